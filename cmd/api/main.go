@@ -1,13 +1,23 @@
 // Package main is the entry point for the User Management API.
+//
+// @title User Management API
+// @version 1.0
+// @description Users, teams, authentication, settings, templates and communications.
+// @BasePath /api/v1
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token as "Bearer <token>"
 package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,98 +26,193 @@ import (
 	"github.com/redis/go-redis/v9"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"github.com/white/user-management/config"
-	"github.com/white/user-management/internal/events"
-	"github.com/white/user-management/internal/handlers"
-	"github.com/white/user-management/internal/middleware"
-
 	"github.com/white/user-management/internal/cache"
+	"github.com/white/user-management/internal/cache/userscope"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/i18n"
+	"github.com/white/user-management/internal/password"
 	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/routes"
 	"github.com/white/user-management/internal/services"
 	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/clientip"
+	"github.com/white/user-management/pkg/email"
 	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/lifecycle"
 	"github.com/white/user-management/pkg/mongodb"
+	"github.com/white/user-management/pkg/requestid"
+	"github.com/white/user-management/pkg/siem"
+	"github.com/white/user-management/pkg/sms"
 	"github.com/white/user-management/pkg/smtp"
+	"github.com/white/user-management/pkg/storage"
+)
+
+// Per-component shutdown timeouts
+const (
+	workersCloseTimeout = 20 * time.Second // Long enough for an in-flight email send
+	kafkaCloseTimeout   = 15 * time.Second // Producer flushes buffered events for up to 10s
+	redisCloseTimeout   = 5 * time.Second
+	mongoCloseTimeout   = 10 * time.Second
 )
 
+// indexBootstrapTimeout bounds creating every index at startup
+const indexBootstrapTimeout = 2 * time.Minute
+
+// seedTimeout bounds creating the built-in roles and the master admin at startup
+const seedTimeout = 30 * time.Second
+
 func main() {
 	// Load environment variables (ignore error in dev)
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
-	mongoURI := os.Getenv("MONGODB_URL")
-	if mongoURI == "" {
-		log.Fatal("FATAL: MONGODB_URI environment variable is required but not set. Please configure MongoDB connection.")
+	// Load and validate configuration - fail fast with every problem listed
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
 	}
 
 	log.Printf("Connecting to MongoDB...")
 	// Initialize MongoDB client
 	mongoConfig := mongodb.Config{
-		URI:         mongoURI,
-		Database:    getEnvWithDefault("MONGODB_DATABASE", "white-dev"),
-		MaxPoolSize: uint64(getEnvIntWithDefault("MONGODB_MAX_POOL_SIZE", 100)),
-		MinPoolSize: uint64(getEnvIntWithDefault("MONGODB_MIN_POOL_SIZE", 10)),
-		MaxRetries:  getEnvIntWithDefault("MONGODB_MAX_RETRIES", 5),
+		URI:         cfg.MongoDB.URI,
+		Database:    cfg.MongoDB.Database,
+		MaxPoolSize: cfg.MongoDB.MaxPoolSize,
+		MinPoolSize: cfg.MongoDB.MinPoolSize,
+		MaxRetries:  cfg.MongoDB.MaxRetries,
+		TLSCAFile:   cfg.MongoDB.TLSCAFile,
+
+		SecondaryReads: cfg.MongoDB.SecondaryReads,
 	}
 
 	mongoClient, err := mongodb.NewClient(mongoConfig)
 	if err != nil {
 		log.Fatalf("FATAL: Failed to connect to MongoDB: %v. Application cannot start without database.", err)
 	}
-	defer mongoClient.Close()
 	log.Println("Successfully connected to MongoDB")
 
-	// Initialize Kafka producer (optional - gracefully handle if not available)
-	// var kafkaProducer *kafka.Producer
-
-	// Load Kafka configuration from environment
-	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
-	if kafkaBrokers == "" {
-		kafkaBrokers = "localhost:9092" // Default for local development
+	// Index bootstrap - opt-in so production can run it in a maintenance window
+	if cfg.MongoDB.InitIndexes {
+		indexCtx, cancelIndexes := context.WithTimeout(context.Background(), indexBootstrapTimeout)
+		err := repositories.InitIndexes(indexCtx, mongoClient)
+		cancelIndexes()
+		switch {
+		case err != nil && cfg.MongoDB.StrictIndexes:
+			log.Fatalf("FATAL: MongoDB index bootstrap failed: %v", err)
+		case err != nil:
+			log.Println("Warning: some MongoDB indexes could not be created; starting anyway")
+		default:
+			log.Println("MongoDB indexes ensured")
+		}
 	}
 
-	kafkaConfig := config.KafkaConfig{
-		Brokers:       []string{kafkaBrokers},
-		ClientID:      getEnvWithDefault("KAFKA_CLIENT_ID", "white-backend-producer"),
-		Username:      os.Getenv("KAFKA_USER_NAME"),
-		Password:      os.Getenv("KAFKA_PASSWORD"),
-		SSL:           os.Getenv("KAFKA_SSL") == "true",
-		SASLMechanism: getEnvWithDefault("KAFKA_SASL_MECHANISM", "plain"),
-	}
+	// Components are closed in reverse registration order once the server stops
+	closers := lifecycle.NewRegistry()
+	closers.Register("MongoDB client", mongoCloseTimeout, lifecycle.Wrap(mongoClient.Close))
 
-	ctx := context.Background()
-	kafkaProducer, err := kafka.NewProducer(kafkaConfig)
-	if err != nil {
-		log.Printf("Warning: Kafka producer not available: %v. Events will not be published.", err)
-		kafkaProducer = nil // Set to nil so handlers can check
-	} else {
-		log.Println("Connected to Kafka Producer")
-		defer kafkaProducer.Close()
-	}
+	// Initialize Kafka producer - connects lazily and buffers events while the broker is down
+	kafkaProducer := kafka.NewProducer(cfg.Kafka)
+	closers.Register("Kafka producer", kafkaCloseTimeout, lifecycle.Wrap(kafkaProducer.Close))
 
 	// Initialize SMTP client for email sending (Office 365 or other SMTP servers)
 	var smtpClient *smtp.SMTPClient
-	smtpHost := os.Getenv("SMTP_HOST")
-	if smtpHost != "" {
-		var err error
-		smtpClient, err = smtp.NewSMTPClientFromEnv()
-		if err != nil {
-			log.Printf("Warning: SMTP client initialization failed: %v. SMTP email will not be available.", err)
-			smtpClient = nil
+	if cfg.SMTP.Host != "" {
+		smtpClient = smtp.NewSMTPClient(&smtp.SMTPConfig{
+			Host:       cfg.SMTP.Host,
+			Port:       cfg.SMTP.Port,
+			Username:   cfg.SMTP.Username,
+			Password:   cfg.SMTP.Password,
+			FromEmail:  cfg.SMTP.FromEmail,
+			ReplyTo:    cfg.SMTP.ReplyTo,
+			TLSEnabled: cfg.SMTP.TLSEnabled,
+
+			MaxAttachmentBytes: int64(cfg.SMTP.MaxAttachmentMB) << 20,
+		})
+		log.Printf("SMTP email client initialized (host: %s, from: %s)", cfg.SMTP.Host, smtpClient.GetFromEmail())
+
+		// DKIM signing (optional - for relays that do not sign for us)
+		if cfg.SMTP.DKIMDomain != "" {
+			// A key given in the environment may have its line breaks escaped
+			keyPEM := []byte(strings.ReplaceAll(cfg.SMTP.DKIMPrivateKey, `\n`, "\n"))
+			if cfg.SMTP.DKIMPrivateKeyPath != "" {
+				if keyPEM, err = os.ReadFile(cfg.SMTP.DKIMPrivateKeyPath); err != nil {
+					log.Fatalf("FATAL: Failed to read DKIM private key: %v", err)
+				}
+			}
+			signer, err := smtp.NewDKIMSigner(cfg.SMTP.DKIMDomain, cfg.SMTP.DKIMSelector, keyPEM)
+			if err != nil {
+				log.Fatalf("FATAL: %v", err)
+			}
+			smtpClient.SetDKIMSigner(signer)
+			if err := smtpClient.VerifySigning(); err != nil {
+				log.Fatalf("FATAL: DKIM signing check failed: %v", err)
+			}
+			log.Printf("DKIM signing enabled (domain: %s, key published at %s)", signer.Domain(), signer.RecordName())
+			// DMARC counts a signature of the sender's domain or a parent of it
+			fromDomain := strings.ToLower(smtpClient.GetFromEmail()[strings.LastIndex(smtpClient.GetFromEmail(), "@")+1:])
+			if dkimDomain := strings.ToLower(signer.Domain()); fromDomain != dkimDomain && !strings.HasSuffix(fromDomain, "."+dkimDomain) {
+				log.Printf("Warning: the sender %s is not in the DKIM domain %s; receivers enforcing DMARC will not count the signature", smtpClient.GetFromEmail(), signer.Domain())
+			}
 		} else {
-			log.Printf("SMTP email client initialized (host: %s, from: %s)", smtpHost, smtpClient.GetFromEmail())
+			log.Println("Warning: SMTP_DKIM_DOMAIN not configured. SMTP email will not be DKIM-signed unless the relay signs it.")
 		}
 	} else {
 		log.Println("Warning: SMTP_HOST not configured. SMTP email will not be available.")
 	}
 
+	// Attachment contents live in GridFS; messages reference them by location
+	attachmentStorage := storage.NewGridFSStorage(mongoClient.DB, "attachments")
+	loadAttachment := func(ref string) ([]byte, error) {
+		return storage.ReadAll(context.Background(), attachmentStorage, ref, 30*time.Second)
+	}
+	if smtpClient != nil {
+		smtpClient.SetAttachmentLoader(loadAttachment)
+	}
+
+	// Email open/click tracking (optional - only for users whose preferences allow it)
+	var emailTracker *smtp.Tracker
+	if cfg.Tracking.Enabled() {
+		emailTracker = smtp.NewTracker(cfg.Tracking.BaseURL, []byte(cfg.Tracking.Secret))
+		if smtpClient != nil {
+			smtpClient.SetTracker(emailTracker)
+		}
+		log.Printf("Email tracking enabled (base URL: %s)", cfg.Tracking.BaseURL)
+	} else {
+		log.Println("TRACKING_BASE_URL not configured. Email open/click tracking is disabled.")
+	}
+
+	// Email provider used by handlers (EMAIL_PROVIDER; logging sender in development)
+	var emailSender email.EmailSender
+	switch cfg.Email.Provider {
+	case config.EmailProviderSMTP:
+		emailSender = email.NewSMTPSender(smtpClient)
+	case config.EmailProviderSendGrid:
+		emailSender = email.NewSendGridSender(email.SendGridConfig{
+			APIKey:             cfg.Email.SendGridAPIKey,
+			APIURL:             cfg.Email.SendGridAPIURL,
+			FromEmail:          cfg.Email.FromEmail,
+			FromName:           cfg.Email.FromName,
+			MaxAttachmentBytes: int64(cfg.SMTP.MaxAttachmentMB) << 20,
+			AttachmentLoader:   loadAttachment,
+		})
+	default:
+		emailSender = email.NewLogSender(cfg.Email.FromEmail)
+		log.Println("Warning: no email provider configured. Emails will be logged, not sent.")
+	}
+	// Daily and monthly send limits; urgent emails are never held back
+	emailQuota := services.NewEmailQuota(repositories.NewSettingsRepository(mongoClient), repositories.NewEmailUsageRepository(mongoClient))
+	emailSender = email.WithQuota(emailSender, emailQuota)
+	// Addresses that hard-bounced are skipped on every send
+	emailSender = email.WithSuppression(emailSender, repositories.NewEmailSuppressionRepository(mongoClient))
+	emailQuota.SetAlertSender(emailSender)
+	log.Printf("Email provider: %s", emailSender.Name())
+
 	// Initialize Redis client for caching (optional - gracefully handle if not configured)
 	var redisClient *redis.Client
 	var templateCache *cache.TemplateCache
-	redisURL := os.Getenv("REDIS_URL")
-
-	if redisURL != "" {
-		opt, err := redis.ParseURL(redisURL)
+	if cfg.Redis.URL != "" {
+		opt, err := redis.ParseURL(cfg.Redis.URL)
 		if err != nil {
 			log.Printf("Warning: Failed to parse Redis URL: %v. Caching will not be available.", err)
 		} else {
@@ -119,7 +224,8 @@ func main() {
 				log.Printf("Warning: Redis connection failed: %v. Caching will not be available.", err)
 				redisClient = nil
 			} else {
-				templateCache = cache.NewTemplateCache(redisClient)
+				closers.Register("Redis client", redisCloseTimeout, lifecycle.Wrap(redisClient.Close))
+				templateCache = cache.NewTemplateCache(redisClient, cfg.Templates.CacheTTL, cfg.Templates.ListCacheTTL)
 				log.Println("Redis client initialized (caching enabled)")
 			}
 		}
@@ -127,58 +233,97 @@ func main() {
 		log.Println("Warning: REDIS_URL not configured. Caching will not be available.")
 	}
 
-	// Prevent "declared and not used" errors for optional external clients
-	_ = templateCache
-	// Audit Publisher (fire-and-forget Kafka events for audit log)
+	// Domain events are recorded in the events outbox and relayed to Kafka in order
+	eventOutbox := repositories.NewEventOutboxRepository(mongoClient)
+
+	// Audit Publisher (fire-and-forget Kafka events for audit log; team changes via the outbox)
 	auditPublisher := events.NewAuditPublisher(kafkaProducer)
+	auditPublisher.SetRecorder(eventOutbox)
 	log.Println("Audit publisher initialized (audit events via Kafka)")
 
-	// =====================================================
-	// MONGODB REPOSITORIES
-	// =====================================================
-	// Initialize MongoDB repositories (MongoDB-based)
-
-	// mongoUserRepo := repositories.NewMongoUserRepository(mongoClient)
-	// Settings repository (User Settings, Company Settings, Notifications, Audit Logs)
-	settingsRepo := repositories.NewSettingsRepository(mongoClient)
-	// Permission repository (RBAC - Role-Based Access Control)
-	permissionRepo := repositories.NewPermissionRepository(mongoClient)
-
-	scheduleDefinitionRepo := repositories.NewScheduleDefinitionRepository(mongoClient)
-	mongoActivityRepo := repositories.NewMongoActivityRepository(mongoClient)
-
-	// log.Println("MongoDB repositories initialized (all modules including Phase 3)")
-	// emailRepo := repositories.NewMongoEmailRepository(mongoClient)
-
-	// =====================================================
-	// COMMENTED OUT: Legacy services (removed)
-	// =====================================================
-
-	// emailThreadingService := services.NewEmailThreadingService(emailRepo)
-	// Event Publisher Service (Communications Hub - Kafka Event Publishing)
-	// _ = services.NewEventPublisher(kafkaProducer)
-	// log.Println("Event publisher service initialized")
+	// Audit events are also sent to the security team's SIEM when configured
+	auditForwarder := newAuditForwarder(cfg)
+	auditPublisher.SetForwarder(auditForwarder)
 
 	// RBAC Service (Role-Based Access Control with Redis caching)
+	permissionRepo := repositories.NewPermissionRepository(mongoClient)
 	rbacService := services.NewRBACService(permissionRepo, redisClient)
+	rbacService.SetUserStore(repositories.NewMongoUserRepository(mongoClient))
+	// Per-user roles, grants and data scopes and team member lists, shared
+	// through Redis so an admin's change applies on every instance at once
+	if redisClient != nil {
+		rbacService.SetScopeCache(userscope.NewRedis(redisClient, cfg.ScopeCache.TTL))
+	} else {
+		rbacService.SetScopeCache(userscope.NewMemory(cfg.ScopeCache.Size, cfg.ScopeCache.TTL))
+	}
 	log.Println("RBAC Service initialized with Redis caching")
 
-	// =====================================================
-	// MONGODB HANDLERS (TASK GROUP 1: MongoDB Migration Complete)
-	// =====================================================
-	// Initialize MongoDB handlers (using MongoDB repositories)
-	// Settings handler (User Profile, Security, Email Signature, Company, Notifications, Audit Logs, Approval Rules)
-	settingsHandler := handlers.NewSettingsHandler(settingsRepo,auditPublisher)
-	log.Println("Settings Module handler initialized")
+	// Initialize JWT service
+	jwtService, err := utils.NewJWTService(cfg.JWT)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT service: %v", err)
+	}
+	log.Printf("JWT service initialized (signing algorithm: %s, key id: %s)", jwtService.Algorithm(), jwtService.KeyID())
+	log.Printf("JWT HS256 shared secret configured: %t", cfg.JWT.SharedSecret != "")
 
+	// Password hashing at the configured bcrypt cost
+	passwords, err := password.New(cfg.App.PasswordHashCost)
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	// Built-in roles, one per user role, where existing ones keep their
+	// permissions; and the master admin while no admin exists
+	masterAdminSeed := services.NewMasterAdminSeed(repositories.NewMongoUserRepository(mongoClient), permissionRepo, passwords, auditPublisher, os.Stdout)
+	seedCtx, cancelSeed := context.WithTimeout(context.Background(), seedTimeout)
+	seeded, err := masterAdminSeed.Seed(seedCtx, cfg.Accounts.MasterAdminEmail, cfg.Accounts.MasterAdminName, cfg.Accounts.MasterAdminPassword)
+	cancelSeed()
+	if seeded.RolesCreated > 0 {
+		log.Printf("Seeded %d built-in roles", seeded.RolesCreated)
+	}
+	switch {
+	case errors.Is(err, services.ErrMasterAdminEmailMissing):
+		log.Printf("Warning: %v; set it and restart to create the master admin, nobody can sign in until then", err)
+	case err != nil:
+		log.Printf("Warning: failed to seed the built-in roles and master admin: %v", err)
+	case seeded.Admin != nil:
+		log.Printf("Master admin %s created; it must change its password at the first sign-in", seeded.Admin.Email)
+	}
 
-	schedulerHandler := handlers.NewSchedulerHandler(scheduleDefinitionRepo, mongoActivityRepo)
+	// 2FA, password reset and invitation emails, from their published
+	// overrides in the templates collection or the embedded defaults, in the
+	// branding kept in the company info
+	emailBranding := services.NewEmailBranding(repositories.NewSettingsRepository(mongoClient), cfg.Email.FromName)
+	systemEmails := services.NewSystemEmails(repositories.NewMongoTemplateRepository(mongoClient), cfg.Email.FromEmail, cfg.Email.FromName)
+	systemEmails.SetBranding(emailBranding)
 
 	// Initialize router
 	router := mux.NewRouter()
 
 	// Add CORS middleware (must be first to handle preflight OPTIONS requests)
-	router.Use(corsMiddleware)
+	cors := corsMiddleware(cfg.CORS.AllowedOrigins)
+	router.Use(cors)
+
+	// Resolve client IPs once per request, believing forwarding headers only
+	// from the configured proxies
+	clientIPs, err := clientip.NewResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+	router.Use(clientIPs.Middleware)
+
+	// Tag every request with an ID, carried into audit records
+	router.Use(requestid.Middleware)
+
+	// Error messages and system emails in the language of Accept-Language,
+	// or of the user's preferences on authenticated routes
+	router.Use(i18n.Middleware)
+	untranslated := i18n.Untranslated()
+	for _, locale := range i18n.Locales() {
+		if keys := untranslated[locale]; len(keys) > 0 {
+			log.Printf("Warning: the %s catalog lacks %d translations, shown in English: %s", locale, len(keys), strings.Join(keys, "; "))
+		}
+	}
 
 	// Custom NotFoundHandler with CORS headers (for routes that don't exist)
 	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -199,114 +344,271 @@ func main() {
 		w.Write([]byte(`{"error":{"code":"NOT_FOUND","message":"Endpoint not found"}}`))
 	})
 
-	// API v1 routes
-	api := router.PathPrefix("/api/v1").Subrouter()
-
-	// Health check endpoints
-	router.HandleFunc("/health", handlers.GetOverallHealth).Methods("GET", "OPTIONS")
-
-	//Swagger ui endpoint - API documentation
-	router.PathPrefix("swagger").Handler(httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8080/swagger/doc.json"), // The url pointing to API definition
-		httpSwagger.DeepLinking(true),
-		httpSwagger.DocExpansion("none"),
-		httpSwagger.DomID("swagger-ui"),
-	)).Methods(http.MethodGet)
-
-	// Initialize JWT config
-	cfg := &config.Config{
-		JWT: config.JWTConfig{
-			PrivateKeyPath:     "./secrets/jwt/private.pem",
-			PublicKeyPath:      "./secrets/jwt/public.pem",
-			AccessTokenExpiry:  2880, // 2 days (48 hours) in minutes for development
-			RefreshTokenExpiry: 7,    // 7 days
-			SharedSecret:       firstNonEmpty(os.Getenv("JWT_SHARED_SECRET"), os.Getenv("JWT_SECRET")),
-		},
-		Server: config.ServerConfig{
-			Environment: "development",
-		},
+	// Swagger UI - API documentation generated by make swagger
+	if cfg.Server.SwaggerEnabled {
+		router.HandleFunc("/swagger/doc.json", serveSwaggerSpec).Methods(http.MethodGet)
+		router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
+			httpSwagger.URL("doc.json"), // Relative, so it works behind any host or proxy
+			httpSwagger.DeepLinking(true),
+			httpSwagger.DocExpansion("none"),
+			httpSwagger.DomID("swagger-ui"),
+		)).Methods(http.MethodGet)
 	}
 
-	// Initialize JWT service
-	jwtService, err := utils.NewJWTService(cfg.JWT)
-	if err != nil {
-		log.Fatalf("Failed to initialize JWT service: %v", err)
+	// System emails (2FA, password reset, invitations) are queued on Kafka when the worker is enabled
+	emailQueue := services.NewEmailQueue(kafkaProducer, cfg)
+
+	// Notifications to users, by email and in-app, as their notification settings allow
+	notificationService := services.NewNotificationService(
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		repositories.NewNotificationRepository(mongoClient),
+		repositories.NewMongoEmailRepository(mongoClient),
+		emailSender,
+		emailQueue,
+	)
+	pendingNotifications := repositories.NewPendingNotificationRepository(mongoClient)
+	notificationService.SetDigests(pendingNotifications, cfg.Digest.Window)
+
+	// Weekly activity reports, on the weekday set in the system email notification settings
+	weeklyReports := services.NewWeeklyReportJob(
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewMongoActivityRepository(mongoClient),
+		repositories.NewMongoEmailRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		repositories.NewReportRunRepository(mongoClient),
+		notificationService,
+		cfg.Reports.WeeklyCheckInterval,
+		cfg.Reports.WeeklySendHour,
+	)
+	weeklyReports.SetBranding(emailBranding)
+
+	// OpenID Connect sign-in, turned on by SSOEnabled in the security settings
+	var ssoService *services.SSOService
+	if cfg.OIDC.Enabled() {
+		ssoService = services.NewSSOService(
+			utils.NewOIDCProvider(utils.OIDCProviderConfig{
+				IssuerURL:    cfg.OIDC.IssuerURL,
+				ClientID:     cfg.OIDC.ClientID,
+				ClientSecret: cfg.OIDC.ClientSecret,
+				RedirectURL:  cfg.OIDC.RedirectURL,
+				ClockSkew:    cfg.OIDC.ClockSkew,
+			}),
+			repositories.NewSSOStateRepository(mongoClient),
+			repositories.NewMongoUserRepository(mongoClient),
+			repositories.NewSettingsRepository(mongoClient),
+			cfg.OIDC.StateTTL,
+		)
+		log.Printf("SSO: OpenID Connect provider %s", cfg.OIDC.IssuerURL)
 	}
-	log.Println("JWT service initialized")
-	log.Printf("JWT HS256 shared secret configured: %t", cfg.JWT.SharedSecret != "")
 
-	// Initialize JWT middleware (and load DB-backed RBAC context for authZ)
-	baseAuthMiddleware := middleware.JWTAuthDualAlg(jwtService, nil, cfg.JWT.SharedSecret)
-	authMiddleware := func(h http.Handler) http.Handler {
-		return baseAuthMiddleware(middleware.RBACContext(rbacService)(h))
-	}
-	// Convenience wrapper: auth + permission check (RBAC)
-	requirePerm := func(permission string, hf http.HandlerFunc) http.Handler {
-		return authMiddleware(middleware.RequirePermission(permission)(http.HandlerFunc(hf)))
-	}
-
-	// Prevent "declared and not used" errors (Task Group 1)
-	_ = api            // Will be used in future task groups for route registration
-	_ = authMiddleware // Will be used in future task groups for protected routes
-	_ = requirePerm
-
-	// =====================================================
-	// Authentication Routes (MongoDB-based)
-	// =====================================================
-	authHandler := handlers.NewAuthHandler(mongoClient, cfg, kafkaProducer)
-	authHandler.SetAuditPublisher(auditPublisher)
-	api.HandleFunc("/auth/login", authHandler.Login).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/verify-2fa", authHandler.Verify2FA).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/password/change", authHandler.ChangePassword).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/password/forgot", authHandler.ForgotPassword).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/password/reset", authHandler.ResetPassword).Methods("POST", "OPTIONS")
-
-	// api.HandleFunc("/create/new-user", authHandler.CreateUser).Methods("POST", "OPTIONS")
-
-	teamHandler := handlers.NewTeamHandler(mongoClient, smtpClient, kafkaProducer,auditPublisher)
-	api.Handle("/team/members", authMiddleware(http.HandlerFunc(teamHandler.ListTeamMembers))).Methods("GET", "OPTIONS")
-	api.Handle("/team/members/{id}", authMiddleware(http.HandlerFunc(teamHandler.GetTeamMember))).Methods("GET", "OPTIONS")
-	api.Handle("/team/members/invite", authMiddleware(http.HandlerFunc(teamHandler.InviteTeamMember))).Methods("POST", "OPTIONS")
-	api.Handle("/team/members/{id}", authMiddleware(http.HandlerFunc(teamHandler.UpdateTeamMember))).Methods("PUT", "OPTIONS")
-	api.Handle("/team/members/{id}/deactivate", authMiddleware(http.HandlerFunc(teamHandler.DeactivateTeamMember))).Methods("POST", "OPTIONS")
-	api.Handle("/team/members/{id}/reactivate", authMiddleware(http.HandlerFunc(teamHandler.ReactivateTeamMember))).Methods("POST", "OPTIONS")
-	api.Handle("/team/members/{id}", authMiddleware(http.HandlerFunc(teamHandler.DeleteTeamMember))).Methods("DELETE", "OPTIONS")
-	api.Handle("/auth/verify-invite", http.HandlerFunc(teamHandler.VerifyInviteToken)).Methods("GET", "OPTIONS")
-	api.Handle("/auth/complete-signup", http.HandlerFunc(teamHandler.CompleteSignup)).Methods("POST", "OPTIONS")
-
-	// ----- Settings Module Routes -----
-	// User Settings (Profile is read-only - managed by O365)
-	api.Handle("/settings/profile", authMiddleware(http.HandlerFunc(settingsHandler.GetProfile))).Methods("GET", "OPTIONS")
-
-	// System Settings (Admin)
-	api.Handle("/system/company", authMiddleware(http.HandlerFunc(settingsHandler.GetCompanyInfo))).Methods("GET", "OPTIONS")
-	api.Handle("/system/company", authMiddleware(http.HandlerFunc(settingsHandler.UpdateCompanyInfo))).Methods("PUT", "OPTIONS")
-	api.Handle("/system/notifications", authMiddleware(http.HandlerFunc(settingsHandler.GetNotificationSettings))).Methods("GET", "OPTIONS")
-	api.Handle("/system/notifications", authMiddleware(http.HandlerFunc(settingsHandler.UpdateNotificationSettings))).Methods("PUT", "OPTIONS")
-	api.Handle("/system/audit-logs", authMiddleware(http.HandlerFunc(settingsHandler.GetAuditLogs))).Methods("GET", "OPTIONS")
-
-	// ==================================
-	// Multi-Channel Campaign CRUD Routes 
-	// ==================================
-
-	// Campaign Schedule Definitions - MUST come BEFORE /campaigns/{id} to avoid route conflict
-	api.Handle("/campaigns/schedule-definitions", authMiddleware(http.HandlerFunc(schedulerHandler.GetScheduleDefinitions))).Methods("GET", "OPTIONS")           // Get campaign schedule definitions for dropdown selection
-	api.Handle("/campaigns/schedule-definitions", authMiddleware(http.HandlerFunc(schedulerHandler.CreateScheduleDefinition))).Methods("POST", "OPTIONS")        // Create new schedule definition
-	api.Handle("/campaigns/schedule-definitions/{id}", authMiddleware(http.HandlerFunc(schedulerHandler.UpdateScheduleDefinition))).Methods("PUT", "OPTIONS")    // Update schedule definition
-	api.Handle("/campaigns/schedule-definitions/{id}", authMiddleware(http.HandlerFunc(schedulerHandler.DeleteScheduleDefinition))).Methods("DELETE", "OPTIONS") // Delete schedule definition
-	log.Println("Campaign Schedule Definition CRUD routes registered (4 endpoints)")
-
-	log.Println("Background workers run in go-worker (separate process)")
+	// Webhook deliveries of user lifecycle events from the events outbox
+	webhookDispatcher := services.NewWebhookDispatcher(
+		repositories.NewWebhookRepository(mongoClient),
+		eventOutbox,
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		emailSender,
+		cfg.Webhooks.PollInterval,
+		cfg.Webhooks.Timeout,
+		cfg.Webhooks.MaxAttempts,
+		cfg.Webhooks.MaxConsecutiveFailures,
+	)
+
+	// Text messages for 2FA codes, for users who chose SMS
+	var smsSender sms.Sender
+	switch cfg.SMS.Provider {
+	case config.SMSProviderTwilio:
+		smsSender = sms.NewTwilioSender(sms.TwilioConfig{
+			AccountSID: cfg.SMS.TwilioAccountSID,
+			AuthToken:  cfg.SMS.TwilioAuthToken,
+			APIURL:     cfg.SMS.TwilioAPIURL,
+			From:       cfg.SMS.FromNumber,
+			Timeout:    cfg.SMS.Timeout,
+		})
+	default:
+		smsSender = sms.NewLogSender()
+		log.Println("Warning: no SMS provider configured. Text messages will be logged, not sent.")
+	}
+	smsCodes := services.NewSMSCodes(smsSender, cfg.Email.FromName, cfg.SMS.Timeout, cfg.SMS.FallbackToEmail)
+	log.Printf("SMS provider: %s (email fallback: %t)", smsSender.Name(), cfg.SMS.FallbackToEmail)
+
+	// Sign-in attempts, stored in the background so they never hold up a sign-in
+	loginHistory := services.NewLoginHistoryRecorder(repositories.NewLoginHistoryRepository(mongoClient))
+
+	// Last use of each session, for the inactivity timeout of the security settings
+	sessionActivity := services.NewSessionActivity(repositories.NewSessionRepository(mongoClient), repositories.NewSettingsRepository(mongoClient))
+
+	// When each user was last seen, written at most every few minutes and
+	// throttled across instances through Redis when it is available
+	presence := services.NewPresence(repositories.NewMongoUserRepository(mongoClient))
+	if redisClient != nil {
+		presence.SetRedis(redisClient)
+	}
+
+	// Working hours of the system default settings, outside which outbound
+	// messages that are not urgent wait
+	sendWindow := services.NewSendWindowEnforcer(repositories.NewSettingsRepository(mongoClient))
+
+	// Self-service account deactivation and deletion; the deletion sweep
+	// below anonymizes accounts once their grace period is over
+	accountClosing := services.NewAccountClosing(
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		repositories.NewAccountDeletionRepository(mongoClient),
+		eventOutbox,
+		auditPublisher,
+		passwords,
+		cfg.Accounts.DeletionGraceDays,
+		cfg.Accounts.DeletionSweepInterval,
+	)
+
+	// Requests refused for a missing permission or role are audited; users
+	// denied too often are throttled and reported to the system notification
+	// address
+	permissionDenials := services.NewPermissionDenials(
+		repositories.NewPermissionDenialRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		auditPublisher,
+		cfg.Security.DenialLimit,
+		cfg.Security.DenialWindow,
+	)
+	permissionDenials.SetAlertSender(emailSender)
+
+	// Distribution lists are resolved to their members' addresses when a
+	// message to them is sent, now or by the outbox worker
+	distributionLists := services.NewDistributionLists(
+		repositories.NewDistributionListRepository(mongoClient),
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewEmailSuppressionRepository(mongoClient),
+	)
+
+	// Register all API routes from a single dependency container
+	routes.RegisterRoutes(router, &routes.Dependencies{
+		Config:         cfg,
+		MongoClient:    mongoClient,
+		KafkaProducer:  kafkaProducer,
+		EmailSender:    emailSender,
+		RedisClient:    redisClient,
+		TemplateCache:  templateCache,
+		AuditPublisher: auditPublisher,
+		JWTService:     jwtService,
+		RBACService:    rbacService,
+		EmailTracker:   emailTracker,
+		EmailQueue:     emailQueue,
+		Notifications:  notificationService,
+		WeeklyReports:  weeklyReports,
+		EmailQuota:     emailQuota,
+		SSO:            ssoService,
+		Webhooks:       webhookDispatcher,
+		Passwords:      passwords,
+		SystemEmails:   systemEmails,
+		EmailBranding:  emailBranding,
+		LoginHistory:   loginHistory,
+		SMSCodes:       smsCodes,
+		AuditForwarder: auditForwarder,
+		Sessions:       sessionActivity,
+		Presence:       presence,
+		Languages:      services.NewUserLanguages(repositories.NewMongoUserRepository(mongoClient)),
+		SendWindow:     sendWindow,
+		AccountClosing: accountClosing,
+		Denials:        permissionDenials,
+		Lists:          distributionLists,
+
+		AttachmentStorage: attachmentStorage,
+	})
+	// Routes missing from the OpenAPI contract fail make build; say so here
+	// too, for builds that skipped it
+	if err := routes.VerifyContract(router); err != nil {
+		log.Printf("Warning: the API contract at /openapi.json is out of date:\n%v", err)
+	}
+
+	// Background workers stop first on shutdown, finishing their current item
+	workers := lifecycle.NewWorkers()
+	closers.Register("background workers", workersCloseTimeout, workers.Close)
+
+	// Template trash retention sweep
+	trashPurger := services.NewTemplateTrashPurger(
+		repositories.NewMongoTemplateRepository(mongoClient),
+		templateCache,
+		eventOutbox,
+		cfg.Templates.TrashRetentionDays,
+		cfg.Templates.TrashSweepInterval,
+	)
+	workers.Go(trashPurger.Run)
+	log.Printf("Template trash purge scheduled (retention: %d days, every %s)", cfg.Templates.TrashRetentionDays, cfg.Templates.TrashSweepInterval)
+
+	// Account deletion sweep
+	workers.Go(accountClosing.Run)
+	log.Printf("Account deletion sweep scheduled (grace period: %d days, every %s)", cfg.Accounts.DeletionGraceDays, cfg.Accounts.DeletionSweepInterval)
+
+	workers.Go(loginHistory.Run)
+
+	if auditForwarder != nil {
+		workers.Go(auditForwarder.Run)
+	}
+
+	workers.Go(weeklyReports.Run)
+	log.Printf("Weekly report job scheduled (checking every %s, sending from %02d:00 org time)", cfg.Reports.WeeklyCheckInterval, cfg.Reports.WeeklySendHour)
+
+	workers.Go(webhookDispatcher.Run)
+	log.Printf("Webhook dispatcher started (every %s, max %d attempts)", cfg.Webhooks.PollInterval, cfg.Webhooks.MaxAttempts)
+
+	// Notification digests - emails held per recipient and type, sent together
+	notificationDigests := services.NewNotificationDigests(notificationService, pendingNotifications, cfg.Digest.FlushInterval, cfg.Digest.Lease)
+	workers.Go(notificationDigests.Run)
+	log.Printf("Notification digests scheduled (default window %s, every %s)", cfg.Digest.Window, cfg.Digest.FlushInterval)
+
+	// Events outbox relay - without brokers events stay recorded until Kafka is configured
+	if kafkaProducer.Enabled() {
+		eventRelay := services.NewEventOutboxRelay(eventOutbox, kafkaProducer, cfg.Kafka.OutboxPollInterval)
+		eventRelay.SetMaxAttempts(cfg.Kafka.OutboxMaxAttempts)
+		workers.Go(eventRelay.Run)
+		log.Printf("Event outbox relay started (every %s, refused events set aside after %d attempts)", cfg.Kafka.OutboxPollInterval, cfg.Kafka.OutboxMaxAttempts)
+	}
+
+	// Orphaned attachment sweep - files of deleted messages
+	attachmentPurger := services.NewAttachmentPurger(
+		repositories.NewMongoEmailRepository(mongoClient),
+		attachmentStorage,
+		cfg.Attachments.OrphanSweepInterval,
+	)
+	workers.Go(attachmentPurger.Run)
+	log.Printf("Orphaned attachment purge scheduled (every %s)", cfg.Attachments.OrphanSweepInterval)
+
+	// Email outbox retries - only useful when the provider actually delivers
+	if emailSender.Capabilities().Delivers {
+		outboxWorker := services.NewEmailOutboxWorker(
+			repositories.NewMongoEmailRepository(mongoClient),
+			emailSender,
+			kafkaProducer,
+			cfg.Outbox,
+		)
+		outboxWorker.SetSendWindow(sendWindow)
+		outboxWorker.SetDistributionLists(distributionLists)
+		workers.Go(outboxWorker.Run)
+		log.Printf("Email outbox worker started (every %s, max %d attempts)", cfg.Outbox.PollInterval, cfg.Outbox.MaxAttempts)
+	}
+
+	// Email queue worker - sends the system emails queued above
+	if emailQueue != nil {
+		emailWorker := services.NewEmailQueueWorker(
+			repositories.NewMongoEmailRepository(mongoClient),
+			emailSender,
+			kafkaProducer,
+			cfg,
+		)
+		workers.Go(emailWorker.Run)
+		log.Printf("Email queue worker started (topics: %s, %s; max %d attempts)", cfg.Kafka.Topics.EmailQueuedUrgent, cfg.Kafka.Topics.EmailQueued, cfg.Worker.MaxAttempts)
+	}
 
 	// HTTP server configuration
 	srv := &http.Server{
-		Addr:         ":" + getEnvWithDefault("PORT", "8080"),
-		Handler:      corsMiddleware(router),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:         ":" + cfg.Server.Port,
+		Handler:      cors(router),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
 	// Start server
@@ -317,6 +619,19 @@ func main() {
 		}
 	}()
 
+	// Reload JWT keys on SIGHUP (key rotation without restart)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := jwtService.ReloadKeys(); err != nil {
+				log.Printf("Warning: JWT key reload failed, keeping current keys: %v", err)
+				continue
+			}
+			log.Printf("JWT keys reloaded (signing key: %s, verification keys: %v)", jwtService.KeyID(), jwtService.VerificationKeyIDs())
+		}
+	}()
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -324,86 +639,107 @@ func main() {
 
 	log.Println("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
-	}
-
-	log.Println("Server stopped")
-}
-
-// getEnvIntWithDefault gets an environment variable as int or returns a default value
-func getEnvIntWithDefault(key string, defaultValue int) int {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+		log.Printf("Warning: server forced to shutdown: %v", err)
 	}
 
-	intValue := 0
-	_, err := fmt.Sscanf(value, "%d", &intValue)
-	if err != nil {
-		log.Printf("Warning: Invalid integer value for %s: %v, using default: %d", key, value, defaultValue)
-		return defaultValue
+	// Stop workers, flush events published by the last requests, then
+	// disconnect - each step bounded, all within a fresh shutdown deadline
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelClose()
+	if err := closers.Close(closeCtx); err != nil {
+		log.Printf("Warning: shutdown incomplete: %v", err)
 	}
-	return intValue
-}
 
-// getEnvWithDefault returns an environment variable or a default value.
-func getEnvWithDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+	log.Println("Server stopped")
 }
 
-// firstNonEmpty returns the first non-empty string from the provided values.
-func firstNonEmpty(values ...string) string {
-	for _, v := range values {
-		if v != "" {
-			return v
+// newAuditForwarder creates the forwarder of audit events to the configured
+// SIEM, or nil when forwarding is off
+func newAuditForwarder(cfg *config.Config) *siem.Forwarder {
+	fc := cfg.AuditForward
+	var transport siem.Transport
+	switch fc.Target {
+	case config.AuditForwardSyslog:
+		transport = siem.NewSyslogTransport(siem.SyslogConfig{
+			Address: fc.SyslogAddress,
+			TLS:     fc.SyslogTLS,
+			Timeout: fc.Timeout,
+		})
+	case config.AuditForwardHTTPS:
+		contentType := "application/json"
+		if fc.Format == siem.FormatCEF {
+			contentType = "text/plain"
 		}
+		transport = siem.NewHTTPSTransport(siem.HTTPSConfig{
+			URL:         fc.HTTPSURL,
+			AuthHeader:  fc.AuthHeader,
+			AuthValue:   fc.AuthToken,
+			ContentType: contentType,
+			Timeout:     fc.Timeout,
+		})
+	default:
+		return nil
 	}
-	return ""
-}
 
-// corsMiddleware adds CORS headers to responses.
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
+	log.Printf("Audit events forwarded to %s as %s (dry run: %t)", transport.Name(), fc.Format, fc.DryRun)
+	return siem.NewForwarder(transport, siem.ForwarderConfig{
+		Format:         fc.Format,
+		BufferSize:     fc.BufferSize,
+		MaxRetries:     fc.MaxRetries,
+		DryRun:         fc.DryRun,
+		ProductVersion: cfg.Server.Version,
+	})
+}
 
-		allowedOrigins := []string{
-			"http://localhost:3000",
-			"https://electric-exciting-shepherd.ngrok-free.app",
-			"http://localhost:5173",
-			"http://localhost:5174",
-			"http://localhost:5175",
-		}
+// corsMiddleware returns a middleware that adds CORS headers for the allowed origins.
+func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+
+			originAllowed := false
+			for _, allowed := range allowedOrigins {
+				if origin == allowed {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					originAllowed = true
+					break
+				}
+			}
 
-		originAllowed := false
-		for _, allowed := range allowedOrigins {
-			if origin == allowed {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				originAllowed = true
-				break
+			if !originAllowed && origin != "" {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
 			}
-		}
 
-		if !originAllowed && origin != "" {
-			http.Error(w, "Origin not allowed", http.StatusForbidden)
-			return
-		}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
 
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// swaggerSpecPath is where make swagger writes the OpenAPI spec
+const swaggerSpecPath = "docs/swagger/swagger.json"
+
+// serveSwaggerSpec serves the generated spec to the Swagger UI
+func serveSwaggerSpec(w http.ResponseWriter, r *http.Request) {
+	if _, err := os.Stat(swaggerSpecPath); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":"NOT_FOUND","message":"API documentation has not been generated, run make swagger"}}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, r, swaggerSpecPath)
 }
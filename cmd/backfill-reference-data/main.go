@@ -0,0 +1,100 @@
+// Command backfill-reference-data registers every region and team that
+// users are currently assigned to as an active reference entry, so the
+// validation of region and team values does not reject existing data.
+//
+// Values are registered in their canonical lower case form, and users
+// holding another spelling of a code are moved to it. Values that are not
+// valid codes (spaces, punctuation) are only reported; fix them by hand.
+// The invitation defaults pan_india and sales are registered too. It can be
+// re-run safely; entries already registered are left as they are.
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/mongodb"
+)
+
+// invitationDefaults are the codes the team invitation falls back to
+var invitationDefaults = map[string]string{
+	models.ReferenceKindRegions: "pan_india",
+	models.ReferenceKindTeams:   "sales",
+}
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	mongoClient, err := mongodb.NewClient(mongodb.Config{
+		URI:         cfg.MongoDB.URI,
+		Database:    cfg.MongoDB.Database,
+		MaxPoolSize: cfg.MongoDB.MaxPoolSize,
+		MinPoolSize: cfg.MongoDB.MinPoolSize,
+		MaxRetries:  cfg.MongoDB.MaxRetries,
+		TLSCAFile:   cfg.MongoDB.TLSCAFile,
+	})
+	if err != nil {
+		log.Fatalf("FATAL: Failed to connect to MongoDB: %v", err)
+	}
+	defer mongoClient.Close()
+
+	ctx := context.Background()
+	repo := repositories.NewReferenceDataRepository(mongoClient)
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	for _, kind := range []string{models.ReferenceKindRegions, models.ReferenceKindTeams} {
+		if err := backfill(ctx, repo, kind); err != nil {
+			log.Fatalf("FATAL: Backfill of %s failed: %v", kind, err)
+		}
+	}
+}
+
+func backfill(ctx context.Context, repo *repositories.ReferenceDataRepository, kind string) error {
+	values, err := repo.DistinctUserCodes(ctx, kind)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	seen := map[string]bool{invitationDefaults[kind]: true}
+	codes := []string{invitationDefaults[kind]}
+	for _, value := range values {
+		code := models.NormalizeReferenceCode(value)
+		if !models.IsValidReferenceCode(code) {
+			log.Printf("%s: skipped %q, not a valid code; reassign its users by hand", kind, value)
+			continue
+		}
+		if code != value {
+			moved, err := repo.ReassignUsers(ctx, kind, value, code, now)
+			if err != nil {
+				return err
+			}
+			log.Printf("%s: moved %d user(s) from %q to %q", kind, moved, value, code)
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+
+	added, err := repo.Register(ctx, kind, codes, now)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s: registered %d of %d code(s) in use, the rest already existed", kind, added, len(codes))
+	return nil
+}
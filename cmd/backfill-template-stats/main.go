@@ -0,0 +1,65 @@
+// Command backfill-template-stats rebuilds the template_stats day buckets from
+// historical communication documents that reference a template.
+//
+// It recomputes whole days and overwrites their buckets, so it can be re-run
+// safely. Run it while sends are quiet: a send recorded between the recount of
+// a day and its write is lost from that day's bucket.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/mongodb"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	mongoClient, err := mongodb.NewClient(mongodb.Config{
+		URI:         cfg.MongoDB.URI,
+		Database:    cfg.MongoDB.Database,
+		MaxPoolSize: cfg.MongoDB.MaxPoolSize,
+		MinPoolSize: cfg.MongoDB.MinPoolSize,
+		MaxRetries:  cfg.MongoDB.MaxRetries,
+		TLSCAFile:   cfg.MongoDB.TLSCAFile,
+	})
+	if err != nil {
+		log.Fatalf("FATAL: Failed to connect to MongoDB: %v", err)
+	}
+	defer mongoClient.Close()
+
+	ctx := context.Background()
+	emailRepo := repositories.NewMongoEmailRepository(mongoClient)
+	statsRepo := repositories.NewTemplateStatsRepository(mongoClient)
+
+	if err := statsRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	var buckets, sends int64
+	err = emailRepo.EachTemplateSendBucket(ctx, func(bucket *models.TemplateStatsBucket) error {
+		if err := statsRepo.SetBucket(ctx, bucket); err != nil {
+			return err
+		}
+		buckets++
+		sends += bucket.Sends
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("FATAL: Backfill failed after %d bucket(s): %v", buckets, err)
+	}
+
+	log.Printf("Backfilled %d template stats bucket(s) covering %d send(s)", buckets, sends)
+}
@@ -0,0 +1,49 @@
+// Command migrate-settings-user-ids rewrites settings documents whose user_id
+// was stored as an ObjectID to the string user IDs the rest of the service
+// uses. Until it runs, the settings of affected users (2FA among them) are
+// never found and the defaults apply.
+//
+// It can be re-run safely; documents already migrated are skipped.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/mongodb"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	mongoClient, err := mongodb.NewClient(mongodb.Config{
+		URI:         cfg.MongoDB.URI,
+		Database:    cfg.MongoDB.Database,
+		MaxPoolSize: cfg.MongoDB.MaxPoolSize,
+		MinPoolSize: cfg.MongoDB.MinPoolSize,
+		MaxRetries:  cfg.MongoDB.MaxRetries,
+		TLSCAFile:   cfg.MongoDB.TLSCAFile,
+	})
+	if err != nil {
+		log.Fatalf("FATAL: Failed to connect to MongoDB: %v", err)
+	}
+	defer mongoClient.Close()
+
+	results, err := repositories.NewSettingsRepository(mongoClient).MigrateObjectIDUserIDs(context.Background())
+	for _, result := range results {
+		log.Printf("%s: converted %d, dropped %d duplicate(s)", result.Collection, result.Converted, result.Dropped)
+	}
+	if err != nil {
+		log.Fatalf("FATAL: Migration failed: %v", err)
+	}
+}
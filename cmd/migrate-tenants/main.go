@@ -0,0 +1,52 @@
+// Command migrate-tenants records the tenant of users and of the templates,
+// messages, distribution lists and sequence templates they own. Users
+// without a tenant join the default tenant. Templates used to be kept under
+// the ID of the user who created them; until it runs they are not found.
+//
+// It can be re-run safely; documents already migrated are skipped. Run
+// backfill-template-stats afterwards to rebuild the template stats buckets
+// it deletes.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/mongodb"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	mongoClient, err := mongodb.NewClient(mongodb.Config{
+		URI:         cfg.MongoDB.URI,
+		Database:    cfg.MongoDB.Database,
+		MaxPoolSize: cfg.MongoDB.MaxPoolSize,
+		MinPoolSize: cfg.MongoDB.MinPoolSize,
+		MaxRetries:  cfg.MongoDB.MaxRetries,
+		TLSCAFile:   cfg.MongoDB.TLSCAFile,
+	})
+	if err != nil {
+		log.Fatalf("FATAL: Failed to connect to MongoDB: %v", err)
+	}
+	defer mongoClient.Close()
+
+	results, err := repositories.MigrateTenants(context.Background(), mongoClient)
+	for _, result := range results {
+		log.Printf("%s: updated %d, deleted %d", result.Collection, result.Updated, result.Deleted)
+	}
+	if err != nil {
+		log.Fatalf("FATAL: Migration failed: %v", err)
+	}
+	log.Println("Run backfill-template-stats to rebuild the template stats")
+}
@@ -0,0 +1,51 @@
+// Command migrate-working-hours rewrites the working hours of the system
+// default settings from the free-text form they used to be stored in (9am,
+// 6pm) to the HH:MM form the send window is read from, and stores Monday to
+// Friday as the working days when none are set.
+//
+// It can be re-run safely; settings already migrated are left alone.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/mongodb"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	mongoClient, err := mongodb.NewClient(mongodb.Config{
+		URI:         cfg.MongoDB.URI,
+		Database:    cfg.MongoDB.Database,
+		MaxPoolSize: cfg.MongoDB.MaxPoolSize,
+		MinPoolSize: cfg.MongoDB.MinPoolSize,
+		MaxRetries:  cfg.MongoDB.MaxRetries,
+		TLSCAFile:   cfg.MongoDB.TLSCAFile,
+	})
+	if err != nil {
+		log.Fatalf("FATAL: Failed to connect to MongoDB: %v", err)
+	}
+	defer mongoClient.Close()
+
+	result, err := repositories.NewSettingsRepository(mongoClient).MigrateWorkingHours(context.Background())
+	if err != nil {
+		log.Fatalf("FATAL: Migration failed: %v", err)
+	}
+	if !result.Migrated {
+		log.Println("Working hours already migrated")
+		return
+	}
+	log.Printf("Working hours migrated to %s-%s", result.Start, result.End)
+}
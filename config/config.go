@@ -2,22 +2,74 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
+	"github.com/white/user-management/internal/password"
+	"github.com/white/user-management/pkg/clientip"
+	"github.com/white/user-management/pkg/xlsx"
 )
 
 type Config struct {
-	Server		ServerConfig
-	MongoDB		MongoDBConfig
-	Kafka 		KafkaConfig
-	JWT			JWTConfig
+	Server        ServerConfig
+	MongoDB       MongoDBConfig
+	Kafka         KafkaConfig
+	Redis         RedisConfig
+	ScopeCache    ScopeCacheConfig
+	SMTP          SMTPConfig
+	JWT           JWTConfig
+	CORS          CORSConfig
+	App           AppConfig
+	Templates     TemplatesConfig
+	Accounts      AccountsConfig
+	Security      SecurityConfig
+	Tracking      TrackingConfig
+	Email         EmailConfig
+	Outbox        OutboxConfig
+	Digest        DigestConfig
+	Attachments   AttachmentsConfig
+	Worker        WorkerConfig
+	Reports       ReportsConfig
+	OIDC          OIDCConfig
+	Webhooks      WebhooksConfig
+	SMS           SMSConfig
+	AuditForward  AuditForwardConfig
 	ProcessorPort int
 }
 
 type ServerConfig struct {
-	Port string
-	Environment string
-	Version string
+	Port            string
+	Environment     string
+	Version         string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	// SwaggerEnabled serves the API documentation under /swagger/. It
+	// defaults to on outside production.
+	SwaggerEnabled bool
+
+	// TrustedProxies are the CIDRs or addresses of the load balancers and
+	// proxies in front of the API. X-Forwarded-For and X-Real-IP are only
+	// believed from them; without any, client IPs are the direct peers.
+	TrustedProxies []string
+
+	// MaxBodyBytes is the largest JSON request body accepted; endpoints
+	// taking uploads or imports declare their own.
+	MaxBodyBytes int
+
+	// AuthRateLimit is how many requests each client address may make to
+	// the unauthenticated auth routes (sign-in, refresh, password resets,
+	// signup) per minute; 0 turns the limit off
+	AuthRateLimit int
 }
 
 type MongoDBConfig struct {
@@ -26,6 +78,18 @@ type MongoDBConfig struct {
 	MaxPoolSize uint64
 	MinPoolSize uint64
 	MaxRetries  int
+	TLSCAFile   string
+
+	// InitIndexes creates every collection's indexes at startup; production
+	// enables it for maintenance windows. Failures are logged unless
+	// StrictIndexes makes them fatal.
+	InitIndexes   bool
+	StrictIndexes bool
+
+	// SecondaryReads sends template lists, audit logs, user listings and
+	// statistics to secondaries when the replica set has them; turning it
+	// off reads everything from the primary again
+	SecondaryReads bool
 }
 
 type KafkaConfig struct {
@@ -38,30 +102,471 @@ type KafkaConfig struct {
 	SSL             bool
 	SASLMechanism   string
 	Topics          KafkaTopics
+
+	// Events published while the broker is unreachable wait in a bounded
+	// in-memory buffer (oldest dropped first) and are retried every RetryInterval
+	BufferSize    int
+	RetryInterval time.Duration
+
+	// OutboxPollInterval is how often recorded domain events are relayed
+	OutboxPollInterval time.Duration
+	// OutboxMaxAttempts is how often the broker may refuse an event before
+	// it is set aside as failed for an admin to replay; 0 retries forever
+	OutboxMaxAttempts int
 }
 
 type KafkaTopics struct {
-	UserLoggedIn     string
-	UserLoggedOut    string
-	EmailSent        string
+	UserLoggedIn  string
+	UserLoggedOut string
+	EmailSent     string
+
+	// Emails queued for the worker; urgent ones (2FA codes) get their own
+	// topic so they never wait behind bulk sends
+	EmailQueued       string
+	EmailQueuedUrgent string
+	EmailDeadLetter   string // Queued emails that failed every attempt
+}
+
+// RedisConfig holds the optional Redis connection (caching is disabled when URL is empty)
+type RedisConfig struct {
+	URL string
+}
+
+// ScopeCacheConfig holds the cache of the per-user roles, grants and data
+// scope overrides and of team member lists read on authorized requests. It
+// lives in Redis when REDIS_URL is set, in memory otherwise.
+type ScopeCacheConfig struct {
+	TTL  time.Duration // How long entries are reused; changes made on other instances without Redis apply within it
+	Size int           // Users and teams kept by the in-memory cache
+}
+
+// SMTPConfig holds the optional SMTP server used for transactional email
+// (email sending is disabled when Host is empty)
+type SMTPConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	FromEmail  string
+	ReplyTo    string
+	TLSEnabled bool
+
+	MaxAttachmentMB int // Combined attachment size cap per message
+
+	// DKIM signing of outbound messages, for relays that do not sign. Off
+	// unless DKIMDomain is set; the key is a PEM RSA private key, read from
+	// DKIMPrivateKeyPath or given as DKIMPrivateKey.
+	DKIMDomain         string
+	DKIMSelector       string
+	DKIMPrivateKeyPath string
+	DKIMPrivateKey     string
 }
 
 type JWTConfig struct {
-	PrivateKeyPath     string
-	PublicKeyPath      string
-	AccessTokenExpiry  int    // in minutes
-	RefreshTokenExpiry int    // in days
-	JWKSEndpoint       string // JWKS endpoint for RS256 validation
-	SharedSecret       string // Shared secret for HS256 validation
+	Algorithm            string            // Signing algorithm for issued tokens: RS256 (default) or HS256
+	Secret               string            // HMAC secret used when Algorithm is HS256
+	PrivateKeyPath       string            // RS256 only
+	PublicKeyPath        string            // RS256 only
+	KeyID                string            // kid of the signing key (derived from the key when empty)
+	VerificationKeyPaths map[string]string // RS256 only: kid -> public key file still accepted for verification
+	VerificationKeysDir  string            // RS256 only: directory of <kid>.pem public keys, re-scanned on reload
+	AccessTokenExpiry    int               // in minutes
+	RefreshTokenExpiry   int               // in days
+	JWKSEndpoint         string            // JWKS endpoint for RS256 validation
+	SharedSecret         string            // Shared secret for HS256 validation
+
+	// Issuer and Audience are the iss and aud claims of issued tokens, and
+	// the ones tokens signed by the service's keys must carry. An empty
+	// Audience neither sets nor checks aud.
+	Issuer   string
+	Audience string
+
+	// AllowMissingClaims accepts, with a warning, tokens without iss or aud,
+	// for the transition from tokens minted before they were configured.
+	// Turn it off once the last such refresh token has expired.
+	AllowMissingClaims bool
+}
+
+// CORSConfig holds the browser origins allowed to call the API
+type CORSConfig struct {
+	AllowedOrigins []string
+}
+
+// AppConfig holds settings about the frontend application
+type AppConfig struct {
+	BaseURL string // Used to build links in invitation and password reset emails
+
+	// RequireVersion lists the update endpoints that refuse writes without
+	// the version last read (If-Match header or version field). The others
+	// check a version only when one is sent.
+	RequireVersion []string
+
+	// PasswordHashCost is the bcrypt cost new password hashes are written
+	// with. Hashes at a lower cost are rewritten when their user signs in.
+	PasswordHashCost int
+}
+
+// Update endpoints that can require a version
+const (
+	VersionedTeamMembers    = "team_members"
+	VersionedTemplates      = "templates"
+	VersionedSystemSecurity = "system_security"
+)
+
+// versionedEndpoints are the values RequireVersion accepts
+var versionedEndpoints = []string{VersionedTeamMembers, VersionedTemplates, VersionedSystemSecurity}
+
+// RequiresVersion reports whether updates of endpoint must carry a version
+func (c AppConfig) RequiresVersion(endpoint string) bool {
+	return slices.Contains(c.RequireVersion, endpoint)
+}
+
+// TrackingConfig holds email open/click tracking settings. Tracking is off
+// unless both are set.
+type TrackingConfig struct {
+	BaseURL string // Public URL of this API, used for tracking pixel and click redirect links
+	Secret  string // HMAC key signing click redirect targets
+}
+
+// Enabled reports whether outbound email tracking is configured
+func (c TrackingConfig) Enabled() bool {
+	return c.BaseURL != "" && c.Secret != ""
+}
+
+// Email delivery providers
+const (
+	EmailProviderSMTP     = "smtp"
+	EmailProviderSendGrid = "sendgrid"
+	EmailProviderLog      = "log" // Logs messages instead of sending them (development)
+)
+
+// EmailConfig selects how outgoing email is delivered. An empty Provider
+// means SMTP when SMTP_HOST is set and the logging provider otherwise.
+type EmailConfig struct {
+	Provider       string
+	SendGridAPIKey string
+	SendGridAPIURL string
+	FromEmail      string // Sender for API providers; defaults to SMTP_FROM_EMAIL
+	FromName       string
+	WebhookSecret  string // HMAC key for delivery status webhooks; webhooks are rejected when empty
+}
+
+// OutboxConfig controls the worker that retries emails left in queued status
+type OutboxConfig struct {
+	PollInterval time.Duration // How often the outbox is scanned
+	RetryAfter   time.Duration // Age at which a queued email is considered stuck
+	MaxAge       time.Duration // Queued emails older than this are never picked up
+	MaxAttempts  int           // Send attempts before an email is marked failed
+	Backoff      time.Duration // Delay after the first failure, doubled per attempt
+	MaxBackoff   time.Duration // Upper bound for the retry delay
+	Lease        time.Duration // How long a claimed email is reserved for one worker
+}
+
+// DigestConfig controls how notification emails that are not urgent are
+// held and sent together per recipient and type
+type DigestConfig struct {
+	Window        time.Duration // Digest period of users who chose none; 0 emails their notifications right away
+	FlushInterval time.Duration // How often due digests are looked for
+	Lease         time.Duration // How long a claimed digest is reserved for one instance
+}
+
+// WorkerConfig controls the in-process consumer that sends emails queued on Kafka
+type WorkerConfig struct {
+	Enabled     bool          // Queue system emails on Kafka and consume them in this process
+	MaxAttempts int           // Send attempts before a queued email is dead-lettered
+	Backoff     time.Duration // Delay between send attempts
+}
+
+// AttachmentsConfig holds message attachment upload settings
+type AttachmentsConfig struct {
+	MaxUploadMB         int           // Size cap for one uploaded file
+	AllowedTypes        []string      // MIME types accepted for upload
+	OrphanSweepInterval time.Duration // How often attachments of deleted messages are removed
+}
+
+// ReportsConfig controls the scheduled weekly report emails and the
+// spreadsheet exports
+type ReportsConfig struct {
+	WeeklyCheckInterval time.Duration // How often the job checks whether the weekly report is due
+	WeeklySendHour      int           // Hour of the scheduled day, in the org timezone, from which reports go out
+	ExportMaxRows       int           // Team member and audit log exports matching more rows are refused
+}
+
+// OIDCConfig holds the OpenID Connect provider used for SSO sign-in. SSO is
+// off unless IssuerURL is set.
+type OIDCConfig struct {
+	IssuerURL    string // Provider issuer; discovery is read from its /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string        // The callback URL registered with the provider
+	ClockSkew    time.Duration // Tolerance for the ID token's exp, iat and nbf
+	StateTTL     time.Duration // How long a started sign-in can be completed
+}
+
+// Enabled reports whether an OpenID Connect provider is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
+// WebhooksConfig controls delivery of events to webhook subscriptions
+type WebhooksConfig struct {
+	PollInterval           time.Duration // How often new events and due retries are picked up
+	Timeout                time.Duration // Per-request timeout of a delivery
+	MaxAttempts            int           // Attempts per delivery before it is marked failed
+	MaxConsecutiveFailures int           // Failed attempts in a row after which a subscription is disabled
+}
+
+// SMS delivery providers
+const (
+	SMSProviderTwilio = "twilio"
+	SMSProviderLog    = "log" // Logs messages instead of sending them (development)
+)
+
+// SMSConfig selects how text messages, such as 2FA codes, are delivered
+type SMSConfig struct {
+	Provider         string
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioAPIURL     string
+	FromNumber       string        // Sending number in E.164 form
+	Timeout          time.Duration // Per-message provider timeout
+	FallbackToEmail  bool          // Email a 2FA code when its text message cannot be sent
+}
+
+// Audit forwarding targets
+const (
+	AuditForwardSyslog = "syslog"
+	AuditForwardHTTPS  = "https"
+)
+
+// AuditForwardConfig selects the SIEM audit events are also sent to
+type AuditForwardConfig struct {
+	Target        string        // AuditForwardSyslog or AuditForwardHTTPS; empty forwards nothing
+	Format        string        // json or cef
+	SyslogAddress string        // host:port of the syslog collector
+	SyslogTLS     bool          // Syslog over TLS rather than plain TCP
+	HTTPSURL      string        // URL records are posted to
+	AuthHeader    string        // Header carrying AuthToken, e.g. Authorization
+	AuthToken     string        // e.g. "Splunk <token>" for a Splunk HTTP Event Collector
+	BufferSize    int           // Records waiting to be sent; more are dropped
+	MaxRetries    int           // Retries of a failed send
+	Timeout       time.Duration // Per-send timeout
+	DryRun        bool          // Log the records instead of sending them
 }
 
-// Load loads configuration from environment variables and config files
+// TemplatesConfig holds template library settings
+type TemplatesConfig struct {
+	TrashRetentionDays int           // Soft-deleted templates are purged after this many days
+	TrashSweepInterval time.Duration // How often the trash purge runs
+	CacheTTL           time.Duration // Lifetime of a cached published template
+	ListCacheTTL       time.Duration // Lifetime of a cached template listing page
+}
+
+// SecurityConfig holds the throttling of users who are repeatedly denied
+// access, e.g. a compromised account probing admin endpoints
+type SecurityConfig struct {
+	DenialLimit  int           // Denials a user may collect within DenialWindow before being throttled
+	DenialWindow time.Duration // Window denials are counted in, and how long a throttle lasts
+}
+
+// AccountsConfig holds self-service account closing settings
+type AccountsConfig struct {
+	DeletionGraceDays     int           // Requested deletions wait this many days, during which they can be cancelled
+	DeletionSweepInterval time.Duration // How often due deletions are carried out
+
+	// The master admin is created at startup while no admin exists,
+	// so a fresh deployment can be signed in to. Without MasterAdminPassword
+	// a one-time password is generated and printed once; either way it must
+	// be changed at the first sign-in.
+	MasterAdminEmail    string
+	MasterAdminName     string
+	MasterAdminPassword string
+}
+
+const (
+	defaultJWTPrivateKeyPath = "./secrets/jwt/private.pem"
+	defaultJWTPublicKeyPath  = "./secrets/jwt/public.pem"
+
+	// minJWTSecretLength is the minimum HS256 secret size (256 bits)
+	minJWTSecretLength = 32
+
+	// minMasterAdminPasswordLength matches the shortest password a reset accepts
+	minMasterAdminPasswordLength = 8
+)
+
+// envBindings maps each config key to the environment variables it is read from.
+// When several variables are listed the first non-empty one wins.
+var envBindings = map[string][]string{
+	"server.port":             {"PORT"},
+	"server.environment":      {"ENVIRONMENT", "APP_ENV"},
+	"server.version":          {"APP_VERSION"},
+	"server.read_timeout":     {"SERVER_READ_TIMEOUT"},
+	"server.write_timeout":    {"SERVER_WRITE_TIMEOUT"},
+	"server.idle_timeout":     {"SERVER_IDLE_TIMEOUT"},
+	"server.shutdown_timeout": {"SERVER_SHUTDOWN_TIMEOUT"},
+	"server.swagger_enabled":  {"SWAGGER_ENABLED"},
+	"server.trusted_proxies":  {"TRUSTED_PROXIES"},
+	"server.max_body_bytes":   {"SERVER_MAX_BODY_BYTES"},
+	"server.auth_rate_limit":  {"SERVER_AUTH_RATE_LIMIT"},
+
+	"mongodb.uri":             {"MONGODB_URL", "MONGODB_URI"},
+	"mongodb.database":        {"MONGODB_DATABASE"},
+	"mongodb.max_pool_size":   {"MONGODB_MAX_POOL_SIZE"},
+	"mongodb.min_pool_size":   {"MONGODB_MIN_POOL_SIZE"},
+	"mongodb.max_retries":     {"MONGODB_MAX_RETRIES"},
+	"mongodb.tls_ca_file":     {"MONGODB_TLS_CA_FILE"},
+	"mongodb.init_indexes":    {"MONGODB_INIT_INDEXES"},
+	"mongodb.strict_indexes":  {"STRICT_INDEXES"},
+	"mongodb.secondary_reads": {"MONGODB_SECONDARY_READS"},
+
+	"kafka.brokers":              {"KAFKA_BROKERS"},
+	"kafka.client_id":            {"KAFKA_CLIENT_ID"},
+	"kafka.consumer_group":       {"KAFKA_CONSUMER_GROUP"},
+	"kafka.username":             {"KAFKA_USER_NAME"},
+	"kafka.password":             {"KAFKA_PASSWORD"},
+	"kafka.ssl":                  {"KAFKA_SSL"},
+	"kafka.sasl_mechanism":       {"KAFKA_SASL_MECHANISM"},
+	"kafka.buffer_size":          {"KAFKA_BUFFER_SIZE"},
+	"kafka.retry_interval":       {"KAFKA_RETRY_INTERVAL"},
+	"kafka.outbox_poll_interval": {"KAFKA_OUTBOX_POLL_INTERVAL"},
+	"kafka.outbox_max_attempts":  {"KAFKA_OUTBOX_MAX_ATTEMPTS"},
+
+	"redis.url": {"REDIS_URL"},
+
+	"scope_cache.ttl":  {"USER_SCOPE_CACHE_TTL"},
+	"scope_cache.size": {"USER_SCOPE_CACHE_SIZE"},
+
+	"smtp.host":              {"SMTP_HOST"},
+	"smtp.port":              {"SMTP_PORT"},
+	"smtp.username":          {"SMTP_USER"},
+	"smtp.password":          {"SMTP_PASSWORD"},
+	"smtp.from_email":        {"SMTP_FROM_EMAIL"},
+	"smtp.reply_to":          {"SMTP_REPLY_TO"},
+	"smtp.tls_enabled":       {"SMTP_TLS_ENABLED"},
+	"smtp.max_attachment_mb": {"SMTP_MAX_ATTACHMENT_MB"},
+
+	"smtp.dkim_domain":           {"SMTP_DKIM_DOMAIN"},
+	"smtp.dkim_selector":         {"SMTP_DKIM_SELECTOR"},
+	"smtp.dkim_private_key_path": {"SMTP_DKIM_PRIVATE_KEY_PATH"},
+	"smtp.dkim_private_key":      {"SMTP_DKIM_PRIVATE_KEY"},
+
+	"jwt.algorithm":             {"JWT_ALGORITHM"},
+	"jwt.secret":                {"JWT_SECRET"},
+	"jwt.private_key_path":      {"JWT_PRIVATE_KEY_PATH"},
+	"jwt.public_key_path":       {"JWT_PUBLIC_KEY_PATH"},
+	"jwt.key_id":                {"JWT_KEY_ID"},
+	"jwt.verification_keys":     {"JWT_VERIFICATION_KEYS"},
+	"jwt.verification_keys_dir": {"JWT_VERIFICATION_KEYS_DIR"},
+	"jwt.access_token_expiry":   {"JWT_ACCESS_TOKEN_EXPIRY"},
+	"jwt.refresh_token_expiry":  {"JWT_REFRESH_TOKEN_EXPIRY"},
+	"jwt.jwks_endpoint":         {"JWT_JWKS_ENDPOINT"},
+	"jwt.shared_secret":         {"JWT_SHARED_SECRET"},
+	"jwt.issuer":                {"JWT_ISSUER"},
+	"jwt.audience":              {"JWT_AUDIENCE"},
+	"jwt.allow_missing_claims":  {"JWT_ALLOW_MISSING_CLAIMS"},
+
+	"cors.allowed_origins": {"CORS_ALLOWED_ORIGINS"},
+
+	"app.base_url":           {"APP_BASE_URL"},
+	"app.require_version":    {"APP_REQUIRE_VERSION"},
+	"app.password_hash_cost": {"PASSWORD_HASH_COST"},
+
+	"templates.trash_retention_days": {"TEMPLATE_TRASH_RETENTION_DAYS"},
+	"templates.trash_sweep_interval": {"TEMPLATE_TRASH_SWEEP_INTERVAL"},
+	"templates.cache_ttl":            {"TEMPLATE_CACHE_TTL"},
+	"templates.list_cache_ttl":       {"TEMPLATE_LIST_CACHE_TTL"},
+
+	"security.denial_limit":  {"PERMISSION_DENIAL_LIMIT"},
+	"security.denial_window": {"PERMISSION_DENIAL_WINDOW"},
+
+	"accounts.deletion_grace_days":     {"ACCOUNT_DELETION_GRACE_DAYS"},
+	"accounts.deletion_sweep_interval": {"ACCOUNT_DELETION_SWEEP_INTERVAL"},
+	"accounts.master_admin_email":      {"MASTER_ADMIN_EMAIL"},
+	"accounts.master_admin_name":       {"MASTER_ADMIN_NAME"},
+	"accounts.master_admin_password":   {"MASTER_ADMIN_PASSWORD"},
+
+	"tracking.base_url": {"TRACKING_BASE_URL"},
+	"tracking.secret":   {"TRACKING_SECRET"},
+
+	"email.provider":         {"EMAIL_PROVIDER"},
+	"email.sendgrid_api_key": {"SENDGRID_API_KEY"},
+	"email.sendgrid_api_url": {"SENDGRID_API_URL"},
+	"email.from_email":       {"EMAIL_FROM_EMAIL"},
+	"email.from_name":        {"EMAIL_FROM_NAME"},
+	"email.webhook_secret":   {"EMAIL_WEBHOOK_SECRET"},
+
+	"outbox.poll_interval": {"EMAIL_OUTBOX_POLL_INTERVAL"},
+	"outbox.retry_after":   {"EMAIL_OUTBOX_RETRY_AFTER"},
+	"outbox.max_age":       {"EMAIL_OUTBOX_MAX_AGE"},
+	"outbox.max_attempts":  {"EMAIL_OUTBOX_MAX_ATTEMPTS"},
+	"outbox.backoff":       {"EMAIL_OUTBOX_BACKOFF"},
+	"outbox.max_backoff":   {"EMAIL_OUTBOX_MAX_BACKOFF"},
+	"outbox.lease":         {"EMAIL_OUTBOX_LEASE"},
+
+	"digest.window":         {"NOTIFICATION_DIGEST_WINDOW"},
+	"digest.flush_interval": {"NOTIFICATION_DIGEST_FLUSH_INTERVAL"},
+	"digest.lease":          {"NOTIFICATION_DIGEST_LEASE"},
+
+	"attachments.max_upload_mb":         {"ATTACHMENT_MAX_UPLOAD_MB"},
+	"attachments.allowed_types":         {"ATTACHMENT_ALLOWED_TYPES"},
+	"attachments.orphan_sweep_interval": {"ATTACHMENT_ORPHAN_SWEEP_INTERVAL"},
+
+	"worker.enabled":       {"WORKER_ENABLED"},
+	"worker.max_attempts":  {"WORKER_MAX_ATTEMPTS"},
+	"worker.retry_backoff": {"WORKER_RETRY_BACKOFF"},
+
+	"reports.weekly_check_interval": {"WEEKLY_REPORT_CHECK_INTERVAL"},
+	"reports.weekly_send_hour":      {"WEEKLY_REPORT_SEND_HOUR"},
+	"reports.export_max_rows":       {"EXPORT_MAX_ROWS"},
+
+	"oidc.issuer_url":    {"OIDC_ISSUER_URL"},
+	"oidc.client_id":     {"OIDC_CLIENT_ID"},
+	"oidc.client_secret": {"OIDC_CLIENT_SECRET"},
+	"oidc.redirect_url":  {"OIDC_REDIRECT_URL"},
+	"oidc.clock_skew":    {"OIDC_CLOCK_SKEW"},
+	"oidc.state_ttl":     {"OIDC_STATE_TTL"},
+
+	"webhooks.poll_interval":            {"WEBHOOK_POLL_INTERVAL"},
+	"webhooks.timeout":                  {"WEBHOOK_TIMEOUT"},
+	"webhooks.max_attempts":             {"WEBHOOK_MAX_ATTEMPTS"},
+	"webhooks.max_consecutive_failures": {"WEBHOOK_MAX_CONSECUTIVE_FAILURES"},
+
+	"sms.provider":           {"SMS_PROVIDER"},
+	"sms.twilio_account_sid": {"TWILIO_ACCOUNT_SID"},
+	"sms.twilio_auth_token":  {"TWILIO_AUTH_TOKEN"},
+	"sms.twilio_api_url":     {"TWILIO_API_URL"},
+	"sms.from_number":        {"SMS_FROM_NUMBER"},
+	"sms.timeout":            {"SMS_TIMEOUT"},
+	"sms.fallback_to_email":  {"SMS_FALLBACK_TO_EMAIL"},
+
+	"audit_forward.target":         {"AUDIT_FORWARD_TARGET"},
+	"audit_forward.format":         {"AUDIT_FORWARD_FORMAT"},
+	"audit_forward.syslog_address": {"AUDIT_FORWARD_SYSLOG_ADDRESS"},
+	"audit_forward.syslog_tls":     {"AUDIT_FORWARD_SYSLOG_TLS"},
+	"audit_forward.https_url":      {"AUDIT_FORWARD_HTTPS_URL"},
+	"audit_forward.auth_header":    {"AUDIT_FORWARD_AUTH_HEADER"},
+	"audit_forward.auth_token":     {"AUDIT_FORWARD_AUTH_TOKEN"},
+	"audit_forward.buffer_size":    {"AUDIT_FORWARD_BUFFER_SIZE"},
+	"audit_forward.max_retries":    {"AUDIT_FORWARD_MAX_RETRIES"},
+	"audit_forward.timeout":        {"AUDIT_FORWARD_TIMEOUT"},
+	"audit_forward.dry_run":        {"AUDIT_FORWARD_DRY_RUN"},
+
+	"processor.port": {"PROCESSOR_PORT"},
+}
+
+// Load loads configuration from environment variables and config files,
+// then validates it. All problems are reported together so startup can fail
+// fast with the complete list instead of panicking when a feature is first used.
 func Load() (*Config, error) {
 	// Set default values
 	setDefaults()
 
-	// Enable reading from environment variables
-	viper.AutomaticEnv()
+	// Bind each key to its environment variable(s)
+	for key, envs := range envBindings {
+		if err := viper.BindEnv(append([]string{key}, envs...)...); err != nil {
+			return nil, fmt.Errorf("error binding environment for %s: %w", key, err)
+		}
+	}
 
 	// Try to read config file (optional)
 	viper.SetConfigName("config")
@@ -78,70 +583,735 @@ func Load() (*Config, error) {
 		// Config file not found, use environment variables and defaults
 	}
 
+	var problems []string
+	getInt := func(key string) int {
+		raw := strings.TrimSpace(viper.GetString(key))
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be an integer, got %q", envName(key), raw))
+		}
+		return n
+	}
+	getBool := func(key string) bool {
+		raw := strings.TrimSpace(viper.GetString(key))
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be true or false, got %q", envName(key), raw))
+		}
+		return b
+	}
+	getDuration := func(key string) time.Duration {
+		raw := strings.TrimSpace(viper.GetString(key))
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be a positive duration such as 15s, got %q", envName(key), raw))
+		}
+		return d
+	}
+
 	var config Config
 
 	// Server configuration
 	config.Server = ServerConfig{
-		Port:        viper.GetString("server.port"),
-		Environment: viper.GetString("server.environment"),
-		Version:     viper.GetString("server.version"),
+		Port:            viper.GetString("server.port"),
+		Environment:     viper.GetString("server.environment"),
+		Version:         viper.GetString("server.version"),
+		ReadTimeout:     getDuration("server.read_timeout"),
+		WriteTimeout:    getDuration("server.write_timeout"),
+		IdleTimeout:     getDuration("server.idle_timeout"),
+		ShutdownTimeout: getDuration("server.shutdown_timeout"),
+		TrustedProxies:  splitList(viper.GetString("server.trusted_proxies")),
+		MaxBodyBytes:    getInt("server.max_body_bytes"),
+		AuthRateLimit:   getInt("server.auth_rate_limit"),
+	}
+	if strings.TrimSpace(viper.GetString("server.swagger_enabled")) == "" {
+		config.Server.SwaggerEnabled = config.Server.Environment != "production"
+	} else {
+		config.Server.SwaggerEnabled = getBool("server.swagger_enabled")
 	}
 
 	// MongoDB configuration
 	config.MongoDB = MongoDBConfig{
 		URI:         viper.GetString("mongodb.uri"),
 		Database:    viper.GetString("mongodb.database"),
-		MaxPoolSize: viper.GetUint64("mongodb.max_pool_size"),
-		MinPoolSize: viper.GetUint64("mongodb.min_pool_size"),
-		MaxRetries:  viper.GetInt("mongodb.max_retries"),
+		MaxPoolSize: uint64(getInt("mongodb.max_pool_size")),
+		MinPoolSize: uint64(getInt("mongodb.min_pool_size")),
+		MaxRetries:  getInt("mongodb.max_retries"),
+		TLSCAFile:   viper.GetString("mongodb.tls_ca_file"),
+
+		InitIndexes:   getBool("mongodb.init_indexes"),
+		StrictIndexes: getBool("mongodb.strict_indexes"),
+
+		SecondaryReads: getBool("mongodb.secondary_reads"),
 	}
 
 	// Kafka configuration
 	config.Kafka = KafkaConfig{
-		Brokers:         viper.GetStringSlice("kafka.brokers"),
-		ProducerTimeout: viper.GetInt("kafka.producer_timeout"),
+		Brokers:         splitList(viper.GetString("kafka.brokers")),
+		ProducerTimeout: getInt("kafka.producer_timeout"),
 		ConsumerGroup:   viper.GetString("kafka.consumer_group"),
 		ClientID:        viper.GetString("kafka.client_id"),
 		Username:        viper.GetString("kafka.username"),
 		Password:        viper.GetString("kafka.password"),
-		SSL:             viper.GetBool("kafka.ssl"),
+		SSL:             getBool("kafka.ssl"),
 		SASLMechanism:   viper.GetString("kafka.sasl_mechanism"),
 		Topics: KafkaTopics{
-			UserLoggedIn:     viper.GetString("kafka.topics.user_logged_in"),
-			UserLoggedOut:    viper.GetString("kafka.topics.user_logged_out"),
-			EmailSent:        viper.GetString("kafka.topics.email_sent"),
+			UserLoggedIn:  viper.GetString("kafka.topics.user_logged_in"),
+			UserLoggedOut: viper.GetString("kafka.topics.user_logged_out"),
+			EmailSent:     viper.GetString("kafka.topics.email_sent"),
+
+			EmailQueued:       viper.GetString("kafka.topics.email_queued"),
+			EmailQueuedUrgent: viper.GetString("kafka.topics.email_queued_urgent"),
+			EmailDeadLetter:   viper.GetString("kafka.topics.email_dead_letter"),
 		},
+		BufferSize:         getInt("kafka.buffer_size"),
+		RetryInterval:      getDuration("kafka.retry_interval"),
+		OutboxPollInterval: getDuration("kafka.outbox_poll_interval"),
+		OutboxMaxAttempts:  getInt("kafka.outbox_max_attempts"),
+	}
+
+	// Redis configuration
+	config.Redis = RedisConfig{
+		URL: viper.GetString("redis.url"),
+	}
+
+	// User scope cache configuration
+	config.ScopeCache = ScopeCacheConfig{
+		TTL:  getDuration("scope_cache.ttl"),
+		Size: getInt("scope_cache.size"),
+	}
+
+	// SMTP configuration
+	config.SMTP = SMTPConfig{
+		Host:       viper.GetString("smtp.host"),
+		Port:       getInt("smtp.port"),
+		Username:   viper.GetString("smtp.username"),
+		Password:   viper.GetString("smtp.password"),
+		FromEmail:  viper.GetString("smtp.from_email"),
+		ReplyTo:    viper.GetString("smtp.reply_to"),
+		TLSEnabled: getBool("smtp.tls_enabled"),
+
+		MaxAttachmentMB: getInt("smtp.max_attachment_mb"),
+
+		DKIMDomain:         viper.GetString("smtp.dkim_domain"),
+		DKIMSelector:       viper.GetString("smtp.dkim_selector"),
+		DKIMPrivateKeyPath: viper.GetString("smtp.dkim_private_key_path"),
+		DKIMPrivateKey:     viper.GetString("smtp.dkim_private_key"),
+	}
+	if config.SMTP.FromEmail == "" {
+		config.SMTP.FromEmail = config.SMTP.Username
+	}
+	if config.SMTP.ReplyTo == "" {
+		config.SMTP.ReplyTo = config.SMTP.FromEmail
 	}
 
 	// JWT configuration
 	config.JWT = JWTConfig{
+		Algorithm:          strings.ToUpper(strings.TrimSpace(viper.GetString("jwt.algorithm"))),
+		Secret:             viper.GetString("jwt.secret"),
 		PrivateKeyPath:     viper.GetString("jwt.private_key_path"),
 		PublicKeyPath:      viper.GetString("jwt.public_key_path"),
-		AccessTokenExpiry:  viper.GetInt("jwt.access_token_expiry"),
-		RefreshTokenExpiry: viper.GetInt("jwt.refresh_token_expiry"),
+		KeyID:              strings.TrimSpace(viper.GetString("jwt.key_id")),
+		AccessTokenExpiry:  getInt("jwt.access_token_expiry"),
+		RefreshTokenExpiry: getInt("jwt.refresh_token_expiry"),
 		JWKSEndpoint:       viper.GetString("jwt.jwks_endpoint"),
 		SharedSecret:       viper.GetString("jwt.shared_secret"),
+		Issuer:             strings.TrimSpace(viper.GetString("jwt.issuer")),
+		Audience:           strings.TrimSpace(viper.GetString("jwt.audience")),
+		AllowMissingClaims: getBool("jwt.allow_missing_claims"),
+	}
+	verificationKeys, err := parseKeyPaths(viper.GetString("jwt.verification_keys"))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("JWT_VERIFICATION_KEYS %v", err))
+	}
+	config.JWT.VerificationKeyPaths = verificationKeys
+	config.JWT.VerificationKeysDir = viper.GetString("jwt.verification_keys_dir")
+	if config.JWT.Algorithm == "RS256" {
+		// Key files are only used for RS256, so the defaults only apply there
+		if config.JWT.PrivateKeyPath == "" {
+			config.JWT.PrivateKeyPath = defaultJWTPrivateKeyPath
+		}
+		if config.JWT.PublicKeyPath == "" {
+			config.JWT.PublicKeyPath = defaultJWTPublicKeyPath
+		}
+		// JWT_SECRET historically configured the HS256 secret accepted from
+		// external issuers; keep honouring it for RSA deployments
+		if config.JWT.SharedSecret == "" {
+			config.JWT.SharedSecret = config.JWT.Secret
+		}
+		config.JWT.Secret = ""
+	}
+
+	// CORS configuration
+	config.CORS = CORSConfig{
+		AllowedOrigins: splitList(viper.GetString("cors.allowed_origins")),
+	}
+
+	// Frontend application configuration
+	config.App = AppConfig{
+		BaseURL:          strings.TrimRight(viper.GetString("app.base_url"), "/"),
+		RequireVersion:   splitList(viper.GetString("app.require_version")),
+		PasswordHashCost: getInt("app.password_hash_cost"),
+	}
+
+	// Template library configuration
+	config.Templates = TemplatesConfig{
+		TrashRetentionDays: getInt("templates.trash_retention_days"),
+		TrashSweepInterval: getDuration("templates.trash_sweep_interval"),
+		CacheTTL:           getDuration("templates.cache_ttl"),
+		ListCacheTTL:       getDuration("templates.list_cache_ttl"),
+	}
+
+	// Account closing configuration
+	config.Security = SecurityConfig{
+		DenialLimit:  getInt("security.denial_limit"),
+		DenialWindow: getDuration("security.denial_window"),
+	}
+
+	config.Accounts = AccountsConfig{
+		DeletionGraceDays:     getInt("accounts.deletion_grace_days"),
+		DeletionSweepInterval: getDuration("accounts.deletion_sweep_interval"),
+		MasterAdminEmail:      strings.TrimSpace(viper.GetString("accounts.master_admin_email")),
+		MasterAdminName:       strings.TrimSpace(viper.GetString("accounts.master_admin_name")),
+		MasterAdminPassword:   viper.GetString("accounts.master_admin_password"),
+	}
+
+	// Email tracking configuration
+	config.Tracking = TrackingConfig{
+		BaseURL: strings.TrimRight(viper.GetString("tracking.base_url"), "/"),
+		Secret:  viper.GetString("tracking.secret"),
+	}
+
+	// Email provider configuration
+	config.Email = EmailConfig{
+		Provider:       strings.ToLower(strings.TrimSpace(viper.GetString("email.provider"))),
+		SendGridAPIKey: viper.GetString("email.sendgrid_api_key"),
+		SendGridAPIURL: strings.TrimRight(viper.GetString("email.sendgrid_api_url"), "/"),
+		FromEmail:      viper.GetString("email.from_email"),
+		FromName:       viper.GetString("email.from_name"),
+		WebhookSecret:  viper.GetString("email.webhook_secret"),
+	}
+	if config.Email.Provider == "" {
+		config.Email.Provider = EmailProviderLog
+		if config.SMTP.Host != "" {
+			config.Email.Provider = EmailProviderSMTP
+		}
+	}
+	if config.Email.FromEmail == "" {
+		config.Email.FromEmail = config.SMTP.FromEmail
+	}
+
+	// Email outbox worker configuration
+	config.Outbox = OutboxConfig{
+		PollInterval: getDuration("outbox.poll_interval"),
+		RetryAfter:   getDuration("outbox.retry_after"),
+		MaxAge:       getDuration("outbox.max_age"),
+		MaxAttempts:  getInt("outbox.max_attempts"),
+		Backoff:      getDuration("outbox.backoff"),
+		MaxBackoff:   getDuration("outbox.max_backoff"),
+		Lease:        getDuration("outbox.lease"),
+	}
+
+	config.Digest = DigestConfig{
+		Window:        getDuration("digest.window"),
+		FlushInterval: getDuration("digest.flush_interval"),
+		Lease:         getDuration("digest.lease"),
+	}
+
+	// Attachment upload configuration
+	config.Attachments = AttachmentsConfig{
+		MaxUploadMB:         getInt("attachments.max_upload_mb"),
+		AllowedTypes:        splitList(strings.ToLower(viper.GetString("attachments.allowed_types"))),
+		OrphanSweepInterval: getDuration("attachments.orphan_sweep_interval"),
+	}
+
+	// Email queue worker configuration
+	config.Worker = WorkerConfig{
+		Enabled:     getBool("worker.enabled"),
+		MaxAttempts: getInt("worker.max_attempts"),
+		Backoff:     getDuration("worker.retry_backoff"),
+	}
+
+	// Weekly report configuration
+	config.Reports = ReportsConfig{
+		WeeklyCheckInterval: getDuration("reports.weekly_check_interval"),
+		WeeklySendHour:      getInt("reports.weekly_send_hour"),
+		ExportMaxRows:       getInt("reports.export_max_rows"),
+	}
+
+	// OpenID Connect SSO configuration
+	config.OIDC = OIDCConfig{
+		IssuerURL:    strings.TrimSuffix(viper.GetString("oidc.issuer_url"), "/"),
+		ClientID:     viper.GetString("oidc.client_id"),
+		ClientSecret: viper.GetString("oidc.client_secret"),
+		RedirectURL:  viper.GetString("oidc.redirect_url"),
+		ClockSkew:    getDuration("oidc.clock_skew"),
+		StateTTL:     getDuration("oidc.state_ttl"),
+	}
+
+	// Webhook delivery configuration
+	config.Webhooks = WebhooksConfig{
+		PollInterval:           getDuration("webhooks.poll_interval"),
+		Timeout:                getDuration("webhooks.timeout"),
+		MaxAttempts:            getInt("webhooks.max_attempts"),
+		MaxConsecutiveFailures: getInt("webhooks.max_consecutive_failures"),
+	}
+
+	// SMS provider configuration
+	config.SMS = SMSConfig{
+		Provider:         strings.ToLower(strings.TrimSpace(viper.GetString("sms.provider"))),
+		TwilioAccountSID: viper.GetString("sms.twilio_account_sid"),
+		TwilioAuthToken:  viper.GetString("sms.twilio_auth_token"),
+		TwilioAPIURL:     strings.TrimRight(viper.GetString("sms.twilio_api_url"), "/"),
+		FromNumber:       strings.TrimSpace(viper.GetString("sms.from_number")),
+		Timeout:          getDuration("sms.timeout"),
+		FallbackToEmail:  getBool("sms.fallback_to_email"),
+	}
+	if config.SMS.Provider == "" {
+		config.SMS.Provider = SMSProviderLog
+	}
+
+	// SIEM audit forwarding configuration
+	config.AuditForward = AuditForwardConfig{
+		Target:        strings.ToLower(strings.TrimSpace(viper.GetString("audit_forward.target"))),
+		Format:        strings.ToLower(strings.TrimSpace(viper.GetString("audit_forward.format"))),
+		SyslogAddress: strings.TrimSpace(viper.GetString("audit_forward.syslog_address")),
+		SyslogTLS:     getBool("audit_forward.syslog_tls"),
+		HTTPSURL:      strings.TrimSpace(viper.GetString("audit_forward.https_url")),
+		AuthHeader:    strings.TrimSpace(viper.GetString("audit_forward.auth_header")),
+		AuthToken:     viper.GetString("audit_forward.auth_token"),
+		BufferSize:    getInt("audit_forward.buffer_size"),
+		MaxRetries:    getInt("audit_forward.max_retries"),
+		Timeout:       getDuration("audit_forward.timeout"),
+		DryRun:        getBool("audit_forward.dry_run"),
 	}
 
 	// Processor port configuration
-	config.ProcessorPort = viper.GetInt("processor.port")
+	config.ProcessorPort = getInt("processor.port")
+
+	problems = append(problems, config.validate()...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
 
 	return &config, nil
 }
+
+// validate checks cross-field and required values, returning one message per problem
+func (c *Config) validate() []string {
+	var problems []string
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be a valid TCP port, got %q", c.Server.Port))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := clientip.ParsePrefix(proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES: %v", err))
+		}
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		problems = append(problems, fmt.Sprintf("SERVER_MAX_BODY_BYTES must be positive, got %d", c.Server.MaxBodyBytes))
+	}
+	if c.Server.AuthRateLimit < 0 {
+		problems = append(problems, fmt.Sprintf("SERVER_AUTH_RATE_LIMIT must not be negative, got %d", c.Server.AuthRateLimit))
+	}
+
+	if c.MongoDB.URI == "" {
+		problems = append(problems, "MONGODB_URL is required")
+	}
+	if c.MongoDB.Database == "" {
+		problems = append(problems, "MONGODB_DATABASE must not be empty")
+	}
+	if c.MongoDB.MinPoolSize > c.MongoDB.MaxPoolSize {
+		problems = append(problems, fmt.Sprintf("MONGODB_MIN_POOL_SIZE (%d) cannot be greater than MONGODB_MAX_POOL_SIZE (%d)", c.MongoDB.MinPoolSize, c.MongoDB.MaxPoolSize))
+	}
+	if c.MongoDB.TLSCAFile != "" {
+		if _, err := os.Stat(c.MongoDB.TLSCAFile); err != nil {
+			problems = append(problems, fmt.Sprintf("MONGODB_TLS_CA_FILE %q is not readable: %v", c.MongoDB.TLSCAFile, err))
+		}
+	}
+
+	if c.Redis.URL != "" {
+		if u, err := url.Parse(c.Redis.URL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			problems = append(problems, fmt.Sprintf("REDIS_URL must be a redis:// or rediss:// URL, got %q", c.Redis.URL))
+		}
+	}
+
+	if c.SMTP.Host != "" {
+		if c.SMTP.Port <= 0 || c.SMTP.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("SMTP_PORT must be a valid TCP port, got %d", c.SMTP.Port))
+		}
+		if c.SMTP.Username == "" {
+			problems = append(problems, "SMTP_USER is required when SMTP_HOST is set")
+		}
+		if c.SMTP.Password == "" {
+			problems = append(problems, "SMTP_PASSWORD is required when SMTP_HOST is set")
+		}
+		if c.SMTP.MaxAttachmentMB <= 0 {
+			problems = append(problems, fmt.Sprintf("SMTP_MAX_ATTACHMENT_MB must be positive, got %d", c.SMTP.MaxAttachmentMB))
+		}
+	}
+	if c.SMTP.DKIMDomain != "" || c.SMTP.DKIMSelector != "" {
+		if c.SMTP.DKIMDomain == "" || c.SMTP.DKIMSelector == "" {
+			problems = append(problems, "SMTP_DKIM_DOMAIN and SMTP_DKIM_SELECTOR must be set together")
+		}
+		switch {
+		case c.SMTP.DKIMPrivateKeyPath != "" && c.SMTP.DKIMPrivateKey != "":
+			problems = append(problems, "set one of SMTP_DKIM_PRIVATE_KEY_PATH and SMTP_DKIM_PRIVATE_KEY, not both")
+		case c.SMTP.DKIMPrivateKeyPath != "":
+			if _, err := os.Stat(c.SMTP.DKIMPrivateKeyPath); err != nil {
+				problems = append(problems, fmt.Sprintf("SMTP_DKIM_PRIVATE_KEY_PATH %q is not readable: %v", c.SMTP.DKIMPrivateKeyPath, err))
+			}
+		case c.SMTP.DKIMPrivateKey == "":
+			problems = append(problems, "SMTP_DKIM_PRIVATE_KEY_PATH or SMTP_DKIM_PRIVATE_KEY is required when DKIM signing is configured")
+		}
+	}
+
+	switch c.JWT.Algorithm {
+	case "RS256":
+		if _, err := os.Stat(c.JWT.PrivateKeyPath); err != nil {
+			problems = append(problems, fmt.Sprintf("JWT_PRIVATE_KEY_PATH %q is not readable: %v", c.JWT.PrivateKeyPath, err))
+		}
+		if _, err := os.Stat(c.JWT.PublicKeyPath); err != nil {
+			problems = append(problems, fmt.Sprintf("JWT_PUBLIC_KEY_PATH %q is not readable: %v", c.JWT.PublicKeyPath, err))
+		}
+		if c.JWT.VerificationKeysDir != "" {
+			if info, err := os.Stat(c.JWT.VerificationKeysDir); err != nil || !info.IsDir() {
+				problems = append(problems, fmt.Sprintf("JWT_VERIFICATION_KEYS_DIR %q is not a readable directory", c.JWT.VerificationKeysDir))
+			}
+		}
+		for kid, path := range c.JWT.VerificationKeyPaths {
+			if _, err := os.Stat(path); err != nil {
+				problems = append(problems, fmt.Sprintf("JWT_VERIFICATION_KEYS key %q file %q is not readable: %v", kid, path, err))
+			}
+		}
+	case "HS256":
+		if len(c.JWT.VerificationKeyPaths) > 0 || c.JWT.VerificationKeysDir != "" {
+			problems = append(problems, "JWT_VERIFICATION_KEYS/JWT_VERIFICATION_KEYS_DIR must not be set when JWT_ALGORITHM is HS256")
+		}
+		if len(c.JWT.Secret) < minJWTSecretLength {
+			problems = append(problems, fmt.Sprintf("JWT_SECRET must be at least %d bytes when JWT_ALGORITHM is HS256", minJWTSecretLength))
+		}
+		if c.JWT.PrivateKeyPath != "" || c.JWT.PublicKeyPath != "" {
+			problems = append(problems, "JWT_PRIVATE_KEY_PATH/JWT_PUBLIC_KEY_PATH must not be set when JWT_ALGORITHM is HS256")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("JWT_ALGORITHM must be RS256 or HS256, got %q", c.JWT.Algorithm))
+	}
+	if c.JWT.AccessTokenExpiry <= 0 {
+		problems = append(problems, "JWT_ACCESS_TOKEN_EXPIRY must be a positive number of minutes")
+	}
+	if c.JWT.RefreshTokenExpiry <= 0 {
+		problems = append(problems, "JWT_REFRESH_TOKEN_EXPIRY must be a positive number of days")
+	}
+	if c.JWT.Issuer == "" {
+		problems = append(problems, "JWT_ISSUER must not be empty")
+	}
+
+	if c.Kafka.BufferSize <= 0 {
+		problems = append(problems, fmt.Sprintf("KAFKA_BUFFER_SIZE must be positive, got %d", c.Kafka.BufferSize))
+	}
+	if c.Kafka.RetryInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("KAFKA_RETRY_INTERVAL must be a positive duration, got %s", c.Kafka.RetryInterval))
+	}
+	if c.Kafka.OutboxPollInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("KAFKA_OUTBOX_POLL_INTERVAL must be a positive duration, got %s", c.Kafka.OutboxPollInterval))
+	}
+	if c.Kafka.OutboxMaxAttempts < 0 {
+		problems = append(problems, fmt.Sprintf("KAFKA_OUTBOX_MAX_ATTEMPTS must be 0 or more, got %d", c.Kafka.OutboxMaxAttempts))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("CORS_ALLOWED_ORIGINS contains an invalid origin %q", origin))
+		}
+	}
+
+	if c.Templates.TrashRetentionDays <= 0 {
+		problems = append(problems, fmt.Sprintf("TEMPLATE_TRASH_RETENTION_DAYS must be a positive number of days, got %d", c.Templates.TrashRetentionDays))
+	}
+	if c.Templates.TrashSweepInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("TEMPLATE_TRASH_SWEEP_INTERVAL must be a positive duration, got %s", c.Templates.TrashSweepInterval))
+	}
+	if c.Templates.CacheTTL <= 0 {
+		problems = append(problems, fmt.Sprintf("TEMPLATE_CACHE_TTL must be a positive duration, got %s", c.Templates.CacheTTL))
+	}
+	if c.Templates.ListCacheTTL <= 0 {
+		problems = append(problems, fmt.Sprintf("TEMPLATE_LIST_CACHE_TTL must be a positive duration, got %s", c.Templates.ListCacheTTL))
+	}
+	if c.ScopeCache.TTL <= 0 || c.ScopeCache.TTL > 5*time.Minute {
+		problems = append(problems, fmt.Sprintf("USER_SCOPE_CACHE_TTL must be a positive duration of at most 5m, got %s", c.ScopeCache.TTL))
+	}
+	if c.ScopeCache.Size <= 0 {
+		problems = append(problems, fmt.Sprintf("USER_SCOPE_CACHE_SIZE must be positive, got %d", c.ScopeCache.Size))
+	}
+	if c.Security.DenialLimit <= 0 {
+		problems = append(problems, fmt.Sprintf("PERMISSION_DENIAL_LIMIT must be positive, got %d", c.Security.DenialLimit))
+	}
+	if c.Security.DenialWindow <= 0 {
+		problems = append(problems, fmt.Sprintf("PERMISSION_DENIAL_WINDOW must be a positive duration, got %s", c.Security.DenialWindow))
+	}
+	if c.Accounts.DeletionGraceDays < 0 {
+		problems = append(problems, fmt.Sprintf("ACCOUNT_DELETION_GRACE_DAYS must not be negative, got %d", c.Accounts.DeletionGraceDays))
+	}
+	if c.Accounts.DeletionSweepInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("ACCOUNT_DELETION_SWEEP_INTERVAL must be a positive duration, got %s", c.Accounts.DeletionSweepInterval))
+	}
+	if c.Accounts.MasterAdminEmail != "" {
+		if _, err := mail.ParseAddress(c.Accounts.MasterAdminEmail); err != nil {
+			problems = append(problems, fmt.Sprintf("MASTER_ADMIN_EMAIL must be an email address, got %q", c.Accounts.MasterAdminEmail))
+		}
+	}
+	if c.Accounts.MasterAdminPassword != "" && len(c.Accounts.MasterAdminPassword) < minMasterAdminPasswordLength {
+		problems = append(problems, fmt.Sprintf("MASTER_ADMIN_PASSWORD must be at least %d characters", minMasterAdminPasswordLength))
+	}
+
+	if u, err := url.Parse(c.App.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("APP_BASE_URL must be an absolute http(s) URL, got %q", c.App.BaseURL))
+	}
+	for _, endpoint := range c.App.RequireVersion {
+		if !slices.Contains(versionedEndpoints, endpoint) {
+			problems = append(problems, fmt.Sprintf("APP_REQUIRE_VERSION entries must be one of %s, got %q", strings.Join(versionedEndpoints, ", "), endpoint))
+		}
+	}
+	if c.App.PasswordHashCost < password.MinCost || c.App.PasswordHashCost > password.MaxCost {
+		problems = append(problems, fmt.Sprintf("PASSWORD_HASH_COST must be between %d and %d, got %d", password.MinCost, password.MaxCost, c.App.PasswordHashCost))
+	}
+
+	if c.Tracking.BaseURL != "" {
+		if u, err := url.Parse(c.Tracking.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("TRACKING_BASE_URL must be an absolute http(s) URL, got %q", c.Tracking.BaseURL))
+		}
+		if c.Tracking.Secret == "" {
+			problems = append(problems, "TRACKING_SECRET is required when TRACKING_BASE_URL is set")
+		}
+	}
+	if c.Tracking.Secret != "" && len(c.Tracking.Secret) < 32 {
+		problems = append(problems, "TRACKING_SECRET must be at least 32 characters")
+	}
+
+	switch c.Email.Provider {
+	case EmailProviderSMTP:
+		if c.SMTP.Host == "" {
+			problems = append(problems, "SMTP_HOST is required when EMAIL_PROVIDER is smtp")
+		}
+	case EmailProviderSendGrid:
+		if c.Email.SendGridAPIKey == "" {
+			problems = append(problems, "SENDGRID_API_KEY is required when EMAIL_PROVIDER is sendgrid")
+		}
+		if u, err := url.Parse(c.Email.SendGridAPIURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("SENDGRID_API_URL must be an absolute https URL, got %q", c.Email.SendGridAPIURL))
+		}
+		if c.Email.FromEmail == "" {
+			problems = append(problems, "EMAIL_FROM_EMAIL (or SMTP_FROM_EMAIL) is required when EMAIL_PROVIDER is sendgrid")
+		}
+	case EmailProviderLog:
+	default:
+		problems = append(problems, fmt.Sprintf("EMAIL_PROVIDER must be one of smtp, sendgrid or log, got %q", c.Email.Provider))
+	}
+	if c.Email.WebhookSecret != "" && len(c.Email.WebhookSecret) < 32 {
+		problems = append(problems, "EMAIL_WEBHOOK_SECRET must be at least 32 characters")
+	}
+
+	if c.Outbox.PollInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("EMAIL_OUTBOX_POLL_INTERVAL must be a positive duration, got %s", c.Outbox.PollInterval))
+	}
+	if c.Outbox.RetryAfter <= 0 {
+		problems = append(problems, fmt.Sprintf("EMAIL_OUTBOX_RETRY_AFTER must be a positive duration, got %s", c.Outbox.RetryAfter))
+	}
+	if c.Outbox.Backoff <= 0 {
+		problems = append(problems, fmt.Sprintf("EMAIL_OUTBOX_BACKOFF must be a positive duration, got %s", c.Outbox.Backoff))
+	}
+	if c.Outbox.Lease <= 0 {
+		problems = append(problems, fmt.Sprintf("EMAIL_OUTBOX_LEASE must be a positive duration, got %s", c.Outbox.Lease))
+	}
+	if c.Outbox.MaxAge <= c.Outbox.RetryAfter {
+		problems = append(problems, fmt.Sprintf("EMAIL_OUTBOX_MAX_AGE must be longer than EMAIL_OUTBOX_RETRY_AFTER, got %s", c.Outbox.MaxAge))
+	}
+	if c.Outbox.MaxBackoff < c.Outbox.Backoff {
+		problems = append(problems, fmt.Sprintf("EMAIL_OUTBOX_MAX_BACKOFF must not be shorter than EMAIL_OUTBOX_BACKOFF, got %s", c.Outbox.MaxBackoff))
+	}
+	if c.Outbox.MaxAttempts <= 0 {
+		problems = append(problems, fmt.Sprintf("EMAIL_OUTBOX_MAX_ATTEMPTS must be a positive number, got %d", c.Outbox.MaxAttempts))
+	}
+	if c.Digest.Window < 0 || c.Digest.Window > 24*time.Hour {
+		problems = append(problems, fmt.Sprintf("NOTIFICATION_DIGEST_WINDOW must be a duration from 0 to 24h, got %s", c.Digest.Window))
+	}
+	if c.Digest.FlushInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("NOTIFICATION_DIGEST_FLUSH_INTERVAL must be a positive duration, got %s", c.Digest.FlushInterval))
+	}
+	if c.Digest.Lease <= 0 {
+		problems = append(problems, fmt.Sprintf("NOTIFICATION_DIGEST_LEASE must be a positive duration, got %s", c.Digest.Lease))
+	}
+
+	if c.Attachments.MaxUploadMB <= 0 {
+		problems = append(problems, fmt.Sprintf("ATTACHMENT_MAX_UPLOAD_MB must be positive, got %d", c.Attachments.MaxUploadMB))
+	}
+	if len(c.Attachments.AllowedTypes) == 0 {
+		problems = append(problems, "ATTACHMENT_ALLOWED_TYPES must list at least one MIME type")
+	}
+	if c.Attachments.OrphanSweepInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("ATTACHMENT_ORPHAN_SWEEP_INTERVAL must be a positive duration, got %s", c.Attachments.OrphanSweepInterval))
+	}
+
+	if c.Worker.MaxAttempts <= 0 {
+		problems = append(problems, fmt.Sprintf("WORKER_MAX_ATTEMPTS must be a positive number, got %d", c.Worker.MaxAttempts))
+	}
+	if c.Worker.Backoff <= 0 {
+		problems = append(problems, fmt.Sprintf("WORKER_RETRY_BACKOFF must be a positive duration, got %s", c.Worker.Backoff))
+	}
+
+	if c.Reports.WeeklyCheckInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("WEEKLY_REPORT_CHECK_INTERVAL must be a positive duration, got %s", c.Reports.WeeklyCheckInterval))
+	}
+	if c.Reports.WeeklySendHour < 0 || c.Reports.WeeklySendHour > 23 {
+		problems = append(problems, fmt.Sprintf("WEEKLY_REPORT_SEND_HOUR must be an hour from 0 to 23, got %d", c.Reports.WeeklySendHour))
+	}
+	if c.Reports.ExportMaxRows <= 0 || c.Reports.ExportMaxRows >= xlsx.MaxRows {
+		problems = append(problems, fmt.Sprintf("EXPORT_MAX_ROWS must be a positive number of rows below %d, got %d", xlsx.MaxRows, c.Reports.ExportMaxRows))
+	}
+
+	if c.OIDC.Enabled() {
+		if u, err := url.Parse(c.OIDC.IssuerURL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("OIDC_ISSUER_URL must be an absolute URL, got %q", c.OIDC.IssuerURL))
+		}
+		if u, err := url.Parse(c.OIDC.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("OIDC_REDIRECT_URL must be an absolute URL when OIDC_ISSUER_URL is set, got %q", c.OIDC.RedirectURL))
+		}
+		if c.OIDC.ClientID == "" || c.OIDC.ClientSecret == "" {
+			problems = append(problems, "OIDC_CLIENT_ID and OIDC_CLIENT_SECRET are required when OIDC_ISSUER_URL is set")
+		}
+	}
+	if c.OIDC.ClockSkew < 0 {
+		problems = append(problems, fmt.Sprintf("OIDC_CLOCK_SKEW must not be negative, got %s", c.OIDC.ClockSkew))
+	}
+	if c.OIDC.StateTTL <= 0 {
+		problems = append(problems, fmt.Sprintf("OIDC_STATE_TTL must be a positive duration, got %s", c.OIDC.StateTTL))
+	}
+
+	if c.Webhooks.PollInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_POLL_INTERVAL must be a positive duration, got %s", c.Webhooks.PollInterval))
+	}
+	if c.Webhooks.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_TIMEOUT must be a positive duration, got %s", c.Webhooks.Timeout))
+	}
+	if c.Webhooks.MaxAttempts <= 0 {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_MAX_ATTEMPTS must be a positive number, got %d", c.Webhooks.MaxAttempts))
+	}
+	if c.Webhooks.MaxConsecutiveFailures <= 0 {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_MAX_CONSECUTIVE_FAILURES must be a positive number, got %d", c.Webhooks.MaxConsecutiveFailures))
+	}
+
+	switch c.SMS.Provider {
+	case SMSProviderTwilio:
+		if c.SMS.TwilioAccountSID == "" || c.SMS.TwilioAuthToken == "" {
+			problems = append(problems, "TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required when SMS_PROVIDER is twilio")
+		}
+		if u, err := url.Parse(c.SMS.TwilioAPIURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("TWILIO_API_URL must be an absolute https URL, got %q", c.SMS.TwilioAPIURL))
+		}
+		if c.SMS.FromNumber == "" {
+			problems = append(problems, "SMS_FROM_NUMBER is required when SMS_PROVIDER is twilio")
+		}
+	case SMSProviderLog:
+	default:
+		problems = append(problems, fmt.Sprintf("SMS_PROVIDER must be one of twilio or log, got %q", c.SMS.Provider))
+	}
+	if c.SMS.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("SMS_TIMEOUT must be a positive duration, got %s", c.SMS.Timeout))
+	}
+
+	switch c.AuditForward.Target {
+	case "":
+	case AuditForwardSyslog:
+		if _, _, err := net.SplitHostPort(c.AuditForward.SyslogAddress); err != nil {
+			problems = append(problems, fmt.Sprintf("AUDIT_FORWARD_SYSLOG_ADDRESS must be host:port when AUDIT_FORWARD_TARGET is syslog, got %q", c.AuditForward.SyslogAddress))
+		}
+	case AuditForwardHTTPS:
+		if u, err := url.Parse(c.AuditForward.HTTPSURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("AUDIT_FORWARD_HTTPS_URL must be an absolute https URL when AUDIT_FORWARD_TARGET is https, got %q", c.AuditForward.HTTPSURL))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("AUDIT_FORWARD_TARGET must be syslog or https, got %q", c.AuditForward.Target))
+	}
+	if c.AuditForward.Target != "" {
+		if c.AuditForward.Format != "json" && c.AuditForward.Format != "cef" {
+			problems = append(problems, fmt.Sprintf("AUDIT_FORWARD_FORMAT must be json or cef, got %q", c.AuditForward.Format))
+		}
+		if c.AuditForward.BufferSize <= 0 {
+			problems = append(problems, fmt.Sprintf("AUDIT_FORWARD_BUFFER_SIZE must be a positive number, got %d", c.AuditForward.BufferSize))
+		}
+		if c.AuditForward.MaxRetries < 0 {
+			problems = append(problems, fmt.Sprintf("AUDIT_FORWARD_MAX_RETRIES must not be negative, got %d", c.AuditForward.MaxRetries))
+		}
+		if c.AuditForward.Timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("AUDIT_FORWARD_TIMEOUT must be a positive duration, got %s", c.AuditForward.Timeout))
+		}
+	}
+
+	return problems
+}
+
+// envName returns the primary environment variable for a config key (used in error messages)
+func envName(key string) string {
+	if envs, ok := envBindings[key]; ok && len(envs) > 0 {
+		return envs[0]
+	}
+	return key
+}
+
+// parseKeyPaths parses a comma separated list of kid=path pairs
+func parseKeyPaths(value string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, entry := range splitList(value) {
+		kid, path, ok := strings.Cut(entry, "=")
+		kid, path = strings.TrimSpace(kid), strings.TrimSpace(path)
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("must be a comma separated list of kid=path pairs, got %q", entry)
+		}
+		if _, exists := keys[kid]; exists {
+			return nil, fmt.Errorf("contains duplicate key ID %q", kid)
+		}
+		keys[kid] = path
+	}
+	return keys, nil
+}
+
+// splitList splits a comma separated value, dropping empty entries
+func splitList(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
 func setDefaults() {
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.environment", "development")
 	viper.SetDefault("server.version", "1.0.0")
-	
-	// MongoDB defaults
-	viper.SetDefault("mongodb.uri", "mongodb://localhost:27017")
-	viper.SetDefault("mongodb.database", "white_user_db")
+	viper.SetDefault("server.read_timeout", "15s")
+	viper.SetDefault("server.write_timeout", "15s")
+	viper.SetDefault("server.idle_timeout", "60s")
+	viper.SetDefault("server.shutdown_timeout", "30s")
+	viper.SetDefault("server.max_body_bytes", 1<<20)
+	viper.SetDefault("server.auth_rate_limit", 30)
+
+	// MongoDB defaults (URI has no default - it must be configured)
+	viper.SetDefault("mongodb.uri", "")
+	viper.SetDefault("mongodb.database", "white-dev")
 	viper.SetDefault("mongodb.max_pool_size", 100)
 	viper.SetDefault("mongodb.min_pool_size", 10)
 	viper.SetDefault("mongodb.max_retries", 5)
+	viper.SetDefault("mongodb.tls_ca_file", "")
+	viper.SetDefault("mongodb.init_indexes", false)
+	viper.SetDefault("mongodb.strict_indexes", false)
+	viper.SetDefault("mongodb.secondary_reads", true)
 
 	// Kafka defaults
-	viper.SetDefault("kafka.brokers", []string{"localhost:9092"})
+	viper.SetDefault("kafka.brokers", "localhost:9092")
 	viper.SetDefault("kafka.producer_timeout", 5000)
 	viper.SetDefault("kafka.consumer_group", "white-backend")
 	viper.SetDefault("kafka.client_id", "white-backend-producer")
@@ -149,20 +1319,165 @@ func setDefaults() {
 	viper.SetDefault("kafka.password", "")
 	viper.SetDefault("kafka.ssl", false)
 	viper.SetDefault("kafka.sasl_mechanism", "plain")
+	viper.SetDefault("kafka.buffer_size", 1000)
+	viper.SetDefault("kafka.retry_interval", "5s")
+	viper.SetDefault("kafka.outbox_poll_interval", "1s")
+	viper.SetDefault("kafka.outbox_max_attempts", 10)
 
 	// Kafka topic defaults
 	viper.SetDefault("kafka.topics.user_logged_in", "users.logged_in")
 	viper.SetDefault("kafka.topics.user_logged_out", "users.logged_out")
 	viper.SetDefault("kafka.topics.email_sent", "communications.email_sent")
+	viper.SetDefault("kafka.topics.email_queued", "email.queued")
+	viper.SetDefault("kafka.topics.email_queued_urgent", "email.queued.urgent")
+	viper.SetDefault("kafka.topics.email_dead_letter", "email.queued.dlq")
+
+	// Redis defaults (optional)
+	viper.SetDefault("redis.url", "")
+
+	// User scope cache defaults
+	viper.SetDefault("scope_cache.ttl", "2m")
+	viper.SetDefault("scope_cache.size", 10000)
+
+	// SMTP defaults (optional)
+	viper.SetDefault("smtp.host", "")
+	viper.SetDefault("smtp.port", 587)
+	viper.SetDefault("smtp.username", "")
+	viper.SetDefault("smtp.password", "")
+	viper.SetDefault("smtp.from_email", "")
+	viper.SetDefault("smtp.reply_to", "")
+	viper.SetDefault("smtp.tls_enabled", true)
+	viper.SetDefault("smtp.max_attachment_mb", 10)
+	viper.SetDefault("smtp.dkim_domain", "")
+	viper.SetDefault("smtp.dkim_selector", "")
+	viper.SetDefault("smtp.dkim_private_key_path", "")
+	viper.SetDefault("smtp.dkim_private_key", "")
 
 	// JWT defaults
-	viper.SetDefault("jwt.private_key_path", "./secrets/jwt/private.pem")
-	viper.SetDefault("jwt.public_key_path", "./secrets/jwt/public.pem")
-	viper.SetDefault("jwt.access_token_expiry", 15) // 15 minutes
-	viper.SetDefault("jwt.refresh_token_expiry", 7) // 7 days
-	viper.SetDefault("jwt.jwks_endpoint", "")       // JWKS endpoint (optional)
-	viper.SetDefault("jwt.shared_secret", "")       // Shared secret for HS256 (optional)
-
-	// Processor defaults	
+	viper.SetDefault("jwt.algorithm", "RS256")
+	viper.SetDefault("jwt.secret", "")
+	viper.SetDefault("jwt.private_key_path", "")      // defaults to defaultJWTPrivateKeyPath for RS256
+	viper.SetDefault("jwt.public_key_path", "")       // defaults to defaultJWTPublicKeyPath for RS256
+	viper.SetDefault("jwt.key_id", "")                // derived from the key material when empty
+	viper.SetDefault("jwt.verification_keys", "")     // kid=path pairs kept during key rotation
+	viper.SetDefault("jwt.access_token_expiry", 2880) // 2 days (48 hours) in minutes
+	viper.SetDefault("jwt.refresh_token_expiry", 7)   // 7 days
+	viper.SetDefault("jwt.jwks_endpoint", "")         // JWKS endpoint (optional)
+	viper.SetDefault("jwt.shared_secret", "")         // Shared secret for HS256 (optional)
+	viper.SetDefault("jwt.issuer", "white-api")
+	viper.SetDefault("jwt.audience", "")
+	viper.SetDefault("jwt.allow_missing_claims", false)
+
+	// CORS defaults
+	viper.SetDefault("cors.allowed_origins", strings.Join([]string{
+		"http://localhost:3000",
+		"https://electric-exciting-shepherd.ngrok-free.app",
+		"http://localhost:5173",
+		"http://localhost:5174",
+		"http://localhost:5175",
+	}, ","))
+
+	// Frontend defaults
+	viper.SetDefault("app.base_url", "http://localhost:5173")
+	viper.SetDefault("app.require_version", "")
+	viper.SetDefault("app.password_hash_cost", password.DefaultCost)
+
+	// Template library defaults
+	viper.SetDefault("templates.trash_retention_days", 30)
+	viper.SetDefault("templates.trash_sweep_interval", "1h")
+	viper.SetDefault("templates.cache_ttl", "15m")
+	viper.SetDefault("templates.list_cache_ttl", "30s")
+
+	// Account closing defaults
+	viper.SetDefault("security.denial_limit", 20)
+	viper.SetDefault("security.denial_window", "10m")
+	viper.SetDefault("accounts.deletion_grace_days", 14)
+	viper.SetDefault("accounts.deletion_sweep_interval", "1h")
+	viper.SetDefault("accounts.master_admin_email", "")
+	viper.SetDefault("accounts.master_admin_name", "Master Admin")
+	viper.SetDefault("accounts.master_admin_password", "")
+
+	// Email tracking defaults (disabled)
+	viper.SetDefault("tracking.base_url", "")
+	viper.SetDefault("tracking.secret", "")
+
+	// Email provider defaults (chosen from SMTP_HOST when unset)
+	viper.SetDefault("email.provider", "")
+	viper.SetDefault("email.sendgrid_api_key", "")
+	viper.SetDefault("email.sendgrid_api_url", "https://api.sendgrid.com")
+	viper.SetDefault("email.from_email", "")
+	viper.SetDefault("email.from_name", "White Platform")
+	viper.SetDefault("email.webhook_secret", "")
+
+	// Email outbox worker defaults
+	viper.SetDefault("outbox.poll_interval", "30s")
+	viper.SetDefault("outbox.retry_after", "2m")
+	viper.SetDefault("outbox.max_age", "24h")
+	viper.SetDefault("outbox.max_attempts", 5)
+	viper.SetDefault("outbox.backoff", "1m")
+	viper.SetDefault("outbox.max_backoff", "1h")
+	viper.SetDefault("outbox.lease", "2m")
+
+	viper.SetDefault("digest.window", "15m")
+	viper.SetDefault("digest.flush_interval", "1m")
+	viper.SetDefault("digest.lease", "2m")
+
+	// Attachment upload defaults
+	viper.SetDefault("attachments.max_upload_mb", 10)
+	viper.SetDefault("attachments.allowed_types", strings.Join([]string{
+		"application/pdf",
+		"application/msword",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.ms-excel",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.ms-powerpoint",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/zip",
+		"text/plain",
+		"text/csv",
+		"image/png",
+		"image/jpeg",
+		"image/gif",
+		"image/webp",
+	}, ","))
+	viper.SetDefault("attachments.orphan_sweep_interval", "6h")
+
+	// Email queue worker defaults
+	viper.SetDefault("worker.enabled", false)
+	viper.SetDefault("worker.max_attempts", 3)
+	viper.SetDefault("worker.retry_backoff", "5s")
+
+	// Weekly report defaults
+	viper.SetDefault("reports.weekly_check_interval", "15m")
+	viper.SetDefault("reports.weekly_send_hour", 8)
+	viper.SetDefault("reports.export_max_rows", 50000)
+
+	// OpenID Connect SSO defaults
+	viper.SetDefault("oidc.clock_skew", "2m")
+	viper.SetDefault("oidc.state_ttl", "10m")
+
+	// Webhook delivery defaults
+	viper.SetDefault("webhooks.poll_interval", "10s")
+	viper.SetDefault("webhooks.timeout", "10s")
+	viper.SetDefault("webhooks.max_attempts", 6)
+	viper.SetDefault("webhooks.max_consecutive_failures", 20)
+
+	// SMS defaults
+	viper.SetDefault("sms.provider", "")
+	viper.SetDefault("sms.twilio_api_url", "https://api.twilio.com")
+	viper.SetDefault("sms.timeout", "5s")
+	viper.SetDefault("sms.fallback_to_email", true)
+
+	// SIEM audit forwarding defaults
+	viper.SetDefault("audit_forward.target", "")
+	viper.SetDefault("audit_forward.format", "json")
+	viper.SetDefault("audit_forward.syslog_tls", true)
+	viper.SetDefault("audit_forward.auth_header", "Authorization")
+	viper.SetDefault("audit_forward.buffer_size", 1000)
+	viper.SetDefault("audit_forward.max_retries", 3)
+	viper.SetDefault("audit_forward.timeout", "5s")
+	viper.SetDefault("audit_forward.dry_run", false)
+
+	// Processor defaults
 	viper.SetDefault("processor.port", 8081) // Health check port for processor
-}
\ No newline at end of file
+}
@@ -2,85 +2,269 @@ package cache
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sync/atomic"
 	"time"
 
-	"github.com/white/user-management/internal/models"
 	"github.com/redis/go-redis/v9"
+	"github.com/white/user-management/internal/models"
 )
 
-// TemplateCache provides Redis caching for templates
+// warningInterval throttles the Redis failure warnings so an outage logs once in a while, not per request
+const warningInterval = 30 * time.Second
+
+// TemplateCache provides Redis caching for published templates and for
+// template listing pages. Every operation is best-effort: Redis errors are
+// logged and treated as misses so callers always fall back to the database.
 type TemplateCache struct {
-	client *redis.Client
-	ttl    time.Duration
+	client  *redis.Client
+	ttl     time.Duration
+	listTTL time.Duration
+	flight  flightGroup
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	errors      atomic.Uint64
+	lastWarning atomic.Int64
+}
+
+// TemplateCacheStats are the cache counters since the process started
+type TemplateCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"` // Templates removed and tenant listings invalidated
+	Errors    uint64 `json:"errors"`    // Redis failures (served from the database)
 }
 
-// NewTemplateCache creates a new template cache with 15-minute TTL
-func NewTemplateCache(client *redis.Client) *TemplateCache {
+// TemplateListPage is a cached page of a template listing
+type TemplateListPage struct {
+	Templates []*models.MongoTemplate `json:"templates"`
+	Total     int64                   `json:"total"`
+}
+
+// NewTemplateCache creates a new template cache. ttl applies to single
+// templates and listTTL to listing pages, which should stay short because a
+// listing also carries usage counters.
+func NewTemplateCache(client *redis.Client, ttl, listTTL time.Duration) *TemplateCache {
 	return &TemplateCache{
-		client: client,
-		ttl:    15 * time.Minute, // 900 seconds as per spec
+		client:  client,
+		ttl:     ttl,
+		listTTL: listTTL,
 	}
 }
 
-// Get retrieves a template from cache
-// Returns error if cache miss or deserialization fails
-func (c *TemplateCache) Get(tenantID, templateID string) (*models.MongoTemplate, error) {
-	ctx := context.Background()
-	key := c.buildKey(tenantID, templateID)
+// Get retrieves a template from cache. ok is false on a miss or a Redis error.
+func (c *TemplateCache) Get(ctx context.Context, tenantID, templateID string) (template *models.MongoTemplate, ok bool) {
+	if !c.get(ctx, c.buildKey(tenantID, templateID), &template) {
+		return nil, false
+	}
+	return template, true
+}
 
-	// Get value from Redis
-	val, err := c.client.Get(ctx, key).Result()
-	if err == redis.Nil {
-		return nil, fmt.Errorf("cache miss: template not found in cache")
+// GetOrLoad returns a cached template, or loads it on a miss and caches it when
+// it is published. Concurrent misses for the same template share one load, so
+// the returned template must be treated as read-only.
+func (c *TemplateCache) GetOrLoad(ctx context.Context, tenantID, templateID string, load func(context.Context) (*models.MongoTemplate, error)) (*models.MongoTemplate, error) {
+	if template, ok := c.Get(ctx, tenantID, templateID); ok {
+		return template, nil
 	}
+
+	// The shared load must not fail every waiter when the first caller goes away
+	loadCtx := context.WithoutCancel(ctx)
+	val, err, _ := c.flight.do(c.buildKey(tenantID, templateID), func() (interface{}, error) {
+		template, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		if template.Status == string(models.TemplateStatusPublished) {
+			c.Set(loadCtx, template)
+		}
+		return template, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("redis error: %w", err)
+		return nil, err
 	}
+	return val.(*models.MongoTemplate), nil
+}
+
+// Set stores a template in cache with TTL
+func (c *TemplateCache) Set(ctx context.Context, template *models.MongoTemplate) {
+	c.set(ctx, c.buildKey(template.TenantID, template.ID), template, c.ttl)
+}
 
-	// Deserialize JSON
-	var template models.MongoTemplate
-	if err := json.Unmarshal([]byte(val), &template); err != nil {
-		return nil, fmt.Errorf("failed to deserialize template: %w", err)
+// Delete removes templates from cache and invalidates the tenant's cached
+// listings. Used for cache invalidation on every template mutation.
+func (c *TemplateCache) Delete(ctx context.Context, tenantID string, templateIDs ...string) {
+	if len(templateIDs) > 0 {
+		keys := make([]string, 0, len(templateIDs))
+		for _, id := range templateIDs {
+			keys = append(keys, c.buildKey(tenantID, id))
+		}
+		deleted, err := c.client.Del(ctx, keys...).Result()
+		if err != nil {
+			c.warn("delete", err)
+		}
+		c.evictions.Add(uint64(deleted))
 	}
+	c.InvalidateLists(ctx, tenantID)
+}
 
-	return &template, nil
+// InvalidateLists drops every cached listing of a tenant by moving it to a new
+// list generation; the old pages are no longer read and expire on their own
+func (c *TemplateCache) InvalidateLists(ctx context.Context, tenantID string) {
+	if err := c.client.Incr(ctx, c.listGenerationKey(tenantID)).Err(); err != nil {
+		c.warn("invalidate lists", err)
+		return
+	}
+	c.evictions.Add(1)
 }
 
-// Set stores a template in cache with TTL
-// Serializes template to JSON and stores in Redis
-func (c *TemplateCache) Set(template *models.MongoTemplate) error {
-	ctx := context.Background()
-	key := c.buildKey(template.TenantID, template.ID)
+// GetOrLoadList returns a cached listing page for the tenant and filters, or
+// loads and caches it on a miss. filters must capture everything the page
+// depends on, including the caller's data scope. Concurrent misses share one load.
+func (c *TemplateCache) GetOrLoadList(ctx context.Context, tenantID string, filters interface{}, load func(context.Context) (*TemplateListPage, error)) (*TemplateListPage, error) {
+	key, ok := c.listKey(ctx, tenantID, filters)
+	if !ok {
+		return load(ctx)
+	}
 
-	// Serialize template to JSON
-	data, err := json.Marshal(template)
+	var page *TemplateListPage
+	if c.get(ctx, key, &page) {
+		return page, nil
+	}
+
+	loadCtx := context.WithoutCancel(ctx)
+	val, err, _ := c.flight.do(key, func() (interface{}, error) {
+		page, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		c.set(loadCtx, key, page, c.listTTL)
+		return page, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to serialize template: %w", err)
+		return nil, err
 	}
+	return val.(*TemplateListPage), nil
+}
 
-	// Store in Redis with TTL
-	err = c.client.Set(ctx, key, data, c.ttl).Err()
+// FlushTenant removes every cached template and listing of a tenant and
+// returns how many keys were deleted. Unlike the other operations it reports
+// Redis errors, since an admin asked for it explicitly.
+func (c *TemplateCache) FlushTenant(ctx context.Context, tenantID string) (int64, error) {
+	if err := c.client.Incr(ctx, c.listGenerationKey(tenantID)).Err(); err != nil {
+		return 0, fmt.Errorf("failed to invalidate template lists: %w", err)
+	}
+
+	var deleted int64
+	for _, pattern := range []string{c.buildKey(tenantID, "*"), fmt.Sprintf("template:list:%s:*", tenantID)} {
+		iter := c.client.Scan(ctx, 0, pattern, 500).Iterator()
+		var batch []string
+		for iter.Next(ctx) {
+			batch = append(batch, iter.Val())
+			if len(batch) == 500 {
+				n, err := c.client.Del(ctx, batch...).Result()
+				if err != nil {
+					return deleted, fmt.Errorf("failed to delete cache keys: %w", err)
+				}
+				deleted += n
+				batch = batch[:0]
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return deleted, fmt.Errorf("failed to scan cache keys: %w", err)
+		}
+		if len(batch) > 0 {
+			n, err := c.client.Del(ctx, batch...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete cache keys: %w", err)
+			}
+			deleted += n
+		}
+	}
+
+	c.evictions.Add(uint64(deleted))
+	return deleted, nil
+}
+
+// Stats returns the cache counters
+func (c *TemplateCache) Stats() TemplateCacheStats {
+	return TemplateCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Errors:    c.errors.Load(),
+	}
+}
+
+// get reads and decodes a cached value, counting the hit or miss
+func (c *TemplateCache) get(ctx context.Context, key string, dest interface{}) bool {
+	val, err := c.client.Get(ctx, key).Bytes()
 	if err != nil {
-		return fmt.Errorf("failed to set cache: %w", err)
+		if err != redis.Nil {
+			c.warn("get", err)
+		}
+		c.misses.Add(1)
+		return false
+	}
+
+	if err := json.Unmarshal(val, dest); err != nil {
+		c.warn("decode "+key, err)
+		c.misses.Add(1)
+		return false
 	}
 
-	return nil
+	c.hits.Add(1)
+	return true
 }
 
-// Delete removes a template from cache
-// Used for cache invalidation on update/delete/publish/unpublish
-func (c *TemplateCache) Delete(tenantID, templateID string) error {
-	ctx := context.Background()
-	key := c.buildKey(tenantID, templateID)
+// set encodes and stores a value with TTL
+func (c *TemplateCache) set(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.warn("encode "+key, err)
+		return
+	}
+	if err := c.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		c.warn("set", err)
+	}
+}
 
-	err := c.client.Del(ctx, key).Err()
+// listKey builds the key of a listing page from the tenant's current list
+// generation and a hash of the filters. ok is false when Redis is unavailable.
+func (c *TemplateCache) listKey(ctx context.Context, tenantID string, filters interface{}) (key string, ok bool) {
+	generation, err := c.client.Get(ctx, c.listGenerationKey(tenantID)).Result()
+	if err == redis.Nil {
+		generation = "0"
+	} else if err != nil {
+		c.warn("get list generation", err)
+		c.misses.Add(1)
+		return "", false
+	}
+
+	data, err := json.Marshal(filters)
 	if err != nil {
-		return fmt.Errorf("failed to delete cache: %w", err)
+		c.warn("encode list filters", err)
+		return "", false
 	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("template:list:%s:%s:%s", tenantID, generation, hex.EncodeToString(sum[:16])), true
+}
 
-	return nil
+// warn counts a Redis failure and logs it at most once per warningInterval
+func (c *TemplateCache) warn(op string, err error) {
+	c.errors.Add(1)
+	now := time.Now().UnixNano()
+	last := c.lastWarning.Load()
+	if now-last < int64(warningInterval) || !c.lastWarning.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("Warning: template cache %s failed, serving from the database: %v", op, err)
 }
 
 // buildKey creates the Redis key for a template
@@ -88,3 +272,9 @@ func (c *TemplateCache) Delete(tenantID, templateID string) error {
 func (c *TemplateCache) buildKey(tenantID, templateID string) string {
 	return fmt.Sprintf("template:%s:%s", tenantID, templateID)
 }
+
+// listGenerationKey creates the Redis key holding a tenant's list generation
+// Format: template:list-gen:{tenant_id}
+func (c *TemplateCache) listGenerationKey(tenantID string) string {
+	return fmt.Sprintf("template:list-gen:%s", tenantID)
+}
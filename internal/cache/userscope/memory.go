@@ -0,0 +1,133 @@
+package userscope
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is a Cache kept in the process, evicting the least recently used
+// users and teams beyond its size. Invalidations only reach this instance;
+// other instances see a change once their own entries expire.
+type Memory struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	order *list.List // Most recently used first
+	items map[string]*list.Element
+}
+
+// memoryItem is one cached user entry or team member list
+type memoryItem struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewMemory creates a Memory cache holding up to size users and teams for ttl
+func NewMemory(size int, ttl time.Duration) *Memory {
+	return &Memory{
+		ttl:   ttl,
+		size:  size,
+		now:   time.Now,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// GetUser returns the cached entry of a user
+func (m *Memory) GetUser(_ context.Context, userID string) (*Entry, bool) {
+	entry, ok := m.get(userKey(userID)).(*Entry)
+	return entry, ok
+}
+
+// SetUser caches the entry of a user
+func (m *Memory) SetUser(_ context.Context, userID string, entry *Entry) {
+	m.set(userKey(userID), entry)
+}
+
+// InvalidateUser drops the cached entry of a user
+func (m *Memory) InvalidateUser(_ context.Context, userID string) {
+	m.delete(userKey(userID))
+}
+
+// GetTeam returns the cached member IDs of a team
+func (m *Memory) GetTeam(_ context.Context, team string) ([]string, bool) {
+	userIDs, ok := m.get(teamKey(team)).([]string)
+	return userIDs, ok
+}
+
+// SetTeam caches the member IDs of a team
+func (m *Memory) SetTeam(_ context.Context, team string, userIDs []string) {
+	if userIDs == nil {
+		userIDs = []string{}
+	}
+	m.set(teamKey(team), userIDs)
+}
+
+// InvalidateTeam drops the cached member IDs of a team
+func (m *Memory) InvalidateTeam(_ context.Context, team string) {
+	m.delete(teamKey(team))
+}
+
+// InvalidateAll drops every cached user and team
+func (m *Memory) InvalidateAll(_ context.Context) {
+	m.mu.Lock()
+	m.order.Init()
+	clear(m.items)
+	m.mu.Unlock()
+}
+
+// get returns the unexpired value of key, marking it recently used
+func (m *Memory) get(key string) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	item := element.Value.(*memoryItem)
+	if !m.now().Before(item.expiresAt) {
+		m.order.Remove(element)
+		delete(m.items, key)
+		return nil
+	}
+	m.order.MoveToFront(element)
+	return item.value
+}
+
+// set stores value under key, evicting the least recently used beyond size
+func (m *Memory) set(key string, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expiresAt := m.now().Add(m.ttl)
+	if element, ok := m.items[key]; ok {
+		item := element.Value.(*memoryItem)
+		item.value, item.expiresAt = value, expiresAt
+		m.order.MoveToFront(element)
+		return
+	}
+	m.items[key] = m.order.PushFront(&memoryItem{key: key, value: value, expiresAt: expiresAt})
+	for m.size > 0 && m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryItem).key)
+	}
+}
+
+// delete drops key
+func (m *Memory) delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.items[key]; ok {
+		m.order.Remove(element)
+		delete(m.items, key)
+	}
+}
+
+// userKey and teamKey keep users and teams apart within one key space
+func userKey(userID string) string { return "user:" + userID }
+func teamKey(team string) string   { return "team:" + team }
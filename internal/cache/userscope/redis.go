@@ -0,0 +1,136 @@
+package userscope
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces every key of the Redis cache
+const keyPrefix = "userscope:"
+
+// warningInterval throttles the Redis failure warnings so an outage logs
+// once in a while, not per request
+const warningInterval = 30 * time.Second
+
+// Redis is a Cache shared by every instance through Redis, so an
+// invalidation on one instance applies on all of them
+type Redis struct {
+	client      *redis.Client
+	ttl         time.Duration
+	lastWarning atomic.Int64
+}
+
+// NewRedis creates a Redis cache keeping users and teams for ttl
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl}
+}
+
+// GetUser returns the cached entry of a user
+func (c *Redis) GetUser(ctx context.Context, userID string) (*Entry, bool) {
+	var entry *Entry
+	if !c.get(ctx, keyPrefix+userKey(userID), &entry) || entry == nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+// SetUser caches the entry of a user
+func (c *Redis) SetUser(ctx context.Context, userID string, entry *Entry) {
+	c.set(ctx, keyPrefix+userKey(userID), entry)
+}
+
+// InvalidateUser drops the cached entry of a user
+func (c *Redis) InvalidateUser(ctx context.Context, userID string) {
+	c.delete(ctx, keyPrefix+userKey(userID))
+}
+
+// GetTeam returns the cached member IDs of a team
+func (c *Redis) GetTeam(ctx context.Context, team string) ([]string, bool) {
+	var userIDs []string
+	if !c.get(ctx, keyPrefix+teamKey(team), &userIDs) {
+		return nil, false
+	}
+	return userIDs, true
+}
+
+// SetTeam caches the member IDs of a team
+func (c *Redis) SetTeam(ctx context.Context, team string, userIDs []string) {
+	if userIDs == nil {
+		userIDs = []string{}
+	}
+	c.set(ctx, keyPrefix+teamKey(team), userIDs)
+}
+
+// InvalidateTeam drops the cached member IDs of a team
+func (c *Redis) InvalidateTeam(ctx context.Context, team string) {
+	c.delete(ctx, keyPrefix+teamKey(team))
+}
+
+// InvalidateAll drops every cached user and team
+func (c *Redis) InvalidateAll(ctx context.Context) {
+	iter := c.client.Scan(ctx, 0, keyPrefix+"*", 500).Iterator()
+	var batch []string
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == 500 {
+			c.delete(ctx, batch...)
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		c.warn("scan", err)
+	}
+	if len(batch) > 0 {
+		c.delete(ctx, batch...)
+	}
+}
+
+// get reads and decodes a cached value
+func (c *Redis) get(ctx context.Context, key string, dest interface{}) bool {
+	val, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			c.warn("get", err)
+		}
+		return false
+	}
+	if err := json.Unmarshal(val, dest); err != nil {
+		c.warn("decode "+key, err)
+		return false
+	}
+	return true
+}
+
+// set encodes and stores a value with the TTL
+func (c *Redis) set(ctx context.Context, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.warn("encode "+key, err)
+		return
+	}
+	if err := c.client.Set(ctx, key, data, c.ttl).Err(); err != nil {
+		c.warn("set", err)
+	}
+}
+
+// delete drops keys
+func (c *Redis) delete(ctx context.Context, keys ...string) {
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		c.warn("delete", err)
+	}
+}
+
+// warn logs a Redis failure at most once per warningInterval
+func (c *Redis) warn(op string, err error) {
+	now := time.Now().UnixNano()
+	last := c.lastWarning.Load()
+	if now-last < int64(warningInterval) || !c.lastWarning.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("Warning: user scope cache %s failed, reading from the database: %v", op, err)
+}
@@ -0,0 +1,66 @@
+// Package userscope caches the access-control data every authorized request
+// needs: the role, custom roles, direct grants and data scope override of a
+// user, and the IDs of the members of a team that team data scopes filter
+// by. Cache is implemented in memory, the default, and in Redis, so that
+// every instance of a multi-instance deployment sees an invalidation at once.
+//
+// Entries expire after a TTL; callers invalidate them explicitly when a
+// user's roles, grants, data scope or team change.
+package userscope
+
+import (
+	"context"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// Cache stores user entries by user ID and member ID lists by team code.
+// Every operation is best-effort: a failing backend behaves like a miss.
+// Returned values are shared and must be treated as read-only.
+type Cache interface {
+	// GetUser returns the cached entry of a user. ok is false on a miss.
+	GetUser(ctx context.Context, userID string) (entry *Entry, ok bool)
+	// SetUser caches the entry of a user
+	SetUser(ctx context.Context, userID string, entry *Entry)
+	// InvalidateUser drops the cached entry of a user
+	InvalidateUser(ctx context.Context, userID string)
+
+	// GetTeam returns the cached member IDs of a team. ok is false on a miss.
+	GetTeam(ctx context.Context, team string) (userIDs []string, ok bool)
+	// SetTeam caches the member IDs of a team
+	SetTeam(ctx context.Context, team string, userIDs []string)
+	// InvalidateTeam drops the cached member IDs of a team
+	InvalidateTeam(ctx context.Context, team string)
+
+	// InvalidateAll drops every cached user and team
+	InvalidateAll(ctx context.Context)
+}
+
+// Entry is the access-control data of a user as stored on their document.
+// Unknown users are cached too, with Exists false.
+type Entry struct {
+	Exists    bool              `json:"exists"`
+	IsActive  bool              `json:"isActive"`
+	Role      string            `json:"role,omitempty"`
+	Team      string            `json:"team,omitempty"`
+	RoleIDs   []string          `json:"roleIds,omitempty"`   // Custom roles held besides the role
+	Grants    []string          `json:"grants,omitempty"`    // Permissions granted directly
+	DataScope *models.DataScope `json:"dataScope,omitempty"` // The user's own override of the role's data scope
+}
+
+// NewEntry returns the entry of user, or the entry of an unknown user when
+// user is nil
+func NewEntry(user *models.User) *Entry {
+	if user == nil {
+		return &Entry{}
+	}
+	return &Entry{
+		Exists:    true,
+		IsActive:  user.IsActive,
+		Role:      string(user.Role),
+		Team:      user.Team,
+		RoleIDs:   user.RoleIDs,
+		Grants:    user.Permissions,
+		DataScope: user.DataScope,
+	}
+}
@@ -0,0 +1,317 @@
+// Package emailtemplates holds the default content of the system emails the
+// platform sends on its own: the sign-in verification code, the password
+// reset link, the team invitation and the account deactivation notice.
+//
+// Each email is three embedded files under templates/: <name>.subject.tmpl
+// and <name>.txt.tmpl, rendered with text/template, and <name>.html.tmpl,
+// rendered with html/template so values are escaped for their context. The
+// data each email takes is a typed struct implementing Data, available to
+// the files as .Data, and the organisation's look as a Branding, available
+// as .Brand.
+//
+// The wording is not in the files: they look it up in the i18n catalogs
+// with .T "email.<name>.<part>", passing values as name, value pairs, so an
+// email is rendered in the recipient's language and a language is added
+// with a catalog alone. .THTML does the same where a value is markup, such
+// as .MailTo or .Strong.
+//
+// A deployment can replace the defaults with a template in the templates
+// collection carrying the email's Key as its system key (see
+// services.SystemEmails). Such overrides are written with the merge tags of
+// the template library ({{name}}, {{code}}, ...) rather than Go templates;
+// Data.Variables and Branding.Variables list the tags each email offers.
+package emailtemplates
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strconv"
+	texttemplate "text/template"
+
+	"github.com/white/user-management/internal/i18n"
+)
+
+// Keys identifying the system emails, used as the system key of overrides
+const (
+	KeyTwoFactorOTP  = "system.2fa_otp"
+	KeyPasswordReset = "system.password_reset"
+	KeyInvitation    = "system.invitation"
+
+	KeyAccountDeactivated = "system.account_deactivated"
+)
+
+//go:embed templates/*.tmpl
+var files embed.FS
+
+// Data is the content of one system email
+type Data interface {
+	// Key identifies the email the data is for
+	Key() string
+	// Variables returns the merge tag values overrides are rendered with
+	Variables() map[string]string
+}
+
+// Branding is the organisation's look applied to every system email. Empty
+// fields fall back to DefaultBranding.
+type Branding struct {
+	Name         string // Product name shown in subjects, headings and sign-offs
+	PrimaryColor string // Hex color of headers and buttons
+	LogoURL      string // https URL of the logo shown in the header
+	FooterText   string
+	SupportEmail string
+	Tagline      string // Introduces the product in invitations
+}
+
+// DefaultBranding is the look of system emails of an organisation that has
+// not set its own
+var DefaultBranding = Branding{
+	Name:         "White Platform",
+	PrimaryColor: "#667eea",
+	Tagline:      "White is an AI-powered B2B sales engagement platform that helps teams manage their sales pipeline efficiently.",
+}
+
+// WithDefaults returns b with its empty Name, PrimaryColor and Tagline taken
+// from DefaultBranding. The logo, footer and support address stay empty, so
+// the emails leave them out.
+func (b Branding) WithDefaults() Branding {
+	if b.Name == "" {
+		b.Name = DefaultBranding.Name
+	}
+	if b.PrimaryColor == "" {
+		b.PrimaryColor = DefaultBranding.PrimaryColor
+	}
+	if b.Tagline == "" {
+		b.Tagline = DefaultBranding.Tagline
+	}
+	return b
+}
+
+// Variables returns the companyName, brandColor, logoUrl, footerText,
+// supportEmail and tagline merge tags, offered by every system email
+func (b Branding) Variables() map[string]string {
+	return map[string]string{
+		"companyName":  b.Name,
+		"brandColor":   b.PrimaryColor,
+		"logoUrl":      b.LogoURL,
+		"footerText":   b.FooterText,
+		"supportEmail": b.SupportEmail,
+		"tagline":      b.Tagline,
+	}
+}
+
+// Variables returns the merge tags of data with those of brand
+func Variables(data Data, brand Branding) map[string]string {
+	vars := brand.Variables()
+	for tag, value := range data.Variables() {
+		vars[tag] = value
+	}
+	return vars
+}
+
+// Email is a rendered system email
+type Email struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"bodyHtml"`
+	Text    string `json:"bodyText"`
+}
+
+// OTPData is the content of the sign-in verification code email
+type OTPData struct {
+	Name         string
+	Code         string
+	ValidMinutes int
+}
+
+// Key returns KeyTwoFactorOTP
+func (OTPData) Key() string { return KeyTwoFactorOTP }
+
+// Variables returns the name, code and validMinutes merge tags
+func (d OTPData) Variables() map[string]string {
+	return map[string]string{
+		"name":         d.Name,
+		"code":         d.Code,
+		"validMinutes": strconv.Itoa(d.ValidMinutes),
+	}
+}
+
+// PasswordResetData is the content of the password reset email
+type PasswordResetData struct {
+	Name         string
+	ResetURL     string
+	ValidMinutes int
+}
+
+// Key returns KeyPasswordReset
+func (PasswordResetData) Key() string { return KeyPasswordReset }
+
+// Variables returns the name, resetUrl and validMinutes merge tags
+func (d PasswordResetData) Variables() map[string]string {
+	return map[string]string{
+		"name":         d.Name,
+		"resetUrl":     d.ResetURL,
+		"validMinutes": strconv.Itoa(d.ValidMinutes),
+	}
+}
+
+// InvitationData is the content of the team invitation email
+type InvitationData struct {
+	FirstName string
+	InviteURL string
+	ValidDays int
+}
+
+// Key returns KeyInvitation
+func (InvitationData) Key() string { return KeyInvitation }
+
+// Variables returns the firstName, inviteUrl and validDays merge tags
+func (d InvitationData) Variables() map[string]string {
+	return map[string]string{
+		"firstName": d.FirstName,
+		"inviteUrl": d.InviteURL,
+		"validDays": strconv.Itoa(d.ValidDays),
+	}
+}
+
+// AccountDeactivatedData is the content of the email confirming a user
+// deactivated their own account
+type AccountDeactivatedData struct {
+	Name          string
+	DeactivatedAt string // Formatted for display
+}
+
+// Key returns KeyAccountDeactivated
+func (AccountDeactivatedData) Key() string { return KeyAccountDeactivated }
+
+// Variables returns the name and deactivatedAt merge tags
+func (d AccountDeactivatedData) Variables() map[string]string {
+	return map[string]string{
+		"name":          d.Name,
+		"deactivatedAt": d.DeactivatedAt,
+	}
+}
+
+// defaultTemplate is the parsed embedded content of one system email
+type defaultTemplate struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+	sample  Data // Placeholder content shown by previews
+}
+
+// defaults maps each key to its embedded content. The files are part of the
+// binary, so a parse error is a build defect and panics at startup.
+var defaults = map[string]*defaultTemplate{
+	KeyTwoFactorOTP: mustParse("2fa_otp", OTPData{
+		Name: "Jane Doe", Code: "123456", ValidMinutes: 10,
+	}),
+	KeyPasswordReset: mustParse("password_reset", PasswordResetData{
+		Name: "Jane Doe", ResetURL: "https://app.example.com/auth/password/reset?token=example", ValidMinutes: 60,
+	}),
+	KeyInvitation: mustParse("invitation", InvitationData{
+		FirstName: "Jane", InviteURL: "https://app.example.com/signup?token=example", ValidDays: 7,
+	}),
+	KeyAccountDeactivated: mustParse("account_deactivated", AccountDeactivatedData{
+		Name: "Jane Doe", DeactivatedAt: "2 Jan 2006 15:04 UTC",
+	}),
+}
+
+func mustParse(name string, sample Data) *defaultTemplate {
+	return &defaultTemplate{
+		subject: texttemplate.Must(texttemplate.ParseFS(files, "templates/"+name+".subject.tmpl")),
+		html:    htmltemplate.Must(htmltemplate.ParseFS(files, "templates/"+name+".html.tmpl")),
+		text:    texttemplate.Must(texttemplate.ParseFS(files, "templates/"+name+".txt.tmpl")),
+		sample:  sample,
+	}
+}
+
+// Keys returns the keys of every system email, sorted
+func Keys() []string {
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Sample returns placeholder content for the email with key, for previews
+func Sample(key string) (Data, bool) {
+	def, ok := defaults[key]
+	if !ok {
+		return nil, false
+	}
+	return def.sample, true
+}
+
+// message is what the embedded files are executed with
+type message struct {
+	Data  Data
+	Brand Branding
+	t     *i18n.Translator
+}
+
+// Locale returns the language the email is written in
+func (m message) Locale() string {
+	return m.t.Locale()
+}
+
+// T returns the catalog text with key in the email's language, its
+// placeholders filled in from args, given as name, value pairs
+func (m message) T(key string, args ...any) string {
+	return m.t.Text(key, args...)
+}
+
+// THTML is T for HTML bodies where values may be markup: the text and the
+// values are escaped, except values that are already htmltemplate.HTML
+func (m message) THTML(key string, args ...any) htmltemplate.HTML {
+	escaped := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case htmltemplate.HTML:
+			escaped[i] = string(v)
+		default:
+			escaped[i] = htmltemplate.HTMLEscapeString(fmt.Sprint(v))
+		}
+	}
+	return htmltemplate.HTML(i18n.Format(htmltemplate.HTMLEscapeString(m.t.Message(key)), escaped...))
+}
+
+// MailTo returns a mailto link to address, for THTML
+func (m message) MailTo(address string) htmltemplate.HTML {
+	return htmltemplate.HTML(`<a href="mailto:` + htmltemplate.HTMLEscapeString(address) + `">` + htmltemplate.HTMLEscapeString(address) + `</a>`)
+}
+
+// Strong returns text in bold, for THTML
+func (m message) Strong(text string) htmltemplate.HTML {
+	return htmltemplate.HTML("<strong>" + htmltemplate.HTMLEscapeString(text) + "</strong>")
+}
+
+// Render renders the embedded default of the email data is for, in brand
+// with its empty fields defaulted and in the language of t; nil renders it
+// in English, as does t for any text its catalog lacks
+func Render(data Data, brand Branding, t *i18n.Translator) (*Email, error) {
+	def, ok := defaults[data.Key()]
+	if !ok {
+		return nil, fmt.Errorf("unknown system email %q", data.Key())
+	}
+
+	msg := message{Data: data, Brand: brand.WithDefaults(), t: t}
+	var subject, html, text bytes.Buffer
+	if err := def.subject.Execute(&subject, msg); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", data.Key(), err)
+	}
+	if err := def.html.Execute(&html, msg); err != nil {
+		return nil, fmt.Errorf("failed to render %s HTML body: %w", data.Key(), err)
+	}
+	if err := def.text.Execute(&text, msg); err != nil {
+		return nil, fmt.Errorf("failed to render %s text body: %w", data.Key(), err)
+	}
+	return &Email{
+		Subject: string(bytes.TrimSpace(subject.Bytes())),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
@@ -0,0 +1,84 @@
+package emailtemplates
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files with the emails rendered now: run
+// go test ./internal/emailtemplates -update and review the diff
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// golden compares email with testdata/<name>.golden, which holds its
+// subject, text body and HTML body
+func golden(t *testing.T, name string, email *Email) {
+	t.Helper()
+	got := "Subject: " + email.Subject + "\n\n----- text -----\n" + email.Text + "\n----- html -----\n" + email.HTML
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s (run with -update and review the diff):\n%s", name, path, got)
+	}
+}
+
+var invitation = InvitationData{
+	FirstName: "Sam",
+	InviteURL: "https://app.example.com/signup?token=0123abcd",
+	ValidDays: 7,
+}
+
+func TestInvitationWithDefaultBranding(t *testing.T) {
+	email, err := Render(invitation, Branding{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "invitation_default", email)
+
+	for _, want := range []string{DefaultBranding.Name, DefaultBranding.PrimaryColor, DefaultBranding.Tagline} {
+		if !strings.Contains(email.HTML, want) {
+			t.Errorf("the HTML body lacks the default %q", want)
+		}
+	}
+	if strings.Contains(email.HTML, "<img") {
+		t.Errorf("the HTML body shows a logo without one set")
+	}
+}
+
+func TestInvitationWithCustomBranding(t *testing.T) {
+	brand := Branding{
+		Name:         "Acme Sales",
+		PrimaryColor: "#0a7d45",
+		LogoURL:      "https://cdn.acme.test/logo.png",
+		FooterText:   "Acme Corp, 1 Main Street, Springfield",
+		SupportEmail: "help@acme.test",
+		Tagline:      "Acme Sales keeps every deal moving.",
+	}
+	email, err := Render(invitation, brand, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "invitation_branded", email)
+
+	for _, want := range []string{brand.Name, brand.PrimaryColor, brand.LogoURL, brand.FooterText, brand.SupportEmail, brand.Tagline, invitation.InviteURL} {
+		if !strings.Contains(email.HTML, want) {
+			t.Errorf("the HTML body lacks %q", want)
+		}
+	}
+	for _, unwanted := range []string{DefaultBranding.Name, DefaultBranding.PrimaryColor, DefaultBranding.Tagline} {
+		if strings.Contains(email.Subject+email.Text+email.HTML, unwanted) {
+			t.Errorf("the branded invitation still has the default %q", unwanted)
+		}
+	}
+}
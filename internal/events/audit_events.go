@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/white/user-management/pkg/clientip"
 	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/requestid"
+	"github.com/white/user-management/pkg/siem"
 )
 
 // AuditEventTopic returns the configured Kafka topic for audit log events
@@ -60,15 +63,33 @@ const (
 	ActionTeamMemberDeactivated AuditAction = "TEAM_MEMBER_DEACTIVATED"
 	ActionRoleChanged           AuditAction = "ROLE_CHANGED"
 
+	// Account closing actions
+	ActionAccountDeactivated       AuditAction = "ACCOUNT_DEACTIVATED"
+	ActionAccountDeletionRequested AuditAction = "ACCOUNT_DELETION_REQUESTED"
+	ActionAccountDeletionCancelled AuditAction = "ACCOUNT_DELETION_CANCELLED"
+	ActionAccountAnonymized        AuditAction = "ACCOUNT_ANONYMIZED"
+	ActionMasterAdminCreated       AuditAction = "MASTER_ADMIN_CREATED"
+
 	// Document actions
 	ActionDocumentUploaded AuditAction = "DOCUMENT_UPLOADED"
 	ActionDocumentDeleted  AuditAction = "DOCUMENT_DELETED"
 	ActionDocumentShared   AuditAction = "DOCUMENT_SHARED"
 
+	// Impersonation actions
+	ActionImpersonationStarted AuditAction = "IMPERSONATION_STARTED"
+	ActionImpersonationEnded   AuditAction = "IMPERSONATION_ENDED"
+
 	// RBAC actions
 	ActionRoleCreated            AuditAction = "ROLE_CREATED"
 	ActionRoleDeleted            AuditAction = "ROLE_DELETED"
 	ActionRolePermissionsUpdated AuditAction = "ROLE_PERMISSIONS_UPDATED"
+
+	// Security actions
+	ActionPermissionDenied AuditAction = "PERMISSION_DENIED"
+
+	// Event outbox actions
+	ActionEventReplayed        AuditAction = "EVENT_REPLAYED"
+	ActionFailedEventsReplayed AuditAction = "FAILED_EVENTS_REPLAYED"
 )
 
 // AuditResource represents the type of resource being audited
@@ -87,10 +108,13 @@ const (
 	ResourceWorkflow AuditResource = "WORKFLOW"
 )
 
+// auditEventsTopic is the Kafka topic for audit log events
+const auditEventsTopic = "audit.events"
+
 // AuditEvent represents an audit log event published to Kafka
 type AuditEvent struct {
-	EventID    string                 `json:"event_id"`
-	Timestamp  int64                  `json:"timestamp"`
+	Envelope
+	RequestID  string                 `json:"request_id,omitempty"`
 	UserID     string                 `json:"user_id"`
 	UserName   string                 `json:"user_name"`
 	UserEmail  string                 `json:"user_email,omitempty"`
@@ -108,15 +132,35 @@ type AuditEvent struct {
 	ErrorMsg   string                 `json:"error_msg,omitempty"`
 }
 
+func (AuditEvent) Topic() string          { return auditEventsTopic }
+func (e AuditEvent) PartitionKey() string { return e.ResourceID }
+
+// auditEventType returns the envelope event type for an audit action,
+// e.g. audit.team_member_added
+func auditEventType(action AuditAction) string {
+	return "audit." + strings.ToLower(string(action))
+}
+
+// auditRecordTimeout bounds writing a durable audit event to the outbox
+const auditRecordTimeout = 5 * time.Second
+
+// EventRecorder durably records an event for later delivery to Kafka
+// (repositories.EventOutboxRepository)
+type EventRecorder interface {
+	RecordWithID(ctx context.Context, eventID, topic, key string, payload interface{}) error
+}
+
 // AuditPublisher handles publishing audit events to Kafka
 type AuditPublisher struct {
-	producer *kafka.Producer
-	enabled  bool
+	producer  *kafka.Producer
+	enabled   bool
+	recorder  EventRecorder   // nil publishes every event directly
+	forwarder *siem.Forwarder // nil forwards no events to a SIEM
 }
 
 // NewAuditPublisher creates a new audit publisher
 func NewAuditPublisher(producer *kafka.Producer) *AuditPublisher {
-	enabled := producer != nil
+	enabled := producer.Enabled()
 	if enabled {
 		log.Println("Audit event publisher initialized (Kafka enabled)")
 	} else {
@@ -128,32 +172,39 @@ func NewAuditPublisher(producer *kafka.Producer) *AuditPublisher {
 	}
 }
 
+// SetRecorder routes audit events that must not be lost (team membership
+// changes) through the events outbox
+func (p *AuditPublisher) SetRecorder(recorder EventRecorder) {
+	p.recorder = recorder
+}
+
+// SetForwarder also sends every audit event to a SIEM
+func (p *AuditPublisher) SetForwarder(forwarder *siem.Forwarder) {
+	p.forwarder = forwarder
+}
+
 // Publish sends an audit event to Kafka (fire-and-forget)
 func (p *AuditPublisher) Publish(event *AuditEvent) {
-	ctx := context.Background()
 	// Set defaults
 	if event.EventID == "" {
-		event.EventID = uuid.New().String()
-	}
-	if event.Timestamp == 0 {
-		event.Timestamp = time.Now().Unix()
+		event.Envelope = NewEnvelope(auditEventType(event.Action), event.UserID, "")
 	}
+	p.forwarder.Forward(siemRecord(event))
 
 	// Always log the event for debugging
 	eventJSON, _ := json.Marshal(event)
 	log.Printf("AUDIT: %s", string(eventJSON))
 
 	// If Kafka is not available, just log
-	if !p.enabled || p.producer == nil {
+	if !p.enabled {
 		return
 	}
 
-	// Fire-and-forget publish to Kafka
-	go func() {
-		if err := p.producer.PublishJSON(ctx, "audit.events", event); err != nil {
-			log.Printf("Failed to publish audit event: %v", err)
-		}
-	}()
+	// Fire-and-forget publish to Kafka; the producer queues the event and
+	// never blocks on the broker
+	if err := Publish(context.Background(), p.producer, event); err != nil {
+		log.Printf("Failed to publish audit event: %v", err)
+	}
 }
 
 // PublishFromRequest creates and publishes an audit event from HTTP request context
@@ -168,9 +219,59 @@ func (p *AuditPublisher) PublishFromRequest(
 	errorMsg string,
 	metadata map[string]interface{},
 ) {
-	event := &AuditEvent{
-		EventID:    uuid.New().String(),
-		Timestamp:  time.Now().Unix(),
+	p.Publish(newRequestEvent(r, userID, userName, userEmail, action, resource, resourceID, details, success, errorMsg, metadata))
+}
+
+// record writes an audit event to the events outbox, keyed by its resource,
+// falling back to a direct publish when no recorder is set or the write fails
+func (p *AuditPublisher) record(event *AuditEvent) {
+	if p.recorder == nil {
+		p.Publish(event)
+		return
+	}
+
+	p.forwarder.Forward(siemRecord(event))
+	eventJSON, _ := json.Marshal(event)
+	log.Printf("AUDIT: %s", string(eventJSON))
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditRecordTimeout)
+	defer cancel()
+	if err := Record(ctx, p.recorder, event); err != nil {
+		log.Printf("Failed to record audit event, publishing directly: %v", err)
+		if p.enabled {
+			_ = Publish(ctx, p.producer, event)
+		}
+	}
+}
+
+// newRequestEvent builds an audit event from HTTP request context
+func newRequestEvent(
+	r *http.Request,
+	userID, userName, userEmail string,
+	action AuditAction,
+	resource AuditResource,
+	resourceID string,
+	details string,
+	success bool,
+	errorMsg string,
+	metadata map[string]interface{},
+) *AuditEvent {
+	// Actions taken with an impersonation token belong to the real operator;
+	// the impersonated user is kept in the metadata
+	if impersonator, ok := ImpersonatorFromContext(r.Context()); ok && userID != impersonator.UserID {
+		withImpersonation := make(map[string]interface{}, len(metadata)+2)
+		for k, v := range metadata {
+			withImpersonation[k] = v
+		}
+		withImpersonation["impersonated_user_id"] = userID
+		withImpersonation["impersonation_id"] = impersonator.SessionID
+		metadata = withImpersonation
+		userID, userName, userEmail = impersonator.UserID, impersonator.Name, impersonator.Email
+	}
+
+	return &AuditEvent{
+		Envelope:   NewEnvelope(auditEventType(action), userID, ""),
+		RequestID:  requestid.FromContext(r.Context()),
 		UserID:     userID,
 		UserName:   userName,
 		UserEmail:  userEmail,
@@ -178,31 +279,36 @@ func (p *AuditPublisher) PublishFromRequest(
 		Resource:   resource,
 		ResourceID: resourceID,
 		Details:    details,
-		IPAddress:  getClientIP(r),
+		IPAddress:  clientip.FromRequest(r),
 		UserAgent:  r.UserAgent(),
 		Metadata:   metadata,
 		Success:    success,
 		ErrorMsg:   errorMsg,
 	}
-	p.Publish(event)
 }
 
-// Helper to get client IP address
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxied requests)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return forwarded
+// siemRecord converts an audit event to the record forwarded to a SIEM
+func siemRecord(event *AuditEvent) siem.Record {
+	result := siem.ResultSuccess
+	if !event.Success {
+		result = siem.ResultFailure
 	}
-
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+	return siem.Record{
+		ID:         event.EventID,
+		Time:       event.OccurredAt,
+		RequestID:  event.RequestID,
+		Actor:      event.UserID,
+		ActorName:  event.UserName,
+		ActorEmail: event.UserEmail,
+		Action:     string(event.Action),
+		Resource:   string(event.Resource),
+		ResourceID: event.ResourceID,
+		Result:     result,
+		SourceIP:   event.IPAddress,
+		UserAgent:  event.UserAgent,
+		Details:    event.Details,
+		Error:      event.ErrorMsg,
 	}
-
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
 }
 
 // Convenience methods for common audit events
@@ -217,9 +323,16 @@ func (p *AuditPublisher) PublishSettingsEvent(r *http.Request, userID, userName
 	p.PublishFromRequest(r, userID, userName, "", action, ResourceSettings, "", details, true, "", nil)
 }
 
-// PublishTeamEvent publishes a team-related audit event
+// PublishSettingsChangeEvent records a settings update audit event in the
+// events outbox with the changed fields in metadata, so the record of what
+// changed is not lost while Kafka is down
+func (p *AuditPublisher) PublishSettingsChangeEvent(r *http.Request, userID, userName, details string, metadata map[string]interface{}) {
+	p.record(newRequestEvent(r, userID, userName, "", ActionSettingsUpdated, ResourceSettings, "", details, true, "", metadata))
+}
+
+// PublishTeamEvent records a team-related audit event in the events outbox
 func (p *AuditPublisher) PublishTeamEvent(r *http.Request, userID, userName string, action AuditAction, targetUserID, details string) {
-	p.PublishFromRequest(r, userID, userName, "", action, ResourceTeam, targetUserID, details, true, "", nil)
+	p.record(newRequestEvent(r, userID, userName, "", action, ResourceTeam, targetUserID, details, true, "", nil))
 }
 
 // PublishCampaignEvent publishes a campaign-related audit event
@@ -245,7 +358,51 @@ func (p *AuditPublisher) PublishRoleEvent(r *http.Request, userID, userName stri
 	p.PublishFromRequest(r, userID, userName, "", action, ResourceRole, roleCode, details, true, "", metadata)
 }
 
+// PublishPermissionDenied publishes a request refused because userID lacks
+// required, the permission or roles of route. throttled marks refusals with
+// 429 once the user had too many.
+func (p *AuditPublisher) PublishPermissionDenied(r *http.Request, userID, userName, required, route string, throttled bool) {
+	metadata := map[string]interface{}{
+		"required":  required,
+		"method":    r.Method,
+		"route":     route,
+		"throttled": throttled,
+	}
+	p.PublishFromRequest(r, userID, userName, "", ActionPermissionDenied, ResourceAuth, "",
+		"Access denied to "+r.Method+" "+route+" (requires "+required+")", false, "permission denied", metadata)
+}
+
+// PublishAccountEvent records an account closing audit event about
+// targetUserID in the events outbox
+func (p *AuditPublisher) PublishAccountEvent(r *http.Request, userID, userName string, action AuditAction, targetUserID, details string) {
+	p.record(newRequestEvent(r, userID, userName, "", action, ResourceUser, targetUserID, details, true, "", nil))
+}
+
+// SystemActor is the user ID of audit events of background jobs
+const SystemActor = "system"
+
+// PublishSystemAccountEvent records an account audit event about
+// targetUserID taken by a background job or at startup rather than a user
+func (p *AuditPublisher) PublishSystemAccountEvent(action AuditAction, targetUserID, details string) {
+	p.record(&AuditEvent{
+		Envelope:   NewEnvelope(auditEventType(action), SystemActor, ""),
+		UserID:     SystemActor,
+		UserName:   "System",
+		Action:     action,
+		Resource:   ResourceUser,
+		ResourceID: targetUserID,
+		Details:    details,
+		Success:    true,
+	})
+}
+
 // PublishAdminEvent publishes an admin action audit event (bulk operations, data management)
 func (p *AuditPublisher) PublishAdminEvent(r *http.Request, userID, userName string, action AuditAction, details string, metadata map[string]interface{}) {
 	p.PublishFromRequest(r, userID, userName, "", action, ResourceAdmin, "", details, true, "", metadata)
 }
+
+// RecordAdminEvent records an admin action audit event in the events
+// outbox, for actions whose record must not be lost while Kafka is down
+func (p *AuditPublisher) RecordAdminEvent(r *http.Request, userID, userName string, action AuditAction, details string, metadata map[string]interface{}) {
+	p.record(newRequestEvent(r, userID, userName, "", action, ResourceAdmin, "", details, true, "", metadata))
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/pkg/requestid"
+	"github.com/white/user-management/pkg/siem"
+)
+
+// capturingTransport keeps the records a forwarder sends
+type capturingTransport struct {
+	mu      sync.Mutex
+	records []siem.Record
+}
+
+func (t *capturingTransport) Send(ctx context.Context, payload []byte) error {
+	var record siem.Record
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records = append(t.records, record)
+	return nil
+}
+
+func (t *capturingTransport) Name() string { return "capture" }
+func (t *capturingTransport) Close() error { return nil }
+
+// wait returns the first n records sent
+func (t *capturingTransport) wait(tb testing.TB, n int) []siem.Record {
+	tb.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		t.mu.Lock()
+		records := t.records
+		t.mu.Unlock()
+		if len(records) >= n {
+			return records
+		}
+	}
+	tb.Fatalf("fewer than %d records were forwarded", n)
+	return nil
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) RecordWithID(ctx context.Context, eventID, topic, key string, payload interface{}) error {
+	return nil
+}
+
+// TestAuditEventsAreForwardedToTheSIEM publishes audit events from a request
+// and checks each forwarded record names the request, actor, action,
+// resource, result and source IP
+func TestAuditEventsAreForwardedToTheSIEM(t *testing.T) {
+	transport := &capturingTransport{}
+	forwarder := siem.NewForwarder(transport, siem.ForwarderConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go forwarder.Run(ctx)
+
+	publisher := NewAuditPublisher(nil)
+	publisher.SetForwarder(forwarder)
+	publisher.SetRecorder(nopRecorder{})
+
+	handler := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		publisher.PublishAuthEvent(r, "user-1", "Dana", "dana@example.com", ActionLoginFailed, false, "wrong password")
+		publisher.PublishTeamEvent(r, "user-1", "Dana", ActionTeamMemberRemoved, "user-2", "removed from the team")
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set(requestid.Header, "req-42")
+	r.Header.Set("User-Agent", "curl/8.0")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	records := transport.wait(t, 2)
+	want := []siem.Record{
+		{Action: string(ActionLoginFailed), Resource: string(ResourceAuth), Result: siem.ResultFailure, ActorEmail: "dana@example.com", Details: "wrong password"},
+		{Action: string(ActionTeamMemberRemoved), Resource: string(ResourceTeam), ResourceID: "user-2", Result: siem.ResultSuccess, Details: "removed from the team"},
+	}
+	for i, got := range records {
+		if got.ID == "" || got.Time.IsZero() {
+			t.Errorf("record %d has no ID or time: %+v", i, got)
+		}
+		want[i].ID, want[i].Time = got.ID, got.Time
+		want[i].RequestID, want[i].Actor, want[i].ActorName = "req-42", "user-1", "Dana"
+		want[i].SourceIP, want[i].UserAgent = "203.0.113.7", "curl/8.0"
+		if got != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
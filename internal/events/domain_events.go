@@ -0,0 +1,299 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// SchemaVersion is the version of the event payloads defined in this
+// package. Bump it on any breaking change to a payload.
+const SchemaVersion = 1
+
+// Envelope carries the fields common to every event published to Kafka
+type Envelope struct {
+	EventID       string    `json:"event_id"` // Idempotency key for consumers
+	EventType     string    `json:"event_type"`
+	OccurredAt    time.Time `json:"occurred_at"` // RFC 3339, UTC
+	ActorID       string    `json:"actor_id,omitempty"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	SchemaVersion int       `json:"schema_version"`
+}
+
+// NewEnvelope creates an envelope for an event of eventType happening now
+func NewEnvelope(eventType, actorID, tenantID string) Envelope {
+	return Envelope{
+		EventID:       uuid.MustNewUUID(),
+		EventType:     eventType,
+		OccurredAt:    time.Now().UTC().Truncate(time.Millisecond),
+		ActorID:       actorID,
+		TenantID:      tenantID,
+		SchemaVersion: SchemaVersion,
+	}
+}
+
+// Meta returns the envelope of an event
+func (e Envelope) Meta() Envelope {
+	return e
+}
+
+// Event is a typed domain event: an Envelope plus its payload, published to
+// Topic and partitioned by PartitionKey
+type Event interface {
+	Meta() Envelope
+	Topic() string
+	PartitionKey() string
+}
+
+// Record writes an event to the events outbox, keyed for the relay
+func Record(ctx context.Context, recorder EventRecorder, event Event) error {
+	return recorder.RecordWithID(ctx, event.Meta().EventID, event.Topic(), event.PartitionKey(), event)
+}
+
+// Publish sends an event straight to Kafka, bypassing the outbox. Events
+// published this way are lost if the broker stays down.
+func Publish(ctx context.Context, producer *kafka.Producer, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Meta().EventType, err)
+	}
+	return producer.Produce(ctx, event.Topic(), []byte(event.PartitionKey()), data)
+}
+
+// Event types
+const (
+	TypeUserLoggedIn  = "user.logged_in"
+	TypeUserLoggedOut = "user.logged_out"
+
+	TypeTemplateCreated       = "template.created"
+	TypeTemplateUpdated       = "template.updated"
+	TypeTemplateSoftDeleted   = "template.soft_deleted"
+	TypeTemplatePurged        = "template.purged"
+	TypeTemplateTrashRestored = "template.trash_restored"
+	TypeTemplateArchived      = "template.archived"
+	TypeTemplateRestored      = "template.restored"
+	TypeTemplatePublished     = "template.published"
+	TypeTemplateUnpublished   = "template.unpublished"
+	TypeTemplatesBulkUpdated  = "template.bulk_updated"
+	TypeTemplatesImported     = "template.imported"
+	TypeTemplateTagRenamed    = "template.tag_renamed"
+
+	TypeTemplateApprovalRequested = "template.approval_requested"
+	TypeTemplateApproved          = "template.approved"
+	TypeTemplateRejected          = "template.rejected"
+	TypeTemplateApprovalReset     = "template.approval_reset"
+
+	TypeSequenceTemplateCreated = "sequence_template_created"
+	TypeSequenceTemplateUpdated = "sequence_template_updated"
+	TypeSequenceTemplateDeleted = "sequence_template_deleted"
+	TypeSequenceTemplateCloned  = "sequence_template_cloned"
+
+	TypeTeamMemberInvited     = "team_member.invited"
+	TypeTeamMemberActivated   = "team_member.activated"
+	TypeTeamMemberDeactivated = "team_member.deactivated"
+	TypeTeamMemberDeleted     = "team_member.deleted"
+
+	TypeEmailFailed         = "email.failed"
+	TypeEmailDeliveryStatus = "email.delivery_status"
+)
+
+// TopicSequenceEvents carries every sequence template event
+const TopicSequenceEvents = "sequence-events"
+
+// =====================================================
+// User sessions
+// =====================================================
+
+// UserSession is the payload of login and logout events
+type UserSession struct {
+	Envelope
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	Region    string `json:"region,omitempty"`
+	Team      string `json:"team,omitempty"`
+	IPAddress string `json:"ip_address"`
+	UserAgent string `json:"user_agent"`
+}
+
+func (e UserSession) PartitionKey() string { return e.UserID }
+
+// UserLoggedIn is published when a user signs in
+type UserLoggedIn struct{ UserSession }
+
+func (UserLoggedIn) Topic() string { return "users.logged_in" }
+
+// UserLoggedOut is published when a user signs out
+type UserLoggedOut struct{ UserSession }
+
+func (UserLoggedOut) Topic() string { return "users.logged_out" }
+
+// NewUserLoggedIn creates a UserLoggedIn event
+func NewUserLoggedIn(session UserSession) UserLoggedIn {
+	session.Envelope = NewEnvelope(TypeUserLoggedIn, session.UserID, "")
+	return UserLoggedIn{session}
+}
+
+// NewUserLoggedOut creates a UserLoggedOut event
+func NewUserLoggedOut(session UserSession) UserLoggedOut {
+	session.Envelope = NewEnvelope(TypeUserLoggedOut, session.UserID, "")
+	return UserLoggedOut{session}
+}
+
+// =====================================================
+// Templates
+// =====================================================
+
+// TemplateEvent is the payload of events about a single template. The
+// event type is also the topic.
+type TemplateEvent struct {
+	Envelope
+	TemplateID       string `json:"template_id"`
+	SourceTemplateID string `json:"source_template_id,omitempty"` // Set when duplicated
+	Channel          string `json:"channel,omitempty"`
+	Status           string `json:"status,omitempty"`
+	Version          int    `json:"version,omitempty"`
+	Forced           bool   `json:"forced,omitempty"` // Published despite validation warnings
+	Reason           string `json:"reason,omitempty"` // Why a template was purged, e.g. retention
+	ApprovalStatus   string `json:"approval_status,omitempty"`
+	Comment          string `json:"comment,omitempty"` // Submitter's or approver's review comment
+}
+
+func (e TemplateEvent) Topic() string        { return e.EventType }
+func (e TemplateEvent) PartitionKey() string { return e.TemplateID }
+
+// NewTemplateEvent creates an event of eventType (one of the TypeTemplate*
+// constants) about templateID
+func NewTemplateEvent(eventType, actorID, tenantID, templateID string) TemplateEvent {
+	return TemplateEvent{
+		Envelope:   NewEnvelope(eventType, actorID, tenantID),
+		TemplateID: templateID,
+	}
+}
+
+// TemplatesBulkUpdated is published after a bulk action on templates
+type TemplatesBulkUpdated struct {
+	Envelope
+	Action      string   `json:"action"`
+	TemplateIDs []string `json:"template_ids"`
+	Tags        []string `json:"tags,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Succeeded   int      `json:"succeeded"`
+	Skipped     int      `json:"skipped"`
+	Failed      int      `json:"failed"`
+}
+
+func (TemplatesBulkUpdated) Topic() string          { return TypeTemplatesBulkUpdated }
+func (e TemplatesBulkUpdated) PartitionKey() string { return e.TenantID }
+
+// TemplatesImported is published after templates are imported
+type TemplatesImported struct {
+	Envelope
+	Conflict    string   `json:"conflict"`
+	TemplateIDs []string `json:"template_ids"`
+	Created     int      `json:"created"`
+	Overwritten int      `json:"overwritten"`
+	Skipped     int      `json:"skipped"`
+	Failed      int      `json:"failed"`
+}
+
+func (TemplatesImported) Topic() string          { return TypeTemplatesImported }
+func (e TemplatesImported) PartitionKey() string { return e.TenantID }
+
+// TemplateTagRenamed is published after a tag is renamed across templates
+type TemplateTagRenamed struct {
+	Envelope
+	OldName     string   `json:"old_name"`
+	NewName     string   `json:"new_name"`
+	TemplateIDs []string `json:"template_ids"`
+}
+
+func (TemplateTagRenamed) Topic() string          { return TypeTemplateTagRenamed }
+func (e TemplateTagRenamed) PartitionKey() string { return e.TenantID }
+
+// =====================================================
+// Sequence templates
+// =====================================================
+
+// SequenceTemplateEvent is the payload of every sequence template event
+type SequenceTemplateEvent struct {
+	Envelope
+	TemplateID string `json:"template_id"`
+	Name       string `json:"name"`
+	Version    int    `json:"version"`
+	StepCount  int    `json:"step_count"`
+}
+
+func (SequenceTemplateEvent) Topic() string          { return TopicSequenceEvents }
+func (e SequenceTemplateEvent) PartitionKey() string { return e.TemplateID }
+
+// =====================================================
+// Team
+// =====================================================
+
+// TeamMemberInvited is published when a user is invited to the team
+type TeamMemberInvited struct {
+	Envelope
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+func (TeamMemberInvited) Topic() string          { return TypeTeamMemberInvited }
+func (e TeamMemberInvited) PartitionKey() string { return e.UserID }
+
+// TeamMemberStatusChanged is published when a team member is activated
+// (signup completed or reactivated), deactivated or deleted. EventType tells
+// which.
+type TeamMemberStatusChanged struct {
+	Envelope
+	UserID string `json:"user_id"`
+	Status string `json:"status"` // active, inactive or deleted
+}
+
+func (e TeamMemberStatusChanged) Topic() string        { return e.EventType }
+func (e TeamMemberStatusChanged) PartitionKey() string { return e.UserID }
+
+// NewTeamMemberStatusChanged creates a team member status event of eventType
+func NewTeamMemberStatusChanged(eventType, actorID, userID, status string) TeamMemberStatusChanged {
+	return TeamMemberStatusChanged{
+		Envelope: NewEnvelope(eventType, actorID, ""),
+		UserID:   userID,
+		Status:   status,
+	}
+}
+
+// =====================================================
+// Email delivery
+// =====================================================
+
+// EmailFailed is published when an email exhausts its send attempts
+type EmailFailed struct {
+	Envelope
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id,omitempty"`
+	Attempts  int    `json:"attempts"`
+	Reason    string `json:"reason"`
+}
+
+func (EmailFailed) Topic() string          { return TypeEmailFailed }
+func (e EmailFailed) PartitionKey() string { return e.MessageID }
+
+// EmailDeliveryStatus is published for each provider delivery webhook event
+type EmailDeliveryStatus struct {
+	Envelope
+	MessageID  string `json:"message_id"`
+	Event      string `json:"event"` // Provider event, e.g. delivered or bounce
+	Status     string `json:"status"`
+	Recipient  string `json:"recipient,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	BounceType string `json:"bounce_type,omitempty"`
+	UserID     string `json:"user_id,omitempty"`
+}
+
+func (EmailDeliveryStatus) Topic() string          { return TypeEmailDeliveryStatus }
+func (e EmailDeliveryStatus) PartitionKey() string { return e.MessageID }
@@ -0,0 +1,28 @@
+package events
+
+import "context"
+
+// Impersonator is the real operator behind a request made with an
+// impersonation token
+type Impersonator struct {
+	UserID    string
+	Email     string
+	Name      string
+	SessionID string // Impersonation session the token belongs to
+}
+
+type impersonatorKey struct{}
+
+// WithImpersonator marks ctx as acting on behalf of the impersonated user.
+// Audit events built from a request with this context are attributed to
+// the impersonator.
+func WithImpersonator(ctx context.Context, impersonator Impersonator) context.Context {
+	return context.WithValue(ctx, impersonatorKey{}, impersonator)
+}
+
+// ImpersonatorFromContext returns the real operator of an impersonated
+// request, and false for ordinary requests
+func ImpersonatorFromContext(ctx context.Context) (Impersonator, bool) {
+	impersonator, ok := ctx.Value(impersonatorKey{}).(Impersonator)
+	return impersonator, ok
+}
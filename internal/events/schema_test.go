@@ -0,0 +1,270 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// schemaFile is the golden JSON schema of the event payloads. A field
+// renamed, removed or retyped in a struct below fails the test until the
+// schema is updated to match, which is the moment to bump SchemaVersion.
+const schemaFile = "testdata/events.schema.json"
+
+// schemaBases are the definitions shared by other definitions rather than
+// describing one event struct
+var schemaBases = []string{"Envelope", "UserSession"}
+
+// typedEvents returns an event of each struct published to Kafka, keyed by
+// its definition in the schema, with only the envelope set
+func typedEvents() map[string]Event {
+	return map[string]Event{
+		"UserLoggedIn":            NewUserLoggedIn(UserSession{}),
+		"UserLoggedOut":           NewUserLoggedOut(UserSession{}),
+		"TemplateEvent":           NewTemplateEvent(TypeTemplateCreated, "", "", ""),
+		"TemplatesBulkUpdated":    TemplatesBulkUpdated{Envelope: NewEnvelope(TypeTemplatesBulkUpdated, "", "")},
+		"TemplatesImported":       TemplatesImported{Envelope: NewEnvelope(TypeTemplatesImported, "", "")},
+		"TemplateTagRenamed":      TemplateTagRenamed{Envelope: NewEnvelope(TypeTemplateTagRenamed, "", "")},
+		"SequenceTemplateEvent":   SequenceTemplateEvent{Envelope: NewEnvelope(TypeSequenceTemplateCreated, "", "")},
+		"TeamMemberInvited":       TeamMemberInvited{Envelope: NewEnvelope(TypeTeamMemberInvited, "", "")},
+		"TeamMemberStatusChanged": NewTeamMemberStatusChanged(TypeTeamMemberActivated, "", "", ""),
+		"EmailFailed":             EmailFailed{Envelope: NewEnvelope(TypeEmailFailed, "", "")},
+		"EmailDeliveryStatus":     EmailDeliveryStatus{Envelope: NewEnvelope(TypeEmailDeliveryStatus, "", "")},
+		"AuditEvent":              AuditEvent{Envelope: NewEnvelope(auditEventType(ActionLogin), "", "")},
+	}
+}
+
+// jsonSchema is the subset of JSON Schema the golden file uses
+type jsonSchema struct {
+	Ref                  string                `json:"$ref"`
+	Defs                 map[string]jsonSchema `json:"$defs"`
+	AllOf                []jsonSchema          `json:"allOf"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Properties           map[string]jsonSchema `json:"properties"`
+	Required             []string              `json:"required"`
+	AdditionalProperties *bool                 `json:"additionalProperties"`
+	Items                *jsonSchema           `json:"items"`
+}
+
+func loadSchema(t *testing.T) *jsonSchema {
+	t.Helper()
+	data, err := os.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root jsonSchema
+	if err := json.Unmarshal(data, &root); err != nil {
+		t.Fatalf("%s: %v", schemaFile, err)
+	}
+	return &root
+}
+
+// resolve follows $ref and merges allOf into one object schema
+func (root *jsonSchema) resolve(s jsonSchema) jsonSchema {
+	if s.Ref != "" {
+		var name string
+		if _, err := fmt.Sscanf(s.Ref, "#/$defs/%s", &name); err != nil {
+			panic("unsupported $ref " + s.Ref)
+		}
+		return root.resolve(root.Defs[name])
+	}
+	if len(s.AllOf) == 0 {
+		return s
+	}
+	merged := s
+	merged.AllOf = nil
+	merged.Properties = map[string]jsonSchema{}
+	merged.Required = nil
+	for _, part := range append(slices.Clone(s.AllOf), jsonSchema{Properties: s.Properties, Required: s.Required}) {
+		part = root.resolve(part)
+		for name, property := range part.Properties {
+			merged.Properties[name] = property
+		}
+		merged.Required = append(merged.Required, part.Required...)
+	}
+	return merged
+}
+
+// validate returns a description of each way value breaks s
+func (root *jsonSchema) validate(path string, s jsonSchema, value interface{}) []string {
+	s = root.resolve(s)
+	var problems []string
+	wrongType := func() []string {
+		return []string{fmt.Sprintf("%s: %T %v is not %s", path, value, value, s.Type)}
+	}
+	switch s.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return wrongType()
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not an RFC 3339 date-time", path, str))
+			}
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return wrongType()
+		}
+		if _, err := n.Int64(); err != nil {
+			return wrongType()
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return wrongType()
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return wrongType()
+		}
+		for i, item := range items {
+			problems = append(problems, root.validate(fmt.Sprintf("%s[%d]", path, i), *s.Items, item)...)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return wrongType()
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: required field %s is missing", path, name))
+			}
+		}
+		for name, field := range object {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					problems = append(problems, fmt.Sprintf("%s: field %s is not in the schema", path, name))
+				}
+				continue
+			}
+			problems = append(problems, root.validate(path+"."+name, property, field)...)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// marshalEvent returns the JSON of event decoded to generic values, with
+// numbers kept as json.Number
+func marshalEvent(t *testing.T, event Event) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
+
+// filled returns a copy of event with every field set, so that no field is
+// left out by omitempty
+func filled(event Event) Event {
+	v := reflect.New(reflect.TypeOf(event)).Elem()
+	v.Set(reflect.ValueOf(event))
+	fill(v)
+	return v.Interface().(Event)
+}
+
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2026, 3, 14, 9, 26, 53, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i))
+			}
+		}
+	case reflect.String:
+		if v.String() == "" {
+			v.SetString("value")
+		}
+	case reflect.Int, reflect.Int64:
+		v.SetInt(3)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key := reflect.New(v.Type().Key()).Elem()
+		fill(key)
+		elem := reflect.New(v.Type().Elem()).Elem()
+		fill(elem)
+		v.SetMapIndex(key, elem)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf("value"))
+	}
+}
+
+// TestEventsMatchTheSchema marshals every typed event with all its fields
+// set and checks the JSON against the golden schema, both ways: no field
+// the schema does not declare, and no declared field the event lacks
+func TestEventsMatchTheSchema(t *testing.T) {
+	root := loadSchema(t)
+	for name, event := range typedEvents() {
+		t.Run(name, func(t *testing.T) {
+			def, ok := root.Defs[name]
+			if !ok {
+				t.Fatalf("%s has no definition in %s", name, schemaFile)
+			}
+			object := marshalEvent(t, filled(event))
+			for _, problem := range root.validate(name, def, object) {
+				t.Error(problem)
+			}
+			for property := range root.resolve(def).Properties {
+				if _, ok := object[property]; !ok {
+					t.Errorf("%s declares %s, which the event does not have", name, property)
+				}
+			}
+		})
+	}
+}
+
+// TestRequiredEventFieldsAreAlwaysSent checks a required field is not
+// dropped by omitempty when the event leaves it empty
+func TestRequiredEventFieldsAreAlwaysSent(t *testing.T) {
+	root := loadSchema(t)
+	for name, event := range typedEvents() {
+		object := marshalEvent(t, event)
+		for _, required := range root.resolve(root.Defs[name]).Required {
+			if _, ok := object[required]; !ok {
+				t.Errorf("%s omits the required field %s when it is empty", name, required)
+			}
+		}
+		if got := object["schema_version"]; got != json.Number(fmt.Sprint(SchemaVersion)) {
+			t.Errorf("%s schema_version = %v, want %d", name, got, SchemaVersion)
+		}
+	}
+}
+
+// TestSchemaDefinesOnlyTypedEvents keeps the schema and typedEvents in step,
+// so a definition left behind by a removed event is noticed
+func TestSchemaDefinesOnlyTypedEvents(t *testing.T) {
+	root := loadSchema(t)
+	events := typedEvents()
+	for name := range root.Defs {
+		if _, ok := events[name]; !ok && !slices.Contains(schemaBases, name) {
+			t.Errorf("%s defines %s, which is not a typed event", schemaFile, name)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/emailtemplates"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/i18n"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// AccountHandler lets users close their own account, by deactivating it or
+// by having it deleted after a grace period, and lets admins review and
+// cancel pending deletions. Every transition is audited.
+type AccountHandler struct {
+	closing        *services.AccountClosing
+	users          repositories.UserStore
+	auditPublisher *events.AuditPublisher
+	systemEmails   *services.SystemEmails
+	emailSender    email.EmailSender
+	emailRepo      repositories.EmailStore
+	emailQueue     *services.EmailQueue
+}
+
+// NewAccountHandler creates a new AccountHandler
+// auditPublisher can be nil - transitions are then not audited
+func NewAccountHandler(closing *services.AccountClosing, users repositories.UserStore, auditPublisher *events.AuditPublisher) *AccountHandler {
+	return &AccountHandler{closing: closing, users: users, auditPublisher: auditPublisher}
+}
+
+// SetConfirmationEmails sets how the deactivation confirmation email is
+// rendered and sent; without it no confirmation is sent
+func (h *AccountHandler) SetConfirmationEmails(systemEmails *services.SystemEmails, sender email.EmailSender, emailRepo repositories.EmailStore, queue *services.EmailQueue) {
+	h.systemEmails = systemEmails
+	h.emailSender = sender
+	h.emailRepo = emailRepo
+	h.emailQueue = queue
+}
+
+// AccountDeactivatedResponse reports a deactivated account
+type AccountDeactivatedResponse struct {
+	Success         bool   `json:"success"`
+	Message         string `json:"message"`
+	RevokedSessions int64  `json:"revokedSessions"`
+	EmailSent       bool   `json:"emailSent"`
+}
+
+// DeactivateAccount deactivates the caller's account after they re-enter
+// their password, signs them out everywhere and emails a confirmation. The
+// last active admin cannot deactivate their account.
+// POST /api/v1/settings/account/deactivate
+// @Summary Deactivate own account
+// @Description Sets the caller's account inactive once their current password is confirmed, revokes all of their sessions and emails a confirmation. Access tokens already issued keep working until they expire. The last active admin cannot deactivate their account.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Param deactivateRequest body models.DeactivateAccountRequest true "Current password"
+// @Success 200 {object} AccountDeactivatedResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid payload"
+// @Failure 401 {object} ErrorResponse "Unauthorized or wrong password"
+// @Failure 409 {object} CodedErrorResponse "Last active admin"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /settings/account/deactivate [post]
+func (h *AccountHandler) DeactivateAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req models.DeactivateAccountRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.closing.Deactivate(ctx, user, req.CurrentPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrWrongPassword):
+			respondWithErrorCode(w, http.StatusUnauthorized, "INVALID_PASSWORD", "Current password is incorrect")
+		case errors.Is(err, services.ErrLastAdmin):
+			respondWithErrorCode(w, http.StatusConflict, "LAST_ADMIN", "You are the only active admin; make someone else an admin before deactivating your account")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to deactivate account: "+err.Error())
+		}
+		return
+	}
+
+	if h.auditPublisher != nil {
+		h.auditPublisher.PublishAccountEvent(r, user.ID, user.Name, events.ActionAccountDeactivated, user.ID,
+			fmt.Sprintf("Account deactivated by its owner, %d session(s) revoked", revoked))
+	}
+
+	emailSent := true
+	if err := h.sendDeactivationEmail(ctx, user, time.Now()); err != nil {
+		log.Printf("Warning: failed to send deactivation confirmation to user %s: %v", user.ID, err)
+		emailSent = false
+	}
+
+	respondWithJSON(w, http.StatusOK, AccountDeactivatedResponse{
+		Success:         true,
+		Message:         "Account deactivated",
+		RevokedSessions: revoked,
+		EmailSent:       emailSent,
+	})
+}
+
+// RequestAccountDeletion schedules the caller's account to be anonymized
+// once the grace period is over. Until then they can cancel it. An account
+// already deactivated can still be deleted.
+// POST /api/v1/settings/account/delete-request
+// @Summary Request deletion of own account
+// @Description Schedules the anonymization of the caller's account at the end of the grace period (ACCOUNT_DELETION_GRACE_DAYS, 14 days by default). Signing in and calling POST /settings/account/cancel-deletion before then cancels it. The last active admin cannot request deletion.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Param deletionRequest body models.AccountDeletionRequestBody false "Reason for leaving"
+// @Success 201 {object} DataResponse[models.AccountDeletionRequest]
+// @Failure 400 {object} CodedErrorResponse "Invalid payload"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} CodedErrorResponse "Deletion already requested or last active admin"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /settings/account/delete-request [post]
+func (h *AccountHandler) RequestAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	var req models.AccountDeletionRequestBody
+	if r.Body != nil && r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	request, err := h.closing.RequestDeletion(r.Context(), user, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDeletionAlreadyRequested):
+			respondWithErrorCode(w, http.StatusConflict, "DELETION_ALREADY_REQUESTED", "Deletion of your account is already scheduled")
+		case errors.Is(err, services.ErrLastAdmin):
+			respondWithErrorCode(w, http.StatusConflict, "LAST_ADMIN", "You are the only active admin; make someone else an admin before deleting your account")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to request account deletion: "+err.Error())
+		}
+		return
+	}
+
+	if h.auditPublisher != nil {
+		h.auditPublisher.PublishAccountEvent(r, user.ID, user.Name, events.ActionAccountDeletionRequested, user.ID,
+			fmt.Sprintf("Account deletion requested, scheduled for %s", request.ScheduledFor.Format(time.RFC3339)))
+	}
+
+	respondWithJSON(w, http.StatusCreated, DataResponse[*models.AccountDeletionRequest]{
+		Success: true,
+		Data:    request,
+	})
+}
+
+// CancelAccountDeletion cancels the caller's pending account deletion
+// POST /api/v1/settings/account/cancel-deletion
+// @Summary Cancel deletion of own account
+// @Description Cancels the caller's pending account deletion request during its grace period
+// @Tags Settings
+// @Produce json
+// @Success 200 {object} DataResponse[models.AccountDeletionRequest]
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "No pending deletion request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /settings/account/cancel-deletion [post]
+func (h *AccountHandler) CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	request, err := h.closing.CancelDeletion(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrDeletionRequestNotFound) {
+			respondWithError(w, http.StatusNotFound, "No pending deletion request")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel account deletion: "+err.Error())
+		return
+	}
+
+	if h.auditPublisher != nil {
+		h.auditPublisher.PublishAccountEvent(r, user.ID, user.Name, events.ActionAccountDeletionCancelled, user.ID,
+			"Account deletion cancelled by its owner")
+	}
+
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.AccountDeletionRequest]{
+		Success: true,
+		Data:    request,
+	})
+}
+
+// DeletionRequestPage is a page of account deletion requests
+type DeletionRequestPage struct {
+	Requests   []*models.AccountDeletionRequest `json:"requests"`
+	Total      int64                            `json:"total"`
+	Page       int                              `json:"page"`
+	Limit      int                              `json:"limit"`
+	TotalPages int                              `json:"totalPages"`
+}
+
+// ListDeletionRequests lists account deletion requests, pending ones by
+// default, those due soonest first
+// GET /api/v1/admin/deletion-requests
+// @Summary List account deletion requests
+// @Description Lists account deletion requests of the given status (pending by default, or all), those due soonest first
+// @Tags Admin
+// @Produce json
+// @Param status query string false "pending, cancelled, completed or all" default(pending)
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Page size, at most 100" default(50)
+// @Success 200 {object} DataResponse[DeletionRequestPage]
+// @Failure 400 {object} ErrorResponse "Invalid status or paging"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/deletion-requests [get]
+func (h *AccountHandler) ListDeletionRequests(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.AccountDeletionPending
+	case "all":
+		status = ""
+	case models.AccountDeletionPending, models.AccountDeletionCancelled, models.AccountDeletionCompleted:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid status; use pending, cancelled, completed or all")
+		return
+	}
+	page, limit, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	requests, total, err := h.closing.ListDeletionRequests(r.Context(), status, page, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list deletion requests: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, DataResponse[DeletionRequestPage]{
+		Success: true,
+		Data: DeletionRequestPage{
+			Requests:   requests,
+			Total:      total,
+			Page:       page,
+			Limit:      limit,
+			TotalPages: (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// CancelDeletionRequest cancels a user's pending account deletion
+// POST /api/v1/admin/deletion-requests/{id}/cancel
+// @Summary Cancel an account deletion request
+// @Description Cancels a pending account deletion request on the user's behalf
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Deletion request ID"
+// @Success 200 {object} DataResponse[models.AccountDeletionRequest]
+// @Failure 400 {object} ErrorResponse "Invalid deletion request ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "No pending deletion request with this ID"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/deletion-requests/{id}/cancel [post]
+func (h *AccountHandler) CancelDeletionRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid deletion request ID")
+		return
+	}
+
+	actorID := middleware.GetUserID(r)
+	request, err := h.closing.CancelDeletionRequest(r.Context(), id, actorID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrDeletionRequestNotFound) {
+			respondWithError(w, http.StatusNotFound, "No pending deletion request with this ID")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel deletion request: "+err.Error())
+		return
+	}
+
+	if h.auditPublisher != nil {
+		actorName, _ := r.Context().Value(middleware.NameKey).(string)
+		h.auditPublisher.PublishAccountEvent(r, actorID, actorName, events.ActionAccountDeletionCancelled, request.UserID,
+			fmt.Sprintf("Deletion of the account of %s cancelled by an admin", request.Email))
+	}
+
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.AccountDeletionRequest]{
+		Success: true,
+		Data:    request,
+	})
+}
+
+// caller loads the calling user, writing an error response when that fails
+func (h *AccountHandler) caller(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, false
+	}
+	user, err := h.users.GetByID(r.Context(), userID)
+	if err != nil {
+		if repositories.IsUserNotFound(err) {
+			respondWithError(w, http.StatusUnauthorized, "User not found")
+			return nil, false
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user: "+err.Error())
+		return nil, false
+	}
+	return user, true
+}
+
+// sendDeactivationEmail stores the deactivation confirmation and queues it
+// for the email worker, sending it during the request when emails are not
+// queued or it could not be stored or queued
+func (h *AccountHandler) sendDeactivationEmail(ctx context.Context, user *models.User, at time.Time) error {
+	if h.systemEmails == nil || h.emailSender == nil {
+		return errors.New("confirmation emails are not configured")
+	}
+	msg, err := h.systemEmails.Compose(i18n.WithPreference(ctx, user.PreferredLanguage()), user.Email, emailtemplates.AccountDeactivatedData{
+		Name:          user.Name,
+		DeactivatedAt: at.UTC().Format("2 Jan 2006 15:04 MST"),
+	})
+	if err != nil {
+		return err
+	}
+	msg.Priority = models.PriorityHigh
+
+	if h.emailRepo != nil {
+		if err := h.emailRepo.CreateCommMessage(ctx, msg); err != nil {
+			log.Printf("Warning: failed to store deactivation email %s: %v", msg.MessageID, err)
+		} else if err := h.emailQueue.Enqueue(ctx, msg); err == nil {
+			return nil
+		} else if !errors.Is(err, services.ErrEmailQueueDisabled) {
+			log.Printf("Warning: failed to queue deactivation email %s: %v", msg.MessageID, err)
+		}
+	}
+	return deliverEmail(ctx, h.emailSender, h.emailRepo, msg)
+}
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/cache"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// AdminHandler handles operational endpoints for administrators
+type AdminHandler struct {
+	jwtService    *utils.JWTService
+	templateCache *cache.TemplateCache // nil when Redis is not configured
+	emailRepo     repositories.MailboxStore
+	weeklyReports *services.WeeklyReportJob // nil turns the weekly report trigger off
+	emailQuota    *services.EmailQuota      // nil when send limits are not tracked
+}
+
+// NewAdminHandler creates a new AdminHandler
+func NewAdminHandler(jwtService *utils.JWTService, templateCache *cache.TemplateCache, emailRepo repositories.MailboxStore) *AdminHandler {
+	return &AdminHandler{
+		jwtService:    jwtService,
+		templateCache: templateCache,
+		emailRepo:     emailRepo,
+	}
+}
+
+// SetWeeklyReportJob sets the job behind the weekly report trigger
+func (h *AdminHandler) SetWeeklyReportJob(job *services.WeeklyReportJob) {
+	h.weeklyReports = job
+}
+
+// SetEmailQuota sets the send quota whose usage the email usage endpoint reports
+func (h *AdminHandler) SetEmailQuota(quota *services.EmailQuota) {
+	h.emailQuota = quota
+}
+
+// JWTKeysReloaded is the response to reloading the JWT keys
+type JWTKeysReloaded struct {
+	Message          string   `json:"message"`
+	SigningKeyID     string   `json:"signing_key_id"`
+	VerificationKeys []string `json:"verification_keys"`
+}
+
+// ReloadJWTKeys re-reads the JWT key files so a rotated signing key or a
+// retired verification key takes effect without a restart
+// POST /api/v1/admin/jwt/reload-keys
+// @Summary Reload JWT keys
+// @Description Re-reads the JWT signing and verification key files
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} JWTKeysReloaded "Keys reloaded"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Key files could not be loaded"
+// @Security BearerAuth
+// @Router /admin/jwt/reload-keys [post]
+func (h *AdminHandler) ReloadJWTKeys(w http.ResponseWriter, r *http.Request) {
+	if err := h.jwtService.ReloadKeys(); err != nil {
+		log.Printf("JWT key reload failed (requested by %s): %v", middleware.GetUserID(r), err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to reload JWT keys: "+err.Error())
+		return
+	}
+
+	log.Printf("JWT keys reloaded by %s (signing key: %s)", middleware.GetUserID(r), h.jwtService.KeyID())
+	respondWithJSON(w, http.StatusOK, JWTKeysReloaded{
+		Message:          "JWT keys reloaded",
+		SigningKeyID:     h.jwtService.KeyID(),
+		VerificationKeys: h.jwtService.VerificationKeyIDs(),
+	})
+}
+
+// TemplateCacheStatsResponse holds the template cache counters. Stats is unset
+// when there is no cache
+type TemplateCacheStatsResponse struct {
+	Enabled bool                      `json:"enabled"`
+	Stats   *cache.TemplateCacheStats `json:"stats,omitempty"`
+}
+
+// GetTemplateCacheStats returns the template cache hit/miss/eviction counters
+// GET /api/v1/admin/cache/templates/stats
+// @Summary Template cache statistics
+// @Description Returns the template cache counters, or enabled false when there is no cache
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} TemplateCacheStatsResponse "enabled and the cache counters"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Security BearerAuth
+// @Router /admin/cache/templates/stats [get]
+func (h *AdminHandler) GetTemplateCacheStats(w http.ResponseWriter, r *http.Request) {
+	if h.templateCache == nil {
+		respondWithJSON(w, http.StatusOK, TemplateCacheStatsResponse{Enabled: false})
+		return
+	}
+
+	stats := h.templateCache.Stats()
+	respondWithJSON(w, http.StatusOK, TemplateCacheStatsResponse{
+		Enabled: true,
+		Stats:   &stats,
+	})
+}
+
+// TemplateCacheFlushed is the response to flushing a tenant's template cache
+type TemplateCacheFlushed struct {
+	Message     string `json:"message"`
+	TenantID    string `json:"tenant_id"`
+	DeletedKeys int64  `json:"deleted_keys"`
+}
+
+// FlushTenantTemplateCache removes every cached template and listing of a tenant
+// DELETE /api/v1/admin/cache/templates/{tenantId}
+// @Summary Flush a tenant's template cache
+// @Description Removes every cached template and listing of the tenant
+// @Tags Admin
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Success 200 {object} TemplateCacheFlushed "Cache flushed"
+// @Failure 400 {object} ErrorResponse "Invalid tenant ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "Template cache is not configured"
+// @Security BearerAuth
+// @Router /admin/cache/templates/{tenantId} [delete]
+func (h *AdminHandler) FlushTenantTemplateCache(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := uuid.ParseUUID(mux.Vars(r)["tenantId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid tenant ID format")
+		return
+	}
+	if h.templateCache == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Template cache is not configured")
+		return
+	}
+
+	deleted, err := h.templateCache.FlushTenant(r.Context(), tenantID)
+	if err != nil {
+		log.Printf("Template cache flush for tenant %s failed (requested by %s): %v", tenantID, middleware.GetUserID(r), err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to flush template cache: "+err.Error())
+		return
+	}
+
+	log.Printf("Template cache flushed for tenant %s by %s (%d keys)", tenantID, middleware.GetUserID(r), deleted)
+	respondWithJSON(w, http.StatusOK, TemplateCacheFlushed{
+		Message:     "Template cache flushed",
+		TenantID:    tenantID,
+		DeletedKeys: deleted,
+	})
+}
+
+// OutboundEmailPage is a page of outbound emails
+type OutboundEmailPage struct {
+	Emails []*models.MongoCommunication `json:"emails"`
+	Total  int64                        `json:"total"`
+	Limit  int                          `json:"limit"`
+	Offset int                          `json:"offset"`
+}
+
+// ListEmails lists outbound emails, optionally filtered by delivery status,
+// so failed or stuck sends can be found and re-driven
+// GET /api/v1/admin/emails?status=failed&limit=50&offset=0
+// @Summary List outbound emails
+// @Description Lists outbound emails, optionally by delivery status, to find failed or stuck sends
+// @Tags Admin
+// @Produce json
+// @Param status query string false "Delivery status, e.g. failed"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Emails to skip"
+// @Success 200 {object} DataResponse[OutboundEmailPage] "emails, total, limit, offset"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/emails [get]
+func (h *AdminHandler) ListEmails(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+
+	limit := 50
+	offset := 0
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(query.Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	emails, total, err := h.emailRepo.ListOutboundEmails(r.Context(), status, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list emails: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, DataResponse[OutboundEmailPage]{
+		Success: true,
+		Data: OutboundEmailPage{
+			Emails: emails,
+			Total:  total,
+			Limit:  limit,
+			Offset: offset,
+		},
+	})
+}
+
+// EmailRequeued is the response to retrying an email
+type EmailRequeued struct {
+	Message string                     `json:"message"`
+	Status  string                     `json:"status"`
+	Email   *models.MongoCommunication `json:"email"`
+}
+
+// RetryEmail puts a failed or queued email back in the outbox with a fresh
+// attempt budget; the outbox worker sends it on its next sweep
+// POST /api/v1/admin/emails/{id}/retry
+// @Summary Retry an email
+// @Description Puts a failed or queued email back in the outbox; the outbox worker sends it on its next sweep
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Email ID"
+// @Success 202 {object} EmailRequeued "Email requeued"
+// @Failure 400 {object} ErrorResponse "Invalid email ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Email not found"
+// @Failure 409 {object} CodedErrorResponse "Email cannot be retried"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/emails/{id}/retry [post]
+func (h *AdminHandler) RetryEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email ID format")
+		return
+	}
+
+	requeued, err := h.emailRepo.RequeueEmail(r.Context(), id)
+	if err != nil {
+		switch {
+		case repositories.IsCommunicationNotFound(err):
+			respondWithError(w, http.StatusNotFound, "Email not found")
+		case errors.Is(err, repositories.ErrEmailNotRetryable):
+			respondWithErrorCode(w, http.StatusConflict, "EMAIL_NOT_RETRYABLE", "Only failed or queued emails that are not being sent can be retried")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to requeue email: "+err.Error())
+		}
+		return
+	}
+
+	log.Printf("Email %s requeued by %s", id, middleware.GetUserID(r))
+	requeued.Body, requeued.BodyHTML = "", ""
+	respondWithJSON(w, http.StatusAccepted, EmailRequeued{
+		Message: "Email requeued for delivery",
+		Status:  models.MessageStatusQueued,
+		Email:   requeued,
+	})
+}
+
+// GetEmailUsage returns the outbound emails sent today and this month (UTC)
+// against the send limits of the system email notification settings
+// GET /api/v1/admin/email-usage
+// @Summary Email usage
+// @Description Outbound emails sent today and this month (UTC) against the send limits
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} services.EmailUsageReport
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "Email usage is not tracked"
+// @Security BearerAuth
+// @Router /admin/email-usage [get]
+func (h *AdminHandler) GetEmailUsage(w http.ResponseWriter, r *http.Request) {
+	if h.emailQuota == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Email usage is not tracked")
+		return
+	}
+
+	usage, err := h.emailQuota.Usage(r.Context(), time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load email usage: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, usage)
+}
+
+// maxWeeklyReportPreviews caps the reports a dry run renders
+const maxWeeklyReportPreviews = 20
+
+// WeeklyReportTriggered is the response to triggering the weekly reports. A
+// dry run sets DryRun, Recipients and Previews; a single user's report sets
+// UserID and Sent; a full run sets Run
+type WeeklyReportTriggered struct {
+	DryRun     bool                           `json:"dryRun,omitempty"`
+	Recipients *int                           `json:"recipients,omitempty"` // Users opted in to the report
+	Previews   []services.WeeklyReportPreview `json:"previews,omitempty"`
+	UserID     string                         `json:"userId,omitempty"`
+	Sent       *bool                          `json:"sent,omitempty"`
+	Run        *models.ReportRun              `json:"run,omitempty"`
+}
+
+// TriggerWeeklyReport sends this week's reports now instead of waiting for the
+// scheduled weekday. The week still counts as sent, so the scheduled run and
+// later triggers skip it. userId sends only that user's report without
+// counting the week; dryRun=true renders the reports (at most 20) without
+// sending anything.
+// POST /api/v1/admin/reports/weekly/trigger?dryRun=true&userId=...
+// @Summary Trigger the weekly reports
+// @Description Sends this week's reports now. userId sends only that user's report; dryRun renders the reports without sending.
+// @Tags Admin
+// @Produce json
+// @Param dryRun query bool false "Render without sending"
+// @Param userId query string false "Send only this user's report"
+// @Success 200 {object} WeeklyReportTriggered "Run summary, or the rendered reports on a dry run"
+// @Failure 400 {object} ErrorResponse "Invalid dryRun or user ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} CodedErrorResponse "Weekly reports are turned off or already sent this week"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "Weekly reports are not configured"
+// @Security BearerAuth
+// @Router /admin/reports/weekly/trigger [post]
+func (h *AdminHandler) TriggerWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	if h.weeklyReports == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Weekly reports are not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	dryRun := false
+	if v := query.Get("dryRun"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid dryRun, must be true or false")
+			return
+		}
+	}
+	userID := query.Get("userId")
+	if userID != "" {
+		var err error
+		if userID, err = uuid.ParseUUID(userID); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+			return
+		}
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+	switch {
+	case dryRun:
+		previews, optedIn, err := h.weeklyReports.Preview(ctx, now, userID, maxWeeklyReportPreviews)
+		if err != nil {
+			h.respondWeeklyReportError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, WeeklyReportTriggered{
+			DryRun:     true,
+			Recipients: &optedIn,
+			Previews:   previews,
+		})
+
+	case userID != "":
+		sent, err := h.weeklyReports.SendToUser(ctx, now, userID)
+		if err != nil {
+			h.respondWeeklyReportError(w, err)
+			return
+		}
+		log.Printf("Weekly report for user %s triggered by %s (sent: %t)", userID, middleware.GetUserID(r), sent)
+		respondWithJSON(w, http.StatusOK, WeeklyReportTriggered{
+			UserID: userID,
+			Sent:   &sent,
+		})
+
+	default:
+		run, err := h.weeklyReports.Send(ctx, now)
+		if err != nil && run == nil {
+			h.respondWeeklyReportError(w, err)
+			return
+		}
+		log.Printf("Weekly reports for %s triggered by %s: %d sent, %d opted out, %d failed", run.Period, middleware.GetUserID(r), run.Sent, run.Skipped, run.Failed)
+		respondWithJSON(w, http.StatusOK, WeeklyReportTriggered{Run: run})
+	}
+}
+
+// respondWeeklyReportError maps weekly report errors to responses
+func (h *AdminHandler) respondWeeklyReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrWeeklyReportDisabled):
+		respondWithErrorCode(w, http.StatusConflict, "WEEKLY_REPORT_DISABLED", "Weekly reports are turned off, set a weekly report day in the system email notification settings")
+	case errors.Is(err, services.ErrWeeklyReportAlreadySent):
+		respondWithErrorCode(w, http.StatusConflict, "WEEKLY_REPORT_ALREADY_SENT", "This week's reports were already sent")
+	case repositories.IsNotFound(err):
+		respondWithError(w, http.StatusNotFound, "User not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Failed to run weekly reports: "+err.Error())
+	}
+}
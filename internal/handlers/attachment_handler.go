@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/storage"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// multipartOverhead allows for multipart headers and form fields on top of
+// the file itself
+const multipartOverhead = 1 << 20
+
+// maxAttachmentNameLength caps stored attachment file names
+const maxAttachmentNameLength = 255
+
+// AttachmentHandler handles message attachment upload and download
+type AttachmentHandler struct {
+	emailRepo    repositories.MailboxStore
+	storage      storage.Storage
+	scanner      storage.Scanner
+	perms        *middleware.PermissionEnforcer
+	maxBytes     int64
+	allowedTypes map[string]bool
+}
+
+// NewAttachmentHandler creates a new AttachmentHandler
+// scanner can be nil - uploads are not scanned
+func NewAttachmentHandler(emailRepo repositories.MailboxStore, store storage.Storage, scanner storage.Scanner, perms *middleware.PermissionEnforcer, maxUploadMB int, allowedTypes []string) *AttachmentHandler {
+	if scanner == nil {
+		scanner = storage.NoopScanner{}
+	}
+	allowed := make(map[string]bool, len(allowedTypes))
+	for _, t := range allowedTypes {
+		allowed[strings.ToLower(t)] = true
+	}
+	return &AttachmentHandler{
+		emailRepo:    emailRepo,
+		storage:      store,
+		scanner:      scanner,
+		perms:        perms,
+		maxBytes:     int64(maxUploadMB) << 20,
+		allowedTypes: allowed,
+	}
+}
+
+// UploadAttachment godoc
+// @Summary Upload a message attachment
+// @Description Uploads a file (multipart field "file") and attaches it to a message owned by the caller. An optional "contentId" form field makes it an inline image referenced as cid:<contentId>. Size and type are validated and the file is scanned before it is stored.
+// @Tags Communications
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Message ID"
+// @Param file formData file true "File to attach"
+// @Param contentId formData string false "Content-ID for inline images"
+// @Success 201 {object} models.MessageAttachment
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not the message owner"
+// @Failure 404 {object} ErrorResponse "Message not found"
+// @Failure 413 {object} ErrorResponse "File too large"
+// @Failure 415 {object} CodedErrorResponse "File type not allowed"
+// @Failure 422 {object} CodedErrorResponse "File failed the malware scan"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/messages/{id}/attachments [post]
+// @Security BearerAuth
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	messageID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid message ID format")
+		return
+	}
+
+	message, ok := h.accessibleMessage(w, r, messageID)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(h.maxBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "File exceeds the maximum upload size of "+strconv.FormatInt(h.maxBytes>>20, 10)+" MB")
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Invalid multipart form: "+err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "A file is required in the \"file\" field")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.maxBytes+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read uploaded file")
+		return
+	}
+	if int64(len(data)) > h.maxBytes {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File exceeds the maximum upload size of "+strconv.FormatInt(h.maxBytes>>20, 10)+" MB")
+		return
+	}
+	if len(data) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Uploaded file is empty")
+		return
+	}
+
+	filename := sanitizeAttachmentName(header.Filename)
+	contentType := attachmentContentType(header.Header.Get("Content-Type"), filename)
+	if !h.allowedTypes[contentType] {
+		respondWithErrorCode(w, http.StatusUnsupportedMediaType, "ATTACHMENT_TYPE_NOT_ALLOWED", "File type "+contentType+" is not allowed")
+		return
+	}
+	// Images are rendered by mail clients, so their bytes must agree with the declared type
+	if strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		respondWithErrorCode(w, http.StatusUnsupportedMediaType, "ATTACHMENT_TYPE_MISMATCH", "File content does not match its type "+contentType)
+		return
+	}
+
+	if err := h.scanner.Scan(ctx, filename, data); err != nil {
+		if errors.Is(err, storage.ErrInfected) {
+			log.Printf("Rejected upload %q to message %s by %s: %v", filename, messageID, middleware.GetUserID(r), err)
+			respondWithErrorCode(w, http.StatusUnprocessableEntity, "ATTACHMENT_INFECTED", "File failed the malware scan")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to scan file: "+err.Error())
+		return
+	}
+
+	attachmentID := uuid.MustNewUUID()
+	location, err := h.storage.Put(ctx, storage.Object{Key: attachmentID, Filename: filename, ContentType: contentType}, bytes.NewReader(data))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to store file: "+err.Error())
+		return
+	}
+
+	contentID := strings.Trim(strings.TrimSpace(r.FormValue("contentId")), "<>")
+	attachment := &models.MessageAttachment{
+		AttachmentID:    attachmentID,
+		MessageID:       message.ID,
+		FileName:        filename,
+		FileSizeBytes:   int64(len(data)),
+		MimeType:        contentType,
+		ContentID:       contentID,
+		StorageLocation: location,
+		IsInline:        contentID != "",
+		CreatedAt:       time.Now(),
+	}
+	if err := h.emailRepo.SaveCommAttachment(ctx, attachment); err != nil {
+		h.discard(r, location)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save attachment: "+err.Error())
+		return
+	}
+	err = h.emailRepo.AddMessageAttachment(ctx, message.ID, models.CommunicationAttachment{
+		FileName:  filename,
+		FileType:  contentType,
+		FileSize:  int64(len(data)),
+		FileURL:   location,
+		ContentID: contentID,
+	})
+	if err != nil {
+		// The metadata row is now an orphan; the orphan sweep removes it with the file
+		respondWithError(w, http.StatusInternalServerError, "Failed to attach file to message: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, attachment)
+}
+
+// DownloadAttachment godoc
+// @Summary Download a message attachment
+// @Description Streams an attachment of a message owned by the caller (admins may download any)
+// @Tags Communications
+// @Produce octet-stream
+// @Param id path string true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse "Invalid attachment ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not the message owner"
+// @Failure 404 {object} ErrorResponse "Attachment not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/attachments/{id} [get]
+// @Security BearerAuth
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attachmentID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid attachment ID format")
+		return
+	}
+
+	attachment, err := h.emailRepo.GetAttachmentByID(ctx, attachmentID)
+	if err != nil {
+		if repositories.IsAttachmentNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Attachment not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve attachment: "+err.Error())
+		return
+	}
+	if _, ok := h.accessibleMessage(w, r, attachment.MessageID); !ok {
+		return
+	}
+
+	content, err := h.storage.Open(ctx, attachment.StorageLocation)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Attachment file not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to open attachment: "+err.Error())
+		return
+	}
+	defer content.Close()
+
+	if err := h.emailRepo.IncrementAttachmentDownloadCount(ctx, attachment.ID); err != nil {
+		log.Printf("Warning: failed to count download of attachment %s: %v", attachment.ID, err)
+	}
+
+	disposition := "attachment"
+	if attachment.IsInline && strings.HasPrefix(attachment.MimeType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.FileSizeBytes, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Warning: download of attachment %s interrupted: %v", attachment.ID, err)
+	}
+}
+
+// accessibleMessage loads a message the caller may attach to or download
+// from: their own, or any message for an admin. It writes the error response
+// and returns false otherwise.
+func (h *AttachmentHandler) accessibleMessage(w http.ResponseWriter, r *http.Request, messageID string) (*models.MongoCommunication, bool) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, false
+	}
+
+	message, err := h.emailRepo.GetMessageByID(r.Context(), messageID)
+	if err != nil {
+		if repositories.IsCommunicationNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Message not found")
+			return nil, false
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve message: "+err.Error())
+		return nil, false
+	}
+
+	// Messages of other tenants are not revealed, even to admins
+	if models.TenantOf(message.TenantID) != middleware.GetTenantID(r) {
+		respondWithError(w, http.StatusNotFound, "Message not found")
+		return nil, false
+	}
+	if message.UserID != userID && !h.perms.HasRole(r, models.RoleAdmin) {
+		respondWithError(w, http.StatusForbidden, "Permission denied")
+		return nil, false
+	}
+	return message, true
+}
+
+// discard removes a stored file whose metadata could not be saved
+func (h *AttachmentHandler) discard(r *http.Request, location string) {
+	if err := h.storage.Delete(r.Context(), location); err != nil {
+		log.Printf("Warning: failed to remove unsaved attachment %s: %v", location, err)
+	}
+}
+
+// sanitizeAttachmentName keeps the base name of an uploaded file without
+// control characters, capped in length
+func sanitizeAttachmentName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	if runes := []rune(name); len(runes) > maxAttachmentNameLength {
+		name = string(runes[len(runes)-maxAttachmentNameLength:])
+	}
+	return name
+}
+
+// attachmentContentType returns the declared media type of an upload, or the
+// one implied by its extension when the client sent none
+func attachmentContentType(declared, filename string) string {
+	if mediaType, _, err := mime.ParseMediaType(declared); err == nil && mediaType != "application/octet-stream" {
+		return strings.ToLower(mediaType)
+	}
+	if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); byExt != "" {
+		if mediaType, _, err := mime.ParseMediaType(byExt); err == nil {
+			return mediaType
+		}
+	}
+	return "application/octet-stream"
+}
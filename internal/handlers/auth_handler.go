@@ -2,79 +2,193 @@ package handlers
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/emailtemplates"
 	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/i18n"
 	"github.com/white/user-management/internal/middleware"
 	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
 	"github.com/white/user-management/internal/repositories"
 	"github.com/white/user-management/internal/services"
 	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/clientip"
+	"github.com/white/user-management/pkg/email"
 	"github.com/white/user-management/pkg/kafka"
 	"github.com/white/user-management/pkg/mongodb"
-	"github.com/white/user-management/pkg/smtp"
 	"github.com/white/user-management/pkg/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthHandler struct {
 	authService    *services.AuthService
-	producer       *kafka.Producer
+	producer       *kafka.Producer // lossy telemetry only; domain events go through eventOutbox
+	eventOutbox    events.EventRecorder
 	config         *config.Config
-	settingsRepo   *repositories.SettingsRepository
+	settingsRepo   repositories.SettingsStore
 	otpService     *services.OTPService
-	smtpClient     *smtp.SMTPClient
-	db             *mongodb.Client
-	emailRepo      *repositories.MongoEmailRepository
-	userRepo       *repositories.MongoUserRepository
+	emailSender    email.EmailSender
+	transactor     repositories.Transactor // nil runs multi-document writes one by one
+	twoFactorCodes repositories.TwoFactorCodeStore
+	emailRepo      repositories.EmailStore
+	userRepo       repositories.UserStore
 	auditPublisher *events.AuditPublisher
-}
-
-func NewAuthHandler(db *mongodb.Client, config *config.Config, producer *kafka.Producer) *AuthHandler {
-	// Initialize repositories
+	emailQueue     *services.EmailQueue // nil sends emails directly
+	ssoService     *services.SSOService // nil when OIDC is not configured
+	jwtService     *utils.JWTService
+	impersonations repositories.ImpersonationStore
+	rbacService    *services.RBACService // nil reports the permissions in the request context
+	referenceData  *repositories.ReferenceDataRepository
+	systemEmails   *services.SystemEmails
+	loginHistory   *services.LoginHistoryRecorder // nil records no sign-in attempts
+	smsCodes       *services.SMSCodes             // nil sends every 2FA code by email
+	sessions       *services.SessionActivity
+}
+
+func NewAuthHandler(db *mongodb.Client, config *config.Config, producer *kafka.Producer, emailSender email.EmailSender, jwtService *utils.JWTService) *AuthHandler {
 	userRepo := repositories.NewUserRepository(db)
-	sessionRepo := repositories.NewSessionRepository(db)
-	passwordResetRepo := repositories.NewPasswordResetRepository(db)
-	permissionRepo := repositories.NewPermissionRepository(db)
-	settingsRepo := repositories.NewSettingsRepository(db)
-	emailRepo := repositories.NewMongoEmailRepository(db)
-
-	// Initialize JWT service
-	jwtService, err := utils.NewJWTService(config.JWT)
-	if err != nil {
-		panic("Failed to initialize JWT service: " + err.Error())
+	return NewAuthHandlerWithStores(AuthStores{
+		Users:                userRepo,
+		Sessions:             repositories.NewSessionRepository(db),
+		PasswordResets:       repositories.NewPasswordResetRepository(db),
+		Permissions:          repositories.NewPermissionRepository(db),
+		Settings:             repositories.NewSettingsRepository(db),
+		Emails:               repositories.NewMongoEmailRepository(db),
+		Impersonations:       repositories.NewImpersonationRepository(db),
+		TwoFactorCodes:       repositories.NewTwoFactorCodeRepository(db),
+		Events:               repositories.NewEventOutboxRepository(db),
+		ReferenceData:        repositories.NewReferenceDataRepository(db),
+		SystemEmailOverrides: repositories.NewMongoTemplateRepository(db),
+		Transactor:           db,
+	}, config, producer, emailSender, jwtService)
+}
+
+// AuthStores are the stores an AuthHandler works on. NewAuthHandler uses
+// the MongoDB repositories; the optional ones may be left nil.
+type AuthStores struct {
+	Users                repositories.UserStore
+	Sessions             repositories.SessionStore
+	PasswordResets       repositories.PasswordResetStore
+	Permissions          *repositories.PermissionRepository // nil keeps the permissions stored on users
+	Settings             repositories.SettingsStore
+	Emails               repositories.EmailStore
+	Impersonations       repositories.ImpersonationStore
+	TwoFactorCodes       repositories.TwoFactorCodeStore
+	Events               events.EventRecorder
+	ReferenceData        *repositories.ReferenceDataRepository // nil accepts any region and team
+	SystemEmailOverrides services.SystemEmailOverrides         // nil always sends the embedded emails
+	Transactor           repositories.Transactor               // nil runs multi-document writes one by one
+}
+
+// NewAuthHandlerWithStores creates an AuthHandler on the given stores
+func NewAuthHandlerWithStores(stores AuthStores, config *config.Config, producer *kafka.Producer, emailSender email.EmailSender, jwtService *utils.JWTService) *AuthHandler {
+	authService := services.NewAuthService(stores.Users, stores.Sessions, stores.PasswordResets, stores.Permissions, jwtService)
+	if stores.Transactor != nil {
+		authService.SetTransactor(stores.Transactor)
+	}
+	authService.SetPasswordHistory(stores.Settings)
+	sessions := services.NewSessionActivity(stores.Sessions, stores.Settings)
+	authService.SetSessionActivity(sessions)
+
+	return &AuthHandler{
+		authService:    authService,
+		producer:       producer,
+		eventOutbox:    stores.Events,
+		config:         config,
+		settingsRepo:   stores.Settings,
+		otpService:     services.NewOTPService(),
+		emailSender:    emailSender,
+		transactor:     stores.Transactor,
+		twoFactorCodes: stores.TwoFactorCodes,
+		emailRepo:      stores.Emails,
+		userRepo:       stores.Users,
+		jwtService:     jwtService,
+		impersonations: stores.Impersonations,
+		referenceData:  stores.ReferenceData,
+		systemEmails:   services.NewSystemEmails(stores.SystemEmailOverrides, config.Email.FromEmail, config.Email.FromName),
+		sessions:       sessions,
 	}
+}
 
-	authService := services.NewAuthService(userRepo, sessionRepo, passwordResetRepo, permissionRepo, jwtService)
-	otpService := services.NewOTPService()
-	smtpClient, err := smtp.NewSMTPClientFromEnv()
+// SetPasswordHasher sets the hasher passwords are hashed and compared with;
+// nil keeps password.DefaultCost
+func (h *AuthHandler) SetPasswordHasher(hasher *password.Hasher) {
+	if hasher != nil {
+		h.authService.SetPasswordHasher(hasher)
+	}
+}
 
-	return &AuthHandler{
-		authService:  authService,
-		producer:     producer,
-		config:       config,
-		settingsRepo: settingsRepo,
-		otpService:   otpService,
-		smtpClient:   smtpClient,
-		db:           db,
-		emailRepo:    emailRepo,
-		userRepo:     userRepo,
+// SetSystemEmails sets how 2FA and password reset emails are rendered and
+// addressed; nil keeps the one built from the email config
+func (h *AuthHandler) SetSystemEmails(systemEmails *services.SystemEmails) {
+	if systemEmails != nil {
+		h.systemEmails = systemEmails
 	}
 }
+
 // SetAuditPublisher sets the audit publisher for logging auth events
 func (h *AuthHandler) SetAuditPublisher(publisher *events.AuditPublisher) {
 	h.auditPublisher = publisher
 }
 
+// SetEmailQueue queues 2FA and password reset emails for the email worker
+// instead of sending them during the request
+func (h *AuthHandler) SetEmailQueue(queue *services.EmailQueue) {
+	h.emailQueue = queue
+}
+
+// SetNotificationService alerts users when they sign in from a new device
+func (h *AuthHandler) SetNotificationService(notifier *services.NotificationService) {
+	h.authService.SetNotificationService(notifier)
+}
+
+// SetLoginHistory records every sign-in attempt of known users in their
+// login history
+func (h *AuthHandler) SetLoginHistory(recorder *services.LoginHistoryRecorder) {
+	h.loginHistory = recorder
+	h.authService.SetLoginHistory(recorder)
+}
+
+// SetSessionActivity sets the tracker that times out idle sessions, shared
+// with the middleware recording their activity; nil keeps the handler's own
+func (h *AuthHandler) SetSessionActivity(sessions *services.SessionActivity) {
+	if sessions != nil {
+		h.sessions = sessions
+		h.authService.SetSessionActivity(sessions)
+	}
+}
+
+// SetSMSCodes lets users who chose SMS receive their 2FA codes by text
+func (h *AuthHandler) SetSMSCodes(smsCodes *services.SMSCodes) {
+	h.smsCodes = smsCodes
+}
+
+// recordLogin adds a sign-in attempt of userID to the login history; an
+// empty failureReason records a successful sign-in
+func (h *AuthHandler) recordLogin(r *http.Request, userID, email, method string, twoFactor bool, failureReason string) {
+	h.loginHistory.Record(models.LoginRecord{
+		UserID:        userID,
+		Email:         email,
+		Success:       failureReason == "",
+		FailureReason: failureReason,
+		Method:        method,
+		TwoFactor:     twoFactor,
+		IPAddress:     clientip.FromRequest(r),
+		UserAgent:     r.UserAgent(),
+	})
+}
+
 // LoginRequest represents the login request body
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=256"`
 }
 
 // LoginResponse represents the login response body
@@ -83,34 +197,11 @@ type LoginResponse struct {
 	Tokens                interface{} `json:"tokens,omitempty"`
 	Requires2FA           bool        `json:"requires_2fa,omitempty"`
 	RequiresPasswordReset bool        `json:"requiresPasswordReset,omitempty"`
-	TempToken             string      `json:"temp_token,omitempty"`
+	TempToken             string      `json:"temp_token,omitempty"` // 2FA token, or with requiresPasswordReset the reset_token for /auth/password/reset
+	Channel               string      `json:"channel,omitempty"`    // Where the 2FA code was sent: email or sms
 	Message               string      `json:"message,omitempty"`
 }
 
-// Helper function to get client IP from request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		ips := strings.Split(forwarded, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
-	}
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	// Remove port if present
-	if colon := strings.LastIndex(ip, ":"); colon != -1 {
-		ip = ip[:colon]
-	}
-	return ip
-}
-
 // Login godoc
 // @Summary User login
 // @Description Authenticates a user with email and password, returns JWT tokens or requires 2FA verification
@@ -119,37 +210,50 @@ func getClientIP(r *http.Request) string {
 // @Produce json
 // @Param loginRequest body LoginRequest true "Login credentials"
 // @Success 200 {object} LoginResponse "Login successful or 2FA required"
-// @Failure 400 {object} ErrorResponse "Invalid request body or missing fields"
+// @Failure 400 {object} CodedErrorResponse "Invalid request body or missing fields"
 // @Failure 401 {object} ErrorResponse "Invalid credentials"
+// @Failure 403 {object} CodedErrorResponse "Password sign-in disabled, SSO required"
+// @Failure 429 {object} CodedErrorResponse "Too many 2FA codes texted to the user's phone and no email fallback"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-	// Basic validation
-	if req.Email == "" || req.Password == "" {
-		respondWithError(w, http.StatusBadRequest, "Email and password are required")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
 	// Authenticate user (validates password but doesn't create session yet for 2FA flow)
-	user, tokens, err := h.authService.Login(req.Email, req.Password, getClientIP(r), r.UserAgent())
+	user, tokens, err := h.authService.Login(r.Context(), req.Email, req.Password, clientip.FromRequest(r), r.UserAgent())
 
 	if err != nil {
+		if errors.Is(err, services.ErrPasswordLoginDisabled) {
+			if h.auditPublisher != nil {
+				h.auditPublisher.PublishAuthEvent(r, "", req.Email, req.Email, events.ActionLoginFailed, false, "Password login rejected for "+req.Email+": SSO is required")
+			}
+			respondWithErrorCode(w, http.StatusForbidden, "SSO_REQUIRED", "Password sign-in is disabled, sign in with SSO")
+			return
+		}
+		if !errors.Is(err, services.ErrInvalidCredentials) {
+			log.Printf("Error: Login failed: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+			return
+		}
+		// The audit event records why the sign-in was rejected; the client
+		// gets the same response whatever the reason
 		if h.auditPublisher != nil {
-			h.auditPublisher.PublishAuthEvent(r, "", req.Email, req.Email, events.ActionLoginFailed, false, fmt.Sprintf("Login failed for %s: invalid credentials", req.Email))
+			h.auditPublisher.PublishAuthEvent(r, "", req.Email, req.Email, events.ActionLoginFailed, false, fmt.Sprintf("Login failed for %s: %v", req.Email, err))
 		}
 		respondWithError(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
-	// Check if user must reset password (master admin first login)
+	// Check if user must reset password (master admin first login). The
+	// temp token is a reset token for POST /auth/password/reset.
 	if user.MustResetPassword {
-		// Generate temporary token for password reset (15-minute validity encoded in token)
-		tokenData := fmt.Sprintf("reset:%s:%d", user.ID, time.Now().Unix())
-		tempToken := base64.URLEncoding.EncodeToString([]byte(tokenData))
+		tempToken, err := h.authService.StartForcedPasswordReset(r.Context(), user, clientip.FromRequest(r), r.UserAgent())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to start password reset")
+			return
+		}
 
 		respondWithJSON(w, http.StatusOK, LoginResponse{
 			RequiresPasswordReset: true,
@@ -160,7 +264,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has 2FA enabled
-	ctx := context.Background()
+	ctx := r.Context()
 	securitySettings, err := h.settingsRepo.GetSecuritySettings(ctx, user.ID)
 	fmt.Printf("DEBUG 2FA: userID=%s, err=%v, settings=%+v\n", user.ID, err, securitySettings)
 	if err == nil && securitySettings != nil && securitySettings.TwoFactorEnabled {
@@ -182,23 +286,35 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Send OTP via email
+		// Send OTP through the user's 2FA channel
 		fmt.Printf("DEBUG 2FA: OTP code for %s is: %s\n", user.Email, otp)
-		err = h.send2FAEmail(user.Email, user.Name, otp)
+		channel, err := h.send2FACode(ctx, user, securitySettings, otp)
+		if errors.Is(err, services.ErrSMSRateLimited) {
+			respondWithErrorCode(w, http.StatusTooManyRequests, "SMS_RATE_LIMITED", "Too many codes were sent to your phone, try again later")
+			return
+		}
 		if err != nil {
-			fmt.Printf("Warning: Failed to send 2FA email: %v\n", err)
+			fmt.Printf("Warning: Failed to send 2FA code by %s: %v\n", channel, err)
 			// Continue anyway - OTP is logged in dev mode
 		}
 
+		message := "2FA verification required. Please check your email for the OTP code."
+		if channel == models.TwoFactorMethodSMS {
+			message = "2FA verification required. Please check your phone ending in " + lastDigits(securitySettings.PhoneNumber) + " for the OTP code."
+		}
 		respondWithJSON(w, http.StatusOK, LoginResponse{
 			Requires2FA: true,
 			TempToken:   tempToken,
-			Message:     "2FA verification required. Please check your email for the OTP code.",
+			Channel:     channel,
+			Message:     message,
 		})
+		return
 	}
 	// No 2FA - proceed with normal login
-	// Publish login event to Kafka (async, fire-and-forget)
-	go h.publishLoginEvent(user, getClientIP(r), r.UserAgent())
+	h.recordLogin(r, user.ID, user.Email, models.LoginMethodPassword, false, "")
+
+	// Record login event for Kafka (relayed from the events outbox)
+	h.publishLoginEvent(r.Context(), user, clientip.FromRequest(r), r.UserAgent())
 
 	// Publish audit event for successful login
 	if h.auditPublisher != nil {
@@ -214,7 +330,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 // LogoutRequest represents the logout request body
 type LogoutRequest struct {
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 // Logout godoc
@@ -224,31 +340,25 @@ type LogoutRequest struct {
 // @Accept json
 // @Produce json
 // @Param logoutRequest body LogoutRequest true "Refresh token to revoke"
-// @Success 200 {object} map[string]string "Logout successful"
-// @Failure 400 {object} ErrorResponse "Invalid request body or missing refresh token"
+// @Success 200 {object} MessageResponse "Logout successful"
+// @Failure 400 {object} CodedErrorResponse "Invalid request body or missing refresh token"
 // @Failure 401 {object} ErrorResponse "Invalid or expired refresh token"
 // @Router /auth/logout [post]
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	var req LogoutRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-	// Basic validation
-	if req.RefreshToken == "" {
-		respondWithError(w, http.StatusBadRequest, "Refresh token is required")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
 	// Revoke session and invalidate refresh token
-	user, err := h.authService.Logout(req.RefreshToken)
+	user, err := h.authService.Logout(r.Context(), req.RefreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
 		return
 	}
 
-	// Publish logout event to Kafka (async, fire-and-forget)
-	go h.publishLogoutEvent(user, getClientIP(r), r.UserAgent())
+	// Record logout event for Kafka (relayed from the events outbox)
+	h.publishLogoutEvent(r.Context(), user, clientip.FromRequest(r), r.UserAgent())
 
 	// Publish audit event for logout
 	if h.auditPublisher != nil {
@@ -263,7 +373,7 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 
 // RefreshTokenRequest represents the refresh token request body
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 // RefreshTokenResponse represents the refresh token response
@@ -273,32 +383,23 @@ type RefreshTokenResponse struct {
 
 // RefreshToken godoc
 // @Summary Refresh access token
-// @Description Generates new access and refresh tokens using a valid refresh token
+// @Description Generates new access and refresh tokens using a valid refresh token. Sessions unused for longer than the user's session timeout (security settings, in minutes) are rejected like expired ones; every request made with the session's access tokens counts as use. Sessions end after 7 days however active they are.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param refreshRequest body RefreshTokenRequest true "Refresh token"
 // @Success 200 {object} RefreshTokenResponse "Token refreshed successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request body or missing refresh token"
+// @Failure 400 {object} CodedErrorResponse "Invalid request body or missing refresh token"
 // @Failure 401 {object} ErrorResponse "Invalid or expired refresh token"
 // @Router /auth/refresh [post]
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var req RefreshTokenRequest
-
-	// Decode request body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	// Validate refresh token
-	if req.RefreshToken == "" {
-		respondWithError(w, http.StatusBadRequest, "Refresh token is required")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
 	// Refresh token
-	tokens, err := h.authService.RefreshToken(req.RefreshToken)
+	tokens, err := h.authService.RefreshToken(r.Context(), req.RefreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
 		return
@@ -311,34 +412,31 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 // ChangePasswordRequest represents the change password request body
 type ChangePasswordRequest struct {
-	OldPassword string `json:"old_password"`
-	NewPassword string `json:"new_password"`
+	OldPassword string `json:"old_password" validate:"required,max=256"`
+	NewPassword string `json:"new_password" validate:"required,max=256"`
 }
 
 // ChangePassword godoc
 // @Summary Change password
-// @Description Changes password for authenticated user
+// @Description Changes password for authenticated user. The new password may not be one of the user's recent passwords (passwordHistoryCount of the system security settings, the current one included).
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param changePasswordRequest body ChangePasswordRequest true "Old and new passwords"
-// @Success 200 {object} map[string]string "Password changed successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request body or password validation failed"
+// @Success 200 {object} MessageResponse "Password changed successfully"
+// @Failure 400 {object} CodedErrorResponse "Invalid request body or password validation failed; PASSWORD_RECENTLY_USED for a recent password"
 // @Failure 401 {object} ErrorResponse "User not authenticated"
-// @Router /auth/change-password [post]
+// @Router /auth/password/change [post]
 func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	var req ChangePasswordRequest
-
-	// Decode request body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	// Validate passwords
-	if req.OldPassword == "" || req.NewPassword == "" {
-		respondWithError(w, http.StatusBadRequest, "Old password and new password are required")
+	// Credentials are only changed by the account owner
+	if h.hasImpersonationToken(r) {
+		respondWithErrorCode(w, http.StatusForbidden, "IMPERSONATION_FORBIDDEN", "Passwords cannot be changed while impersonating a user")
 		return
 	}
 
@@ -360,12 +458,16 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	// }
 
 	// Change password
-	if err := h.authService.ChangePassword(userID, req.OldPassword, req.NewPassword); err != nil {
+	if err := h.authService.ChangePassword(r.Context(), userID, req.OldPassword, req.NewPassword); err != nil {
 		// Publish audit event for failed password change
 		if h.auditPublisher != nil {
 			userName, _ := r.Context().Value(middleware.NameKey).(string)
 			h.auditPublisher.PublishAuthEvent(r, userID, userName, "", events.ActionPasswordChanged, false, fmt.Sprintf("Password change failed: %v", err))
 		}
+		if errors.Is(err, services.ErrPasswordRecentlyUsed) {
+			respondWithPasswordRecentlyUsed(w)
+			return
+		}
 		respondWithError(w, http.StatusBadRequest, "")
 		return
 	}
@@ -375,9 +477,20 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// hasImpersonationToken reports whether the request carries a valid
+// impersonation access token. Used by public routes that take no JWT.
+func (h *AuthHandler) hasImpersonationToken(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.jwtService == nil {
+		return false
+	}
+	claims, err := h.jwtService.ValidateAccessToken(token)
+	return err == nil && claims.IsImpersonation()
+}
+
 // ForgotPasswordRequest represents the forgot password request body
 type ForgotPasswordRequest struct {
-	Email string `json:"email"`
+	Email string `json:"email" validate:"required,email,max=254"`
 }
 
 // ForgotPasswordResponse represents the forgot password response
@@ -394,27 +507,19 @@ type ForgotPasswordResponse struct {
 // @Produce json
 // @Param forgotPasswordRequest body ForgotPasswordRequest true "User email"
 // @Success 200 {object} ForgotPasswordResponse "Password reset email sent"
-// @Failure 400 {object} ErrorResponse "Invalid request body or email validation failed"
+// @Failure 400 {object} CodedErrorResponse "Invalid request body or email validation failed"
 // @Failure 500 {object} ErrorResponse "Failed to create reset token"
-// @Router /auth/forgot-password [post]
+// @Router /auth/password/forgot [post]
 func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	var req ForgotPasswordRequest
-
-	// Decode request body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	// Validate email
-	if req.Email == "" {
-		respondWithError(w, http.StatusBadRequest, "Email is required")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 	// Create reset token
 	resetToken, err := h.authService.ForgotPassword(
+		r.Context(),
 		req.Email,
-		getClientIP(r),
+		clientip.FromRequest(r),
 		r.UserAgent(),
 	)
 
@@ -423,15 +528,15 @@ func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userRepo.GetByEmailCompat(req.Email)
+	user, err := h.userRepo.GetByEmail(r.Context(), req.Email)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "This is email not exists")
 		return
 	}
 	// Send invitation email via Kafka queue (or direct SMTP as fallback)
 	emailSent := false
-	inviteURL := fmt.Sprintf("%s/auth/password/reset?token=%s", getAppBaseURL(), resetToken)
-	emailErr := h.sendForgetPasswordEmail(req.Email, user.Name, inviteURL)
+	inviteURL := fmt.Sprintf("%s/auth/password/reset?token=%s", h.config.App.BaseURL, resetToken)
+	emailErr := h.sendForgetPasswordEmail(i18n.WithPreference(r.Context(), user.PreferredLanguage()), req.Email, user.Name, inviteURL)
 	if emailErr != nil {
 		// Log error but don't fail the request - user is already created
 		fmt.Printf("Warning: Failed to send invitation email to %s: %v\n", req.Email, emailErr)
@@ -459,32 +564,23 @@ func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 
 // ResetPasswordRequest represents the reset password request body
 type ResetPasswordRequest struct {
-	ResetToken  string `json:"reset_token"`
-	NewPassword string `json:"new_password"`
+	ResetToken  string `json:"reset_token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,max=256"`
 }
 
 // ResetPassword godoc
 // @Summary Reset password with token
-// @Description Resets user password using reset token from email
+// @Description Resets user password using reset token from email, or the one of a forced reset. The new password may not be one of the user's recent passwords.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param resetPasswordRequest body ResetPasswordRequest true "Reset token and new password"
-// @Success 200 {object} map[string]string "Password reset successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request body, token, or password validation failed"
-// @Router /auth/reset-password [post]
+// @Success 200 {object} MessageResponse "Password reset successfully"
+// @Failure 400 {object} CodedErrorResponse "Invalid request body, token, or password validation failed; PASSWORD_RECENTLY_USED for a recent password"
+// @Router /auth/password/reset [post]
 func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	var req ResetPasswordRequest
-
-	// Decode request body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	// Validate inputs
-	if req.ResetToken == "" || req.NewPassword == "" {
-		respondWithError(w, http.StatusBadRequest, "Reset token and new password are required")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
@@ -495,11 +591,15 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 	// Reset password
-	if err := h.authService.ResetPassword(req.ResetToken, req.NewPassword); err != nil {
+	if err := h.authService.ResetPassword(r.Context(), req.ResetToken, req.NewPassword); err != nil {
 		// Publish audit event for failed password reset
 		if h.auditPublisher != nil {
 			h.auditPublisher.PublishAuthEvent(r, "", "", "", events.ActionPasswordReset, false, fmt.Sprintf("Password reset failed: %v", err))
 		}
+		if errors.Is(err, services.ErrPasswordRecentlyUsed) {
+			respondWithPasswordRecentlyUsed(w)
+			return
+		}
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -515,357 +615,176 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 
 }
 
-type TwoFAOTP struct {
-	ID        string    `bson:"_id,omitempty"`
-	UserID    string    `bson:"user_id"`
-	TempToken string    `bson:"temp_token"`
-	OTPHash   string    `bson:"otp_hash"`
-	ExpiresAt time.Time `bson:"expires_at"`
-	Used      bool      `bson:"used"`
-	CreatedAt time.Time `bson:"created_at"`
+// respondWithPasswordRecentlyUsed refuses a new password that is one of the
+// user's recent passwords
+func respondWithPasswordRecentlyUsed(w http.ResponseWriter) {
+	respondWithErrorCode(w, http.StatusBadRequest, "PASSWORD_RECENTLY_USED", "Password was used recently, choose a different one")
 }
 
-// store2FAOTP stores the 2FA OTP in the database
+// store2FAOTP stores the 2FA OTP of a sign-in
 func (h *AuthHandler) store2FAOTP(ctx context.Context, userID, tempToken string, otpHash string, expiresAt time.Time) error {
-	collection := h.db.Database().Collection("two_factor_otps")
-	newUUID := uuid.MustNewUUID()
-	otp := TwoFAOTP{
-		ID:        newUUID,
+	return h.twoFactorCodes.CreateTwoFactorCode(ctx, &models.TwoFAOTP{
+		ID:        uuid.MustNewUUID(),
 		UserID:    userID,
 		TempToken: tempToken,
 		OTPHash:   otpHash,
 		ExpiresAt: expiresAt,
 		Used:      false,
 		CreatedAt: time.Now(),
-	}
-
-	_, err := collection.InsertOne(ctx, otp)
-	return err
+	})
 }
 
-// get2FAOTP retrieves the 2FA OTP record by temp token
-func (h *AuthHandler) get2FAOTP(ctx context.Context, tempToken string) (*TwoFAOTP, error) {
-	collection := h.db.Database().Collection("two_factor_otps")
-	var otp TwoFAOTP
-	err := collection.FindOne(ctx, map[string]interface{}{
-		"temp_token": tempToken,
-		"used":       false,
-	}).Decode(&otp)
-
-	if err != nil {
-		return nil, err
+// inTransaction runs fn in a transaction when a transactor is set, and
+// directly otherwise
+func (h *AuthHandler) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if h.transactor == nil {
+		return fn(ctx)
 	}
-
-	return &otp, nil
+	return h.transactor.WithTransaction(ctx, fn)
 }
 
-// mark2FAOTPUsed marks the OTP as used
-func (h *AuthHandler) mark2FAOTPUsed(ctx context.Context, tempToken string) error {
-	collection := h.db.Database().Collection("two_factor_otps")
+// send2FACode sends a 2FA sign-in code through the user's 2FA channel and
+// returns the channel used. A code that cannot be texted is emailed instead
+// when SMS fallback is configured.
+func (h *AuthHandler) send2FACode(ctx context.Context, user *models.User, settings *models.SettingsUserSecuritySettings, otp string) (string, error) {
+	if h.smsCodes != nil && settings.TwoFactorChannel() == models.TwoFactorMethodSMS {
+		err := h.smsCodes.SendSignInCode(ctx, settings.PhoneNumber, otp, h.otpService.ExpiryMinutes())
+		if err == nil {
+			return models.TwoFactorMethodSMS, nil
+		}
+		if !h.smsCodes.FallbackToEmail() {
+			return models.TwoFactorMethodSMS, err
+		}
+		fmt.Printf("Warning: Failed to text 2FA code to user %s, emailing it instead: %v\n", user.ID, err)
+	}
+	return models.TwoFactorMethodEmail, h.send2FAEmail(i18n.WithPreference(ctx, user.PreferredLanguage()), user.Email, user.Name, otp)
+}
 
-	_, err := collection.UpdateOne(ctx,
-		map[string]interface{}{"temp_token": tempToken},
-		map[string]interface{}{"$set": map[string]interface{}{"used": true}},
-	)
-	return err
+// lastDigits returns the last four digits of a phone number
+func lastDigits(phoneNumber string) string {
+	if len(phoneNumber) <= 4 {
+		return phoneNumber
+	}
+	return phoneNumber[len(phoneNumber)-4:]
 }
 
-// send2FAEmail sends the 2FA OTP via email using Kafka queue (go-worker handles actual sending)
-func (h *AuthHandler) send2FAEmail(email, name, otp string) error {
-	subject := "White Platform - Your Login Verification Code"
-
-	htmlBody := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background-color: #4F46E5; color: white; padding: 20px; text-align: center; }
-        .content { background-color: #f9f9f9; padding: 30px; border-radius: 5px; margin-top: 20px; }
-        .otp-code { font-size: 32px; font-weight: bold; letter-spacing: 8px; color: #4F46E5; text-align: center; margin: 30px 0; padding: 20px; background-color: #fff; border-radius: 5px; border: 2px dashed #4F46E5; }
-        .footer { text-align: center; margin-top: 20px; font-size: 12px; color: #666; }
-        .warning { color: #DC2626; font-weight: bold; margin-top: 20px; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>Login Verification</h1>
-        </div>
-        <div class="content">
-            <p>Hello %s,</p>
-            <p>You are attempting to login to White Platform. Please use the following verification code to complete your login:</p>
-
-            <div class="otp-code">%s</div>
-
-            <p><strong>This code is valid for 10 minutes.</strong></p>
-
-            <p>If you didn't request this login, please ignore this email and ensure your account is secure.</p>
-
-            <p class="warning">Never share this code with anyone. Our team will never ask for your verification code.</p>
-        </div>
-        <div class="footer">
-            <p>&copy; 2025 White Platform. All rights reserved.</p>
-            <p>This is an automated email. Please do not reply.</p>
-        </div>
-    </div>
-</body>
-</html>
-	`, name, otp)
-
-	plainBody := fmt.Sprintf(`
-Login Verification
-
-Hello %s,
-
-You are attempting to login to White Platform. Please use the following verification code to complete your login:
-
-Verification Code: %s
-
-This code is valid for 10 minutes.
-
-If you didn't request this login, please ignore this email and ensure your account is secure.
-
-SECURITY WARNING: Never share this code with anyone. Our team will never ask for your verification code.
-
----
-White Platform
-This is an automated email. Please do not reply.
-	`, name, otp)
-
-	// Create email message with unique ID
-	messageID := uuid.MustNewUUID()
-	now := time.Now()
-
-	msg := &models.CommMessage{
-		MessageID:   messageID,
-		Channel:     models.ChannelEmail,
-		Direction:   models.DirectionOutbound,
-		Status:      models.MessageStatusQueued,
-		FromAddress: "sivaganesz7482@gmail.com",
-		FromName:    "White Platform",
-		ToAddresses: []string{email},
-		Subject:     subject,
-		BodyHTML:    htmlBody,
-		BodyText:    plainBody,
-		Priority:    models.PriorityUrgent, // OTP emails are urgent
-		CreatedAt:   now,
-		UpdatedAt:   now,
+// send2FAEmail sends the 2FA OTP via email using the Kafka queue (the email worker handles actual sending)
+func (h *AuthHandler) send2FAEmail(ctx context.Context, email, name, otp string) error {
+	msg, err := h.systemEmails.Compose(ctx, email, emailtemplates.OTPData{
+		Name:         name,
+		Code:         otp,
+		ValidMinutes: h.otpService.ExpiryMinutes(),
+	})
+	if err != nil {
+		return err
 	}
+	expiresAt := h.otpService.GetExpiryTime() // A retried code is useless once it has expired
+	msg.Priority = models.PriorityUrgent      // OTP emails are urgent
+	msg.ExpiresAt = &expiresAt
 
 	// Store message in MongoDB
 	if h.emailRepo != nil {
-		if err := h.emailRepo.CreateMessageCompat(msg); err != nil {
+		if err := h.emailRepo.CreateCommMessage(ctx, msg); err != nil {
 			fmt.Printf("Warning: Failed to store 2FA email in database: %v\n", err)
 			// Fall back to direct SMTP if available
-			return h.send2FAEmailDirect(email, msg)
+			return h.send2FAEmailDirect(ctx, email, msg)
 		}
-	}
 
-	// Future Enhancement: email queuing via Kafka
-
-	// Queue via Kafka for go-worker to process
-	// if h.producer != nil {
-	// queueMessage := models.NewEmailQueueMessage(
-	// 	messageID.Hex(),
-	// 	"smtp", // Use SMTP for system emails
-	// 	"urgent",
-	// )
-	// if err := h.producer.PublishJSON("email.queued", queueMessage); err != nil {
-	// 	fmt.Printf("Warning: Failed to queue 2FA email to Kafka: %v\n", err)
-	// Fall back to direct SMTP if available
-	// return h.send2FAEmailDirect(email, msg)
-	// }
-	// fmt.Printf("2FA email queued successfully for: %s (message_id=%s)\n", email, messageID.Hex())
-	// return nil
-	// }
+		// Queue via Kafka for the email worker to process
+		if err := h.emailQueue.Enqueue(ctx, msg); err == nil {
+			fmt.Printf("2FA email queued successfully for: %s (message_id=%s)\n", email, msg.MessageID)
+			return nil
+		} else if !errors.Is(err, services.ErrEmailQueueDisabled) {
+			fmt.Printf("Warning: Failed to queue 2FA email to Kafka: %v\n", err)
+		}
+	}
 
-	// No Kafka available, fall back to direct SMTP
-	return h.send2FAEmailDirect(email, msg)
+	// No queue available, send directly through the email provider
+	return h.send2FAEmailDirect(ctx, email, msg)
 }
 
-// send2FAEmailDirect sends 2FA email directly via SMTP (fallback when Kafka unavailable)
-func (h *AuthHandler) send2FAEmailDirect(email string, msg *models.CommMessage) error {
-	if h.smtpClient == nil {
-		fmt.Printf("SMTP not configured. 2FA email would be sent to: %s\n", email)
-		fmt.Printf("Subject: %s\n", msg.Subject)
-		return nil
-	}
-	if err := h.smtpClient.SendEmail(msg); err != nil {
-		fmt.Printf("SMTP ERROR: Failed to send 2FA email to %s: %v\n", email, err)
+// send2FAEmailDirect sends 2FA email directly through the email provider (fallback when Kafka unavailable)
+func (h *AuthHandler) send2FAEmailDirect(ctx context.Context, email string, msg *models.CommMessage) error {
+	if err := deliverEmail(ctx, h.emailSender, h.emailRepo, msg); err != nil {
+		fmt.Printf("EMAIL ERROR: Failed to send 2FA email to %s via %s: %v\n", email, h.emailSender.Name(), err)
 		return err
 	}
-	fmt.Printf("2FA email sent successfully to: %s\n", email)
+	fmt.Printf("2FA email sent successfully to: %s (provider: %s)\n", email, h.emailSender.Name())
 	return nil
 }
 
-// sendForgetPasswordEmail sends Forget email via.
 // sendForgetPasswordEmail sends forgot password email
-func (h *AuthHandler) sendForgetPasswordEmail(toEmail, name, resetLink string) error {
-	subject := "Reset your password"
-
-	htmlBody := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-  <meta charset="UTF-8">
-  <title>Password Reset</title>
-</head>
-<body style="font-family: Arial, sans-serif; background-color: #f6f6f6; padding: 20px;">
-  <table width="100%%" cellpadding="0" cellspacing="0">
-    <tr>
-      <td align="center">
-        <table width="600" style="background: #ffffff; padding: 30px; border-radius: 8px;">
-          <tr>
-            <td>
-              <h2 style="color: #333;">Reset your password</h2>
-
-              <p>Hello %s,</p>
-
-              <p>
-                We received a request to reset your password.
-                Click the button below to choose a new one.
-              </p>
-
-              <p style="text-align: center; margin: 30px 0;">
-                <a href="%s"
-                   style="background: #4f46e5; color: #ffffff; padding: 12px 24px;
-                          text-decoration: none; border-radius: 6px; font-weight: bold;">
-                  Reset Password
-                </a>
-              </p>
-
-              <p>
-                This link will expire in <strong>30 minutes</strong>.
-              </p>
-
-              <p>
-                If you did not request a password reset, you can safely ignore this email.
-              </p>
-
-              <hr style="margin: 30px 0; border: none; border-top: 1px solid #eee;">
-
-              <p style="font-size: 12px; color: #888;">
-                If the button doesn’t work, copy and paste this link into your browser:
-                <br>
-                <a href="%s">%s</a>
-              </p>
-
-              <p style="font-size: 12px; color: #888;">
-                — The %s Security Team
-              </p>
-            </td>
-          </tr>
-        </table>
-      </td>
-    </tr>
-  </table>
-</body>
-</html>
-`,
-		name,
-		resetLink,
-		resetLink,
-		resetLink,
-		"White",
-	)
-
-	textBody := fmt.Sprintf(
-		`Hello %s,
-
-We received a request to reset your password.
-
-Reset your password using the link below:
-%s
-
-This link will expire in 30 minutes.
-
-If you did not request this, you can ignore this email.
-
-— %s Security Team
-`,
-		name,
-		resetLink,
-		"user",
-	)
-
-	// Create email message with unique ID
-	messageID := uuid.MustNewUUID()
-	now := time.Now()
-
-	msg := &models.CommMessage{
-		MessageID:   messageID,
-		Channel:     models.ChannelEmail,
-		Direction:   models.DirectionOutbound,
-		Status:      models.MessageStatusQueued,
-		FromAddress: "sivaganesz7482@gmail.com",
-		FromName:    "White Platform",
-		ToAddresses: []string{toEmail},
-		Subject:     subject,
-		BodyHTML:    htmlBody,
-		BodyText:    textBody,
-		Priority:    models.PriorityHigh, // Invitations are high priority
-		CreatedAt:   now,
-		UpdatedAt:   now,
+func (h *AuthHandler) sendForgetPasswordEmail(ctx context.Context, toEmail, name, resetLink string) error {
+	msg, err := h.systemEmails.Compose(ctx, toEmail, emailtemplates.PasswordResetData{
+		Name:         name,
+		ResetURL:     resetLink,
+		ValidMinutes: int(services.PasswordResetValidity / time.Minute),
+	})
+	if err != nil {
+		return err
 	}
+	msg.Priority = models.PriorityUrgent // Password resets are urgent, sent outside working hours too
 
 	// Store message in MongoDB
 	if h.emailRepo != nil {
-		if err := h.emailRepo.CreateMessageCompat(msg); err != nil {
+		if err := h.emailRepo.CreateCommMessage(ctx, msg); err != nil {
 			fmt.Printf("Warning: Failed to store invitation email in database: %v\n", err)
 			// Fall back to direct SMTP if available
-			return h.sendForgetPasswordEmailDirect(toEmail, msg)
+			return h.sendForgetPasswordEmailDirect(ctx, toEmail, msg)
+		}
+
+		// Queue via Kafka for the email worker to process
+		if err := h.emailQueue.Enqueue(ctx, msg); err == nil {
+			fmt.Printf("Password reset email queued successfully for: %s (message_id=%s)\n", toEmail, msg.MessageID)
+			return nil
+		} else if !errors.Is(err, services.ErrEmailQueueDisabled) {
+			fmt.Printf("Warning: Failed to queue password reset email to Kafka: %v\n", err)
 		}
 	}
-	// Send email via your email service
-	return h.sendForgetPasswordEmailDirect(toEmail, msg)
+
+	// No queue available, send directly through the email provider
+	return h.sendForgetPasswordEmailDirect(ctx, toEmail, msg)
 }
 
-func (h *AuthHandler) sendForgetPasswordEmailDirect(toEmail string, msg *models.CommMessage) error {
-	if h.smtpClient == nil {
-		fmt.Printf("SMTP not configured. Invitation email would be sent to: %s\n", toEmail)
-		fmt.Printf("Subject: %s\n", msg.Subject)
-		return nil
-	}
-	err := h.smtpClient.SendEmail(msg)
-	if err != nil {
-		fmt.Printf("SMTP ERROR: Failed to send invitation email to %s: %v\n", toEmail, err)
+func (h *AuthHandler) sendForgetPasswordEmailDirect(ctx context.Context, toEmail string, msg *models.CommMessage) error {
+	if err := deliverEmail(ctx, h.emailSender, h.emailRepo, msg); err != nil {
+		fmt.Printf("EMAIL ERROR: Failed to send password reset email to %s via %s: %v\n", toEmail, h.emailSender.Name(), err)
 		return err
 	}
 
-	fmt.Printf("Invitation email sent directly via SMTP to: %s\n", toEmail)
+	fmt.Printf("Password reset email sent to: %s (provider: %s)\n", toEmail, h.emailSender.Name())
 	return nil
 }
 
+// Verify2FARequest is the body of a 2FA verification
 type Verify2FARequest struct {
-	TempToken string `json:"temp_token"`
-	OTPCode   string `json:"otp_code"`
+	TempToken string `json:"temp_token" validate:"required,uuid"`
+	OTPCode   string `json:"otp_code" validate:"required,max=10"`
 }
 
+// Verify2FA godoc
+// @Summary Verify 2FA code
+// @Description Completes a login that required 2FA with the temp token from /auth/login and the emailed code, returns JWT tokens
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param verifyRequest body Verify2FARequest true "Temp token and verification code"
+// @Success 200 {object} LoginResponse "Login successful"
+// @Failure 400 {object} CodedErrorResponse "Invalid request body or missing fields"
+// @Failure 401 {object} ErrorResponse "Invalid, expired or already used code"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/verify-2fa [post]
 func (h *AuthHandler) Verify2FA(w http.ResponseWriter, r *http.Request) {
 	var req Verify2FARequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid Bad Request")
-		return
-	}
-
-	if req.TempToken == "" || req.OTPCode == "" {
-		respondWithError(w, http.StatusBadRequest, "TempToken and OTPCode are required")
-		return
-	}
-
-	// Validate temp token format (UUID)
-	if req.TempToken == "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid temp token format")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
 	// verify tempToken and otp code
-	ctx := context.Background()
+	ctx := r.Context()
 
 	//get the OTP record
-	storedOTP, err := h.get2FAOTP(ctx, req.TempToken)
+	storedOTP, err := h.twoFactorCodes.GetTwoFactorCode(ctx, req.TempToken)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid or expired verification code")
 		return
@@ -873,37 +792,51 @@ func (h *AuthHandler) Verify2FA(w http.ResponseWriter, r *http.Request) {
 
 	// Check if OTP is expired
 	if h.otpService.IsOTPExpired(storedOTP.ExpiresAt) {
+		h.recordLogin(r, storedOTP.UserID, "", models.LoginMethodPassword, true, models.LoginFailureExpired2FA)
 		respondWithError(w, http.StatusUnauthorized, "Verification code has expired")
 		return
 	}
 
 	// Vaildate OTP code
-	if h.otpService.ValidateOTP(req.OTPCode, storedOTP.OTPHash, storedOTP.ExpiresAt) {
+	if !h.otpService.ValidateOTP(req.OTPCode, storedOTP.OTPHash, storedOTP.ExpiresAt) {
+		h.recordLogin(r, storedOTP.UserID, "", models.LoginMethodPassword, true, models.LoginFailureInvalid2FA)
 		respondWithError(w, http.StatusUnauthorized, "Invalid verification code")
 		return
 	}
 
-	// Marks OTP as used
-	if err := h.mark2FAOTPUsed(ctx, storedOTP.ID); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to mark OTP as used")
-		return
-	}
-
-	userRepo := repositories.NewUserRepository(h.db)
-	user, err := userRepo.GetByIDCompat(storedOTP.UserID)
+	user, err := h.userRepo.GetByID(ctx, storedOTP.UserID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
 		return
 	}
 
-	tokens, err := h.authService.CreateSessionForUser(user, getClientIP(r), r.UserAgent())
+	// Mark the OTP used and create the session in one transaction, so a code
+	// is neither spent without a session nor usable twice
+	var tokens *models.TokenPair
+	err = h.inTransaction(ctx, func(ctx context.Context) error {
+		if err := h.twoFactorCodes.MarkTwoFactorCodeUsed(ctx, storedOTP.ID); err != nil {
+			return err
+		}
+		created, err := h.authService.CreateSessionForUser(ctx, user, clientip.FromRequest(r), r.UserAgent())
+		if err != nil {
+			return err
+		}
+		tokens = created
+		return nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired verification code")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create user session")
 		return
 	}
 
-	// Publish login event to Kafka
-	go h.publishLoginEvent(user, getClientIP(r), r.UserAgent())
+	h.recordLogin(r, user.ID, user.Email, models.LoginMethodPassword, true, "")
+
+	// Record login event for Kafka (relayed from the events outbox)
+	h.publishLoginEvent(r.Context(), user, clientip.FromRequest(r), r.UserAgent())
 
 	// Return response
 	respondWithJSON(w, http.StatusOK, LoginResponse{
@@ -913,72 +846,39 @@ func (h *AuthHandler) Verify2FA(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// publishLoginEvent publishes a user login event to Kafka
-func (h *AuthHandler) publishLoginEvent(user *models.User, ipAddress, userAgent string) {
-	// Skip if Kafka producer is not available
-	if h.producer == nil {
-		println("Kafka producer not available, skipping event publish")
-		return
-	}
-
-	event := map[string]interface{}{
-		"event_id":     uuid.MustNewUUID(),
-		"user_id":      user.ID,
-		"email":        user.Email,
-		"role":         user.Role,
-		"region":       user.Region,
-		"team":         user.Team,
-		"ip_address":   ipAddress,
-		"user_agent":   userAgent,
-		"logged_in_at": time.Now().Unix(),
-	}
-
-	ctx := context.Background() // or pass the request/context from handler
-
-	if err := h.producer.PublishJSON(ctx, "users.logged_in", event); err != nil {
-		// Log error but don't fail the login process
-		// In production, use a proper logger
-		fmt.Println("Failed to publish login event:", err.Error())
-	}
-
+// publishLoginEvent records a user login event in the events outbox
+// Failures are logged and never fail the login
+func (h *AuthHandler) publishLoginEvent(ctx context.Context, user *models.User, ipAddress, userAgent string) {
+	recordEvent(ctx, h.eventOutbox, events.NewUserLoggedIn(userSession(user, ipAddress, userAgent)))
 }
 
-// publishLogoutEvent publishes a user logout event to Kafka
-func (h *AuthHandler) publishLogoutEvent(user *models.User, ipAddress, userAgent string) {
-	// Skip if Kafka producer is not available
-	if h.producer == nil {
-		println("Kafka producer not available, skipping event publish")
-		return
-	}
-
-	event := map[string]interface{}{
-		"event_id":      uuid.MustNewUUID(),
-		"user_id":       user.ID,
-		"email":         user.Email,
-		"role":          user.Role,
-		"region":        user.Region,
-		"team":          user.Team,
-		"ip_address":    ipAddress,
-		"user_agent":    userAgent,
-		"logged_out_at": time.Now().Unix(),
-	}
-	ctx := context.Background() // or pass the request/context from handler
+// publishLogoutEvent records a user logout event in the events outbox
+// Failures are logged and never fail the logout
+func (h *AuthHandler) publishLogoutEvent(ctx context.Context, user *models.User, ipAddress, userAgent string) {
+	recordEvent(ctx, h.eventOutbox, events.NewUserLoggedOut(userSession(user, ipAddress, userAgent)))
+}
 
-	if err := h.producer.PublishJSON(ctx, "users.logged_out", event); err != nil {
-		// Log error but don't fail the logout process
-		// In production, you'd use a proper logger
-		println("Failed to publish logout event:", err.Error())
+// userSession builds the payload shared by login and logout events
+func userSession(user *models.User, ipAddress, userAgent string) events.UserSession {
+	return events.UserSession{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      string(user.Role),
+		Region:    user.Region,
+		Team:      user.Team,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
 	}
 }
 
 type InviteUserRequest struct {
-	Email       string   `json:"email"`
-	Name        string   `json:"name"`
-	Password    string   `json:"password"`
-	Role        string   `json:"role"`
-	Region      string   `json:"region"`
-	Team        string   `json:"team"`
-	Permissions []string `json:"permissions"`
+	Email       string   `json:"email" validate:"required,email,max=254"`
+	Name        string   `json:"name" validate:"required,max=200"`
+	Password    string   `json:"password" validate:"max=256"`
+	Role        string   `json:"role" validate:"required,oneof=admin manager hunting farming genops sales_rep"`
+	Region      string   `json:"region" validate:"max=64"`
+	Team        string   `json:"team" validate:"max=64"`
+	Permissions []string `json:"permissions" validate:"max=200,dive,required,max=100"`
 }
 
 // @Security BearerAuth
@@ -992,25 +892,24 @@ func (h *AuthHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var req InviteUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-
-	// Validate required fields
-	if req.Email == "" {
-		respondWithError(w, http.StatusBadRequest, "Email is required")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	if req.Name == "" {
-		respondWithError(w, http.StatusBadRequest, "Name is required")
-		return
+	// Region and team are optional but must name active reference entries
+	if req.Region != "" {
+		region, ok := resolveReferenceCode(w, r, h.referenceData, models.ReferenceKindRegions, req.Region)
+		if !ok {
+			return
+		}
+		req.Region = region
 	}
-
-	if req.Role == "" {
-		respondWithError(w, http.StatusBadRequest, "Role is required")
-		return
+	if req.Team != "" {
+		team, ok := resolveReferenceCode(w, r, h.referenceData, models.ReferenceKindTeams, req.Team)
+		if !ok {
+			return
+		}
+		req.Team = team
 	}
 
 	// // Check if user with email already exists
@@ -1023,7 +922,7 @@ func (h *AuthHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	newUUID := uuid.MustNewUUID()
 
 	// Create new user (inactive by default, pending activation)
-	newUser := &models.MongoUser{
+	newUser := &models.User{
 		ID:           newUUID,
 		Email:        req.Email,
 		PasswordHash: req.Password,
@@ -1038,12 +937,12 @@ func (h *AuthHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call repository
-	if err := h.authService.CreateForHandler(newUser); err != nil {
+	if err := h.authService.CreateForHandler(r.Context(), newUser); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create user invitation")
 		return
 	}
 	// Convert to safe user profile
-	profile := newUser.ToProfile1()
+	profile := newUser.ToProfile()
 
 	respondWithJSON(w, http.StatusCreated, profile)
 }
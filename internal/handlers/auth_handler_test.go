@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/sms"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// authFixture is an AuthHandler over in-memory stores, routed as
+// RegisterRoutes routes the sign-in endpoints
+type authFixture struct {
+	*testServer
+	users     *memory.UserStore
+	settings  *memory.SettingsStore
+	emails    *memory.EmailStore
+	codes     *memory.TwoFactorCodeStore
+	outbox    *memory.EventOutbox
+	passwords *password.Hasher
+	handler   *AuthHandler
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	passwords, err := password.New(password.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &authFixture{
+		testServer: newTestServer(t),
+		users:      memory.NewUserStore(),
+		emails:     memory.NewEmailStore(),
+		codes:      memory.NewTwoFactorCodeStore(),
+		outbox:     memory.NewEventOutbox(),
+		passwords:  passwords,
+	}
+	f.settings = memory.NewSettingsStore(f.users)
+	cfg := &config.Config{}
+	cfg.Email.FromEmail = "noreply@example.test"
+	f.handler = NewAuthHandlerWithStores(AuthStores{
+		Users:          f.users,
+		Sessions:       f.users,
+		PasswordResets: f.users,
+		Settings:       f.settings,
+		Emails:         f.emails,
+		Impersonations: memory.NewImpersonationStore(),
+		TwoFactorCodes: f.codes,
+		Events:         f.outbox,
+	}, cfg, nil, email.NewLogSender(cfg.Email.FromEmail), f.jwt)
+	f.handler.SetPasswordHasher(passwords)
+	f.handlePublic(http.MethodPost, "/api/v1/auth/login", f.handler.Login)
+	f.handlePublic(http.MethodPost, "/api/v1/auth/verify-2fa", f.handler.Verify2FA)
+	return f
+}
+
+// addUser adds an active user signing in with secret
+func (f *authFixture) addUser(emailAddress, secret string) *models.User {
+	f.t.Helper()
+	hash, err := f.passwords.Hash(secret)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return f.users.Add(&models.User{
+		Email:        emailAddress,
+		Name:         "Dana Reyes",
+		PasswordHash: hash,
+		Role:         models.UserRoleSalesRep,
+		IsActive:     true,
+		Status:       "active",
+	})
+}
+
+// login signs in and decodes the response
+func (f *authFixture) login(emailAddress, secret string) (int, LoginResponse) {
+	f.t.Helper()
+	rec := f.do(nil, http.MethodPost, "/api/v1/auth/login", LoginRequest{Email: emailAddress, Password: secret})
+	var body LoginResponse
+	if rec.Code == http.StatusOK {
+		decodeBody(f.t, rec, &body)
+	}
+	return rec.Code, body
+}
+
+// sentEmail returns the last email stored for to
+func (f *authFixture) sentEmail(to string) *models.MongoCommunication {
+	f.t.Helper()
+	var last *models.MongoCommunication
+	for _, msg := range f.emails.Messages() {
+		if msg.To == to && (last == nil || !msg.CreatedAt.Before(last.CreatedAt)) {
+			last = msg
+		}
+	}
+	if last == nil {
+		f.t.Fatalf("no email was sent to %s", to)
+	}
+	return last
+}
+
+var otpPattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// emailedCode returns the 2FA code in the last email sent to to
+func (f *authFixture) emailedCode(to string) string {
+	f.t.Helper()
+	msg := f.sentEmail(to)
+	code := otpPattern.FindString(msg.Body + " " + msg.BodyHTML)
+	if code == "" {
+		f.t.Fatalf("no code in the email to %s: %q", to, msg.Body)
+	}
+	return code
+}
+
+// tokensOf decodes the tokens of a completed sign-in
+func tokensOf(t *testing.T, body LoginResponse) models.TokenPair {
+	t.Helper()
+	tokens, ok := body.Tokens.(map[string]interface{})
+	if !ok {
+		t.Fatalf("tokens = %#v", body.Tokens)
+	}
+	access, _ := tokens["access_token"].(string)
+	refresh, _ := tokens["refresh_token"].(string)
+	if access == "" || refresh == "" {
+		t.Fatalf("tokens = %#v, want an access and a refresh token", tokens)
+	}
+	return models.TokenPair{AccessToken: access, RefreshToken: refresh}
+}
+
+func TestLoginWithoutTwoFactor(t *testing.T) {
+	f := newAuthFixture(t)
+	user := f.addUser("dana@example.test", "correct horse")
+
+	status, body := f.login(user.Email, "correct horse")
+	if status != http.StatusOK || body.Requires2FA {
+		t.Fatalf("login = %d requires 2FA %v, want 200 with tokens", status, body.Requires2FA)
+	}
+	tokens := tokensOf(t, body)
+	claims, err := f.jwt.ValidateAccessToken(tokens.AccessToken)
+	if err != nil || claims.UserID != user.ID {
+		t.Errorf("access token claims = %+v, %v; want user %s", claims, err, user.ID)
+	}
+	if got := f.outbox.EventTypes(); len(got) != 1 || got[0] != events.TypeUserLoggedIn {
+		t.Errorf("events = %v, want one %s", got, events.TypeUserLoggedIn)
+	}
+
+	if status, _ := f.login(user.Email, "wrong horse"); status != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password = %d, want 401", status)
+	}
+	if status, _ := f.login("nobody@example.test", "correct horse"); status != http.StatusUnauthorized {
+		t.Errorf("login with an unknown email = %d, want 401", status)
+	}
+}
+
+// TestLoginWithTwoFactor signs in with 2FA enabled: the password alone
+// returns a temp token, and the emailed code exchanges it for tokens once
+func TestLoginWithTwoFactor(t *testing.T) {
+	f := newAuthFixture(t)
+	user := f.addUser("dana@example.test", "correct horse")
+	f.settings.SetSecuritySettings(models.SettingsUserSecuritySettings{UserID: user.ID, TwoFactorEnabled: true})
+
+	status, body := f.login(user.Email, "correct horse")
+	if status != http.StatusOK || !body.Requires2FA || body.TempToken == "" {
+		t.Fatalf("login = %d %+v, want a 2FA challenge", status, body)
+	}
+	if body.Tokens != nil {
+		t.Fatalf("a 2FA challenge returned tokens %v", body.Tokens)
+	}
+	if body.Channel != models.TwoFactorMethodEmail {
+		t.Errorf("channel = %q, want email", body.Channel)
+	}
+	if got := f.outbox.EventTypes(); len(got) != 0 {
+		t.Errorf("events before verification = %v, want none", got)
+	}
+	code := f.emailedCode(user.Email)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	rec := f.do(nil, http.MethodPost, "/api/v1/auth/verify-2fa", Verify2FARequest{TempToken: body.TempToken, OTPCode: wrong})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("verify with a wrong code = %d, want 401", rec.Code)
+	}
+
+	rec = f.do(nil, http.MethodPost, "/api/v1/auth/verify-2fa", Verify2FARequest{TempToken: body.TempToken, OTPCode: code})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify = %d %s", rec.Code, rec.Body)
+	}
+	var verified LoginResponse
+	decodeBody(t, rec, &verified)
+	tokens := tokensOf(t, verified)
+	if _, err := f.users.GetByRefreshToken(t.Context(), tokens.RefreshToken); err != nil {
+		t.Errorf("the session of the refresh token was not stored: %v", err)
+	}
+	if got := f.outbox.EventTypes(); len(got) != 1 || got[0] != events.TypeUserLoggedIn {
+		t.Errorf("events = %v, want one %s", got, events.TypeUserLoggedIn)
+	}
+
+	// A code signs in once
+	rec = f.do(nil, http.MethodPost, "/api/v1/auth/verify-2fa", Verify2FARequest{TempToken: body.TempToken, OTPCode: code})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("verify with a used code = %d, want 401", rec.Code)
+	}
+}
+
+func TestVerifyTwoFactorRejectsExpiredCodes(t *testing.T) {
+	f := newAuthFixture(t)
+	user := f.addUser("dana@example.test", "correct horse")
+	hash, err := services.NewOTPService().HashOTP("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempToken := uuid.MustNewUUID()
+	if err := f.codes.CreateTwoFactorCode(t.Context(), &models.TwoFAOTP{
+		ID:        uuid.MustNewUUID(),
+		UserID:    user.ID,
+		TempToken: tempToken,
+		OTPHash:   hash,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := f.do(nil, http.MethodPost, "/api/v1/auth/verify-2fa", Verify2FARequest{TempToken: tempToken, OTPCode: "123456"})
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "expired") {
+		t.Errorf("verify with an expired code = %d %s, want 401 expired", rec.Code, rec.Body)
+	}
+}
+
+// TestLoginValidatesTheBody checks malformed sign-ins are refused with the
+// offending fields before any credentials are checked
+func TestLoginValidatesTheBody(t *testing.T) {
+	f := newAuthFixture(t)
+	f.addUser("dana@example.com", "Correct-Horse-9")
+
+	for _, tt := range []struct {
+		name string
+		body interface{}
+		want map[string]string
+	}{
+		{"empty", LoginRequest{}, map[string]string{"email": "is required", "password": "is required"}},
+		{"blank email", LoginRequest{Email: "  ", Password: "Correct-Horse-9"}, map[string]string{"email": "is required"}},
+		{"long email", LoginRequest{Email: strings.Repeat("a", 250) + "@example.com", Password: "x"}, map[string]string{"email": "must be at most 254 characters"}},
+		{"long password", LoginRequest{Email: "dana@example.com", Password: strings.Repeat("x", 257)}, map[string]string{"password": "must be at most 256 characters"}},
+	} {
+		detail := errorDetail(t, f.do(nil, http.MethodPost, "/api/v1/auth/login", tt.body), http.StatusBadRequest)
+		if detail.Code != "VALIDATION_FAILED" || !maps.Equal(detail.Fields, tt.want) {
+			t.Errorf("%s: error = %+v, want fields %v", tt.name, detail, tt.want)
+		}
+	}
+
+	// A typo in a field name is an error, not a missing field
+	rec := f.do(nil, http.MethodPost, "/api/v1/auth/login", `{"email":"dana@example.com","passwrod":"Correct-Horse-9"}`)
+	if detail := errorDetail(t, rec, http.StatusBadRequest); detail.Code != "UNKNOWN_FIELD" {
+		t.Errorf("misspelt field = %+v, want UNKNOWN_FIELD", detail)
+	}
+	if status, _ := f.login("dana@example.com", "Correct-Horse-9"); status != http.StatusOK {
+		t.Errorf("valid login = %d", status)
+	}
+}
+
+// stalledSMS never delivers a text, returning only when the send times out
+type stalledSMS struct{}
+
+func (stalledSMS) SendSMS(ctx context.Context, to, body string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (stalledSMS) Name() string { return "stalled" }
+
+// emailsTo counts the emails stored for to
+func (f *authFixture) emailsTo(to string) int {
+	n := 0
+	for _, msg := range f.emails.Messages() {
+		if msg.To == to {
+			n++
+		}
+	}
+	return n
+}
+
+// TestTwoFactorCodesFollowTheUsersChannel signs in users who chose email
+// and SMS for their 2FA codes, and checks each code arrives, and only
+// arrives, through the user's channel
+func TestTwoFactorCodesFollowTheUsersChannel(t *testing.T) {
+	f := newAuthFixture(t)
+	texts := sms.NewMemorySender()
+	f.handler.SetSMSCodes(services.NewSMSCodes(texts, "Acme CRM", time.Second, false))
+	byEmail := f.addUser("email@example.test", "correct horse")
+	bySMS := f.addUser("sms@example.test", "correct horse")
+	unverified := f.addUser("unverified@example.test", "correct horse")
+	f.settings.SetSecuritySettings(models.SettingsUserSecuritySettings{UserID: byEmail.ID, TwoFactorEnabled: true, TwoFactorMethod: models.TwoFactorMethodEmail, PhoneNumber: "+14155550100"})
+	f.settings.SetSecuritySettings(models.SettingsUserSecuritySettings{UserID: bySMS.ID, TwoFactorEnabled: true, TwoFactorMethod: models.TwoFactorMethodSMS, PhoneNumber: "+14155550123"})
+	// SMS chosen, but no phone number verified
+	f.settings.SetSecuritySettings(models.SettingsUserSecuritySettings{UserID: unverified.ID, TwoFactorEnabled: true, TwoFactorMethod: models.TwoFactorMethodSMS})
+
+	for _, user := range []*models.User{byEmail, unverified} {
+		status, body := f.login(user.Email, "correct horse")
+		if status != http.StatusOK || body.Channel != models.TwoFactorMethodEmail {
+			t.Errorf("login of %s = %d channel %q, want email", user.Email, status, body.Channel)
+		}
+		f.emailedCode(user.Email)
+	}
+	if sent := texts.Sent(); len(sent) != 0 {
+		t.Fatalf("texts to users with email codes: %+v", sent)
+	}
+
+	status, body := f.login(bySMS.Email, "correct horse")
+	if status != http.StatusOK || !body.Requires2FA || body.Channel != models.TwoFactorMethodSMS {
+		t.Fatalf("login by SMS = %d %+v, want an SMS challenge", status, body)
+	}
+	if !strings.Contains(body.Message, "0123") {
+		t.Errorf("message %q does not name the phone's last digits", body.Message)
+	}
+	if n := f.emailsTo(bySMS.Email); n != 0 {
+		t.Errorf("%d emails to a user with SMS codes", n)
+	}
+	sent := texts.Sent()
+	if len(sent) != 1 || sent[0].To != "+14155550123" {
+		t.Fatalf("texts = %+v, want one to the verified number", sent)
+	}
+	// One plain text message
+	if text := sent[0].Body; len(text) > 160 || strings.ContainsAny(text, "<>") || !strings.Contains(text, "Acme CRM") {
+		t.Errorf("text = %q, want a short plain message naming the product", text)
+	}
+	code := otpPattern.FindString(sent[0].Body)
+	rec := f.do(nil, http.MethodPost, "/api/v1/auth/verify-2fa", Verify2FARequest{TempToken: body.TempToken, OTPCode: code})
+	if rec.Code != http.StatusOK {
+		t.Errorf("verify the texted code = %d %s", rec.Code, rec.Body)
+	}
+}
+
+// TestTwoFactorSMSFailures checks a text that cannot be sent in time is
+// emailed instead when the fallback is on, and a number texted too often
+// is refused
+func TestTwoFactorSMSFailures(t *testing.T) {
+	f := newAuthFixture(t)
+	user := f.addUser("sms@example.test", "correct horse")
+	f.settings.SetSecuritySettings(models.SettingsUserSecuritySettings{UserID: user.ID, TwoFactorEnabled: true, TwoFactorMethod: models.TwoFactorMethodSMS, PhoneNumber: "+14155550123"})
+
+	// A provider that hangs is given up on quickly
+	f.handler.SetSMSCodes(services.NewSMSCodes(stalledSMS{}, "Acme CRM", 50*time.Millisecond, true))
+	start := time.Now()
+	status, body := f.login(user.Email, "correct horse")
+	if status != http.StatusOK || body.Channel != models.TwoFactorMethodEmail {
+		t.Fatalf("login with a stalled provider = %d %+v, want the code emailed", status, body)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("login took %v waiting for the provider", elapsed)
+	}
+	f.emailedCode(user.Email)
+
+	// Without the fallback the user is told to check their phone all the same
+	texts := sms.NewMemorySender()
+	texts.FailWith(errors.New("provider down"))
+	f.handler.SetSMSCodes(services.NewSMSCodes(texts, "Acme CRM", time.Second, false))
+	emailed := f.emailsTo(user.Email)
+	if status, body := f.login(user.Email, "correct horse"); status != http.StatusOK || body.Channel != models.TwoFactorMethodSMS {
+		t.Errorf("login with a failing provider = %d %+v, want the sms channel", status, body)
+	}
+	if f.emailsTo(user.Email) != emailed {
+		t.Error("the code was emailed without the fallback")
+	}
+
+	// Five codes an hour per number, the failed one included
+	texts.FailWith(nil)
+	for i := 0; i < 4; i++ {
+		if status, _ := f.login(user.Email, "correct horse"); status != http.StatusOK {
+			t.Fatalf("login %d = %d", i+2, status)
+		}
+	}
+	rec := f.do(nil, http.MethodPost, "/api/v1/auth/login", LoginRequest{Email: user.Email, Password: "correct horse"})
+	if detail := errorDetail(t, rec, http.StatusTooManyRequests); detail.Code != "SMS_RATE_LIMITED" {
+		t.Errorf("sixth code = %+v, want SMS_RATE_LIMITED", detail)
+	}
+	if n := len(texts.Sent()); n != 4 {
+		t.Errorf("%d texts sent, want 4 before the limit", n)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+)
+
+// SetRBACService resolves the effective permissions returned by GET /auth/me
+func (h *AuthHandler) SetRBACService(rbac *services.RBACService) {
+	h.rbacService = rbac
+}
+
+// MeResponse describes the signed-in principal. The SPA loads it at boot, so
+// fields are only ever added to it.
+type MeResponse struct {
+	User        models.UserProfile `json:"user"`
+	Role        string             `json:"role"`
+	Team        string             `json:"team"`
+	Region      string             `json:"region"`
+	Permissions []string           `json:"permissions"` // Role permissions merged with the user's own grants
+	DataScope   models.DataScope   `json:"dataScope"`   // Scope applied to campaigns, templates and sequences
+	Session     MeSession          `json:"session"`
+}
+
+// MeSession describes the access token the request was made with
+type MeSession struct {
+	ExpiresAt     *time.Time         `json:"expiresAt,omitempty"`
+	Impersonating bool               `json:"impersonating"`           // Show the impersonation banner
+	Impersonation *ImpersonationInfo `json:"impersonation,omitempty"` // Set while impersonating
+}
+
+// ImpersonationInfo identifies the real operator behind an impersonation token
+type ImpersonationInfo struct {
+	SessionID  string    `json:"sessionId"`
+	ActorID    string    `json:"actorId"`
+	ActorEmail string    `json:"actorEmail"`
+	ActorName  string    `json:"actorName"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Me godoc
+// @Summary Get the signed-in principal
+// @Description Returns the user the access token is for with their role, team, region, effective permissions and data scope, and when the token expires. With an impersonation token, session.impersonating is true and session.impersonation identifies the real operator.
+// @Tags Authentication
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MeResponse
+// @Failure 401 {object} ErrorResponse "Not authenticated"
+// @Router /auth/me [get]
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := h.userRepo.GetByID(ctx, middleware.GetUserID(r))
+	if err != nil {
+		if repositories.IsUserNotFound(err) {
+			respondWithError(w, http.StatusUnauthorized, "User not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user: "+err.Error())
+		return
+	}
+
+	permissions := middleware.GetUserPermissions(r)
+	if h.rbacService != nil {
+		effective, err := h.rbacService.EffectivePermissions(ctx, user)
+		if err != nil {
+			log.Printf("Auth: failed to resolve permissions for user %s: %v", user.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load permissions")
+			return
+		}
+		permissions = effective.Permissions
+	}
+
+	response := MeResponse{
+		User:        user.ToProfile(),
+		Role:        string(user.Role),
+		Team:        user.Team,
+		Region:      user.Region,
+		Permissions: permissions,
+		DataScope:   requestDataScope(r),
+	}
+	if expiresAt, ok := middleware.GetTokenExpiresAt(r); ok {
+		response.Session.ExpiresAt = &expiresAt
+	}
+	if impersonator, ok := middleware.GetImpersonator(r); ok {
+		response.Session.Impersonating = true
+		response.Session.Impersonation = &ImpersonationInfo{
+			SessionID:  impersonator.SessionID,
+			ActorID:    impersonator.UserID,
+			ActorEmail: impersonator.Email,
+			ActorName:  impersonator.Name,
+		}
+		// The impersonation guard has already checked the session exists
+		if session, err := h.impersonations.GetImpersonation(ctx, impersonator.SessionID); err == nil {
+			response.Session.Impersonation.ExpiresAt = session.ExpiresAt
+		}
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
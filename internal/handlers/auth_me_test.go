@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// TestMeShape pins the JSON the SPA loads at boot: fields may be added to it
+// but not renamed or moved
+func TestMeShape(t *testing.T) {
+	f := newAuthFixture(t)
+	f.handle(http.MethodGet, "/api/v1/auth/me", f.handler.Me)
+	user := f.addUser("dana@example.com", "Correct-Horse-9")
+	user.Team, user.Region = "alpha", "north"
+	user.Permissions = []string{models.PermTeamMembersView, models.PermTemplatesApprove}
+	f.users.Add(user)
+
+	scope := models.DataScope{Customers: models.DataScopeOwn, Campaigns: models.DataScopeTeam, Users: models.DataScopeTeam}
+	ctx := context.WithValue(context.Background(), middleware.DataScopeKey, scope)
+	before := time.Now()
+	rec := f.doContext(ctx, user, http.MethodGet, "/api/v1/auth/me", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /auth/me = %d %s", rec.Code, rec.Body)
+	}
+
+	var shape map[string]json.RawMessage
+	decodeBody(t, rec, &shape)
+	keys := func(m map[string]json.RawMessage) []string {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	if got, want := keys(shape), []string{"dataScope", "permissions", "region", "role", "session", "team", "user"}; !slices.Equal(got, want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+	var session map[string]json.RawMessage
+	if err := json.Unmarshal(shape["session"], &session); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(session), []string{"expiresAt", "impersonating"}; !slices.Equal(got, want) {
+		t.Errorf("session fields = %v, want %v", got, want)
+	}
+	if got, want := string(shape["dataScope"]), `{"customers":"own","campaigns":"team","users":"team"}`; got != want {
+		t.Errorf("dataScope = %s, want %s", got, want)
+	}
+
+	var me MeResponse
+	decodeBody(t, rec, &me)
+	if me.User.ID != user.ID || me.User.Email != user.Email {
+		t.Errorf("user = %+v, want %s", me.User, user.Email)
+	}
+	if me.Role != string(models.UserRoleSalesRep) || me.Team != "alpha" || me.Region != "north" {
+		t.Errorf("role, team, region = %q, %q, %q", me.Role, me.Team, me.Region)
+	}
+	if !slices.Equal(me.Permissions, user.Permissions) {
+		t.Errorf("permissions = %v, want %v", me.Permissions, user.Permissions)
+	}
+	if me.Session.ExpiresAt == nil || !me.Session.ExpiresAt.After(before) || me.Session.Impersonating {
+		t.Errorf("session = %+v, want the access token expiry and no impersonation", me.Session)
+	}
+}
+
+func TestMeWithoutAUser(t *testing.T) {
+	f := newAuthFixture(t)
+	f.handle(http.MethodGet, "/api/v1/auth/me", f.handler.Me)
+	if rec := f.do(nil, http.MethodGet, "/api/v1/auth/me", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET /auth/me = %d, want 401", rec.Code)
+	}
+	// A token of a user who has since been deleted
+	gone := &models.User{ID: uuid.MustNewUUID(), Email: "gone@example.com", Role: models.UserRoleSalesRep}
+	if rec := f.do(gone, http.MethodGet, "/api/v1/auth/me", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /auth/me of a deleted user = %d, want 401", rec.Code)
+	}
+}
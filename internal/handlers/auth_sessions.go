@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+)
+
+// SessionListResponse lists the caller's sessions
+type SessionListResponse struct {
+	Sessions           []models.SessionInfo `json:"sessions"`
+	IdleTimeoutMinutes int                  `json:"idleTimeoutMinutes"` // The caller's session timeout
+}
+
+// ListSessions godoc
+// @Summary List my sessions
+// @Description Lists the caller's signed-in sessions, newest first, with when each was last used, when it times out unless used again and its absolute expiry. Sessions that timed out after inactivity, expired or were signed out are not listed. Activity is recorded at most once a minute.
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} SessionListResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /auth/sessions [get]
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	sessions, idle, err := h.sessions.List(r.Context(), userID, middleware.GetSessionID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve sessions: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, SessionListResponse{
+		Sessions:           sessions,
+		IdleTimeoutMinutes: int(idle / time.Minute),
+	})
+}
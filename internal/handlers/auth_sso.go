@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/clientip"
+)
+
+// =====================================================
+// Single Sign-On (OpenID Connect)
+// =====================================================
+
+// SetSSOService enables SSO sign-in. With SSO enabled in the system security
+// settings it also enforces the password sign-in restriction on Login.
+func (h *AuthHandler) SetSSOService(sso *services.SSOService) {
+	h.ssoService = sso
+	if sso != nil {
+		h.authService.SetLoginPolicy(sso.PasswordLoginPolicy)
+	}
+}
+
+// SSOLogin godoc
+// @Summary Start SSO sign-in
+// @Description Redirects to the OpenID Connect provider. The state and nonce of the sign-in are kept server-side and expire after OIDC_STATE_TTL.
+// @Tags Authentication
+// @Success 302 "Redirect to the identity provider"
+// @Failure 403 {object} CodedErrorResponse "SSO is disabled"
+// @Failure 503 {object} CodedErrorResponse "SSO is not configured"
+// @Router /auth/sso/login [get]
+func (h *AuthHandler) SSOLogin(w http.ResponseWriter, r *http.Request) {
+	if h.ssoService == nil {
+		respondWithErrorCode(w, http.StatusServiceUnavailable, "SSO_NOT_CONFIGURED", "SSO is not configured")
+		return
+	}
+
+	redirectURL, err := h.ssoService.Start(r.Context())
+	if err != nil {
+		if errors.Is(err, services.ErrSSODisabled) {
+			respondWithErrorCode(w, http.StatusForbidden, "SSO_DISABLED", "SSO sign-in is disabled")
+			return
+		}
+		log.Printf("SSO: failed to start sign-in: %v", err)
+		respondWithError(w, http.StatusBadGateway, "Failed to start SSO sign-in")
+		return
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// SSOCallback godoc
+// @Summary Complete SSO sign-in
+// @Description Callback of the OpenID Connect provider. Exchanges the code, validates the ID token and signs in the user with the verified email, provisioning them when just-in-time provisioning is allowed. Returns the same response as a password login.
+// @Tags Authentication
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State issued by /auth/sso/login"
+// @Success 200 {object} LoginResponse "Login successful"
+// @Failure 400 {object} CodedErrorResponse "Invalid, expired or reused state, or the provider returned an error"
+// @Failure 401 {object} CodedErrorResponse "ID token could not be verified or email not verified"
+// @Failure 403 {object} CodedErrorResponse "SSO disabled, no account for the email or account inactive"
+// @Failure 503 {object} CodedErrorResponse "SSO is not configured"
+// @Router /auth/sso/callback [get]
+func (h *AuthHandler) SSOCallback(w http.ResponseWriter, r *http.Request) {
+	if h.ssoService == nil {
+		respondWithErrorCode(w, http.StatusServiceUnavailable, "SSO_NOT_CONFIGURED", "SSO is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		message := providerErr
+		if description := query.Get("error_description"); description != "" {
+			message += ": " + description
+		}
+		respondWithErrorCode(w, http.StatusBadRequest, "SSO_PROVIDER_ERROR", "Identity provider error: "+message)
+		return
+	}
+
+	user, err := h.ssoService.Complete(r.Context(), query.Get("code"), query.Get("state"))
+	if err != nil {
+		status, code, message := ssoErrorResponse(err)
+		if status == http.StatusInternalServerError || status == http.StatusUnauthorized {
+			log.Printf("SSO: sign-in failed: %v", err)
+		}
+		if h.auditPublisher != nil && status != http.StatusInternalServerError {
+			h.auditPublisher.PublishAuthEvent(r, "", "", "", events.ActionLoginFailed, false, fmt.Sprintf("SSO login failed: %v", err))
+		}
+		respondWithErrorCode(w, status, code, message)
+		return
+	}
+
+	tokens, err := h.authService.CreateSessionForUser(r.Context(), user, clientip.FromRequest(r), r.UserAgent())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user session")
+		return
+	}
+	h.recordLogin(r, user.ID, user.Email, models.LoginMethodSSO, false, "")
+
+	// Record login event for Kafka (relayed from the events outbox)
+	h.publishLoginEvent(r.Context(), user, clientip.FromRequest(r), r.UserAgent())
+
+	if h.auditPublisher != nil {
+		h.auditPublisher.PublishAuthEvent(r, user.ID, user.Name, user.Email, events.ActionLogin, true, "User logged in with SSO")
+	}
+
+	respondWithJSON(w, http.StatusOK, LoginResponse{
+		User:   user.ToProfile(),
+		Tokens: tokens,
+	})
+}
+
+// ssoErrorResponse maps an SSO sign-in error to its response
+func ssoErrorResponse(err error) (status int, code, message string) {
+	switch {
+	case errors.Is(err, services.ErrSSODisabled):
+		return http.StatusForbidden, "SSO_DISABLED", "SSO sign-in is disabled"
+	case errors.Is(err, services.ErrSSOInvalidState):
+		return http.StatusBadRequest, "SSO_INVALID_STATE", "SSO sign-in expired or was already used, please try again"
+	case errors.Is(err, services.ErrSSOEmailNotVerified):
+		return http.StatusUnauthorized, "SSO_EMAIL_NOT_VERIFIED", "Your identity provider has not verified your email address"
+	case errors.Is(err, services.ErrSSOInvalidToken):
+		return http.StatusUnauthorized, "SSO_INVALID_TOKEN", "SSO sign-in could not be verified"
+	case errors.Is(err, services.ErrSSONoAccount):
+		return http.StatusForbidden, "SSO_NO_ACCOUNT", "No account exists for this email address"
+	case errors.Is(err, services.ErrSSOAccountInactive):
+		return http.StatusForbidden, "ACCOUNT_INACTIVE", "Your account is inactive"
+	default:
+		return http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to complete SSO sign-in"
+	}
+}
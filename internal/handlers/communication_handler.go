@@ -0,0 +1,677 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// maxScheduleAhead bounds how far ahead a message can be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// CommunicationHandler handles a user's email inbox, search, thread and send
+// endpoints
+type CommunicationHandler struct {
+	emailRepo    repositories.MailboxStore
+	emailSender  email.EmailSender
+	settingsRepo repositories.SettingsStore
+	sendWindow   *services.SendWindowEnforcer // nil sends at any time of day
+	signatures   *services.EmailSignatures    // nil without settings
+
+	listRepo          repositories.DistributionListStore // nil without distribution lists
+	distributionLists *services.DistributionLists
+	userRepo          repositories.UserStore
+}
+
+// NewCommunicationHandler creates a new CommunicationHandler
+// settingsRepo can be nil - sent messages are then neither tracked nor signed
+func NewCommunicationHandler(emailRepo repositories.MailboxStore, emailSender email.EmailSender, settingsRepo repositories.SettingsStore) *CommunicationHandler {
+	h := &CommunicationHandler{
+		emailRepo:    emailRepo,
+		emailSender:  emailSender,
+		settingsRepo: settingsRepo,
+	}
+	if settingsRepo != nil {
+		h.signatures = services.NewEmailSignatures(settingsRepo)
+	}
+	return h
+}
+
+// SetSendWindow defers messages sent outside the organization's working
+// hours to the next time the send window opens
+func (h *CommunicationHandler) SetSendWindow(window *services.SendWindowEnforcer) {
+	h.sendWindow = window
+}
+
+// SetDistributionLists lets messages be sent to a distribution list with
+// list_id; users resolves the caller's data scope for the list
+func (h *CommunicationHandler) SetDistributionLists(repo repositories.DistributionListStore, lists *services.DistributionLists, users repositories.UserStore) {
+	h.listRepo = repo
+	h.distributionLists = lists
+	h.userRepo = users
+}
+
+// GetInbox godoc
+// @Summary List inbox messages
+// @Description Lists the caller's email messages, newest first. Only messages owned by the authenticated user are returned. Pages are read by cursor, or with page for a total.
+// @Tags Communications
+// @Produce json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param page query int false "Page number, for page paging with a total"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Param unread query bool false "Only unread (true) or only read (false) messages"
+// @Param starred query bool false "Only starred (true) or only unstarred (false) messages"
+// @Param direction query string false "inbound or outbound"
+// @Param status query string false "Message status; scheduled lists messages waiting for their send time"
+// @Param from query string false "Sent at or after (RFC 3339)"
+// @Param to query string false "Sent at or before (RFC 3339)"
+// @Success 200 {object} pagination.Envelope[models.CommMessage] "total only with page paging"
+// @Failure 400 {object} ErrorResponse "Invalid filter or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/inbox [get]
+// @Security BearerAuth
+func (h *CommunicationHandler) GetInbox(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filters, err := parseInboxFilters(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filters.Limit = page.FetchLimit()
+	filters.Offset = page.Offset
+	filters.After = page.After
+	messages, err := h.emailRepo.GetCommInbox(r.Context(), userID, filters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve inbox: "+err.Error())
+		return
+	}
+
+	envelope := pagination.NewEnvelope(page, messages, func(message *models.CommMessage) pagination.Cursor {
+		cursor := pagination.Cursor{ID: message.MessageID}
+		if message.SentAt != nil {
+			cursor.SortValue = *message.SentAt
+		}
+		return cursor
+	})
+	if page.PageMode {
+		total, err := h.emailRepo.CountInbox(r.Context(), userID, filters)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve inbox: "+err.Error())
+			return
+		}
+		envelope = envelope.WithTotal(total)
+	}
+
+	respondWithJSON(w, http.StatusOK, envelope)
+}
+
+// GetInboxSummary godoc
+// @Summary Inbox summary
+// @Description Returns the caller's total, unread and starred email message counts
+// @Tags Communications
+// @Produce json
+// @Success 200 {object} repositories.InboxSummary
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/inbox/summary [get]
+// @Security BearerAuth
+func (h *CommunicationHandler) GetInboxSummary(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	summary, err := h.emailRepo.GetInboxSummary(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve inbox summary: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+// MessageSearchResponse is a page of message search results
+type MessageSearchResponse struct {
+	Results    []*repositories.MessageSearchResult `json:"results"`
+	Total      int64                               `json:"total"`
+	Page       int                                 `json:"page"`
+	Limit      int                                 `json:"limit"`
+	TotalPages int                                 `json:"totalPages"`
+}
+
+// SearchMessages godoc
+// @Summary Search messages
+// @Description Full-text search over the caller's messages (subject, body, sender and recipients), best matches first. Each result carries a snippet of the body around the first match with the positions of matched terms.
+// @Tags Communications
+// @Produce json
+// @Param q query string true "Search text (at least 3 characters)"
+// @Param channel query string false "Channel (default email)"
+// @Param from query string false "Sent at or after (RFC 3339)"
+// @Param to query string false "Sent at or before (RFC 3339)"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Success 200 {object} MessageSearchResponse "results, total, page, limit, totalPages"
+// @Failure 400 {object} ErrorResponse "Invalid query, filter or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/search [get]
+// @Security BearerAuth
+func (h *CommunicationHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len([]rune(query)) < repositories.MinSearchQueryLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Search query must be at least %d characters", repositories.MinSearchQueryLength))
+		return
+	}
+
+	page, limit, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+	if page*limit > repositories.MaxSearchResults {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Only the first %d results can be paged through; refine the search", repositories.MaxSearchResults))
+		return
+	}
+	filters, err := parseInboxFilters(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filters.Channel = r.URL.Query().Get("channel")
+	filters.Limit = limit
+	filters.Offset = (page - 1) * limit
+
+	results, total, err := h.emailRepo.SearchMessages(r.Context(), userID, query, filters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to search messages: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, MessageSearchResponse{
+		Results:    results,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: (int(total) + limit - 1) / limit,
+	})
+}
+
+// ThreadListResponse is a page of conversation threads
+type ThreadListResponse struct {
+	Threads    []*repositories.MessageThread `json:"threads"`
+	Total      int64                         `json:"total"`
+	Page       int                           `json:"page"`
+	Limit      int                           `json:"limit"`
+	TotalPages int                           `json:"totalPages"`
+}
+
+// ListThreads godoc
+// @Summary List conversation threads
+// @Description Lists the caller's email threads, most recently active first
+// @Tags Communications
+// @Produce json
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Param archived query bool false "Only archived (true) or only active (false) threads"
+// @Success 200 {object} ThreadListResponse "threads, total, page, limit, totalPages"
+// @Failure 400 {object} ErrorResponse "Invalid filter or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/threads [get]
+// @Security BearerAuth
+func (h *CommunicationHandler) ListThreads(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	page, limit, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+	var archived *bool
+	if archivedStr := r.URL.Query().Get("archived"); archivedStr != "" {
+		b, err := strconv.ParseBool(archivedStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid archived value")
+			return
+		}
+		archived = &b
+	}
+
+	threads, total, err := h.emailRepo.ListThreads(r.Context(), userID, archived, limit, (page-1)*limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve threads: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ThreadListResponse{
+		Threads:    threads,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: (int(total) + limit - 1) / limit,
+	})
+}
+
+// ThreadMessagesResponse is a thread with its messages
+type ThreadMessagesResponse struct {
+	Thread   *repositories.MessageThread `json:"thread"`
+	Messages []*models.CommMessage       `json:"messages"`
+}
+
+// GetThreadMessages godoc
+// @Summary List thread messages
+// @Description Returns the messages of one of the caller's threads in chronological order
+// @Tags Communications
+// @Produce json
+// @Param id path string true "Thread ID"
+// @Success 200 {object} ThreadMessagesResponse "thread, messages"
+// @Failure 400 {object} ErrorResponse "Invalid thread ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Thread not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/threads/{id}/messages [get]
+// @Security BearerAuth
+func (h *CommunicationHandler) GetThreadMessages(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	threadID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid thread ID format")
+		return
+	}
+
+	thread, err := h.emailRepo.GetUserThread(r.Context(), threadID, userID)
+	if err != nil {
+		if repositories.IsCommunicationNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Thread not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve thread: "+err.Error())
+		return
+	}
+
+	messages, err := h.emailRepo.GetCommMessagesByThread(r.Context(), thread.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve thread messages: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ThreadMessagesResponse{
+		Thread:   thread,
+		Messages: messages,
+	})
+}
+
+// UpdateThreadRequest represents the request body for updating a thread
+type UpdateThreadRequest struct {
+	IsArchived *bool `json:"isArchived" validate:"required"`
+}
+
+// UpdateThread godoc
+// @Summary Update a thread
+// @Description Archives or unarchives one of the caller's threads
+// @Tags Communications
+// @Accept json
+// @Produce json
+// @Param id path string true "Thread ID"
+// @Param thread body UpdateThreadRequest true "Thread changes"
+// @Success 200 {object} repositories.MessageThread
+// @Failure 400 {object} CodedErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Thread not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/threads/{id} [patch]
+// @Security BearerAuth
+func (h *CommunicationHandler) UpdateThread(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	threadID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid thread ID format")
+		return
+	}
+
+	var req UpdateThreadRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	thread, err := h.emailRepo.SetThreadArchived(r.Context(), threadID, userID, *req.IsArchived)
+	if err != nil {
+		if repositories.IsCommunicationNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Thread not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to update thread: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, thread)
+}
+
+// SendMessage godoc
+// @Summary Send an email
+// @Description Sends an email from the caller, now or at scheduled_at, with the caller's email signature appended while it is enabled. A scheduled message is stored with status scheduled until the outbox worker sends it and can be cancelled until then. scheduled_at is RFC 3339 with an offset, or a local time (2006-01-02T15:04) in the IANA timezone; it is stored in UTC and may be at most a year ahead. A message sent now outside the organization's send window (GET /settings/send-window) is scheduled for the window's next opening instead, as is a scheduled message that comes due outside it. With list_id the message also goes to the members of a distribution list as BCC recipients, resolved when it is sent; to then defaults to the caller.
+// @Tags Communications
+// @Accept json
+// @Produce json
+// @Param message body models.SendMessageRequest true "Message"
+// @Success 201 {object} models.CommMessage "Sent"
+// @Success 202 {object} models.CommMessage "Scheduled, deferred to the send window, or queued for retry after a failed send"
+// @Failure 400 {object} CodedErrorResponse "Invalid request or send time, or the list has no recipients"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Distribution list out of scope"
+// @Failure 404 {object} ErrorResponse "Thread or distribution list not found"
+// @Failure 409 {object} CodedErrorResponse "Distribution list archived"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/messages [post]
+// @Security BearerAuth
+func (h *CommunicationHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req models.SendMessageRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.BodyText == "" && req.BodyHTML == "" {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", "body_text or body_html is required")
+		return
+	}
+	if req.To == "" && req.ListID == "" {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", "to or list_id is required")
+		return
+	}
+	if req.ListID != "" && h.distributionLists == nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", "Distribution lists are not available")
+		return
+	}
+
+	now := time.Now()
+	var scheduledAt *time.Time
+	if req.ScheduledAt != "" {
+		at, err := parseSendTime(req.ScheduledAt, req.Timezone)
+		if err != nil {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_SCHEDULE", err.Error())
+			return
+		}
+		switch {
+		case !at.After(now):
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_SCHEDULE", "scheduled_at must be in the future")
+			return
+		case at.After(now.Add(maxScheduleAhead)):
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_SCHEDULE", "scheduled_at must be within a year")
+			return
+		}
+		scheduledAt = &at
+	} else if req.Timezone != "" {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_SCHEDULE", "timezone is only used with scheduled_at")
+		return
+	} else {
+		// Outside working hours the message waits for the window to open
+		scheduledAt = h.sendWindow.DeferUntil(r.Context(), models.PriorityNormal)
+	}
+
+	if req.ThreadID != "" {
+		if _, err := h.emailRepo.GetUserThread(r.Context(), req.ThreadID, userID); err != nil {
+			if repositories.IsCommunicationNotFound(err) {
+				respondWithError(w, http.StatusNotFound, "Thread not found")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve thread: "+err.Error())
+			return
+		}
+	}
+
+	to := req.To
+	if req.ListID != "" {
+		list, ok := loadDistributionList(w, r, h.listRepo, h.userRepo, req.ListID)
+		if !ok {
+			return
+		}
+		if list.IsArchived() {
+			respondWithErrorCode(w, http.StatusConflict, "LIST_ARCHIVED", "Distribution list is archived")
+			return
+		}
+		// Members go in BCC, so the message is addressed to the sender
+		if to == "" {
+			to = middleware.GetUserEmail(r)
+		}
+	}
+
+	msg := &models.CommMessage{
+		MessageID:    uuid.MustNewUUID(),
+		ThreadID:     req.ThreadID,
+		Channel:      models.ChannelEmail,
+		Direction:    models.DirectionOutbound,
+		Status:       models.MessageStatusQueued,
+		FromName:     middleware.GetUserEmail(r),
+		FromAddress:  h.emailSender.FromAddress(),
+		ToAddresses:  []string{to},
+		CCAddresses:  req.CC,
+		BCCAddresses: req.BCC,
+		Subject:      req.Subject,
+		BodyText:     req.BodyText,
+		BodyHTML:     req.BodyHTML,
+		UserID:       userID,
+		TenantID:     middleware.GetTenantID(r),
+		Priority:     models.PriorityNormal,
+		ScheduledAt:  scheduledAt,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if scheduledAt != nil {
+		msg.Status = models.MessageStatusScheduled
+	}
+	msg.DistributionListID = req.ListID
+	msg.TrackEngagement = emailTrackingEnabled(r.Context(), h.settingsRepo, userID)
+	// Signed before storing, so scheduled sends and retries send the signed body
+	if err := h.signatures.Apply(r.Context(), msg); err != nil {
+		log.Printf("Warning: email signature of user %s not applied: %v", userID, err)
+	}
+
+	// A message sent now is resolved before it is stored, so a list with
+	// nobody to send to is refused; scheduled ones are resolved by the worker
+	var expansion *models.DistributionListExpansion
+	if req.ListID != "" && scheduledAt == nil {
+		var err error
+		expansion, err = h.distributionLists.Expand(r.Context(), req.ListID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to resolve distribution list: "+err.Error())
+			return
+		}
+		if len(expansion.Addresses) == 0 {
+			respondWithErrorCode(w, http.StatusBadRequest, "LIST_EMPTY", "Distribution list has no recipients to send to")
+			return
+		}
+	}
+
+	if err := h.emailRepo.CreateCommMessage(r.Context(), msg); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to store message: "+err.Error())
+		return
+	}
+	if scheduledAt != nil {
+		respondWithJSON(w, http.StatusAccepted, msg)
+		return
+	}
+
+	// A failed send stays queued for the outbox worker to retry
+	sending := msg
+	if expansion != nil {
+		sending = services.WithRecipients(msg, expansion)
+	}
+	if err := deliverEmail(r.Context(), h.emailSender, h.emailRepo, sending); err != nil {
+		log.Printf("EMAIL ERROR: failed to send message %s via %s: %v", msg.MessageID, h.emailSender.Name(), err)
+		respondWithJSON(w, http.StatusAccepted, msg)
+		return
+	}
+	msg.ExternalID = sending.ExternalID
+	if h.emailSender.Capabilities().Delivers {
+		sentAt := time.Now()
+		msg.Status = models.MessageStatusSent
+		msg.SentAt = &sentAt
+	}
+	respondWithJSON(w, http.StatusCreated, msg)
+}
+
+// CancelScheduledMessage godoc
+// @Summary Cancel a scheduled email
+// @Description Deletes one of the caller's scheduled messages before it is sent. Once the outbox worker has claimed it for sending it can no longer be cancelled.
+// @Tags Communications
+// @Produce json
+// @Param id path string true "Message ID"
+// @Success 204 "Cancelled"
+// @Failure 400 {object} ErrorResponse "Invalid message ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Message not found"
+// @Failure 409 {object} CodedErrorResponse "Message is not scheduled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /communications/messages/{id} [delete]
+// @Security BearerAuth
+func (h *CommunicationHandler) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	messageID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid message ID format")
+		return
+	}
+
+	if err := h.emailRepo.CancelScheduledEmail(r.Context(), messageID, userID); err != nil {
+		switch {
+		case repositories.IsCommunicationNotFound(err):
+			respondWithError(w, http.StatusNotFound, "Message not found")
+		case errors.Is(err, repositories.ErrEmailNotScheduled):
+			respondWithErrorCode(w, http.StatusConflict, "MESSAGE_NOT_SCHEDULED", "Message is no longer scheduled and cannot be cancelled")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to cancel message: "+err.Error())
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseSendTime reads a send time given with an offset, or as a local time
+// in the IANA zone tz, and returns it in UTC
+func parseSendTime(value, tz string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		if tz != "" {
+			return time.Time{}, errors.New("timezone cannot be combined with a scheduled_at that has an offset")
+		}
+		return t.UTC(), nil
+	}
+
+	if tz == "" {
+		return time.Time{}, errors.New("scheduled_at needs an offset, or a timezone for a local time")
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", tz)
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("scheduled_at must be RFC 3339 or a local time like 2006-01-02T15:04")
+}
+
+// parseInboxFilters reads the inbox filter query parameters; any error is a
+// client error
+func parseInboxFilters(r *http.Request) (repositories.EmailFilters, error) {
+	query := r.URL.Query()
+	filters := repositories.EmailFilters{
+		TenantID: middleware.GetTenantID(r),
+		Status:   query.Get("status"),
+	}
+
+	if unread := query.Get("unread"); unread != "" {
+		b, err := strconv.ParseBool(unread)
+		if err != nil {
+			return filters, errors.New("Invalid unread value")
+		}
+		isRead := !b
+		filters.IsRead = &isRead
+	}
+	if starred := query.Get("starred"); starred != "" {
+		b, err := strconv.ParseBool(starred)
+		if err != nil {
+			return filters, errors.New("Invalid starred value")
+		}
+		filters.IsStarred = &b
+	}
+
+	switch direction := query.Get("direction"); direction {
+	case "", models.DirectionInbound, models.DirectionOutbound:
+		filters.Direction = direction
+	default:
+		return filters, errors.New("Invalid direction, must be inbound or outbound")
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filters, errors.New("Invalid from date, expected RFC 3339")
+		}
+		filters.DateFrom = &t
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filters, errors.New("Invalid to date, expected RFC 3339")
+		}
+		filters.DateTo = &t
+	}
+	if filters.DateFrom != nil && filters.DateTo != nil && filters.DateTo.Before(*filters.DateFrom) {
+		return filters, errors.New("The to date must not be before the from date")
+	}
+
+	return filters, nil
+}
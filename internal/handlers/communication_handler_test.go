@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSendTime(t *testing.T) {
+	for _, tt := range []struct {
+		value, tz string
+		want      time.Time
+	}{
+		{"2026-03-02T09:00:00+05:30", "", time.Date(2026, 3, 2, 3, 30, 0, 0, time.UTC)},
+		{"2026-03-02T09:00:00Z", "", time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)},
+		{"2026-03-02T09:00", "Asia/Kolkata", time.Date(2026, 3, 2, 3, 30, 0, 0, time.UTC)},
+		{"2026-01-15T09:00:30", "America/New_York", time.Date(2026, 1, 15, 14, 0, 30, 0, time.UTC)},
+		// Daylight saving time in the zone on the day itself
+		{"2026-07-01T09:00", "America/New_York", time.Date(2026, 7, 1, 13, 0, 0, 0, time.UTC)},
+	} {
+		got, err := parseSendTime(tt.value, tt.tz)
+		if err != nil || !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("parseSendTime(%q, %q) = %v, %v, want %v", tt.value, tt.tz, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ value, tz string }{
+		{"2026-03-02T09:00:00+05:30", "Asia/Kolkata"}, // Offset and zone disagree, or repeat each other
+		{"2026-03-02T09:00", ""},                      // Whose nine o'clock?
+		{"2026-03-02T09:00", "Local"},                 // The server's zone
+		{"2026-03-02T09:00", "Mars/Olympus_Mons"},
+		{"next tuesday", "Europe/Paris"},
+		{"2026-03-02", "Europe/Paris"},
+	} {
+		if got, err := parseSendTime(tt.value, tt.tz); err == nil {
+			t.Errorf("parseSendTime(%q, %q) = %v, want an error", tt.value, tt.tz, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setVersionETag returns the version of a versioned resource as its ETag,
+// for the client to send back in If-Match when updating it
+func setVersionETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// expectedVersion returns the version an update was based on, from the
+// If-Match header or else the body's version field, or nil when neither is
+// sent. Without one it responds with 428 when required is set, and it
+// responds with 400 when the two disagree or If-Match is not a version.
+func expectedVersion(w http.ResponseWriter, r *http.Request, bodyVersion *int, required bool) (*int, bool) {
+	var version *int
+	if header := strings.TrimSpace(r.Header.Get("If-Match")); header != "" {
+		parsed, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+		if err != nil || parsed < 0 {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_VERSION", "If-Match must be the version returned by the last read")
+			return nil, false
+		}
+		if bodyVersion != nil && *bodyVersion != parsed {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_VERSION", "If-Match and version disagree")
+			return nil, false
+		}
+		version = &parsed
+	} else if bodyVersion != nil {
+		version = bodyVersion
+	}
+
+	if version == nil && required {
+		respondWithErrorCode(w, http.StatusPreconditionRequired, "VERSION_REQUIRED", "Send the version last read in If-Match or the version field")
+		return nil, false
+	}
+	return version, true
+}
+
+// VersionConflictResponse is the body of a 409 version conflict
+type VersionConflictResponse struct {
+	Success bool        `json:"success"`
+	Error   ErrorDetail `json:"error"`
+	Current interface{} `json:"current"`
+}
+
+// respondWithVersionConflict responds with 409 and the stored state, so the
+// client can merge its changes and retry with the current version
+func respondWithVersionConflict(w http.ResponseWriter, current interface{}) {
+	respondWithJSON(w, http.StatusConflict, VersionConflictResponse{
+		Error: ErrorDetail{
+			Code:    "CONFLICT",
+			Message: "The resource was changed by someone else; merge with the current state and retry",
+		},
+		Current: current,
+	})
+}
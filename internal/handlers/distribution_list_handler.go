@@ -0,0 +1,556 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/validation"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// DistributionListHandler manages distribution lists, the reusable groups
+// of recipients messages can be sent to. Lists are scoped like campaigns:
+// the campaigns data scope decides whose lists a user sees and changes.
+type DistributionListHandler struct {
+	repo      repositories.DistributionListStore
+	lists     *services.DistributionLists
+	emailRepo repositories.EmailStore
+	userRepo  repositories.UserStore
+}
+
+// NewDistributionListHandler creates a new DistributionListHandler
+func NewDistributionListHandler(repo repositories.DistributionListStore, lists *services.DistributionLists, emailRepo repositories.EmailStore, userRepo repositories.UserStore) *DistributionListHandler {
+	return &DistributionListHandler{repo: repo, lists: lists, emailRepo: emailRepo, userRepo: userRepo}
+}
+
+// CreateList godoc
+// @Summary Create a distribution list
+// @Description Creates a distribution list owned by the caller, optionally with its first members. Members are user IDs, sent to at the user's current address, or email addresses; repeats are kept once. A list holds at most 1000 members.
+// @Tags Communications
+// @Accept json
+// @Produce json
+// @Param list body models.CreateDistributionListRequest true "List"
+// @Success 201 {object} models.DistributionList
+// @Failure 400 {object} CodedErrorResponse "Invalid request, or unknown user IDs"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 409 {object} CodedErrorResponse "Too many members"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists [post]
+// @Security BearerAuth
+func (h *DistributionListHandler) CreateList(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithErrorCode(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	var req models.CreateDistributionListRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	members, ok := h.readMembers(w, r, req.Members, true)
+	if !ok {
+		return
+	}
+	if len(members) > models.MaxDistributionListMembers {
+		respondWithErrorCode(w, http.StatusConflict, "LIST_FULL", fmt.Sprintf("A distribution list holds at most %d members", models.MaxDistributionListMembers))
+		return
+	}
+
+	now := time.Now()
+	list := &models.DistributionList{
+		ID:          uuid.MustNewUUID(),
+		TenantID:    listTenantID(r),
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		OwnerID:     userID,
+		Status:      models.DistributionListStatusActive,
+		CreatedBy:   userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := h.repo.CreateList(r.Context(), list); err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create distribution list: "+err.Error())
+		return
+	}
+	added, err := h.repo.AddMembers(r.Context(), list.ID, members, userID, now)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to add distribution list members: "+err.Error())
+		return
+	}
+	list.MemberCount = added
+
+	respondWithJSON(w, http.StatusCreated, list)
+}
+
+// ListLists godoc
+// @Summary List distribution lists
+// @Description Lists the distribution lists within the caller's campaigns data scope, newest first. Archived lists are left out unless archived=true. Pages are read by cursor, or with page for a total.
+// @Tags Communications
+// @Produce json
+// @Param search query string false "Search in list name"
+// @Param archived query bool false "Include archived lists"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param page query int false "Page number, for page paging with a total"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Success 200 {object} pagination.Envelope[models.DistributionList] "total only with page paging"
+// @Failure 400 {object} CodedErrorResponse "Invalid query parameters"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists [get]
+// @Security BearerAuth
+func (h *DistributionListHandler) ListLists(w http.ResponseWriter, r *http.Request) {
+	dataScope, claims, err := requestScope(r, h.userRepo)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+	scopeOwnerIDs, denyAll := services.CreatedByScope("distribution_lists", dataScope, claims)
+	if denyAll {
+		respondWithErrorCode(w, http.StatusForbidden, "FORBIDDEN", "Permission denied")
+		return
+	}
+
+	query := r.URL.Query()
+	filters := repositories.DistributionListFilters{
+		TenantID:      listTenantID(r),
+		Search:        strings.TrimSpace(query.Get("search")),
+		ScopeOwnerIDs: scopeOwnerIDs,
+	}
+	if archived := query.Get("archived"); archived != "" {
+		filters.IncludeArchived, err = strconv.ParseBool(archived)
+		if err != nil {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid archived value, must be true or false")
+			return
+		}
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	lists, err := h.repo.ListLists(r.Context(), filters, page)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list distribution lists: "+err.Error())
+		return
+	}
+	envelope := pagination.NewEnvelope(page, lists, func(list *models.DistributionList) pagination.Cursor {
+		return pagination.Cursor{SortValue: list.CreatedAt, ID: list.ID}
+	})
+	if page.PageMode {
+		total, err := h.repo.CountLists(r.Context(), filters)
+		if err != nil {
+			respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list distribution lists: "+err.Error())
+			return
+		}
+		envelope = envelope.WithTotal(total)
+	}
+
+	respondWithJSON(w, http.StatusOK, envelope)
+}
+
+// GetList godoc
+// @Summary Get a distribution list
+// @Description Returns a distribution list within the caller's campaigns data scope, without its members
+// @Tags Communications
+// @Produce json
+// @Param id path string true "List ID"
+// @Success 200 {object} models.DistributionList
+// @Failure 400 {object} CodedErrorResponse "Invalid list ID"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "List not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists/{id} [get]
+// @Security BearerAuth
+func (h *DistributionListHandler) GetList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.loadListInScope(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// UpdateList godoc
+// @Summary Update a distribution list
+// @Description Renames a distribution list, changes its description, or archives it. An archived list takes no new messages and is left out of listings, but the messages already scheduled to it are still sent; archived=false restores it.
+// @Tags Communications
+// @Accept json
+// @Produce json
+// @Param id path string true "List ID"
+// @Param list body models.UpdateDistributionListRequest true "Fields to change"
+// @Success 200 {object} models.DistributionList
+// @Failure 400 {object} CodedErrorResponse "Invalid request"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "List not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists/{id} [patch]
+// @Security BearerAuth
+func (h *DistributionListHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.loadListInScope(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateDistributionListRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			respondWithInvalidFields(w, validation.Errors{"name": "is required"})
+			return
+		}
+		req.Name = &name
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		req.Description = &description
+	}
+
+	updated, err := h.repo.UpdateList(r.Context(), list.TenantID, list.ID, &req, time.Now())
+	if err != nil {
+		if errors.Is(err, repositories.ErrDistributionListNotFound) {
+			respondWithErrorCode(w, http.StatusNotFound, "NOT_FOUND", "Distribution list not found")
+			return
+		}
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update distribution list: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// DeleteList godoc
+// @Summary Delete a distribution list
+// @Description Deletes a distribution list and its members. A list that scheduled or queued messages are still to be sent to cannot be deleted, since its members are resolved when they are sent; archive it instead.
+// @Tags Communications
+// @Produce json
+// @Param id path string true "List ID"
+// @Success 204 "Deleted"
+// @Failure 400 {object} CodedErrorResponse "Invalid list ID"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "List not found"
+// @Failure 409 {object} CodedErrorResponse "Messages are still to be sent to the list"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists/{id} [delete]
+// @Security BearerAuth
+func (h *DistributionListHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.loadListInScope(w, r)
+	if !ok {
+		return
+	}
+
+	pending, err := h.emailRepo.CountPendingForDistributionList(r.Context(), list.ID)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete distribution list: "+err.Error())
+		return
+	}
+	if pending > 0 {
+		respondWithErrorCode(w, http.StatusConflict, "LIST_IN_USE",
+			fmt.Sprintf("%d scheduled message(s) are still to be sent to this list; archive it instead", pending))
+		return
+	}
+
+	if err := h.repo.DeleteList(r.Context(), list.TenantID, list.ID); err != nil {
+		if errors.Is(err, repositories.ErrDistributionListNotFound) {
+			respondWithErrorCode(w, http.StatusNotFound, "NOT_FOUND", "Distribution list not found")
+			return
+		}
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete distribution list: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListMembers godoc
+// @Summary List distribution list members
+// @Description Lists the members of a distribution list in the order they were added. Pages are read by cursor, or with page for a total.
+// @Tags Communications
+// @Produce json
+// @Param id path string true "List ID"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param page query int false "Page number, for page paging with a total"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Success 200 {object} pagination.Envelope[models.DistributionListMember] "total only with page paging"
+// @Failure 400 {object} CodedErrorResponse "Invalid list ID or pagination"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "List not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists/{id}/members [get]
+// @Security BearerAuth
+func (h *DistributionListHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	list, ok := h.loadListInScope(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.repo.ListMembers(r.Context(), list.ID, page)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list distribution list members: "+err.Error())
+		return
+	}
+	envelope := pagination.NewEnvelope(page, members, func(member *models.DistributionListMember) pagination.Cursor {
+		return pagination.Cursor{SortValue: member.AddedAt, ID: member.ID}
+	})
+	if page.PageMode {
+		total, err := h.repo.CountMembers(r.Context(), list.ID)
+		if err != nil {
+			respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list distribution list members: "+err.Error())
+			return
+		}
+		envelope = envelope.WithTotal(total)
+	}
+
+	respondWithJSON(w, http.StatusOK, envelope)
+}
+
+// AddMembers godoc
+// @Summary Add distribution list members
+// @Description Adds up to 500 members to a distribution list: user IDs, sent to at the user's current address, or email addresses. Members already in the list are kept once and counted as unchanged. A list holds at most 1000 members.
+// @Tags Communications
+// @Accept json
+// @Produce json
+// @Param id path string true "List ID"
+// @Param members body models.DistributionListMembersRequest true "Members to add"
+// @Success 200 {object} models.DistributionListMembersResult
+// @Failure 400 {object} CodedErrorResponse "Invalid request, or unknown user IDs"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "List not found"
+// @Failure 409 {object} CodedErrorResponse "Too many members"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists/{id}/members [post]
+// @Security BearerAuth
+func (h *DistributionListHandler) AddMembers(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.loadListInScope(w, r)
+	if !ok {
+		return
+	}
+	var req models.DistributionListMembersRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	members, ok := h.readMembers(w, r, req.Members, true)
+	if !ok {
+		return
+	}
+
+	count, err := h.repo.CountMembers(r.Context(), list.ID)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to add distribution list members: "+err.Error())
+		return
+	}
+	// Members given that are already in the list count towards the limit,
+	// so a full list refuses them too
+	if int(count)+len(members) > models.MaxDistributionListMembers {
+		respondWithErrorCode(w, http.StatusConflict, "LIST_FULL",
+			fmt.Sprintf("A distribution list holds at most %d members; this one has %d", models.MaxDistributionListMembers, count))
+		return
+	}
+
+	added, err := h.repo.AddMembers(r.Context(), list.ID, members, middleware.GetUserID(r), time.Now())
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to add distribution list members: "+err.Error())
+		return
+	}
+	h.respondWithMembersResult(w, r, list.ID, models.DistributionListMembersResult{Added: added, Unchanged: len(req.Members) - added})
+}
+
+// RemoveMembers godoc
+// @Summary Remove distribution list members
+// @Description Removes up to 500 members from a distribution list, named by user ID or email address as they were added. Members not in the list are counted as unchanged.
+// @Tags Communications
+// @Accept json
+// @Produce json
+// @Param id path string true "List ID"
+// @Param members body models.DistributionListMembersRequest true "Members to remove"
+// @Success 200 {object} models.DistributionListMembersResult
+// @Failure 400 {object} CodedErrorResponse "Invalid request"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "List not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists/{id}/members/remove [post]
+// @Security BearerAuth
+func (h *DistributionListHandler) RemoveMembers(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.loadListInScope(w, r)
+	if !ok {
+		return
+	}
+	var req models.DistributionListMembersRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	// Users deleted since they were added can still be removed
+	members, ok := h.readMembers(w, r, req.Members, false)
+	if !ok {
+		return
+	}
+
+	removed, err := h.repo.RemoveMembers(r.Context(), list.ID, members, time.Now())
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to remove distribution list members: "+err.Error())
+		return
+	}
+	h.respondWithMembersResult(w, r, list.ID, models.DistributionListMembersResult{Removed: removed, Unchanged: len(req.Members) - removed})
+}
+
+// GetRecipients godoc
+// @Summary Preview distribution list recipients
+// @Description Resolves a distribution list the way a message sent to it now would be: the addresses of its members, without deactivated or deleted users, suppressed addresses and repeats, with how many were skipped for each reason. Scheduled messages are resolved again when they are sent.
+// @Tags Communications
+// @Produce json
+// @Param id path string true "List ID"
+// @Success 200 {object} models.DistributionListExpansion
+// @Failure 400 {object} CodedErrorResponse "Invalid list ID"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "List not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /communications/lists/{id}/recipients [get]
+// @Security BearerAuth
+func (h *DistributionListHandler) GetRecipients(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.loadListInScope(w, r)
+	if !ok {
+		return
+	}
+	expansion, err := h.lists.Expand(r.Context(), list.ID)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to resolve distribution list: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, expansion)
+}
+
+// respondWithMembersResult completes a membership change with the list's
+// member count
+func (h *DistributionListHandler) respondWithMembersResult(w http.ResponseWriter, r *http.Request, listID string, result models.DistributionListMembersResult) {
+	count, err := h.repo.CountMembers(r.Context(), listID)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to count distribution list members: "+err.Error())
+		return
+	}
+	result.MemberCount = int(count)
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// readMembers checks that each member names a user ID or an email address
+// and drops repeats. With mustExist, user IDs of no account of the caller's
+// tenant are refused.
+// It writes the error response when a member is invalid.
+func (h *DistributionListHandler) readMembers(w http.ResponseWriter, r *http.Request, inputs []models.DistributionListMemberInput, mustExist bool) ([]models.DistributionListMemberInput, bool) {
+	invalid := validation.Errors{}
+	members := make([]models.DistributionListMemberInput, 0, len(inputs))
+	seen := make(map[string]int, len(inputs))
+	var userIDs []string
+	for i, member := range inputs {
+		member.Email = strings.TrimSpace(member.Email)
+		if (member.UserID == "") == (member.Email == "") {
+			invalid[fmt.Sprintf("members[%d]", i)] = "needs either a userId or an email"
+			continue
+		}
+		key := repositories.DistributionListMemberID("", member)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = i
+		members = append(members, member)
+		if member.UserID != "" {
+			userIDs = append(userIDs, member.UserID)
+		}
+	}
+	if len(invalid) > 0 {
+		respondWithInvalidFields(w, invalid)
+		return nil, false
+	}
+	if !mustExist || len(userIDs) == 0 {
+		return members, true
+	}
+
+	users, err := h.userRepo.GetUsersByIDs(r.Context(), userIDs)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to look up users: "+err.Error())
+		return nil, false
+	}
+	// Users of other tenants are not revealed
+	tenantID := listTenantID(r)
+	found := make(map[string]bool, len(users))
+	for _, user := range users {
+		found[user.ID] = user.Tenant() == tenantID
+	}
+	for _, id := range userIDs {
+		if !found[id] {
+			invalid[fmt.Sprintf("members[%d].userId", seen[repositories.DistributionListMemberID("", models.DistributionListMemberInput{UserID: id})])] = "is not a user"
+		}
+	}
+	if len(invalid) > 0 {
+		respondWithInvalidFields(w, invalid)
+		return nil, false
+	}
+	return members, true
+}
+
+// loadListInScope reads the {id} list of the caller's tenant and enforces
+// the caller's campaigns data scope, writing the error response when it
+// fails
+func (h *DistributionListHandler) loadListInScope(w http.ResponseWriter, r *http.Request) (*models.DistributionList, bool) {
+	listID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid distribution list ID format")
+		return nil, false
+	}
+	return loadDistributionList(w, r, h.repo, h.userRepo, listID)
+}
+
+// loadDistributionList reads a list of the caller's tenant and enforces the
+// caller's campaigns data scope, writing the error response when it fails
+func loadDistributionList(w http.ResponseWriter, r *http.Request, repo repositories.DistributionListStore, userRepo repositories.UserStore, listID string) (*models.DistributionList, bool) {
+	dataScope, claims, err := requestScope(r, userRepo)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return nil, false
+	}
+
+	list, err := repo.GetList(r.Context(), listTenantID(r), listID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrDistributionListNotFound) {
+			respondWithErrorCode(w, http.StatusNotFound, "NOT_FOUND", "Distribution list not found")
+			return nil, false
+		}
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load distribution list: "+err.Error())
+		return nil, false
+	}
+
+	if !services.IsInScope("distribution_lists", dataScope, claims, list) {
+		respondWithErrorCode(w, http.StatusForbidden, "FORBIDDEN", "Permission denied")
+		return nil, false
+	}
+	return list, true
+}
+
+// listTenantID returns the tenant whose distribution lists a request works
+// on, the tenant of the access token
+func listTenantID(r *http.Request) string {
+	return middleware.GetTenantID(r)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// listsFixture serves the distribution list routes over memory stores
+type listsFixture struct {
+	s      *testServer
+	users  *memory.UserStore
+	lists  *memory.DistributionListStore
+	emails *memory.EmailStore
+	owner  *models.User
+}
+
+func newListsFixture(t *testing.T) *listsFixture {
+	t.Helper()
+	f := &listsFixture{
+		s:      newTestServer(t),
+		users:  memory.NewUserStore(),
+		lists:  memory.NewDistributionListStore(),
+		emails: memory.NewEmailStore(),
+	}
+	f.owner = f.users.Add(&models.User{Email: "owner@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+	h := NewDistributionListHandler(f.lists, services.NewDistributionLists(f.lists, f.users, nil), f.emails, f.users)
+	f.s.handle(http.MethodPost, "/api/v1/communications/lists", h.CreateList)
+	f.s.handle(http.MethodGet, "/api/v1/communications/lists", h.ListLists)
+	f.s.handle(http.MethodGet, "/api/v1/communications/lists/{id}", h.GetList)
+	f.s.handle(http.MethodPatch, "/api/v1/communications/lists/{id}", h.UpdateList)
+	f.s.handle(http.MethodDelete, "/api/v1/communications/lists/{id}", h.DeleteList)
+	f.s.handle(http.MethodGet, "/api/v1/communications/lists/{id}/members", h.ListMembers)
+	f.s.handle(http.MethodPost, "/api/v1/communications/lists/{id}/members", h.AddMembers)
+	f.s.handle(http.MethodPost, "/api/v1/communications/lists/{id}/members/remove", h.RemoveMembers)
+	f.s.handle(http.MethodGet, "/api/v1/communications/lists/{id}/recipients", h.GetRecipients)
+	return f
+}
+
+// createList creates a list as the owner with members
+func (f *listsFixture) createList(t *testing.T, name string, members ...models.DistributionListMemberInput) models.DistributionList {
+	t.Helper()
+	rec := f.s.do(f.owner, http.MethodPost, "/api/v1/communications/lists", models.CreateDistributionListRequest{Name: name, Members: members})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+	var list models.DistributionList
+	decodeBody(t, rec, &list)
+	return list
+}
+
+// TestDistributionListMembersAreDeduped creates a list with a repeated
+// member, adds members already in it, and checks each recipient is kept
+// once and the recipients preview skips the deactivated user
+func TestDistributionListMembersAreDeduped(t *testing.T) {
+	f := newListsFixture(t)
+	active := f.users.Add(&models.User{Email: "ana@example.com", IsActive: true})
+	inactive := f.users.Add(&models.User{Email: "ben@example.com", IsActive: false})
+
+	list := f.createList(t, "APAC sales",
+		models.DistributionListMemberInput{UserID: active.ID},
+		models.DistributionListMemberInput{Email: "Cy@Example.com"},
+		models.DistributionListMemberInput{Email: "CY@EXAMPLE.COM"},
+		models.DistributionListMemberInput{UserID: active.ID},
+	)
+	if list.MemberCount != 2 || list.OwnerID != f.owner.ID || list.Status != models.DistributionListStatusActive {
+		t.Errorf("created = %+v, want 2 members", list)
+	}
+
+	path := "/api/v1/communications/lists/" + list.ID
+	rec := f.s.do(f.owner, http.MethodPost, path+"/members", models.DistributionListMembersRequest{Members: []models.DistributionListMemberInput{
+		{Email: "CY@example.com"},
+		{UserID: inactive.ID},
+		{UserID: inactive.ID},
+	}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("add = %d %s", rec.Code, rec.Body)
+	}
+	var added models.DistributionListMembersResult
+	decodeBody(t, rec, &added)
+	if added.Added != 1 || added.Unchanged != 2 || added.MemberCount != 3 {
+		t.Errorf("add = %+v, want 1 added, 2 unchanged, 3 members", added)
+	}
+
+	rec = f.s.do(f.owner, http.MethodGet, path+"/recipients", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("recipients = %d %s", rec.Code, rec.Body)
+	}
+	var expansion models.DistributionListExpansion
+	decodeBody(t, rec, &expansion)
+	// Members added by one request share their time and come in ID order
+	if got := slices.Sorted(slices.Values(expansion.Addresses)); !slices.Equal(got, []string{"ana@example.com", "cy@example.com"}) || expansion.SkippedInactive != 1 {
+		t.Errorf("recipients = %+v, want ana and cy with ben skipped", expansion)
+	}
+
+	rec = f.s.do(f.owner, http.MethodPost, path+"/members/remove", models.DistributionListMembersRequest{Members: []models.DistributionListMemberInput{
+		{Email: "cy@example.com"},
+		{Email: "nobody@example.com"},
+	}})
+	var removed models.DistributionListMembersResult
+	decodeBody(t, rec, &removed)
+	if rec.Code != http.StatusOK || removed.Removed != 1 || removed.Unchanged != 1 || removed.MemberCount != 2 {
+		t.Errorf("remove = %d %+v, want 1 removed, 1 unchanged, 2 members", rec.Code, removed)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		members []models.DistributionListMemberInput
+	}{
+		{"unknown user", []models.DistributionListMemberInput{{UserID: uuid.MustNewUUID()}}},
+		{"neither", []models.DistributionListMemberInput{{}}},
+		{"both", []models.DistributionListMemberInput{{UserID: active.ID, Email: "ana@example.com"}}},
+	} {
+		rec := f.s.do(f.owner, http.MethodPost, path+"/members", models.DistributionListMembersRequest{Members: tt.members})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d %s, want 400", tt.name, rec.Code, rec.Body)
+		}
+	}
+}
+
+// TestDistributionListMembersArePaged adds members over several requests
+// and pages through them by cursor and by page number
+func TestDistributionListMembersArePaged(t *testing.T) {
+	f := newListsFixture(t)
+	list := f.createList(t, "Beta customers")
+	path := "/api/v1/communications/lists/" + list.ID + "/members"
+	var want []string
+	for i := range 5 {
+		address := fmt.Sprintf("beta%d@example.com", i)
+		want = append(want, address)
+		rec := f.s.do(f.owner, http.MethodPost, path, models.DistributionListMembersRequest{Members: []models.DistributionListMemberInput{{Email: address}}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("add = %d %s", rec.Code, rec.Body)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var got []string
+	target := path + "?limit=2"
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("cursor paging did not end")
+		}
+		rec := f.s.do(f.owner, http.MethodGet, target, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("members = %d %s", rec.Code, rec.Body)
+		}
+		var body pagination.Envelope[models.DistributionListMember]
+		decodeBody(t, rec, &body)
+		for _, member := range body.Items {
+			got = append(got, member.Email)
+		}
+		if !body.HasMore {
+			break
+		}
+		target = path + "?limit=2&cursor=" + body.NextCursor
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged members = %v, want %v in the order they were added", got, want)
+	}
+
+	rec := f.s.do(f.owner, http.MethodGet, path+"?limit=2&page=3", nil)
+	var last pagination.Envelope[models.DistributionListMember]
+	decodeBody(t, rec, &last)
+	if rec.Code != http.StatusOK || last.Total == nil || *last.Total != 5 || len(last.Items) != 1 || last.Items[0].Email != want[4] || last.HasMore {
+		t.Errorf("page 3 = %d %+v, want the last member of 5", rec.Code, last)
+	}
+	if rec := f.s.do(f.owner, http.MethodGet, path+"?cursor=garbage", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad cursor = %d, want 400", rec.Code)
+	}
+}
+
+// TestDistributionListInUseIsArchivedNotDeleted schedules a message to a
+// list and checks the list can only be archived until the message is sent
+func TestDistributionListInUseIsArchivedNotDeleted(t *testing.T) {
+	f := newListsFixture(t)
+	list := f.createList(t, "Newsletter", models.DistributionListMemberInput{Email: "reader@example.com"})
+	path := "/api/v1/communications/lists/" + list.ID
+	msg := &models.CommMessage{
+		MessageID:          uuid.MustNewUUID(),
+		Channel:            string(models.CommunicationChannelEmail),
+		Status:             models.MessageStatusScheduled,
+		UserID:             f.owner.ID,
+		DistributionListID: list.ID,
+	}
+	if err := f.emails.CreateCommMessage(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if detail := errorDetail(t, f.s.do(f.owner, http.MethodDelete, path, nil), http.StatusConflict); detail.Code != "LIST_IN_USE" {
+		t.Errorf("delete with a scheduled message = %s, want LIST_IN_USE", detail.Code)
+	}
+
+	archived := true
+	rec := f.s.do(f.owner, http.MethodPatch, path, models.UpdateDistributionListRequest{Archived: &archived})
+	var updated models.DistributionList
+	decodeBody(t, rec, &updated)
+	if rec.Code != http.StatusOK || !updated.IsArchived() || updated.ArchivedAt == nil {
+		t.Fatalf("archive = %d %+v", rec.Code, updated)
+	}
+	listed := func(query string) int {
+		t.Helper()
+		rec := f.s.do(f.owner, http.MethodGet, "/api/v1/communications/lists"+query, nil)
+		var body pagination.Envelope[models.DistributionList]
+		decodeBody(t, rec, &body)
+		return len(body.Items)
+	}
+	if n := listed(""); n != 0 {
+		t.Errorf("listing = %d lists, want the archived list left out", n)
+	}
+	if n := listed("?archived=true"); n != 1 {
+		t.Errorf("listing archived = %d lists, want 1", n)
+	}
+	// The scheduled message still goes to the archived list's members
+	rec = f.s.do(f.owner, http.MethodGet, path+"/recipients", nil)
+	var expansion models.DistributionListExpansion
+	decodeBody(t, rec, &expansion)
+	if len(expansion.Addresses) != 1 {
+		t.Errorf("archived list recipients = %+v, want its member", expansion)
+	}
+
+	if err := f.emails.MarkSent(context.Background(), msg.MessageID, "smtp", ""); err != nil {
+		t.Fatal(err)
+	}
+	if rec := f.s.do(f.owner, http.MethodDelete, path, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete once sent = %d %s, want 204", rec.Code, rec.Body)
+	}
+	if rec := f.s.do(f.owner, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete = %d, want 404", rec.Code)
+	}
+	if n, _ := f.lists.CountMembers(context.Background(), list.ID); n != 0 {
+		t.Errorf("%d members left after delete", n)
+	}
+}
+
+// TestDistributionListsFollowTheCampaignsScope checks a user limited to
+// their own campaigns neither sees nor changes another user's list
+func TestDistributionListsFollowTheCampaignsScope(t *testing.T) {
+	f := newListsFixture(t)
+	list := f.createList(t, "Owner's list")
+	other := f.users.Add(&models.User{Email: "rep@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+	own := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Campaigns: models.DataScopeOwn})
+	path := "/api/v1/communications/lists/" + list.ID
+
+	if rec := f.s.doContext(own, other, http.MethodGet, path, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("get another's list = %d, want 403", rec.Code)
+	}
+	if rec := f.s.doContext(own, other, http.MethodDelete, path, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("delete another's list = %d, want 403", rec.Code)
+	}
+	rec := f.s.doContext(own, other, http.MethodGet, "/api/v1/communications/lists", nil)
+	var body pagination.Envelope[models.DistributionList]
+	decodeBody(t, rec, &body)
+	if rec.Code != http.StatusOK || len(body.Items) != 0 {
+		t.Errorf("listing = %d with %d lists, want none of the owner's", rec.Code, len(body.Items))
+	}
+	if rec := f.s.doContext(own, f.owner, http.MethodGet, path, nil); rec.Code != http.StatusOK {
+		t.Errorf("owner get = %d, want 200", rec.Code)
+	}
+	if rec := f.s.do(f.owner, http.MethodGet, "/api/v1/communications/lists/"+uuid.MustNewUUID(), nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown list = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/kafka"
+)
+
+// maxWebhookBodyBytes bounds a delivery webhook request body
+const maxWebhookBodyBytes = 1 << 20
+
+// deliveryWebhookSignatureHeader carries the hex HMAC-SHA256 of the raw body,
+// optionally prefixed with "sha256="
+const deliveryWebhookSignatureHeader = "X-Webhook-Signature"
+
+// EmailWebhookHandler receives delivery status callbacks from email providers
+type EmailWebhookHandler struct {
+	emailRepo       repositories.MailboxStore
+	suppressionRepo *repositories.EmailSuppressionRepository
+	kafkaProducer   *kafka.Producer
+	secret          []byte // empty rejects every webhook
+}
+
+// NewEmailWebhookHandler creates a new EmailWebhookHandler
+func NewEmailWebhookHandler(emailRepo repositories.MailboxStore, suppressionRepo *repositories.EmailSuppressionRepository, kafkaProducer *kafka.Producer, secret string) *EmailWebhookHandler {
+	return &EmailWebhookHandler{
+		emailRepo:       emailRepo,
+		suppressionRepo: suppressionRepo,
+		kafkaProducer:   kafkaProducer,
+		secret:          []byte(secret),
+	}
+}
+
+// DeliveryWebhookResult summarises a processed webhook batch
+type DeliveryWebhookResult struct {
+	Received int      `json:"received"`
+	Applied  int      `json:"applied"`
+	Ignored  int      `json:"ignored"` // Duplicate, stale or for an unknown message
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// HandleDeliveryStatus godoc
+// @Summary Email delivery status webhook
+// @Description Applies provider delivery events (delivered, bounced, deferred, complained) to communication records. Accepts one event or an array. The X-Webhook-Signature header must carry the hex HMAC-SHA256 of the body. Duplicate and out-of-order events are ignored; hard bounces suppress the recipient.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param X-Webhook-Signature header string true "HMAC-SHA256 of the body"
+// @Param events body []models.EmailDeliveryWebhook true "Delivery events"
+// @Success 200 {object} DeliveryWebhookResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} CodedErrorResponse
+// @Failure 503 {object} CodedErrorResponse
+// @Router /webhooks/email/delivery [post]
+func (h *EmailWebhookHandler) HandleDeliveryStatus(w http.ResponseWriter, r *http.Request) {
+	if len(h.secret) == 0 {
+		respondWithErrorCode(w, http.StatusServiceUnavailable, "WEBHOOK_NOT_CONFIGURED", "Delivery webhooks are not configured")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	if !h.validSignature(body, r.Header.Get(deliveryWebhookSignatureHeader)) {
+		respondWithErrorCode(w, http.StatusUnauthorized, "INVALID_SIGNATURE", "Invalid webhook signature")
+		return
+	}
+
+	deliveries, err := decodeDeliveryEvents(body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	result := DeliveryWebhookResult{Received: len(deliveries)}
+	for i := range deliveries {
+		ev := &deliveries[i]
+		ev.Normalize()
+		if err := ev.Validate(); err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+
+		msg, applied, err := h.emailRepo.UpdateDeliveryStatus(ctx, ev)
+		if err != nil {
+			if repositories.IsCommunicationNotFound(err) {
+				// Acknowledge so the provider stops retrying
+				result.Ignored++
+				continue
+			}
+			log.Printf("Failed to apply %s event for message %s: %v", ev.Event, ev.MessageID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to apply delivery event")
+			return
+		}
+		if !applied {
+			result.Ignored++
+			continue
+		}
+		result.Applied++
+
+		recipient := ev.Recipient
+		if recipient == "" {
+			recipient = msg.ToEmail
+		}
+		if ev.IsHardBounce() && recipient != "" {
+			if err := h.suppressionRepo.Suppress(ctx, &models.EmailSuppression{
+				Email:     recipient,
+				Reason:    ev.Reason,
+				Source:    models.SuppressionSourceHardBounce,
+				MessageID: msg.ID,
+			}); err != nil {
+				log.Printf("Warning: failed to suppress %s after hard bounce of %s: %v", recipient, msg.ID, err)
+			}
+		}
+
+		event := events.EmailDeliveryStatus{
+			Envelope:   events.NewEnvelope(events.TypeEmailDeliveryStatus, "", msg.TenantID),
+			MessageID:  msg.ID,
+			Event:      ev.Event,
+			Status:     msg.Status,
+			Recipient:  recipient,
+			Reason:     ev.Reason,
+			BounceType: ev.BounceType,
+			UserID:     msg.UserID,
+		}
+		event.OccurredAt = ev.OccurredAt()
+		publishEvent(ctx, h.kafkaProducer, event)
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// validSignature checks the hex HMAC-SHA256 of body against the header value
+func (h *EmailWebhookHandler) validSignature(body []byte, header string) bool {
+	sig, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(header), "sha256="))
+	if err != nil || len(sig) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// decodeDeliveryEvents accepts a single event object or an array of events
+func decodeDeliveryEvents(body []byte) ([]models.EmailDeliveryWebhook, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var events []models.EmailDeliveryWebhook
+		if err := json.Unmarshal(trimmed, &events); err != nil {
+			return nil, err
+		}
+		return events, nil
+	}
+	var event models.EmailDeliveryWebhook
+	if err := json.Unmarshal(trimmed, &event); err != nil {
+		return nil, err
+	}
+	return []models.EmailDeliveryWebhook{event}, nil
+}
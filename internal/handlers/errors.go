@@ -0,0 +1,30 @@
+package handlers
+
+import "net/http"
+
+// Error responses follow these conventions across handlers:
+//
+//   - 401 when the caller is not authenticated or their token cannot be
+//     resolved to a user or tenant.
+//   - 403 when the caller lacks the permission or role an operation needs
+//     regardless of which resource it touches: listing, searching, creating,
+//     bulk and import/export operations, and operation variants such as a
+//     permanent delete reserved to admins.
+//   - 404 when a specific resource addressed by ID does not exist, or does
+//     exist but lies outside the caller's data scope. Answering 403 there
+//     would confirm the resource exists to someone not allowed to see it, so
+//     both cases share the same response.
+//   - 405 with an Allow header when the path exists but not for the request
+//     method (METHOD_NOT_ALLOWED, written by the router).
+//
+// Coded responses (respondWithErrorCode) carry the machine-readable codes
+// documented on each endpoint, such as VALIDATION_FAILED, VERSION_CONFLICT,
+// LAST_ADMIN or IMPERSONATION_FORBIDDEN; NOT_FOUND and METHOD_NOT_ALLOWED
+// are written by the router for unknown paths and methods.
+
+// respondWithHiddenNotFound writes the 404 returned both for a resource that
+// does not exist and for one outside the caller's data scope, so the two
+// cannot be told apart
+func respondWithHiddenNotFound(w http.ResponseWriter, message string) {
+	respondWithError(w, http.StatusNotFound, message)
+}
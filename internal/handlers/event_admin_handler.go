@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// maxEventReplayLimit caps the failed events one replay re-enqueues
+const maxEventReplayLimit = 10000
+
+// EventAdminHandler lets operators inspect the events outbox and replay
+// events that failed or that consumers missed
+type EventAdminHandler struct {
+	outbox         repositories.EventOutboxStore
+	replays        *services.EventReplays
+	auditPublisher *events.AuditPublisher
+}
+
+// NewEventAdminHandler creates a new EventAdminHandler
+// auditPublisher can be nil - replays are then not audited
+func NewEventAdminHandler(outbox repositories.EventOutboxStore, replays *services.EventReplays, auditPublisher *events.AuditPublisher) *EventAdminHandler {
+	return &EventAdminHandler{outbox: outbox, replays: replays, auditPublisher: auditPublisher}
+}
+
+// OutboxEventPage is a page of outbox events
+type OutboxEventPage struct {
+	Events []*models.OutboxEvent `json:"events"`
+	Total  int64                 `json:"total"`
+	Limit  int                   `json:"limit"`
+	Offset int                   `json:"offset"`
+}
+
+// ListEvents lists outbox events newest first
+// GET /api/v1/admin/events?status=failed&topic=audit-events&limit=50&offset=0
+// @Summary List outbox events
+// @Description Lists the events recorded for Kafka, newest first and without their payload. pending events wait for the relay (lastError shows a failing attempt), failed events were refused by the broker KAFKA_OUTBOX_MAX_ATTEMPTS times and are set aside until replayed, and published events are kept for 7 days.
+// @Tags Admin
+// @Produce json
+// @Param status query string false "pending, failed or published"
+// @Param topic query string false "Kafka topic"
+// @Param type query string false "Event type, e.g. template.created"
+// @Param from query string false "Recorded at or after (RFC 3339)"
+// @Param to query string false "Recorded before (RFC 3339)"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Events to skip"
+// @Success 200 {object} DataResponse[OutboxEventPage] "events, total, limit, offset"
+// @Failure 400 {object} ErrorResponse "Invalid status or date"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing events:admin permission"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/events [get]
+func (h *EventAdminHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.OutboxEventFilter{
+		Status:    query.Get("status"),
+		Topic:     query.Get("topic"),
+		EventType: query.Get("type"),
+	}
+	if filter.Status != "" && !models.IsValidOutboxEventStatus(filter.Status) {
+		respondWithError(w, http.StatusBadRequest, "Invalid status, must be pending, failed or published")
+		return
+	}
+	for name, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid "+name+" date, expected RFC 3339")
+				return
+			}
+			*dst = &t
+		}
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		respondWithError(w, http.StatusBadRequest, "The to date must not be before the from date")
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(query.Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	list, total, err := h.outbox.ListEvents(r.Context(), filter, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list events: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, DataResponse[OutboxEventPage]{
+		Success: true,
+		Data: OutboxEventPage{
+			Events: list,
+			Total:  total,
+			Limit:  limit,
+			Offset: offset,
+		},
+	})
+}
+
+// GetEvent returns one outbox event with its payload and delivery attempts
+// GET /api/v1/admin/events/{id}
+// @Summary Get an outbox event
+// @Description Returns an event with its payload as published and its latest delivery attempts
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Event ID (the payload's event_id)"
+// @Success 200 {object} models.OutboxEvent
+// @Failure 400 {object} ErrorResponse "Invalid event ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing events:admin permission"
+// @Failure 404 {object} ErrorResponse "Event not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/events/{id} [get]
+func (h *EventAdminHandler) GetEvent(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid event ID format")
+		return
+	}
+
+	event, err := h.outbox.GetEvent(r.Context(), eventID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrOutboxEventNotFound) {
+			respondWithError(w, http.StatusNotFound, "Event not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve event: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, event)
+}
+
+// ReplayEvent re-enqueues one failed or published event
+// POST /api/v1/admin/events/{id}/replay
+// @Summary Replay an outbox event
+// @Description Puts a failed or published event back in front of the relay with a fresh attempt budget; it is published on the relay's next run under its original event_id, so consumers that dedupe on it see a duplicate at most. Audited as EVENT_REPLAYED.
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Event ID (the payload's event_id)"
+// @Success 202 {object} models.OutboxEvent
+// @Failure 400 {object} ErrorResponse "Invalid event ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing events:admin permission, or impersonating"
+// @Failure 404 {object} ErrorResponse "Event not found"
+// @Failure 409 {object} CodedErrorResponse "Event is still pending"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/events/{id}/replay [post]
+func (h *EventAdminHandler) ReplayEvent(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid event ID format")
+		return
+	}
+
+	event, err := h.replays.Replay(r.Context(), eventID, middleware.GetUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrOutboxEventNotFound):
+			respondWithError(w, http.StatusNotFound, "Event not found")
+		case errors.Is(err, repositories.ErrOutboxEventNotReplayable):
+			respondWithErrorCode(w, http.StatusConflict, "EVENT_PENDING", "The event is still pending and will be published by the relay")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to replay event: "+err.Error())
+		}
+		return
+	}
+
+	h.publish(r, events.ActionEventReplayed,
+		fmt.Sprintf("Event %s (%s) replayed to %s", event.ID, event.EventType, event.Topic),
+		map[string]interface{}{
+			"event_id":   event.ID,
+			"event_type": event.EventType,
+			"topic":      event.Topic,
+		})
+	event.Payload = ""
+	respondWithJSON(w, http.StatusAccepted, event)
+}
+
+// ReplayFailedEvents re-enqueues the failed events of a time window in the
+// background
+// POST /api/v1/admin/events/replay-failed
+// @Summary Replay failed outbox events
+// @Description Starts a job re-enqueuing the failed events recorded in [from, to), oldest first and at most limit (default 1000, max 10000), each under its original event_id. Follow it at the Location returned. Audited as FAILED_EVENTS_REPLAYED with the job ID.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body models.ReplayFailedEventsRequest true "Time window and limit"
+// @Success 202 {object} models.EventReplayJob
+// @Failure 400 {object} CodedErrorResponse "Invalid window or limit"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing events:admin permission, or impersonating"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/events/replay-failed [post]
+func (h *EventAdminHandler) ReplayFailedEvents(w http.ResponseWriter, r *http.Request) {
+	var req models.ReplayFailedEventsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if !req.To.After(req.From) {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_WINDOW", "to must be after from")
+		return
+	}
+	if req.Limit > maxEventReplayLimit {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_LIMIT", fmt.Sprintf("limit must be at most %d", maxEventReplayLimit))
+		return
+	}
+
+	job, err := h.replays.StartReplayFailed(r.Context(), req.From, req.To, req.Limit, middleware.GetUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start replay: "+err.Error())
+		return
+	}
+
+	h.publish(r, events.ActionFailedEventsReplayed,
+		fmt.Sprintf("Replay %s of up to %d failed events recorded from %s to %s", job.ID, job.Limit, job.From.Format(time.RFC3339), job.To.Format(time.RFC3339)),
+		map[string]interface{}{
+			"job_id": job.ID,
+			"from":   job.From,
+			"to":     job.To,
+			"limit":  job.Limit,
+		})
+	w.Header().Set("Location", "/api/v1/admin/events/replay-failed/"+job.ID)
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// GetReplayJob returns the progress of a failed events replay
+// GET /api/v1/admin/events/replay-failed/{jobID}
+// @Summary Get a failed events replay
+// @Description Returns the progress of a replay started with POST /admin/events/replay-failed: the failed events matched and how many were re-enqueued
+// @Tags Admin
+// @Produce json
+// @Param jobID path string true "Replay job ID"
+// @Success 200 {object} models.EventReplayJob
+// @Failure 400 {object} ErrorResponse "Invalid job ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing events:admin permission"
+// @Failure 404 {object} ErrorResponse "Replay not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/events/replay-failed/{jobID} [get]
+func (h *EventAdminHandler) GetReplayJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.ParseUUID(mux.Vars(r)["jobID"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid replay job ID format")
+		return
+	}
+
+	job, err := h.replays.GetReplayJob(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrEventReplayJobNotFound) {
+			respondWithError(w, http.StatusNotFound, "Replay not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve replay: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// publish records a replay in the audit log
+func (h *EventAdminHandler) publish(r *http.Request, action events.AuditAction, details string, metadata map[string]interface{}) {
+	if h.auditPublisher == nil {
+		return
+	}
+	actorName, _ := r.Context().Value(middleware.NameKey).(string)
+	h.auditPublisher.RecordAdminEvent(r, middleware.GetUserID(r), actorName, action, details, metadata)
+}
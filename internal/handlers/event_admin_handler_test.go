@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// permanentRefusal is the broker refusing an event itself, which counts
+// towards setting the event aside
+var permanentRefusal error = kafka.MessageSizeTooLarge
+
+// refusingBroker is an EventPublisher refusing every event while refused
+// is set, and recording the event_id of those it acknowledges
+type refusingBroker struct {
+	mu        sync.Mutex
+	refused   error
+	published []string
+}
+
+func (b *refusingBroker) ProduceSync(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.refused != nil {
+		return b.refused
+	}
+	b.published = append(b.published, headers["event_id"])
+	return nil
+}
+
+// eventListing is the data of GET /admin/events
+type eventListing struct {
+	Data struct {
+		Events []models.OutboxEvent `json:"events"`
+		Total  int64                `json:"total"`
+	} `json:"data"`
+}
+
+// TestFailedEventIsListedAndReplayed fails a publish, finds the event with
+// the failed listing, replays it and sees it published under its original
+// ID, with the replay audited
+func TestFailedEventIsListedAndReplayed(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	admin := users.Add(&models.User{Email: "ops@example.com", Role: models.UserRoleAdmin, IsActive: true})
+	outbox := memory.NewEventOutbox()
+	broker := &refusingBroker{refused: permanentRefusal}
+	relay := services.NewEventOutboxRelay(outbox, broker, time.Minute)
+	relay.SetMaxAttempts(1)
+	recorder := &auditRecorder{}
+	publisher := events.NewAuditPublisher(nil)
+	publisher.SetRecorder(recorder)
+	h := NewEventAdminHandler(outbox, services.NewEventReplays(outbox), publisher)
+	s.handle(http.MethodGet, "/api/v1/admin/events", h.ListEvents)
+	s.handle(http.MethodGet, "/api/v1/admin/events/{id}", h.GetEvent)
+	s.handle(http.MethodPost, "/api/v1/admin/events/{id}/replay", h.ReplayEvent)
+	s.handle(http.MethodPost, "/api/v1/admin/events/replay-failed", h.ReplayFailedEvents)
+	s.handle(http.MethodGet, "/api/v1/admin/events/replay-failed/{jobID}", h.GetReplayJob)
+
+	event := events.NewTemplateEvent(events.TypeTemplateCreated, admin.ID, "acme", uuid.MustNewUUID())
+	if err := events.Record(context.Background(), outbox, event); err != nil {
+		t.Fatal(err)
+	}
+	eventID := outbox.Events()[0].ID
+
+	list := func(query string) eventListing {
+		t.Helper()
+		rec := s.do(admin, http.MethodGet, "/api/v1/admin/events"+query, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list%s = %d %s", query, rec.Code, rec.Body)
+		}
+		var body eventListing
+		decodeBody(t, rec, &body)
+		return body
+	}
+	get := func() models.OutboxEvent {
+		t.Helper()
+		rec := s.do(admin, http.MethodGet, "/api/v1/admin/events/"+eventID, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get = %d %s", rec.Code, rec.Body)
+		}
+		var body models.OutboxEvent
+		decodeBody(t, rec, &body)
+		return body
+	}
+
+	// With a budget of one attempt the refusal sets the event aside
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("relay = %v, want the event set aside", err)
+	}
+	failed := list("?status=failed&type=" + event.EventType)
+	if failed.Data.Total != 1 || len(failed.Data.Events) != 1 || failed.Data.Events[0].ID != eventID || failed.Data.Events[0].Payload != "" {
+		t.Fatalf("failed events = %+v, want the refused event without its payload", failed.Data)
+	}
+	if pending := list("?status=pending"); pending.Data.Total != 0 {
+		t.Errorf("pending events = %d, want none", pending.Data.Total)
+	}
+	detail := get()
+	if detail.Status != models.OutboxEventFailed || len(detail.DeliveryAttempts) != 1 || detail.DeliveryAttempts[0].Error == "" || !strings.Contains(detail.Payload, eventID) {
+		t.Errorf("event = %+v, want it failed with its attempt and payload", detail)
+	}
+
+	rec := s.do(admin, http.MethodPost, "/api/v1/admin/events/"+eventID+"/replay", nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("replay = %d %s", rec.Code, rec.Body)
+	}
+	var replayed models.OutboxEvent
+	decodeBody(t, rec, &replayed)
+	if replayed.ID != eventID || replayed.Status != models.OutboxEventPending || replayed.LastReplayedBy != admin.ID {
+		t.Errorf("replayed = %+v, want the same event pending again", replayed)
+	}
+	if rec := s.do(admin, http.MethodPost, "/api/v1/admin/events/"+eventID+"/replay", nil); rec.Code != http.StatusConflict {
+		t.Errorf("replaying a pending event = %d, want 409", rec.Code)
+	}
+
+	broker.refused = nil
+	if relayed, err := relay.RelayPending(context.Background()); err != nil || relayed != 1 {
+		t.Fatalf("relay after the replay = %d, %v", relayed, err)
+	}
+	if got := get(); got.Status != models.OutboxEventPublished || got.Replays != 1 {
+		t.Errorf("event after the relay = %s, %d replays; want published", got.Status, got.Replays)
+	}
+	if len(broker.published) != 1 || broker.published[0] != eventID {
+		t.Errorf("published %v, want the original event_id %s", broker.published, eventID)
+	}
+	if published := list("?status=published"); published.Data.Total != 1 {
+		t.Errorf("published events = %d, want 1", published.Data.Total)
+	}
+
+	recorder.mu.Lock()
+	audited := len(recorder.events) == 1 && recorder.events[0].Action == events.ActionEventReplayed && recorder.events[0].UserID == admin.ID
+	recorder.mu.Unlock()
+	if !audited {
+		t.Errorf("audit events = %+v, want one EVENT_REPLAYED by the admin", recorder.events)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		body         interface{}
+		want         int
+	}{
+		{http.MethodGet, "/api/v1/admin/events?status=lost", nil, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/admin/events?from=yesterday", nil, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/admin/events/" + uuid.MustNewUUID(), nil, http.StatusNotFound},
+		{http.MethodGet, "/api/v1/admin/events/not-an-id", nil, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/admin/events/" + uuid.MustNewUUID() + "/replay", nil, http.StatusNotFound},
+		{http.MethodPost, "/api/v1/admin/events/replay-failed", map[string]string{"from": "2026-01-02T00:00:00Z", "to": "2026-01-01T00:00:00Z"}, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/admin/events/replay-failed", map[string]interface{}{"from": "2026-01-01T00:00:00Z", "to": "2026-01-02T00:00:00Z", "limit": 20000}, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/admin/events/replay-failed/" + uuid.MustNewUUID(), nil, http.StatusNotFound},
+	} {
+		if rec := s.do(admin, tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+// TestReplayFailedEventsRunsAsAJob sets two events aside and replays the
+// failed events of a window through a job followed at its Location
+func TestReplayFailedEventsRunsAsAJob(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	admin := users.Add(&models.User{Email: "ops@example.com", Role: models.UserRoleAdmin, IsActive: true})
+	outbox := memory.NewEventOutbox()
+	broker := &refusingBroker{refused: permanentRefusal}
+	relay := services.NewEventOutboxRelay(outbox, broker, time.Minute)
+	relay.SetMaxAttempts(1)
+	recorder := &auditRecorder{}
+	publisher := events.NewAuditPublisher(nil)
+	publisher.SetRecorder(recorder)
+	h := NewEventAdminHandler(outbox, services.NewEventReplays(outbox), publisher)
+	s.handle(http.MethodPost, "/api/v1/admin/events/replay-failed", h.ReplayFailedEvents)
+	s.handle(http.MethodGet, "/api/v1/admin/events/replay-failed/{jobID}", h.GetReplayJob)
+
+	from := time.Now().Add(-time.Minute)
+	for range 2 {
+		if err := events.Record(context.Background(), outbox, events.NewTemplateEvent(events.TypeTemplateCreated, admin.ID, "acme", uuid.MustNewUUID())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do(admin, http.MethodPost, "/api/v1/admin/events/replay-failed", models.ReplayFailedEventsRequest{From: from, To: time.Now().Add(time.Minute)})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("replay failed = %d %s", rec.Code, rec.Body)
+	}
+	var job models.EventReplayJob
+	decodeBody(t, rec, &job)
+	if location := rec.Header().Get("Location"); location != "/api/v1/admin/events/replay-failed/"+job.ID {
+		t.Errorf("Location = %q", location)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == models.EventReplayRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec := s.do(admin, http.MethodGet, "/api/v1/admin/events/replay-failed/"+job.ID, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get job = %d %s", rec.Code, rec.Body)
+		}
+		decodeBody(t, rec, &job)
+	}
+	if job.Status != models.EventReplayCompleted || job.Matched != 2 || job.Replayed != 2 {
+		t.Fatalf("job = %+v, want both events replayed", job)
+	}
+
+	broker.mu.Lock()
+	broker.refused = nil
+	broker.mu.Unlock()
+	if relayed, err := relay.RelayPending(context.Background()); err != nil || relayed != 2 {
+		t.Errorf("relay after the job = %d, %v; want both published", relayed, err)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.events) != 1 || recorder.events[0].Action != events.ActionFailedEventsReplayed || recorder.events[0].Metadata["job_id"] != job.ID {
+		t.Errorf("audit events = %+v, want one FAILED_EVENTS_REPLAYED naming the job", recorder.events)
+	}
+}
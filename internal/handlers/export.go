@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/white/user-management/pkg/xlsx"
+)
+
+// defaultExportMaxRows caps spreadsheet exports unless SetExportMaxRows
+// says otherwise
+const defaultExportMaxRows = 50000
+
+// exportFormat reads the format parameter of the spreadsheet exports: xlsx
+// unless csv is asked for
+func exportFormat(r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "xlsx":
+		return "xlsx", true
+	case "csv":
+		return format, true
+	default:
+		return "", false
+	}
+}
+
+// respondExportTooLarge refuses an export matching more than limit rows
+func respondExportTooLarge(w http.ResponseWriter, what string, total int64, limit int) {
+	respondWithErrorCode(w, http.StatusBadRequest, "EXPORT_TOO_LARGE",
+		fmt.Sprintf("%d %s match, more than the export limit of %d; narrow the export with filters", total, what, limit))
+}
+
+// exportWriter writes the rows of an export as CSV or as the first sheet of
+// a workbook. Only the workbook gets the summary sheet.
+type exportWriter struct {
+	csv  *csv.Writer
+	xlsx *xlsx.Writer
+}
+
+// startExport sets the download headers for name-<date>.<format>, writes the
+// 200 and the header row. Once it returns the status can no longer change.
+func startExport(w http.ResponseWriter, name, format, sheet string, widths []float64, header []string) (*exportWriter, error) {
+	contentType := "text/csv; charset=utf-8"
+	if format == "xlsx" {
+		contentType = xlsx.ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`-`+time.Now().UTC().Format("2006-01-02")+`.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	if format == "csv" {
+		export := &exportWriter{csv: csv.NewWriter(w)}
+		return export, export.csv.Write(header)
+	}
+	export := &exportWriter{xlsx: xlsx.NewWriter(w)}
+	if err := export.xlsx.StartSheet(xlsx.Sheet{Name: sheet, Widths: widths, FreezeHeader: true}); err != nil {
+		return export, err
+	}
+	return export, export.xlsx.WriteHeader(header...)
+}
+
+// row writes one row. CSV values are written as text, with user-supplied
+// strings kept from being evaluated as formulas; the workbook stores text
+// inline, which spreadsheet applications never evaluate.
+func (e *exportWriter) row(values ...interface{}) error {
+	if e.xlsx != nil {
+		return e.xlsx.WriteRow(values...)
+	}
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			record[i] = csvSafe(v)
+		case time.Time:
+			if !v.IsZero() {
+				record[i] = v.UTC().Format(time.RFC3339)
+			}
+		case nil:
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return e.csv.Write(record)
+}
+
+// summary adds, to a workbook only, a sheet counting the exported rows by
+// each of the groupings
+func (e *exportWriter) summary(total int, groupings ...exportTally) error {
+	if e.xlsx == nil {
+		return nil
+	}
+	if err := e.xlsx.StartSheet(xlsx.Sheet{Name: "Summary", Widths: []float64{16, 32, 12}, FreezeHeader: true}); err != nil {
+		return err
+	}
+	if err := e.xlsx.WriteHeader("Breakdown", "Value", "Count"); err != nil {
+		return err
+	}
+	if err := e.xlsx.WriteRow("Total", "", total); err != nil {
+		return err
+	}
+	for _, tally := range groupings {
+		for _, value := range tally.values() {
+			label := value
+			if label == "" {
+				label = "(none)"
+			}
+			if err := e.xlsx.WriteRow(tally.name, label, tally.counts[value]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// close flushes the export
+func (e *exportWriter) close() error {
+	if e.xlsx != nil {
+		return e.xlsx.Close()
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+// exportTally counts exported rows by the value of one column
+type exportTally struct {
+	name   string
+	counts map[string]int
+}
+
+func newExportTally(name string) exportTally {
+	return exportTally{name: name, counts: make(map[string]int)}
+}
+
+func (t exportTally) add(value string) {
+	t.counts[value]++
+}
+
+// values returns the counted values, most frequent first
+func (t exportTally) values() []string {
+	values := make([]string, 0, len(t.counts))
+	for value := range t.counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if t.counts[values[i]] != t.counts[values[j]] {
+			return t.counts[values[i]] > t.counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
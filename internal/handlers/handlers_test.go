@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/utils"
+)
+
+// testServer routes requests to the handlers under test behind the JWT
+// middleware, as RegisterRoutes does, without the database backed RBAC
+// context
+type testServer struct {
+	t      testing.TB
+	router *mux.Router
+	jwt    *utils.JWTService
+}
+
+func newTestServer(t testing.TB) *testServer {
+	t.Helper()
+	jwtService, err := utils.NewJWTService(config.JWTConfig{
+		Algorithm:          "HS256",
+		Secret:             "handlers-tests-only-secret-0123456789abcdef",
+		AccessTokenExpiry:  15,
+		RefreshTokenExpiry: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+	return &testServer{t: t, router: mux.NewRouter(), jwt: jwtService}
+}
+
+// handle registers an authenticated route
+func (s *testServer) handle(method, path string, handler http.HandlerFunc) {
+	s.router.Handle(path, middleware.JWTAuth(s.jwt)(handler)).Methods(method)
+}
+
+// handlePublic registers a route open to anyone
+func (s *testServer) handlePublic(method, path string, handler http.HandlerFunc) {
+	s.router.Handle(path, handler).Methods(method)
+}
+
+// do sends a request as user, anonymously when nil, with body encoded as
+// JSON when set
+func (s *testServer) do(user *models.User, method, target string, body interface{}) *httptest.ResponseRecorder {
+	return s.doContext(context.Background(), user, method, target, body)
+}
+
+// doContext is do with the request built over ctx, for the values the RBAC
+// middleware would have set
+func (s *testServer) doContext(ctx context.Context, user *models.User, method, target string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.doHeader(ctx, user, method, target, body, nil)
+}
+
+// doHeader is doContext with header added to the request, as If-Match
+func (s *testServer) doHeader(ctx context.Context, user *models.User, method, target string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req := httptest.NewRequest(method, target, reader).WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if user != nil {
+		token, err := s.jwt.GenerateAccessToken(user, "")
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeBody decodes the JSON body of rec into v
+func decodeBody(t testing.TB, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+// errorDetail decodes the coded error of rec, failing unless it has status
+func errorDetail(t testing.TB, rec *httptest.ResponseRecorder, status int) ErrorDetail {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d %s, want %d", rec.Code, rec.Body, status)
+	}
+	var body CodedErrorResponse
+	decodeBody(t, rec, &body)
+	return body.Error
+}
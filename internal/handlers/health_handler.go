@@ -3,6 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/siem"
 )
 
 type HealthResponse struct {
@@ -17,7 +20,24 @@ type HealthCheck struct {
 	Details interface{} `json:"details,omitempty"`
 	Error   string      `json:"error,omitempty"`
 }
-func GetOverallHealth(w http.ResponseWriter, r *http.Request) {
+
+// HealthHandler reports the health of the service and its dependencies
+type HealthHandler struct {
+	producer       *kafka.Producer
+	auditForwarder *siem.Forwarder // nil when audit events are not sent to a SIEM
+}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler(producer *kafka.Producer) *HealthHandler {
+	return &HealthHandler{producer: producer}
+}
+
+// SetAuditForwarder reports the backlog of the SIEM audit forwarder
+func (h *HealthHandler) SetAuditForwarder(forwarder *siem.Forwarder) {
+	h.auditForwarder = forwarder
+}
+
+func (h *HealthHandler) GetOverallHealth(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Service: "white-backend-api",
 		Version: "1.0.0",
@@ -25,15 +45,46 @@ func GetOverallHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	allHealthy := true
+	degraded := false
+
+	// Kafka is optional: events are buffered while it is down, so the
+	// service is degraded rather than unhealthy
+	kafkaHealth := h.producer.Health()
+	kafkaCheck := HealthCheck{Status: "healthy", Details: kafkaHealth, Error: kafkaHealth.LastError}
+	switch {
+	case !kafkaHealth.Enabled:
+		kafkaCheck.Status = "disabled"
+	case !kafkaHealth.Connected:
+		kafkaCheck.Status = "degraded"
+		degraded = true
+	}
+	response.Checks["kafka"] = kafkaCheck
 
+	// Audit forwarding is optional too: records wait in a backlog while the
+	// SIEM is unreachable and are dropped, and counted, once it is full
+	forwarderCheck := HealthCheck{Status: "disabled"}
+	if h.auditForwarder != nil {
+		forwarderHealth := h.auditForwarder.Health()
+		forwarderCheck = HealthCheck{Status: "healthy", Details: forwarderHealth}
+		if forwarderHealth.Failing {
+			forwarderCheck.Status = "degraded"
+			forwarderCheck.Error = forwarderHealth.LastError
+			degraded = true
+		}
+	}
+	response.Checks["audit_forwarder"] = forwarderCheck
+
+	w.Header().Set("Content-Type", "application/json")
 	if allHealthy {
 		response.Status = "healthy"
+		if degraded {
+			response.Status = "degraded"
+		}
 		w.WriteHeader(http.StatusOK)
 	}else{
 		response.Status = "unhealthy"
 		w.WriteHeader(http.StatusServiceUnavailable)
 	}
-	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
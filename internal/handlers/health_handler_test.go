@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/white/user-management/pkg/siem"
+)
+
+// unreachableSIEM fails every send
+type unreachableSIEM struct{}
+
+func (unreachableSIEM) Send(ctx context.Context, payload []byte) error {
+	return errors.New("connection refused")
+}
+func (unreachableSIEM) Name() string { return siem.TransportSyslog }
+func (unreachableSIEM) Close() error { return nil }
+
+// TestHealthReportsTheAuditForwarder checks /health reports the backlog of
+// the SIEM forwarder, and a failing SIEM as degraded rather than unhealthy
+func TestHealthReportsTheAuditForwarder(t *testing.T) {
+	health := func(h *HealthHandler) (int, HealthResponse) {
+		rec := httptest.NewRecorder()
+		h.GetOverallHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var response HealthResponse
+		decodeBody(t, rec, &response)
+		return rec.Code, response
+	}
+
+	h := NewHealthHandler(nil)
+	if code, response := health(h); code != http.StatusOK || response.Checks["audit_forwarder"].Status != "disabled" {
+		t.Errorf("health without forwarding = %d %+v", code, response.Checks["audit_forwarder"])
+	}
+
+	forwarder := siem.NewForwarder(unreachableSIEM{}, siem.ForwarderConfig{BufferSize: 10})
+	h.SetAuditForwarder(forwarder)
+	for i := 0; i < 3; i++ {
+		forwarder.Forward(siem.Record{ID: "evt"})
+	}
+	code, response := health(h)
+	check := response.Checks["audit_forwarder"]
+	details, _ := check.Details.(map[string]interface{})
+	if code != http.StatusOK || check.Status != "healthy" || details["backlog"] != 3.0 || details["capacity"] != 10.0 {
+		t.Errorf("health with a backlog = %d %+v", code, check)
+	}
+
+	// Running it through the queue with no retries leaves the SIEM failing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forwarder.Run(ctx)
+	code, response = health(h)
+	check = response.Checks["audit_forwarder"]
+	if code != http.StatusOK || response.Status != "degraded" || check.Status != "degraded" || check.Error != "connection refused" {
+		t.Errorf("health with the SIEM failing = %d %s %+v", code, response.Status, check)
+	}
+}
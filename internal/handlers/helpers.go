@@ -1,10 +1,32 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/i18n"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/validation"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/kafka"
 )
 
+// eventPublishTimeout bounds a fire-and-forget Kafka publish or outbox write
+const eventPublishTimeout = 5 * time.Second
+
 // respondWithJSON writes a JSON response
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, err := json.Marshal(payload)
@@ -19,7 +41,290 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
-// respondWithError writes an error response
+// ErrorResponse is the body written by respondWithError
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// CodedErrorResponse is the body written by respondWithErrorCode
+type CodedErrorResponse struct {
+	Success bool        `json:"success"`
+	Error   ErrorDetail `json:"error"`
+}
+
+// ErrorDetail is a machine-readable error code with its message
+type ErrorDetail struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"` // Why each invalid field was rejected, by JSON path
+}
+
+// MessageResponse is the body of endpoints that only confirm an action
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// SuccessResponse is the body of endpoints that confirm an action in the
+// success/message shape
+type SuccessResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+// DataResponse is the body of endpoints answering with a resource in the
+// success/data shape
+type DataResponse[T any] struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Data    T      `json:"data"`
+}
+
+// respondWithError writes an error response, its message in the request's
+// language
 func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
+	respondWithJSON(w, code, ErrorResponse{Error: i18n.FromResponse(w).Error(message)})
+}
+
+// respondWithErrorCode writes an error response with a machine-readable
+// code, its message in the request's language
+func respondWithErrorCode(w http.ResponseWriter, status int, code, message string) {
+	respondWithJSON(w, status, CodedErrorResponse{
+		Error: ErrorDetail{Code: code, Message: i18n.FromResponse(w).Error(message)},
+	})
+}
+
+// decodeAndValidate decodes the JSON request body into dst with decodeJSON
+// and checks it against the validate tags of its fields. A body that breaks
+// the rules is answered with 400 VALIDATION_FAILED and the invalid fields.
+// It returns false once it has responded.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if !decodeJSON(w, r, dst) {
+		return false
+	}
+	return validateRequest(w, dst)
+}
+
+// decodeJSON decodes the JSON request body into dst, within the body limit
+// the request was given by middleware.BodyLimit. Fields dst does not
+// declare are rejected, to catch client typos. On failure it responds with
+// the coded error and returns false:
+//   - 415 UNSUPPORTED_MEDIA_TYPE when the body is not application/json
+//   - 413 BODY_TOO_LARGE when the body is over the limit
+//   - 400 UNKNOWN_FIELD when it has a field dst does not declare
+//   - 400 MALFORMED_JSON when it is not a single JSON value of dst's shape
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeJSONLimit(w, r, dst, middleware.GetBodyLimit(r))
+}
+
+// decodeJSONLimit is decodeJSON with a limit of its own, for endpoints that
+// take documents larger than the configured one
+func decodeJSONLimit(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64) bool {
+	if !isJSONContent(r.Header.Get("Content-Type")) {
+		respondWithErrorCode(w, http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE", "Request body must be application/json")
+		return false
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		respondWithDecodeError(w, err, limit)
+		return false
+	}
+	// Anything after the value but whitespace is a second value or garbage
+	var extra json.RawMessage
+	if err := decoder.Decode(&extra); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithDecodeError(w, err, limit)
+			return false
+		}
+		respondWithErrorCode(w, http.StatusBadRequest, "MALFORMED_JSON", "Malformed JSON: the body must hold a single JSON value")
+		return false
+	}
+	return true
+}
+
+// respondWithDecodeError answers a body that did not decode with the code
+// of what went wrong
+func respondWithDecodeError(w http.ResponseWriter, err error, limit int64) {
+	var tooLarge *http.MaxBytesError
+	var wrongType *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		respondWithErrorCode(w, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", fmt.Sprintf("Request body too large: the limit is %d bytes", limit))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		respondWithErrorCode(w, http.StatusBadRequest, "UNKNOWN_FIELD", "Unknown field: "+strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`))
+	case errors.As(err, &wrongType) && wrongType.Field != "":
+		respondWithErrorCode(w, http.StatusBadRequest, "MALFORMED_JSON", fmt.Sprintf("Malformed JSON: %s must be %s", wrongType.Field, wrongType.Type))
+	case errors.Is(err, io.EOF):
+		respondWithErrorCode(w, http.StatusBadRequest, "MALFORMED_JSON", "Malformed JSON: the body is empty")
+	default:
+		respondWithErrorCode(w, http.StatusBadRequest, "MALFORMED_JSON", "Malformed JSON: "+err.Error())
+	}
+}
+
+// isJSONContent reports whether a Content-Type header is JSON:
+// application/json or a +json type such as application/merge-patch+json
+func isJSONContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// validateRequest checks a decoded request against the validate tags of its
+// fields, responding with 400 and the invalid fields when it breaks them
+func validateRequest(w http.ResponseWriter, req interface{}) bool {
+	err := validation.Struct(req)
+	if err == nil {
+		return true
+	}
+	var fields validation.Errors
+	if !errors.As(err, &fields) {
+		log.Printf("Error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	respondWithInvalidFields(w, fields)
+	return false
+}
+
+// respondWithInvalidFields writes a 400 VALIDATION_FAILED response listing
+// the invalid fields, for checks the validate tags cannot express
+func respondWithInvalidFields(w http.ResponseWriter, fields validation.Errors) {
+	respondWithJSON(w, http.StatusBadRequest, CodedErrorResponse{
+		Error: ErrorDetail{Code: "VALIDATION_FAILED", Message: "Invalid fields: " + fields.Error(), Fields: fields},
+	})
+}
+
+// requestScope returns the caller's data scope and the claims its filters
+// are built from
+func requestScope(r *http.Request, userRepo repositories.UserStore) (models.DataScope, services.ScopeClaims, error) {
+	ctx := r.Context()
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok {
+		return models.DataScope{}, services.ScopeClaims{}, fmt.Errorf("user ID not found")
+	}
+	team, _ := ctx.Value(middleware.TeamKey).(string)
+	// region, _ := ctx.Value(middleware.RegionKey).(string)
+	region := ""
+
+	dataScope := requestDataScope(r)
+
+	teamUserIDs, err := services.GetTeamUserIDs(ctx, userRepo, team)
+	if err != nil {
+		return models.DataScope{}, services.ScopeClaims{}, err
+	}
+	return dataScope, services.ScopeClaims{UserID: userID, Team: team, Region: region, TeamUserIDs: teamUserIDs}, nil
+}
+
+// requestDataScope returns the data scope RBACContext resolved for the
+// caller's role, or unrestricted when none was resolved
+func requestDataScope(r *http.Request) models.DataScope {
+	if ds, ok := r.Context().Value(middleware.DataScopeKey).(models.DataScope); ok {
+		return ds
+	}
+	return models.DataScope{Customers: "all", Campaigns: "all"}
+}
+
+// publishEvent publishes a fire-and-forget Kafka event. The publish keeps the
+// request's values but not its cancellation, so a client disconnecting after a
+// committed write doesn't drop the event; eventPublishTimeout bounds it instead.
+// Failures are logged, never returned. Use it for lossy telemetry only;
+// domain events go through recordEvent.
+func publishEvent(ctx context.Context, producer *kafka.Producer, event events.Event) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventPublishTimeout)
+	defer cancel()
+	if err := events.Publish(ctx, producer, event); err != nil {
+		log.Printf("Warning: failed to publish %s event: %v", event.Topic(), err)
+	}
+}
+
+// recordEvent writes a domain event to the events outbox, from which the
+// relay publishes it to Kafka in order. Like publishEvent it survives the
+// client disconnecting and only logs failures; unlike it, a recorded event
+// is not lost when the broker is down.
+func recordEvent(ctx context.Context, outbox events.EventRecorder, event events.Event) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventPublishTimeout)
+	defer cancel()
+	if err := events.Record(ctx, outbox, event); err != nil {
+		log.Printf("Warning: failed to record %s event: %v", event.Topic(), err)
+	}
+}
+
+// emailTrackingEnabled reports whether the user's communication preferences
+// allow open/click tracking on outgoing email. Any lookup failure disables
+// tracking so a body is never rewritten without consent.
+func emailTrackingEnabled(ctx context.Context, settingsRepo repositories.SettingsStore, userID string) bool {
+	if settingsRepo == nil || userID == "" {
+		return false
+	}
+	prefs, err := settingsRepo.GetCommunicationPreferences(ctx, userID)
+	if err != nil || prefs == nil {
+		return false
+	}
+	return prefs.EmailPreferences.EnableTracking
+}
+
+// deliverEmail sends msg through the configured provider and marks the stored
+// communication sent, recording the provider's message ID. A message that
+// fails stays queued for the outbox worker to retry. A failure to update the
+// record is logged; the email has already gone out.
+func deliverEmail(ctx context.Context, sender email.EmailSender, emailRepo repositories.EmailStore, msg *models.CommMessage) error {
+	if err := sender.SendEmail(ctx, msg); err != nil {
+		return err
+	}
+	if emailRepo != nil && sender.Capabilities().Delivers {
+		if err := emailRepo.MarkSent(ctx, msg.MessageID, sender.Name(), msg.ExternalID); err != nil {
+			log.Printf("Warning: failed to mark email %s as sent: %v", msg.MessageID, err)
+		}
+	}
+	return nil
+}
+
+// parsePage reads the page (default 1) and limit (default 50, capped at
+// 100) query parameters, writing a 400 response when either is invalid
+func parsePage(w http.ResponseWriter, r *http.Request) (page, limit int, ok bool) {
+	query := r.URL.Query()
+
+	page = 1
+	if pageStr := query.Get("page"); pageStr != "" {
+		p, err := strconv.Atoi(pageStr)
+		if err != nil || p < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid page number")
+			return 0, 0, false
+		}
+		page = p
+	}
+
+	limit = 50
+	if limitStr := query.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit value")
+			return 0, 0, false
+		}
+		if l > 100 {
+			l = 100
+		}
+		limit = l
+	}
+
+	return page, limit, true
+}
+
+// parseDryRun reads the optional dry_run query parameter, writing a 400
+// response when it is not a boolean
+func parseDryRun(w http.ResponseWriter, r *http.Request) (dryRun, ok bool) {
+	value := r.URL.Query().Get("dry_run")
+	if value == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", "Invalid dry_run value, must be true or false")
+		return false, false
+	}
+	return dryRun, true
 }
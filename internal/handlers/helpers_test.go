@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/services"
+)
+
+type decodeTarget struct {
+	Name  string `json:"name" validate:"required,max=20"`
+	Count int    `json:"count"`
+}
+
+// decodeRequest runs decodeAndValidate over a request with body and
+// contentType, behind a BodyLimit of limit
+func decodeRequest(t *testing.T, body, contentType string, limit int64) (*httptest.ResponseRecorder, decodeTarget, bool) {
+	t.Helper()
+	var dst decodeTarget
+	var decoded bool
+	handler := middleware.BodyLimit(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if decoded = decodeAndValidate(w, r, &dst); decoded {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, dst, decoded
+}
+
+func TestDecodeJSONAcceptsOneJSONValue(t *testing.T) {
+	for _, tt := range []struct {
+		name, body, contentType string
+	}{
+		{"plain", `{"name":"widget","count":2}`, "application/json"},
+		{"charset", `{"name":"widget","count":2}`, "application/json; charset=utf-8"},
+		{"+json type", `{"name":"widget","count":2}`, "application/merge-patch+json"},
+		{"trailing whitespace", "{\"name\":\"widget\",\"count\":2}\n\t ", "application/json"},
+	} {
+		rec, dst, ok := decodeRequest(t, tt.body, tt.contentType, 1024)
+		if !ok || dst.Name != "widget" || dst.Count != 2 {
+			t.Errorf("%s = %d %s, decoded %+v", tt.name, rec.Code, rec.Body, dst)
+		}
+	}
+}
+
+// TestDecodeJSONFailureCodes sends each kind of unacceptable body and
+// checks it is refused with its own status and code
+func TestDecodeJSONFailureCodes(t *testing.T) {
+	for _, tt := range []struct {
+		name, body, contentType string
+		status                  int
+		code                    string
+	}{
+		{"no content type", `{"name":"widget"}`, "", http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE"},
+		{"form", "name=widget", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE"},
+		{"text", `{"name":"widget"}`, "text/plain", http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE"},
+		{"unparseable content type", `{"name":"widget"}`, "application/json; charset", http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE"},
+		{"over the limit", `{"name":"` + strings.Repeat("w", 2000) + `"}`, "application/json", http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE"},
+		{"over the limit after the value", `{"name":"widget"}` + strings.Repeat(" ", 2000) + "{}", "application/json", http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE"},
+		{"unknown field", `{"name":"widget","colour":"red"}`, "application/json", http.StatusBadRequest, "UNKNOWN_FIELD"},
+		{"second value", `{"name":"widget"}{"name":"gadget"}`, "application/json", http.StatusBadRequest, "MALFORMED_JSON"},
+		{"trailing garbage", `{"name":"widget"} trailing`, "application/json", http.StatusBadRequest, "MALFORMED_JSON"},
+		{"truncated", `{"name":"wid`, "application/json", http.StatusBadRequest, "MALFORMED_JSON"},
+		{"wrong type", `{"name":"widget","count":"two"}`, "application/json", http.StatusBadRequest, "MALFORMED_JSON"},
+		{"array", `[{"name":"widget"}]`, "application/json", http.StatusBadRequest, "MALFORMED_JSON"},
+		{"empty", ``, "application/json", http.StatusBadRequest, "MALFORMED_JSON"},
+		{"invalid", `{"name":""}`, "application/json", http.StatusBadRequest, "VALIDATION_FAILED"},
+	} {
+		rec, _, ok := decodeRequest(t, tt.body, tt.contentType, 1024)
+		if ok {
+			t.Errorf("%s: decoded", tt.name)
+			continue
+		}
+		var body CodedErrorResponse
+		decodeBody(t, rec, &body)
+		if rec.Code != tt.status || body.Error.Code != tt.code {
+			t.Errorf("%s = %d %s, want %d %s", tt.name, rec.Code, body.Error.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestDecodeJSONNamesTheProblem(t *testing.T) {
+	for _, tt := range []struct {
+		body, want string
+	}{
+		{`{"name":"widget","colour":"red"}`, "Unknown field: colour"},
+		{`{"name":"widget","count":"two"}`, "count must be int"},
+		{``, "the body is empty"},
+		{`{"name":"widget"} {}`, "a single JSON value"},
+	} {
+		rec, _, _ := decodeRequest(t, tt.body, "application/json", 1024)
+		var body CodedErrorResponse
+		decodeBody(t, rec, &body)
+		if !strings.Contains(body.Error.Message, tt.want) {
+			t.Errorf("%q: message %q, want it to say %q", tt.body, body.Error.Message, tt.want)
+		}
+	}
+}
+
+// TestBodyLimitDefaultsWhenUnset checks requests that BodyLimit did not
+// see, or was given no limit for, are decoded within DefaultBodyLimit
+func TestBodyLimitDefaultsWhenUnset(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	if got := middleware.GetBodyLimit(req); got != middleware.DefaultBodyLimit {
+		t.Errorf("limit without the middleware = %d, want %d", got, middleware.DefaultBodyLimit)
+	}
+	if rec, _, ok := decodeRequest(t, `{"name":"`+strings.Repeat("w", 2000)+`"}`, "application/json", 0); ok || rec.Code != http.StatusBadRequest {
+		t.Errorf("2 KB body with no limit configured = %d, want it read and failing validation", rec.Code)
+	}
+}
+
+// TestOptionalBodiesMayBeLeftOut publishes a template with no body, and
+// checks a body that is sent is still decoded strictly
+func TestOptionalBodiesMayBeLeftOut(t *testing.T) {
+	f := newTemplateFixture(t)
+	author := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+
+	publish := func(template string, body interface{}, contentType string) *httptest.ResponseRecorder {
+		t.Helper()
+		var header http.Header
+		if contentType != "" {
+			header = http.Header{"Content-Type": {contentType}}
+		}
+		return f.doHeader(context.Background(), author, http.MethodPost, "/api/v1/templates/"+template+"/publish", body, header)
+	}
+
+	// Neither a body nor a content type is needed when the body is optional
+	if rec := publish(f.createTemplate(author, "No body").ID, nil, ""); rec.Code != http.StatusOK {
+		t.Errorf("publish without a body = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if rec := publish(f.createTemplate(author, "Empty object").ID, `{}`, "application/json"); rec.Code != http.StatusOK {
+		t.Errorf("publish with {} = %d %s, want 200", rec.Code, rec.Body)
+	}
+
+	template := f.createTemplate(author, "Strict").ID
+	for _, tt := range []struct {
+		name, body, contentType string
+		status                  int
+		code                    string
+	}{
+		{"unknown field", `{"forced":true}`, "application/json", http.StatusBadRequest, "UNKNOWN_FIELD"},
+		{"trailing data", `{"force":true} {}`, "application/json", http.StatusBadRequest, "MALFORMED_JSON"},
+		{"not JSON", `force=true`, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE"},
+	} {
+		if detail := errorDetail(t, publish(template, tt.body, tt.contentType), tt.status); detail.Code != tt.code {
+			t.Errorf("%s = %s, want %s", tt.name, detail.Code, tt.code)
+		}
+	}
+}
+
+// TestMultipartUploadsAreExemptFromJSONChecks posts a CSV import larger
+// than the JSON body limit as multipart, and checks it reaches the import
+// rather than being refused as too large or not JSON
+func TestMultipartUploadsAreExemptFromJSONChecks(t *testing.T) {
+	h := NewUserImportHandler(services.NewUserImporter(nil, nil, ""), nil, nil)
+	handler := middleware.BodyLimit(1024)(http.HandlerFunc(h.ImportUsers))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "users.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A header padded past the JSON limit, and no rows
+	file.Write([]byte("email,first name,last name" + strings.Repeat(",", 2000) + "\n"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code == http.StatusRequestEntityTooLarge || rec.Code == http.StatusUnsupportedMediaType {
+		t.Fatalf("multipart import = %d %s, want it past the JSON checks", rec.Code, rec.Body)
+	}
+	var coded CodedErrorResponse
+	decodeBody(t, rec, &coded)
+	if coded.Error.Code != "INVALID_IMPORT_FILE" {
+		t.Errorf("multipart import = %d %s, want the import to reject the file itself", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/clientip"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// impersonationTTL is how long an impersonation token is valid. It cannot be
+// refreshed, so support staff start a new impersonation to continue.
+const impersonationTTL = 15 * time.Minute
+
+// ImpersonationHandler lets support staff act as another user to debug what
+// that user sees. Every start and end is audited against the real operator.
+type ImpersonationHandler struct {
+	users          repositories.UserStore
+	sessions       repositories.ImpersonationStore
+	jwtService     *utils.JWTService
+	auditPublisher *events.AuditPublisher
+}
+
+// NewImpersonationHandler creates a new ImpersonationHandler
+func NewImpersonationHandler(users repositories.UserStore, sessions repositories.ImpersonationStore, jwtService *utils.JWTService, auditPublisher *events.AuditPublisher) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		users:          users,
+		sessions:       sessions,
+		jwtService:     jwtService,
+		auditPublisher: auditPublisher,
+	}
+}
+
+// ImpersonationResponse is the access token of a new impersonation
+type ImpersonationResponse struct {
+	AccessToken   string                       `json:"access_token"`
+	TokenType     string                       `json:"token_type"`
+	ExpiresIn     int                          `json:"expires_in"`
+	Impersonation *models.ImpersonationSession `json:"impersonation"`
+}
+
+// StartImpersonation issues a short-lived, non-refreshable access token for
+// the user, carrying the caller as the act claim. Admins, inactive users and
+// the caller themselves cannot be impersonated.
+// POST /api/v1/admin/impersonate/{userID}
+// @Summary Start impersonating a user
+// @Description Issues a short-lived, non-refreshable access token for the user with the caller as the act claim
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param userID path string true "User to impersonate"
+// @Param impersonationRequest body models.StartImpersonationRequest false "Reason for the impersonation"
+// @Success 201 {object} ImpersonationResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid body or user ID, the caller, or an inactive user"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Missing permission, impersonating, or an admin target"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/impersonate/{userID} [post]
+func (h *ImpersonationHandler) StartImpersonation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	actorID := middleware.GetUserID(r)
+
+	var req models.StartImpersonationRequest
+	if r.Body != nil && r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	targetID, err := uuid.ParseUUID(mux.Vars(r)["userID"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if targetID == actorID {
+		respondWithError(w, http.StatusBadRequest, "You cannot impersonate yourself")
+		return
+	}
+
+	actor, err := h.users.GetByID(ctx, actorID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "User not found")
+		return
+	}
+	target, err := h.users.GetByID(ctx, targetID)
+	if err != nil {
+		if repositories.IsUserNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user: "+err.Error())
+		return
+	}
+	// Users of other tenants are not revealed
+	if target.Tenant() != actor.Tenant() {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if !target.IsActive {
+		respondWithError(w, http.StatusBadRequest, "Inactive users cannot be impersonated")
+		return
+	}
+	// Impersonating an admin would hand support staff admin access
+	if target.Role == models.UserRoleAdmin {
+		respondWithErrorCode(w, http.StatusForbidden, "IMPERSONATION_FORBIDDEN", "Admins cannot be impersonated")
+		return
+	}
+
+	now := time.Now()
+	session := &models.ImpersonationSession{
+		ID:           uuid.MustNewUUID(),
+		ActorID:      actor.ID,
+		ActorEmail:   actor.Email,
+		ActorName:    actor.Name,
+		TargetUserID: target.ID,
+		TargetEmail:  target.Email,
+		Reason:       strings.TrimSpace(req.Reason),
+		StartedAt:    now,
+		ExpiresAt:    now.Add(impersonationTTL),
+		IPAddress:    clientip.FromRequest(r),
+	}
+	if err := h.sessions.CreateImpersonation(ctx, session); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start impersonation: "+err.Error())
+		return
+	}
+
+	token, err := h.jwtService.GenerateImpersonationToken(target, actor, session.ID, session.ExpiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate impersonation token")
+		return
+	}
+
+	if h.auditPublisher != nil {
+		details := fmt.Sprintf("Started impersonating %s (%s)", target.Name, target.Email)
+		if session.Reason != "" {
+			details += " - reason: " + session.Reason
+		}
+		h.auditPublisher.PublishSessionEvent(r, actor.ID, actor.Name, events.ActionImpersonationStarted, session.ID, target.ID, details)
+	}
+
+	respondWithJSON(w, http.StatusCreated, ImpersonationResponse{
+		AccessToken:   token,
+		TokenType:     "Bearer",
+		ExpiresIn:     int(impersonationTTL.Seconds()),
+		Impersonation: session,
+	})
+}
+
+// ImpersonationEnded is the response to ending the impersonation of a user
+type ImpersonationEnded struct {
+	Message string `json:"message"`
+	Ended   int    `json:"ended"` // Impersonation sessions ended
+}
+
+// EndImpersonation ends impersonating the user before the token expires and
+// revokes its token. Called with the impersonation token it ends that
+// session; called by the operator with their own token it ends all of their
+// active sessions as the user.
+// DELETE /api/v1/admin/impersonate/{userID}
+// @Summary End impersonating a user
+// @Description Ends the impersonation and revokes its token. With the impersonation token it ends that session; with the operator's token it ends all of their sessions as the user.
+// @Tags Admin
+// @Produce json
+// @Param userID path string true "Impersonated user"
+// @Success 200 {object} ImpersonationEnded "Impersonation ended"
+// @Failure 400 {object} ErrorResponse "Invalid user ID, or the impersonation token is for another user"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Missing permission"
+// @Failure 404 {object} ErrorResponse "No active impersonation of this user"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/impersonate/{userID} [delete]
+func (h *ImpersonationHandler) EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	targetID, err := uuid.ParseUUID(mux.Vars(r)["userID"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var sessions []*models.ImpersonationSession
+	if impersonator, ok := middleware.GetImpersonator(r); ok {
+		if middleware.GetUserID(r) != targetID {
+			respondWithError(w, http.StatusBadRequest, "The impersonation token is for another user")
+			return
+		}
+		session, err := h.sessions.GetImpersonation(ctx, impersonator.SessionID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to get impersonation: "+err.Error())
+			return
+		}
+		sessions = []*models.ImpersonationSession{session}
+	} else {
+		// The route checked the operator's permission
+		var err error
+		sessions, err = h.sessions.ListActiveImpersonations(ctx, middleware.GetUserID(r), targetID, time.Now())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to list impersonations: "+err.Error())
+			return
+		}
+	}
+
+	ended := 0
+	now := time.Now()
+	for _, session := range sessions {
+		ok, err := h.sessions.EndImpersonation(ctx, session.ID, now)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to end impersonation: "+err.Error())
+			return
+		}
+		if !ok {
+			continue
+		}
+		ended++
+		if h.auditPublisher != nil {
+			h.auditPublisher.PublishSessionEvent(r, session.ActorID, session.ActorName, events.ActionImpersonationEnded, session.ID, session.TargetUserID,
+				fmt.Sprintf("Stopped impersonating %s", session.TargetEmail))
+		}
+	}
+
+	if ended == 0 {
+		respondWithError(w, http.StatusNotFound, "No active impersonation of this user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, ImpersonationEnded{
+		Message: "Impersonation ended",
+		Ended:   ended,
+	})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// LoginHistoryHandler serves the sign-in attempts of users, to the users
+// themselves and to administrators
+type LoginHistoryHandler struct {
+	history repositories.LoginHistoryStore
+	users   repositories.UserStore
+}
+
+// NewLoginHistoryHandler creates a new LoginHistoryHandler
+func NewLoginHistoryHandler(history repositories.LoginHistoryStore, users repositories.UserStore) *LoginHistoryHandler {
+	return &LoginHistoryHandler{history: history, users: users}
+}
+
+// GetMyLoginHistory lists the caller's sign-in attempts newest first
+// GET /api/v1/auth/login-history
+// @Summary List my sign-in attempts
+// @Description Lists the caller's successful and rejected sign-ins of the last 90 days newest first, with the client's IP address, browser, operating system and device
+// @Tags Authentication
+// @Produce json
+// @Param success query bool false "Only successful (true) or rejected (false) sign-ins"
+// @Param from query string false "Only sign-ins at or after this time (RFC 3339)"
+// @Param to query string false "Only sign-ins before this time (RFC 3339)"
+// @Param limit query int false "Number of sign-ins to return (default 50, max 100)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param offset query int false "Number of sign-ins to skip, for offset paging with a total"
+// @Param page query int false "Page number, for page paging with a total"
+// @Success 200 {object} pagination.Envelope[models.LoginRecord] "total only with offset or page paging"
+// @Failure 400 {object} ErrorResponse "Invalid filter or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /auth/login-history [get]
+func (h *LoginHistoryHandler) GetMyLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	h.respondWithLoginHistory(w, r, userID)
+}
+
+// GetUserLoginHistory lists a user's sign-in attempts newest first
+// GET /api/v1/admin/users/{id}/login-history
+// @Summary List a user's sign-in attempts
+// @Description Lists the user's successful and rejected sign-ins of the last 90 days newest first, with the client's IP address, browser, operating system and device
+// @Tags Users
+// @Produce json
+// @Param id path string true "User ID"
+// @Param success query bool false "Only successful (true) or rejected (false) sign-ins"
+// @Param from query string false "Only sign-ins at or after this time (RFC 3339)"
+// @Param to query string false "Only sign-ins before this time (RFC 3339)"
+// @Param limit query int false "Number of sign-ins to return (default 50, max 100)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param offset query int false "Number of sign-ins to skip, for offset paging with a total"
+// @Param page query int false "Page number, for page paging with a total"
+// @Success 200 {object} pagination.Envelope[models.LoginRecord] "total only with offset or page paging"
+// @Failure 400 {object} ErrorResponse "Invalid user ID, filter or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/login-history [get]
+func (h *LoginHistoryHandler) GetUserLoginHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if _, err := h.users.GetByID(r.Context(), id); err != nil {
+		if repositories.IsUserNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user: "+err.Error())
+		return
+	}
+	h.respondWithLoginHistory(w, r, id)
+}
+
+func (h *LoginHistoryHandler) respondWithLoginHistory(w http.ResponseWriter, r *http.Request, userID string) {
+	filter, err := parseLoginHistoryFilter(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := h.history.ListLoginHistory(r.Context(), userID, filter, page)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get login history: "+err.Error())
+		return
+	}
+
+	envelope := pagination.NewEnvelope(page, records, func(record models.LoginRecord) pagination.Cursor {
+		return pagination.Cursor{SortValue: record.Timestamp, ID: record.ID.Hex()}
+	})
+	if page.PageMode {
+		total, err := h.history.CountLoginHistory(r.Context(), userID, filter)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count login history: "+err.Error())
+			return
+		}
+		envelope = envelope.WithTotal(total)
+	}
+
+	respondWithJSON(w, http.StatusOK, envelope)
+}
+
+// parseLoginHistoryFilter reads the success, from and to query parameters
+func parseLoginHistoryFilter(r *http.Request) (models.LoginHistoryFilter, error) {
+	query := r.URL.Query()
+	var filter models.LoginHistoryFilter
+
+	if success := query.Get("success"); success != "" {
+		b, err := strconv.ParseBool(success)
+		if err != nil {
+			return filter, errors.New("Invalid success, must be true or false")
+		}
+		filter.Success = &b
+	}
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, errors.New("Invalid from date, expected RFC 3339")
+		}
+		filter.From = &t
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, errors.New("Invalid to date, expected RFC 3339")
+		}
+		filter.To = &t
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return filter, errors.New("The to date must not be before the from date")
+	}
+
+	return filter, nil
+}
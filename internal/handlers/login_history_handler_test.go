@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// TestLoginHistoryRecordsSignIns signs in with a right and a wrong password
+// and lists both attempts, newest first, filtered by outcome
+func TestLoginHistoryRecordsSignIns(t *testing.T) {
+	f := newAuthFixture(t)
+	store := memory.NewLoginHistoryStore()
+	recorder := services.NewLoginHistoryRecorder(store)
+	f.handler.SetLoginHistory(recorder)
+	history := NewLoginHistoryHandler(store, f.users)
+	f.handle(http.MethodGet, "/api/v1/auth/login-history", history.GetMyLoginHistory)
+	user := f.addUser("dana@example.test", "correct horse")
+	other := f.addUser("sam@example.test", "battery staple")
+
+	f.login(user.Email, "wrong horse")
+	f.login(user.Email, "correct horse")
+	f.login(other.Email, "battery staple")
+
+	// Run stores what is queued once its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder.Run(ctx)
+
+	list := func(query string) []models.LoginRecord {
+		t.Helper()
+		rec := f.do(user, http.MethodGet, "/api/v1/auth/login-history"+query, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login history%s = %d %s", query, rec.Code, rec.Body)
+		}
+		var body pagination.Envelope[models.LoginRecord]
+		decodeBody(t, rec, &body)
+		return body.Items
+	}
+
+	records := list("")
+	if len(records) != 2 {
+		t.Fatalf("%d sign-ins listed, want the 2 of the user", len(records))
+	}
+	for _, record := range records {
+		if record.UserID != user.ID || record.Method != models.LoginMethodPassword {
+			t.Errorf("record = user %s method %q, want the user's password sign-ins", record.UserID, record.Method)
+		}
+	}
+	if !records[0].Success || records[1].Success {
+		t.Errorf("successes = %v, %v; want the successful sign-in first", records[0].Success, records[1].Success)
+	}
+
+	if failed := list("?success=false"); len(failed) != 1 || failed[0].Success {
+		t.Errorf("failed sign-ins = %+v, want the wrong password", failed)
+	}
+}
+
+// TestUserLoginHistoryNormalizesTheID checks an admin finds a user's
+// sign-ins by an ID sent in upper case, though users are stored, and looked
+// up, by the lowercase form, and that near-miss IDs are rejected
+func TestUserLoginHistoryNormalizesTheID(t *testing.T) {
+	f := newAuthFixture(t)
+	store := memory.NewLoginHistoryStore()
+	recorder := services.NewLoginHistoryRecorder(store)
+	f.handler.SetLoginHistory(recorder)
+	history := NewLoginHistoryHandler(store, f.users)
+	f.handle(http.MethodGet, "/api/v1/admin/users/{id}/login-history", history.GetUserLoginHistory)
+	admin := f.addUser("admin@example.test", "correct horse")
+	user := f.addUser("dana@example.test", "correct horse")
+	f.login(user.Email, "correct horse")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder.Run(ctx)
+
+	// The store itself matches IDs exactly
+	if _, err := f.users.GetByID(context.Background(), strings.ToUpper(user.ID)); err == nil {
+		t.Fatal("the user store matched an uppercase ID; the test needs a case-sensitive store")
+	}
+
+	rec := f.do(admin, http.MethodGet, "/api/v1/admin/users/"+strings.ToUpper(user.ID)+"/login-history", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login history by uppercase ID = %d %s", rec.Code, rec.Body)
+	}
+	var body pagination.Envelope[models.LoginRecord]
+	decodeBody(t, rec, &body)
+	if len(body.Items) != 1 || body.Items[0].UserID != user.ID {
+		t.Errorf("login history by uppercase ID = %+v, want the user's sign-in", body.Items)
+	}
+
+	for _, id := range []string{user.ID[:31], user.ID + "0", strings.ReplaceAll(user.ID, "-", ""), "{" + user.ID[1:35] + "}"} {
+		if rec := f.do(admin, http.MethodGet, "/api/v1/admin/users/"+id+"/login-history", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("login history of %q = %d, want 400", id, rec.Code)
+		}
+	}
+	if rec := f.do(admin, http.MethodGet, "/api/v1/admin/users/"+uuid.MustNewUUID()+"/login-history", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("login history of an unknown user = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// NotificationHandler serves the signed-in user's in-app notification feed
+type NotificationHandler struct {
+	notificationRepo repositories.NotificationStore
+}
+
+// NewNotificationHandler creates a new NotificationHandler
+func NewNotificationHandler(notificationRepo repositories.NotificationStore) *NotificationHandler {
+	return &NotificationHandler{notificationRepo: notificationRepo}
+}
+
+// NotificationListResponse is a page of the caller's notifications
+type NotificationListResponse struct {
+	Notifications []*models.Notification `json:"notifications"`
+	UnreadCount   int64                  `json:"unreadCount"` // Across all pages
+	Total         int64                  `json:"total"`
+	Page          int                    `json:"page"`
+	Limit         int                    `json:"limit"`
+	TotalPages    int                    `json:"totalPages"`
+}
+
+// NotificationReadResponse is a notification marked read and the unread
+// notifications left
+type NotificationReadResponse struct {
+	Notification *models.Notification `json:"notification"`
+	UnreadCount  int64                `json:"unreadCount"`
+}
+
+// ListNotifications lists the caller's notifications newest first, paginated
+// with page/limit, along with their unread count. unread=true lists only
+// unread notifications.
+// GET /api/v1/notifications
+// @Summary List notifications
+// @Description Lists the caller's in-app notifications newest first, with the unread count
+// @Tags Notifications
+// @Produce json
+// @Param unread query bool false "Only unread notifications"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size"
+// @Success 200 {object} NotificationListResponse "notifications, unreadCount, total, page, limit"
+// @Failure 400 {object} ErrorResponse "Invalid unread or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /notifications [get]
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	unreadOnly := false
+	if unread := r.URL.Query().Get("unread"); unread != "" {
+		var err error
+		if unreadOnly, err = strconv.ParseBool(unread); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid unread, must be true or false")
+			return
+		}
+	}
+
+	page, limit, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	notifications, total, err := h.notificationRepo.ListNotifications(r.Context(), userID, unreadOnly, limit, (page-1)*limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list notifications: "+err.Error())
+		return
+	}
+	unreadCount, err := h.notificationRepo.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count unread notifications: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, NotificationListResponse{
+		Notifications: notifications,
+		UnreadCount:   unreadCount,
+		Total:         total,
+		Page:          page,
+		Limit:         limit,
+		TotalPages:    (int(total) + limit - 1) / limit,
+	})
+}
+
+// MarkNotificationRead marks one of the caller's notifications read and
+// returns it with the remaining unread count. Marking a read notification
+// again changes nothing.
+// PATCH /api/v1/notifications/{id}/read
+// @Summary Mark a notification read
+// @Description Marks one of the caller's notifications read and returns it with the remaining unread count
+// @Tags Notifications
+// @Produce json
+// @Param id path string true "Notification ID"
+// @Success 200 {object} NotificationReadResponse "notification and unreadCount"
+// @Failure 400 {object} ErrorResponse "Invalid notification ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Notification not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /notifications/{id}/read [patch]
+func (h *NotificationHandler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	id, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+	notification, err := h.notificationRepo.MarkNotificationRead(r.Context(), userID, id, time.Now())
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Notification not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark notification read: "+err.Error())
+		return
+	}
+	unreadCount, err := h.notificationRepo.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count unread notifications: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, NotificationReadResponse{Notification: notification, UnreadCount: unreadCount})
+}
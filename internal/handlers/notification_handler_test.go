@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+func TestNotificationsAreListedAndReadPerUser(t *testing.T) {
+	s := newTestServer(t)
+	store := memory.NewNotificationStore()
+	handler := NewNotificationHandler(store)
+	s.handle(http.MethodGet, "/api/v1/notifications", handler.ListNotifications)
+	s.handle(http.MethodPatch, "/api/v1/notifications/{id}/read", handler.MarkNotificationRead)
+
+	user := &models.User{ID: uuid.MustNewUUID(), Email: "dana@example.test", Role: models.UserRoleSalesRep}
+	other := &models.User{ID: uuid.MustNewUUID(), Email: "sam@example.test", Role: models.UserRoleSalesRep}
+	notify := func(owner *models.User, title string, at time.Time) *models.Notification {
+		n := &models.Notification{ID: uuid.MustNewUUID(), UserID: owner.ID, Title: title, CreatedAt: at}
+		if err := store.CreateNotification(context.Background(), n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	now := time.Now()
+	older := notify(user, "Older", now.Add(-time.Hour))
+	notify(user, "Newer", now)
+	others := notify(other, "Someone else's", now)
+
+	type listing struct {
+		Notifications []models.Notification `json:"notifications"`
+		UnreadCount   int64                 `json:"unreadCount"`
+		Total         int64                 `json:"total"`
+	}
+	list := func(query string) listing {
+		t.Helper()
+		rec := s.do(user, http.MethodGet, "/api/v1/notifications"+query, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list%s = %d %s", query, rec.Code, rec.Body)
+		}
+		var body listing
+		decodeBody(t, rec, &body)
+		return body
+	}
+
+	all := list("")
+	if all.Total != 2 || all.UnreadCount != 2 || len(all.Notifications) != 2 || all.Notifications[0].Title != "Newer" {
+		t.Fatalf("listing = %+v, want the user's 2 unread notifications newest first", all)
+	}
+
+	rec := s.do(user, http.MethodPatch, "/api/v1/notifications/"+older.ID+"/read", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("mark read = %d %s", rec.Code, rec.Body)
+	}
+	var marked struct {
+		Notification models.Notification `json:"notification"`
+		UnreadCount  int64               `json:"unreadCount"`
+	}
+	decodeBody(t, rec, &marked)
+	if !marked.Notification.IsRead() || marked.UnreadCount != 1 {
+		t.Errorf("marked = read %v unread count %d, want read with 1 unread left", marked.Notification.IsRead(), marked.UnreadCount)
+	}
+	if unread := list("?unread=true"); unread.Total != 1 || unread.Notifications[0].Title != "Newer" {
+		t.Errorf("unread listing = %+v, want only the newer notification", unread)
+	}
+
+	if rec := s.do(user, http.MethodPatch, "/api/v1/notifications/"+others.ID+"/read", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("marking another user's notification = %d, want 404", rec.Code)
+	}
+	if rec := s.do(nil, http.MethodGet, "/api/v1/notifications", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous listing = %d, want 401", rec.Code)
+	}
+}
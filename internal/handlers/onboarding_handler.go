@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/services"
+)
+
+// OnboardingHandler serves the onboarding checklist of the caller
+type OnboardingHandler struct {
+	onboarding *services.OnboardingService
+}
+
+// NewOnboardingHandler creates a new OnboardingHandler
+func NewOnboardingHandler(onboarding *services.OnboardingService) *OnboardingHandler {
+	return &OnboardingHandler{onboarding: onboarding}
+}
+
+// GetMyOnboarding returns the caller's onboarding checklist
+// GET /api/v1/users/me/onboarding
+// @Summary Get my onboarding checklist
+// @Description Lists the setup steps of a new team member (profile, profile picture, verified phone, 2FA, email signature, a second sign-in, a first template or email), each done or not and whether it was dismissed, with the share of the steps not dismissed that are done
+// @Tags Users
+// @Produce json
+// @Success 200 {object} models.OnboardingChecklist
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /users/me/onboarding [get]
+func (h *OnboardingHandler) GetMyOnboarding(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	checklist, err := h.onboarding.Checklist(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve onboarding checklist: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, checklist)
+}
+
+// DismissOnboardingItem hides an item of the caller's onboarding checklist
+// PATCH /api/v1/users/me/onboarding/{item}/dismiss
+// @Summary Dismiss an onboarding checklist item
+// @Description Hides a step of the caller's onboarding checklist for good; it is still listed, marked dismissed, and no longer counts toward the percentage
+// @Tags Users
+// @Produce json
+// @Param item path string true "Item key, e.g. avatar or two_factor"
+// @Success 200 {object} models.OnboardingChecklist
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} CodedErrorResponse "Unknown item"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /users/me/onboarding/{item}/dismiss [patch]
+func (h *OnboardingHandler) DismissOnboardingItem(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	checklist, err := h.onboarding.Dismiss(r.Context(), userID, mux.Vars(r)["item"])
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownOnboardingItem) {
+			respondWithErrorCode(w, http.StatusNotFound, "UNKNOWN_ONBOARDING_ITEM", "Unknown onboarding item")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to dismiss onboarding item: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, checklist)
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// ReferenceDataHandler manages one kind of reference data, regions or
+// teams, that user region and team fields are validated against
+type ReferenceDataHandler struct {
+	repo  *repositories.ReferenceDataRepository
+	kind  string // models.ReferenceKindRegions or models.ReferenceKindTeams
+	label string // Singular name used in messages, e.g. "Team"
+}
+
+// NewReferenceDataHandler creates a new ReferenceDataHandler for kind
+func NewReferenceDataHandler(repo *repositories.ReferenceDataRepository, kind string) *ReferenceDataHandler {
+	return &ReferenceDataHandler{repo: repo, kind: kind, label: referenceLabel(kind)}
+}
+
+// ListActive lists the active entries, for populating dropdowns
+// GET /api/v1/regions, GET /api/v1/teams
+// @Summary List active regions or teams
+// @Description Lists the active entries, for populating dropdowns, under the regions or teams key
+// @Tags Reference Data
+// @Produce json
+// @Success 200 {object} map[string][]models.ReferenceEntry
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /regions [get]
+// @Router /teams [get]
+func (h *ReferenceDataHandler) ListActive(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, true)
+}
+
+// List lists every entry, inactive ones included
+// GET /api/v1/admin/regions, GET /api/v1/admin/teams
+// @Summary List all regions or teams
+// @Description Lists every entry, inactive ones included, under the regions or teams key
+// @Tags Reference Data
+// @Produce json
+// @Success 200 {object} map[string][]models.ReferenceEntry
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/regions [get]
+// @Router /admin/teams [get]
+func (h *ReferenceDataHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, false)
+}
+
+func (h *ReferenceDataHandler) list(w http.ResponseWriter, r *http.Request, activeOnly bool) {
+	entries, err := h.repo.List(r.Context(), h.kind, activeOnly)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list "+h.kind+": "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{h.kind: entries})
+}
+
+// Get returns an entry
+// GET /api/v1/admin/regions/{code}, GET /api/v1/admin/teams/{code}
+// @Summary Get a region or team
+// @Tags Reference Data
+// @Produce json
+// @Param code path string true "Code"
+// @Success 200 {object} models.ReferenceEntry
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/regions/{code} [get]
+// @Router /admin/teams/{code} [get]
+func (h *ReferenceDataHandler) Get(w http.ResponseWriter, r *http.Request) {
+	entry, err := h.repo.Get(r.Context(), h.kind, mux.Vars(r)["code"])
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, h.label+" not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get "+strings.ToLower(h.label)+": "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, entry)
+}
+
+// Create adds an entry. The code is stored lower case and cannot change.
+// POST /api/v1/admin/regions, POST /api/v1/admin/teams
+// @Summary Create a region or team
+// @Description Adds an entry; the code is stored lower case and cannot change
+// @Tags Reference Data
+// @Accept json
+// @Produce json
+// @Param entryRequest body models.CreateReferenceEntryRequest true "Entry"
+// @Success 201 {object} models.ReferenceEntry
+// @Failure 400 {object} CodedErrorResponse "Invalid body or code"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 409 {object} ErrorResponse "Code already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/regions [post]
+// @Router /admin/teams [post]
+func (h *ReferenceDataHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateReferenceEntryRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	code := models.NormalizeReferenceCode(req.Code)
+	if !models.IsValidReferenceCode(code) {
+		respondWithError(w, http.StatusBadRequest, "code is required and may only contain letters, digits, underscores and dashes (max 64)")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = code
+	}
+
+	now := time.Now()
+	entry := &models.ReferenceEntry{
+		Code:      code,
+		Name:      name,
+		IsActive:  req.IsActive == nil || *req.IsActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.repo.Create(r.Context(), h.kind, entry); err != nil {
+		if repositories.IsDuplicateKey(err) {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("%s %q already exists", h.label, code))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to create "+strings.ToLower(h.label)+": "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, entry)
+}
+
+// ReferenceEntryUpdated is the response to updating a region or team
+type ReferenceEntryUpdated struct {
+	Entry      *models.ReferenceEntry `json:"entry"`
+	Reassigned int64                  `json:"reassigned"` // Users moved to reassignTo
+}
+
+// Update renames, activates or deactivates an entry. Deactivating one that
+// users are assigned to is refused unless reassignTo names an active entry
+// to move them to first.
+// PUT /api/v1/admin/regions/{code}, PUT /api/v1/admin/teams/{code}
+// @Summary Update a region or team
+// @Description Renames, activates or deactivates an entry. Deactivating one with assigned users requires reassignTo.
+// @Tags Reference Data
+// @Accept json
+// @Produce json
+// @Param code path string true "Code"
+// @Param entryRequest body models.UpdateReferenceEntryRequest true "Fields to update"
+// @Success 200 {object} ReferenceEntryUpdated "entry and the number of users reassigned"
+// @Failure 400 {object} CodedErrorResponse "Invalid body, name or reassignTo"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Not found"
+// @Failure 409 {object} CodedErrorResponse "Users are assigned and no reassignTo was given"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/regions/{code} [put]
+// @Router /admin/teams/{code} [put]
+func (h *ReferenceDataHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := mux.Vars(r)["code"]
+
+	var req models.UpdateReferenceEntryRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.Name != nil {
+		trimmed := strings.TrimSpace(*req.Name)
+		if trimmed == "" {
+			respondWithError(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		req.Name = &trimmed
+	}
+
+	existing, err := h.repo.Get(ctx, h.kind, code)
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, h.label+" not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get "+strings.ToLower(h.label)+": "+err.Error())
+		return
+	}
+
+	var reassigned int64
+	if req.IsActive != nil && !*req.IsActive && existing.IsActive {
+		assigned, err := h.repo.CountAssignedUsers(ctx, h.kind, code)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count assigned users: "+err.Error())
+			return
+		}
+		if assigned > 0 {
+			target := models.NormalizeReferenceCode(req.ReassignTo)
+			if target == "" {
+				respondWithErrorCode(w, http.StatusConflict, "REFERENCE_IN_USE",
+					fmt.Sprintf("%d user(s) are assigned to this %s; set reassignTo to move them first", assigned, strings.ToLower(h.label)))
+				return
+			}
+			if target == code {
+				respondWithError(w, http.StatusBadRequest, "reassignTo must differ from the entry being deactivated")
+				return
+			}
+			active, err := h.repo.IsActive(ctx, h.kind, target)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to check reassignTo: "+err.Error())
+				return
+			}
+			if !active {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("reassignTo %q is not an active %s", target, strings.ToLower(h.label)))
+				return
+			}
+			reassigned, err = h.repo.ReassignUsers(ctx, h.kind, code, target, time.Now())
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to reassign users: "+err.Error())
+				return
+			}
+		}
+	}
+
+	entry, err := h.repo.Update(ctx, h.kind, code, req.Name, req.IsActive, time.Now())
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, h.label+" not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to update "+strings.ToLower(h.label)+": "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, ReferenceEntryUpdated{
+		Entry:      entry,
+		Reassigned: reassigned,
+	})
+}
+
+// resolveReferenceCode returns the canonical code of a region or team value
+// from a request, responding with 400 when it is not an active entry.
+// Without a repository every value is accepted as given.
+func resolveReferenceCode(w http.ResponseWriter, r *http.Request, repo *repositories.ReferenceDataRepository, kind, value string) (string, bool) {
+	if repo == nil {
+		return value, true
+	}
+	code := models.NormalizeReferenceCode(value)
+	active, err := repo.IsActive(r.Context(), kind, code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check "+strings.ToLower(referenceLabel(kind))+": "+err.Error())
+		return "", false
+	}
+	if !active {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_"+strings.ToUpper(referenceLabel(kind)),
+			fmt.Sprintf("Unknown or inactive %s %q", strings.ToLower(referenceLabel(kind)), value))
+		return "", false
+	}
+	return code, true
+}
+
+// referenceLabel is the singular name of a reference data kind
+func referenceLabel(kind string) string {
+	if kind == models.ReferenceKindRegions {
+		return "Region"
+	}
+	return "Team"
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// RoleHandler manages the built-in and custom roles and assigns custom
+// roles to users
+type RoleHandler struct {
+	rbac           *services.RBACService
+	users          repositories.UserStore
+	auditPublisher *events.AuditPublisher
+}
+
+// NewRoleHandler creates a new RoleHandler
+// auditPublisher can be nil - role changes are then not audited
+func NewRoleHandler(rbac *services.RBACService, users repositories.UserStore, auditPublisher *events.AuditPublisher) *RoleHandler {
+	return &RoleHandler{rbac: rbac, users: users, auditPublisher: auditPublisher}
+}
+
+// RoleDeletedResponse reports a deleted role and how many of its users were
+// moved to another role
+type RoleDeletedResponse struct {
+	ID              string `json:"id"`
+	RoleCode        string `json:"roleCode"`
+	ReassignedUsers int64  `json:"reassignedUsers"`
+}
+
+// ListRoles lists the roles users can hold
+// GET /api/v1/admin/roles
+// @Summary List roles
+// @Description Lists the built-in roles (isSystemRole, one per user role) and the custom roles, by code
+// @Tags Roles
+// @Produce json
+// @Success 200 {object} models.RolePermissionListResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing roles:manage permission"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles [get]
+func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.rbac.GetAllRoles(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list roles: "+err.Error())
+		return
+	}
+	if roles == nil {
+		roles = []models.RolePermission{}
+	}
+	respondWithJSON(w, http.StatusOK, models.RolePermissionListResponse{Roles: roles})
+}
+
+// CreateRole creates a custom role
+// POST /api/v1/admin/roles
+// @Summary Create a custom role
+// @Description Creates a role with a permission list and data scope. The code (lowercase letters, digits and underscores) cannot be changed later. Users are given custom roles with PUT /admin/users/{id}/roles and hold their permissions on top of their own role's.
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param roleRequest body models.CreateCustomRoleRequest true "Role"
+// @Success 201 {object} models.RolePermission
+// @Failure 400 {object} CodedErrorResponse "Invalid body, code or permissions"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing roles:manage permission"
+// @Failure 409 {object} CodedErrorResponse "Role code already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles [post]
+func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateCustomRoleRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	req.RoleCode = strings.TrimSpace(req.RoleCode)
+	req.RoleName = strings.TrimSpace(req.RoleName)
+	if !validRoleDataScope(w, req.DataScope) {
+		return
+	}
+
+	role, err := h.rbac.CreateCustomRole(r.Context(), req, middleware.GetUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRoleCode):
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_ROLE_CODE", err.Error())
+		case errors.Is(err, repositories.ErrInvalidInput):
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_PERMISSION", err.Error())
+		case errors.Is(err, repositories.ErrDuplicateKey):
+			respondWithErrorCode(w, http.StatusConflict, "ROLE_CODE_TAKEN", "A role with code "+req.RoleCode+" already exists")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to create role: "+err.Error())
+		}
+		return
+	}
+
+	h.publish(r, events.ActionRoleCreated, role.RoleCode, fmt.Sprintf("Role %s created with %d permissions", role.RoleCode, len(role.Permissions)), role)
+	respondWithJSON(w, http.StatusCreated, role)
+}
+
+// GetRole returns a role
+// GET /api/v1/admin/roles/{id}
+// @Summary Get a role
+// @Tags Roles
+// @Produce json
+// @Param id path string true "Role ID"
+// @Success 200 {object} models.RolePermission
+// @Failure 400 {object} ErrorResponse "Invalid role ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing roles:manage permission"
+// @Failure 404 {object} ErrorResponse "Role not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles/{id} [get]
+func (h *RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := roleIDParam(w, r)
+	if !ok {
+		return
+	}
+	role, err := h.rbac.GetRoleByID(r.Context(), id)
+	if err != nil {
+		respondWithRoleError(w, err, "Failed to get role")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, role)
+}
+
+// UpdateRole replaces the name, description, permissions and data scope of
+// a role
+// PUT /api/v1/admin/roles/{id}
+// @Summary Update a role
+// @Description Replaces the name, description, permissions and data scope of a built-in or custom role. The code cannot change, and users hold roles by ID or code, so renaming a role does not affect signed-in users.
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param roleRequest body models.UpdateRolePermissionsRequest true "Role"
+// @Success 200 {object} models.RolePermission
+// @Failure 400 {object} CodedErrorResponse "Invalid body or permissions"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing roles:manage permission"
+// @Failure 404 {object} ErrorResponse "Role not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles/{id} [put]
+func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := roleIDParam(w, r)
+	if !ok {
+		return
+	}
+	var req models.UpdateRolePermissionsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	req.RoleName = strings.TrimSpace(req.RoleName)
+	if !validRoleDataScope(w, req.DataScope) {
+		return
+	}
+
+	role, err := h.rbac.UpdateRoleByID(r.Context(), id, req, middleware.GetUserID(r))
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidInput) {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_PERMISSION", err.Error())
+			return
+		}
+		respondWithRoleError(w, err, "Failed to update role")
+		return
+	}
+
+	h.publish(r, events.ActionRolePermissionsUpdated, role.RoleCode, fmt.Sprintf("Role %s updated to %d permissions", role.RoleCode, len(role.Permissions)), role)
+	respondWithJSON(w, http.StatusOK, role)
+}
+
+// DeleteRole deletes a custom role
+// DELETE /api/v1/admin/roles/{id}
+// @Summary Delete a custom role
+// @Description Deletes a custom role. Built-in roles cannot be deleted. A role users still hold, as a custom role or as their role, is only deleted with reassign_to naming the role to move them to.
+// @Tags Roles
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param reassign_to query string false "ID of the role to move the role's users to"
+// @Success 200 {object} RoleDeletedResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid role ID or reassignment target"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing roles:manage permission"
+// @Failure 404 {object} ErrorResponse "Role or reassignment target not found"
+// @Failure 409 {object} CodedErrorResponse "Built-in role, or role in use without reassign_to"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles/{id} [delete]
+func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := roleIDParam(w, r)
+	if !ok {
+		return
+	}
+	reassignTo := strings.TrimSpace(r.URL.Query().Get("reassign_to"))
+	if reassignTo != "" {
+		var err error
+		if reassignTo, err = uuid.ParseUUID(reassignTo); err != nil {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REASSIGNMENT", "Invalid reassign_to role ID")
+			return
+		}
+	}
+
+	role, moved, err := h.rbac.DeleteRoleByID(r.Context(), id, reassignTo)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrBuiltInRole):
+			respondWithErrorCode(w, http.StatusConflict, "BUILT_IN_ROLE", err.Error())
+		case errors.Is(err, services.ErrRoleInUse):
+			respondWithErrorCode(w, http.StatusConflict, "ROLE_IN_USE", err.Error()+"; pass reassign_to to move them to another role")
+		case errors.Is(err, services.ErrInvalidRoleReassignment):
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REASSIGNMENT", err.Error())
+		default:
+			respondWithRoleError(w, err, "Failed to delete role")
+		}
+		return
+	}
+
+	details := fmt.Sprintf("Role %s deleted", role.RoleCode)
+	if moved > 0 {
+		details += fmt.Sprintf(", %d users moved to role %s", moved, reassignTo)
+	}
+	h.publish(r, events.ActionRoleDeleted, role.RoleCode, details, role)
+	respondWithJSON(w, http.StatusOK, RoleDeletedResponse{ID: role.ID, RoleCode: role.RoleCode, ReassignedUsers: moved})
+}
+
+// AssignUserRoles sets the custom roles of a user
+// PUT /api/v1/admin/users/{id}/roles
+// @Summary Assign custom roles to a user
+// @Description Replaces the custom roles of a user; an empty list removes them. The user keeps their own role and direct permissions, and holds the union of all of them from their next request.
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param rolesRequest body models.AssignRolesRequest true "Role IDs"
+// @Success 200 {object} models.UserProfile
+// @Failure 400 {object} CodedErrorResponse "Invalid body or user ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing roles:manage permission, or impersonating"
+// @Failure 404 {object} ErrorResponse "User or role not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/roles [put]
+func (h *RoleHandler) AssignUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req models.AssignRolesRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, err := h.rbac.AssignRoles(r.Context(), h.users, userID, req.RoleIDs)
+	if err != nil {
+		switch {
+		case repositories.IsUserNotFound(err):
+			respondWithError(w, http.StatusNotFound, "User not found")
+		case errors.Is(err, repositories.ErrRoleNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to assign roles: "+err.Error())
+		}
+		return
+	}
+
+	if h.auditPublisher != nil {
+		actorName, _ := r.Context().Value(middleware.NameKey).(string)
+		h.auditPublisher.PublishTeamEvent(r, middleware.GetUserID(r), actorName, events.ActionRoleChanged,
+			user.ID, fmt.Sprintf("Custom roles set to [%s]", strings.Join(user.RoleIDs, ", ")))
+	}
+	respondWithJSON(w, http.StatusOK, user.ToProfile())
+}
+
+// publish records a role change in the audit log
+func (h *RoleHandler) publish(r *http.Request, action events.AuditAction, roleCode, details string, role *models.RolePermission) {
+	if h.auditPublisher == nil {
+		return
+	}
+	actorName, _ := r.Context().Value(middleware.NameKey).(string)
+	h.auditPublisher.PublishRoleEvent(r, middleware.GetUserID(r), actorName, action, roleCode, details, map[string]interface{}{
+		"role_id":     role.ID,
+		"permissions": role.Permissions,
+	})
+}
+
+// roleIDParam reads the {id} path variable, responding with 400 when it is
+// not a valid ID
+func roleIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid role ID")
+		return "", false
+	}
+	return id, true
+}
+
+// validRoleDataScope checks every scope set on a role, responding with 400
+// for the first invalid one
+func validRoleDataScope(w http.ResponseWriter, scope models.DataScope) bool {
+	for _, resource := range models.DataScopeResources {
+		if value := scope.Get(resource); value != "" && !models.IsValidDataScopeValue(value) {
+			respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("Invalid data scope %q for %s, must be own, team, region, all or none", value, resource))
+			return false
+		}
+	}
+	return true
+}
+
+// respondWithRoleError responds with 404 for unknown roles and 500 otherwise
+func respondWithRoleError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, repositories.ErrRoleNotFound) {
+		respondWithError(w, http.StatusNotFound, "Role not found")
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, message+": "+err.Error())
+}
@@ -2,7 +2,6 @@ package handlers
 import (
 	"github.com/white/user-management/pkg/uuid"
 	"github.com/white/user-management/internal/middleware"
-	"encoding/json"
 	"net/http"
 	"strings"
 	"time"
@@ -36,9 +35,9 @@ func NewSchedulerHandler(
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {array} models.ScheduleDefinition
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/campaigns/schedule-definitions [get]
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /campaigns/schedule-definitions [get]
 func (h *SchedulerHandler) GetScheduleDefinitions(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from context (stored as string UUID by middleware)
 	userID := middleware.GetUserID(r)
@@ -59,13 +58,13 @@ func (h *SchedulerHandler) GetScheduleDefinitions(w http.ResponseWriter, r *http
 
 // CreateScheduleDefinitionRequest represents the request body for creating a schedule definition
 type CreateScheduleDefinitionRequest struct {
-	Name               string                 `json:"name"`
-	Description        string                 `json:"description,omitempty"`
-	Frequency          string                 `json:"frequency"`
-	DayOfWeek          int                    `json:"dayOfWeek,omitempty"`
-	DayOfMonth         int                    `json:"dayOfMonth,omitempty"`
-	Time               string                 `json:"time"`
-	TimeZone           string                 `json:"timeZone"`
+	Name               string                 `json:"name" validate:"required,max=200"`
+	Description        string                 `json:"description,omitempty" validate:"max=2000"`
+	Frequency          string                 `json:"frequency" validate:"max=32"`
+	DayOfWeek          int                    `json:"dayOfWeek,omitempty" validate:"min=0,max=6"`
+	DayOfMonth         int                    `json:"dayOfMonth,omitempty" validate:"min=0,max=31"`
+	Time               string                 `json:"time" validate:"max=5"`
+	TimeZone           string                 `json:"timeZone" validate:"max=64"`
 	UseContactTimeZone bool                   `json:"useContactTimeZone"`
 	ExcludedHolidays   []string               `json:"excludedHolidays"`
 	SendingWindows     []models.SendingWindow `json:"sendingWindows"`
@@ -81,10 +80,10 @@ type CreateScheduleDefinitionRequest struct {
 // @Security BearerAuth
 // @Param schedule body CreateScheduleDefinitionRequest true "Schedule definition data"
 // @Success 201 {object} models.ScheduleDefinition
-// @Failure 400 {object} map[string]string "Bad request"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/campaigns/schedule-definitions [post]
+// @Failure 400 {object} CodedErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /campaigns/schedule-definitions [post]
 func (h *SchedulerHandler) CreateScheduleDefinition(w http.ResponseWriter, r *http.Request) {
 	//Extract user ID from context
 	userID := middleware.GetUserID(r);
@@ -94,14 +93,7 @@ func (h *SchedulerHandler) CreateScheduleDefinition(w http.ResponseWriter, r *ht
 	}
 
 	var req CreateScheduleDefinitionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "invalid request body");
-		return
-	}
-
-		// Validate required fields
-	if req.Name == "" {
-		respondWithError(w, http.StatusBadRequest, "Name is required")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 	if req.TimeZone == "" {
@@ -145,7 +137,7 @@ func (h *SchedulerHandler) CreateScheduleDefinition(w http.ResponseWriter, r *ht
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
-		h.activityRepo.CreateActivityCompat(activity)
+		h.activityRepo.CreateActivity(r.Context(), activity)
 	}
 
 	respondWithJSON(w, http.StatusCreated, schedule)
@@ -161,11 +153,11 @@ func (h *SchedulerHandler) CreateScheduleDefinition(w http.ResponseWriter, r *ht
 // @Param id path string true "Schedule definition ID"
 // @Param schedule body CreateScheduleDefinitionRequest true "Updated schedule definition data"
 // @Success 200 {object} models.ScheduleDefinition
-// @Failure 400 {object} map[string]string "Bad request"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/campaigns/schedule-definitions/{id} [put]
+// @Failure 400 {object} CodedErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /campaigns/schedule-definitions/{id} [put]
 func (h *SchedulerHandler) UpdateScheduleDefinition(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from context
 	userID := middleware.GetUserID(r)
@@ -175,8 +167,11 @@ func (h *SchedulerHandler) UpdateScheduleDefinition(w http.ResponseWriter, r *ht
 	}
 
 	// Get schedule ID from URL
-	vars := mux.Vars(r)
-	scheduleID := vars["id"]
+	scheduleID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid schedule ID")
+		return
+	}
 
 	// Get existing schedule
 	existing, err := h.scheduleDefinitionRepo.GetScheduleDefinitionByID(scheduleID)
@@ -191,8 +186,7 @@ func (h *SchedulerHandler) UpdateScheduleDefinition(w http.ResponseWriter, r *ht
 
 	// Parse request body
 	var req CreateScheduleDefinitionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
@@ -232,7 +226,7 @@ func (h *SchedulerHandler) UpdateScheduleDefinition(w http.ResponseWriter, r *ht
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
-		h.activityRepo.CreateActivityCompat(activity)
+		h.activityRepo.CreateActivity(r.Context(), activity)
 	}
 
 	respondWithJSON(w, http.StatusOK, existing)
@@ -246,11 +240,11 @@ func (h *SchedulerHandler) UpdateScheduleDefinition(w http.ResponseWriter, r *ht
 // @Security BearerAuth
 // @Param id path string true "Schedule definition ID"
 // @Success 204 "No Content"
-// @Failure 400 {object} map[string]string "Bad request"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/campaigns/schedule-definitions/{id} [delete]
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /campaigns/schedule-definitions/{id} [delete]
 func (h *SchedulerHandler) DeleteScheduleDefinition(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from context
 	userID := middleware.GetUserID(r)
@@ -260,8 +254,11 @@ func (h *SchedulerHandler) DeleteScheduleDefinition(w http.ResponseWriter, r *ht
 	}
 
 	// Get schedule ID from URL
-	vars := mux.Vars(r)
-	scheduleID := vars["id"]
+	scheduleID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid schedule ID")
+		return
+	}
 
 	// Delete from database
 	if err := h.scheduleDefinitionRepo.DeleteScheduleDefinition(scheduleID); err != nil {
@@ -285,7 +282,7 @@ func (h *SchedulerHandler) DeleteScheduleDefinition(w http.ResponseWriter, r *ht
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
-		h.activityRepo.CreateActivityCompat(activity)
+		h.activityRepo.CreateActivity(r.Context(), activity)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+)
+
+// maxPhoneVerificationAttempts wrong codes end a phone verification; a new
+// code has to be requested
+const maxPhoneVerificationAttempts = 5
+
+// SecuritySettingsHandler lets users manage their own 2FA: whether it is on,
+// whether codes come by email or SMS, and the phone number they are texted to
+type SecuritySettingsHandler struct {
+	settings repositories.SettingsStore
+	otp      *services.OTPService
+	smsCodes *services.SMSCodes // nil when phone numbers cannot be verified
+}
+
+// NewSecuritySettingsHandler creates a new SecuritySettingsHandler
+func NewSecuritySettingsHandler(settings repositories.SettingsStore, smsCodes *services.SMSCodes) *SecuritySettingsHandler {
+	return &SecuritySettingsHandler{
+		settings: settings,
+		otp:      services.NewOTPService(),
+		smsCodes: smsCodes,
+	}
+}
+
+// PhoneVerificationStarted is the response to adding a phone number: a code
+// was texted to it
+type PhoneVerificationStarted struct {
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expiresAt"` // When the code stops being accepted
+}
+
+// GetSecuritySettings returns the caller's security settings
+// GET /api/v1/settings/security
+// @Summary Get my security settings
+// @Description Returns whether 2FA is on, the channel its codes are sent through and the verified phone number
+// @Tags Settings
+// @Produce json
+// @Success 200 {object} models.SettingsUserSecuritySettings
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /settings/security [get]
+func (h *SecuritySettingsHandler) GetSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	settings, err := h.settings.GetSecuritySettings(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get security settings: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// UpdateSecuritySettings turns 2FA on or off and picks the channel of its
+// codes. SMS can only be picked once a phone number is verified.
+// PUT /api/v1/settings/security
+// @Summary Update my security settings
+// @Description Turns 2FA on or off, picks email or sms for its codes (sms needs a verified phone number) and sets the session timeout
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Param request body models.SettingsUpdateSecuritySettingsRequest true "Fields to change"
+// @Success 200 {object} models.SettingsUserSecuritySettings
+// @Failure 400 {object} CodedErrorResponse "Invalid payload, or sms picked without a verified phone number"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Impersonating"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /settings/security [put]
+func (h *SecuritySettingsHandler) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req models.SettingsUpdateSecuritySettingsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if req.TwoFactorMethod != nil && *req.TwoFactorMethod == models.TwoFactorMethodSMS {
+		current, err := h.settings.GetSecuritySettings(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to get security settings: "+err.Error())
+			return
+		}
+		if current.PhoneNumber == "" {
+			respondWithErrorCode(w, http.StatusBadRequest, "PHONE_NOT_VERIFIED", "Verify a phone number before choosing SMS for 2FA codes")
+			return
+		}
+	}
+
+	settings, err := h.settings.UpdateSecuritySettings(r.Context(), userID, req)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update security settings: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// StartPhoneVerification texts a code to a phone number, which replaces the
+// caller's phone number once the code is confirmed
+// POST /api/v1/settings/security/phone
+// @Summary Add a phone number for 2FA
+// @Description Texts a verification code to the phone number; confirm it with POST /settings/security/phone/verify. A new request replaces the code sent before.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Param request body models.SettingsPhoneNumberRequest true "Phone number in E.164 form"
+// @Success 202 {object} PhoneVerificationStarted "message, expiresAt"
+// @Failure 400 {object} CodedErrorResponse "Invalid payload"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Impersonating"
+// @Failure 429 {object} CodedErrorResponse "Too many codes texted to this number"
+// @Failure 502 {object} ErrorResponse "The text message could not be sent"
+// @Failure 503 {object} ErrorResponse "SMS is not available"
+// @Security BearerAuth
+// @Router /settings/security/phone [post]
+func (h *SecuritySettingsHandler) StartPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if h.smsCodes == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "SMS is not available")
+		return
+	}
+	var req models.SettingsPhoneNumberRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	code := h.otp.GenerateOTP()
+	codeHash, err := h.otp.HashOTP(code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate code")
+		return
+	}
+	expiresAt := h.otp.GetExpiryTime()
+	verification := models.PhoneVerification{PhoneNumber: req.PhoneNumber, CodeHash: codeHash, ExpiresAt: expiresAt}
+	if err := h.settings.StartPhoneVerification(r.Context(), userID, verification); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to store verification: "+err.Error())
+		return
+	}
+
+	if err := h.smsCodes.SendVerificationCode(r.Context(), req.PhoneNumber, code, h.otp.ExpiryMinutes()); err != nil {
+		if errors.Is(err, services.ErrSMSRateLimited) {
+			respondWithErrorCode(w, http.StatusTooManyRequests, "SMS_RATE_LIMITED", "Too many codes were sent to this phone number, try again later")
+			return
+		}
+		respondWithError(w, http.StatusBadGateway, "Failed to send the text message: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, PhoneVerificationStarted{
+		Message:   "Verification code sent",
+		ExpiresAt: expiresAt,
+	})
+}
+
+// VerifyPhoneNumber confirms the phone number being verified with the code
+// texted to it
+// POST /api/v1/settings/security/phone/verify
+// @Summary Confirm a phone number for 2FA
+// @Description Makes the phone number being verified the caller's, with the code texted to it. After 5 wrong codes a new one has to be requested.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Param request body models.SettingsVerifyPhoneNumberRequest true "Code texted to the phone number"
+// @Success 200 {object} models.SettingsUserSecuritySettings
+// @Failure 400 {object} CodedErrorResponse "Invalid payload, no verification in progress, or a wrong or expired code"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Impersonating"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /settings/security/phone/verify [post]
+func (h *SecuritySettingsHandler) VerifyPhoneNumber(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req models.SettingsVerifyPhoneNumberRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	current, err := h.settings.GetSecuritySettings(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get security settings: "+err.Error())
+		return
+	}
+	verification := current.PhoneVerification
+	switch {
+	case verification == nil:
+		respondWithErrorCode(w, http.StatusBadRequest, "NO_PHONE_VERIFICATION", "No phone number is being verified")
+		return
+	case verification.Attempts >= maxPhoneVerificationAttempts:
+		respondWithErrorCode(w, http.StatusBadRequest, "TOO_MANY_ATTEMPTS", "Too many wrong codes, request a new one")
+		return
+	case h.otp.IsOTPExpired(verification.ExpiresAt):
+		respondWithErrorCode(w, http.StatusBadRequest, "CODE_EXPIRED", "The code has expired, request a new one")
+		return
+	case !h.otp.ValidateOTP(req.Code, verification.CodeHash, verification.ExpiresAt):
+		if err := h.settings.RecordPhoneVerificationAttempt(r.Context(), userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to record attempt: "+err.Error())
+			return
+		}
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_CODE", "Invalid verification code")
+		return
+	}
+
+	settings, err := h.settings.ConfirmPhoneNumber(r.Context(), userID, verification.PhoneNumber, time.Now())
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithErrorCode(w, http.StatusBadRequest, "NO_PHONE_VERIFICATION", "A newer code was requested, enter that one")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to save phone number: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// RemovePhoneNumber removes the caller's phone number; 2FA codes are emailed
+// again
+// DELETE /api/v1/settings/security/phone
+// @Summary Remove my 2FA phone number
+// @Description Removes the verified phone number and any verification in progress, and sends 2FA codes by email again
+// @Tags Settings
+// @Produce json
+// @Success 200 {object} models.SettingsUserSecuritySettings
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Impersonating"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /settings/security/phone [delete]
+func (h *SecuritySettingsHandler) RemovePhoneNumber(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	settings, err := h.settings.RemovePhoneNumber(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to remove phone number: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/sms"
+)
+
+// newSecuritySettingsServer routes a SecuritySettingsHandler over memory
+// stores texting through texts, or without SMS when texts is nil
+func newSecuritySettingsServer(t *testing.T, texts *sms.MemorySender) (*testServer, *memory.UserStore) {
+	t.Helper()
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	settings := memory.NewSettingsStore(users)
+	var smsCodes *services.SMSCodes
+	if texts != nil {
+		smsCodes = services.NewSMSCodes(texts, "Acme CRM", time.Second, false)
+	}
+	h := NewSecuritySettingsHandler(settings, smsCodes)
+	s.handle(http.MethodPut, "/api/v1/settings/security", h.UpdateSecuritySettings)
+	s.handle(http.MethodPost, "/api/v1/settings/security/phone", h.StartPhoneVerification)
+	s.handle(http.MethodPost, "/api/v1/settings/security/phone/verify", h.VerifyPhoneNumber)
+	s.handle(http.MethodDelete, "/api/v1/settings/security/phone", h.RemovePhoneNumber)
+	return s, users
+}
+
+// TestPhoneNumberIsVerifiedBeforeSMSCodes adds a phone number with the code
+// texted to it, and checks SMS can only be chosen for 2FA codes after that
+func TestPhoneNumberIsVerifiedBeforeSMSCodes(t *testing.T) {
+	texts := sms.NewMemorySender()
+	s, users := newSecuritySettingsServer(t, texts)
+	user := users.Add(&models.User{Email: "dana@example.test", Role: models.UserRoleSalesRep, IsActive: true})
+	useSMS := func() *models.SettingsUpdateSecuritySettingsRequest {
+		method := models.TwoFactorMethodSMS
+		return &models.SettingsUpdateSecuritySettingsRequest{TwoFactorMethod: &method}
+	}
+
+	rec := s.do(user, http.MethodPut, "/api/v1/settings/security", useSMS())
+	if detail := errorDetail(t, rec, http.StatusBadRequest); detail.Code != "PHONE_NOT_VERIFIED" {
+		t.Errorf("SMS without a phone number = %+v, want PHONE_NOT_VERIFIED", detail)
+	}
+	rec = s.do(user, http.MethodPost, "/api/v1/settings/security/phone", models.SettingsPhoneNumberRequest{PhoneNumber: "4155550123"})
+	if detail := errorDetail(t, rec, http.StatusBadRequest); detail.Fields["phoneNumber"] == "" {
+		t.Errorf("a number without a country code = %+v, want it rejected", detail)
+	}
+	rec = s.do(user, http.MethodPost, "/api/v1/settings/security/phone/verify", models.SettingsVerifyPhoneNumberRequest{Code: "123456"})
+	if detail := errorDetail(t, rec, http.StatusBadRequest); detail.Code != "NO_PHONE_VERIFICATION" {
+		t.Errorf("verify before a code was sent = %+v, want NO_PHONE_VERIFICATION", detail)
+	}
+
+	if rec := s.do(user, http.MethodPost, "/api/v1/settings/security/phone", models.SettingsPhoneNumberRequest{PhoneNumber: "+14155550123"}); rec.Code != http.StatusAccepted {
+		t.Fatalf("start verification = %d %s", rec.Code, rec.Body)
+	}
+	sent := texts.Sent()
+	if len(sent) != 1 || sent[0].To != "+14155550123" {
+		t.Fatalf("texts = %+v, want the code texted to the number", sent)
+	}
+	code := otpPattern.FindString(sent[0].Body)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	rec = s.do(user, http.MethodPost, "/api/v1/settings/security/phone/verify", models.SettingsVerifyPhoneNumberRequest{Code: wrong})
+	if detail := errorDetail(t, rec, http.StatusBadRequest); detail.Code != "INVALID_CODE" {
+		t.Errorf("wrong code = %+v, want INVALID_CODE", detail)
+	}
+	rec = s.do(user, http.MethodPost, "/api/v1/settings/security/phone/verify", models.SettingsVerifyPhoneNumberRequest{Code: code})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify = %d %s", rec.Code, rec.Body)
+	}
+	var settings models.SettingsUserSecuritySettings
+	decodeBody(t, rec, &settings)
+	if settings.PhoneNumber != "+14155550123" {
+		t.Errorf("phone number = %q after verifying it", settings.PhoneNumber)
+	}
+
+	rec = s.do(user, http.MethodPut, "/api/v1/settings/security", useSMS())
+	decodeBody(t, rec, &settings)
+	if rec.Code != http.StatusOK || settings.TwoFactorChannel() != models.TwoFactorMethodSMS {
+		t.Errorf("choosing SMS after verifying = %d %+v", rec.Code, settings)
+	}
+
+	// Without the phone number, codes are emailed again
+	rec = s.do(user, http.MethodDelete, "/api/v1/settings/security/phone", nil)
+	var removed models.SettingsUserSecuritySettings
+	decodeBody(t, rec, &removed)
+	if rec.Code != http.StatusOK || removed.PhoneNumber != "" || removed.TwoFactorChannel() != models.TwoFactorMethodEmail {
+		t.Errorf("removing the phone number = %d %+v", rec.Code, removed)
+	}
+}
+
+// TestPhoneVerificationLimits checks a verification ends after five wrong
+// codes, and that numbers cannot be verified without an SMS provider
+func TestPhoneVerificationLimits(t *testing.T) {
+	texts := sms.NewMemorySender()
+	s, users := newSecuritySettingsServer(t, texts)
+	user := users.Add(&models.User{Email: "dana@example.test", Role: models.UserRoleSalesRep, IsActive: true})
+
+	if rec := s.do(user, http.MethodPost, "/api/v1/settings/security/phone", models.SettingsPhoneNumberRequest{PhoneNumber: "+14155550123"}); rec.Code != http.StatusAccepted {
+		t.Fatalf("start verification = %d %s", rec.Code, rec.Body)
+	}
+	code := otpPattern.FindString(texts.Sent()[0].Body)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < maxPhoneVerificationAttempts; i++ {
+		s.do(user, http.MethodPost, "/api/v1/settings/security/phone/verify", models.SettingsVerifyPhoneNumberRequest{Code: wrong})
+	}
+	rec := s.do(user, http.MethodPost, "/api/v1/settings/security/phone/verify", models.SettingsVerifyPhoneNumberRequest{Code: code})
+	if detail := errorDetail(t, rec, http.StatusBadRequest); detail.Code != "TOO_MANY_ATTEMPTS" {
+		t.Errorf("the right code after %d wrong ones = %+v, want TOO_MANY_ATTEMPTS", maxPhoneVerificationAttempts, detail)
+	}
+
+	s, users = newSecuritySettingsServer(t, nil)
+	user = users.Add(&models.User{Email: "dana@example.test", Role: models.UserRoleSalesRep, IsActive: true})
+	if rec := s.do(user, http.MethodPost, "/api/v1/settings/security/phone", models.SettingsPhoneNumberRequest{PhoneNumber: "+14155550123"}); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("start verification without SMS = %d, want 503", rec.Code)
+	}
+}
@@ -1,42 +1,82 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/events"
 	"github.com/white/user-management/internal/middleware"
 	"github.com/white/user-management/internal/models"
 	"github.com/white/user-management/internal/repositories"
 	"github.com/white/user-management/internal/services"
-	"github.com/white/user-management/pkg/kafka"
 	"github.com/white/user-management/pkg/uuid"
 )
 
 // SequenceTemplateHandler handles sequence template operations
 type SequenceTemplateHandler struct {
-	sequenceRepo  *repositories.SequenceTemplateRepository
-	activityRepo  *repositories.ActivityRepository
-	userRepo      *repositories.MongoUserRepository
-	kafkaProducer *kafka.Producer
+	sequenceRepo *repositories.SequenceTemplateRepository
+	activityRepo *repositories.ActivityRepository
+	userRepo     repositories.UserStore
+	scheduleRepo *repositories.ScheduleDefinitionRepository
+	settingsRepo repositories.SettingsStore
+	eventOutbox  *repositories.EventOutboxRepository
 }
 
 // NewSequenceTemplateHandler creates a new sequence template handler
 func NewSequenceTemplateHandler(
 	sequenceRepo *repositories.SequenceTemplateRepository,
 	activityRepo *repositories.ActivityRepository,
-	userRepo *repositories.MongoUserRepository,
-	kafkaProducer *kafka.Producer,
+	userRepo repositories.UserStore,
+	scheduleRepo *repositories.ScheduleDefinitionRepository,
+	settingsRepo repositories.SettingsStore,
+	eventOutbox *repositories.EventOutboxRepository,
 ) *SequenceTemplateHandler {
 	return &SequenceTemplateHandler{
-		sequenceRepo:  sequenceRepo,
-		activityRepo:  activityRepo,
-		userRepo:      userRepo,
-		kafkaProducer: kafkaProducer,
+		sequenceRepo: sequenceRepo,
+		activityRepo: activityRepo,
+		userRepo:     userRepo,
+		scheduleRepo: scheduleRepo,
+		settingsRepo: settingsRepo,
+		eventOutbox:  eventOutbox,
 	}
 }
 
+// SequenceTemplateListResponse is a page of sequence templates
+type SequenceTemplateListResponse struct {
+	Success    bool                                `json:"success"`
+	Templates  []*models.SequenceTemplateWithSteps `json:"templates"`
+	Total      int64                               `json:"total"`
+	Page       int                                 `json:"page"`
+	Limit      int                                 `json:"limit"`
+	TotalPages int                                 `json:"totalPages"`
+}
+
+// SequenceValidationResponse is the result of validating a stored sequence
+// template. Warnings don't make it invalid
+type SequenceValidationResponse struct {
+	Success  bool                             `json:"success"`
+	ID       string                           `json:"id"`
+	Valid    bool                             `json:"valid"`
+	Errors   []models.SequenceValidationIssue `json:"errors"`
+	Warnings []models.SequenceValidationIssue `json:"warnings"`
+}
+
+// SequenceSchedulePreview is when each step of a sequence would be sent for a
+// recipient enrolled on Start
+type SequenceSchedulePreview struct {
+	Success  bool                          `json:"success"`
+	ID       string                        `json:"id"`
+	Start    string                        `json:"start"`    // YYYY-MM-DD
+	Timezone string                        `json:"timezone"` // Organization default for steps that don't set one
+	Steps    []models.SequenceStepFireTime `json:"steps"`
+	Warnings []string                      `json:"warnings"`
+}
 
 // CreateSequenceTemplate godoc
 // @Summary Create a new sequence template
@@ -46,341 +86,812 @@ func NewSequenceTemplateHandler(
 // @Produce json
 // @Param template body models.SequenceTemplateWithSteps true "Sequence template with steps"
 // @Success 201 {object} models.SequenceTemplateWithSteps
-// @Failure 400 {object} map[string]interface{} "Invalid request payload or validation error"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
-// @Router /api/v1/sequences [post]
+// @Failure 400 {object} CodedErrorResponse "Invalid request payload or validation error"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /sequences [post]
 // @Security BearerAuth
 func (h *SequenceTemplateHandler) CreateSequenceTemplate(w http.ResponseWriter, r *http.Request) {
-	// Parse request body - support both flat and nested structures
-	var payload map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "INVALID_REQUEST",
-				"message": "Invalid request payload: " + err.Error(),
-			},
-		})
+	template, ok := readSequenceTemplate(w, r, true)
+	if !ok {
 		return
 	}
 
-	// Build the template structure
-	var template models.SequenceTemplateWithSteps
+	// Get user ID from JWT context (set by authMiddleware)
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondWithErrorCode(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+	template.Template.CreatedBy = userID
+	template.Template.TenantID = middleware.GetTenantID(r)
 
-	// Check if payload has nested 'template' field or flat structure
-	if _, hasTemplate := payload["template"]; hasTemplate {
-		// Nested structure with 'template' and 'steps'
-		payloadBytes, _ := json.Marshal(payload)
-		if err := json.Unmarshal(payloadBytes, &template); err != nil {
-			respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-				"success": false,
-				"error": map[string]interface{}{
-					"code":    "INVALID_REQUEST",
-					"message": "Invalid template structure: " + err.Error(),
-				},
-			})
+	// Generate template ID
+	template.Template.TemplateID = uuid.MustNewUUID()
+
+	// Set template ID on all steps
+	for i := range template.Steps {
+		template.Steps[i].TemplateID = template.Template.TemplateID
+	}
+
+	// Create sequence template
+	if err := h.sequenceRepo.CreateSequenceTemplate(r.Context(), template); err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create sequence template: "+err.Error())
+		return
+	}
+
+	h.publishSequenceEvent(r.Context(), events.TypeSequenceTemplateCreated, template, userID)
+	h.logSequenceActivity(r.Context(), "sequence_template_created", "Sequence Template Created", "Created sequence template: "+template.Template.Name, userID, template.Template.TemplateID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":  true,
+		"id":       template.Template.TemplateID,
+		"template": template,
+	})
+}
+
+// ListSequenceTemplates godoc
+// @Summary List sequence templates
+// @Description Lists sequence templates within the caller's data scope, newest first, filtered by step channel, active flag and name search.
+// @Tags Sequences
+// @Produce json
+// @Param channel query string false "Only sequences with a step on this channel (email, sms, whatsapp, linkedin)"
+// @Param is_active query bool false "Filter by active flag"
+// @Param search query string false "Search in sequence name"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Items per page (default: 20, max: 100)"
+// @Success 200 {object} SequenceTemplateListResponse "templates, total, page, limit, totalPages"
+// @Failure 400 {object} CodedErrorResponse "Invalid query parameters"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /sequences [get]
+// @Security BearerAuth
+func (h *SequenceTemplateHandler) ListSequenceTemplates(w http.ResponseWriter, r *http.Request) {
+	dataScope, claims, err := requestScope(r, h.userRepo)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+	scopeCreatedBy, denyAll := services.CreatedByScope("sequences", dataScope, claims)
+	if denyAll {
+		respondWithErrorCode(w, http.StatusForbidden, "FORBIDDEN", "Permission denied")
+		return
+	}
+
+	query := r.URL.Query()
+	filters := repositories.SequenceTemplateFilters{
+		TenantID:       middleware.GetTenantID(r),
+		Channel:        query.Get("channel"),
+		Search:         query.Get("search"),
+		ScopeCreatedBy: scopeCreatedBy,
+	}
+	if filters.Channel != "" && !models.IsValidSequenceStepChannel(filters.Channel) {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid channel: must be email, sms, whatsapp, or linkedin")
+		return
+	}
+
+	isActiveStr := query.Get("is_active")
+	if isActiveStr == "" {
+		isActiveStr = query.Get("isActive")
+	}
+	if isActiveStr != "" {
+		isActive, err := strconv.ParseBool(isActiveStr)
+		if err != nil {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid is_active value")
 			return
 		}
-	} else {
-		// Flat structure - convert to nested
-		template.Template.Name, _ = payload["name"].(string)
-		template.Template.Description, _ = payload["description"].(string)
-
-		// Parse service_id (supports serviceId, service_id)
-		if serviceID, ok := payload["serviceId"].(string); ok && serviceID != "" {
-			template.Template.ServiceID = serviceID
-		} else if serviceID, ok := payload["service_id"].(string); ok && serviceID != "" {
-			template.Template.ServiceID = serviceID
-		}
+		filters.IsActive = &isActive
+	}
 
-		// Parse schedule_id (supports scheduleId, schedule_id)
-		if scheduleID, ok := payload["scheduleId"].(string); ok && scheduleID != "" {
-			template.Template.ScheduleID = scheduleID
-		} else if scheduleID, ok := payload["schedule_id"].(string); ok && scheduleID != "" {
-			template.Template.ScheduleID = scheduleID
+	page := 1
+	if pageStr := query.Get("page"); pageStr != "" {
+		p, err := strconv.Atoi(pageStr)
+		if err != nil || p < 1 {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid page number")
+			return
 		}
-
-		// Parse isActive (supports isActive, is_active)
-		if isActive, ok := payload["isActive"].(bool); ok {
-			template.Template.IsActive = isActive
-		} else if isActive, ok := payload["is_active"].(bool); ok {
-			template.Template.IsActive = isActive
-		} else {
-			template.Template.IsActive = true // Default to active
+		page = p
+	}
+	filters.Limit = 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid limit value")
+			return
 		}
-
-		// Parse steps array and map field names
-		if stepsData, hasSteps := payload["steps"]; hasSteps {
-			if stepsArray, ok := stepsData.([]interface{}); ok {
-				template.Steps = make([]models.CampaignSequenceStep, len(stepsArray))
-				for i, stepData := range stepsArray {
-					stepMap, ok := stepData.(map[string]interface{})
-					if !ok {
-						continue
-					}
-
-					// Map field names to model field names
-					step := &template.Steps[i]
-
-					// order / step_number / step_order -> StepOrder
-					if order, ok := stepMap["order"].(float64); ok {
-						step.StepOrder = int(order)
-					} else if stepNum, ok := stepMap["step_number"].(float64); ok {
-						step.StepOrder = int(stepNum)
-					} else if stepOrder, ok := stepMap["step_order"].(float64); ok {
-						step.StepOrder = int(stepOrder)
-					}
-
-					// communicationType / channel -> Channel
-					if commType, ok := stepMap["communicationType"].(string); ok {
-						step.Channel = commType
-					} else if channel, ok := stepMap["channel"].(string); ok {
-						step.Channel = channel
-					}
-
-					// subject (for email)
-					if subject, ok := stepMap["subject"].(string); ok {
-						step.Subject = subject
-					}
-
-					// message / body -> Body
-					if message, ok := stepMap["message"].(string); ok {
-						step.Body = message
-					} else if body, ok := stepMap["body"].(string); ok {
-						step.Body = body
-					}
-
-					// delayDays / delay_days / waitDays / wait_days -> DelayDays and WaitDays (proposed + legacy)
-					if delayDays, ok := stepMap["delayDays"].(float64); ok {
-						step.DelayDays = int(delayDays)
-						step.WaitDays = int(delayDays)
-					} else if delayDays, ok := stepMap["delay_days"].(float64); ok {
-						step.DelayDays = int(delayDays)
-						step.WaitDays = int(delayDays)
-					} else if waitDays, ok := stepMap["waitDays"].(float64); ok {
-						step.WaitDays = int(waitDays)
-						if step.DelayDays == 0 {
-							step.DelayDays = int(waitDays)
-						}
-					} else if waitDays, ok := stepMap["wait_days"].(float64); ok {
-						step.WaitDays = int(waitDays)
-						if step.DelayDays == 0 {
-							step.DelayDays = int(waitDays)
-						}
-					}
-
-					// waitHours / wait_hours (deprecated; ignored for new model)
-					if waitHours, ok := stepMap["waitHours"].(float64); ok {
-						step.WaitHours = int(waitHours)
-					} else if waitHours, ok := stepMap["wait_hours"].(float64); ok {
-						step.WaitHours = int(waitHours)
-					}
-
-					// sendAt / send_at / sendTime / send_time -> SendAt and SendTime (required HH:MM)
-					if sendAt, ok := stepMap["sendAt"].(string); ok && sendAt != "" {
-						step.SendAt = sendAt
-						step.SendTime = sendAt
-					} else if sendAt, ok := stepMap["send_at"].(string); ok && sendAt != "" {
-						step.SendAt = sendAt
-						step.SendTime = sendAt
-					} else if sendTime, ok := stepMap["sendTime"].(string); ok && sendTime != "" {
-						step.SendTime = sendTime
-						step.SendAt = sendTime
-					} else if sendTime, ok := stepMap["send_time"].(string); ok && sendTime != "" {
-						step.SendTime = sendTime
-						step.SendAt = sendTime
-					}
-
-					// templateId / content_template_id -> ContentTemplateID
-					if templateIDStr, ok := stepMap["templateId"].(string); ok && templateIDStr != "" {
-						step.ContentTemplateID = templateIDStr
-					} else if templateIDStr, ok := stepMap["content_template_id"].(string); ok && templateIDStr != "" {
-						step.ContentTemplateID = templateIDStr
-					}
-
-					// Generate content_template_id if not provided
-					if step.ContentTemplateID == "" {
-						step.ContentTemplateID = uuid.MustNewUUID()
-					}
-
-					// Parse attachments array
-					if attachmentsData, hasAttachments := stepMap["attachments"]; hasAttachments {
-						if attachmentsArray, ok := attachmentsData.([]interface{}); ok {
-							step.Attachments = make([]models.SequenceStepAttachment, 0, len(attachmentsArray))
-							for _, attachData := range attachmentsArray {
-								attachMap, ok := attachData.(map[string]interface{})
-								if !ok {
-									continue
-								}
-								attachment := models.SequenceStepAttachment{}
-								if id, ok := attachMap["id"].(string); ok {
-									attachment.ID = id
-								}
-								if name, ok := attachMap["name"].(string); ok {
-									attachment.Name = name
-								}
-								if typ, ok := attachMap["type"].(string); ok {
-									attachment.Type = typ
-								}
-								if size, ok := attachMap["size"].(string); ok {
-									attachment.Size = size
-								}
-								if webUrl, ok := attachMap["webUrl"].(string); ok {
-									attachment.WebURL = webUrl
-								} else if webUrl, ok := attachMap["web_url"].(string); ok {
-									attachment.WebURL = webUrl
-								}
-								if category, ok := attachMap["category"].(string); ok {
-									attachment.Category = category
-								}
-								step.Attachments = append(step.Attachments, attachment)
-							}
-						}
-					}
-				}
-			}
+		if l > 100 {
+			l = 100
 		}
+		filters.Limit = l
 	}
+	filters.Offset = (page - 1) * filters.Limit
 
-	// Validate required fields
-	if template.Template.Name == "" {
-		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "VALIDATION_ERROR",
-				"message": "Template name is required",
-			},
-		})
+	templates, total, err := h.sequenceRepo.ListSequenceTemplatesPage(r.Context(), filters)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list sequence templates: "+err.Error())
 		return
 	}
 
-	if len(template.Steps) == 0 {
-		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "VALIDATION_ERROR",
-				"message": "At least one step is required",
-			},
-		})
+	respondWithJSON(w, http.StatusOK, SequenceTemplateListResponse{
+		Success:    true,
+		Templates:  templates,
+		Total:      total,
+		Page:       page,
+		Limit:      filters.Limit,
+		TotalPages: (int(total) + filters.Limit - 1) / filters.Limit,
+	})
+}
+
+// GetSequenceTemplate godoc
+// @Summary Get a sequence template
+// @Description Returns a sequence template with its steps.
+// @Tags Sequences
+// @Produce json
+// @Param id path string true "Sequence template ID (UUID)"
+// @Success 200 {object} models.SequenceTemplateWithSteps
+// @Failure 400 {object} CodedErrorResponse "Invalid ID"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "Sequence template not found"
+// @Router /sequences/{id} [get]
+// @Security BearerAuth
+func (h *SequenceTemplateHandler) GetSequenceTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadSequenceInScope(w, r)
+	if !ok {
 		return
 	}
 
-	// Validate step ordering
-	if err := models.ValidateStepOrdering(template.Steps); err != nil {
-		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "VALIDATION_ERROR",
-				"message": "Invalid step ordering: " + err.Error(),
-			},
-		})
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"template": template,
+	})
+}
+
+// UpdateSequenceTemplate godoc
+// @Summary Update a sequence template
+// @Description Replaces a sequence template's details and steps. Accepts the same flat or nested payload as create; the version is bumped on every update. isActive keeps its current value when omitted from a flat payload.
+// @Tags Sequences
+// @Accept json
+// @Produce json
+// @Param id path string true "Sequence template ID (UUID)"
+// @Param template body models.SequenceTemplateWithSteps true "Sequence template with steps"
+// @Success 200 {object} models.SequenceTemplateWithSteps
+// @Failure 400 {object} CodedErrorResponse "Invalid request payload or validation error"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "Sequence template not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /sequences/{id} [put]
+// @Security BearerAuth
+func (h *SequenceTemplateHandler) UpdateSequenceTemplate(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.loadSequenceInScope(w, r)
+	if !ok {
 		return
 	}
 
-	// Normalize: ensure DelayDays and SendAt are set from legacy fields for persistence
+	template, ok := readSequenceTemplate(w, r, existing.Template.IsActive)
+	if !ok {
+		return
+	}
+
+	// Identity and authorship stay with the stored template
+	template.Template.TemplateID = existing.Template.TemplateID
+	template.Template.CreatedBy = existing.Template.CreatedBy
+	template.Template.CreatedAt = existing.Template.CreatedAt
+	template.Template.TenantID = existing.Template.TenantID
+	template.Template.Version = existing.Template.Version + 1
+
+	// Steps that keep their position keep their creation time
+	stepCreated := make(map[int]time.Time, len(existing.Steps))
+	for _, step := range existing.Steps {
+		stepCreated[step.StepOrder] = step.CreatedAt
+	}
+	now := time.Now()
 	for i := range template.Steps {
-		if template.Steps[i].DelayDays == 0 && template.Steps[i].WaitDays != 0 {
-			template.Steps[i].DelayDays = template.Steps[i].WaitDays
+		if createdAt, ok := stepCreated[template.Steps[i].StepOrder]; ok {
+			template.Steps[i].CreatedAt = createdAt
+		} else {
+			template.Steps[i].CreatedAt = now
 		}
-		if template.Steps[i].SendAt == "" && template.Steps[i].SendTime != "" {
-			template.Steps[i].SendAt = template.Steps[i].SendTime
+	}
+
+	if err := h.sequenceRepo.UpdateSequenceTemplate(r.Context(), middleware.GetTenantID(r), template); err != nil {
+		if errors.Is(err, repositories.ErrTemplateNotFound) {
+			respondWithErrorCode(w, http.StatusNotFound, "NOT_FOUND", "Sequence template not found")
+			return
 		}
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update sequence template: "+err.Error())
+		return
 	}
 
-	// Validate sequence step timing: send_at required, format HH:MM
-	if err := models.ValidateSequenceStepTiming(template.Steps); err != nil {
-		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "VALIDATION_ERROR",
-				"message": err.Error(),
-			},
-		})
+	userID := middleware.GetUserID(r)
+	h.publishSequenceEvent(r.Context(), events.TypeSequenceTemplateUpdated, template, userID)
+	h.logSequenceActivity(r.Context(), "sequence_template_updated", "Sequence Template Updated", "Updated sequence template: "+template.Template.Name, userID, template.Template.TemplateID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"id":       template.Template.TemplateID,
+		"template": template,
+	})
+}
+
+// DeleteSequenceTemplate godoc
+// @Summary Delete a sequence template
+// @Description Deletes a sequence template. Templates referenced by any campaign cannot be deleted.
+// @Tags Sequences
+// @Produce json
+// @Param id path string true "Sequence template ID (UUID)"
+// @Success 204 "No Content - Sequence template deleted"
+// @Failure 400 {object} CodedErrorResponse "Invalid ID"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "Sequence template not found"
+// @Failure 409 {object} CodedErrorResponse "Sequence template is used by campaigns"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /sequences/{id} [delete]
+// @Security BearerAuth
+func (h *SequenceTemplateHandler) DeleteSequenceTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadSequenceInScope(w, r)
+	if !ok {
 		return
 	}
+	templateID := template.Template.TemplateID
 
-	// Validate branch conditions
-	if err := template.Validate(); err != nil {
-		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "VALIDATION_ERROR",
-				"message": "Validation failed: " + err.Error(),
-			},
-		})
+	campaigns, err := h.sequenceRepo.CountCampaignsUsingSequence(r.Context(), templateID)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to check campaign usage: "+err.Error())
+		return
+	}
+	if campaigns > 0 {
+		respondWithErrorCode(w, http.StatusConflict, "SEQUENCE_IN_USE", fmt.Sprintf("Sequence template is used by %d campaign(s)", campaigns))
+		return
+	}
+
+	if err := h.sequenceRepo.DeleteSequenceTemplate(r.Context(), middleware.GetTenantID(r), templateID); err != nil {
+		if errors.Is(err, repositories.ErrTemplateNotFound) {
+			respondWithErrorCode(w, http.StatusNotFound, "NOT_FOUND", "Sequence template not found")
+			return
+		}
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete sequence template: "+err.Error())
 		return
 	}
 
-	// Get user ID from JWT context (set by authMiddleware)
 	userID := middleware.GetUserID(r)
-	if userID == "" {
-		// If user ID not in context, return unauthorized
-		respondWithJSON(w, http.StatusUnauthorized, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "UNAUTHORIZED",
-				"message": "User not authenticated",
-			},
-		})
+	h.publishSequenceEvent(r.Context(), events.TypeSequenceTemplateDeleted, template, userID)
+	h.logSequenceActivity(r.Context(), "sequence_template_deleted", "Sequence Template Deleted", "Deleted sequence template: "+template.Template.Name, userID, templateID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CloneSequenceTemplate godoc
+// @Summary Clone a sequence template
+// @Description Creates an active copy of a sequence template and its steps at version 1. Uses the given name or appends " (copy)" to the source name.
+// @Tags Sequences
+// @Accept json
+// @Produce json
+// @Param id path string true "Source sequence template ID (UUID)"
+// @Param request body models.DuplicateTemplateRequest false "Optional name for the copy"
+// @Success 201 {object} models.SequenceTemplateWithSteps
+// @Failure 400 {object} CodedErrorResponse "Invalid ID or request body"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "Sequence template not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /sequences/{id}/clone [post]
+// @Security BearerAuth
+func (h *SequenceTemplateHandler) CloneSequenceTemplate(w http.ResponseWriter, r *http.Request) {
+	source, ok := h.loadSequenceInScope(w, r)
+	if !ok {
 		return
 	}
-	template.Template.CreatedBy = userID
 
-	// Generate template ID
-	template.Template.TemplateID = uuid.MustNewUUID()
+	var req models.DuplicateTemplateRequest
+	if r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+	name := req.Name
+	if name == "" {
+		name = source.Template.Name + " (copy)"
+	}
 
-	// Set template ID on all steps
-	for i := range template.Steps {
-		template.Steps[i].TemplateID = template.Template.TemplateID
+	userID := middleware.GetUserID(r)
+	clone, err := h.sequenceRepo.Clone(r.Context(), middleware.GetTenantID(r), source.Template.TemplateID, name, userID)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to clone sequence template: "+err.Error())
+		return
 	}
 
-	// Create sequence template
-	if err := h.sequenceRepo.CreateSequenceTemplate(&template); err != nil {
-		respondWithJSON(w, http.StatusInternalServerError, map[string]interface{}{
-			"success": false,
-			"error": map[string]interface{}{
-				"code":    "DATABASE_ERROR",
-				"message": "Failed to create sequence template: " + err.Error(),
-			},
-		})
+	h.publishSequenceEvent(r.Context(), events.TypeSequenceTemplateCloned, clone, userID)
+	h.logSequenceActivity(r.Context(), "sequence_template_cloned", "Sequence Template Cloned", "Cloned sequence template "+source.Template.Name+" as "+clone.Template.Name, userID, clone.Template.TemplateID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":  true,
+		"id":       clone.Template.TemplateID,
+		"sourceId": source.Template.TemplateID,
+		"template": clone,
+	})
+}
+
+// ValidateSequenceTemplate godoc
+// @Summary Validate a stored sequence template
+// @Description Checks a stored sequence template (ordering, branches, send times, timezones and per-step content) and returns every problem found as a structured list. Steps whose send time falls outside the working hours of the template's schedule are reported as warnings and don't make the template invalid.
+// @Tags Sequences
+// @Produce json
+// @Param id path string true "Sequence template ID (UUID)"
+// @Success 200 {object} SequenceValidationResponse "valid, errors and warnings (stepOrder, field, message)"
+// @Failure 400 {object} CodedErrorResponse "Invalid ID"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "Sequence template not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /sequences/{id}/validate [post]
+// @Security BearerAuth
+func (h *SequenceTemplateHandler) ValidateSequenceTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadSequenceInScope(w, r)
+	if !ok {
 		return
 	}
 
-	// Publish Kafka event (fire-and-forget)
-	if h.kafkaProducer != nil {
-		event := map[string]interface{}{
-			"event_type":  "sequence_template_created",
-			"template_id": template.Template.TemplateID,
-			"name":        template.Template.Name,
-			"version":     template.Template.Version,
-			"step_count":  len(template.Steps),
-			"created_by":  template.Template.CreatedBy,
-			"timestamp":   time.Now().Format(time.RFC3339),
+	valid, validationErrors, err := h.sequenceRepo.ValidateSequence(r.Context(), middleware.GetTenantID(r), template.Template.TemplateID)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to validate sequence template: "+err.Error())
+		return
+	}
+
+	defaultTZ, err := h.defaultTimezone(r.Context())
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load default timezone: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SequenceValidationResponse{
+		Success:  true,
+		ID:       template.Template.TemplateID,
+		Valid:    valid,
+		Errors:   validationErrors,
+		Warnings: h.workingHoursWarnings(template, defaultTZ),
+	})
+}
+
+// PreviewSequenceSchedule godoc
+// @Summary Preview a sequence's send schedule
+// @Description Returns the date and time each step would be sent for a recipient enrolled on the start date. Delays accumulate from step to step and each step sends at its sendAt in its own timezone (the organization default when unset). Steps outside the sending windows of the template's schedule carry warnings, and steps outside the organization's send window carry deferredTo, the time they would actually be sent.
+// @Tags Sequences
+// @Produce json
+// @Param id path string true "Sequence template ID (UUID)"
+// @Param start query string false "Enrollment date, YYYY-MM-DD (default: today)"
+// @Success 200 {object} SequenceSchedulePreview "start, timezone and steps (order, dayOffset, sendAt, timezone, fireAt, fireAtUtc, deferredTo, warnings)"
+// @Failure 400 {object} CodedErrorResponse "Invalid ID, start date or step timing"
+// @Failure 401 {object} CodedErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Permission denied"
+// @Failure 404 {object} CodedErrorResponse "Sequence template not found"
+// @Failure 500 {object} CodedErrorResponse "Internal server error"
+// @Router /sequences/{id}/schedule-preview [get]
+// @Security BearerAuth
+func (h *SequenceTemplateHandler) PreviewSequenceSchedule(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.loadSequenceInScope(w, r)
+	if !ok {
+		return
+	}
+
+	defaultTZ, err := h.defaultTimezone(r.Context())
+	if err != nil {
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load default timezone: "+err.Error())
+		return
+	}
+
+	start := time.Now()
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		start, err = time.Parse("2006-01-02", startStr)
+		if err != nil {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid start date: expected YYYY-MM-DD")
+			return
+		}
+	}
+
+	steps, err := models.PreviewSequenceSchedule(template.Steps, start, defaultTZ)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	var warnings []string
+	window, err := h.orgSendWindow(r.Context())
+	if err != nil {
+		warnings = append(warnings, "Send window not checked: "+err.Error())
+	}
+	if window != nil {
+		for i := range steps {
+			if window.Contains(steps[i].FireAt) {
+				continue
+			}
+			opening := window.NextOpening(steps[i].FireAt).In(steps[i].FireAt.Location())
+			steps[i].DeferredTo = &opening
+			steps[i].Warnings = append(steps[i].Warnings, "Outside the organization's send window; sent at "+opening.Format("2006-01-02 15:04 MST")+" instead")
 		}
-		_ = h.kafkaProducer.PublishJSON(ctx, "sequence-events", event)
-	}
-
-	// Log activity
-	if h.activityRepo != nil {
-		activity := &models.Activity{
-			ID:            uuid.MustNewUUID(),
-			ActivityType:  "sequence_template_created",
-			Title:         "Sequence Template Created",
-			Description:   "Created sequence template: " + template.Template.Name,
-			Owner:         userID,
-			RelatedToType: "sequence_template",
-			RelatedToID:   template.Template.TemplateID,
-			Status:        "completed",
-			Priority:      "normal",
-			CreatedAt:     time.Now(),
+	}
+
+	schedule, err := h.templateSchedule(template)
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	if schedule != nil {
+		for i := range steps {
+			inWindow, err := schedule.InSendingWindow(steps[i].FireAt)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+				break
+			}
+			if !inWindow {
+				steps[i].Warnings = append(steps[i].Warnings, "Sends outside the working hours of schedule "+schedule.Name)
+			}
 		}
-		_ = h.activityRepo.CreateActivityCompat(activity)
 	}
 
-	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
-		"success":  true,
-		"id":       template.Template.TemplateID,
-		"template": template,
+	respondWithJSON(w, http.StatusOK, SequenceSchedulePreview{
+		Success:  true,
+		ID:       template.Template.TemplateID,
+		Start:    start.Format("2006-01-02"),
+		Timezone: defaultTZ,
+		Steps:    steps,
+		Warnings: warnings,
 	})
-}
\ No newline at end of file
+}
+
+// defaultTimezone returns the organization's default timezone for steps that don't set one
+func (h *SequenceTemplateHandler) defaultTimezone(ctx context.Context) (string, error) {
+	if h.settingsRepo == nil {
+		return "UTC", nil
+	}
+	settings, err := h.settingsRepo.GetSystemDefaultSettings(ctx)
+	if err != nil {
+		return "", err
+	}
+	if settings.Timezone == "" {
+		return "UTC", nil
+	}
+	return settings.Timezone, nil
+}
+
+// orgSendWindow returns the organization's send window, nil without settings
+func (h *SequenceTemplateHandler) orgSendWindow(ctx context.Context) (*models.SendWindow, error) {
+	if h.settingsRepo == nil {
+		return nil, nil
+	}
+	settings, err := h.settingsRepo.GetSystemDefaultSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return settings.SendWindow()
+}
+
+// templateSchedule loads the schedule definition a sequence template references.
+// It returns nil when the template has none or the schedule has no sending windows.
+func (h *SequenceTemplateHandler) templateSchedule(template *models.SequenceTemplateWithSteps) (*models.ScheduleDefinition, error) {
+	scheduleID := template.Template.ScheduleID
+	if scheduleID == "" || h.scheduleRepo == nil {
+		return nil, nil
+	}
+	schedule, err := h.scheduleRepo.GetScheduleDefinitionByID(scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("Working hours not checked: schedule %s could not be loaded (%v)", scheduleID, err)
+	}
+	if !schedule.HasSendingWindows() {
+		return nil, nil
+	}
+	return schedule, nil
+}
+
+// workingHoursWarnings flags steps whose send time falls outside every sending
+// window of the template's schedule. Weekdays depend on the enrollment date, so
+// only the time of day is checked (today's date is used for the timezone conversion).
+func (h *SequenceTemplateHandler) workingHoursWarnings(template *models.SequenceTemplateWithSteps, defaultTZ string) []models.SequenceValidationIssue {
+	warnings := []models.SequenceValidationIssue{}
+
+	schedule, err := h.templateSchedule(template)
+	if err != nil {
+		return append(warnings, models.SequenceValidationIssue{
+			StepOrder: 0,
+			Field:     "scheduleId",
+			Message:   err.Error(),
+		})
+	}
+	if schedule == nil {
+		return warnings
+	}
+
+	year, month, day := time.Now().Date()
+	for _, step := range template.Steps {
+		loc, err := time.LoadLocation(step.EffectiveTimezone(defaultTZ))
+		if err != nil {
+			continue // reported as an error
+		}
+		clock, err := time.Parse("15:04", step.EffectiveSendAt())
+		if err != nil {
+			continue // reported as an error
+		}
+		inHours, err := schedule.InSendingHours(time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, loc))
+		if err != nil {
+			return append(warnings, models.SequenceValidationIssue{
+				StepOrder: 0,
+				Field:     "scheduleId",
+				Message:   err.Error(),
+			})
+		}
+		if !inHours {
+			warnings = append(warnings, models.SequenceValidationIssue{
+				StepOrder: step.StepOrder,
+				Field:     "sendAt",
+				Message:   fmt.Sprintf("Send time %s (%s) is outside the working hours of schedule %s", step.EffectiveSendAt(), loc.String(), schedule.Name),
+			})
+		}
+	}
+	return warnings
+}
+
+// loadSequenceInScope loads the sequence template of the caller's tenant
+// named by the {id} path variable and enforces the caller's data scope, writing the error response
+// when it fails
+func (h *SequenceTemplateHandler) loadSequenceInScope(w http.ResponseWriter, r *http.Request) (*models.SequenceTemplateWithSteps, bool) {
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid sequence template ID format")
+		return nil, false
+	}
+
+	dataScope, claims, err := requestScope(r, h.userRepo)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return nil, false
+	}
+
+	template, err := h.sequenceRepo.GetSequenceTemplateByID(r.Context(), middleware.GetTenantID(r), templateID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrTemplateNotFound) {
+			respondWithErrorCode(w, http.StatusNotFound, "NOT_FOUND", "Sequence template not found")
+			return nil, false
+		}
+		respondWithErrorCode(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load sequence template: "+err.Error())
+		return nil, false
+	}
+
+	if !services.IsInScope("sequences", dataScope, claims, &template.Template) {
+		respondWithErrorCode(w, http.StatusForbidden, "FORBIDDEN", "Permission denied")
+		return nil, false
+	}
+
+	return template, true
+}
+
+// publishSequenceEvent records a sequence-events message in the events outbox
+func (h *SequenceTemplateHandler) publishSequenceEvent(ctx context.Context, eventType string, template *models.SequenceTemplateWithSteps, actorID string) {
+	recordEvent(ctx, h.eventOutbox, events.SequenceTemplateEvent{
+		Envelope:   events.NewEnvelope(eventType, actorID, template.Template.TenantID),
+		TemplateID: template.Template.TemplateID,
+		Name:       template.Template.Name,
+		Version:    template.Template.Version,
+		StepCount:  len(template.Steps),
+	})
+}
+
+// logSequenceActivity records a completed activity for a sequence template operation
+func (h *SequenceTemplateHandler) logSequenceActivity(ctx context.Context, activityType, title, description, userID, templateID string) {
+	if h.activityRepo == nil {
+		return
+	}
+	activity := &models.Activity{
+		ID:            uuid.MustNewUUID(),
+		ActivityType:  activityType,
+		Title:         title,
+		Description:   description,
+		Owner:         userID,
+		RelatedToType: "sequence_template",
+		RelatedToID:   templateID,
+		Status:        "completed",
+		Priority:      "normal",
+		CreatedAt:     time.Now(),
+	}
+	_ = h.activityRepo.CreateActivity(ctx, activity)
+}
+
+// =====================================================
+// Payload parsing
+// =====================================================
+
+// readSequenceTemplate decodes a create/update payload (flat or nested),
+// normalizes legacy step fields and validates the result, writing the error
+// response when it fails. defaultActive is used when a flat payload omits isActive.
+func readSequenceTemplate(w http.ResponseWriter, r *http.Request, defaultActive bool) (*models.SequenceTemplateWithSteps, bool) {
+	var payload map[string]interface{}
+	if !decodeJSON(w, r, &payload) {
+		return nil, false
+	}
+
+	template, err := parseSequenceTemplatePayload(payload, defaultActive)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid template structure: "+err.Error())
+		return nil, false
+	}
+
+	if err := validateSequenceTemplate(template); err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return nil, false
+	}
+
+	return template, true
+}
+
+// parseSequenceTemplatePayload builds a sequence template from a payload that
+// is either nested ({"template": {...}, "steps": [...]}) or flat (template
+// fields and steps at the top level, camelCase or snake_case)
+func parseSequenceTemplatePayload(payload map[string]interface{}, defaultActive bool) (*models.SequenceTemplateWithSteps, error) {
+	var template models.SequenceTemplateWithSteps
+
+	// Nested structure with 'template' and 'steps'
+	if _, hasTemplate := payload["template"]; hasTemplate {
+		payloadBytes, _ := json.Marshal(payload)
+		if err := json.Unmarshal(payloadBytes, &template); err != nil {
+			return nil, err
+		}
+		return &template, nil
+	}
+
+	// Flat structure - convert to nested
+	template.Template.Name, _ = payload["name"].(string)
+	template.Template.Description, _ = payload["description"].(string)
+	template.Template.ServiceID = firstString(payload, "serviceId", "service_id")
+	template.Template.ScheduleID = firstString(payload, "scheduleId", "schedule_id")
+
+	// Parse isActive (supports isActive, is_active)
+	if isActive, ok := payload["isActive"].(bool); ok {
+		template.Template.IsActive = isActive
+	} else if isActive, ok := payload["is_active"].(bool); ok {
+		template.Template.IsActive = isActive
+	} else {
+		template.Template.IsActive = defaultActive
+	}
+
+	// Parse steps array and map field names
+	if stepsArray, ok := payload["steps"].([]interface{}); ok {
+		template.Steps = make([]models.CampaignSequenceStep, len(stepsArray))
+		for i, stepData := range stepsArray {
+			if stepMap, ok := stepData.(map[string]interface{}); ok {
+				template.Steps[i] = parseSequenceStep(stepMap)
+			}
+		}
+	}
+
+	return &template, nil
+}
+
+// parseSequenceStep maps a flat step payload onto a sequence step
+func parseSequenceStep(stepMap map[string]interface{}) models.CampaignSequenceStep {
+	var step models.CampaignSequenceStep
+
+	// order / step_number / step_order -> StepOrder
+	if order, ok := stepMap["order"].(float64); ok {
+		step.StepOrder = int(order)
+	} else if stepNum, ok := stepMap["step_number"].(float64); ok {
+		step.StepOrder = int(stepNum)
+	} else if stepOrder, ok := stepMap["step_order"].(float64); ok {
+		step.StepOrder = int(stepOrder)
+	}
+
+	// communicationType / channel -> Channel
+	step.Channel = firstString(stepMap, "communicationType", "channel")
+
+	// subject (for email)
+	step.Subject, _ = stepMap["subject"].(string)
+
+	// message / body -> Body
+	step.Body = firstString(stepMap, "message", "body")
+
+	// delayDays / delay_days / waitDays / wait_days -> DelayDays and WaitDays (proposed + legacy)
+	if delayDays, ok := stepMap["delayDays"].(float64); ok {
+		step.DelayDays = int(delayDays)
+		step.WaitDays = int(delayDays)
+	} else if delayDays, ok := stepMap["delay_days"].(float64); ok {
+		step.DelayDays = int(delayDays)
+		step.WaitDays = int(delayDays)
+	} else if waitDays, ok := stepMap["waitDays"].(float64); ok {
+		step.WaitDays = int(waitDays)
+		step.DelayDays = int(waitDays)
+	} else if waitDays, ok := stepMap["wait_days"].(float64); ok {
+		step.WaitDays = int(waitDays)
+		step.DelayDays = int(waitDays)
+	}
+
+	// waitHours / wait_hours (deprecated; ignored for new model)
+	if waitHours, ok := stepMap["waitHours"].(float64); ok {
+		step.WaitHours = int(waitHours)
+	} else if waitHours, ok := stepMap["wait_hours"].(float64); ok {
+		step.WaitHours = int(waitHours)
+	}
+
+	// sendAt / send_at / sendTime / send_time -> SendAt and SendTime (required HH:MM)
+	if sendAt := firstString(stepMap, "sendAt", "send_at", "sendTime", "send_time"); sendAt != "" {
+		step.SendAt = sendAt
+		step.SendTime = sendAt
+	}
+
+	// timezone / time_zone -> Timezone (IANA; empty uses the org default)
+	step.Timezone = firstString(stepMap, "timezone", "time_zone")
+
+	// templateId / content_template_id -> ContentTemplateID
+	step.ContentTemplateID = firstString(stepMap, "templateId", "content_template_id")
+
+	// Generate content_template_id if not provided
+	if step.ContentTemplateID == "" {
+		step.ContentTemplateID = uuid.MustNewUUID()
+	}
+
+	// Parse attachments array
+	if attachmentsArray, ok := stepMap["attachments"].([]interface{}); ok {
+		step.Attachments = make([]models.SequenceStepAttachment, 0, len(attachmentsArray))
+		for _, attachData := range attachmentsArray {
+			attachMap, ok := attachData.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			attachment := models.SequenceStepAttachment{}
+			attachment.ID, _ = attachMap["id"].(string)
+			attachment.Name, _ = attachMap["name"].(string)
+			attachment.Type, _ = attachMap["type"].(string)
+			attachment.Size, _ = attachMap["size"].(string)
+			attachment.WebURL = firstString(attachMap, "webUrl", "web_url")
+			attachment.Category, _ = attachMap["category"].(string)
+			step.Attachments = append(step.Attachments, attachment)
+		}
+	}
+
+	return step
+}
+
+// firstString returns the first non-empty string value among keys
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := m[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// validateSequenceTemplate checks required fields, step ordering, send times
+// and branches, normalizing legacy step timing fields for persistence
+func validateSequenceTemplate(template *models.SequenceTemplateWithSteps) error {
+	if template.Template.Name == "" {
+		return errors.New("Template name is required")
+	}
+
+	if len(template.Steps) == 0 {
+		return errors.New("At least one step is required")
+	}
+
+	if err := models.ValidateStepOrdering(template.Steps); err != nil {
+		return fmt.Errorf("Invalid step ordering: %w", err)
+	}
+
+	// Normalize: ensure DelayDays and SendAt are set from legacy fields for persistence
+	for i := range template.Steps {
+		if template.Steps[i].DelayDays == 0 && template.Steps[i].WaitDays != 0 {
+			template.Steps[i].DelayDays = template.Steps[i].WaitDays
+		}
+		if template.Steps[i].SendAt == "" && template.Steps[i].SendTime != "" {
+			template.Steps[i].SendAt = template.Steps[i].SendTime
+		}
+	}
+
+	// Validate sequence step timing: send_at required, format HH:MM
+	if err := models.ValidateSequenceStepTiming(template.Steps); err != nil {
+		return err
+	}
+
+	// Validate branch conditions
+	if err := template.Validate(); err != nil {
+		return fmt.Errorf("Validation failed: %w", err)
+	}
+
+	return nil
+}
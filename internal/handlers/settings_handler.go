@@ -1,32 +1,98 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"strconv"
 
 	"github.com/white/user-management/internal/events"
 	"github.com/white/user-management/internal/middleware"
 	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
 	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/validation"
+	"github.com/white/user-management/pkg/uuid"
 	// "github.com/gorilla/mux"
 )
 
 // SettingsHandler handles settings-related HTTP requests
 // NOTE: Profile is read-only (managed by O365), so no userRepo needed for password changes
 type SettingsHandler struct {
-	repo *repositories.SettingsRepository
+	repo repositories.SettingsStore
 	// approvalRuleRepo *repositories.ApprovalRuleRepository
 	auditPublisher *events.AuditPublisher
+	users          repositories.UserStore // Resolves team members for team-scoped audit logs
+	requireVersion bool                   // System security updates must carry the version last read
+	emailBranding  *services.EmailBranding // Cached branding refreshed on company info updates
+	sendWindow     *services.SendWindowEnforcer
+	denials        *services.PermissionDenials // Requests refused for a missing permission or role
+	exportMaxRows  int                         // Most audit logs one export may hold
+}
+
+// SettingsUpdateResponse is the response to a settings update: the saved
+// settings and the fields the update changed
+type SettingsUpdateResponse[T any] struct {
+	Success bool                     `json:"success"`
+	Message string                   `json:"message"`
+	Data    T                        `json:"data"`
+	Changes services.SettingsChanges `json:"changes"`
+}
+
+// EmailSignaturePreview is a sample email with the caller's signature
+// applied
+type EmailSignaturePreview struct {
+	Subject  string `json:"subject"`
+	BodyHTML string `json:"bodyHtml"`
+	BodyText string `json:"bodyText"`
+	Enabled  bool   `json:"enabled"` // Whether the signature is added to outgoing emails
 }
 
 // NewSettingsHandler creates a new SettingsHandler
-// func NewSettingsHandler(repo *repositories.SettingsRepository, approvalRuleRepo *repositories.ApprovalRuleRepository) *SettingsHandler {
-func NewSettingsHandler(repo *repositories.SettingsRepository, auditPublisher *events.AuditPublisher) *SettingsHandler {
+// func NewSettingsHandler(repo repositories.SettingsStore, approvalRuleRepo *repositories.ApprovalRuleRepository) *SettingsHandler {
+func NewSettingsHandler(repo repositories.SettingsStore, auditPublisher *events.AuditPublisher) *SettingsHandler {
 	return &SettingsHandler{
 		repo: repo,
 		// approvalRuleRepo: approvalRuleRepo,
 		auditPublisher: auditPublisher,
+		exportMaxRows:  defaultExportMaxRows,
+	}
+}
+
+// SetUserStore sets the user store used to scope audit logs to the
+// caller's team
+func (h *SettingsHandler) SetUserStore(users repositories.UserStore) {
+	h.users = users
+}
+
+// SetRequireVersion makes system security updates without the version last
+// read fail with 428 instead of overwriting whatever is stored
+func (h *SettingsHandler) SetRequireVersion(required bool) {
+	h.requireVersion = required
+}
+
+// SetEmailBranding sets the email branding cache dropped when the company
+// info changes, so the next email uses the new branding
+func (h *SettingsHandler) SetEmailBranding(branding *services.EmailBranding) {
+	h.emailBranding = branding
+}
+
+// SetSendWindow sets the send window enforcer reported by GetSendWindow
+func (h *SettingsHandler) SetSendWindow(window *services.SendWindowEnforcer) {
+	h.sendWindow = window
+}
+
+// SetPermissionDenials sets the record of refused requests listed by
+// GetPermissionDenials
+func (h *SettingsHandler) SetPermissionDenials(denials *services.PermissionDenials) {
+	h.denials = denials
+}
+
+// SetExportMaxRows sets how many audit logs an export may hold before it
+// is refused
+func (h *SettingsHandler) SetExportMaxRows(limit int) {
+	if limit > 0 {
+		h.exportMaxRows = limit
 	}
 }
 
@@ -44,9 +110,9 @@ func (h *SettingsHandler) getUserID(r *http.Request) (string, bool) {
 // @Tags Settings
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Success 200 {object} DataResponse[models.SettingsUserProfile]
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /settings/profile [get]
 func (h *SettingsHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	userID, ok := h.getUserID(r)
@@ -61,9 +127,123 @@ func (h *SettingsHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    profile,
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SettingsUserProfile]{Success: true, Data: profile})
+}
+
+// ==================== Email Signature ====================
+
+// signaturePreviewHTML and signaturePreviewText are the sample message the
+// signature preview is rendered on
+const (
+	signaturePreviewSubject = "Following up on our call"
+	signaturePreviewHTML    = "<p>Hi Alex,</p><p>Thanks for your time today. I have attached the proposal we discussed; let me know if you have any questions.</p><p>Best regards,</p>"
+	signaturePreviewText    = "Hi Alex,\n\nThanks for your time today. I have attached the proposal we discussed; let me know if you have any questions.\n\nBest regards,"
+)
+
+// GetEmailSignature godoc
+// @Summary Get email signature
+// @Description Get the caller's email signature, appended to the emails they send while enabled
+// @Tags Settings
+// @Produce json
+// @Success 200 {object} DataResponse[models.SettingsEmailSignature]
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /settings/email-signature [get]
+// @Security BearerAuth
+func (h *SettingsHandler) GetEmailSignature(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.getUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	signature, err := h.repo.GetEmailSignature(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get email signature: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SettingsEmailSignature]{Success: true, Data: signature})
+}
+
+// UpdateEmailSignature godoc
+// @Summary Update email signature
+// @Description Save the caller's email signature. The signature is HTML; scripts, styles, frames, forms, event handler attributes and URLs other than http(s), mailto and tel are removed before it is saved. While enabled it is appended to the emails the caller sends, never to system emails.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Param request body models.SettingsUpdateEmailSignatureRequest true "Signature"
+// @Success 200 {object} DataResponse[models.SettingsEmailSignature]
+// @Failure 400 {object} CodedErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /settings/email-signature [put]
+// @Security BearerAuth
+func (h *SettingsHandler) UpdateEmailSignature(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.getUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req models.SettingsUpdateEmailSignatureRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	req.Signature = services.SanitizeSignatureHTML(req.Signature)
+
+	signature, err := h.repo.UpdateEmailSignature(r.Context(), userID, req)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update email signature: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SettingsEmailSignature]{
+		Success: true,
+		Message: "Email signature updated successfully",
+		Data:    signature,
+	})
+}
+
+// PreviewEmailSignature godoc
+// @Summary Preview email signature
+// @Description Render a sample message with the caller's saved signature appended the way sent emails get it, as HTML and plain text. The signature is applied even while disabled; enabled tells whether sent emails carry it.
+// @Tags Settings
+// @Produce json
+// @Success 200 {object} DataResponse[EmailSignaturePreview] "subject, bodyHtml, bodyText and enabled"
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /settings/email-signature/preview [get]
+// @Security BearerAuth
+func (h *SettingsHandler) PreviewEmailSignature(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.getUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	signature, err := h.repo.GetEmailSignature(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get email signature: "+err.Error())
+		return
+	}
+
+	sample := &models.CommMessage{
+		UserID:   userID,
+		Subject:  signaturePreviewSubject,
+		BodyHTML: signaturePreviewHTML,
+		BodyText: signaturePreviewText,
+	}
+	services.AppendSignature(sample, signature.Signature)
+
+	respondWithJSON(w, http.StatusOK, DataResponse[EmailSignaturePreview]{
+		Success: true,
+		Data: EmailSignaturePreview{
+			Subject:  sample.Subject,
+			BodyHTML: sample.BodyHTML,
+			BodyText: sample.BodyText,
+			Enabled:  signature.Enabled,
+		},
 	})
 }
 
@@ -75,10 +255,10 @@ func (h *SettingsHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 // @Tags Settings
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/company [get]
+// @Success 200 {object} DataResponse[models.SettingsCompanyInfo]
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/company [get]
 func (h *SettingsHandler) GetCompanyInfo(w http.ResponseWriter, r *http.Request) {
 	_, ok := h.getUserID(r)
 	if !ok {
@@ -92,24 +272,22 @@ func (h *SettingsHandler) GetCompanyInfo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    info,
-	})
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SettingsCompanyInfo]{Success: true, Data: info})
 }
 
 // UpdateCompanyInfo godoc
 // @Summary Update company information
-// @Description Update company information (admin only)
+// @Description Update company information (admin only). emailBranding replaces the branding of system emails and weekly reports: primaryColor must be a hex color and logoUrl an https URL; empty fields use the defaults. The response lists the changed fields with their old and new values; with dry_run=true nothing is saved.
 // @Tags Settings
 // @Accept json
 // @Produce json
+// @Param dry_run query bool false "Validate and return the changes without saving"
 // @Param request body models.SettingsUpdateCompanyInfoRequest true "Company info update data"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/company [put]
+// @Success 200 {object} SettingsUpdateResponse[models.SettingsCompanyInfo]
+// @Failure 400 {object} CodedErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/company [put]
 func (h *SettingsHandler) UpdateCompanyInfo(w http.ResponseWriter, r *http.Request) {
 	_, ok := h.getUserID(r)
 	if !ok {
@@ -117,9 +295,25 @@ func (h *SettingsHandler) UpdateCompanyInfo(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.SettingsUpdateCompanyInfoRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	current, err := h.repo.GetCompanyInfo(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get company info: "+err.Error())
+		return
+	}
+	proposed := *current
+	req.ApplyTo(&proposed)
+	if dryRun {
+		respondWithSettingsPreview(w, &proposed, services.DiffSettings(current, &proposed))
 		return
 	}
 
@@ -128,24 +322,16 @@ func (h *SettingsHandler) UpdateCompanyInfo(w http.ResponseWriter, r *http.Reque
 		respondWithError(w, http.StatusInternalServerError, "Failed to update company info: "+err.Error())
 		return
 	}
+	h.emailBranding.Invalidate()
 
-	// Publish audit log event (fire-and-forget)
-	if h.auditPublisher != nil {
-		userID, _ := h.getUserID(r)
-		userName, _ := r.Context().Value(middleware.NameKey).(string)
-		h.auditPublisher.PublishSettingsEvent(
-			r,
-			userID,
-			userName,
-			events.ActionSettingsUpdated,
-			"Company information updated",
-		)
-	}
+	changes := services.DiffSettings(current, info)
+	h.publishSettingsChanges(r, "Company information", changes)
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    info,
-		"message": "Company information updated successfully",
+	respondWithJSON(w, http.StatusOK, SettingsUpdateResponse[*models.SettingsCompanyInfo]{
+		Success: true,
+		Message: "Company information updated successfully",
+		Data:    info,
+		Changes: changes,
 	})
 }
 
@@ -157,10 +343,10 @@ func (h *SettingsHandler) UpdateCompanyInfo(w http.ResponseWriter, r *http.Reque
 // @Tags Settings
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/notifications [get]
+// @Success 200 {object} DataResponse[models.SettingsNotificationSettings]
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/notifications [get]
 func (h *SettingsHandler) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
 	userID, ok := h.getUserID(r)
 	if !ok {
@@ -174,10 +360,7 @@ func (h *SettingsHandler) GetNotificationSettings(w http.ResponseWriter, r *http
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    settings,
-	})
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SettingsNotificationSettings]{Success: true, Data: settings})
 }
 
 // UpdateNotificationSettings godoc
@@ -187,11 +370,11 @@ func (h *SettingsHandler) GetNotificationSettings(w http.ResponseWriter, r *http
 // @Accept json
 // @Produce json
 // @Param request body models.SettingsUpdateNotificationSettingsRequest true "Notification settings update data"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/notifications [put]
+// @Success 200 {object} DataResponse[models.SettingsNotificationSettings]
+// @Failure 400 {object} CodedErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/notifications [put]
 func (h *SettingsHandler) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
 	userID, ok := h.getUserID(r)
 	if !ok {
@@ -199,9 +382,18 @@ func (h *SettingsHandler) UpdateNotificationSettings(w http.ResponseWriter, r *h
 		return
 	}
 
-	var req models.SettingsUpdateNotificationSettingsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	// Toggles missing from the body keep their current values
+	current, err := h.repo.GetNotificationSettings(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get notification settings: "+err.Error())
+		return
+	}
+	req := models.SettingsUpdateNotificationSettingsRequest{
+		EmailNotifications:   &current.EmailNotifications,
+		BrowserNotifications: &current.BrowserNotifications,
+		DigestFrequency:      &current.DigestFrequency,
+	}
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
@@ -211,10 +403,10 @@ func (h *SettingsHandler) UpdateNotificationSettings(w http.ResponseWriter, r *h
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    settings,
-		"message": "Notification settings updated successfully",
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SettingsNotificationSettings]{
+		Success: true,
+		Message: "Notification settings updated successfully",
+		Data:    settings,
 	})
 }
 
@@ -222,16 +414,19 @@ func (h *SettingsHandler) UpdateNotificationSettings(w http.ResponseWriter, r *h
 
 // GetAuditLogs godoc
 // @Summary Get audit logs
-// @Description Get system audit logs with pagination
+// @Description Get system audit logs with pagination, limited to the caller's data scope for users
 // @Tags Settings
 // @Accept json
 // @Produce json
 // @Param limit query int false "Number of logs to return (default 10, max 100)"
-// @Param offset query int false "Number of logs to skip (default 0)"
-// @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/audit-logs [get]
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param offset query int false "Number of logs to skip, for offset paging with a total"
+// @Param page query int false "Page number, for page paging with a total"
+// @Success 200 {object} pagination.Envelope[models.SettingsAuditLog] "total only with offset or page paging"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/audit-logs [get]
 func (h *SettingsHandler) GetAuditLogs(w http.ResponseWriter, r *http.Request) {
 	_, ok := h.getUserID(r)
 	if !ok {
@@ -239,39 +434,186 @@ func (h *SettingsHandler) GetAuditLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse query parameters
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
+	page, err := pagination.Parse(r, 10)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	limit := 10
-	offset := 0
+	userIDs, err := h.auditLogUsers(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve data scope: "+err.Error())
+		return
+	}
 
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
+	logs, err := h.repo.GetAuditLogs(r.Context(), userIDs, page)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
 		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get audit logs: "+err.Error())
+		return
 	}
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil {
-			offset = o
+
+	envelope := pagination.NewEnvelope(page, logs, func(log models.SettingsAuditLog) pagination.Cursor {
+		return pagination.Cursor{SortValue: log.Timestamp, ID: log.ID.Hex()}
+	})
+	if page.PageMode {
+		total, err := h.repo.CountAuditLogs(r.Context(), userIDs)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count audit logs: "+err.Error())
+			return
 		}
+		envelope = envelope.WithTotal(total)
 	}
 
-	logs, total, err := h.repo.GetAuditLogs(r.Context(), limit, offset)
+	respondWithJSON(w, http.StatusOK, envelope)
+}
+
+// auditLogUsers returns the users whose audit logs the caller may see, nil
+// for all of them
+func (h *SettingsHandler) auditLogUsers(r *http.Request) ([]string, error) {
+	dataScope, claims, err := requestScope(r, h.users)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get audit logs: "+err.Error())
+		return nil, err
+	}
+	userIDs, denyAll := services.CreatedByScope("audit_logs", dataScope, claims)
+	if denyAll {
+		userIDs = []string{}
+	}
+	return userIDs, nil
+}
+
+// ExportAuditLogs godoc
+// @Summary Export audit logs
+// @Description Downloads the audit logs within the caller's data scope, newest first, as a spreadsheet with a frozen header row and a Summary sheet counting them by action and user, or as CSV without the summary. Exports over the configured row limit are refused.
+// @Tags Settings
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce text/csv
+// @Param format query string false "xlsx (default) or csv"
+// @Success 200 {file} file "audit-logs-<date>.xlsx or .csv"
+// @Failure 400 {object} CodedErrorResponse "Invalid format, or EXPORT_TOO_LARGE"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing audit log permission"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/system/audit-logs/export [get]
+func (h *SettingsHandler) ExportAuditLogs(w http.ResponseWriter, r *http.Request) {
+	requestedBy, ok := h.getUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	format, ok := exportFormat(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid format, must be xlsx or csv")
+		return
+	}
+	userIDs, err := h.auditLogUsers(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve data scope: "+err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data": map[string]interface{}{
-			"logs":   logs,
-			"total":  total,
-			"limit":  limit,
-			"offset": offset,
-		},
+	total, err := h.repo.CountAuditLogs(r.Context(), userIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count audit logs: "+err.Error())
+		return
+	}
+	if total > int64(h.exportMaxRows) {
+		respondExportTooLarge(w, "audit logs", total, h.exportMaxRows)
+		return
+	}
+
+	// Once the first row is out the status can no longer change, so a
+	// failure part way through is only logged
+	export, err := startExport(w, "audit-logs", format, "Audit Logs",
+		[]float64{22, 38, 24, 24, 24, 60, 16},
+		[]string{"Timestamp", "User ID", "User Name", "Action", "Resource", "Details", "IP Address"})
+	if err != nil {
+		log.Printf("Audit log export failed (requested by %s): %v", requestedBy, err)
+		return
+	}
+	byAction, byUser := newExportTally("Action"), newExportTally("User")
+	rows := 0
+	err = h.repo.EachAuditLog(r.Context(), userIDs, func(entry *models.SettingsAuditLog) error {
+		if err := export.row(entry.Timestamp, entry.UserID, entry.UserName, entry.Action, entry.Resource, entry.Details, entry.IPAddress); err != nil {
+			return err
+		}
+		byAction.add(entry.Action)
+		byUser.add(entry.UserName)
+		rows++
+		return nil
 	})
+	if err == nil {
+		err = export.summary(rows, byAction, byUser)
+	}
+	if closeErr := export.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Audit log export failed after %d rows (requested by %s): %v", rows, requestedBy, err)
+		return
+	}
+	log.Printf("Audit log %s export of %d rows by %s", format, rows, requestedBy)
+}
+
+// GetPermissionDenials godoc
+// @Summary List refused requests
+// @Description Lists the requests of the last 30 days refused because the caller lacked the permission or role the route requires, newest first, for reviewing privilege escalation attempts. Throttled ones were refused with 429 after the user was denied too often.
+// @Tags Settings
+// @Produce json
+// @Param user_id query string false "Only the denials of this user"
+// @Param limit query int false "Number of denials to return (default 50, max 100)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param offset query int false "Number of denials to skip, for offset paging with a total"
+// @Param page query int false "Page number, for page paging with a total"
+// @Success 200 {object} pagination.Envelope[models.PermissionDenial] "total only with offset or page paging"
+// @Failure 400 {object} ErrorResponse "Invalid user ID or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Missing audit log permission"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/system/audit-logs/permission-denials [get]
+func (h *SettingsHandler) GetPermissionDenials(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID != "" {
+		var err error
+		if userID, err = uuid.ParseUUID(userID); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	denials, err := h.denials.List(r.Context(), userID, page)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get permission denials: "+err.Error())
+		return
+	}
+
+	envelope := pagination.NewEnvelope(page, denials, func(denial models.PermissionDenial) pagination.Cursor {
+		return pagination.Cursor{SortValue: denial.OccurredAt, ID: denial.ID.Hex()}
+	})
+	if page.PageMode {
+		total, err := h.denials.Count(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to count permission denials: "+err.Error())
+			return
+		}
+		envelope = envelope.WithTotal(total)
+	}
+
+	respondWithJSON(w, http.StatusOK, envelope)
 }
 
 // ==================== System Default Settings ====================
@@ -282,10 +624,10 @@ func (h *SettingsHandler) GetAuditLogs(w http.ResponseWriter, r *http.Request) {
 // @Tags Settings
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/defaults [get]
+// @Success 200 {object} DataResponse[models.SystemDefaultSettings]
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/defaults [get]
 func (h *SettingsHandler) GetSystemDefaultSettings(w http.ResponseWriter, r *http.Request) {
 	_, ok := h.getUserID(r)
 	if !ok {
@@ -299,25 +641,55 @@ func (h *SettingsHandler) GetSystemDefaultSettings(w http.ResponseWriter, r *htt
 		return
 	}
 
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SystemDefaultSettings]{Success: true, Data: settings})
+}
+
+
+// GetSendWindow godoc
+// @Summary Get the send window
+// @Description Returns the working hours and days outbound messages that are not urgent are sent in, in the organization's timezone, whether the window is open now and when it next opens. Messages sent while it is closed are scheduled for nextOpening; 2FA codes and password resets are always sent right away.
+// @Tags Settings
+// @Produce json
+// @Success 200 {object} models.SendWindowStatus
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /settings/send-window [get]
+// @Security BearerAuth
+func (h *SettingsHandler) GetSendWindow(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.getUserID(r); !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	window := h.sendWindow
+	if window == nil {
+		window = services.NewSendWindowEnforcer(h.repo)
+	}
+	status, err := window.Status(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get send window: "+err.Error())
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"data":    settings,
+		"data":    status,
 	})
 }
 
-
 // UpdateSystemDefaultSettings godoc
 // @Summary Update system default settings
-// @Description Update system-wide default settings (admin only)
+// @Description Update system-wide default settings (admin only). Working hours are HH:MM (24h) times that must start before they end, and workingDays lists weekday names (monday to friday when unset); together with the timezone they make the send window of outbound messages. The response lists the changed fields with their old and new values; with dry_run=true the update is validated and nothing is saved.
 // @Tags Settings
 // @Accept json
 // @Produce json
+// @Param dry_run query bool false "Validate and return the changes without saving"
 // @Param request body models.UpdateSystemDefaultSettingsRequest true "Settings update data"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/defaults [put]
+// @Success 200 {object} SettingsUpdateResponse[models.SystemDefaultSettings]
+// @Failure 400 {object} CodedErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/defaults [put]
 func (h *SettingsHandler) UpdateSystemDefaultSettings(w http.ResponseWriter, r *http.Request) {
 	_, ok := h.getUserID(r)
 	if !ok {
@@ -325,9 +697,29 @@ func (h *SettingsHandler) UpdateSystemDefaultSettings(w http.ResponseWriter, r *
 		return
 	}
 
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.UpdateSystemDefaultSettingsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	current, err := h.repo.GetSystemDefaultSettings(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get system default settings: "+err.Error())
+		return
+	}
+	proposed := *current
+	req.ApplyTo(&proposed)
+	if errs := services.ValidateSystemDefaultSettings(&proposed); len(errs) > 0 {
+		respondWithInvalidFields(w, errs)
+		return
+	}
+	if dryRun {
+		respondWithSettingsPreview(w, &proposed, services.DiffSettings(current, &proposed))
 		return
 	}
 
@@ -337,26 +729,151 @@ func (h *SettingsHandler) UpdateSystemDefaultSettings(w http.ResponseWriter, r *
 		return
 	}
 
-	// Publish audit log event (fire-and-forget)
-	if h.auditPublisher != nil {
-		userID, _ := h.getUserID(r)
-		userName, _ := r.Context().Value(middleware.NameKey).(string)
-		h.auditPublisher.PublishSettingsEvent(
-			r,
-			userID,
-			userName,
-			events.ActionSettingsUpdated,
-			"System default settings updated",
-		)
+	changes := services.DiffSettings(current, settings)
+	h.publishSettingsChanges(r, "System default settings", changes)
+
+	respondWithJSON(w, http.StatusOK, SettingsUpdateResponse[*models.SystemDefaultSettings]{
+		Success: true,
+		Message: "System default settings updated successfully",
+		Data:    settings,
+		Changes: changes,
+	})
+}
+
+
+// ==================== System Security Settings ====================
+
+// GetSystemSecuritySettings godoc
+// @Summary Get system security settings
+// @Description Get system-wide security settings (password policy, sessions, template approval)
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Success 200 {object} DataResponse[models.SystemSecuritySettings]
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/security [get]
+func (h *SettingsHandler) GetSystemSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	_, ok := h.getUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	settings, err := h.repo.GetSystemSecuritySettings(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get system security settings: "+err.Error())
+		return
+	}
+	setVersionETag(w, settings.Version)
+
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SystemSecuritySettings]{Success: true, Data: settings})
+}
+
+// UpdateSystemSecuritySettings godoc
+// @Summary Update system security settings
+// @Description Update system-wide security settings (admin only). minPasswordLength must be between 8 and 128, sessionTimeoutMinutes positive and ipWhitelist a list of IP addresses or CIDR ranges separated by commas or newlines. The response lists the changed fields with their old and new values; with dry_run=true the update is validated and nothing is saved, and a version sent is checked without being required.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Param dry_run query bool false "Validate and return the changes without saving"
+// @Param If-Match header string false "Version last read, as returned in the ETag header"
+// @Param request body models.UpdateSystemSecuritySettingsRequest true "Security settings update data"
+// @Success 200 {object} SettingsUpdateResponse[models.SystemSecuritySettings]
+// @Failure 400 {object} CodedErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} VersionConflictResponse "Settings changed since the version sent; includes the current settings"
+// @Failure 428 {object} CodedErrorResponse "Version required but not sent"
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/security [put]
+func (h *SettingsHandler) UpdateSystemSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	_, ok := h.getUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateSystemSecuritySettingsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	version, ok := expectedVersion(w, r, req.Version, h.requireVersion && !dryRun)
+	if !ok {
+		return
+	}
+	req.Version = version
+
+	current, err := h.repo.GetSystemSecuritySettings(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get system security settings: "+err.Error())
+		return
+	}
+	proposed := *current
+	req.ApplyTo(&proposed)
+	if errs := services.ValidateSystemSecuritySettings(&proposed); len(errs) > 0 {
+		respondWithInvalidFields(w, errs)
+		return
+	}
+	if dryRun {
+		if version != nil && *version != current.Version {
+			respondWithVersionConflict(w, current)
+			return
+		}
+		setVersionETag(w, current.Version)
+		respondWithSettingsPreview(w, &proposed, services.DiffSettings(current, &proposed))
+		return
 	}
 
+	settings, err := h.repo.UpdateSystemSecuritySettings(r.Context(), &req)
+	if err != nil {
+		if errors.Is(err, repositories.ErrVersionConflict) {
+			if current, getErr := h.repo.GetSystemSecuritySettings(r.Context()); getErr == nil {
+				respondWithVersionConflict(w, current)
+				return
+			}
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to update system security settings: "+err.Error())
+		return
+	}
+	setVersionETag(w, settings.Version)
+
+	changes := services.DiffSettings(current, settings)
+	h.publishSettingsChanges(r, "System security settings", changes)
+
+	respondWithJSON(w, http.StatusOK, SettingsUpdateResponse[*models.SystemSecuritySettings]{
+		Success: true,
+		Message: "System security settings updated successfully",
+		Data:    settings,
+		Changes: changes,
+	})
+}
+
+// respondWithSettingsPreview writes the settings a dry run update would save
+// and the fields it would change
+func respondWithSettingsPreview(w http.ResponseWriter, settings interface{}, changes services.SettingsChanges) {
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
+		"dryRun":  true,
 		"data":    settings,
-		"message": "System default settings updated successfully",
+		"changes": changes,
 	})
 }
 
+// publishSettingsChanges records a settings update in the audit log with the
+// changed fields and their old and new values
+func (h *SettingsHandler) publishSettingsChanges(r *http.Request, subject string, changes services.SettingsChanges) {
+	if h.auditPublisher == nil {
+		return
+	}
+	userID, _ := h.getUserID(r)
+	userName, _ := r.Context().Value(middleware.NameKey).(string)
+	h.auditPublisher.PublishSettingsChangeEvent(r, userID, userName, changes.Describe(subject), changes.Metadata())
+}
 
 // ==================== System Email & Notification Settings ====================
 
@@ -366,10 +883,10 @@ func (h *SettingsHandler) UpdateSystemDefaultSettings(w http.ResponseWriter, r *
 // @Tags Settings
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/email-notifications [get]
+// @Success 200 {object} DataResponse[models.SystemEmailNotificationSettings]
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/email-notifications [get]
 func (h *SettingsHandler) GetSystemEmailNotificationSettings(w http.ResponseWriter, r *http.Request) {
 	_, ok := h.getUserID(r)
 	if !ok {
@@ -383,10 +900,7 @@ func (h *SettingsHandler) GetSystemEmailNotificationSettings(w http.ResponseWrit
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    settings,
-	})
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SystemEmailNotificationSettings]{Success: true, Data: settings})
 }
 
 // UpdateSystemEmailNotificationSettings godoc
@@ -396,11 +910,11 @@ func (h *SettingsHandler) GetSystemEmailNotificationSettings(w http.ResponseWrit
 // @Accept json
 // @Produce json
 // @Param request body models.UpdateSystemEmailNotificationSettingsRequest true "Email notification settings update data"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /system/email-notifications [put]
+// @Success 200 {object} DataResponse[models.SystemEmailNotificationSettings]
+// @Failure 400 {object} CodedErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/system/email-notifications [put]
 func (h *SettingsHandler) UpdateSystemEmailNotificationSettings(w http.ResponseWriter, r *http.Request) {
 	_, ok := h.getUserID(r)
 	if !ok {
@@ -409,8 +923,11 @@ func (h *SettingsHandler) UpdateSystemEmailNotificationSettings(w http.ResponseW
 	}
 
 	var req models.UpdateSystemEmailNotificationSettingsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.SystemNotificationEmail != nil && *req.SystemNotificationEmail != "" && !validation.IsEmail(*req.SystemNotificationEmail) {
+		respondWithInvalidFields(w, validation.Errors{"systemNotificationEmail": "must be a valid email address"})
 		return
 	}
 
@@ -433,9 +950,9 @@ func (h *SettingsHandler) UpdateSystemEmailNotificationSettings(w http.ResponseW
 		)
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    settings,
-		"message": "System email notification settings updated successfully",
+	respondWithJSON(w, http.StatusOK, DataResponse[*models.SystemEmailNotificationSettings]{
+		Success: true,
+		Message: "System email notification settings updated successfully",
+		Data:    settings,
 	})
 }
@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/xlsx"
+	"github.com/white/user-management/pkg/xlsx/xlsxtest"
+)
+
+// TestAuditLogsFollowTheUsersScope checks a team-scoped caller sees the
+// audit logs of their team only, and an own-scoped one their own
+func TestAuditLogsFollowTheUsersScope(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	settings := memory.NewSettingsStore(users)
+	h := NewSettingsHandler(settings, nil)
+	h.SetUserStore(users)
+	s.handle(http.MethodGet, "/api/v1/admin/system/audit-logs", h.GetAuditLogs)
+
+	manager := users.Add(&models.User{Email: "manager@example.com", Role: models.UserRoleManager, IsActive: true, Team: "north"})
+	teammate := users.Add(&models.User{Email: "north@example.com", Role: models.UserRoleSalesRep, IsActive: true, Team: "north"})
+	stranger := users.Add(&models.User{Email: "south@example.com", Role: models.UserRoleSalesRep, IsActive: true, Team: "south"})
+	for _, user := range []*models.User{manager, teammate, stranger} {
+		settings.AddAuditLog(models.SettingsAuditLog{UserID: user.ID, UserName: user.Email, Action: "login"})
+	}
+
+	logsOf := func(scope models.DataScope) []string {
+		t.Helper()
+		ctx := context.WithValue(context.Background(), middleware.DataScopeKey, scope)
+		rec := s.doContext(ctx, manager, http.MethodGet, "/api/v1/admin/system/audit-logs", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("audit logs = %d %s", rec.Code, rec.Body)
+		}
+		var page pagination.Envelope[models.SettingsAuditLog]
+		decodeBody(t, rec, &page)
+		var names []string
+		for _, log := range page.Items {
+			names = append(names, log.UserName)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	for _, tt := range []struct {
+		scope string
+		want  []string
+	}{
+		{models.DataScopeAll, []string{manager.Email, teammate.Email, stranger.Email}},
+		{models.DataScopeTeam, []string{manager.Email, teammate.Email}},
+		{models.DataScopeOwn, []string{manager.Email}},
+		{models.DataScopeNone, nil},
+	} {
+		want := slices.Sorted(slices.Values(tt.want))
+		if got := logsOf(models.DataScope{Users: tt.scope}); !slices.Equal(got, want) {
+			t.Errorf("users scope %s: logs of %v, want %v", tt.scope, got, want)
+		}
+	}
+}
+
+// TestSystemSecurityUpdatesAreVersioned interleaves two updates of the same
+// version of the system security settings
+func TestSystemSecurityUpdatesAreVersioned(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	h := NewSettingsHandler(memory.NewSettingsStore(users), nil)
+	s.handle(http.MethodGet, "/api/v1/admin/system/security", h.GetSystemSecuritySettings)
+	s.handle(http.MethodPut, "/api/v1/admin/system/security", h.UpdateSystemSecuritySettings)
+	admin := users.Add(&models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true})
+
+	etag := s.do(admin, http.MethodGet, "/api/v1/admin/system/security", nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on the system security settings")
+	}
+	update := func(timeout int, version string) *httptest.ResponseRecorder {
+		return s.doHeader(context.Background(), admin, http.MethodPut, "/api/v1/admin/system/security",
+			models.UpdateSystemSecuritySettingsRequest{SessionTimeoutMinutes: &timeout}, http.Header{"If-Match": {version}})
+	}
+
+	if rec := update(45, etag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Fatalf("first update = %d, ETag %q; want 200 and a new version", rec.Code, rec.Header().Get("ETag"))
+	}
+	rec := update(90, etag)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("second update = %d %s, want 409", rec.Code, rec.Body)
+	}
+	var conflict struct {
+		Current models.SystemSecuritySettings `json:"current"`
+	}
+	decodeBody(t, rec, &conflict)
+	if conflict.Current.SessionTimeoutMinutes != 45 {
+		t.Errorf("current session timeout = %d, want the first update's 45", conflict.Current.SessionTimeoutMinutes)
+	}
+
+	// Opt-in: a client sending no version still updates
+	rec = s.do(admin, http.MethodPut, "/api/v1/admin/system/security", models.UpdateSystemSecuritySettingsRequest{})
+	if rec.Code != http.StatusOK {
+		t.Errorf("update without a version = %d %s", rec.Code, rec.Body)
+	}
+	h.SetRequireVersion(true)
+	if rec := s.do(admin, http.MethodPut, "/api/v1/admin/system/security", models.UpdateSystemSecuritySettingsRequest{}); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("update without a required version = %d, want 428", rec.Code)
+	}
+}
+
+// TestAuditLogCursorPagesSurviveInserts pages through the audit logs by
+// cursor while new entries are logged, and checks the entries logged before
+// the first page are each listed once and the new ones not at all
+func TestAuditLogCursorPagesSurviveInserts(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	settings := memory.NewSettingsStore(users)
+	s.handle(http.MethodGet, "/api/v1/admin/system/audit-logs", NewSettingsHandler(settings, nil).GetAuditLogs)
+	admin := users.Add(&models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true})
+	for i := 0; i < 7; i++ {
+		settings.AddAuditLog(models.SettingsAuditLog{UserID: admin.ID, Action: fmt.Sprintf("old-%d", i)})
+	}
+
+	var seen []string
+	target := "/api/v1/admin/system/audit-logs?limit=3"
+	for pages := 0; ; pages++ {
+		if pages > 7 {
+			t.Fatal("still paging after 7 pages")
+		}
+		rec := s.do(admin, http.MethodGet, target, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d = %d %s", pages+1, rec.Code, rec.Body)
+		}
+		var page pagination.Envelope[models.SettingsAuditLog]
+		decodeBody(t, rec, &page)
+		if page.Total != nil {
+			t.Errorf("cursor page has total %d", *page.Total)
+		}
+		for _, log := range page.Items {
+			seen = append(seen, log.Action)
+		}
+		if !page.HasMore {
+			break
+		}
+		settings.AddAuditLog(models.SettingsAuditLog{UserID: admin.ID, Action: fmt.Sprintf("new-%d", pages)})
+		target = "/api/v1/admin/system/audit-logs?limit=3&cursor=" + page.NextCursor
+	}
+
+	want := []string{"old-6", "old-5", "old-4", "old-3", "old-2", "old-1", "old-0"}
+	if !slices.Equal(seen, want) {
+		t.Errorf("listed %v, want %v", seen, want)
+	}
+
+	// Offset paging counts the matches, the new entries included
+	rec := s.do(admin, http.MethodGet, "/api/v1/admin/system/audit-logs?page=1&limit=3", nil)
+	var page pagination.Envelope[models.SettingsAuditLog]
+	decodeBody(t, rec, &page)
+	if page.Total == nil || *page.Total != 9 || len(page.Items) != 3 || page.Items[0].Action != "new-1" {
+		t.Errorf("first page by number = %+v, want 3 of 9 starting with the newest", page)
+	}
+
+	badID := pagination.Cursor{SortValue: time.Now(), ID: "not-an-object-id"}.Encode()
+	for _, cursor := range []string{"garbage", badID} {
+		if rec := s.do(admin, http.MethodGet, "/api/v1/admin/system/audit-logs?cursor="+cursor, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("cursor %q = %d, want 400", cursor, rec.Code)
+		}
+	}
+}
+
+// auditRecorder keeps the audit events written to the events outbox
+type auditRecorder struct {
+	mu     sync.Mutex
+	events []*events.AuditEvent
+}
+
+func (r *auditRecorder) RecordWithID(ctx context.Context, eventID, topic, key string, payload interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, payload.(*events.AuditEvent))
+	return nil
+}
+
+// TestSystemSettingsDryRunSavesNothing previews updates of the system
+// security and default settings and checks the changes are listed but not
+// saved or audited, and that invalid combinations are refused either way
+func TestSystemSettingsDryRunSavesNothing(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	settings := memory.NewSettingsStore(users)
+	recorder := &auditRecorder{}
+	publisher := events.NewAuditPublisher(nil)
+	publisher.SetRecorder(recorder)
+	h := NewSettingsHandler(settings, publisher)
+	s.handle(http.MethodPut, "/api/v1/admin/system/security", h.UpdateSystemSecuritySettings)
+	s.handle(http.MethodPut, "/api/v1/admin/system/defaults", h.UpdateSystemDefaultSettings)
+	admin := users.Add(&models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true})
+
+	var preview struct {
+		DryRun  bool                                  `json:"dryRun"`
+		Data    models.SystemSecuritySettings         `json:"data"`
+		Changes map[string]models.SettingsFieldChange `json:"changes"`
+	}
+	length, sso := 16, true
+	rec := s.do(admin, http.MethodPut, "/api/v1/admin/system/security?dry_run=true",
+		models.UpdateSystemSecuritySettingsRequest{MinPasswordLength: &length, SSOEnabled: &sso})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry run = %d %s", rec.Code, rec.Body)
+	}
+	decodeBody(t, rec, &preview)
+	want := map[string]models.SettingsFieldChange{
+		"minPasswordLength": {Old: float64(12), New: float64(16)},
+		"ssoEnabled":        {Old: false, New: true},
+	}
+	if !preview.DryRun || preview.Data.MinPasswordLength != 16 || !maps.Equal(preview.Changes, want) {
+		t.Errorf("preview = %+v, want the changes %v", preview, want)
+	}
+	if saved, _ := settings.GetSystemSecuritySettings(context.Background()); saved.MinPasswordLength != 12 || saved.SSOEnabled || saved.Version != 0 {
+		t.Errorf("settings after the dry run = %+v, want the defaults", saved)
+	}
+
+	start := "19:00"
+	rec = s.do(admin, http.MethodPut, "/api/v1/admin/system/defaults?dry_run=true", models.UpdateSystemDefaultSettingsRequest{WorkingHoursStart: start})
+	if got := errorDetail(t, rec, http.StatusBadRequest); got.Code != "VALIDATION_FAILED" || got.Fields["workingHoursEnd"] == "" {
+		t.Errorf("start after end = %+v, want workingHoursEnd refused", got)
+	}
+	if rec := s.do(admin, http.MethodPut, "/api/v1/admin/system/defaults", models.UpdateSystemDefaultSettingsRequest{WorkingHoursStart: start}); rec.Code != http.StatusBadRequest {
+		t.Errorf("saving start after end = %d %s, want 400", rec.Code, rec.Body)
+	}
+	rec = s.do(admin, http.MethodPut, "/api/v1/admin/system/defaults?dry_run=maybe", models.UpdateSystemDefaultSettingsRequest{})
+	if got := errorDetail(t, rec, http.StatusBadRequest); got.Code != "VALIDATION_ERROR" {
+		t.Errorf("dry_run=maybe = %+v, want VALIDATION_ERROR", got)
+	}
+	if saved, _ := settings.GetSystemDefaultSettings(context.Background()); saved.WorkingHoursStart != "09:00" {
+		t.Errorf("working hours start = %s, want the default kept", saved.WorkingHoursStart)
+	}
+
+	if len(recorder.events) != 0 {
+		t.Errorf("audit events = %+v, want none for previews and refusals", recorder.events)
+	}
+}
+
+// TestSystemSettingsUpdatesAuditTheChanges checks an update responds with
+// and audits exactly the fields it changed, old and new
+func TestSystemSettingsUpdatesAuditTheChanges(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	recorder := &auditRecorder{}
+	publisher := events.NewAuditPublisher(nil)
+	publisher.SetRecorder(recorder)
+	h := NewSettingsHandler(memory.NewSettingsStore(users), publisher)
+	s.handle(http.MethodPut, "/api/v1/admin/system/security", h.UpdateSystemSecuritySettings)
+	s.handle(http.MethodPut, "/api/v1/admin/system/defaults", h.UpdateSystemDefaultSettings)
+	admin := users.Add(&models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true})
+
+	// The timeout sent is the current one, so it is not a change
+	timeout, whitelist := 30, "10.0.0.0/8"
+	rec := s.do(admin, http.MethodPut, "/api/v1/admin/system/security",
+		models.UpdateSystemSecuritySettingsRequest{SessionTimeoutMinutes: &timeout, IPWhitelist: &whitelist})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update = %d %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Changes map[string]models.SettingsFieldChange `json:"changes"`
+	}
+	decodeBody(t, rec, &body)
+	if want := map[string]models.SettingsFieldChange{"ipWhitelist": {Old: "", New: whitelist}}; !maps.Equal(body.Changes, want) {
+		t.Errorf("response changes = %v, want %v", body.Changes, want)
+	}
+
+	if rec := s.do(admin, http.MethodPut, "/api/v1/admin/system/defaults",
+		models.UpdateSystemDefaultSettingsRequest{Currency: "USD", WorkingHoursEnd: "17:30"}); rec.Code != http.StatusOK {
+		t.Fatalf("update defaults = %d %s", rec.Code, rec.Body)
+	}
+
+	if len(recorder.events) != 2 {
+		t.Fatalf("%d audit events, want 2", len(recorder.events))
+	}
+	for i, want := range []struct {
+		details string
+		changes map[string]interface{}
+	}{
+		{
+			"System security settings updated: ipWhitelist",
+			map[string]interface{}{"ipWhitelist": map[string]interface{}{"old": "", "new": whitelist}},
+		},
+		{
+			"System default settings updated: currency, workingHoursEnd",
+			map[string]interface{}{
+				"currency":        map[string]interface{}{"old": "INR", "new": "USD"},
+				"workingHoursEnd": map[string]interface{}{"old": "18:00", "new": "17:30"},
+			},
+		},
+	} {
+		event := recorder.events[i]
+		if event.Action != events.ActionSettingsUpdated || event.UserID != admin.ID || event.Details != want.details {
+			t.Errorf("event %d = %s by %s: %q, want %q", i, event.Action, event.UserID, event.Details, want.details)
+		}
+		if !reflect.DeepEqual(event.Metadata, map[string]interface{}{"changes": want.changes}) {
+			t.Errorf("event %d metadata = %v, want the changes %v", i, event.Metadata, want.changes)
+		}
+	}
+}
+
+// TestGetSendWindow checks the send window is reported with whether it is
+// open by the enforcer's clock and when it next opens
+func TestGetSendWindow(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	h := NewSettingsHandler(memory.NewSettingsStore(users), nil)
+	window := services.NewSendWindowEnforcer(memory.NewSettingsStore(users))
+	h.SetSendWindow(window)
+	s.handle(http.MethodGet, "/api/v1/settings/send-window", h.GetSendWindow)
+	rep := users.Add(&models.User{Email: "rep@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	status := func(now time.Time) models.SendWindowStatus {
+		t.Helper()
+		window.SetClock(func() time.Time { return now })
+		rec := s.do(rep, http.MethodGet, "/api/v1/settings/send-window", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /settings/send-window = %d %s", rec.Code, rec.Body)
+		}
+		var body struct {
+			Data models.SendWindowStatus `json:"data"`
+		}
+		decodeBody(t, rec, &body)
+		return body.Data
+	}
+
+	// Friday evening in the default Asia/Kolkata window opens on Monday
+	closed := status(time.Date(2026, 3, 6, 18, 0, 0, 0, kolkata))
+	if closed.Open || closed.ClosesAt != nil || !closed.NextOpening.Equal(time.Date(2026, 3, 9, 9, 0, 0, 0, kolkata)) {
+		t.Errorf("friday evening = %+v, want closed until monday 09:00", closed)
+	}
+	if closed.Timezone != "Asia/Kolkata" || closed.WorkingHoursStart != "09:00" || closed.WorkingHoursEnd != "18:00" || !slices.Equal(closed.WorkingDays, models.DefaultWorkingDays) {
+		t.Errorf("window = %+v, want the default working hours", closed)
+	}
+	open := status(time.Date(2026, 3, 6, 17, 59, 0, 0, kolkata))
+	if !open.Open || open.ClosesAt == nil || !open.ClosesAt.Equal(time.Date(2026, 3, 6, 18, 0, 0, 0, kolkata)) {
+		t.Errorf("friday 17:59 = %+v, want open until 18:00", open)
+	}
+}
+
+// TestEmailSignatureIsSanitizedAndPreviewed checks a saved signature loses
+// its scripts and handlers, and the preview shows it appended to a sample
+// message whether or not it is enabled
+func TestEmailSignatureIsSanitizedAndPreviewed(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	h := NewSettingsHandler(memory.NewSettingsStore(users), nil)
+	s.handle(http.MethodGet, "/api/v1/settings/email-signature", h.GetEmailSignature)
+	s.handle(http.MethodPut, "/api/v1/settings/email-signature", h.UpdateEmailSignature)
+	s.handle(http.MethodGet, "/api/v1/settings/email-signature/preview", h.PreviewEmailSignature)
+	rep := users.Add(&models.User{Email: "rep@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+	other := users.Add(&models.User{Email: "other@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+
+	var saved struct {
+		Data models.SettingsEmailSignature `json:"data"`
+	}
+	rec := s.do(rep, http.MethodPut, "/api/v1/settings/email-signature", models.SettingsUpdateEmailSignatureRequest{
+		Signature: `<p onclick="steal()">Dana Smith</p><script>steal()</script><a href="javascript:steal()">Acme</a>`,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT /settings/email-signature = %d %s", rec.Code, rec.Body)
+	}
+	decodeBody(t, rec, &saved)
+	if want := `<p>Dana Smith</p><a>Acme</a>`; saved.Data.Signature != want || saved.Data.Enabled {
+		t.Errorf("saved signature = %+v, want %q disabled", saved.Data, want)
+	}
+	rec = s.do(rep, http.MethodGet, "/api/v1/settings/email-signature", nil)
+	decodeBody(t, rec, &saved)
+	if saved.Data.Signature != `<p>Dana Smith</p><a>Acme</a>` {
+		t.Errorf("stored signature = %q, want the sanitized one", saved.Data.Signature)
+	}
+
+	preview := func(user *models.User) (body struct {
+		Data struct {
+			Subject  string `json:"subject"`
+			BodyHTML string `json:"bodyHtml"`
+			BodyText string `json:"bodyText"`
+			Enabled  bool   `json:"enabled"`
+		} `json:"data"`
+	}) {
+		t.Helper()
+		rec := s.do(user, http.MethodGet, "/api/v1/settings/email-signature/preview", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /settings/email-signature/preview = %d %s", rec.Code, rec.Body)
+		}
+		decodeBody(t, rec, &body)
+		return body
+	}
+	disabled := preview(rep)
+	if disabled.Data.Enabled || strings.Count(disabled.Data.BodyHTML, "<p>Dana Smith</p><a>Acme</a>") != 1 ||
+		!strings.HasSuffix(disabled.Data.BodyText, "\n\n-- \nDana Smith\nAcme") || disabled.Data.Subject == "" {
+		t.Errorf("preview while disabled = %+v, want the signature appended", disabled.Data)
+	}
+
+	s.do(rep, http.MethodPut, "/api/v1/settings/email-signature", models.SettingsUpdateEmailSignatureRequest{Signature: "<p>Dana</p>", Enabled: true})
+	if enabled := preview(rep); !enabled.Data.Enabled || !strings.HasSuffix(enabled.Data.BodyHTML, `<div class="email-signature"><p>Dana</p></div>`) {
+		t.Errorf("preview while enabled = %+v", enabled.Data)
+	}
+
+	// Signatures are per user
+	if unsigned := preview(other); unsigned.Data.Enabled || strings.Contains(unsigned.Data.BodyHTML, "email-signature") {
+		t.Errorf("preview of a user without a signature = %+v", unsigned.Data)
+	}
+}
+
+// TestExportAuditLogs exports the audit logs as a workbook and as CSV,
+// reading the workbook back to check its rows and the summary counts
+func TestExportAuditLogs(t *testing.T) {
+	s := newTestServer(t)
+	users := memory.NewUserStore()
+	settings := memory.NewSettingsStore(users)
+	h := NewSettingsHandler(settings, nil)
+	h.SetUserStore(users)
+	s.handle(http.MethodGet, "/api/v1/admin/system/audit-logs/export", h.ExportAuditLogs)
+
+	manager := users.Add(&models.User{Name: "Maya", Email: "manager@example.com", Role: models.UserRoleManager, IsActive: true, Team: "north"})
+	teammate := users.Add(&models.User{Name: "Nils", Email: "north@example.com", Role: models.UserRoleSalesRep, IsActive: true, Team: "north"})
+	stranger := users.Add(&models.User{Name: "Sam", Email: "south@example.com", Role: models.UserRoleSalesRep, IsActive: true, Team: "south"})
+	entries := []struct {
+		user   *models.User
+		action string
+	}{
+		{manager, "login"}, {manager, "settings_updated"}, {teammate, "login"},
+		{teammate, "login"}, {stranger, "login"}, {stranger, "=cmd|' /C calc'!A0"},
+	}
+	for _, entry := range entries {
+		settings.AddAuditLog(models.SettingsAuditLog{UserID: entry.user.ID, UserName: entry.user.Name, Action: entry.action, Resource: "auth", IPAddress: "203.0.113.7"})
+	}
+	all := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Users: models.DataScopeAll})
+
+	rec := s.doContext(all, manager, http.MethodGet, "/api/v1/admin/system/audit-logs/export", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export = %d %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != xlsx.ContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got, want := rec.Header().Get("Content-Disposition"), `attachment; filename="audit-logs-`+time.Now().UTC().Format("2006-01-02")+`.xlsx"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	workbook, err := xlsxtest.Read(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := workbook.Sheet("Audit Logs")
+	if logs == nil || len(logs.Rows) != len(entries)+1 || !logs.FrozenHeader {
+		t.Fatalf("audit log sheet = %+v, want a frozen header and %d rows", logs, len(entries))
+	}
+	if header := logs.Rows[0]; header[0] != "Timestamp" || header[3] != "Action" || header[6] != "IP Address" {
+		t.Errorf("header = %q", header)
+	}
+	// Newest first
+	if last := logs.Rows[1]; last[1] != stranger.ID || last[3] != "=cmd|' /C calc'!A0" || last[6] != "203.0.113.7" {
+		t.Errorf("first row = %q, want the newest log", last)
+	}
+
+	summary := workbook.Sheet("Summary")
+	if summary == nil {
+		t.Fatal("no Summary sheet")
+	}
+	counts := map[string]string{}
+	for _, row := range summary.Rows[1:] {
+		counts[row[0]+"/"+row[1]] = row[2]
+	}
+	want := map[string]string{
+		"Total/": "6", "Action/login": "4", "Action/settings_updated": "1", "Action/=cmd|' /C calc'!A0": "1",
+		"User/Maya": "2", "User/Nils": "2", "User/Sam": "2",
+	}
+	if !maps.Equal(counts, want) {
+		t.Errorf("summary = %v, want %v", counts, want)
+	}
+
+	// The export follows the caller's data scope, and CSV has no summary
+	team := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Users: models.DataScopeTeam})
+	rec = s.doContext(team, manager, http.MethodGet, "/api/v1/admin/system/audit-logs/export?format=csv", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("CSV export = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("CSV rows = %d, want a header and the team's 4 logs", len(records))
+	}
+	for _, record := range records[1:] {
+		if record[1] == stranger.ID {
+			t.Errorf("CSV holds a log of another team: %q", record)
+		}
+	}
+
+	if rec := s.doContext(all, manager, http.MethodGet, "/api/v1/admin/system/audit-logs/export?format=pdf", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("pdf export = %d, want 400", rec.Code)
+	}
+
+	// Over the limit the export is refused before anything is written
+	h.SetExportMaxRows(5)
+	rec = s.doContext(all, manager, http.MethodGet, "/api/v1/admin/system/audit-logs/export", nil)
+	if detail := errorDetail(t, rec, http.StatusBadRequest); detail.Code != "EXPORT_TOO_LARGE" || !strings.Contains(detail.Message, "6 audit logs") {
+		t.Errorf("export over the limit = %+v", detail)
+	}
+	if rec := s.doContext(team, manager, http.MethodGet, "/api/v1/admin/system/audit-logs/export", nil); rec.Code != http.StatusOK {
+		t.Errorf("export of 4 logs under a limit of 5 = %d", rec.Code)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/emailtemplates"
+	"github.com/white/user-management/internal/i18n"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+)
+
+// SystemEmailHandler lets administrators check the overrides of system
+// emails (2FA codes, password resets, invitations) before publishing them
+type SystemEmailHandler struct {
+	overrides services.SystemEmailOverrides
+	branding  *services.EmailBranding // nil previews in the default branding
+}
+
+// NewSystemEmailHandler creates a new SystemEmailHandler
+func NewSystemEmailHandler(overrides services.SystemEmailOverrides) *SystemEmailHandler {
+	return &SystemEmailHandler{overrides: overrides}
+}
+
+// SetBranding makes previews use the organisation's email branding
+func (h *SystemEmailHandler) SetBranding(branding *services.EmailBranding) {
+	h.branding = branding
+}
+
+// SystemEmailSummary describes a system email and the merge tags its
+// overrides can use
+type SystemEmailSummary struct {
+	Key       string   `json:"key"`
+	MergeTags []string `json:"mergeTags"`
+}
+
+// SystemEmailPreviewRequest is the optional body of a system email preview
+type SystemEmailPreviewRequest struct {
+	Variables map[string]string `json:"variables"` // Replace the sample merge tag values
+}
+
+// SystemEmailOverridePreview is the rendering of a stored override
+type SystemEmailOverridePreview struct {
+	TemplateID string                          `json:"templateId"`
+	Status     string                          `json:"status"`
+	Preview    *models.TemplatePreviewResponse `json:"preview,omitempty"`
+	Error      string                          `json:"error,omitempty"` // Why the override would not be sent
+}
+
+// SystemEmailPreviewResponse compares a system email's override with its
+// embedded default
+type SystemEmailPreviewResponse struct {
+	Key      string                      `json:"key"`
+	Source   string                      `json:"source"`             // What is sent now: override or default
+	Override *SystemEmailOverridePreview `json:"override,omitempty"` // Most recently updated override, published or not
+	Default  *emailtemplates.Email       `json:"default"`
+}
+
+// ListSystemEmails lists the system emails that can be overridden
+// GET /api/v1/admin/system-emails
+// @Summary List system emails
+// @Description Lists the system emails that a published email template with is_system set and the email's key as system_key overrides, with the merge tags available to it
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} map[string][]SystemEmailSummary
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Security BearerAuth
+// @Router /admin/system-emails [get]
+func (h *SystemEmailHandler) ListSystemEmails(w http.ResponseWriter, r *http.Request) {
+	summaries := []SystemEmailSummary{}
+	for _, key := range emailtemplates.Keys() {
+		sample, _ := emailtemplates.Sample(key)
+		vars := emailtemplates.Variables(sample, emailtemplates.DefaultBranding)
+		tags := make([]string, 0, len(vars))
+		for tag := range vars {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		summaries = append(summaries, SystemEmailSummary{Key: key, MergeTags: tags})
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"systemEmails": summaries})
+}
+
+// PreviewSystemEmail renders a system email's latest override, published or
+// not, next to its embedded default, using sample values for the merge tags
+// and the current email branding. The default is rendered in the locale
+// asked for, or in the caller's language.
+// POST /api/v1/admin/system-emails/{key}/preview
+// @Summary Preview a system email override
+// @Description Renders the most recently updated override of a system email with sample merge tag values, reports why it would not be sent if it would not, and renders the embedded default it falls back to, in the locale asked for or else the caller's language. Overrides are sent whatever the recipient's language.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param key path string true "System email key, e.g. system.2fa_otp"
+// @Param locale query string false "Language of the default, e.g. es"
+// @Param request body SystemEmailPreviewRequest false "Merge tag values replacing the samples"
+// @Success 200 {object} SystemEmailPreviewResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid payload or unknown locale"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Unknown system email"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/system-emails/{key}/preview [post]
+func (h *SystemEmailHandler) PreviewSystemEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := mux.Vars(r)["key"]
+	sample, ok := emailtemplates.Sample(key)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown system email "+key)
+		return
+	}
+	translator := i18n.FromContext(ctx)
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		t, ok := i18n.For(locale)
+		if !ok {
+			respondWithErrorCode(w, http.StatusBadRequest, "UNKNOWN_LOCALE", "Unknown locale "+locale+": one of "+strings.Join(i18n.Locales(), ", "))
+			return
+		}
+		translator = t
+	}
+
+	var req SystemEmailPreviewRequest
+	if r.Body != nil && r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+	brand := h.branding.Get(ctx)
+	variables := emailtemplates.Variables(sample, brand)
+	for tag, value := range req.Variables {
+		variables[tag] = value
+	}
+
+	fallback, err := emailtemplates.Render(sample, brand, translator)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to render default: "+err.Error())
+		return
+	}
+	resp := SystemEmailPreviewResponse{Key: key, Source: "default", Default: fallback}
+
+	latest, err := h.overrides.GetSystemEmailOverride(ctx, key, false)
+	if err != nil && !repositories.IsNotFound(err) {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load override: "+err.Error())
+		return
+	}
+	if latest != nil {
+		_, preview, renderErr := services.RenderSystemEmailOverride(latest, variables)
+		resp.Override = &SystemEmailOverridePreview{TemplateID: latest.ID, Status: latest.Status, Preview: preview}
+		switch {
+		case renderErr != nil:
+			resp.Override.Error = renderErr.Error()
+		case !latest.IsPublished():
+			resp.Override.Error = "not published"
+		}
+	}
+
+	// The published override may be an older one than the latest
+	published, err := h.overrides.GetSystemEmailOverride(ctx, key, true)
+	if err != nil && !repositories.IsNotFound(err) {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load override: "+err.Error())
+		return
+	}
+	if published != nil {
+		if _, _, err := services.RenderSystemEmailOverride(published, emailtemplates.Variables(sample, brand)); err == nil {
+			resp.Source = "override"
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -1,50 +1,120 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/emailtemplates"
 	"github.com/white/user-management/internal/events"
 	"github.com/white/user-management/internal/middleware"
 	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
 	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/email"
 	"github.com/white/user-management/pkg/kafka"
 	"github.com/white/user-management/pkg/mongodb"
-	"github.com/white/user-management/pkg/smtp"
 	"github.com/white/user-management/pkg/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // TeamHandler handles team member management endpoints
 type TeamHandler struct {
 	client         *mongodb.Client
-	smtpClient     *smtp.SMTPClient
+	users          repositories.UserStore // Invitations and signups
+	emailSender    email.EmailSender
 	kafkaProducer  *kafka.Producer
-	emailRepo      *repositories.MongoEmailRepository
+	eventOutbox    events.EventRecorder
+	emailRepo      repositories.EmailStore
 	permissionRepo *repositories.PermissionRepository
 	auditPublisher *events.AuditPublisher
+	referenceData  *repositories.ReferenceDataRepository // Regions and teams that region and team values must name
+	appBaseURL     string                                // Frontend base URL used to build invitation links
+	emailQueue     *services.EmailQueue                  // nil sends emails directly
+	requireVersion bool                                  // Member updates must carry the version last read
+	passwords      *password.Hasher
+	systemEmails   *services.SystemEmails
+	rbacService    *services.RBACService // nil leaves cached roles and team member lists to expire
+	hierarchy      *services.UserHierarchy
+	exportMaxRows  int // Most members one export may hold
 }
 
+// inviteValidity is how long an invitation link can be used
+const inviteValidity = 7 * 24 * time.Hour
+
 // NewTeamHandler creates a new TeamHandler
-func NewTeamHandler(client *mongodb.Client, smtpClient *smtp.SMTPClient, kafkaProducer *kafka.Producer, auditPublisher *events.AuditPublisher) *TeamHandler {
+func NewTeamHandler(client *mongodb.Client, emailSender email.EmailSender, kafkaProducer *kafka.Producer, auditPublisher *events.AuditPublisher, appBaseURL string) *TeamHandler {
 	return &TeamHandler{
 		client:         client,
-		smtpClient:     smtpClient,
+		users:          repositories.NewMongoUserRepository(client),
+		emailSender:    emailSender,
 		kafkaProducer:  kafkaProducer,
+		eventOutbox:    repositories.NewEventOutboxRepository(client),
 		emailRepo:      repositories.NewMongoEmailRepository(client),
 		permissionRepo: repositories.NewPermissionRepository(client),
+		referenceData:  repositories.NewReferenceDataRepository(client),
 		auditPublisher: auditPublisher,
+		appBaseURL:     appBaseURL,
+		passwords:      password.Default(),
+		systemEmails:   services.NewSystemEmails(repositories.NewMongoTemplateRepository(client), emailSender.FromAddress(), ""),
+		exportMaxRows:  defaultExportMaxRows,
+		hierarchy:      services.NewUserHierarchy(repositories.NewMongoUserRepository(client)),
+	}
+}
+
+// SetRequireVersion makes member updates without the version last read
+// fail with 428 instead of overwriting whatever is stored
+func (h *TeamHandler) SetRequireVersion(required bool) {
+	h.requireVersion = required
+}
+
+// SetPasswordHasher sets the hasher signup passwords are hashed with; nil
+// keeps password.DefaultCost
+func (h *TeamHandler) SetPasswordHasher(hasher *password.Hasher) {
+	if hasher != nil {
+		h.passwords = hasher
+	}
+}
+
+// SetSystemEmails sets how invitation emails are rendered and addressed;
+// nil keeps the one sending from the email provider's address
+func (h *TeamHandler) SetSystemEmails(systemEmails *services.SystemEmails) {
+	if systemEmails != nil {
+		h.systemEmails = systemEmails
+	}
+}
+
+// SetEmailQueue queues invitation emails for the email worker instead of
+// sending them during the request
+func (h *TeamHandler) SetEmailQueue(queue *services.EmailQueue) {
+	h.emailQueue = queue
+}
+
+// SetRBACService sets the service whose cached user scopes and team member
+// lists are invalidated when a member's role or team changes
+func (h *TeamHandler) SetRBACService(rbacService *services.RBACService) {
+	h.rbacService = rbacService
+}
+
+// SetExportMaxRows sets how many members an export may hold before it is
+// refused
+func (h *TeamHandler) SetExportMaxRows(limit int) {
+	if limit > 0 {
+		h.exportMaxRows = limit
 	}
 }
 
@@ -63,22 +133,123 @@ type TeamMember struct {
 	Avatar      string     `json:"avatar,omitempty"`
 	Phone       string     `json:"phone,omitempty"`
 	JobTitle    string     `json:"jobTitle,omitempty"`
+	ManagerID   string     `json:"managerId,omitempty"`
 	InviteToken string     `json:"inviteToken,omitempty"`
 	CreatedAt   time.Time  `json:"createdAt"`
 	UpdatedAt   time.Time  `json:"updatedAt"`
 	LastLogin   *time.Time `json:"lastLogin,omitempty"`
+	LastSeenAt  *time.Time `json:"lastSeenAt,omitempty"`
+	Presence    string     `json:"presence"` // online, away or offline, from lastSeenAt
+	Version     int        `json:"version"`  // Send back in If-Match when updating
 }
 
 // TeamMembersResponse represents the response for list team members
 type TeamMembersResponse struct {
-	Success bool         `json:"success"`
-	Data    []TeamMember `json:"data"`
+	Success bool            `json:"success"`
+	Data    TeamMembersPage `json:"data"`
+}
+
+// TeamMembersPage is a page of team members
+type TeamMembersPage struct {
+	Members []TeamMember `json:"members"`
 	Total   int64        `json:"total"`
 	Limit   int          `json:"limit"`
 	Offset  int          `json:"offset"`
 }
 
-// ListTeamMembers lists all team members with pagination
+// TeamMemberResponse represents the response for a single team member
+type TeamMemberResponse struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message,omitempty"`
+	Data    TeamMember `json:"data"`
+}
+
+// InviteTeamMemberRequest is the body of a team member invitation
+type InviteTeamMemberRequest struct {
+	Email     string `json:"email" validate:"required,email,max=254"`
+	FirstName string `json:"firstName" validate:"max=100"`
+	LastName  string `json:"lastName" validate:"max=100"`
+	Name      string `json:"name" validate:"max=200"` // Fallback for backward compatibility
+	Role      string `json:"role" validate:"omitempty,oneof=admin manager hunting farming genops sales_rep"`
+	Region    string `json:"region" validate:"max=64"`
+	Team      string `json:"team" validate:"max=64"`
+	JobTitle  string `json:"jobTitle" validate:"max=100"`
+	ManagerID string `json:"managerId" validate:"omitempty,uuid"` // An active user the member reports to
+}
+
+// UpdateTeamMemberRequest documents the fields a team member update
+// accepts; fields left out are not changed
+type UpdateTeamMemberRequest struct {
+	FirstName *string `json:"firstName,omitempty" validate:"omitempty,max=100"`
+	LastName  *string `json:"lastName,omitempty" validate:"omitempty,max=100"`
+	Name      *string `json:"name,omitempty" validate:"omitempty,max=200"`
+	Role      *string `json:"role,omitempty" validate:"omitempty,oneof=admin manager hunting farming genops sales_rep"`
+	Region    *string `json:"region,omitempty" validate:"omitempty,max=64"`
+	Team      *string `json:"team,omitempty" validate:"omitempty,max=64"`
+	Phone     *string `json:"phone,omitempty" validate:"omitempty,e164"`
+	JobTitle  *string `json:"jobTitle,omitempty" validate:"omitempty,max=100"`
+	ManagerID *string `json:"managerId,omitempty" validate:"omitempty,uuid"` // An active user the member reports to; empty removes the manager
+	Avatar    *string `json:"avatar,omitempty" validate:"omitempty,max=2048"`
+	Version   *int    `json:"version,omitempty" validate:"omitempty,min=0"` // Version last read, unless sent in If-Match
+}
+
+// InviteTeamMemberResponse is the response to a team member invitation
+type InviteTeamMemberResponse struct {
+	Success   bool          `json:"success"`
+	Message   string        `json:"message"`
+	EmailSent bool          `json:"emailSent"` // Whether the invitation email went out
+	Data      InvitedMember `json:"data"`
+}
+
+// InvitedMember is the user an invitation created
+type InvitedMember struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Name      string `json:"name"`
+}
+
+// InvitationDetails is who an invitation token was issued to
+type InvitationDetails struct {
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Role      string `json:"role"`
+	Region    string `json:"region"`
+}
+
+// SignedUpUser is the user who completed their signup
+type SignedUpUser struct {
+	Email string `json:"email"`
+}
+
+// CompleteSignupRequest is the body of an invitation acceptance
+type CompleteSignupRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,max=256"`
+	Phone    string `json:"phone" validate:"omitempty,e164"`
+}
+
+// ListTeamMembers godoc
+// @Summary List team members
+// @Description Lists the team members within the caller's data scope, newest first
+// @Tags Team
+// @Produce json
+// @Param role query string false "Role"
+// @Param region query string false "Region"
+// @Param team query string false "Team"
+// @Param status query string false "invited, active or inactive"
+// @Param search query string false "Name or email contains"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Param offset query int false "Members to skip"
+// @Success 200 {object} TeamMembersResponse
+// @Failure 400 {object} ErrorResponse "Invalid filter"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Insufficient permissions"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/team/members [get]
 func (h *TeamHandler) ListTeamMembers(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -104,11 +275,28 @@ func (h *TeamHandler) ListTeamMembers(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	filter, denyAll, err := h.teamMemberFilter(r)
+	if err != nil {
+		if errors.Is(err, errInvalidMemberFilter) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve data scope: "+err.Error())
+		return
+	}
+	if denyAll {
+		respondWithJSON(w, http.StatusOK, TeamMembersResponse{
+			Success: true,
+			Data:    TeamMembersPage{Members: []TeamMember{}, Limit: limit, Offset: offset},
+		})
+		return
+	}
+
 	// Get users from database
 	collection := h.client.Collection("users")
 
 	// Count total
-	total, err := collection.CountDocuments(ctx, bson.M{})
+	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to count team members")
 		return
@@ -120,7 +308,7 @@ func (h *TeamHandler) ListTeamMembers(w http.ResponseWriter, r *http.Request) {
 		SetSkip(int64(offset)).
 		SetSort(bson.D{{Key: "created_at", Value: -1}})
 
-	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	cursor, err := collection.Find(ctx, filter, opts)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to fetch team members")
 		return
@@ -134,74 +322,211 @@ func (h *TeamHandler) ListTeamMembers(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		firstName := getStringField(user, "first_name")
-		lastName := getStringField(user, "last_name")
-		name := getStringField(user, "name")
-		// If name is empty, construct from firstName and lastName
-		if name == "" && (firstName != "" || lastName != "") {
-			name = firstName + " " + lastName
+		members = append(members, teamMemberFromDocument(user))
+	}
+
+	if members == nil {
+		members = []TeamMember{}
+	}
+
+	respondWithJSON(w, http.StatusOK, TeamMembersResponse{
+		Success: true,
+		Data:    TeamMembersPage{Members: members, Total: total, Limit: limit, Offset: offset},
+	})
+}
+
+// validManager checks that managerID can manage the member userID, writing
+// 400 INVALID_MANAGER when it cannot
+func (h *TeamHandler) validManager(w http.ResponseWriter, r *http.Request, userID, managerID string) bool {
+	err := h.hierarchy.ValidateManager(r.Context(), userID, managerID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrManagerNotFound), errors.Is(err, services.ErrManagerInactive),
+		errors.Is(err, services.ErrManagerIsSelf), errors.Is(err, services.ErrManagerCycle):
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_MANAGER", "Invalid managerId: "+err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Failed to check manager: "+err.Error())
+	}
+	return false
+}
+
+// errInvalidMemberFilter marks a team member filter parameter that cannot
+// be used
+var errInvalidMemberFilter = errors.New("invalid filter")
+
+// teamMemberFilter combines the caller's data scope with the role, region,
+// team, status and search parameters of the team member listing. denyAll
+// reports a scope that matches no member.
+func (h *TeamHandler) teamMemberFilter(r *http.Request) (filter bson.M, denyAll bool, err error) {
+	dataScope, claims, err := requestScope(r, repositories.NewMongoUserRepository(h.client))
+	if err != nil {
+		return nil, false, err
+	}
+	scope, denyAll := services.BuildScopeFilter("team_members", dataScope, claims)
+	if denyAll {
+		return nil, true, nil
+	}
+
+	query := r.URL.Query()
+	conditions := []bson.M{scope}
+	for _, field := range []string{"role", "region", "team"} {
+		if value := strings.TrimSpace(query.Get(field)); value != "" {
+			conditions = append(conditions, bson.M{field: value})
 		}
+	}
+	switch status := query.Get("status"); status {
+	case "":
+	case "active":
+		// Members created before statuses were recorded have none
+		conditions = append(conditions, bson.M{"status": bson.M{"$in": bson.A{"active", "", nil}}})
+	case "invited", "inactive":
+		conditions = append(conditions, bson.M{"status": status})
+	default:
+		return nil, false, fmt.Errorf("%w: status must be invited, active or inactive", errInvalidMemberFilter)
+	}
+	if search := strings.TrimSpace(query.Get("search")); search != "" {
+		pattern := regexp.QuoteMeta(search)
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"name": bson.M{"$regex": pattern, "$options": "i"}},
+			bson.M{"email": bson.M{"$regex": pattern, "$options": "i"}},
+		}})
+	}
+	if len(conditions) == 1 {
+		return scope, false, nil
+	}
+	return bson.M{"$and": conditions}, false, nil
+}
 
-		member := TeamMember{
-			ID:          getIDField(user, "_id"),
-			FirstName:   firstName,
-			LastName:    lastName,
-			Name:        name,
-			Email:       getStringField(user, "email"),
-			Role:        getStringField(user, "role"),
-			Region:      getStringField(user, "region"),
-			Team:        getStringField(user, "team"),
-			Status:      getStringFieldWithDefault(user, "status", "active"),
-			Permissions: getStringArrayField(user, "permissions"),
-			Avatar:      getStringField(user, "avatar"),
-			Phone:       getStringField(user, "phone"),
-			JobTitle:    getStringField(user, "job_title"),
-			InviteToken: getStringField(user, "invite_token"),
+// ExportTeamMembers godoc
+// @Summary Export team members
+// @Description Downloads the team members within the caller's data scope matching the listing filters, newest first, as a spreadsheet with a frozen header row and a Summary sheet counting them by role and region, or as CSV without the summary. Exports over the configured row limit are refused.
+// @Tags Team
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce text/csv
+// @Param format query string false "xlsx (default) or csv"
+// @Param role query string false "Role"
+// @Param region query string false "Region"
+// @Param team query string false "Team"
+// @Param status query string false "invited, active or inactive"
+// @Param search query string false "Name or email contains"
+// @Success 200 {file} file "team-members-<date>.xlsx or .csv"
+// @Failure 400 {object} CodedErrorResponse "Invalid format or filter, or EXPORT_TOO_LARGE"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/team/members/export [get]
+func (h *TeamHandler) ExportTeamMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format, ok := exportFormat(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid format, must be xlsx or csv")
+		return
+	}
+	filter, denyAll, err := h.teamMemberFilter(r)
+	if err != nil {
+		if errors.Is(err, errInvalidMemberFilter) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
 		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve data scope: "+err.Error())
+		return
+	}
+	if denyAll {
+		filter = bson.M{"_id": bson.M{"$in": bson.A{}}}
+	}
 
-		if createdAt, ok := user["created_at"].(primitive.DateTime); ok {
-			member.CreatedAt = createdAt.Time()
+	collection := h.client.Collection("users")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count team members")
+		return
+	}
+	if total > int64(h.exportMaxRows) {
+		respondExportTooLarge(w, "team members", total, h.exportMaxRows)
+		return
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch team members")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// Once the first row is out the status can no longer change, so a
+	// failure part way through is only logged
+	requestedBy := middleware.GetUserID(r)
+	export, err := startExport(w, "team-members", format, "Team Members",
+		[]float64{38, 28, 34, 12, 14, 18, 10, 24, 18, 22, 22},
+		[]string{"ID", "Name", "Email", "Role", "Region", "Team", "Status", "Job Title", "Phone", "Created At", "Last Login"})
+	if err != nil {
+		log.Printf("Team member export failed (requested by %s): %v", requestedBy, err)
+		return
+	}
+	byRole, byRegion := newExportTally("Role"), newExportTally("Region")
+	rows := 0
+	for cursor.Next(ctx) {
+		var user bson.M
+		if err = cursor.Decode(&user); err != nil {
+			break
 		}
-		if updatedAt, ok := user["updated_at"].(primitive.DateTime); ok {
-			member.UpdatedAt = updatedAt.Time()
+		member := teamMemberFromDocument(user)
+		var lastLogin time.Time
+		if member.LastLogin != nil {
+			lastLogin = *member.LastLogin
 		}
-		if lastLogin, ok := user["last_login"].(primitive.DateTime); ok {
-			t := lastLogin.Time()
-			member.LastLogin = &t
+		if err = export.row(member.ID, member.Name, member.Email, member.Role, member.Region, member.Team,
+			member.Status, member.JobTitle, member.Phone, member.CreatedAt, lastLogin); err != nil {
+			break
 		}
-
-		members = append(members, member)
+		byRole.add(member.Role)
+		byRegion.add(member.Region)
+		rows++
 	}
-
-	if members == nil {
-		members = []TeamMember{}
+	if err == nil {
+		err = cursor.Err()
 	}
-
-	response := map[string]interface{}{
-		"success": true,
-		"data": map[string]interface{}{
-			"members": members,
-			"total":   total,
-			"limit":   limit,
-			"offset":  offset,
-		},
+	if err == nil {
+		err = export.summary(rows, byRole, byRegion)
 	}
-
-	respondWithJSON(w, http.StatusOK, response)
+	if closeErr := export.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Team member export failed after %d rows (requested by %s): %v", rows, requestedBy, err)
+		return
+	}
+	log.Printf("Team member %s export of %d rows by %s", format, rows, requestedBy)
 }
 
-// GetTeamMember gets a single team member by ID
+// GetTeamMember godoc
+// @Summary Get a team member
+// @Description Returns a team member, with its version in the ETag header
+// @Tags Team
+// @Produce json
+// @Param id path string true "Team member ID"
+// @Success 200 {object} TeamMemberResponse
+// @Failure 400 {object} ErrorResponse "Invalid team member ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Team member not found"
+// @Security BearerAuth
+// @Router /admin/team/members/{id} [get]
 func (h *TeamHandler) GetTeamMember(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	id, err := uuid.ValidateUUID(idStr)
+	id, err := uuid.ParseUUID(idStr)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid team member ID")
 		return
 	}
 
+	if !h.memberInScope(w, r, id) {
+		return
+	}
+
 	collection := h.client.Collection("users")
 	var user bson.M
 	err = collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
@@ -210,41 +535,9 @@ func (h *TeamHandler) GetTeamMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	firstName := getStringField(user, "first_name")
-	lastName := getStringField(user, "last_name")
-	name := getStringField(user, "name")
-	if name == "" && (firstName != "" || lastName != "") {
-		name = firstName + " " + lastName
-	}
-
-	member := TeamMember{
-		ID:          getIDField(user, "_id"),
-		FirstName:   firstName,
-		LastName:    lastName,
-		Name:        name,
-		Email:       getStringField(user, "email"),
-		Role:        getStringField(user, "role"),
-		Region:      getStringField(user, "region"),
-		Team:        getStringField(user, "team"),
-		Status:      getStringFieldWithDefault(user, "status", "active"),
-		Permissions: getStringArrayField(user, "permissions"),
-		Avatar:      getStringField(user, "avatar"),
-		Phone:       getStringField(user, "phone"),
-		JobTitle:    getStringField(user, "job_title"),
-		InviteToken: getStringField(user, "invite_token"),
-	}
-
-	if createdAt, ok := user["created_at"].(primitive.DateTime); ok {
-		member.CreatedAt = createdAt.Time()
-	}
-	if updatedAt, ok := user["updated_at"].(primitive.DateTime); ok {
-		member.UpdatedAt = updatedAt.Time()
-	}
-
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    member,
-	})
+	member := teamMemberFromDocument(user)
+	setVersionETag(w, member.Version)
+	respondWithJSON(w, http.StatusOK, TeamMemberResponse{Success: true, Data: member})
 }
 
 // generateInviteToken generates a secure random token for invitation
@@ -261,21 +554,24 @@ func hashToken(token string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// InviteTeamMember invites a new team member
+// InviteTeamMember godoc
+// @Summary Invite a team member
+// @Description Creates an invited user and emails them a signup link valid for 7 days. Region and team default to pan_india and sales and must be active reference entries.
+// @Tags Team
+// @Accept json
+// @Produce json
+// @Param inviteRequest body InviteTeamMemberRequest true "Invitation"
+// @Success 201 {object} InviteTeamMemberResponse "Invited; emailSent reports whether the email went out"
+// @Failure 400 {object} CodedErrorResponse "Invalid body, missing email or name, unknown region or team, or INVALID_MANAGER"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Insufficient permissions"
+// @Failure 409 {object} ErrorResponse "User with this email already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/team/members/invite [post]
 func (h *TeamHandler) InviteTeamMember(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Email     string `json:"email"`
-		FirstName string `json:"firstName"`
-		LastName  string `json:"lastName"`
-		Name      string `json:"name"` // Fallback for backward compatibility
-		Role      string `json:"role"`
-		Region    string `json:"region"`
-		Team      string `json:"team"`
-		JobTitle  string `json:"jobTitle"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	var req InviteTeamMemberRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
@@ -296,15 +592,28 @@ func (h *TeamHandler) InviteTeamMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	region, ok := resolveReferenceCode(w, r, h.referenceData, models.ReferenceKindRegions, getValueOrDefault(req.Region, "pan_india"))
+	if !ok {
+		return
+	}
+	team, ok := resolveReferenceCode(w, r, h.referenceData, models.ReferenceKindTeams, getValueOrDefault(req.Team, "sales"))
+	if !ok {
+		return
+	}
+	// A new member has no reports, so any active user can manage them
+	if !h.validManager(w, r, "", req.ManagerID) {
+		return
+	}
+
 	ctx := r.Context()
-	collection := h.client.Collection("users")
 
 	// Check if user already exists
-	var existing bson.M
-	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existing)
-	if err == nil {
+	if _, err := h.users.GetByEmail(ctx, req.Email); err == nil {
 		respondWithError(w, http.StatusConflict, "User with this email already exists")
 		return
+	} else if !repositories.IsNotFound(err) {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check existing users")
+		return
 	}
 
 	// Generate invite token
@@ -317,37 +626,35 @@ func (h *TeamHandler) InviteTeamMember(w http.ResponseWriter, r *http.Request) {
 	inviteTokenHash := hashToken(inviteToken)
 	// Create new user with invited status
 	now := time.Now()
-	userID := uuid.MustNewUUID()
+	inviteExpiry := now.Add(inviteValidity)
 	fullName := firstName + " " + lastName
-	newUser := bson.M{
-		"_id":               userID,
-		"email":             req.Email,
-		"first_name":        firstName,
-		"last_name":         lastName,
-		"name":              fullName,
-		"role":              getValueOrDefault(req.Role, "sales_rep"),
-		"region":            getValueOrDefault(req.Region, "pan_india"),
-		"team":              getValueOrDefault(req.Team, "sales"),
-		"job_title":         req.JobTitle,
-		"status":            "invited",
-		"permissions":       []string{},
-		"invite_token":      inviteTokenHash,
-		"invite_sent_at":    now,
-		"invite_expires_at": now.Add(7 * 24 * time.Hour), // 7 days expiry
-		"created_at":        now,
-		"updated_at":        now,
-	}
-
-	_, err = collection.InsertOne(ctx, newUser)
-	if err != nil {
+	newUser := &models.User{
+		TenantID:     middleware.GetTenantID(r), // Invited members join the inviter's tenant
+		Email:        req.Email,
+		FirstName:    firstName,
+		LastName:     lastName,
+		Name:         fullName,
+		Role:         models.UserRole(getValueOrDefault(req.Role, "sales_rep")),
+		Region:       region,
+		Team:         team,
+		JobTitle:     req.JobTitle,
+		ManagerID:    req.ManagerID,
+		Status:       "invited",
+		InviteToken:  inviteTokenHash,
+		InviteSentAt: &now,
+		InviteExpiry: &inviteExpiry,
+	}
+	if err := h.users.Create(ctx, newUser); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create team member")
 		return
 	}
+	userID := newUser.ID
+	h.invalidateScopes("", team)
 
 	// Send invitation email via Kafka queue (or direct SMTP as fallback)
 	emailSent := false
-	inviteURL := fmt.Sprintf("%s/signup?token=%s", getAppBaseURL(), inviteTokenHash)
-	emailErr := h.sendInvitationEmail(req.Email, firstName, inviteURL)
+	inviteURL := fmt.Sprintf("%s/signup?token=%s", h.appBaseURL, inviteTokenHash)
+	emailErr := h.sendInvitationEmail(ctx, req.Email, firstName, inviteURL)
 	if emailErr != nil {
 		// Log error but don't fail the request - user is already created
 		fmt.Printf("Warning: Failed to send invitation email to %s: %v\n", req.Email, emailErr)
@@ -355,148 +662,104 @@ func (h *TeamHandler) InviteTeamMember(w http.ResponseWriter, r *http.Request) {
 		emailSent = true
 	}
 
+	actorID := middleware.GetUserID(r)
+	recordEvent(ctx, h.eventOutbox, events.TeamMemberInvited{
+		Envelope: events.NewEnvelope(events.TypeTeamMemberInvited, actorID, ""),
+		UserID:   userID,
+		Email:    req.Email,
+		Role:     req.Role,
+	})
+
 	// Publish audit event via Kafka (fire-and-forget)
 	if h.auditPublisher != nil {
-		actorID := middleware.GetUserID(r)
 		actorName, _ := ctx.Value(middleware.NameKey).(string)
 		h.auditPublisher.PublishTeamEvent(r, actorID, actorName, events.ActionTeamMemberAdded,
 			userID, fmt.Sprintf("Team member invited: %s (%s) - role: %s", fullName, req.Email, req.Role))
 	}
-	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
-		"success":   true,
-		"message":   "Team member invited successfully",
-		"emailSent": emailSent,
-		"data": map[string]interface{}{
-			"id":        userID,
-			"email":     req.Email,
-			"firstName": firstName,
-			"lastName":  lastName,
-			"name":      fullName,
+	respondWithJSON(w, http.StatusCreated, InviteTeamMemberResponse{
+		Success:   true,
+		Message:   "Team member invited successfully",
+		EmailSent: emailSent,
+		Data: InvitedMember{
+			ID:        userID,
+			Email:     req.Email,
+			FirstName: firstName,
+			LastName:  lastName,
+			Name:      fullName,
 		},
 	})
 }
 
-// sendInvitationEmail sends an invitation email to the new team member using Kafka queue
-func (h *TeamHandler) sendInvitationEmail(toEmail, firstName, inviteURL string) error {
-	subject := "You're invited to join White Platform"
-
-	htmlBody := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Team Invitation</title>
-</head>
-<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-    <div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-        <h1 style="color: white; margin: 0;">Welcome to White Platform</h1>
-    </div>
-    <div style="background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px;">
-        <p>Hi %s,</p>
-        <p>You've been invited to join the White Platform team! White is an AI-powered B2B sales engagement platform that helps teams manage their sales pipeline efficiently.</p>
-        <p>Click the button below to complete your registration and get started:</p>
-        <div style="text-align: center; margin: 30px 0;">
-            <a href="%s" style="background: #667eea; color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">Complete Registration</a>
-        </div>
-        <p style="color: #666; font-size: 14px;">This invitation link will expire in 7 days.</p>
-        <p style="color: #666; font-size: 14px;">If the button doesn't work, copy and paste this link into your browser:</p>
-        <p style="color: #667eea; font-size: 12px; word-break: break-all;">%s</p>
-        <hr style="border: none; border-top: 1px solid #ddd; margin: 30px 0;">
-        <p style="color: #999; font-size: 12px;">This email was sent by White Platform. If you didn't expect this invitation, please ignore this email.</p>
-    </div>
-</body>
-</html>
-`, firstName, inviteURL, inviteURL)
-
-	textBody := fmt.Sprintf(`Hi %s,
-
-You've been invited to join the White Platform team!
-
-Click the link below to complete your registration:
-%s
-
-This invitation link will expire in 7 days.
-
-Best regards,
-White Platform Team
-`, firstName, inviteURL)
-
-	// Create email message with unique ID
-	messageID := uuid.MustNewUUID()
-	now := time.Now()
+// InviteImportedUsers records the invitation events of users created by a
+// user import and, when the import sends invites, emails their signup links.
+// A failed email is logged; the invite can be resent later.
+func (h *TeamHandler) InviteImportedUsers(ctx context.Context, users []services.ImportedUser, sendInvites bool) {
+	actorID, _ := ctx.Value(middleware.UserIDKey).(string)
+	teams := make([]string, 0, len(users))
+	for _, user := range users {
+		teams = append(teams, user.Team)
+	}
+	h.invalidateScopes("", teams...)
+	for _, user := range users {
+		recordEvent(ctx, h.eventOutbox, events.TeamMemberInvited{
+			Envelope: events.NewEnvelope(events.TypeTeamMemberInvited, actorID, ""),
+			UserID:   user.ID,
+			Email:    user.Email,
+			Role:     user.Role,
+		})
+		if !sendInvites {
+			continue
+		}
+		if err := h.sendInvitationEmail(ctx, user.Email, user.FirstName, user.InviteURL); err != nil {
+			fmt.Printf("Warning: Failed to send invitation email to imported user %s: %v\n", user.Email, err)
+		}
+	}
+}
 
-	msg := &models.CommMessage{
-		MessageID:   messageID,
-		Channel:     models.ChannelEmail,
-		Direction:   models.DirectionOutbound,
-		Status:      models.MessageStatusQueued,
-		FromAddress: "sivaganesz7482@gmail.com",
-		FromName:    "White Platform",
-		ToAddresses: []string{toEmail},
-		Subject:     subject,
-		BodyHTML:    htmlBody,
-		BodyText:    textBody,
-		Priority:    models.PriorityHigh, // Invitations are high priority
-		CreatedAt:   now,
-		UpdatedAt:   now,
+// sendInvitationEmail sends an invitation email to the new team member using Kafka queue
+func (h *TeamHandler) sendInvitationEmail(ctx context.Context, toEmail, firstName, inviteURL string) error {
+	msg, err := h.systemEmails.Compose(ctx, toEmail, emailtemplates.InvitationData{
+		FirstName: firstName,
+		InviteURL: inviteURL,
+		ValidDays: int(inviteValidity / (24 * time.Hour)),
+	})
+	if err != nil {
+		return err
 	}
+	msg.Priority = models.PriorityHigh // Invitations are high priority
 
 	// Store message in MongoDB
 	if h.emailRepo != nil {
-		if err := h.emailRepo.CreateMessageCompat(msg); err != nil {
+		if err := h.emailRepo.CreateCommMessage(ctx, msg); err != nil {
 			fmt.Printf("Warning: Failed to store invitation email in database: %v\n", err)
 			// Fall back to direct SMTP if available
-			return h.sendInvitationEmailDirect(toEmail, msg)
+			return h.sendInvitationEmailDirect(ctx, toEmail, msg)
 		}
-	}
 
-	// Queue via Kafka for go-worker to process // future use
-	// if h.kafkaProducer != nil {
-	// 	queueMessage := models.NewEmailQueueMessage(
-	// 		messageID.Hex(),
-	// 		"smtp", // Use SMTP for system emails
-	// 		"high",
-	// 	)
-	// 	if err := h.kafkaProducer.PublishJSON(kafka.TopicEmailQueue, queueMessage); err != nil {
-	// 		fmt.Printf("Warning: Failed to queue invitation email to Kafka topic %s: %v\n", kafka.TopicEmailQueue, err)
-	// 		// Fall back to direct SMTP if available
-	// 		return h.sendInvitationEmailDirect(toEmail, msg)
-	// 	}
-	// 	fmt.Printf("Invitation email queued successfully for: %s (message_id=%s)\n", toEmail, messageID.Hex())
-	// 	return nil
-	// }
+		// Queue via Kafka for the email worker to process
+		if err := h.emailQueue.Enqueue(ctx, msg); err == nil {
+			fmt.Printf("Invitation email queued successfully for: %s (message_id=%s)\n", toEmail, msg.MessageID)
+			return nil
+		} else if !errors.Is(err, services.ErrEmailQueueDisabled) {
+			fmt.Printf("Warning: Failed to queue invitation email to Kafka: %v\n", err)
+		}
+	}
 
-	// No Kafka available, fall back to direct SMTP
-	return h.sendInvitationEmailDirect(toEmail, msg)
+	// No queue available, send directly through the email provider
+	return h.sendInvitationEmailDirect(ctx, toEmail, msg)
 }
 
-// sendInvitationEmailDirect sends invitation email directly via SMTP (fallback when Kafka unavailable)
-func (h *TeamHandler) sendInvitationEmailDirect(toEmail string, msg *models.CommMessage) error {
-	if h.smtpClient == nil {
-		fmt.Printf("SMTP not configured. Invitation email would be sent to: %s\n", toEmail)
-		fmt.Printf("Subject: %s\n", msg.Subject)
-		return nil
-	}
-
-	err := h.smtpClient.SendEmail(msg)
-	if err != nil {
-		fmt.Printf("SMTP ERROR: Failed to send invitation email to %s: %v\n", toEmail, err)
+// sendInvitationEmailDirect sends invitation email directly through the email provider (fallback when Kafka unavailable)
+func (h *TeamHandler) sendInvitationEmailDirect(ctx context.Context, toEmail string, msg *models.CommMessage) error {
+	if err := deliverEmail(ctx, h.emailSender, h.emailRepo, msg); err != nil {
+		fmt.Printf("EMAIL ERROR: Failed to send invitation email to %s via %s: %v\n", toEmail, h.emailSender.Name(), err)
 		return err
 	}
 
-	fmt.Printf("Invitation email sent directly via SMTP to: %s\n", toEmail)
+	fmt.Printf("Invitation email sent to: %s (provider: %s)\n", toEmail, h.emailSender.Name())
 	return nil
 }
 
-// getAppBaseURL returns the frontend base URL from environment or default
-func getAppBaseURL() string {
-	baseURL := os.Getenv("APP_BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:5173" // Default development URL
-	}
-	return baseURL
-}
-
 // splitName splits a full name into first and last name
 func splitName(name string) []string {
 	parts := make([]string, 0, 2)
@@ -537,6 +800,53 @@ func joinStrings(parts []string) string {
 	return result
 }
 
+// teamMemberFromDocument builds the team member response of a user document
+func teamMemberFromDocument(user bson.M) TeamMember {
+	firstName := getStringField(user, "first_name")
+	lastName := getStringField(user, "last_name")
+	name := getStringField(user, "name")
+	// If name is empty, construct from firstName and lastName
+	if name == "" && (firstName != "" || lastName != "") {
+		name = firstName + " " + lastName
+	}
+
+	member := TeamMember{
+		ID:          getIDField(user, "_id"),
+		FirstName:   firstName,
+		LastName:    lastName,
+		Name:        name,
+		Email:       getStringField(user, "email"),
+		Role:        getStringField(user, "role"),
+		Region:      getStringField(user, "region"),
+		Team:        getStringField(user, "team"),
+		Status:      getStringFieldWithDefault(user, "status", "active"),
+		Permissions: getStringArrayField(user, "permissions"),
+		Avatar:      getStringField(user, "avatar"),
+		Phone:       getStringField(user, "phone"),
+		JobTitle:    getStringField(user, "job_title"),
+		ManagerID:   getStringField(user, "manager_id"),
+		InviteToken: getStringField(user, "invite_token"),
+		Version:     getIntField(user, "version"),
+	}
+
+	if createdAt, ok := user["created_at"].(primitive.DateTime); ok {
+		member.CreatedAt = createdAt.Time()
+	}
+	if updatedAt, ok := user["updated_at"].(primitive.DateTime); ok {
+		member.UpdatedAt = updatedAt.Time()
+	}
+	if lastLogin, ok := user["last_login"].(primitive.DateTime); ok {
+		t := lastLogin.Time()
+		member.LastLogin = &t
+	}
+	if lastSeen, ok := user["last_seen_at"].(primitive.DateTime); ok {
+		t := lastSeen.Time()
+		member.LastSeenAt = &t
+	}
+	member.Presence = models.PresenceAt(member.LastSeenAt, time.Now())
+	return member
+}
+
 // Helper functions
 func getStringField(m bson.M, key string) string {
 	if val, ok := m[key].(string); ok {
@@ -545,6 +855,19 @@ func getStringField(m bson.M, key string) string {
 	return ""
 }
 
+// getIntField reads a number stored as any BSON integer or double
+func getIntField(m bson.M, key string) int {
+	switch val := m[key].(type) {
+	case int32:
+		return int(val)
+	case int64:
+		return int(val)
+	case float64:
+		return int(val)
+	}
+	return 0
+}
+
 func getStringFieldWithDefault(m bson.M, key, defaultVal string) string {
 	if val, ok := m[key].(string); ok && val != "" {
 		return val
@@ -585,70 +908,146 @@ func getValueOrDefault(val, defaultVal string) string {
 	return defaultVal
 }
 
-// UpdateTeamMember updates a team member
+// UpdateTeamMember godoc
+// @Summary Update a team member
+// @Description Updates the fields sent. With the version last read in If-Match or the version field, the update only applies if the member was not changed since.
+// @Tags Team
+// @Accept json
+// @Produce json
+// @Param id path string true "Team member ID"
+// @Param If-Match header string false "Version last read"
+// @Param updateRequest body UpdateTeamMemberRequest true "Fields to update"
+// @Success 200 {object} TeamMemberResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid ID, body or version, unknown region or team, or INVALID_MANAGER"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} CodedErrorResponse "Roles cannot be changed while impersonating"
+// @Failure 409 {object} VersionConflictResponse "Team member changed since the version sent; includes the current member"
+// @Failure 428 {object} CodedErrorResponse "Version required"
+// @Failure 404 {object} ErrorResponse "Team member not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/team/members/{id} [put]
 func (h *TeamHandler) UpdateTeamMember(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	id, err := uuid.ValidateUUID(idStr)
+	id, err := uuid.ParseUUID(idStr)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid team member ID")
 		return
 	}
-	var req map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	var req UpdateTeamMemberRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	version, ok := expectedVersion(w, r, req.Version, h.requireVersion)
+	if !ok {
+		return
+	}
+	if req.Role != nil && middleware.IsImpersonated(r) {
+		respondWithErrorCode(w, http.StatusForbidden, "IMPERSONATION_FORBIDDEN", "Roles cannot be changed while impersonating a user")
+		return
+	}
+	if !h.memberInScope(w, r, id) {
 		return
 	}
 	collection := h.client.Collection("users")
 
-	// Build update document
+	// Build update document from the fields sent
 	update := bson.M{"updated_at": time.Now()}
+	for field, value := range map[string]*string{
+		"first_name": req.FirstName,
+		"last_name":  req.LastName,
+		"name":       req.Name,
+		"role":       req.Role,
+		"phone":      req.Phone,
+		"job_title":  req.JobTitle,
+		"avatar":     req.Avatar,
+	} {
+		if value != nil {
+			update[field] = *value
+		}
+	}
 
-	// Map frontend field names to database field names
-	fieldMapping := map[string]string{
-		"firstName": "first_name",
-		"lastName":  "last_name",
-		"name":      "name",
-		"role":      "role",
-		"region":    "region",
-		"team":      "team",
-		"phone":     "phone",
-		"jobTitle":  "job_title",
-		"avatar":    "avatar",
-	}
-	for key, value := range fieldMapping {
-		if val, ok := req[key]; ok {
-			update[value] = val
+	// Region and team must name active reference entries
+	for _, ref := range []struct {
+		field, kind string
+		value       *string
+	}{
+		{"region", models.ReferenceKindRegions, req.Region},
+		{"team", models.ReferenceKindTeams, req.Team},
+	} {
+		if ref.value == nil {
+			continue
+		}
+		code, ok := resolveReferenceCode(w, r, h.referenceData, ref.kind, *ref.value)
+		if !ok {
+			return
+		}
+		update[ref.field] = code
+	}
+
+	if req.ManagerID != nil {
+		if !h.validManager(w, r, id, *req.ManagerID) {
+			return
+		}
+		update["manager_id"] = *req.ManagerID
+	}
+
+	// The team the member leaves, whose cached member list goes stale
+	var previousTeam string
+	if req.Team != nil {
+		var existing bson.M
+		if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err == nil {
+			previousTeam = getStringField(existing, "team")
 		}
 	}
 
 	// If firstName or lastName is updated, also update the combined name field
-	firstName, hasFirst := req["firstName"].(string)
-	lastName, hasLast := req["lastName"].(string)
-	if hasFirst || hasLast {
+	if req.FirstName != nil || req.LastName != nil {
+		var firstName, lastName string
 		// Get current values if not provided
-		if !hasFirst || !hasLast {
+		if req.FirstName == nil || req.LastName == nil {
 			var existing bson.M
-			err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&existing)
-			if err == nil {
-				if !hasFirst {
-					firstName = getStringField(existing, "first_name")
-				}
-				if !hasLast {
-					lastName = getStringField(existing, "last_name")
-				}
+			if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err == nil {
+				firstName = getStringField(existing, "first_name")
+				lastName = getStringField(existing, "last_name")
 			}
 		}
+		if req.FirstName != nil {
+			firstName = *req.FirstName
+		}
+		if req.LastName != nil {
+			lastName = *req.LastName
+		}
 		update["name"] = firstName + " " + lastName
 	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
-	if err != nil || result.MatchedCount == 0 {
+	// Only update the version read when the client sent one
+	filter := bson.M{"_id": id}
+	if version != nil {
+		filter["version"] = repositories.VersionFilter(*version)
+	}
+	var updated bson.M
+	err = collection.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": update, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments && version != nil {
+		var current bson.M
+		if collection.FindOne(ctx, bson.M{"_id": id}).Decode(&current) == nil {
+			respondWithVersionConflict(w, teamMemberFromDocument(current))
+			return
+		}
+	}
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update team member")
 		return
 	}
+	if req.Role != nil || req.Team != nil {
+		h.invalidateScopes(id, previousTeam, getStringField(updated, "team"))
+	}
 	// Publish audit log event (fire-and-forget)
 	if h.auditPublisher != nil {
 		actorID := middleware.GetUserID(r)
@@ -662,23 +1061,42 @@ func (h *TeamHandler) UpdateTeamMember(w http.ResponseWriter, r *http.Request) {
 			fmt.Sprintf("Team member updated (ID: %s)", idStr),
 		)
 	}
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": "Team member updated successfully",
+	member := teamMemberFromDocument(updated)
+	setVersionETag(w, member.Version)
+	respondWithJSON(w, http.StatusOK, TeamMemberResponse{
+		Success: true,
+		Message: "Team member updated successfully",
+		Data:    member,
 	})
 }
 
-// DeactivateTeamMember deactivates a team member
+// DeactivateTeamMember godoc
+// @Summary Deactivate a team member
+// @Description Sets the member inactive; they can no longer sign in
+// @Tags Team
+// @Produce json
+// @Param id path string true "Team member ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse "Invalid team member ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Insufficient permissions"
+// @Failure 404 {object} ErrorResponse "Team member not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/team/members/{id}/deactivate [post]
 func (h *TeamHandler) DeactivateTeamMember(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	id, err := uuid.ValidateUUID(idStr)
+	id, err := uuid.ParseUUID(idStr)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid team member ID")
 		return
 	}
+	if !h.memberInScope(w, r, id) {
+		return
+	}
 
 	collection := h.client.Collection("users")
 	_, err = collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
@@ -691,6 +1109,7 @@ func (h *TeamHandler) DeactivateTeamMember(w http.ResponseWriter, r *http.Reques
 		respondWithError(w, http.StatusInternalServerError, "Failed to deactivate team member")
 		return
 	}
+	recordEvent(ctx, h.eventOutbox, events.NewTeamMemberStatusChanged(events.TypeTeamMemberDeactivated, middleware.GetUserID(r), id, "inactive"))
 
 	// Publish audit log event (fire-and-forget)
 	if h.auditPublisher != nil {
@@ -712,17 +1131,33 @@ func (h *TeamHandler) DeactivateTeamMember(w http.ResponseWriter, r *http.Reques
 	})
 }
 
-// ReactivateTeamMember reactivates a deactivated team member
+// ReactivateTeamMember godoc
+// @Summary Reactivate a team member
+// @Description Sets a deactivated member active again
+// @Tags Team
+// @Produce json
+// @Param id path string true "Team member ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse "Invalid team member ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Insufficient permissions"
+// @Failure 404 {object} ErrorResponse "Team member not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/team/members/{id}/reactivate [post]
 func (h *TeamHandler) ReactivateTeamMember(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	id, err := uuid.ValidateUUID(idStr)
+	id, err := uuid.ParseUUID(idStr)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid team member ID")
 		return
 	}
+	if !h.memberInScope(w, r, id) {
+		return
+	}
 
 	collection := h.client.Collection("users")
 	_, err = collection.UpdateOne(ctx,
@@ -736,6 +1171,7 @@ func (h *TeamHandler) ReactivateTeamMember(w http.ResponseWriter, r *http.Reques
 		respondWithError(w, http.StatusInternalServerError, "Failed to reactivate team member")
 		return
 	}
+	recordEvent(ctx, h.eventOutbox, events.NewTeamMemberStatusChanged(events.TypeTeamMemberActivated, middleware.GetUserID(r), id, "active"))
 
 	// Publish audit log event (fire-and-forget)
 	if h.auditPublisher != nil {
@@ -757,17 +1193,33 @@ func (h *TeamHandler) ReactivateTeamMember(w http.ResponseWriter, r *http.Reques
 	})
 }
 
-// DeleteTeamMember deletes a team member by ID
+// DeleteTeamMember godoc
+// @Summary Delete a team member
+// @Description Marks the member deleted
+// @Tags Team
+// @Produce json
+// @Param id path string true "Team member ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse "Invalid team member ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Insufficient permissions"
+// @Failure 404 {object} ErrorResponse "Team member not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/team/members/{id} [delete]
 func (h *TeamHandler) DeleteTeamMember(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	id, err := uuid.ValidateUUID(idStr)
+	id, err := uuid.ParseUUID(idStr)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid team member ID")
 		return
 	}
+	if !h.memberInScope(w, r, id) {
+		return
+	}
 
 	collection := h.client.Collection("users")
 	_, err = collection.UpdateOne(ctx,
@@ -783,6 +1235,7 @@ func (h *TeamHandler) DeleteTeamMember(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete team member")
 		return
 	}
+	recordEvent(ctx, h.eventOutbox, events.NewTeamMemberStatusChanged(events.TypeTeamMemberDeleted, middleware.GetUserID(r), id, "deleted"))
 
 	// Publish audit log event (fire-and-forget)
 	if h.auditPublisher != nil {
@@ -804,7 +1257,58 @@ func (h *TeamHandler) DeleteTeamMember(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// VerifyInviteToken verifies an invite token and returns user info
+// invalidateScopes drops the cached roles and data scope of userID, when
+// set, and the cached member lists of teams a member joined or left
+func (h *TeamHandler) invalidateScopes(userID string, teams ...string) {
+	if h.rbacService == nil {
+		return
+	}
+	if userID != "" {
+		h.rbacService.InvalidateUserDataScope(userID)
+	}
+	h.rbacService.InvalidateTeams(teams...)
+}
+
+// memberInScope reports whether team member id exists within the caller's
+// team_members data scope, writing the error response when it does not.
+// Members out of scope are not found rather than forbidden, so their
+// existence is not revealed.
+func (h *TeamHandler) memberInScope(w http.ResponseWriter, r *http.Request, id string) bool {
+	dataScope, claims, err := requestScope(r, repositories.NewMongoUserRepository(h.client))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve data scope: "+err.Error())
+		return false
+	}
+	filter, denyAll := services.BuildScopeFilter("team_members", dataScope, claims)
+	if denyAll {
+		respondWithHiddenNotFound(w, "Team member not found")
+		return false
+	}
+
+	count, err := h.client.Collection("users").CountDocuments(r.Context(),
+		bson.M{"$and": []bson.M{filter, {"_id": id}}}, options.Count().SetLimit(1))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch team member")
+		return false
+	}
+	if count == 0 {
+		respondWithHiddenNotFound(w, "Team member not found")
+		return false
+	}
+	return true
+}
+
+// VerifyInviteToken godoc
+// @Summary Verify an invitation
+// @Description Checks an invitation token and returns the invited user's email, name, role and region for the signup form
+// @Tags Team
+// @Produce json
+// @Param token query string true "Invitation token"
+// @Success 200 {object} DataResponse[InvitationDetails] "Invitation details"
+// @Failure 400 {object} ErrorResponse "Token is required"
+// @Failure 404 {object} ErrorResponse "Invalid or expired invitation token"
+// @Failure 410 {object} ErrorResponse "Invitation has expired"
+// @Router /auth/verify-invite [get]
 func (h *TeamHandler) VerifyInviteToken(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 	if token == "" {
@@ -812,127 +1316,83 @@ func (h *TeamHandler) VerifyInviteToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ctx := r.Context()
-	collection := h.client.Collection("users")
-
 	// Find user by invite token
-	var user bson.M
-	err := collection.FindOne(ctx, bson.M{
-		"invite_token": token,
-		"status":       "invited",
-	}).Decode(&user)
-	if err != nil {
+	user, err := h.users.GetByInviteToken(r.Context(), token)
+	if repositories.IsNotFound(err) {
 		respondWithError(w, http.StatusNotFound, "Invalid or expired invitation token")
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify invitation")
+		return
+	}
 
 	// Check if token has expired
-	if expiresAt, ok := user["invite_expires_at"].(primitive.DateTime); ok {
-		if time.Now().After(expiresAt.Time()) {
-			respondWithError(w, http.StatusGone, "Invitation has expired")
-			return
-		}
+	if user.InviteExpiry != nil && time.Now().After(*user.InviteExpiry) {
+		respondWithError(w, http.StatusGone, "Invitation has expired")
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data": map[string]interface{}{
-			"email":     getStringField(user, "email"),
-			"firstName": getStringField(user, "first_name"),
-			"lastName":  getStringField(user, "last_name"),
-			"role":      getStringField(user, "role"),
-			"region":    getStringField(user, "region"),
+	respondWithJSON(w, http.StatusOK, DataResponse[InvitationDetails]{
+		Success: true,
+		Data: InvitationDetails{
+			Email:     user.Email,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Role:      string(user.Role),
+			Region:    user.Region,
 		},
 	})
 }
 
-// CompleteSignup completes the signup process for an invited user
+// CompleteSignup godoc
+// @Summary Complete signup
+// @Description Accepts an invitation: sets the password and activates the user
+// @Tags Team
+// @Accept json
+// @Produce json
+// @Param signupRequest body CompleteSignupRequest true "Invitation token and password"
+// @Success 200 {object} DataResponse[SignedUpUser] "Signup completed"
+// @Failure 400 {object} CodedErrorResponse "Invalid body, missing fields or password too short"
+// @Failure 404 {object} ErrorResponse "Invalid or expired invitation token"
+// @Failure 410 {object} ErrorResponse "Invitation has expired"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/complete-signup [post]
 func (h *TeamHandler) CompleteSignup(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Token    string `json:"token"`
-		Password string `json:"password"`
-		Phone    string `json:"phone"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invaild request body")
-	}
-
-	if req.Token == "" || req.Password == "" {
-		respondWithError(w, http.StatusBadRequest, "Token and Password are required")
-		return
-	}
-
-	if len(req.Password) < 6 {
-		respondWithError(w, http.StatusBadRequest, "Password must be at least 6 characters long")
+	var req CompleteSignupRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 	ctx := r.Context()
-	collection := h.client.Collection("users")
-
-	var user bson.M
-	err := collection.FindOne(ctx, bson.M{
-		"invite_token": req.Token,
-		"status":       "invited",
-	}).Decode(&user)
-
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Invalid or expired invitation token")
-		return
-	}
-
-	// check if token has expired
-	if expiresAt, ok := user["invite_expires_at"].(primitive.DateTime); ok {
-		if time.Now().After(expiresAt.Time()) {
-			respondWithError(w, http.StatusGone, "Invitation has expired")
-			return
-		}
-	}
 
 	//hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.passwords.Hash(req.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to process password")
 		return
 	}
 
-	now := time.Now()
-	update := bson.M{
-		"$set": bson.M{
-			"password":     hashedPassword,
-			"status":       "active",
-			"is_active":    true, // Required for login authentication check
-			"updated_at":   now,
-			"activated_at": now,
-		},
-		"$unset": bson.M{
-			"invite_token":      "",
-			"invite_expires_at": "",
-		},
+	// The token is spent by the same update that activates the user, so two
+	// signups with it cannot both succeed
+	user, err := h.users.AcceptInvitation(ctx, req.Token, hashedPassword, req.Phone, time.Now())
+	if repositories.IsNotFound(err) {
+		respondWithError(w, http.StatusNotFound, "Invalid or expired invitation token")
+		return
 	}
-
-	if req.Phone != "" {
-		update["$set"].(bson.M)["phone"] = req.Phone
+	if errors.Is(err, repositories.ErrInvitationExpired) {
+		respondWithError(w, http.StatusGone, "Invitation has expired")
+		return
 	}
-
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": user["_id"]}, update)
-
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to complete signup")
 		return
 	}
+	recordEvent(ctx, h.eventOutbox, events.NewTeamMemberStatusChanged(events.TypeTeamMemberActivated, user.ID, user.ID, "active"))
 
-	if result.ModifiedCount == 0 {
-		respondWithError(w, http.StatusInternalServerError, "Failed to Update user")
-		return
-	}
-
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": "Signup completed successfully",
-		"data": map[string]interface{}{
-			"email": getStringField(user, "email"),
-		},
+	respondWithJSON(w, http.StatusOK, DataResponse[SignedUpUser]{
+		Success: true,
+		Message: "Signup completed successfully",
+		Data:    SignedUpUser{Email: user.Email},
 	})
 
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/email"
+)
+
+// newInviteFixture adds the invitation and signup routes of a TeamHandler
+// to an auth fixture, sharing its stores, so invited members can sign in
+func newInviteFixture(t *testing.T) *authFixture {
+	t.Helper()
+	f := newAuthFixture(t)
+	sender := email.NewLogSender("noreply@example.test")
+	team := &TeamHandler{
+		users:        f.users,
+		emailSender:  sender,
+		eventOutbox:  f.outbox,
+		emailRepo:    f.emails,
+		appBaseURL:   "https://app.example.test",
+		passwords:    f.passwords,
+		systemEmails: services.NewSystemEmails(nil, sender.FromAddress(), ""),
+		hierarchy:    services.NewUserHierarchy(f.users),
+	}
+	f.handle(http.MethodPost, "/api/v1/team/members/invite", team.InviteTeamMember)
+	f.handlePublic(http.MethodGet, "/api/v1/auth/verify-invite", team.VerifyInviteToken)
+	f.handlePublic(http.MethodPost, "/api/v1/auth/complete-signup", team.CompleteSignup)
+	return f
+}
+
+var inviteLinkPattern = regexp.MustCompile(`/signup\?token=([0-9a-f]+)`)
+
+// invite invites address as admin and returns the token of the emailed
+// signup link
+func (f *authFixture) invite(admin *models.User, address string) string {
+	f.t.Helper()
+	rec := f.do(admin, http.MethodPost, "/api/v1/team/members/invite", InviteTeamMemberRequest{
+		Email:     address,
+		FirstName: "Sam",
+		LastName:  "Okafor",
+		Role:      "sales_rep",
+	})
+	if rec.Code != http.StatusCreated {
+		f.t.Fatalf("invite = %d %s", rec.Code, rec.Body)
+	}
+	msg := f.sentEmail(address)
+	match := inviteLinkPattern.FindStringSubmatch(msg.Body + " " + msg.BodyHTML)
+	if match == nil {
+		f.t.Fatalf("no signup link in the invitation: %q", msg.Body)
+	}
+	return match[1]
+}
+
+// TestInvitedMemberSignsUpAndSignsIn follows an invitation from the email
+// to the first sign-in
+func TestInvitedMemberSignsUpAndSignsIn(t *testing.T) {
+	f := newInviteFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@example.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	token := f.invite(admin, "sam@example.test")
+
+	invited, err := f.users.GetByEmail(t.Context(), "sam@example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invited.Status != "invited" || invited.IsActive || invited.TenantID != "acme" {
+		t.Errorf("invited member = status %q active %v tenant %q, want an inactive invited member of acme", invited.Status, invited.IsActive, invited.TenantID)
+	}
+	if status, _ := f.login("sam@example.test", "new secret"); status != http.StatusUnauthorized {
+		t.Errorf("login before signup = %d, want 401", status)
+	}
+
+	rec := f.do(nil, http.MethodGet, "/api/v1/auth/verify-invite?token="+url.QueryEscape(token), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify invite = %d %s", rec.Code, rec.Body)
+	}
+	var verified struct {
+		Data map[string]string `json:"data"`
+	}
+	decodeBody(t, rec, &verified)
+	if verified.Data["email"] != "sam@example.test" || verified.Data["firstName"] != "Sam" || verified.Data["lastName"] != "Okafor" {
+		t.Errorf("verified invitation = %v", verified.Data)
+	}
+
+	rec = f.do(nil, http.MethodPost, "/api/v1/auth/complete-signup", CompleteSignupRequest{Token: token, Password: "new secret", Phone: "+14155550123"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("complete signup = %d %s", rec.Code, rec.Body)
+	}
+	status, body := f.login("sam@example.test", "new secret")
+	if status != http.StatusOK {
+		t.Fatalf("login after signup = %d", status)
+	}
+	tokensOf(t, body)
+
+	activated, err := f.users.GetByID(t.Context(), invited.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activated.Status != "active" || !activated.IsActive || activated.Phone != "+14155550123" || activated.InviteToken != "" {
+		t.Errorf("activated member = status %q active %v phone %q token %q", activated.Status, activated.IsActive, activated.Phone, activated.InviteToken)
+	}
+	want := []string{events.TypeTeamMemberInvited, events.TypeTeamMemberActivated, events.TypeUserLoggedIn}
+	if got := f.outbox.EventTypes(); !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	// The token is spent
+	rec = f.do(nil, http.MethodPost, "/api/v1/auth/complete-signup", CompleteSignupRequest{Token: token, Password: "other secret"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second signup with the token = %d, want 404", rec.Code)
+	}
+	if rec := f.do(nil, http.MethodGet, "/api/v1/auth/verify-invite?token="+url.QueryEscape(token), nil); rec.Code != http.StatusNotFound {
+		t.Errorf("verifying a spent token = %d, want 404", rec.Code)
+	}
+}
+
+func TestInviteRejectsExistingEmail(t *testing.T) {
+	f := newInviteFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@example.test", Role: models.UserRoleAdmin, IsActive: true})
+	f.addUser("sam@example.test", "secret")
+
+	rec := f.do(admin, http.MethodPost, "/api/v1/team/members/invite", InviteTeamMemberRequest{Email: "sam@example.test", Name: "Sam Okafor"})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("inviting an existing email = %d %s, want 409", rec.Code, rec.Body)
+	}
+}
+
+// TestInviteValidatesTheBody checks invitations with an invalid address,
+// role, manager or oversized field are refused with the offending fields,
+// and none of them creates a member
+func TestInviteValidatesTheBody(t *testing.T) {
+	f := newInviteFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@example.test", Role: models.UserRoleAdmin, IsActive: true})
+
+	for _, tt := range []struct {
+		name string
+		req  InviteTeamMemberRequest
+		want map[string]string
+	}{
+		{"no email", InviteTeamMemberRequest{Name: "Sam"}, map[string]string{"email": "is required"}},
+		{"not an email", InviteTeamMemberRequest{Email: "not-an-email"}, map[string]string{"email": "must be a valid email address"}},
+		{"unknown role", InviteTeamMemberRequest{Email: "sam@example.test", Role: "owner"}, map[string]string{"role": "must be one of: admin, manager, hunting, farming, genops, sales_rep"}},
+		{"manager not a UUID", InviteTeamMemberRequest{Email: "sam@example.test", ManagerID: "42"}, map[string]string{"managerId": "must be a UUID"}},
+		{"long names", InviteTeamMemberRequest{Email: "sam@example.test", FirstName: strings.Repeat("S", 101), JobTitle: strings.Repeat("j", 101)}, map[string]string{
+			"firstName": "must be at most 100 characters",
+			"jobTitle":  "must be at most 100 characters",
+		}},
+	} {
+		detail := errorDetail(t, f.do(admin, http.MethodPost, "/api/v1/team/members/invite", tt.req), http.StatusBadRequest)
+		if detail.Code != "VALIDATION_FAILED" || !maps.Equal(detail.Fields, tt.want) {
+			t.Errorf("%s: error = %+v, want fields %v", tt.name, detail, tt.want)
+		}
+	}
+	if _, err := f.users.GetByEmail(t.Context(), "sam@example.test"); err == nil {
+		t.Error("an invalid invitation created the member")
+	}
+}
+
+func TestExpiredInvitationIsGone(t *testing.T) {
+	f := newInviteFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@example.test", Role: models.UserRoleAdmin, IsActive: true})
+	token := f.invite(admin, "sam@example.test")
+
+	invited, err := f.users.GetByEmail(t.Context(), "sam@example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-time.Hour)
+	invited.InviteExpiry = &expired
+	f.users.Add(invited)
+
+	if rec := f.do(nil, http.MethodGet, "/api/v1/auth/verify-invite?token="+token, nil); rec.Code != http.StatusGone {
+		t.Errorf("verify an expired invitation = %d, want 410", rec.Code)
+	}
+	rec := f.do(nil, http.MethodPost, "/api/v1/auth/complete-signup", CompleteSignupRequest{Token: token, Password: "new secret"})
+	if rec.Code != http.StatusGone {
+		t.Errorf("signup with an expired invitation = %d, want 410", rec.Code)
+	}
+	if _, err := f.users.GetByInviteToken(t.Context(), token); err != nil {
+		t.Errorf("an expired invitation was spent: %v", err)
+	}
+	if rec := f.do(nil, http.MethodPost, "/api/v1/auth/complete-signup", CompleteSignupRequest{Token: "unknown", Password: "new secret"}); rec.Code != http.StatusNotFound {
+		t.Errorf("signup with an unknown token = %d, want 404", rec.Code)
+	}
+	if _, err := f.users.GetByInviteToken(t.Context(), "unknown"); !repositories.IsNotFound(err) {
+		t.Errorf("GetByInviteToken of an unknown token = %v, want not found", err)
+	}
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// =====================================================
+// Approval Workflow
+// =====================================================
+
+// SubmitTemplateForApproval godoc
+// @Summary Submit a template for approval
+// @Description Puts a draft template in the approvers' queue (GET /api/v1/templates?approvalFlag=pending) and notifies the users holding the templates:library:approve permission. The template must pass publish validation. Rejected templates may be resubmitted.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param request body models.TemplateApprovalRequest false "Note for the approvers"
+// @Success 200 {object} models.MongoTemplate
+// @Failure 400 {object} CodedErrorResponse "Invalid template ID, not a draft or validation error"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 409 {object} ErrorResponse "Template is already pending approval or approved"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/submit-for-approval [post]
+// @Security BearerAuth
+func (h *TemplateHandler) SubmitTemplateForApproval(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	template, req, userID, ok := h.loadApprovalRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := template.CanSubmitForApproval(); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, models.ErrApprovalNotDraft) {
+			status = http.StatusBadRequest
+		}
+		respondWithError(w, status, err.Error())
+		return
+	}
+	if err := template.ValidateForPublish(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Template validation failed: "+err.Error())
+		return
+	}
+
+	entry := models.TemplateApproval{Action: models.TemplateApprovalSubmitted, ActorID: userID, Comment: req.Comment, At: time.Now()}
+	if !h.setApprovalState(w, r, template, string(models.TemplateApprovalPending), entry) {
+		return
+	}
+
+	event := events.NewTemplateEvent(events.TypeTemplateApprovalRequested, userID, template.TenantID, template.ID)
+	event.ApprovalStatus = template.ApprovalStatus
+	event.Comment = req.Comment
+	recordEvent(ctx, h.eventOutbox, event)
+
+	h.logTemplateActivity(ctx, template, userID, "Template Submitted for Approval", "Template submitted for approval: "+template.Name)
+
+	h.notifyApprovers(ctx, template, userID, req.Comment)
+
+	respondWithJSON(w, http.StatusOK, template)
+}
+
+// ApproveTemplate godoc
+// @Summary Approve a template
+// @Description Approves a template pending approval. When approval is required (system security settings) only approved templates can be published.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param request body models.TemplateApprovalRequest false "Approver comment"
+// @Success 200 {object} models.MongoTemplate
+// @Failure 400 {object} CodedErrorResponse "Invalid template ID or body"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 409 {object} ErrorResponse "Template is not pending approval"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/approve [post]
+// @Security BearerAuth
+func (h *TemplateHandler) ApproveTemplate(w http.ResponseWriter, r *http.Request) {
+	h.reviewTemplate(w, r, models.TemplateApprovalApprove)
+}
+
+// RejectTemplate godoc
+// @Summary Reject a template
+// @Description Rejects a template pending approval. The comment telling the creator what to change is required. The creator may edit and resubmit the template.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param request body models.TemplateApprovalRequest true "Reason for the rejection"
+// @Success 200 {object} models.MongoTemplate
+// @Failure 400 {object} CodedErrorResponse "Invalid template ID or missing comment"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 409 {object} ErrorResponse "Template is not pending approval"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/reject [post]
+// @Security BearerAuth
+func (h *TemplateHandler) RejectTemplate(w http.ResponseWriter, r *http.Request) {
+	h.reviewTemplate(w, r, models.TemplateApprovalReject)
+}
+
+// reviewTemplate records an approver's decision on a pending template
+func (h *TemplateHandler) reviewTemplate(w http.ResponseWriter, r *http.Request, action models.TemplateApprovalAction) {
+	ctx := r.Context()
+	template, req, userID, ok := h.loadApprovalRequest(w, r)
+	if !ok {
+		return
+	}
+
+	toStatus, eventType, title := models.TemplateApprovalApproved, events.TypeTemplateApproved, "Template Approved"
+	if action == models.TemplateApprovalReject {
+		if req.Comment == "" {
+			respondWithError(w, http.StatusBadRequest, "A comment is required to reject a template")
+			return
+		}
+		toStatus, eventType, title = models.TemplateApprovalRejected, events.TypeTemplateRejected, "Template Rejected"
+	}
+
+	if err := template.CanReview(); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	entry := models.TemplateApproval{Action: action, ActorID: userID, Comment: req.Comment, At: time.Now()}
+	if !h.setApprovalState(w, r, template, string(toStatus), entry) {
+		return
+	}
+
+	event := events.NewTemplateEvent(eventType, userID, template.TenantID, template.ID)
+	event.ApprovalStatus = template.ApprovalStatus
+	event.Comment = req.Comment
+	recordEvent(ctx, h.eventOutbox, event)
+
+	h.logTemplateActivity(ctx, template, userID, title, title+": "+template.Name)
+
+	respondWithJSON(w, http.StatusOK, template)
+}
+
+// loadApprovalRequest reads the template, optional comment and caller of an
+// approval workflow request, writing the error response when it cannot go on
+func (h *TemplateHandler) loadApprovalRequest(w http.ResponseWriter, r *http.Request) (*models.MongoTemplate, models.TemplateApprovalRequest, string, bool) {
+	var req models.TemplateApprovalRequest
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return nil, req, "", false
+	}
+
+	// Body is optional except for the comment a rejection requires
+	if r.Body != nil && r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return nil, req, "", false
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, req, "", false
+	}
+
+	template, ok := h.loadTemplateInScope(w, r, templateID)
+	if !ok {
+		return nil, req, "", false
+	}
+	return template, req, userID, true
+}
+
+// setApprovalState moves template to toStatus in the review cycle, updating
+// the in-memory copy and the cache. It writes the error response and returns
+// false when the template changed under the caller.
+func (h *TemplateHandler) setApprovalState(w http.ResponseWriter, r *http.Request, template *models.MongoTemplate, toStatus string, entry models.TemplateApproval) bool {
+	ctx := r.Context()
+	if err := h.templateRepo.SetApprovalState(ctx, template.TenantID, template.ID, template.ApprovalStatus, toStatus, entry); err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrApprovalStateChanged):
+			respondWithError(w, http.StatusConflict, "Template approval status changed, reload and try again")
+		case repositories.IsTemplateNotFound(err):
+			respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to update template approval: "+err.Error())
+		}
+		return false
+	}
+
+	template.ApprovalStatus = toStatus
+	template.Approvals = append(template.Approvals, entry)
+	template.UpdatedAt = entry.At
+
+	if h.cache != nil {
+		h.cache.Delete(ctx, template.TenantID, template.ID)
+		h.cache.InvalidateLists(ctx, template.TenantID)
+	}
+	return true
+}
+
+// templateApprovalRequired reports whether templates must be approved before
+// they are published
+func (h *TemplateHandler) templateApprovalRequired(ctx context.Context) (bool, error) {
+	if h.settingsRepo == nil {
+		return false, nil
+	}
+	settings, err := h.settingsRepo.GetSystemSecuritySettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	return settings.TemplateApprovalRequired, nil
+}
+
+// resetApproval withdraws an edited template from review. The caller has
+// checked ApprovalResetOnEdit.
+func (h *TemplateHandler) resetApproval(ctx context.Context, template *models.MongoTemplate, userID string) error {
+	entry := models.TemplateApproval{Action: models.TemplateApprovalReset, ActorID: userID, At: time.Now()}
+	if err := h.templateRepo.SetApprovalState(ctx, template.TenantID, template.ID, template.ApprovalStatus, "", entry); err != nil {
+		return err
+	}
+	template.ApprovalStatus = ""
+	template.Approvals = append(template.Approvals, entry)
+
+	recordEvent(ctx, h.eventOutbox, events.NewTemplateEvent(events.TypeTemplateApprovalReset, userID, template.TenantID, template.ID))
+	h.logTemplateActivity(ctx, template, userID, "Template Approval Reset", "Template edited during review, approval reset: "+template.Name)
+	return nil
+}
+
+// notifyApprovers notifies everyone who can approve template, except the
+// user who submitted it. Failures are logged; the submission stands.
+func (h *TemplateHandler) notifyApprovers(ctx context.Context, template *models.MongoTemplate, submittedBy, comment string) {
+	if h.approvers == nil || h.notifier == nil {
+		return
+	}
+	approvers, err := h.approvers(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to look up template approvers for %s: %v", template.ID, err)
+		return
+	}
+
+	submitter := submittedBy
+	if user, err := h.userRepo.GetByID(ctx, submittedBy); err == nil && user.Name != "" {
+		submitter = user.Name
+	}
+
+	payload := models.NotificationPayload{
+		Title: fmt.Sprintf("Template awaiting approval: %s", template.Name),
+		Body:  fmt.Sprintf("%s submitted the %s template %q for approval.", submitter, template.Channel, template.Name),
+		HTML: fmt.Sprintf("<p>%s submitted the %s template <strong>%s</strong> for approval.</p>",
+			html.EscapeString(submitter), html.EscapeString(template.Channel), html.EscapeString(template.Name)),
+		Link: "/templates/" + template.ID,
+		Data: map[string]string{"templateId": template.ID, "submittedBy": submittedBy},
+	}
+	if comment != "" {
+		payload.Body += "\n\nComment: " + comment
+		payload.HTML += "<p>Comment: " + html.EscapeString(comment) + "</p>"
+	}
+
+	for _, approver := range approvers {
+		if approver.ID == submittedBy {
+			continue
+		}
+		if err := h.notifier.Notify(ctx, approver.ID, models.NotificationTemplateApprovalRequest, payload); err != nil {
+			log.Printf("Warning: failed to notify approver %s of template %s: %v", approver.ID, template.ID, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// ConvertTemplate godoc
+// @Summary Convert a template to another channel
+// @Description Creates a draft copy of a template on another channel, named "<source> (SMS)" and so on. The body becomes plain text: HTML is stripped, list items become "- " or numbered lines and links are followed by their URL. It is cut with an ellipsis to the channel limit (160 characters, one segment, for SMS; 1024 for WhatsApp; 8000 for a LinkedIn InMail). Merge tags, custom fields, tags and the filter fields are carried over; the subject, other content fields and attachments are dropped. WhatsApp drafts need a metaTemplateName before publishing. The warnings list every adaptation. The draft is validated like a created template.
+// @Tags Templates
+// @Produce json
+// @Param id path string true "Source Template ID (UUID)"
+// @Param target query string true "Channel to convert to (sms, whatsapp, linkedin)"
+// @Success 201 {object} models.TemplateConversionResult
+// @Failure 400 {object} ErrorResponse "Invalid template ID or target channel"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Source template not found"
+// @Failure 422 {object} ErrorResponse "The converted template is not valid, e.g. the source has no text"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/convert [post]
+// @Security BearerAuth
+func (h *TemplateHandler) ConvertTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sourceTemplateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+	target := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("target")))
+	if target == "" {
+		respondWithError(w, http.StatusBadRequest, "target is required: one of "+strings.Join(services.TemplateConversionTargets(), ", "))
+		return
+	}
+
+	createdBy, ok := ctx.Value("user_id").(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return
+	}
+
+	// Get source template (the caller must be able to read it)
+	sourceTemplate, ok := h.loadTemplateInScope(w, r, sourceTemplateID)
+	if !ok {
+		return
+	}
+
+	converted, warnings, err := services.ConvertTemplate(sourceTemplate, target)
+	switch {
+	case errors.Is(err, services.ErrConversionTarget):
+		respondWithError(w, http.StatusBadRequest, "Invalid target channel "+target+": one of "+strings.Join(services.TemplateConversionTargets(), ", "))
+		return
+	case errors.Is(err, services.ErrConversionSameChannel):
+		respondWithError(w, http.StatusBadRequest, "Template is already a "+target+" template")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Failed to convert template: "+err.Error())
+		return
+	}
+	if err := converted.Validate(); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, "Converted template is not valid: "+err.Error())
+		return
+	}
+
+	name, err := h.uniqueTemplateName(ctx, tenantID, converted.Name, "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to convert template: "+err.Error())
+		return
+	}
+	now := time.Now()
+	converted.ID = uuid.MustNewUUID()
+	converted.TenantID = tenantID
+	converted.Name = name
+	converted.CreatedBy = createdBy
+	converted.CreatedAt = now
+	converted.UpdatedAt = now
+
+	if err := h.templateRepo.Create(ctx, converted); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to convert template: "+err.Error())
+		return
+	}
+	if h.cache != nil {
+		h.cache.InvalidateLists(ctx, tenantID)
+	}
+
+	// Record the event in the outbox for the relay to publish
+	event := events.NewTemplateEvent(events.TypeTemplateCreated, createdBy, converted.TenantID, converted.ID)
+	event.SourceTemplateID = sourceTemplateID
+	event.Channel = converted.Channel
+	event.Status = converted.Status
+	recordEvent(ctx, h.eventOutbox, event)
+
+	h.logTemplateActivity(ctx, converted, createdBy, "Template Converted", "Template converted to "+target+" from: "+sourceTemplate.Name)
+
+	respondWithJSON(w, http.StatusCreated, models.TemplateConversionResult{
+		Template: converted,
+		Warnings: warnings,
+	})
+}
@@ -2,62 +2,133 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/mail"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/white/user-management/internal/cache"
+	"github.com/white/user-management/internal/events"
 	"github.com/white/user-management/internal/middleware"
 	"github.com/white/user-management/internal/models"
 	"github.com/white/user-management/internal/repositories"
 	"github.com/white/user-management/internal/services"
-	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/email"
 	"github.com/white/user-management/pkg/uuid"
 )
 
+// Test send limits
+const (
+	maxTestRecipients  = 5
+	testSendsPerWindow = 10
+	testSendWindow     = time.Hour
+	testSubjectPrefix  = "[TEST] "
+)
+
 // TemplateHandler handles template-related HTTP requests
 type TemplateHandler struct {
-	templateRepo  *repositories.TemplateRepository
-	activityRepo  *repositories.ActivityRepository
-	userRepo      *repositories.MongoUserRepository
-	kafkaProducer *kafka.Producer
+	templateRepo  repositories.TemplateStore
+	activityRepo  repositories.ActivityStore
+	userRepo      repositories.UserStore
+	eventOutbox   events.EventRecorder
+	emailRepo     repositories.EmailStore
+	settingsRepo  repositories.SettingsStore
+	emailSender   email.EmailSender
+	perms         *middleware.PermissionEnforcer
 	// geminiClient       *gemini.GeminiClient
-	// rateLimiter        *utils.RateLimiter
-	cache *cache.TemplateCache // Redis cache for templates
+	rateLimiter *utils.RateLimiter   // Test sends per user
+	cache       *cache.TemplateCache // Redis cache for templates
+	requireVersion bool // Updates must carry the version last read
+	notifier    *services.NotificationService // Approval requests; nil sends none
+	approvers   ApproverLookup                // Who to notify of templates waiting for review
+	linter      *services.TemplateLinter      // Content checks for lint and clean-lint publishes
 	// integrationHandler *IntegrationHandler       // For Exotel template submission
 }
 
 // NewTemplateHandler creates a new template handler
-func NewTemplateHandler(templateRepo *repositories.TemplateRepository, activityRepo *repositories.ActivityRepository, kafkaProducer *kafka.Producer, userRepo *repositories.MongoUserRepository, templateCache *cache.TemplateCache) *TemplateHandler {
+func NewTemplateHandler(templateRepo repositories.TemplateStore, activityRepo repositories.ActivityStore, eventOutbox events.EventRecorder, userRepo repositories.UserStore, templateCache *cache.TemplateCache, emailRepo repositories.EmailStore, settingsRepo repositories.SettingsStore, emailSender email.EmailSender, perms *middleware.PermissionEnforcer) *TemplateHandler {
 	return &TemplateHandler{
 		templateRepo:  templateRepo,
 		activityRepo:  activityRepo,
 		userRepo:      userRepo,
-		kafkaProducer: kafkaProducer,
+		eventOutbox:   eventOutbox,
+		emailRepo:     emailRepo,
+		settingsRepo:  settingsRepo,
+		emailSender:   emailSender,
+		perms:         perms,
 		// geminiClient:  geminiClient,
-		// rateLimiter:   utils.NewRateLimiter(10, 1*time.Hour), // 10 requests per hour
-		cache: templateCache,
+		rateLimiter: utils.NewRateLimiter(testSendsPerWindow, testSendWindow),
+		cache:       templateCache,
+		linter:      services.NewTemplateLinter(services.TemplateLinkTimeout),
 	}
 }
 
-// getTenantID gets tenant ID from context, falling back to user ID if not set
-// This allows the template system to work in single-tenant mode where tenant_id
-// is not explicitly set in the JWT token
-func (h *TemplateHandler) getTenantID(r *http.Request) (string, error) {
-	// First try to get tenant_id from context
-	if tenantIDStr, ok := r.Context().Value("tenant_id").(string); ok {
-		return tenantIDStr, nil
+// ApproverLookup returns the users who may approve templates
+type ApproverLookup func(ctx context.Context) ([]*models.User, error)
+
+// SetNotificationService notifies approvers of templates submitted for approval
+func (h *TemplateHandler) SetNotificationService(notifier *services.NotificationService) {
+	h.notifier = notifier
+}
+
+// SetRequireVersion makes template updates without the version last read
+// fail with 428 instead of overwriting whatever is stored
+func (h *TemplateHandler) SetRequireVersion(required bool) {
+	h.requireVersion = required
+}
+
+// SetLinter replaces the linter templates are checked with
+func (h *TemplateHandler) SetLinter(linter *services.TemplateLinter) {
+	if linter != nil {
+		h.linter = linter
 	}
-	// Fall back to user_id as tenant_id (single-tenant mode)
-	if userID, ok := r.Context().Value("user_id").(string); ok {
-		return userID, nil
+}
+
+// SetApproverLookup sets who is notified when a template is submitted for
+// approval. Without it nobody is notified.
+func (h *TemplateHandler) SetApproverLookup(lookup ApproverLookup) {
+	h.approvers = lookup
+}
+
+// errNoTenant is returned when a request carries no tenant
+var errNoTenant = errors.New("no tenant in request context")
+
+// getTenantID gets the tenant whose templates the request works on, the
+// tenant of the access token
+func (h *TemplateHandler) getTenantID(r *http.Request) (string, error) {
+	if tenantID := middleware.GetTenantID(r); tenantID != "" {
+		return tenantID, nil
 	}
-	// Generate a default tenant ID for testing/development
-	return uuid.MustNewUUID(), nil
+	return "", errNoTenant
+}
+
+// TemplateListResponse is a page of templates
+type TemplateListResponse struct {
+	Templates  []*models.MongoTemplate `json:"templates"`
+	Total      int64                   `json:"total"`
+	Page       int                     `json:"page"`
+	Limit      int                     `json:"limit"`
+	TotalPages int                     `json:"totalPages"`
+}
+
+// TemplateTagsResponse is the tags of a tenant's templates with how many
+// templates carry each
+type TemplateTagsResponse struct {
+	Tags  []models.TemplateTagCount `json:"tags"`
+	Total int                       `json:"total"`
+}
+
+// TemplateTagRenamed is the response to renaming a tag
+type TemplateTagRenamed struct {
+	Name    string `json:"name"`    // The new name
+	Updated int    `json:"updated"` // Templates retagged
 }
 
 // =====================================================
@@ -72,16 +143,15 @@ func (h *TemplateHandler) getTenantID(r *http.Request) (string, error) {
 // @Produce json
 // @Param template body models.CreateTemplateRequest true "Template creation request"
 // @Success 201 {object} models.MongoTemplate
-// @Failure 400 {object} map[string]string "Invalid request payload or validation error"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates [post]
+// @Failure 400 {object} CodedErrorResponse "Invalid request payload or validation error"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates [post]
 // @Security BearerAuth
 func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 	var req models.CreateTemplateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
@@ -94,19 +164,13 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get tenant ID from context (with fallback to user ID)
+	// Get tenant ID from context
 	tenantID, err := h.getTenantID(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
 		return
 	}
 
-	// Validate channel
-	if !models.IsValidChannel(req.Channel) {
-		respondWithError(w, http.StatusBadRequest, "Invalid channel: must be email, sms")
-		return
-	}
-
 	// Build content from request (merge convenience fields into content map)
 	content := req.Content
 	if content == nil {
@@ -148,16 +212,27 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 	if req.Status != "" {
 		status = req.Status
 	}
+	if status == string(models.TemplateStatusPublished) || status == string(models.TemplateStatusActive) {
+		required, err := h.templateApprovalRequired(ctx)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to load security settings: "+err.Error())
+			return
+		}
+		if required {
+			respondWithError(w, http.StatusConflict, "Templates must be approved before they are published; create a draft and submit it for approval")
+			return
+		}
+	}
 
 	// Parse ServiceID if provided
 	var serviceID string
 	if req.ServiceID != "" {
-		// Validate UUID format if needed
-		if _, err := uuid.ValidateUUID(req.ServiceID); err != nil {
+		parsed, err := uuid.ParseUUID(req.ServiceID)
+		if err != nil {
 			respondWithError(w, http.StatusBadRequest, "Invalid service ID format")
 			return
 		}
-		serviceID = req.ServiceID
+		serviceID = parsed
 	}
 
 	// Create template object
@@ -173,7 +248,7 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 		Subject:      subject,
 		Body:         body,
 		CustomFields: req.CustomFields,
-		Tags:         req.Tags,
+		Tags:         models.NormalizeTags(req.Tags),
 		Version:      1,
 		IsSystem:     false,
 		CreatedBy:    createdBy,
@@ -190,8 +265,9 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 		MetaTemplateName: req.MetaTemplateName,
 	}
 
-	// Extract merge tags from content
+	// Extract merge tags from content, each an optional string variable
 	template.Variables = template.ExtractMergeTags()
+	template.SyncVariablesSchema()
 
 	// Validate merge tags (returns warnings for undefined tags)
 	mergeTagWarnings := template.ValidateMergeTags()
@@ -207,25 +283,20 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Create template in database
-	if err := h.templateRepo.CreateTemplateCompat(template); err != nil {
+	if err := h.templateRepo.Create(ctx, template); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create template: "+err.Error())
 		return
 	}
-
-	// Publish Kafka event (fire-and-forget)
-	if h.kafkaProducer != nil {
-		event := map[string]interface{}{
-			"event_type":  "template.created",
-			"template_id": template.ID,
-			"tenant_id":   template.TenantID,
-			"channel":     template.Channel,
-			"status":      template.Status,
-			"created_by":  createdBy,
-			"created_at":  now.Unix(),
-		}
-		_ = h.kafkaProducer.PublishJSON(ctx, "template.created", event)
+	if h.cache != nil {
+		h.cache.InvalidateLists(r.Context(), template.TenantID)
 	}
 
+	// Record the event in the outbox for the relay to publish
+	event := events.NewTemplateEvent(events.TypeTemplateCreated, createdBy, template.TenantID, template.ID)
+	event.Channel = template.Channel
+	event.Status = template.Status
+	recordEvent(ctx, h.eventOutbox, event)
+
 	// Log activity
 	activity := &models.Activity{
 		ID:            uuid.MustNewUUID(),
@@ -242,7 +313,7 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 		UpdatedAt:     now,
 	}
 
-	_ = h.activityRepo.CreateActivityCompat(activity)
+	_ = h.activityRepo.CreateActivity(ctx, activity)
 
 	// Return template directly (MongoTemplate has proper JSON tags)
 	respondWithJSON(w, http.StatusCreated, template)
@@ -250,7 +321,7 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 
 // ListTemplates godoc
 // @Summary List templates with filters
-// @Description Retrieves templates with optional filtering by channel, status, created_by, tag, search term, and pagination support. Tag filtering uses templates_by_tag lookup table for efficient retrieval.
+// @Description Retrieves templates with optional filtering by channel, status, created_by, tag, search term, performance, and pagination support. Tag filtering queries the indexed tags array. Each template carries a usage summary (sends in the last 30 days and when it was last used).
 // @Tags Templates
 // @Accept json
 // @Produce json
@@ -258,19 +329,20 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 // @Param status query string false "Filter by status (draft, published)"
 // @Param created_by query string false "Filter by creator user ID (UUID)"
 // @Param tag query string false "Filter by tag (single tag name or comma-separated for multiple tags, uses AND logic)"
-// @Param search query string false "Search in template name and description"
+// @Param search query string false "Search in template name, description, subject and body"
+// @Param performance query string false "Quartile of 30-day sends within the tenant (high = top quartile, low = bottom quartile including unused, medium = the rest)"
 // @Param page query int false "Page number (default: 1)"
 // @Param limit query int false "Items per page (default: 50, max: 100)"
 // @Param sort_by query string false "Sort by field (name, created_at, updated_at)"
 // @Param sort_order query string false "Sort order (asc, desc)"
-// @Success 200 {object} models.TemplateListResponse
-// @Failure 400 {object} map[string]string "Invalid query parameters"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates [get]
+// @Success 200 {object} TemplateListResponse "templates, total, page, limit, totalPages"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates [get]
 // @Security BearerAuth
 func (h *TemplateHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
-	// Get tenant ID from context (with fallback to user ID)
+	// Get tenant ID from context
 	tenantID, err := h.getTenantID(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
@@ -282,330 +354,130 @@ func (h *TemplateHandler) ListTemplates(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	if _, denyAll := services.BuildScopeFilter("campaigns", dataScope, claims); denyAll {
+	scopeCreatedBy, denyAll := services.CreatedByScope("campaigns", dataScope, claims)
+	if denyAll {
 		respondWithError(w, http.StatusForbidden, "Permission denied")
 		return
 	}
 
-	// Parse tag filter (single or comma-separated)
-	tagFilter := r.URL.Query().Get("tag")
-	var templates []*models.MongoTemplate
-
-	if tagFilter != "" {
-		// Use tag-based lookup for efficient filtering
-		tags := strings.Split(tagFilter, ",")
-
-		if len(tags) == 1 {
-			// Single tag - use templates_by_tag lookup
-			tagName := strings.TrimSpace(tags[0])
-			templates, err = h.templateRepo.GetTemplatesByTag(tagName, 1000)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to retrieve templates by tag: "+err.Error())
-				return
-			}
-		} else {
-			// Multiple tags - use AND logic (template must have ALL tags)
-			// Get templates for first tag
-			firstTag := strings.TrimSpace(tags[0])
-			templates, err = h.templateRepo.GetTemplatesByTag(firstTag, 1000)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to retrieve templates by tag: "+err.Error())
-				return
-			}
-
-			// Filter to only templates that have ALL tags
-			var filteredTemplates []*models.MongoTemplate
-			for _, template := range templates {
-				hasAllTags := true
-				for _, tag := range tags {
-					tagName := strings.TrimSpace(tag)
-					if !template.HasTag(tagName) {
-						hasAllTags = false
-						break
-					}
-				}
-				if hasAllTags {
-					filteredTemplates = append(filteredTemplates, template)
-				}
-			}
-			templates = filteredTemplates
-		}
-
-		// Apply additional filters (channel, status, search, etc.) to tag-filtered results
-		// Accept both camelCase (frontend) and snake_case parameter names
-		tagSortBy := r.URL.Query().Get("sortBy")
-		if tagSortBy == "" {
-			tagSortBy = r.URL.Query().Get("sort_by")
-		}
-		tagSortOrder := r.URL.Query().Get("sortOrder")
-		if tagSortOrder == "" {
-			tagSortOrder = r.URL.Query().Get("sort_order")
-		}
-
-		filters := repositories.TemplateFilters{
-			TenantID:  tenantID,
-			Channel:   r.URL.Query().Get("channel"),
-			Status:    r.URL.Query().Get("status"),
-			Search:    r.URL.Query().Get("search"),
-			SortBy:    tagSortBy,
-			SortOrder: tagSortOrder,
-		}
-
-		// Apply filters manually
-		var finalTemplates []*models.MongoTemplate
-		for _, template := range templates {
-			// Channel filter
-			if filters.Channel != "" && template.Channel != filters.Channel {
-				continue
-			}
-
-			// Status filter
-			if filters.Status != "" && template.Status != filters.Status {
-				continue
-			}
-
-			// Search filter
-			if filters.Search != "" {
-				searchLower := strings.ToLower(filters.Search)
-				nameLower := strings.ToLower(template.Name)
-				descLower := strings.ToLower(template.Description)
-				if !strings.Contains(nameLower, searchLower) && !strings.Contains(descLower, searchLower) {
-					continue
-				}
-			}
-
-			finalTemplates = append(finalTemplates, template)
-		}
-		templates = finalTemplates
-	} else {
-		// No tag filter - use standard List method
-		// Accept both camelCase (frontend) and snake_case parameter names
-		sortBy := r.URL.Query().Get("sortBy")
-		if sortBy == "" {
-			sortBy = r.URL.Query().Get("sort_by")
-		}
-		sortOrder := r.URL.Query().Get("sortOrder")
-		if sortOrder == "" {
-			sortOrder = r.URL.Query().Get("sort_order")
-		}
-
-		filters := repositories.TemplateFilters{
-			TenantID:     tenantID,
-			Channel:      r.URL.Query().Get("channel"),
-			Status:       r.URL.Query().Get("status"),
-			Search:       r.URL.Query().Get("search"),
-			SortBy:       sortBy,
-			SortOrder:    sortOrder,
-			ApprovalFlag: r.URL.Query().Get("approvalFlag"),
-			Performance:  r.URL.Query().Get("performance"),
-		}
-
-		// Parse serviceId filter (UUID reference)
-		if serviceIDStr := r.URL.Query().Get("serviceId"); serviceIDStr != "" {
-			if _, err := uuid.ValidateUUID(serviceIDStr); err != nil {
-				respondWithError(w, http.StatusBadRequest, "Invalid serviceId format")
-				return
-			}
-			filters.ServiceID = serviceIDStr
-		}
-
-		// Parse forStage filter - supports both:
-		// 1. Multiple params: forStage=prospect&forStage=mql
-		// 2. Comma-separated: forStage=prospect,mql
-		if forStageValues := r.URL.Query()["forStage"]; len(forStageValues) > 0 {
-			for _, val := range forStageValues {
-				// Split each value by comma in case of comma-separated format
-				parts := strings.Split(val, ",")
-				for _, part := range parts {
-					trimmed := strings.TrimSpace(part)
-					if trimmed != "" {
-						filters.ForStage = append(filters.ForStage, trimmed)
-					}
-				}
-			}
-		}
-
-		// Parse industries filter - supports both formats
-		if industriesValues := r.URL.Query()["industries"]; len(industriesValues) > 0 {
-			for _, val := range industriesValues {
-				parts := strings.Split(val, ",")
-				for _, part := range parts {
-					trimmed := strings.TrimSpace(part)
-					if trimmed != "" {
-						filters.Industries = append(filters.Industries, trimmed)
-					}
-				}
-			}
-		}
-
-		// Parse created_by filter
-		if createdByStr := r.URL.Query().Get("created_by"); createdByStr != "" {
-			if _, err := uuid.ValidateUUID(createdByStr); err != nil {
-				respondWithError(w, http.StatusBadRequest, "Invalid created_by UUID format")
-				return
-			}
-			filters.CreatedBy = createdByStr
-		}
+	query := r.URL.Query()
 
-		// Parse pagination
-		filters.Page = 1
-		if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-			page, err := strconv.Atoi(pageStr)
-			if err != nil || page < 1 {
-				respondWithError(w, http.StatusBadRequest, "Invalid page number")
-				return
-			}
-			filters.Page = page
-		}
+	// Accept both camelCase (frontend) and snake_case parameter names
+	sortBy := query.Get("sortBy")
+	if sortBy == "" {
+		sortBy = query.Get("sort_by")
+	}
+	sortOrder := query.Get("sortOrder")
+	if sortOrder == "" {
+		sortOrder = query.Get("sort_order")
+	}
 
-		filters.Limit = 50
-		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-			limit, err := strconv.Atoi(limitStr)
-			if err != nil || limit < 1 {
-				respondWithError(w, http.StatusBadRequest, "Invalid limit value")
-				return
-			}
-			if limit > 100 {
-				limit = 100
-			}
-			filters.Limit = limit
-		}
+	filters := repositories.TemplateFilters{
+		TenantID:       tenantID,
+		Channel:        query.Get("channel"),
+		Status:         query.Get("status"),
+		Search:         query.Get("search"),
+		SortBy:         sortBy,
+		SortOrder:      sortOrder,
+		ApprovalFlag:   query.Get("approvalFlag"),
+		Performance:    query.Get("performance"),
+		ScopeCreatedBy: scopeCreatedBy, // Data scope is applied in the query so totals are exact
+	}
 
-		// Validate channel if provided
-		if filters.Channel != "" && !models.IsValidChannel(filters.Channel) {
-			respondWithError(w, http.StatusBadRequest, "Invalid channel: must be email, sms, whatsapp, or linkedin")
-			return
-		}
+	// Tag filter (single or comma-separated, AND semantics)
+	filters.Tags = splitQueryList(query["tag"])
 
-		// Validate status if provided
-		if filters.Status != "" && !models.IsValidTemplateStatus(filters.Status) {
-			respondWithError(w, http.StatusBadRequest, "Invalid status: must be draft or published")
+	// Parse serviceId filter (UUID reference)
+	if serviceIDStr := query.Get("serviceId"); serviceIDStr != "" {
+		serviceID, err := uuid.ParseUUID(serviceIDStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid serviceId format")
 			return
 		}
+		filters.ServiceID = serviceID
+	}
 
-		// If scope is not "all", fetch a larger window and apply scope filtering + pagination in-memory.
-		requestedPage := filters.Page
-		requestedLimit := filters.Limit
-		scopeValue := strings.ToLower(strings.TrimSpace(services.ScopeValueForResource(dataScope, "campaigns")))
-		if scopeValue == "all" || scopeValue == "" {
-			// Admin / full scope (or empty = all): do not filter by tenant_id so all org templates are visible
-			filters.TenantID = ""
-		}
-		if scopeValue != "" && scopeValue != "all" {
-			filters.Page = 1
-			filters.Limit = 1000
-		}
+	// forStage and industries support both repeated params and comma-separated values
+	filters.ForStage = splitQueryList(query["forStage"])
+	filters.Industries = splitQueryList(query["industries"])
 
-		// Call repository (pagination is already applied via filters.Page and filters.Limit)
-		templates, err = h.templateRepo.ListTemplates(filters)
+	// Parse created_by filter
+	if createdByStr := query.Get("created_by"); createdByStr != "" {
+		createdBy, err := uuid.ParseUUID(createdByStr)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve templates: "+err.Error())
+			respondWithError(w, http.StatusBadRequest, "Invalid created_by UUID format")
 			return
 		}
+		filters.CreatedBy = createdBy
+	}
 
-		// Enforce RBAC Data Scope (campaigns scope applies to templates)
-		filtered := make([]*models.MongoTemplate, 0, len(templates))
-		for _, t := range templates {
-			if services.IsInScope("campaigns", dataScope, claims, t) {
-				filtered = append(filtered, t)
-			}
-		}
-		templates = filtered
-		totalCount := int64(len(templates))
-
-		// Apply pagination if we fetched a larger window
-		page := requestedPage
-		limit := requestedLimit
-		if scopeValue != "" && scopeValue != "all" {
-			start := (page - 1) * limit
-			if start < 0 {
-				start = 0
-			}
-			end := start + limit
-			if start >= len(templates) {
-				templates = []*models.MongoTemplate{}
-			} else {
-				if end > len(templates) {
-					end = len(templates)
-				}
-				templates = templates[start:end]
-			}
-		}
-
-		// Calculate total pages
-		totalPages := (int(totalCount) + requestedLimit - 1) / requestedLimit
-
-		// Build response
-		response := map[string]interface{}{
-			"templates":  templates,
-			"total":      totalCount,
-			"page":       requestedPage,
-			"limit":      requestedLimit,
-			"totalPages": totalPages,
-		}
-
-		respondWithJSON(w, http.StatusOK, response)
+	// Parse pagination
+	var ok bool
+	if filters.Page, filters.Limit, ok = parsePage(w, r); !ok {
 		return
 	}
 
-	// For tag-filtered results, pagination is applied manually
-	// Get total count from filtered results
-	totalCount := len(templates)
+	// Validate channel if provided
+	if filters.Channel != "" && !models.IsValidChannel(filters.Channel) {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel: must be email, sms, whatsapp, or linkedin")
+		return
+	}
 
-	// Enforce RBAC Data Scope (campaigns scope applies to templates)
-	filtered := make([]*models.MongoTemplate, 0, len(templates))
-	for _, t := range templates {
-		if services.IsInScope("campaigns", dataScope, claims, t) {
-			filtered = append(filtered, t)
-		}
+	// Validate status if provided
+	if filters.Status != "" && !models.IsValidTemplateStatus(filters.Status) {
+		respondWithError(w, http.StatusBadRequest, "Invalid status: must be draft or published")
+		return
 	}
-	templates = filtered
-	totalCount = len(templates)
 
-	// Parse pagination params
-	page := 1
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		parsedPage, err := strconv.Atoi(pageStr)
-		if err == nil && parsedPage > 0 {
-			page = parsedPage
-		}
+	// Validate performance if provided
+	if filters.Performance != "" && !models.IsValidTemplatePerformance(filters.Performance) {
+		respondWithError(w, http.StatusBadRequest, "Invalid performance: must be high, medium, or low")
+		return
 	}
 
-	limit := 50
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err == nil && parsedLimit > 0 {
-			if parsedLimit > 100 {
-				parsedLimit = 100
-			}
-			limit = parsedLimit
+	// Listing pages are cached briefly per tenant and filter set (data scope included)
+	load := func(ctx context.Context) (*cache.TemplateListPage, error) {
+		templates, total, err := h.templateRepo.ListTemplatesPage(ctx, filters)
+		if err != nil {
+			return nil, err
 		}
+		return &cache.TemplateListPage{Templates: templates, Total: total}, nil
 	}
-
-	// Calculate pagination
-	totalPages := (totalCount + limit - 1) / limit
-	startIdx := (page - 1) * limit
-	endIdx := startIdx + limit
-
-	if startIdx >= totalCount {
-		templates = []*models.MongoTemplate{} // Empty results for out-of-range page
+	var page *cache.TemplateListPage
+	if h.cache != nil {
+		page, err = h.cache.GetOrLoadList(r.Context(), tenantID, filters, load)
 	} else {
-		if endIdx > totalCount {
-			endIdx = totalCount
-		}
-		templates = templates[startIdx:endIdx]
+		page, err = load(r.Context())
 	}
-
-	// Build response - MongoTemplate has proper JSON tags
-	response := map[string]interface{}{
-		"templates":  templates,
-		"total":      totalCount,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": totalPages,
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve templates: "+err.Error())
+		return
 	}
+	templates, totalCount := page.Templates, page.Total
 
-	respondWithJSON(w, http.StatusOK, response)
+	// Calculate total pages
+	totalPages := (int(totalCount) + filters.Limit - 1) / filters.Limit
+
+	respondWithJSON(w, http.StatusOK, TemplateListResponse{
+		Templates:  templates,
+		Total:      totalCount,
+		Page:       filters.Page,
+		Limit:      filters.Limit,
+		TotalPages: totalPages,
+	})
+}
+
+// splitQueryList flattens repeated and comma-separated query values, dropping blanks
+func splitQueryList(values []string) []string {
+	var out []string
+	for _, val := range values {
+		for _, part := range strings.Split(val, ",") {
+			if trimmed := strings.TrimSpace(part); trimmed != "" {
+				out = append(out, trimmed)
+			}
+		}
+	}
+	return out
 }
 
 // GetTemplate godoc
@@ -616,100 +488,88 @@ func (h *TemplateHandler) ListTemplates(w http.ResponseWriter, r *http.Request)
 // @Produce json
 // @Param id path string true "Template ID (UUID)"
 // @Success 200 {object} models.MongoTemplate
-// @Failure 400 {object} map[string]string "Invalid template ID"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Template not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates/{id} [get]
+// @Failure 400 {object} ErrorResponse "Invalid template ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id} [get]
 // @Security BearerAuth
 func (h *TemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	templateID := vars["id"]
-	if _, err := uuid.ValidateUUID(templateID); err != nil {
+	templateID, err := uuid.ParseUUID(vars["id"])
+	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
 
-	// Get tenant ID from context (with fallback to user ID)
+	// Get tenant ID from context
 	tenantID, err := h.getTenantID(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
 		return
 	}
 
+	// Cache-aside: published templates are served from cache and concurrent
+	// misses share one database read. Only published templates are cached;
+	// drafts change frequently.
+	load := func(ctx context.Context) (*models.MongoTemplate, error) {
+		return h.templateRepo.GetByID(ctx, tenantID, templateID)
+	}
 	var template *models.MongoTemplate
-
-	// Cache-aside pattern: Try to get from cache first (only if cache is available)
 	if h.cache != nil {
-		cachedTemplate, err := h.cache.Get(tenantID, templateID)
-		if err == nil {
-			// Cache hit
-			template = cachedTemplate
-			goto respondTemplate
-		}
-		// Cache miss - continue to database query
+		template, err = h.cache.GetOrLoad(r.Context(), tenantID, templateID, load)
+	} else {
+		template, err = load(r.Context())
 	}
-
-	// Get template from database
-	template, err = h.templateRepo.GetTemplateByIDCompat(tenantID, templateID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
 		return
 	}
 
-respondTemplate:
-	// Enforce RBAC Data Scope (campaigns scope applies to templates)
-	dataScope, claims, err := h.getCampaignScope(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-	if _, denyAll := services.BuildScopeFilter("campaigns", dataScope, claims); denyAll || !services.IsInScope("campaigns", dataScope, claims, template) {
-		respondWithError(w, http.StatusForbidden, "Permission denied")
+	// Enforce RBAC Data Scope (campaigns scope applies to templates); templates
+	// out of scope are not found
+	if !h.templateInScope(w, r, template) {
 		return
 	}
 
-	// Cache the template if it's published (only cache published templates)
-	// Draft templates change frequently and should not be cached
-	if h.cache != nil && template.Status == "published" {
-		if err := h.cache.Set(template); err != nil {
-			// Log error but don't fail the request
-			// Caching is a performance optimization, not a requirement
-			// We could add logging here: log.Printf("Failed to cache template: %v", err)
-		}
-	}
-
 	// Return frontend-compatible response
+	setVersionETag(w, template.Version)
 	respondWithJSON(w, http.StatusOK, template)
 }
 
 // UpdateTemplate godoc
 // @Summary Update a template
-// @Description Updates an existing template. Only draft templates should be updated directly. For published templates, consider creating a new version.
+// @Description Updates an existing template. Only draft templates should be updated directly. For published templates, consider creating a new version. Sending the version last read (If-Match header or version field) refuses the update with 409 when the template changed since. A variablesSchema sent replaces the template's; merge tags it does not declare are added as optional strings.
 // @Tags Templates
 // @Accept json
 // @Produce json
 // @Param id path string true "Template ID (UUID)"
+// @Param If-Match header string false "Version last read, as returned in the ETag header"
 // @Param template body models.UpdateTemplateRequest true "Template update request"
 // @Success 200 {object} models.MongoTemplate
-// @Failure 400 {object} map[string]string "Invalid request or attempting to update published template"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Template not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates/{id} [put]
+// @Failure 400 {object} CodedErrorResponse "Invalid request or attempting to update published template"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 409 {object} VersionConflictResponse "Template changed since the version sent; includes the current template"
+// @Failure 428 {object} CodedErrorResponse "Version required but not sent"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id} [put]
 // @Security BearerAuth
 func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	ctx := context.Background()
-	templateID := vars["id"]
-	if _, err := uuid.ValidateUUID(templateID); err != nil {
+	ctx := r.Context()
+	templateID, err := uuid.ParseUUID(vars["id"])
+	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
 
 	var req models.UpdateTemplateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	version, ok := expectedVersion(w, r, req.Version, h.requireVersion)
+	if !ok {
 		return
 	}
 
@@ -722,7 +582,7 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get tenant ID from context (with fallback to user ID)
+	// Get tenant ID from context
 	tenantID, err := h.getTenantID(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
@@ -730,20 +590,15 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Fetch existing template
-	template, err := h.templateRepo.GetTemplateByIDCompat(tenantID, templateID)
+	template, err := h.templateRepo.GetByID(ctx, tenantID, templateID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
 		return
 	}
 
-	// Enforce RBAC Data Scope (campaigns scope applies to templates)
-	dataScope, claims, err := h.getCampaignScope(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-	if _, denyAll := services.BuildScopeFilter("campaigns", dataScope, claims); denyAll || !services.IsInScope("campaigns", dataScope, claims, template) {
-		respondWithError(w, http.StatusForbidden, "Permission denied")
+	// Enforce RBAC Data Scope (campaigns scope applies to templates); templates
+	// out of scope are not found
+	if !h.templateInScope(w, r, template) {
 		return
 	}
 
@@ -752,6 +607,10 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "System templates cannot be edited")
 		return
 	}
+	if version != nil && template.Version != *version {
+		respondWithVersionConflict(w, template)
+		return
+	}
 
 	// Warn if updating published template
 	if template.Status == "published" {
@@ -775,7 +634,7 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		template.CustomFields = req.CustomFields
 	}
 	if req.Tags != nil {
-		template.Tags = req.Tags
+		template.Tags = models.NormalizeTags(req.Tags)
 	}
 
 	// Apply frontend-compatible fields
@@ -808,8 +667,12 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		template.Variables = template.ExtractMergeTags()
 	}
 
-	// Apply status update
+	// Apply status update (going live must pass the publish validation gate)
 	if req.Status != "" {
+		if (req.Status == string(models.TemplateStatusPublished) || req.Status == string(models.TemplateStatusActive)) && !template.IsPublished() {
+			respondWithError(w, http.StatusBadRequest, "Use POST /api/v1/templates/{id}/publish to publish a template")
+			return
+		}
 		template.Status = req.Status
 	}
 
@@ -837,12 +700,20 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 
 	// Apply service ID (validate UUID)
 	if req.ServiceID != "" {
-		if _, err := uuid.ValidateUUID(req.ServiceID); err != nil {
+		serviceID, err := uuid.ParseUUID(req.ServiceID)
+		if err != nil {
 			respondWithError(w, http.StatusBadRequest, "Invalid service ID format")
 			return
 		}
-		template.ServiceID = req.ServiceID
+		template.ServiceID = serviceID
+	}
+
+	// A schema sent replaces the stored one; tags it leaves out, and tags
+	// new to the content, become optional strings
+	if req.VariablesSchema != nil {
+		template.VariablesSchema = req.VariablesSchema
 	}
+	template.SyncVariablesSchema()
 
 	// Update timestamp
 	template.UpdatedAt = time.Now()
@@ -860,28 +731,42 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Update in database
-	if err := h.templateRepo.UpdateTemplateCompat(template); err != nil {
+	// A pending or approved review does not cover the edited content
+	if template.ApprovalResetOnEdit() {
+		if err := h.resetApproval(ctx, template, updatedBy); err != nil {
+			if errors.Is(err, repositories.ErrApprovalStateChanged) {
+				respondWithError(w, http.StatusConflict, "Template approval status changed, reload and try again")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Failed to reset template approval: "+err.Error())
+			return
+		}
+	}
+
+	// Update in database, only at the version read when the client sent one
+	if version != nil {
+		err = h.templateRepo.UpdateTemplateAtVersion(ctx, template, *version)
+	} else {
+		err = h.templateRepo.UpdateTemplate(ctx, template)
+	}
+	if err != nil {
+		if errors.Is(err, repositories.ErrVersionConflict) {
+			if current, getErr := h.templateRepo.GetByID(ctx, tenantID, templateID); getErr == nil {
+				respondWithVersionConflict(w, current)
+				return
+			}
+		}
 		respondWithError(w, http.StatusInternalServerError, "Failed to update template: "+err.Error())
 		return
 	}
 
 	// Invalidate cache (template content changed)
 	if h.cache != nil {
-		_ = h.cache.Delete(tenantID, templateID)
+		h.cache.Delete(r.Context(), tenantID, templateID)
 	}
 
-	// Publish Kafka event (fire-and-forget)
-	if h.kafkaProducer != nil {
-		event := map[string]interface{}{
-			"event_type":  "template.updated",
-			"template_id": template.ID,
-			"tenant_id":   template.TenantID,
-			"updated_by":  updatedBy,
-			"updated_at":  template.UpdatedAt.Unix(),
-		}
-		_ = h.kafkaProducer.PublishJSON(ctx, "template.updated", event)
-	}
+	// Record the event in the outbox for the relay to publish
+	recordEvent(ctx, h.eventOutbox, events.NewTemplateEvent(events.TypeTemplateUpdated, updatedBy, template.TenantID, template.ID))
 
 	// Log activity
 	now := time.Now()
@@ -899,68 +784,69 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		CreatedAt:     now,
 		UpdatedAt:     now,
 	}
-	_ = h.activityRepo.CreateActivityCompat(activity)
+	_ = h.activityRepo.CreateActivity(ctx, activity)
 
 	// Return frontend-compatible response
+	setVersionETag(w, template.Version)
 	respondWithJSON(w, http.StatusOK, template)
 }
 
 // DeleteTemplate godoc
 // @Summary Delete a template
-// @Description Deletes a template (hard delete). System templates cannot be deleted. Removes tag associations and updates counters.
+// @Description Moves a template to the trash (soft delete); it can be restored until the retention sweep purges it. With permanent=true an admin removes the template for good, whether or not it is in the trash. System templates cannot be deleted.
 // @Tags Templates
 // @Accept json
 // @Produce json
 // @Param id path string true "Template ID (UUID)"
+// @Param permanent query bool false "Permanently delete (admin only)"
 // @Success 204 "No Content - Template deleted successfully"
-// @Failure 400 {object} map[string]string "Invalid template ID or cannot delete system template"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Template not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates/{id} [delete]
+// @Failure 400 {object} ErrorResponse "Invalid template ID or cannot delete system template"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied or permanent delete by a non-admin"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id} [delete]
 // @Security BearerAuth
 func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 	vars := mux.Vars(r)
-	templateID := vars["id"]
-	if _, err := uuid.ValidateUUID(templateID); err != nil {
+	templateID, err := uuid.ParseUUID(vars["id"])
+	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
 
 	// Get user ID from context
-	var deletedBy string
-	if userID, ok := r.Context().Value("user_id").(string); ok {
-		deletedBy = userID
-	} else {
+	deletedBy, ok := ctx.Value("user_id").(string)
+	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Get tenant ID from context (with fallback to user ID)
-	tenantID, err := h.getTenantID(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
-		return
+	permanent := false
+	if permanentStr := r.URL.Query().Get("permanent"); permanentStr != "" {
+		var err error
+		if permanent, err = strconv.ParseBool(permanentStr); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid permanent value")
+			return
+		}
 	}
-
-	// Fetch existing template
-	template, err := h.templateRepo.GetTemplateByIDCompat(tenantID, templateID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
+	if permanent && !h.perms.HasRole(r, models.RoleAdmin) {
+		respondWithError(w, http.StatusForbidden, "Only admins can permanently delete templates")
 		return
 	}
 
-	// Enforce RBAC Data Scope (campaigns scope applies to templates)
-	dataScope, claims, err := h.getCampaignScope(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
+	// Trashed templates can only be reached for permanent removal
+	var template *models.MongoTemplate
+	if permanent {
+		template, ok = h.loadAnyStateTemplateInScope(w, r, templateID)
+	} else {
+		template, ok = h.loadTemplateInScope(w, r, templateID)
 	}
-	if _, denyAll := services.BuildScopeFilter("campaigns", dataScope, claims); denyAll || !services.IsInScope("campaigns", dataScope, claims, template) {
-		respondWithError(w, http.StatusForbidden, "Permission denied")
+	if !ok {
 		return
 	}
+	tenantID := template.TenantID
 
 	// Check if template can be deleted
 	if !template.CanDelete() {
@@ -968,203 +854,287 @@ func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Remove tag associations and update counters
-	for _, tagName := range template.Tags {
-		_ = h.templateRepo.RemoveTagFromTemplateCompat(tenantID, tagName)
-	}
-
-	// Delete template
-	if err := h.templateRepo.DeleteTemplateCompat(tenantID, templateID); err != nil {
+	if permanent {
+		if err := h.templateRepo.Delete(ctx, tenantID, templateID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to delete template: "+err.Error())
+			return
+		}
+	} else if err := h.templateRepo.SoftDelete(ctx, tenantID, templateID, deletedBy); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete template: "+err.Error())
 		return
 	}
 
-	// Invalidate cache (template deleted)
+	// Invalidate cache (template no longer readable either way)
 	if h.cache != nil {
-		_ = h.cache.Delete(tenantID, templateID)
+		h.cache.Delete(r.Context(), tenantID, templateID)
 	}
 
-	// Publish Kafka event (fire-and-forget)
-	if h.kafkaProducer != nil {
-		event := map[string]interface{}{
-			"event_type":  "template.deleted",
-			"template_id": templateID,
-			"tenant_id":   tenantID,
-			"deleted_by":  deletedBy,
-			"deleted_at":  time.Now().Unix(),
-		}
-		_ = h.kafkaProducer.PublishJSON(ctx, "template.deleted", event)
+	// Record the event in the outbox for the relay to publish
+	eventType := events.TypeTemplateSoftDeleted
+	if permanent {
+		eventType = events.TypeTemplatePurged
 	}
+	recordEvent(ctx, h.eventOutbox, events.NewTemplateEvent(eventType, deletedBy, tenantID, templateID))
 
-	// Log activity
-	now := time.Now()
-	activity := &models.Activity{
-		ID:            uuid.MustNewUUID(),
-		ActivityType:  "note",
-		Title:         "Template Deleted",
-		Description:   "Template deleted: " + template.Name,
-		Owner:         deletedBy,
-		RelatedToType: "template",
-		RelatedToID:   templateID,
-		Status:        "completed",
-		Priority:      "high",
-		CreatedBy:     deletedBy,
-		CreatedAt:     now,
-		UpdatedAt:     now,
+	if permanent {
+		h.logTemplateActivity(ctx, template, deletedBy, "Template Permanently Deleted", "Template permanently deleted: "+template.Name)
+	} else {
+		h.logTemplateActivity(ctx, template, deletedBy, "Template Deleted", "Template moved to trash: "+template.Name)
 	}
-	_ = h.activityRepo.CreateActivityCompat(activity)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// DuplicateTemplate godoc
-// @Summary Clone a template
-// @Description Creates a copy of an existing template with a new UUID. Appends " (Copy)" to the name, sets status to draft, and version to 1. Does not copy analytics.
+// ListTrashTemplates godoc
+// @Summary List trashed templates
+// @Description Lists the tenant's soft-deleted templates, most recently deleted first, within the caller's data scope. Trashed templates are purged permanently after the configured retention period.
 // @Tags Templates
-// @Accept json
 // @Produce json
-// @Param id path string true "Source Template ID (UUID)"
-// @Success 201 {object} models.MongoTemplate
-// @Failure 400 {object} map[string]string "Invalid template ID"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Source template not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates/{id}/duplicate [post]
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Success 200 {object} TemplateListResponse "templates, total, page, limit, totalPages"
+// @Failure 400 {object} ErrorResponse "Invalid pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/trash [get]
 // @Security BearerAuth
-func (h *TemplateHandler) DuplicateTemplate(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sourceTemplateID := vars["id"]
-	ctx := r.Context()
-	_, err := uuid.ValidateUUID(sourceTemplateID)
+func (h *TemplateHandler) ListTrashTemplates(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := h.getTenantID(r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
 		return
 	}
 
-	// Get user ID from context
-	var createdBy string
-	if userID, ok := r.Context().Value("user_id").(string); ok {
-		createdBy = userID
-	} else {
+	dataScope, claims, err := h.getCampaignScope(r)
+	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-
-	tenantID, err := h.getTenantID(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invaild tenant ID")
-	}
-	// Get source template
-	sourceTemplate, err := h.templateRepo.GetTemplateByIDCompat(tenantID, sourceTemplateID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Source template not found: "+err.Error())
+	scopeCreatedBy, denyAll := services.CreatedByScope("campaigns", dataScope, claims)
+	if denyAll {
+		respondWithError(w, http.StatusForbidden, "Permission denied")
 		return
 	}
 
-	// Create new template (copy)
-	now := time.Now()
-	newTemplate := &models.MongoTemplate{
-		ID:           uuid.MustNewUUID(), // New UUID
-		TenantID:     tenantID,
-		Name:         sourceTemplate.Name + " (Copy)",
-		Description:  sourceTemplate.Description,
-		Channel:      sourceTemplate.Channel,
-		Category:     sourceTemplate.Category,
-		Status:       "draft", // Always draft
-		Content:      make(map[string]string),
-		Subject:      sourceTemplate.Subject,
-		Body:         sourceTemplate.Body,
-		Variables:    make([]string, len(sourceTemplate.Variables)),
-		CustomFields: make(map[string]string),
-		Tags:         make([]string, len(sourceTemplate.Tags)),
-		Version:      1,     // Reset version
-		IsSystem:     false, // Never system template
-		CreatedBy:    createdBy,
-		CreatedAt:    now,
-		UpdatedAt:    now,
-		PublishedAt:  nil, // Not published
-		PublishedBy:  "",
+	page, limit, ok := parsePage(w, r)
+	if !ok {
+		return
 	}
 
-	for k, v := range sourceTemplate.Content {
-		newTemplate.Content[k] = v
+	templates, total, err := h.templateRepo.ListTrash(r.Context(), tenantID, scopeCreatedBy, page, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve trashed templates: "+err.Error())
+		return
 	}
 
-	// Copy variables (merge tags)
-	copy(newTemplate.Variables, sourceTemplate.Variables)
+	respondWithJSON(w, http.StatusOK, TemplateListResponse{
+		Templates:  templates,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: (int(total) + limit - 1) / limit,
+	})
+}
 
-	// Copy custom fields
-	if sourceTemplate.CustomFields != nil {
-		for k, v := range sourceTemplate.CustomFields {
-			newTemplate.CustomFields[k] = v
-		}
+// RestoreDeletedTemplate godoc
+// @Summary Restore a template from the trash
+// @Description Takes a soft-deleted template out of the trash with its previous status. Archived templates are restored with PUT /api/v1/templates/{id}/restore instead.
+// @Tags Templates
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Success 200 {object} models.MongoTemplate
+// @Failure 400 {object} ErrorResponse "Invalid template ID or template not in trash"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/restore [post]
+// @Security BearerAuth
+func (h *TemplateHandler) RestoreDeletedTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
 	}
 
-	// Copy tags
-	copy(newTemplate.Tags, sourceTemplate.Tags)
+	userID, ok := ctx.Value("user_id").(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
 
-	// Create new template in database
-	if err := h.templateRepo.CreateTemplateCompat(newTemplate); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to duplicate template: "+err.Error())
+	template, ok := h.loadAnyStateTemplateInScope(w, r, templateID)
+	if !ok {
+		return
+	}
+	if !template.IsDeleted() {
+		respondWithError(w, http.StatusBadRequest, "Template is not in the trash")
 		return
 	}
 
-	// Publish Kafka event (fire-and-forget)
-	if h.kafkaProducer != nil {
-		event := map[string]interface{}{
-			"event_type":         "template.created",
-			"template_id":        newTemplate.ID,
-			"source_template_id": sourceTemplateID,
-			"tenant_id":          newTemplate.TenantID,
-			"channel":            newTemplate.Channel,
-			"status":             newTemplate.Status,
-			"created_by":         createdBy,
-			"created_at":         now.Unix(),
-			"is_duplicate":       true,
+	if err := h.templateRepo.RestoreFromTrash(ctx, template.TenantID, templateID); err != nil {
+		if errors.Is(err, repositories.ErrTemplateNotFound) {
+			respondWithError(w, http.StatusNotFound, "Template not found")
+			return
 		}
-		_ = h.kafkaProducer.PublishJSON(ctx, "template.created", event)
+		respondWithError(w, http.StatusInternalServerError, "Failed to restore template: "+err.Error())
+		return
 	}
-	// Log activity
-	activity := &models.Activity{
-		ID:            uuid.MustNewUUID(),
-		ActivityType:  "note",
-		Title:         "Template Duplicated",
-		Description:   "Template duplicated from: " + sourceTemplate.Name,
-		Owner:         createdBy,
-		RelatedToType: "template",
-		RelatedToID:   newTemplate.ID,
-		Status:        "completed",
-		Priority:      "medium",
-		CreatedBy:     createdBy,
-		CreatedAt:     now,
-		UpdatedAt:     now,
+	if h.cache != nil {
+		h.cache.InvalidateLists(ctx, template.TenantID)
 	}
-	_ = h.activityRepo.CreateActivityCompat(activity)
 
-	// Return template directly (MongoTemplate has proper JSON tags)
-	respondWithJSON(w, http.StatusCreated, newTemplate)
+	restored, err := h.templateRepo.GetByID(ctx, template.TenantID, templateID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load restored template: "+err.Error())
+		return
+	}
+
+	recordEvent(ctx, h.eventOutbox, events.NewTemplateEvent(events.TypeTemplateTrashRestored, userID, restored.TenantID, templateID))
+
+	h.logTemplateActivity(ctx, restored, userID, "Template Restored", "Template restored from trash: "+restored.Name)
+
+	respondWithJSON(w, http.StatusOK, restored)
 }
 
-func (h *TemplateHandler) getCampaignScope(r *http.Request) (models.DataScope, services.ScopeClaims, error) {
+// DuplicateTemplate godoc
+// @Summary Clone a template
+// @Description Creates a draft copy of an existing template with a new UUID, deep-copying content, custom fields, tags and channel-specific fields. Uses the given name or appends " (copy)" to the source name; auto-generated names never collide within the tenant. Version resets to 1 and analytics are not copied.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Source Template ID (UUID)"
+// @Param request body models.DuplicateTemplateRequest false "Optional name for the copy"
+// @Success 201 {object} models.MongoTemplate
+// @Failure 400 {object} CodedErrorResponse "Invalid template ID or request body"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Source template not found"
+// @Failure 409 {object} ErrorResponse "A template with the requested name already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/duplicate [post]
+// @Security BearerAuth
+func (h *TemplateHandler) DuplicateTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
 	ctx := r.Context()
-	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	sourceTemplateID, err := uuid.ParseUUID(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+
+	// Body is optional
+	var req models.DuplicateTemplateRequest
+	if r.Body != nil && r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	// Get user ID from context
+	var createdBy string
+	if userID, ok := r.Context().Value("user_id").(string); ok {
+		createdBy = userID
+	} else {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return
+	}
+
+	// Get source template (the caller must be able to read it)
+	sourceTemplate, ok := h.loadTemplateInScope(w, r, sourceTemplateID)
 	if !ok {
-		return models.DataScope{}, services.ScopeClaims{}, fmt.Errorf("user ID not found")
+		return
+	}
+
+	name, err := h.uniqueDuplicateName(ctx, tenantID, sourceTemplate.Name, req.Name)
+	if err != nil {
+		if errors.Is(err, errTemplateNameTaken) {
+			respondWithError(w, http.StatusConflict, "A template named \""+req.Name+"\" already exists")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to duplicate template: "+err.Error())
+		return
+	}
+
+	// Create new template (deep copy, always a draft)
+	now := time.Now()
+	newTemplate := sourceTemplate.Duplicate(uuid.MustNewUUID(), tenantID, name, createdBy, now)
+
+	// Create new template in database
+	if err := h.templateRepo.Create(ctx, newTemplate); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to duplicate template: "+err.Error())
+		return
 	}
-	team, _ := ctx.Value(middleware.TeamKey).(string)
-	// region, _ := ctx.Value(middleware.RegionKey).(string)
-	region := ""
+	if h.cache != nil {
+		h.cache.InvalidateLists(ctx, tenantID)
+	}
+
+	// Record the event in the outbox for the relay to publish
+	event := events.NewTemplateEvent(events.TypeTemplateCreated, createdBy, newTemplate.TenantID, newTemplate.ID)
+	event.SourceTemplateID = sourceTemplateID
+	event.Channel = newTemplate.Channel
+	event.Status = newTemplate.Status
+	recordEvent(ctx, h.eventOutbox, event)
+
+	h.logTemplateActivity(ctx, newTemplate, createdBy, "Template Duplicated", "Template duplicated from: "+sourceTemplate.Name)
 
-	dataScope := models.DataScope{Customers: "all", Campaigns: "all"}
-	if ds, ok := ctx.Value(middleware.DataScopeKey).(models.DataScope); ok {
-		dataScope = ds
+	// Return template directly (MongoTemplate has proper JSON tags)
+	respondWithJSON(w, http.StatusCreated, newTemplate)
+}
+
+// errTemplateNameTaken is returned when an explicitly requested name is already used
+var errTemplateNameTaken = errors.New("template name already exists")
+
+// uniqueDuplicateName picks the name for a duplicated template. An explicit name
+// must be free within the tenant; otherwise "<source> (copy)", "<source> (copy 2)", ...
+// is used, taking the first one not already present.
+func (h *TemplateHandler) uniqueDuplicateName(ctx context.Context, tenantID, sourceName, requested string) (string, error) {
+	return h.uniqueTemplateName(ctx, tenantID, sourceName+" (copy)", requested)
+}
+
+// uniqueTemplateName picks the name for a template created from another. An
+// explicit name must be free within the tenant; otherwise fallback, which
+// ends in a bracket, is numbered inside it until it is free.
+func (h *TemplateHandler) uniqueTemplateName(ctx context.Context, tenantID, fallback, requested string) (string, error) {
+	base := requested
+	if base == "" {
+		base = fallback
 	}
 
-	teamUserIDs, err := services.GetTeamUserIDs(ctx, h.userRepo, team)
+	existing, err := h.templateRepo.ListNamesWithPrefix(ctx, tenantID, base)
 	if err != nil {
-		return models.DataScope{}, services.ScopeClaims{}, err
+		return "", err
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, n := range existing {
+		taken[n] = true
 	}
-	return dataScope, services.ScopeClaims{UserID: userID, Team: team, Region: region, TeamUserIDs: teamUserIDs}, nil
+
+	if !taken[base] {
+		return base, nil
+	}
+	if requested != "" {
+		return "", errTemplateNameTaken
+	}
+
+	stem := strings.TrimSuffix(base, ")")
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s %d)", stem, i)
+		if !taken[candidate] {
+			return candidate, nil
+		}
+	}
+}
+
+func (h *TemplateHandler) getCampaignScope(r *http.Request) (models.DataScope, services.ScopeClaims, error) {
+	return requestScope(r, h.userRepo)
 }
 
 
@@ -1179,23 +1149,22 @@ func (h *TemplateHandler) getCampaignScope(r *http.Request) (models.DataScope, s
 // @Produce json
 // @Param id path string true "Template ID"
 // @Success 200 {object} models.MongoTemplate
-// @Failure 400 {object} map[string]string "Invalid template ID"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Template not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates/{id}/archive [put]
+// @Failure 400 {object} ErrorResponse "Invalid template ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/archive [put]
 // @Security BearerAuth
 func (h *TemplateHandler) ArchiveTemplate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	templateID := vars["id"]
 	ctx := r.Context()
-	_, err := uuid.ValidateUUID(templateID)
+	templateID, err := uuid.ParseUUID(vars["id"])
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
 
-	// Get tenant ID from context (with fallback to user ID)
+	// Get tenant ID from context
 	tenantID, err := h.getTenantID(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
@@ -1203,7 +1172,7 @@ func (h *TemplateHandler) ArchiveTemplate(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get existing template
-	template, err := h.templateRepo.GetTemplateByIDCompat(tenantID, templateID)
+	template, err := h.templateRepo.GetByID(ctx, tenantID, templateID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
 		return
@@ -1225,22 +1194,17 @@ func (h *TemplateHandler) ArchiveTemplate(w http.ResponseWriter, r *http.Request
 	template.Status = "archived"
 	template.UpdatedAt = time.Now()
 
-	if err := h.templateRepo.UpdateTemplateCompat(template); err != nil {
+	if err := h.templateRepo.UpdateTemplate(ctx, template); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to archive template: "+err.Error())
 		return
 	}
-
-	// Publish Kafka event
-	if h.kafkaProducer != nil {
-		event := map[string]interface{}{
-			"event_type":  "template.archived",
-			"template_id": template.ID,
-			"tenant_id":   template.TenantID,
-			"archived_at": time.Now().Unix(),
-		}
-		_ = h.kafkaProducer.PublishJSON(ctx, "template.archived", event)
+	if h.cache != nil {
+		h.cache.Delete(ctx, tenantID, templateID)
 	}
 
+	// Record the event in the outbox for the relay to publish
+	recordEvent(ctx, h.eventOutbox, events.NewTemplateEvent(events.TypeTemplateArchived, middleware.GetUserID(r), template.TenantID, template.ID))
+
 	// Return frontend-compatible response
 	respondWithJSON(w, http.StatusOK, template)
 }
@@ -1253,23 +1217,22 @@ func (h *TemplateHandler) ArchiveTemplate(w http.ResponseWriter, r *http.Request
 // @Produce json
 // @Param id path string true "Template ID"
 // @Success 200 {object} models.MongoTemplate
-// @Failure 400 {object} map[string]string "Invalid template ID or not archived"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 404 {object} map[string]string "Template not found"
-// @Failure 500 {object} map[string]string "Internal server error"
-// @Router /api/v1/templates/{id}/restore [put]
+// @Failure 400 {object} ErrorResponse "Invalid template ID or not archived"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/restore [put]
 // @Security BearerAuth
 func (h *TemplateHandler) RestoreTemplate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	templateID := vars["id"]
 	ctx := r.Context()
-	_, err := uuid.ValidateUUID(templateID)
+	templateID, err := uuid.ParseUUID(vars["id"])
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
 		return
 	}
 
-	// Get tenant ID from context (with fallback to user ID)
+	// Get tenant ID from context
 	tenantID, err := h.getTenantID(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
@@ -1277,7 +1240,7 @@ func (h *TemplateHandler) RestoreTemplate(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get existing template
-	template, err := h.templateRepo.GetTemplateByIDCompat(tenantID, templateID)
+	template, err := h.templateRepo.GetByID(ctx, tenantID, templateID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
 		return
@@ -1293,22 +1256,1315 @@ func (h *TemplateHandler) RestoreTemplate(w http.ResponseWriter, r *http.Request
 	template.Status = "draft"
 	template.UpdatedAt = time.Now()
 
-	if err := h.templateRepo.UpdateTemplateCompat(template); err != nil {
+	if err := h.templateRepo.UpdateTemplate(ctx, template); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to restore template: "+err.Error())
 		return
 	}
+	if h.cache != nil {
+		h.cache.InvalidateLists(ctx, tenantID)
+	}
+
+	// Record the event in the outbox for the relay to publish
+	recordEvent(ctx, h.eventOutbox, events.NewTemplateEvent(events.TypeTemplateRestored, middleware.GetUserID(r), template.TenantID, template.ID))
+
+	// Return frontend-compatible response
+	respondWithJSON(w, http.StatusOK, template)
+}
+
+// =====================================================
+// Publishing
+// =====================================================
+
+// PublishTemplate godoc
+// @Summary Publish a template
+// @Description Runs template validation and channel-specific checks (email requires a subject, WhatsApp requires metaTemplateName, required variables need a default or an example), refuses merge tags that may be left unresolved unless force=true, stamps published_at/published_by, caches the template and emits a template.published event.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param force query bool false "Publish even if merge tags are unresolved"
+// @Param require_clean_lint query bool false "Refuse to publish while the lint reports errors (links are checked)"
+// @Param request body models.PublishTemplateRequest false "Publish options"
+// @Success 200 {object} models.MongoTemplate
+// @Failure 400 {object} CodedErrorResponse "Invalid template ID or validation error"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 409 {object} ErrorResponse "Template is already published, or approval is required and the template is not approved"
+// @Failure 422 {object} ErrorResponse "Unresolved merge tags (retry with force=true), or lint errors when a clean lint is required"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/publish [post]
+// @Security BearerAuth
+func (h *TemplateHandler) PublishTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+
+	// Body is optional; force may also be given as a query parameter
+	var req models.PublishTemplateRequest
+	if r.Body != nil && r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if force, err := strconv.ParseBool(r.URL.Query().Get("force")); err == nil && force {
+		req.Force = true
+	}
+	if clean, err := strconv.ParseBool(r.URL.Query().Get("require_clean_lint")); err == nil && clean {
+		req.RequireCleanLint = true
+	}
+
+	publishedBy, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	template, ok := h.loadTemplateInScope(w, r, templateID)
+	if !ok {
+		return
+	}
+
+	if template.IsPublished() {
+		respondWithError(w, http.StatusConflict, "Template is already published")
+		return
+	}
+	if template.Status == string(models.TemplateStatusArchived) {
+		respondWithError(w, http.StatusBadRequest, "Archived templates must be restored before publishing")
+		return
+	}
+
+	required, err := h.templateApprovalRequired(ctx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load security settings: "+err.Error())
+		return
+	}
+	if required && !template.IsApproved() {
+		respondWithError(w, http.StatusConflict, "Template must be approved before it can be published")
+		return
+	}
+
+	if err := template.ValidateForPublish(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Template validation failed: "+err.Error())
+		return
+	}
 
-	// Publish Kafka event
-	if h.kafkaProducer != nil {
-		event := map[string]interface{}{
-			"event_type":  "template.restored",
-			"template_id": template.ID,
-			"tenant_id":   template.TenantID,
-			"restored_at": time.Now().Unix(),
+	if warnings := template.ValidateMergeTags(); len(warnings) > 0 && !req.Force {
+		respondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":    "Template has unresolved merge tags; retry with force=true to publish anyway",
+			"warnings": warnings,
+		})
+		return
+	}
+
+	if req.RequireCleanLint {
+		opts, err := h.lintOptions(ctx, true)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to load security settings: "+err.Error())
+			return
+		}
+		if report := h.linter.Lint(ctx, template, opts); report.Errors > 0 {
+			respondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error": fmt.Sprintf("Template has %d lint errors; fix them or publish without requireCleanLint", report.Errors),
+				"lint":  report,
+			})
+			return
 		}
-		_ = h.kafkaProducer.PublishJSON(ctx, "template.restored", event)
 	}
 
-	// Return frontend-compatible response
+	now := time.Now()
+	if err := h.templateRepo.SetPublishState(ctx, template.TenantID, template.ID, string(models.TemplateStatusPublished), &now, publishedBy); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to publish template: "+err.Error())
+		return
+	}
+	template.Status = string(models.TemplateStatusPublished)
+	template.PublishedAt = &now
+	template.PublishedBy = publishedBy
+	template.UpdatedAt = now
+
+	// Published templates are served from cache
+	if h.cache != nil {
+		h.cache.Set(ctx, template)
+		h.cache.InvalidateLists(ctx, template.TenantID)
+	}
+
+	// Record the event in the outbox for the relay to publish
+	event := events.NewTemplateEvent(events.TypeTemplatePublished, publishedBy, template.TenantID, template.ID)
+	event.Channel = template.Channel
+	event.Version = template.Version
+	event.Forced = req.Force
+	recordEvent(ctx, h.eventOutbox, event)
+
+	h.logTemplateActivity(ctx, template, publishedBy, "Template Published", "Template published: "+template.Name)
+
+	respondWithJSON(w, http.StatusOK, template)
+}
+
+// UnpublishTemplate godoc
+// @Summary Unpublish a template
+// @Description Moves a published template back to draft and evicts it from the cache. Blocked while an active sequence uses the template in one of its steps.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Success 200 {object} models.MongoTemplate
+// @Failure 400 {object} ErrorResponse "Invalid template ID or template is not published"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 409 {object} ErrorResponse "Template is used by active sequences"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/unpublish [post]
+// @Security BearerAuth
+func (h *TemplateHandler) UnpublishTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+
+	unpublishedBy, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	template, ok := h.loadTemplateInScope(w, r, templateID)
+	if !ok {
+		return
+	}
+
+	if !template.CanUnpublish() {
+		respondWithError(w, http.StatusBadRequest, "Template is not published")
+		return
+	}
+
+	// Active sequences send this template - unpublishing would break them
+	sequences, err := h.templateRepo.FindActiveSequencesUsingTemplate(ctx, template.TenantID, template.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check sequence usage: "+err.Error())
+		return
+	}
+	if len(sequences) > 0 {
+		refs := make([]map[string]string, 0, len(sequences))
+		for _, seq := range sequences {
+			refs = append(refs, map[string]string{"id": seq.TemplateID, "name": seq.Name})
+		}
+		respondWithJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Template is used by active sequences",
+			"sequences": refs,
+		})
+		return
+	}
+
+	if err := h.templateRepo.SetPublishState(ctx, template.TenantID, template.ID, string(models.TemplateStatusDraft), nil, ""); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unpublish template: "+err.Error())
+		return
+	}
+	now := time.Now()
+	template.Status = string(models.TemplateStatusDraft)
+	template.PublishedAt = nil
+	template.PublishedBy = ""
+	template.UpdatedAt = now
+
+	// Evict cache (only published templates are cached)
+	if h.cache != nil {
+		h.cache.Delete(ctx, template.TenantID, template.ID)
+	}
+
+	// Record the event in the outbox for the relay to publish
+	recordEvent(ctx, h.eventOutbox, events.NewTemplateEvent(events.TypeTemplateUnpublished, unpublishedBy, template.TenantID, template.ID))
+
+	h.logTemplateActivity(ctx, template, unpublishedBy, "Template Unpublished", "Template unpublished: "+template.Name)
+
 	respondWithJSON(w, http.StatusOK, template)
 }
+
+// =====================================================
+// Bulk Operations
+// =====================================================
+
+// BulkTemplates godoc
+// @Summary Apply one action to many templates
+// @Description Moves to the trash, tags, untags or changes the status of up to 200 templates in one request. Every ID is checked for tenant ownership and data scope first; system templates are skipped for destructive actions and published templates used by active sequences are not moved off published. Returns a per-ID result (ok, skipped or error with a reason). Publishing is not available in bulk - use the publish endpoint.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param request body models.BulkTemplateRequest true "IDs, action (delete, add_tags, remove_tags, set_status) and its arguments"
+// @Success 200 {object} models.BulkTemplateResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid action, arguments or more than 200 IDs"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 500 {object} models.BulkTemplateResponse "Bulk update failed"
+// @Router /templates/bulk [post]
+// @Security BearerAuth
+func (h *TemplateHandler) BulkTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req models.BulkTemplateRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return
+	}
+
+	// Validate the action and its arguments
+	switch req.Action {
+	case models.BulkTemplateActionDelete:
+		if !h.perms.HasPermission(r, models.PermTemplatesDelete) {
+			respondWithError(w, http.StatusForbidden, "Missing required permission: "+models.PermTemplatesDelete)
+			return
+		}
+	case models.BulkTemplateActionAddTags, models.BulkTemplateActionRemoveTags:
+		req.Tags = models.NormalizeTags(req.Tags)
+		if len(req.Tags) == 0 {
+			respondWithError(w, http.StatusBadRequest, "tags is required for "+req.Action)
+			return
+		}
+		for _, tag := range req.Tags {
+			if len([]rune(tag)) > maxTagLength {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Tag name must be at most %d characters", maxTagLength))
+				return
+			}
+		}
+	case models.BulkTemplateActionSetStatus:
+		if !models.IsValidTemplateStatus(req.Status) {
+			respondWithError(w, http.StatusBadRequest, "Invalid status: "+req.Status)
+			return
+		}
+		if req.Status == string(models.TemplateStatusPublished) || req.Status == string(models.TemplateStatusActive) {
+			respondWithError(w, http.StatusBadRequest, "Use POST /api/v1/templates/{id}/publish to publish a template")
+			return
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid action: must be delete, add_tags, remove_tags or set_status")
+		return
+	}
+
+	dataScope, claims, err := h.getCampaignScope(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if _, denyAll := services.BuildScopeFilter("campaigns", dataScope, claims); denyAll {
+		respondWithError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+
+	// De-duplicate while keeping request order for the results
+	ids := make([]string, 0, len(req.IDs))
+	results := make(map[string]*models.BulkTemplateResult, len(req.IDs))
+	var lookupIDs []string
+	for _, id := range req.IDs {
+		if _, seen := results[id]; seen {
+			continue
+		}
+		ids = append(ids, id)
+		results[id] = &models.BulkTemplateResult{ID: id}
+		lookupID, err := uuid.ParseUUID(id)
+		if err != nil {
+			results[id].Result, results[id].Reason = models.BulkResultError, "invalid template ID format"
+			continue
+		}
+		lookupIDs = append(lookupIDs, lookupID)
+	}
+
+	found, err := h.templateRepo.GetByIDs(ctx, tenantID, lookupIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load templates: "+err.Error())
+		return
+	}
+	byID := make(map[string]*models.MongoTemplate, len(found))
+	for _, t := range found {
+		byID[t.ID] = t
+	}
+
+	// Decide per template before touching anything
+	var eligible []string
+	for _, id := range lookupIDs {
+		result := results[id]
+		template := byID[id]
+		switch {
+		case template == nil:
+			result.Result, result.Reason = models.BulkResultError, "template not found"
+		case !services.IsInScope("campaigns", dataScope, claims, template):
+			result.Result, result.Reason = models.BulkResultError, "permission denied"
+		default:
+			if reason := h.bulkSkipReason(ctx, template, req); reason != "" {
+				result.Result, result.Reason = models.BulkResultSkipped, reason
+				continue
+			}
+			eligible = append(eligible, id)
+		}
+	}
+
+	// Apply the action to every eligible template in one round trip
+	var applyErr error
+	if len(eligible) > 0 {
+		switch req.Action {
+		case models.BulkTemplateActionDelete:
+			_, applyErr = h.templateRepo.SoftDeleteMany(ctx, tenantID, eligible, userID)
+		case models.BulkTemplateActionAddTags:
+			_, applyErr = h.templateRepo.AddTagsMany(ctx, tenantID, eligible, req.Tags)
+		case models.BulkTemplateActionRemoveTags:
+			_, applyErr = h.templateRepo.RemoveTagsMany(ctx, tenantID, eligible, req.Tags)
+		case models.BulkTemplateActionSetStatus:
+			_, applyErr = h.templateRepo.SetStatusMany(ctx, tenantID, eligible, req.Status)
+		}
+	}
+	for _, id := range eligible {
+		if applyErr != nil {
+			results[id].Result, results[id].Reason = models.BulkResultError, applyErr.Error()
+			continue
+		}
+		results[id].Result = models.BulkResultOK
+	}
+	if h.cache != nil && applyErr == nil && len(eligible) > 0 {
+		h.cache.Delete(ctx, tenantID, eligible...)
+	}
+
+	resp := models.BulkTemplateResponse{Action: req.Action, Results: make([]models.BulkTemplateResult, 0, len(ids))}
+	for _, id := range ids {
+		result := results[id]
+		switch result.Result {
+		case models.BulkResultOK:
+			resp.Succeeded++
+		case models.BulkResultSkipped:
+			resp.Skipped++
+		default:
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, *result)
+	}
+
+	if applyErr != nil {
+		respondWithJSON(w, http.StatusInternalServerError, resp)
+		return
+	}
+
+	if resp.Succeeded > 0 {
+		recordEvent(ctx, h.eventOutbox, events.TemplatesBulkUpdated{
+			Envelope:    events.NewEnvelope(events.TypeTemplatesBulkUpdated, userID, tenantID),
+			Action:      req.Action,
+			TemplateIDs: eligible,
+			Tags:        req.Tags,
+			Status:      req.Status,
+			Succeeded:   resp.Succeeded,
+			Skipped:     resp.Skipped,
+			Failed:      resp.Failed,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// bulkSkipReason returns why a bulk action should leave template untouched, or ""
+func (h *TemplateHandler) bulkSkipReason(ctx context.Context, template *models.MongoTemplate, req models.BulkTemplateRequest) string {
+	switch req.Action {
+	case models.BulkTemplateActionDelete:
+		if !template.CanDelete() {
+			return "system templates cannot be deleted"
+		}
+	case models.BulkTemplateActionSetStatus:
+		if template.Status == req.Status {
+			return "template is already " + req.Status
+		}
+		if template.IsSystem && req.Status == string(models.TemplateStatusArchived) {
+			return "system templates cannot be archived"
+		}
+		if template.IsPublished() {
+			// Same guard as UnpublishTemplate
+			sequences, err := h.templateRepo.FindActiveSequencesUsingTemplate(ctx, template.TenantID, template.ID)
+			if err != nil {
+				return "could not check sequences using the template"
+			}
+			if len(sequences) > 0 {
+				return fmt.Sprintf("template is used by %d active sequence(s)", len(sequences))
+			}
+		}
+	}
+	return ""
+}
+
+// =====================================================
+// Import / Export
+// =====================================================
+
+// Import/export limits
+const (
+	maxExportTemplates = 1000
+	maxImportTemplates = 500
+	maxImportBytes     = 10 << 20 // 10 MB
+)
+
+// ExportTemplates godoc
+// @Summary Export templates as JSON
+// @Description Produces a schema-versioned JSON document with the full definitions of the selected templates, without tenant, creator or environment-specific identifiers. Select templates with ids (comma-separated or repeated) and/or channel; with neither, every template in scope is exported (up to 1000).
+// @Tags Templates
+// @Produce json
+// @Param ids query string false "Template IDs (comma-separated)"
+// @Param channel query string false "Filter by channel (email, sms, whatsapp, linkedin)"
+// @Success 200 {object} models.TemplateExportDocument
+// @Failure 400 {object} ErrorResponse "Invalid IDs or channel, or too many templates"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/export [get]
+// @Security BearerAuth
+func (h *TemplateHandler) ExportTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return
+	}
+
+	dataScope, claims, err := h.getCampaignScope(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	scopeCreatedBy, denyAll := services.CreatedByScope("campaigns", dataScope, claims)
+	if denyAll {
+		respondWithError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+
+	channel := r.URL.Query().Get("channel")
+	if channel != "" && !models.IsValidChannel(channel) {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel: must be email, sms, whatsapp, or linkedin")
+		return
+	}
+
+	var templates []*models.MongoTemplate
+	if ids := splitQueryList(r.URL.Query()["ids"]); len(ids) > 0 {
+		if len(ids) > maxExportTemplates {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("At most %d templates can be exported at once", maxExportTemplates))
+			return
+		}
+		for i, id := range ids {
+			parsed, err := uuid.ParseUUID(id)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid template ID format: "+id)
+				return
+			}
+			ids[i] = parsed
+		}
+		found, err := h.templateRepo.GetByIDs(ctx, tenantID, ids)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to export templates: "+err.Error())
+			return
+		}
+		for _, t := range found {
+			if (channel == "" || t.Channel == channel) && services.IsInScope("campaigns", dataScope, claims, t) {
+				templates = append(templates, t)
+			}
+		}
+	} else {
+		filters := repositories.TemplateFilters{
+			TenantID:       tenantID,
+			Channel:        channel,
+			ScopeCreatedBy: scopeCreatedBy,
+			SortBy:         "name",
+			SortOrder:      "asc",
+			Limit:          100,
+		}
+		for filters.Page = 1; ; filters.Page++ {
+			page, total, err := h.templateRepo.ListTemplatesPage(ctx, filters)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to export templates: "+err.Error())
+				return
+			}
+			if total > maxExportTemplates {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%d templates match; narrow the export with ids or channel (max %d)", total, maxExportTemplates))
+				return
+			}
+			templates = append(templates, page...)
+			if len(page) < filters.Limit || int64(len(templates)) >= total {
+				break
+			}
+		}
+	}
+
+	// Stable order keeps exports diffable
+	sort.SliceStable(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+
+	now := time.Now().UTC()
+	doc := models.TemplateExportDocument{
+		SchemaVersion: models.TemplateExportSchemaVersion,
+		ExportedAt:    now,
+		Templates:     make([]models.TemplateExportItem, 0, len(templates)),
+	}
+	for _, t := range templates {
+		doc.Templates = append(doc.Templates, models.NewTemplateExportItem(t))
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="templates-%s.json"`, now.Format("20060102-150405")))
+	respondWithJSON(w, http.StatusOK, doc)
+}
+
+// ImportTemplates godoc
+// @Summary Import templates from JSON
+// @Description Imports a document produced by the export endpoint. Templates are matched on name within the tenant and conflicts are resolved with the conflict strategy: skip (default), overwrite (replace the existing definition in place) or duplicate (import under a "(copy)" name). Every template is re-validated, gets its merge tags re-extracted, a fresh ID and the importer as creator, and is never imported as a system template.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param conflict query string false "Conflict strategy: skip, overwrite or duplicate (default: skip)"
+// @Param request body models.TemplateExportDocument true "Export document"
+// @Success 200 {object} models.TemplateImportResponse
+// @Failure 400 {object} ErrorResponse "Invalid document, schema version or conflict strategy"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/import [post]
+// @Security BearerAuth
+func (h *TemplateHandler) ImportTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	conflict := r.URL.Query().Get("conflict")
+	if conflict == "" {
+		conflict = models.ImportConflictSkip
+	}
+	switch conflict {
+	case models.ImportConflictSkip, models.ImportConflictOverwrite, models.ImportConflictDuplicate:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid conflict strategy: must be skip, overwrite or duplicate")
+		return
+	}
+
+	var doc models.TemplateExportDocument
+	if !decodeJSONLimit(w, r, &doc, maxImportBytes) {
+		return
+	}
+	if doc.SchemaVersion != models.TemplateExportSchemaVersion {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported schemaVersion %d (expected %d)", doc.SchemaVersion, models.TemplateExportSchemaVersion))
+		return
+	}
+	if len(doc.Templates) == 0 {
+		respondWithError(w, http.StatusBadRequest, "The import document contains no templates")
+		return
+	}
+	if len(doc.Templates) > maxImportTemplates {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("At most %d templates can be imported at once", maxImportTemplates))
+		return
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return
+	}
+	dataScope, claims, err := h.getCampaignScope(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if _, denyAll := services.BuildScopeFilter("campaigns", dataScope, claims); denyAll {
+		respondWithError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+	approvalRequired, err := h.templateApprovalRequired(ctx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load security settings: "+err.Error())
+		return
+	}
+
+	// Existing templates by name, for conflict detection
+	names := make([]string, 0, len(doc.Templates))
+	for i := range doc.Templates {
+		doc.Templates[i].Name = strings.TrimSpace(doc.Templates[i].Name)
+		names = append(names, doc.Templates[i].Name)
+	}
+	existing, err := h.templateRepo.GetByNames(ctx, tenantID, names)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check existing templates: "+err.Error())
+		return
+	}
+	byName := make(map[string]*models.MongoTemplate, len(existing))
+	for _, t := range existing {
+		if _, seen := byName[t.Name]; !seen {
+			byName[t.Name] = t
+		}
+	}
+
+	resp := models.TemplateImportResponse{Conflict: conflict, Results: make([]models.TemplateImportResult, 0, len(doc.Templates))}
+	var importedIDs []string
+	for i := range doc.Templates {
+		result := h.importTemplate(ctx, &doc.Templates[i], conflict, tenantID, userID, byName, dataScope, claims, approvalRequired)
+		result.Index = i
+
+		switch result.Result {
+		case models.ImportResultCreated:
+			resp.Created++
+			importedIDs = append(importedIDs, result.ID)
+		case models.ImportResultOverwritten:
+			resp.Overwritten++
+			importedIDs = append(importedIDs, result.ID)
+		case models.ImportResultSkipped:
+			resp.Skipped++
+		default:
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	// Overwritten templates may be cached and every import changes the listings
+	if h.cache != nil && len(importedIDs) > 0 {
+		h.cache.Delete(ctx, tenantID, importedIDs...)
+	}
+
+	if len(importedIDs) > 0 {
+		recordEvent(ctx, h.eventOutbox, events.TemplatesImported{
+			Envelope:    events.NewEnvelope(events.TypeTemplatesImported, userID, tenantID),
+			Conflict:    conflict,
+			TemplateIDs: importedIDs,
+			Created:     resp.Created,
+			Overwritten: resp.Overwritten,
+			Skipped:     resp.Skipped,
+			Failed:      resp.Failed,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// importTemplate imports one export item, resolving name conflicts with the given
+// strategy. byName is updated so later items in the same document see this one.
+// When approvalRequired, an import cannot publish a template; overwriting one
+// withdraws it from review like an edit does.
+func (h *TemplateHandler) importTemplate(ctx context.Context, item *models.TemplateExportItem, conflict, tenantID, userID string, byName map[string]*models.MongoTemplate, dataScope models.DataScope, claims services.ScopeClaims, approvalRequired bool) models.TemplateImportResult {
+	result := models.TemplateImportResult{Name: item.Name, Result: models.ImportResultError}
+	if item.Name == "" {
+		result.Reason = "name is required"
+		return result
+	}
+	if !models.IsValidChannel(item.Channel) {
+		result.Reason = "invalid channel: " + item.Channel
+		return result
+	}
+	if item.Status != "" && !models.IsValidTemplateStatus(item.Status) {
+		result.Reason = "invalid status: " + item.Status
+		return result
+	}
+
+	now := time.Now()
+	template := &models.MongoTemplate{
+		ID:        uuid.MustNewUUID(),
+		TenantID:  tenantID,
+		Version:   1,
+		CreatedBy: userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	overwrite := false
+
+	if current := byName[item.Name]; current != nil {
+		switch conflict {
+		case models.ImportConflictSkip:
+			result.Result, result.ID, result.Reason = models.ImportResultSkipped, current.ID, "a template with this name already exists"
+			return result
+		case models.ImportConflictOverwrite:
+			if !services.IsInScope("campaigns", dataScope, claims, current) {
+				result.Reason = "permission denied for the existing template"
+				return result
+			}
+			if current.IsSystem {
+				result.Result, result.ID, result.Reason = models.ImportResultSkipped, current.ID, "system templates cannot be overwritten"
+				return result
+			}
+			template, overwrite = current, true
+			template.Version++
+		case models.ImportConflictDuplicate:
+			name, err := h.uniqueDuplicateName(ctx, tenantID, item.Name, "")
+			if err != nil {
+				result.Reason = "failed to pick a free name: " + err.Error()
+				return result
+			}
+			item.Name, result.Name = name, name
+		}
+	}
+
+	wasPublished := template.IsPublished()
+	item.ApplyTo(template)
+
+	validate := template.Validate
+	if template.IsPublished() {
+		validate = template.ValidateForPublish
+	}
+	if err := validate(); err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	if approvalRequired && template.IsPublished() && !wasPublished {
+		result.Reason = "templates must be approved before they are published; import as draft and submit for approval"
+		return result
+	}
+	if overwrite && template.ApprovalResetOnEdit() {
+		template.ApprovalStatus = ""
+		template.Approvals = append(template.Approvals, models.TemplateApproval{Action: models.TemplateApprovalReset, ActorID: userID, At: now})
+	}
+	if !template.IsPublished() {
+		template.PublishedAt, template.PublishedBy = nil, ""
+	} else if !wasPublished {
+		template.PublishedAt, template.PublishedBy = &now, userID
+	}
+
+	if overwrite {
+		if err := h.templateRepo.Replace(ctx, template); err != nil {
+			result.Reason = "failed to overwrite template: " + err.Error()
+			return result
+		}
+		result.Result = models.ImportResultOverwritten
+	} else {
+		if err := h.templateRepo.Create(ctx, template); err != nil {
+			result.Reason = "failed to create template: " + err.Error()
+			return result
+		}
+		result.Result = models.ImportResultCreated
+	}
+
+	result.ID = template.ID
+	byName[template.Name] = template
+	return result
+}
+
+// =====================================================
+// Tags
+// =====================================================
+
+// maxTagLength is the longest accepted tag name
+const maxTagLength = 50
+
+// ListTemplateTags godoc
+// @Summary List template tags
+// @Description Returns every tag used by the tenant's templates with the number of templates carrying it, most used first. Counts are computed from the templates themselves, so they always agree with tag-filtered listings.
+// @Tags Templates
+// @Produce json
+// @Success 200 {object} TemplateTagsResponse "tags: [{name, count}]"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/tags [get]
+// @Security BearerAuth
+func (h *TemplateHandler) ListTemplateTags(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return
+	}
+
+	tags, err := h.templateRepo.ListTagCounts(r.Context(), tenantID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve tags: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, TemplateTagsResponse{Tags: tags, Total: len(tags)})
+}
+
+// RenameTemplateTag godoc
+// @Summary Rename a template tag
+// @Description Renames a tag on every template in the tenant. Templates that already carry the new name keep a single copy of it.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param name path string true "Current tag name"
+// @Param request body models.RenameTemplateTagRequest true "New tag name"
+// @Success 200 {object} TemplateTagRenamed "Renamed tag and affected template count"
+// @Failure 400 {object} CodedErrorResponse "Invalid tag name"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Tag not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/tags/{name} [put]
+// @Security BearerAuth
+func (h *TemplateHandler) RenameTemplateTag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	oldName := strings.TrimSpace(mux.Vars(r)["name"])
+
+	var req models.RenameTemplateTagRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	newName := strings.TrimSpace(req.Name)
+	if oldName == "" || newName == "" {
+		respondWithError(w, http.StatusBadRequest, "Tag name is required")
+		return
+	}
+	if len([]rune(newName)) > maxTagLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Tag name must be at most %d characters", maxTagLength))
+		return
+	}
+
+	userID, ok := ctx.Value(middleware.UserIDKey).(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return
+	}
+
+	if newName == oldName {
+		respondWithJSON(w, http.StatusOK, TemplateTagRenamed{Name: newName})
+		return
+	}
+
+	updatedIDs, err := h.templateRepo.RenameTag(ctx, tenantID, oldName, newName)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to rename tag: "+err.Error())
+		return
+	}
+	if len(updatedIDs) == 0 {
+		respondWithError(w, http.StatusNotFound, "Tag not found")
+		return
+	}
+
+	// Cached templates still carry the old tag
+	if h.cache != nil {
+		h.cache.Delete(ctx, tenantID, updatedIDs...)
+	}
+
+	recordEvent(ctx, h.eventOutbox, events.TemplateTagRenamed{
+		Envelope:    events.NewEnvelope(events.TypeTemplateTagRenamed, userID, tenantID),
+		OldName:     oldName,
+		NewName:     newName,
+		TemplateIDs: updatedIDs,
+	})
+
+	respondWithJSON(w, http.StatusOK, TemplateTagRenamed{Name: newName, Updated: len(updatedIDs)})
+}
+
+// =====================================================
+// Preview
+// =====================================================
+
+// PreviewTemplate godoc
+// @Summary Preview a template
+// @Description Renders a saved template with the supplied merge tag values. Values injected into email HTML are escaped unless marked raw. Variables of the template's schema with no value supplied take their default; required ones without either are refused with MISSING_REQUIRED_VARIABLES, and values that do not fit their variable's type are reported as warnings. Reports tags with no value, supplied keys that matched no tag, and character/segment counts for SMS and WhatsApp.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param request body models.TemplatePreviewRequest true "Variable values and optional channel override"
+// @Success 200 {object} models.TemplatePreviewResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid template ID, payload, merge tag or channel, or MISSING_REQUIRED_VARIABLES"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Router /templates/{id}/preview [post]
+// @Security BearerAuth
+func (h *TemplateHandler) PreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+
+	var req models.TemplatePreviewRequest
+	if r.Body != nil && r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	template, ok := h.loadTemplateInScope(w, r, templateID)
+	if !ok {
+		return
+	}
+
+	h.respondWithPreview(w, template, req.Channel, req.Variables)
+}
+
+// PreviewDraftTemplate godoc
+// @Summary Preview an unsaved template
+// @Description Renders a template body that has not been saved yet, so the editor can live-preview drafts. Accepts the same template fields as create.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param request body models.DraftTemplatePreviewRequest true "Draft template, variable values and optional channel override"
+// @Success 200 {object} models.TemplatePreviewResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid payload, merge tag or channel"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Router /templates/preview [post]
+// @Security BearerAuth
+func (h *TemplateHandler) PreviewDraftTemplate(w http.ResponseWriter, r *http.Request) {
+	var req models.DraftTemplatePreviewRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	channel := req.Channel
+	if channel == "" {
+		channel = req.Template.Channel
+	}
+	if channel == "" {
+		respondWithError(w, http.StatusBadRequest, "channel is required")
+		return
+	}
+
+	h.respondWithPreview(w, draftTemplate(req.Template, channel), channel, req.Variables)
+}
+
+// draftTemplate builds an unsaved template from a create request, merging
+// the convenience fields into content the same way CreateTemplate does
+func draftTemplate(req models.CreateTemplateRequest, channel string) *models.MongoTemplate {
+	content := make(map[string]string, len(req.Content)+2)
+	for k, v := range req.Content {
+		content[k] = v
+	}
+	if req.Subject != "" {
+		content["subject"] = req.Subject
+	}
+	if req.Message != "" {
+		if channel == string(models.TemplateChannelEmail) {
+			if _, exists := content["body_html"]; !exists {
+				content["body_html"] = req.Message
+			}
+		} else {
+			content["body"] = req.Message
+		}
+	}
+
+	return &models.MongoTemplate{
+		Name:         req.Name,
+		Channel:      channel,
+		Content:      content,
+		Subject:      req.Subject,
+		Body:         req.Message,
+		CustomFields: req.CustomFields,
+	}
+}
+
+// GetTemplateStats godoc
+// @Summary Get template usage statistics
+// @Description Returns how often a template was sent and failed, all time and per day over the last days (default 30, max 365), and when it was last used. Test sends are not counted.
+// @Tags Templates
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param days query int false "Window in days (default 30, max 365)"
+// @Success 200 {object} models.TemplateStats
+// @Failure 400 {object} ErrorResponse "Invalid template ID or days"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/stats [get]
+// @Security BearerAuth
+func (h *TemplateHandler) GetTemplateStats(w http.ResponseWriter, r *http.Request) {
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+
+	days := models.TemplateStatsWindowDays
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d < 1 || d > 365 {
+			respondWithError(w, http.StatusBadRequest, "Invalid days: must be between 1 and 365")
+			return
+		}
+		days = d
+	}
+
+	template, ok := h.loadTemplateInScope(w, r, templateID)
+	if !ok {
+		return
+	}
+
+	stats, err := h.templateRepo.GetUsageStats(r.Context(), template.TenantID, template.ID, days)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve template stats: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+// SendTestTemplate godoc
+// @Summary Send a test email for a template
+// @Description Renders an email template exactly as the preview endpoint does and sends it to up to 5 addresses with a [TEST] subject prefix. The message is stored as a test communication. Limited to 10 test sends per user per hour. deliveryStatus is "sent" only when SMTP accepted the message; "not_configured" means SMTP is not set up and nothing was delivered.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param request body models.SendTestTemplateRequest true "Recipients and variable values"
+// @Success 200 {object} models.SendTestTemplateResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid request, recipients or merge tag; MISSING_REQUIRED_VARIABLES; UNSUPPORTED_CHANNEL for non-email templates"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 429 {object} ErrorResponse "Test send limit reached"
+// @Failure 502 {object} models.SendTestTemplateResponse "SMTP rejected the message"
+// @Router /templates/{id}/send-test [post]
+// @Security BearerAuth
+func (h *TemplateHandler) SendTestTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+
+	var req models.SendTestTemplateRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	recipients, err := normalizeTestRecipients(req.To)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "INVALID_RECIPIENTS", err.Error())
+		return
+	}
+
+	template, ok := h.loadTemplateInScope(w, r, templateID)
+	if !ok {
+		return
+	}
+	if template.Channel != string(models.TemplateChannelEmail) {
+		respondWithErrorCode(w, http.StatusBadRequest, "UNSUPPORTED_CHANNEL", "Test sends are only available for email templates")
+		return
+	}
+
+	vars, missing, warnings := template.ResolveVariables(req.Variables)
+	if len(missing) > 0 {
+		respondWithMissingVariables(w, missing)
+		return
+	}
+	preview, err := services.RenderTemplatePreview(template, "", vars)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMergeTag) {
+			respondWithErrorCode(w, http.StatusBadRequest, "INVALID_MERGE_TAG", err.Error())
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to render template")
+		return
+	}
+
+	// Only count requests that would actually send
+	if allowed, retryAfter := h.rateLimiter.Allow(userID); !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		respondWithErrorCode(w, http.StatusTooManyRequests, "RATE_LIMITED",
+			fmt.Sprintf("Test send limit reached (%d per hour)", testSendsPerWindow))
+		return
+	}
+
+	now := time.Now()
+	msg := &models.CommMessage{
+		MessageID:   uuid.MustNewUUID(),
+		Channel:     models.ChannelEmail,
+		Direction:   models.DirectionOutbound,
+		Status:      models.MessageStatusQueued,
+		FromName:    "White Platform",
+		ToAddresses: recipients,
+		Subject:     testSubjectPrefix + preview.Subject,
+		BodyHTML:    preview.Body,
+		BodyText:    preview.BodyText,
+		EntityType:  "template",
+		EntityID:    template.ID,
+		UserID:      userID,
+		TenantID:    template.TenantID,
+		TemplateID:  template.ID,
+		Priority:    models.PriorityNormal,
+		IsTest:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	msg.TrackEngagement = emailTrackingEnabled(r.Context(), h.settingsRepo, userID)
+	msg.FromAddress = h.emailSender.FromAddress()
+
+	if h.emailRepo != nil {
+		if err := h.emailRepo.CreateCommMessage(r.Context(), msg); err != nil {
+			log.Printf("Warning: failed to store test email for template %s: %v", template.ID, err)
+		}
+	}
+
+	resp := models.SendTestTemplateResponse{
+		MessageID:       msg.MessageID,
+		To:              recipients,
+		Subject:         msg.Subject,
+		MissingTags:     preview.MissingTags,
+		UnusedVariables: preview.UnusedVariables,
+		Warnings:        warnings,
+	}
+
+	status := http.StatusOK
+	if !h.emailSender.Capabilities().Delivers {
+		// Nothing was delivered - say so rather than reporting success
+		resp.DeliveryStatus = models.TestSendDeliveryNotConfigured
+		_ = h.emailSender.SendEmail(r.Context(), msg)
+	} else if err := deliverEmail(r.Context(), h.emailSender, h.emailRepo, msg); err != nil {
+		resp.DeliveryStatus = models.TestSendDeliveryFailed
+		resp.Error = err.Error()
+		status = http.StatusBadGateway
+		if errors.Is(err, email.ErrSendQuotaExceeded) {
+			status = http.StatusTooManyRequests
+		}
+		log.Printf("EMAIL ERROR: failed to send test email for template %s via %s: %v", template.ID, h.emailSender.Name(), err)
+	} else {
+		resp.DeliveryStatus = models.TestSendDeliverySent
+		resp.Delivered = true
+	}
+
+	if h.emailRepo != nil && resp.DeliveryStatus != models.TestSendDeliveryNotConfigured {
+		msgStatus := models.MessageStatusSent
+		if !resp.Delivered {
+			msgStatus = models.MessageStatusFailed
+		}
+		_ = h.emailRepo.UpdateMessageStatus(r.Context(), msg.MessageID, msgStatus)
+	}
+
+	h.logTemplateActivity(r.Context(), template, userID, "Template Test Sent", "Test email sent for template: "+template.Name)
+
+	respondWithJSON(w, status, resp)
+}
+
+// normalizeTestRecipients trims, validates and de-duplicates test send addresses
+func normalizeTestRecipients(to []string) ([]string, error) {
+	seen := make(map[string]bool, len(to))
+	recipients := make([]string, 0, len(to))
+	for _, raw := range to {
+		addr, err := mail.ParseAddress(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address: %q", raw)
+		}
+		key := strings.ToLower(addr.Address)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		recipients = append(recipients, addr.Address)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	if len(recipients) > maxTestRecipients {
+		return nil, fmt.Errorf("at most %d recipients are allowed", maxTestRecipients)
+	}
+	return recipients, nil
+}
+
+// respondWithPreview renders the template with the values checked against
+// its variables schema, and maps renderer errors to 400s
+func (h *TemplateHandler) respondWithPreview(w http.ResponseWriter, template *models.MongoTemplate, channel string, vars map[string]models.PreviewVariable) {
+	vars, missing, warnings := template.ResolveVariables(vars)
+	if len(missing) > 0 {
+		respondWithMissingVariables(w, missing)
+		return
+	}
+	preview, err := services.RenderTemplatePreview(template, channel, vars)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnsupportedPreviewChannel):
+			respondWithError(w, http.StatusBadRequest, "Invalid channel: must be email, sms, whatsapp or linkedin")
+		case errors.Is(err, services.ErrInvalidMergeTag):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to render template")
+		}
+		return
+	}
+
+	preview.Warnings = warnings
+	respondWithJSON(w, http.StatusOK, preview)
+}
+
+// respondWithMissingVariables answers a render without values for required
+// variables with 400 MISSING_REQUIRED_VARIABLES naming them
+func respondWithMissingVariables(w http.ResponseWriter, missing []string) {
+	respondWithErrorCode(w, http.StatusBadRequest, "MISSING_REQUIRED_VARIABLES", "Missing required variables: "+strings.Join(missing, ", "))
+}
+
+// loadTemplateInScope fetches a template and enforces the campaigns data scope.
+// It writes the error response and returns false when the template cannot be used.
+func (h *TemplateHandler) loadTemplateInScope(w http.ResponseWriter, r *http.Request, templateID string) (*models.MongoTemplate, bool) {
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return nil, false
+	}
+
+	template, err := h.templateRepo.GetByID(r.Context(), tenantID, templateID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
+		return nil, false
+	}
+
+	return template, h.templateInScope(w, r, template)
+}
+
+// loadAnyStateTemplateInScope is loadTemplateInScope for endpoints that also
+// operate on templates in the trash
+func (h *TemplateHandler) loadAnyStateTemplateInScope(w http.ResponseWriter, r *http.Request, templateID string) (*models.MongoTemplate, bool) {
+	tenantID, err := h.getTenantID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid tenant ID")
+		return nil, false
+	}
+
+	template, err := h.templateRepo.GetByIDAnyState(r.Context(), tenantID, templateID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Template not found: "+err.Error())
+		return nil, false
+	}
+
+	return template, h.templateInScope(w, r, template)
+}
+
+// templateInScope enforces the caller's RBAC data scope on a template (campaigns
+// scope applies to templates), writing the error response when it is out of
+// scope. Out of scope templates are not found rather than forbidden, so their
+// existence is not revealed.
+func (h *TemplateHandler) templateInScope(w http.ResponseWriter, r *http.Request, template *models.MongoTemplate) bool {
+	dataScope, claims, err := h.getCampaignScope(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, denyAll := services.BuildScopeFilter("campaigns", dataScope, claims); denyAll || !services.IsInScope("campaigns", dataScope, claims, template) {
+		respondWithHiddenNotFound(w, "Template not found")
+		return false
+	}
+	return true
+}
+
+// logTemplateActivity records a completed activity for a template operation
+func (h *TemplateHandler) logTemplateActivity(ctx context.Context, template *models.MongoTemplate, userID, title, description string) {
+	now := time.Now()
+	activity := &models.Activity{
+		ID:            uuid.MustNewUUID(),
+		ActivityType:  "note",
+		Title:         title,
+		Description:   description,
+		Owner:         userID,
+		RelatedToType: "template",
+		RelatedToID:   template.ID,
+		Status:        "completed",
+		Priority:      "medium",
+		CreatedBy:     userID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	_ = h.activityRepo.CreateActivity(ctx, activity)
+}
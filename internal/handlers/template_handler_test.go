@@ -0,0 +1,1008 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// templateFixture is a TemplateHandler over in-memory stores, without a
+// cache, routed as RegisterRoutes routes it
+type templateFixture struct {
+	*testServer
+	users      *memory.UserStore
+	templates  *memory.TemplateStore
+	activities *memory.ActivityStore
+	settings   *memory.SettingsStore
+	outbox     *memory.EventOutbox
+	handler    *TemplateHandler
+}
+
+func newTemplateFixture(t testing.TB) *templateFixture {
+	t.Helper()
+	f := &templateFixture{
+		testServer: newTestServer(t),
+		users:      memory.NewUserStore(),
+		templates:  memory.NewTemplateStore(),
+		activities: memory.NewActivityStore(),
+		outbox:     memory.NewEventOutbox(),
+	}
+	f.settings = memory.NewSettingsStore(f.users)
+	f.handler = NewTemplateHandler(f.templates, f.activities, f.outbox, f.users, nil, memory.NewEmailStore(), f.settings, nil, middleware.NewPermissionEnforcer(nil))
+	f.handle(http.MethodGet, "/api/v1/templates", f.handler.ListTemplates)
+	f.handle(http.MethodPost, "/api/v1/templates", f.handler.CreateTemplate)
+	f.handle(http.MethodGet, "/api/v1/templates/tags", f.handler.ListTemplateTags)
+	f.handle(http.MethodPut, "/api/v1/templates/tags/{name}", f.handler.RenameTemplateTag)
+	f.handle(http.MethodGet, "/api/v1/templates/export", f.handler.ExportTemplates)
+	f.handle(http.MethodPost, "/api/v1/templates/import", f.handler.ImportTemplates)
+	f.handle(http.MethodGet, "/api/v1/templates/{id}", f.handler.GetTemplate)
+	f.handle(http.MethodPut, "/api/v1/templates/{id}", f.handler.UpdateTemplate)
+	f.handle(http.MethodDelete, "/api/v1/templates/{id}", f.handler.DeleteTemplate)
+	f.handle(http.MethodPost, "/api/v1/templates/{id}/publish", f.handler.PublishTemplate)
+	f.handle(http.MethodPost, "/api/v1/templates/{id}/unpublish", f.handler.UnpublishTemplate)
+	f.handle(http.MethodPost, "/api/v1/templates/{id}/convert", f.handler.ConvertTemplate)
+	f.handle(http.MethodPost, "/api/v1/templates/{id}/submit-for-approval", f.handler.SubmitTemplateForApproval)
+	f.handle(http.MethodPost, "/api/v1/templates/{id}/approve", f.handler.ApproveTemplate)
+	return f
+}
+
+// createTemplate creates an email template named name as user
+func (f *templateFixture) createTemplate(user *models.User, name string) *models.MongoTemplate {
+	f.t.Helper()
+	rec := f.do(user, http.MethodPost, "/api/v1/templates", models.CreateTemplateRequest{
+		Name:    name,
+		Channel: "email",
+		Subject: "Hello {{first_name}}",
+		Message: "<p>Welcome aboard, {{first_name}}</p>",
+	})
+	if rec.Code != http.StatusCreated {
+		f.t.Fatalf("create %q = %d %s", name, rec.Code, rec.Body)
+	}
+	var template models.MongoTemplate
+	decodeBody(f.t, rec, &template)
+	return &template
+}
+
+// listTemplates returns the IDs of the templates user lists
+func (f *templateFixture) listTemplates(ctx context.Context, user *models.User) map[string]string {
+	f.t.Helper()
+	rec := f.doContext(ctx, user, http.MethodGet, "/api/v1/templates", nil)
+	if rec.Code != http.StatusOK {
+		f.t.Fatalf("list = %d %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Templates []models.MongoTemplate `json:"templates"`
+	}
+	decodeBody(f.t, rec, &body)
+	names := make(map[string]string, len(body.Templates))
+	for _, template := range body.Templates {
+		names[template.ID] = template.Name
+	}
+	return names
+}
+
+// TestTemplatesAreIsolatedBetweenTenants creates templates of the same name
+// in two tenants and checks neither tenant can list, read, update or delete
+// the other's, which answers as a template that does not exist
+func TestTemplatesAreIsolatedBetweenTenants(t *testing.T) {
+	f := newTemplateFixture(t)
+	acme := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	globex := f.users.Add(&models.User{Email: "admin@globex.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "globex"})
+
+	acmeTemplate := f.createTemplate(acme, "Welcome")
+	globexTemplate := f.createTemplate(globex, "Welcome")
+	if acmeTemplate.TenantID != "acme" || globexTemplate.TenantID != "globex" {
+		t.Fatalf("tenants = %q and %q, want acme and globex", acmeTemplate.TenantID, globexTemplate.TenantID)
+	}
+
+	for _, tt := range []struct {
+		user  *models.User
+		own   *models.MongoTemplate
+		other *models.MongoTemplate
+	}{
+		{acme, acmeTemplate, globexTemplate},
+		{globex, globexTemplate, acmeTemplate},
+	} {
+		listed := f.listTemplates(context.Background(), tt.user)
+		if len(listed) != 1 || listed[tt.own.ID] != "Welcome" {
+			t.Errorf("%s lists %v, want only its own template", tt.user.TenantID, listed)
+		}
+
+		if rec := f.do(tt.user, http.MethodGet, "/api/v1/templates/"+tt.own.ID, nil); rec.Code != http.StatusOK {
+			t.Errorf("%s reading its own template = %d", tt.user.TenantID, rec.Code)
+		}
+
+		missingID := uuid.MustNewUUID()
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			var body interface{}
+			if method == http.MethodPut {
+				body = models.UpdateTemplateRequest{Name: "Taken over"}
+			}
+			other := f.do(tt.user, method, "/api/v1/templates/"+tt.other.ID, body)
+			missing := f.do(tt.user, method, "/api/v1/templates/"+missingID, body)
+			if other.Code != http.StatusNotFound {
+				t.Errorf("%s %s of the other tenant's template = %d %s, want 404", tt.user.TenantID, method, other.Code, other.Body)
+			}
+			if other.Code != missing.Code {
+				t.Errorf("%s %s: other tenant = %d, missing = %d; want the same answer", tt.user.TenantID, method, other.Code, missing.Code)
+			}
+		}
+	}
+
+	// Neither template was touched by the other tenant
+	for _, template := range []*models.MongoTemplate{acmeTemplate, globexTemplate} {
+		stored, err := f.templates.GetByID(context.Background(), template.TenantID, template.ID)
+		if err != nil {
+			t.Fatalf("%s template: %v", template.TenantID, err)
+		}
+		if stored.Name != "Welcome" || stored.Version != 1 {
+			t.Errorf("%s template = %q version %d, want it unchanged", template.TenantID, stored.Name, stored.Version)
+		}
+	}
+}
+
+// TestCreateTemplateValidatesTheBody checks templates with a missing name,
+// an unknown channel or approval flag, or too many tags are refused with the
+// offending fields and none of them is stored
+func TestCreateTemplateValidatesTheBody(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	tags := make([]string, 51)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	for _, tt := range []struct {
+		name string
+		req  models.CreateTemplateRequest
+		want map[string]string
+	}{
+		{"empty", models.CreateTemplateRequest{}, map[string]string{"name": "is required", "channel": "is required"}},
+		{"unknown channel", models.CreateTemplateRequest{Name: "Welcome", Channel: "fax"}, map[string]string{"channel": "must be one of: email, sms, whatsapp, linkedin"}},
+		{"unknown approval flag", models.CreateTemplateRequest{Name: "Welcome", Channel: "email", ApprovalFlag: "blue"}, map[string]string{"approvalFlag": "must be one of: green, yellow, red"}},
+		{"long name", models.CreateTemplateRequest{Name: strings.Repeat("n", 201), Channel: "email"}, map[string]string{"name": "must be at most 200 characters"}},
+		{"too many tags", models.CreateTemplateRequest{Name: "Welcome", Channel: "email", Tags: tags}, map[string]string{"tags": "must be at most 50 items"}},
+		{"blank tag", models.CreateTemplateRequest{Name: "Welcome", Channel: "email", Tags: []string{"vip", " "}}, map[string]string{"tags": "item 2 is required"}},
+	} {
+		detail := errorDetail(t, f.do(admin, http.MethodPost, "/api/v1/templates", tt.req), http.StatusBadRequest)
+		if detail.Code != "VALIDATION_FAILED" || !maps.Equal(detail.Fields, tt.want) {
+			t.Errorf("%s: error = %+v, want fields %v", tt.name, detail, tt.want)
+		}
+	}
+	if listed := f.listTemplates(context.Background(), admin); len(listed) != 0 {
+		t.Errorf("invalid templates were stored: %v", listed)
+	}
+}
+
+// TestTemplateListingFollowsTheCampaignsScope checks an all-scope admin
+// lists every template of the tenant, whoever created it, while an
+// own-scope user lists only their own
+func TestTemplateListingFollowsTheCampaignsScope(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	rep := f.users.Add(&models.User{Email: "rep@acme.test", Role: models.UserRoleSalesRep, IsActive: true, TenantID: "acme"})
+	outsider := f.users.Add(&models.User{Email: "rep@globex.test", Role: models.UserRoleSalesRep, IsActive: true, TenantID: "globex"})
+
+	adminTemplate := f.createTemplate(admin, "Admin template")
+	repTemplate := f.createTemplate(rep, "Rep template")
+	f.createTemplate(outsider, "Globex template")
+
+	all := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Campaigns: "all"})
+	listed := f.listTemplates(all, admin)
+	if len(listed) != 2 || listed[adminTemplate.ID] == "" || listed[repTemplate.ID] == "" {
+		t.Errorf("all-scope admin lists %v, want both acme templates", listed)
+	}
+
+	own := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Campaigns: "own"})
+	listed = f.listTemplates(own, rep)
+	if len(listed) != 1 || listed[repTemplate.ID] == "" {
+		t.Errorf("own-scope rep lists %v, want only their template", listed)
+	}
+}
+
+// TestTemplateLifecycle creates, updates, trashes and purges a template,
+// checking the store, the activity timeline and the events outbox at each
+// step
+func TestTemplateLifecycle(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+
+	template := f.createTemplate(admin, "Welcome")
+	if template.CreatedBy != admin.ID || template.Version != 1 {
+		t.Errorf("created template = by %q version %d, want by %s version 1", template.CreatedBy, template.Version, admin.ID)
+	}
+
+	rec := f.do(admin, http.MethodPut, "/api/v1/templates/"+template.ID, models.UpdateTemplateRequest{Name: "Welcome back"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update = %d %s", rec.Code, rec.Body)
+	}
+	stored, err := f.templates.GetByID(context.Background(), "acme", template.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "Welcome back" || stored.Version != 2 {
+		t.Errorf("updated template = %q version %d, want %q version 2", stored.Name, stored.Version, "Welcome back")
+	}
+	if listed := f.listTemplates(context.Background(), admin); listed[template.ID] != "Welcome back" {
+		t.Errorf("listed templates = %v, want the new name", listed)
+	}
+
+	if rec := f.do(admin, http.MethodDelete, "/api/v1/templates/"+template.ID, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if rec := f.do(admin, http.MethodGet, "/api/v1/templates/"+template.ID, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("reading a trashed template = %d, want 404", rec.Code)
+	}
+	if _, err := f.templates.GetByIDAnyState(context.Background(), "acme", template.ID); err != nil {
+		t.Errorf("a trashed template is kept until purged: %v", err)
+	}
+
+	if rec := f.do(admin, http.MethodDelete, "/api/v1/templates/"+template.ID+"?permanent=true", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("permanent delete = %d %s", rec.Code, rec.Body)
+	}
+	if _, err := f.templates.GetByIDAnyState(context.Background(), "acme", template.ID); !repositories.IsNotFound(err) {
+		t.Errorf("purged template lookup = %v, want not found", err)
+	}
+
+	want := []string{events.TypeTemplateCreated, events.TypeTemplateUpdated, events.TypeTemplateSoftDeleted, events.TypeTemplatePurged}
+	if got := f.outbox.EventTypes(); !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	for _, activity := range f.activities.Activities() {
+		if activity.RelatedToID != template.ID || activity.Owner != admin.ID {
+			t.Errorf("activity %q relates to %s owned by %s, want the template and its creator", activity.Title, activity.RelatedToID, activity.Owner)
+		}
+	}
+	if got := len(f.activities.Activities()); got < 2 {
+		t.Errorf("%d activities recorded, want the create and the update", got)
+	}
+}
+
+// TestTemplatePublishWorkflow publishes and unpublishes a template through
+// the validation gate
+func TestTemplatePublishWorkflow(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	template := f.createTemplate(admin, "Welcome")
+	path := "/api/v1/templates/" + template.ID
+
+	rec := f.do(admin, http.MethodPost, path+"/publish", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("publish = %d %s", rec.Code, rec.Body)
+	}
+	var published models.MongoTemplate
+	decodeBody(t, rec, &published)
+	if published.Status != string(models.TemplateStatusPublished) || published.PublishedBy != admin.ID || published.PublishedAt == nil {
+		t.Errorf("published template = status %q by %q at %v", published.Status, published.PublishedBy, published.PublishedAt)
+	}
+	if rec := f.do(admin, http.MethodPost, path+"/publish", nil); rec.Code != http.StatusConflict {
+		t.Errorf("publishing a published template = %d, want 409", rec.Code)
+	}
+
+	rec = f.do(admin, http.MethodPost, path+"/unpublish", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unpublish = %d %s", rec.Code, rec.Body)
+	}
+	stored, err := f.templates.GetByID(context.Background(), "acme", template.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != string(models.TemplateStatusDraft) {
+		t.Errorf("unpublished template status = %q, want draft", stored.Status)
+	}
+	if rec := f.do(admin, http.MethodPost, path+"/unpublish", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("unpublishing a draft = %d, want 400", rec.Code)
+	}
+
+	want := []string{events.TypeTemplateCreated, events.TypeTemplatePublished, events.TypeTemplateUnpublished}
+	if got := f.outbox.EventTypes(); !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+// TestPublishingNeedsValidMergeTags holds back a template with an undefined
+// merge tag unless forced
+func TestPublishingNeedsValidMergeTags(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	rec := f.do(admin, http.MethodPost, "/api/v1/templates", models.CreateTemplateRequest{
+		Name:    "Colours",
+		Channel: "email",
+		Subject: "Hello",
+		Message: "<p>We heard you like {{favourite_colour}}</p>",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+	var template models.MongoTemplate
+	decodeBody(t, rec, &template)
+	path := "/api/v1/templates/" + template.ID
+
+	rec = f.do(admin, http.MethodPost, path+"/publish", nil)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "favourite_colour") {
+		t.Errorf("publish with an undefined merge tag = %d %s, want 422 naming it", rec.Code, rec.Body)
+	}
+	if rec := f.do(admin, http.MethodPost, path+"/publish?force=true", nil); rec.Code != http.StatusOK {
+		t.Errorf("forced publish = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPublishingWaitsForApprovalWhenRequired(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	template := f.createTemplate(admin, "Welcome")
+	f.requireApproval()
+
+	rec := f.do(admin, http.MethodPost, "/api/v1/templates/"+template.ID+"/publish", nil)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "approved") {
+		t.Errorf("publishing an unapproved template = %d %s, want 409", rec.Code, rec.Body)
+	}
+}
+
+// requireApproval turns on the approval workflow
+func (f *templateFixture) requireApproval() {
+	f.t.Helper()
+	required := true
+	if _, err := f.settings.UpdateSystemSecuritySettings(context.Background(), &models.UpdateSystemSecuritySettingsRequest{TemplateApprovalRequired: &required}); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// stored returns the template as the store holds it
+func (f *templateFixture) stored(tenantID, id string) *models.MongoTemplate {
+	f.t.Helper()
+	template, err := f.templates.GetByID(context.Background(), tenantID, id)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return template
+}
+
+func TestApprovedTemplatesCanBePublished(t *testing.T) {
+	f := newTemplateFixture(t)
+	author := f.users.Add(&models.User{Email: "author@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	approver := f.users.Add(&models.User{Email: "approver@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	template := f.createTemplate(author, "Welcome")
+	f.requireApproval()
+
+	rec := f.do(author, http.MethodPost, "/api/v1/templates/"+template.ID+"/submit-for-approval", models.TemplateApprovalRequest{Comment: "Ready for launch"})
+	var submitted models.MongoTemplate
+	decodeBody(t, rec, &submitted)
+	if rec.Code != http.StatusOK || submitted.ApprovalStatus != string(models.TemplateApprovalPending) {
+		t.Fatalf("submit = %d, approval %q, want 200 pending", rec.Code, submitted.ApprovalStatus)
+	}
+	if rec := f.do(author, http.MethodPost, "/api/v1/templates/"+template.ID+"/publish", nil); rec.Code != http.StatusConflict {
+		t.Errorf("publishing a pending template = %d %s, want 409", rec.Code, rec.Body)
+	}
+
+	rec = f.do(approver, http.MethodPost, "/api/v1/templates/"+template.ID+"/approve", nil)
+	var approved models.MongoTemplate
+	decodeBody(t, rec, &approved)
+	if rec.Code != http.StatusOK || !approved.IsApproved() {
+		t.Fatalf("approve = %d, approval %q, want 200 approved", rec.Code, approved.ApprovalStatus)
+	}
+
+	if rec := f.do(author, http.MethodPost, "/api/v1/templates/"+template.ID+"/publish", nil); rec.Code != http.StatusOK {
+		t.Fatalf("publishing an approved template = %d %s, want 200", rec.Code, rec.Body)
+	}
+	stored := f.stored("acme", template.ID)
+	if !stored.IsPublished() || !stored.IsApproved() {
+		t.Errorf("stored status %q, approval %q; want published and approved", stored.Status, stored.ApprovalStatus)
+	}
+	var actions []models.TemplateApprovalAction
+	for _, entry := range stored.Approvals {
+		actions = append(actions, entry.Action)
+	}
+	if !slices.Equal(actions, []models.TemplateApprovalAction{models.TemplateApprovalSubmitted, models.TemplateApprovalApprove}) {
+		t.Errorf("approval history = %v, want submitted then approved", actions)
+	}
+}
+
+// TestEditingAPendingTemplateResetsItsApproval checks an edit during review
+// withdraws the template, so the edited content needs submitting again
+func TestEditingAPendingTemplateResetsItsApproval(t *testing.T) {
+	f := newTemplateFixture(t)
+	author := f.users.Add(&models.User{Email: "author@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	approver := f.users.Add(&models.User{Email: "approver@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	template := f.createTemplate(author, "Welcome")
+	f.requireApproval()
+
+	if rec := f.do(author, http.MethodPost, "/api/v1/templates/"+template.ID+"/submit-for-approval", nil); rec.Code != http.StatusOK {
+		t.Fatalf("submit = %d %s", rec.Code, rec.Body)
+	}
+	if rec := f.do(author, http.MethodPut, "/api/v1/templates/"+template.ID, models.UpdateTemplateRequest{Description: "Edited during review"}); rec.Code != http.StatusOK {
+		t.Fatalf("update = %d %s", rec.Code, rec.Body)
+	}
+
+	stored := f.stored("acme", template.ID)
+	if stored.ApprovalStatus != "" || stored.Status != string(models.TemplateStatusDraft) {
+		t.Errorf("edited template status %q, approval %q; want a draft out of review", stored.Status, stored.ApprovalStatus)
+	}
+	if last := stored.Approvals[len(stored.Approvals)-1]; last.Action != models.TemplateApprovalReset || last.ActorID != author.ID {
+		t.Errorf("last approval entry = %+v, want a reset by the author", last)
+	}
+
+	// The approver can no longer approve the content they were sent
+	if rec := f.do(approver, http.MethodPost, "/api/v1/templates/"+template.ID+"/approve", nil); rec.Code != http.StatusConflict {
+		t.Errorf("approving the edited template = %d %s, want 409", rec.Code, rec.Body)
+	}
+	if rec := f.do(author, http.MethodPost, "/api/v1/templates/"+template.ID+"/publish", nil); rec.Code != http.StatusConflict {
+		t.Errorf("publishing the edited template = %d %s, want 409", rec.Code, rec.Body)
+	}
+}
+
+func TestApprovingAnUnsubmittedTemplateIsRefused(t *testing.T) {
+	f := newTemplateFixture(t)
+	author := f.users.Add(&models.User{Email: "author@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	approver := f.users.Add(&models.User{Email: "approver@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	template := f.createTemplate(author, "Welcome")
+	f.requireApproval()
+
+	rec := f.do(approver, http.MethodPost, "/api/v1/templates/"+template.ID+"/approve", nil)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), models.ErrApprovalNotPending.Error()) {
+		t.Errorf("approving a draft never submitted = %d %s, want 409 not pending", rec.Code, rec.Body)
+	}
+	if stored := f.stored("acme", template.ID); stored.ApprovalStatus != "" || len(stored.Approvals) != 0 {
+		t.Errorf("stored approval %q with history %+v, want none", stored.ApprovalStatus, stored.Approvals)
+	}
+}
+
+// createTagged creates an email template named name carrying tags as user
+func (f *templateFixture) createTagged(user *models.User, name string, tags ...string) *models.MongoTemplate {
+	f.t.Helper()
+	rec := f.do(user, http.MethodPost, "/api/v1/templates", models.CreateTemplateRequest{
+		Name:    name,
+		Channel: "email",
+		Subject: "Hello",
+		Message: "<p>Hello {{first_name}}</p>",
+		Tags:    tags,
+	})
+	if rec.Code != http.StatusCreated {
+		f.t.Fatalf("create %q = %d %s", name, rec.Code, rec.Body)
+	}
+	var template models.MongoTemplate
+	decodeBody(f.t, rec, &template)
+	return &template
+}
+
+// tagCounts returns the count of each tag user's tenant lists
+func (f *templateFixture) tagCounts(user *models.User) map[string]int64 {
+	f.t.Helper()
+	rec := f.do(user, http.MethodGet, "/api/v1/templates/tags", nil)
+	if rec.Code != http.StatusOK {
+		f.t.Fatalf("list tags = %d %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Tags []models.TemplateTagCount `json:"tags"`
+	}
+	decodeBody(f.t, rec, &body)
+	counts := make(map[string]int64, len(body.Tags))
+	for _, tag := range body.Tags {
+		counts[tag.Name] = tag.Count
+	}
+	return counts
+}
+
+// TestTemplateTagsAreCountedFromTemplates checks the tag counts follow the
+// templates as they are created, retagged, renamed and deleted
+func TestTemplateTagsAreCountedFromTemplates(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	outsider := f.users.Add(&models.User{Email: "admin@globex.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "globex"})
+	welcome := f.createTagged(admin, "Welcome", "onboarding", "vip")
+	followUp := f.createTagged(admin, "Follow up", "vip", "priority")
+	f.createTagged(outsider, "Globex", "vip")
+
+	if got := f.tagCounts(admin); len(got) != 3 || got["vip"] != 2 || got["onboarding"] != 1 || got["priority"] != 1 {
+		t.Errorf("tag counts = %v, want vip 2, onboarding 1 and priority 1", got)
+	}
+
+	rec := f.do(admin, http.MethodPut, "/api/v1/templates/"+welcome.ID, models.UpdateTemplateRequest{Tags: []string{"vip"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retag = %d %s", rec.Code, rec.Body)
+	}
+	if got := f.tagCounts(admin); got["onboarding"] != 0 || got["vip"] != 2 {
+		t.Errorf("tag counts after dropping onboarding = %v", got)
+	}
+
+	rec = f.do(admin, http.MethodPut, "/api/v1/templates/tags/vip", models.RenameTemplateTagRequest{Name: "priority"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename = %d %s", rec.Code, rec.Body)
+	}
+	if got := f.tagCounts(admin); len(got) != 1 || got["priority"] != 2 {
+		t.Errorf("tag counts after the rename = %v, want priority 2", got)
+	}
+	stored, err := f.templates.GetByID(context.Background(), "acme", followUp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stored.Tags, []string{"priority"}) {
+		t.Errorf("tags of a template with both names = %v, want one priority", stored.Tags)
+	}
+	if got := f.tagCounts(outsider); got["vip"] != 1 {
+		t.Errorf("the rename reached the other tenant: %v", got)
+	}
+	if got := f.outbox.EventTypes(); got[len(got)-1] != events.TypeTemplateTagRenamed {
+		t.Errorf("last event = %s, want %s", got[len(got)-1], events.TypeTemplateTagRenamed)
+	}
+
+	if rec := f.do(admin, http.MethodPut, "/api/v1/templates/tags/vip", models.RenameTemplateTagRequest{Name: "gold"}); rec.Code != http.StatusNotFound {
+		t.Errorf("renaming an unused tag = %d, want 404", rec.Code)
+	}
+
+	if rec := f.do(admin, http.MethodDelete, "/api/v1/templates/"+followUp.ID, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if got := f.tagCounts(admin); got["priority"] != 1 {
+		t.Errorf("tag counts after a delete = %v, want priority 1", got)
+	}
+}
+
+// TestTagFilteredListingsArePaged checks a tag-filtered listing reports
+// the total of the matching templates and pages through them
+func TestTagFilteredListingsArePaged(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	for _, name := range []string{"One", "Two", "Three"} {
+		f.createTagged(admin, name, "vip")
+	}
+	f.createTagged(admin, "Four", "other")
+
+	seen := map[string]bool{}
+	for page := 1; page <= 2; page++ {
+		rec := f.do(admin, http.MethodGet, fmt.Sprintf("/api/v1/templates?tag=vip&limit=2&page=%d&sort_by=name", page), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d = %d %s", page, rec.Code, rec.Body)
+		}
+		var body struct {
+			Templates  []models.MongoTemplate `json:"templates"`
+			Total      int                    `json:"total"`
+			TotalPages int                    `json:"totalPages"`
+		}
+		decodeBody(t, rec, &body)
+		if body.Total != 3 || body.TotalPages != 2 {
+			t.Errorf("page %d: total %d in %d pages, want 3 in 2", page, body.Total, body.TotalPages)
+		}
+		if want := 3 - (page-1)*2; len(body.Templates) != min(want, 2) {
+			t.Errorf("page %d holds %d templates", page, len(body.Templates))
+		}
+		for _, template := range body.Templates {
+			if seen[template.ID] || !slices.Contains(template.Tags, "vip") {
+				t.Errorf("page %d lists %q again or without the tag", page, template.Name)
+			}
+			seen[template.ID] = true
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("the pages listed %d templates, want 3", len(seen))
+	}
+}
+
+// TestTeamScopedListingsPageThroughLargeTeams fills a tenant with over a
+// thousand templates created by two teams, and checks a team-scoped user
+// gets the exact count of their team's templates and pages through every
+// one of them
+func TestTeamScopedListingsPageThroughLargeTeams(t *testing.T) {
+	f := newTemplateFixture(t)
+	var north, south []*models.User
+	for i := 0; i < 3; i++ {
+		north = append(north, f.users.Add(&models.User{Email: fmt.Sprintf("north%d@acme.test", i), Role: models.UserRoleManager, IsActive: true, TenantID: "acme", Team: "north"}))
+		south = append(south, f.users.Add(&models.User{Email: fmt.Sprintf("south%d@acme.test", i), Role: models.UserRoleManager, IsActive: true, TenantID: "acme", Team: "south"}))
+	}
+	const northCount, southCount = 613, 742
+	create := func(team []*models.User, n int) map[string]bool {
+		ids := map[string]bool{}
+		for i := 0; i < n; i++ {
+			template := &models.MongoTemplate{TenantID: "acme", Name: fmt.Sprintf("%s %d", team[0].Team, i), Channel: "email", Status: string(models.TemplateStatusDraft), CreatedBy: team[i%len(team)].ID}
+			if err := f.templates.Create(context.Background(), template); err != nil {
+				t.Fatal(err)
+			}
+			ids[template.ID] = true
+		}
+		return ids
+	}
+	northIDs := create(north, northCount)
+	create(south, southCount)
+
+	team := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Campaigns: models.DataScopeTeam})
+	const limit = 100
+	pages := (northCount + limit - 1) / limit
+	seen := map[string]bool{}
+	for page := 1; page <= pages+1; page++ {
+		rec := f.doContext(team, north[1], http.MethodGet, fmt.Sprintf("/api/v1/templates?limit=%d&page=%d", limit, page), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d = %d %s", page, rec.Code, rec.Body)
+		}
+		var body struct {
+			Templates  []models.MongoTemplate `json:"templates"`
+			Total      int                    `json:"total"`
+			TotalPages int                    `json:"totalPages"`
+		}
+		decodeBody(t, rec, &body)
+		if body.Total != northCount || body.TotalPages != pages {
+			t.Errorf("page %d: total %d in %d pages, want %d in %d", page, body.Total, body.TotalPages, northCount, pages)
+		}
+		// Full pages, the remainder on the last one and nothing past it
+		want := min(limit, max(northCount-(page-1)*limit, 0))
+		if len(body.Templates) != want {
+			t.Errorf("page %d holds %d templates, want %d", page, len(body.Templates), want)
+		}
+		for _, template := range body.Templates {
+			if !northIDs[template.ID] || seen[template.ID] {
+				t.Fatalf("page %d lists %q, of another team or again", page, template.Name)
+			}
+			seen[template.ID] = true
+		}
+	}
+	if len(seen) != northCount {
+		t.Errorf("the pages listed %d templates, want all %d of the team", len(seen), northCount)
+	}
+
+	// The whole tenant, for an all-scope caller
+	all := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Campaigns: models.DataScopeAll})
+	rec := f.doContext(all, south[0], http.MethodGet, "/api/v1/templates?limit=1", nil)
+	var body struct {
+		Total int `json:"total"`
+	}
+	decodeBody(t, rec, &body)
+	if body.Total != northCount+southCount {
+		t.Errorf("all-scope total = %d, want %d", body.Total, northCount+southCount)
+	}
+}
+
+// exportTemplates exports the templates user sees, narrowed by query
+func (f *templateFixture) exportTemplates(user *models.User, query string) models.TemplateExportDocument {
+	f.t.Helper()
+	rec := f.do(user, http.MethodGet, "/api/v1/templates/export"+query, nil)
+	if rec.Code != http.StatusOK {
+		f.t.Fatalf("export = %d %s", rec.Code, rec.Body)
+	}
+	var doc models.TemplateExportDocument
+	decodeBody(f.t, rec, &doc)
+	return doc
+}
+
+// importTemplates imports doc as user, resolving conflicts with conflict
+func (f *templateFixture) importTemplates(user *models.User, conflict string, doc models.TemplateExportDocument) models.TemplateImportResponse {
+	f.t.Helper()
+	rec := f.do(user, http.MethodPost, "/api/v1/templates/import?conflict="+conflict, doc)
+	if rec.Code != http.StatusOK {
+		f.t.Fatalf("import with %s = %d %s", conflict, rec.Code, rec.Body)
+	}
+	var resp models.TemplateImportResponse
+	decodeBody(f.t, rec, &resp)
+	return resp
+}
+
+// BenchmarkListTemplatesTeamScope lists the templates of a 500 user team as
+// one of its members, reading the team's member IDs from the user store on
+// every request and through the user scope cache the RBAC middleware
+// installs
+func BenchmarkListTemplatesTeamScope(b *testing.B) {
+	f := newTemplateFixture(b)
+	var team []*models.User
+	for i := 0; i < 500; i++ {
+		team = append(team, f.users.Add(&models.User{Email: fmt.Sprintf("north%d@acme.test", i), Role: models.UserRoleSalesRep, IsActive: true, TenantID: "acme", Team: "north"}))
+	}
+	for i := 0; i < 2000; i++ {
+		f.users.Add(&models.User{Email: fmt.Sprintf("other%d@acme.test", i), Role: models.UserRoleSalesRep, IsActive: true, TenantID: "acme", Team: fmt.Sprintf("team%d", i%20)})
+	}
+	for i := 0; i < 200; i++ {
+		template := &models.MongoTemplate{TenantID: "acme", Name: fmt.Sprintf("North %d", i), Channel: "email", Status: string(models.TemplateStatusDraft), CreatedBy: team[i%len(team)].ID}
+		if err := f.templates.Create(context.Background(), template); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	rbac := services.NewRBACService(nil, nil)
+	rbac.SetUserStore(f.users)
+	scoped := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Campaigns: models.DataScopeTeam})
+	for _, bb := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"uncached", scoped},
+		{"cached", rbac.WithTeamMembers(scoped)},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if rec := f.doContext(bb.ctx, team[0], http.MethodGet, "/api/v1/templates?limit=20", nil); rec.Code != http.StatusOK {
+					b.Fatalf("list = %d %s", rec.Code, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+// TestTemplateExportRoundTrips exports a tenant's templates, imports them
+// into an empty tenant and exports them again: the two documents match but
+// for the system flag, which imports never keep
+func TestTemplateExportRoundTrips(t *testing.T) {
+	f := newTemplateFixture(t)
+	acme := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	globex := f.users.Add(&models.User{Email: "admin@globex.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "globex"})
+
+	f.createTagged(acme, "Welcome", "onboarding")
+	f.createTagged(acme, "Follow up", "vip", "onboarding")
+	rec := f.do(acme, http.MethodPost, "/api/v1/templates", models.CreateTemplateRequest{Name: "Meeting reminder", Channel: "sms", Message: "See you at {{meeting_time}}"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create the reminder = %d %s", rec.Code, rec.Body)
+	}
+	var system models.MongoTemplate
+	decodeBody(t, rec, &system)
+	system.IsSystem = true
+	if err := f.templates.Replace(context.Background(), &system); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := f.exportTemplates(acme, "")
+	if exported.SchemaVersion != models.TemplateExportSchemaVersion {
+		t.Errorf("schemaVersion = %d, want %d", exported.SchemaVersion, models.TemplateExportSchemaVersion)
+	}
+	var names []string
+	for _, item := range exported.Templates {
+		names = append(names, item.Name)
+	}
+	if want := []string{"Follow up", "Meeting reminder", "Welcome"}; !slices.Equal(names, want) {
+		t.Fatalf("exported %v, want %v sorted by name", names, want)
+	}
+
+	// Imports extract the merge tags again rather than trusting the document
+	imported := exported
+	imported.Templates = slices.Clone(exported.Templates)
+	for i := range imported.Templates {
+		imported.Templates[i].VariablesSchema = nil
+	}
+	resp := f.importTemplates(globex, models.ImportConflictSkip, imported)
+	if resp.Created != 3 || resp.Failed != 0 {
+		t.Fatalf("import = %+v, want 3 created", resp)
+	}
+	for _, result := range resp.Results {
+		stored, err := f.templates.GetByID(context.Background(), "globex", result.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", result.Name, err)
+		}
+		if stored.CreatedBy != globex.ID || stored.IsSystem {
+			t.Errorf("%s: created_by = %s, system = %v; want the importer and not a system template", result.Name, stored.CreatedBy, stored.IsSystem)
+		}
+		if stored.ID == system.ID {
+			t.Errorf("%s kept the ID of the exported template", result.Name)
+		}
+	}
+	if sms := f.exportTemplates(globex, "?channel=sms").Templates; len(sms) != 1 || sms[0].Name != "Meeting reminder" {
+		t.Errorf("sms export = %+v, want the reminder only", sms)
+	}
+
+	reexported := f.exportTemplates(globex, "")
+	for i := range exported.Templates {
+		exported.Templates[i].IsSystem = false
+	}
+	if got, want := fmt.Sprintf("%+v", reexported.Templates), fmt.Sprintf("%+v", exported.Templates); got != want {
+		t.Errorf("re-exported templates differ:\n%s\nwant\n%s", got, want)
+	}
+	if !slices.Contains(f.outbox.EventTypes(), events.TypeTemplatesImported) {
+		t.Errorf("events = %v, want %s", f.outbox.EventTypes(), events.TypeTemplatesImported)
+	}
+}
+
+func TestTemplateImportConflicts(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	welcome := f.createTemplate(admin, "Welcome")
+
+	doc := f.exportTemplates(admin, "?ids="+welcome.ID)
+	doc.Templates[0].Subject = "Imported {{first_name}}"
+
+	if resp := f.importTemplates(admin, models.ImportConflictSkip, doc); resp.Skipped != 1 || resp.Results[0].ID != welcome.ID {
+		t.Errorf("skip = %+v, want the existing template skipped", resp)
+	}
+	if stored, _ := f.templates.GetByID(context.Background(), "acme", welcome.ID); stored.Subject != welcome.Subject {
+		t.Errorf("subject after skip = %q, want it unchanged", stored.Subject)
+	}
+
+	if resp := f.importTemplates(admin, models.ImportConflictOverwrite, doc); resp.Overwritten != 1 || resp.Results[0].ID != welcome.ID {
+		t.Errorf("overwrite = %+v, want the existing template overwritten", resp)
+	}
+	if stored, _ := f.templates.GetByID(context.Background(), "acme", welcome.ID); stored.Subject != "Imported {{first_name}}" || stored.Version != welcome.Version+1 {
+		t.Errorf("after overwrite: subject %q, version %d; want the imported subject and version %d", stored.Subject, stored.Version, welcome.Version+1)
+	}
+
+	resp := f.importTemplates(admin, models.ImportConflictDuplicate, doc)
+	if resp.Created != 1 || resp.Results[0].ID == welcome.ID || !strings.Contains(resp.Results[0].Name, "(copy)") {
+		t.Errorf("duplicate = %+v, want a new template under a copy name", resp)
+	}
+
+	// Each template is validated on its own; one bad item does not fail the rest
+	doc.Templates = append(doc.Templates, models.TemplateExportItem{Name: "Fax", Channel: "fax"})
+	if resp := f.importTemplates(admin, models.ImportConflictSkip, doc); resp.Skipped != 1 || resp.Failed != 1 || resp.Results[1].Reason == "" {
+		t.Errorf("import with a bad channel = %+v, want one skipped and one failed with a reason", resp)
+	}
+}
+
+func TestTemplateImportRejectsBadDocuments(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	item := models.TemplateExportItem{Name: "Welcome", Channel: "email", Status: "draft", Subject: "Hi", Body: "Hello"}
+	for _, tt := range []struct {
+		name  string
+		query string
+		doc   models.TemplateExportDocument
+	}{
+		{"unknown conflict strategy", "?conflict=merge", models.TemplateExportDocument{SchemaVersion: models.TemplateExportSchemaVersion, Templates: []models.TemplateExportItem{item}}},
+		{"other schema version", "", models.TemplateExportDocument{SchemaVersion: models.TemplateExportSchemaVersion + 1, Templates: []models.TemplateExportItem{item}}},
+		{"no templates", "", models.TemplateExportDocument{SchemaVersion: models.TemplateExportSchemaVersion}},
+	} {
+		if rec := f.do(admin, http.MethodPost, "/api/v1/templates/import"+tt.query, tt.doc); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d %s, want 400", tt.name, rec.Code, rec.Body)
+		}
+	}
+	if rec := f.do(admin, http.MethodGet, "/api/v1/templates/export?ids=not-an-id", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("export of a malformed ID = %d, want 400", rec.Code)
+	}
+}
+
+// TestTemplateUpdatesAreVersioned interleaves two edits of the same version
+// and checks the second is refused with the template as it now is
+func TestTemplateUpdatesAreVersioned(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	other := f.users.Add(&models.User{Email: "other@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	template := f.createTemplate(admin, "Welcome")
+	target := "/api/v1/templates/" + template.ID
+	ifMatch := func(version string) http.Header { return http.Header{"If-Match": {version}} }
+
+	rec := f.do(admin, http.MethodGet, target, nil)
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+
+	// Both read version 1; the first to write wins
+	first := f.doHeader(context.Background(), admin, http.MethodPut, target, models.UpdateTemplateRequest{Name: "First"}, ifMatch(`"1"`))
+	if first.Code != http.StatusOK || first.Header().Get("ETag") != `"2"` {
+		t.Fatalf("first update = %d, ETag %q; want 200 at version 2", first.Code, first.Header().Get("ETag"))
+	}
+	second := f.doHeader(context.Background(), other, http.MethodPut, target, models.UpdateTemplateRequest{Name: "Second"}, ifMatch(`"1"`))
+	if second.Code != http.StatusConflict {
+		t.Fatalf("second update = %d %s, want 409", second.Code, second.Body)
+	}
+	var conflict struct {
+		Error   ErrorDetail          `json:"error"`
+		Current models.MongoTemplate `json:"current"`
+	}
+	decodeBody(t, second, &conflict)
+	if conflict.Error.Code != "CONFLICT" || conflict.Current.Name != "First" || conflict.Current.Version != 2 {
+		t.Errorf("conflict = %+v, want the first update at version 2", conflict)
+	}
+
+	// Merged and retried with the version in the body
+	version := 2
+	if rec := f.do(other, http.MethodPut, target, models.UpdateTemplateRequest{Name: "Second", Version: &version}); rec.Code != http.StatusOK {
+		t.Errorf("retry at version 2 = %d %s", rec.Code, rec.Body)
+	}
+
+	// Clients sending no version are not checked unless required
+	if rec := f.do(admin, http.MethodPut, target, models.UpdateTemplateRequest{Name: "Unchecked"}); rec.Code != http.StatusOK {
+		t.Errorf("update without a version = %d %s, want 200", rec.Code, rec.Body)
+	}
+	f.handler.SetRequireVersion(true)
+	if rec := f.do(admin, http.MethodPut, target, models.UpdateTemplateRequest{Name: "Unchecked"}); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("update without a required version = %d, want 428", rec.Code)
+	}
+	if rec := f.doHeader(context.Background(), admin, http.MethodPut, target, models.UpdateTemplateRequest{Name: "Bad"}, ifMatch("*")); rec.Code != http.StatusBadRequest {
+		t.Errorf("If-Match * = %d, want 400", rec.Code)
+	}
+	if rec := f.doHeader(context.Background(), admin, http.MethodPut, target, models.UpdateTemplateRequest{Name: "Bad", Version: &version}, ifMatch(`"4"`)); rec.Code != http.StatusBadRequest {
+		t.Errorf("If-Match and version disagreeing = %d, want 400", rec.Code)
+	}
+}
+
+// TestConcurrentTemplateUpdatesConflict sends updates of the same version at
+// once, so some pass the handler's version check before any is stored, and
+// checks the store lets exactly one through
+func TestConcurrentTemplateUpdatesConflict(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	template := f.createTemplate(admin, "Welcome")
+
+	const writers = 8
+	codes := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := f.doHeader(context.Background(), admin, http.MethodPut, "/api/v1/templates/"+template.ID,
+				models.UpdateTemplateRequest{Name: fmt.Sprintf("Edit %d", i)}, http.Header{"If-Match": {`"1"`}})
+			codes <- rec.Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	count := map[int]int{}
+	for code := range codes {
+		count[code]++
+	}
+	if count[http.StatusOK] != 1 || count[http.StatusConflict] != writers-1 {
+		t.Errorf("responses = %v, want one 200 and %d 409", count, writers-1)
+	}
+	stored, err := f.templates.GetByID(context.Background(), "acme", template.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != 2 {
+		t.Errorf("version = %d, want 2 after a single update", stored.Version)
+	}
+}
+
+// TestConvertTemplateCreatesADraft converts an email template to SMS and
+// checks a plain-text draft is stored beside it with the warnings, that a
+// second conversion gets its own name, and that bad targets are refused
+func TestConvertTemplateCreatesADraft(t *testing.T) {
+	f := newTemplateFixture(t)
+	admin := f.users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	source := f.createTemplate(admin, "Welcome")
+
+	convert := func(id, target string) *models.TemplateConversionResult {
+		t.Helper()
+		rec := f.do(admin, http.MethodPost, "/api/v1/templates/"+id+"/convert?target="+target, nil)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("convert to %s = %d %s", target, rec.Code, rec.Body)
+		}
+		var result models.TemplateConversionResult
+		decodeBody(t, rec, &result)
+		return &result
+	}
+
+	result := convert(source.ID, "SMS")
+	draft := result.Template
+	if draft.Name != "Welcome (SMS)" || draft.Channel != "sms" || draft.Status != string(models.TemplateStatusDraft) || draft.Body != "Welcome aboard, {{first_name}}" {
+		t.Errorf("draft = %q on %s, %s: %q", draft.Name, draft.Channel, draft.Status, draft.Body)
+	}
+	if draft.ID == "" || draft.ID == source.ID || draft.TenantID != "acme" || draft.CreatedBy != admin.ID {
+		t.Errorf("draft = id %q tenant %q by %q, want a new template of the admin's tenant", draft.ID, draft.TenantID, draft.CreatedBy)
+	}
+	if want := []string{"subject discarded: SMS templates have no subject", "1 merge tags kept"}; !slices.Equal(result.Warnings, want) {
+		t.Errorf("warnings = %q, want %q", result.Warnings, want)
+	}
+	stored, err := f.templates.GetByID(context.Background(), "acme", draft.ID)
+	if err != nil || stored.Channel != "sms" {
+		t.Fatalf("stored draft = %+v, %v", stored, err)
+	}
+	if original, err := f.templates.GetByID(context.Background(), "acme", source.ID); err != nil || original.Channel != "email" || original.Version != 1 {
+		t.Errorf("source after converting = %+v, %v; want it unchanged", original, err)
+	}
+
+	if again := convert(source.ID, "sms"); again.Template.Name != "Welcome (SMS 2)" {
+		t.Errorf("second conversion named %q, want Welcome (SMS 2)", again.Template.Name)
+	}
+
+	for _, tt := range []struct {
+		id, target string
+		want       int
+	}{
+		{source.ID, "", http.StatusBadRequest},
+		{source.ID, "email", http.StatusBadRequest},
+		{source.ID, "fax", http.StatusBadRequest},
+		{draft.ID, "sms", http.StatusBadRequest},
+		{"not-a-uuid", "sms", http.StatusBadRequest},
+		{uuid.MustNewUUID(), "sms", http.StatusNotFound},
+	} {
+		if rec := f.do(admin, http.MethodPost, "/api/v1/templates/"+tt.id+"/convert?target="+tt.target, nil); rec.Code != tt.want {
+			t.Errorf("convert %s to %q = %d %s, want %d", tt.id, tt.target, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// LintTemplate godoc
+// @Summary Lint a template
+// @Description Checks a saved template for problems that make emails fail or land in spam: links and image URLs that do not answer 2xx (HEAD requests, 5s each, at most 50 URLs; internal addresses are never requested, even through redirects), images without alt text, a missing plain-text alternative, a low text-to-image ratio, unresolved merge tags and, when the requiresUnsubscribe security setting is on, a missing {{unsubscribe_url}}. Findings never block saving; publishing with requireCleanLint refuses templates with errors. Set check_links=false to skip the link requests.
+// @Tags Templates
+// @Produce json
+// @Param id path string true "Template ID (UUID)"
+// @Param check_links query bool false "Request every link (default true)"
+// @Success 200 {object} models.TemplateLintReport
+// @Failure 400 {object} ErrorResponse "Invalid template ID or check_links"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Permission denied"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/{id}/lint [post]
+// @Security BearerAuth
+func (h *TemplateHandler) LintTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid template ID format")
+		return
+	}
+	checkLinks, ok := parseCheckLinks(w, r)
+	if !ok {
+		return
+	}
+
+	template, ok := h.loadTemplateInScope(w, r, templateID)
+	if !ok {
+		return
+	}
+
+	h.respondWithLint(w, r, template, checkLinks)
+}
+
+// LintDraftTemplate godoc
+// @Summary Lint an unsaved template
+// @Description Runs the template lint on a template that has not been saved yet, so the editor can check drafts. Accepts the same template fields as create.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param check_links query bool false "Request every link (default true)"
+// @Param request body models.DraftTemplateLintRequest true "Draft template"
+// @Success 200 {object} models.TemplateLintReport
+// @Failure 400 {object} CodedErrorResponse "Invalid payload, channel or check_links"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /templates/lint [post]
+// @Security BearerAuth
+func (h *TemplateHandler) LintDraftTemplate(w http.ResponseWriter, r *http.Request) {
+	checkLinks, ok := parseCheckLinks(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DraftTemplateLintRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	channel := req.Template.Channel
+	if !models.IsValidChannel(channel) {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel: must be email, sms, whatsapp or linkedin")
+		return
+	}
+
+	h.respondWithLint(w, r, draftTemplate(req.Template, channel), checkLinks)
+}
+
+// respondWithLint lints a template and writes the report
+func (h *TemplateHandler) respondWithLint(w http.ResponseWriter, r *http.Request, template *models.MongoTemplate, checkLinks bool) {
+	opts, err := h.lintOptions(r.Context(), checkLinks)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load security settings: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, h.linter.Lint(r.Context(), template, opts))
+}
+
+// lintOptions returns the lint checks the system settings ask for
+func (h *TemplateHandler) lintOptions(ctx context.Context, checkLinks bool) (services.TemplateLintOptions, error) {
+	opts := services.TemplateLintOptions{CheckLinks: checkLinks}
+	if h.settingsRepo == nil {
+		return opts, nil
+	}
+	settings, err := h.settingsRepo.GetSystemSecuritySettings(ctx)
+	if err != nil {
+		return opts, err
+	}
+	opts.RequireUnsubscribe = settings.RequiresUnsubscribe
+	return opts, nil
+}
+
+// parseCheckLinks reads the check_links query parameter, true by default
+func parseCheckLinks(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	value := r.URL.Query().Get("check_links")
+	if value == "" {
+		return true, true
+	}
+	checkLinks, err := strconv.ParseBool(value)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid check_links value, must be true or false")
+		return false, false
+	}
+	return checkLinks, true
+}
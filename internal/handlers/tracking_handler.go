@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/smtp"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// trackingPixel is a 1x1 transparent GIF
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// TrackingHandler serves the unauthenticated open-pixel and click-redirect
+// endpoints embedded in tracked emails
+type TrackingHandler struct {
+	emailRepo repositories.MailboxStore
+	tracker   *smtp.Tracker // nil when tracking is not configured
+}
+
+// NewTrackingHandler creates a new TrackingHandler
+func NewTrackingHandler(emailRepo repositories.MailboxStore, tracker *smtp.Tracker) *TrackingHandler {
+	return &TrackingHandler{
+		emailRepo: emailRepo,
+		tracker:   tracker,
+	}
+}
+
+// TrackOpen godoc
+// @Summary Email open pixel
+// @Description Records an open of a tracked email and returns a 1x1 transparent GIF. HEAD requests (link scanners, prefetchers) are not recorded.
+// @Tags tracking
+// @Produce image/gif
+// @Param messageID path string true "Message ID"
+// @Success 200 {file} binary
+// @Router /track/open/{messageID}.gif [get]
+func (h *TrackingHandler) TrackOpen(w http.ResponseWriter, r *http.Request) {
+	messageID, err := uuid.ParseUUID(mux.Vars(r)["messageID"])
+	if err == nil && r.Method == http.MethodGet {
+		if err := h.emailRepo.MarkOpened(r.Context(), messageID, time.Now()); err != nil {
+			log.Printf("Warning: failed to record open for message %s: %v", messageID, err)
+		}
+	}
+
+	// Always answer with the pixel so mail clients never show a broken image
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(trackingPixel)
+	}
+}
+
+// TrackClick godoc
+// @Summary Email click redirect
+// @Description Records a click on a tracked link and redirects to the original URL. The url parameter must carry a valid signature. HEAD requests are redirected without being recorded.
+// @Tags tracking
+// @Param messageID path string true "Message ID"
+// @Param url query string true "Original link"
+// @Param sig query string true "Link signature"
+// @Success 302
+// @Failure 400 {object} ErrorResponse
+// @Router /track/click/{messageID} [get]
+func (h *TrackingHandler) TrackClick(w http.ResponseWriter, r *http.Request) {
+	messageID, err := uuid.ParseUUID(mux.Vars(r)["messageID"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	target := r.URL.Query().Get("url")
+	// Only signed links are followed - anything else would be an open redirect
+	if h.tracker == nil || target == "" || !h.tracker.Verify(messageID, target, r.URL.Query().Get("sig")) {
+		respondWithError(w, http.StatusBadRequest, "Invalid tracking link")
+		return
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		respondWithError(w, http.StatusBadRequest, "Invalid tracking link")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if err := h.emailRepo.RecordClick(r.Context(), messageID, target, time.Now()); err != nil {
+			log.Printf("Warning: failed to record click for message %s: %v", messageID, err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// SetRBACService sets the service that resolves role data scopes and caches
+// the per-user overrides, so a changed override applies on the next request
+func (h *UserHandler) SetRBACService(rbacService *services.RBACService) {
+	h.rbacService = rbacService
+}
+
+// UserDataScopeResponse is a user's data scope: the role's, the user's own
+// override and the two merged
+type UserDataScopeResponse struct {
+	UserID        string            `json:"userId"`
+	Role          models.UserRole   `json:"role"`
+	RoleDataScope *models.DataScope `json:"roleDataScope"`
+	Override      *models.DataScope `json:"override"`
+	Effective     models.DataScope  `json:"effective"`
+}
+
+// GetUserDataScope returns a user's data scope
+// GET /api/v1/admin/users/{id}/data-scope
+// @Summary Get a user's data scope
+// @Description Returns the role's data scope, the user's override and the effective scope
+// @Tags Users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} UserDataScopeResponse
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/data-scope [get]
+func (h *UserHandler) GetUserDataScope(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	h.respondWithDataScope(w, r, user)
+}
+
+// UpdateUserDataScope sets a user's data scope override. The body maps
+// resources (customers, campaigns, users) to own, team, region, all or none;
+// an empty value falls back to the role's scope for that resource. Resources
+// left out keep their current override.
+// PUT /api/v1/admin/users/{id}/data-scope
+// @Summary Update a user's data scope
+// @Description Sets the user's override per resource (customers, campaigns, users) to own, team, region, all or none; an empty value falls back to the role's scope
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param scopeRequest body map[string]string true "Resource to data scope"
+// @Success 200 {object} UserDataScopeResponse
+// @Failure 400 {object} ErrorResponse "Invalid body, resource or scope"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only, or impersonating"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/data-scope [put]
+func (h *UserHandler) UpdateUserDataScope(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	override := models.DataScope{}
+	if user.DataScope != nil {
+		override = *user.DataScope
+	}
+	for resource, value := range req {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" && !models.IsValidDataScopeValue(value) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid data scope %q for %s, must be own, team, region, all or none", value, resource))
+			return
+		}
+		if !override.Set(resource, value) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown data scope resource %q, must be one of %s", resource, strings.Join(models.DataScopeResources, ", ")))
+			return
+		}
+	}
+
+	var stored *models.DataScope
+	if override != (models.DataScope{}) {
+		stored = &override
+	}
+	updated, err := h.userRepo.UpdateDataScope(r.Context(), user.ID, stored)
+	if err != nil {
+		if repositories.IsUserNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to update data scope: "+err.Error())
+		return
+	}
+	if h.rbacService != nil {
+		h.rbacService.InvalidateUserDataScope(user.ID)
+	}
+
+	h.respondWithDataScope(w, r, updated)
+}
+
+// loadUser loads the user named by the {id} path variable, responding with
+// 400 or 404 when it is invalid or does not exist. Users of other tenants
+// or outside the caller's users data scope are not found rather than
+// forbidden, so their existence is not revealed.
+func (h *UserHandler) loadUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return nil, false
+	}
+	user, err := h.userRepo.GetByID(r.Context(), id)
+	if err != nil {
+		if repositories.IsUserNotFound(err) {
+			respondWithHiddenNotFound(w, "User not found")
+			return nil, false
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user: "+err.Error())
+		return nil, false
+	}
+	if user.Tenant() != middleware.GetTenantID(r) {
+		respondWithHiddenNotFound(w, "User not found")
+		return nil, false
+	}
+
+	dataScope, claims, err := requestScope(r, h.userRepo)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve data scope: "+err.Error())
+		return nil, false
+	}
+	if !services.IsInScope("users", dataScope, claims, user) {
+		respondWithHiddenNotFound(w, "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *UserHandler) respondWithDataScope(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var roleScope *models.DataScope
+	if h.rbacService != nil {
+		scope, err := h.rbacService.GetDataScopeForRole(r.Context(), string(user.Role))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to get role data scope: "+err.Error())
+			return
+		}
+		roleScope = scope
+	}
+
+	effective := models.DataScope{}
+	if roleScope != nil {
+		effective = *roleScope
+	}
+	respondWithJSON(w, http.StatusOK, UserDataScopeResponse{
+		UserID:        user.ID,
+		Role:          user.Role,
+		RoleDataScope: roleScope,
+		Override:      user.DataScope,
+		Effective:     effective.WithOverride(user.DataScope),
+	})
+}
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+)
+
+// userStatsTTL is how long the dashboard numbers are reused; the dashboard
+// polls them
+const userStatsTTL = 60 * time.Second
+
+const (
+	// maxUserLookupIDs is the most user IDs one lookup may resolve
+	maxUserLookupIDs = 500
+	// userLookupTTL is how long a looked up user is served from memory. Other
+	// services resolve the same few users constantly.
+	userLookupTTL = 30 * time.Second
+	// maxUserLookupCache bounds the lookup cache; it is emptied when full
+	maxUserLookupCache = 10000
+)
+
+// UserHandler serves the user directory for administrators
+type UserHandler struct {
+	userRepo    repositories.UserStore
+	rbacService *services.RBACService // Resolves role data scopes; nil reports none
+	hierarchy   *services.UserHierarchy
+
+	statsMu sync.Mutex
+	stats   *repositories.UserStats // Last computed numbers, reused for userStatsTTL
+
+	lookupMu    sync.Mutex
+	lookupCache map[string]cachedUserLookup // By user ID
+}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler(userRepo repositories.UserStore) *UserHandler {
+	return &UserHandler{
+		userRepo:    userRepo,
+		hierarchy:   services.NewUserHierarchy(userRepo),
+		lookupCache: make(map[string]cachedUserLookup),
+	}
+}
+
+// UserLookupRequest is the body of a batch user lookup
+type UserLookupRequest struct {
+	IDs []string `json:"ids" validate:"required"`
+}
+
+// UserLookupEntry is the public part of a user returned by a lookup
+type UserLookupEntry struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Team     string `json:"team"`
+	Region   string `json:"region"`
+	IsActive bool   `json:"isActive"`
+}
+
+// UserLookupResponse is the response to a batch user lookup
+type UserLookupResponse struct {
+	Users    map[string]UserLookupEntry `json:"users"`    // By user ID
+	NotFound []string                   `json:"notFound"` // IDs without a user in the caller's tenant
+}
+
+// cachedUserLookup is a looked up user kept for userLookupTTL
+type cachedUserLookup struct {
+	entry     UserLookupEntry
+	tenantID  string
+	expiresAt time.Time
+}
+
+// userCSVHeader is the header row of the CSV user export
+var userCSVHeader = []string{"id", "name", "email", "role", "region", "team", "is_active", "created_at", "last_login_at"}
+
+// ListUsers lists users filtered by role, region, team, is_active, search
+// (name or email) and created_after/created_before (RFC 3339), sorted by
+// sort (name, email, role, created_at or last_login_at, prefixed with "-"
+// for descending; default -created_at) and paginated by cursor, or with
+// page/limit (see package pagination). Cursors are only issued when sorting
+// by created_at. format=csv streams every matching user as a CSV file
+// instead of a page.
+// GET /api/v1/admin/users
+// @Summary List users
+// @Description Lists users with filters, sorted and paged by cursor (created_at sorts only) or page. format=csv streams every matching user as CSV instead.
+// @Tags Users
+// @Produce json
+// @Produce text/csv
+// @Param role query string false "Role"
+// @Param region query string false "Region"
+// @Param team query string false "Team"
+// @Param is_active query bool false "Active flag"
+// @Param search query string false "Name or email contains"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created at or before (RFC 3339)"
+// @Param sort query string false "name, email, role, created_at or last_login_at, prefixed with - for descending (default -created_at)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size (default 50, max 100)"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} pagination.Envelope[models.UserProfile]
+// @Failure 400 {object} ErrorResponse "Invalid filter, sort or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users [get]
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseUserFilters(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "csv":
+		h.exportUsersCSV(w, r, filters)
+		return
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid format, must be json or csv")
+		return
+	}
+
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	byCreatedAt := filters.SortBy == "created_at"
+	if page.After != nil && !byCreatedAt {
+		respondWithError(w, http.StatusBadRequest, "cursor requires sort created_at or -created_at; use page with other sorts")
+		return
+	}
+	filters.Limit = page.FetchLimit()
+	filters.Offset = page.Offset
+	filters.After = page.After
+
+	users, total, err := h.userRepo.ListUsersFiltered(r.Context(), filters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list users: "+err.Error())
+		return
+	}
+
+	profiles := make([]models.UserProfile, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, user.ToProfile())
+	}
+
+	var key func(profile models.UserProfile) pagination.Cursor
+	if byCreatedAt {
+		key = func(profile models.UserProfile) pagination.Cursor {
+			return pagination.Cursor{SortValue: profile.CreatedAt, ID: profile.ID}
+		}
+	}
+	respondWithJSON(w, http.StatusOK, pagination.NewEnvelope(page, profiles, key).WithTotal(total))
+}
+
+// GetUserStats returns the dashboard numbers: users by status, role, region
+// and team, logins in the last 24 hours and 7 days, pending invitations and
+// active sessions. They are computed at most once per userStatsTTL.
+// GET /api/v1/admin/users/stats
+// @Summary User statistics
+// @Description Dashboard numbers for the user directory
+// @Tags Users
+// @Produce json
+// @Success 200 {object} repositories.UserStats
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/stats [get]
+func (h *UserHandler) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+
+	now := time.Now()
+	if h.stats == nil || now.Sub(h.stats.GeneratedAt) >= userStatsTTL {
+		stats, err := h.userRepo.UserStats(r.Context(), now)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to compute user stats: "+err.Error())
+			return
+		}
+		h.stats = stats
+	}
+
+	respondWithJSON(w, http.StatusOK, h.stats)
+}
+
+// LookupUsers resolves up to 500 user IDs to their name, email, role, team,
+// region and active flag in one call, for services that display users. IDs
+// without a user, or whose user belongs to another tenant, are listed in
+// notFound. Open to admins and to principals
+// with the users:read permission.
+// POST /api/v1/users/lookup
+// @Summary Look up users
+// @Description Resolves user IDs to their public details; returns users keyed by ID and the IDs not found as notFound
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param lookupRequest body UserLookupRequest true "User IDs, at most 500"
+// @Success 200 {object} UserLookupResponse
+// @Failure 400 {object} CodedErrorResponse "Invalid body, no IDs or too many"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Insufficient permissions"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /users/lookup [post]
+func (h *UserHandler) LookupUsers(w http.ResponseWriter, r *http.Request) {
+	var req UserLookupRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		respondWithError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(ids) > maxUserLookupIDs {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("At most %d ids can be looked up at once", maxUserLookupIDs))
+		return
+	}
+
+	now := time.Now()
+	tenantID := middleware.GetTenantID(r)
+	found := make(map[string]UserLookupEntry, len(ids))
+	missing := h.cachedLookups(tenantID, ids, found, now)
+	if len(missing) > 0 {
+		users, err := h.userRepo.GetUsersByIDs(r.Context(), missing)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to look up users: "+err.Error())
+			return
+		}
+		fetched := make(map[string]cachedUserLookup, len(users))
+		for _, user := range users {
+			fetched[user.ID] = cachedUserLookup{
+				entry: UserLookupEntry{
+					Name:     user.Name,
+					Email:    user.Email,
+					Role:     string(user.Role),
+					Team:     user.Team,
+					Region:   user.Region,
+					IsActive: user.IsActive,
+				},
+				tenantID: user.Tenant(),
+			}
+		}
+		h.cacheLookups(fetched, now)
+		for id, lookup := range fetched {
+			// Users of other tenants are not found, as if they did not exist
+			if lookup.tenantID == tenantID {
+				found[id] = lookup.entry
+			}
+		}
+	}
+
+	notFound := []string{}
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			notFound = append(notFound, id)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, UserLookupResponse{Users: found, NotFound: notFound})
+}
+
+// cachedLookups adds the unexpired cached users of tenantID among ids to
+// found and returns the IDs still to be read. Cached users of other tenants
+// are neither found nor read again.
+func (h *UserHandler) cachedLookups(tenantID string, ids []string, found map[string]UserLookupEntry, now time.Time) []string {
+	h.lookupMu.Lock()
+	defer h.lookupMu.Unlock()
+	var missing []string
+	for _, id := range ids {
+		if cached, ok := h.lookupCache[id]; ok && now.Before(cached.expiresAt) {
+			if cached.tenantID == tenantID {
+				found[id] = cached.entry
+			}
+			continue
+		}
+		missing = append(missing, id)
+	}
+	return missing
+}
+
+// cacheLookups keeps looked up users for userLookupTTL
+func (h *UserHandler) cacheLookups(entries map[string]cachedUserLookup, now time.Time) {
+	h.lookupMu.Lock()
+	defer h.lookupMu.Unlock()
+	if len(h.lookupCache)+len(entries) > maxUserLookupCache {
+		h.lookupCache = make(map[string]cachedUserLookup)
+	}
+	for id, lookup := range entries {
+		lookup.expiresAt = now.Add(userLookupTTL)
+		h.lookupCache[id] = lookup
+	}
+}
+
+// exportUsersCSV writes every user matching filters as CSV, one row at a
+// time. Once the first row is out the status can no longer change, so a
+// failure part way through is only logged.
+func (h *UserHandler) exportUsersCSV(w http.ResponseWriter, r *http.Request, filters repositories.UserFilters) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="users-`+time.Now().UTC().Format("2006-01-02")+`.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(userCSVHeader); err != nil {
+		log.Printf("User CSV export failed (requested by %s): %v", middleware.GetUserID(r), err)
+		return
+	}
+
+	rows := 0
+	err := h.userRepo.EachUserFiltered(r.Context(), filters, func(user *models.User) error {
+		lastLogin := ""
+		if user.LastLoginAt != nil {
+			lastLogin = user.LastLoginAt.UTC().Format(time.RFC3339)
+		}
+		rows++
+		return writer.Write([]string{
+			user.ID,
+			csvSafe(user.Name),
+			csvSafe(user.Email),
+			string(user.Role),
+			csvSafe(user.Region),
+			csvSafe(user.Team),
+			strconv.FormatBool(user.IsActive),
+			user.CreatedAt.UTC().Format(time.RFC3339),
+			lastLogin,
+		})
+	})
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		log.Printf("User CSV export failed after %d rows (requested by %s): %v", rows, middleware.GetUserID(r), err)
+		return
+	}
+	log.Printf("User CSV export of %d rows by %s", rows, middleware.GetUserID(r))
+}
+
+// csvSafe keeps spreadsheet applications from evaluating a user-supplied
+// value as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// parseUserFilters reads the filter and sort parameters of the user listing
+func parseUserFilters(r *http.Request) (repositories.UserFilters, error) {
+	query := r.URL.Query()
+	filters := repositories.UserFilters{
+		Role:   strings.TrimSpace(query.Get("role")),
+		Region: strings.TrimSpace(query.Get("region")),
+		Team:   strings.TrimSpace(query.Get("team")),
+		Search: strings.TrimSpace(query.Get("search")),
+	}
+
+	if isActive := query.Get("is_active"); isActive != "" {
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			return filters, errors.New("Invalid is_active, must be true or false")
+		}
+		filters.IsActive = &active
+	}
+
+	if after := query.Get("created_after"); after != "" {
+		t, err := time.Parse(time.RFC3339, after)
+		if err != nil {
+			return filters, errors.New("Invalid created_after date, expected RFC 3339")
+		}
+		filters.CreatedAfter = &t
+	}
+	if before := query.Get("created_before"); before != "" {
+		t, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			return filters, errors.New("Invalid created_before date, expected RFC 3339")
+		}
+		filters.CreatedBefore = &t
+	}
+	if filters.CreatedAfter != nil && filters.CreatedBefore != nil && !filters.CreatedBefore.After(*filters.CreatedAfter) {
+		return filters, errors.New("created_before must be after created_after")
+	}
+
+	sort := query.Get("sort")
+	filters.SortOrder = "asc"
+	if strings.HasPrefix(sort, "-") {
+		sort = strings.TrimPrefix(sort, "-")
+		filters.SortOrder = "desc"
+	}
+	switch sort {
+	case "":
+		filters.SortBy, filters.SortOrder = "created_at", "desc"
+	case "name", "email", "role", "created_at", "last_login_at":
+		filters.SortBy = sort
+	default:
+		return filters, errors.New("Invalid sort, must be name, email, role, created_at or last_login_at")
+	}
+
+	return filters, nil
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+func newUserTestServer(t *testing.T) (*testServer, *memory.UserStore) {
+	t.Helper()
+	users := memory.NewUserStore()
+	h := NewUserHandler(users)
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/admin/users", h.ListUsers)
+	s.handle(http.MethodGet, "/api/v1/admin/users/{id}/data-scope", h.GetUserDataScope)
+	s.handle(http.MethodPut, "/api/v1/admin/users/{id}/data-scope", h.UpdateUserDataScope)
+	s.handle(http.MethodPost, "/api/v1/users/lookup", h.LookupUsers)
+	return s, users
+}
+
+// TestUserHandlerHidesOtherTenants checks a user of another tenant answers
+// exactly as a user that does not exist
+func TestUserHandlerHidesOtherTenants(t *testing.T) {
+	s, users := newUserTestServer(t)
+	admin := users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	colleague := users.Add(&models.User{Email: "rep@acme.test", Role: models.UserRoleSalesRep, IsActive: true, TenantID: "acme"})
+	outsider := users.Add(&models.User{Email: "rep@globex.test", Role: models.UserRoleSalesRep, IsActive: true, TenantID: "globex"})
+
+	if rec := s.do(admin, http.MethodGet, "/api/v1/admin/users/"+colleague.ID+"/data-scope", nil); rec.Code != http.StatusOK {
+		t.Fatalf("same tenant = %d %s, want 200", rec.Code, rec.Body)
+	}
+
+	missing := s.do(admin, http.MethodGet, "/api/v1/admin/users/"+uuid.MustNewUUID()+"/data-scope", nil)
+	other := s.do(admin, http.MethodGet, "/api/v1/admin/users/"+outsider.ID+"/data-scope", nil)
+	if missing.Code != http.StatusNotFound || other.Code != http.StatusNotFound {
+		t.Fatalf("missing = %d, other tenant = %d; want 404 for both", missing.Code, other.Code)
+	}
+	if missing.Body.String() != other.Body.String() {
+		t.Errorf("other tenant body %q differs from the missing user body %q", other.Body, missing.Body)
+	}
+}
+
+// TestUserHandlerHidesUsersOutOfScope checks users outside the caller's
+// users data scope are not found rather than forbidden
+func TestUserHandlerHidesUsersOutOfScope(t *testing.T) {
+	s, users := newUserTestServer(t)
+	manager := users.Add(&models.User{Email: "manager@example.com", Role: models.UserRoleManager, IsActive: true, Team: "north"})
+	teammate := users.Add(&models.User{Email: "north@example.com", Role: models.UserRoleSalesRep, IsActive: true, Team: "north"})
+	stranger := users.Add(&models.User{Email: "south@example.com", Role: models.UserRoleSalesRep, IsActive: true, Team: "south"})
+
+	ctx := context.WithValue(context.Background(), middleware.DataScopeKey, models.DataScope{Users: "team"})
+	if rec := s.doContext(ctx, manager, http.MethodGet, "/api/v1/admin/users/"+teammate.ID+"/data-scope", nil); rec.Code != http.StatusOK {
+		t.Errorf("teammate = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if rec := s.doContext(ctx, manager, http.MethodGet, "/api/v1/admin/users/"+stranger.ID+"/data-scope", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("other team = %d %s, want 404", rec.Code, rec.Body)
+	}
+}
+
+// TestUserDataScopeUpdates sets, merges and clears a user's override and
+// rejects unknown resources and values
+func TestUserDataScopeUpdates(t *testing.T) {
+	s, users := newUserTestServer(t)
+	admin := users.Add(&models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true})
+	rep := users.Add(&models.User{Email: "rep@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+	target := "/api/v1/admin/users/" + rep.ID + "/data-scope"
+
+	update := func(body interface{}) (int, UserDataScopeResponse) {
+		t.Helper()
+		rec := s.do(admin, http.MethodPut, target, body)
+		var scope UserDataScopeResponse
+		if rec.Code == http.StatusOK {
+			decodeBody(t, rec, &scope)
+		}
+		return rec.Code, scope
+	}
+
+	code, scope := update(map[string]string{"users": "Team", "customers": "own"})
+	if code != http.StatusOK {
+		t.Fatalf("update = %d", code)
+	}
+	if want := (models.DataScope{Customers: "own", Users: "team"}); scope.Override == nil || *scope.Override != want || scope.Effective != want {
+		t.Errorf("scope = %+v, want the override %+v", scope, want)
+	}
+
+	// Resources left out keep their value; an empty value clears one
+	if _, scope = update(map[string]string{"campaigns": "all", "customers": ""}); scope.Override == nil ||
+		*scope.Override != (models.DataScope{Campaigns: "all", Users: "team"}) {
+		t.Errorf("override after the second update = %+v", scope.Override)
+	}
+	stored, err := users.GetByID(context.Background(), rep.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DataScope == nil || *stored.DataScope != (models.DataScope{Campaigns: "all", Users: "team"}) {
+		t.Errorf("stored override = %+v", stored.DataScope)
+	}
+
+	for _, body := range []interface{}{
+		map[string]string{"invoices": "all"},
+		map[string]string{"users": "everyone"},
+		`["users"]`,
+	} {
+		if code, _ := update(body); code != http.StatusBadRequest {
+			t.Errorf("update with %v = %d, want 400", body, code)
+		}
+	}
+
+	// Clearing every resource removes the override
+	if _, scope = update(map[string]string{"campaigns": "", "users": ""}); scope.Override != nil {
+		t.Errorf("override after clearing = %+v, want none", scope.Override)
+	}
+	if rec := s.do(admin, http.MethodGet, target, nil); rec.Code != http.StatusOK {
+		t.Errorf("get = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLookupUsersHidesOtherTenants(t *testing.T) {
+	s, users := newUserTestServer(t)
+	admin := users.Add(&models.User{Email: "admin@acme.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "acme"})
+	outsider := users.Add(&models.User{Email: "rep@globex.test", Role: models.UserRoleSalesRep, IsActive: true, TenantID: "globex"})
+	globexAdmin := users.Add(&models.User{Email: "admin@globex.test", Role: models.UserRoleAdmin, IsActive: true, TenantID: "globex"})
+
+	var result UserLookupResponse
+	// Twice, so the second lookup is answered from the cache
+	for i := 0; i < 2; i++ {
+		rec := s.do(admin, http.MethodPost, "/api/v1/users/lookup", UserLookupRequest{IDs: []string{admin.ID, outsider.ID}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("lookup = %d %s", rec.Code, rec.Body)
+		}
+		decodeBody(t, rec, &result)
+		if _, ok := result.Users[outsider.ID]; ok || len(result.NotFound) != 1 || result.NotFound[0] != outsider.ID {
+			t.Fatalf("lookup %d = %+v, want the other tenant's user not found", i+1, result)
+		}
+	}
+
+	// The cached entry still serves its own tenant
+	rec := s.do(globexAdmin, http.MethodPost, "/api/v1/users/lookup", UserLookupRequest{IDs: []string{outsider.ID}})
+	decodeBody(t, rec, &result)
+	if _, ok := result.Users[outsider.ID]; !ok {
+		t.Errorf("lookup by the user's own tenant = %+v, want the user", result)
+	}
+}
+
+// seedLookupUsers adds n users of one tenant and returns their IDs
+func seedLookupUsers(users *memory.UserStore, n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = users.Add(&models.User{Email: fmt.Sprintf("rep%d@acme.test", i), Role: models.UserRoleSalesRep, IsActive: true, TenantID: "acme"}).ID
+	}
+	return ids
+}
+
+// BenchmarkGetByID500 resolves 500 users one store call at a time, as
+// downstream services did before the batch lookup. Against Mongo each call
+// is also a round trip, reported as calls/op.
+func BenchmarkGetByID500(b *testing.B) {
+	users := memory.NewUserStore()
+	ids := seedLookupUsers(users, maxUserLookupIDs)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, id := range ids {
+			if _, err := users.GetByID(ctx, id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(len(ids)), "calls/op")
+}
+
+// BenchmarkGetByIDs500 resolves the same 500 users in the one store call
+// the lookup endpoint makes
+func BenchmarkGetByIDs500(b *testing.B) {
+	users := memory.NewUserStore()
+	ids := seedLookupUsers(users, maxUserLookupIDs)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		found, err := users.GetUsersByIDs(ctx, ids)
+		if err != nil || len(found) != len(ids) {
+			b.Fatalf("found %d of %d: %v", len(found), len(ids), err)
+		}
+	}
+	b.ReportMetric(1, "calls/op")
+}
+
+// TestUserStatsAreReusedForAMinute counts users by status, role and team and
+// checks a second request within userStatsTTL gets the same numbers
+func TestUserStatsAreReusedForAMinute(t *testing.T) {
+	s, users := newUserTestServer(t)
+	h := NewUserHandler(users)
+	s.handle(http.MethodGet, "/api/v1/users/stats", h.GetUserStats)
+
+	now := time.Now()
+	recent, lastWeek := now.Add(-time.Hour), now.Add(-72*time.Hour)
+	inviteExpiry, expired := now.Add(48*time.Hour), now.Add(-time.Hour)
+	admin := users.Add(&models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true, Team: "ops", LastLoginAt: &recent})
+	users.Add(&models.User{Email: "rep1@example.com", Role: models.UserRoleSalesRep, IsActive: true, Team: "north", LastLoginAt: &lastWeek})
+	users.Add(&models.User{Email: "rep2@example.com", Role: models.UserRoleSalesRep, Team: "north"})
+	users.Add(&models.User{Email: "new@example.com", Role: models.UserRoleSalesRep, Status: "invited", InviteExpiry: &inviteExpiry})
+	users.Add(&models.User{Email: "late@example.com", Role: models.UserRoleManager, Status: "invited", InviteExpiry: &expired})
+	for _, session := range []*models.Session{
+		{TokenID: "live", RefreshToken: "live", UserID: admin.ID, ExpiresAt: now.Add(time.Hour)},
+		{TokenID: "revoked", RefreshToken: "revoked", UserID: admin.ID, ExpiresAt: now.Add(time.Hour), IsRevoked: true},
+		{TokenID: "expired", RefreshToken: "expired", UserID: admin.ID, ExpiresAt: now.Add(-time.Hour)},
+	} {
+		if err := users.CreateSession(context.Background(), session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats repositories.UserStats
+	rec := s.do(admin, http.MethodGet, "/api/v1/users/stats", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stats = %d %s", rec.Code, rec.Body)
+	}
+	decodeBody(t, rec, &stats)
+	want := repositories.UserStats{
+		Total:              5,
+		ByStatus:           map[string]int64{"active": 2, "invited": 2, "deactivated": 1},
+		ByRole:             map[string]int64{"admin": 1, "sales_rep": 3, "manager": 1},
+		ByTeam:             map[string]int64{"ops": 1, "north": 2, "": 2},
+		LoginsLast24h:      1,
+		LoginsLast7d:       2,
+		PendingInvitations: 1,
+		ActiveSessions:     1,
+	}
+	if stats.Total != want.Total || !maps.Equal(stats.ByStatus, want.ByStatus) || !maps.Equal(stats.ByRole, want.ByRole) || !maps.Equal(stats.ByTeam, want.ByTeam) ||
+		stats.LoginsLast24h != want.LoginsLast24h || stats.LoginsLast7d != want.LoginsLast7d ||
+		stats.PendingInvitations != want.PendingInvitations || stats.ActiveSessions != want.ActiveSessions {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	users.Add(&models.User{Email: "rep3@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+	var again repositories.UserStats
+	decodeBody(t, s.do(admin, http.MethodGet, "/api/v1/users/stats", nil), &again)
+	if again.Total != stats.Total || !again.GeneratedAt.Equal(stats.GeneratedAt) {
+		t.Errorf("second request = %d users generated at %s, want the numbers of %s reused", again.Total, again.GeneratedAt, stats.GeneratedAt)
+	}
+}
+
+// TestUserCursorPagesSurviveInserts pages through the users by cursor while
+// users are created between the pages, and checks every user listed before
+// the first page shows up exactly once
+func TestUserCursorPagesSurviveInserts(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for _, sort := range []string{"-created_at", "created_at"} {
+		s, users := newUserTestServer(t)
+		admin := users.Add(&models.User{Email: "admin@example.com", Name: "admin", Role: models.UserRoleAdmin, IsActive: true, CreatedAt: start})
+		existing := []string{admin.Email}
+		for i := 1; i <= 6; i++ {
+			// Pairs created at the same instant, ordered by ID alone
+			user := users.Add(&models.User{Email: fmt.Sprintf("rep%d@example.com", i), Name: fmt.Sprintf("rep%d", i), Role: models.UserRoleSalesRep, IsActive: true, CreatedAt: start.Add(time.Duration((i+1)/2) * time.Minute)})
+			existing = append(existing, user.Email)
+		}
+
+		var seen []string
+		created := 0
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(existing) {
+				t.Fatalf("sort %s: still paging after %d pages", sort, pages)
+			}
+			query := url.Values{"limit": {"2"}, "sort": {sort}}
+			if cursor != "" {
+				query.Set("cursor", cursor)
+			}
+			rec := s.do(admin, http.MethodGet, "/api/v1/admin/users?"+query.Encode(), nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("sort %s page %d = %d %s", sort, pages+1, rec.Code, rec.Body)
+			}
+			var page pagination.Envelope[models.UserProfile]
+			decodeBody(t, rec, &page)
+			for _, profile := range page.Items {
+				seen = append(seen, profile.Email)
+			}
+			if !page.HasMore {
+				if page.NextCursor != "" {
+					t.Errorf("sort %s: last page has next_cursor %q", sort, page.NextCursor)
+				}
+				break
+			}
+			cursor = page.NextCursor
+
+			// A newer user between every two pages
+			created++
+			users.Add(&models.User{Email: fmt.Sprintf("new%d@example.com", created), Name: "new", Role: models.UserRoleSalesRep, IsActive: true, CreatedAt: start.Add(time.Hour + time.Duration(created)*time.Minute)})
+		}
+
+		for _, email := range existing {
+			if n := countOf(seen, email); n != 1 {
+				t.Errorf("sort %s: %s listed %d times in %v", sort, email, n, seen)
+			}
+		}
+		// Newest first, users created meanwhile sort before the cursor; oldest
+		// first, they are all still ahead of it
+		newer := len(seen) - len(existing)
+		if sort == "-created_at" && newer != 0 || sort == "created_at" && newer != created {
+			t.Errorf("sort %s: %d of the %d users created while paging listed: %v", sort, newer, created, seen)
+		}
+	}
+}
+
+// countOf counts the occurrences of value in values
+func countOf(values []string, value string) int {
+	n := 0
+	for _, v := range values {
+		if v == value {
+			n++
+		}
+	}
+	return n
+}
+
+func TestUserCursorRequiresCreatedAtSort(t *testing.T) {
+	s, users := newUserTestServer(t)
+	admin := users.Add(&models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true})
+	cursor := pagination.Cursor{SortValue: time.Now(), ID: admin.ID}.Encode()
+
+	for _, query := range []string{"sort=name&cursor=" + cursor, "cursor=garbage", "cursor=" + cursor + "&page=2"} {
+		if rec := s.do(admin, http.MethodGet, "/api/v1/admin/users?"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// UserReportsResponse lists the users reporting directly to a user
+type UserReportsResponse struct {
+	UserID  string               `json:"userId"`
+	Reports []models.UserProfile `json:"reports"`
+}
+
+// ManagementChainResponse lists the managers above a user, nearest first
+type ManagementChainResponse struct {
+	UserID    string               `json:"userId"`
+	Managers  []models.UserProfile `json:"managers"`
+	Truncated bool                 `json:"truncated"` // The chain goes on past the depth cap
+}
+
+// GetUserReports returns the users whose manager is the user
+// GET /api/v1/admin/users/{id}/reports
+// @Summary List a user's direct reports
+// @Description Returns the users whose manager is this user, sorted by name
+// @Tags Users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} UserReportsResponse
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/reports [get]
+func (h *UserHandler) GetUserReports(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	reports, err := h.hierarchy.DirectReports(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list direct reports: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, UserReportsResponse{UserID: user.ID, Reports: userProfiles(reports)})
+}
+
+// GetUserManagementChain returns the user's manager, that manager's manager
+// and so on up to
+// services.MaxManagementDepth managers
+// GET /api/v1/admin/users/{id}/management-chain
+// @Summary Get a user's management chain
+// @Description Returns the managers above this user, nearest first, up to 20; truncated is set when the chain goes on past them
+// @Tags Users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} ManagementChainResponse
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/management-chain [get]
+func (h *UserHandler) GetUserManagementChain(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	chain, truncated, err := h.hierarchy.ManagementChain(r.Context(), user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to walk the management chain: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, ManagementChainResponse{UserID: user.ID, Managers: userProfiles(chain), Truncated: truncated})
+}
+
+// userProfiles returns the API representation of users
+func userProfiles(users []*models.User) []models.UserProfile {
+	profiles := make([]models.UserProfile, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, user.ToProfile())
+	}
+	return profiles
+}
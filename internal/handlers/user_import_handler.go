@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+const (
+	// maxUserImportBytes bounds an uploaded import file
+	maxUserImportBytes = 5 << 20
+
+	// userImportSyncRows is the most rows imported during the request;
+	// larger files are always imported in the background
+	userImportSyncRows = 1000
+)
+
+// UserImportHandler imports users from CSV files
+type UserImportHandler struct {
+	importer       *services.UserImporter
+	imports        *repositories.UserImportRepository
+	auditPublisher *events.AuditPublisher
+}
+
+// NewUserImportHandler creates a new UserImportHandler
+// auditPublisher can be nil - imports are then not audited
+func NewUserImportHandler(importer *services.UserImporter, imports *repositories.UserImportRepository, auditPublisher *events.AuditPublisher) *UserImportHandler {
+	return &UserImportHandler{importer: importer, imports: imports, auditPublisher: auditPublisher}
+}
+
+// ImportUsers godoc
+// @Summary Import users from CSV
+// @Description Creates invited users from a CSV file (multipart field "file", at most 5 MB and 10,000 rows) with the columns email, first name, last name, role, region, team and job title; only email and a name are required. Each row is validated (email, role, active region and team, duplicates in the file) and rows that fail are reported without stopping the others. Users that already exist are skipped, so a file can be imported again. Set send_invites=false to create the users without emailing their invitations, which can be resent later. Files over 1,000 rows, or any file with async=true, are imported in the background: the response is 202 with the job to poll.
+// @Tags Users
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV file"
+// @Param send_invites formData bool false "Email the invitations (default true)"
+// @Param async formData bool false "Import in the background"
+// @Success 200 {object} models.UserImportJob "Imported, with the report of every row"
+// @Success 202 {object} models.UserImportJob "Importing in the background"
+// @Failure 400 {object} CodedErrorResponse "Invalid file or form"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 413 {object} ErrorResponse "File too large"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/import [post]
+func (h *UserImportHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUserImportBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(maxUserImportBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "File exceeds the maximum import size of 5 MB")
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Invalid multipart form: "+err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	sendInvites, err := formBool(r, "send_invites", true)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+	async, err := formBool(r, "async", false)
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "A CSV file is required in the \"file\" field")
+		return
+	}
+	defer file.Close()
+
+	// Kept in memory so a background import outlives the request's temp files
+	data, err := io.ReadAll(io.LimitReader(file, maxUserImportBytes+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read uploaded file")
+		return
+	}
+	if len(data) > maxUserImportBytes {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File exceeds the maximum import size of 5 MB")
+		return
+	}
+
+	rows, err := h.importer.CountRows(bytes.NewReader(data))
+	if err != nil {
+		code := "INVALID_IMPORT_FILE"
+		if errors.Is(err, services.ErrUserImportTooLarge) {
+			code = "IMPORT_TOO_LARGE"
+		}
+		respondWithErrorCode(w, http.StatusBadRequest, code, "Invalid import file: "+err.Error())
+		return
+	}
+
+	actorID := middleware.GetUserID(r)
+	now := time.Now()
+	job := &models.UserImportJob{
+		ID:          uuid.MustNewUUID(),
+		Status:      models.UserImportRunning,
+		Filename:    header.Filename,
+		SendInvites: sendInvites,
+		CreatedBy:   actorID,
+		TenantID:    middleware.GetTenantID(r),
+		TotalRows:   rows,
+		Rows:        []models.UserImportRow{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := h.imports.CreateJob(r.Context(), job); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start import: "+err.Error())
+		return
+	}
+
+	if h.auditPublisher != nil {
+		actorName, _ := r.Context().Value(middleware.NameKey).(string)
+		h.auditPublisher.PublishTeamEvent(r, actorID, actorName, events.ActionTeamMemberAdded,
+			job.ID, fmt.Sprintf("User import started: %d rows from %s (send invites: %t)", rows, header.Filename, sendInvites))
+	}
+
+	// The import finishes even if the client goes away
+	ctx := context.WithoutCancel(r.Context())
+	if async || rows > userImportSyncRows {
+		accepted := *job
+		go func() {
+			if err := h.importer.Run(ctx, job, bytes.NewReader(data)); err != nil {
+				log.Printf("Warning: user import %s stopped: %v", job.ID, err)
+			}
+		}()
+		w.Header().Set("Location", "/api/v1/admin/users/import/"+accepted.ID)
+		respondWithJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	if err := h.importer.Run(ctx, job, bytes.NewReader(data)); err != nil {
+		log.Printf("Warning: user import %s stopped: %v", job.ID, err)
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// GetUserImport godoc
+// @Summary Get a user import
+// @Description Returns the progress of a user import and the report of the rows processed so far. With format=csv the report is downloaded as CSV (line, email, status, user_id, reason).
+// @Tags Users
+// @Produce json,text/csv
+// @Param jobID path string true "Import job ID"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} models.UserImportJob
+// @Failure 400 {object} ErrorResponse "Invalid job ID or format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Import not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/import/{jobID} [get]
+func (h *UserImportHandler) GetUserImport(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.ParseUUID(mux.Vars(r)["jobID"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import job ID format")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		respondWithError(w, http.StatusBadRequest, "Invalid format, must be json or csv")
+		return
+	}
+
+	job, err := h.imports.GetJob(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserImportNotFound) {
+			respondWithError(w, http.StatusNotFound, "Import not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve import: "+err.Error())
+		return
+	}
+
+	if format != "csv" {
+		respondWithJSON(w, http.StatusOK, job)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-import-%s.csv"`, job.ID))
+	w.WriteHeader(http.StatusOK)
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"line", "email", "status", "user_id", "reason"})
+	for _, row := range job.Rows {
+		writer.Write([]string{strconv.Itoa(row.Line), csvSafe(row.Email), row.Status, row.UserID, csvSafe(row.Reason)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("User import report %s download failed: %v", job.ID, err)
+	}
+}
+
+// formBool reads an optional boolean form field
+func formBool(r *http.Request, name string, fallback bool) (bool, error) {
+	value := strings.TrimSpace(r.FormValue(name))
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value, must be true or false", name)
+	}
+	return b, nil
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// minWebhookSecretLength is the shortest signing secret accepted from the caller
+const minWebhookSecretLength = 16
+
+// WebhookSubscriptionHandler manages the webhook subscriptions that receive
+// user lifecycle events, and their delivery log
+type WebhookSubscriptionHandler struct {
+	repo       *repositories.WebhookRepository
+	dispatcher *services.WebhookDispatcher
+}
+
+// NewWebhookSubscriptionHandler creates a new WebhookSubscriptionHandler
+func NewWebhookSubscriptionHandler(repo *repositories.WebhookRepository, dispatcher *services.WebhookDispatcher) *WebhookSubscriptionHandler {
+	return &WebhookSubscriptionHandler{repo: repo, dispatcher: dispatcher}
+}
+
+// WebhookSubscriptionCreated is the create response, the only one that
+// includes the signing secret
+type WebhookSubscriptionCreated struct {
+	*models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookListResponse is the webhook subscriptions with the event types they
+// can subscribe to
+type WebhookListResponse struct {
+	Webhooks   []*models.WebhookSubscription `json:"webhooks"`
+	EventTypes []string                      `json:"eventTypes"`
+}
+
+// ListWebhooks lists every webhook subscription, newest first
+// GET /api/v1/admin/webhooks
+// @Summary List webhooks
+// @Description Lists every webhook subscription, newest first
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {object} WebhookListResponse "webhooks"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/webhooks [get]
+func (h *WebhookSubscriptionHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.repo.ListSubscriptions(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list webhooks: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, WebhookListResponse{
+		Webhooks:   subs,
+		EventTypes: models.WebhookEventTypes,
+	})
+}
+
+// CreateWebhook creates a webhook subscription. The signing secret is
+// generated when none is given and is only returned in this response.
+// POST /api/v1/admin/webhooks
+// @Summary Create a webhook
+// @Description Creates a webhook subscription. The signing secret is generated when none is given and only returned here.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param webhookRequest body models.CreateWebhookSubscriptionRequest true "Subscription"
+// @Success 201 {object} WebhookSubscriptionCreated
+// @Failure 400 {object} CodedErrorResponse "Invalid body, URL, event types or secret"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/webhooks [post]
+func (h *WebhookSubscriptionHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWebhookSubscriptionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if err := validateWebhookURL(req.URL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateWebhookEventTypes(req.EventTypes); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to generate webhook secret")
+			return
+		}
+		req.Secret = secret
+	} else if len(req.Secret) < minWebhookSecretLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("secret must be at least %d characters", minWebhookSecretLength))
+		return
+	}
+
+	now := time.Now()
+	sub := &models.WebhookSubscription{
+		ID:          uuid.MustNewUUID(),
+		URL:         req.URL,
+		Description: strings.TrimSpace(req.Description),
+		Secret:      req.Secret,
+		EventTypes:  req.EventTypes,
+		IsActive:    req.IsActive == nil || *req.IsActive,
+		CreatedBy:   middleware.GetUserID(r),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+	if err := h.repo.CreateSubscription(r.Context(), sub); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create webhook: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, WebhookSubscriptionCreated{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// GetWebhook returns a webhook subscription
+// GET /api/v1/admin/webhooks/{id}
+// @Summary Get a webhook
+// @Tags Webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 400 {object} ErrorResponse "Invalid webhook ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Webhook not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/webhooks/{id} [get]
+func (h *WebhookSubscriptionHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.loadSubscription(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, sub)
+}
+
+// UpdateWebhook changes the given fields of a webhook subscription.
+// Re-activating a disabled subscription clears its failure count.
+// PUT /api/v1/admin/webhooks/{id}
+// @Summary Update a webhook
+// @Description Changes the fields sent. Re-activating a disabled subscription clears its failure count.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param webhookRequest body models.UpdateWebhookSubscriptionRequest true "Fields to update"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 400 {object} CodedErrorResponse "Invalid webhook ID, body, URL, event types or secret"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Webhook not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/webhooks/{id} [put]
+func (h *WebhookSubscriptionHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateWebhookSubscriptionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if req.URL != nil {
+		trimmed := strings.TrimSpace(*req.URL)
+		if err := validateWebhookURL(trimmed); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.URL = &trimmed
+	}
+	if req.EventTypes != nil {
+		if err := validateWebhookEventTypes(*req.EventTypes); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Secret != nil && len(*req.Secret) < minWebhookSecretLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("secret must be at least %d characters", minWebhookSecretLength))
+		return
+	}
+
+	id, ok := webhookIDParam(w, r)
+	if !ok {
+		return
+	}
+	sub, err := h.repo.UpdateSubscription(r.Context(), id, &req, time.Now())
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to update webhook: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, sub)
+}
+
+// DeleteWebhook deletes a webhook subscription and its delivery log
+// DELETE /api/v1/admin/webhooks/{id}
+// @Summary Delete a webhook
+// @Description Deletes the subscription and its delivery log
+// @Tags Webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse "Invalid webhook ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Webhook not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/webhooks/{id} [delete]
+func (h *WebhookSubscriptionHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.DeleteSubscription(r.Context(), id); err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete webhook: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted successfully"})
+}
+
+// WebhookDeliveryListResponse is a page of a webhook's deliveries
+type WebhookDeliveryListResponse struct {
+	Deliveries []*models.WebhookDelivery `json:"deliveries"`
+	Total      int64                     `json:"total"`
+	Page       int                       `json:"page"`
+	Limit      int                       `json:"limit"`
+	TotalPages int                       `json:"totalPages"`
+}
+
+// ListWebhookDeliveries lists the deliveries of a webhook subscription newest
+// first, paginated with page/limit. status=pending|succeeded|failed filters
+// by outcome.
+// GET /api/v1/admin/webhooks/{id}/deliveries
+// @Summary List webhook deliveries
+// @Description Lists the deliveries of a subscription newest first
+// @Tags Webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "pending, succeeded or failed"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size"
+// @Success 200 {object} WebhookDeliveryListResponse "deliveries, total, page, limit"
+// @Failure 400 {object} ErrorResponse "Invalid webhook ID, status or pagination"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Webhook not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/webhooks/{id}/deliveries [get]
+func (h *WebhookSubscriptionHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.loadSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryFailed:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid status, must be pending, succeeded or failed")
+		return
+	}
+
+	page, limit, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, total, err := h.repo.ListDeliveries(r.Context(), sub.ID, status, limit, (page-1)*limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list webhook deliveries: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, WebhookDeliveryListResponse{
+		Deliveries: deliveries,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: (int(total) + limit - 1) / limit,
+	})
+}
+
+// TestWebhook sends a webhook.test event to a subscription right away and
+// returns the logged delivery, so a receiver can be checked before real
+// events flow. Inactive subscriptions can be tested too.
+// POST /api/v1/admin/webhooks/{id}/test
+// @Summary Test a webhook
+// @Description Sends a webhook.test event right away and returns the logged delivery
+// @Tags Webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 400 {object} ErrorResponse "Invalid webhook ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Admins only"
+// @Failure 404 {object} ErrorResponse "Webhook not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security BearerAuth
+// @Router /admin/webhooks/{id}/test [post]
+func (h *WebhookSubscriptionHandler) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.loadSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.dispatcher.SendTest(r.Context(), sub, middleware.GetUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send test event: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, delivery)
+}
+
+// loadSubscription loads the subscription named by the {id} path variable,
+// responding with 404 when it does not exist
+func (h *WebhookSubscriptionHandler) loadSubscription(w http.ResponseWriter, r *http.Request) (*models.WebhookSubscription, bool) {
+	id, ok := webhookIDParam(w, r)
+	if !ok {
+		return nil, false
+	}
+	sub, err := h.repo.GetSubscription(r.Context(), id)
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "Webhook not found")
+			return nil, false
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to get webhook: "+err.Error())
+		return nil, false
+	}
+	return sub, true
+}
+
+// validateWebhookURL requires an absolute http or https URL
+func validateWebhookURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// validateWebhookEventTypes rejects event types that cannot be subscribed to
+func validateWebhookEventTypes(eventTypes []string) error {
+	for _, eventType := range eventTypes {
+		if !models.IsWebhookEventType(eventType) {
+			return fmt.Errorf("unknown event type %q, must be one of %s", eventType, strings.Join(models.WebhookEventTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// generateWebhookSecret generates a random signing secret
+func generateWebhookSecret() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(bytes), nil
+}
+
+// webhookIDParam reads the {id} path variable, responding with 400 when it
+// is not a UUID
+func webhookIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id, err := uuid.ParseUUID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return "", false
+	}
+	return id, true
+}
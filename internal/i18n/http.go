@@ -0,0 +1,78 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying t, for the emails sent while handling a
+// request
+func NewContext(ctx context.Context, t *Translator) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the translator carried by ctx, English when none is
+func FromContext(ctx context.Context) *Translator {
+	if t, ok := ctx.Value(contextKey{}).(*Translator); ok {
+		return t
+	}
+	return English()
+}
+
+// WithPreference returns ctx carrying the translator of a language
+// preference, such as the one of the recipient of an email. ctx is returned
+// as it is when no catalog matches the preference.
+func WithPreference(ctx context.Context, preference string) context.Context {
+	if t, ok := For(preference); ok {
+		return NewContext(ctx, t)
+	}
+	return ctx
+}
+
+// responseWriter carries the translator of a request to the code writing
+// its error responses, which only sees the response writer
+type responseWriter struct {
+	http.ResponseWriter
+	t *Translator
+}
+
+// Unwrap returns the wrapped response writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Attach makes t the translator of a request: it is carried by the returned
+// request's context and response writer, and named in the Content-Language
+// header. A translator attached earlier is replaced.
+func Attach(w http.ResponseWriter, r *http.Request, t *Translator) (http.ResponseWriter, *http.Request) {
+	if attached, ok := w.(*responseWriter); ok {
+		w = attached.ResponseWriter
+	}
+	w.Header().Set("Content-Language", t.Locale())
+	return &responseWriter{ResponseWriter: w, t: t}, r.WithContext(NewContext(r.Context(), t))
+}
+
+// FromResponse returns the translator attached to w, English when none is
+func FromResponse(w http.ResponseWriter) *Translator {
+	for {
+		switch v := w.(type) {
+		case *responseWriter:
+			return v.t
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return English()
+		}
+	}
+}
+
+// Middleware attaches the translator of the request's Accept-Language
+// header. Authenticated routes may replace it with the user's preference.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r = Attach(w, r, Negotiate("", r.Header.Get("Accept-Language")))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,272 @@
+// Package i18n translates the text the API shows to people: the system
+// emails and the error messages of responses. Audit records and logs are
+// not translated; they stay in English.
+//
+// Each language is one embedded catalog, locales/<locale>.json, holding
+// the email texts under "messages", by key, and the translations of error
+// messages under "errors", by their English text. English is the reference:
+// its catalog lists every key and message, and any a catalog lacks is shown
+// in English. Adding a language takes only a new catalog file; Untranslated
+// lists what a catalog still lacks.
+//
+// Texts take named values as {name} placeholders, filled in by Format.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the language of the reference catalog, used for anything
+// no other catalog translates
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalog is the content of one locales/<locale>.json file
+type catalog struct {
+	Locale   string            `json:"locale"`   // BCP 47 tag, the file name without .json
+	Name     string            `json:"name"`     // The language's own name for itself
+	Aliases  []string          `json:"aliases"`  // Other names preferences may use, e.g. "english"
+	Messages map[string]string `json:"messages"` // Email texts by key
+	Errors   map[string]string `json:"errors"`   // Error messages by their English text
+}
+
+// catalogs maps each locale to its catalog, and names maps every locale and
+// alias, lowercased, to its locale. The catalogs are part of the binary, so
+// a broken one is a build defect and panics at startup.
+var catalogs, names = mustLoad()
+
+func mustLoad() (map[string]*catalog, map[string]string) {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: %v", err))
+	}
+	catalogs := make(map[string]*catalog, len(entries))
+	names := make(map[string]string)
+	for _, entry := range entries {
+		content, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: %v", err))
+		}
+		var c catalog
+		if err := json.Unmarshal(content, &c); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", entry.Name(), err))
+		}
+		if c.Locale+".json" != entry.Name() {
+			panic(fmt.Sprintf("i18n: catalog %s is for locale %q", entry.Name(), c.Locale))
+		}
+		catalogs[c.Locale] = &c
+		names[strings.ToLower(c.Locale)] = c.Locale
+		for _, alias := range c.Aliases {
+			names[strings.ToLower(alias)] = c.Locale
+		}
+	}
+	if catalogs[DefaultLocale] == nil {
+		panic("i18n: no catalog for " + DefaultLocale)
+	}
+	return catalogs, names
+}
+
+// Translator shows text in one language, falling back to English for what
+// its catalog does not translate. The zero of *Translator, nil, is English.
+type Translator struct {
+	catalog *catalog
+}
+
+// English returns the translator of the reference catalog
+func English() *Translator {
+	return &Translator{catalog: catalogs[DefaultLocale]}
+}
+
+// Locale returns the locale the translator shows text in
+func (t *Translator) Locale() string {
+	if t == nil {
+		return DefaultLocale
+	}
+	return t.catalog.Locale
+}
+
+// Message returns the text of the message with key, in English when the
+// catalog has none and key itself when no catalog has it
+func (t *Translator) Message(key string) string {
+	if t != nil {
+		if text := t.catalog.Messages[key]; text != "" {
+			return text
+		}
+	}
+	if text := catalogs[DefaultLocale].Messages[key]; text != "" {
+		return text
+	}
+	return key
+}
+
+// Text returns the message with key with its placeholders filled in from
+// args, given as name, value pairs
+func (t *Translator) Text(key string, args ...any) string {
+	return Format(t.Message(key), args...)
+}
+
+// Error translates an error message of a response. Messages ending in
+// details, "Failed to get user: <cause>", are translated by what precedes
+// the first ": " and keep the details as they are. Messages the catalog
+// does not know are returned unchanged.
+func (t *Translator) Error(message string) string {
+	if t == nil || t.catalog.Locale == DefaultLocale {
+		return message
+	}
+	if text := t.catalog.Errors[message]; text != "" {
+		return text
+	}
+	if prefix, details, ok := strings.Cut(message, ": "); ok {
+		if text := t.catalog.Errors[prefix]; text != "" {
+			return text + ": " + details
+		}
+	}
+	return message
+}
+
+// Format fills the {name} placeholders of text from args, given as name,
+// value pairs. Placeholders without a value are left as they are.
+func Format(text string, args ...any) string {
+	if len(args) < 2 {
+		return text
+	}
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// For returns the translator of the language tag names, matched exactly,
+// by an alias such as "english" or by its base language ("es-MX" uses
+// "es"). The second result is false, with English, when no catalog matches.
+func For(tag string) (*Translator, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if tag == "" {
+		return English(), false
+	}
+	if locale, ok := names[tag]; ok {
+		return &Translator{catalog: catalogs[locale]}, true
+	}
+	if base, _, ok := strings.Cut(tag, "-"); ok {
+		if locale, ok := names[base]; ok {
+			return &Translator{catalog: catalogs[locale]}, true
+		}
+	}
+	return English(), false
+}
+
+// Negotiate returns the translator of the first language available of the
+// user's preference, then the languages of an Accept-Language header by
+// their weight, then English
+func Negotiate(preference, acceptLanguage string) *Translator {
+	if t, ok := For(preference); ok {
+		return t
+	}
+	for _, tag := range acceptedLanguages(acceptLanguage) {
+		if t, ok := For(tag); ok {
+			return t
+		}
+	}
+	return English()
+}
+
+// acceptedLanguages returns the tags of an Accept-Language header, most
+// wanted first, leaving out those weighted 0 and the * wildcard
+func acceptedLanguages(header string) []string {
+	type weighted struct {
+		tag    string
+		weight float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if weight > 0 {
+			tags = append(tags, weighted{tag: tag, weight: weight})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].weight > tags[j].weight })
+
+	out := make([]string, len(tags))
+	for i, tag := range tags {
+		out[i] = tag.tag
+	}
+	return out
+}
+
+// Locales returns the locale of every catalog, sorted
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// placeholderPattern matches the {name} placeholders of a text
+var placeholderPattern = regexp.MustCompile(`\{[A-Za-z]+\}`)
+
+// Untranslated lists, by locale, the message keys and error messages of
+// the English catalog that another catalog lacks, and those whose
+// translation does not use the same placeholders. Locales translating
+// everything are left out. Startup logs what it returns.
+func Untranslated() map[string][]string {
+	reference := catalogs[DefaultLocale]
+	out := make(map[string][]string)
+	for locale, c := range catalogs {
+		if locale == DefaultLocale {
+			continue
+		}
+		var missing []string
+		for key, text := range reference.Messages {
+			if !samePlaceholders(text, c.Messages[key]) {
+				missing = append(missing, key)
+			}
+		}
+		for message := range reference.Errors {
+			if c.Errors[message] == "" {
+				missing = append(missing, "errors: "+message)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			out[locale] = missing
+		}
+	}
+	return out
+}
+
+// samePlaceholders reports whether translation is set and uses every
+// placeholder of text and no other
+func samePlaceholders(text, translation string) bool {
+	if translation == "" {
+		return false
+	}
+	want := placeholderPattern.FindAllString(text, -1)
+	got := placeholderPattern.FindAllString(translation, -1)
+	sort.Strings(want)
+	sort.Strings(got)
+	return strings.Join(want, ",") == strings.Join(got, ",")
+}
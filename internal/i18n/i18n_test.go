@@ -0,0 +1,126 @@
+package i18n
+
+import (
+	"sort"
+	"testing"
+)
+
+// TestCatalogsTranslateEverything fails for every message key and error
+// message of the reference catalog that another catalog lacks, so a new
+// catalog file is complete before it ships
+func TestCatalogsTranslateEverything(t *testing.T) {
+	for locale, missing := range Untranslated() {
+		for _, key := range missing {
+			t.Errorf("%s: untranslated %q", locale, key)
+		}
+	}
+}
+
+// TestCatalogsOnlyTranslateReferenceKeys fails for every key of a catalog
+// that the reference catalog does not list. Untranslated walks the
+// reference keys only, so a text added to one translation alone would
+// otherwise go unnoticed.
+func TestCatalogsOnlyTranslateReferenceKeys(t *testing.T) {
+	reference := catalogs[DefaultLocale]
+	for _, locale := range Locales() {
+		c := catalogs[locale]
+		for _, key := range sortedKeys(c.Messages) {
+			if _, ok := reference.Messages[key]; !ok {
+				t.Errorf("%s: message %q is not in %s.json", locale, key, DefaultLocale)
+			}
+		}
+		for _, message := range sortedKeys(c.Errors) {
+			if _, ok := reference.Errors[message]; !ok {
+				t.Errorf("%s: error %q is not in %s.json", locale, message, DefaultLocale)
+			}
+		}
+	}
+}
+
+// TestReferenceErrorsAreTheirOwnText checks the English error catalog maps
+// each message to itself, as handlers respond with the English text
+func TestReferenceErrorsAreTheirOwnText(t *testing.T) {
+	for message, text := range catalogs[DefaultLocale].Errors {
+		if message != text {
+			t.Errorf("%s: error %q is translated as %q", DefaultLocale, message, text)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	tests := []struct {
+		tag    string
+		locale string
+		found  bool
+	}{
+		{"es", "es", true},
+		{"ES", "es", true},
+		{"es-MX", "es", true},
+		{"es_MX", "es", true},
+		{"english", "en", true},
+		{"fr", "en", false},
+		{"", "en", false},
+	}
+	for _, tt := range tests {
+		translator, found := For(tt.tag)
+		if translator.Locale() != tt.locale || found != tt.found {
+			t.Errorf("For(%q) = %s, %v; want %s, %v", tt.tag, translator.Locale(), found, tt.locale, tt.found)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		preference     string
+		acceptLanguage string
+		want           string
+	}{
+		{"es", "en", "es"},
+		{"", "fr;q=0.9, es;q=0.8, en;q=0.1", "es"},
+		{"", "es;q=0, en", "en"},
+		{"fr", "", "en"},
+		{"klingon", "es-AR", "es"},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.preference, tt.acceptLanguage).Locale(); got != tt.want {
+			t.Errorf("Negotiate(%q, %q) = %s, want %s", tt.preference, tt.acceptLanguage, got, tt.want)
+		}
+	}
+}
+
+func TestErrorKeepsDetails(t *testing.T) {
+	es, _ := For("es")
+	message := "Internal server error"
+	translated := es.Error(message)
+	if translated == message {
+		t.Fatalf("Error(%q) was not translated", message)
+	}
+	if got := es.Error(message + ": connection refused"); got != translated+": connection refused" {
+		t.Errorf("Error with details = %q, want %q", got, translated+": connection refused")
+	}
+	if got := es.Error("Not a known message"); got != "Not a known message" {
+		t.Errorf("Error of an unknown message = %q, want it unchanged", got)
+	}
+	if got := English().Error(message); got != message {
+		t.Errorf("English Error = %q, want %q", got, message)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format("Expires in {minutes} minutes for {name}", "minutes", 15, "name", "Ana")
+	if want := "Expires in 15 minutes for Ana"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+	if got := Format("Hello {name}"); got != "Hello {name}" {
+		t.Errorf("Format without values = %q", got)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package integration
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// mailTimeout bounds the wait for an email sent while serving a request
+const mailTimeout = 10 * time.Second
+
+// signIn is the body of a sign-in response
+type signIn struct {
+	Requires2FA bool   `json:"requires_2fa"`
+	TempToken   string `json:"temp_token"`
+	Channel     string `json:"channel"`
+	Tokens      struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	} `json:"tokens"`
+}
+
+// login signs in with a password, failing the test unless it answers 200
+func login(t *testing.T, h *testutil.Harness, address, secret string) *signIn {
+	t.Helper()
+	resp := h.Do(http.MethodPost, "/api/v1/auth/login", map[string]string{"email": address, "password": secret})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("login as %s = %d %s", address, resp.Status, resp.Body)
+	}
+	var body signIn
+	resp.Decode(t, &body)
+	return &body
+}
+
+// checkSignedIn checks token is an access token of address
+func checkSignedIn(t *testing.T, h *testutil.Harness, token, address string) {
+	t.Helper()
+	if token == "" {
+		t.Fatalf("%s was not issued an access token", address)
+	}
+	resp := h.DoWithToken(token, http.MethodGet, "/api/v1/auth/me", nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("GET /auth/me as %s = %d %s", address, resp.Status, resp.Body)
+	}
+	if !bytes.Contains(resp.Body, []byte(address)) {
+		t.Errorf("GET /auth/me = %s, want %s", resp.Body, address)
+	}
+}
+
+var codePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// TestLoginWithTwoFactor turns on 2FA through the security settings, then
+// signs in with the password and the code emailed for it
+func TestLoginWithTwoFactor(t *testing.T) {
+	h := testutil.New(t)
+	user := h.CreateUser("dana@example.com", models.UserRoleSalesRep)
+
+	enabled := true
+	if resp := h.DoAs(user, http.MethodPut, "/api/v1/settings/security", models.SettingsUpdateSecuritySettingsRequest{TwoFactorEnabled: &enabled}); resp.Status != http.StatusOK {
+		t.Fatalf("enabling 2FA = %d %s", resp.Status, resp.Body)
+	}
+
+	challenge := login(t, h, user.Email, testutil.Password)
+	if !challenge.Requires2FA || challenge.TempToken == "" || challenge.Tokens.AccessToken != "" {
+		t.Fatalf("login = %+v, want a 2FA challenge without tokens", challenge)
+	}
+	if challenge.Channel != models.TwoFactorMethodEmail {
+		t.Errorf("channel = %q, want email", challenge.Channel)
+	}
+	mail := h.Mail.WaitFor(t, user.Email, mailTimeout)
+	code := codePattern.FindString(mail.Text + " " + mail.HTML)
+	if code == "" {
+		t.Fatalf("no code in the email %q: %s", mail.Subject, mail.Text)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if resp := h.Do(http.MethodPost, "/api/v1/auth/verify-2fa", map[string]string{"temp_token": challenge.TempToken, "otp_code": wrong}); resp.Status != http.StatusUnauthorized {
+		t.Errorf("verify with a wrong code = %d, want 401", resp.Status)
+	}
+
+	resp := h.Do(http.MethodPost, "/api/v1/auth/verify-2fa", map[string]string{"temp_token": challenge.TempToken, "otp_code": code})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("verify = %d %s", resp.Status, resp.Body)
+	}
+	var verified signIn
+	resp.Decode(t, &verified)
+	checkSignedIn(t, h, verified.Tokens.AccessToken, user.Email)
+
+	// A code signs in once
+	if resp := h.Do(http.MethodPost, "/api/v1/auth/verify-2fa", map[string]string{"temp_token": challenge.TempToken, "otp_code": code}); resp.Status != http.StatusUnauthorized {
+		t.Errorf("verify with a used code = %d, want 401", resp.Status)
+	}
+}
@@ -0,0 +1,78 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestTeamMemberUpdatesAreVersioned has two admins edit the same member from
+// the same read, then many at once, and checks only one edit of a version
+// is stored
+func TestTeamMemberUpdatesAreVersioned(t *testing.T) {
+	h := testutil.New(t)
+	first := h.CreateUser("first@example.com", models.UserRoleAdmin)
+	second := h.CreateUser("second@example.com", models.UserRoleAdmin)
+	member := h.CreateUser("member@example.com", models.UserRoleSalesRep)
+	path := "/api/v1/admin/team/members/" + member.ID
+
+	read := func() handlers.TeamMember {
+		t.Helper()
+		resp := h.DoAs(first, http.MethodGet, path, nil)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("get member = %d %s", resp.Status, resp.Body)
+		}
+		var body handlers.TeamMemberResponse
+		resp.Decode(t, &body)
+		return body.Data
+	}
+	update := func(user *models.User, name string, version int) *testutil.Response {
+		return h.DoAs(user, http.MethodPut, path, handlers.UpdateTeamMemberRequest{Name: &name, Version: &version})
+	}
+
+	version := read().Version
+	if resp := update(first, "First Edit", version); resp.Status != http.StatusOK {
+		t.Fatalf("first update = %d %s", resp.Status, resp.Body)
+	}
+	resp := update(second, "Second Edit", version)
+	if resp.Status != http.StatusConflict {
+		t.Fatalf("second update of version %d = %d %s, want 409", version, resp.Status, resp.Body)
+	}
+	var conflict struct {
+		Current handlers.TeamMember `json:"current"`
+	}
+	resp.Decode(t, &conflict)
+	if conflict.Current.Name != "First Edit" || conflict.Current.Version != version+1 {
+		t.Errorf("current = %q at version %d, want the first edit at %d", conflict.Current.Name, conflict.Current.Version, version+1)
+	}
+
+	// Several edits of the current version racing each other
+	version++
+	const writers = 6
+	statuses := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses <- update(second, fmt.Sprintf("Edit %d", i), version).Status
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+	count := map[int]int{}
+	for status := range statuses {
+		count[status]++
+	}
+	if count[http.StatusOK] != 1 || count[http.StatusConflict] != writers-1 {
+		t.Errorf("responses = %v, want one 200 and %d 409", count, writers-1)
+	}
+	if got := read().Version; got != version+1 {
+		t.Errorf("version = %d, want %d after one more edit", got, version+1)
+	}
+}
@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestTeamScopedManagerSeesTheirTeam lists team members as a manager, whose
+// role scopes users to their team, then narrows the manager to their own
+// record and checks the next request with the same token already sees it
+func TestTeamScopedManagerSeesTheirTeam(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin, testutil.WithTeam("ops"))
+	manager := h.CreateUser("manager@example.com", models.UserRoleManager, testutil.WithTeam("north"))
+	h.CreateUser("north@example.com", models.UserRoleSalesRep, testutil.WithTeam("north"))
+	h.CreateUser("south@example.com", models.UserRoleSalesRep, testutil.WithTeam("south"))
+	token := h.Token(manager)
+
+	members := func() []string {
+		t.Helper()
+		resp := h.DoWithToken(token, http.MethodGet, "/api/v1/admin/team/members", nil)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("team members = %d %s", resp.Status, resp.Body)
+		}
+		var body handlers.TeamMembersResponse
+		resp.Decode(t, &body)
+		var emails []string
+		for _, member := range body.Data.Members {
+			emails = append(emails, member.Email)
+		}
+		slices.Sort(emails)
+		if int64(len(emails)) != body.Data.Total {
+			t.Errorf("total = %d for %d members", body.Data.Total, len(emails))
+		}
+		return emails
+	}
+
+	if got, want := members(), []string{"manager@example.com", "north@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("team-scoped manager sees %v, want %v", got, want)
+	}
+
+	scopePath := "/api/v1/admin/users/" + manager.ID + "/data-scope"
+	resp := h.DoAs(admin, http.MethodPut, scopePath, map[string]string{"users": models.DataScopeOwn})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("setting the data scope = %d %s", resp.Status, resp.Body)
+	}
+	var scope handlers.UserDataScopeResponse
+	resp.Decode(t, &scope)
+	if scope.RoleDataScope == nil || scope.RoleDataScope.Users != models.DataScopeTeam || scope.Effective.Users != models.DataScopeOwn {
+		t.Errorf("data scope = %+v, want the role's team scope overridden with own", scope)
+	}
+	if got, want := members(), []string{"manager@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("after the override the manager sees %v, want %v", got, want)
+	}
+
+	// Only admins set data scopes
+	if resp := h.DoWithToken(token, http.MethodPut, scopePath, map[string]string{"users": models.DataScopeAll}); resp.Status != http.StatusForbidden {
+		t.Errorf("manager widening their own scope = %d, want 403", resp.Status)
+	}
+}
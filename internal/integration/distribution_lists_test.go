@@ -0,0 +1,111 @@
+package integration
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestDistributionListAgainstMongo builds a list through the API, schedules
+// a message to it, and checks against MongoDB that members are deduped and
+// paged, a deactivated member is not sent to, and the list can only be
+// archived while the message is pending
+func TestDistributionListAgainstMongo(t *testing.T) {
+	h := testutil.New(t)
+	owner := h.CreateUser("owner@example.com", models.UserRoleAdmin)
+	active := h.CreateUser("ana@example.com", models.UserRoleSalesRep)
+	inactive := h.CreateUser("ben@example.com", models.UserRoleSalesRep, func(u *models.User) {
+		u.IsActive = false
+	})
+
+	res := h.DoAs(owner, http.MethodPost, "/api/v1/communications/lists", models.CreateDistributionListRequest{
+		Name: "APAC sales",
+		Members: []models.DistributionListMemberInput{
+			{UserID: active.ID},
+			{UserID: inactive.ID},
+			{Email: "Cy@Example.com"},
+		},
+	})
+	if res.Status != http.StatusCreated {
+		t.Fatalf("create = %d %s", res.Status, res.Body)
+	}
+	var list models.DistributionList
+	res.Decode(t, &list)
+	path := "/api/v1/communications/lists/" + list.ID
+
+	// Repeats of members already in the list are kept once
+	res = h.DoAs(owner, http.MethodPost, path+"/members", models.DistributionListMembersRequest{Members: []models.DistributionListMemberInput{
+		{Email: "cy@example.com"},
+		{UserID: active.ID},
+		{Email: "dee@example.com"},
+	}})
+	var added models.DistributionListMembersResult
+	res.Decode(t, &added)
+	if res.Status != http.StatusOK || added.Added != 1 || added.Unchanged != 2 || added.MemberCount != 4 {
+		t.Fatalf("add = %d %+v, want 1 added of 4 members", res.Status, added)
+	}
+
+	seen := map[string]bool{}
+	target := path + "/members?limit=3"
+	for pages := 0; target != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("cursor paging did not end")
+		}
+		res := h.DoAs(owner, http.MethodGet, target, nil)
+		if res.Status != http.StatusOK {
+			t.Fatalf("members = %d %s", res.Status, res.Body)
+		}
+		var page pagination.Envelope[models.DistributionListMember]
+		res.Decode(t, &page)
+		for _, member := range page.Items {
+			if seen[member.ID] {
+				t.Errorf("member %s on two pages", member.ID)
+			}
+			seen[member.ID] = true
+		}
+		target = ""
+		if page.HasMore {
+			target = path + "/members?limit=3&cursor=" + page.NextCursor
+		}
+	}
+	if len(seen) != 4 {
+		t.Errorf("paged %d members, want 4", len(seen))
+	}
+
+	res = h.DoAs(owner, http.MethodGet, path+"/recipients", nil)
+	var expansion models.DistributionListExpansion
+	res.Decode(t, &expansion)
+	if res.Status != http.StatusOK || len(expansion.Addresses) != 3 || expansion.SkippedInactive != 1 {
+		t.Errorf("recipients = %d %+v, want 3 addresses with the deactivated member skipped", res.Status, expansion)
+	}
+	for _, address := range expansion.Addresses {
+		if address == inactive.Email {
+			t.Errorf("recipients include the deactivated %s", address)
+		}
+	}
+
+	res = h.DoAs(owner, http.MethodPost, "/api/v1/communications/messages", models.SendMessageRequest{
+		Subject:     "Quarterly update",
+		BodyText:    "Numbers inside.",
+		ListID:      list.ID,
+		ScheduledAt: time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+	if res.Status != http.StatusAccepted {
+		t.Fatalf("scheduling to the list = %d %s", res.Status, res.Body)
+	}
+
+	if res := h.DoAs(owner, http.MethodDelete, path, nil); res.Status != http.StatusConflict {
+		t.Errorf("delete with a scheduled message = %d %s, want 409", res.Status, res.Body)
+	}
+	archived := true
+	if res := h.DoAs(owner, http.MethodPatch, path, models.UpdateDistributionListRequest{Archived: &archived}); res.Status != http.StatusOK {
+		t.Errorf("archive = %d %s, want 200", res.Status, res.Body)
+	}
+	if res := h.DoAs(owner, http.MethodGet, path, nil); res.Status != http.StatusOK {
+		t.Errorf("get archived list = %d, want it kept", res.Status)
+	}
+}
@@ -0,0 +1,4 @@
+// Package integration holds the end-to-end suites run against the API
+// through testutil.Harness. They are skipped unless TEST_MONGODB_URI names
+// a MongoDB server; see package testutil.
+package integration
@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/email"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// recordingSender keeps the emails it is asked to send
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []models.CommMessage
+}
+
+func (s *recordingSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, *msg)
+	return nil
+}
+
+func (s *recordingSender) Name() string        { return "recording" }
+func (s *recordingSender) FromAddress() string { return "noreply@example.test" }
+func (s *recordingSender) Capabilities() email.Capabilities {
+	return email.Capabilities{Delivers: true}
+}
+
+// TestScheduledEmailIsSignedOnce schedules emails from a user with and
+// without their signature enabled, and checks the stored and sent bodies
+// carry it exactly once while enabled and not at all while disabled
+func TestScheduledEmailIsSignedOnce(t *testing.T) {
+	h := testutil.New(t)
+	user := h.CreateUser("dana@example.com", models.UserRoleSalesRep)
+	sender := &recordingSender{}
+	worker := outboxWorker(h, sender)
+
+	saveSignature := func(enabled bool) {
+		t.Helper()
+		res := h.DoAs(user, http.MethodPut, "/api/v1/settings/email-signature", models.SettingsUpdateEmailSignatureRequest{
+			Signature: `<p>Dana Smith<script>steal()</script></p>`, Enabled: enabled,
+		})
+		if res.Status != http.StatusOK {
+			t.Fatalf("saving the signature = %d %s", res.Status, res.Body)
+		}
+	}
+	send := func() (stored string, sent string) {
+		t.Helper()
+		id := scheduleEmail(t, h, user, time.Now().Add(time.Hour))
+		makeDue(t, h, id)
+		// Twice, as a second worker or a retry would
+		for range 2 {
+			if _, err := worker.ProcessDue(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var doc struct {
+			Body string `bson:"body"`
+		}
+		if err := h.Mongo.Collection("communication").FindOne(context.Background(), bson.M{"_id": id}).Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+		if len(sender.sent) == 0 {
+			t.Fatal("nothing was sent")
+		}
+		return doc.Body, sender.sent[len(sender.sent)-1].BodyText
+	}
+
+	saveSignature(false)
+	if stored, sent := send(); strings.Contains(stored, "Dana Smith") || strings.Contains(sent, "Dana Smith") {
+		t.Errorf("disabled signature sent: stored %q, sent %q", stored, sent)
+	}
+
+	saveSignature(true)
+	stored, sent := send()
+	for _, body := range []string{stored, sent} {
+		if strings.Count(body, "Dana Smith") != 1 || !strings.HasSuffix(body, "\n\n-- \nDana Smith") || strings.Contains(body, "steal") {
+			t.Errorf("body %q, want the sanitized signature once at the end", body)
+		}
+	}
+	if n := len(sender.sent); n != 2 {
+		t.Errorf("%d emails sent, want 2", n)
+	}
+}
@@ -0,0 +1,111 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// switchableBroker refuses every event while refusing is set and records
+// the event_id of each one it acknowledges
+type switchableBroker struct {
+	mu        sync.Mutex
+	refusing  bool
+	published []string
+}
+
+func (b *switchableBroker) ProduceSync(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.refusing {
+		return kafka.MessageSizeTooLarge
+	}
+	b.published = append(b.published, headers["event_id"])
+	return nil
+}
+
+// TestFailedEventIsReplayedThroughTheAPI sets an event aside with the
+// broker refusing it, finds it through GET /admin/events, replays it and
+// checks the relay publishes it under its original ID
+func TestFailedEventIsReplayedThroughTheAPI(t *testing.T) {
+	h := testutil.New(t)
+	ops := h.CreateUser("ops@example.com", models.UserRoleAdmin, func(u *models.User) {
+		u.Permissions = []string{models.PermEventsAdmin}
+	})
+	ctx := context.Background()
+	outbox := repositories.NewEventOutboxRepository(h.Mongo)
+	broker := &switchableBroker{refusing: true}
+	relay := services.NewEventOutboxRelay(outbox, broker, time.Minute)
+	relay.SetMaxAttempts(1)
+
+	event := events.NewTemplateEvent(events.TypeTemplateCreated, ops.ID, "acme", uuid.MustNewUUID())
+	if err := events.Record(ctx, outbox, event); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.RelayPending(ctx); err != nil {
+		t.Fatalf("relay = %v, want the refused events set aside", err)
+	}
+
+	var listing struct {
+		Data struct {
+			Events []models.OutboxEvent `json:"events"`
+			Total  int64                `json:"total"`
+		} `json:"data"`
+	}
+	resp := h.DoAs(ops, http.MethodGet, "/api/v1/admin/events?status=failed&type="+event.EventType, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("list failed = %d %s", resp.Status, resp.Body)
+	}
+	resp.Decode(t, &listing)
+	if listing.Data.Total != 1 || listing.Data.Events[0].ID != event.EventID || listing.Data.Events[0].Status != models.OutboxEventFailed {
+		t.Fatalf("failed events = %+v, want the refused event", listing.Data)
+	}
+
+	if resp := h.DoAs(ops, http.MethodPost, "/api/v1/admin/events/"+event.EventID+"/replay", nil); resp.Status != http.StatusAccepted {
+		t.Fatalf("replay = %d %s", resp.Status, resp.Body)
+	}
+	if resp := h.DoAs(ops, http.MethodPost, "/api/v1/admin/events/"+event.EventID+"/replay", nil); resp.Status != http.StatusConflict {
+		t.Errorf("replaying it again while pending = %d, want 409", resp.Status)
+	}
+
+	broker.mu.Lock()
+	broker.refusing = false
+	broker.mu.Unlock()
+	if _, err := relay.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var detail models.OutboxEvent
+	resp = h.DoAs(ops, http.MethodGet, "/api/v1/admin/events/"+event.EventID, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("get = %d %s", resp.Status, resp.Body)
+	}
+	resp.Decode(t, &detail)
+	if detail.Status != models.OutboxEventPublished || detail.Replays != 1 || detail.LastReplayedBy != ops.ID || len(detail.DeliveryAttempts) != 2 {
+		t.Errorf("event = %+v, want it published after one replay by the operator", detail)
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if !slices.Contains(broker.published, event.EventID) {
+		t.Errorf("published %v, want the original event_id %s", broker.published, event.EventID)
+	}
+
+	// The replay itself was audited through the outbox
+	audits, total, err := outbox.ListEvents(ctx, models.OutboxEventFilter{EventType: "audit.event_replayed"}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || audits[0].Topic == "" {
+		t.Errorf("replay audit events in the outbox = %d, want 1", total)
+	}
+}
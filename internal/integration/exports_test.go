@@ -0,0 +1,90 @@
+package integration
+
+import (
+	"encoding/csv"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/xlsx/xlsxtest"
+)
+
+// inRegion puts a created user in region
+func inRegion(region string) testutil.UserOption {
+	return func(u *models.User) { u.Region = region }
+}
+
+// TestExportTeamMembers exports the roster as a workbook, reads it back and
+// checks the member rows, the filters and the summary counts by role and
+// region
+func TestExportTeamMembers(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin, inRegion("west"))
+	h.CreateUser("manager@example.com", models.UserRoleManager, inRegion("west"), testutil.WithTeam("north"))
+	h.CreateUser("rep1@example.com", models.UserRoleSalesRep, inRegion("west"), testutil.WithTeam("north"))
+	h.CreateUser("rep2@example.com", models.UserRoleSalesRep, inRegion("south"))
+	rep := h.CreateUser("rep3@example.com", models.UserRoleSalesRep, inRegion("south"))
+
+	res := h.DoAs(admin, http.MethodGet, "/api/v1/admin/team/members/export?format=xlsx", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("export = %d %s", res.Status, res.Body)
+	}
+	if got, want := res.Header.Get("Content-Disposition"), `attachment; filename="team-members-`+time.Now().UTC().Format("2006-01-02")+`.xlsx"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	workbook, err := xlsxtest.Read(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := workbook.Sheet("Team Members")
+	if members == nil || len(members.Rows) != 6 || !members.FrozenHeader {
+		t.Fatalf("member sheet = %+v, want a frozen header and 5 members", members)
+	}
+	// Newest first
+	if first := members.Rows[1]; first[0] != rep.ID || first[2] != rep.Email || first[3] != string(models.UserRoleSalesRep) || first[4] != "south" {
+		t.Errorf("first member = %q, want %s", first, rep.Email)
+	}
+
+	summary := workbook.Sheet("Summary")
+	if summary == nil {
+		t.Fatal("no Summary sheet")
+	}
+	counts := map[string]string{}
+	for _, row := range summary.Rows[1:] {
+		counts[row[0]+"/"+row[1]] = row[2]
+	}
+	want := map[string]string{
+		"Total/": "5", "Role/sales_rep": "3", "Role/manager": "1", "Role/admin": "1",
+		"Region/west": "3", "Region/south": "2",
+	}
+	if !maps.Equal(counts, want) {
+		t.Errorf("summary = %v, want %v", counts, want)
+	}
+
+	// The listing filters narrow the export
+	res = h.DoAs(admin, http.MethodGet, "/api/v1/admin/team/members/export?format=csv&role=sales_rep&region=west", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("CSV export = %d %s", res.Status, res.Body)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(res.Body))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][2] != "rep1@example.com" {
+		t.Errorf("filtered export = %q, want rep1 only", records)
+	}
+
+	if res := h.DoAs(admin, http.MethodGet, "/api/v1/admin/team/members/export?status=gone", nil); res.Status != http.StatusBadRequest {
+		t.Errorf("export with an unknown status = %d, want 400", res.Status)
+	}
+	if res := h.DoAs(rep, http.MethodGet, "/api/v1/admin/team/members/export", nil); res.Status != http.StatusForbidden {
+		t.Errorf("export by a sales rep = %d, want 403", res.Status)
+	}
+	if res := h.DoAs(rep, http.MethodGet, "/api/v1/admin/system/audit-logs/export", nil); res.Status != http.StatusForbidden {
+		t.Errorf("audit log export by a sales rep = %d, want 403", res.Status)
+	}
+}
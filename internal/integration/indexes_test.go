@@ -0,0 +1,95 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// indexSpec is what a test checks of an index
+type indexSpec struct {
+	Name               string `bson:"name"`
+	Unique             bool   `bson:"unique"`
+	Sparse             bool   `bson:"sparse"`
+	ExpireAfterSeconds *int32 `bson:"expireAfterSeconds"`
+}
+
+// listIndexes returns the indexes of a collection by name
+func listIndexes(t *testing.T, h *testutil.Harness, collection string) map[string]indexSpec {
+	t.Helper()
+	cursor, err := h.Mongo.Collection(collection).Indexes().List(context.Background())
+	if err != nil {
+		t.Fatalf("%s: %v", collection, err)
+	}
+	var specs []indexSpec
+	if err := cursor.All(context.Background(), &specs); err != nil {
+		t.Fatalf("%s: %v", collection, err)
+	}
+	byName := make(map[string]indexSpec, len(specs))
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+	return byName
+}
+
+// TestInitIndexesCreatesTheQueryIndexes checks the indexes the hot lookups
+// rely on exist after the bootstrap the harness runs, and that running it
+// again, as every restart does, succeeds
+func TestInitIndexesCreatesTheQueryIndexes(t *testing.T) {
+	h := testutil.New(t)
+
+	type expect struct {
+		unique, sparse, ttl bool
+	}
+	for collection, indexes := range map[string]map[string]expect{
+		"users": {
+			"invite_token_1": {sparse: true},
+		},
+		"sessions": {
+			"refresh_token_1":        {unique: true},
+			"user_id_1_expires_at_1": {},
+			"token_id_1":             {},
+			"user_id_1_user_agent_1": {},
+		},
+		"password_resets": {
+			"reset_token_1": {unique: true},
+			"expires_at_1":  {ttl: true},
+		},
+		"two_factor_otps": {
+			"temp_token_1": {unique: true},
+			"expires_at_1": {ttl: true},
+		},
+		"audit_logs": {
+			"timestamp_-1":            {},
+			"user_id_1_timestamp_-1":  {},
+			"resource_1_timestamp_-1": {},
+		},
+		"user_activity_logs": {
+			"user_id_1_created_at_-1": {},
+		},
+		"communication": {
+			"communication_text": {},
+		},
+	} {
+		existing := listIndexes(t, h, collection)
+		for name, want := range indexes {
+			got, ok := existing[name]
+			if !ok {
+				t.Errorf("%s has no index %s", collection, name)
+				continue
+			}
+			if got.Unique != want.unique || got.Sparse != want.sparse || (got.ExpireAfterSeconds != nil) != want.ttl {
+				t.Errorf("%s.%s = %+v, want unique %v, sparse %v, TTL %v", collection, name, got, want.unique, want.sparse, want.ttl)
+			}
+		}
+	}
+
+	if err := repositories.InitIndexes(context.Background(), h.Mongo); err != nil {
+		t.Errorf("InitIndexes over existing indexes = %v", err)
+	}
+	if got := len(listIndexes(t, h, "sessions")); got != 5 {
+		t.Errorf("sessions has %d indexes after a second bootstrap, want _id and the 4 defined", got)
+	}
+}
@@ -0,0 +1,79 @@
+package integration
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+)
+
+var signupLinkPattern = regexp.MustCompile(`/signup\?token=([0-9a-f]+)`)
+
+// TestInvitedMemberSignsUpAndSignsIn follows an invitation from the admin
+// to the invited member's first sign-in
+func TestInvitedMemberSignsUpAndSignsIn(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	const address = "sam@example.com"
+
+	resp := h.DoAs(admin, http.MethodPost, "/api/v1/admin/team/members/invite", handlers.InviteTeamMemberRequest{
+		Email:     address,
+		FirstName: "Sam",
+		LastName:  "Okafor",
+		Role:      "sales_rep",
+	})
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("invite = %d %s", resp.Status, resp.Body)
+	}
+	mail := h.Mail.WaitFor(t, address, mailTimeout)
+	match := signupLinkPattern.FindStringSubmatch(mail.Text + " " + mail.HTML)
+	if match == nil {
+		t.Fatalf("no signup link in the invitation %q: %s", mail.Subject, mail.Text)
+	}
+	token := match[1]
+
+	if resp := h.Do(http.MethodPost, "/api/v1/auth/login", map[string]string{"email": address, "password": testutil.Password}); resp.Status != http.StatusUnauthorized {
+		t.Errorf("login before signup = %d, want 401", resp.Status)
+	}
+
+	resp = h.Do(http.MethodGet, "/api/v1/auth/verify-invite?token="+url.QueryEscape(token), nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("verify invite = %d %s", resp.Status, resp.Body)
+	}
+	var verified struct {
+		Data map[string]string `json:"data"`
+	}
+	resp.Decode(t, &verified)
+	if verified.Data["email"] != address || verified.Data["firstName"] != "Sam" {
+		t.Errorf("verified invitation = %v", verified.Data)
+	}
+
+	resp = h.Do(http.MethodPost, "/api/v1/auth/complete-signup", handlers.CompleteSignupRequest{Token: token, Password: testutil.Password})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("complete signup = %d %s", resp.Status, resp.Body)
+	}
+
+	signedIn := login(t, h, address, testutil.Password)
+	if signedIn.Requires2FA {
+		t.Fatalf("login after signup asked for 2FA")
+	}
+	checkSignedIn(t, h, signedIn.Tokens.AccessToken, address)
+
+	stored, err := h.Users.GetByEmail(t.Context(), address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "active" || !stored.IsActive || stored.InviteToken != "" {
+		t.Errorf("member = status %q active %v token %q, want an active member without a token", stored.Status, stored.IsActive, stored.InviteToken)
+	}
+
+	// The token is spent
+	resp = h.Do(http.MethodPost, "/api/v1/auth/complete-signup", handlers.CompleteSignupRequest{Token: token, Password: "another secret"})
+	if resp.Status != http.StatusNotFound {
+		t.Errorf("second signup with the token = %d, want 404", resp.Status)
+	}
+}
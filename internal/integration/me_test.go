@@ -0,0 +1,58 @@
+package integration
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// TestMeReportsWhatRoutesAuthorize checks GET /auth/me merges the role's
+// permissions with the user's own grants, and that a route guarded by a
+// granted permission lets the user in just as /auth/me says
+func TestMeReportsWhatRoutesAuthorize(t *testing.T) {
+	h := testutil.New(t)
+	granted := h.CreateUser("granted@example.com", models.UserRoleSalesRep, testutil.WithTeam("alpha"), func(u *models.User) {
+		u.Permissions = []string{models.PermTemplatesApprove, models.PermTeamMembersView}
+	})
+	plain := h.CreateUser("plain@example.com", models.UserRoleSalesRep, testutil.WithTeam("alpha"))
+
+	me := func(user *models.User) handlers.MeResponse {
+		t.Helper()
+		resp := h.DoAs(user, http.MethodGet, "/api/v1/auth/me", nil)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("GET /auth/me as %s = %d %s", user.Email, resp.Status, resp.Body)
+		}
+		var body handlers.MeResponse
+		resp.Decode(t, &body)
+		return body
+	}
+
+	// The role's permission first, the grant it lacks after it, once each
+	got := me(granted)
+	if want := []string{models.PermTeamMembersView, models.PermTemplatesApprove}; !slices.Equal(got.Permissions, want) {
+		t.Errorf("permissions = %v, want %v", got.Permissions, want)
+	}
+	if want := (models.DataScope{Customers: models.DataScopeOwn, Campaigns: models.DataScopeOwn, Users: models.DataScopeTeam}); got.DataScope != want {
+		t.Errorf("dataScope = %+v, want the sales rep defaults %+v", got.DataScope, want)
+	}
+	if got.Role != string(models.UserRoleSalesRep) || got.Team != "alpha" || got.Session.ExpiresAt == nil {
+		t.Errorf("me = %+v", got)
+	}
+	if got := me(plain); slices.Contains(got.Permissions, models.PermTemplatesApprove) {
+		t.Errorf("permissions without the grant = %v", got.Permissions)
+	}
+
+	// Approving an unknown template gets past authorization only with the grant
+	approve := "/api/v1/templates/" + uuid.MustNewUUID() + "/approve"
+	if resp := h.DoAs(plain, http.MethodPost, approve, map[string]string{}); resp.Status != http.StatusForbidden {
+		t.Errorf("approve without the grant = %d %s, want 403", resp.Status, resp.Body)
+	}
+	if resp := h.DoAs(granted, http.MethodPost, approve, map[string]string{}); resp.Status == http.StatusForbidden {
+		t.Errorf("approve with the grant = %d %s, want it authorized", resp.Status, resp.Body)
+	}
+}
@@ -0,0 +1,101 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestDigestClaimsRaceSafely has several owners claim due digests at once
+// from MongoDB, checking no notification is leased to two of them and every
+// one is claimed, including those of a due digest not due themselves
+func TestDigestClaimsRaceSafely(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	pending := repositories.NewPendingNotificationRepository(h.Mongo)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	want := map[string]bool{}
+	for user := range 6 {
+		for i := range 3 {
+			id := fmt.Sprintf("user%d-%d", user, i)
+			due := now.Add(-time.Minute)
+			if i == 2 {
+				due = now.Add(time.Hour) // Goes out with the rest of its digest
+			}
+			if err := pending.AddPendingNotification(ctx, &models.PendingNotification{
+				ID: id, UserID: fmt.Sprintf("user%d", user), Type: models.NotificationTaskReminder,
+				Title: "Call Acme", CreatedAt: now.Add(time.Duration(i) * time.Second), DueAt: due,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			want[id] = true
+		}
+	}
+
+	var mu sync.Mutex
+	claimedBy := map[string]string{}
+	var wg sync.WaitGroup
+	for worker := range 4 {
+		owner := fmt.Sprintf("instance-%d", worker)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				batch, err := pending.ClaimDueDigest(ctx, owner, now, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(batch) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, n := range batch {
+					if other, ok := claimedBy[n.ID]; ok {
+						t.Errorf("%s claimed by %s and %s", n.ID, other, owner)
+					}
+					claimedBy[n.ID] = owner
+					if n.UserID != batch[0].UserID {
+						t.Errorf("batch of %s holds a notification of %s", batch[0].UserID, n.UserID)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(claimedBy) != len(want) {
+		t.Errorf("%d of %d notifications claimed", len(claimedBy), len(want))
+	}
+
+	// Leased notifications are not claimed again until the lease runs out,
+	// and only their owner deletes them
+	if batch, err := pending.ClaimDueDigest(ctx, "late", now.Add(30*time.Second), time.Minute); err != nil || len(batch) != 0 {
+		t.Errorf("claim during the lease = %d, %v; want nothing", len(batch), err)
+	}
+	if err := pending.DeletePendingNotifications(ctx, "late", []string{"user0-0"}); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := pending.ClaimDueDigest(ctx, "late", now.Add(2*time.Minute), time.Minute)
+	if err != nil || len(batch) != 3 || batch[0].CreatedAt.After(batch[1].CreatedAt) {
+		t.Fatalf("claim after the lease = %d, %v; want a whole digest oldest first", len(batch), err)
+	}
+	ids := make([]string, len(batch))
+	for i, n := range batch {
+		ids[i] = n.ID
+	}
+	if err := pending.DeletePendingNotifications(ctx, "late", ids); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.Mongo.Collection("pending_notifications").CountDocuments(ctx, bson.M{}); err != nil || n != int64(len(want)-3) {
+		t.Errorf("%d notifications left, %v; want %d", n, err, len(want)-3)
+	}
+}
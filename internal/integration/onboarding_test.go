@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func onboarding(t *testing.T, h *testutil.Harness, user *models.User) models.OnboardingChecklist {
+	t.Helper()
+	res := h.DoAs(user, http.MethodGet, "/api/v1/users/me/onboarding", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("onboarding checklist = %d %s", res.Status, res.Body)
+	}
+	var checklist models.OnboardingChecklist
+	res.Decode(t, &checklist)
+	return checklist
+}
+
+// TestOnboardingChecklist checks a fresh user, with no settings stored, has
+// nothing done, and that a user who went through every step is done
+func TestOnboardingChecklist(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	fresh := h.CreateUser("new@example.com", models.UserRoleAdmin)
+	settled := h.CreateUser("settled@example.com", models.UserRoleAdmin)
+
+	checklist := onboarding(t, h, fresh)
+	if checklist.Percent != 0 || checklist.Completed != 0 || checklist.Total != len(checklist.Items) || len(checklist.Items) < 7 {
+		t.Errorf("fresh user's checklist = %+v, want every item undone", checklist)
+	}
+
+	settings := repositories.NewSettingsRepository(h.Mongo)
+	if _, err := settings.UpdateUserProfile(ctx, settled.ID, models.SettingsUpdateProfileRequest{
+		FirstName: "Sam", LastName: "Rivera", JobTitle: "Account Executive", Avatar: "https://cdn.example.com/sam.png",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	enabled := true
+	if _, err := settings.UpdateSecuritySettings(ctx, settled.ID, models.SettingsUpdateSecuritySettingsRequest{TwoFactorEnabled: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	// As verification by text message leaves it
+	if _, err := h.Mongo.Collection("security_settings").UpdateOne(ctx, bson.M{"user_id": settled.ID},
+		bson.M{"$set": bson.M{"phone_number": "+14155550123"}}, options.Update().SetUpsert(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := settings.UpdateEmailSignature(ctx, settled.ID, models.SettingsUpdateEmailSignatureRequest{Signature: "<p>Sam Rivera</p>", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	logins := repositories.NewLoginHistoryRepository(h.Mongo)
+	for _, at := range []time.Time{time.Now().Add(-48 * time.Hour), time.Now()} {
+		if err := logins.CreateLoginRecord(ctx, &models.LoginRecord{UserID: settled.ID, Timestamp: at, Success: true, Method: "password"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTemplate(t, h, settled, "First template")
+
+	checklist = onboarding(t, h, settled)
+	if checklist.Percent != 100 || checklist.Completed != checklist.Total {
+		t.Errorf("configured user's checklist = %+v, want 100%%", checklist)
+	}
+	for _, item := range checklist.Items {
+		if !item.Done || item.Dismissed {
+			t.Errorf("item %s of the configured user: done %t, dismissed %t", item.Key, item.Done, item.Dismissed)
+		}
+	}
+
+	// One sign-in is the first, not a return
+	if err := logins.CreateLoginRecord(ctx, &models.LoginRecord{UserID: fresh.ID, Timestamp: time.Now(), Success: true, Method: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if checklist := onboarding(t, h, fresh); checklist.Completed != 0 {
+		t.Errorf("fresh user with one sign-in completed %d items", checklist.Completed)
+	}
+}
+
+// TestOnboardingDismissalPersists dismisses an item and checks it stays
+// dismissed, out of the percentage, for that user only
+func TestOnboardingDismissalPersists(t *testing.T) {
+	h := testutil.New(t)
+	user := h.CreateUser("new@example.com", models.UserRoleAdmin)
+	other := h.CreateUser("other@example.com", models.UserRoleAdmin)
+	createTemplate(t, h, user, "First template")
+
+	before := onboarding(t, h, user)
+	for i := 0; i < 2; i++ {
+		res := h.DoAs(user, http.MethodPatch, "/api/v1/users/me/onboarding/avatar/dismiss", nil)
+		if res.Status != http.StatusOK {
+			t.Fatalf("dismissing = %d %s", res.Status, res.Body)
+		}
+	}
+
+	after := onboarding(t, h, user)
+	for _, item := range after.Items {
+		if item.Dismissed != (item.Key == "avatar") {
+			t.Errorf("item %s dismissed = %t after dismissing avatar", item.Key, item.Dismissed)
+		}
+	}
+	if after.Total != before.Total-1 || after.Completed != 1 || after.Percent != 100/after.Total {
+		t.Errorf("checklist after dismissing = %+v, before %+v", after, before)
+	}
+	for _, item := range onboarding(t, h, other).Items {
+		if item.Dismissed {
+			t.Errorf("another user's %s is dismissed", item.Key)
+		}
+	}
+
+	if res := h.DoAs(user, http.MethodPatch, "/api/v1/users/me/onboarding/world_peace/dismiss", nil); res.Status != http.StatusNotFound {
+		t.Errorf("dismissing an unknown item = %d, want 404", res.Status)
+	}
+}
@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestUserCursorPagesSurviveInserts pages through the users stored in
+// MongoDB newest and oldest first, creating a user between every two
+// pages, and checks the users that existed before the first page are each
+// listed once
+func TestUserCursorPagesSurviveInserts(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	all := []string{admin.Email}
+	for i := 0; i < 6; i++ {
+		all = append(all, h.CreateUser(fmt.Sprintf("rep%d@example.com", i), models.UserRoleSalesRep).Email)
+	}
+
+	for _, sort := range []string{"-created_at", "created_at"} {
+		existing := slices.Clone(all)
+		var seen []string
+		query := url.Values{"limit": {"2"}, "sort": {sort}}
+		for pages := 0; ; pages++ {
+			if pages > 20 {
+				t.Fatalf("sort %s: still paging after %d pages", sort, pages)
+			}
+			resp := h.DoAs(admin, http.MethodGet, "/api/v1/admin/users?"+query.Encode(), nil)
+			if resp.Status != http.StatusOK {
+				t.Fatalf("sort %s page %d = %d %s", sort, pages+1, resp.Status, resp.Body)
+			}
+			var page pagination.Envelope[models.UserProfile]
+			resp.Decode(t, &page)
+			for _, profile := range page.Items {
+				seen = append(seen, profile.Email)
+			}
+			if !page.HasMore {
+				break
+			}
+			query.Set("cursor", page.NextCursor)
+			all = append(all, h.CreateUser(fmt.Sprintf("new%d@example.com", len(all)), models.UserRoleSalesRep).Email)
+		}
+
+		// Newest first, the users created meanwhile sort before the cursor;
+		// oldest first, they are all still ahead of it
+		want := existing
+		if sort == "created_at" {
+			want = all
+		}
+		if got := slices.Sorted(slices.Values(seen)); !slices.Equal(got, slices.Sorted(slices.Values(want))) {
+			t.Errorf("sort %s listed %v, want each of %v once", sort, seen, want)
+		}
+	}
+}
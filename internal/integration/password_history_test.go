@@ -0,0 +1,53 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestPasswordHistoryAgainstMongo changes a password more times than the
+// history keeps and checks the replaced hashes are kept newest first and
+// capped, and that rehashing the current password adds none
+func TestPasswordHistoryAgainstMongo(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	user := h.CreateUser("ana@example.com", models.UserRoleSalesRep)
+
+	replaced := []string{user.PasswordHash}
+	for i := 1; i <= models.MaxPasswordHistory+2; i++ {
+		// Hashes start with $, which the update must store as it is
+		hash := fmt.Sprintf("$2a$04$hash-%02d", i)
+		if err := h.Users.UpdatePassword(ctx, user.ID, hash); err != nil {
+			t.Fatal(err)
+		}
+		replaced = append(replaced, hash)
+	}
+	current := replaced[len(replaced)-1]
+	want := slices.Clone(replaced[:len(replaced)-1])
+	slices.Reverse(want)
+	want = want[:models.MaxPasswordHistory]
+
+	stored, err := h.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PasswordHash != current || !slices.Equal(stored.PasswordHistory, want) {
+		t.Fatalf("hash %q, history %q; want %q and %q", stored.PasswordHash, stored.PasswordHistory, current, want)
+	}
+
+	if err := h.Users.ReplacePasswordHash(ctx, user.ID, "$2a$12$rehashed"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = h.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PasswordHash != "$2a$12$rehashed" || !slices.Equal(stored.PasswordHistory, want) {
+		t.Errorf("after a rehash: hash %q, history %q; want the history unchanged", stored.PasswordHash, stored.PasswordHistory)
+	}
+}
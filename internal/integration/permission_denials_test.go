@@ -0,0 +1,84 @@
+package integration
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestRepeatedDenialsAreThrottledAndReported probes an admin endpoint as a
+// sales rep past the denial limit, checking the probes turn from 403 into
+// 429, the notification address is alerted once, and security can review
+// every probe
+func TestRepeatedDenialsAreThrottledAndReported(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	rep := h.CreateUser("rep@example.com", models.UserRoleSalesRep)
+	notify := "security@example.com"
+	if res := h.DoAs(admin, http.MethodPut, "/api/v1/admin/system/email-notifications", models.UpdateSystemEmailNotificationSettingsRequest{
+		SystemNotificationEmail: &notify,
+	}); res.Status != http.StatusOK {
+		t.Fatalf("setting the notification address = %d %s", res.Status, res.Body)
+	}
+
+	limit := h.Config.Security.DenialLimit
+	for i := 1; i <= limit; i++ {
+		if res := h.DoAs(rep, http.MethodGet, "/api/v1/admin/system/audit-logs", nil); res.Status != http.StatusForbidden {
+			t.Fatalf("probe %d = %d, want 403", i, res.Status)
+		}
+	}
+	for i := limit + 1; i <= limit+3; i++ {
+		res := h.DoAs(rep, http.MethodGet, "/api/v1/admin/system/audit-logs", nil)
+		if res.Status != http.StatusTooManyRequests || errorCode(t, res) != "TOO_MANY_DENIALS" || res.Header.Get("Retry-After") == "" {
+			t.Errorf("probe %d = %d %s, want 429 with Retry-After", i, res.Status, res.Body)
+		}
+	}
+
+	alert := h.Mail.WaitFor(t, notify, 5*time.Second)
+	if !strings.Contains(alert.Subject, "Repeated access denials") || !strings.Contains(alert.Text, rep.ID) {
+		t.Errorf("alert %q: %s", alert.Subject, alert.Text)
+	}
+	alerts := 0
+	for _, mail := range h.Mail.Messages() {
+		for _, to := range mail.To {
+			if to == notify {
+				alerts++
+			}
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("%d alerts sent, want 1", alerts)
+	}
+
+	// The admin's own requests are not held back
+	res := h.DoAs(admin, http.MethodGet, "/api/v1/admin/system/audit-logs/permission-denials?user_id="+rep.ID+"&limit=100&page=1", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("listing the denials = %d %s", res.Status, res.Body)
+	}
+	var page pagination.Envelope[models.PermissionDenial]
+	res.Decode(t, &page)
+	if page.Total == nil || *page.Total != int64(limit+3) || len(page.Items) != limit+3 {
+		t.Fatalf("denials listed = %d of %v, want %d", len(page.Items), page.Total, limit+3)
+	}
+	throttled := 0
+	for _, denial := range page.Items {
+		if denial.Throttled {
+			throttled++
+		}
+		if denial.UserID != rep.ID || denial.Route != "/api/v1/admin/system/audit-logs" || denial.Required != models.PermAuditLogsView || denial.Method != http.MethodGet {
+			t.Errorf("denial = %+v", denial)
+		}
+	}
+	if throttled != 3 {
+		t.Errorf("%d denials marked throttled, want 3", throttled)
+	}
+
+	if res := h.DoAs(rep, http.MethodGet, "/api/v1/admin/system/audit-logs/permission-denials", nil); res.Status != http.StatusTooManyRequests {
+		t.Errorf("a throttled rep reviewing denials = %d, want 429", res.Status)
+	}
+}
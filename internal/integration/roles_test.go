@@ -0,0 +1,200 @@
+package integration
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// createRole creates a custom role as admin, failing the test when it is not
+// created
+func createRole(t *testing.T, h *testutil.Harness, admin *models.User, code string, permissions ...string) models.RolePermission {
+	t.Helper()
+	resp := h.DoAs(admin, http.MethodPost, "/api/v1/admin/roles", models.CreateCustomRoleRequest{
+		RoleCode:    code,
+		RoleName:    code,
+		Permissions: permissions,
+		DataScope:   models.DataScope{Customers: models.DataScopeOwn, Campaigns: models.DataScopeOwn, Users: models.DataScopeOwn},
+	})
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("create role %s = %d %s", code, resp.Status, resp.Body)
+	}
+	var role models.RolePermission
+	resp.Decode(t, &role)
+	return role
+}
+
+// errorCode returns the machine-readable code of an error response
+func errorCode(t *testing.T, resp *testutil.Response) string {
+	t.Helper()
+	var body handlers.CodedErrorResponse
+	resp.Decode(t, &body)
+	return body.Error.Code
+}
+
+// TestCustomRolesUnionPermissions checks a user holding custom roles gets
+// their role's permissions, every custom role's and their own grants, and
+// that routes authorize them on any of them
+func TestCustomRolesUnionPermissions(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	rep := h.CreateUser("rep@example.com", models.UserRoleSalesRep, func(u *models.User) {
+		u.Permissions = []string{models.PermTeamMembersInvite}
+	})
+
+	templates := createRole(t, h, admin, "template_approver", "templates:library:*")
+	audit := createRole(t, h, admin, "auditor", "settings:audit_logs:*")
+	if templates.IsSystemRole || templates.ID == "" {
+		t.Fatalf("created role = %+v", templates)
+	}
+
+	auditLogs := "/api/v1/admin/system/audit-logs"
+	if resp := h.DoAs(rep, http.MethodGet, auditLogs, nil); resp.Status != http.StatusForbidden {
+		t.Fatalf("audit logs before the roles = %d %s, want 403", resp.Status, resp.Body)
+	}
+
+	// Duplicates are held once
+	resp := h.DoAs(admin, http.MethodPut, "/api/v1/admin/users/"+rep.ID+"/roles",
+		models.AssignRolesRequest{RoleIDs: []string{templates.ID, audit.ID, templates.ID}})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("assign roles = %d %s", resp.Status, resp.Body)
+	}
+	var profile models.UserProfile
+	resp.Decode(t, &profile)
+	if want := []string{templates.ID, audit.ID}; !slices.Equal(profile.RoleIDs, want) || profile.Role != string(models.UserRoleSalesRep) {
+		t.Errorf("assigned profile roles = %s %v, want sales_rep %v", profile.Role, profile.RoleIDs, want)
+	}
+
+	resp = h.DoAs(rep, http.MethodGet, "/api/v1/auth/me", nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("GET /auth/me = %d %s", resp.Status, resp.Body)
+	}
+	var me handlers.MeResponse
+	resp.Decode(t, &me)
+	for _, want := range []string{models.PermTeamMembersView, "templates:library:*", "settings:audit_logs:*", models.PermTeamMembersInvite} {
+		if !slices.Contains(me.Permissions, want) {
+			t.Errorf("permissions = %v, missing %s", me.Permissions, want)
+		}
+	}
+	if resp := h.DoAs(rep, http.MethodGet, auditLogs, nil); resp.Status != http.StatusOK {
+		t.Errorf("audit logs with the auditor role = %d %s, want 200", resp.Status, resp.Body)
+	}
+
+	// An empty list takes the custom roles away, and the access with them
+	if resp := h.DoAs(admin, http.MethodPut, "/api/v1/admin/users/"+rep.ID+"/roles", models.AssignRolesRequest{RoleIDs: []string{}}); resp.Status != http.StatusOK {
+		t.Fatalf("clear roles = %d %s", resp.Status, resp.Body)
+	}
+	if resp := h.DoAs(rep, http.MethodGet, auditLogs, nil); resp.Status != http.StatusForbidden {
+		t.Errorf("audit logs after clearing the roles = %d %s, want 403", resp.Status, resp.Body)
+	}
+}
+
+// TestCustomRoleRequests checks what creating and assigning roles refuses
+func TestCustomRoleRequests(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	rep := h.CreateUser("rep@example.com", models.UserRoleSalesRep)
+	createRole(t, h, admin, "auditor", "settings:audit_logs:*")
+
+	for _, tt := range []struct {
+		name, code string
+		status     int
+		errCode    string
+	}{
+		{"taken code", "auditor", http.StatusConflict, "ROLE_CODE_TAKEN"},
+		{"built-in code", models.RoleManager, http.StatusConflict, "ROLE_CODE_TAKEN"},
+		{"uppercase code", "Auditor2", http.StatusBadRequest, "INVALID_ROLE_CODE"},
+		{"one letter code", "a", http.StatusBadRequest, "INVALID_ROLE_CODE"},
+	} {
+		resp := h.DoAs(admin, http.MethodPost, "/api/v1/admin/roles", models.CreateCustomRoleRequest{
+			RoleCode: tt.code, RoleName: tt.name, Permissions: []string{"settings:audit_logs:*"},
+		})
+		if resp.Status != tt.status || errorCode(t, resp) != tt.errCode {
+			t.Errorf("%s: create = %d %s, want %d %s", tt.name, resp.Status, resp.Body, tt.status, tt.errCode)
+		}
+	}
+
+	unknown := "/api/v1/admin/users/" + rep.ID + "/roles"
+	if resp := h.DoAs(admin, http.MethodPut, unknown, models.AssignRolesRequest{RoleIDs: []string{"2d7e8f8a-1111-4c4c-8888-000000000001"}}); resp.Status != http.StatusNotFound {
+		t.Errorf("assign an unknown role = %d %s, want 404", resp.Status, resp.Body)
+	}
+
+	// Managing roles takes roles:manage
+	if resp := h.DoAs(rep, http.MethodPost, "/api/v1/admin/roles", models.CreateCustomRoleRequest{RoleCode: "sneaky", RoleName: "Sneaky", Permissions: []string{"*:*:*"}}); resp.Status != http.StatusForbidden {
+		t.Errorf("create as a sales rep = %d %s, want 403", resp.Status, resp.Body)
+	}
+	if resp := h.DoAs(rep, http.MethodPut, unknown, models.AssignRolesRequest{RoleIDs: []string{}}); resp.Status != http.StatusForbidden {
+		t.Errorf("assign as a sales rep = %d %s, want 403", resp.Status, resp.Body)
+	}
+}
+
+// TestDeleteCustomRole checks a role its users still hold is only deleted
+// with somewhere to move them, that they are moved, and that built-in roles
+// are never deleted
+func TestDeleteCustomRole(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	rep := h.CreateUser("rep@example.com", models.UserRoleSalesRep)
+	old := createRole(t, h, admin, "old_auditor", "settings:audit_logs:*")
+	successor := createRole(t, h, admin, "template_approver", "templates:library:*")
+
+	if resp := h.DoAs(admin, http.MethodPut, "/api/v1/admin/users/"+rep.ID+"/roles", models.AssignRolesRequest{RoleIDs: []string{old.ID}}); resp.Status != http.StatusOK {
+		t.Fatalf("assign role = %d %s", resp.Status, resp.Body)
+	}
+
+	path := "/api/v1/admin/roles/" + old.ID
+	resp := h.DoAs(admin, http.MethodDelete, path, nil)
+	if resp.Status != http.StatusConflict || errorCode(t, resp) != "ROLE_IN_USE" {
+		t.Fatalf("delete a held role = %d %s, want 409 ROLE_IN_USE", resp.Status, resp.Body)
+	}
+	if resp := h.DoAs(admin, http.MethodGet, path, nil); resp.Status != http.StatusOK {
+		t.Fatalf("the refused role = %d %s, want it kept", resp.Status, resp.Body)
+	}
+	resp = h.DoAs(admin, http.MethodDelete, path+"?reassign_to="+old.ID, nil)
+	if resp.Status != http.StatusBadRequest || errorCode(t, resp) != "INVALID_REASSIGNMENT" {
+		t.Errorf("reassign to itself = %d %s, want 400 INVALID_REASSIGNMENT", resp.Status, resp.Body)
+	}
+
+	resp = h.DoAs(admin, http.MethodDelete, path+"?reassign_to="+successor.ID, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("delete with reassign_to = %d %s", resp.Status, resp.Body)
+	}
+	var deleted handlers.RoleDeletedResponse
+	resp.Decode(t, &deleted)
+	if deleted.ID != old.ID || deleted.ReassignedUsers != 1 {
+		t.Errorf("deleted = %+v, want %s with 1 user moved", deleted, old.ID)
+	}
+	if resp := h.DoAs(admin, http.MethodGet, path, nil); resp.Status != http.StatusNotFound {
+		t.Errorf("the deleted role = %d %s, want 404", resp.Status, resp.Body)
+	}
+
+	moved, err := h.Users.GetByID(t.Context(), rep.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{successor.ID}; !slices.Equal(moved.RoleIDs, want) {
+		t.Errorf("roles after the reassignment = %v, want %v", moved.RoleIDs, want)
+	}
+	if resp := h.DoAs(rep, http.MethodGet, "/api/v1/admin/system/audit-logs", nil); resp.Status != http.StatusForbidden {
+		t.Errorf("audit logs after the role was deleted = %d %s, want 403", resp.Status, resp.Body)
+	}
+
+	// Unheld roles go without reassign_to; built-in roles never go
+	if resp := h.DoAs(admin, http.MethodDelete, "/api/v1/admin/roles/"+createRole(t, h, admin, "unused", "settings:audit_logs:*").ID, nil); resp.Status != http.StatusOK {
+		t.Errorf("delete an unheld role = %d %s", resp.Status, resp.Body)
+	}
+	var roles models.RolePermissionListResponse
+	h.DoAs(admin, http.MethodGet, "/api/v1/admin/roles", nil).Decode(t, &roles)
+	i := slices.IndexFunc(roles.Roles, func(role models.RolePermission) bool { return role.RoleCode == models.RoleSalesRep })
+	if i < 0 {
+		t.Fatalf("roles = %+v, missing %s", roles.Roles, models.RoleSalesRep)
+	}
+	resp = h.DoAs(admin, http.MethodDelete, "/api/v1/admin/roles/"+roles.Roles[i].ID+"?reassign_to="+successor.ID, nil)
+	if resp.Status != http.StatusConflict || errorCode(t, resp) != "BUILT_IN_ROLE" {
+		t.Errorf("delete a built-in role = %d %s, want 409 BUILT_IN_ROLE", resp.Status, resp.Body)
+	}
+}
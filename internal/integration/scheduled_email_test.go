@@ -0,0 +1,255 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/email"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// countingSender counts the emails it is asked to send, taking a moment
+// over each so that racing workers overlap
+type countingSender struct {
+	sent atomic.Int32
+}
+
+func (s *countingSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	time.Sleep(20 * time.Millisecond)
+	s.sent.Add(1)
+	return nil
+}
+
+func (s *countingSender) Name() string        { return "counting" }
+func (s *countingSender) FromAddress() string { return "noreply@example.test" }
+func (s *countingSender) Capabilities() email.Capabilities {
+	return email.Capabilities{Delivers: true}
+}
+
+func outboxWorker(h *testutil.Harness, sender email.EmailSender) *services.EmailOutboxWorker {
+	return services.NewEmailOutboxWorker(repositories.NewMongoEmailRepository(h.Mongo), sender, nil, config.OutboxConfig{
+		RetryAfter:  time.Minute,
+		MaxAge:      24 * time.Hour,
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		Lease:       time.Minute,
+	})
+}
+
+// scheduleEmail schedules an email from user for at and returns its ID
+func scheduleEmail(t *testing.T, h *testutil.Harness, user *models.User, at time.Time) string {
+	t.Helper()
+	res := h.DoAs(user, http.MethodPost, "/api/v1/communications/messages", models.SendMessageRequest{
+		To:          "lead@example.com",
+		Subject:     "Following up",
+		BodyText:    "Shall we talk on Friday?",
+		ScheduledAt: at.Format(time.RFC3339Nano),
+	})
+	if res.Status != http.StatusAccepted {
+		t.Fatalf("scheduling an email = %d %s", res.Status, res.Body)
+	}
+	var msg models.CommMessage
+	res.Decode(t, &msg)
+	if msg.Status != models.MessageStatusScheduled {
+		t.Fatalf("scheduled email has status %q", msg.Status)
+	}
+	return msg.MessageID
+}
+
+// makeDue moves the send time of a scheduled email into the past
+func makeDue(t *testing.T, h *testutil.Harness, id string) {
+	t.Helper()
+	if _, err := h.Mongo.Collection("communication").UpdateOne(context.Background(), bson.M{"_id": id},
+		bson.M{"$set": bson.M{"scheduled_at": time.Now().Add(-time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func messageStatus(t *testing.T, h *testutil.Harness, id string) string {
+	t.Helper()
+	var doc struct {
+		Status string `bson:"status"`
+	}
+	if err := h.Mongo.Collection("communication").FindOne(context.Background(), bson.M{"_id": id}).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Status
+}
+
+// TestScheduledEmailIsSentOnceByRacingWorkers runs two workers at the same
+// moment against one due email, several times over, and checks each email
+// is claimed and sent exactly once and can no longer be cancelled
+func TestScheduledEmailIsSentOnceByRacingWorkers(t *testing.T) {
+	h := testutil.New(t)
+	user := h.CreateUser("dana@example.com", models.UserRoleSalesRep)
+	sender := &countingSender{}
+	workers := []*services.EmailOutboxWorker{outboxWorker(h, sender), outboxWorker(h, sender)}
+
+	const rounds = 10
+	for round := 0; round < rounds; round++ {
+		id := scheduleEmail(t, h, user, time.Now().Add(time.Hour))
+		makeDue(t, h, id)
+
+		var wg sync.WaitGroup
+		var total atomic.Int32
+		start := make(chan struct{})
+		for _, w := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				sent, err := w.ProcessDue(context.Background())
+				if err != nil {
+					t.Error(err)
+				}
+				total.Add(int32(sent))
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if total.Load() != 1 {
+			t.Errorf("round %d: workers sent the email %d times, want once", round, total.Load())
+		}
+		if status := messageStatus(t, h, id); status != models.MessageStatusSent {
+			t.Errorf("round %d: status %q after sending", round, status)
+		}
+		if res := h.DoAs(user, http.MethodDelete, "/api/v1/communications/messages/"+id, nil); res.Status != http.StatusConflict {
+			t.Errorf("round %d: cancelling a sent email = %d, want 409", round, res.Status)
+		}
+	}
+	if n := sender.sent.Load(); n != rounds {
+		t.Errorf("%d emails reached the sender, want %d", n, rounds)
+	}
+}
+
+// TestScheduledEmailCancelledJustBeforeItIsDue cancels emails moments
+// before their send time, and after it but before a worker claims them, and
+// checks neither is sent
+func TestScheduledEmailCancelledJustBeforeItIsDue(t *testing.T) {
+	h := testutil.New(t)
+	user := h.CreateUser("dana@example.com", models.UserRoleSalesRep)
+	other := h.CreateUser("sam@example.com", models.UserRoleSalesRep)
+	sender := &countingSender{}
+	worker := outboxWorker(h, sender)
+
+	due := time.Now().Add(time.Second)
+	soon := scheduleEmail(t, h, user, due)
+	overdue := scheduleEmail(t, h, user, time.Now().Add(time.Hour))
+	makeDue(t, h, overdue)
+	kept := scheduleEmail(t, h, user, time.Now().Add(time.Hour))
+
+	var listing struct {
+		Items []models.CommMessage `json:"items"`
+	}
+	h.DoAs(user, http.MethodGet, "/api/v1/communications/inbox?status=scheduled", nil).Decode(t, &listing)
+	if len(listing.Items) != 3 {
+		t.Errorf("%d scheduled emails listed, want 3", len(listing.Items))
+	}
+	for _, msg := range listing.Items {
+		if msg.Status != models.MessageStatusScheduled || msg.ScheduledAt == nil || msg.ScheduledAt.Location() != time.UTC {
+			t.Errorf("listed %s with status %q at %v, want scheduled in UTC", msg.MessageID, msg.Status, msg.ScheduledAt)
+		}
+	}
+
+	if res := h.DoAs(other, http.MethodDelete, "/api/v1/communications/messages/"+soon, nil); res.Status != http.StatusNotFound {
+		t.Errorf("another user cancelling the email = %d, want 404", res.Status)
+	}
+	time.Sleep(time.Until(due.Add(-100 * time.Millisecond)))
+	for _, id := range []string{soon, overdue} {
+		if res := h.DoAs(user, http.MethodDelete, "/api/v1/communications/messages/"+id, nil); res.Status != http.StatusNoContent {
+			t.Fatalf("cancelling %s = %d %s", id, res.Status, res.Body)
+		}
+	}
+	time.Sleep(time.Until(due.Add(100 * time.Millisecond)))
+
+	if sent, err := worker.ProcessDue(context.Background()); err != nil || sent != 0 {
+		t.Errorf("ProcessDue after the cancellations = %d, %v, want nothing sent", sent, err)
+	}
+	if res := h.DoAs(user, http.MethodDelete, "/api/v1/communications/messages/"+soon, nil); res.Status != http.StatusNotFound {
+		t.Errorf("cancelling a cancelled email = %d, want 404", res.Status)
+	}
+	if status := messageStatus(t, h, kept); status != models.MessageStatusScheduled {
+		t.Errorf("an email scheduled later has status %q", status)
+	}
+	if n := sender.sent.Load(); n != 0 {
+		t.Errorf("%d cancelled emails were sent", n)
+	}
+}
+
+// TestEmailDueOutsideTheSendWindowWaits runs the outbox worker at 3am by a
+// fake clock and checks a due email is rescheduled for the window's opening
+// without spending an attempt, while an urgent one is sent at once
+func TestEmailDueOutsideTheSendWindowWaits(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	user := h.CreateUser("dana@example.com", models.UserRoleSalesRep)
+	settings := repositories.NewSettingsRepository(h.Mongo)
+	if _, err := settings.UpdateSystemDefaultSettings(ctx, &models.UpdateSystemDefaultSettingsRequest{
+		Timezone: "UTC", WorkingHoursStart: "09:00", WorkingHoursEnd: "18:00",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Wednesday well after the test runs, so the held email is not due
+	// again by the real clock the claim uses
+	now := time.Date(2099, 3, 4, 3, 0, 0, 0, time.UTC)
+	window := services.NewSendWindowEnforcer(settings)
+	window.SetClock(func() time.Time { return now })
+	sender := &countingSender{}
+	worker := outboxWorker(h, sender)
+	worker.SetSendWindow(window)
+
+	held := scheduleEmail(t, h, user, time.Now().Add(time.Hour))
+	makeDue(t, h, held)
+	urgent := scheduleEmail(t, h, user, time.Now().Add(time.Hour))
+	makeDue(t, h, urgent)
+	messages := h.Mongo.Collection("communication")
+	if _, err := messages.UpdateOne(ctx, bson.M{"_id": urgent}, bson.M{"$set": bson.M{"priority": models.PriorityUrgent}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent, err := worker.ProcessDue(ctx); err != nil || sent != 1 {
+		t.Fatalf("ProcessDue at 3am = %d, %v, want the urgent email sent", sent, err)
+	}
+	if status := messageStatus(t, h, urgent); status != models.MessageStatusSent {
+		t.Errorf("urgent email has status %q, want sent", status)
+	}
+	var doc struct {
+		Status       string     `bson:"status"`
+		ScheduledAt  *time.Time `bson:"scheduled_at"`
+		SendAttempts int        `bson:"send_attempts"`
+		LeaseOwner   string     `bson:"lease_owner"`
+	}
+	if err := messages.FindOne(ctx, bson.M{"_id": held}).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	opening := time.Date(2099, 3, 4, 9, 0, 0, 0, time.UTC)
+	if doc.Status != models.MessageStatusScheduled || doc.ScheduledAt == nil || !doc.ScheduledAt.Equal(opening) || doc.SendAttempts != 0 || doc.LeaseOwner != "" {
+		t.Errorf("held email = %+v, want scheduled for %v with no attempt spent and no lease", doc, opening)
+	}
+
+	// Held emails can still be cancelled; once the window opens the rest go
+	if res := h.DoAs(user, http.MethodDelete, "/api/v1/communications/messages/"+held, nil); res.Status != http.StatusNoContent {
+		t.Errorf("cancelling the held email = %d %s", res.Status, res.Body)
+	}
+	later := scheduleEmail(t, h, user, time.Now().Add(time.Hour))
+	makeDue(t, h, later)
+	now = opening
+	if sent, err := worker.ProcessDue(ctx); err != nil || sent != 1 {
+		t.Errorf("ProcessDue at the opening = %d, %v, want the due email sent", sent, err)
+	}
+	if n := sender.sent.Load(); n != 2 {
+		t.Errorf("%d emails sent, want the urgent one and the one due at the opening", n)
+	}
+}
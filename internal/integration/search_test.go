@@ -0,0 +1,116 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// searchResponse is the body of GET /api/v1/communications/search
+type searchResponse struct {
+	Results []repositories.MessageSearchResult `json:"results"`
+	Total   int64                              `json:"total"`
+}
+
+// search runs a message search as user with the given query parameters
+func search(t *testing.T, h *testutil.Harness, user *models.User, params url.Values) searchResponse {
+	t.Helper()
+	resp := h.DoAs(user, http.MethodGet, "/api/v1/communications/search?"+params.Encode(), nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("search %s = %d %s", params.Encode(), resp.Status, resp.Body)
+	}
+	var body searchResponse
+	resp.Decode(t, &body)
+	return body
+}
+
+// seedMessage returns a message of user sent at sentAt, ready to insert
+func seedMessage(user *models.User, channel, subject, body string, sentAt time.Time) models.MongoCommunication {
+	return models.MongoCommunication{
+		ID:        uuid.MustNewUUID(),
+		Channel:   channel,
+		Direction: models.DirectionOutbound,
+		From:      user.Name,
+		FromEmail: user.Email,
+		To:        "Lee Park",
+		ToEmail:   "lee@acme.test",
+		Subject:   subject,
+		Body:      body,
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		Status:    "sent",
+		SentAt:    sentAt,
+		CreatedAt: sentAt,
+	}
+}
+
+// TestMessageSearch seeds a few hundred messages of two users and checks
+// the search ranks subject matches first, filters on channel and date, and
+// never returns another user's messages
+func TestMessageSearch(t *testing.T) {
+	h := testutil.New(t)
+	rep := h.CreateUser("rep@example.com", models.UserRoleSalesRep)
+	other := h.CreateUser("other@example.com", models.UserRoleSalesRep)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var docs []interface{}
+	for i := 0; i < 150; i++ {
+		for _, user := range []*models.User{rep, other} {
+			docs = append(docs, seedMessage(user, "email", fmt.Sprintf("Pipeline update %d", i), "Numbers for this week are in the dashboard.", now.Add(-time.Duration(i)*time.Hour)))
+		}
+	}
+	inSubject := seedMessage(rep, "email", "Acme renewal", "Following up on the renewal quote for Acme.", now.Add(-72*time.Hour))
+	inBody := seedMessage(rep, "email", "Quick question", "Did Acme get a chance to review the renewal terms?", now.Add(-time.Hour))
+	old := seedMessage(rep, "email", "Last year", "Last year's renewal went through in March.", now.Add(-400*24*time.Hour))
+	sms := seedMessage(rep, "sms", "", "Reminder: renewal call at 3pm", now)
+	othersRenewal := seedMessage(other, "email", "Globex renewal", "The Globex renewal is signed.", now)
+	docs = append(docs, inSubject, inBody, old, sms, othersRenewal)
+	if _, err := h.Mongo.Collection("communication").InsertMany(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+
+	found := search(t, h, rep, url.Values{"q": {"renewal"}})
+	var ids []string
+	for _, result := range found.Results {
+		ids = append(ids, result.Message.MessageID)
+		if result.Message.UserID != rep.ID {
+			t.Errorf("%s of user %s was returned to %s", result.Message.MessageID, result.Message.UserID, rep.ID)
+		}
+		if len(result.Highlights) == 0 {
+			t.Errorf("%q has no highlights in snippet %q", result.Message.Subject, result.Snippet)
+		}
+	}
+	if found.Total != 3 || len(ids) != 3 || ids[0] != inSubject.ID {
+		t.Fatalf("results = %v (total %d), want the subject match first of 3 emails", ids, found.Total)
+	}
+
+	if got := search(t, h, rep, url.Values{"q": {"renewal"}, "channel": {"sms"}}); got.Total != 1 || got.Results[0].Message.MessageID != sms.ID {
+		t.Errorf("sms search = %+v, want the sms only", got)
+	}
+	from := now.Add(-30 * 24 * time.Hour).Format(time.RFC3339)
+	if got := search(t, h, rep, url.Values{"q": {"renewal"}, "from": {from}}); got.Total != 2 {
+		t.Errorf("search from %s found %d, want the 2 recent emails", from, got.Total)
+	}
+	paged := search(t, h, rep, url.Values{"q": {"renewal"}, "page": {"2"}, "limit": {"1"}})
+	if paged.Total != 3 || len(paged.Results) != 1 || paged.Results[0].Message.MessageID != ids[1] {
+		t.Errorf("second page of 1 = %+v, want the second result", paged)
+	}
+
+	if got := search(t, h, other, url.Values{"q": {"renewal"}}); got.Total != 1 || got.Results[0].Message.MessageID != othersRenewal.ID {
+		t.Errorf("the other user found %+v, want their own message only", got)
+	}
+
+	for _, query := range []string{"re", "  a  "} {
+		if resp := h.DoAs(rep, http.MethodGet, "/api/v1/communications/search?q="+url.QueryEscape(query), nil); resp.Status != http.StatusBadRequest {
+			t.Errorf("search %q = %d, want 400", query, resp.Status)
+		}
+	}
+}
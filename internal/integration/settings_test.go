@@ -0,0 +1,210 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// legacyUser creates a user whose ID is the hex form of an ObjectID, as
+// users created before string UUIDs were, and returns the ObjectID
+func legacyUser(t *testing.T, h *testutil.Harness, address string) (*models.User, primitive.ObjectID) {
+	t.Helper()
+	ctx := context.Background()
+	user := h.CreateUser(address, models.UserRoleSalesRep)
+	users := h.Mongo.Collection("users")
+	if _, err := users.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	oid := primitive.NewObjectID()
+	user.ID = oid.Hex()
+	if _, err := users.InsertOne(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	return user, oid
+}
+
+// TestObjectIDKeyedSettingsAreFoundAfterTheMigration stores 2FA settings
+// under an ObjectID user_id, which login never finds, and checks 2FA is
+// asked for once MigrateObjectIDUserIDs has rewritten them
+func TestObjectIDKeyedSettingsAreFoundAfterTheMigration(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	user, oid := legacyUser(t, h, "legacy@example.com")
+	duplicate, duplicateOID := legacyUser(t, h, "both@example.com")
+
+	security := h.Mongo.Collection("security_settings")
+	if _, err := security.InsertMany(ctx, []interface{}{
+		bson.M{"user_id": oid, "two_factor_enabled": true, "two_factor_method": models.TwoFactorMethodEmail, "session_timeout": 30},
+		// A user who also has settings under the string ID keeps those
+		bson.M{"user_id": duplicateOID, "two_factor_enabled": true, "session_timeout": 30},
+		bson.M{"user_id": duplicate.ID, "two_factor_enabled": false, "session_timeout": 30},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Mongo.Collection("audit_logs").InsertOne(ctx, bson.M{"user_id": oid, "action": "login"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if before := login(t, h, user.Email, testutil.Password); before.Requires2FA {
+		t.Fatalf("login before the migration = %+v; the ObjectID-keyed settings were found", before)
+	}
+
+	settings := repositories.NewSettingsRepository(h.Mongo)
+	results, err := settings.MigrateObjectIDUserIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]repositories.UserIDMigrationResult{}
+	for _, result := range results {
+		counts[result.Collection] = result
+	}
+	if got := counts["security_settings"]; got.Converted != 1 || got.Dropped != 1 {
+		t.Errorf("security_settings = %+v, want 1 converted and 1 dropped", got)
+	}
+	if got := counts["audit_logs"]; got.Converted != 1 {
+		t.Errorf("audit_logs = %+v, want 1 converted", got)
+	}
+
+	if after := login(t, h, user.Email, testutil.Password); !after.Requires2FA {
+		t.Errorf("login after the migration = %+v, want a 2FA challenge", after)
+	}
+	if kept := login(t, h, duplicate.Email, testutil.Password); kept.Requires2FA {
+		t.Errorf("login of the user with both documents = %+v, want the string-keyed settings, without 2FA", kept)
+	}
+	if n, err := security.CountDocuments(ctx, bson.M{"user_id": bson.M{"$type": "objectId"}}); err != nil || n != 0 {
+		t.Errorf("%d ObjectID user_id left (%v), want none", n, err)
+	}
+
+	// Running it again changes nothing
+	results, err = settings.MigrateObjectIDUserIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Converted != 0 || result.Dropped != 0 {
+			t.Errorf("second run: %+v, want nothing to do", result)
+		}
+	}
+}
+
+// TestSystemSettingsDryRunAndAudit previews a system security update,
+// checks nothing was stored, then makes it and checks the audit entry in the
+// events outbox lists exactly the fields changed
+func TestSystemSettingsDryRunAndAudit(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	security := h.Mongo.Collection("system_security")
+	outbox := h.Mongo.Collection("events_outbox")
+	settingsAudits := bson.M{"payload": bson.M{"$regex": `"action":"` + string(events.ActionSettingsUpdated) + `"`}}
+
+	length, expiry := 14, 90
+	update := models.UpdateSystemSecuritySettingsRequest{MinPasswordLength: &length, PasswordExpiryDays: &expiry}
+	resp := h.DoAs(admin, http.MethodPut, "/api/v1/admin/system/security?dry_run=true", update)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("dry run = %d %s", resp.Status, resp.Body)
+	}
+	if n, err := security.CountDocuments(ctx, bson.M{}); err != nil || n != 0 {
+		t.Errorf("%d system security documents after the dry run (%v), want none", n, err)
+	}
+	if n, err := outbox.CountDocuments(ctx, settingsAudits); err != nil || n != 0 {
+		t.Errorf("%d settings audit events after the dry run (%v), want none", n, err)
+	}
+
+	if resp := h.DoAs(admin, http.MethodPut, "/api/v1/admin/system/security", update); resp.Status != http.StatusOK {
+		t.Fatalf("update = %d %s", resp.Status, resp.Body)
+	}
+	var stored models.SystemSecuritySettings
+	if err := security.FindOne(ctx, bson.M{}).Decode(&stored); err != nil || stored.MinPasswordLength != length {
+		t.Fatalf("stored settings = %+v (%v), want minPasswordLength %d", stored, err, length)
+	}
+
+	var recorded models.OutboxEvent
+	if err := outbox.FindOne(ctx, settingsAudits).Decode(&recorded); err != nil {
+		t.Fatalf("no settings audit event in the outbox: %v", err)
+	}
+	var event events.AuditEvent
+	if err := json.Unmarshal([]byte(recorded.Payload), &event); err != nil {
+		t.Fatal(err)
+	}
+	// The expiry sent is the default, so only the length changed
+	want := map[string]interface{}{"changes": map[string]interface{}{
+		"minPasswordLength": map[string]interface{}{"old": float64(12), "new": float64(length)},
+	}}
+	if !reflect.DeepEqual(event.Metadata, want) || event.UserID != admin.ID {
+		t.Errorf("audit event by %s with metadata %v, want %v", event.UserID, event.Metadata, want)
+	}
+}
+
+// TestFirstSystemDefaultsUpdateKeepsTheOtherDefaults checks the first
+// update of the system defaults, which creates their document, changes the
+// fields sent only, as its dry run said it would
+func TestFirstSystemDefaultsUpdateKeepsTheOtherDefaults(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+
+	var body struct {
+		Data    models.SystemDefaultSettings          `json:"data"`
+		Changes map[string]models.SettingsFieldChange `json:"changes"`
+	}
+	update := models.UpdateSystemDefaultSettingsRequest{Currency: "USD"}
+	for _, path := range []string{"/api/v1/admin/system/defaults?dry_run=true", "/api/v1/admin/system/defaults"} {
+		resp := h.DoAs(admin, http.MethodPut, path, update)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("PUT %s = %d %s", path, resp.Status, resp.Body)
+		}
+		resp.Decode(t, &body)
+		if len(body.Changes) != 1 || body.Changes["currency"] != (models.SettingsFieldChange{Old: "INR", New: "USD"}) {
+			t.Errorf("PUT %s changes = %v, want currency only", path, body.Changes)
+		}
+		if body.Data.Timezone != "Asia/Kolkata" || body.Data.WorkingHoursStart != "09:00" || body.Data.WorkingHoursEnd != "18:00" {
+			t.Errorf("PUT %s settings = %+v, want the defaults kept", path, body.Data)
+		}
+	}
+
+	var stored struct {
+		Data models.SystemDefaultSettings `json:"data"`
+	}
+	h.DoAs(admin, http.MethodGet, "/api/v1/admin/system/defaults", nil).Decode(t, &stored)
+	if stored.Data.Currency != "USD" || stored.Data.Language != "english" {
+		t.Errorf("stored settings = %+v, want USD with the default language", stored.Data)
+	}
+}
+
+// TestMigrateWorkingHours rewrites working hours stored in the legacy 9am
+// form as HH:MM and checks a second run changes nothing
+func TestMigrateWorkingHours(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	if _, err := h.Mongo.Collection("system_defaults").InsertOne(ctx, bson.M{
+		"timezone": "Asia/Kolkata", "working_hours_start": "9:30am", "working_hours_end": "6pm",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := repositories.NewSettingsRepository(h.Mongo)
+	result, err := settings.MigrateWorkingHours(ctx)
+	if err != nil || !result.Migrated || result.Start != "09:30" || result.End != "18:00" {
+		t.Fatalf("MigrateWorkingHours = %+v, %v, want 09:30-18:00 migrated", result, err)
+	}
+	stored, err := settings.GetSystemDefaultSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.WorkingHoursStart != "09:30" || stored.WorkingHoursEnd != "18:00" || len(stored.WorkingDays) != len(models.DefaultWorkingDays) {
+		t.Errorf("stored settings = %+v", stored)
+	}
+	if result, err := settings.MigrateWorkingHours(ctx); err != nil || result.Migrated {
+		t.Errorf("second run = %+v, %v, want nothing to do", result, err)
+	}
+}
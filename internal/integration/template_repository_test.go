@@ -0,0 +1,162 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// TestTemplateRoundTripsThroughMongo stores a template with every field set,
+// reloads it and diffs all fields, then edits every editable field and
+// checks an update changes exactly those
+func TestTemplateRoundTripsThroughMongo(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	owner := h.CreateUser("dana@example.com", models.UserRoleAdmin)
+	repo := repositories.NewMongoTemplateRepository(h.Mongo)
+
+	at := func(day int) *time.Time {
+		t := time.Date(2026, 3, day, 9, 30, 15, 250_000_000, time.UTC)
+		return &t
+	}
+	want := &models.MongoTemplate{
+		ID:          uuid.MustNewUUID(),
+		TenantID:    owner.TenantID,
+		Name:        "Spring follow-up",
+		Description: "Second touch after a demo",
+		Type:        "email",
+		Channel:     "email",
+		Status:      "published",
+		Content:     map[string]string{"subject": "Hi {{first_name}}", "body_html": "<p>Thanks for your time</p>"},
+		Subject:     "Hi {{first_name}}",
+		Body:        "Thanks for your time, {{first_name}}",
+		Variables:   []string{"first_name"},
+		VariablesSchema: []models.TemplateVariable{{
+			Name:     "first_name",
+			Type:     models.TemplateVariableString,
+			Required: true,
+			Default:  "there",
+			Example:  "Dana",
+		}},
+		CustomFields:     map[string]string{"region": "emea"},
+		Category:         "follow-up",
+		Tags:             []string{"demo", "spring"},
+		Version:          3,
+		IsSystem:         true,
+		SystemKey:        "system.2fa_otp",
+		UpdatedAt:        *at(2),
+		CreatedBy:        owner.ID,
+		PublishedAt:      at(3),
+		PublishedBy:      owner.ID,
+		DeletedAt:        at(4),
+		DeletedBy:        owner.ID,
+		ForStage:         []string{"mql", "sql"},
+		Industries:       []string{"saas"},
+		ApprovalFlag:     "green",
+		AiEnhanced:       true,
+		ServiceID:        "service-1",
+		ApprovalStatus:   "approved",
+		Approvals:        []models.TemplateApproval{{Action: models.TemplateApprovalApprove, ActorID: owner.ID, Comment: "Looks good", At: *at(5)}},
+		MetaTemplateName: "spring_follow_up",
+		MetaStatus:       "approved",
+		SubmittedDate:    at(6),
+		ExpectedApproval: at(7),
+		TemplateType:     "InMail Message",
+		KoshDocumentIds:  []string{"kosh-1", "kosh-2"},
+	}
+	if err := repo.Create(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	// MongoDB keeps milliseconds
+	want.CreatedAt = want.CreatedAt.Truncate(time.Millisecond).UTC()
+
+	got, err := repo.GetByIDAnyState(ctx, owner.TenantID, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded template differs:\n got %+v\nwant %+v", *got, *want)
+	}
+
+	edited := *want
+	edited.Name, edited.Description = "Summer follow-up", "Third touch"
+	edited.Type, edited.Channel, edited.Status = "sms", "sms", "draft"
+	edited.Content = map[string]string{"body": "Hi {{name}}"}
+	edited.Subject, edited.Body = "Hello", "Hi {{name}}"
+	edited.Variables = []string{"name"}
+	edited.VariablesSchema = []models.TemplateVariable{{Name: "name", Type: models.TemplateVariableString}}
+	edited.CustomFields = map[string]string{"region": "apac"}
+	edited.Category, edited.Tags = "nurture", []string{"summer"}
+	edited.ForStage, edited.Industries = []string{"prospect"}, []string{"retail"}
+	edited.ApprovalFlag, edited.AiEnhanced, edited.ServiceID = "yellow", false, "service-2"
+	edited.MetaTemplateName, edited.TemplateType = "summer_follow_up", "Connection Request"
+	edited.KoshDocumentIds = []string{"kosh-3"}
+	if err := repo.UpdateTemplate(ctx, &edited); err != nil {
+		t.Fatal(err)
+	}
+	edited.UpdatedAt = edited.UpdatedAt.Truncate(time.Millisecond).UTC()
+
+	got, err = repo.GetByIDAnyState(ctx, owner.TenantID, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != want.Version+1 {
+		t.Errorf("version after an update = %d, want %d", got.Version, want.Version+1)
+	}
+	if !reflect.DeepEqual(got, &edited) {
+		t.Errorf("updated template differs:\n got %+v\nwant %+v", *got, edited)
+	}
+}
+
+// TestActiveSequencesUsingATemplateStayInTheTenant checks only the tenant's
+// own active sequences, and the default tenant's sequences from before
+// tenants were recorded, count as using one of its templates
+func TestActiveSequencesUsingATemplateStayInTheTenant(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	sequences := repositories.NewSequenceTemplateRepository(h.Mongo)
+	templates := repositories.NewMongoTemplateRepository(h.Mongo)
+	templateID := uuid.MustNewUUID()
+
+	create := func(tenantID, name string, active bool) *models.SequenceTemplateWithSteps {
+		t.Helper()
+		sequence := &models.SequenceTemplateWithSteps{
+			Template: models.SequenceTemplate{TenantID: tenantID, Name: name, IsActive: active, CreatedBy: uuid.MustNewUUID()},
+			Steps:    []models.CampaignSequenceStep{{Channel: "email", ContentTemplateID: templateID}},
+		}
+		if err := sequences.CreateSequenceTemplate(ctx, sequence); err != nil {
+			t.Fatal(err)
+		}
+		return sequence
+	}
+	own := create(models.DefaultTenantID, "Onboarding", true)
+	legacy := create("", "Legacy onboarding", true)
+	create(models.DefaultTenantID, "Paused", false)
+	create(uuid.MustNewUUID(), "Another tenant's", true)
+
+	found, err := templates.FindActiveSequencesUsingTemplate(ctx, models.DefaultTenantID, templateID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, sequence := range found {
+		names[sequence.Name] = true
+	}
+	if len(found) != 2 || !names[own.Template.Name] || !names[legacy.Template.Name] {
+		t.Errorf("sequences using the template = %v, want the tenant's active and legacy ones", names)
+	}
+
+	if found, err := templates.FindActiveSequencesUsingTemplate(ctx, uuid.MustNewUUID(), templateID); err != nil || len(found) != 0 {
+		t.Errorf("a tenant without sequences = %d sequences, %v; want none", len(found), err)
+	}
+	if _, err := templates.FindActiveSequencesUsingTemplate(ctx, "", templateID); !errors.Is(err, repositories.ErrTenantRequired) {
+		t.Errorf("no tenant = %v, want ErrTenantRequired", err)
+	}
+}
@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// TestTeamScopedTemplateListingsAreExact stores over a thousand templates
+// created by two teams and checks a manager, whose role scopes campaigns to
+// their team, gets the exact count of their team's templates and pages
+// through every one of them
+func TestTeamScopedTemplateListingsAreExact(t *testing.T) {
+	h := testutil.New(t)
+	var north, south []*models.User
+	for i := 0; i < 3; i++ {
+		north = append(north, h.CreateUser(fmt.Sprintf("north%d@example.com", i), models.UserRoleManager, testutil.WithTeam("north")))
+		south = append(south, h.CreateUser(fmt.Sprintf("south%d@example.com", i), models.UserRoleManager, testutil.WithTeam("south")))
+	}
+
+	const northCount, southCount = 613, 742
+	northIDs := map[string]bool{}
+	var docs []interface{}
+	created := time.Now().Add(-time.Hour)
+	for i := 0; i < northCount+southCount; i++ {
+		team := south
+		if i < northCount {
+			team = north
+		}
+		template := models.MongoTemplate{
+			ID:        uuid.MustNewUUID(),
+			TenantID:  team[0].TenantID,
+			Name:      fmt.Sprintf("%s %d", team[0].Team, i),
+			Channel:   "email",
+			Status:    string(models.TemplateStatusDraft),
+			CreatedBy: team[i%len(team)].ID,
+			// Runs of templates created in the same millisecond
+			CreatedAt: created.Add(time.Duration(i/4) * time.Millisecond),
+		}
+		if i < northCount {
+			northIDs[template.ID] = true
+		}
+		docs = append(docs, template)
+	}
+	if _, err := h.Mongo.Collection("templates").InsertMany(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+
+	type listing struct {
+		Templates  []models.MongoTemplate `json:"templates"`
+		Total      int                    `json:"total"`
+		TotalPages int                    `json:"totalPages"`
+	}
+	const limit = 100
+	pages := (northCount + limit - 1) / limit
+	seen := map[string]bool{}
+	for page := 1; page <= pages+1; page++ {
+		resp := h.DoAs(north[1], http.MethodGet, fmt.Sprintf("/api/v1/templates?limit=%d&page=%d", limit, page), nil)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("page %d = %d %s", page, resp.Status, resp.Body)
+		}
+		var body listing
+		resp.Decode(t, &body)
+		if body.Total != northCount || body.TotalPages != pages {
+			t.Errorf("page %d: total %d in %d pages, want %d in %d", page, body.Total, body.TotalPages, northCount, pages)
+		}
+		if want := min(limit, max(northCount-(page-1)*limit, 0)); len(body.Templates) != want {
+			t.Errorf("page %d holds %d templates, want %d", page, len(body.Templates), want)
+		}
+		for _, template := range body.Templates {
+			if !northIDs[template.ID] || seen[template.ID] {
+				t.Fatalf("page %d lists %q, of another team or again", page, template.Name)
+			}
+			seen[template.ID] = true
+		}
+	}
+	if len(seen) != northCount {
+		t.Errorf("the pages listed %d templates, want all %d of the team", len(seen), northCount)
+	}
+
+	resp := h.DoAs(south[2], http.MethodGet, "/api/v1/templates?limit=1", nil)
+	var body listing
+	resp.Decode(t, &body)
+	if body.Total != southCount {
+		t.Errorf("the other team's total = %d, want %d", body.Total, southCount)
+	}
+}
@@ -0,0 +1,91 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// cached reports whether the template cache holds template; checked is
+// false without TEST_REDIS_URL, when there is no cache
+func cached(h *testutil.Harness, template *models.MongoTemplate) (held, checked bool) {
+	if h.Cache == nil {
+		return false, false
+	}
+	_, held = h.Cache.Get(context.Background(), template.TenantID, template.ID)
+	return held, true
+}
+
+// TestTemplateLifecycle creates, lists, publishes, updates and deletes a
+// template, checking what the cache holds at each step when it is on
+func TestTemplateLifecycle(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+
+	template := createTemplate(t, h, admin, "Welcome")
+	if held, _ := cached(h, template); held {
+		t.Errorf("a draft template was cached")
+	}
+	if listed := listTemplates(t, h, admin); len(listed) != 1 || listed[template.ID] != "Welcome" {
+		t.Fatalf("listed templates = %v, want the new template", listed)
+	}
+
+	if resp := h.DoAs(admin, http.MethodPost, "/api/v1/templates/"+template.ID+"/publish?force=true", nil); resp.Status != http.StatusOK {
+		t.Fatalf("publish = %d %s", resp.Status, resp.Body)
+	}
+	if held, checked := cached(h, template); checked && !held {
+		t.Errorf("the published template was not cached")
+	}
+	var hits uint64
+	if h.Cache != nil {
+		hits = h.Cache.Stats().Hits
+	}
+	if resp := h.DoAs(admin, http.MethodGet, "/api/v1/templates/"+template.ID, nil); resp.Status != http.StatusOK {
+		t.Fatalf("get = %d %s", resp.Status, resp.Body)
+	}
+	if h.Cache != nil && h.Cache.Stats().Hits <= hits {
+		t.Errorf("reading the published template missed the cache")
+	}
+
+	// A listing cached before a change is not served after it
+	second := createTemplate(t, h, admin, "Follow up")
+	if listed := listTemplates(t, h, admin); len(listed) != 2 || listed[second.ID] != "Follow up" {
+		t.Errorf("listed templates = %v, want both templates", listed)
+	}
+
+	resp := h.DoAs(admin, http.MethodPut, "/api/v1/templates/"+template.ID, models.UpdateTemplateRequest{Name: "Welcome back"})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("update = %d %s", resp.Status, resp.Body)
+	}
+	if held, _ := cached(h, template); held {
+		t.Errorf("the updated template is still cached")
+	}
+	var read models.MongoTemplate
+	resp = h.DoAs(admin, http.MethodGet, "/api/v1/templates/"+template.ID, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("get = %d %s", resp.Status, resp.Body)
+	}
+	resp.Decode(t, &read)
+	if read.Name != "Welcome back" {
+		t.Errorf("read template name = %q, want %q", read.Name, "Welcome back")
+	}
+	if listed := listTemplates(t, h, admin); listed[template.ID] != "Welcome back" {
+		t.Errorf("listed templates = %v, want the new name", listed)
+	}
+
+	if resp := h.DoAs(admin, http.MethodDelete, "/api/v1/templates/"+template.ID, nil); resp.Status != http.StatusNoContent {
+		t.Fatalf("delete = %d %s", resp.Status, resp.Body)
+	}
+	if held, _ := cached(h, template); held {
+		t.Errorf("the deleted template is still cached")
+	}
+	if resp := h.DoAs(admin, http.MethodGet, "/api/v1/templates/"+template.ID, nil); resp.Status != http.StatusNotFound {
+		t.Errorf("reading the deleted template = %d, want 404", resp.Status)
+	}
+	if listed := listTemplates(t, h, admin); len(listed) != 1 || listed[second.ID] == "" {
+		t.Errorf("listed templates = %v, want only the remaining template", listed)
+	}
+}
@@ -0,0 +1,263 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// twoTenants is a harness with an admin in each of the acme and globex
+// tenants
+type twoTenants struct {
+	*testutil.Harness
+	acme   *models.User
+	globex *models.User
+}
+
+func newTwoTenants(t *testing.T) *twoTenants {
+	t.Helper()
+	h := testutil.New(t)
+	return &twoTenants{
+		Harness: h,
+		acme:    h.CreateUser("admin@acme.test", models.UserRoleAdmin, testutil.WithTenant("acme")),
+		globex:  h.CreateUser("admin@globex.test", models.UserRoleAdmin, testutil.WithTenant("globex")),
+	}
+}
+
+// createTemplate creates an email template named name as user
+func createTemplate(t *testing.T, h *testutil.Harness, user *models.User, name string) *models.MongoTemplate {
+	t.Helper()
+	resp := h.DoAs(user, http.MethodPost, "/api/v1/templates", models.CreateTemplateRequest{
+		Name:    name,
+		Channel: "email",
+		Subject: "Hello {{first_name}}",
+		Message: "<p>Welcome aboard, {{first_name}}</p>",
+	})
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("creating template %q as %s = %d %s", name, user.Email, resp.Status, resp.Body)
+	}
+	var template models.MongoTemplate
+	resp.Decode(t, &template)
+	return &template
+}
+
+// listTemplates maps the ID of each template user lists to its name
+func listTemplates(t *testing.T, h *testutil.Harness, user *models.User) map[string]string {
+	t.Helper()
+	resp := h.DoAs(user, http.MethodGet, "/api/v1/templates", nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("listing templates as %s = %d %s", user.Email, resp.Status, resp.Body)
+	}
+	var body struct {
+		Templates []models.MongoTemplate `json:"templates"`
+	}
+	resp.Decode(t, &body)
+	names := make(map[string]string, len(body.Templates))
+	for _, template := range body.Templates {
+		names[template.ID] = template.Name
+	}
+	return names
+}
+
+func TestTenantsCannotReachEachOthersTemplates(t *testing.T) {
+	h := newTwoTenants(t)
+	acmeTemplate := createTemplate(t, h.Harness, h.acme, "Welcome")
+	globexTemplate := createTemplate(t, h.Harness, h.globex, "Welcome")
+
+	for _, tt := range []struct {
+		user       *models.User
+		own, other *models.MongoTemplate
+	}{
+		{h.acme, acmeTemplate, globexTemplate},
+		{h.globex, globexTemplate, acmeTemplate},
+	} {
+		if listed := listTemplates(t, h.Harness, tt.user); len(listed) != 1 || listed[tt.own.ID] == "" {
+			t.Errorf("%s lists %v, want only its own template", tt.user.TenantID, listed)
+		}
+		if resp := h.DoAs(tt.user, http.MethodGet, "/api/v1/templates/"+tt.own.ID, nil); resp.Status != http.StatusOK {
+			t.Errorf("%s reading its own template = %d", tt.user.TenantID, resp.Status)
+		}
+
+		for _, req := range []struct {
+			method, path string
+			body         interface{}
+		}{
+			{http.MethodGet, "/api/v1/templates/" + tt.other.ID, nil},
+			{http.MethodPut, "/api/v1/templates/" + tt.other.ID, models.UpdateTemplateRequest{Name: "Taken over"}},
+			{http.MethodPost, "/api/v1/templates/" + tt.other.ID + "/duplicate", map[string]string{}},
+			{http.MethodDelete, "/api/v1/templates/" + tt.other.ID, nil},
+			{http.MethodDelete, "/api/v1/templates/" + tt.other.ID + "?permanent=true", nil},
+		} {
+			if resp := h.DoAs(tt.user, req.method, req.path, req.body); resp.Status != http.StatusNotFound {
+				t.Errorf("%s: %s %s = %d %s, want 404", tt.user.TenantID, req.method, req.path, resp.Status, resp.Body)
+			}
+		}
+	}
+
+	templates := repositories.NewMongoTemplateRepository(h.Mongo)
+	for _, template := range []*models.MongoTemplate{acmeTemplate, globexTemplate} {
+		stored, err := templates.GetByID(context.Background(), template.TenantID, template.ID)
+		if err != nil {
+			t.Fatalf("%s template: %v", template.TenantID, err)
+		}
+		if stored.Name != "Welcome" || stored.Version != 1 {
+			t.Errorf("%s template = %q version %d, want it untouched", template.TenantID, stored.Name, stored.Version)
+		}
+	}
+}
+
+func TestTenantsCannotReachEachOthersMessages(t *testing.T) {
+	h := newTwoTenants(t)
+	scheduledAt := time.Now().Add(24 * time.Hour)
+	message := &models.CommMessage{
+		MessageID:   uuid.MustNewUUID(),
+		Channel:     "email",
+		Direction:   "outbound",
+		Status:      models.MessageStatusScheduled,
+		FromAddress: h.globex.Email,
+		ToAddresses: []string{"buyer@customer.test"},
+		Subject:     "Globex pricing",
+		BodyText:    "Our confidential prices",
+		UserID:      h.globex.ID,
+		TenantID:    "globex",
+		ScheduledAt: &scheduledAt,
+		CreatedAt:   time.Now(),
+	}
+	if err := repositories.NewMongoEmailRepository(h.Mongo).CreateCommMessage(context.Background(), message); err != nil {
+		t.Fatalf("CreateCommMessage: %v", err)
+	}
+
+	for _, tt := range []struct {
+		user   *models.User
+		listed bool
+	}{
+		{h.globex, true},
+		{h.acme, false},
+	} {
+		inbox := h.DoAs(tt.user, http.MethodGet, "/api/v1/communications/inbox?status=scheduled", nil)
+		if inbox.Status != http.StatusOK {
+			t.Fatalf("%s's inbox = %d %s", tt.user.TenantID, inbox.Status, inbox.Body)
+		}
+		if listed := bytes.Contains(inbox.Body, []byte(message.MessageID)); listed != tt.listed {
+			t.Errorf("%s's inbox lists globex's message: %v, want %v", tt.user.TenantID, listed, tt.listed)
+		}
+	}
+	if message.ThreadID != "" {
+		if resp := h.DoAs(h.acme, http.MethodGet, "/api/v1/communications/threads/"+message.ThreadID+"/messages", nil); resp.Status != http.StatusNotFound {
+			t.Errorf("acme reading globex's thread = %d %s, want 404", resp.Status, resp.Body)
+		}
+	}
+	if resp := h.DoAs(h.acme, http.MethodDelete, "/api/v1/communications/messages/"+message.MessageID, nil); resp.Status != http.StatusNotFound {
+		t.Errorf("acme cancelling globex's message = %d %s, want 404", resp.Status, resp.Body)
+	}
+	if resp := h.DoAs(h.globex, http.MethodDelete, "/api/v1/communications/messages/"+message.MessageID, nil); resp.Status != http.StatusNoContent {
+		t.Errorf("globex cancelling its own message = %d %s, want 204", resp.Status, resp.Body)
+	}
+}
+
+func TestTenantsCannotReachEachOthersDistributionLists(t *testing.T) {
+	h := newTwoTenants(t)
+	resp := h.DoAs(h.globex, http.MethodPost, "/api/v1/communications/lists", models.CreateDistributionListRequest{Name: "Key accounts"})
+	if resp.Status != http.StatusCreated {
+		t.Fatalf("creating a list = %d %s", resp.Status, resp.Body)
+	}
+	var list struct {
+		ID string `json:"id"`
+	}
+	resp.Decode(t, &list)
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if resp := h.DoAs(h.acme, method, "/api/v1/communications/lists/"+list.ID, nil); resp.Status != http.StatusNotFound {
+			t.Errorf("acme: %s globex's list = %d %s, want 404", method, resp.Status, resp.Body)
+		}
+	}
+	if resp := h.DoAs(h.globex, http.MethodGet, "/api/v1/communications/lists/"+list.ID, nil); resp.Status != http.StatusOK {
+		t.Errorf("globex reading its own list = %d %s", resp.Status, resp.Body)
+	}
+}
+
+// TestMigrateTenants seeds documents written before tenants were recorded
+// and checks each gets its owner's tenant, once
+func TestMigrateTenants(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	legacy := h.CreateUser("legacy@example.com", models.UserRoleSalesRep)
+	globex := h.CreateUser("rep@globex.test", models.UserRoleSalesRep, testutil.WithTenant("globex"))
+	if _, err := h.Mongo.Collection("users").UpdateOne(ctx, bson.M{"_id": legacy.ID}, bson.M{"$unset": bson.M{"tenant_id": ""}}); err != nil {
+		t.Fatal(err)
+	}
+
+	seeded := []struct {
+		collection, owner, id, userID, tenantID string
+		want                                    string
+	}{
+		// Templates used to carry their creator's ID as the tenant
+		{"templates", "created_by", uuid.MustNewUUID(), legacy.ID, legacy.ID, models.DefaultTenantID},
+		{"templates", "created_by", uuid.MustNewUUID(), globex.ID, globex.ID, "globex"},
+		{"communication", "user_id", uuid.MustNewUUID(), globex.ID, "", "globex"},
+		{"distribution_lists", "owner_id", uuid.MustNewUUID(), legacy.ID, "", models.DefaultTenantID},
+		{"sequence_templates", "created_by", uuid.MustNewUUID(), globex.ID, "", "globex"},
+		// Already migrated documents are left alone
+		{"templates", "created_by", uuid.MustNewUUID(), globex.ID, "globex", "globex"},
+	}
+	for _, doc := range seeded {
+		fields := bson.M{"_id": doc.id, doc.owner: doc.userID}
+		if doc.tenantID != "" {
+			fields["tenant_id"] = doc.tenantID
+		}
+		if _, err := h.Mongo.Collection(doc.collection).InsertOne(ctx, fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.Mongo.Collection("template_stats").InsertOne(ctx, bson.M{"_id": legacy.ID + ":x", "tenant_id": legacy.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := repositories.MigrateTenants(ctx, h.Mongo)
+	if err != nil {
+		t.Fatalf("MigrateTenants: %v", err)
+	}
+	counts := map[string]repositories.TenantMigrationResult{}
+	for _, result := range results {
+		counts[result.Collection] = result
+	}
+	for collection, want := range map[string]int64{"users": 1, "templates": 2, "communication": 1, "distribution_lists": 1, "sequence_templates": 1} {
+		if got := counts[collection].Updated; got != want {
+			t.Errorf("%s: %d updated, want %d", collection, got, want)
+		}
+	}
+	if counts["template_stats"].Deleted != 1 {
+		t.Errorf("template_stats: %d deleted, want 1", counts["template_stats"].Deleted)
+	}
+
+	for _, doc := range seeded {
+		var stored struct {
+			TenantID string `bson:"tenant_id"`
+		}
+		if err := h.Mongo.Collection(doc.collection).FindOne(ctx, bson.M{"_id": doc.id}).Decode(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if stored.TenantID != doc.want {
+			t.Errorf("%s of %s: tenant %q, want %q", doc.collection, doc.userID, stored.TenantID, doc.want)
+		}
+	}
+
+	// Running it again changes nothing
+	results, err = repositories.MigrateTenants(ctx, h.Mongo)
+	if err != nil {
+		t.Fatalf("second MigrateTenants: %v", err)
+	}
+	for _, result := range results {
+		if result.Updated != 0 || result.Deleted != 0 {
+			t.Errorf("second run changed %s: %+v", result.Collection, result)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/testutil"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// requireTransactions skips the test unless MongoDB is a replica set, as
+// standalone servers run transactions one write at a time
+func requireTransactions(t *testing.T, h *testutil.Harness) {
+	t.Helper()
+	var hello struct {
+		SetName string `bson:"setName"`
+	}
+	if err := h.Mongo.Client.Database("admin").RunCommand(context.Background(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+	if hello.SetName == "" {
+		t.Skip("MongoDB is not a replica set; transactions need one")
+	}
+}
+
+// TestTransactionsLeaveNoPartialState ends transactions after their first
+// write with an error and with a panic, and checks neither write stays
+func TestTransactionsLeaveNoPartialState(t *testing.T) {
+	h := testutil.New(t)
+	requireTransactions(t, h)
+	ctx := context.Background()
+	probes := h.Mongo.Collection("transaction_probes")
+
+	err := h.Mongo.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := probes.InsertOne(ctx, bson.M{"step": "failed"}); err != nil {
+			return err
+		}
+		return errors.New("crashed")
+	})
+	if err == nil || !strings.Contains(err.Error(), "crashed") {
+		t.Errorf("WithTransaction = %v, want the failure", err)
+	}
+
+	func() {
+		defer func() { recover() }()
+		h.Mongo.WithTransaction(ctx, func(ctx context.Context) error {
+			if _, err := probes.InsertOne(ctx, bson.M{"step": "panicked"}); err != nil {
+				return err
+			}
+			panic("killed mid-transaction")
+		})
+	}()
+
+	if n, err := probes.CountDocuments(ctx, bson.M{}); err != nil || n != 0 {
+		t.Errorf("%d probes (%v) after the aborted transactions, want none", n, err)
+	}
+	if err := h.Mongo.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := probes.InsertOne(ctx, bson.M{"step": "committed"})
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := probes.CountDocuments(ctx, bson.M{}); n != 1 {
+		t.Errorf("%d probes after a committed transaction, want 1", n)
+	}
+}
+
+// failingPasswords fails the password update of a reset, after the token
+// was marked used in the same transaction
+type failingPasswords struct {
+	*repositories.MongoUserRepository
+}
+
+func (failingPasswords) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	return errors.New("crashed before the password was stored")
+}
+
+// TestPasswordResetIsAllOrNothing fails a reset between its two writes and
+// checks the token can still be used
+func TestPasswordResetIsAllOrNothing(t *testing.T) {
+	h := testutil.New(t)
+	requireTransactions(t, h)
+	ctx := context.Background()
+	user := h.CreateUser("dana@example.com", models.UserRoleSalesRep)
+	repo := repositories.NewMongoUserRepository(h.Mongo)
+
+	newAuth := func(users repositories.UserStore) *services.AuthService {
+		auth := services.NewAuthService(users, repo, repo, nil, h.JWT)
+		auth.SetPasswordHasher(h.Passwords)
+		auth.SetTransactor(h.Mongo)
+		return auth
+	}
+	token, err := newAuth(repo).ForgotPassword(ctx, user.Email, "", "")
+	if err != nil || token == "" {
+		t.Fatalf("ForgotPassword = %q, %v", token, err)
+	}
+
+	if err := newAuth(failingPasswords{repo}).ResetPassword(ctx, token, "Another-Horse-10"); err == nil {
+		t.Fatal("ResetPassword succeeded with the password update failing")
+	}
+	if n, err := h.Mongo.Collection("password_resets").CountDocuments(ctx, bson.M{"user_id": user.ID, "is_used": true}); err != nil || n != 0 {
+		t.Errorf("%d used reset tokens (%v) after the failed reset, want the token unused", n, err)
+	}
+	login(t, h, user.Email, testutil.Password)
+
+	if err := newAuth(repo).ResetPassword(ctx, token, "Another-Horse-10"); err != nil {
+		t.Fatalf("retrying the reset = %v", err)
+	}
+	login(t, h, user.Email, "Another-Horse-10")
+}
+
+// failingSessions fails to store the session of a 2FA sign-in, after the
+// code was marked used in the same transaction
+type failingSessions struct {
+	*repositories.MongoUserRepository
+}
+
+func (failingSessions) CreateSession(ctx context.Context, session *models.Session) error {
+	return errors.New("crashed before the session was stored")
+}
+
+// TestVerify2FAIsAllOrNothing fails a 2FA sign-in between using up the code
+// and storing the session, and checks the code still signs in
+func TestVerify2FAIsAllOrNothing(t *testing.T) {
+	h := testutil.New(t)
+	requireTransactions(t, h)
+	ctx := context.Background()
+	user := h.CreateUser("dana@example.com", models.UserRoleSalesRep)
+	repo := repositories.NewMongoUserRepository(h.Mongo)
+	codes := repositories.NewTwoFactorCodeRepository(h.Mongo)
+
+	otp := services.NewOTPService()
+	hash, err := otp.HashOTP("482913")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := &models.TwoFAOTP{
+		ID:        uuid.MustNewUUID(),
+		UserID:    user.ID,
+		TempToken: uuid.MustNewUUID(),
+		OTPHash:   hash,
+		ExpiresAt: time.Now().Add(5 * time.Minute),
+		CreatedAt: time.Now(),
+	}
+	if err := codes.CreateTwoFactorCode(ctx, code); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(sessions repositories.SessionStore) *httptest.ResponseRecorder {
+		cfg := &config.Config{}
+		cfg.Email.FromEmail = "noreply@example.test"
+		handler := handlers.NewAuthHandlerWithStores(handlers.AuthStores{
+			Users:          repo,
+			Sessions:       sessions,
+			PasswordResets: repo,
+			Settings:       repositories.NewSettingsRepository(h.Mongo),
+			Emails:         repositories.NewMongoEmailRepository(h.Mongo),
+			Impersonations: repositories.NewImpersonationRepository(h.Mongo),
+			TwoFactorCodes: codes,
+			Events:         repositories.NewEventOutboxRepository(h.Mongo),
+			Transactor:     h.Mongo,
+		}, cfg, nil, email.NewLogSender(cfg.Email.FromEmail), h.JWT)
+		body := `{"temp_token":"` + code.TempToken + `","otp_code":"482913"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/verify-2fa", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.Verify2FA(rec, req)
+		return rec
+	}
+
+	if rec := verify(failingSessions{repo}); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("verify with the session failing = %d %s, want 500", rec.Code, rec.Body)
+	}
+	if _, err := codes.GetTwoFactorCode(ctx, code.TempToken); err != nil {
+		t.Fatalf("the code is used up after the failed sign-in: %v", err)
+	}
+	if rec := verify(repo); rec.Code != http.StatusOK {
+		t.Fatalf("retrying the sign-in = %d %s", rec.Code, rec.Body)
+	}
+	if rec := verify(repo); rec.Code != http.StatusUnauthorized {
+		t.Errorf("signing in again with the same code = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package integration
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestUserStatsAggregations seeds a known distribution of users and
+// sessions and checks the numbers the MongoDB aggregations return
+func TestUserStatsAggregations(t *testing.T) {
+	h := testutil.New(t)
+	ctx := context.Background()
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin, testutil.WithTeam("ops"))
+
+	now := time.Now()
+	recent, lastWeek, lastMonth := now.Add(-time.Hour), now.Add(-72*time.Hour), now.Add(-30*24*time.Hour)
+	inviteExpiry, expired := now.Add(48*time.Hour), now.Add(-time.Hour)
+	for _, user := range []*models.User{
+		{Email: "north1@example.com", Role: models.UserRoleSalesRep, Region: "north", Team: "alpha", IsActive: true, LastLoginAt: &recent},
+		{Email: "north2@example.com", Role: models.UserRoleSalesRep, Region: "north", Team: "alpha", IsActive: true, LastLoginAt: &lastWeek},
+		{Email: "south1@example.com", Role: models.UserRoleManager, Region: "south", Team: "beta", IsActive: true, LastLoginAt: &lastMonth},
+		{Email: "gone@example.com", Role: models.UserRoleSalesRep, Region: "south", Team: "beta"},
+		{Email: "invited@example.com", Role: models.UserRoleSalesRep, Region: "north", Status: repositories.UserStatusInvited, InviteExpiry: &inviteExpiry},
+		{Email: "lapsed@example.com", Role: models.UserRoleSalesRep, Region: "north", Status: repositories.UserStatusInvited, InviteExpiry: &expired},
+	} {
+		if err := h.Users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var sessions []interface{}
+	for _, session := range []models.Session{
+		{TokenID: "live-1", RefreshToken: "live-1", UserID: admin.ID, IssuedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{TokenID: "live-2", RefreshToken: "live-2", UserID: admin.ID, IssuedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{TokenID: "revoked", RefreshToken: "revoked", UserID: admin.ID, IssuedAt: now, ExpiresAt: now.Add(time.Hour), IsRevoked: true},
+		{TokenID: "expired", RefreshToken: "expired", UserID: admin.ID, IssuedAt: lastWeek, ExpiresAt: now.Add(-time.Hour)},
+	} {
+		sessions = append(sessions, session)
+	}
+	if _, err := h.Mongo.Collection("sessions").InsertMany(ctx, sessions); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := h.DoAs(admin, http.MethodGet, "/api/v1/users/stats", nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("stats = %d %s", resp.Status, resp.Body)
+	}
+	var stats repositories.UserStats
+	resp.Decode(t, &stats)
+
+	if stats.Total != 7 {
+		t.Errorf("total = %d, want 7", stats.Total)
+	}
+	for name, tt := range map[string]struct{ got, want map[string]int64 }{
+		"status": {stats.ByStatus, map[string]int64{"active": 4, "invited": 2, "deactivated": 1}},
+		"role":   {stats.ByRole, map[string]int64{"admin": 1, "sales_rep": 5, "manager": 1}},
+		"region": {stats.ByRegion, map[string]int64{"pan_india": 1, "north": 4, "south": 2}},
+		"team":   {stats.ByTeam, map[string]int64{"ops": 1, "alpha": 2, "beta": 2, "": 2}},
+	} {
+		if !maps.Equal(tt.got, tt.want) {
+			t.Errorf("by %s = %v, want %v", name, tt.got, tt.want)
+		}
+	}
+	if stats.LoginsLast24h != 1 || stats.LoginsLast7d != 2 {
+		t.Errorf("logins = %d in 24h, %d in 7d; want 1 and 2", stats.LoginsLast24h, stats.LoginsLast7d)
+	}
+	if stats.PendingInvitations != 1 {
+		t.Errorf("pending invitations = %d, want 1", stats.PendingInvitations)
+	}
+	if stats.ActiveSessions != 2 {
+		t.Errorf("active sessions = %d, want 2", stats.ActiveSessions)
+	}
+
+	rep := h.CreateUser("rep@example.com", models.UserRoleSalesRep)
+	if resp := h.DoAs(rep, http.MethodGet, "/api/v1/users/stats", nil); resp.Status != http.StatusForbidden {
+		t.Errorf("stats as a sales rep = %d, want 403", resp.Status)
+	}
+}
@@ -0,0 +1,46 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/testutil"
+)
+
+// TestUppercaseIDsFindTheirDocuments checks Mongo matches IDs exactly, so a
+// lookup by an uppercase ID misses, and that the handlers normalize path IDs
+// before querying so the same ID finds the document through the API
+func TestUppercaseIDsFindTheirDocuments(t *testing.T) {
+	h := testutil.New(t)
+	admin := h.CreateUser("admin@example.com", models.UserRoleAdmin)
+	member := h.CreateUser("member@example.com", models.UserRoleSalesRep)
+	upper := strings.ToUpper(member.ID)
+
+	if _, err := h.Users.GetByID(context.Background(), upper); !repositories.IsUserNotFound(err) {
+		t.Fatalf("GetByID(%q) = %v, want not found without normalizing", upper, err)
+	}
+
+	resp := h.DoAs(admin, http.MethodGet, "/api/v1/admin/team/members/"+upper, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("get member by uppercase ID = %d %s", resp.Status, resp.Body)
+	}
+	var body handlers.TeamMemberResponse
+	resp.Decode(t, &body)
+	if body.Data.ID != member.ID {
+		t.Errorf("member ID = %q, want %q", body.Data.ID, member.ID)
+	}
+	if resp := h.DoAs(admin, http.MethodGet, "/api/v1/admin/users/"+upper+"/login-history", nil); resp.Status != http.StatusOK {
+		t.Errorf("login history by uppercase ID = %d %s", resp.Status, resp.Body)
+	}
+
+	for _, id := range []string{member.ID[:31], member.ID + "0", strings.ReplaceAll(member.ID, "-", ""), "urn:uuid:" + member.ID} {
+		if resp := h.DoAs(admin, http.MethodGet, "/api/v1/admin/team/members/"+id, nil); resp.Status != http.StatusBadRequest {
+			t.Errorf("get member %q = %d, want 400", id, resp.Status)
+		}
+	}
+}
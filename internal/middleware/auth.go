@@ -3,10 +3,14 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/i18n"
 	"github.com/white/user-management/internal/models"
 	"github.com/white/user-management/internal/utils"
 	"github.com/white/user-management/pkg/uuid"
@@ -21,8 +25,14 @@ const (
 	TeamKey        = "team"
 	PermissionsKey = "permissions"
 	DataScopeKey   = "data_scope"
+	TokenExpiresAtKey = "token_expires_at"
+	SessionIDKey      = "session_id"
 )
 
+// tenantKey is the context key of the authenticated user's tenant. Unlike
+// the keys above it is typed, so only this package can set it.
+type tenantKey struct{}
+
 type ErrorResponse struct {
 	Error ErrorDetail `json:"error"`
 }
@@ -32,7 +42,13 @@ type ErrorDetail struct {
 	Message string `json:"message"`
 }
 
+// respondWithJSON writes payload as JSON; the message of an ErrorResponse
+// is written in the request's language
 func respondWithJSON(w http.ResponseWriter, statusCode int, payload interface{}) {
+	if errResp, ok := payload.(ErrorResponse); ok {
+		errResp.Error.Message = i18n.FromResponse(w).Error(errResp.Error.Message)
+		payload = errResp
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(payload)
@@ -69,16 +85,11 @@ func JWTAuth(jwtService *utils.JWTService) func(http.Handler) http.Handler {
 			// Validate access token
 			claims, err := jwtService.ValidateAccessToken(accessToken)
 			if err != nil {
-				respondWithJSON(w, http.StatusUnauthorized, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "INVALID_TOKEN",
-						Message: "Inalid or expired access token",
-					},
-				})
+				respondWithJSON(w, http.StatusUnauthorized, ErrorResponse{Error: tokenError(err)})
 				return
 			}
 
-			userObjectID, err := uuid.ValidateUUID(claims.UserID)
+			userObjectID, err := uuid.ParseUUID(claims.UserID)
 			if err != nil {
 				log.Printf("Invalid user ID format in token: %v", err)
 				respondWithJSON(w, http.StatusUnauthorized, ErrorResponse{
@@ -98,6 +109,14 @@ func JWTAuth(jwtService *utils.JWTService) func(http.Handler) http.Handler {
 			ctx = context.WithValue(ctx, RoleKey, claims.Role)
 			ctx = context.WithValue(ctx, TeamKey, claims.Team)
 			ctx = context.WithValue(ctx, PermissionsKey, claims.Permissions)
+			if claims.ExpiresAt != nil {
+				ctx = context.WithValue(ctx, TokenExpiresAtKey, claims.ExpiresAt.Time)
+			}
+			if claims.SessionID != "" {
+				ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			}
+			ctx = context.WithValue(ctx, tenantKey{}, models.TenantOf(claims.TenantID))
+			ctx = withImpersonator(ctx, claims)
 
 			// Call next handler with updated context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -139,12 +158,7 @@ func JWTAuthDualAlg(jwtService *utils.JWTService, jwksCache *utils.JWKSCache, sh
 			// Validate access token with dual algorithm support
 			claims, err := jwtService.ValidateAccessTokenDualAlg(accessToken, jwksCache, sharedSecret)
 			if err != nil {
-				respondWithJSON(w, http.StatusUnauthorized, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "INVALID_TOKEN",
-						Message: "Invalid or expired access token",
-					},
-				})
+				respondWithJSON(w, http.StatusUnauthorized, ErrorResponse{Error: tokenError(err)})
 				return
 			}
 
@@ -157,7 +171,7 @@ func JWTAuthDualAlg(jwtService *utils.JWTService, jwksCache *utils.JWKSCache, sh
 			}
 
 			// Validate userID UUID format
-			if _, err := uuid.ValidateUUID(claims.UserID); err != nil {
+			if err := uuid.ValidateUUID(claims.UserID); err != nil {
 				log.Printf("Invalid user ID format in token: %v", err)
 				respondWithJSON(w, http.StatusUnauthorized, ErrorResponse{
 					Error: ErrorDetail{
@@ -177,6 +191,14 @@ func JWTAuthDualAlg(jwtService *utils.JWTService, jwksCache *utils.JWKSCache, sh
 			ctx = context.WithValue(ctx, "roles", roles) // Add roles array to context
 			ctx = context.WithValue(ctx, TeamKey, claims.Team)
 			ctx = context.WithValue(ctx, PermissionsKey, claims.Permissions)
+			if claims.ExpiresAt != nil {
+				ctx = context.WithValue(ctx, TokenExpiresAtKey, claims.ExpiresAt.Time)
+			}
+			if claims.SessionID != "" {
+				ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			}
+			ctx = context.WithValue(ctx, tenantKey{}, models.TenantOf(claims.TenantID))
+			ctx = withImpersonator(ctx, claims)
 
 			// Call next handler with updated context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -184,113 +206,84 @@ func JWTAuthDualAlg(jwtService *utils.JWTService, jwksCache *utils.JWKSCache, sh
 	}
 }
 
-// RequirePermission is a middleware that checks if user has a specific permission
-func RequirePermission(permission string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get permissions from context (set by JWTAuth middleware)
-			permissionsInterface := r.Context().Value(PermissionsKey)
-			if permissionsInterface == nil {
-				log.Printf("Auth: 403 %s %s - permissions not in context (required: %s)", r.Method, r.URL.Path, permission)
-				respondWithJSON(w, http.StatusForbidden, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "PERMISSION_DENIED",
-						Message: "User permissions not found",
-					},
-				})
-				return
-			}
-
-			permissions, ok := permissionsInterface.([]string)
-			if !ok {
-				log.Printf("Auth: 403 %s %s - invalid permissions format (required: %s)", r.Method, r.URL.Path, permission)
-				respondWithJSON(w, http.StatusInternalServerError, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "INTERNAL_ERROR",
-						Message: "Invalid permissions format",
-					},
-				})
-				return
-			}
+// tokenError describes why an access token was refused: minted by another
+// issuer or for another audience, or invalid or expired
+func tokenError(err error) ErrorDetail {
+	switch {
+	case errors.Is(err, utils.ErrInvalidIssuer):
+		return ErrorDetail{Code: "INVALID_ISSUER", Message: "Access token was not issued by this service"}
+	case errors.Is(err, utils.ErrInvalidAudience):
+		return ErrorDetail{Code: "INVALID_AUDIENCE", Message: "Access token is not meant for this service"}
+	}
+	return ErrorDetail{Code: "INVALID_TOKEN", Message: "Invalid or expired access token"}
+}
 
-			// Check if user has the required permission (supports wildcards)
-			hasPermission := models.HasPermission(permissions, permission)
+// RequirePermission is a middleware that checks if user has a specific permission.
+// Permissions come from the request context only; use PermissionEnforcer for a repository fallback.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return (*PermissionEnforcer)(nil).RequirePermission(permission)
+}
 
-			if !hasPermission {
-				userID, role := r.Context().Value(UserIDKey), r.Context().Value(RoleKey)
-				log.Printf("Auth: 403 %s %s - permission denied (required: %s, user_id: %v, role: %v)", r.Method, r.URL.Path, permission, userID, role)
-				respondWithJSON(w, http.StatusForbidden, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "PERMISSION_DENIED",
-						Message: "You don't have permission to perform this action",
-					},
-				})
-				return
-			}
+// RequireRole is a middleware that checks if user has a specific role.
+// The role comes from the request context only; use PermissionEnforcer for a repository fallback.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return (*PermissionEnforcer)(nil).RequireRole(roles...)
+}
 
-			// Call next handler
-			next.ServeHTTP(w, r)
-		})
+// GetUserID retrieves user ID from request context as a string UUID
+func GetUserID(r *http.Request) string {
+	if userID, ok := r.Context().Value(UserIDKey).(string); ok {
+		return userID
 	}
+	return ""
 }
 
-// RequireRole is a middleware that checks if user has a specific role
-func RequireRole(roles ...string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get role from context (set by JWTAuth middleware)
-			userRoleInterface := r.Context().Value(RoleKey)
-			if userRoleInterface == nil {
-				respondWithJSON(w, http.StatusForbidden, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "ROLE_REQUIRED",
-						Message: "User role not found",
-					},
-				})
-				return
-			}
-
-			role, ok := userRoleInterface.(string)
-			if !ok {
-				respondWithJSON(w, http.StatusInternalServerError, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "INTERNAL_ERROR",
-						Message: "Invalid role format",
-					},
-				})
-				return
-			}
+// GetTenantID returns the tenant of the authenticated user, or "" when the
+// request was not authenticated. Tokens issued before tenants were recorded
+// act for the default tenant.
+func GetTenantID(r *http.Request) string {
+	tenantID, _ := r.Context().Value(tenantKey{}).(string)
+	return tenantID
+}
 
-			// Check if user has one of the required roles
-			hasRole := false
-			for _, r := range roles {
-				if r == role {
-					hasRole = true
-					break
-				}
-			}
+// withImpersonator records the real operator of an impersonation token in
+// ctx; the user claims above stay those of the impersonated user
+func withImpersonator(ctx context.Context, claims *utils.AccessTokenClaims) context.Context {
+	if !claims.IsImpersonation() {
+		return ctx
+	}
+	return events.WithImpersonator(ctx, events.Impersonator{
+		UserID:    claims.Actor.Subject,
+		Email:     claims.Actor.Email,
+		Name:      claims.Actor.Name,
+		SessionID: claims.ID,
+	})
+}
 
-			if !hasRole {
-				respondWithJSON(w, http.StatusForbidden, ErrorResponse{
-					Error: ErrorDetail{
-						Code:    "ROLE_DENIED",
-						Message: "Your role does not have access to this resource",
-					},
-				})
-				return
-			}
+// GetImpersonator returns the real operator when the request was made with
+// an impersonation token
+func GetImpersonator(r *http.Request) (events.Impersonator, bool) {
+	return events.ImpersonatorFromContext(r.Context())
+}
 
-			// Call next handler
-			next.ServeHTTP(w, r)
-		})
-	}
+// IsImpersonated reports whether the request was made with an impersonation token
+func IsImpersonated(r *http.Request) bool {
+	_, ok := GetImpersonator(r)
+	return ok
 }
 
+// GetTokenExpiresAt returns when the request's access token expires, and
+// false when it has no expiry
+func GetTokenExpiresAt(r *http.Request) (time.Time, bool) {
+	expiresAt, ok := r.Context().Value(TokenExpiresAtKey).(time.Time)
+	return expiresAt, ok
+}
 
-// GetUserID retrieves user ID from request context as a string UUID
-func GetUserID(r *http.Request) string {
-	if userID, ok := r.Context().Value(UserIDKey).(string); ok {
-		return userID
+// GetSessionID returns the session the request's access token was issued
+// for, or "" for tokens that carry none (impersonation, older tokens)
+func GetSessionID(r *http.Request) string {
+	if sessionID, ok := r.Context().Value(SessionIDKey).(string); ok {
+		return sessionID
 	}
 	return ""
 }
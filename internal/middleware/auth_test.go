@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+const authTestSecret = "middleware-tests-only-secret-0123456789ab"
+
+// jwtServiceFor returns an HS256 service of the test secret minting tokens
+// with issuer and audience, as each environment sharing the secret would
+func jwtServiceFor(t *testing.T, issuer, audience string) *utils.JWTService {
+	t.Helper()
+	s, err := utils.NewJWTService(config.JWTConfig{
+		Algorithm:          utils.AlgorithmHS256,
+		Secret:             authTestSecret,
+		AccessTokenExpiry:  15,
+		RefreshTokenExpiry: 7,
+		Issuer:             issuer,
+		Audience:           audience,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestJWTAuthNamesIssuerAndAudienceErrors checks tokens signed with the
+// shared key but minted by another environment or for another audience
+// are refused with codes saying so
+func TestJWTAuthNamesIssuerAndAudienceErrors(t *testing.T) {
+	production := jwtServiceFor(t, "white-api-production", "white-crm")
+	user := &models.User{ID: uuid.MustNewUUID(), Email: "dana@example.test", Role: models.UserRoleSalesRep}
+	mint := func(s *utils.JWTService) string {
+		token, err := s.GenerateAccessToken(user, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for name, auth := range map[string]func(http.Handler) http.Handler{
+		"JWTAuth":        JWTAuth(production),
+		"JWTAuthDualAlg": JWTAuthDualAlg(production, nil, authTestSecret),
+	} {
+		for _, tt := range []struct {
+			name, token, code string
+			status            int
+		}{
+			{"own token", mint(production), "", http.StatusOK},
+			{"staging token", mint(jwtServiceFor(t, "white-api-staging", "white-crm")), "INVALID_ISSUER", http.StatusUnauthorized},
+			{"partner token", mint(jwtServiceFor(t, "white-api-production", "partner-portal")), "INVALID_AUDIENCE", http.StatusUnauthorized},
+			{"garbage", "not-a-token", "INVALID_TOKEN", http.StatusUnauthorized},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			auth(reached).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("%s, %s = %d %s, want %d", name, tt.name, rec.Code, rec.Body, tt.status)
+				continue
+			}
+			if tt.code == "" {
+				continue
+			}
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tt.code {
+				t.Errorf("%s, %s = %s, want %s", name, tt.name, body.Error.Code, tt.code)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// BodyLimitKey holds the largest JSON request body the handlers decode
+const BodyLimitKey = "body_limit"
+
+// DefaultBodyLimit is the JSON body limit of requests BodyLimit did not see
+const DefaultBodyLimit int64 = 1 << 20
+
+// BodyLimit sets the largest JSON body the handlers will decode from a
+// request. The body is not read here: handlers taking uploads or imports
+// declare limits of their own, larger than this one. A limit of zero or
+// less leaves DefaultBodyLimit in force.
+func BodyLimit(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), BodyLimitKey, limit))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetBodyLimit returns the largest JSON body to decode from the request
+func GetBodyLimit(r *http.Request) int64 {
+	if limit, ok := r.Context().Value(BodyLimitKey).(int64); ok {
+		return limit
+	}
+	return DefaultBodyLimit
+}
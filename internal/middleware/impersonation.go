@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/white/user-management/internal/repositories"
+)
+
+// ImpersonationGuard rejects impersonation tokens whose session has been
+// ended or has expired, so ending an impersonation revokes its token
+// straight away. Requests with ordinary tokens pass through.
+func ImpersonationGuard(sessions repositories.ImpersonationStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			impersonator, ok := GetImpersonator(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			session, err := sessions.GetImpersonation(r.Context(), impersonator.SessionID)
+			if err != nil && !repositories.IsNotFound(err) {
+				log.Printf("Impersonation: failed to load session %s: %v", impersonator.SessionID, err)
+				respondWithJSON(w, http.StatusInternalServerError, ErrorResponse{
+					Error: ErrorDetail{
+						Code:    "INTERNAL_ERROR",
+						Message: "Failed to verify impersonation session",
+					},
+				})
+				return
+			}
+			if session == nil || !session.IsActive(time.Now()) ||
+				session.ActorID != impersonator.UserID || session.TargetUserID != GetUserID(r) {
+				respondWithJSON(w, http.StatusUnauthorized, ErrorResponse{
+					Error: ErrorDetail{
+						Code:    "IMPERSONATION_ENDED",
+						Message: "Impersonation session has ended",
+					},
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RefuseImpersonation rejects requests made with an impersonation token.
+// It guards operations that must only be done by the account owner, such as
+// changing credentials or roles.
+func RefuseImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsImpersonated(r) {
+			respondWithJSON(w, http.StatusForbidden, ErrorResponse{
+				Error: ErrorDetail{
+					Code:    "IMPERSONATION_FORBIDDEN",
+					Message: "This action is not allowed while impersonating a user",
+				},
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
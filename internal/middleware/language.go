@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/white/user-management/internal/i18n"
+	"github.com/white/user-management/internal/services"
+)
+
+// Language makes the language the user chose in their preferences the
+// request's, in place of the one i18n.Middleware took from Accept-Language.
+// A preference no catalog matches leaves Accept-Language deciding. The
+// impersonating admin reads the responses of an impersonated request, so
+// their preference is used. A nil languages changes nothing.
+func Language(languages *services.UserLanguages) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if languages != nil {
+				userID := GetUserID(r)
+				if impersonator, ok := GetImpersonator(r); ok {
+					userID = impersonator.UserID
+				}
+				if preference := languages.Get(r.Context(), userID); preference != "" {
+					w, r = i18n.Attach(w, r, i18n.Negotiate(preference, r.Header.Get("Accept-Language")))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/services"
+)
+
+// PermissionLookup loads a user's role and permissions from storage.
+// It is used when the request context carries no permission claims, and is
+// expected to cache its results (RBACService.UserPermissionLookup reads
+// through the user scope cache).
+type PermissionLookup func(ctx context.Context, userID string) (role string, permissions []string, err error)
+
+// PermissionEnforcer builds RequirePermission/RequireRole middleware that read
+// permissions from the request context (JWT claims / RBACContext) and fall back
+// to a repository lookup.
+// A nil *PermissionEnforcer only uses the request context.
+type PermissionEnforcer struct {
+	lookup  PermissionLookup
+	denials *services.PermissionDenials // nil only answers denials with 403
+}
+
+// NewPermissionEnforcer creates a PermissionEnforcer
+// lookup may be nil to disable the repository fallback
+func NewPermissionEnforcer(lookup PermissionLookup) *PermissionEnforcer {
+	return &PermissionEnforcer{lookup: lookup}
+}
+
+// SetDenials makes the enforcer record every denied request and refuse the
+// ones of users denied too often with 429
+func (e *PermissionEnforcer) SetDenials(denials *services.PermissionDenials) {
+	e.denials = denials
+}
+
+// deny refuses a request lacking required, a permission or roles, with 403,
+// or with 429 once the user has been denied too often
+func (e *PermissionEnforcer) deny(w http.ResponseWriter, r *http.Request, required string, detail ErrorDetail) {
+	if e != nil && e.denials != nil {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		role, _ := r.Context().Value(RoleKey).(string)
+		name, _ := r.Context().Value(NameKey).(string)
+		throttled, retryAfter := e.denials.Record(r, services.DeniedRequest{
+			UserID:   GetUserID(r),
+			UserName: name,
+			Role:     role,
+			Required: required,
+			Route:    route,
+		})
+		if throttled {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			respondWithJSON(w, http.StatusTooManyRequests, ErrorResponse{
+				Error: ErrorDetail{
+					Code:    "TOO_MANY_DENIALS",
+					Message: "Too many requests were denied; try again later",
+				},
+			})
+			return
+		}
+	}
+	respondWithJSON(w, http.StatusForbidden, ErrorResponse{Error: detail})
+}
+
+// RequirePermission is a middleware that checks if user has a specific permission
+// (supports wildcards). The 403 response names the missing permission.
+func (e *PermissionEnforcer) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			permissions, ok := r.Context().Value(PermissionsKey).([]string)
+			if r.Context().Value(PermissionsKey) != nil && !ok {
+				log.Printf("Auth: 500 %s %s - invalid permissions format (required: %s)", r.Method, r.URL.Path, permission)
+				respondWithJSON(w, http.StatusInternalServerError, ErrorResponse{
+					Error: ErrorDetail{
+						Code:    "INTERNAL_ERROR",
+						Message: "Invalid permissions format",
+					},
+				})
+				return
+			}
+
+			// No permission claims in context - fall back to the repository
+			if len(permissions) == 0 {
+				_, loaded, found := e.load(r)
+				if !found {
+					log.Printf("Auth: 403 %s %s - permissions not in context (required: %s)", r.Method, r.URL.Path, permission)
+					respondWithJSON(w, http.StatusForbidden, ErrorResponse{
+						Error: ErrorDetail{
+							Code:    "PERMISSION_DENIED",
+							Message: "User permissions not found (required: " + permission + ")",
+						},
+					})
+					return
+				}
+				permissions = loaded
+			}
+
+			if !models.HasPermission(permissions, permission) {
+				userID, role := r.Context().Value(UserIDKey), r.Context().Value(RoleKey)
+				log.Printf("Auth: 403 %s %s - permission denied (required: %s, user_id: %v, role: %v)", r.Method, r.URL.Path, permission, userID, role)
+				e.deny(w, r, permission, ErrorDetail{
+					Code:    "PERMISSION_DENIED",
+					Message: "Missing required permission: " + permission,
+				})
+				return
+			}
+
+			// Call next handler
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole is a middleware that checks if user has one of the given roles
+func (e *PermissionEnforcer) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRoles, found := e.roles(r)
+			if !found {
+				respondWithJSON(w, http.StatusForbidden, ErrorResponse{
+					Error: ErrorDetail{
+						Code:    "ROLE_REQUIRED",
+						Message: "User role not found",
+					},
+				})
+				return
+			}
+
+			if hasAnyRole(userRoles, roles) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log.Printf("Auth: 403 %s %s - role denied (required one of: %v, user_id: %v, roles: %v)", r.Method, r.URL.Path, roles, r.Context().Value(UserIDKey), userRoles)
+			e.deny(w, r, "role "+strings.Join(roles, " or "), ErrorDetail{
+				Code:    "ROLE_DENIED",
+				Message: "Your role does not have access to this resource",
+			})
+		})
+	}
+}
+
+// RequireRoleOrPermission is a middleware that lets in users with one of the
+// given roles as well as principals granted permission, such as service
+// tokens carrying a users:read permission claim
+func (e *PermissionEnforcer) RequireRoleOrPermission(permission string, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if e.HasRole(r, roles...) || e.HasPermission(r, permission) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log.Printf("Auth: 403 %s %s - access denied (required one of roles %v or permission %s, user_id: %v)", r.Method, r.URL.Path, roles, permission, r.Context().Value(UserIDKey))
+			e.deny(w, r, "role "+strings.Join(roles, " or ")+" or "+permission, ErrorDetail{
+				Code:    "PERMISSION_DENIED",
+				Message: "Missing required role or permission: " + permission,
+			})
+		})
+	}
+}
+
+// RequirePermissionUnlessImpersonated checks permission like
+// RequirePermission, except on impersonated requests: they carry the
+// impersonated user's permissions rather than the operator's, and are let
+// through for the handler to check the token is the one being acted on
+func (e *PermissionEnforcer) RequirePermissionUnlessImpersonated(permission string) func(http.Handler) http.Handler {
+	requirePermission := e.RequirePermission(permission)
+	return func(next http.Handler) http.Handler {
+		checked := requirePermission(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if IsImpersonated(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			checked.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasRole reports whether the authenticated user has one of the given roles,
+// using the same context-then-repository resolution as RequireRole. Handlers use
+// it when only part of an endpoint is role-restricted.
+func (e *PermissionEnforcer) HasRole(r *http.Request, roles ...string) bool {
+	userRoles, found := e.roles(r)
+	return found && hasAnyRole(userRoles, roles)
+}
+
+// roles returns the role claims in context, falling back to the repository
+// when there are none. found is false when no role can be resolved.
+func (e *PermissionEnforcer) roles(r *http.Request) ([]string, bool) {
+	if userRoles := contextRoles(r); len(userRoles) > 0 {
+		return userRoles, true
+	}
+	role, _, found := e.load(r)
+	if !found || role == "" {
+		return nil, false
+	}
+	return []string{role}, true
+}
+
+// hasAnyRole reports whether any of userRoles is one of required
+func hasAnyRole(userRoles, required []string) bool {
+	for _, want := range required {
+		for _, role := range userRoles {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the authenticated user has permission, using the
+// same context-then-repository resolution as RequirePermission. Handlers use it
+// when the required permission depends on the request body.
+func (e *PermissionEnforcer) HasPermission(r *http.Request, permission string) bool {
+	permissions, _ := r.Context().Value(PermissionsKey).([]string)
+	if len(permissions) == 0 {
+		_, loaded, found := e.load(r)
+		if !found {
+			return false
+		}
+		permissions = loaded
+	}
+	return models.HasPermission(permissions, permission)
+}
+
+// contextRoles returns the roles set by the auth middleware (single role and roles array)
+func contextRoles(r *http.Request) []string {
+	var roles []string
+	if role, ok := r.Context().Value(RoleKey).(string); ok && role != "" {
+		roles = append(roles, role)
+	}
+	if list, ok := r.Context().Value("roles").([]string); ok {
+		roles = append(roles, list...)
+	}
+	return roles
+}
+
+// load returns the role and permissions of the authenticated user from the
+// repository lookup. found is false when no lookup is configured, the user is
+// unknown or the lookup fails.
+func (e *PermissionEnforcer) load(r *http.Request) (role string, permissions []string, found bool) {
+	if e == nil || e.lookup == nil {
+		return "", nil, false
+	}
+
+	userID := GetUserID(r)
+	if userID == "" {
+		return "", nil, false
+	}
+
+	role, permissions, err := e.lookup(r.Context(), userID)
+	if err != nil {
+		log.Printf("Auth: failed to load permissions for user %s: %v", userID, err)
+		return "", nil, false
+	}
+	return role, permissions, true
+}
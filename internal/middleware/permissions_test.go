@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/services"
+)
+
+// reached answers 200, standing in for the handler a middleware protects
+var reached = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// serve sends a request through handler with the context values the JWT
+// middleware would set
+func serve(handler http.Handler, values map[string]interface{}) *httptest.ResponseRecorder {
+	ctx := context.Background()
+	for key, value := range values {
+		ctx = context.WithValue(ctx, key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/templates/1", nil).WithContext(ctx))
+	return rec
+}
+
+// lookupOf returns a PermissionLookup answering for user-1 only
+func lookupOf(role string, permissions []string) PermissionLookup {
+	return func(ctx context.Context, userID string) (string, []string, error) {
+		if userID != "user-1" {
+			return "", nil, errors.New("user not found")
+		}
+		return role, permissions, nil
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name     string
+		enforcer *PermissionEnforcer
+		values   map[string]interface{}
+		status   int
+	}{
+		{"granted in the token", nil, map[string]interface{}{PermissionsKey: []string{models.PermTemplatesDelete}}, http.StatusOK},
+		{"granted by a wildcard", nil, map[string]interface{}{PermissionsKey: []string{"templates:*:*"}}, http.StatusOK},
+		{"other permissions", nil, map[string]interface{}{PermissionsKey: []string{"templates:library:view"}}, http.StatusForbidden},
+		{"no claims and no lookup", nil, map[string]interface{}{UserIDKey: "user-1"}, http.StatusForbidden},
+		{"no claims, granted by the lookup", NewPermissionEnforcer(lookupOf("admin", []string{"*:*:*"})), map[string]interface{}{UserIDKey: "user-1"}, http.StatusOK},
+		{"no claims, refused by the lookup", NewPermissionEnforcer(lookupOf("sales_rep", []string{"templates:library:view"})), map[string]interface{}{UserIDKey: "user-1"}, http.StatusForbidden},
+		{"no claims, the lookup fails", NewPermissionEnforcer(lookupOf("admin", []string{"*:*:*"})), map[string]interface{}{UserIDKey: "user-2"}, http.StatusForbidden},
+		{"malformed claims", nil, map[string]interface{}{PermissionsKey: "templates:*:*"}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.enforcer.RequirePermission(models.PermTemplatesDelete)(reached), tt.values)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+			if rec.Code == http.StatusForbidden && !strings.Contains(rec.Body.String(), models.PermTemplatesDelete) {
+				t.Errorf("403 body = %s, want the missing permission named", rec.Body)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		enforcer *PermissionEnforcer
+		values   map[string]interface{}
+		status   int
+	}{
+		{"role in the token", nil, map[string]interface{}{RoleKey: "manager"}, http.StatusOK},
+		{"one of the roles claim", nil, map[string]interface{}{RoleKey: "sales_rep", "roles": []string{"admin"}}, http.StatusOK},
+		{"other role", nil, map[string]interface{}{RoleKey: "sales_rep"}, http.StatusForbidden},
+		{"no role and no lookup", nil, map[string]interface{}{UserIDKey: "user-1"}, http.StatusForbidden},
+		{"role from the lookup", NewPermissionEnforcer(lookupOf("admin", nil)), map[string]interface{}{UserIDKey: "user-1"}, http.StatusOK},
+		{"other role from the lookup", NewPermissionEnforcer(lookupOf("sales_rep", nil)), map[string]interface{}{UserIDKey: "user-1"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.enforcer.RequireRole("admin", "manager")(reached), tt.values)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+		})
+	}
+}
+
+// TestRequireRoleOrPermission lets in service tokens granted the permission
+// as well as users with the role
+func TestRequireRoleOrPermission(t *testing.T) {
+	handler := NewPermissionEnforcer(nil).RequireRoleOrPermission("users:directory:read", "admin")(reached)
+	for _, tt := range []struct {
+		values map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{RoleKey: "admin"}, http.StatusOK},
+		{map[string]interface{}{PermissionsKey: []string{"users:directory:read"}}, http.StatusOK},
+		{map[string]interface{}{RoleKey: "sales_rep", PermissionsKey: []string{"templates:*:*"}}, http.StatusForbidden},
+	} {
+		if rec := serve(handler, tt.values); rec.Code != tt.status {
+			t.Errorf("%v = %d, want %d", tt.values, rec.Code, tt.status)
+		}
+	}
+}
+
+// TestDenialsAreThrottled sends a burst of denied requests through an
+// enforcer recording denials, checking they turn from 403 into 429 past the
+// limit while granted requests and other users are unaffected
+func TestDenialsAreThrottled(t *testing.T) {
+	store := memory.NewPermissionDenialStore()
+	enforcer := NewPermissionEnforcer(nil)
+	enforcer.SetDenials(services.NewPermissionDenials(store, memory.NewSettingsStore(memory.NewUserStore()), nil, 2, time.Minute))
+	byPermission := enforcer.RequirePermission(models.PermTemplatesDelete)(reached)
+	byRole := enforcer.RequireRole("admin")(reached)
+	mallory := map[string]interface{}{UserIDKey: "mallory", RoleKey: "sales_rep", PermissionsKey: []string{"templates:library:view"}}
+
+	for i, handler := range []http.Handler{byPermission, byRole} {
+		if rec := serve(handler, mallory); rec.Code != http.StatusForbidden {
+			t.Fatalf("denial %d = %d, want 403", i+1, rec.Code)
+		}
+	}
+	for i, handler := range []http.Handler{byPermission, byRole, byPermission} {
+		rec := serve(handler, mallory)
+		if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "TOO_MANY_DENIALS") {
+			t.Errorf("denial %d = %d %s, want 429", i+3, rec.Code, rec.Body)
+		}
+		if retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 61 {
+			t.Errorf("denial %d Retry-After = %q, want up to a minute", i+3, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// The throttle only answers denials
+	granted := map[string]interface{}{UserIDKey: "mallory", PermissionsKey: []string{models.PermTemplatesDelete}}
+	if rec := serve(byPermission, granted); rec.Code != http.StatusOK {
+		t.Errorf("granted request of a throttled user = %d, want 200", rec.Code)
+	}
+	if rec := serve(byRole, map[string]interface{}{UserIDKey: "dana", RoleKey: "sales_rep"}); rec.Code != http.StatusForbidden {
+		t.Errorf("another user's denial = %d, want 403", rec.Code)
+	}
+
+	denials, err := store.ListPermissionDenials(context.Background(), "mallory", pagination.Request{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(denials) != 5 {
+		t.Fatalf("%d denials of mallory recorded, want 5", len(denials))
+	}
+	required := map[string]int{}
+	for _, denial := range denials {
+		required[denial.Required]++
+	}
+	if required[models.PermTemplatesDelete] != 3 || required["role admin"] != 2 {
+		t.Errorf("denials required %v, want the permission 3 times and the role twice", required)
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/white/user-management/internal/services"
+)
+
+// Presence records each authenticated request as the user being seen. It
+// never rejects a request. Impersonated requests are not the user's own and
+// pass through unrecorded, as does everything with a nil presence.
+func Presence(presence *services.Presence) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if presence != nil {
+				if _, impersonated := GetImpersonator(r); !impersonated {
+					presence.Record(r.Context(), GetUserID(r))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/white/user-management/internal/models"
 	"github.com/white/user-management/internal/services"
 )
 
 // RBACContext loads DB-backed permissions + data scope for the user's role
-// and stores them in request context. This makes backend authZ authoritative
-// (JWT permissions are treated as non-authoritative).
+// and stores them in request context, together with the permissions of the
+// user's custom roles and their direct grants. This makes backend authZ
+// authoritative (JWT permissions are treated as non-authoritative).
 func RBACContext(rbacService *services.RBACService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -19,7 +21,9 @@ func RBACContext(rbacService *services.RBACService) func(http.Handler) http.Hand
 				return
 			}
 
-			ctx := r.Context()
+			ctx := services.WithPermissionMemo(r.Context())
+			// Team member lists for team data scopes come from the user scope cache
+			ctx = rbacService.WithTeamMembers(ctx)
 
 			roleCode, _ := ctx.Value(RoleKey).(string)
 			if roleCode == "" {
@@ -82,9 +86,39 @@ func RBACContext(rbacService *services.RBACService) func(http.Handler) http.Hand
 				}
 			}
 
+			// Custom roles (resolved by ID, so renaming one changes nothing) and
+			// direct grants are read from the user document, briefly cached
+			userID, _ := ctx.Value(UserIDKey).(string)
+			assigned, err := rbacService.AssignedPermissions(ctx, userID)
+			if err != nil {
+				log.Printf("RBAC: failed to load assigned permissions for user %s: %v (path: %s %s)", userID, err, r.Method, r.URL.Path)
+				respondWithJSON(w, http.StatusInternalServerError, ErrorResponse{
+					Error: ErrorDetail{
+						Code:    "INTERNAL_ERROR",
+						Message: "Failed to load permissions",
+					},
+				})
+				return
+			}
+			perms = services.MergePermissions(perms, assigned)
+
 			ctx = context.WithValue(ctx, PermissionsKey, perms)
-			if dataScope != nil {
-				ctx = context.WithValue(ctx, DataScopeKey, *dataScope)
+
+			// The user's own data scope override is read from the DB (briefly
+			// cached), so a change applies without signing in again
+			scope, err := rbacService.DataScopeForUser(ctx, userID, dataScope)
+			if err != nil {
+				log.Printf("RBAC: failed to load data scope for user %s: %v (path: %s %s)", userID, err, r.Method, r.URL.Path)
+				respondWithJSON(w, http.StatusInternalServerError, ErrorResponse{
+					Error: ErrorDetail{
+						Code:    "INTERNAL_ERROR",
+						Message: "Failed to load data scope",
+					},
+				})
+				return
+			}
+			if dataScope != nil || scope != (models.DataScope{}) {
+				ctx = context.WithValue(ctx, DataScopeKey, scope)
 			}
 
 			next.ServeHTTP(w, r.WithContext(ctx))
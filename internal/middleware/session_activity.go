@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/white/user-management/internal/services"
+)
+
+// SessionActivity records each authenticated request as activity of the
+// session its access token was issued for, which keeps the session from
+// timing out after inactivity. It never rejects a request; a timed-out
+// session fails at its next refresh. Tokens issued for no session, such as
+// impersonation tokens, and a nil activity pass requests through.
+func SessionActivity(activity *services.SessionActivity) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if activity != nil {
+				activity.Record(r.Context(), GetUserID(r), GetSessionID(r))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Account deletion request statuses
+const (
+	AccountDeletionPending   = "pending"   // Waiting out the grace period
+	AccountDeletionCancelled = "cancelled" // Cancelled by the user or an admin
+	AccountDeletionCompleted = "completed" // The account was anonymized
+)
+
+// AccountDeletionRequest is a user's request to have their account deleted.
+// Once ScheduledFor has passed the account is anonymized, unless the user or
+// an admin cancelled the request first. A user has at most one pending
+// request.
+// Collection: account_deletion_requests
+type AccountDeletionRequest struct {
+	ID           string     `bson:"_id" json:"id"`
+	UserID       string     `bson:"user_id" json:"userId"`
+	Email        string     `bson:"email" json:"email"` // As it was when requested; anonymization clears it
+	Name         string     `bson:"name" json:"name"`
+	Reason       string     `bson:"reason,omitempty" json:"reason,omitempty"`
+	Status       string     `bson:"status" json:"status"`
+	RequestedAt  time.Time  `bson:"requested_at" json:"requestedAt"`
+	ScheduledFor time.Time  `bson:"scheduled_for" json:"scheduledFor"` // When the grace period ends
+	CancelledAt  *time.Time `bson:"cancelled_at,omitempty" json:"cancelledAt,omitempty"`
+	CancelledBy  string     `bson:"cancelled_by,omitempty" json:"cancelledBy,omitempty"` // The user themselves or an admin
+	CompletedAt  *time.Time `bson:"completed_at,omitempty" json:"completedAt,omitempty"`
+}
+
+// DeactivateAccountRequest is the body of a self-service account
+// deactivation
+type DeactivateAccountRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required,max=128"`
+}
+
+// AccountDeletionRequestBody is the optional body of an account deletion
+// request
+type AccountDeletionRequestBody struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
@@ -14,6 +14,7 @@ type MongoCampaign struct {
 	OwnerID        string         `bson:"owner_id,omitempty" json:"ownerId,omitempty"`  // Campaign owner user ID
 	Channels       []string       `bson:"channels,omitempty" json:"channels,omitempty"` // For multi-channel campaigns
 	Steps          []CampaignStep `bson:"steps,omitempty" json:"steps,omitempty"`
+	SequenceTemplateID string     `bson:"sequence_template_id,omitempty" json:"sequenceTemplateId,omitempty"` // Sequence template the campaign runs
 	TargetAudience TargetAudience  `bson:"target_audience" json:"targetAudience"`
 	ScheduledAt    *time.Time     `bson:"scheduled_at,omitempty" json:"scheduledAt,omitempty"`
 	StartedAt      *time.Time     `bson:"started_at,omitempty" json:"startedAt,omitempty"`
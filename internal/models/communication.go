@@ -24,6 +24,7 @@ const (
 const (
 	MessageStatusDraft     = "draft"
 	MessageStatusQueued    = "queued"
+	MessageStatusScheduled = "scheduled" // Held until its scheduled_at, then queued for sending
 	MessageStatusSent      = "sent"
 	MessageStatusDelivered = "delivered"
 	MessageStatusFailed    = "failed"
@@ -169,11 +170,21 @@ type CommMessage struct {
 	IsStarred       bool                      `json:"is_starred"`
 	IsArchived      bool                      `json:"is_archived"`
 	Labels          []string                  `json:"labels,omitempty"`
+	TenantID        string                    `json:"tenant_id,omitempty"`
+	TemplateID      string                    `json:"template_id,omitempty"` // Template the message was rendered from; counted in template_stats
+	DistributionListID string                 `json:"distribution_list_id,omitempty"` // List whose members are added as BCC recipients when the message is sent
+	IsTest          bool                      `json:"is_test,omitempty"` // Template test send, not a real outreach message
+	SignatureApplied bool                     `json:"signature_applied,omitempty"` // The sender's email signature is in the body already
 	ScheduledAt     *time.Time                `json:"scheduled_at,omitempty"`
+	ExpiresAt       *time.Time                `json:"expires_at,omitempty"` // Outbox retries stop after this
 	SentAt          *time.Time                `json:"sent_at,omitempty"`
 	DeliveredAt     *time.Time                `json:"delivered_at,omitempty"`
 	OpenedAt        *time.Time                `json:"opened_at,omitempty"`
 	ClickedAt       *time.Time                `json:"clicked_at,omitempty"`
+	OpenCount       int                       `json:"open_count"`
+	ClickCount      int                       `json:"click_count"`
+	ClickedLinks    []string                  `json:"clicked_links,omitempty"`
+	TrackEngagement bool                      `json:"-"` // Sender's preferences allow an open pixel and click redirects
 	BouncedAt       *time.Time                `json:"bounced_at,omitempty"`
 	FailedAt        *time.Time                `json:"failed_at,omitempty"`
 	ErrorMessage    string                    `json:"error_message,omitempty"`
@@ -267,4 +278,20 @@ type SendingWindow struct {
 	DayOfWeek string `bson:"day_of_week" json:"dayOfWeek"` // monday, tuesday, etc.
 	StartTime string `bson:"start_time" json:"startTime"`  // HH:MM format
 	EndTime   string `bson:"end_time" json:"endTime"`      // HH:MM format
-}
\ No newline at end of file
+}
+
+// SendMessageRequest is an email composed by a user, sent now or at
+// ScheduledAt. ScheduledAt is RFC 3339 with an offset (2026-03-02T09:00:00+05:30),
+// or a local time (2026-03-02T09:00) read in the IANA Timezone.
+type SendMessageRequest struct {
+	To          string   `json:"to,omitempty" validate:"omitempty,email"` // Stored messages keep one primary recipient; add others as CC. Required without list_id.
+	CC          []string `json:"cc,omitempty" validate:"max=50,dive,email"`
+	BCC         []string `json:"bcc,omitempty" validate:"max=50,dive,email"`
+	Subject     string   `json:"subject" validate:"required,max=998"`
+	BodyText    string   `json:"body_text,omitempty"`
+	BodyHTML    string   `json:"body_html,omitempty"`
+	ThreadID    string   `json:"thread_id,omitempty" validate:"omitempty,uuid"`
+	ScheduledAt string   `json:"scheduled_at,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"`
+	ListID      string   `json:"list_id,omitempty" validate:"omitempty,uuid"` // Distribution list whose members are BCC'd, resolved when the message is sent
+}
@@ -0,0 +1,102 @@
+package models
+
+import "time"
+
+// MaxDistributionListMembers caps the members of a distribution list. A
+// message to a list is one email with the list's members as BCC recipients,
+// and providers take about a thousand recipients per message.
+const MaxDistributionListMembers = 1000
+
+// MaxDistributionListMembersPerRequest caps the members one request adds or
+// removes
+const MaxDistributionListMembersPerRequest = 500
+
+// Distribution list statuses
+const (
+	DistributionListStatusActive   = "active"
+	DistributionListStatusArchived = "archived" // Takes no new messages; those already scheduled to it are still sent
+)
+
+// DistributionList is a named, reusable group of recipients such as
+// "All APAC sales reps". Its members are resolved to addresses when a
+// message sent to it goes out, so changes to the list or its users apply to
+// messages already scheduled.
+// Collection: distribution_lists
+type DistributionList struct {
+	ID          string     `bson:"_id" json:"id"`
+	TenantID    string     `bson:"tenant_id" json:"tenantId,omitempty"` // Empty on lists created before tenants were recorded, which belong to the default tenant
+	Name        string     `bson:"name" json:"name"`
+	Description string     `bson:"description,omitempty" json:"description,omitempty"`
+	OwnerID     string     `bson:"owner_id" json:"ownerId"` // Scoped like campaigns: own, team or all
+	Status      string     `bson:"status" json:"status"`
+	MemberCount int        `bson:"member_count" json:"memberCount"`
+	CreatedBy   string     `bson:"created_by" json:"createdBy"`
+	CreatedAt   time.Time  `bson:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updatedAt"`
+	ArchivedAt  *time.Time `bson:"archived_at,omitempty" json:"archivedAt,omitempty"`
+}
+
+// IsArchived reports whether the list takes no new messages
+func (l *DistributionList) IsArchived() bool {
+	return l.Status == DistributionListStatusArchived
+}
+
+// DistributionListMember is one recipient of a distribution list: a user,
+// sent to at the address their account has at send time, or a raw address
+// Collection: distribution_list_members
+type DistributionListMember struct {
+	ID      string    `bson:"_id" json:"id"` // List ID and member key, so a recipient is in a list once
+	ListID  string    `bson:"list_id" json:"listId"`
+	UserID  string    `bson:"user_id,omitempty" json:"userId,omitempty"`
+	Email   string    `bson:"email,omitempty" json:"email,omitempty"` // Lower-cased
+	AddedBy string    `bson:"added_by" json:"addedBy"`
+	AddedAt time.Time `bson:"added_at" json:"addedAt"`
+}
+
+// DistributionListMemberInput names a member to add or remove: either a
+// user ID or an email address
+type DistributionListMemberInput struct {
+	UserID string `json:"userId,omitempty" validate:"omitempty,uuid"`
+	Email  string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+}
+
+// CreateDistributionListRequest is the request body for creating a list,
+// optionally with its first members
+type CreateDistributionListRequest struct {
+	Name        string                        `json:"name" validate:"required,max=200"`
+	Description string                        `json:"description,omitempty" validate:"max=1000"`
+	Members     []DistributionListMemberInput `json:"members,omitempty" validate:"max=500"`
+}
+
+// UpdateDistributionListRequest is the request body for updating a list;
+// fields left out are unchanged. archived false restores an archived list.
+type UpdateDistributionListRequest struct {
+	Name        *string `json:"name,omitempty" validate:"omitempty,max=200"`
+	Description *string `json:"description,omitempty" validate:"omitempty,max=1000"`
+	Archived    *bool   `json:"archived,omitempty"`
+}
+
+// DistributionListMembersRequest is the request body for adding members to
+// a list or removing them
+type DistributionListMembersRequest struct {
+	Members []DistributionListMemberInput `json:"members" validate:"required,max=500"`
+}
+
+// DistributionListMembersResult reports what a membership change did
+type DistributionListMembersResult struct {
+	Added       int `json:"added,omitempty"`
+	Removed     int `json:"removed,omitempty"`
+	Unchanged   int `json:"unchanged"` // Already in the list, or not in it for a removal
+	MemberCount int `json:"memberCount"`
+}
+
+// DistributionListExpansion is what a distribution list sends to right
+// now: the addresses of its members, without deactivated or deleted users,
+// suppressed addresses and duplicates
+type DistributionListExpansion struct {
+	ListID            string   `json:"listId"`
+	Addresses         []string `json:"addresses"`
+	SkippedInactive   int      `json:"skippedInactive"`   // Members whose user is deactivated
+	SkippedUnknown    int      `json:"skippedUnknown"`    // Members whose user no longer exists
+	SkippedSuppressed int      `json:"skippedSuppressed"` // Addresses on the suppression list
+}
@@ -27,16 +27,22 @@ type MongoCommunication struct {
 	CustomerID  string        `bson:"customer_id,omitempty" json:"customerId,omitempty"`
 	CampaignID  string        `bson:"campaign_id,omitempty" json:"campaignId,omitempty"`
 	UserID      string        `bson:"user_id,omitempty" json:"userId,omitempty"`     // Sender/owner user ID
+	TenantID    string        `bson:"tenant_id,omitempty" json:"tenantId,omitempty"`
+	TemplateID  string        `bson:"template_id,omitempty" json:"templateId,omitempty"` // Template the message was rendered from
+	DistributionListID string `bson:"distribution_list_id,omitempty" json:"distributionListId,omitempty"` // List whose members are BCC'd, resolved at send time
 	Status      string                    `bson:"status" json:"status"`                          // pending, queued, sending, sent, delivered, opened, clicked, bounced, failed, spam, unsubscribed
 
 	// External provider tracking
 	ExternalMessageID string                    `bson:"external_message_id,omitempty" json:"externalMessageId,omitempty"` // Provider-specific message ID (e.g., SendGrid sg_message_id)
 	SGMessageID       string                    `bson:"sg_message_id,omitempty" json:"sgMessageId,omitempty"`             // SendGrid message ID for webhook matching
+	Provider          string                    `bson:"provider,omitempty" json:"provider,omitempty"`                     // Email provider the message was sent through
 
 	// User interaction flags
 	IsRead      bool                      `bson:"is_read" json:"isRead"`
 	IsStarred   bool                      `bson:"is_starred" json:"isStarred"`
 	IsArchived  bool                      `bson:"is_archived" json:"isArchived"`
+	IsTest      bool                      `bson:"is_test,omitempty" json:"isTest,omitempty"` // Template test send
+	SignatureApplied bool                 `bson:"signature_applied,omitempty" json:"signatureApplied,omitempty"` // The sender's email signature is in the body already
 
 	// Scheduling
 	ScheduledAt   *time.Time              `bson:"scheduled_at,omitempty" json:"scheduledAt,omitempty"` // When the message is scheduled to be sent
@@ -62,6 +68,17 @@ type MongoCommunication struct {
 	BounceReason  string                  `bson:"bounce_reason,omitempty" json:"bounceReason,omitempty"` // Detailed bounce reason
 	FailureReason string                  `bson:"failure_reason,omitempty" json:"failureReason,omitempty"` // Why sending failed
 
+	// Outbox retry state for queued outbound email
+	SendAttempts  int        `bson:"send_attempts,omitempty" json:"sendAttempts,omitempty"`
+	NextAttemptAt *time.Time `bson:"next_attempt_at,omitempty" json:"nextAttemptAt,omitempty"`
+	LeaseUntil    *time.Time `bson:"lease_until,omitempty" json:"-"` // A worker is sending until then
+	LeaseOwner    string     `bson:"lease_owner,omitempty" json:"-"`
+	ExpiresAt     *time.Time `bson:"expires_at,omitempty" json:"expiresAt,omitempty"` // Not worth sending after this (e.g. OTP codes)
+
+	// Last applied delivery webhook, for idempotent and ordered updates
+	DeliveryRank    int        `bson:"delivery_rank,omitempty" json:"-"`
+	DeliveryEventAt *time.Time `bson:"delivery_event_at,omitempty" json:"-"`
+
 	// Timestamps
 	CreatedAt   time.Time                 `bson:"created_at" json:"createdAt"`
 	UpdatedAt   time.Time                 `bson:"updated_at" json:"updatedAt"`
@@ -76,6 +93,7 @@ type CommunicationAttachment struct {
 	ContentID   string `bson:"content_id,omitempty" json:"contentId,omitempty"` // For inline attachments (cid:)
 	ItemID      string `bson:"item_id,omitempty" json:"itemId,omitempty"`       // OneDrive item ID for downloading
 	WebURL      string `bson:"web_url,omitempty" json:"webUrl,omitempty"`       // OneDrive web URL for preview
+	Data        []byte `bson:"-" json:"-"`                                      // Bytes to send; when nil the sender loads FileURL
 }
 
 // CommunicationChannel represents the channel of communication
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Delivery events reported by email provider webhooks
+const (
+	DeliveryEventDelivered  = "delivered"
+	DeliveryEventBounced    = "bounced"
+	DeliveryEventDeferred   = "deferred"
+	DeliveryEventComplained = "complained"
+)
+
+// Statuses set by delivery events that have no MessageStatus equivalent
+const (
+	MessageStatusDeferred = "deferred"
+	MessageStatusSpam     = "spam"
+)
+
+// Bounce types
+const (
+	BounceTypeHard = "hard"
+	BounceTypeSoft = "soft"
+)
+
+// deliveryEventRanks orders delivery events so a late or repeated webhook never
+// moves a message back to an earlier state: a deferral can be followed by a
+// delivery, a delivery by a bounce or complaint, but not the other way round.
+var deliveryEventRanks = map[string]int{
+	DeliveryEventDeferred:   1,
+	DeliveryEventDelivered:  2,
+	DeliveryEventBounced:    3,
+	DeliveryEventComplained: 4,
+}
+
+// DeliveryEventRank returns the precedence of a delivery event (0 if unknown)
+func DeliveryEventRank(event string) int {
+	return deliveryEventRanks[event]
+}
+
+// EmailDeliveryWebhook is the generic provider callback for one delivery event
+type EmailDeliveryWebhook struct {
+	MessageID  string `json:"message_id"`            // Our message ID or the provider's message ID
+	Event      string `json:"event"`                 // delivered, bounced, deferred, complained
+	Timestamp  int64  `json:"timestamp"`             // Unix seconds when the provider saw the event
+	Reason     string `json:"reason,omitempty"`      // Provider diagnostic (bounce or deferral reason)
+	BounceType string `json:"bounce_type,omitempty"` // hard (default) or soft, for bounced events
+	Recipient  string `json:"recipient,omitempty"`   // Address the event is about; defaults to the message's recipient
+}
+
+// Normalize lower-cases the event and bounce type and defaults bounces to hard
+func (w *EmailDeliveryWebhook) Normalize() {
+	w.MessageID = strings.TrimSpace(w.MessageID)
+	w.Event = strings.ToLower(strings.TrimSpace(w.Event))
+	w.BounceType = strings.ToLower(strings.TrimSpace(w.BounceType))
+	w.Recipient = strings.ToLower(strings.TrimSpace(w.Recipient))
+	if w.Event == DeliveryEventBounced && w.BounceType == "" {
+		w.BounceType = BounceTypeHard
+	}
+}
+
+// Validate checks the required fields of a normalized webhook event
+func (w *EmailDeliveryWebhook) Validate() error {
+	if w.MessageID == "" {
+		return fmt.Errorf("message_id is required")
+	}
+	if DeliveryEventRank(w.Event) == 0 {
+		return fmt.Errorf("event must be one of delivered, bounced, deferred, complained")
+	}
+	if w.Timestamp <= 0 {
+		return fmt.Errorf("timestamp is required")
+	}
+	if w.Event == DeliveryEventBounced && w.BounceType != BounceTypeHard && w.BounceType != BounceTypeSoft {
+		return fmt.Errorf("bounce_type must be hard or soft")
+	}
+	return nil
+}
+
+// OccurredAt returns the event time
+func (w *EmailDeliveryWebhook) OccurredAt() time.Time {
+	return time.Unix(w.Timestamp, 0).UTC()
+}
+
+// IsHardBounce reports whether the event permanently rejects the recipient
+func (w *EmailDeliveryWebhook) IsHardBounce() bool {
+	return w.Event == DeliveryEventBounced && w.BounceType == BounceTypeHard
+}
+
+// EmailSuppression is an address future sends must skip
+// Collection: email_suppressions
+type EmailSuppression struct {
+	Email     string    `bson:"_id" json:"email"` // Lower-cased address
+	Reason    string    `bson:"reason" json:"reason"`
+	Source    string    `bson:"source" json:"source"` // What caused it, e.g. hard_bounce
+	MessageID string    `bson:"message_id,omitempty" json:"messageId,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"createdAt"`
+}
+
+// Suppression sources
+const (
+	SuppressionSourceHardBounce = "hard_bounce"
+)
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// EmailQueueMessage asks the email worker to send a stored outbound email.
+// The email itself stays in MongoDB; the message only references it.
+type EmailQueueMessage struct {
+	MessageID string    `json:"message_id"`
+	Priority  string    `json:"priority"` // normal, high, urgent
+	QueuedAt  time.Time `json:"queued_at"`
+}
+
+// NewEmailQueueMessage creates a queue message for a stored email
+func NewEmailQueueMessage(messageID, priority string) *EmailQueueMessage {
+	return &EmailQueueMessage{
+		MessageID: messageID,
+		Priority:  priority,
+		QueuedAt:  time.Now().UTC(),
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Email send quota periods. Periods follow UTC.
+const (
+	EmailUsageDay   = "day"
+	EmailUsageMonth = "month"
+)
+
+// EmailUsage counts the outbound emails sent in one quota period
+// Collection: email_usage
+type EmailUsage struct {
+	ID          string     `bson:"_id" json:"-"` // Period and its start, e.g. day:2026-10-17
+	Period      string     `bson:"period" json:"period"`
+	Start       time.Time  `bson:"start" json:"start"`
+	Sent        int64      `bson:"sent" json:"sent"`
+	AlertSentAt *time.Time `bson:"alert_sent_at,omitempty" json:"alertSentAt,omitempty"` // Usage alert, sent at most once per period
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updatedAt"`
+}
+
+// EmailUsageStart returns the start of the period t falls in
+func EmailUsageStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	if period == EmailUsageMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// EmailUsageEnd returns the end of the period starting at start, when its
+// usage resets
+func EmailUsageEnd(period string, start time.Time) time.Time {
+	if period == EmailUsageMonth {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// EmailUsageID is the ID of the usage document of the period starting at start
+func EmailUsageID(period string, start time.Time) string {
+	if period == EmailUsageMonth {
+		return period + ":" + start.Format("2006-01")
+	}
+	return period + ":" + start.Format("2006-01-02")
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// ImpersonationSession is a support operator acting as another user through
+// a short-lived access token. The token carries the session ID, so ending
+// the session revokes the token.
+// Collection: impersonation_sessions
+type ImpersonationSession struct {
+	ID           string     `bson:"_id" json:"id"`
+	ActorID      string     `bson:"actor_id" json:"actorId"` // The real operator
+	ActorEmail   string     `bson:"actor_email" json:"actorEmail"`
+	ActorName    string     `bson:"actor_name" json:"actorName"`
+	TargetUserID string     `bson:"target_user_id" json:"targetUserId"` // The impersonated user
+	TargetEmail  string     `bson:"target_email" json:"targetEmail"`
+	Reason       string     `bson:"reason,omitempty" json:"reason,omitempty"`
+	StartedAt    time.Time  `bson:"started_at" json:"startedAt"`
+	ExpiresAt    time.Time  `bson:"expires_at" json:"expiresAt"`
+	EndedAt      *time.Time `bson:"ended_at,omitempty" json:"endedAt,omitempty"` // Set when ended early
+	IPAddress    string     `bson:"ip_address,omitempty" json:"ipAddress,omitempty"`
+}
+
+// IsActive reports whether the session has neither been ended nor expired
+func (s *ImpersonationSession) IsActive(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// StartImpersonationRequest is the optional body of an impersonation start
+type StartImpersonationRequest struct {
+	Reason string `json:"reason" validate:"max=500"` // Ticket or explanation, kept in the audit trail
+}
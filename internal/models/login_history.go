@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sign-in methods of a login record
+const (
+	LoginMethodPassword = "password"
+	LoginMethodSSO      = "sso"
+)
+
+// Why a sign-in of a known user was rejected
+const (
+	LoginFailureWrongPassword = "wrong_password"
+	LoginFailureInactive      = "account_inactive"
+	LoginFailureSSORequired   = "sso_required"
+	LoginFailureInvalid2FA    = "invalid_2fa_code"
+	LoginFailureExpired2FA    = "expired_2fa_code"
+)
+
+// LoginRecord is one sign-in attempt of a user, successful or not. Attempts
+// with an unknown email have no user to show them to and are not recorded.
+// Collection: login_history
+type LoginRecord struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        string             `bson:"user_id" json:"userId"`
+	Email         string             `bson:"email,omitempty" json:"email,omitempty"`
+	Timestamp     time.Time          `bson:"timestamp" json:"timestamp"`
+	Success       bool               `bson:"success" json:"success"`
+	FailureReason string             `bson:"failure_reason,omitempty" json:"failureReason,omitempty"` // One of the LoginFailure constants
+	Method        string             `bson:"method" json:"method"`                                    // password or sso
+	TwoFactor     bool               `bson:"two_factor" json:"twoFactor"`                             // A 2FA code was checked
+	IPAddress     string             `bson:"ip_address,omitempty" json:"ipAddress,omitempty"`
+	UserAgent     string             `bson:"user_agent,omitempty" json:"userAgent,omitempty"`
+	Browser       string             `bson:"browser,omitempty" json:"browser,omitempty"`
+	OS            string             `bson:"os,omitempty" json:"os,omitempty"`
+	Device        string             `bson:"device,omitempty" json:"device,omitempty"` // desktop, mobile, tablet, bot or other
+}
+
+// LoginHistoryFilter narrows a user's login history. Nil fields match every
+// record.
+type LoginHistoryFilter struct {
+	Success *bool
+	From    *time.Time // Inclusive
+	To      *time.Time // Exclusive
+}
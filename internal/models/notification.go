@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// NotificationType identifies what a notification is about. Each type maps to
+// the user's notification settings that let it through.
+type NotificationType string
+
+const (
+	NotificationNewDeviceLogin          NotificationType = "new_device_login"
+	NotificationTemplateApprovalRequest NotificationType = "template_approval_request"
+	NotificationTaskReminder            NotificationType = "task_reminder"
+	NotificationWeeklyReport            NotificationType = "weekly_report"
+)
+
+// Notification is an entry of a user's in-app notification feed
+type Notification struct {
+	ID        string            `bson:"_id" json:"id"`
+	UserID    string            `bson:"user_id" json:"userId"`
+	Type      NotificationType  `bson:"type" json:"type"`
+	Title     string            `bson:"title" json:"title"`
+	Body      string            `bson:"body" json:"body"`
+	Link      string            `bson:"link,omitempty" json:"link,omitempty"`
+	Data      map[string]string `bson:"data,omitempty" json:"data,omitempty"`
+	ReadAt    *time.Time        `bson:"read_at,omitempty" json:"readAt,omitempty"`
+	CreatedAt time.Time         `bson:"created_at" json:"createdAt"`
+}
+
+// IsRead reports whether the user has read the notification
+func (n *Notification) IsRead() bool {
+	return n.ReadAt != nil
+}
+
+// NotificationPayload is the content of a notification. Title is also the
+// email subject and Body its plain-text body; HTML, when set, is the email's
+// HTML body.
+type NotificationPayload struct {
+	Title string
+	Body  string
+	HTML  string
+	Link  string
+	Data  map[string]string
+}
+
+// Digest frequencies a user can choose for notification emails. Emails of
+// one type received within the period are sent together as one digest.
+const (
+	DigestImmediate = "immediate" // Every notification is emailed on its own
+	Digest15Minutes = "15m"
+	DigestHourly    = "hourly"
+	DigestDaily     = "daily"
+)
+
+// PendingNotification is a notification email held back to go out in the
+// recipient's next digest of its type. A flushing worker leases the batch
+// so that only one instance sends it.
+// Collection: pending_notifications
+type PendingNotification struct {
+	ID         string           `bson:"_id"`
+	UserID     string           `bson:"user_id"`
+	Type       NotificationType `bson:"type"`
+	Title      string           `bson:"title"`
+	Body       string           `bson:"body"`
+	Link       string           `bson:"link,omitempty"`
+	CreatedAt  time.Time        `bson:"created_at"`
+	DueAt      time.Time        `bson:"due_at"` // When the digest holding it goes out at the latest
+	LeaseUntil *time.Time       `bson:"lease_until,omitempty"`
+	LeaseOwner string           `bson:"lease_owner,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// OnboardingProgress is what a user has chosen about their onboarding
+// checklist; whether an item is done is computed from their data.
+// Collection: onboarding_progress
+type OnboardingProgress struct {
+	UserID    string    `bson:"user_id" json:"userId"`
+	Dismissed []string  `bson:"dismissed" json:"dismissed"` // Item keys hidden by the user
+	UpdatedAt time.Time `bson:"updated_at" json:"updatedAt"`
+}
+
+// OnboardingItem is one step of the onboarding checklist
+type OnboardingItem struct {
+	Key       string `json:"key"`
+	Title     string `json:"title"`
+	Done      bool   `json:"done"`
+	Dismissed bool   `json:"dismissed"`
+}
+
+// OnboardingChecklist is a user's onboarding checklist. Percent is the
+// share of the items not dismissed that are done; with every item dismissed
+// it is 100.
+type OnboardingChecklist struct {
+	Items     []OnboardingItem `json:"items"`
+	Completed int              `json:"completed"` // Done items not dismissed
+	Total     int              `json:"total"`     // Items not dismissed
+	Percent   int              `json:"percent"`
+}
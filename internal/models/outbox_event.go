@@ -0,0 +1,107 @@
+package models
+
+import "time"
+
+// Delivery status of an outbox event, derived from its timestamps
+const (
+	OutboxEventPending   = "pending"   // Waiting for the relay, possibly after failed attempts
+	OutboxEventFailed    = "failed"    // Refused by the broker too often; set aside until replayed
+	OutboxEventPublished = "published" // Delivered to Kafka
+)
+
+// OutboxEvent is a domain event waiting to be relayed to Kafka. Events are
+// recorded alongside the write they describe and published in Sequence order,
+// so a broker outage or crash delays them instead of losing them.
+// Collection: events_outbox
+type OutboxEvent struct {
+	ID          string     `bson:"_id" json:"eventId"` // Also the payload's event_id, for consumer dedupe
+	Topic       string     `bson:"topic" json:"topic"`
+	EventType   string     `bson:"event_type,omitempty" json:"eventType,omitempty"` // The payload's event_type
+	Key         string     `bson:"key,omitempty" json:"key,omitempty"`              // Kafka partition key
+	Payload     string     `bson:"payload" json:"payload,omitempty"`                // JSON as published
+	Sequence    int64      `bson:"sequence" json:"sequence"`
+	Attempts    int        `bson:"attempts" json:"attempts"` // Since it was recorded or last replayed
+	LastError   string     `bson:"last_error,omitempty" json:"lastError,omitempty"`
+	CreatedAt   time.Time  `bson:"created_at" json:"createdAt"`
+	PublishedAt *time.Time `bson:"published_at,omitempty" json:"publishedAt,omitempty"`
+	FailedAt    *time.Time `bson:"failed_at,omitempty" json:"failedAt,omitempty"` // Set aside by the relay
+
+	// The latest delivery attempts, oldest first
+	DeliveryAttempts []OutboxDeliveryAttempt `bson:"delivery_attempts,omitempty" json:"deliveryAttempts,omitempty"`
+
+	// Replays re-enqueue the event under the same ID
+	Replays        int        `bson:"replays,omitempty" json:"replays,omitempty"`
+	LastReplayedAt *time.Time `bson:"last_replayed_at,omitempty" json:"lastReplayedAt,omitempty"`
+	LastReplayedBy string     `bson:"last_replayed_by,omitempty" json:"lastReplayedBy,omitempty"`
+
+	Status string `bson:"-" json:"status"` // pending, failed or published
+}
+
+// OutboxDeliveryAttempt is one attempt to publish an outbox event
+type OutboxDeliveryAttempt struct {
+	At    time.Time `bson:"at" json:"at"`
+	Error string    `bson:"error,omitempty" json:"error,omitempty"` // Empty when the broker acknowledged it
+}
+
+// DeliveryStatus returns the status of the event from its timestamps
+func (e *OutboxEvent) DeliveryStatus() string {
+	switch {
+	case e.PublishedAt != nil:
+		return OutboxEventPublished
+	case e.FailedAt != nil:
+		return OutboxEventFailed
+	default:
+		return OutboxEventPending
+	}
+}
+
+// IsValidOutboxEventStatus checks if the outbox event status is valid
+func IsValidOutboxEventStatus(status string) bool {
+	switch status {
+	case OutboxEventPending, OutboxEventFailed, OutboxEventPublished:
+		return true
+	}
+	return false
+}
+
+// OutboxEventFilter narrows a listing of outbox events. Empty fields match
+// every event.
+type OutboxEventFilter struct {
+	Status    string
+	Topic     string
+	EventType string
+	From      *time.Time // Recorded at or after, inclusive
+	To        *time.Time // Recorded before, exclusive
+}
+
+// Status of an event replay job
+const (
+	EventReplayRunning   = "running"
+	EventReplayCompleted = "completed"
+	EventReplayFailed    = "failed" // Stopped by an error; events already re-enqueued stay so
+)
+
+// EventReplayJob re-enqueues the failed outbox events recorded in a window,
+// oldest first and at most Limit of them.
+// Collection: event_replay_jobs
+type EventReplayJob struct {
+	ID         string     `bson:"_id" json:"id"`
+	Status     string     `bson:"status" json:"status"`
+	From       time.Time  `bson:"from" json:"from"`
+	To         time.Time  `bson:"to" json:"to"`
+	Limit      int        `bson:"limit" json:"limit"`
+	Matched    int        `bson:"matched" json:"matched"`   // Failed events found in the window, up to Limit
+	Replayed   int        `bson:"replayed" json:"replayed"` // Of them re-enqueued; others were replayed meanwhile
+	Error      string     `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy  string     `bson:"created_by" json:"createdBy"`
+	CreatedAt  time.Time  `bson:"created_at" json:"createdAt"`
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finishedAt,omitempty"`
+}
+
+// ReplayFailedEventsRequest asks to re-enqueue the failed events recorded
+// in [from, to)
+type ReplayFailedEventsRequest struct {
+	From  time.Time `json:"from" validate:"required"`
+	To    time.Time `json:"to" validate:"required"`
+	Limit int       `json:"limit,omitempty" validate:"omitempty,min=1,max=10000"` // Defaults to 1000
+}
@@ -6,14 +6,14 @@ import (
 
 // PasswordReset represents a password reset token
 type PasswordReset struct {
-	ResetToken string             `json:"reset_token"`
-	UserID     string             `json:"user_id"`
-	Email      string             `json:"email"`
-	CreatedAt  time.Time          `json:"created_at"`
-	ExpiresAt  time.Time          `json:"expires_at"`
-	IsUsed     bool               `json:"is_used"`
-	IPAddress  string             `json:"ip_address"`
-	UserAgent  string             `json:"user_agent"`
+	ResetToken string             `json:"reset_token" bson:"reset_token"`
+	UserID     string             `json:"user_id" bson:"user_id"`
+	Email      string             `json:"email" bson:"email"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	IsUsed     bool               `json:"is_used" bson:"is_used"`
+	IPAddress  string             `json:"ip_address" bson:"ip_address"`
+	UserAgent  string             `json:"user_agent" bson:"user_agent"`
 }
 
 // IsValid checks if the reset token is still valid
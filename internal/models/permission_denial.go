@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PermissionDenial is a request refused because the caller lacked the
+// permission or role its route requires, kept for security review
+// Collection: permission_denials
+type PermissionDenial struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     string             `bson:"user_id" json:"userId"`
+	UserName   string             `bson:"user_name,omitempty" json:"userName,omitempty"`
+	Role       string             `bson:"role,omitempty" json:"role,omitempty"`
+	Required   string             `bson:"required" json:"required"` // The permission, or the roles, the route requires
+	Method     string             `bson:"method" json:"method"`
+	Route      string             `bson:"route" json:"route"` // The route template, e.g. /api/v1/admin/roles/{id}
+	IPAddress  string             `bson:"ip_address,omitempty" json:"ipAddress,omitempty"`
+	RequestID  string             `bson:"request_id,omitempty" json:"requestId,omitempty"`
+	Throttled  bool               `bson:"throttled" json:"throttled"` // Refused with 429 because the user had too many denials
+	OccurredAt time.Time          `bson:"occurred_at" json:"occurredAt"`
+}
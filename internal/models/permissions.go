@@ -54,10 +54,13 @@ type PermissionResource struct {
 type DataScope struct {
 	Customers string `bson:"customers" json:"customers"` // own | team | region | all
 	Campaigns string `bson:"campaigns" json:"campaigns"` // own | team | region | all
+	Users     string `bson:"users,omitempty" json:"users,omitempty"` // own | team | region | all - team members and their activity
 }
 
 // RolePermission defines permissions assigned to a role
-// Stored in 'role_permissions' collection
+// Stored in 'role_permissions' collection. The built-in roles, one per
+// UserRole value, are seeded at startup; custom roles are created by admins
+// and assigned to users by ID (User.RoleIDs) on top of their role.
 // Permissions use 3-part format: "resource:sub_scope:action"
 type RolePermission struct {
 	ID           string `bson:"_id,omitempty" json:"id"`
@@ -179,21 +182,27 @@ func BuildPermission(resource, subScope, action string) string {
 
 // UpdateRolePermissionsRequest is the request body for updating role permissions
 type UpdateRolePermissionsRequest struct {
-	RoleName    string    `json:"roleName"`
-	Description string    `json:"description"`
-	Permissions []string  `json:"permissions"`
+	RoleName    string    `json:"roleName" validate:"required,max=100"`
+	Description string    `json:"description" validate:"max=500"`
+	Permissions []string  `json:"permissions" validate:"max=200,dive,required,max=100"`
 	DataScope   DataScope `json:"dataScope"`
 }
 
 // CreateCustomRoleRequest is the request body for creating a new custom role
 type CreateCustomRoleRequest struct {
-	RoleCode    string    `json:"roleCode"`
-	RoleName    string    `json:"roleName"`
-	Description string    `json:"description"`
-	Permissions []string  `json:"permissions"`
+	RoleCode    string    `json:"roleCode" validate:"required,max=50"`
+	RoleName    string    `json:"roleName" validate:"required,max=100"`
+	Description string    `json:"description" validate:"max=500"`
+	Permissions []string  `json:"permissions" validate:"max=200,dive,required,max=100"`
 	DataScope   DataScope `json:"dataScope"`
 }
 
+// AssignRolesRequest is the request body for setting the custom roles of a
+// user; an empty list removes them all
+type AssignRolesRequest struct {
+	RoleIDs []string `json:"roleIds" validate:"max=20,dive,required"`
+}
+
 // MyPermissionsResponse is the response for /permissions/my endpoint
 type MyPermissionsResponse struct {
 	RoleCode    string    `json:"roleCode"`
@@ -224,21 +233,110 @@ const (
 	DataScopeNone   = "none"   // No access to this resource
 )
 
+// Data scope resources, the per-resource fields of DataScope
+const (
+	DataScopeResourceCustomers = "customers"
+	DataScopeResourceCampaigns = "campaigns"
+	DataScopeResourceUsers     = "users"
+)
+
+// DataScopeResources lists the resources a data scope can be set for
+var DataScopeResources = []string{DataScopeResourceCustomers, DataScopeResourceCampaigns, DataScopeResourceUsers}
+
+// IsValidDataScopeValue checks if value is one of the data scope constants
+func IsValidDataScopeValue(value string) bool {
+	switch value {
+	case DataScopeOwn, DataScopeTeam, DataScopeRegion, DataScopeAll, DataScopeNone:
+		return true
+	}
+	return false
+}
+
+// Get returns the scope set for resource, or "" when none is set
+func (d DataScope) Get(resource string) string {
+	switch resource {
+	case DataScopeResourceCustomers:
+		return d.Customers
+	case DataScopeResourceCampaigns:
+		return d.Campaigns
+	case DataScopeResourceUsers:
+		return d.Users
+	}
+	return ""
+}
+
+// Set sets the scope of resource and reports whether resource is known
+func (d *DataScope) Set(resource, value string) bool {
+	switch resource {
+	case DataScopeResourceCustomers:
+		d.Customers = value
+	case DataScopeResourceCampaigns:
+		d.Campaigns = value
+	case DataScopeResourceUsers:
+		d.Users = value
+	default:
+		return false
+	}
+	return true
+}
+
+// WithOverride returns the scope with every resource set in override
+// replaced by the override's value. A nil override changes nothing.
+func (d DataScope) WithOverride(override *DataScope) DataScope {
+	if override == nil {
+		return d
+	}
+	for _, resource := range DataScopeResources {
+		if value := override.Get(resource); value != "" {
+			d.Set(resource, value)
+		}
+	}
+	return d
+}
+
+// ================================
+// Constants for Enforced Permissions
+// ================================
+
+const (
+	PermSystemSettingsView   = "settings:system:view"
+	PermSystemSettingsUpdate = "settings:system:update"
+	PermAuditLogsView        = "settings:audit_logs:view"
+
+	PermTeamMembersView   = "team:members:view"
+	PermTeamMembersInvite = "team:members:invite"
+	PermTeamMembersUpdate = "team:members:update"
+	PermTeamMembersDelete = "team:members:delete"
+
+	PermTemplatesDelete  = "templates:library:delete"
+	PermTemplatesApprove = "templates:library:approve"
+
+	// PermSupportImpersonate lets support staff act as another user
+	PermSupportImpersonate = "support:users:impersonate"
+
+	// PermRolesManage lets admins create, change, delete and assign roles
+	PermRolesManage = "roles:manage"
+
+	// PermEventsAdmin lets operators inspect and replay outbox events
+	PermEventsAdmin = "events:admin"
+)
+
 // ================================
 // Constants for System Roles
 // ================================
 
 const (
-	RoleAdmin   = "admin"
-	RoleManager = "manager"
-	RoleHunting = "hunting"
-	RoleFarming = "farming"
-	RoleGenOps  = "genops"
+	RoleAdmin    = "admin"
+	RoleManager  = "manager"
+	RoleSalesRep = "sales_rep"
+	RoleHunting  = "hunting"
+	RoleFarming  = "farming"
+	RoleGenOps   = "genops"
 )
 
 // SystemRoles returns the list of system roles that cannot be deleted
 func SystemRoles() []string {
-	return []string{RoleAdmin, RoleManager, RoleHunting, RoleFarming, RoleGenOps}
+	return []string{RoleAdmin, RoleManager, RoleSalesRep, RoleHunting, RoleFarming, RoleGenOps}
 }
 
 // IsSystemRole checks if a role code is a system role
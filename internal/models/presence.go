@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Presence of a user, derived from when they last made a request
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// Presence thresholds: a user seen within PresenceOnlineWithin is online,
+// within PresenceAwayWithin away, and offline after that or never seen
+const (
+	PresenceOnlineWithin = 10 * time.Minute
+	PresenceAwayWithin   = time.Hour
+)
+
+// PresenceAt returns the presence at now of a user last seen at lastSeen
+func PresenceAt(lastSeen *time.Time, now time.Time) string {
+	if lastSeen == nil {
+		return PresenceOffline
+	}
+	switch idle := now.Sub(*lastSeen); {
+	case idle < PresenceOnlineWithin:
+		return PresenceOnline
+	case idle < PresenceAwayWithin:
+		return PresenceAway
+	default:
+		return PresenceOffline
+	}
+}
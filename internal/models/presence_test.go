@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresenceAtBoundaries(t *testing.T) {
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		idle time.Duration
+		want string
+	}{
+		{0, PresenceOnline},
+		{PresenceOnlineWithin - time.Nanosecond, PresenceOnline},
+		{PresenceOnlineWithin, PresenceAway},
+		{PresenceAwayWithin - time.Nanosecond, PresenceAway},
+		{PresenceAwayWithin, PresenceOffline},
+		{48 * time.Hour, PresenceOffline},
+	} {
+		seen := now.Add(-tt.idle)
+		if got := PresenceAt(&seen, now); got != tt.want {
+			t.Errorf("seen %v ago = %s, want %s", tt.idle, got, tt.want)
+		}
+	}
+	if got := PresenceAt(nil, now); got != PresenceOffline {
+		t.Errorf("never seen = %s, want %s", got, PresenceOffline)
+	}
+}
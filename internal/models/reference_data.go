@@ -0,0 +1,60 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Reference data kinds. Each is stored in the collection of the same name
+// and matches the user field holding its code.
+const (
+	ReferenceKindRegions = "regions"
+	ReferenceKindTeams   = "teams"
+)
+
+// ReferenceEntry is a managed region or team. Users store its code in their
+// region or team field.
+// Collections: regions, teams
+type ReferenceEntry struct {
+	Code      string    `bson:"_id" json:"code"`
+	Name      string    `bson:"name" json:"name"`
+	IsActive  bool      `bson:"is_active" json:"isActive"`
+	CreatedAt time.Time `bson:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updatedAt"`
+}
+
+// CreateReferenceEntryRequest is the body of a new region or team
+type CreateReferenceEntryRequest struct {
+	Code     string `json:"code" validate:"required,max=64"`
+	Name     string `json:"name" validate:"max=200"`
+	IsActive *bool  `json:"isActive"` // Defaults to true
+}
+
+// UpdateReferenceEntryRequest changes the given fields of a region or team.
+// Deactivating one that users are assigned to requires ReassignTo, the code
+// of an active entry to move them to.
+type UpdateReferenceEntryRequest struct {
+	Name       *string `json:"name,omitempty" validate:"omitempty,max=200"`
+	IsActive   *bool   `json:"isActive,omitempty"`
+	ReassignTo string  `json:"reassignTo,omitempty" validate:"max=64"`
+}
+
+// NormalizeReferenceCode returns the canonical form of a region or team
+// code: trimmed and lower case
+func NormalizeReferenceCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// IsValidReferenceCode reports whether code is a canonical code of lower
+// case letters, digits, underscores and dashes
+func IsValidReferenceCode(code string) bool {
+	if code == "" || len(code) > 64 {
+		return false
+	}
+	for _, c := range code {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
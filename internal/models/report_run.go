@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ReportWeekly is the kind of the weekly activity report run
+const ReportWeekly = "weekly_report"
+
+// ReportRun records one scheduled report run. Its ID is the report kind and
+// the period it covers, so a period can only be claimed once.
+// Collection: report_runs
+type ReportRun struct {
+	ID         string     `bson:"_id" json:"id"`
+	Kind       string     `bson:"kind" json:"kind"`
+	Period     string     `bson:"period" json:"period"` // ISO week, e.g. 2026-W42
+	StartedAt  time.Time  `bson:"started_at" json:"startedAt"`
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finishedAt,omitempty"`
+	Sent       int        `bson:"sent" json:"sent"`
+	Skipped    int        `bson:"skipped" json:"skipped"` // Opted out of the report
+	Failed     int        `bson:"failed" json:"failed"`
+	Error      string     `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// ReportRunID is the ID of the kind report run for period
+func ReportRunID(kind, period string) string {
+	return kind + ":" + period
+}
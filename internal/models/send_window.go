@@ -0,0 +1,163 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WorkingHoursLayout is the form working hours are stored in: 24h HH:MM
+const WorkingHoursLayout = "15:04"
+
+// legacyWorkingHoursLayouts are the free-text forms working hours were
+// stored in before they were validated, e.g. 9am and 9:30am
+var legacyWorkingHoursLayouts = []string{"3pm", "3:04pm"}
+
+// Weekdays in the form working days are stored in
+var Weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// DefaultWorkingDays are the working days of organizations that have not
+// chosen any
+var DefaultWorkingDays = []string{"monday", "tuesday", "wednesday", "thursday", "friday"}
+
+// NormalizeWorkingHours returns a time of day as HH:MM, accepting the legacy
+// 9am and 9:30am forms as well
+func NormalizeWorkingHours(value string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, layout := range append([]string{WorkingHoursLayout}, legacyWorkingHoursLayouts...) {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(WorkingHoursLayout), true
+		}
+	}
+	return "", false
+}
+
+// SendWindow is the part of the week outbound messages that are not urgent
+// are sent in: from Start to End (exclusive) on each working day, in the
+// organization's timezone
+type SendWindow struct {
+	Location    *time.Location
+	Start       int // Minutes after midnight
+	End         int // Minutes after midnight
+	WorkingDays map[time.Weekday]bool
+}
+
+// SendWindow returns the window the settings allow sending in. Working hours
+// still in the legacy 9am form are understood; without working days the
+// default ones apply.
+func (s *SystemDefaultSettings) SendWindow() (*SendWindow, error) {
+	timezone := s.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	start, err := workingHoursMinute(s.WorkingHoursStart)
+	if err != nil {
+		return nil, err
+	}
+	end, err := workingHoursMinute(s.WorkingHoursEnd)
+	if err != nil {
+		return nil, err
+	}
+	if start >= end {
+		return nil, fmt.Errorf("working hours %s-%s end before they start", s.WorkingHoursStart, s.WorkingHoursEnd)
+	}
+
+	days := s.WorkingDays
+	if len(days) == 0 {
+		days = DefaultWorkingDays
+	}
+	window := &SendWindow{Location: loc, Start: start, End: end, WorkingDays: make(map[time.Weekday]bool, len(days))}
+	for _, day := range days {
+		weekday, ok := ParseWeekday(day)
+		if !ok {
+			return nil, fmt.Errorf("unknown working day %q", day)
+		}
+		window.WorkingDays[weekday] = true
+	}
+	return window, nil
+}
+
+// ParseWeekday returns the weekday named by day, in any case
+func ParseWeekday(day string) (time.Weekday, bool) {
+	day = strings.ToLower(strings.TrimSpace(day))
+	for i, name := range Weekdays {
+		if name == day {
+			return time.Weekday(i), true
+		}
+	}
+	return 0, false
+}
+
+func workingHoursMinute(value string) (int, error) {
+	normalized, ok := NormalizeWorkingHours(value)
+	if !ok {
+		return 0, fmt.Errorf("working hours %q are not a time of day", value)
+	}
+	t, _ := time.Parse(WorkingHoursLayout, normalized)
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether at falls inside the window
+func (w *SendWindow) Contains(at time.Time) bool {
+	local := at.In(w.Location)
+	minute := local.Hour()*60 + local.Minute()
+	return w.WorkingDays[local.Weekday()] && minute >= w.Start && minute < w.End
+}
+
+// NextOpening returns the first time after at the window opens, or the zero
+// time when it never does
+func (w *SendWindow) NextOpening(at time.Time) time.Time {
+	local := at.In(w.Location)
+	year, month, day := local.Date()
+	for offset := 0; offset <= 7; offset++ {
+		opening := time.Date(year, month, day+offset, w.Start/60, w.Start%60, 0, 0, w.Location)
+		if w.WorkingDays[opening.Weekday()] && opening.After(at) {
+			return opening
+		}
+	}
+	return time.Time{}
+}
+
+// ClosingAfter returns when the window containing at closes
+func (w *SendWindow) ClosingAfter(at time.Time) time.Time {
+	year, month, day := at.In(w.Location).Date()
+	return time.Date(year, month, day, w.End/60, w.End%60, 0, 0, w.Location)
+}
+
+// SendWindowStatus is the effective send window at a point in time
+type SendWindowStatus struct {
+	Timezone          string     `json:"timezone"`
+	WorkingHoursStart string     `json:"workingHoursStart"` // HH:MM
+	WorkingHoursEnd   string     `json:"workingHoursEnd"`   // HH:MM, exclusive
+	WorkingDays       []string   `json:"workingDays"`
+	Now               time.Time  `json:"now"`
+	Open              bool       `json:"open"`               // Messages that are not urgent are sent right away
+	ClosesAt          *time.Time `json:"closesAt,omitempty"` // When open
+	NextOpening       time.Time  `json:"nextOpening"`        // Where messages sent while closed are deferred to
+}
+
+// Status describes the window at now
+func (w *SendWindow) Status(now time.Time) *SendWindowStatus {
+	status := &SendWindowStatus{
+		Timezone:          w.Location.String(),
+		WorkingHoursStart: fmt.Sprintf("%02d:%02d", w.Start/60, w.Start%60),
+		WorkingHoursEnd:   fmt.Sprintf("%02d:%02d", w.End/60, w.End%60),
+		Now:               now.In(w.Location),
+		Open:              w.Contains(now),
+		NextOpening:       w.NextOpening(now),
+	}
+	for i, name := range Weekdays {
+		if w.WorkingDays[time.Weekday(i)] {
+			status.WorkingDays = append(status.WorkingDays, name)
+		}
+	}
+	if status.Open {
+		closes := w.ClosingAfter(now)
+		status.ClosesAt = &closes
+	}
+	return status
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalizeWorkingHours(t *testing.T) {
+	for value, want := range map[string]string{
+		"09:00":   "09:00",
+		"18:30":   "18:30",
+		"9am":     "09:00",
+		"6pm":     "18:00",
+		"6:30pm":  "18:30",
+		" 9AM ":   "09:00",
+		"12am":    "00:00",
+		"12pm":    "12:00",
+		"9:05am":  "09:05",
+		"23:59":   "23:59",
+		"00:00":   "00:00",
+		"11:59pm": "23:59",
+	} {
+		if got, ok := NormalizeWorkingHours(value); !ok || got != want {
+			t.Errorf("NormalizeWorkingHours(%q) = %q, %v, want %q", value, got, ok, want)
+		}
+	}
+	for _, value := range []string{"", "9", "noon", "24:00", "9:60am", "13pm", "9.30"} {
+		if got, ok := NormalizeWorkingHours(value); ok {
+			t.Errorf("NormalizeWorkingHours(%q) = %q, want it refused", value, got)
+		}
+	}
+}
+
+func TestSendWindowSettings(t *testing.T) {
+	window, err := (&SystemDefaultSettings{Timezone: "Asia/Kolkata", WorkingHoursStart: "9am", WorkingHoursEnd: "6:30pm"}).SendWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if window.Start != 9*60 || window.End != 18*60+30 || window.Location.String() != "Asia/Kolkata" {
+		t.Errorf("window = %+v, want 09:00-18:30 in Asia/Kolkata", window)
+	}
+	if len(window.WorkingDays) != 5 || window.WorkingDays[time.Saturday] || window.WorkingDays[time.Sunday] {
+		t.Errorf("working days = %v, want monday to friday by default", window.WorkingDays)
+	}
+
+	for _, settings := range []SystemDefaultSettings{
+		{Timezone: "Mars/Olympus_Mons", WorkingHoursStart: "09:00", WorkingHoursEnd: "18:00"},
+		{WorkingHoursStart: "18:00", WorkingHoursEnd: "09:00"},
+		{WorkingHoursStart: "09:00", WorkingHoursEnd: "09:00"},
+		{WorkingHoursStart: "morning", WorkingHoursEnd: "18:00"},
+		{WorkingHoursStart: "09:00", WorkingHoursEnd: "18:00", WorkingDays: []string{"monday", "funday"}},
+	} {
+		if window, err := settings.SendWindow(); err == nil {
+			t.Errorf("SendWindow of %+v = %+v, want an error", settings, window)
+		}
+	}
+}
+
+// TestSendWindowBoundaries checks the window opens on its first minute,
+// closes on its last, and where each time outside it is deferred to
+func TestSendWindowBoundaries(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	window, err := (&SystemDefaultSettings{Timezone: "Asia/Kolkata", WorkingHoursStart: "09:00", WorkingHoursEnd: "18:00"}).SendWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-03-04 is a Wednesday
+	at := func(day, hour, minute, second int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, second, 0, kolkata)
+	}
+
+	for _, tt := range []struct {
+		name string
+		at   time.Time
+		open bool
+		next time.Time
+	}{
+		{"3am", at(4, 3, 0, 0), false, at(4, 9, 0, 0)},
+		{"last second before opening", at(4, 8, 59, 59), false, at(4, 9, 0, 0)},
+		{"opening minute", at(4, 9, 0, 0), true, at(5, 9, 0, 0)},
+		{"last open minute", at(4, 17, 59, 59), true, at(5, 9, 0, 0)},
+		{"closing minute", at(4, 18, 0, 0), false, at(5, 9, 0, 0)},
+		{"friday evening", at(6, 18, 0, 0), false, at(9, 9, 0, 0)},
+		{"saturday noon", at(7, 12, 0, 0), false, at(9, 9, 0, 0)},
+		{"sunday just before the week opens", at(8, 8, 59, 0), false, at(9, 9, 0, 0)},
+		// 03:00 UTC on Wednesday is 08:30 in Kolkata
+		{"other timezone", time.Date(2026, 3, 4, 3, 0, 0, 0, time.UTC), false, at(4, 9, 0, 0)},
+	} {
+		if got := window.Contains(tt.at); got != tt.open {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.at, got, tt.open)
+		}
+		if got := window.NextOpening(tt.at); !got.Equal(tt.next) {
+			t.Errorf("%s: NextOpening(%v) = %v, want %v", tt.name, tt.at, got, tt.next)
+		}
+	}
+
+	status := window.Status(at(4, 12, 0, 0))
+	if !status.Open || status.ClosesAt == nil || !status.ClosesAt.Equal(at(4, 18, 0, 0)) || !status.NextOpening.Equal(at(5, 9, 0, 0)) {
+		t.Errorf("status at noon = %+v, want open until 18:00", status)
+	}
+	if status.WorkingHoursStart != "09:00" || status.WorkingHoursEnd != "18:00" || !slices.Equal(status.WorkingDays, DefaultWorkingDays) {
+		t.Errorf("status at noon = %+v", status)
+	}
+	if status := window.Status(at(7, 12, 0, 0)); status.Open || status.ClosesAt != nil {
+		t.Errorf("status on saturday = %+v, want closed", status)
+	}
+}
+
+// TestSendWindowAcrossDaylightSaving checks the next opening is at the
+// start of working hours on the local clock after the clocks change
+func TestSendWindowAcrossDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	window, err := (&SystemDefaultSettings{Timezone: "America/New_York", WorkingHoursStart: "09:00", WorkingHoursEnd: "17:00", WorkingDays: []string{"Monday", "friday"}}).SendWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clocks go forward on Sunday 2026-03-08
+	friday := time.Date(2026, 3, 6, 17, 0, 0, 0, newYork)
+	if got, want := window.NextOpening(friday), time.Date(2026, 3, 9, 13, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextOpening after friday = %v, want %v", got.UTC(), want)
+	}
+	if window.Contains(time.Date(2026, 3, 4, 12, 0, 0, 0, newYork)) {
+		t.Error("window open on a wednesday, which is not a working day")
+	}
+}
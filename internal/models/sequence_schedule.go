@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SequenceStepFireTime is when one step of a sequence would be sent for a
+// hypothetical enrollment
+type SequenceStepFireTime struct {
+	StepOrder int       `json:"order"`
+	Channel   string    `json:"communicationType"`
+	DayOffset int       `json:"dayOffset"` // Days after the enrollment date
+	SendAt    string    `json:"sendAt"`
+	Timezone  string    `json:"timezone"`
+	FireAt    time.Time `json:"fireAt"` // In the step's timezone
+	FireAtUTC time.Time `json:"fireAtUtc"`
+	// Next opening of the organization's send window when FireAt is outside it
+	DeferredTo *time.Time `json:"deferredTo,omitempty"`
+	Warnings   []string   `json:"warnings,omitempty"`
+}
+
+// EffectiveDelayDays returns the step's delay after the previous step, preferring
+// delay_days over the legacy wait_days field
+func (s *CampaignSequenceStep) EffectiveDelayDays() int {
+	if s.DelayDays != 0 {
+		return s.DelayDays
+	}
+	return s.WaitDays
+}
+
+// EffectiveTimezone returns the step's timezone, falling back to defaultTZ
+func (s *CampaignSequenceStep) EffectiveTimezone(defaultTZ string) string {
+	if s.Timezone != "" {
+		return s.Timezone
+	}
+	return defaultTZ
+}
+
+// PreviewSequenceSchedule computes when each step fires for a recipient enrolled
+// on enrolledOn (only its calendar date is used). Delays accumulate from step to
+// step and each step sends at its send_at wall-clock time in its own timezone,
+// or defaultTZ when the step has none.
+func PreviewSequenceSchedule(steps []CampaignSequenceStep, enrolledOn time.Time, defaultTZ string) ([]SequenceStepFireTime, error) {
+	year, month, day := enrolledOn.Date()
+	preview := make([]SequenceStepFireTime, 0, len(steps))
+	offset := 0
+	for _, step := range steps {
+		offset += step.EffectiveDelayDays()
+
+		timezone := step.EffectiveTimezone(defaultTZ)
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: unknown timezone %q", step.StepOrder, timezone)
+		}
+		sendAt := step.EffectiveSendAt()
+		clock, err := time.Parse("15:04", sendAt)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: send_at must be HH:MM (24h), got %q", step.StepOrder, sendAt)
+		}
+
+		fireAt := time.Date(year, month, day+offset, clock.Hour(), clock.Minute(), 0, 0, loc)
+		preview = append(preview, SequenceStepFireTime{
+			StepOrder: step.StepOrder,
+			Channel:   step.Channel,
+			DayOffset: offset,
+			SendAt:    sendAt,
+			Timezone:  loc.String(),
+			FireAt:    fireAt,
+			FireAtUTC: fireAt.UTC(),
+		})
+	}
+	return preview, nil
+}
+
+// HasSendingWindows reports whether the schedule restricts sending to windows
+func (d *ScheduleDefinition) HasSendingWindows() bool {
+	return len(d.SendingWindows) > 0
+}
+
+// Location returns the schedule's timezone (UTC when unset)
+func (d *ScheduleDefinition) Location() (*time.Location, error) {
+	if d.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(d.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown schedule timezone %q", d.TimeZone)
+	}
+	return loc, nil
+}
+
+// InSendingWindow reports whether at falls inside one of the schedule's sending
+// windows for that weekday, evaluated in the schedule's timezone. Schedules
+// without windows allow any time.
+func (d *ScheduleDefinition) InSendingWindow(at time.Time) (bool, error) {
+	return d.inSendingWindows(at, true)
+}
+
+// InSendingHours reports whether at's time of day falls inside any of the
+// schedule's sending windows regardless of weekday, evaluated in the
+// schedule's timezone. Schedules without windows allow any time.
+func (d *ScheduleDefinition) InSendingHours(at time.Time) (bool, error) {
+	return d.inSendingWindows(at, false)
+}
+
+func (d *ScheduleDefinition) inSendingWindows(at time.Time, matchWeekday bool) (bool, error) {
+	if !d.HasSendingWindows() {
+		return true, nil
+	}
+	loc, err := d.Location()
+	if err != nil {
+		return false, err
+	}
+	local := at.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	weekday := strings.ToLower(local.Weekday().String())
+
+	for _, window := range d.SendingWindows {
+		if matchWeekday && window.DayOfWeek != "" && !strings.EqualFold(window.DayOfWeek, weekday) {
+			continue
+		}
+		start, errStart := time.Parse("15:04", window.StartTime)
+		end, errEnd := time.Parse("15:04", window.EndTime)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		if minute >= start.Hour()*60+start.Minute() && minute < end.Hour()*60+end.Minute() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
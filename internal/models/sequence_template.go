@@ -3,12 +3,14 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
 // SequenceTemplate represents a reusable sequence template
 type SequenceTemplate struct {
 	TemplateID  string    `json:"id" bson:"_id,omitempty" db:"template_id"`
+	TenantID    string    `json:"tenantId,omitempty" bson:"tenant_id,omitempty" db:"tenant_id"` // Unset on sequences created before tenants were recorded, which belong to the default tenant
 	Name        string    `json:"name" bson:"name" db:"name" validate:"required,min=1,max=200"`
 	Description string    `json:"description,omitempty" bson:"description,omitempty" db:"description"`
 	ServiceID   string    `json:"serviceId,omitempty" bson:"service_id,omitempty" db:"service_id"`
@@ -62,6 +64,7 @@ type CampaignSequenceStep struct {
 	BranchConditions  string                   `json:"branchConditions" bson:"branch_conditions,omitempty" db:"branch_conditions"` // JSON
 	Attachments       []SequenceStepAttachment `json:"attachments,omitempty" bson:"attachments,omitempty" db:"attachments"`        // KOSH documents
 	SendAt            string                   `json:"sendAt" bson:"send_at" db:"send_at"`
+	Timezone          string                   `json:"timezone,omitempty" bson:"timezone,omitempty" db:"timezone"` // IANA name; empty uses the org default
 	SendTime string `json:"sendTime,omitempty" bson:"send_time,omitempty" db:"send_time"`
 	CreatedAt time.Time `json:"createdAt" bson:"created_at" db:"created_at"`
 }
@@ -72,6 +75,14 @@ type SequenceTemplateWithSteps struct {
 	Steps    []CampaignSequenceStep `json:"steps" bson:"steps"`
 }
 
+// SequenceValidationIssue is one problem found when validating a sequence
+// template. StepOrder is 0 for problems with the sequence as a whole
+type SequenceValidationIssue struct {
+	StepOrder int    `json:"stepOrder"`
+	Field     string `json:"field"`
+	Message   string `json:"message"`
+}
+
 // Helper methods
 
 // IsValidSequenceStepChannel checks if the channel is valid
@@ -124,9 +135,35 @@ func (s *CampaignSequenceStep) GetTotalWaitDuration() int {
 	return (s.WaitDays * 24) + s.WaitHours
 }
 
-// ValidateSequenceStepTiming validates that each step has send_at (or send_time) and format HH:MM.
+// EffectiveSendAt returns the step's send time, preferring send_at over the legacy send_time field
+func (s *CampaignSequenceStep) EffectiveSendAt() string {
+	if s.SendAt != "" {
+		return s.SendAt
+	}
+	return s.SendTime
+}
+
+// ValidateSendAtFormat checks that a send time is in 24h HH:MM format
+func ValidateSendAtFormat(sendAt string) bool {
+	_, err := time.Parse("15:04", sendAt)
+	return err == nil && len(sendAt) == 5
+}
+
+// ValidateStepTimezone checks that a step's timezone, when set, is a known IANA name
+func ValidateStepTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", timezone)
+	}
+	return nil
+}
+
+// ValidateSequenceStepTiming validates that each step has send_at (or send_time)
+// in HH:MM format and, when set, a valid IANA timezone.
 func ValidateSequenceStepTiming(steps []CampaignSequenceStep) error {
-	for i, step := range steps {
+	for _, step := range steps {
 		effective := step.EffectiveSendAt()
 		if effective == "" {
 			return fmt.Errorf("step %d: send_at is required (HH:MM)", step.StepOrder)
@@ -134,7 +171,9 @@ func ValidateSequenceStepTiming(steps []CampaignSequenceStep) error {
 		if !ValidateSendAtFormat(effective) {
 			return fmt.Errorf("step %d: send_at must be HH:MM (24h), got %q", step.StepOrder, effective)
 		}
-		_ = i
+		if err := ValidateStepTimezone(step.Timezone); err != nil {
+			return fmt.Errorf("step %d: %w", step.StepOrder, err)
+		}
 	}
 	return nil
 }
@@ -15,6 +15,7 @@ type Session struct {
 	UserAgent    string             `json:"user_agent" bson:"user_agent"`
 	IsRevoked    bool               `json:"is_revoked" bson:"is_revoked"`
 	RevokedAt    *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	LastActivityAt *time.Time       `json:"last_activity_at,omitempty" bson:"last_activity_at,omitempty"` // Recorded at most once a minute; unset on sessions created before it was tracked
 
 }
 
@@ -23,6 +24,46 @@ func (s *Session) IsVaild() bool {
 	return !s.IsRevoked && time.Now().Before(s.ExpiresAt);
 }
 
+// LastActive returns when the session was last used, falling back to when
+// it was issued for sessions that never recorded activity
+func (s *Session) LastActive() time.Time {
+	if s.LastActivityAt != nil {
+		return *s.LastActivityAt
+	}
+	return s.IssuedAt
+}
+
+// IdleExpiresAt returns when the session times out unless it is used again.
+// The absolute expiry still applies, so it is never later than ExpiresAt.
+func (s *Session) IdleExpiresAt(idle time.Duration) time.Time {
+	if idle <= 0 {
+		return s.ExpiresAt
+	}
+	if at := s.LastActive().Add(idle); at.Before(s.ExpiresAt) {
+		return at
+	}
+	return s.ExpiresAt
+}
+
+// IsActiveAt reports whether the session can still be used at now: it is
+// not revoked, not past its absolute expiry and was used within idle. An
+// idle of zero or less disables the inactivity timeout.
+func (s *Session) IsActiveAt(now time.Time, idle time.Duration) bool {
+	return !s.IsRevoked && now.Before(s.IdleExpiresAt(idle))
+}
+
+// SessionInfo describes a session to its owner, without its tokens
+type SessionInfo struct {
+	ID             string    `json:"id"`
+	IPAddress      string    `json:"ipAddress"`
+	UserAgent      string    `json:"userAgent"`
+	IssuedAt       time.Time `json:"issuedAt"`
+	LastActivityAt time.Time `json:"lastActivityAt"`
+	IdleExpiresAt  time.Time `json:"idleExpiresAt"` // When the session times out unless used again
+	ExpiresAt      time.Time `json:"expiresAt"`     // Absolute expiry, however active the session is
+	Current        bool      `json:"current"`       // The session of the token making the request
+}
+
 // TokenPair represents access and refresh tokens
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
@@ -42,24 +42,65 @@ type SettingsEmailSignature struct {
 
 // SettingsUpdateEmailSignatureRequest represents an email signature update request
 type SettingsUpdateEmailSignatureRequest struct {
-	Signature string `json:"signature"`
+	Signature string `json:"signature" validate:"max=10000"` // HTML; scripts, styles and frames are removed
 	Enabled   bool   `json:"enabled"`
 }
 
+// Channels 2FA sign-in codes are sent through
+const (
+	TwoFactorMethodEmail = "email"
+	TwoFactorMethodSMS   = "sms"
+)
+
 // SettingsUserSecuritySettings represents user's security settings
 type SettingsUserSecuritySettings struct {
 	ID                 string             `bson:"_id,omitempty" json:"id"`
 	UserID             string             `bson:"user_id" json:"userId"`
 	TwoFactorEnabled   bool               `bson:"two_factor_enabled" json:"twoFactorEnabled"`
+	TwoFactorMethod    string             `bson:"two_factor_method,omitempty" json:"twoFactorMethod,omitempty"` // email (default) or sms
+	PhoneNumber        string             `bson:"phone_number,omitempty" json:"phoneNumber,omitempty"`          // Verified, in E.164 form
+	PhoneVerifiedAt    *time.Time         `bson:"phone_verified_at,omitempty" json:"phoneVerifiedAt,omitempty"`
+	PhoneVerification  *PhoneVerification `bson:"phone_verification,omitempty" json:"-"` // Pending change of PhoneNumber
 	SessionTimeout     int                `bson:"session_timeout" json:"sessionTimeout"` // minutes
 	LastPasswordChange *time.Time         `bson:"last_password_change,omitempty" json:"lastPasswordChange,omitempty"`
 	UpdatedAt          time.Time          `bson:"updated_at" json:"updatedAt"`
 }
 
+// TwoFactorChannel returns the channel 2FA codes are sent through: sms when
+// chosen and a phone number is verified, email otherwise
+func (s *SettingsUserSecuritySettings) TwoFactorChannel() string {
+	if s.TwoFactorMethod == TwoFactorMethodSMS && s.PhoneNumber != "" {
+		return TwoFactorMethodSMS
+	}
+	return TwoFactorMethodEmail
+}
+
+// PhoneVerification is a code texted to a phone number that becomes the
+// user's once the code is confirmed
+type PhoneVerification struct {
+	PhoneNumber string    `bson:"phone_number"`
+	CodeHash    string    `bson:"code_hash"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+	Attempts    int       `bson:"attempts"` // Wrong codes entered
+}
+
 // SettingsUpdateSecuritySettingsRequest represents a security settings update request
 type SettingsUpdateSecuritySettingsRequest struct {
-	TwoFactorEnabled *bool `json:"twoFactorEnabled,omitempty"`
-	SessionTimeout   *int  `json:"sessionTimeout,omitempty"`
+	TwoFactorEnabled *bool   `json:"twoFactorEnabled,omitempty"`
+	TwoFactorMethod  *string `json:"twoFactorMethod,omitempty" validate:"omitempty,oneof=email sms"` // sms needs a verified phone number
+	SessionTimeout   *int    `json:"sessionTimeout,omitempty" validate:"omitempty,min=1,max=43200"`
+}
+
+// SettingsPhoneNumberRequest starts the verification of a phone number for
+// 2FA codes
+type SettingsPhoneNumberRequest struct {
+	PhoneNumber string `json:"phoneNumber" validate:"required,e164"`
+}
+
+// SettingsVerifyPhoneNumberRequest confirms a phone number with the code
+// texted to it
+type SettingsVerifyPhoneNumberRequest struct {
+	Code string `json:"code" validate:"required,max=10"`
 }
 
 // SettingsChangePasswordRequest represents a password change request
@@ -101,30 +142,60 @@ type SettingsUpdateCommunicationPreferencesRequest struct {
 
 // SettingsCompanyInfo represents company settings
 type SettingsCompanyInfo struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id" diff:"-"`
 	Name      string             `bson:"name" json:"name"`
 	Logo      string             `bson:"logo,omitempty" json:"logo,omitempty"`
 	Industry  string             `bson:"industry,omitempty" json:"industry,omitempty"`
 	Size      string             `bson:"size,omitempty" json:"size,omitempty"`
 	Website   string             `bson:"website,omitempty" json:"website,omitempty"`
 	Address   string             `bson:"address,omitempty" json:"address,omitempty"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updatedAt"`
+	EmailBranding SettingsEmailBranding `bson:"email_branding" json:"emailBranding"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updatedAt" diff:"-"`
+}
+
+// SettingsEmailBranding is the look of the emails the platform sends on its
+// own (sign-in codes, invitations, password resets, weekly reports). Empty
+// fields use the platform defaults.
+type SettingsEmailBranding struct {
+	PrimaryColor string `bson:"primary_color,omitempty" json:"primaryColor" validate:"omitempty,hexcolor"`
+	LogoURL      string `bson:"logo_url,omitempty" json:"logoUrl" validate:"omitempty,https_url,max=2048"`
+	FooterText   string `bson:"footer_text,omitempty" json:"footerText" validate:"max=500"`
+	SupportEmail string `bson:"support_email,omitempty" json:"supportEmail" validate:"omitempty,email,max=254"`
+	Tagline      string `bson:"tagline,omitempty" json:"tagline" validate:"max=300"` // Introduces the product in invitations
 }
 
 // SettingsUpdateCompanyInfoRequest represents a company info update request
 type SettingsUpdateCompanyInfoRequest struct {
-	Name     string `json:"name,omitempty"`
-	Logo     string `json:"logo,omitempty"`
-	Industry string `json:"industry,omitempty"`
-	Size     string `json:"size,omitempty"`
-	Website  string `json:"website,omitempty"`
-	Address  string `json:"address,omitempty"`
+	Name     string `json:"name,omitempty" validate:"max=200"`
+	Logo     string `json:"logo,omitempty" validate:"max=2048"`
+	Industry string `json:"industry,omitempty" validate:"max=100"`
+	Size     string `json:"size,omitempty" validate:"max=50"`
+	Website  string `json:"website,omitempty" validate:"max=2048"`
+	Address  string `json:"address,omitempty" validate:"max=500"`
+	// Replaces the whole email branding; empty fields reset to the defaults
+	EmailBranding *SettingsEmailBranding `json:"emailBranding,omitempty"`
+}
+
+// ApplyTo sets the fields of the request on info, ignoring empty ones like
+// the stored update does
+func (req *SettingsUpdateCompanyInfoRequest) ApplyTo(info *SettingsCompanyInfo) {
+	setIfNotEmpty(&info.Name, req.Name)
+	setIfNotEmpty(&info.Logo, req.Logo)
+	setIfNotEmpty(&info.Industry, req.Industry)
+	setIfNotEmpty(&info.Size, req.Size)
+	setIfNotEmpty(&info.Website, req.Website)
+	setIfNotEmpty(&info.Address, req.Address)
+	if req.EmailBranding != nil {
+		info.EmailBranding = *req.EmailBranding
+	}
 }
 
 // SettingsEmailNotificationSettings represents email notification preferences
 type SettingsEmailNotificationSettings struct {
 	TaskReminder    bool `bson:"task_reminder" json:"taskReminder"`
 	WeeklyReport    bool `bson:"weekly_report" json:"weeklyReport"`
+	TemplateApproval bool `bson:"template_approval" json:"templateApproval"` // Templates waiting for the user's approval
+	SecurityAlert    bool `bson:"security_alert" json:"securityAlert"`       // Sign-ins from a new device
 }
 
 // SettingsBrowserNotificationSettings represents browser notification preferences
@@ -140,20 +211,25 @@ type SettingsNotificationSettings struct {
 	UserID               string                  `bson:"user_id" json:"userId"`
 	EmailNotifications   SettingsEmailNotificationSettings   `bson:"email_notifications" json:"emailNotifications"`
 	BrowserNotifications SettingsBrowserNotificationSettings `bson:"browser_notifications" json:"browserNotifications"`
-	UpdatedAt            time.Time                           `bson:"updated_at" json:"updatedAt"`
+	// How often notification emails of one type are sent together: one of
+	// the Digest constants, or empty for the organization's default window.
+	// Security alerts always go out right away.
+	DigestFrequency string    `bson:"digest_frequency,omitempty" json:"digestFrequency,omitempty"`
+	UpdatedAt       time.Time `bson:"updated_at" json:"updatedAt"`
 }
 
 // SettingsUpdateNotificationSettingsRequest represents a notification settings update request
 type SettingsUpdateNotificationSettingsRequest struct {
 	EmailNotifications   *SettingsEmailNotificationSettings   `json:"emailNotifications,omitempty"`
 	BrowserNotifications *SettingsBrowserNotificationSettings `json:"browserNotifications,omitempty"`
+	DigestFrequency      *string                              `json:"digestFrequency,omitempty" validate:"omitempty,oneof=immediate 15m hourly daily"`
 }
 
 // SettingsAuditLog represents an audit log entry for the settings page
 type SettingsAuditLog struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
-	UserID    primitive.ObjectID `bson:"user_id" json:"userId"`
+	UserID    string             `bson:"user_id" json:"userId"`
 	UserName  string             `bson:"user_name" json:"userName"`
 	Action    string             `bson:"action" json:"action"`
 	Resource  string             `bson:"resource" json:"resource"`
@@ -165,68 +241,132 @@ type SettingsAuditLog struct {
 
 // SystemDefaultSettings represents system-wide default settings
 type SystemDefaultSettings struct {
-	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id" diff:"-"`
 	Timezone        string             `bson:"timezone" json:"timezone"`
 	Currency        string             `bson:"currency" json:"currency"`
 	Language        string             `bson:"language" json:"language"`
 	DateFormat      string             `bson:"date_format" json:"dateFormat"`
+	// Messages that are not urgent are only sent from WorkingHoursStart to
+	// WorkingHoursEnd (HH:MM, 24h) on WorkingDays, in Timezone
 	WorkingHoursStart string           `bson:"working_hours_start" json:"workingHoursStart"`
 	WorkingHoursEnd   string           `bson:"working_hours_end" json:"workingHoursEnd"`
-	UpdatedAt       time.Time          `bson:"updated_at" json:"updatedAt"`
+	WorkingDays     []string           `bson:"working_days,omitempty" json:"workingDays"` // Weekday names; Monday to Friday when unset
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updatedAt" diff:"-"`
 }
 
 // UpdateSystemDefaultSettingsRequest represents an update request for system default settings
 type UpdateSystemDefaultSettingsRequest struct {
-	Timezone        string `json:"timezone,omitempty"`
-	Currency        string `json:"currency,omitempty"`
-	Language        string `json:"language,omitempty"`
-	DateFormat      string `json:"dateFormat,omitempty"`
-	WorkingHoursStart string `json:"workingHoursStart,omitempty"`
-	WorkingHoursEnd   string `json:"workingHoursEnd,omitempty"`
+	Timezone        string `json:"timezone,omitempty" validate:"max=64"`
+	Currency        string `json:"currency,omitempty" validate:"max=3"`
+	Language        string `json:"language,omitempty" validate:"max=35"`
+	DateFormat      string `json:"dateFormat,omitempty" validate:"max=32"`
+	WorkingHoursStart string `json:"workingHoursStart,omitempty" validate:"max=5"` // HH:MM, 24h
+	WorkingHoursEnd   string `json:"workingHoursEnd,omitempty" validate:"max=5"`   // HH:MM, 24h
+	// Replaces the working days; at least one weekday name
+	WorkingDays     []string `json:"workingDays,omitempty" validate:"omitempty,max=7,dive,max=9"`
+}
+
+// ApplyTo sets the fields of the request on settings, ignoring empty ones
+// like the stored update does
+func (req *UpdateSystemDefaultSettingsRequest) ApplyTo(settings *SystemDefaultSettings) {
+	setIfNotEmpty(&settings.Timezone, req.Timezone)
+	setIfNotEmpty(&settings.Currency, req.Currency)
+	setIfNotEmpty(&settings.Language, req.Language)
+	setIfNotEmpty(&settings.DateFormat, req.DateFormat)
+	setIfNotEmpty(&settings.WorkingHoursStart, req.WorkingHoursStart)
+	setIfNotEmpty(&settings.WorkingHoursEnd, req.WorkingHoursEnd)
+	if req.WorkingDays != nil {
+		settings.WorkingDays = req.WorkingDays
+	}
 }
 
 // ==================== System Security Settings ====================
 
 // SystemSecuritySettings represents system-wide security settings
 type SystemSecuritySettings struct {
-	ID                     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ID                     primitive.ObjectID `bson:"_id,omitempty" json:"id" diff:"-"`
 	TwoFactorRequired      bool               `bson:"two_factor_required" json:"twoFactorRequired"`
 	MinPasswordLength      int                `bson:"min_password_length" json:"minPasswordLength"`
 	PasswordExpiryDays     int                `bson:"password_expiry_days" json:"passwordExpiryDays"`
 	RequireSpecialChars    bool               `bson:"require_special_chars" json:"requireSpecialChars"`
+	// New passwords may not be one of the user's last PasswordHistoryCount
+	// passwords, the current one included; 0 allows reusing any
+	PasswordHistoryCount   int                `bson:"password_history_count" json:"passwordHistoryCount"`
 	SessionTimeoutMinutes  int                `bson:"session_timeout_minutes" json:"sessionTimeoutMinutes"`
 	IPWhitelist            string             `bson:"ip_whitelist,omitempty" json:"ipWhitelist,omitempty"`
 	SSOEnabled             bool               `bson:"sso_enabled" json:"ssoEnabled"`
-	UpdatedAt              time.Time          `bson:"updated_at" json:"updatedAt"`
+	// SSO sign-ins of unknown verified emails create an account with JITDefaultRole
+	AllowJITProvisioning   bool               `bson:"allow_jit_provisioning" json:"allowJitProvisioning"`
+	JITDefaultRole         string             `bson:"jit_default_role" json:"jitDefaultRole"`
+	// With SSO enabled, only admins may still sign in with a password
+	PasswordLoginDisabled  bool               `bson:"password_login_disabled" json:"passwordLoginDisabled"`
+	// Templates must be approved by a template approver before publishing
+	TemplateApprovalRequired bool             `bson:"template_approval_required" json:"templateApprovalRequired"`
+	// Email templates must contain the {{unsubscribe_url}} placeholder; lint reports it as an error otherwise
+	RequiresUnsubscribe    bool               `bson:"requires_unsubscribe" json:"requiresUnsubscribe"`
+	// Bumped on every update; send it back to update only what was read
+	Version                int                `bson:"version" json:"version" diff:"-"`
+	UpdatedAt              time.Time          `bson:"updated_at" json:"updatedAt" diff:"-"`
 }
 
 // UpdateSystemSecuritySettingsRequest represents an update request for system security settings
 type UpdateSystemSecuritySettingsRequest struct {
 	TwoFactorRequired      *bool   `json:"twoFactorRequired,omitempty"`
-	MinPasswordLength      *int    `json:"minPasswordLength,omitempty"`
-	PasswordExpiryDays     *int    `json:"passwordExpiryDays,omitempty"`
+	MinPasswordLength      *int    `json:"minPasswordLength,omitempty" validate:"omitempty,min=8,max=128"`
+	PasswordExpiryDays     *int    `json:"passwordExpiryDays,omitempty" validate:"omitempty,min=0,max=3650"`
 	RequireSpecialChars    *bool   `json:"requireSpecialChars,omitempty"`
-	SessionTimeoutMinutes  *int    `json:"sessionTimeoutMinutes,omitempty"`
-	IPWhitelist            *string `json:"ipWhitelist,omitempty"`
+	PasswordHistoryCount   *int    `json:"passwordHistoryCount,omitempty" validate:"omitempty,min=0,max=10"`
+	SessionTimeoutMinutes  *int    `json:"sessionTimeoutMinutes,omitempty" validate:"omitempty,min=1,max=43200"`
+	IPWhitelist            *string `json:"ipWhitelist,omitempty" validate:"omitempty,max=4096"`
 	SSOEnabled             *bool   `json:"ssoEnabled,omitempty"`
+	AllowJITProvisioning   *bool   `json:"allowJitProvisioning,omitempty"`
+	JITDefaultRole         *string `json:"jitDefaultRole,omitempty" validate:"omitempty,max=50"`
+	PasswordLoginDisabled  *bool   `json:"passwordLoginDisabled,omitempty"`
+	TemplateApprovalRequired *bool `json:"templateApprovalRequired,omitempty"`
+	RequiresUnsubscribe    *bool   `json:"requiresUnsubscribe,omitempty"`
+	// Version last read; the update is refused if the settings changed since
+	Version                *int    `json:"version,omitempty" validate:"omitempty,min=0"`
+}
+
+// ApplyTo sets the fields present in the request on settings
+func (req *UpdateSystemSecuritySettingsRequest) ApplyTo(settings *SystemSecuritySettings) {
+	setIfPresent(&settings.TwoFactorRequired, req.TwoFactorRequired)
+	setIfPresent(&settings.MinPasswordLength, req.MinPasswordLength)
+	setIfPresent(&settings.PasswordExpiryDays, req.PasswordExpiryDays)
+	setIfPresent(&settings.RequireSpecialChars, req.RequireSpecialChars)
+	setIfPresent(&settings.PasswordHistoryCount, req.PasswordHistoryCount)
+	setIfPresent(&settings.SessionTimeoutMinutes, req.SessionTimeoutMinutes)
+	setIfPresent(&settings.IPWhitelist, req.IPWhitelist)
+	setIfPresent(&settings.SSOEnabled, req.SSOEnabled)
+	setIfPresent(&settings.AllowJITProvisioning, req.AllowJITProvisioning)
+	setIfPresent(&settings.JITDefaultRole, req.JITDefaultRole)
+	setIfPresent(&settings.PasswordLoginDisabled, req.PasswordLoginDisabled)
+	setIfPresent(&settings.TemplateApprovalRequired, req.TemplateApprovalRequired)
+	setIfPresent(&settings.RequiresUnsubscribe, req.RequiresUnsubscribe)
 }
 
 // ==================== Data & Privacy Settings ====================
 
 // DataPrivacySettings represents system-wide data and privacy settings
 type DataPrivacySettings struct {
-	ID                     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ID                     primitive.ObjectID `bson:"_id,omitempty" json:"id" diff:"-"`
 	DataRetentionDays      int                `bson:"data_retention_days" json:"dataRetentionDays"`
 	AutomaticDataCleanup   bool               `bson:"automatic_data_cleanup" json:"automaticDataCleanup"`
-	UpdatedAt              time.Time          `bson:"updated_at" json:"updatedAt"`
+	UpdatedAt              time.Time          `bson:"updated_at" json:"updatedAt" diff:"-"`
 }
 
 // UpdateDataPrivacySettingsRequest represents an update request for data privacy settings
 type UpdateDataPrivacySettingsRequest struct {
-	DataRetentionDays    *int  `json:"dataRetentionDays,omitempty"`
+	DataRetentionDays    *int  `json:"dataRetentionDays,omitempty" validate:"omitempty,min=1,max=3650"`
 	AutomaticDataCleanup *bool `json:"automaticDataCleanup,omitempty"`
 }
 
+// ApplyTo sets the fields present in the request on settings
+func (req *UpdateDataPrivacySettingsRequest) ApplyTo(settings *DataPrivacySettings) {
+	setIfPresent(&settings.DataRetentionDays, req.DataRetentionDays)
+	setIfPresent(&settings.AutomaticDataCleanup, req.AutomaticDataCleanup)
+}
+
 // ==================== System Email & Notification Settings ====================
 
 // SystemEmailNotificationSettings represents system-wide email and notification settings
@@ -234,13 +374,38 @@ type SystemEmailNotificationSettings struct {
 	ID                      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	SystemNotificationEmail string             `bson:"system_notification_email" json:"systemNotificationEmail"`
 	WeeklyReportSchedule    string             `bson:"weekly_report_schedule" json:"weeklyReportSchedule"`
-	EmailSendLimitAlertPercent int             `bson:"email_send_limit_alert_percent" json:"emailSendLimitAlertPercent"`
+	EmailSendLimitAlertPercent int             `bson:"email_send_limit_alert_percent" json:"emailSendLimitAlertPercent"` // Alert the system notification email at this share of a send limit; 0 turns alerts off
+	DailySendLimit          int64              `bson:"daily_send_limit" json:"dailySendLimit"`     // Outbound emails per UTC day; 0 means no limit
+	MonthlySendLimit        int64              `bson:"monthly_send_limit" json:"monthlySendLimit"` // Outbound emails per UTC calendar month; 0 means no limit
 	UpdatedAt               time.Time          `bson:"updated_at" json:"updatedAt"`
 }
 
 // UpdateSystemEmailNotificationSettingsRequest represents an update request for system email notification settings
 type UpdateSystemEmailNotificationSettingsRequest struct {
-	SystemNotificationEmail    *string `json:"systemNotificationEmail,omitempty"`
-	WeeklyReportSchedule       *string `json:"weeklyReportSchedule,omitempty"`
-	EmailSendLimitAlertPercent *int    `json:"emailSendLimitAlertPercent,omitempty"`
+	SystemNotificationEmail    *string `json:"systemNotificationEmail,omitempty" validate:"omitempty,max=254"` // Empty turns system notifications off
+	WeeklyReportSchedule       *string `json:"weeklyReportSchedule,omitempty" validate:"omitempty,max=16"` // A weekday name; empty turns weekly reports off
+	EmailSendLimitAlertPercent *int    `json:"emailSendLimitAlertPercent,omitempty" validate:"omitempty,min=0,max=100"`
+	DailySendLimit             *int64  `json:"dailySendLimit,omitempty" validate:"omitempty,min=0"`   // 0 for no limit
+	MonthlySendLimit           *int64  `json:"monthlySendLimit,omitempty" validate:"omitempty,min=0"` // 0 for no limit
+}
+
+// SettingsFieldChange is the value of a settings field before and after an
+// update
+type SettingsFieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// setIfNotEmpty sets *dst to value unless value is empty
+func setIfNotEmpty(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+// setIfPresent sets *dst to *value when value is set
+func setIfPresent[T any](dst *T, value *T) {
+	if value != nil {
+		*dst = *value
+	}
 }
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SSOState is the server-side half of an SSO sign-in in progress. It is
+// created when the user is sent to the identity provider and consumed by the
+// callback, so each state can be used once.
+// Collection: sso_states
+type SSOState struct {
+	ID           string    `bson:"_id" json:"-"`           // State parameter sent to the provider
+	Nonce        string    `bson:"nonce" json:"-"`         // Expected in the ID token
+	CodeVerifier string    `bson:"code_verifier" json:"-"` // PKCE verifier for the code exchange
+	CreatedAt    time.Time `bson:"created_at" json:"-"`
+	ExpiresAt    time.Time `bson:"expires_at" json:"-"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,6 +30,9 @@ type MongoTemplate struct {
 	Subject      string            `bson:"subject,omitempty" json:"subject,omitempty"`     // Convenience field for email
 	Body         string            `bson:"body,omitempty" json:"message,omitempty"`        // Main body content, JSON as "message" for frontend
 	Variables    []string          `bson:"variables,omitempty" json:"variables,omitempty"` // Extracted merge tags
+	// Type, requirement and default of each merge tag; seeded from the
+	// content, every tag an optional string until edited
+	VariablesSchema []TemplateVariable `bson:"variables_schema,omitempty" json:"variablesSchema,omitempty"`
 	CustomFields map[string]string `bson:"custom_fields,omitempty" json:"customFields,omitempty"`
 
 	// Organization
@@ -38,6 +42,8 @@ type MongoTemplate struct {
 	// Versioning & System
 	Version  int  `bson:"version,omitempty" json:"version,omitempty"`
 	IsSystem bool `bson:"is_system,omitempty" json:"isSystem,omitempty"` // System templates cannot be deleted
+	// Key of the system email a system template overrides, e.g. system.2fa_otp
+	SystemKey string `bson:"system_key,omitempty" json:"systemKey,omitempty"`
 
 	// Timestamps
 	CreatedAt   time.Time  `bson:"created_at" json:"createdAt"`
@@ -46,6 +52,13 @@ type MongoTemplate struct {
 	PublishedAt *time.Time `bson:"published_at,omitempty" json:"publishedAt,omitempty"`
 	PublishedBy string     `bson:"published_by,omitempty" json:"publishedBy,omitempty"`
 
+	// Soft delete - deleted templates stay in the trash until restored or purged
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy string     `bson:"deleted_by,omitempty" json:"deletedBy,omitempty"`
+
+	// Usage summary from template_stats, filled in listings only
+	Usage *TemplateUsage `bson:"-" json:"usage,omitempty"`
+
 	// Frontend filter fields
 	ForStage     []string `bson:"for_stage,omitempty" json:"forStage,omitempty"`         // Funnel stages (prospect, mql, sql, etc.)
 	Industries   []string `bson:"industries,omitempty" json:"industries,omitempty"`      // Industry targeting
@@ -53,6 +66,10 @@ type MongoTemplate struct {
 	AiEnhanced   bool     `bson:"ai_enhanced,omitempty" json:"aiEnhanced,omitempty"`     // AI-generated content
 	ServiceID    string   `bson:"service_id,omitempty" json:"serviceId,omitempty"`       // Reference to services collection
 
+	// Review before publishing; ApprovalStatus stays empty until first submitted
+	ApprovalStatus string             `bson:"approval_status,omitempty" json:"approvalStatus,omitempty"` // pending, approved, rejected
+	Approvals      []TemplateApproval `bson:"approvals,omitempty" json:"approvals,omitempty"`            // Review history, oldest first
+
 	// WhatsApp Meta approval fields
 	MetaTemplateName string     `bson:"meta_template_name,omitempty" json:"metaTemplateName,omitempty"`
 	MetaStatus       string     `bson:"meta_status,omitempty" json:"metaStatus,omitempty"` // approved, pending, rejected
@@ -88,6 +105,9 @@ func (t *MongoTemplate) Validate() error {
 	if !IsValidTemplateStatus(t.Status) {
 		return fmt.Errorf("invalid status: %s", t.Status)
 	}
+	if err := t.validateVariablesSchema(); err != nil {
+		return err
+	}
 
 	// Build content map from fields if not set
 	if t.Content == nil {
@@ -164,6 +184,36 @@ func (t *MongoTemplate) CanPublish() bool {
 	return t.Status == string(TemplateStatusDraft) && t.Validate() == nil
 }
 
+// ValidateForPublish runs Validate plus the channel-specific requirements
+// that only apply once a template goes live
+func (t *MongoTemplate) ValidateForPublish() error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	switch t.Channel {
+	case string(TemplateChannelEmail):
+		if t.Content["subject"] == "" && t.Subject == "" {
+			return errors.New("email template requires subject")
+		}
+	case string(TemplateChannelWhatsApp):
+		if t.MetaTemplateName == "" {
+			return errors.New("WhatsApp template requires metaTemplateName")
+		}
+	}
+
+	if names := t.unsendableVariables(); len(names) > 0 {
+		return fmt.Errorf("required variables need a default or an example: %s", strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// IsPublished reports whether the template is live (published or active)
+func (t *MongoTemplate) IsPublished() bool {
+	return t.Status == string(TemplateStatusPublished) || t.Status == string(TemplateStatusActive)
+}
+
 // CanUnpublish checks if the template can be unpublished
 func (t *MongoTemplate) CanUnpublish() bool {
 	return t.Status == string(TemplateStatusPublished) || t.Status == string(TemplateStatusActive)
@@ -179,6 +229,70 @@ func (t *MongoTemplate) CanDelete() bool {
 	return !t.IsSystem
 }
 
+// Duplicate returns a deep copy of the template as a new draft owned by createdBy.
+// Content, custom fields, tags and channel-specific fields are copied; publication,
+// review and Meta approval state and system flags are reset.
+func (t *MongoTemplate) Duplicate(id, tenantID, name, createdBy string, now time.Time) *MongoTemplate {
+	return &MongoTemplate{
+		ID:           id,
+		TenantID:     tenantID,
+		Name:         name,
+		Description:  t.Description,
+		Type:         t.Type,
+		Channel:      t.Channel,
+		Status:       string(TemplateStatusDraft),
+		Content:      copyStringMap(t.Content),
+		Subject:      t.Subject,
+		Body:         t.Body,
+		Variables:    copyStrings(t.Variables),
+		CustomFields: copyStringMap(t.CustomFields),
+
+		VariablesSchema: copyVariables(t.VariablesSchema),
+		Category:     t.Category,
+		Tags:         copyStrings(t.Tags),
+		Version:      1,
+		IsSystem:     false,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		CreatedBy:    createdBy,
+
+		ForStage:     copyStrings(t.ForStage),
+		Industries:   copyStrings(t.Industries),
+		ApprovalFlag: t.ApprovalFlag,
+		AiEnhanced:   t.AiEnhanced,
+		ServiceID:    t.ServiceID,
+
+		MetaTemplateName: t.MetaTemplateName,
+		TemplateType:     t.TemplateType,
+		KoshDocumentIds:  copyStrings(t.KoshDocumentIds),
+	}
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
+
+func copyVariables(v []TemplateVariable) []TemplateVariable {
+	if v == nil {
+		return nil
+	}
+	return append([]TemplateVariable(nil), v...)
+}
+
 // =============================================================================
 // Merge Tag Methods
 // =============================================================================
@@ -227,10 +341,14 @@ func (t *MongoTemplate) extractTagsFromString(value string, tags map[string]bool
 	}
 }
 
-// ValidateMergeTags returns warnings for undefined merge tags
+// ValidateMergeTags returns warnings for merge tags that may be left
+// unresolved when the template is sent: tags that are neither standard
+// tags, custom fields nor declared variables, and declared variables that
+// are optional and have no default
 func (t *MongoTemplate) ValidateMergeTags() []string {
 	warnings := []string{}
 	extractedTags := t.ExtractMergeTags()
+	sort.Strings(extractedTags)
 
 	standardTagsMap := make(map[string]bool)
 	for _, tag := range StandardMergeTags {
@@ -248,6 +366,13 @@ func (t *MongoTemplate) ValidateMergeTags() []string {
 			}
 		}
 
+		if variable, ok := t.Variable(tag); ok {
+			if !variable.Guaranteed() {
+				warnings = append(warnings, fmt.Sprintf("merge tag '{{%s}}' is optional and has no default", tag))
+			}
+			continue
+		}
+
 		warnings = append(warnings, fmt.Sprintf("merge tag '{{%s}}' is not defined", tag))
 	}
 
@@ -278,6 +403,11 @@ func (t *MongoTemplate) RemoveTag(tag string) {
 	}
 }
 
+// IsDeleted reports whether the template is in the trash
+func (t *MongoTemplate) IsDeleted() bool {
+	return t.DeletedAt != nil
+}
+
 // HasTag checks if the template has a specific tag
 func (t *MongoTemplate) HasTag(tag string) bool {
 	for _, existingTag := range t.Tags {
@@ -288,6 +418,24 @@ func (t *MongoTemplate) HasTag(tag string) bool {
 	return false
 }
 
+// NormalizeTags trims tag names and drops empty and duplicate tags, keeping order
+func NormalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
 // AddVariable adds a variable to the template's variable list
 func (t *MongoTemplate) AddVariable(variable string) {
 	for _, v := range t.Variables {
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// TemplateApprovalStatus is where a template is in the review cycle. A
+// template that was never submitted has no approval status.
+type TemplateApprovalStatus string
+
+const (
+	TemplateApprovalPending  TemplateApprovalStatus = "pending"
+	TemplateApprovalApproved TemplateApprovalStatus = "approved"
+	TemplateApprovalRejected TemplateApprovalStatus = "rejected"
+)
+
+// TemplateApprovalAction is a step recorded in a template's review history
+type TemplateApprovalAction string
+
+const (
+	TemplateApprovalSubmitted TemplateApprovalAction = "submitted"
+	TemplateApprovalApprove   TemplateApprovalAction = "approved"
+	TemplateApprovalReject    TemplateApprovalAction = "rejected"
+	TemplateApprovalReset     TemplateApprovalAction = "reset" // Edited while pending or approved
+)
+
+// TemplateApproval is one entry of a template's review history
+type TemplateApproval struct {
+	Action  TemplateApprovalAction `bson:"action" json:"action"`
+	ActorID string                 `bson:"actor_id" json:"actorId"`
+	Comment string                 `bson:"comment,omitempty" json:"comment,omitempty"`
+	At      time.Time              `bson:"at" json:"at"`
+}
+
+// TemplateApprovalRequest is the body of the submit, approve and reject endpoints
+type TemplateApprovalRequest struct {
+	Comment string `json:"comment" validate:"max=2000"`
+}
+
+// Review cycle transition errors
+var (
+	ErrApprovalAlreadyPending  = errors.New("template is already pending approval")
+	ErrApprovalAlreadyApproved = errors.New("template is already approved")
+	ErrApprovalNotPending      = errors.New("template has not been submitted for approval")
+	ErrApprovalNotDraft        = errors.New("only draft templates can be submitted for approval")
+)
+
+// IsTemplateApprovalStatus checks if s is a review cycle status
+func IsTemplateApprovalStatus(s string) bool {
+	switch TemplateApprovalStatus(s) {
+	case TemplateApprovalPending, TemplateApprovalApproved, TemplateApprovalRejected:
+		return true
+	}
+	return false
+}
+
+// CanSubmitForApproval checks that the template is a draft that is neither
+// pending nor already approved. Rejected templates may be resubmitted.
+func (t *MongoTemplate) CanSubmitForApproval() error {
+	switch TemplateApprovalStatus(t.ApprovalStatus) {
+	case TemplateApprovalPending:
+		return ErrApprovalAlreadyPending
+	case TemplateApprovalApproved:
+		return ErrApprovalAlreadyApproved
+	}
+	if t.Status != string(TemplateStatusDraft) {
+		return ErrApprovalNotDraft
+	}
+	return nil
+}
+
+// CanReview checks that the template is waiting for an approver
+func (t *MongoTemplate) CanReview() error {
+	if TemplateApprovalStatus(t.ApprovalStatus) != TemplateApprovalPending {
+		return ErrApprovalNotPending
+	}
+	return nil
+}
+
+// IsApproved reports whether the current content of the template was approved
+func (t *MongoTemplate) IsApproved() bool {
+	return TemplateApprovalStatus(t.ApprovalStatus) == TemplateApprovalApproved
+}
+
+// ApprovalResetOnEdit reports whether editing the template withdraws it from
+// review: a pending or approved decision no longer covers the new content
+func (t *MongoTemplate) ApprovalResetOnEdit() bool {
+	switch TemplateApprovalStatus(t.ApprovalStatus) {
+	case TemplateApprovalPending, TemplateApprovalApproved:
+		return true
+	}
+	return false
+}
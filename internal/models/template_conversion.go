@@ -0,0 +1,8 @@
+package models
+
+// TemplateConversionResult is a template converted to another channel, with
+// what the conversion had to change to fit it
+type TemplateConversionResult struct {
+	Template *MongoTemplate `json:"template"` // The new draft on the target channel
+	Warnings []string       `json:"warnings"` // Adaptations made, e.g. content truncated or subject discarded
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,24 +11,24 @@ import (
 // CreateTemplateRequest represents a request to create a new template
 type CreateTemplateRequest struct {
 	Name         string            `json:"name" validate:"required,min=1,max=200"`
-	Description  string            `json:"description,omitempty"`
+	Description  string            `json:"description,omitempty" validate:"max=2000"`
 	Channel      string            `json:"channel" validate:"required,oneof=email sms whatsapp linkedin"`
 	Content      map[string]string `json:"content,omitempty"`
 	CustomFields map[string]string `json:"customFields,omitempty"`
-	Tags         []string          `json:"tags,omitempty"`
+	Tags         []string          `json:"tags,omitempty" validate:"max=50,dive,required,max=50"`
 	// Frontend-compatible fields (camelCase)
-	ForStage     []string `json:"forStage,omitempty"`     // Funnel stages
-	Industries   []string `json:"industries,omitempty"`   // Industry targeting 
-	ApprovalFlag string   `json:"approvalFlag,omitempty"` // green, yellow, red
-	AiEnhanced   bool     `json:"aiEnhanced,omitempty"`   // AI-generated flag
-	ServiceID    string   `json:"serviceId,omitempty"`    // ObjectID reference to services collection
+	ForStage     []string `json:"forStage,omitempty"`                                                 // Funnel stages
+	Industries   []string `json:"industries,omitempty"`                                               // Industry targeting
+	ApprovalFlag string   `json:"approvalFlag,omitempty" validate:"omitempty,oneof=green yellow red"` // green, yellow, red
+	AiEnhanced   bool     `json:"aiEnhanced,omitempty"`                                               // AI-generated flag
+	ServiceID    string   `json:"serviceId,omitempty"`                                                // ObjectID reference to services collection
 	// Channel-specific (camelCase)
-	Subject          string `json:"subject,omitempty"`          // Email subject (convenience field)
-	Message          string `json:"message,omitempty"`          // Message body (convenience field)
-	TemplateType     string `json:"type,omitempty"`             // LinkedIn: Connection Request, InMail Message
-	MetaTemplateName string `json:"metaTemplateName,omitempty"` // WhatsApp Meta template name
-	Category         string `json:"category,omitempty"`         // WhatsApp category
-	Language         string `json:"language,omitempty"`         // WhatsApp language
+	Subject          string `json:"subject,omitempty" validate:"max=998"` // Email subject (convenience field)
+	Message          string `json:"message,omitempty"`                    // Message body (convenience field)
+	TemplateType     string `json:"type,omitempty"`                       // LinkedIn: Connection Request, InMail Message
+	MetaTemplateName string `json:"metaTemplateName,omitempty"`           // WhatsApp Meta template name
+	Category         string `json:"category,omitempty"`                   // WhatsApp category
+	Language         string `json:"language,omitempty"`                   // WhatsApp language
 	// Status
 	Status string `json:"status,omitempty"`
 }
@@ -34,18 +36,18 @@ type CreateTemplateRequest struct {
 // UpdateTemplateRequest represents a request to update an existing template
 type UpdateTemplateRequest struct {
 	Name         string            `json:"name,omitempty" validate:"omitempty,min=1,max=200"`
-	Description  string            `json:"description,omitempty"`
+	Description  string            `json:"description,omitempty" validate:"max=2000"`
 	Content      map[string]string `json:"content,omitempty"`
 	CustomFields map[string]string `json:"customFields,omitempty"`
-	Tags         []string          `json:"tags,omitempty"`
+	Tags         []string          `json:"tags,omitempty" validate:"max=50,dive,required,max=50"`
 	// Frontend-compatible fields (camelCase)
 	ForStage     []string `json:"forStage,omitempty"`
 	Industries   []string `json:"industries,omitempty"`
-	ApprovalFlag string   `json:"approvalFlag,omitempty"`
+	ApprovalFlag string   `json:"approvalFlag,omitempty" validate:"omitempty,oneof=green yellow red"`
 	AiEnhanced   *bool    `json:"aiEnhanced,omitempty"` // Pointer to distinguish unset from false
 	ServiceID    string   `json:"serviceId,omitempty"`  // ObjectID reference to services collection
 	// Channel-specific (camelCase)
-	Subject          string `json:"subject,omitempty"`
+	Subject          string `json:"subject,omitempty" validate:"max=998"`
 	Message          string `json:"message,omitempty"`
 	TemplateType     string `json:"type,omitempty"`
 	MetaTemplateName string `json:"metaTemplateName,omitempty"`
@@ -53,8 +55,176 @@ type UpdateTemplateRequest struct {
 	Language         string `json:"language,omitempty"`
 	// Status
 	Status string `json:"status,omitempty"`
+	// Version last read; the update is refused with 409 if the template
+	// changed since. The If-Match header can carry it instead.
+	Version *int `json:"version,omitempty" validate:"omitempty,min=0"`
+	// Replaces the variables schema when sent
+	VariablesSchema []TemplateVariable `json:"variablesSchema,omitempty" validate:"omitempty,max=200,dive"`
 }
 
+// PublishTemplateRequest represents the optional body of a publish request
+type PublishTemplateRequest struct {
+	Force bool `json:"force,omitempty"` // Publish even if merge tags are unresolved
+	// Refuse to publish while the template has lint errors, such as broken
+	// links. Checking the links makes the publish slower.
+	RequireCleanLint bool `json:"requireCleanLint,omitempty"`
+}
+
+// DuplicateTemplateRequest represents the optional body of a duplicate request
+type DuplicateTemplateRequest struct {
+	Name string `json:"name,omitempty" validate:"max=200"` // Defaults to "<source name> (copy)"
+}
+
+// PreviewVariable is a merge tag value supplied for a preview.
+// It accepts either a plain JSON value ("Jane", 42) or {"value": "<b>x</b>", "raw": true};
+// raw values are injected into HTML bodies without escaping.
+type PreviewVariable struct {
+	Value string `json:"value"`
+	Raw   bool   `json:"raw,omitempty"`
+}
+
+// UnmarshalJSON accepts both the plain and the object form
+func (v *PreviewVariable) UnmarshalJSON(data []byte) error {
+	var obj struct {
+		Value interface{} `json:"value"`
+		Raw   bool        `json:"raw"`
+	}
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		v.Value, v.Raw = previewValueString(obj.Value), obj.Raw
+		return nil
+	}
+
+	var plain interface{}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return err
+	}
+	if _, isList := plain.([]interface{}); isList {
+		return fmt.Errorf("variable value must be a string, number, boolean or {value, raw} object")
+	}
+	v.Value, v.Raw = previewValueString(plain), false
+	return nil
+}
+
+func previewValueString(value interface{}) string {
+	switch val := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// TemplatePreviewRequest represents a request to render a saved template
+type TemplatePreviewRequest struct {
+	Variables map[string]PreviewVariable `json:"variables"`
+	Channel   string                     `json:"channel,omitempty" validate:"omitempty,oneof=email sms whatsapp linkedin"` // Optional channel override
+}
+
+// DraftTemplatePreviewRequest represents a request to render an unsaved template
+type DraftTemplatePreviewRequest struct {
+	Template  CreateTemplateRequest      `json:"template" validate:"-"` // Drafts may still lack a name
+	Variables map[string]PreviewVariable `json:"variables"`
+	Channel   string                     `json:"channel,omitempty" validate:"omitempty,oneof=email sms whatsapp linkedin"` // Optional channel override
+}
+
+// TemplatePreviewResponse is the rendered output of a template preview
+type TemplatePreviewResponse struct {
+	Channel         string   `json:"channel"`
+	Subject         string   `json:"subject,omitempty"`
+	PreHeader       string   `json:"preHeader,omitempty"`
+	Body            string   `json:"body"`               // body_html for email, body for other channels
+	BodyText        string   `json:"bodyText,omitempty"` // Plain-text alternative (email)
+	MissingTags     []string `json:"missingTags"`        // Tags in the template with no value supplied
+	UnusedVariables []string `json:"unusedVariables"`    // Supplied keys that matched no tag
+	Warnings        []string `json:"warnings,omitempty"` // Values that do not fit their variable's type
+	CharacterCount  int      `json:"characterCount,omitempty"`
+	SegmentCount    int      `json:"segmentCount,omitempty"`
+	Encoding        string   `json:"encoding,omitempty"` // SMS: GSM-7 or UCS-2
+}
+
+// SendTestTemplateRequest represents a request to send a rendered template to test recipients
+type SendTestTemplateRequest struct {
+	To        []string                   `json:"to"`
+	Variables map[string]PreviewVariable `json:"variables"`
+}
+
+// Test send delivery outcomes
+const (
+	TestSendDeliverySent          = "sent"           // SMTP accepted the message
+	TestSendDeliveryNotConfigured = "not_configured" // No SMTP client; the message was only stored
+	TestSendDeliveryFailed        = "failed"         // SMTP rejected the message
+)
+
+// SendTestTemplateResponse reports the outcome of a template test send
+type SendTestTemplateResponse struct {
+	MessageID       string   `json:"messageId"`
+	To              []string `json:"to"`
+	Subject         string   `json:"subject"`
+	Delivered       bool     `json:"delivered"`      // True only when SMTP accepted the message
+	DeliveryStatus  string   `json:"deliveryStatus"` // sent, not_configured, failed
+	Error           string   `json:"error,omitempty"`
+	MissingTags     []string `json:"missingTags"`
+	UnusedVariables []string `json:"unusedVariables"`
+	Warnings        []string `json:"warnings,omitempty"` // Values that do not fit their variable's type
+}
+
+// TemplateTagCount is a tag with the number of templates using it
+type TemplateTagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// RenameTemplateTagRequest represents a request to rename a tag across templates
+type RenameTemplateTagRequest struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+// Bulk template actions
+const (
+	BulkTemplateActionDelete     = "delete"
+	BulkTemplateActionAddTags    = "add_tags"
+	BulkTemplateActionRemoveTags = "remove_tags"
+	BulkTemplateActionSetStatus  = "set_status"
+)
+
+// MaxBulkTemplateIDs is the largest batch accepted by the bulk endpoint
+const MaxBulkTemplateIDs = 200
+
+// BulkTemplateRequest represents one action applied to many templates
+type BulkTemplateRequest struct {
+	IDs    []string `json:"ids" validate:"required,max=200"` // Malformed IDs are reported per ID
+	Action string   `json:"action" validate:"required,oneof=delete add_tags remove_tags set_status"`
+	Tags   []string `json:"tags,omitempty"`   // add_tags / remove_tags
+	Status string   `json:"status,omitempty"` // set_status
+}
+
+// Per-ID outcomes of a bulk operation
+const (
+	BulkResultOK      = "ok"
+	BulkResultSkipped = "skipped"
+	BulkResultError   = "error"
+)
+
+// BulkTemplateResult is the outcome of a bulk action for one template
+type BulkTemplateResult struct {
+	ID     string `json:"id"`
+	Result string `json:"result"` // ok, skipped, error
+	Reason string `json:"reason,omitempty"`
+}
+
+// BulkTemplateResponse reports the outcome of a bulk template operation
+type BulkTemplateResponse struct {
+	Action    string               `json:"action"`
+	Succeeded int                  `json:"succeeded"`
+	Skipped   int                  `json:"skipped"`
+	Failed    int                  `json:"failed"`
+	Results   []BulkTemplateResult `json:"results"`
+}
 
 // TemplateChannel represents a communication channel
 type TemplateChannel string
@@ -172,6 +342,7 @@ var StandardMergeTags = []string{
 	"assigned_rep_name",
 	"assigned_rep_email",
 	"custom_field",
+	UnsubscribeMergeTag,
 }
 
 // Channel-specific content field requirements and limits
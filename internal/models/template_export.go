@@ -0,0 +1,130 @@
+package models
+
+import "time"
+
+// TemplateExportSchemaVersion is the version of the template export format.
+// Bump it whenever TemplateExportItem changes incompatibly.
+const TemplateExportSchemaVersion = 1
+
+// TemplateExportDocument is the JSON document produced by template export and
+// accepted by template import
+type TemplateExportDocument struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	ExportedAt    time.Time            `json:"exportedAt"`
+	Templates     []TemplateExportItem `json:"templates"`
+}
+
+// TemplateExportItem is a portable template definition. It carries no tenant,
+// creator, timestamp or environment-specific references (service, KOSH
+// documents, Meta submission state), so it can be imported into any environment.
+type TemplateExportItem struct {
+	Name             string             `json:"name"`
+	Description      string             `json:"description,omitempty"`
+	Type             string             `json:"type,omitempty"`
+	Channel          string             `json:"channel"`
+	Status           string             `json:"status"`
+	Content          map[string]string  `json:"content,omitempty"`
+	Subject          string             `json:"subject,omitempty"`
+	Body             string             `json:"message,omitempty"`
+	CustomFields     map[string]string  `json:"customFields,omitempty"`
+	VariablesSchema  []TemplateVariable `json:"variablesSchema,omitempty"`
+	Category         string             `json:"category,omitempty"`
+	Tags             []string           `json:"tags,omitempty"`
+	ForStage         []string           `json:"forStage,omitempty"`
+	Industries       []string           `json:"industries,omitempty"`
+	ApprovalFlag     string             `json:"approvalFlag,omitempty"`
+	AiEnhanced       bool               `json:"aiEnhanced,omitempty"`
+	MetaTemplateName string             `json:"metaTemplateName,omitempty"`
+	TemplateType     string             `json:"templateType,omitempty"`
+	IsSystem         bool               `json:"isSystem,omitempty"` // Informational; imports are never system templates
+}
+
+// NewTemplateExportItem builds the portable definition of a template
+func NewTemplateExportItem(t *MongoTemplate) TemplateExportItem {
+	return TemplateExportItem{
+		Name:             t.Name,
+		Description:      t.Description,
+		Type:             t.Type,
+		Channel:          t.Channel,
+		Status:           t.Status,
+		Content:          copyStringMap(t.Content),
+		Subject:          t.Subject,
+		Body:             t.Body,
+		CustomFields:     copyStringMap(t.CustomFields),
+		VariablesSchema:  copyVariables(t.VariablesSchema),
+		Category:         t.Category,
+		Tags:             copyStrings(t.Tags),
+		ForStage:         copyStrings(t.ForStage),
+		Industries:       copyStrings(t.Industries),
+		ApprovalFlag:     t.ApprovalFlag,
+		AiEnhanced:       t.AiEnhanced,
+		MetaTemplateName: t.MetaTemplateName,
+		TemplateType:     t.TemplateType,
+		IsSystem:         t.IsSystem,
+	}
+}
+
+// ApplyTo copies the definition onto t, re-extracting merge tags. Identity,
+// ownership and environment-specific fields of t are left untouched, and the
+// result is never a system template.
+func (i *TemplateExportItem) ApplyTo(t *MongoTemplate) {
+	t.Name = i.Name
+	t.Description = i.Description
+	t.Type = i.Type
+	t.Channel = i.Channel
+	t.Status = i.Status
+	t.Content = copyStringMap(i.Content)
+	t.Subject = i.Subject
+	t.Body = i.Body
+	t.CustomFields = copyStringMap(i.CustomFields)
+	t.VariablesSchema = copyVariables(i.VariablesSchema)
+	t.Category = i.Category
+	t.Tags = NormalizeTags(i.Tags)
+	t.ForStage = copyStrings(i.ForStage)
+	t.Industries = copyStrings(i.Industries)
+	t.ApprovalFlag = i.ApprovalFlag
+	t.AiEnhanced = i.AiEnhanced
+	t.MetaTemplateName = i.MetaTemplateName
+	t.TemplateType = i.TemplateType
+	t.IsSystem = false
+
+	if t.Status == "" {
+		t.Status = string(TemplateStatusDraft)
+	}
+	t.Variables = t.ExtractMergeTags()
+	t.SyncVariablesSchema()
+}
+
+// Template import conflict strategies (matched on name within the tenant)
+const (
+	ImportConflictSkip      = "skip"
+	ImportConflictOverwrite = "overwrite"
+	ImportConflictDuplicate = "duplicate"
+)
+
+// Per-template import outcomes
+const (
+	ImportResultCreated     = "created"
+	ImportResultOverwritten = "overwritten"
+	ImportResultSkipped     = "skipped"
+	ImportResultError       = "error"
+)
+
+// TemplateImportResult is the outcome of importing one template
+type TemplateImportResult struct {
+	Index  int    `json:"index"` // Position in the imported document
+	Name   string `json:"name"`  // Name the template was stored under
+	ID     string `json:"id,omitempty"`
+	Result string `json:"result"` // created, overwritten, skipped, error
+	Reason string `json:"reason,omitempty"`
+}
+
+// TemplateImportResponse reports the outcome of a template import
+type TemplateImportResponse struct {
+	Conflict    string                 `json:"conflict"`
+	Created     int                    `json:"created"`
+	Overwritten int                    `json:"overwritten"`
+	Skipped     int                    `json:"skipped"`
+	Failed      int                    `json:"failed"`
+	Results     []TemplateImportResult `json:"results"`
+}
@@ -0,0 +1,60 @@
+package models
+
+// Template lint severities. Only errors can stop a publish, and only when
+// the publish asks for a clean lint.
+const (
+	LintSeverityError   = "error"
+	LintSeverityWarning = "warning"
+	LintSeverityInfo    = "info"
+)
+
+// Template lint rules
+const (
+	LintRuleBrokenLink         = "broken_link"          // A link or image URL did not answer 2xx
+	LintRuleBlockedLink        = "blocked_link"         // A URL points, or redirects, to a private address
+	LintRuleUncheckedLink      = "unchecked_link"       // A URL could not be checked (merge tag, timeout, too many links)
+	LintRuleMissingAlt         = "missing_alt"          // An image has no alt attribute
+	LintRuleMissingPlainText   = "missing_plain_text"   // An HTML email has no body_text alternative
+	LintRuleLowTextRatio       = "low_text_ratio"       // Images outweigh the text
+	LintRuleImageOnly          = "image_only"           // The body is images with next to no text
+	LintRuleUnresolvedMergeTag = "unresolved_merge_tag" // A merge tag is neither standard nor a custom field
+	LintRuleMissingUnsubscribe = "missing_unsubscribe"  // The unsubscribe placeholder is required but missing
+)
+
+// UnsubscribeMergeTag is the placeholder replaced with the recipient's
+// unsubscribe link
+const UnsubscribeMergeTag = "unsubscribe_url"
+
+// LintFinding is one problem found in a template
+type LintFinding struct {
+	Severity string `json:"severity"` // error, warning or info
+	Rule     string `json:"rule"`     // One of the lint rules
+	Message  string `json:"message"`
+	Location string `json:"location"` // Content field, with the line when known
+}
+
+// TemplateLintReport is the result of linting a template. Findings never
+// block saving.
+type TemplateLintReport struct {
+	Findings         []LintFinding `json:"findings"`
+	Errors           int           `json:"errors"`
+	Warnings         int           `json:"warnings"`
+	LinksChecked     int           `json:"linksChecked"`
+	TextToImageRatio *float64      `json:"textToImageRatio,omitempty"` // Share of the body that is text, 0 to 1; absent without images
+}
+
+// Add records a finding and counts it by severity
+func (r *TemplateLintReport) Add(severity, rule, message, location string) {
+	r.Findings = append(r.Findings, LintFinding{Severity: severity, Rule: rule, Message: message, Location: location})
+	switch severity {
+	case LintSeverityError:
+		r.Errors++
+	case LintSeverityWarning:
+		r.Warnings++
+	}
+}
+
+// DraftTemplateLintRequest represents a request to lint an unsaved template
+type DraftTemplateLintRequest struct {
+	Template CreateTemplateRequest `json:"template" validate:"-"` // Drafts may still lack a name
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// TemplateStatsWindowDays is the window of the summarized usage shown in template listings
+const TemplateStatsWindowDays = 30
+
+// Template performance levels accepted by the list filter. They are quartiles
+// of the tenant's sends over the stats window: high is the top quartile, low
+// the bottom quartile (including unused templates) and medium the rest.
+const (
+	TemplatePerformanceHigh   = "high"
+	TemplatePerformanceMedium = "medium"
+	TemplatePerformanceLow    = "low"
+)
+
+// IsValidTemplatePerformance checks if a performance filter value is valid
+func IsValidTemplatePerformance(level string) bool {
+	switch level {
+	case TemplatePerformanceHigh, TemplatePerformanceMedium, TemplatePerformanceLow:
+		return true
+	}
+	return false
+}
+
+// TemplateStatsBucket holds one day of send counters for a template
+// Collection: template_stats
+type TemplateStatsBucket struct {
+	ID         string    `bson:"_id" json:"-"` // tenant_id:template_id:day
+	TenantID   string    `bson:"tenant_id" json:"-"`
+	TemplateID string    `bson:"template_id" json:"-"`
+	Day        string    `bson:"day" json:"day"` // UTC, YYYY-MM-DD
+	Sends      int64     `bson:"sends" json:"sends"`
+	Failures   int64     `bson:"failures" json:"failures"`
+	LastUsedAt time.Time `bson:"last_used_at" json:"-"`
+}
+
+// TemplateStatsDay returns the bucket day (UTC, YYYY-MM-DD) of at
+func TemplateStatsDay(at time.Time) string {
+	return at.UTC().Format("2006-01-02")
+}
+
+// TemplateStatsBucketID returns the ID of a template's bucket for the day of at
+func TemplateStatsBucketID(tenantID, templateID string, at time.Time) string {
+	return tenantID + ":" + templateID + ":" + TemplateStatsDay(at)
+}
+
+// TemplateUsage is the usage summary attached to templates in listings
+type TemplateUsage struct {
+	Sends30d   int64      `json:"sends30d"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// TemplateStats is the response of GET /templates/{id}/stats
+type TemplateStats struct {
+	TemplateID     string                 `json:"templateId"`
+	Sends          int64                  `json:"sends"`    // All time
+	Failures       int64                  `json:"failures"` // All time
+	FailureRate    float64                `json:"failureRate"`
+	WindowDays     int                    `json:"windowDays"`
+	WindowSends    int64                  `json:"windowSends"`
+	WindowFailures int64                  `json:"windowFailures"`
+	LastUsedAt     *time.Time             `json:"lastUsedAt,omitempty"`
+	Daily          []*TemplateStatsBucket `json:"daily"` // Days with sends inside the window, oldest first
+}
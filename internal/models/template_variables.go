@@ -0,0 +1,174 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TemplateVariableType is the kind of value a template variable holds
+type TemplateVariableType string
+
+const (
+	TemplateVariableString TemplateVariableType = "string"
+	TemplateVariableNumber TemplateVariableType = "number"
+	TemplateVariableDate   TemplateVariableType = "date" // 2006-01-02 or RFC 3339
+	TemplateVariableURL    TemplateVariableType = "url"  // Absolute http or https URL
+)
+
+// TemplateVariable describes a merge tag of a template for the people
+// sending it: what it holds, whether they must supply it, and the value
+// used when they do not
+type TemplateVariable struct {
+	Name     string               `bson:"name" json:"name" validate:"required,max=100"`
+	Type     TemplateVariableType `bson:"type" json:"type" validate:"omitempty,oneof=string number date url"` // Defaults to string
+	Required bool                 `bson:"required,omitempty" json:"required,omitempty"`
+	Default  string               `bson:"default,omitempty" json:"default,omitempty" validate:"max=1000"` // Used when no value is supplied
+	Example  string               `bson:"example,omitempty" json:"example,omitempty" validate:"max=1000"` // Shown to senders
+}
+
+// Guaranteed reports whether the variable always has a value when the
+// template is rendered: senders must supply a required one, and a default
+// fills in an optional one
+func (v *TemplateVariable) Guaranteed() bool {
+	return v.Required || v.Default != ""
+}
+
+// IsValidTemplateVariableType reports whether t is a declared variable
+// type; an empty type is taken as string
+func IsValidTemplateVariableType(t TemplateVariableType) bool {
+	switch t {
+	case "", TemplateVariableString, TemplateVariableNumber, TemplateVariableDate, TemplateVariableURL:
+		return true
+	}
+	return false
+}
+
+// Check returns why value does not fit the variable's type, or nil. A
+// variable of an unknown type fits no value.
+func (v *TemplateVariable) Check(value string) error {
+	switch v.Type {
+	case "", TemplateVariableString:
+	case TemplateVariableNumber:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return fmt.Errorf("%s must be a number", v.Name)
+		}
+	case TemplateVariableDate:
+		value = strings.TrimSpace(value)
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				return fmt.Errorf("%s must be a date (YYYY-MM-DD or RFC 3339)", v.Name)
+			}
+		}
+	case TemplateVariableURL:
+		u, err := url.Parse(strings.TrimSpace(value))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL", v.Name)
+		}
+	default:
+		return fmt.Errorf("%s has unknown type %q", v.Name, v.Type)
+	}
+	return nil
+}
+
+// Variable returns the schema entry of a merge tag
+func (t *MongoTemplate) Variable(name string) (*TemplateVariable, bool) {
+	for i := range t.VariablesSchema {
+		if t.VariablesSchema[i].Name == name {
+			return &t.VariablesSchema[i], true
+		}
+	}
+	return nil, false
+}
+
+// SyncVariablesSchema gives every merge tag of the content without a
+// schema entry one, as an optional string, and fills in the type of
+// entries without one. Entries are kept when their tag leaves the content,
+// so an edit that drops a tag and brings it back keeps its settings.
+func (t *MongoTemplate) SyncVariablesSchema() {
+	for i := range t.VariablesSchema {
+		if t.VariablesSchema[i].Type == "" {
+			t.VariablesSchema[i].Type = TemplateVariableString
+		}
+	}
+	tags := t.ExtractMergeTags()
+	slices.Sort(tags)
+	for _, tag := range tags {
+		if _, ok := t.Variable(tag); !ok {
+			t.VariablesSchema = append(t.VariablesSchema, TemplateVariable{Name: tag, Type: TemplateVariableString})
+		}
+	}
+}
+
+// validateVariablesSchema checks that schema entries are unique, of a
+// declared type, and that their defaults and examples fit their types
+func (t *MongoTemplate) validateVariablesSchema() error {
+	seen := make(map[string]bool, len(t.VariablesSchema))
+	for i := range t.VariablesSchema {
+		v := &t.VariablesSchema[i]
+		if seen[v.Name] {
+			return fmt.Errorf("variable %s is declared more than once", v.Name)
+		}
+		seen[v.Name] = true
+		if !IsValidTemplateVariableType(v.Type) {
+			return fmt.Errorf("variable %s has unknown type %q", v.Name, v.Type)
+		}
+		if v.Default != "" {
+			if err := v.Check(v.Default); err != nil {
+				return fmt.Errorf("default of %w", err)
+			}
+		}
+		if v.Example != "" {
+			if err := v.Check(v.Example); err != nil {
+				return fmt.Errorf("example of %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveVariables checks values supplied to render the template against
+// its variables schema. Variables with no value supplied take their
+// default. It returns the values to render with, the required variables
+// still without one, and a warning for each value that does not fit its
+// variable's type.
+func (t *MongoTemplate) ResolveVariables(values map[string]PreviewVariable) (map[string]PreviewVariable, []string, []string) {
+	resolved := make(map[string]PreviewVariable, len(values)+len(t.VariablesSchema))
+	for name, value := range values {
+		resolved[name] = value
+	}
+	missing := []string{}
+	var warnings []string
+	for i := range t.VariablesSchema {
+		v := &t.VariablesSchema[i]
+		value, ok := values[v.Name]
+		switch {
+		case ok:
+			if err := v.Check(value.Value); err != nil {
+				warnings = append(warnings, err.Error())
+			}
+		case v.Default != "":
+			resolved[v.Name] = PreviewVariable{Value: v.Default}
+		case v.Required:
+			missing = append(missing, v.Name)
+		}
+	}
+	slices.Sort(missing)
+	slices.Sort(warnings)
+	return resolved, missing, warnings
+}
+
+// unsendableVariables returns the required variables with neither a default
+// nor an example, which senders are given no hint how to fill
+func (t *MongoTemplate) unsendableVariables() []string {
+	var names []string
+	for _, v := range t.VariablesSchema {
+		if v.Required && v.Default == "" && v.Example == "" {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSyncVariablesSchemaSeedsMergeTags(t *testing.T) {
+	template := &MongoTemplate{
+		Subject: "Hello {{first_name}}",
+		Body:    "Your plan renews on {{renewal_date}}, {{first_name}}",
+		VariablesSchema: []TemplateVariable{
+			{Name: "renewal_date", Type: TemplateVariableDate, Required: true},
+			{Name: "dropped", Default: "kept"},
+		},
+	}
+	template.SyncVariablesSchema()
+
+	want := []TemplateVariable{
+		{Name: "renewal_date", Type: TemplateVariableDate, Required: true},
+		{Name: "dropped", Type: TemplateVariableString, Default: "kept"},
+		{Name: "first_name", Type: TemplateVariableString},
+	}
+	if !slices.Equal(template.VariablesSchema, want) {
+		t.Errorf("schema = %+v, want %+v", template.VariablesSchema, want)
+	}
+
+	// Syncing again changes nothing
+	template.SyncVariablesSchema()
+	if !slices.Equal(template.VariablesSchema, want) {
+		t.Errorf("schema synced twice = %+v, want %+v", template.VariablesSchema, want)
+	}
+}
+
+func TestValidateVariablesSchema(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		schema []TemplateVariable
+		want   string
+	}{
+		{"declared types", []TemplateVariable{{Name: "a"}, {Name: "b", Type: TemplateVariableString}, {Name: "c", Type: TemplateVariableNumber, Default: "4.5"}, {Name: "d", Type: TemplateVariableDate, Example: "2026-03-14"}, {Name: "e", Type: TemplateVariableURL, Default: "https://example.com/x"}}, ""},
+		{"unknown type", []TemplateVariable{{Name: "first_name", Type: "text"}}, `variable first_name has unknown type "text"`},
+		{"duplicate", []TemplateVariable{{Name: "a"}, {Name: "a", Type: TemplateVariableNumber}}, "declared more than once"},
+		{"default of the wrong type", []TemplateVariable{{Name: "n", Type: TemplateVariableNumber, Default: "four"}}, "default of n must be a number"},
+		{"example of the wrong type", []TemplateVariable{{Name: "u", Type: TemplateVariableURL, Example: "ftp://example.com"}}, "example of u must be an http or https URL"},
+	} {
+		template := &MongoTemplate{VariablesSchema: tt.schema}
+		err := template.validateVariablesSchema()
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTemplateVariableCheck(t *testing.T) {
+	for _, tt := range []struct {
+		variable TemplateVariable
+		value    string
+		ok       bool
+	}{
+		{TemplateVariable{Name: "s"}, "anything", true},
+		{TemplateVariable{Name: "s", Type: TemplateVariableString}, "", true},
+		{TemplateVariable{Name: "n", Type: TemplateVariableNumber}, " 12.5 ", true},
+		{TemplateVariable{Name: "n", Type: TemplateVariableNumber}, "twelve", false},
+		{TemplateVariable{Name: "d", Type: TemplateVariableDate}, "2026-03-14", true},
+		{TemplateVariable{Name: "d", Type: TemplateVariableDate}, "2026-03-14T09:30:00Z", true},
+		{TemplateVariable{Name: "d", Type: TemplateVariableDate}, "14/03/2026", false},
+		{TemplateVariable{Name: "u", Type: TemplateVariableURL}, "https://example.com", true},
+		{TemplateVariable{Name: "u", Type: TemplateVariableURL}, "example.com", false},
+		{TemplateVariable{Name: "t", Type: "text"}, "anything", false},
+	} {
+		if err := tt.variable.Check(tt.value); (err == nil) != tt.ok {
+			t.Errorf("%s (%q) Check(%q) = %v, want ok %v", tt.variable.Name, tt.variable.Type, tt.value, err, tt.ok)
+		}
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	template := &MongoTemplate{VariablesSchema: []TemplateVariable{
+		{Name: "first_name", Type: TemplateVariableString, Default: "there"},
+		{Name: "renewal_date", Type: TemplateVariableDate, Required: true},
+		{Name: "seats", Type: TemplateVariableNumber, Required: true},
+		{Name: "plan_url", Type: TemplateVariableURL, Required: true, Default: "https://example.com/plan"},
+		{Name: "nickname", Type: TemplateVariableString},
+	}}
+
+	resolved, missing, warnings := template.ResolveVariables(map[string]PreviewVariable{
+		"seats": {Value: "many"},
+		"extra": {Value: "passed through", Raw: true},
+	})
+
+	// A required variable with a default is filled in, not missing
+	if !slices.Equal(missing, []string{"renewal_date"}) {
+		t.Errorf("missing = %v, want [renewal_date]", missing)
+	}
+	if !slices.Equal(warnings, []string{"seats must be a number"}) {
+		t.Errorf("warnings = %v, want the mistyped seats", warnings)
+	}
+	want := map[string]PreviewVariable{
+		"first_name": {Value: "there"},
+		"plan_url":   {Value: "https://example.com/plan"},
+		"seats":      {Value: "many"},
+		"extra":      {Value: "passed through", Raw: true},
+	}
+	if len(resolved) != len(want) {
+		t.Errorf("resolved = %v, want %v", resolved, want)
+	}
+	for name, value := range want {
+		if resolved[name] != value {
+			t.Errorf("resolved[%s] = %+v, want %+v", name, resolved[name], value)
+		}
+	}
+
+	// Supplied values win over defaults, and nothing is missing once the
+	// required variables are given
+	resolved, missing, warnings = template.ResolveVariables(map[string]PreviewVariable{
+		"first_name":   {Value: "Ana"},
+		"renewal_date": {Value: "2026-03-14"},
+		"seats":        {Value: "5"},
+	})
+	if len(missing) != 0 || len(warnings) != 0 || resolved["first_name"].Value != "Ana" {
+		t.Errorf("resolved %v, missing %v, warnings %v; want Ana and nothing missing", resolved, missing, warnings)
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+// DefaultTenantID is the tenant of users created before tenants were
+// recorded, and of every user of a single-tenant deployment. Access tokens
+// issued without a tenant claim act for it.
+const DefaultTenantID = "00000000-0000-0000-0000-000000000001"
+
+// TenantOf returns the tenant a stored tenant ID stands for: documents
+// written before tenants were recorded carry none and belong to the
+// default tenant
+func TenantOf(tenantID string) string {
+	if tenantID == "" {
+		return DefaultTenantID
+	}
+	return tenantID
+}
+
+// Tenant returns the tenant the user belongs to
+func (u *User) Tenant() string {
+	return TenantOf(u.TenantID)
+}
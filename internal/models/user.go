@@ -5,48 +5,50 @@ import (
 )
 
 
-// MongoUser represents a user in the MongoDB database
+// User is a user account as stored in MongoDB and used throughout the
+// service. API responses use UserProfile instead.
 // Collection: users
-type MongoUser struct {
+type User struct {
 	ID             string                `bson:"_id,omitempty" json:"id"`
+	TenantID       string                `bson:"tenant_id,omitempty" json:"tenantId,omitempty"` // Organization the user belongs to; unset reads as DefaultTenantID
 	Email          string                `bson:"email" json:"email"`
 	PasswordHash   string                `bson:"password_hash" json:"-"` // Never expose in JSON
+	PasswordHistory []string             `bson:"password_history,omitempty" json:"-"` // Hashes of the passwords replaced, newest first; never exposed
 	Name           string                `bson:"name" json:"name"`
+	FirstName      string                `bson:"first_name,omitempty" json:"firstName,omitempty"`
+	LastName       string                `bson:"last_name,omitempty" json:"lastName,omitempty"`
 	Role           UserRole              `bson:"role" json:"role"`
 	Region         string                `bson:"region" json:"region"`
 	Team           string                `bson:"team,omitempty" json:"team,omitempty"`
+	JobTitle       string                `bson:"job_title,omitempty" json:"jobTitle,omitempty"`
+	Phone          string                `bson:"phone,omitempty" json:"phone,omitempty"`          // E.164, e.g. +14155550123
+	ManagerID      string                `bson:"manager_id,omitempty" json:"managerId,omitempty"` // The active user this one reports to
 	Permissions    []string              `bson:"permissions,omitempty" json:"permissions,omitempty"`
-	Preferences    *MongoUserPreferences      `bson:"preferences,omitempty" json:"preferences,omitempty"`
+	RoleIDs        []string              `bson:"role_ids,omitempty" json:"roleIds,omitempty"` // Custom roles held on top of Role, by role ID so renaming a role changes nothing
+	DataScope      *DataScope            `bson:"data_scope,omitempty" json:"dataScope,omitempty"` // Per-user override of the role's data scope
+	Preferences    *MongoUserPreferences `bson:"preferences,omitempty" json:"preferences,omitempty"`
 	EmailSignature string                `bson:"email_signature,omitempty" json:"emailSignature,omitempty"`
 	IsActive       bool                  `bson:"is_active" json:"isActive"`
+	Status         string                `bson:"status,omitempty" json:"status,omitempty"` // invited, active, inactive or deleted; unset reads as active
+	InviteToken    string                `bson:"invite_token,omitempty" json:"-"` // Signup link token of an invited user; never exposed
+	InviteSentAt   *time.Time            `bson:"invite_sent_at,omitempty" json:"-"`
+	InviteExpiry   *time.Time            `bson:"invite_expires_at,omitempty" json:"-"`
+	ActivatedAt    *time.Time            `bson:"activated_at,omitempty" json:"-"` // When an invited user completed signup
 	OTPHash        string                `bson:"otp_hash,omitempty" json:"-"` // Never expose in JSON
 	OTPExpiresAt   *time.Time            `bson:"otp_expires_at,omitempty" json:"-"`
 	CreatedAt      time.Time             `bson:"created_at" json:"createdAt"`
 	UpdatedAt      time.Time             `bson:"updated_at" json:"updatedAt"`
-	LastLoginAt  *time.Time         `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
-
-	IsMasterAdmin     bool       `bson:"is_master_admin" json:"is_master_admin"`
-	MustResetPassword bool       `bson:"must_reset_password" json:"-"`
+	Version        int                   `bson:"version,omitempty" json:"version,omitempty"` // Bumped by team member updates, for optimistic locking
+	LastLoginAt    *time.Time            `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
+	LastSeenAt     *time.Time            `bson:"last_seen_at,omitempty" json:"lastSeenAt,omitempty"` // Last authenticated request, written at most every few minutes
 
-}
-type User struct {
-	ID           string `bson:"_id,omitempty" json:"id"`
-	Email        string             `bson:"email" json:"email"`
-	PasswordHash string             `bson:"password_hash" json:"-"` // Never expose password hash in JSON
-	Name         string             `bson:"name" json:"name"`
-	Role         string             `bson:"role" json:"role"`               // hunting, farming, admin
-	Region       string             `bson:"region" json:"region"`           // north, south, east, west, central
-	Team         string             `bson:"team" json:"team"`               // sales, marketing, support
-	Permissions  []string           `bson:"permissions" json:"permissions"` // Array of permission strings
-	IsActive     bool               `bson:"is_active" json:"is_active"`
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
-	LastLoginAt  *time.Time         `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
-
-	IsMasterAdmin     bool       `bson:"is_master_admin" json:"is_master_admin"`
-	MustResetPassword bool       `bson:"must_reset_password" json:"-"`
+	IsMasterAdmin     bool `bson:"is_master_admin" json:"is_master_admin"`
+	MustResetPassword bool `bson:"must_reset_password" json:"-"`
 }
 
+// MaxPasswordHistory caps the replaced password hashes kept per user, and
+// so the PasswordHistoryCount of the system security settings
+const MaxPasswordHistory = 10
 
 type UserRole string
 
@@ -56,6 +58,7 @@ const (
 	UserRoleManager  UserRole = "manager"   // Team management access
 )
 
+// UserProfile is the user shape returned by the API
 type UserProfile struct {
 	ID          string `bson:"_id,omitempty" json:"id"`
 	Email       string             `bson:"email" json:"email"`
@@ -63,7 +66,14 @@ type UserProfile struct {
 	Role        string             `bson:"role" json:"role"`
 	Region      string             `bson:"region" json:"region"`
 	Team        string             `bson:"team" json:"team"`
+	JobTitle    string             `bson:"job_title,omitempty" json:"jobTitle,omitempty"`
+	Phone       string             `bson:"phone,omitempty" json:"phone,omitempty"`
+	ManagerID   string             `bson:"manager_id,omitempty" json:"managerId,omitempty"`
 	Permissions []string           `bson:"permissions" json:"permissions"`
+	RoleIDs     []string           `bson:"role_ids,omitempty" json:"roleIds,omitempty"`
+	IsActive    bool               `bson:"is_active" json:"isActive"`
+	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
+	LastLoginAt *time.Time         `bson:"last_login_at,omitempty" json:"lastLoginAt,omitempty"`
 }
 
 // IsValidUserRole checks if the user role is valid
@@ -83,7 +93,7 @@ func IsValidUserRole(role string) bool {
 }
 
 // HasPermission checks if the user has a specific permission
-func (u *MongoUser) HasPermission(permission string) bool {
+func (u *User) HasPermission(permission string) bool {
 	// Admin has all permissions
 	if u.Role == UserRoleAdmin {
 		return true
@@ -100,7 +110,7 @@ func (u *MongoUser) HasPermission(permission string) bool {
 }
 
 // IsOTPValid checks if the OTP is still valid (not expired)
-func (u *MongoUser) IsOTPValid() bool {
+func (u *User) IsOTPValid() bool {
 	if u.OTPHash == "" || u.OTPExpiresAt == nil {
 		return false
 	}
@@ -109,7 +119,7 @@ func (u *MongoUser) IsOTPValid() bool {
 }
 
 // SetOTP sets the OTP hash and expiry time (10 minutes from now)
-func (u *MongoUser) SetOTP(hash string) {
+func (u *User) SetOTP(hash string) {
 	u.OTPHash = hash
 	expiryTime := time.Now().Add(10 * time.Minute)
 	u.OTPExpiresAt = &expiryTime
@@ -117,50 +127,19 @@ func (u *MongoUser) SetOTP(hash string) {
 }
 
 // ClearOTP clears the OTP hash and expiry time
-func (u *MongoUser) ClearOTP() {
+func (u *User) ClearOTP() {
 	u.OTPHash = ""
 	u.OTPExpiresAt = nil
 	u.UpdatedAt = time.Now()
 }
 
 // UpdatePassword updates the user's password hash
-func (u *MongoUser) UpdatePassword(hash string) {
+func (u *User) UpdatePassword(hash string) {
 	u.PasswordHash = hash
 	u.UpdatedAt = time.Now()
 }
 
-// ToUser converts MongoUser to User (for service layer compatibility)
-func (m *MongoUser) ToUser() *User {
-	if m == nil {
-		return nil
-	}
-	return &User{
-		ID:           m.ID,
-		Email:        m.Email,
-		PasswordHash: m.PasswordHash,
-		Name:         m.Name,
-		Role:         string(m.Role), // Convert UserRole to string
-		Region:       m.Region,
-		Team:         m.Team,
-		Permissions:  m.Permissions,
-		IsActive:     m.IsActive,
-		CreatedAt:    m.CreatedAt,
-		UpdatedAt:    m.UpdatedAt,
-	}
-}
-
-// ToProfile converts a User to a UserProfile (safe for API responses)
-func (u *MongoUser) ToProfile1() UserProfile {
-	return UserProfile{
-		ID:          u.ID,
-		Email:       u.Email,
-		Name:        u.Name,
-		Role:        string(u.Role),
-		Region:      u.Region,
-		Team:        u.Team,
-		Permissions: u.Permissions,
-	}
-}
+// ToProfile returns the API representation of a user
 func (u *User) ToProfile() UserProfile {
 	return UserProfile{
 		ID:          u.ID,
@@ -169,12 +148,17 @@ func (u *User) ToProfile() UserProfile {
 		Role:        string(u.Role),
 		Region:      u.Region,
 		Team:        u.Team,
+		JobTitle:    u.JobTitle,
+		Phone:       u.Phone,
+		ManagerID:   u.ManagerID,
 		Permissions: u.Permissions,
+		RoleIDs:     u.RoleIDs,
+		IsActive:    u.IsActive,
+		CreatedAt:   u.CreatedAt,
+		LastLoginAt: u.LastLoginAt,
 	}
 }
 
-
-
 type TwoFAOTP struct {
 	ID        string `bson:"_id,omitempty"`
 	UserID    string `bson:"user_id"`
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Status of a user import job
+const (
+	UserImportRunning   = "running"
+	UserImportCompleted = "completed"
+	UserImportFailed    = "failed" // Stopped by an error; rows already created stay created
+)
+
+// Outcome of one row of a user import
+const (
+	UserImportRowCreated = "created" // Invited user created
+	UserImportRowSkipped = "skipped" // A user with the email already exists; importing a file again skips its created rows
+	UserImportRowInvalid = "invalid" // Rejected by validation; see Reason
+	UserImportRowFailed  = "failed"  // Valid, but could not be stored; see Reason
+)
+
+// UserImportJob is one CSV import of users and its per-row report. Rows are
+// processed in batches and the job is saved after each, so Processed shows
+// the progress of a running import.
+// Collection: user_import_jobs
+type UserImportJob struct {
+	ID          string          `bson:"_id" json:"id"`
+	Status      string          `bson:"status" json:"status"`
+	Filename    string          `bson:"filename,omitempty" json:"filename,omitempty"`
+	SendInvites bool            `bson:"send_invites" json:"sendInvites"`
+	CreatedBy   string          `bson:"created_by" json:"createdBy"`
+	TenantID    string          `bson:"tenant_id,omitempty" json:"-"` // Tenant the imported users join, the importer's
+	TotalRows   int             `bson:"total_rows" json:"totalRows"`
+	Processed   int             `bson:"processed" json:"processed"`
+	Created     int             `bson:"created" json:"created"`
+	Skipped     int             `bson:"skipped" json:"skipped"`
+	Invalid     int             `bson:"invalid" json:"invalid"`
+	Failed      int             `bson:"failed" json:"failed"`
+	Rows        []UserImportRow `bson:"rows" json:"rows"`
+	Error       string          `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time       `bson:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time       `bson:"updated_at" json:"updatedAt"`
+	FinishedAt  *time.Time      `bson:"finished_at,omitempty" json:"finishedAt,omitempty"`
+}
+
+// UserImportRow is the outcome of one CSV row. Line is the line number in
+// the file, the header being line 1.
+type UserImportRow struct {
+	Line   int    `bson:"line" json:"line"`
+	Email  string `bson:"email" json:"email"`
+	Status string `bson:"status" json:"status"`
+	UserID string `bson:"user_id,omitempty" json:"userId,omitempty"`
+	Reason string `bson:"reason,omitempty" json:"reason,omitempty"`
+}
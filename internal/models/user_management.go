@@ -7,14 +7,14 @@ import (
 
 // UserActivityLog represents a user activity for audit trail
 type UserActivityLog struct {
-	UserID       string `json:"user_id"`
-	ActivityID   string `json:"activity_id"`
-	ActivityType string             `json:"activity_type"`
-	Description  string             `json:"description"`
-	IPAddress    string             `json:"ip_address,omitempty"`
-	UserAgent    string             `json:"user_agent,omitempty"`
-	Metadata     string             `json:"metadata,omitempty"`
-	CreatedAt    time.Time          `json:"created_at"`
+	UserID       string `json:"user_id" bson:"user_id"`
+	ActivityID   string `json:"activity_id" bson:"activity_id"`
+	ActivityType string             `json:"activity_type" bson:"activity_type"`
+	Description  string             `json:"description" bson:"description"`
+	IPAddress    string             `json:"ip_address,omitempty" bson:"ip_address,omitempty"`
+	UserAgent    string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Metadata     string             `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
 }
 
 // UserActivityType constants
@@ -53,6 +53,14 @@ type MongoUserPreferences struct {
 	DashboardLayout string `bson:"dashboard_layout,omitempty" json:"dashboardLayout,omitempty"`
 }
 
+// PreferredLanguage returns the language the user chose, "" when none
+func (u *User) PreferredLanguage() string {
+	if u.Preferences == nil {
+		return ""
+	}
+	return u.Preferences.Language
+}
+
 // UserPreferences represents user-specific preferences
 type UserPreferences struct {
 	UserID             string `json:"user_id"`
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func testUser() *User {
+	created := time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+	lastLogin := time.Date(2026, 3, 2, 17, 4, 5, 0, time.UTC)
+	return &User{
+		ID:                "8c0f5a8e-4b8f-4a43-9d55-2f1f3c6c9e01",
+		TenantID:          "acme",
+		Email:             "dana@acme.test",
+		PasswordHash:      "$2a$10$hash",
+		PasswordHistory:   []string{"$2a$10$older"},
+		Name:              "Dana Reyes",
+		Role:              UserRoleManager,
+		Region:            "west",
+		Team:              "enterprise",
+		JobTitle:          "Sales manager",
+		Phone:             "+14155550123",
+		ManagerID:         "2d7e8f8a-1111-4c4c-8888-000000000001",
+		Permissions:       []string{"templates:library:view"},
+		RoleIDs:           []string{"role-1"},
+		Preferences:       &MongoUserPreferences{Language: "de", Timezone: "Europe/Berlin"},
+		IsActive:          true,
+		Status:            "active",
+		InviteToken:       "invite-secret",
+		OTPHash:           "otp-secret",
+		CreatedAt:         created,
+		UpdatedAt:         lastLogin,
+		LastLoginAt:       &lastLogin,
+		MustResetPassword: true,
+	}
+}
+
+// TestUserProfileShape pins the JSON of a profile, which clients read
+func TestUserProfileShape(t *testing.T) {
+	data, err := json.Marshal(testUser().ToProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"8c0f5a8e-4b8f-4a43-9d55-2f1f3c6c9e01","email":"dana@acme.test","name":"Dana Reyes",` +
+		`"role":"manager","region":"west","team":"enterprise","jobTitle":"Sales manager","phone":"+14155550123",` +
+		`"managerId":"2d7e8f8a-1111-4c4c-8888-000000000001","permissions":["templates:library:view"],"roleIds":["role-1"],` +
+		`"isActive":true,"createdAt":"2026-01-05T09:30:00Z","lastLoginAt":"2026-03-02T17:04:05Z"}`
+	if string(data) != want {
+		t.Errorf("profile =\n%s\nwant\n%s", data, want)
+	}
+
+	// Optional fields are left out rather than sent empty
+	data, err = json.Marshal((&User{ID: "u1", Email: "sam@acme.test", Role: UserRoleSalesRep}).ToProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"id":"u1","email":"sam@acme.test","name":"","role":"sales_rep","region":"","team":"","permissions":null,"isActive":false,"createdAt":"0001-01-01T00:00:00Z"}`
+	if string(data) != want {
+		t.Errorf("minimal profile =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestUserJSONHidesSecrets(t *testing.T) {
+	data, err := json.Marshal(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"$2a$10$hash", "$2a$10$older", "invite-secret", "otp-secret", "must_reset_password", "MustResetPassword"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the user's JSON contains %q: %s", secret, data)
+		}
+	}
+}
+
+// TestUserBSONRoundTrip stores and loads every field, including those the
+// former converters between user types dropped
+func TestUserBSONRoundTrip(t *testing.T) {
+	user := testUser()
+	data, err := bson.Marshal(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded User
+	if err := bson.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	// BSON dates have millisecond precision and load in local time
+	loaded.CreatedAt = loaded.CreatedAt.UTC()
+	loaded.UpdatedAt = loaded.UpdatedAt.UTC()
+	lastLogin := loaded.LastLoginAt.UTC()
+	loaded.LastLoginAt = &lastLogin
+	if !reflect.DeepEqual(&loaded, user) {
+		t.Errorf("loaded\n%+v\nwant\n%+v", loaded, *user)
+	}
+}
@@ -0,0 +1,108 @@
+package models
+
+import "time"
+
+// WebhookEventTypes are the event types a webhook subscription can receive.
+// They match the event_type of the events outbox envelopes.
+var WebhookEventTypes = []string{
+	"team_member.invited",
+	"team_member.activated",
+	"team_member.deactivated",
+	"team_member.deleted",
+}
+
+// WebhookTestEventType is the event type of test deliveries
+const WebhookTestEventType = "webhook.test"
+
+// IsWebhookEventType reports whether eventType can be subscribed to
+func IsWebhookEventType(eventType string) bool {
+	for _, known := range WebhookEventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscription is an external endpoint that receives events
+// Collection: webhook_subscriptions
+type WebhookSubscription struct {
+	ID                  string     `bson:"_id" json:"id"`
+	URL                 string     `bson:"url" json:"url"`
+	Description         string     `bson:"description,omitempty" json:"description,omitempty"`
+	Secret              string     `bson:"secret" json:"-"`               // HMAC-SHA256 signing key, only returned on create
+	EventTypes          []string   `bson:"event_types" json:"eventTypes"` // Empty receives every event type
+	IsActive            bool       `bson:"is_active" json:"isActive"`
+	ConsecutiveFailures int        `bson:"consecutive_failures" json:"consecutiveFailures"`
+	DisabledAt          *time.Time `bson:"disabled_at,omitempty" json:"disabledAt,omitempty"`
+	DisabledReason      string     `bson:"disabled_reason,omitempty" json:"disabledReason,omitempty"`
+	CreatedBy           string     `bson:"created_by" json:"createdBy"`
+	CreatedAt           time.Time  `bson:"created_at" json:"createdAt"`
+	UpdatedAt           time.Time  `bson:"updated_at" json:"updatedAt"`
+}
+
+// Receives reports whether the subscription wants events of eventType
+func (s *WebhookSubscription) Receives(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, wanted := range s.EventTypes {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event sent, or to be sent, to a subscription along
+// with the outcome of its latest attempt
+// Collection: webhook_deliveries
+type WebhookDelivery struct {
+	ID             string     `bson:"_id" json:"id"` // Subscription and event ID, so an event is queued once per subscription
+	SubscriptionID string     `bson:"subscription_id" json:"subscriptionId"`
+	EventID        string     `bson:"event_id" json:"eventId"`
+	EventType      string     `bson:"event_type" json:"eventType"`
+	Payload        string     `bson:"payload" json:"payload"` // JSON event envelope as sent
+	Status         string     `bson:"status" json:"status"`
+	Attempts       int        `bson:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time  `bson:"next_attempt_at" json:"nextAttemptAt"`
+	LastStatusCode int        `bson:"last_status_code,omitempty" json:"lastStatusCode,omitempty"`
+	LastError      string     `bson:"last_error,omitempty" json:"lastError,omitempty"`
+	LastResponse   string     `bson:"last_response,omitempty" json:"lastResponse,omitempty"` // Start of the receiver's response body
+	DurationMs     int64      `bson:"duration_ms,omitempty" json:"durationMs,omitempty"`
+	IsTest         bool       `bson:"is_test,omitempty" json:"isTest,omitempty"`
+	CreatedAt      time.Time  `bson:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time  `bson:"updated_at" json:"updatedAt"`
+	DeliveredAt    *time.Time `bson:"delivered_at,omitempty" json:"deliveredAt,omitempty"`
+}
+
+// WebhookDeliveryID is the ID of the delivery of an event to a subscription
+func WebhookDeliveryID(subscriptionID, eventID string) string {
+	return subscriptionID + ":" + eventID
+}
+
+// CreateWebhookSubscriptionRequest is the body of a new webhook subscription
+type CreateWebhookSubscriptionRequest struct {
+	URL         string   `json:"url" validate:"required,max=2048"`
+	Description string   `json:"description" validate:"max=500"`
+	Secret      string   `json:"secret" validate:"max=256"` // Generated when empty
+	EventTypes  []string `json:"eventTypes"`                // Empty receives every event type
+	IsActive    *bool    `json:"isActive"`                  // Defaults to true
+}
+
+// UpdateWebhookSubscriptionRequest changes the given fields of a webhook
+// subscription. Re-activating a subscription clears its failure count.
+type UpdateWebhookSubscriptionRequest struct {
+	URL         *string   `json:"url,omitempty" validate:"omitempty,max=2048"`
+	Description *string   `json:"description,omitempty" validate:"omitempty,max=500"`
+	Secret      *string   `json:"secret,omitempty" validate:"omitempty,max=256"`
+	EventTypes  *[]string `json:"eventTypes,omitempty"`
+	IsActive    *bool     `json:"isActive,omitempty"`
+}
@@ -0,0 +1,305 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CheckRoutes returns an error naming every route router serves under the
+// spec's base path without a documented operation. OPTIONS is answered by
+// the CORS middleware and HEAD by the GET handler, so neither needs one of
+// its own.
+func (s *Spec) CheckRoutes(router *mux.Router) error {
+	var errs []error
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // A subrouter's prefix, not an endpoint
+		}
+		if !strings.HasPrefix(template, s.basePath+"/") {
+			return nil
+		}
+		path := strings.TrimPrefix(template, s.basePath)
+		for _, method := range methods {
+			switch method {
+			case http.MethodOptions:
+				continue
+			case http.MethodHead:
+				if _, ok := s.Operation(http.MethodGet, path); ok {
+					continue
+				}
+			}
+			if _, ok := s.Operation(method, path); !ok {
+				errs = append(errs, fmt.Errorf("%s %s is served but not documented", method, template))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// CheckResponses encodes a sample of every JSON response type documented,
+// with every field set, and returns an error naming each one whose JSON
+// does not match the schema the spec declares for it. Operation IDs are
+// checked to be unique too.
+func (s *Spec) CheckResponses() error {
+	doc := s.Document()
+	var errs []error
+	ids := map[string]string{}
+	for _, op := range s.ops {
+		route := routeKey(op.Method, op.Path)
+		if other, ok := ids[op.ID]; ok {
+			errs = append(errs, fmt.Errorf("%s: operation ID %q is also used by %s", route, op.ID, other))
+		}
+		ids[op.ID] = route
+
+		for _, response := range op.Responses {
+			if response.Body == nil || len(response.Files) > 0 {
+				continue
+			}
+			t := reflect.TypeOf(response.Body)
+			encoded, err := json.Marshal(s.reflector.sample(t, map[reflect.Type]bool{}).Interface())
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %d: %s cannot be encoded: %w", route, response.Status, t, err))
+				continue
+			}
+			var value interface{}
+			if err := json.Unmarshal(encoded, &value); err != nil {
+				errs = append(errs, fmt.Errorf("%s %d: %s encodes invalid JSON: %w", route, response.Status, t, err))
+				continue
+			}
+			schema := s.reflector.schemaOf(t, false)
+			for _, problem := range doc.validate(value, schema, "$") {
+				errs = append(errs, fmt.Errorf("%s %d: %s: %s", route, response.Status, t, problem))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sample returns a value of t with every field set: strings to the first
+// value of their enum, if they have one, slices and maps to one element.
+// seen holds the types being sampled, so a type within itself is left
+// empty rather than sampled forever.
+func (r *reflector) sample(t reflect.Type, seen map[reflect.Type]bool) reflect.Value {
+	v := reflect.New(t).Elem()
+	r.fill(v, nil, seen)
+	return v
+}
+
+func (r *reflector) fill(v reflect.Value, enum []interface{}, seen map[reflect.Type]bool) {
+	t := v.Type()
+	if values, ok := r.enums[t]; ok {
+		enum = values
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if seen[t.Elem()] {
+			return
+		}
+		v.Set(reflect.New(t.Elem()))
+		r.fill(v.Elem(), enum, seen)
+	case reflect.String:
+		if len(enum) > 0 {
+			v.SetString(fmt.Sprint(enum[0]))
+			return
+		}
+		v.SetString("sample")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(math.Pi)
+	case reflect.Slice:
+		if seen[t.Elem()] || t == rawMessageType {
+			v.Set(reflect.MakeSlice(t, 0, 0))
+			return
+		}
+		v.Set(reflect.MakeSlice(t, 1, 1))
+		r.fill(v.Index(0), enum, seen)
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		if t.Key().Kind() != reflect.String || seen[t.Elem()] {
+			return
+		}
+		key := reflect.New(t.Key()).Elem()
+		key.SetString("key")
+		value := reflect.New(t.Elem()).Elem()
+		r.fill(value, nil, seen)
+		v.SetMapIndex(key, value)
+	case reflect.Struct:
+		if t == timeType {
+			v.Set(reflect.ValueOf(time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)))
+			return
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() && !field.Anonymous {
+				continue
+			}
+			if !v.Field(i).CanSet() {
+				continue
+			}
+			r.fill(v.Field(i), r.fieldEnum(t, field), seen)
+		}
+	}
+}
+
+// fieldEnum returns the values a string field, or the strings of a slice
+// field, are limited to: those registered for the field, or those of its
+// oneof rule
+func (r *reflector) fieldEnum(t reflect.Type, field reflect.StructField) []interface{} {
+	if values, ok := r.fieldEnums[t][field.Name]; ok {
+		return values
+	}
+	rules := strings.Split(field.Tag.Get("validate"), ",")
+	items := indirect(field.Type).Kind() == reflect.Slice
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "dive" {
+			if !items {
+				return nil
+			}
+			items = false
+			continue
+		}
+		if option, ok := strings.CutPrefix(rule, "oneof="); ok && !items {
+			var values []interface{}
+			for _, value := range strings.Fields(option) {
+				values = append(values, value)
+			}
+			return values
+		}
+	}
+	return nil
+}
+
+// validate returns the ways value, decoded from JSON, does not match
+// schema. Only the structure is checked: types, enums, required and
+// undeclared properties; lengths, formats and patterns are left to the
+// request validation.
+func (d *Document) validate(value interface{}, schema *Schema, path string) []string {
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", path, schema.Ref)}
+		}
+		return d.validate(value, resolved, path)
+	}
+	if value == nil {
+		if schema.Nullable || schema.isAny() {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: null is not allowed", path)}
+	}
+	if len(schema.OneOf) > 0 {
+		var problems []string
+		for _, option := range schema.OneOf {
+			optionProblems := d.validate(value, option, path)
+			if len(optionProblems) == 0 {
+				return nil
+			}
+			problems = append(problems, optionProblems...)
+		}
+		return problems
+	}
+
+	mismatch := func() []string {
+		return []string{fmt.Sprintf("%s: %T does not match type %s", path, value, schema.Type)}
+	}
+	switch schema.Type {
+	case "":
+		return nil
+	case String:
+		s, ok := value.(string)
+		if !ok {
+			return mismatch()
+		}
+		if schema.Enum != nil && !containsValue(schema.Enum, s) {
+			return []string{fmt.Sprintf("%s: %q is not one of %v", path, s, schema.Enum)}
+		}
+	case Integer:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return mismatch()
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return mismatch()
+		}
+	case Boolean:
+		if _, ok := value.(bool); !ok {
+			return mismatch()
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		var problems []string
+		for i, item := range items {
+			problems = append(problems, d.validate(item, schema.Items, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		var problems []string
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: required property %s is missing", path, name))
+			}
+		}
+		for _, name := range sortedKeys(object) {
+			property, ok := schema.Properties[name]
+			if !ok {
+				additional, isSchema := schema.AdditionalProperties.(*Schema)
+				switch {
+				case isSchema:
+					property = additional
+				case schema.AdditionalProperties == true:
+					continue
+				default:
+					problems = append(problems, fmt.Sprintf("%s: property %s is not declared", path, name))
+					continue
+				}
+			}
+			problems = append(problems, d.validate(object[name], property, path+"."+name)...)
+		}
+		return problems
+	}
+	return nil
+}
+
+func containsValue(values []interface{}, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
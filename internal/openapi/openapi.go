@@ -0,0 +1,493 @@
+// Package openapi builds the OpenAPI 3 description of the API from Go
+// values: each operation names its request and response types, and their
+// schemas are reflected from the types' JSON and validate tags, so the
+// spec changes with the structs handlers encode. Named string types and
+// string fields holding one of a set of constants are described as enums
+// once registered, so generated clients get them as unions rather than
+// bare strings.
+//
+// Check compares a Spec with the routes a router serves and with what the
+// response types encode to, so an undocumented route or a response that no
+// longer matches its schema is caught before it ships.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version of the documents built
+const Version = "3.0.3"
+
+// Content types of request and response bodies
+const (
+	JSON      = "application/json"
+	Multipart = "multipart/form-data"
+	CSV       = "text/csv"
+	XLSX      = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	Binary    = "application/octet-stream"
+	GIF       = "image/gif"
+)
+
+// Parameter types
+const (
+	String  = "string"
+	Integer = "integer"
+	Boolean = "boolean"
+	File    = "file" // A multipart file part
+)
+
+// Op documents one operation of the API: a method on a path, relative to
+// the API base path, with the types of its request body and responses
+type Op struct {
+	Method  string
+	Path    string // With {name} path parameters, as registered on the router
+	ID      string // Unique; generated clients name their methods after it
+	Tag     string
+	Summary string
+	Public  bool // Served without a bearer token
+
+	// Deprecated marks an operation kept for existing clients, which
+	// should move to the one named in the summary
+	Deprecated bool
+
+	Query  []Param
+	Header []Param
+	Form   []Param     // Fields of a multipart body
+	Body   interface{} // Zero value of the JSON request body; nil for none
+
+	Responses []Response
+	Errors    []int // Statuses answered with an error body
+}
+
+// Param is a query, header or form parameter
+type Param struct {
+	Name        string
+	Type        string // String, Integer, Boolean or File
+	Required    bool
+	Description string
+}
+
+// Response is one successful response of an operation
+type Response struct {
+	Status      int
+	Description string
+	Body        interface{} // Zero value of the body; nil for none
+	Files       []string    // Content types of a file body, instead of JSON
+}
+
+// Described returns the response with a description
+func (r Response) Described(description string) Response {
+	r.Description = description
+	return r
+}
+
+// Query returns an optional query parameter
+func Query(name, typ, description string) Param {
+	return Param{Name: name, Type: typ, Description: description}
+}
+
+// RequiredQuery returns a query parameter requests must have
+func RequiredQuery(name, typ, description string) Param {
+	return Param{Name: name, Type: typ, Required: true, Description: description}
+}
+
+// Header returns a request header parameter
+func Header(name string, required bool, description string) Param {
+	return Param{Name: name, Type: String, Required: required, Description: description}
+}
+
+// FormFile returns a required multipart file field
+func FormFile(name, description string) Param {
+	return Param{Name: name, Type: File, Required: true, Description: description}
+}
+
+// FormField returns a multipart text field
+func FormField(name string, required bool, description string) Param {
+	return Param{Name: name, Type: String, Required: required, Description: description}
+}
+
+// OK returns a 200 response with a JSON body
+func OK(body interface{}) Response {
+	return Response{Status: http.StatusOK, Body: body}
+}
+
+// Created returns a 201 response with a JSON body
+func Created(body interface{}) Response {
+	return Response{Status: http.StatusCreated, Body: body}
+}
+
+// Accepted returns a 202 response with a JSON body
+func Accepted(body interface{}) Response {
+	return Response{Status: http.StatusAccepted, Body: body}
+}
+
+// NoContent returns a 204 response
+func NoContent() Response {
+	return Response{Status: http.StatusNoContent, Description: "No content"}
+}
+
+// Download returns a 200 response of a file of one of contentTypes
+func Download(contentTypes ...string) Response {
+	return Response{Status: http.StatusOK, Description: "File", Files: contentTypes}
+}
+
+// Redirect returns a 302 response
+func Redirect(description string) Response {
+	return Response{Status: http.StatusFound, Description: description}
+}
+
+// Spec is an API description being built
+type Spec struct {
+	title    string
+	version  string
+	basePath string
+
+	ops       []Op
+	byRoute   map[string]int
+	reflector *reflector
+	errorBody []interface{}
+	bodyError []int
+}
+
+// NewSpec returns an empty spec of the API served under basePath. Error
+// responses are described as one of errorBodies.
+func NewSpec(title, version, basePath string, errorBodies ...interface{}) *Spec {
+	return &Spec{
+		title:     title,
+		version:   version,
+		basePath:  basePath,
+		byRoute:   map[string]int{},
+		reflector: newReflector(),
+		errorBody: errorBodies,
+	}
+}
+
+// BodyErrors sets the error statuses every operation taking a JSON body
+// may answer with, besides its own, such as a body too large to read
+func (s *Spec) BodyErrors(statuses ...int) {
+	s.bodyError = statuses
+}
+
+// Add documents operations. A later operation on the same method and path
+// replaces the earlier one.
+func (s *Spec) Add(ops ...Op) {
+	for _, op := range ops {
+		op.Method = strings.ToUpper(op.Method)
+		key := routeKey(op.Method, op.Path)
+		if i, ok := s.byRoute[key]; ok {
+			s.ops[i] = op
+			continue
+		}
+		s.byRoute[key] = len(s.ops)
+		s.ops = append(s.ops, op)
+	}
+}
+
+// Operation returns the operation documented for method on path
+func (s *Spec) Operation(method, path string) (Op, bool) {
+	i, ok := s.byRoute[routeKey(strings.ToUpper(method), path)]
+	if !ok {
+		return Op{}, false
+	}
+	return s.ops[i], true
+}
+
+// Operations returns the documented operations in the order they were added
+func (s *Spec) Operations() []Op {
+	return append([]Op(nil), s.ops...)
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// Enum describes the named string type of values as an enum of values
+func Enum[T ~string](s *Spec, values ...T) {
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = string(value)
+	}
+	s.reflector.enums[reflect.TypeOf(values).Elem()] = list
+}
+
+// FieldEnum describes a string field of the struct of structValue, by Go
+// field name, as an enum of values
+func (s *Spec) FieldEnum(structValue interface{}, field string, values ...string) {
+	t := indirect(reflect.TypeOf(structValue))
+	if _, ok := t.FieldByName(field); !ok {
+		panic(fmt.Sprintf("openapi: %s has no field %s", t, field))
+	}
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	if s.reflector.fieldEnums[t] == nil {
+		s.reflector.fieldEnums[t] = map[string][]interface{}{}
+	}
+	s.reflector.fieldEnums[t][field] = list
+}
+
+// pathParam matches the {name} and {name:pattern} parameters of a path
+var pathParam = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// Document builds the OpenAPI document of the spec
+func (s *Spec) Document() *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: s.title, Version: s.version},
+		Servers: []Server{{URL: s.basePath}},
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: s.reflector.schemas,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"BearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	// Error responses refer to one Error component when there are several
+	// error bodies, rather than repeating them for every status
+	errorSchema := &Schema{}
+	for _, body := range s.errorBody {
+		errorSchema.OneOf = append(errorSchema.OneOf, s.reflector.schemaOf(reflect.TypeOf(body), false))
+	}
+	if len(errorSchema.OneOf) == 1 {
+		errorSchema = errorSchema.OneOf[0]
+	} else if len(errorSchema.OneOf) > 1 {
+		s.reflector.schemas["Error"] = errorSchema
+		errorSchema = &Schema{Ref: "#/components/schemas/Error"}
+	}
+
+	for _, op := range s.ops {
+		path := pathParam.ReplaceAllString(op.Path, "{$1}")
+		item := doc.Paths[path]
+		if item == nil {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		item.set(op.Method, s.operation(op, errorSchema))
+	}
+	return doc
+}
+
+func (s *Spec) operation(op Op, errorSchema *Schema) *Operation {
+	operation := &Operation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Deprecated:  op.Deprecated,
+		Responses:   map[string]*ResponseObject{},
+	}
+	if op.Tag != "" {
+		operation.Tags = []string{op.Tag}
+	}
+	if !op.Public {
+		operation.Security = []map[string][]string{{"BearerAuth": {}}}
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		operation.Parameters = append(operation.Parameters, &Parameter{
+			Name: match[1], In: "path", Required: true, Schema: &Schema{Type: String},
+		})
+	}
+	for _, param := range op.Query {
+		operation.Parameters = append(operation.Parameters, parameter(param, "query"))
+	}
+	for _, param := range op.Header {
+		operation.Parameters = append(operation.Parameters, parameter(param, "header"))
+	}
+
+	switch {
+	case len(op.Form) > 0:
+		form := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for _, field := range op.Form {
+			property := &Schema{Type: String, Description: field.Description}
+			if field.Type == File {
+				property.Format = "binary"
+			}
+			form.Properties[field.Name] = property
+			if field.Required {
+				form.Required = append(form.Required, field.Name)
+			}
+		}
+		operation.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{Multipart: {Schema: form}}}
+	case op.Body != nil:
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{JSON: {Schema: s.reflector.schemaOf(reflect.TypeOf(op.Body), true)}},
+		}
+	}
+
+	for _, response := range op.Responses {
+		object := &ResponseObject{Description: response.Description}
+		if object.Description == "" {
+			object.Description = http.StatusText(response.Status)
+		}
+		switch {
+		case len(response.Files) > 0:
+			object.Content = map[string]*MediaType{}
+			for _, contentType := range response.Files {
+				object.Content[contentType] = &MediaType{Schema: &Schema{Type: String, Format: "binary"}}
+			}
+		case response.Body != nil:
+			object.Content = map[string]*MediaType{JSON: {Schema: s.reflector.schemaOf(reflect.TypeOf(response.Body), false)}}
+		}
+		operation.Responses[strconv.Itoa(response.Status)] = object
+	}
+	statuses := op.Errors
+	if op.Body != nil && len(op.Form) == 0 {
+		statuses = append(append([]int{}, op.Errors...), s.bodyError...)
+	}
+	for _, status := range statuses {
+		operation.Responses[strconv.Itoa(status)] = &ResponseObject{
+			Description: http.StatusText(status),
+			Content:     map[string]*MediaType{JSON: {Schema: errorSchema}},
+		}
+	}
+	return operation
+}
+
+func parameter(param Param, in string) *Parameter {
+	return &Parameter{
+		Name:        param.Name,
+		In:          in,
+		Required:    param.Required,
+		Description: param.Description,
+		Schema:      &Schema{Type: param.Type},
+	}
+}
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Server is where the API is served
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem holds the operations of a path
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Head   *Operation `json:"head,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+func (p *PathItem) set(method string, operation *Operation) {
+	switch method {
+	case http.MethodGet:
+		p.Get = operation
+	case http.MethodHead:
+		p.Head = operation
+	case http.MethodPost:
+		p.Post = operation
+	case http.MethodPut:
+		p.Put = operation
+	case http.MethodPatch:
+		p.Patch = operation
+	case http.MethodDelete:
+		p.Delete = operation
+	}
+}
+
+// Operation is one method of a path
+type Operation struct {
+	Tags        []string                   `json:"tags,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	OperationID string                     `json:"operationId,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Parameters  []*Parameter               `json:"parameters,omitempty"`
+	RequestBody *RequestBody               `json:"requestBody,omitempty"`
+	Responses   map[string]*ResponseObject `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation takes
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// ResponseObject is one response of an operation
+type ResponseObject struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body of one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is how requests authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Schema is an OpenAPI 3.0 schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // true or a *Schema
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,248 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type color string
+
+type widget struct {
+	ID        string     `json:"id"`
+	Color     color      `json:"color"`
+	Size      string     `json:"size"`
+	Shape     string     `json:"shape" validate:"oneof=round square"`
+	Tags      []string   `json:"tags,omitempty"`
+	Parent    *widget    `json:"parent"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	internal  string
+}
+
+type createWidgetRequest struct {
+	Name  string `json:"name" validate:"required,max=40"`
+	Color color  `json:"color,omitempty"`
+	Email string `json:"email,omitempty" validate:"omitempty,email"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// drifting is a string type that has come to encode itself as a number,
+// as a response field that drifted from its declared type would
+type drifting string
+
+func (drifting) MarshalJSON() ([]byte, error) {
+	return []byte(`1`), nil
+}
+
+type driftingWidget struct {
+	Count drifting `json:"count"`
+}
+
+func widgetSpec() *Spec {
+	spec := NewSpec("Widgets", "1.0", "/api/v1", apiError{})
+	Enum(spec, color("red"), color("blue"))
+	spec.FieldEnum(widget{}, "Size", "small", "large")
+	spec.Add(
+		Op{Method: "get", Path: "/widgets", ID: "ListWidgets", Responses: []Response{OK([]widget{})}},
+		Op{Method: http.MethodPost, Path: "/widgets", ID: "CreateWidget", Body: createWidgetRequest{}, Responses: []Response{Created(widget{})}, Errors: []int{http.StatusBadRequest}},
+		Op{Method: http.MethodGet, Path: "/widgets/{id:[0-9a-f-]+}", ID: "GetWidget", Public: true, Responses: []Response{OK(widget{})}},
+	)
+	return spec
+}
+
+func schema(t *testing.T, doc *Document, name string) *Schema {
+	t.Helper()
+	s, ok := doc.Components.Schemas[name]
+	if !ok {
+		t.Fatalf("no %s component in %v", name, sortedKeys(doc.Components.Schemas))
+	}
+	return s
+}
+
+func TestDocumentDescribesOperations(t *testing.T) {
+	doc := widgetSpec().Document()
+	if doc.OpenAPI != Version || len(doc.Servers) != 1 || doc.Servers[0].URL != "/api/v1" {
+		t.Errorf("document = %s, servers %v", doc.OpenAPI, doc.Servers)
+	}
+
+	list := doc.Paths["/widgets"].Get
+	if list == nil || list.OperationID != "ListWidgets" || len(list.Security) != 1 {
+		t.Fatalf("GET /widgets = %+v, want it documented behind the bearer token", list)
+	}
+	// Path parameter patterns are left out of the documented path
+	get := doc.Paths["/widgets/{id}"].Get
+	if get == nil || get.Security != nil || len(get.Parameters) != 1 || get.Parameters[0].In != "path" || !get.Parameters[0].Required {
+		t.Fatalf("GET /widgets/{id} = %+v, want a public operation with its path parameter", get)
+	}
+
+	create := doc.Paths["/widgets"].Post
+	if create.RequestBody == nil || create.RequestBody.Content[JSON].Schema.Ref != "#/components/schemas/openapi.createWidgetRequest" {
+		t.Errorf("POST /widgets body = %+v", create.RequestBody)
+	}
+	if create.Responses["201"] == nil || create.Responses["400"] == nil || create.Responses["400"].Content[JSON].Schema.Ref != "#/components/schemas/openapi.apiError" {
+		t.Errorf("POST /widgets responses = %v, want 201 and the error body for 400", sortedKeys(create.Responses))
+	}
+}
+
+func TestSchemasFollowTheJSONEncoding(t *testing.T) {
+	doc := widgetSpec().Document()
+	w := schema(t, doc, "openapi.widget")
+
+	if _, ok := w.Properties["internal"]; ok {
+		t.Error("unexported field documented")
+	}
+	// Fields without omitempty are required, unless they are pointers
+	for _, name := range []string{"id", "color", "size", "shape", "updatedAt"} {
+		if !slices.Contains(w.Required, name) {
+			t.Errorf("%s not required in %v", name, w.Required)
+		}
+	}
+	if slices.Contains(w.Required, "tags") || slices.Contains(w.Required, "parent") || slices.Contains(w.Required, "deletedAt") {
+		t.Errorf("required = %v, want tags, parent and deletedAt optional", w.Required)
+	}
+	if p := w.Properties["updatedAt"]; p.Type != String || p.Format != "date-time" {
+		t.Errorf("updatedAt = %+v, want a date-time string", p)
+	}
+	// A pointer encoded as null is nullable; a $ref is wrapped to say so
+	if p := w.Properties["parent"]; !p.Nullable || len(p.OneOf) != 1 || p.OneOf[0].Ref != "#/components/schemas/openapi.widget" {
+		t.Errorf("parent = %+v, want a nullable reference to widget", p)
+	}
+
+	// Request schemas require what validation requires
+	req := schema(t, doc, "openapi.createWidgetRequest")
+	if !slices.Equal(req.Required, []string{"name"}) {
+		t.Errorf("request required = %v, want name", req.Required)
+	}
+	if p := req.Properties["name"]; p.MaxLength == nil || *p.MaxLength != 40 {
+		t.Errorf("name = %+v, want a max length of 40", p)
+	}
+	if p := req.Properties["email"]; p.Format != "email" {
+		t.Errorf("email = %+v, want format email", p)
+	}
+}
+
+// TestEnumsAreEmittedAsEnums checks named string types, registered fields
+// and oneof rules are described with their values, not as bare strings
+func TestEnumsAreEmittedAsEnums(t *testing.T) {
+	doc := widgetSpec().Document()
+	w := schema(t, doc, "openapi.widget")
+	for name, want := range map[string][]interface{}{
+		"color": {"red", "blue"},
+		"size":  {"small", "large"},
+		"shape": {"round", "square"},
+	} {
+		if p := w.Properties[name]; p.Type != String || !slices.Equal(p.Enum, want) {
+			t.Errorf("%s = %+v, want a string enum of %v", name, p, want)
+		}
+	}
+	if p := schema(t, doc, "openapi.createWidgetRequest").Properties["color"]; !slices.Equal(p.Enum, []interface{}{"red", "blue"}) {
+		t.Errorf("request color = %+v, want the enum", p)
+	}
+
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"enum":["small","large"]`) {
+		t.Errorf("encoded document has no size enum: %s", encoded)
+	}
+}
+
+func TestFieldEnumPanicsOnUnknownFields(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("FieldEnum accepted a field widget does not have")
+		}
+	}()
+	NewSpec("Widgets", "1.0", "/api/v1").FieldEnum(widget{}, "Weight", "light")
+}
+
+// TestCheckRoutesNamesUndocumentedRoutes serves a documented route, one
+// that is not, and routes CheckRoutes leaves alone
+func TestCheckRoutesNamesUndocumentedRoutes(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	router := mux.NewRouter()
+	router.HandleFunc("/health", noop).Methods(http.MethodGet)
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/widgets", noop).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/widgets/{id:[0-9a-f-]+}", noop).Methods(http.MethodGet, http.MethodHead)
+
+	spec := widgetSpec()
+	if err := spec.CheckRoutes(router); err != nil {
+		t.Fatalf("CheckRoutes = %v, want every route documented", err)
+	}
+
+	api.HandleFunc("/widgets/{id:[0-9a-f-]+}", noop).Methods(http.MethodDelete)
+	api.HandleFunc("/gadgets", noop).Methods(http.MethodHead)
+	err := spec.CheckRoutes(router)
+	if err == nil {
+		t.Fatal("CheckRoutes passed undocumented routes")
+	}
+	for _, want := range []string{"DELETE /api/v1/widgets/{id:[0-9a-f-]+}", "HEAD /api/v1/gadgets"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("CheckRoutes = %v, want it to name %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "OPTIONS") || strings.Contains(err.Error(), "/health") {
+		t.Errorf("CheckRoutes = %v, want OPTIONS and routes outside the base path left alone", err)
+	}
+}
+
+func TestCheckResponses(t *testing.T) {
+	if err := widgetSpec().CheckResponses(); err != nil {
+		t.Fatalf("CheckResponses = %v, want the widget responses to match", err)
+	}
+
+	spec := widgetSpec()
+	spec.Add(
+		Op{Method: http.MethodGet, Path: "/drifting", ID: "GetDrifting", Responses: []Response{OK(driftingWidget{})}},
+		Op{Method: http.MethodGet, Path: "/widgets/export", ID: "ListWidgets", Responses: []Response{Download(CSV)}},
+	)
+	err := spec.CheckResponses()
+	if err == nil {
+		t.Fatal("CheckResponses passed a response that does not match its schema")
+	}
+	for _, want := range []string{
+		"$.count: float64 does not match type string",
+		`operation ID "ListWidgets" is also used by GET /widgets`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("CheckResponses = %v, want %q", err, want)
+		}
+	}
+}
+
+// TestCheckResponsesRejectsValuesOutsideTheEnum validates a value that is
+// not one of an enum's values directly, since samples always use the first
+func TestCheckResponsesRejectsValuesOutsideTheEnum(t *testing.T) {
+	doc := widgetSpec().Document()
+	problems := doc.validate(map[string]interface{}{"color": "green"}, &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"color": {Type: String, Enum: []interface{}{"red", "blue"}}},
+		Required:   []string{"color", "size"},
+	}, "$")
+	want := []string{"$: required property size is missing", `$.color: "green" is not one of [red blue]`}
+	if !slices.Equal(problems, want) {
+		t.Errorf("problems = %q, want %q", problems, want)
+	}
+}
+
+func TestAddReplacesTheOperationOfARoute(t *testing.T) {
+	spec := widgetSpec()
+	spec.Add(Op{Method: http.MethodGet, Path: "/widgets", ID: "ListAllWidgets"})
+	if op, ok := spec.Operation("get", "/widgets"); !ok || op.ID != "ListAllWidgets" {
+		t.Errorf("operation = %+v, %v; want the later one", op, ok)
+	}
+	if n := len(spec.Operations()); n != 3 {
+		t.Errorf("%d operations, want 3", n)
+	}
+}
@@ -0,0 +1,315 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reflector turns Go types into schemas the way encoding/json encodes
+// them. Named structs become components, referred to by $ref.
+//
+// Request bodies and responses get schemas of their own, as they differ in
+// what is required: a response field is required when it is always encoded
+// (no omitempty, not a pointer), a request field when its validate tag
+// requires it. Request schemas are named with an Input suffix unless the
+// type's name already says it is a request.
+type reflector struct {
+	schemas    map[string]*Schema
+	names      map[typeMode]string
+	enums      map[reflect.Type][]interface{}
+	fieldEnums map[reflect.Type]map[string][]interface{}
+}
+
+type typeMode struct {
+	t     reflect.Type
+	input bool
+}
+
+func newReflector() *reflector {
+	return &reflector{
+		schemas:    map[string]*Schema{},
+		names:      map[typeMode]string{},
+		enums:      map[reflect.Type][]interface{}{},
+		fieldEnums: map[reflect.Type]map[string][]interface{}{},
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaOf returns the schema of t, a $ref for named structs
+func (r *reflector) schemaOf(t reflect.Type, input bool) *Schema {
+	t = indirect(t)
+	if values, ok := r.enums[t]; ok {
+		return &Schema{Type: String, Enum: values}
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: String, Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Kind() != reflect.Struct && implements(t, textMarshalerType):
+		return &Schema{Type: String}
+	case implements(t, jsonMarshalerType):
+		// Encodes itself; an ObjectID, say, is a string
+		if t.Kind() == reflect.Array || t.Kind() == reflect.String {
+			return &Schema{Type: String}
+		}
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Boolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: Integer, Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: Integer, Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: Integer, Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: String}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: String, Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: r.schemaOf(t.Elem(), input)}
+	case reflect.Map:
+		value := r.schemaOf(t.Elem(), input)
+		if value.isAny() {
+			return &Schema{Type: "object", AdditionalProperties: true}
+		}
+		return &Schema{Type: "object", AdditionalProperties: value}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t, input)
+		}
+		return r.component(t, input)
+	}
+	return &Schema{} // interface{} and anything else: any value
+}
+
+// component returns a $ref to the component of a named struct, building
+// the component the first time
+func (r *reflector) component(t reflect.Type, input bool) *Schema {
+	key := typeMode{t, input}
+	name, ok := r.names[key]
+	if !ok {
+		name = componentName(t, input)
+		r.names[key] = name
+		r.schemas[name] = &Schema{} // Placeholder, for types that refer to themselves
+		*r.schemas[name] = *r.structSchema(t, input)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// importPath matches the import path before a package name in type names
+var importPath = regexp.MustCompile(`[\w.\-]+/`)
+
+// componentName names the component of t: its package and type name, with
+// type arguments after a dash, as pagination.Envelope-models.User
+func componentName(t reflect.Type, input bool) string {
+	name := t.String()
+	if open := strings.Index(t.Name(), "["); open >= 0 {
+		pkg := t.String()[:strings.Index(t.String(), ".")]
+		args := importPath.ReplaceAllString(t.Name()[open+1:len(t.Name())-1], "")
+		name = pkg + "." + t.Name()[:open] + "-" + strings.ReplaceAll(args, ",", "-")
+	}
+	if input && !strings.HasSuffix(name, "Request") && !strings.HasSuffix(name, "Input") {
+		name += "Input"
+	}
+	return name
+}
+
+// structSchema returns the object schema of the JSON fields of a struct
+func (r *reflector) structSchema(t reflect.Type, input bool) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	r.addFields(schema, t, input)
+	return schema
+}
+
+func (r *reflector) addFields(schema *Schema, t reflect.Type, input bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		// Untagged embedded structs have their fields promoted
+		if field.Anonymous && name == "" && indirect(field.Type).Kind() == reflect.Struct {
+			r.addFields(schema, indirect(field.Type), input)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := r.schemaOf(field.Type, input)
+		if values, ok := r.fieldEnums[t][field.Name]; ok {
+			property = &Schema{Type: String, Enum: values}
+		}
+		if hasOption(options, "string") {
+			property = &Schema{Type: String}
+		}
+		rules := field.Tag.Get("validate")
+		property = applyRules(property, rules, field.Type)
+
+		isPointer := field.Type.Kind() == reflect.Ptr
+		omitted := hasOption(options, "omitempty")
+		if isPointer && !omitted && !input {
+			property = nullable(property)
+		}
+		schema.Properties[name] = property
+
+		required := !omitted && !isPointer
+		if input {
+			required = hasRule(rules, "required")
+		}
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// applyRules adds the constraints of validate rules to a field's schema
+func applyRules(schema *Schema, rules string, t reflect.Type) *Schema {
+	if rules == "" {
+		return schema
+	}
+	constrained := *schema
+	target := &constrained
+	elem := indirect(t)
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "dive" {
+			// Rules after dive apply to the items
+			if target.Items != nil && target.Ref == "" {
+				items := applyRules(target.Items, strings.Join(remainingRules(rules), ","), elem.Elem())
+				target.Items = items
+			}
+			break
+		}
+		if target.Ref != "" {
+			continue // Constraints on a $ref would be ignored
+		}
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			n := int(limit)
+			switch {
+			case target.Type == String && name == "min":
+				target.MinLength = &n
+			case target.Type == String:
+				target.MaxLength = &n
+			case target.Type == "array" && name == "min":
+				target.MinItems = &n
+			case target.Type == "array":
+				target.MaxItems = &n
+			case (target.Type == Integer || target.Type == "number") && name == "min":
+				target.Minimum = &limit
+			case target.Type == Integer || target.Type == "number":
+				target.Maximum = &limit
+			}
+		case "oneof":
+			if target.Type == String && target.Enum == nil {
+				for _, option := range strings.Fields(param) {
+					target.Enum = append(target.Enum, option)
+				}
+			}
+		case "email":
+			target.Format = "email"
+		case "uuid":
+			target.Format = "uuid"
+		case "url", "https_url":
+			target.Format = "uri"
+		case "hexcolor":
+			target.Pattern = `^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`
+		case "e164":
+			target.Pattern = `^\+[1-9][0-9]{7,14}$`
+		}
+	}
+	return target
+}
+
+// remainingRules returns the rules after the first dive
+func remainingRules(rules string) []string {
+	parts := strings.Split(rules, ",")
+	for i, part := range parts {
+		if strings.TrimSpace(part) == "dive" {
+			return parts[i+1:]
+		}
+	}
+	return nil
+}
+
+// nullable marks a schema as also allowing null. A $ref cannot carry
+// nullable in OpenAPI 3.0, so it is wrapped.
+func nullable(schema *Schema) *Schema {
+	if schema.isAny() {
+		return schema
+	}
+	if schema.Ref != "" {
+		return &Schema{OneOf: []*Schema{schema}, Nullable: true}
+	}
+	copied := *schema
+	copied.Nullable = true
+	return &copied
+}
+
+func (s *Schema) isAny() bool {
+	return s.Ref == "" && s.Type == "" && len(s.OneOf) == 0 && s.Enum == nil
+}
+
+func hasOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRule(rules, rule string) bool {
+	for _, r := range strings.Split(rules, ",") {
+		r = strings.TrimSpace(r)
+		if r == "dive" {
+			return false
+		}
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
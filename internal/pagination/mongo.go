@@ -0,0 +1,46 @@
+package pagination
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sort orders a cursor-paged collection by field, with _id in the same
+// direction breaking ties so every item has a unique position
+func Sort(field string, descending bool) bson.D {
+	order := 1
+	if descending {
+		order = -1
+	}
+	return bson.D{{Key: field, Value: order}, {Key: "_id", Value: order}}
+}
+
+// After returns the condition matching the documents that follow c in the
+// order of Sort(field, descending). id is c.ID as stored in _id.
+func After(field string, descending bool, c *Cursor, id interface{}) bson.M {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: c.SortValue}},
+		bson.M{field: c.SortValue, "_id": bson.M{op: id}},
+	}}
+}
+
+// And returns filter narrowed down by condition, leaving filter unchanged
+func And(filter, condition bson.M) bson.M {
+	if len(filter) == 0 {
+		return condition
+	}
+	return bson.M{"$and": bson.A{filter, condition}}
+}
+
+// ObjectID returns the cursor ID of a collection keyed by ObjectIDs
+func (c Cursor) ObjectID() (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidCursor
+	}
+	return id, nil
+}
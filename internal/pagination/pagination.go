@@ -0,0 +1,166 @@
+// Package pagination parses the paging parameters of list endpoints and
+// builds the response envelope they share:
+//
+//	{
+//	  "items":       [...],
+//	  "total":       1234,   // only when the endpoint counted the matches
+//	  "next_cursor": "...",  // absent on the last page
+//	  "has_more":    true
+//	}
+//
+// A list is read with limit (default 50, max 100) and either cursor or
+// page/offset. Without page or offset the list is in cursor mode: the first
+// request sends no cursor, and each following one sends back the previous
+// next_cursor until has_more is false. A cursor encodes the sort key and ID
+// of the last item returned, so the next page starts strictly after it and
+// items inserted meanwhile neither repeat nor shift the pages. page
+// (1-based) or offset select the older skip-based mode, which is kept for
+// existing clients and also reports total.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits applied when a request does not send limit, or sends more than
+// MaxLimit
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+)
+
+// ErrInvalidCursor reports a cursor that was not issued by this service
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position after which the next page starts: the sort key
+// and ID of the last item of the previous page
+type Cursor struct {
+	SortValue time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// Encode returns the opaque form of c sent to clients as next_cursor
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor sent by a client
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// Follows reports whether an item with sort value t and ID id comes after
+// c in a listing sorted by sort value then ID, for stores paging in memory
+func (c Cursor) Follows(t time.Time, id string, descending bool) bool {
+	if descending {
+		return t.Before(c.SortValue) || t.Equal(c.SortValue) && id < c.ID
+	}
+	return t.After(c.SortValue) || t.Equal(c.SortValue) && id > c.ID
+}
+
+// Request holds the paging parameters of a list request
+type Request struct {
+	Limit    int
+	PageMode bool    // Skip-based paging with page or offset
+	Offset   int     // Items to skip, in page mode
+	After    *Cursor // Cursor mode position; nil for the first page
+}
+
+// FetchLimit is the number of items to ask the store for: one more than the
+// limit, to tell whether another page follows
+func (p Request) FetchLimit() int {
+	return p.Limit + 1
+}
+
+// Parse reads limit, cursor, page and offset from the query string, with
+// defaultLimit used when limit is not sent
+func Parse(r *http.Request, defaultLimit int) (Request, error) {
+	query := r.URL.Query()
+	req := Request{Limit: defaultLimit}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return req, errors.New("Invalid limit value")
+		}
+		req.Limit = limit
+	}
+	if req.Limit > MaxLimit {
+		req.Limit = MaxLimit
+	}
+
+	cursorStr, pageStr, offsetStr := query.Get("cursor"), query.Get("page"), query.Get("offset")
+	if cursorStr != "" && (pageStr != "" || offsetStr != "") {
+		return req, errors.New("cursor cannot be combined with page or offset")
+	}
+	switch {
+	case pageStr != "" && offsetStr != "":
+		return req, errors.New("page and offset cannot be combined")
+	case pageStr != "":
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			return req, errors.New("Invalid page number")
+		}
+		req.PageMode, req.Offset = true, (page-1)*req.Limit
+	case offsetStr != "":
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return req, errors.New("Invalid offset value")
+		}
+		req.PageMode, req.Offset = true, offset
+	case cursorStr != "":
+		after, err := DecodeCursor(cursorStr)
+		if err != nil {
+			return req, fmt.Errorf("%w, send back the next_cursor of the previous page", err)
+		}
+		req.After = after
+	}
+	return req, nil
+}
+
+// Envelope is the response body of a list endpoint
+type Envelope[T any] struct {
+	Items      []T    `json:"items"`
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// NewEnvelope builds the envelope of items fetched with req.FetchLimit(),
+// dropping the extra item. key returns the cursor of an item; with a nil
+// key no next_cursor is issued, for listings not sorted by a cursor key.
+func NewEnvelope[T any](req Request, items []T, key func(item T) Cursor) Envelope[T] {
+	envelope := Envelope[T]{Items: items}
+	if envelope.Items == nil {
+		envelope.Items = []T{}
+	}
+	if len(items) > req.Limit {
+		envelope.Items = items[:req.Limit]
+		envelope.HasMore = true
+		if key != nil {
+			envelope.NextCursor = key(envelope.Items[req.Limit-1]).Encode()
+		}
+	}
+	return envelope
+}
+
+// WithTotal sets the number of items matching the listing
+func (e Envelope[T]) WithTotal(total int64) Envelope[T] {
+	e.Total = &total
+	return e
+}
@@ -0,0 +1,141 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cursor := Cursor{SortValue: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), ID: "42"}
+
+	for _, tt := range []struct {
+		query string
+		want  Request
+	}{
+		{"", Request{Limit: 10}},
+		{"limit=25", Request{Limit: 25}},
+		{"limit=500", Request{Limit: MaxLimit}},
+		{"page=3&limit=20", Request{Limit: 20, PageMode: true, Offset: 40}},
+		{"page=1", Request{Limit: 10, PageMode: true}},
+		{"offset=7", Request{Limit: 10, PageMode: true, Offset: 7}},
+		{"cursor=" + cursor.Encode() + "&limit=5", Request{Limit: 5, After: &cursor}},
+	} {
+		got, err := Parse(httptest.NewRequest("GET", "/items?"+tt.query, nil), 10)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", tt.query, err)
+			continue
+		}
+		if got.Limit != tt.want.Limit || got.PageMode != tt.want.PageMode || got.Offset != tt.want.Offset {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+		if (got.After == nil) != (tt.want.After == nil) || got.After != nil && (!got.After.SortValue.Equal(tt.want.After.SortValue) || got.After.ID != tt.want.After.ID) {
+			t.Errorf("Parse(%q).After = %+v, want %+v", tt.query, got.After, tt.want.After)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	cursor := Cursor{SortValue: time.Now(), ID: "42"}.Encode()
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=-1",
+		"limit=ten",
+		"page=0",
+		"page=two",
+		"offset=-5",
+		"page=2&offset=10",
+		"cursor=" + cursor + "&page=2",
+		"cursor=" + cursor + "&offset=0",
+		"cursor=not-a-cursor",
+	} {
+		if _, err := Parse(httptest.NewRequest("GET", "/items?"+query, nil), 10); err == nil {
+			t.Errorf("Parse(%q) accepted", query)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	want := Cursor{SortValue: time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC), ID: "65f0c0ffee"}
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.SortValue.Equal(want.SortValue) || got.ID != want.ID {
+		t.Errorf("DecodeCursor(Encode()) = %+v, want %+v", got, want)
+	}
+
+	noID, _ := json.Marshal(Cursor{SortValue: time.Now()})
+	for _, value := range []string{
+		"%%%",
+		base64.RawURLEncoding.EncodeToString([]byte("not json")),
+		base64.RawURLEncoding.EncodeToString(noID),
+	} {
+		if _, err := DecodeCursor(value); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", value, err)
+		}
+	}
+}
+
+func TestCursorFollows(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := Cursor{SortValue: at, ID: "m"}
+
+	for _, tt := range []struct {
+		t          time.Time
+		id         string
+		descending bool
+		want       bool
+	}{
+		{at.Add(-time.Second), "z", true, true},
+		{at, "a", true, true},
+		{at, "m", true, false},
+		{at, "z", true, false},
+		{at.Add(time.Second), "a", true, false},
+		{at.Add(time.Second), "a", false, true},
+		{at, "z", false, true},
+		{at, "m", false, false},
+		{at.Add(-time.Second), "z", false, false},
+	} {
+		if got := c.Follows(tt.t, tt.id, tt.descending); got != tt.want {
+			t.Errorf("Follows(%v, %q, descending %v) = %v, want %v", tt.t.Sub(at), tt.id, tt.descending, got, tt.want)
+		}
+	}
+}
+
+func TestNewEnvelope(t *testing.T) {
+	req := Request{Limit: 2}
+	key := func(n int) Cursor { return Cursor{ID: string(rune('a' + n))} }
+
+	// One item past the limit means another page follows the last one kept
+	env := NewEnvelope(req, []int{1, 2, 3}, key)
+	if len(env.Items) != 2 || !env.HasMore || env.NextCursor != key(2).Encode() {
+		t.Errorf("envelope = %+v, want two items, has_more and the cursor of the second", env)
+	}
+
+	env = NewEnvelope(req, []int{1, 2}, key)
+	if len(env.Items) != 2 || env.HasMore || env.NextCursor != "" {
+		t.Errorf("last page = %+v, want no more and no cursor", env)
+	}
+
+	if env := NewEnvelope(req, []int{1, 2, 3}, nil); !env.HasMore || env.NextCursor != "" {
+		t.Errorf("envelope without a key = %+v, want has_more and no cursor", env)
+	}
+
+	data, err := json.Marshal(NewEnvelope[int](req, nil, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"items":[],"has_more":false}` {
+		t.Errorf("empty envelope = %s", data)
+	}
+
+	data, _ = json.Marshal(NewEnvelope(req, []int{1}, key).WithTotal(1))
+	if string(data) != `{"items":[1],"total":1,"has_more":false}` {
+		t.Errorf("envelope with a total = %s", data)
+	}
+}
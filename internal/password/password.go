@@ -0,0 +1,96 @@
+// Package password hashes and verifies user passwords. It is the only place
+// that knows the hashing algorithm and its cost.
+//
+// Stored hashes carry their algorithm as a prefix in the modular crypt
+// format: bcrypt hashes start with $2a$, $2b$ or $2y$ and embed their cost.
+// A later algorithm gets its own prefix (argon2id hashes in the PHC format
+// start with $argon2id$), so Compare can keep verifying old hashes while new
+// ones are written with the new algorithm, and NeedsRehash reports the old
+// ones for upgrade on the next sign-in.
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Range of bcrypt costs accepted from configuration
+const (
+	MinCost     = 10
+	MaxCost     = 15
+	DefaultCost = bcrypt.DefaultCost
+)
+
+// ErrMismatch reports a password that does not match the hash
+var ErrMismatch = errors.New("password does not match")
+
+// ErrUnknownAlgorithm reports a stored hash without a known algorithm prefix
+var ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+
+// Hasher hashes passwords at the configured cost
+type Hasher struct {
+	cost int
+}
+
+// New creates a Hasher writing bcrypt hashes at cost, which must be between
+// MinCost and MaxCost
+func New(cost int) (*Hasher, error) {
+	if cost < MinCost || cost > MaxCost {
+		return nil, fmt.Errorf("password hash cost must be between %d and %d, got %d", MinCost, MaxCost, cost)
+	}
+	return &Hasher{cost: cost}, nil
+}
+
+// Default returns a Hasher at DefaultCost
+func Default() *Hasher {
+	return &Hasher{cost: DefaultCost}
+}
+
+// Cost returns the cost new hashes are written with
+func (h *Hasher) Cost() int {
+	return h.cost
+}
+
+// Hash hashes password for storage
+func (h *Hasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Compare returns nil when password matches hash, ErrMismatch when it does
+// not, and ErrUnknownAlgorithm when hash is not in a known format
+func (h *Hasher) Compare(hash, password string) error {
+	if !isBcrypt(hash) {
+		return ErrUnknownAlgorithm
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
+
+// NeedsRehash reports whether hash was written with another algorithm or a
+// lower cost than h writes, so it should be replaced once the password is
+// known to match
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if !isBcrypt(hash) {
+		return false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+	return cost < h.cost
+}
+
+// isBcrypt reports whether hash carries a bcrypt prefix
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
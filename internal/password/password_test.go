@@ -0,0 +1,85 @@
+package password
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewValidatesTheCost(t *testing.T) {
+	for _, cost := range []int{0, MinCost - 1, MaxCost + 1, 31} {
+		if _, err := New(cost); err == nil {
+			t.Errorf("New(%d) accepted", cost)
+		}
+	}
+	for _, cost := range []int{MinCost, 12, MaxCost} {
+		h, err := New(cost)
+		if err != nil || h.Cost() != cost {
+			t.Errorf("New(%d) = %v, %v", cost, h, err)
+		}
+	}
+	if Default().Cost() != bcrypt.DefaultCost {
+		t.Errorf("Default cost = %d", Default().Cost())
+	}
+}
+
+func TestHashAndCompare(t *testing.T) {
+	h, err := New(MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.Hash("Correct-Horse-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost != MinCost {
+		t.Errorf("hash cost = %d, %v; want %d", cost, err, MinCost)
+	}
+	if err := h.Compare(hash, "Correct-Horse-9"); err != nil {
+		t.Errorf("Compare with the password = %v", err)
+	}
+	if err := h.Compare(hash, "correct-horse-9"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Compare with another password = %v, want ErrMismatch", err)
+	}
+
+	// Hashes of any cost and bcrypt variant still verify
+	low, _ := bcrypt.GenerateFromPassword([]byte("Correct-Horse-9"), bcrypt.MinCost)
+	if err := h.Compare(string(low), "Correct-Horse-9"); err != nil {
+		t.Errorf("Compare with a low cost hash = %v", err)
+	}
+	for _, stored := range []string{"", "plaintext", "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA"} {
+		if err := h.Compare(stored, "Correct-Horse-9"); !errors.Is(err, ErrUnknownAlgorithm) {
+			t.Errorf("Compare(%q) = %v, want ErrUnknownAlgorithm", stored, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	h, err := New(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashAt := func(cost int) string {
+		hash, err := bcrypt.GenerateFromPassword([]byte("Correct-Horse-9"), cost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(hash)
+	}
+
+	for _, tt := range []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"lower cost", hashAt(MinCost), true},
+		{"same cost", hashAt(12), false},
+		{"unknown algorithm", "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA", false},
+		{"malformed bcrypt", "$2a$xx$", false},
+	} {
+		if got := h.NeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("NeedsRehash of a %s hash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccountDeletionRepository stores the account deletion requests of users
+type AccountDeletionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAccountDeletionRepository creates a new AccountDeletionRepository
+func NewAccountDeletionRepository(client *mongodb.Client) *AccountDeletionRepository {
+	return &AccountDeletionRepository{
+		collection: client.Collection("account_deletion_requests"),
+	}
+}
+
+// EnsureIndexes creates the index allowing one pending request per user and
+// the one the deletion sweep finds due requests with
+func (r *AccountDeletionRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, r.collection, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": models.AccountDeletionPending}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "scheduled_for", Value: 1}}},
+	})
+}
+
+// CreateDeletionRequest stores a new pending request. A user who already has
+// one gets a duplicate key error.
+func (r *AccountDeletionRepository) CreateDeletionRequest(ctx context.Context, request *models.AccountDeletionRequest) error {
+	if _, err := r.collection.InsertOne(ctx, request); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%w: deletion already requested", ErrDuplicateKey)
+		}
+		return fmt.Errorf("error creating account deletion request: %w", err)
+	}
+	return nil
+}
+
+// GetPendingDeletionRequest returns the pending request of a user
+func (r *AccountDeletionRepository) GetPendingDeletionRequest(ctx context.Context, userID string) (*models.AccountDeletionRequest, error) {
+	var request models.AccountDeletionRequest
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "status": models.AccountDeletionPending}).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrDeletionRequestNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting account deletion request: %w", err)
+	}
+	return &request, nil
+}
+
+// ListDeletionRequests returns a page of requests, optionally of one status,
+// those due soonest first
+func (r *AccountDeletionRepository) ListDeletionRequests(ctx context.Context, status string, page, limit int) ([]*models.AccountDeletionRequest, int64, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting account deletion requests: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "scheduled_for", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing account deletion requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	requests := []*models.AccountDeletionRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, 0, fmt.Errorf("error decoding account deletion requests: %w", err)
+	}
+	return requests, total, nil
+}
+
+// ListDueDeletionRequests returns up to limit pending requests whose grace
+// period ended by now
+func (r *AccountDeletionRepository) ListDueDeletionRequests(ctx context.Context, now time.Time, limit int) ([]*models.AccountDeletionRequest, error) {
+	filter := bson.M{
+		"status":        models.AccountDeletionPending,
+		"scheduled_for": bson.M{"$lte": now},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "scheduled_for", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing due account deletion requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	requests := []*models.AccountDeletionRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, fmt.Errorf("error decoding account deletion requests: %w", err)
+	}
+	return requests, nil
+}
+
+// CancelDeletionRequest cancels a pending request and returns it as
+// cancelled. A request that is unknown or no longer pending is not found.
+func (r *AccountDeletionRepository) CancelDeletionRequest(ctx context.Context, id, cancelledBy string, at time.Time) (*models.AccountDeletionRequest, error) {
+	var request models.AccountDeletionRequest
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.AccountDeletionPending},
+		bson.M{"$set": bson.M{
+			"status":       models.AccountDeletionCancelled,
+			"cancelled_at": at,
+			"cancelled_by": cancelledBy,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrDeletionRequestNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling account deletion request: %w", err)
+	}
+	return &request, nil
+}
+
+// CompleteDeletionRequest marks a pending request carried out, clearing the
+// email and name kept on it. It returns false when the request was cancelled
+// in the meantime.
+func (r *AccountDeletionRepository) CompleteDeletionRequest(ctx context.Context, id string, at time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.AccountDeletionPending},
+		bson.M{"$set": bson.M{
+			"status":       models.AccountDeletionCompleted,
+			"completed_at": at,
+			"email":        "",
+			"name":         "",
+		}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error completing account deletion request: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -36,6 +36,19 @@ func NewMongoActivityRepository(client *mongodb.Client) *MongoActivityRepository
 // Extended Methods for Full Activity Management (Tasks, Events, etc.)
 // ===================================================================
 
+// EnsureIndexes creates the indexes for owner activity listings
+func (r *MongoActivityRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "owner", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+	}
+	return createIndexes(ctx, r.collection, indexes)
+}
+
 // CreateActivity creates a new activity (generic activity entity)
 func (r *MongoActivityRepository) CreateActivity(ctx context.Context, activity *models.Activity) error {
 	activity.CreatedAt = time.Now()
@@ -139,3 +152,37 @@ func (r *MongoActivityRepository) GetActivitiesByOwner(ctx context.Context, owne
 
 	return activities, nil
 }
+
+// CountActivitiesByTitle counts an owner's activities on relatedToType
+// records created in [since, until), keyed by activity title
+func (r *MongoActivityRepository) CountActivitiesByTitle(ctx context.Context, ownerID, relatedToType string, since, until time.Time) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"owner":           ownerID,
+			"related_to_type": relatedToType,
+			"created_at":      bson.M{"$gte": since, "$lt": until},
+			"deleted_at":      nil,
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$title", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error counting activities: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Title string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding activity counts: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Title] = row.Count
+	}
+	return counts, nil
+}
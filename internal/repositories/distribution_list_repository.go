@@ -0,0 +1,299 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DistributionListFilters narrows a listing of a tenant's distribution lists
+type DistributionListFilters struct {
+	TenantID        string
+	Search          string   // Case-insensitive match on the name
+	IncludeArchived bool     // Archived lists are left out unless set
+	ScopeOwnerIDs   []string // Only lists owned by these users; nil for no restriction
+}
+
+// DistributionListRepository stores distribution lists and their members.
+// Members are kept one document each, keyed by list and member, so adding
+// a member twice keeps one entry and large lists page cheaply.
+type DistributionListRepository struct {
+	lists   *mongo.Collection
+	members *mongo.Collection
+}
+
+// NewDistributionListRepository creates a new DistributionListRepository
+func NewDistributionListRepository(client *mongodb.Client) *DistributionListRepository {
+	return &DistributionListRepository{
+		lists:   client.Collection("distribution_lists"),
+		members: client.Collection("distribution_list_members"),
+	}
+}
+
+// EnsureIndexes creates the listing and member paging indexes
+func (r *DistributionListRepository) EnsureIndexes(ctx context.Context) error {
+	if err := createIndexes(ctx, r.lists, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "owner_id", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+	return createIndexes(ctx, r.members, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "list_id", Value: 1}, {Key: "added_at", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+}
+
+// DistributionListMemberID returns the document ID of a member of listID:
+// the list ID and the member's user ID or lower-cased address
+func DistributionListMemberID(listID string, member models.DistributionListMemberInput) string {
+	if member.UserID != "" {
+		return listID + "/user:" + member.UserID
+	}
+	return listID + "/email:" + normalizeEmail(member.Email)
+}
+
+// CreateList stores a new list
+func (r *DistributionListRepository) CreateList(ctx context.Context, list *models.DistributionList) error {
+	if _, err := r.lists.InsertOne(ctx, list); err != nil {
+		return fmt.Errorf("error creating distribution list: %w", err)
+	}
+	return nil
+}
+
+// GetList retrieves a list of a tenant by ID
+func (r *DistributionListRepository) GetList(ctx context.Context, tenantID, id string) (*models.DistributionList, error) {
+	return r.findList(ctx, bson.M{"_id": id, "tenant_id": tenantMatch(tenantID)})
+}
+
+// GetListAnyTenant retrieves a list by ID whatever its tenant, for sends
+// whose tenant was checked when they were requested
+func (r *DistributionListRepository) GetListAnyTenant(ctx context.Context, id string) (*models.DistributionList, error) {
+	return r.findList(ctx, bson.M{"_id": id})
+}
+
+func (r *DistributionListRepository) findList(ctx context.Context, filter bson.M) (*models.DistributionList, error) {
+	var list models.DistributionList
+	err := r.lists.FindOne(ctx, filter).Decode(&list)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrDistributionListNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting distribution list: %w", err)
+	}
+	return &list, nil
+}
+
+// ListLists returns up to page.FetchLimit() lists matching filters, newest
+// first, after page.After in cursor mode or skipping page.Offset in page mode
+func (r *DistributionListRepository) ListLists(ctx context.Context, filters DistributionListFilters, page pagination.Request) ([]*models.DistributionList, error) {
+	query := distributionListFilter(filters)
+	if page.After != nil {
+		query = pagination.And(query, pagination.After("created_at", true, page.After, page.After.ID))
+	}
+
+	opts := options.Find().
+		SetSort(pagination.Sort("created_at", true)).
+		SetLimit(int64(page.FetchLimit())).
+		SetSkip(int64(page.Offset))
+	cursor, err := r.lists.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing distribution lists: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	lists := []*models.DistributionList{}
+	if err := cursor.All(ctx, &lists); err != nil {
+		return nil, fmt.Errorf("error decoding distribution lists: %w", err)
+	}
+	return lists, nil
+}
+
+// CountLists counts the lists matching filters
+func (r *DistributionListRepository) CountLists(ctx context.Context, filters DistributionListFilters) (int64, error) {
+	count, err := r.lists.CountDocuments(ctx, distributionListFilter(filters))
+	if err != nil {
+		return 0, fmt.Errorf("error counting distribution lists: %w", err)
+	}
+	return count, nil
+}
+
+func distributionListFilter(filters DistributionListFilters) bson.M {
+	query := bson.M{"tenant_id": tenantMatch(filters.TenantID)}
+	if !filters.IncludeArchived {
+		query["status"] = models.DistributionListStatusActive
+	}
+	if filters.Search != "" {
+		query["name"] = bson.M{"$regex": regexp.QuoteMeta(filters.Search), "$options": "i"}
+	}
+	if filters.ScopeOwnerIDs != nil {
+		query["owner_id"] = bson.M{"$in": filters.ScopeOwnerIDs}
+	}
+	return query
+}
+
+// UpdateList applies the given fields of update to a list of a tenant and
+// returns it updated
+func (r *DistributionListRepository) UpdateList(ctx context.Context, tenantID, id string, update *models.UpdateDistributionListRequest, at time.Time) (*models.DistributionList, error) {
+	setFields := bson.M{"updated_at": at}
+	unsetFields := bson.M{}
+	if update.Name != nil {
+		setFields["name"] = *update.Name
+	}
+	if update.Description != nil {
+		setFields["description"] = *update.Description
+	}
+	if update.Archived != nil {
+		if *update.Archived {
+			setFields["status"] = models.DistributionListStatusArchived
+			setFields["archived_at"] = at
+		} else {
+			setFields["status"] = models.DistributionListStatusActive
+			unsetFields["archived_at"] = ""
+		}
+	}
+	updateDoc := bson.M{"$set": setFields}
+	if len(unsetFields) > 0 {
+		updateDoc["$unset"] = unsetFields
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var list models.DistributionList
+	err := r.lists.FindOneAndUpdate(ctx, bson.M{"_id": id, "tenant_id": tenantID}, updateDoc, opts).Decode(&list)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrDistributionListNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating distribution list: %w", err)
+	}
+	return &list, nil
+}
+
+// DeleteList deletes a list of a tenant and its members
+func (r *DistributionListRepository) DeleteList(ctx context.Context, tenantID, id string) error {
+	result, err := r.lists.DeleteOne(ctx, bson.M{"_id": id, "tenant_id": tenantID})
+	if err != nil {
+		return fmt.Errorf("error deleting distribution list: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrDistributionListNotFound)
+	}
+	if _, err := r.members.DeleteMany(ctx, bson.M{"list_id": id}); err != nil {
+		return fmt.Errorf("error deleting distribution list members: %w", err)
+	}
+	return nil
+}
+
+// AddMembers adds members to a list, keeping those already in it, and
+// returns how many were added. The list's member count is refreshed.
+func (r *DistributionListRepository) AddMembers(ctx context.Context, listID string, members []models.DistributionListMemberInput, addedBy string, at time.Time) (int, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	writes := make([]mongo.WriteModel, len(members))
+	for i, member := range members {
+		doc := models.DistributionListMember{
+			ID:      DistributionListMemberID(listID, member),
+			ListID:  listID,
+			UserID:  member.UserID,
+			AddedBy: addedBy,
+			AddedAt: at,
+		}
+		if member.UserID == "" {
+			doc.Email = normalizeEmail(member.Email)
+		}
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$setOnInsert": doc}).
+			SetUpsert(true)
+	}
+
+	result, err := r.members.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, fmt.Errorf("error adding distribution list members: %w", err)
+	}
+	return int(result.UpsertedCount), r.refreshMemberCount(ctx, listID, at)
+}
+
+// RemoveMembers removes members from a list and returns how many were in it.
+// The list's member count is refreshed.
+func (r *DistributionListRepository) RemoveMembers(ctx context.Context, listID string, members []models.DistributionListMemberInput, at time.Time) (int, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(members))
+	for i, member := range members {
+		ids[i] = DistributionListMemberID(listID, member)
+	}
+
+	result, err := r.members.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("error removing distribution list members: %w", err)
+	}
+	return int(result.DeletedCount), r.refreshMemberCount(ctx, listID, at)
+}
+
+// refreshMemberCount sets a list's member count from its member documents
+func (r *DistributionListRepository) refreshMemberCount(ctx context.Context, listID string, at time.Time) error {
+	count, err := r.CountMembers(ctx, listID)
+	if err != nil {
+		return err
+	}
+	_, err = r.lists.UpdateOne(ctx, bson.M{"_id": listID}, bson.M{"$set": bson.M{"member_count": count, "updated_at": at}})
+	if err != nil {
+		return fmt.Errorf("error updating distribution list member count: %w", err)
+	}
+	return nil
+}
+
+// CountMembers counts the members of a list
+func (r *DistributionListRepository) CountMembers(ctx context.Context, listID string) (int64, error) {
+	count, err := r.members.CountDocuments(ctx, bson.M{"list_id": listID})
+	if err != nil {
+		return 0, fmt.Errorf("error counting distribution list members: %w", err)
+	}
+	return count, nil
+}
+
+// ListMembers returns up to page.FetchLimit() members of a list in the order
+// they were added, after page.After in cursor mode or skipping page.Offset
+// in page mode
+func (r *DistributionListRepository) ListMembers(ctx context.Context, listID string, page pagination.Request) ([]*models.DistributionListMember, error) {
+	query := bson.M{"list_id": listID}
+	if page.After != nil {
+		query = pagination.And(query, pagination.After("added_at", false, page.After, page.After.ID))
+	}
+
+	opts := options.Find().
+		SetSort(pagination.Sort("added_at", false)).
+		SetLimit(int64(page.FetchLimit())).
+		SetSkip(int64(page.Offset))
+	return r.findMembers(ctx, query, opts)
+}
+
+// AllMembers returns every member of a list in the order they were added.
+// Lists hold at most models.MaxDistributionListMembers members.
+func (r *DistributionListRepository) AllMembers(ctx context.Context, listID string) ([]*models.DistributionListMember, error) {
+	return r.findMembers(ctx, bson.M{"list_id": listID}, options.Find().SetSort(pagination.Sort("added_at", false)))
+}
+
+func (r *DistributionListRepository) findMembers(ctx context.Context, query bson.M, opts *options.FindOptions) ([]*models.DistributionListMember, error) {
+	cursor, err := r.members.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing distribution list members: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	members := []*models.DistributionListMember{}
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, fmt.Errorf("error decoding distribution list members: %w", err)
+	}
+	return members, nil
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmailSuppressionRepository stores addresses outgoing email must skip, keyed
+// by the lower-cased address
+type EmailSuppressionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewEmailSuppressionRepository creates a new EmailSuppressionRepository
+func NewEmailSuppressionRepository(client *mongodb.Client) *EmailSuppressionRepository {
+	return &EmailSuppressionRepository{
+		collection: client.Collection("email_suppressions"),
+	}
+}
+
+// Suppress adds an address to the suppression list. Suppressing an address
+// that is already listed keeps the original entry.
+func (r *EmailSuppressionRepository) Suppress(ctx context.Context, s *models.EmailSuppression) error {
+	s.Email = normalizeEmail(s.Email)
+	if s.Email == "" {
+		return fmt.Errorf("email is required")
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": s.Email},
+		bson.M{"$setOnInsert": s},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("error suppressing email: %w", err)
+	}
+	return nil
+}
+
+// FilterSuppressed returns the addresses of addrs that are suppressed
+func (r *EmailSuppressionRepository) FilterSuppressed(ctx context.Context, addrs []string) ([]string, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr = normalizeEmail(addr); addr != "" {
+			normalized = append(normalized, addr)
+		}
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": normalized}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error checking suppressions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var found []struct {
+		Email string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("error decoding suppressions: %w", err)
+	}
+
+	suppressed := make([]string, len(found))
+	for i, f := range found {
+		suppressed[i] = f.Email
+	}
+	return suppressed, nil
+}
+
+// normalizeEmail lower-cases an address and strips surrounding space
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmailUsageRepository counts outbound emails per quota period, one document
+// per period
+type EmailUsageRepository struct {
+	collection *mongo.Collection
+}
+
+// NewEmailUsageRepository creates a new EmailUsageRepository
+func NewEmailUsageRepository(client *mongodb.Client) *EmailUsageRepository {
+	return &EmailUsageRepository{
+		collection: client.Collection("email_usage"),
+	}
+}
+
+// IncrementEmailUsage atomically adds n sent emails to the period starting at
+// start and returns the updated usage
+func (r *EmailUsageRepository) IncrementEmailUsage(ctx context.Context, period string, start time.Time, n int64, at time.Time) (*models.EmailUsage, error) {
+	update := bson.M{
+		"$inc":         bson.M{"sent": n},
+		"$set":         bson.M{"updated_at": at},
+		"$setOnInsert": bson.M{"period": period, "start": start},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var usage models.EmailUsage
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": models.EmailUsageID(period, start)}, update, opts).Decode(&usage)
+	if err != nil {
+		return nil, fmt.Errorf("error incrementing email usage: %w", err)
+	}
+	return &usage, nil
+}
+
+// GetEmailUsage returns the usage of the period starting at start, which is
+// zero when nothing was sent in it yet
+func (r *EmailUsageRepository) GetEmailUsage(ctx context.Context, period string, start time.Time) (*models.EmailUsage, error) {
+	id := models.EmailUsageID(period, start)
+	var usage models.EmailUsage
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&usage)
+	if err == mongo.ErrNoDocuments {
+		return &models.EmailUsage{ID: id, Period: period, Start: start}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting email usage: %w", err)
+	}
+	return &usage, nil
+}
+
+// ClaimUsageAlert marks the usage alert of the period starting at start sent.
+// It returns false when the alert was already sent, so only one caller sends
+// it however many instances cross the threshold at once.
+func (r *EmailUsageRepository) ClaimUsageAlert(ctx context.Context, period string, start time.Time, at time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": models.EmailUsageID(period, start), "alert_sent_at": nil},
+		bson.M{"$set": bson.M{"alert_sent_at": at}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error claiming email usage alert: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
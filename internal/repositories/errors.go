@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -36,14 +37,70 @@ var (
 	// ErrCommunicationNotFound is returned when a communication is not found
 	ErrCommunicationNotFound = errors.New("communication not found")
 
+	// ErrAttachmentNotFound is returned when a message attachment is not found
+	ErrAttachmentNotFound = errors.New("attachment not found")
+
 	// ErrUserNotFound is returned when a user is not found
 	ErrUserNotFound = errors.New("user not found")
 
 	// ErrTemplateNotFound is returned when a template is not found
 	ErrTemplateNotFound = errors.New("template not found")
 
+	// ErrNotificationNotFound is returned when a notification is not found
+	ErrNotificationNotFound = errors.New("notification not found")
+
+	// ErrReportRunNotFound is returned when a report run is not found
+	ErrReportRunNotFound = errors.New("report run not found")
+
+	// ErrSSOStateNotFound is returned when an SSO state is unknown, expired or already used
+	ErrSSOStateNotFound = errors.New("SSO state not found")
+
+	// ErrWebhookNotFound is returned when a webhook subscription is not found
+	ErrWebhookNotFound = errors.New("webhook subscription not found")
+
+	// ErrImpersonationNotFound is returned when an impersonation session is not found
+	ErrImpersonationNotFound = errors.New("impersonation session not found")
+
+	// ErrReferenceEntryNotFound is returned when a region or team is not found
+	ErrReferenceEntryNotFound = errors.New("reference entry not found")
+
 	// ErrCampaignNotFound is returned when a campaign is not found
 	ErrCampaignNotFound = errors.New("campaign not found")
+
+	// ErrUserImportNotFound is returned when a user import job is not found
+	ErrUserImportNotFound = errors.New("user import not found")
+
+	// ErrOutboxEventNotFound is returned when an outbox event is not found
+	// or was published too long ago to be kept
+	ErrOutboxEventNotFound = errors.New("event not found")
+
+	// ErrEventReplayJobNotFound is returned when an event replay job is not found
+	ErrEventReplayJobNotFound = errors.New("event replay job not found")
+
+	// ErrRoleNotFound is returned when a role is not found or was deleted
+	ErrRoleNotFound = errors.New("role not found")
+
+	// ErrDeletionRequestNotFound is returned when an account deletion
+	// request is not found or is no longer pending
+	ErrDeletionRequestNotFound = errors.New("account deletion request not found")
+
+	// ErrDistributionListNotFound is returned when a distribution list is not found
+	ErrDistributionListNotFound = errors.New("distribution list not found")
+
+	// ErrVersionConflict is returned when an update names a version that is
+	// no longer the stored one
+	ErrVersionConflict = errors.New("version conflict")
+
+	// ErrInvitationExpired is returned when an invitation is accepted after
+	// it expired
+	ErrInvitationExpired = errors.New("invitation has expired")
+
+	// ErrTwoFactorCodeNotFound is returned when a 2FA sign-in code is
+	// unknown or was already used
+	ErrTwoFactorCodeNotFound = errors.New("2FA code not found")
+
+	// ErrTenantRequired is returned when a tenant-scoped query has no tenant ID
+	ErrTenantRequired = errors.New("tenant ID is required")
 )
 
 // IsNotFound checks if an error is a not found error
@@ -75,6 +132,11 @@ func IsCommunicationNotFound(err error) bool {
 	return errors.Is(err, ErrCommunicationNotFound)
 }
 
+// IsAttachmentNotFound checks if an error indicates an attachment was not found
+func IsAttachmentNotFound(err error) bool {
+	return errors.Is(err, ErrAttachmentNotFound)
+}
+
 // IsUserNotFound checks if an error indicates a user was not found
 func IsUserNotFound(err error) bool {
 	return errors.Is(err, ErrUserNotFound)
@@ -85,6 +147,15 @@ func IsTemplateNotFound(err error) bool {
 	return errors.Is(err, ErrTemplateNotFound)
 }
 
+// VersionFilter matches a stored version. Documents written before
+// versioning have none and count as version 0.
+func VersionFilter(version int) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
 func WrapNotFound(err error, domainErr error) error {
 	if err == nil {
 		return nil
@@ -0,0 +1,360 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// publishedEventRetention is how long relayed events are kept for inspection
+const publishedEventRetention = 7 * 24 * time.Hour
+
+// eventReplayJobRetention is how long finished replay jobs are kept
+const eventReplayJobRetention = 30 * 24 * time.Hour
+
+// eventAttemptHistory is how many delivery attempts an event keeps
+const eventAttemptHistory = 20
+
+// lastEventSequence keeps sequences strictly increasing within the process
+var lastEventSequence atomic.Int64
+
+// ErrOutboxEventNotReplayable is returned when replaying an event that is
+// still waiting for the relay
+var ErrOutboxEventNotReplayable = errors.New("event is still pending")
+
+// EventOutboxRepository records domain events for the outbox relay
+type EventOutboxRepository struct {
+	collection *mongo.Collection
+	replayJobs *mongo.Collection
+}
+
+// NewEventOutboxRepository creates a new EventOutboxRepository
+func NewEventOutboxRepository(client *mongodb.Client) *EventOutboxRepository {
+	return &EventOutboxRepository{
+		collection: client.Collection("events_outbox"),
+		replayJobs: client.Collection("event_replay_jobs"),
+	}
+}
+
+// RecordWithID stores an event whose payload already carries eventID
+func (r *EventOutboxRepository) RecordWithID(ctx context.Context, eventID, topic, key string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", topic, err)
+	}
+
+	// The type is kept beside the payload so events can be listed by it
+	var envelope struct {
+		EventType string `json:"event_type"`
+	}
+	_ = json.Unmarshal(data, &envelope)
+
+	event := &models.OutboxEvent{
+		ID:        eventID,
+		Topic:     topic,
+		EventType: envelope.EventType,
+		Key:       key,
+		Payload:   string(data),
+		Sequence:  nextEventSequence(),
+		CreatedAt: time.Now(),
+	}
+	if _, err := r.collection.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("error recording %s event: %w", topic, err)
+	}
+	return nil
+}
+
+// ListUnpublished returns up to limit pending events, oldest first. Failed
+// events are left out until they are replayed.
+func (r *EventOutboxRepository) ListUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "sequence", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"published_at": nil, "failed_at": nil}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing unpublished events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []*models.OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("error decoding events: %w", err)
+	}
+	return events, nil
+}
+
+// ListEventsBetween returns up to limit events of the given topics recorded
+// with a sequence in (after, until], in sequence order. Consumers other than
+// the Kafka relay keep their own position in the outbox with it.
+func (r *EventOutboxRepository) ListEventsBetween(ctx context.Context, after, until int64, topics []string, limit int) ([]*models.OutboxEvent, error) {
+	filter := bson.M{
+		"sequence": bson.M{"$gt": after, "$lte": until},
+		"topic":    bson.M{"$in": topics},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "sequence", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []*models.OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("error decoding events: %w", err)
+	}
+	return events, nil
+}
+
+// MarkPublished records that an event was delivered to Kafka
+func (r *EventOutboxRepository) MarkPublished(ctx context.Context, eventID string) error {
+	now := time.Now()
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": eventID},
+		bson.M{
+			"$set":  bson.M{"published_at": now},
+			"$inc":  bson.M{"attempts": 1},
+			"$push": attemptPush(models.OutboxDeliveryAttempt{At: now}),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error marking event published: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed publish attempt. The event stays pending,
+// unless setAside marks it failed so the relay moves past it.
+func (r *EventOutboxRepository) MarkFailed(ctx context.Context, eventID string, cause error, setAside bool) error {
+	now := time.Now()
+	set := bson.M{"last_error": cause.Error()}
+	if setAside {
+		set["failed_at"] = now
+	}
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": eventID},
+		bson.M{
+			"$set":  set,
+			"$inc":  bson.M{"attempts": 1},
+			"$push": attemptPush(models.OutboxDeliveryAttempt{At: now, Error: cause.Error()}),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error recording event failure: %w", err)
+	}
+	return nil
+}
+
+// attemptPush appends attempt to an event's history, keeping the latest
+// eventAttemptHistory
+func attemptPush(attempt models.OutboxDeliveryAttempt) bson.M {
+	return bson.M{"delivery_attempts": bson.M{"$each": []models.OutboxDeliveryAttempt{attempt}, "$slice": -eventAttemptHistory}}
+}
+
+// ListEvents returns the events matching filter, newest first and without
+// their payload and attempts, along with the number of matches ignoring
+// pagination
+func (r *EventOutboxRepository) ListEvents(ctx context.Context, filter models.OutboxEventFilter, limit, offset int) ([]*models.OutboxEvent, int64, error) {
+	query := outboxEventQuery(filter)
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting events: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "sequence", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"payload": 0, "delivery_attempts": 0})
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []*models.OutboxEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, fmt.Errorf("error decoding events: %w", err)
+	}
+	for _, event := range events {
+		event.Status = event.DeliveryStatus()
+	}
+	return events, total, nil
+}
+
+// outboxEventQuery builds the query of an event listing
+func outboxEventQuery(filter models.OutboxEventFilter) bson.M {
+	query := bson.M{}
+	switch filter.Status {
+	case models.OutboxEventPending:
+		query["published_at"] = nil
+		query["failed_at"] = nil
+	case models.OutboxEventFailed:
+		query["published_at"] = nil
+		query["failed_at"] = bson.M{"$ne": nil}
+	case models.OutboxEventPublished:
+		query["published_at"] = bson.M{"$ne": nil}
+	}
+	if filter.Topic != "" {
+		query["topic"] = filter.Topic
+	}
+	if filter.EventType != "" {
+		query["event_type"] = filter.EventType
+	}
+	created := bson.M{}
+	if filter.From != nil {
+		created["$gte"] = *filter.From
+	}
+	if filter.To != nil {
+		created["$lt"] = *filter.To
+	}
+	if len(created) > 0 {
+		query["created_at"] = created
+	}
+	return query
+}
+
+// GetEvent returns an event with its payload and delivery attempts
+func (r *EventOutboxRepository) GetEvent(ctx context.Context, eventID string) (*models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	if err := r.collection.FindOne(ctx, bson.M{"_id": eventID}).Decode(&event); err != nil {
+		return nil, WrapNotFound(err, ErrOutboxEventNotFound)
+	}
+	event.Status = event.DeliveryStatus()
+	return &event, nil
+}
+
+// Requeue puts a failed or published event back in front of the relay
+// under its own ID, with a fresh attempt budget. It returns
+// ErrOutboxEventNotReplayable while the event is pending.
+func (r *EventOutboxRepository) Requeue(ctx context.Context, eventID, replayedBy string) (*models.OutboxEvent, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var event models.OutboxEvent
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id": eventID,
+			"$or": bson.A{
+				bson.M{"published_at": bson.M{"$ne": nil}},
+				bson.M{"failed_at": bson.M{"$ne": nil}},
+			},
+		},
+		bson.M{
+			"$set":   bson.M{"attempts": 0, "last_replayed_at": time.Now(), "last_replayed_by": replayedBy},
+			"$unset": bson.M{"published_at": "", "failed_at": "", "last_error": ""},
+			"$inc":   bson.M{"replays": 1},
+		},
+		opts,
+	).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		if _, getErr := r.GetEvent(ctx, eventID); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrOutboxEventNotReplayable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error requeueing event: %w", err)
+	}
+	event.Status = event.DeliveryStatus()
+	return &event, nil
+}
+
+// ListFailedIDs returns the IDs of up to limit failed events recorded in
+// [from, to), oldest first
+func (r *EventOutboxRepository) ListFailedIDs(ctx context.Context, from, to time.Time, limit int) ([]string, error) {
+	query := outboxEventQuery(models.OutboxEventFilter{Status: models.OutboxEventFailed, From: &from, To: &to})
+	opts := options.Find().
+		SetSort(bson.D{{Key: "sequence", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing failed events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("error decoding failed events: %w", err)
+	}
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+	return ids, nil
+}
+
+// CreateReplayJob stores a new event replay job
+func (r *EventOutboxRepository) CreateReplayJob(ctx context.Context, job *models.EventReplayJob) error {
+	if _, err := r.replayJobs.InsertOne(ctx, job); err != nil {
+		return fmt.Errorf("error creating event replay job: %w", err)
+	}
+	return nil
+}
+
+// SaveReplayJob saves the progress of a replay job
+func (r *EventOutboxRepository) SaveReplayJob(ctx context.Context, job *models.EventReplayJob) error {
+	if _, err := r.replayJobs.ReplaceOne(ctx, bson.M{"_id": job.ID}, job); err != nil {
+		return fmt.Errorf("error saving event replay job: %w", err)
+	}
+	return nil
+}
+
+// GetReplayJob returns a replay job
+func (r *EventOutboxRepository) GetReplayJob(ctx context.Context, jobID string) (*models.EventReplayJob, error) {
+	var job models.EventReplayJob
+	if err := r.replayJobs.FindOne(ctx, bson.M{"_id": jobID}).Decode(&job); err != nil {
+		return nil, WrapNotFound(err, ErrEventReplayJobNotFound)
+	}
+	return &job, nil
+}
+
+// EnsureIndexes creates the relay's ordering index and the indexes of the
+// admin listings, and expires published events after publishedEventRetention
+// and replay jobs after eventReplayJobRetention
+func (r *EventOutboxRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "sequence", Value: 1}}},
+		{Keys: bson.D{{Key: "sequence", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(publishedEventRetention.Seconds())).SetName("published_at_ttl"),
+		},
+		{
+			Keys:    bson.D{{Key: "failed_at", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{Keys: bson.D{{Key: "topic", Value: 1}, {Key: "sequence", Value: -1}}},
+		{Keys: bson.D{{Key: "event_type", Value: 1}, {Key: "sequence", Value: -1}}},
+	}
+	if err := createIndexes(ctx, r.collection, indexes); err != nil {
+		return err
+	}
+	return createIndexes(ctx, r.replayJobs, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(eventReplayJobRetention.Seconds())).SetName("created_at_ttl"),
+	}})
+}
+
+// nextEventSequence returns the current time in nanoseconds, bumped past the
+// previous sequence when the clock hasn't moved
+func nextEventSequence() int64 {
+	for {
+		last := lastEventSequence.Load()
+		next := max(time.Now().UnixNano(), last+1)
+		if lastEventSequence.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
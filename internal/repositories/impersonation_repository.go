@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ImpersonationRepository stores impersonation sessions
+type ImpersonationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewImpersonationRepository creates a new ImpersonationRepository
+func NewImpersonationRepository(client *mongodb.Client) *ImpersonationRepository {
+	return &ImpersonationRepository{
+		collection: client.Collection("impersonation_sessions"),
+	}
+}
+
+// EnsureIndexes creates the index used to find an operator's sessions
+func (r *ImpersonationRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, r.collection, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "target_user_id", Value: 1}, {Key: "expires_at", Value: -1}}},
+	})
+}
+
+// CreateImpersonation stores a new impersonation session
+func (r *ImpersonationRepository) CreateImpersonation(ctx context.Context, session *models.ImpersonationSession) error {
+	if _, err := r.collection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("error creating impersonation session: %w", err)
+	}
+	return nil
+}
+
+// GetImpersonation retrieves an impersonation session by ID
+func (r *ImpersonationRepository) GetImpersonation(ctx context.Context, id string) (*models.ImpersonationSession, error) {
+	var session models.ImpersonationSession
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrImpersonationNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting impersonation session: %w", err)
+	}
+	return &session, nil
+}
+
+// ListActiveImpersonations returns the sessions of an operator as a user
+// that have not ended or expired
+func (r *ImpersonationRepository) ListActiveImpersonations(ctx context.Context, actorID, targetUserID string, now time.Time) ([]*models.ImpersonationSession, error) {
+	filter := bson.M{
+		"actor_id":       actorID,
+		"target_user_id": targetUserID,
+		"expires_at":     bson.M{"$gt": now},
+		"ended_at":       bson.M{"$exists": false},
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing impersonation sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*models.ImpersonationSession{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("error decoding impersonation sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// EndImpersonation ends a session early. It returns false when the session
+// had already ended.
+func (r *ImpersonationRepository) EndImpersonation(ctx context.Context, id string, at time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "ended_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"ended_at": at}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error ending impersonation session: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
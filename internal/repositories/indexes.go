@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InitIndexes creates the indexes of every repository. Each index is created
+// on its own, so one failure (such as a unique index over existing
+// duplicates) is logged and the rest are still created; all failures are
+// returned together.
+func InitIndexes(ctx context.Context, client *mongodb.Client) error {
+	var errs []error
+	ensure := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	ensure(NewMongoUserRepository(client).EnsureIndexes(ctx))
+	ensure(NewSettingsRepository(client).EnsureIndexes(ctx))
+	ensure(NewPermissionRepository(client).EnsureIndexes(ctx))
+	ensure(NewMongoEmailRepository(client).EnsureIndexes(ctx))
+	ensure(NewMongoTemplateRepository(client).EnsureIndexes(ctx))
+	ensure(NewTemplateStatsRepository(client).EnsureIndexes(ctx))
+	ensure(NewMongoActivityRepository(client).EnsureIndexes(ctx))
+	ensure(NewScheduleDefinitionRepository(client).EnsureIndexes(ctx))
+	ensure(NewEventOutboxRepository(client).EnsureIndexes(ctx))
+	ensure(NewNotificationRepository(client).EnsureIndexes(ctx))
+	ensure(NewPendingNotificationRepository(client).EnsureIndexes(ctx))
+	ensure(NewSSOStateRepository(client).EnsureIndexes(ctx))
+	ensure(NewImpersonationRepository(client).EnsureIndexes(ctx))
+	ensure(NewWebhookRepository(client).EnsureIndexes(ctx))
+	ensure(NewReferenceDataRepository(client).EnsureIndexes(ctx))
+	ensure(NewLoginHistoryRepository(client).EnsureIndexes(ctx))
+	ensure(NewUserImportRepository(client).EnsureIndexes(ctx))
+	ensure(NewAccountDeletionRepository(client).EnsureIndexes(ctx))
+	ensure(NewPermissionDenialRepository(client).EnsureIndexes(ctx))
+	ensure(NewDistributionListRepository(client).EnsureIndexes(ctx))
+
+	ensure(NewTwoFactorCodeRepository(client).EnsureIndexes(ctx))
+
+	return errors.Join(errs...)
+}
+
+// createIndexes creates indexes on a collection one at a time, logging each
+// failure and carrying on with the next index
+func createIndexes(ctx context.Context, collection *mongo.Collection, indexes []mongo.IndexModel) error {
+	var errs []error
+	for _, index := range indexes {
+		name := indexName(index)
+		if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+			log.Printf("Warning: failed to create index %s on %s: %v", name, collection.Name(), err)
+			errs = append(errs, fmt.Errorf("index %s on %s: %w", name, collection.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// indexName returns an index's explicit name or the name MongoDB generates
+// from its keys, e.g. user_id_1_created_at_-1
+func indexName(index mongo.IndexModel) string {
+	if index.Options != nil && index.Options.Name != nil {
+		return *index.Options.Name
+	}
+	keys, ok := index.Keys.(bson.D)
+	if !ok {
+		return fmt.Sprint(index.Keys)
+	}
+	parts := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// loginHistoryRetention is how long sign-in attempts are kept
+const loginHistoryRetention = 90 * 24 * time.Hour
+
+// LoginHistoryRepository stores the sign-in attempts of every user
+type LoginHistoryRepository struct {
+	collection *mongo.Collection
+}
+
+// NewLoginHistoryRepository creates a new LoginHistoryRepository
+func NewLoginHistoryRepository(client *mongodb.Client) *LoginHistoryRepository {
+	return &LoginHistoryRepository{
+		collection: client.Collection("login_history"),
+	}
+}
+
+// EnsureIndexes creates the history and device indexes and the retention TTL
+// index
+func (r *LoginHistoryRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "user_agent", Value: 1}, {Key: "success", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "timestamp", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(loginHistoryRetention.Seconds())).SetName("timestamp_ttl"),
+		},
+	}
+	return createIndexes(ctx, r.collection, indexes)
+}
+
+// CreateLoginRecord stores a sign-in attempt
+func (r *LoginHistoryRepository) CreateLoginRecord(ctx context.Context, record *models.LoginRecord) error {
+	if _, err := r.collection.InsertOne(ctx, record); err != nil {
+		return fmt.Errorf("error creating login record: %w", err)
+	}
+	return nil
+}
+
+// ListLoginHistory returns up to page.FetchLimit() sign-in attempts of a user
+// matching filter, newest first, after page.After in cursor mode or skipping
+// page.Offset in page mode
+func (r *LoginHistoryRepository) ListLoginHistory(ctx context.Context, userID string, filter models.LoginHistoryFilter, page pagination.Request) ([]models.LoginRecord, error) {
+	query := loginHistoryFilter(userID, filter)
+	if page.After != nil {
+		id, err := page.After.ObjectID()
+		if err != nil {
+			return nil, err
+		}
+		query = pagination.And(query, pagination.After("timestamp", true, page.After, id))
+	}
+
+	opts := options.Find().
+		SetSort(pagination.Sort("timestamp", true)).
+		SetLimit(int64(page.FetchLimit())).
+		SetSkip(int64(page.Offset))
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing login history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	records := []models.LoginRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("error decoding login history: %w", err)
+	}
+	return records, nil
+}
+
+// CountLoginHistory counts the sign-in attempts of a user matching filter
+func (r *LoginHistoryRepository) CountLoginHistory(ctx context.Context, userID string, filter models.LoginHistoryFilter) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, loginHistoryFilter(userID, filter))
+	if err != nil {
+		return 0, fmt.Errorf("error counting login history: %w", err)
+	}
+	return count, nil
+}
+
+// HasSuccessfulLogin reports whether a user signed in successfully with
+// userAgent within the retention period, or with any client when userAgent
+// is empty
+func (r *LoginHistoryRepository) HasSuccessfulLogin(ctx context.Context, userID, userAgent string) (bool, error) {
+	filter := bson.M{"user_id": userID, "success": true}
+	if userAgent != "" {
+		filter["user_agent"] = userAgent
+	}
+	err := r.collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking login history: %w", err)
+	}
+	return true, nil
+}
+
+// loginHistoryFilter matches the sign-in attempts of userID narrowed by filter
+func loginHistoryFilter(userID string, filter models.LoginHistoryFilter) bson.M {
+	query := bson.M{"user_id": userID}
+	if filter.Success != nil {
+		query["success"] = *filter.Success
+	}
+	if filter.From != nil || filter.To != nil {
+		timestamp := bson.M{}
+		if filter.From != nil {
+			timestamp["$gte"] = *filter.From
+		}
+		if filter.To != nil {
+			timestamp["$lt"] = *filter.To
+		}
+		query["timestamp"] = timestamp
+	}
+	return query
+}
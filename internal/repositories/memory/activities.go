@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.ActivityStore = (*ActivityStore)(nil)
+
+// ActivityStore keeps activity timeline entries in memory, in the order
+// they were created
+type ActivityStore struct {
+	mu         sync.RWMutex
+	activities []models.Activity
+}
+
+// NewActivityStore creates an empty ActivityStore
+func NewActivityStore() *ActivityStore {
+	return &ActivityStore{}
+}
+
+// CreateActivity stores an activity
+func (s *ActivityStore) CreateActivity(ctx context.Context, activity *models.Activity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activities = append(s.activities, *activity)
+	return nil
+}
+
+// Activities returns the stored activities, oldest first
+func (s *ActivityStore) Activities() []models.Activity {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.Activity(nil), s.activities...)
+}
@@ -0,0 +1,270 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.DistributionListStore = (*DistributionListStore)(nil)
+
+// DistributionListStore keeps distribution lists and their members in
+// memory with the tenant, ordering and dedupe rules of
+// DistributionListRepository
+type DistributionListStore struct {
+	mu      sync.RWMutex
+	lists   map[string]*models.DistributionList
+	members map[string]*models.DistributionListMember // By DistributionListMemberID
+}
+
+// NewDistributionListStore creates an empty DistributionListStore
+func NewDistributionListStore() *DistributionListStore {
+	return &DistributionListStore{
+		lists:   make(map[string]*models.DistributionList),
+		members: make(map[string]*models.DistributionListMember),
+	}
+}
+
+// CreateList stores a new list
+func (s *DistributionListStore) CreateList(ctx context.Context, list *models.DistributionList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lists[list.ID]; ok {
+		return fmt.Errorf("error creating distribution list: %s exists", list.ID)
+	}
+	copied := *list
+	s.lists[list.ID] = &copied
+	return nil
+}
+
+// GetList retrieves a list of a tenant by ID
+func (s *DistributionListStore) GetList(ctx context.Context, tenantID, id string) (*models.DistributionList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := s.inTenant(tenantID, id)
+	if list == nil {
+		return nil, notFound(repositories.ErrDistributionListNotFound)
+	}
+	copied := *list
+	return &copied, nil
+}
+
+// GetListAnyTenant retrieves a list by ID whatever its tenant
+func (s *DistributionListStore) GetListAnyTenant(ctx context.Context, id string) (*models.DistributionList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, ok := s.lists[id]
+	if !ok {
+		return nil, notFound(repositories.ErrDistributionListNotFound)
+	}
+	copied := *list
+	return &copied, nil
+}
+
+// ListLists returns up to page.FetchLimit() lists matching filters, newest
+// first, after page.After or skipping page.Offset
+func (s *DistributionListStore) ListLists(ctx context.Context, filters repositories.DistributionListFilters, p pagination.Request) ([]*models.DistributionList, error) {
+	var lists []*models.DistributionList
+	for _, list := range s.matching(filters) {
+		if p.After == nil || p.After.Follows(list.CreatedAt, list.ID, true) {
+			lists = append(lists, list)
+		}
+	}
+
+	sort.Slice(lists, func(i, j int) bool {
+		if !lists[i].CreatedAt.Equal(lists[j].CreatedAt) {
+			return lists[i].CreatedAt.After(lists[j].CreatedAt)
+		}
+		return lists[i].ID > lists[j].ID
+	})
+	start, end := page(len(lists), p.Offset, p.FetchLimit())
+	return append([]*models.DistributionList{}, lists[start:end]...), nil
+}
+
+// CountLists counts the lists matching filters
+func (s *DistributionListStore) CountLists(ctx context.Context, filters repositories.DistributionListFilters) (int64, error) {
+	return int64(len(s.matching(filters))), nil
+}
+
+// UpdateList applies the given fields of update to a list of a tenant and
+// returns it updated
+func (s *DistributionListStore) UpdateList(ctx context.Context, tenantID, id string, update *models.UpdateDistributionListRequest, at time.Time) (*models.DistributionList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.inTenant(tenantID, id)
+	if list == nil {
+		return nil, notFound(repositories.ErrDistributionListNotFound)
+	}
+	if update.Name != nil {
+		list.Name = *update.Name
+	}
+	if update.Description != nil {
+		list.Description = *update.Description
+	}
+	if update.Archived != nil {
+		if *update.Archived {
+			archivedAt := at
+			list.Status = models.DistributionListStatusArchived
+			list.ArchivedAt = &archivedAt
+		} else {
+			list.Status = models.DistributionListStatusActive
+			list.ArchivedAt = nil
+		}
+	}
+	list.UpdatedAt = at
+	copied := *list
+	return &copied, nil
+}
+
+// DeleteList deletes a list of a tenant and its members
+func (s *DistributionListStore) DeleteList(ctx context.Context, tenantID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inTenant(tenantID, id) == nil {
+		return notFound(repositories.ErrDistributionListNotFound)
+	}
+	delete(s.lists, id)
+	for key, member := range s.members {
+		if member.ListID == id {
+			delete(s.members, key)
+		}
+	}
+	return nil
+}
+
+// AddMembers adds members to a list, keeping those already in it, and
+// returns how many were added. The list's member count is refreshed.
+func (s *DistributionListStore) AddMembers(ctx context.Context, listID string, members []models.DistributionListMemberInput, addedBy string, at time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+	for _, member := range members {
+		id := repositories.DistributionListMemberID(listID, member)
+		if _, ok := s.members[id]; ok {
+			continue
+		}
+		stored := &models.DistributionListMember{ID: id, ListID: listID, UserID: member.UserID, AddedBy: addedBy, AddedAt: at}
+		if member.UserID == "" {
+			stored.Email = strings.ToLower(strings.TrimSpace(member.Email))
+		}
+		s.members[id] = stored
+		added++
+	}
+	s.refreshMemberCount(listID, at)
+	return added, nil
+}
+
+// RemoveMembers removes members from a list and returns how many were in
+// it. The list's member count is refreshed.
+func (s *DistributionListStore) RemoveMembers(ctx context.Context, listID string, members []models.DistributionListMemberInput, at time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for _, member := range members {
+		id := repositories.DistributionListMemberID(listID, member)
+		if _, ok := s.members[id]; ok {
+			delete(s.members, id)
+			removed++
+		}
+	}
+	s.refreshMemberCount(listID, at)
+	return removed, nil
+}
+
+// CountMembers counts the members of a list
+func (s *DistributionListStore) CountMembers(ctx context.Context, listID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.membersOf(listID))), nil
+}
+
+// ListMembers returns up to page.FetchLimit() members of a list in the order
+// they were added, after page.After or skipping page.Offset
+func (s *DistributionListStore) ListMembers(ctx context.Context, listID string, p pagination.Request) ([]*models.DistributionListMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var members []*models.DistributionListMember
+	for _, member := range s.membersOf(listID) {
+		if p.After == nil || p.After.Follows(member.AddedAt, member.ID, false) {
+			members = append(members, member)
+		}
+	}
+	start, end := page(len(members), p.Offset, p.FetchLimit())
+	return append([]*models.DistributionListMember{}, members[start:end]...), nil
+}
+
+// AllMembers returns every member of a list in the order they were added
+func (s *DistributionListStore) AllMembers(ctx context.Context, listID string) ([]*models.DistributionListMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.membersOf(listID), nil
+}
+
+// inTenant returns a tenant's stored list by ID, or nil. Lists without a
+// tenant belong to the default tenant. The caller holds the lock.
+func (s *DistributionListStore) inTenant(tenantID, id string) *models.DistributionList {
+	list, ok := s.lists[id]
+	if !ok || models.TenantOf(list.TenantID) != models.TenantOf(tenantID) {
+		return nil
+	}
+	return list
+}
+
+// matching returns copies of the lists matching filters
+func (s *DistributionListStore) matching(filters repositories.DistributionListFilters) []*models.DistributionList {
+	var search *regexp.Regexp
+	if filters.Search != "" {
+		search = regexp.MustCompile("(?i)" + regexp.QuoteMeta(filters.Search))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var lists []*models.DistributionList
+	for _, list := range s.lists {
+		switch {
+		case models.TenantOf(list.TenantID) != models.TenantOf(filters.TenantID):
+		case !filters.IncludeArchived && list.Status != models.DistributionListStatusActive:
+		case search != nil && !search.MatchString(list.Name):
+		case filters.ScopeOwnerIDs != nil && !contains(filters.ScopeOwnerIDs, list.OwnerID):
+		default:
+			copied := *list
+			lists = append(lists, &copied)
+		}
+	}
+	return lists
+}
+
+// membersOf returns copies of the members of a list sorted by when they
+// were added, then ID. The caller holds the lock.
+func (s *DistributionListStore) membersOf(listID string) []*models.DistributionListMember {
+	members := []*models.DistributionListMember{}
+	for _, member := range s.members {
+		if member.ListID == listID {
+			copied := *member
+			members = append(members, &copied)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].AddedAt.Equal(members[j].AddedAt) {
+			return members[i].AddedAt.Before(members[j].AddedAt)
+		}
+		return members[i].ID < members[j].ID
+	})
+	return members
+}
+
+// refreshMemberCount sets a list's member count from its members. The
+// caller holds the write lock.
+func (s *DistributionListStore) refreshMemberCount(listID string, at time.Time) {
+	if list, ok := s.lists[listID]; ok {
+		list.MemberCount = len(s.membersOf(listID))
+		list.UpdatedAt = at
+	}
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.EmailUsageStore = (*EmailUsageStore)(nil)
+
+// EmailUsageStore keeps outbound email usage counters in memory
+type EmailUsageStore struct {
+	mu    sync.Mutex
+	usage map[string]*models.EmailUsage
+}
+
+// NewEmailUsageStore creates an empty EmailUsageStore
+func NewEmailUsageStore() *EmailUsageStore {
+	return &EmailUsageStore{usage: make(map[string]*models.EmailUsage)}
+}
+
+// IncrementEmailUsage adds n sent emails to the period starting at start
+func (s *EmailUsageStore) IncrementEmailUsage(ctx context.Context, period string, start time.Time, n int64, at time.Time) (*models.EmailUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.get(period, start)
+	usage.Sent += n
+	usage.UpdatedAt = at
+	return cloneEmailUsage(usage), nil
+}
+
+// GetEmailUsage returns the usage of the period starting at start
+func (s *EmailUsageStore) GetEmailUsage(ctx context.Context, period string, start time.Time) (*models.EmailUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if usage, ok := s.usage[models.EmailUsageID(period, start)]; ok {
+		return cloneEmailUsage(usage), nil
+	}
+	return &models.EmailUsage{ID: models.EmailUsageID(period, start), Period: period, Start: start}, nil
+}
+
+// ClaimUsageAlert marks the usage alert of the period sent, returning false
+// when it already was. Like the MongoDB store it only claims a period that
+// has usage.
+func (s *EmailUsageStore) ClaimUsageAlert(ctx context.Context, period string, start time.Time, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage, ok := s.usage[models.EmailUsageID(period, start)]
+	if !ok || usage.AlertSentAt != nil {
+		return false, nil
+	}
+	usage.AlertSentAt = &at
+	return true, nil
+}
+
+// get returns the stored usage of a period, creating it when missing. The
+// caller holds the lock.
+func (s *EmailUsageStore) get(period string, start time.Time) *models.EmailUsage {
+	id := models.EmailUsageID(period, start)
+	usage, ok := s.usage[id]
+	if !ok {
+		usage = &models.EmailUsage{ID: id, Period: period, Start: start}
+		s.usage[id] = usage
+	}
+	return usage
+}
+
+func cloneEmailUsage(usage *models.EmailUsage) *models.EmailUsage {
+	copied := *usage
+	if usage.AlertSentAt != nil {
+		at := *usage.AlertSentAt
+		copied.AlertSentAt = &at
+	}
+	return &copied
+}
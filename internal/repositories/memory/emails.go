@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.EmailStore = (*EmailStore)(nil)
+
+// EmailStore keeps outbound emails in memory. It does not thread messages or
+// record template statistics.
+type EmailStore struct {
+	mu       sync.RWMutex
+	messages map[string]*models.MongoCommunication
+}
+
+// NewEmailStore creates an empty EmailStore
+func NewEmailStore() *EmailStore {
+	return &EmailStore{messages: make(map[string]*models.MongoCommunication)}
+}
+
+// Messages returns copies of every stored email, for inspecting what was sent
+func (s *EmailStore) Messages() []*models.MongoCommunication {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	messages := make([]*models.MongoCommunication, 0, len(s.messages))
+	for _, m := range s.messages {
+		copied := *m
+		messages = append(messages, &copied)
+	}
+	return messages
+}
+
+// CreateCommMessage stores a message the way MongoEmailRepository converts it
+func (s *EmailStore) CreateCommMessage(ctx context.Context, msg *models.CommMessage) error {
+	stored := &models.MongoCommunication{
+		ID:                 msg.MessageID,
+		ThreadID:           msg.ThreadID,
+		Channel:            msg.Channel,
+		Direction:          msg.Direction,
+		Subject:            msg.Subject,
+		Body:               msg.BodyText,
+		BodyHTML:           msg.BodyHTML,
+		Snippet:            msg.Snippet,
+		Priority:           msg.Priority,
+		Status:             msg.Status,
+		From:               msg.FromName,
+		FromEmail:          msg.FromAddress,
+		CC:                 msg.CCAddresses,
+		BCC:                msg.BCCAddresses,
+		UserID:             msg.UserID,
+		IsTest:             msg.IsTest,
+		SignatureApplied:   msg.SignatureApplied,
+		TenantID:           msg.TenantID,
+		TemplateID:         msg.TemplateID,
+		DistributionListID: msg.DistributionListID,
+		ExpiresAt:          msg.ExpiresAt,
+		Attachments:        msg.Attachments,
+		CreatedAt:          msg.CreatedAt,
+		SentAt:             msg.CreatedAt,
+		UpdatedAt:          time.Now(),
+	}
+	if len(msg.ToAddresses) > 0 {
+		stored.To = msg.ToAddresses[0]
+		stored.ToEmail = msg.ToAddresses[0]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[stored.ID] = stored
+	return nil
+}
+
+// GetMessageByID retrieves an email message by ID
+func (s *EmailStore) GetMessageByID(ctx context.Context, id string) (*models.MongoCommunication, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.messages[id]
+	if !ok || m.Channel != string(models.CommunicationChannelEmail) {
+		return nil, notFound(repositories.ErrCommunicationNotFound)
+	}
+	copied := *m
+	return &copied, nil
+}
+
+// UpdateMessageStatus updates an email message's status
+func (s *EmailStore) UpdateMessageStatus(ctx context.Context, id string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok || m.Channel != string(models.CommunicationChannelEmail) {
+		return notFound(repositories.ErrCommunicationNotFound)
+	}
+	m.Status = status
+	return nil
+}
+
+// MarkSent records a successful send with the provider and its message ID
+func (s *EmailStore) MarkSent(ctx context.Context, id, provider, externalID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return notFound(repositories.ErrCommunicationNotFound)
+	}
+	now := time.Now()
+	if m.DeliveryRank == 0 {
+		m.Status = models.MessageStatusSent
+	}
+	m.SentAt = now
+	m.Provider = provider
+	m.UpdatedAt = now
+	if externalID != "" {
+		m.ExternalMessageID = externalID
+	}
+	m.LeaseUntil = nil
+	m.LeaseOwner = ""
+	m.NextAttemptAt = nil
+	return nil
+}
+
+// CountPendingForDistributionList counts the emails to a distribution list
+// still scheduled or queued
+func (s *EmailStore) CountPendingForDistributionList(ctx context.Context, listID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var count int64
+	for _, m := range s.messages {
+		if m.DistributionListID == listID && (m.Status == models.MessageStatusScheduled || m.Status == models.MessageStatusQueued) {
+			count++
+		}
+	}
+	return count, nil
+}
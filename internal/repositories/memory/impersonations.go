@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.ImpersonationStore = (*ImpersonationStore)(nil)
+
+// ImpersonationStore keeps impersonation sessions in memory
+type ImpersonationStore struct {
+	mu       sync.Mutex
+	sessions map[string]models.ImpersonationSession
+}
+
+// NewImpersonationStore creates an empty ImpersonationStore
+func NewImpersonationStore() *ImpersonationStore {
+	return &ImpersonationStore{sessions: make(map[string]models.ImpersonationSession)}
+}
+
+// CreateImpersonation stores a new impersonation session
+func (s *ImpersonationStore) CreateImpersonation(ctx context.Context, session *models.ImpersonationSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+// GetImpersonation retrieves an impersonation session by ID
+func (s *ImpersonationStore) GetImpersonation(ctx context.Context, id string) (*models.ImpersonationSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, notFound(repositories.ErrImpersonationNotFound)
+	}
+	return &session, nil
+}
+
+// ListActiveImpersonations returns the unended, unexpired sessions of an
+// operator as a user, newest first
+func (s *ImpersonationStore) ListActiveImpersonations(ctx context.Context, actorID, targetUserID string, now time.Time) ([]*models.ImpersonationSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := []*models.ImpersonationSession{}
+	for _, session := range s.sessions {
+		if session.ActorID == actorID && session.TargetUserID == targetUserID && session.IsActive(now) {
+			session := session
+			sessions = append(sessions, &session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartedAt.After(sessions[j].StartedAt) })
+	return sessions, nil
+}
+
+// EndImpersonation ends a session early
+func (s *ImpersonationStore) EndImpersonation(ctx context.Context, id string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || session.EndedAt != nil {
+		return false, nil
+	}
+	session.EndedAt = &at
+	s.sessions[id] = session
+	return true, nil
+}
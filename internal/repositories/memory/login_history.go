@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ repositories.LoginHistoryStore = (*LoginHistoryStore)(nil)
+
+// LoginHistoryStore keeps sign-in attempts in memory. Records are not
+// expired.
+type LoginHistoryStore struct {
+	mu      sync.RWMutex
+	records []models.LoginRecord
+}
+
+// NewLoginHistoryStore creates an empty LoginHistoryStore
+func NewLoginHistoryStore() *LoginHistoryStore {
+	return &LoginHistoryStore{}
+}
+
+// CreateLoginRecord stores a sign-in attempt
+func (s *LoginHistoryStore) CreateLoginRecord(ctx context.Context, record *models.LoginRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record.ID.IsZero() {
+		record.ID = primitive.NewObjectID()
+	}
+	s.records = append(s.records, *record)
+	return nil
+}
+
+// ListLoginHistory returns up to p.FetchLimit() sign-in attempts of a user
+// matching filter, newest first, after p.After or skipping p.Offset
+func (s *LoginHistoryStore) ListLoginHistory(ctx context.Context, userID string, filter models.LoginHistoryFilter, p pagination.Request) ([]models.LoginRecord, error) {
+	if p.After != nil {
+		if _, err := p.After.ObjectID(); err != nil {
+			return nil, err
+		}
+	}
+	var records []models.LoginRecord
+	for _, record := range s.matching(userID, filter) {
+		if p.After == nil || p.After.Follows(record.Timestamp, record.ID.Hex(), true) {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Timestamp.Equal(records[j].Timestamp) {
+			return records[i].Timestamp.After(records[j].Timestamp)
+		}
+		return records[i].ID.Hex() > records[j].ID.Hex()
+	})
+	start, end := page(len(records), p.Offset, p.FetchLimit())
+	return append([]models.LoginRecord{}, records[start:end]...), nil
+}
+
+// CountLoginHistory counts the sign-in attempts of a user matching filter
+func (s *LoginHistoryStore) CountLoginHistory(ctx context.Context, userID string, filter models.LoginHistoryFilter) (int64, error) {
+	return int64(len(s.matching(userID, filter))), nil
+}
+
+// HasSuccessfulLogin reports whether a user signed in successfully with
+// userAgent, or with any client when userAgent is empty
+func (s *LoginHistoryStore) HasSuccessfulLogin(ctx context.Context, userID, userAgent string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, record := range s.records {
+		if record.UserID == userID && record.Success && (userAgent == "" || record.UserAgent == userAgent) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matching returns the sign-in attempts of userID narrowed by filter
+func (s *LoginHistoryStore) matching(userID string, filter models.LoginHistoryFilter) []models.LoginRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var records []models.LoginRecord
+	for _, record := range s.records {
+		switch {
+		case record.UserID != userID:
+		case filter.Success != nil && record.Success != *filter.Success:
+		case filter.From != nil && record.Timestamp.Before(*filter.From):
+		case filter.To != nil && !record.Timestamp.Before(*filter.To):
+		default:
+			records = append(records, record)
+		}
+	}
+	return records
+}
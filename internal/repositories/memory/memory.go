@@ -0,0 +1,74 @@
+// Package memory provides in-memory implementations of the repository store
+// interfaces, for running handlers and services without MongoDB. Every store
+// is safe for concurrent use and reports missing records with the same
+// errors as the Mongo repositories, so repositories.IsNotFound and friends
+// behave alike.
+package memory
+
+import (
+	"github.com/white/user-management/internal/repositories"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// notFound wraps a domain error the way the Mongo repositories do
+func notFound(domainErr error) error {
+	return repositories.WrapNotFound(mongo.ErrNoDocuments, domainErr)
+}
+
+// page returns the [offset, offset+limit) window of n items, clamped to n.
+// A non-positive limit means no limit.
+func page(n, offset, limit int) (start, end int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	end = n
+	if limit > 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// contains reports whether values contains v
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether values contains any of wanted
+func containsAny(values, wanted []string) bool {
+	for _, w := range wanted {
+		if contains(values, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneStrings copies a slice so stored records never share backing arrays
+// with the caller
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string(nil), values...)
+}
+
+// cloneStringMap copies a map so stored records never share it with the
+// caller
+func cloneStringMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
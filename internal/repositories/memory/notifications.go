@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.NotificationStore = (*NotificationStore)(nil)
+
+// NotificationStore keeps in-app notifications in memory
+type NotificationStore struct {
+	mu            sync.RWMutex
+	notifications map[string]*models.Notification
+}
+
+// NewNotificationStore creates an empty NotificationStore
+func NewNotificationStore() *NotificationStore {
+	return &NotificationStore{notifications: make(map[string]*models.Notification)}
+}
+
+// CreateNotification stores a notification
+func (s *NotificationStore) CreateNotification(ctx context.Context, n *models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifications[n.ID] = cloneNotification(n)
+	return nil
+}
+
+// ListNotifications returns a user's notifications newest first, along with
+// the number of matches ignoring pagination
+func (s *NotificationStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit, offset int) ([]*models.Notification, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	notifications := []*models.Notification{}
+	for _, n := range s.notifications {
+		if n.UserID == userID && (!unreadOnly || !n.IsRead()) {
+			notifications = append(notifications, cloneNotification(n))
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		if c := notifications[i].CreatedAt.Compare(notifications[j].CreatedAt); c != 0 {
+			return c > 0
+		}
+		return notifications[i].ID > notifications[j].ID
+	})
+	start, end := page(len(notifications), offset, limit)
+	return notifications[start:end], int64(len(notifications)), nil
+}
+
+// CountUnreadNotifications counts a user's unread notifications
+func (s *NotificationStore) CountUnreadNotifications(ctx context.Context, userID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var count int64
+	for _, n := range s.notifications {
+		if n.UserID == userID && !n.IsRead() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks one of a user's notifications read, keeping the
+// original read time of one that is already read
+func (s *NotificationStore) MarkNotificationRead(ctx context.Context, userID, id string, at time.Time) (*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notifications[id]
+	if !ok || n.UserID != userID {
+		return nil, notFound(repositories.ErrNotificationNotFound)
+	}
+	if n.ReadAt == nil {
+		n.ReadAt = &at
+	}
+	return cloneNotification(n), nil
+}
+
+// cloneNotification copies a notification so stored records never share
+// memory with the caller
+func cloneNotification(n *models.Notification) *models.Notification {
+	copied := *n
+	if n.ReadAt != nil {
+		readAt := *n.ReadAt
+		copied.ReadAt = &readAt
+	}
+	if n.Data != nil {
+		copied.Data = make(map[string]string, len(n.Data))
+		for k, v := range n.Data {
+			copied.Data[k] = v
+		}
+	}
+	return &copied
+}
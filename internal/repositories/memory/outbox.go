@@ -0,0 +1,260 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.EventOutboxStore = (*EventOutbox)(nil)
+
+// eventAttemptHistory is how many delivery attempts an event keeps, as in
+// the Mongo repository
+const eventAttemptHistory = 20
+
+// EventOutbox records events in memory as EventOutboxRepository records
+// them. Nothing relays them unless a test runs an EventOutboxRelay over it.
+type EventOutbox struct {
+	mu     sync.RWMutex
+	events []models.OutboxEvent
+	jobs   map[string]models.EventReplayJob
+}
+
+// NewEventOutbox creates an empty EventOutbox
+func NewEventOutbox() *EventOutbox {
+	return &EventOutbox{jobs: make(map[string]models.EventReplayJob)}
+}
+
+// RecordWithID records payload as JSON under eventID
+func (o *EventOutbox) RecordWithID(ctx context.Context, eventID, topic, key string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", topic, err)
+	}
+	var envelope struct {
+		EventType string `json:"event_type"`
+	}
+	_ = json.Unmarshal(data, &envelope)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, models.OutboxEvent{
+		ID:        eventID,
+		Topic:     topic,
+		EventType: envelope.EventType,
+		Key:       key,
+		Payload:   string(data),
+		Sequence:  int64(len(o.events) + 1),
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+// Events returns the recorded events, oldest first
+func (o *EventOutbox) Events() []models.OutboxEvent {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	events := make([]models.OutboxEvent, len(o.events))
+	for i := range o.events {
+		events[i] = *copyOutboxEvent(&o.events[i])
+	}
+	return events
+}
+
+// EventTypes returns the event_type of each recorded event, oldest first
+func (o *EventOutbox) EventTypes() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	types := make([]string, len(o.events))
+	for i, event := range o.events {
+		types[i] = event.EventType
+	}
+	return types
+}
+
+// ListUnpublished returns up to limit pending events, oldest first
+func (o *EventOutbox) ListUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var pending []*models.OutboxEvent
+	for i := range o.events {
+		if o.events[i].DeliveryStatus() == models.OutboxEventPending && len(pending) < limit {
+			pending = append(pending, copyOutboxEvent(&o.events[i]))
+		}
+	}
+	return pending, nil
+}
+
+// MarkPublished records that an event was delivered
+func (o *EventOutbox) MarkPublished(ctx context.Context, eventID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if event := o.find(eventID); event != nil {
+		now := time.Now()
+		event.PublishedAt = &now
+		addAttempt(event, models.OutboxDeliveryAttempt{At: now})
+	}
+	return nil
+}
+
+// MarkFailed records a failed publish attempt, setting the event aside as
+// failed when setAside
+func (o *EventOutbox) MarkFailed(ctx context.Context, eventID string, cause error, setAside bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if event := o.find(eventID); event != nil {
+		now := time.Now()
+		event.LastError = cause.Error()
+		if setAside {
+			event.FailedAt = &now
+		}
+		addAttempt(event, models.OutboxDeliveryAttempt{At: now, Error: cause.Error()})
+	}
+	return nil
+}
+
+// ListEvents returns the events matching filter newest first, without
+// their payload and attempts, and the number of matches
+func (o *EventOutbox) ListEvents(ctx context.Context, filter models.OutboxEventFilter, limit, offset int) ([]*models.OutboxEvent, int64, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var matched []*models.OutboxEvent
+	for i := len(o.events) - 1; i >= 0; i-- {
+		if event := &o.events[i]; matchesOutboxFilter(event, filter) {
+			listed := copyOutboxEvent(event)
+			listed.Payload = ""
+			listed.DeliveryAttempts = nil
+			matched = append(matched, listed)
+		}
+	}
+	start, end := page(len(matched), offset, limit)
+	return append([]*models.OutboxEvent{}, matched[start:end]...), int64(len(matched)), nil
+}
+
+// GetEvent returns an event with its payload and delivery attempts
+func (o *EventOutbox) GetEvent(ctx context.Context, eventID string) (*models.OutboxEvent, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	event := o.find(eventID)
+	if event == nil {
+		return nil, notFound(repositories.ErrOutboxEventNotFound)
+	}
+	return copyOutboxEvent(event), nil
+}
+
+// Requeue puts a failed or published event back in front of the relay
+// under its own ID
+func (o *EventOutbox) Requeue(ctx context.Context, eventID, replayedBy string) (*models.OutboxEvent, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	event := o.find(eventID)
+	if event == nil {
+		return nil, notFound(repositories.ErrOutboxEventNotFound)
+	}
+	if event.DeliveryStatus() == models.OutboxEventPending {
+		return nil, repositories.ErrOutboxEventNotReplayable
+	}
+	now := time.Now()
+	event.Attempts = 0
+	event.LastReplayedAt = &now
+	event.LastReplayedBy = replayedBy
+	event.PublishedAt = nil
+	event.FailedAt = nil
+	event.LastError = ""
+	event.Replays++
+	return copyOutboxEvent(event), nil
+}
+
+// ListFailedIDs returns the IDs of up to limit failed events recorded in
+// [from, to), oldest first
+func (o *EventOutbox) ListFailedIDs(ctx context.Context, from, to time.Time, limit int) ([]string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	filter := models.OutboxEventFilter{Status: models.OutboxEventFailed, From: &from, To: &to}
+	ids := []string{}
+	for i := range o.events {
+		if matchesOutboxFilter(&o.events[i], filter) && len(ids) < limit {
+			ids = append(ids, o.events[i].ID)
+		}
+	}
+	return ids, nil
+}
+
+// CreateReplayJob stores a new replay job
+func (o *EventOutbox) CreateReplayJob(ctx context.Context, job *models.EventReplayJob) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.jobs[job.ID]; ok {
+		return fmt.Errorf("error creating event replay job: %s exists", job.ID)
+	}
+	o.jobs[job.ID] = *job
+	return nil
+}
+
+// SaveReplayJob saves the progress of a replay job
+func (o *EventOutbox) SaveReplayJob(ctx context.Context, job *models.EventReplayJob) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.jobs[job.ID] = *job
+	return nil
+}
+
+// GetReplayJob returns a replay job
+func (o *EventOutbox) GetReplayJob(ctx context.Context, jobID string) (*models.EventReplayJob, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	job, ok := o.jobs[jobID]
+	if !ok {
+		return nil, notFound(repositories.ErrEventReplayJobNotFound)
+	}
+	return &job, nil
+}
+
+// find returns the stored event with id, nil when there is none. The
+// caller holds the lock.
+func (o *EventOutbox) find(id string) *models.OutboxEvent {
+	for i := range o.events {
+		if o.events[i].ID == id {
+			return &o.events[i]
+		}
+	}
+	return nil
+}
+
+// addAttempt counts an attempt and keeps the latest eventAttemptHistory
+func addAttempt(event *models.OutboxEvent, attempt models.OutboxDeliveryAttempt) {
+	event.Attempts++
+	event.DeliveryAttempts = append(event.DeliveryAttempts, attempt)
+	if n := len(event.DeliveryAttempts); n > eventAttemptHistory {
+		event.DeliveryAttempts = slices.Clone(event.DeliveryAttempts[n-eventAttemptHistory:])
+	}
+}
+
+// matchesOutboxFilter reports whether event is one a listing by filter
+// returns
+func matchesOutboxFilter(event *models.OutboxEvent, filter models.OutboxEventFilter) bool {
+	switch {
+	case filter.Status != "" && event.DeliveryStatus() != filter.Status,
+		filter.Topic != "" && event.Topic != filter.Topic,
+		filter.EventType != "" && event.EventType != filter.EventType,
+		filter.From != nil && event.CreatedAt.Before(*filter.From),
+		filter.To != nil && !event.CreatedAt.Before(*filter.To):
+		return false
+	}
+	return true
+}
+
+// copyOutboxEvent returns a copy of event with its status set, sharing no
+// attempts with the store
+func copyOutboxEvent(event *models.OutboxEvent) *models.OutboxEvent {
+	copied := *event
+	copied.DeliveryAttempts = slices.Clone(event.DeliveryAttempts)
+	copied.Status = copied.DeliveryStatus()
+	return &copied
+}
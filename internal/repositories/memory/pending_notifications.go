@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.PendingNotificationStore = (*PendingNotificationStore)(nil)
+
+// PendingNotificationStore keeps notifications held for digests in memory
+type PendingNotificationStore struct {
+	mu      sync.Mutex
+	pending map[string]*models.PendingNotification
+}
+
+// NewPendingNotificationStore creates an empty PendingNotificationStore
+func NewPendingNotificationStore() *PendingNotificationStore {
+	return &PendingNotificationStore{pending: make(map[string]*models.PendingNotification)}
+}
+
+// AddPendingNotification holds a notification for the next digest
+func (s *PendingNotificationStore) AddPendingNotification(ctx context.Context, n *models.PendingNotification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *n
+	s.pending[n.ID] = &copied
+	return nil
+}
+
+// ClaimDueDigest leases to owner the unleased notifications of the
+// recipient and type of the oldest notification due by now, oldest first
+func (s *PendingNotificationStore) ClaimDueDigest(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.PendingNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unleased := func(n *models.PendingNotification) bool {
+		return n.LeaseUntil == nil || !n.LeaseUntil.After(now)
+	}
+
+	var first *models.PendingNotification
+	for _, n := range s.pending {
+		if unleased(n) && !n.DueAt.After(now) && (first == nil || n.DueAt.Before(first.DueAt)) {
+			first = n
+		}
+	}
+	if first == nil {
+		return nil, nil
+	}
+
+	until := now.Add(lease)
+	claimed := []*models.PendingNotification{}
+	for _, n := range s.pending {
+		if n.UserID != first.UserID || n.Type != first.Type {
+			continue
+		}
+		if unleased(n) {
+			n.LeaseUntil, n.LeaseOwner = &until, owner
+		}
+		if n.LeaseOwner == owner {
+			copied := *n
+			claimed = append(claimed, &copied)
+		}
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].CreatedAt.Before(claimed[j].CreatedAt) })
+	return claimed, nil
+}
+
+// DeletePendingNotifications removes sent notifications still leased to
+// owner
+func (s *PendingNotificationStore) DeletePendingNotifications(ctx context.Context, owner string, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if n, ok := s.pending[id]; ok && n.LeaseOwner == owner {
+			delete(s.pending, id)
+		}
+	}
+	return nil
+}
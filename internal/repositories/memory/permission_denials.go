@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ repositories.PermissionDenialStore = (*PermissionDenialStore)(nil)
+
+// PermissionDenialStore keeps refused requests in memory. Denials are not
+// expired.
+type PermissionDenialStore struct {
+	mu      sync.RWMutex
+	denials []models.PermissionDenial
+}
+
+// NewPermissionDenialStore creates an empty PermissionDenialStore
+func NewPermissionDenialStore() *PermissionDenialStore {
+	return &PermissionDenialStore{}
+}
+
+// CreatePermissionDenial stores a refused request
+func (s *PermissionDenialStore) CreatePermissionDenial(ctx context.Context, denial *models.PermissionDenial) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if denial.ID.IsZero() {
+		denial.ID = primitive.NewObjectID()
+	}
+	s.denials = append(s.denials, *denial)
+	return nil
+}
+
+// ListPermissionDenials returns up to p.FetchLimit() refused requests, only
+// those of userID when set, newest first, after p.After or skipping p.Offset
+func (s *PermissionDenialStore) ListPermissionDenials(ctx context.Context, userID string, p pagination.Request) ([]models.PermissionDenial, error) {
+	if p.After != nil {
+		if _, err := p.After.ObjectID(); err != nil {
+			return nil, err
+		}
+	}
+	var denials []models.PermissionDenial
+	for _, denial := range s.matching(userID) {
+		if p.After == nil || p.After.Follows(denial.OccurredAt, denial.ID.Hex(), true) {
+			denials = append(denials, denial)
+		}
+	}
+
+	sort.Slice(denials, func(i, j int) bool {
+		if !denials[i].OccurredAt.Equal(denials[j].OccurredAt) {
+			return denials[i].OccurredAt.After(denials[j].OccurredAt)
+		}
+		return denials[i].ID.Hex() > denials[j].ID.Hex()
+	})
+	start, end := page(len(denials), p.Offset, p.FetchLimit())
+	return append([]models.PermissionDenial{}, denials[start:end]...), nil
+}
+
+// CountPermissionDenials counts the refused requests, only those of userID
+// when set
+func (s *PermissionDenialStore) CountPermissionDenials(ctx context.Context, userID string) (int64, error) {
+	return int64(len(s.matching(userID))), nil
+}
+
+// matching returns the refused requests of userID, or all when empty
+func (s *PermissionDenialStore) matching(userID string) []models.PermissionDenial {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var denials []models.PermissionDenial
+	for _, denial := range s.denials {
+		if userID == "" || denial.UserID == userID {
+			denials = append(denials, denial)
+		}
+	}
+	return denials
+}
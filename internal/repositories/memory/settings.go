@@ -0,0 +1,453 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ repositories.SettingsStore = (*SettingsStore)(nil)
+
+// SettingsStore keeps settings in memory. Settings that were never saved read
+// as the same defaults SettingsRepository returns, and updates of unsaved
+// settings start from empty ones, as an upsert does.
+type SettingsStore struct {
+	mu                 sync.RWMutex
+	users              *UserStore // Source of profiles not yet saved; may be nil
+	profiles           map[string]*models.SettingsUserProfile
+	signatures         map[string]*models.SettingsEmailSignature
+	security           map[string]*models.SettingsUserSecuritySettings
+	communication      map[string]*models.SettingsCommunicationPreferences
+	notifications      map[string]*models.SettingsNotificationSettings
+	company            *models.SettingsCompanyInfo
+	systemDefaults     *models.SystemDefaultSettings
+	systemSecurity     *models.SystemSecuritySettings
+	systemNotification *models.SystemEmailNotificationSettings
+	auditLogs          []models.SettingsAuditLog
+}
+
+// NewSettingsStore creates an empty SettingsStore. Profiles of users in users
+// are created on first read, like SettingsRepository does from the users
+// collection.
+func NewSettingsStore(users *UserStore) *SettingsStore {
+	return &SettingsStore{
+		users:         users,
+		profiles:      make(map[string]*models.SettingsUserProfile),
+		signatures:    make(map[string]*models.SettingsEmailSignature),
+		security:      make(map[string]*models.SettingsUserSecuritySettings),
+		communication: make(map[string]*models.SettingsCommunicationPreferences),
+		notifications: make(map[string]*models.SettingsNotificationSettings),
+	}
+}
+
+// SetSecuritySettings saves a user's security settings, e.g. to enable 2FA
+func (s *SettingsStore) SetSecuritySettings(settings models.SettingsUserSecuritySettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.security[settings.UserID] = &settings
+}
+
+// SetCommunicationPreferences saves a user's communication preferences
+func (s *SettingsStore) SetCommunicationPreferences(prefs models.SettingsCommunicationPreferences) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.communication[prefs.UserID] = &prefs
+}
+
+// AddAuditLog stores an audit log entry stamped with the current time
+func (s *SettingsStore) AddAuditLog(entry models.SettingsAuditLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.ID = primitive.NewObjectID()
+	entry.Timestamp = time.Now()
+	s.auditLogs = append(s.auditLogs, entry)
+}
+
+// GetUserProfile retrieves a user's profile, creating it from the user's
+// account on first read
+func (s *SettingsStore) GetUserProfile(ctx context.Context, userID string) (*models.SettingsUserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if profile, ok := s.profiles[userID]; ok {
+		copied := *profile
+		return &copied, nil
+	}
+	if s.users == nil {
+		return nil, notFound(repositories.ErrUserNotFound)
+	}
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	profile := &models.SettingsUserProfile{
+		ID:        uuid.MustNewUUID(),
+		UserID:    userID,
+		FirstName: user.Name,
+		Email:     user.Email,
+		Region:    user.Region,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: time.Now(),
+	}
+	s.profiles[userID] = profile
+	copied := *profile
+	return &copied, nil
+}
+
+// GetEmailSignature retrieves a user's email signature, empty and disabled
+// when none was saved
+func (s *SettingsStore) GetEmailSignature(ctx context.Context, userID string) (*models.SettingsEmailSignature, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if signature, ok := s.signatures[userID]; ok {
+		copied := *signature
+		return &copied, nil
+	}
+	return &models.SettingsEmailSignature{UserID: userID, UpdatedAt: time.Now()}, nil
+}
+
+// UpdateEmailSignature saves a user's email signature
+func (s *SettingsStore) UpdateEmailSignature(ctx context.Context, userID string, update models.SettingsUpdateEmailSignatureRequest) (*models.SettingsEmailSignature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	signature, ok := s.signatures[userID]
+	if !ok {
+		signature = &models.SettingsEmailSignature{ID: uuid.MustNewUUID(), UserID: userID}
+		s.signatures[userID] = signature
+	}
+	signature.Signature = update.Signature
+	signature.Enabled = update.Enabled
+	signature.UpdatedAt = time.Now()
+	copied := *signature
+	return &copied, nil
+}
+
+// GetSecuritySettings retrieves a user's security settings
+func (s *SettingsStore) GetSecuritySettings(ctx context.Context, userID string) (*models.SettingsUserSecuritySettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if settings, ok := s.security[userID]; ok {
+		copied := *settings
+		return &copied, nil
+	}
+	return repositories.DefaultSecuritySettings(userID), nil
+}
+
+// UpdateSecuritySettings updates a user's security settings
+func (s *SettingsStore) UpdateSecuritySettings(ctx context.Context, userID string, update models.SettingsUpdateSecuritySettingsRequest) (*models.SettingsUserSecuritySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.securityOf(userID)
+	if update.TwoFactorEnabled != nil {
+		settings.TwoFactorEnabled = *update.TwoFactorEnabled
+	}
+	if update.TwoFactorMethod != nil {
+		settings.TwoFactorMethod = *update.TwoFactorMethod
+	}
+	if update.SessionTimeout != nil {
+		settings.SessionTimeout = *update.SessionTimeout
+	}
+	settings.UpdatedAt = time.Now()
+	copied := *settings
+	return &copied, nil
+}
+
+// StartPhoneVerification stores a code texted to a phone number, replacing
+// any verification in progress
+func (s *SettingsStore) StartPhoneVerification(ctx context.Context, userID string, verification models.PhoneVerification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.securityOf(userID)
+	settings.PhoneVerification = &verification
+	settings.UpdatedAt = time.Now()
+	return nil
+}
+
+// RecordPhoneVerificationAttempt counts a wrong code entered for the
+// verification in progress
+func (s *SettingsStore) RecordPhoneVerificationAttempt(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if settings, ok := s.security[userID]; ok && settings.PhoneVerification != nil {
+		verification := *settings.PhoneVerification
+		verification.Attempts++
+		settings.PhoneVerification = &verification
+	}
+	return nil
+}
+
+// ConfirmPhoneNumber makes the phone number of the verification in progress
+// the user's, returning a not found error when phoneNumber is no longer
+// being verified
+func (s *SettingsStore) ConfirmPhoneNumber(ctx context.Context, userID, phoneNumber string, at time.Time) (*models.SettingsUserSecuritySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, ok := s.security[userID]
+	if !ok || settings.PhoneVerification == nil || settings.PhoneVerification.PhoneNumber != phoneNumber {
+		return nil, repositories.ErrNotFound
+	}
+	settings.PhoneNumber, settings.PhoneVerifiedAt, settings.PhoneVerification = phoneNumber, &at, nil
+	settings.UpdatedAt = at
+	copied := *settings
+	return &copied, nil
+}
+
+// RemovePhoneNumber removes the user's phone number and any verification in
+// progress, sending 2FA codes by email again
+func (s *SettingsStore) RemovePhoneNumber(ctx context.Context, userID string) (*models.SettingsUserSecuritySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, ok := s.security[userID]
+	if !ok {
+		return repositories.DefaultSecuritySettings(userID), nil
+	}
+	settings.TwoFactorMethod = models.TwoFactorMethodEmail
+	settings.PhoneNumber, settings.PhoneVerifiedAt, settings.PhoneVerification = "", nil, nil
+	settings.UpdatedAt = time.Now()
+	copied := *settings
+	return &copied, nil
+}
+
+// securityOf returns the stored security settings of a user, saving the
+// defaults first when there are none. The caller holds s.mu.
+func (s *SettingsStore) securityOf(userID string) *models.SettingsUserSecuritySettings {
+	settings, ok := s.security[userID]
+	if !ok {
+		settings = repositories.DefaultSecuritySettings(userID)
+		settings.ID = uuid.MustNewUUID()
+		s.security[userID] = settings
+	}
+	return settings
+}
+
+// GetCommunicationPreferences retrieves a user's communication preferences
+func (s *SettingsStore) GetCommunicationPreferences(ctx context.Context, userID string) (*models.SettingsCommunicationPreferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if prefs, ok := s.communication[userID]; ok {
+		copied := *prefs
+		return &copied, nil
+	}
+	return repositories.DefaultCommunicationPreferences(userID), nil
+}
+
+// GetNotificationSettings retrieves a user's notification settings
+func (s *SettingsStore) GetNotificationSettings(ctx context.Context, userID string) (*models.SettingsNotificationSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if settings, ok := s.notifications[userID]; ok {
+		copied := *settings
+		return &copied, nil
+	}
+	return repositories.DefaultNotificationSettings(userID), nil
+}
+
+// UpdateNotificationSettings updates a user's notification settings
+func (s *SettingsStore) UpdateNotificationSettings(ctx context.Context, userID string, update *models.SettingsUpdateNotificationSettingsRequest) (*models.SettingsNotificationSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, ok := s.notifications[userID]
+	if !ok {
+		settings = &models.SettingsNotificationSettings{ID: uuid.MustNewUUID(), UserID: userID}
+		s.notifications[userID] = settings
+	}
+	if update.EmailNotifications != nil {
+		settings.EmailNotifications = *update.EmailNotifications
+	}
+	if update.BrowserNotifications != nil {
+		settings.BrowserNotifications = *update.BrowserNotifications
+	}
+	if update.DigestFrequency != nil {
+		settings.DigestFrequency = *update.DigestFrequency
+	}
+	settings.UpdatedAt = time.Now()
+	copied := *settings
+	return &copied, nil
+}
+
+// GetCompanyInfo retrieves the company info
+func (s *SettingsStore) GetCompanyInfo(ctx context.Context) (*models.SettingsCompanyInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.company == nil {
+		return repositories.DefaultCompanyInfo(), nil
+	}
+	copied := *s.company
+	return &copied, nil
+}
+
+// UpdateCompanyInfo updates the company info, ignoring empty fields
+func (s *SettingsStore) UpdateCompanyInfo(ctx context.Context, update *models.SettingsUpdateCompanyInfoRequest) (*models.SettingsCompanyInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.company == nil {
+		s.company = &models.SettingsCompanyInfo{ID: primitive.NewObjectID()}
+	}
+	info := s.company
+	update.ApplyTo(info)
+	info.UpdatedAt = time.Now()
+	copied := *info
+	return &copied, nil
+}
+
+// GetSystemDefaultSettings retrieves the system default settings
+func (s *SettingsStore) GetSystemDefaultSettings(ctx context.Context) (*models.SystemDefaultSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.systemDefaults == nil {
+		return repositories.DefaultSystemDefaultSettings(), nil
+	}
+	copied := *s.systemDefaults
+	return &copied, nil
+}
+
+// UpdateSystemDefaultSettings updates the system default settings, ignoring empty fields
+func (s *SettingsStore) UpdateSystemDefaultSettings(ctx context.Context, update *models.UpdateSystemDefaultSettingsRequest) (*models.SystemDefaultSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.systemDefaults == nil {
+		s.systemDefaults = repositories.DefaultSystemDefaultSettings()
+	}
+	settings := s.systemDefaults
+	update.ApplyTo(settings)
+	settings.UpdatedAt = time.Now()
+	copied := *settings
+	return &copied, nil
+}
+
+// GetSystemSecuritySettings retrieves the system security settings
+func (s *SettingsStore) GetSystemSecuritySettings(ctx context.Context) (*models.SystemSecuritySettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.systemSecurity == nil {
+		return repositories.DefaultSystemSecuritySettings(), nil
+	}
+	copied := *s.systemSecurity
+	return &copied, nil
+}
+
+// UpdateSystemSecuritySettings updates the system security settings
+func (s *SettingsStore) UpdateSystemSecuritySettings(ctx context.Context, update *models.UpdateSystemSecuritySettingsRequest) (*models.SystemSecuritySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.systemSecurity == nil {
+		s.systemSecurity = repositories.DefaultSystemSecuritySettings()
+	}
+	settings := s.systemSecurity
+	if update.Version != nil && *update.Version != settings.Version {
+		return nil, repositories.ErrVersionConflict
+	}
+	update.ApplyTo(settings)
+	settings.Version++
+	settings.UpdatedAt = time.Now()
+	copied := *settings
+	return &copied, nil
+}
+
+// GetSystemEmailNotificationSettings retrieves the system email notification settings
+func (s *SettingsStore) GetSystemEmailNotificationSettings(ctx context.Context) (*models.SystemEmailNotificationSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.systemNotification == nil {
+		return repositories.DefaultSystemEmailNotificationSettings(), nil
+	}
+	copied := *s.systemNotification
+	return &copied, nil
+}
+
+// UpdateSystemEmailNotificationSettings updates the system email notification settings
+func (s *SettingsStore) UpdateSystemEmailNotificationSettings(ctx context.Context, update *models.UpdateSystemEmailNotificationSettingsRequest) (*models.SystemEmailNotificationSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.systemNotification == nil {
+		s.systemNotification = repositories.DefaultSystemEmailNotificationSettings()
+	}
+	settings := s.systemNotification
+	if update.SystemNotificationEmail != nil {
+		settings.SystemNotificationEmail = *update.SystemNotificationEmail
+	}
+	if update.WeeklyReportSchedule != nil {
+		settings.WeeklyReportSchedule = *update.WeeklyReportSchedule
+	}
+	if update.EmailSendLimitAlertPercent != nil {
+		settings.EmailSendLimitAlertPercent = *update.EmailSendLimitAlertPercent
+	}
+	if update.DailySendLimit != nil {
+		settings.DailySendLimit = *update.DailySendLimit
+	}
+	if update.MonthlySendLimit != nil {
+		settings.MonthlySendLimit = *update.MonthlySendLimit
+	}
+	settings.UpdatedAt = time.Now()
+	copied := *settings
+	return &copied, nil
+}
+
+// GetAuditLogs returns up to p.FetchLimit() audit logs newest first, after
+// p.After or skipping p.Offset. A non-nil userIDs only returns the logs of
+// those users.
+func (s *SettingsStore) GetAuditLogs(ctx context.Context, userIDs []string, p pagination.Request) ([]models.SettingsAuditLog, error) {
+	if p.After != nil {
+		if _, err := p.After.ObjectID(); err != nil {
+			return nil, err
+		}
+	}
+	var logs []models.SettingsAuditLog
+	for _, log := range s.auditLogsOf(userIDs) {
+		if p.After == nil || p.After.Follows(log.Timestamp, log.ID.Hex(), true) {
+			logs = append(logs, log)
+		}
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		if !logs[i].Timestamp.Equal(logs[j].Timestamp) {
+			return logs[i].Timestamp.After(logs[j].Timestamp)
+		}
+		return logs[i].ID.Hex() > logs[j].ID.Hex()
+	})
+	start, end := page(len(logs), p.Offset, p.FetchLimit())
+	return append([]models.SettingsAuditLog{}, logs[start:end]...), nil
+}
+
+// CountAuditLogs counts the audit logs, only those of userIDs when non-nil
+func (s *SettingsStore) CountAuditLogs(ctx context.Context, userIDs []string) (int64, error) {
+	return int64(len(s.auditLogsOf(userIDs))), nil
+}
+
+// EachAuditLog calls fn with every audit log newest first, only those of
+// userIDs when non-nil
+func (s *SettingsStore) EachAuditLog(ctx context.Context, userIDs []string, fn func(*models.SettingsAuditLog) error) error {
+	logs := s.auditLogsOf(userIDs)
+	sort.Slice(logs, func(i, j int) bool {
+		if !logs[i].Timestamp.Equal(logs[j].Timestamp) {
+			return logs[i].Timestamp.After(logs[j].Timestamp)
+		}
+		return logs[i].ID.Hex() > logs[j].ID.Hex()
+	})
+	for i := range logs {
+		if err := fn(&logs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditLogsOf returns the audit logs of userIDs, or all when nil
+func (s *SettingsStore) auditLogsOf(userIDs []string) []models.SettingsAuditLog {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var logs []models.SettingsAuditLog
+	for _, log := range s.auditLogs {
+		if userIDs == nil || slices.Contains(userIDs, log.UserID) {
+			logs = append(logs, log)
+		}
+	}
+	return logs
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.SSOStateStore = (*SSOStateStore)(nil)
+
+// SSOStateStore keeps SSO sign-in states in memory
+type SSOStateStore struct {
+	mu     sync.Mutex
+	states map[string]models.SSOState
+}
+
+// NewSSOStateStore creates an empty SSOStateStore
+func NewSSOStateStore() *SSOStateStore {
+	return &SSOStateStore{states: make(map[string]models.SSOState)}
+}
+
+// SaveSSOState stores the state of a new SSO sign-in
+func (s *SSOStateStore) SaveSSOState(ctx context.Context, state *models.SSOState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.ID] = *state
+	return nil
+}
+
+// ConsumeSSOState removes and returns an unexpired state
+func (s *SSOStateStore) ConsumeSSOState(ctx context.Context, id string, now time.Time) (*models.SSOState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[id]
+	if !ok {
+		return nil, notFound(repositories.ErrSSOStateNotFound)
+	}
+	delete(s.states, id)
+	if !state.ExpiresAt.After(now) {
+		return nil, notFound(repositories.ErrSSOStateNotFound)
+	}
+	return &state, nil
+}
@@ -0,0 +1,591 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+var _ repositories.TemplateStore = (*TemplateStore)(nil)
+
+// TemplateStore keeps templates in memory with the tenant and trash rules of
+// MongoTemplateRepository: every read is scoped to a tenant and trashed
+// templates are only visible through the trash methods. It records no send
+// statistics and no sequences, so every template is unused and no sequence
+// depends on one.
+type TemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*models.MongoTemplate
+}
+
+// NewTemplateStore creates an empty TemplateStore
+func NewTemplateStore() *TemplateStore {
+	return &TemplateStore{templates: make(map[string]*models.MongoTemplate)}
+}
+
+// cloneTemplate copies a template and its slices
+func cloneTemplate(t *models.MongoTemplate) *models.MongoTemplate {
+	copied := *t
+	copied.Tags = cloneStrings(t.Tags)
+	copied.Variables = cloneStrings(t.Variables)
+	copied.VariablesSchema = append([]models.TemplateVariable(nil), t.VariablesSchema...)
+	copied.ForStage = cloneStrings(t.ForStage)
+	copied.Industries = cloneStrings(t.Industries)
+	copied.KoshDocumentIds = cloneStrings(t.KoshDocumentIds)
+	copied.Content = cloneStringMap(t.Content)
+	copied.CustomFields = cloneStringMap(t.CustomFields)
+	copied.Approvals = append([]models.TemplateApproval(nil), t.Approvals...)
+	return &copied
+}
+
+// inTenant returns a tenant's stored template by ID in any state, or nil.
+// The caller holds the lock.
+func (s *TemplateStore) inTenant(tenantID, id string) *models.MongoTemplate {
+	t, ok := s.templates[id]
+	if !ok || t.TenantID != tenantID {
+		return nil
+	}
+	return t
+}
+
+// live returns a tenant's stored template by ID unless it is trashed, or nil.
+// The caller holds the lock.
+func (s *TemplateStore) live(tenantID, id string) *models.MongoTemplate {
+	t := s.inTenant(tenantID, id)
+	if t == nil || t.DeletedAt != nil {
+		return nil
+	}
+	return t
+}
+
+// collect returns copies of a tenant's live templates matching keep, oldest first
+func (s *TemplateStore) collect(tenantID string, keep func(t *models.MongoTemplate) bool) []*models.MongoTemplate {
+	templates := []*models.MongoTemplate{}
+	for _, t := range s.templates {
+		if t.TenantID == tenantID && t.DeletedAt == nil && keep(t) {
+			templates = append(templates, cloneTemplate(t))
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if !templates[i].CreatedAt.Equal(templates[j].CreatedAt) {
+			return templates[i].CreatedAt.Before(templates[j].CreatedAt)
+		}
+		return templates[i].ID < templates[j].ID
+	})
+	return templates
+}
+
+// GetByID retrieves a tenant's template by ID
+func (s *TemplateStore) GetByID(ctx context.Context, tenantID, id string) (*models.MongoTemplate, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t := s.live(tenantID, id)
+	if t == nil {
+		return nil, notFound(repositories.ErrTemplateNotFound)
+	}
+	return cloneTemplate(t), nil
+}
+
+// GetByIDAnyState retrieves a tenant's template by ID, including trashed ones
+func (s *TemplateStore) GetByIDAnyState(ctx context.Context, tenantID, id string) (*models.MongoTemplate, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t := s.inTenant(tenantID, id)
+	if t == nil {
+		return nil, notFound(repositories.ErrTemplateNotFound)
+	}
+	return cloneTemplate(t), nil
+}
+
+// GetByIDs retrieves a tenant's templates by ID, skipping unknown IDs
+func (s *TemplateStore) GetByIDs(ctx context.Context, tenantID string, ids []string) ([]*models.MongoTemplate, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collect(tenantID, func(t *models.MongoTemplate) bool { return contains(ids, t.ID) }), nil
+}
+
+// GetByNames retrieves a tenant's templates with any of the given names, oldest first
+func (s *TemplateStore) GetByNames(ctx context.Context, tenantID string, names []string) ([]*models.MongoTemplate, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collect(tenantID, func(t *models.MongoTemplate) bool { return contains(names, t.Name) }), nil
+}
+
+// ListTemplatesPage returns one page of a tenant's templates matching filters
+// and the total number of matches
+func (s *TemplateStore) ListTemplatesPage(ctx context.Context, filters repositories.TemplateFilters) ([]*models.MongoTemplate, int64, error) {
+	if uuid.IsEmptyUUID(filters.TenantID) {
+		return nil, 0, repositories.ErrTenantRequired
+	}
+	limit := filters.Limit
+	if limit == 0 {
+		limit = 50
+	}
+
+	s.mu.RLock()
+	templates := s.collect(filters.TenantID, func(t *models.MongoTemplate) bool { return matchesFilters(t, filters) })
+	s.mu.RUnlock()
+
+	sortTemplates(templates, filters.SortBy, filters.SortOrder == "asc")
+
+	skip := filters.Offset
+	if filters.Page > 0 {
+		skip = (filters.Page - 1) * limit
+	}
+	start, end := page(len(templates), skip, limit)
+	result := templates[start:end]
+	for _, t := range result {
+		t.Usage = &models.TemplateUsage{}
+	}
+	return result, int64(len(templates)), nil
+}
+
+// matchesFilters applies the listing filters of buildTemplateListFilter to one template
+func matchesFilters(t *models.MongoTemplate, f repositories.TemplateFilters) bool {
+	switch {
+	case f.Channel != "" && t.Channel != f.Channel,
+		f.Type != "" && t.Type != f.Type,
+		f.Category != "" && t.Category != f.Category,
+		f.Status != "" && t.Status != f.Status,
+		models.IsTemplateApprovalStatus(f.ApprovalFlag) && t.ApprovalStatus != f.ApprovalFlag,
+		f.ApprovalFlag != "" && !models.IsTemplateApprovalStatus(f.ApprovalFlag) && t.ApprovalFlag != f.ApprovalFlag,
+		!uuid.IsEmptyUUID(f.ServiceID) && t.ServiceID != f.ServiceID,
+		!uuid.IsEmptyUUID(f.CreatedBy) && t.CreatedBy != f.CreatedBy,
+		f.ScopeCreatedBy != nil && !contains(f.ScopeCreatedBy, t.CreatedBy),
+		len(f.ForStage) > 0 && !containsAny(t.ForStage, f.ForStage),
+		len(f.Industries) > 0 && !containsAny(t.Industries, f.Industries):
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !contains(t.Tags, tag) {
+			return false
+		}
+	}
+	// With no send statistics every template performs low
+	if f.Performance != "" && f.Performance != models.TemplatePerformanceLow {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		found := false
+		for _, field := range []string{t.Name, t.Description, t.Subject, t.Body} {
+			if strings.Contains(strings.ToLower(field), search) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sortTemplates orders a listing like ListTemplatesPage: by the sort field,
+// newest first unless ascending, with the ID as tiebreaker
+func sortTemplates(templates []*models.MongoTemplate, sortBy string, asc bool) {
+	less := func(a, b *models.MongoTemplate) int {
+		switch sortBy {
+		case "name":
+			return strings.Compare(a.Name, b.Name)
+		case "status":
+			return strings.Compare(a.Status, b.Status)
+		case "updated_at", "updatedAt", "performance", "usage":
+			return a.UpdatedAt.Compare(b.UpdatedAt)
+		default:
+			return a.CreatedAt.Compare(b.CreatedAt)
+		}
+	}
+	sort.SliceStable(templates, func(i, j int) bool {
+		c := less(templates[i], templates[j])
+		if !asc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return templates[i].ID < templates[j].ID
+	})
+}
+
+// ListNamesWithPrefix returns the names of a tenant's templates starting with prefix
+func (s *TemplateStore) ListNamesWithPrefix(ctx context.Context, tenantID, prefix string) ([]string, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := []string{}
+	for _, t := range s.collect(tenantID, func(t *models.MongoTemplate) bool { return strings.HasPrefix(t.Name, prefix) }) {
+		names = append(names, t.Name)
+	}
+	return names, nil
+}
+
+// FindActiveSequencesUsingTemplate returns no sequences; the store keeps none
+func (s *TemplateStore) FindActiveSequencesUsingTemplate(ctx context.Context, tenantID, templateID string) ([]*models.SequenceTemplate, error) {
+	return nil, nil
+}
+
+// GetUsageStats returns empty statistics for a tenant's template
+func (s *TemplateStore) GetUsageStats(ctx context.Context, tenantID, templateID string, windowDays int) (*models.TemplateStats, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	return &models.TemplateStats{
+		TemplateID: templateID,
+		WindowDays: windowDays,
+		Daily:      []*models.TemplateStatsBucket{},
+	}, nil
+}
+
+// Create inserts a new template, assigning an ID when it has none
+func (s *TemplateStore) Create(ctx context.Context, template *models.MongoTemplate) error {
+	if uuid.IsEmptyUUID(template.TenantID) {
+		return repositories.ErrTenantRequired
+	}
+	if template.ID == "" {
+		template.ID = uuid.MustNewUUID()
+	}
+	template.CreatedAt = time.Now()
+	if template.Channel == "" {
+		template.Channel = template.Type
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates[template.ID] = cloneTemplate(template)
+	return nil
+}
+
+// UpdateTemplate stamps UpdatedAt and updates a template's editable fields
+func (s *TemplateStore) UpdateTemplate(ctx context.Context, template *models.MongoTemplate) error {
+	return s.updateTemplate(template, nil)
+}
+
+// UpdateTemplateAtVersion updates a template only if its stored version is
+// still version
+func (s *TemplateStore) UpdateTemplateAtVersion(ctx context.Context, template *models.MongoTemplate, version int) error {
+	return s.updateTemplate(template, &version)
+}
+
+func (s *TemplateStore) updateTemplate(template *models.MongoTemplate, version *int) error {
+	if uuid.IsEmptyUUID(template.TenantID) {
+		return repositories.ErrTenantRequired
+	}
+	template.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.live(template.TenantID, template.ID)
+	if t == nil {
+		return notFound(repositories.ErrTemplateNotFound)
+	}
+	if version != nil && t.Version != *version {
+		return repositories.ErrVersionConflict
+	}
+	// The fields of editableTemplateFields in the repositories package
+	t.Name = template.Name
+	t.Description = template.Description
+	t.Type = template.Type
+	t.Channel = template.Channel
+	t.Status = template.Status
+	t.Content = cloneStringMap(template.Content)
+	t.Subject = template.Subject
+	t.Body = template.Body
+	t.Variables = cloneStrings(template.Variables)
+	t.VariablesSchema = append([]models.TemplateVariable(nil), template.VariablesSchema...)
+	t.CustomFields = cloneStringMap(template.CustomFields)
+	t.Category = template.Category
+	t.Tags = cloneStrings(template.Tags)
+	t.ForStage = cloneStrings(template.ForStage)
+	t.Industries = cloneStrings(template.Industries)
+	t.ApprovalFlag = template.ApprovalFlag
+	t.AiEnhanced = template.AiEnhanced
+	t.ServiceID = template.ServiceID
+	t.MetaTemplateName = template.MetaTemplateName
+	t.TemplateType = template.TemplateType
+	t.KoshDocumentIds = cloneStrings(template.KoshDocumentIds)
+	t.UpdatedAt = template.UpdatedAt
+	t.Version++
+	template.Version = t.Version
+	return nil
+}
+
+// Replace overwrites a template within its tenant
+func (s *TemplateStore) Replace(ctx context.Context, template *models.MongoTemplate) error {
+	if uuid.IsEmptyUUID(template.TenantID) {
+		return repositories.ErrTenantRequired
+	}
+	template.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.live(template.TenantID, template.ID) == nil {
+		return notFound(repositories.ErrTemplateNotFound)
+	}
+	s.templates[template.ID] = cloneTemplate(template)
+	return nil
+}
+
+// SetPublishState updates a template's status and publication stamp. A nil
+// publishedAt clears the stamp.
+func (s *TemplateStore) SetPublishState(ctx context.Context, tenantID, id, status string, publishedAt *time.Time, publishedBy string) error {
+	if uuid.IsEmptyUUID(tenantID) {
+		return repositories.ErrTenantRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.live(tenantID, id)
+	if t == nil {
+		return notFound(repositories.ErrTemplateNotFound)
+	}
+	t.Status = status
+	t.UpdatedAt = time.Now()
+	if publishedAt != nil {
+		at := *publishedAt
+		t.PublishedAt = &at
+		t.PublishedBy = publishedBy
+	} else {
+		t.PublishedAt = nil
+		t.PublishedBy = ""
+	}
+	return nil
+}
+
+// SetApprovalState moves a template from fromStatus to toStatus in the review
+// cycle and appends entry to its review history
+func (s *TemplateStore) SetApprovalState(ctx context.Context, tenantID, id, fromStatus, toStatus string, entry models.TemplateApproval) error {
+	if uuid.IsEmptyUUID(tenantID) {
+		return repositories.ErrTenantRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.live(tenantID, id)
+	if t == nil {
+		return notFound(repositories.ErrTemplateNotFound)
+	}
+	if t.ApprovalStatus != fromStatus {
+		return repositories.ErrApprovalStateChanged
+	}
+	t.ApprovalStatus = toStatus
+	t.Approvals = append(t.Approvals, entry)
+	t.UpdatedAt = time.Now()
+	return nil
+}
+
+// Delete permanently removes a tenant's template, whether or not it is in the trash
+func (s *TemplateStore) Delete(ctx context.Context, tenantID, id string) error {
+	if uuid.IsEmptyUUID(tenantID) {
+		return repositories.ErrTenantRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inTenant(tenantID, id) == nil {
+		return notFound(repositories.ErrTemplateNotFound)
+	}
+	delete(s.templates, id)
+	return nil
+}
+
+// SoftDelete moves a tenant's template to the trash
+func (s *TemplateStore) SoftDelete(ctx context.Context, tenantID, id, deletedBy string) error {
+	matched, err := s.SoftDeleteMany(ctx, tenantID, []string{id}, deletedBy)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return notFound(repositories.ErrTemplateNotFound)
+	}
+	return nil
+}
+
+// ListTrash returns one page of a tenant's trashed templates, most recently
+// deleted first, and the total number in the trash
+func (s *TemplateStore) ListTrash(ctx context.Context, tenantID string, scopeCreatedBy []string, pageNum, limit int) ([]*models.MongoTemplate, int64, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, 0, repositories.ErrTenantRequired
+	}
+	s.mu.RLock()
+	templates := []*models.MongoTemplate{}
+	for _, t := range s.templates {
+		if t.TenantID != tenantID || t.DeletedAt == nil {
+			continue
+		}
+		if scopeCreatedBy != nil && !contains(scopeCreatedBy, t.CreatedBy) {
+			continue
+		}
+		templates = append(templates, cloneTemplate(t))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(templates, func(i, j int) bool {
+		if !templates[i].DeletedAt.Equal(*templates[j].DeletedAt) {
+			return templates[i].DeletedAt.After(*templates[j].DeletedAt)
+		}
+		return templates[i].ID < templates[j].ID
+	})
+	start, end := page(len(templates), (pageNum-1)*limit, limit)
+	return templates[start:end], int64(len(templates)), nil
+}
+
+// RestoreFromTrash takes a tenant's template out of the trash
+func (s *TemplateStore) RestoreFromTrash(ctx context.Context, tenantID, id string) error {
+	if uuid.IsEmptyUUID(tenantID) {
+		return repositories.ErrTenantRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.inTenant(tenantID, id)
+	if t == nil || t.DeletedAt == nil {
+		return notFound(repositories.ErrTemplateNotFound)
+	}
+	t.DeletedAt = nil
+	t.DeletedBy = ""
+	t.UpdatedAt = time.Now()
+	return nil
+}
+
+// SoftDeleteMany moves a tenant's templates to the trash and returns how many were moved
+func (s *TemplateStore) SoftDeleteMany(ctx context.Context, tenantID string, ids []string, deletedBy string) (int64, error) {
+	now := time.Now()
+	return s.updateMany(tenantID, ids, func(t *models.MongoTemplate) {
+		t.DeletedAt = &now
+		t.DeletedBy = deletedBy
+		t.UpdatedAt = now
+	})
+}
+
+// SetStatusMany sets the status of a tenant's templates, clearing the
+// publication stamp when they leave the published state
+func (s *TemplateStore) SetStatusMany(ctx context.Context, tenantID string, ids []string, status string) (int64, error) {
+	return s.updateMany(tenantID, ids, func(t *models.MongoTemplate) {
+		t.Status = status
+		t.UpdatedAt = time.Now()
+		if status != string(models.TemplateStatusPublished) && status != string(models.TemplateStatusActive) {
+			t.PublishedAt = nil
+			t.PublishedBy = ""
+		}
+	})
+}
+
+// AddTagsMany adds tags to a tenant's templates, skipping tags already present
+func (s *TemplateStore) AddTagsMany(ctx context.Context, tenantID string, ids, tags []string) (int64, error) {
+	return s.updateMany(tenantID, ids, func(t *models.MongoTemplate) {
+		for _, tag := range tags {
+			if !contains(t.Tags, tag) {
+				t.Tags = append(t.Tags, tag)
+			}
+		}
+		t.UpdatedAt = time.Now()
+	})
+}
+
+// RemoveTagsMany removes tags from a tenant's templates
+func (s *TemplateStore) RemoveTagsMany(ctx context.Context, tenantID string, ids, tags []string) (int64, error) {
+	return s.updateMany(tenantID, ids, func(t *models.MongoTemplate) {
+		kept := []string{}
+		for _, tag := range t.Tags {
+			if !contains(tags, tag) {
+				kept = append(kept, tag)
+			}
+		}
+		t.Tags = kept
+		t.UpdatedAt = time.Now()
+	})
+}
+
+// updateMany applies fn to a tenant's live templates by ID and returns the matched count
+func (s *TemplateStore) updateMany(tenantID string, ids []string, fn func(t *models.MongoTemplate)) (int64, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return 0, repositories.ErrTenantRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched int64
+	for _, id := range ids {
+		if t := s.live(tenantID, id); t != nil {
+			fn(t)
+			matched++
+		}
+	}
+	return matched, nil
+}
+
+// ListTagCounts returns every tag used by a tenant's templates with its usage
+// count, most used first
+func (s *TemplateStore) ListTagCounts(ctx context.Context, tenantID string) ([]models.TemplateTagCount, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	s.mu.RLock()
+	counts := map[string]int64{}
+	for _, t := range s.templates {
+		if t.TenantID == tenantID && t.DeletedAt == nil {
+			for _, tag := range t.Tags {
+				counts[tag]++
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	tags := make([]models.TemplateTagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, models.TemplateTagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// RenameTag renames a tag on every template of a tenant, keeping each tag
+// once, and returns the IDs of the templates changed
+func (s *TemplateStore) RenameTag(ctx context.Context, tenantID, oldName, newName string) ([]string, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, repositories.ErrTenantRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := []string{}
+	for _, t := range s.templates {
+		if t.TenantID != tenantID || t.DeletedAt != nil || !contains(t.Tags, oldName) {
+			continue
+		}
+		renamed := []string{}
+		for _, tag := range t.Tags {
+			if tag == oldName {
+				tag = newName
+			}
+			if !contains(renamed, tag) {
+				renamed = append(renamed, tag)
+			}
+		}
+		t.Tags = renamed
+		t.UpdatedAt = time.Now()
+		ids = append(ids, t.ID)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var _ repositories.TwoFactorCodeStore = (*TwoFactorCodeStore)(nil)
+
+// TwoFactorCodeStore keeps 2FA sign-in codes in memory
+type TwoFactorCodeStore struct {
+	mu    sync.Mutex
+	codes map[string]models.TwoFAOTP
+}
+
+// NewTwoFactorCodeStore creates an empty TwoFactorCodeStore
+func NewTwoFactorCodeStore() *TwoFactorCodeStore {
+	return &TwoFactorCodeStore{codes: make(map[string]models.TwoFAOTP)}
+}
+
+// CreateTwoFactorCode stores the code of a new 2FA sign-in
+func (s *TwoFactorCodeStore) CreateTwoFactorCode(ctx context.Context, code *models.TwoFAOTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.codes {
+		if existing.TempToken == code.TempToken {
+			return repositories.ErrDuplicateKey
+		}
+	}
+	s.codes[code.ID] = *code
+	return nil
+}
+
+// GetTwoFactorCode returns the unused code of a temp token
+func (s *TwoFactorCodeStore) GetTwoFactorCode(ctx context.Context, tempToken string) (*models.TwoFAOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, code := range s.codes {
+		if code.TempToken == tempToken && !code.Used {
+			return &code, nil
+		}
+	}
+	return nil, notFound(repositories.ErrTwoFactorCodeNotFound)
+}
+
+// MarkTwoFactorCodeUsed marks an unused code as used
+func (s *TwoFactorCodeStore) MarkTwoFactorCodeUsed(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[id]
+	if !ok || code.Used {
+		return notFound(repositories.ErrTwoFactorCodeNotFound)
+	}
+	code.Used = true
+	s.codes[id] = code
+	return nil
+}
@@ -0,0 +1,581 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+var (
+	_ repositories.UserStore          = (*UserStore)(nil)
+	_ repositories.SessionStore       = (*UserStore)(nil)
+	_ repositories.PasswordResetStore = (*UserStore)(nil)
+)
+
+// UserStore keeps users, sessions and password resets in memory. Like
+// MongoUserRepository it serves all three store interfaces.
+type UserStore struct {
+	mu       sync.RWMutex
+	users    map[string]*models.User
+	sessions map[string]*models.Session       // By refresh token
+	resets   map[string]*models.PasswordReset // By reset token
+}
+
+// NewUserStore creates an empty UserStore
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users:    make(map[string]*models.User),
+		sessions: make(map[string]*models.Session),
+		resets:   make(map[string]*models.PasswordReset),
+	}
+}
+
+// Add stores a user as given, keeping its ID if set. It is meant for seeding.
+func (s *UserStore) Add(user *models.User) *models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *user
+	if stored.ID == "" {
+		stored.ID = uuid.MustNewUUID()
+	}
+	s.users[stored.ID] = &stored
+	copied := stored
+	return &copied
+}
+
+// GetByID retrieves a user by ID
+func (s *UserStore) GetByID(ctx context.Context, id string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, notFound(repositories.ErrUserNotFound)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// GetUsersByIDs retrieves the users with the given IDs, leaving out IDs
+// without a user
+func (s *UserStore) GetUsersByIDs(ctx context.Context, ids []string) ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := []*models.User{}
+	for _, id := range ids {
+		if user, ok := s.users[id]; ok {
+			copied := *user
+			copied.PasswordHash, copied.OTPHash, copied.OTPExpiresAt = "", "", nil
+			users = append(users, &copied)
+		}
+	}
+	return users, nil
+}
+
+// GetByEmail retrieves a user by their email address
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user := s.findByEmail(email)
+	if user == nil {
+		return nil, notFound(repositories.ErrUserNotFound)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// GetByInviteToken retrieves the invited user holding a signup token
+func (s *UserStore) GetByInviteToken(ctx context.Context, token string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user := s.findByInviteToken(token)
+	if user == nil {
+		return nil, notFound(repositories.ErrUserNotFound)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// findByInviteToken returns the invited user holding token, or nil. The
+// caller holds the lock.
+func (s *UserStore) findByInviteToken(token string) *models.User {
+	if token == "" {
+		return nil
+	}
+	for _, user := range s.users {
+		if user.InviteToken == token && user.Status == "invited" {
+			return user
+		}
+	}
+	return nil
+}
+
+// AcceptInvitation activates the invited user holding token and spends the
+// token
+func (s *UserStore) AcceptInvitation(ctx context.Context, token, passwordHash, phone string, at time.Time) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.findByInviteToken(token)
+	if user == nil {
+		return nil, notFound(repositories.ErrUserNotFound)
+	}
+	if user.InviteExpiry != nil && at.After(*user.InviteExpiry) {
+		return nil, repositories.ErrInvitationExpired
+	}
+	accepted := *user
+	user.PasswordHash = passwordHash
+	user.Status = "active"
+	user.IsActive = true
+	user.UpdatedAt = at
+	user.ActivatedAt = &at
+	if phone != "" {
+		user.Phone = phone
+	}
+	user.InviteToken = ""
+	user.InviteExpiry = nil
+	return &accepted, nil
+}
+
+// findByEmail returns the stored user with email, or nil. The caller holds the lock.
+func (s *UserStore) findByEmail(email string) *models.User {
+	for _, user := range s.users {
+		if user.Email == email {
+			return user
+		}
+	}
+	return nil
+}
+
+// ListByTeam retrieves users in a specific team sorted by name with pagination
+func (s *UserStore) ListByTeam(ctx context.Context, team string, limit, offset int) ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := []*models.User{}
+	for _, user := range s.users {
+		if user.Team == team {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	start, end := page(len(users), offset, limit)
+	return users[start:end], nil
+}
+
+// ListDirectReports retrieves the users whose manager is managerID, sorted
+// by name
+func (s *UserStore) ListDirectReports(ctx context.Context, managerID string) ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := []*models.User{}
+	for _, user := range s.users {
+		if user.ManagerID == managerID {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users, nil
+}
+
+// ListUsersFiltered lists users matching filters, along with the number of
+// matches ignoring pagination
+func (s *UserStore) ListUsersFiltered(ctx context.Context, filters repositories.UserFilters) ([]*models.User, int64, error) {
+	users := s.filterUsers(filters)
+	total := int64(len(users))
+	if filters.After != nil {
+		descending := filters.SortOrder != "asc"
+		users = slices.DeleteFunc(users, func(user *models.User) bool {
+			return !filters.After.Follows(user.CreatedAt, user.ID, descending)
+		})
+	}
+	start, end := page(len(users), filters.Offset, filters.Limit)
+	return users[start:end], total, nil
+}
+
+// EachUserFiltered calls fn for every user matching filters in listing order,
+// stopping at the first error
+func (s *UserStore) EachUserFiltered(ctx context.Context, filters repositories.UserFilters, fn func(user *models.User) error) error {
+	users, _, err := s.ListUsersFiltered(ctx, filters)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterUsers returns copies of the users matching filters, sorted like
+// MongoUserRepository sorts them
+func (s *UserStore) filterUsers(filters repositories.UserFilters) []*models.User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	search := strings.ToLower(filters.Search)
+	users := []*models.User{}
+	for _, user := range s.users {
+		switch {
+		case filters.Role != "" && string(user.Role) != filters.Role,
+			filters.Region != "" && user.Region != filters.Region,
+			filters.Team != "" && user.Team != filters.Team,
+			filters.IsActive != nil && user.IsActive != *filters.IsActive,
+			search != "" && !strings.Contains(strings.ToLower(user.Name), search) && !strings.Contains(strings.ToLower(user.Email), search),
+			filters.CreatedAfter != nil && user.CreatedAt.Before(*filters.CreatedAfter),
+			filters.CreatedBefore != nil && !user.CreatedAt.Before(*filters.CreatedBefore):
+			continue
+		}
+		copied := *user
+		copied.PasswordHash = ""
+		copied.OTPHash = ""
+		copied.OTPExpiresAt = nil
+		users = append(users, &copied)
+	}
+
+	compare := func(a, b *models.User) int {
+		switch filters.SortBy {
+		case "name":
+			return strings.Compare(a.Name, b.Name)
+		case "email":
+			return strings.Compare(a.Email, b.Email)
+		case "role":
+			return strings.Compare(string(a.Role), string(b.Role))
+		case "last_login_at":
+			return compareTimes(a.LastLoginAt, b.LastLoginAt)
+		default:
+			return a.CreatedAt.Compare(b.CreatedAt)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		c := compare(users[i], users[j])
+		if c == 0 {
+			c = strings.Compare(users[i].ID, users[j].ID)
+		}
+		if filters.SortOrder != "asc" {
+			c = -c
+		}
+		return c < 0
+	})
+	return users
+}
+
+// compareTimes orders optional times with unset ones first, as MongoDB sorts
+// missing fields
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.Compare(*b)
+}
+
+// UserStats computes the dashboard numbers as of now, classifying users the
+// way MongoUserRepository does
+func (s *UserStore) UserStats(ctx context.Context, now time.Time) (*repositories.UserStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := &repositories.UserStats{
+		Total:       int64(len(s.users)),
+		ByStatus:    make(map[string]int64),
+		ByRole:      make(map[string]int64),
+		ByRegion:    make(map[string]int64),
+		ByTeam:      make(map[string]int64),
+		GeneratedAt: now,
+	}
+	for _, user := range s.users {
+		switch {
+		case user.Status == repositories.UserStatusInvited:
+			stats.ByStatus[repositories.UserStatusInvited]++
+			if user.InviteExpiry != nil && user.InviteExpiry.After(now) {
+				stats.PendingInvitations++
+			}
+		case user.IsActive:
+			stats.ByStatus[repositories.UserStatusActive]++
+		default:
+			stats.ByStatus[repositories.UserStatusDeactivated]++
+		}
+		stats.ByRole[string(user.Role)]++
+		stats.ByRegion[user.Region]++
+		stats.ByTeam[user.Team]++
+		if user.LastLoginAt != nil {
+			if !user.LastLoginAt.Before(now.Add(-24 * time.Hour)) {
+				stats.LoginsLast24h++
+			}
+			if !user.LastLoginAt.Before(now.Add(-7 * 24 * time.Hour)) {
+				stats.LoginsLast7d++
+			}
+		}
+		if user.LastSeenAt != nil && !user.LastSeenAt.Before(now.Add(-24*time.Hour)) {
+			stats.ActiveLast24h++
+		}
+	}
+	for _, session := range s.sessions {
+		if !session.IsRevoked && session.ExpiresAt.After(now) {
+			stats.ActiveSessions++
+		}
+	}
+	return stats, nil
+}
+
+// Create inserts a new user with a fresh ID. Emails are unique, as in
+// MongoDB.
+func (s *UserStore) Create(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findByEmail(user.Email) != nil {
+		return fmt.Errorf("user with email %s already exists", user.Email)
+	}
+	now := time.Now()
+	user.ID = uuid.MustNewUUID()
+	user.TenantID = user.Tenant()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+// CountAdmins counts the users, active or not, holding the admin role or
+// one of adminRoleIDs, leaving out anonymized accounts
+func (s *UserStore) CountAdmins(ctx context.Context, adminRoleIDs []string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var count int64
+	for _, user := range s.users {
+		if user.Status == repositories.UserStatusDeleted {
+			continue
+		}
+		if user.Role == models.UserRoleAdmin || containsAny(user.RoleIDs, adminRoleIDs) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateLastLogin updates the last login timestamp
+func (s *UserStore) UpdateLastLogin(ctx context.Context, userID string, loginTime time.Time) error {
+	return s.update(userID, func(user *models.User) {
+		user.LastLoginAt = &loginTime
+		user.UpdatedAt = time.Now()
+	})
+}
+
+// UpdateLastSeen records that the user made a request at at, unless they
+// were seen less than interval before
+func (s *UserStore) UpdateLastSeen(ctx context.Context, userID string, at time.Time, interval time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok || (user.LastSeenAt != nil && user.LastSeenAt.After(at.Add(-interval))) {
+		return nil
+	}
+	user.LastSeenAt = &at
+	return nil
+}
+
+// UpdatePassword updates the password hash, keeping the one replaced in the
+// password history
+func (s *UserStore) UpdatePassword(ctx context.Context, id string, passwordHash string) error {
+	return s.update(id, func(user *models.User) {
+		if user.PasswordHash != "" {
+			history := append([]string{user.PasswordHash}, user.PasswordHistory...)
+			if len(history) > models.MaxPasswordHistory {
+				history = history[:models.MaxPasswordHistory]
+			}
+			user.PasswordHistory = history
+		}
+		user.PasswordHash = passwordHash
+		user.MustResetPassword = false
+	})
+}
+
+// ReplacePasswordHash rewrites the hash of the current password
+func (s *UserStore) ReplacePasswordHash(ctx context.Context, id string, passwordHash string) error {
+	return s.update(id, func(user *models.User) {
+		user.PasswordHash = passwordHash
+	})
+}
+
+// UpdateDataScope sets the user's data scope override
+func (s *UserStore) UpdateDataScope(ctx context.Context, id string, scope *models.DataScope) (*models.User, error) {
+	var updated models.User
+	err := s.update(id, func(user *models.User) {
+		user.DataScope = scope
+		user.UpdatedAt = time.Now()
+		updated = *user
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// UpdateRoleIDs sets the custom roles the user holds
+func (s *UserStore) UpdateRoleIDs(ctx context.Context, id string, roleIDs []string) (*models.User, error) {
+	var updated models.User
+	err := s.update(id, func(user *models.User) {
+		user.RoleIDs = slices.Clone(roleIDs)
+		if len(roleIDs) == 0 {
+			user.RoleIDs = nil
+		}
+		user.UpdatedAt = time.Now()
+		updated = *user
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// update applies fn to a stored user
+func (s *UserStore) update(userID string, fn func(user *models.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return notFound(repositories.ErrUserNotFound)
+	}
+	fn(user)
+	return nil
+}
+
+// CreateSession stores a session
+func (s *UserStore) CreateSession(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *session
+	s.sessions[session.RefreshToken] = &stored
+	return nil
+}
+
+// HasDeviceSession reports whether the user has a session, current or past,
+// from userAgent
+func (s *UserStore) HasDeviceSession(ctx context.Context, userID, userAgent string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.UserAgent == userAgent {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetByRefreshToken retrieves a session by refresh token
+func (s *UserStore) GetByRefreshToken(ctx context.Context, refreshToken string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[refreshToken]
+	if !ok {
+		return nil, notFound(fmt.Errorf("session not found"))
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// Revoke marks a session as revoked
+func (s *UserStore) Revoke(ctx context.Context, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[refreshToken]
+	if !ok {
+		return notFound(fmt.Errorf("session not found"))
+	}
+	session.IsRevoked = true
+	return nil
+}
+
+// ReplaceRefreshToken swaps the refresh token of a session
+func (s *UserStore) ReplaceRefreshToken(ctx context.Context, refreshToken, replacement string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[refreshToken]
+	if !ok {
+		return notFound(fmt.Errorf("session not found"))
+	}
+	delete(s.sessions, refreshToken)
+	session.RefreshToken = replacement
+	s.sessions[replacement] = session
+	return nil
+}
+
+// TouchSession records activity on a session like the Mongo repository:
+// at most once per interval, and never on a session that timed out after idle
+func (s *UserStore) TouchSession(ctx context.Context, tokenID string, at time.Time, interval, idle time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if session.TokenID != tokenID || session.IsRevoked || !at.Before(session.ExpiresAt) {
+			continue
+		}
+		last := session.LastActive()
+		if last.After(at.Add(-interval)) || (idle > 0 && !last.After(at.Add(-idle))) {
+			continue
+		}
+		touched := at
+		session.LastActivityAt = &touched
+	}
+	return nil
+}
+
+// ListUserSessions returns the unrevoked, unexpired sessions of a user, most
+// recently issued first
+func (s *UserStore) ListUserSessions(ctx context.Context, userID string, now time.Time) ([]*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := []*models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && !session.IsRevoked && now.Before(session.ExpiresAt) {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].IssuedAt.After(sessions[j].IssuedAt) })
+	return sessions, nil
+}
+
+// CreatePasswordReset stores a password reset token
+func (s *UserStore) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *reset
+	s.resets[reset.ResetToken] = &stored
+	return nil
+}
+
+// GetPasswordReset retrieves a password reset by token
+func (s *UserStore) GetPasswordReset(ctx context.Context, token string) (*models.PasswordReset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reset, ok := s.resets[token]
+	if !ok {
+		return nil, notFound(fmt.Errorf("password reset not found"))
+	}
+	copied := *reset
+	return &copied, nil
+}
+
+// MarkPasswordResetUsed marks an unused password reset token as used. A
+// token already used is reported as not found.
+func (s *UserStore) MarkPasswordResetUsed(ctx context.Context, resetToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reset, ok := s.resets[resetToken]
+	if !ok || reset.IsUsed {
+		return notFound(fmt.Errorf("password reset not found"))
+	}
+	reset.IsUsed = true
+	return nil
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetAttachmentByID retrieves attachment metadata by ID
+func (r *MongoEmailRepository) GetAttachmentByID(ctx context.Context, attachmentID string) (*MessageAttachment, error) {
+	var att MessageAttachment
+	err := r.attachmentsCollection.FindOne(ctx, bson.M{"_id": attachmentID}).Decode(&att)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, WrapNotFound(mongo.ErrNoDocuments, ErrAttachmentNotFound)
+		}
+		return nil, fmt.Errorf("error finding attachment: %w", err)
+	}
+	return &att, nil
+}
+
+// AddMessageAttachment appends an attachment reference to a message, so the
+// email is sent with it
+func (r *MongoEmailRepository) AddMessageAttachment(ctx context.Context, messageID string, att models.CommunicationAttachment) error {
+	result, err := r.messagesCollection.UpdateOne(ctx,
+		bson.M{"_id": messageID},
+		bson.M{
+			"$push": bson.M{"attachments": att},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error adding attachment to message: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	return nil
+}
+
+// ListOrphanedAttachments returns up to limit attachments created before
+// cutoff whose message no longer exists
+func (r *MongoEmailRepository) ListOrphanedAttachments(ctx context.Context, cutoff time.Time, limit int) ([]*MessageAttachment, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"createdAt": bson.M{"$lt": cutoff}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         r.messagesCollection.Name(),
+			"localField":   "messageId",
+			"foreignField": "_id",
+			"as":           "message",
+		}}},
+		{{Key: "$match", Value: bson.M{"message": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"message": 0}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := r.attachmentsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error finding orphaned attachments: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var attachments []*MessageAttachment
+	if err := cursor.All(ctx, &attachments); err != nil {
+		return nil, fmt.Errorf("error decoding attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+// DeleteAttachment removes attachment metadata
+func (r *MongoEmailRepository) DeleteAttachment(ctx context.Context, attachmentID string) error {
+	result, err := r.attachmentsCollection.DeleteOne(ctx, bson.M{"_id": attachmentID})
+	if err != nil {
+		return fmt.Errorf("error deleting attachment: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrAttachmentNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrEmailNotRetryable is returned when re-driving an email that was already
+// sent or that a worker is sending
+var ErrEmailNotRetryable = errors.New("email is not in a retryable state")
+
+// ErrEmailNotScheduled is returned when cancelling an email that is not
+// waiting for its scheduled time, because it was already claimed for sending
+// or was never scheduled
+var ErrEmailNotScheduled = errors.New("email is not scheduled")
+
+// OutboxClaimOptions controls which queued emails a worker may claim
+type OutboxClaimOptions struct {
+	Owner       string        // Identifies the claiming worker
+	Lease       time.Duration // How long the claim blocks other workers
+	RetryAfter  time.Duration // Grace period before a never-retried email is picked up
+	MaxAge      time.Duration // Never-retried emails older than this are left alone
+	MaxAttempts int
+}
+
+// ClaimQueuedEmail leases the oldest queued outbound email that is due for a
+// send attempt and counts the attempt. Due means its next_attempt_at has
+// passed, or, for an email the outbox has not tried yet, that the sending
+// request had RetryAfter to deliver it itself. The lease makes the claim safe
+// across worker instances. Returns nil when nothing is due.
+func (r *MongoEmailRepository) ClaimQueuedEmail(ctx context.Context, opts OutboxClaimOptions) (*models.MongoCommunication, error) {
+	now := time.Now()
+	filter := bson.M{
+		"channel":   string(models.CommunicationChannelEmail),
+		"direction": models.DirectionOutbound,
+		"status":    models.MessageStatusQueued,
+		"is_test":   bson.M{"$ne": true},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"next_attempt_at": bson.M{"$lte": now}},
+				bson.M{
+					"next_attempt_at": bson.M{"$exists": false},
+					"created_at":      bson.M{"$lte": now.Add(-opts.RetryAfter), "$gte": now.Add(-opts.MaxAge)},
+				},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"lease_until": bson.M{"$exists": false}},
+				bson.M{"lease_until": bson.M{"$lte": now}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"send_attempts": bson.M{"$exists": false}},
+				bson.M{"send_attempts": bson.M{"$lt": opts.MaxAttempts}},
+			}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"lease_until": now.Add(opts.Lease),
+			"lease_owner": opts.Owner,
+			"updated_at":  now,
+		},
+		"$inc": bson.M{"send_attempts": 1},
+	}
+	findOpts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var claimed models.MongoCommunication
+	err := r.messagesCollection.FindOneAndUpdate(ctx, filter, update, findOpts).Decode(&claimed)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming queued email: %w", err)
+	}
+	return &claimed, nil
+}
+
+// ClaimScheduledEmail moves the scheduled outbound email that has been due
+// the longest to queued, leased to owner with the attempt counted, and
+// returns it. Only one of several workers racing for an email gets it, and a
+// claimed email can no longer be cancelled. Returns nil when nothing is due.
+func (r *MongoEmailRepository) ClaimScheduledEmail(ctx context.Context, owner string, lease time.Duration) (*models.MongoCommunication, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":       models.MessageStatusScheduled,
+		"scheduled_at": bson.M{"$lte": now},
+		"channel":      string(models.CommunicationChannelEmail),
+		"direction":    models.DirectionOutbound,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      models.MessageStatusQueued,
+			"lease_until": now.Add(lease),
+			"lease_owner": owner,
+			"updated_at":  now,
+			// Picked up by the queued sweep if this worker stops mid-send,
+			// however long ago the email was created
+			"next_attempt_at": now.Add(lease),
+		},
+		"$inc": bson.M{"send_attempts": 1},
+	}
+	findOpts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "scheduled_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var claimed models.MongoCommunication
+	err := r.messagesCollection.FindOneAndUpdate(ctx, filter, update, findOpts).Decode(&claimed)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming scheduled email: %w", err)
+	}
+	return &claimed, nil
+}
+
+// CancelScheduledEmail deletes a user's scheduled email that has not been
+// claimed for sending yet. It returns ErrEmailNotScheduled once the email
+// was claimed, and a not found error for emails of other users.
+func (r *MongoEmailRepository) CancelScheduledEmail(ctx context.Context, id, userID string) error {
+	result, err := r.messagesCollection.DeleteOne(ctx, bson.M{
+		"_id":     id,
+		"user_id": userID,
+		"status":  models.MessageStatusScheduled,
+	})
+	if err != nil {
+		return fmt.Errorf("error cancelling scheduled email: %w", err)
+	}
+	if result.DeletedCount > 0 {
+		return nil
+	}
+
+	count, err := r.messagesCollection.CountDocuments(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("error retrieving email: %w", err)
+	}
+	if count == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	return ErrEmailNotScheduled
+}
+
+// CountPendingForDistributionList counts the outbound emails to a
+// distribution list still to be sent: scheduled, or queued for their first
+// attempt or a retry. The list's members are resolved when they are sent.
+func (r *MongoEmailRepository) CountPendingForDistributionList(ctx context.Context, listID string) (int64, error) {
+	count, err := r.messagesCollection.CountDocuments(ctx, bson.M{
+		"distribution_list_id": listID,
+		"status":               bson.M{"$in": bson.A{models.MessageStatusScheduled, models.MessageStatusQueued}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error counting emails to distribution list: %w", err)
+	}
+	return count, nil
+}
+
+// ClaimEmail leases one queued outbound email for owner and counts the
+// attempt, for a worker that was told about the email directly rather than
+// finding it in a sweep. Returns nil when the email is missing, no longer
+// queued or leased by another worker.
+func (r *MongoEmailRepository) ClaimEmail(ctx context.Context, id, owner string, lease time.Duration) (*models.MongoCommunication, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id":       id,
+		"channel":   string(models.CommunicationChannelEmail),
+		"direction": models.DirectionOutbound,
+		"status":    models.MessageStatusQueued,
+		"$or": bson.A{
+			bson.M{"lease_until": bson.M{"$exists": false}},
+			bson.M{"lease_until": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"lease_until": now.Add(lease),
+			"lease_owner": owner,
+			"updated_at":  now,
+		},
+		"$inc": bson.M{"send_attempts": 1},
+	}
+
+	var claimed models.MongoCommunication
+	err := r.messagesCollection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&claimed)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming email: %w", err)
+	}
+	return &claimed, nil
+}
+
+// RecordSendFailure releases a claimed email after a failed attempt. With a
+// nextAttempt it stays queued until then; without one it is marked failed.
+// The update only applies while owner still holds the lease.
+func (r *MongoEmailRepository) RecordSendFailure(ctx context.Context, id, owner, reason string, nextAttempt *time.Time) error {
+	now := time.Now()
+	set := bson.M{
+		"failure_reason": reason,
+		"updated_at":     now,
+	}
+	unset := bson.M{"lease_until": "", "lease_owner": ""}
+	if nextAttempt != nil {
+		set["next_attempt_at"] = *nextAttempt
+	} else {
+		set["status"] = models.MessageStatusFailed
+		set["failed_at"] = now
+		unset["next_attempt_at"] = ""
+	}
+
+	_, err := r.messagesCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "lease_owner": owner},
+		bson.M{"$set": set, "$unset": unset},
+	)
+	if err != nil {
+		return fmt.Errorf("error recording send failure: %w", err)
+	}
+	return nil
+}
+
+// DeferEmail releases a claimed email that could not be attempted yet, such
+// as one held back by a send limit, keeping it queued until `until`. The
+// claim's attempt is given back. The update only applies while owner still
+// holds the lease.
+func (r *MongoEmailRepository) DeferEmail(ctx context.Context, id, owner, reason string, until time.Time) error {
+	_, err := r.messagesCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "lease_owner": owner},
+		bson.M{
+			"$set":   bson.M{"next_attempt_at": until, "failure_reason": reason, "updated_at": time.Now()},
+			"$unset": bson.M{"lease_until": "", "lease_owner": ""},
+			"$inc":   bson.M{"send_attempts": -1},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error deferring email: %w", err)
+	}
+	return nil
+}
+
+// RescheduleEmail releases a claimed email as scheduled for `at`, such as
+// one sent outside the send window, so it can still be cancelled until
+// then. The claim's attempt is given back. The update only applies while
+// owner still holds the lease.
+func (r *MongoEmailRepository) RescheduleEmail(ctx context.Context, id, owner string, at time.Time) error {
+	_, err := r.messagesCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "lease_owner": owner},
+		bson.M{
+			"$set":   bson.M{"status": models.MessageStatusScheduled, "scheduled_at": at, "updated_at": time.Now()},
+			"$unset": bson.M{"lease_until": "", "lease_owner": "", "next_attempt_at": ""},
+			"$inc":   bson.M{"send_attempts": -1},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error rescheduling email: %w", err)
+	}
+	return nil
+}
+
+// ListOutboundEmails returns outbound emails with the given status (all when
+// empty), newest first, with the total count
+func (r *MongoEmailRepository) ListOutboundEmails(ctx context.Context, status string, limit, offset int) ([]*models.MongoCommunication, int64, error) {
+	filter := bson.M{
+		"channel":   string(models.CommunicationChannelEmail),
+		"direction": models.DirectionOutbound,
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	total, err := r.messagesCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting emails: %w", err)
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"body": 0, "body_html": 0})
+	cursor, err := r.messagesCollection.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing emails: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	emails := []*models.MongoCommunication{}
+	if err := cursor.All(ctx, &emails); err != nil {
+		return nil, 0, fmt.Errorf("error decoding emails: %w", err)
+	}
+	return emails, total, nil
+}
+
+// RequeueEmail puts a failed or stuck outbound email back in the outbox with
+// a fresh attempt budget, due immediately
+func (r *MongoEmailRepository) RequeueEmail(ctx context.Context, id string) (*models.MongoCommunication, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id":       id,
+		"channel":   string(models.CommunicationChannelEmail),
+		"direction": models.DirectionOutbound,
+		"status":    bson.M{"$in": bson.A{models.MessageStatusFailed, models.MessageStatusQueued}},
+		// Never re-drive an email a worker is sending right now
+		"$or": bson.A{
+			bson.M{"lease_until": bson.M{"$exists": false}},
+			bson.M{"lease_until": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":          models.MessageStatusQueued,
+			"send_attempts":   0,
+			"next_attempt_at": now,
+			"updated_at":      now,
+		},
+		"$unset": bson.M{"lease_until": "", "lease_owner": "", "failed_at": "", "expires_at": ""},
+	}
+
+	var requeued models.MongoCommunication
+	err := r.messagesCollection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&requeued)
+	if err == nil {
+		return &requeued, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error requeueing email: %w", err)
+	}
+
+	// Distinguish a missing email from one that is not retryable
+	count, err := r.messagesCollection.CountDocuments(ctx, bson.M{"_id": id, "channel": string(models.CommunicationChannelEmail)})
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving email: %w", err)
+	}
+	if count == 0 {
+		return nil, WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	return nil, ErrEmailNotRetryable
+}
@@ -2,11 +2,15 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
 	"github.com/white/user-management/pkg/mongodb"
+	"github.com/white/user-management/pkg/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -18,6 +22,7 @@ type MongoEmailRepository struct {
 	messagesCollection    *mongo.Collection
 	threadsCollection     *mongo.Collection
 	attachmentsCollection *mongo.Collection
+	templateStats         *TemplateStatsRepository
 }
 
 func NewMongoEmailRepository(client *mongodb.Client) *MongoEmailRepository {
@@ -26,20 +31,25 @@ func NewMongoEmailRepository(client *mongodb.Client) *MongoEmailRepository {
 		messagesCollection: client.Collection("communication"),
 		threadsCollection:  client.Collection("message_threads"),
 		attachmentsCollection: client.Collection("message_attachments"),
+		templateStats:         NewTemplateStatsRepository(client),
 	}
 }
 
 // EmailFilters represents filters for email inbox queries
 type EmailFilters struct {
+	TenantID   string // Only messages of this tenant; empty for no restriction
 	Channel    string
 	Status     string
 	IsRead     *bool
 	IsStarred  *bool
 	DateFrom   *time.Time
 	DateTo     *time.Time
+	Direction  string
 	EntityType string
 	EntityID   string
 	Limit      int
+	Offset     int
+	After      *pagination.Cursor // Inbox messages after it, by sent_at
 }
 
 
@@ -50,6 +60,18 @@ func (r *MongoEmailRepository) CreateMessage(ctx context.Context, message *model
 		return fmt.Errorf("error creating email message: %w", err)
 	}
 	message.ID = result.InsertedID.(string)
+
+	// Count real outbound sends of a template; a stats failure never fails the send
+	if message.TemplateID != "" && !message.IsTest && message.Direction == models.DirectionOutbound {
+		sentAt := message.CreatedAt
+		if sentAt.IsZero() {
+			sentAt = time.Now()
+		}
+		failed := message.Status == models.MessageStatusFailed
+		if err := r.templateStats.RecordSend(ctx, message.TenantID, message.TemplateID, sentAt, failed); err != nil {
+			log.Printf("Warning: failed to record template send for message %s: %v", message.ID, err)
+		}
+	}
 	return nil
 }
 
@@ -129,49 +151,21 @@ func (r *MongoEmailRepository) GetMessagesByThread(ctx context.Context, threadID
 	return messages, nil
 }
 
-// GetInbox retrieves inbox messages for a user with filters
+// GetInbox retrieves a page of a user's email messages, newest first
 func (r *MongoEmailRepository) GetInbox(ctx context.Context, userID string, filters EmailFilters) ([]*models.MongoCommunication, error) {
 	if filters.Limit <= 0 {
 		filters.Limit = 50 // Default limit
 	}
 
-	filter := bson.M{
-		"channel": string(models.CommunicationChannelEmail),
-	}
-	// Apply filters
-	if filters.Status != "" {
-		filter["status"] = filters.Status
-	}
-	if filters.IsRead != nil {
-		if *filters.IsRead {
-			filter["read_at"] = bson.M{"exists":true, "$ne":nil}
-		} else {
-			filter["read_at"] = bson.M{"$exists": false}
-		}
-	}
-	if filters.IsStarred != nil {
-		filter["isStarred"] = *filters.IsStarred
-	}
-	if filters.DateFrom != nil {
-		filter["sentAt"] = bson.M{"$gte": filters.DateFrom}
-	}
-
-	if filters.DateTo != nil {
-		if sentAtFilter, ok := filter["sentAt"].(bson.M); ok {
-			sentAtFilter["$lte"] = filters.DateTo
-		}else {
-			filter["sentAt"] = bson.M{"$lte": filters.DateTo}
-		}
-	}
-	if filters.EntityID != "" {
-		if filters.EntityType == "customer" {
-			filter["customerId"] = filters.EntityID
-		} 
+	filter := inboxFilter(userID, filters)
+	if filters.After != nil {
+		filter = pagination.And(filter, pagination.After("sent_at", true, filters.After, filters.After.ID))
 	}
 
 	opts := options.Find().
+		SetSkip(int64(filters.Offset)).
 		SetLimit(int64(filters.Limit)).
-		SetSort(bson.D{{Key: "sent_at", Value: -1}})
+		SetSort(pagination.Sort("sent_at", true))
 	cursor, err := r.messagesCollection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving email inbox: %w", err)
@@ -184,8 +178,91 @@ func (r *MongoEmailRepository) GetInbox(ctx context.Context, userID string, filt
 	}
 
 	return messages, nil
+}
+
+// CountInbox counts a user's email messages matching filters (Limit, Offset
+// and After are ignored)
+func (r *MongoEmailRepository) CountInbox(ctx context.Context, userID string, filters EmailFilters) (int64, error) {
+	count, err := r.messagesCollection.CountDocuments(ctx, inboxFilter(userID, filters))
+	if err != nil {
+		return 0, fmt.Errorf("error counting email inbox: %w", err)
+	}
+	return count, nil
+}
 
+// InboxSummary holds the message counts shown on a user's inbox
+type InboxSummary struct {
+	Total   int64 `json:"total"`
+	Unread  int64 `json:"unread"`
+	Starred int64 `json:"starred"`
+}
 
+// GetInboxSummary counts a user's total, unread and starred email messages
+func (r *MongoEmailRepository) GetInboxSummary(ctx context.Context, userID string) (*InboxSummary, error) {
+	unread, starred := false, true
+	summary := &InboxSummary{}
+
+	var err error
+	if summary.Total, err = r.CountInbox(ctx, userID, EmailFilters{}); err != nil {
+		return nil, err
+	}
+	if summary.Unread, err = r.CountInbox(ctx, userID, EmailFilters{IsRead: &unread}); err != nil {
+		return nil, err
+	}
+	if summary.Starred, err = r.CountInbox(ctx, userID, EmailFilters{IsStarred: &starred}); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// inboxFilter builds the query for a user's email messages. Every key matches
+// the stored bson field names.
+func inboxFilter(userID string, filters EmailFilters) bson.M {
+	filter := bson.M{
+		"channel": string(models.CommunicationChannelEmail),
+		"user_id": userID,
+	}
+	if filters.TenantID != "" {
+		filter["tenant_id"] = tenantMatch(filters.TenantID)
+	}
+	if filters.Channel != "" {
+		filter["channel"] = filters.Channel
+	}
+	if filters.Direction != "" {
+		filter["direction"] = filters.Direction
+	}
+	if filters.Status != "" {
+		filter["status"] = filters.Status
+	}
+	if filters.IsRead != nil {
+		// A null read_at also matches a missing one
+		if *filters.IsRead {
+			filter["read_at"] = bson.M{"$ne": nil}
+		} else {
+			filter["read_at"] = nil
+		}
+	}
+	if filters.IsStarred != nil {
+		if *filters.IsStarred {
+			filter["is_starred"] = true
+		} else {
+			filter["is_starred"] = bson.M{"$ne": true}
+		}
+	}
+	if filters.DateFrom != nil || filters.DateTo != nil {
+		sentAt := bson.M{}
+		if filters.DateFrom != nil {
+			sentAt["$gte"] = *filters.DateFrom
+		}
+		if filters.DateTo != nil {
+			sentAt["$lte"] = *filters.DateTo
+		}
+		filter["sent_at"] = sentAt
+	}
+	if filters.EntityID != "" && filters.EntityType == "customer" {
+		filter["customer_id"] = filters.EntityID
+	}
+	return filter
 }
 
 // UpdateMessageStatus updates email message status
@@ -200,13 +277,23 @@ func (r *MongoEmailRepository) UpdateMessageStatus(ctx context.Context, id strin
 		},
 	}
 
-	result, err := r.messagesCollection.UpdateOne(ctx, filter, update)
-	if err != nil {
+	// Read the previous state back so a send that turns failed is counted once in template_stats
+	var previous models.MongoCommunication
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"status": 1, "tenant_id": 1, "template_id": 1, "is_test": 1, "created_at": 1})
+	if err := r.messagesCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+		}
 		return fmt.Errorf("error updating email status: %w", err)
 	}
 
-	if result.MatchedCount == 0 {
-		return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	if status == models.MessageStatusFailed && previous.Status != models.MessageStatusFailed &&
+		previous.TemplateID != "" && !previous.IsTest {
+		if err := r.templateStats.RecordFailure(ctx, previous.TenantID, previous.TemplateID, previous.CreatedAt); err != nil {
+			log.Printf("Warning: failed to record template failure for message %s: %v", id, err)
+		}
 	}
 
 	return nil
@@ -221,6 +308,7 @@ func (r *MongoEmailRepository) MarkAsRead(ctx context.Context, id string) error
 	update := bson.M{
 		"$set" : bson.M{
 			"read_at": time.Now(),
+			"is_read": true,
 			"status": string(models.CommunicationStatusRead),
 		},
 	}
@@ -234,10 +322,162 @@ func (r *MongoEmailRepository) MarkAsRead(ctx context.Context, id string) error
 	return nil
 }
 
+// MarkOpened records an open of a tracked email. The first open sets
+// opened_at; every open bumps open_count.
+func (r *MongoEmailRepository) MarkOpened(ctx context.Context, id string, at time.Time) error {
+	filter := bson.M{
+		"_id":     id,
+		"channel": string(models.CommunicationChannelEmail),
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"opened_at":  bson.M{"$ifNull": bson.A{"$opened_at", at}},
+			"open_count": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$open_count", 0}}, 1}},
+			"updated_at": at,
+		}}},
+	}
+	result, err := r.messagesCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error recording email open: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	return nil
+}
+
+// RecordClick records a click on a tracked link. A click implies the email
+// was opened, so opened_at is filled in when the pixel was blocked.
+func (r *MongoEmailRepository) RecordClick(ctx context.Context, id, link string, at time.Time) error {
+	filter := bson.M{
+		"_id":     id,
+		"channel": string(models.CommunicationChannelEmail),
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"opened_at":     bson.M{"$ifNull": bson.A{"$opened_at", at}},
+			"clicked_at":    bson.M{"$ifNull": bson.A{"$clicked_at", at}},
+			"click_count":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$click_count", 0}}, 1}},
+			"clicked_links": bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$clicked_links", bson.A{}}}, bson.A{link}}},
+			"updated_at":    at,
+		}}},
+	}
+	result, err := r.messagesCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error recording email click: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	return nil
+}
+
+// MarkSent records a successful send: status sent (unless a delivery webhook
+// already moved it further), the provider, and the provider's message ID so
+// delivery webhooks can be matched back to it. Any outbox lease is released.
+func (r *MongoEmailRepository) MarkSent(ctx context.Context, id, provider, externalID string) error {
+	now := time.Now()
+	set := bson.M{
+		"status": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$delivery_rank", 0}}, 0}},
+			"$status",
+			models.MessageStatusSent,
+		}},
+		"sent_at":    now,
+		"provider":   provider,
+		"updated_at": now,
+	}
+	if externalID != "" {
+		set["external_message_id"] = externalID
+		if provider == "sendgrid" {
+			set["sg_message_id"] = externalID
+		}
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: set}},
+		{{Key: "$unset", Value: bson.A{"lease_until", "lease_owner", "next_attempt_at"}}},
+	}
+	result, err := r.messagesCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return fmt.Errorf("error marking email as sent: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	return nil
+}
+
+// UpdateDeliveryStatus applies a provider delivery event to the email it is
+// about, matched by our message ID or the provider's. Events are applied in
+// DeliveryEventRank order: one that ranks below the last applied event, or
+// repeats it without being newer, leaves the document unchanged and returns
+// applied=false, so duplicate and out-of-order webhooks are harmless.
+func (r *MongoEmailRepository) UpdateDeliveryStatus(ctx context.Context, ev *models.EmailDeliveryWebhook) (*models.MongoCommunication, bool, error) {
+	rank := models.DeliveryEventRank(ev.Event)
+	at := ev.OccurredAt()
+	match := bson.M{"$or": bson.A{
+		bson.M{"_id": ev.MessageID},
+		bson.M{"external_message_id": ev.MessageID},
+	}}
+	filter := bson.M{"$and": bson.A{
+		match,
+		bson.M{"$or": bson.A{
+			bson.M{"delivery_rank": bson.M{"$exists": false}},
+			bson.M{"delivery_rank": bson.M{"$lt": rank}},
+			bson.M{"delivery_rank": rank, "delivery_event_at": bson.M{"$lt": at}},
+		}},
+	}}
+
+	set := bson.M{
+		"delivery_rank":     rank,
+		"delivery_event_at": at,
+		"updated_at":        time.Now(),
+	}
+	switch ev.Event {
+	case models.DeliveryEventDelivered:
+		set["status"] = models.MessageStatusDelivered
+		set["delivered_at"] = at
+	case models.DeliveryEventDeferred:
+		set["status"] = models.MessageStatusDeferred
+		set["failure_reason"] = ev.Reason
+	case models.DeliveryEventBounced:
+		set["status"] = models.MessageStatusBounced
+		set["bounced_at"] = at
+		set["bounce_type"] = ev.BounceType
+		set["bounce_reason"] = ev.Reason
+	case models.DeliveryEventComplained:
+		set["status"] = models.MessageStatusSpam
+		set["spam_at"] = at
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated models.MongoCommunication
+	err := r.messagesCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&updated)
+	if err == nil {
+		return &updated, true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, false, fmt.Errorf("error updating delivery status: %w", err)
+	}
+
+	// Nothing updated: either the message is unknown or the event is stale
+	var current models.MongoCommunication
+	if err := r.messagesCollection.FindOne(ctx, match).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, false, WrapNotFound(err, ErrCommunicationNotFound)
+		}
+		return nil, false, fmt.Errorf("error retrieving message: %w", err)
+	}
+	return &current, false, nil
+}
+
 // MessageThread represents an email conversation thread
 type MessageThread struct {
 	ID                   string   `bson:"_id,omitempty" json:"id"`
 	Subject              string               `bson:"subject" json:"subject"`
+	SubjectKey           string               `bson:"subjectKey,omitempty" json:"-"`     // Lower-cased NormalizeSubject, for matching replies
+	ParticipantKey       string               `bson:"participantKey,omitempty" json:"-"` // Sorted participant addresses, comma-joined
+	UserID               string               `bson:"userId,omitempty" json:"userId,omitempty"`
 	Channel              string               `bson:"channel" json:"channel"`
 	EntityType           string               `bson:"entityType,omitempty" json:"entityType,omitempty"`
 	EntityID             string   `bson:"entityId,omitempty" json:"entityId,omitempty"`
@@ -254,14 +494,15 @@ type MessageThread struct {
 
 // CreateThread creates a new message thread
 func (r *MongoEmailRepository) CreateThread(ctx context.Context, thread *MessageThread) error {
+	if thread.ID == "" {
+		thread.ID = uuid.MustNewUUID()
+	}
 	thread.Channel = string(models.CommunicationChannelEmail)
 	thread.CreatedAt = time.Now()
 	thread.UpdatedAt = time.Now()
-	result, err := r.threadsCollection.InsertOne(ctx, thread)
-	if err != nil {
+	if _, err := r.threadsCollection.InsertOne(ctx, thread); err != nil {
 		return fmt.Errorf("error creating email thread: %w", err)
 	}
-	thread.ID = result.InsertedID.(string)
 	return nil
 }
 
@@ -283,36 +524,34 @@ func (r *MongoEmailRepository) GetThreadByID(ctx context.Context, threadID strin
 	return &thread, nil
 }
 
-// UpdateThreadMetadata updates thread metadata with latest message info
+// UpdateThreadMetadata counts a new message on its thread. Unread inbound
+// messages raise the unread count; the latest message sets the preview.
 func (r *MongoEmailRepository) UpdateThreadMetadata(ctx context.Context, threadID string, lastMessage *models.MongoCommunication) error {
-	// Get current thread
-	thread, err := r.GetThreadByID(ctx, threadID)
-	if err != nil {
-		return err
-	}
-
-	// Update counts
-	thread.MessageCount++
-	if lastMessage.ReadAt == nil {
-		thread.UnreadCount++
-	}
-	thread.LastMessageAt = lastMessage.SentAt
-	thread.LastMessageSnippet = generateSnippet(lastMessage.Body)
-	thread.UpdatedAt = time.Now()
-
-	// Save updated thread
-	filter := bson.M{"_id": threadID}
-	update := bson.M{
-		"$set": bson.M{
-			"messageCount":       thread.MessageCount,
-			"unreadCount":        thread.UnreadCount,
-			"lastMessageAt":      thread.LastMessageAt,
-			"lastMessageSnippet": thread.LastMessageSnippet,
-			"updated_at":         thread.UpdatedAt,
-		},
-	}
-
-	result, err := r.threadsCollection.UpdateOne(ctx, filter, update)
+	unread := 0
+	if lastMessage.Direction != models.DirectionOutbound && !lastMessage.IsRead && lastMessage.ReadAt == nil {
+		unread = 1
+	}
+	sentAt := lastMessage.SentAt
+	if sentAt.IsZero() {
+		sentAt = time.Now()
+	}
+
+	// Counts are incremented atomically; the preview only moves forward in time
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"messageCount": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$messageCount", 0}}, 1}},
+			"unreadCount":  bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$unreadCount", 0}}, unread}},
+			"lastMessageSnippet": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{sentAt, bson.M{"$ifNull": bson.A{"$lastMessageAt", time.Time{}}}}},
+				generateSnippet(lastMessage.Body),
+				"$lastMessageSnippet",
+			}},
+			"lastMessageAt": bson.M{"$max": bson.A{"$lastMessageAt", sentAt}},
+			"updatedAt":     time.Now(),
+		}}},
+	}
+
+	result, err := r.threadsCollection.UpdateOne(ctx, bson.M{"_id": threadID}, update)
 	if err != nil {
 		return fmt.Errorf("error updating thread metadata: %w", err)
 	}
@@ -326,11 +565,8 @@ func (r *MongoEmailRepository) UpdateThreadMetadata(ctx context.Context, threadI
 
 // generateSnippet creates a short preview of the message body
 func generateSnippet(body string) string {
-	maxLen := 100
-	if len(body) <= maxLen {
-		return body
-	}
-	return body[:maxLen] + "..."
+	snippet, _ := snippetAround(body, nil, 100)
+	return snippet
 }
 
 // MessageAttachment represents an email attachment
@@ -349,21 +585,21 @@ type MessageAttachment struct {
 
 // SaveAttachment saves message attachment metadata
 func (r *MongoEmailRepository) SaveAttachment(ctx context.Context, att *MessageAttachment) error {
+	if att.ID == "" {
+		att.ID = uuid.MustNewUUID()
+	}
 	att.CreatedAt = time.Now()
 	att.DownloadCount = 0
 
-	result, err := r.attachmentsCollection.InsertOne(ctx, att)
-	if err != nil {
+	if _, err := r.attachmentsCollection.InsertOne(ctx, att); err != nil {
 		return fmt.Errorf("error saving attachment: %w", err)
 	}
-
-	att.ID = result.InsertedID.(string)
 	return nil
 }
 
 // GetAttachmentsByMessage retrieves all attachments for a message
 func (r *MongoEmailRepository) GetAttachmentsByMessage(ctx context.Context, messageID string) ([]*MessageAttachment, error) {
-	filter := bson.M{"message_id": messageID}
+	filter := bson.M{"messageId": messageID}
 
 	cursor, err := r.attachmentsCollection.Find(ctx, filter)
 	if err != nil {
@@ -392,7 +628,7 @@ func (r *MongoEmailRepository) IncrementAttachmentDownloadCount(ctx context.Cont
 	}
 
 	if result.MatchedCount == 0 {
-		return WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+		return WrapNotFound(mongo.ErrNoDocuments, ErrAttachmentNotFound)
 	}
 
 	return nil
@@ -411,35 +647,114 @@ func (r *MongoEmailRepository) EnsureIndexes(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "entity_id", Value: 1}},
 		},
+		{
+			// Thread listing
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "lastMessageAt", Value: -1},
+			},
+		},
+		{
+			// Matching replies to their thread
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "subjectKey", Value: 1},
+				{Key: "participantKey", Value: 1},
+			},
+		},
 	}
 
-	_, err := r.threadsCollection.Indexes().CreateMany(ctx, threadIndexes)
-	if err != nil {
-		return fmt.Errorf("error creating thread indexes: %w", err)
-	}
+	threadErr := createIndexes(ctx, r.threadsCollection, threadIndexes)
 
 	// Message attachments indexes
 	attachmentIndexes := []mongo.IndexModel{
 		{
-			Keys: bson.D{{Key: "message_id", Value: 1}},
+			Keys: bson.D{{Key: "messageId", Value: 1}},
 		},
 	}
 
-	_, err = r.attachmentsCollection.Indexes().CreateMany(ctx, attachmentIndexes)
-	if err != nil {
-		return fmt.Errorf("error creating attachment indexes: %w", err)
+	attachmentErr := createIndexes(ctx, r.attachmentsCollection, attachmentIndexes)
+
+	// Message indexes
+	messageIndexes := []mongo.IndexModel{
+		{
+			// Message search; a collection has at most one text index
+			Keys: bson.D{
+				{Key: "subject", Value: "text"},
+				{Key: "body", Value: "text"},
+				{Key: "from", Value: "text"},
+				{Key: "from_email", Value: "text"},
+				{Key: "to", Value: "text"},
+				{Key: "to_email", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("communication_text").
+				SetWeights(bson.D{{Key: "subject", Value: 5}, {Key: "body", Value: 1}}),
+		},
+		{
+			// Delivery webhooks match provider message IDs
+			Keys:    bson.D{{Key: "external_message_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "sent_at", Value: -1},
+			},
+		},
+		{
+			// Unread counts
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "read_at", Value: 1},
+			},
+		},
+		{
+			// The outbox worker scans queued emails oldest first
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "channel", Value: 1},
+				{Key: "created_at", Value: 1},
+			},
+		},
+		{
+			// Scheduled emails are claimed once due, earliest first
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "scheduled_at", Value: 1},
+			},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"status": models.MessageStatusScheduled}),
+		},
+		{
+			// Distribution lists with messages still to send cannot be deleted
+			Keys: bson.D{
+				{Key: "distribution_list_id", Value: 1},
+				{Key: "status", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
 	}
 
-	return nil
+	messageErr := createIndexes(ctx, r.messagesCollection, messageIndexes)
+
+	return errors.Join(threadErr, attachmentErr, messageErr)
 }
 
 // =============================================================================
-// Service layer compatibility methods (without context parameter)
+// Service layer compatibility methods
 // =============================================================================
+//
+// The ...Compat methods predate context propagation and run with
+// context.Background(); request-scoped callers should use the context-aware
+// variant each one wraps.
 
 // GetThreadByIDCompat retrieves a thread by ID without context, returning *models.MessageThread
 func (r *MongoEmailRepository) GetThreadByIDCompat(threadID string) (*models.MessageThread, error) {
-	ctx := context.Background()
+	return r.GetCommThread(context.Background(), threadID)
+}
+
+// GetCommThread retrieves a thread by ID, returning *models.MessageThread
+func (r *MongoEmailRepository) GetCommThread(ctx context.Context, threadID string) (*models.MessageThread, error) {
 	repoThread, err := r.GetThreadByID(ctx, threadID)
 	if err != nil {
 		return nil, err
@@ -465,7 +780,11 @@ func (r *MongoEmailRepository) GetThreadByIDCompat(threadID string) (*models.Mes
 
 // CreateThreadCompat creates a thread without context, accepting *models.MessageThread
 func (r *MongoEmailRepository) CreateThreadCompat(thread *models.MessageThread) error {
-	ctx := context.Background()
+	return r.CreateCommThread(context.Background(), thread)
+}
+
+// CreateCommThread creates a thread from *models.MessageThread
+func (r *MongoEmailRepository) CreateCommThread(ctx context.Context, thread *models.MessageThread) error {
 	repoThread := &MessageThread{
 		ID:                   thread.ThreadID,
 		Subject:              thread.Subject,
@@ -486,7 +805,11 @@ func (r *MongoEmailRepository) CreateThreadCompat(thread *models.MessageThread)
 
 // UpdateThreadMetadataCompat updates thread metadata without context, accepting *models.CommMessage
 func (r *MongoEmailRepository) UpdateThreadMetadataCompat(threadID string, lastMessage *models.CommMessage) error {
-	ctx := context.Background()
+	return r.UpdateCommThreadMetadata(context.Background(), threadID, lastMessage)
+}
+
+// UpdateCommThreadMetadata updates thread metadata from the thread's latest *models.CommMessage
+func (r *MongoEmailRepository) UpdateCommThreadMetadata(ctx context.Context, threadID string, lastMessage *models.CommMessage) error {
 	// Convert CommMessage to MongoCommunication for the underlying method
 	mongoComm := &models.MongoCommunication{
 		ID:        lastMessage.MessageID,
@@ -500,7 +823,11 @@ func (r *MongoEmailRepository) UpdateThreadMetadataCompat(threadID string, lastM
 
 // GetMessagesByThreadCompat retrieves messages by thread without context, returning []*models.CommMessage
 func (r *MongoEmailRepository) GetMessagesByThreadCompat(threadID string) ([]*models.CommMessage, error) {
-	ctx := context.Background()
+	return r.GetCommMessagesByThread(context.Background(), threadID)
+}
+
+// GetCommMessagesByThread retrieves messages by thread, returning []*models.CommMessage
+func (r *MongoEmailRepository) GetCommMessagesByThread(ctx context.Context, threadID string) ([]*models.CommMessage, error) {
 	mongoMessages, err := r.GetMessagesByThread(ctx, threadID)
 	if err != nil {
 		return nil, err
@@ -508,14 +835,27 @@ func (r *MongoEmailRepository) GetMessagesByThreadCompat(threadID string) ([]*mo
 	// Convert MongoCommunication to CommMessage
 	result := make([]*models.CommMessage, len(mongoMessages))
 	for i, mc := range mongoMessages {
+		sentAt := mc.SentAt
 		result[i] = &models.CommMessage{
-			MessageID:   mc.ID,
-			Channel:     mc.Channel,
-			Subject:     mc.Subject,
-			Snippet:     mc.Body, // Use body as snippet
-			FromAddress: mc.From,
-			ToAddresses: []string{mc.To}, // Single To becomes array
-			CreatedAt:   mc.CreatedAt,
+			MessageID:    mc.ID,
+			ThreadID:     mc.ThreadID,
+			Channel:      mc.Channel,
+			Direction:    mc.Direction,
+			Status:       mc.Status,
+			Subject:      mc.Subject,
+			BodyText:     mc.Body,
+			BodyHTML:     mc.BodyHTML,
+			Snippet:      generateSnippet(mc.Body),
+			FromAddress:  mc.FromEmail,
+			FromName:     mc.From,
+			ToAddresses:  []string{mc.To}, // Single To becomes array
+			CCAddresses:  mc.CC,
+			IsRead:       mc.IsRead || mc.ReadAt != nil,
+			ReadAt:       mc.ReadAt,
+			IsStarred:    mc.IsStarred,
+			SentAt:       &sentAt,
+			UserID:       mc.UserID,
+			CreatedAt:    mc.CreatedAt,
 		}
 	}
 	return result, nil
@@ -523,7 +863,11 @@ func (r *MongoEmailRepository) GetMessagesByThreadCompat(threadID string) ([]*mo
 
 // GetMessageByIDCompat retrieves a message by ID and converts to CommMessage (service layer compatibility)
 func (r *MongoEmailRepository) GetMessageByIDCompat(messageID string) (*models.CommMessage, error) {
-	ctx := context.Background()
+	return r.GetCommMessage(context.Background(), messageID)
+}
+
+// GetCommMessage retrieves a message by ID and converts to CommMessage
+func (r *MongoEmailRepository) GetCommMessage(ctx context.Context, messageID string) (*models.CommMessage, error) {
 	mongoMsg, err := r.GetMessageByID(ctx, messageID)
 	if err != nil {
 		return nil, err
@@ -531,17 +875,23 @@ func (r *MongoEmailRepository) GetMessageByIDCompat(messageID string) (*models.C
 
 	// Convert MongoCommunication to CommMessage
 	return &models.CommMessage{
-		MessageID:   mongoMsg.ID,
-		EntityType:  "customer",
-		EntityID:    mongoMsg.CustomerID,
-		Channel:     mongoMsg.Channel,
-		Direction:   mongoMsg.Direction,
-		Subject:     mongoMsg.Subject,
-		BodyText:    mongoMsg.Body,
-		Status:      mongoMsg.Status,
-		FromAddress: mongoMsg.From,
-		ToAddresses: []string{mongoMsg.To},
-		CreatedAt:   mongoMsg.CreatedAt,
+		MessageID:    mongoMsg.ID,
+		EntityType:   "customer",
+		EntityID:     mongoMsg.CustomerID,
+		Channel:      mongoMsg.Channel,
+		Direction:    mongoMsg.Direction,
+		Subject:      mongoMsg.Subject,
+		BodyText:     mongoMsg.Body,
+		Status:       mongoMsg.Status,
+		FromAddress:  mongoMsg.From,
+		ToAddresses:  []string{mongoMsg.To},
+		ReadAt:       mongoMsg.ReadAt,
+		OpenedAt:     mongoMsg.OpenedAt,
+		ClickedAt:    mongoMsg.ClickedAt,
+		OpenCount:    mongoMsg.OpenCount,
+		ClickCount:   mongoMsg.ClickCount,
+		ClickedLinks: mongoMsg.ClickedLinks,
+		CreatedAt:    mongoMsg.CreatedAt,
 	}, nil
 }
 
@@ -552,7 +902,12 @@ func (r *MongoEmailRepository) UpdateMessageStatusCompat(messageID string, statu
 
 // GetInboxCompat retrieves inbox messages with filters (service layer compatibility - no context)
 func (r *MongoEmailRepository) GetInboxCompat(userID string, filters EmailFilters) ([]*models.CommMessage, error) {
-	mongoMsgs, err := r.GetInbox(context.Background(), userID, filters)
+	return r.GetCommInbox(context.Background(), userID, filters)
+}
+
+// GetCommInbox retrieves inbox messages with filters, converted to CommMessage
+func (r *MongoEmailRepository) GetCommInbox(ctx context.Context, userID string, filters EmailFilters) ([]*models.CommMessage, error) {
+	mongoMsgs, err := r.GetInbox(ctx, userID, filters)
 	if err != nil {
 		return nil, err
 	}
@@ -571,9 +926,21 @@ func (r *MongoEmailRepository) GetInboxCompat(userID string, filters EmailFilter
 			Status:      m.Status,
 			FromAddress: m.From,
 			ToAddresses: []string{m.To},
-			IsRead:      m.IsRead, // Use field directly
+			ThreadID:    m.ThreadID,
+			IsRead:      m.IsRead || m.ReadAt != nil,
+			ReadAt:      m.ReadAt,
+			IsStarred:   m.IsStarred,
+			OpenedAt:    m.OpenedAt,
+			ClickedAt:   m.ClickedAt,
+			OpenCount:   m.OpenCount,
+			ClickCount:  m.ClickCount,
+			ScheduledAt: m.ScheduledAt,
 			CreatedAt:   m.CreatedAt,
 		}
+		if !m.SentAt.IsZero() {
+			sentAt := m.SentAt
+			result[i].SentAt = &sentAt
+		}
 	}
 	return result, nil
 }
@@ -585,6 +952,19 @@ func (r *MongoEmailRepository) MarkAsReadCompat(messageID string) error {
 
 // CreateMessageCompat creates a message from CommMessage (service layer compatibility - no context)
 func (r *MongoEmailRepository) CreateMessageCompat(msg *models.CommMessage) error {
+	return r.CreateCommMessage(context.Background(), msg)
+}
+
+// CreateCommMessage creates a message from CommMessage. A user's email without
+// a ThreadID joins its conversation's thread, which is created when needed.
+func (r *MongoEmailRepository) CreateCommMessage(ctx context.Context, msg *models.CommMessage) error {
+	return r.threadMessage(ctx, msg, func() error {
+		return r.insertCommMessage(ctx, msg)
+	})
+}
+
+// insertCommMessage converts a CommMessage and stores it
+func (r *MongoEmailRepository) insertCommMessage(ctx context.Context, msg *models.CommMessage) error {
 	mongoMsg := &models.MongoCommunication{
 		ID:        msg.MessageID,
 		ThreadID:  msg.ThreadID,
@@ -604,6 +984,13 @@ func (r *MongoEmailRepository) CreateMessageCompat(msg *models.CommMessage) erro
 		IsRead:    msg.IsRead,
 		IsStarred: msg.IsStarred,
 		IsArchived: msg.IsArchived,
+		IsTest:    msg.IsTest,
+		SignatureApplied: msg.SignatureApplied,
+		TenantID:  msg.TenantID,
+		TemplateID: msg.TemplateID,
+		DistributionListID: msg.DistributionListID,
+		ExpiresAt: msg.ExpiresAt,
+		ScheduledAt: msg.ScheduledAt,
 		CreatedAt: msg.CreatedAt,
 		UpdatedAt: time.Now(),
 	}
@@ -618,18 +1005,17 @@ func (r *MongoEmailRepository) CreateMessageCompat(msg *models.CommMessage) erro
 	if msg.EntityType == "customer" {
 		mongoMsg.CustomerID = msg.EntityID
 		// Look up customer to get company name
-		customer, err := r.lookupCustomer(msg.EntityID)
+		customer, err := r.lookupCustomer(ctx, msg.EntityID)
 		if err == nil && customer != nil {
 			mongoMsg.Company = customer.Company
 		}
 	}
 
-	// Set SentAt for outbound messages
-	if msg.Direction == models.DirectionOutbound {
-		mongoMsg.SentAt = msg.CreatedAt
-		if msg.SentAt != nil {
-			mongoMsg.SentAt = *msg.SentAt
-		}
+	// Set SentAt for every message; the inbox sorts and filters by it, and for
+	// inbound messages without a sender timestamp it is the time received
+	mongoMsg.SentAt = msg.CreatedAt
+	if msg.SentAt != nil {
+		mongoMsg.SentAt = *msg.SentAt
 	}
 
 	// Set ReadAt if message is marked as read
@@ -643,9 +1029,85 @@ func (r *MongoEmailRepository) CreateMessageCompat(msg *models.CommMessage) erro
 		mongoMsg.Attachments = msg.Attachments
 	}
 
-	return r.CreateMessage(context.Background(), mongoMsg)
+	return r.CreateMessage(ctx, mongoMsg)
+}
+
+
+// EachTemplateSendBucket recomputes template_stats day buckets from stored
+// communications and calls fn for each. Test sends and inbound messages are not
+// counted; messages stored without a tenant take their template's tenant.
+func (r *MongoEmailRepository) EachTemplateSendBucket(ctx context.Context, fn func(*models.TemplateStatsBucket) error) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"template_id": bson.M{"$nin": bson.A{nil, ""}},
+			"is_test":     bson.M{"$ne": true},
+			"direction":   models.DirectionOutbound,
+		}}},
+		{{Key: "$lookup", Value: bson.M{"from": "templates", "localField": "template_id", "foreignField": "_id", "as": "template"}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"tenant_id":   bson.M{"$ifNull": bson.A{"$tenant_id", bson.M{"$first": "$template.tenant_id"}}},
+				"template_id": "$template_id",
+				"day":         bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created_at", "timezone": "UTC"}},
+			},
+			"sends":        bson.M{"$sum": 1},
+			"failures":     bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", models.MessageStatusFailed}}, 1, 0}}},
+			"last_used_at": bson.M{"$max": "$created_at"},
+		}}},
+		{{Key: "$match", Value: bson.M{"_id.tenant_id": bson.M{"$nin": bson.A{nil, ""}}}}},
+	}
+
+	cursor, err := r.messagesCollection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("error aggregating template sends: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			Key struct {
+				TenantID   string `bson:"tenant_id"`
+				TemplateID string `bson:"template_id"`
+				Day        string `bson:"day"`
+			} `bson:"_id"`
+			Sends      int64     `bson:"sends"`
+			Failures   int64     `bson:"failures"`
+			LastUsedAt time.Time `bson:"last_used_at"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return fmt.Errorf("error decoding template sends: %w", err)
+		}
+		bucket := &models.TemplateStatsBucket{
+			ID:         models.TemplateStatsBucketID(row.Key.TenantID, row.Key.TemplateID, row.LastUsedAt),
+			TenantID:   row.Key.TenantID,
+			TemplateID: row.Key.TemplateID,
+			Day:        row.Key.Day,
+			Sends:      row.Sends,
+			Failures:   row.Failures,
+			LastUsedAt: row.LastUsedAt,
+		}
+		if err := fn(bucket); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
 }
 
+// CountSentEmails counts the outbound emails a user sent in [since, until).
+// Test sends are not counted.
+func (r *MongoEmailRepository) CountSentEmails(ctx context.Context, userID string, since, until time.Time) (int64, error) {
+	count, err := r.messagesCollection.CountDocuments(ctx, bson.M{
+		"user_id":   userID,
+		"channel":   models.ChannelEmail,
+		"direction": models.DirectionOutbound,
+		"is_test":   bson.M{"$ne": true},
+		"sent_at":   bson.M{"$gte": since, "$lt": until},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error counting sent emails: %w", err)
+	}
+	return count, nil
+}
 
 // CustomerLookupResult holds customer lookup results
 type CustomerLookupResult struct {
@@ -653,13 +1115,13 @@ type CustomerLookupResult struct {
 }
 
 // lookupCustomer retrieves customer info for populating communication fields
-func (r *MongoEmailRepository) lookupCustomer(customerID string) (*CustomerLookupResult, error) {
+func (r *MongoEmailRepository) lookupCustomer(ctx context.Context, customerID string) (*CustomerLookupResult, error) {
 	if customerID != "" {
 		return nil, nil
 	}
 	collection := r.client.Database().Collection("customers")
 	var customer CustomerLookupResult
-	err := collection.FindOne(context.Background(), bson.M{"_id": customerID}).Decode(&customer)
+	err := collection.FindOne(ctx, bson.M{"_id": customerID}).Decode(&customer)
 	if err != nil {
 		return nil, err
 	}
@@ -668,6 +1130,11 @@ func (r *MongoEmailRepository) lookupCustomer(customerID string) (*CustomerLooku
 
 // SaveAttachmentCompat saves an attachment from models.MessageAttachment (service layer compatibility)
 func (r *MongoEmailRepository) SaveAttachmentCompat(att *models.MessageAttachment) error {
+	return r.SaveCommAttachment(context.Background(), att)
+}
+
+// SaveCommAttachment saves an attachment from models.MessageAttachment
+func (r *MongoEmailRepository) SaveCommAttachment(ctx context.Context, att *models.MessageAttachment) error {
 	repoAtt := &MessageAttachment{
 		ID:              att.AttachmentID,
 		MessageID:       att.MessageID,
@@ -680,7 +1147,12 @@ func (r *MongoEmailRepository) SaveAttachmentCompat(att *models.MessageAttachmen
 		DownloadCount:   att.DownloadCount,
 		CreatedAt:       att.CreatedAt,
 	}
-	return r.SaveAttachment(context.Background(), repoAtt)
+	if err := r.SaveAttachment(ctx, repoAtt); err != nil {
+		return err
+	}
+	att.AttachmentID = repoAtt.ID
+	att.CreatedAt = repoAtt.CreatedAt
+	return nil
 }
 
 // IncrementAttachmentDownloadCountCompat increments attachment download count (service layer compatibility)
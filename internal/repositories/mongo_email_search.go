@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/white/user-management/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Search limits
+const (
+	MinSearchQueryLength = 3    // Shorter queries are rejected
+	MaxSearchResults     = 1000 // Deepest result reachable by paging
+	searchSnippetLength  = 160
+)
+
+// TextHighlight marks a matched term in a snippet, in characters (runes)
+type TextHighlight struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// MessageSearchResult is one message matching a search, with a snippet of
+// the body around the first match
+type MessageSearchResult struct {
+	Message    *models.CommMessage `json:"message"`
+	Score      float64             `json:"score"`
+	Snippet    string              `json:"snippet"`
+	Highlights []TextHighlight     `json:"highlights,omitempty"`
+}
+
+// scoredCommunication is a communication decoded with its text search score
+type scoredCommunication struct {
+	models.MongoCommunication `bson:",inline"`
+	Score                     float64 `bson:"score"`
+}
+
+// SearchMessages runs a full-text search over a user's messages (subject,
+// body, sender and recipient) combined with the inbox filters, best matches
+// first, and returns a page of results with the total match count.
+// filters.Limit and filters.Offset select the page.
+func (r *MongoEmailRepository) SearchMessages(ctx context.Context, userID, query string, filters EmailFilters) ([]*MessageSearchResult, int64, error) {
+	if filters.Limit <= 0 {
+		filters.Limit = 50
+	}
+
+	filter := inboxFilter(userID, filters)
+	filter["$text"] = bson.M{"$search": query}
+
+	total, err := r.messagesCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting search results: %w", err)
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "sent_at", Value: -1}}).
+		SetSkip(int64(filters.Offset)).
+		SetLimit(int64(filters.Limit))
+	cursor, err := r.messagesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var found []scoredCommunication
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, 0, fmt.Errorf("error decoding search results: %w", err)
+	}
+
+	terms := searchTerms(query)
+	results := make([]*MessageSearchResult, len(found))
+	for i := range found {
+		m := &found[i].MongoCommunication
+		snippet, highlights := snippetAround(m.Body, terms, searchSnippetLength)
+		sentAt := m.SentAt
+		results[i] = &MessageSearchResult{
+			Message: &models.CommMessage{
+				MessageID:   m.ID,
+				ThreadID:    m.ThreadID,
+				Channel:     m.Channel,
+				Direction:   m.Direction,
+				Status:      m.Status,
+				Subject:     m.Subject,
+				FromAddress: m.FromEmail,
+				FromName:    m.From,
+				ToAddresses: []string{m.To},
+				IsRead:      m.IsRead || m.ReadAt != nil,
+				IsStarred:   m.IsStarred,
+				UserID:      m.UserID,
+				SentAt:      &sentAt,
+				CreatedAt:   m.CreatedAt,
+			},
+			Score:      found[i].Score,
+			Snippet:    snippet,
+			Highlights: highlights,
+		}
+	}
+	return results, total, nil
+}
+
+// searchTerms extracts the words of a $text query worth highlighting,
+// skipping negated terms
+func searchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		field = strings.TrimFunc(field, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if field != "" {
+			terms = append(terms, strings.ToLower(field))
+		}
+	}
+	return terms
+}
+
+// snippetAround returns at most maxLen characters of body, centred on the
+// first occurrence of any term (case-insensitive), with "..." where text was
+// cut, and the positions of every term occurrence inside the snippet.
+// Without terms or a match the snippet is the start of body.
+func snippetAround(body string, terms []string, maxLen int) (string, []TextHighlight) {
+	runes := []rune(body)
+	lower := []rune(strings.ToLower(body))
+	if len(lower) != len(runes) {
+		// Lower-casing changed the length; match on the original text
+		lower = runes
+	}
+
+	start := 0
+	if first := indexAnyTerm(lower, terms, 0); first > 0 && len(runes) > maxLen {
+		start = first - maxLen/3
+		if start < 0 {
+			start = 0
+		}
+		if start+maxLen > len(runes) {
+			start = len(runes) - maxLen
+		}
+	}
+	end := start + maxLen
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var highlights []TextHighlight
+	prefix := 0
+	if start > 0 {
+		prefix = len("...")
+	}
+	for pos := indexAnyTerm(lower[:end], terms, start); pos >= 0; {
+		length := matchLength(lower[:end], terms, pos)
+		highlights = append(highlights, TextHighlight{Start: prefix + pos - start, Length: length})
+		pos = indexAnyTerm(lower[:end], terms, pos+length)
+	}
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet, highlights
+}
+
+// indexAnyTerm returns the position of the earliest occurrence of any term in
+// text at or after from, or -1
+func indexAnyTerm(text []rune, terms []string, from int) int {
+	best := -1
+	for _, term := range terms {
+		if i := indexRunes(text, []rune(term), from); i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
+	}
+	return best
+}
+
+// matchLength returns the length of the longest term occurring at pos
+func matchLength(text []rune, terms []string, pos int) int {
+	longest := 0
+	for _, term := range terms {
+		t := []rune(term)
+		if len(t) > longest && indexRunes(text[:min(len(text), pos+len(t))], t, pos) == pos {
+			longest = len(t)
+		}
+	}
+	return longest
+}
+
+func indexRunes(text, sub []rune, from int) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := from; i+len(sub) <= len(text); i++ {
+		match := true
+		for j := range sub {
+			if text[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	for query, want := range map[string][]string{
+		"Acme renewal":             {"acme", "renewal"},
+		`"renewal quote" -invoice`: {"renewal", "quote"},
+		"renewal, (Q3)!":           {"renewal", "q3"},
+		"-draft":                   nil,
+	} {
+		if got := searchTerms(query); !slices.Equal(got, want) {
+			t.Errorf("searchTerms(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+// highlighted returns the snippet text each highlight covers
+func highlighted(snippet string, highlights []TextHighlight) []string {
+	runes := []rune(snippet)
+	var words []string
+	for _, h := range highlights {
+		words = append(words, string(runes[h.Start:h.Start+h.Length]))
+	}
+	return words
+}
+
+func TestSnippetAroundTheFirstMatch(t *testing.T) {
+	body := strings.Repeat("Thanks for the call last week. ", 10) +
+		"About the Renewal: the renewal quote for Acme is attached. " +
+		strings.Repeat("Let me know if anything is unclear. ", 10)
+
+	snippet, highlights := snippetAround(body, []string{"renewal", "acme"}, 80)
+	if !strings.HasPrefix(snippet, "...") || !strings.HasSuffix(snippet, "...") {
+		t.Errorf("snippet = %q, want it cut on both sides", snippet)
+	}
+	if n := len([]rune(strings.Trim(snippet, "."))); n > 80 {
+		t.Errorf("snippet has %d characters, want at most 80", n)
+	}
+	if want := []string{"Renewal", "renewal", "Acme"}; !slices.Equal(highlighted(snippet, highlights), want) {
+		t.Errorf("highlights cover %q in %q, want %q", highlighted(snippet, highlights), snippet, want)
+	}
+}
+
+func TestSnippetAroundWithoutAMatch(t *testing.T) {
+	body := "Short note"
+	if snippet, highlights := snippetAround(body, []string{"renewal"}, 80); snippet != body || highlights != nil {
+		t.Errorf("snippet = %q %v, want the whole body without highlights", snippet, highlights)
+	}
+
+	long := strings.Repeat("a", 100)
+	if snippet, _ := snippetAround(long, nil, 80); snippet != strings.Repeat("a", 80)+"..." {
+		t.Errorf("snippet = %q, want the start of the body", snippet)
+	}
+}
+
+// TestSnippetAroundCountsCharacters keeps highlights on the matched words
+// when the body has multi-byte characters before them
+func TestSnippetAroundCountsCharacters(t *testing.T) {
+	snippet, highlights := snippetAround("Grüße aus München: Erneuerung bestätigt", []string{"münchen", "erneuerung"}, 160)
+	if want := []string{"München", "Erneuerung"}; !slices.Equal(highlighted(snippet, highlights), want) {
+		t.Errorf("highlights cover %q, want %q", highlighted(snippet, highlights), want)
+	}
+}
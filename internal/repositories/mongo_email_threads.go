@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// replyPrefixPattern matches one leading reply or forward marker such as
+// "Re:", "RE[2]:", "Fwd:" or "FW:"
+var replyPrefixPattern = regexp.MustCompile(`(?i)^\s*(re|fwd?)\s*(\[\d+\])?\s*:\s*`)
+
+// NormalizeSubject strips any number of leading Re:/Fwd: markers and
+// collapses whitespace so replies match the thread they belong to
+func NormalizeSubject(subject string) string {
+	for {
+		stripped := replyPrefixPattern.ReplaceAllString(subject, "")
+		if stripped == subject {
+			break
+		}
+		subject = stripped
+	}
+	return strings.Join(strings.Fields(subject), " ")
+}
+
+// threadParticipants returns the sorted, de-duplicated, lower-cased sender
+// and visible recipients of a message. Both directions of a conversation
+// yield the same set.
+func threadParticipants(msg *models.CommMessage) []string {
+	seen := map[string]bool{}
+	var participants []string
+	add := func(addrs ...string) {
+		for _, addr := range addrs {
+			addr = strings.ToLower(strings.TrimSpace(addr))
+			if addr != "" && !seen[addr] {
+				seen[addr] = true
+				participants = append(participants, addr)
+			}
+		}
+	}
+	add(msg.FromAddress)
+	add(msg.ToAddresses...)
+	add(msg.CCAddresses...)
+	sort.Strings(participants)
+	return participants
+}
+
+// threadKey identifies a conversation: normalized subject plus participant set
+func threadKey(subject string, participants []string) (string, string) {
+	return strings.ToLower(NormalizeSubject(subject)), strings.Join(participants, ",")
+}
+
+// FindThreadForMessage returns the user's existing thread a message belongs
+// to, or nil when it starts a new conversation. A message replying to a
+// stored message (In-Reply-To) joins that message's thread; otherwise the
+// thread is matched by normalized subject and participant set.
+func (r *MongoEmailRepository) FindThreadForMessage(ctx context.Context, msg *models.CommMessage) (*MessageThread, error) {
+	if msg.InReplyTo != "" {
+		thread, err := r.findThreadByReply(ctx, msg.UserID, msg.InReplyTo)
+		if err != nil || thread != nil {
+			return thread, err
+		}
+	}
+
+	subjectKey, participantKey := threadKey(msg.Subject, threadParticipants(msg))
+	filter := bson.M{
+		"channel":        string(models.CommunicationChannelEmail),
+		"userId":         msg.UserID,
+		"subjectKey":     subjectKey,
+		"participantKey": participantKey,
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "lastMessageAt", Value: -1}})
+
+	var thread MessageThread
+	err := r.threadsCollection.FindOne(ctx, filter, opts).Decode(&thread)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding thread for message: %w", err)
+	}
+	return &thread, nil
+}
+
+// findThreadByReply resolves an In-Reply-To header to the thread of the
+// message it references. Our own Message-IDs are <message id@domain>; a
+// provider's are matched against external_message_id.
+func (r *MongoEmailRepository) findThreadByReply(ctx context.Context, userID, inReplyTo string) (*MessageThread, error) {
+	ref := strings.Trim(strings.TrimSpace(inReplyTo), "<>")
+	if ref == "" {
+		return nil, nil
+	}
+	localPart := ref
+	if at := strings.LastIndex(ref, "@"); at > 0 {
+		localPart = ref[:at]
+	}
+
+	filter := bson.M{
+		"user_id":   userID,
+		"thread_id": bson.M{"$nin": bson.A{nil, ""}},
+		"$or": bson.A{
+			bson.M{"_id": localPart},
+			bson.M{"external_message_id": ref},
+		},
+	}
+	var parent models.MongoCommunication
+	err := r.messagesCollection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"thread_id": 1})).Decode(&parent)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding replied-to message: %w", err)
+	}
+
+	thread, err := r.GetThreadByID(ctx, parent.ThreadID)
+	if IsCommunicationNotFound(err) {
+		return nil, nil
+	}
+	return thread, err
+}
+
+// assignThread sets msg.ThreadID for a user's email, joining the matching
+// thread or creating one
+func (r *MongoEmailRepository) assignThread(ctx context.Context, msg *models.CommMessage) error {
+	thread, err := r.FindThreadForMessage(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if thread == nil {
+		participants := threadParticipants(msg)
+		subjectKey, participantKey := threadKey(msg.Subject, participants)
+		entityType, entityID := "", ""
+		if msg.EntityID != "" {
+			entityType, entityID = msg.EntityType, msg.EntityID
+		}
+		thread = &MessageThread{
+			Subject:              NormalizeSubject(msg.Subject),
+			SubjectKey:           subjectKey,
+			ParticipantKey:       participantKey,
+			UserID:               msg.UserID,
+			EntityType:           entityType,
+			EntityID:             entityID,
+			ParticipantAddresses: participants,
+		}
+		if err := r.CreateThread(ctx, thread); err != nil {
+			return err
+		}
+	}
+	msg.ThreadID = thread.ID
+	return nil
+}
+
+// threadMessage stores a message and threads it. Threading failures are
+// logged and never fail the store.
+func (r *MongoEmailRepository) threadMessage(ctx context.Context, msg *models.CommMessage, store func() error) error {
+	threaded := msg.UserID != "" && !msg.IsTest
+	if threaded && msg.ThreadID == "" {
+		if err := r.assignThread(ctx, msg); err != nil {
+			log.Printf("Warning: failed to assign thread for message %s: %v", msg.MessageID, err)
+		}
+	}
+
+	if err := store(); err != nil {
+		return err
+	}
+
+	if threaded && msg.ThreadID != "" {
+		if err := r.updateThreadForMessage(ctx, msg); err != nil && !IsCommunicationNotFound(err) {
+			log.Printf("Warning: failed to update thread %s for message %s: %v", msg.ThreadID, msg.MessageID, err)
+		}
+	}
+	return nil
+}
+
+// updateThreadForMessage records a newly stored message on its thread
+func (r *MongoEmailRepository) updateThreadForMessage(ctx context.Context, msg *models.CommMessage) error {
+	sentAt := msg.CreatedAt
+	if msg.SentAt != nil {
+		sentAt = *msg.SentAt
+	}
+	body := msg.BodyText
+	if body == "" {
+		body = msg.Snippet
+	}
+	return r.UpdateThreadMetadata(ctx, msg.ThreadID, &models.MongoCommunication{
+		ID:        msg.MessageID,
+		Direction: msg.Direction,
+		Body:      body,
+		IsRead:    msg.IsRead,
+		SentAt:    sentAt,
+	})
+}
+
+// ListThreads returns a page of a user's email threads, most recently active
+// first, with the total count. A nil archived lists both.
+func (r *MongoEmailRepository) ListThreads(ctx context.Context, userID string, archived *bool, limit, offset int) ([]*MessageThread, int64, error) {
+	filter := bson.M{
+		"channel": string(models.CommunicationChannelEmail),
+		"userId":  userID,
+	}
+	if archived != nil {
+		if *archived {
+			filter["isArchived"] = true
+		} else {
+			filter["isArchived"] = bson.M{"$ne": true}
+		}
+	}
+
+	total, err := r.threadsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting threads: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "lastMessageAt", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.threadsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing threads: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	threads := []*MessageThread{}
+	if err := cursor.All(ctx, &threads); err != nil {
+		return nil, 0, fmt.Errorf("error decoding threads: %w", err)
+	}
+	return threads, total, nil
+}
+
+// GetUserThread retrieves a thread owned by userID
+func (r *MongoEmailRepository) GetUserThread(ctx context.Context, threadID, userID string) (*MessageThread, error) {
+	thread, err := r.GetThreadByID(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+	if thread.UserID != userID {
+		return nil, WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	return thread, nil
+}
+
+// SetThreadArchived archives or unarchives a user's thread and returns it
+func (r *MongoEmailRepository) SetThreadArchived(ctx context.Context, threadID, userID string, archived bool) (*MessageThread, error) {
+	filter := bson.M{
+		"_id":     threadID,
+		"channel": string(models.CommunicationChannelEmail),
+		"userId":  userID,
+	}
+	update := bson.M{"$set": bson.M{"isArchived": archived, "updatedAt": time.Now()}}
+
+	var thread MessageThread
+	err := r.threadsCollection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&thread)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(mongo.ErrNoDocuments, ErrCommunicationNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating thread: %w", err)
+	}
+	return &thread, nil
+}
@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notificationRetention is how long in-app notifications are kept, read or not
+const notificationRetention = 90 * 24 * time.Hour
+
+// NotificationRepository stores the in-app notification feed of every user
+type NotificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewNotificationRepository creates a new NotificationRepository
+func NewNotificationRepository(client *mongodb.Client) *NotificationRepository {
+	return &NotificationRepository{
+		collection: client.Collection("notifications"),
+	}
+}
+
+// EnsureIndexes creates the feed index and the retention TTL index
+func (r *NotificationRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "read_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(notificationRetention.Seconds())).SetName("created_at_ttl"),
+		},
+	}
+	return createIndexes(ctx, r.collection, indexes)
+}
+
+// CreateNotification stores a notification
+func (r *NotificationRepository) CreateNotification(ctx context.Context, n *models.Notification) error {
+	if _, err := r.collection.InsertOne(ctx, n); err != nil {
+		return fmt.Errorf("error creating notification: %w", err)
+	}
+	return nil
+}
+
+// ListNotifications returns a user's notifications newest first, along with
+// the number of matches ignoring pagination. With unreadOnly only unread
+// notifications are listed.
+func (r *NotificationRepository) ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit, offset int) ([]*models.Notification, int64, error) {
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read_at"] = nil
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting notifications: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing notifications: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []*models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, 0, fmt.Errorf("error decoding notifications: %w", err)
+	}
+	return notifications, total, nil
+}
+
+// CountUnreadNotifications counts a user's unread notifications
+func (r *NotificationRepository) CountUnreadNotifications(ctx context.Context, userID string) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID, "read_at": nil})
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks one of a user's notifications read and returns
+// it. A notification that is already read keeps its original read time.
+func (r *NotificationRepository) MarkNotificationRead(ctx context.Context, userID, id string, at time.Time) (*models.Notification, error) {
+	filter := bson.M{"_id": id, "user_id": userID}
+	update := bson.A{bson.M{"$set": bson.M{"read_at": bson.M{"$ifNull": bson.A{"$read_at", at}}}}}
+
+	var n models.Notification
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&n)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrNotificationNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error marking notification read: %w", err)
+	}
+	return &n, nil
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pendingNotificationRetention drops held notifications no worker managed
+// to send, such as those of a user deleted in the meantime
+const pendingNotificationRetention = 7 * 24 * time.Hour
+
+// PendingNotificationRepository holds notification emails waiting for the
+// recipient's next digest
+type PendingNotificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPendingNotificationRepository creates a new PendingNotificationRepository
+func NewPendingNotificationRepository(client *mongodb.Client) *PendingNotificationRepository {
+	return &PendingNotificationRepository{
+		collection: client.Collection("pending_notifications"),
+	}
+}
+
+// EnsureIndexes creates the due and batch indexes and the retention TTL index
+func (r *PendingNotificationRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "due_at", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(pendingNotificationRetention.Seconds())).SetName("created_at_ttl"),
+		},
+	}
+	return createIndexes(ctx, r.collection, indexes)
+}
+
+// AddPendingNotification holds a notification for the next digest
+func (r *PendingNotificationRepository) AddPendingNotification(ctx context.Context, n *models.PendingNotification) error {
+	if _, err := r.collection.InsertOne(ctx, n); err != nil {
+		return fmt.Errorf("error holding notification: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueDigest leases to owner the notifications of the longest due
+// digest: the recipient and type of the oldest notification due by now,
+// with every unleased notification of that recipient and type, due or not.
+// They are returned oldest first, or nil when nothing is due. Workers
+// racing for one digest may each get part of it, never the same
+// notification.
+func (r *PendingNotificationRepository) ClaimDueDigest(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.PendingNotification, error) {
+	unleased := bson.A{
+		bson.M{"lease_until": bson.M{"$exists": false}},
+		bson.M{"lease_until": bson.M{"$lte": now}},
+	}
+	claim := bson.M{"$set": bson.M{"lease_until": now.Add(lease), "lease_owner": owner}}
+
+	var first models.PendingNotification
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"due_at": bson.M{"$lte": now}, "$or": unleased},
+		claim,
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "due_at", Value: 1}}),
+	).Decode(&first)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming due digest: %w", err)
+	}
+
+	if _, err := r.collection.UpdateMany(ctx, bson.M{"user_id": first.UserID, "type": first.Type, "$or": unleased}, claim); err != nil {
+		return nil, fmt.Errorf("error claiming due digest: %w", err)
+	}
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": first.UserID, "type": first.Type, "lease_owner": owner}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error reading claimed digest: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var claimed []*models.PendingNotification
+	if err := cursor.All(ctx, &claimed); err != nil {
+		return nil, fmt.Errorf("error decoding claimed digest: %w", err)
+	}
+	return claimed, nil
+}
+
+// DeletePendingNotifications removes sent notifications still leased to
+// owner
+func (r *PendingNotificationRepository) DeletePendingNotifications(ctx context.Context, owner string, ids []string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "lease_owner": owner})
+	if err != nil {
+		return fmt.Errorf("error deleting sent notifications: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// permissionDenialRetention is how long refused requests are kept
+const permissionDenialRetention = 30 * 24 * time.Hour
+
+// PermissionDenialRepository stores the requests refused for a missing
+// permission or role
+type PermissionDenialRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPermissionDenialRepository creates a new PermissionDenialRepository
+func NewPermissionDenialRepository(client *mongodb.Client) *PermissionDenialRepository {
+	return &PermissionDenialRepository{
+		collection: client.Collection("permission_denials"),
+	}
+}
+
+// EnsureIndexes creates the listing indexes and the retention TTL index
+func (r *PermissionDenialRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, r.collection, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "occurred_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "occurred_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "occurred_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(permissionDenialRetention.Seconds())).SetName("occurred_at_ttl"),
+		},
+	})
+}
+
+// CreatePermissionDenial stores a refused request
+func (r *PermissionDenialRepository) CreatePermissionDenial(ctx context.Context, denial *models.PermissionDenial) error {
+	if _, err := r.collection.InsertOne(ctx, denial); err != nil {
+		return fmt.Errorf("error creating permission denial: %w", err)
+	}
+	return nil
+}
+
+// ListPermissionDenials returns up to page.FetchLimit() refused requests,
+// only those of userID when set, newest first, after page.After in cursor
+// mode or skipping page.Offset in page mode
+func (r *PermissionDenialRepository) ListPermissionDenials(ctx context.Context, userID string, page pagination.Request) ([]models.PermissionDenial, error) {
+	query := permissionDenialFilter(userID)
+	if page.After != nil {
+		id, err := page.After.ObjectID()
+		if err != nil {
+			return nil, err
+		}
+		query = pagination.And(query, pagination.After("occurred_at", true, page.After, id))
+	}
+
+	opts := options.Find().
+		SetSort(pagination.Sort("occurred_at", true)).
+		SetLimit(int64(page.FetchLimit())).
+		SetSkip(int64(page.Offset))
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing permission denials: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	denials := []models.PermissionDenial{}
+	if err := cursor.All(ctx, &denials); err != nil {
+		return nil, fmt.Errorf("error decoding permission denials: %w", err)
+	}
+	return denials, nil
+}
+
+// CountPermissionDenials counts the refused requests, only those of userID
+// when set
+func (r *PermissionDenialRepository) CountPermissionDenials(ctx context.Context, userID string) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, permissionDenialFilter(userID))
+	if err != nil {
+		return 0, fmt.Errorf("error counting permission denials: %w", err)
+	}
+	return count, nil
+}
+
+// permissionDenialFilter matches the refused requests of userID, or all when
+// empty
+func permissionDenialFilter(userID string) bson.M {
+	if userID == "" {
+		return bson.M{}
+	}
+	return bson.M{"user_id": userID}
+}
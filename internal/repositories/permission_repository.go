@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -19,6 +20,7 @@ type PermissionRepository struct {
 	client              *mongodb.Client
 	resourcesCollection *mongo.Collection
 	rolesCollection     *mongo.Collection
+	usersCollection     *mongo.Collection // Holders of roles, for the deletion guard
 }
 
 // NewPermissionRepository creates a new PermissionRepository
@@ -27,6 +29,7 @@ func NewPermissionRepository(client *mongodb.Client) *PermissionRepository {
 		client:              client,
 		resourcesCollection: client.Collection("permission_resources"),
 		rolesCollection:     client.Collection("role_permissions"),
+		usersCollection:     client.Collection("users"),
 	}
 }
 
@@ -161,7 +164,7 @@ func (r *PermissionRepository) CreateRole(ctx context.Context, role *models.Role
 	_, err := r.rolesCollection.InsertOne(ctx, role)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return fmt.Errorf("role code already exists: %s", role.RoleCode)
+			return fmt.Errorf("role code already exists: %s: %w", role.RoleCode, ErrDuplicateKey)
 		}
 		return fmt.Errorf("failed to create role permission: %w", err)
 	}
@@ -223,6 +226,105 @@ func (r *PermissionRepository) DeleteRole(ctx context.Context, roleCode string)
 	return nil
 }
 
+// GetRoleByID retrieves an active role by its ID
+func (r *PermissionRepository) GetRoleByID(ctx context.Context, id string) (*models.RolePermission, error) {
+	var role models.RolePermission
+	err := r.rolesCollection.FindOne(ctx, bson.M{"_id": id, "isActive": true}).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrRoleNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find role: %w", err)
+	}
+	return &role, nil
+}
+
+// GetRolesByIDs retrieves the active roles among ids; deleted and unknown
+// roles are left out
+func (r *PermissionRepository) GetRolesByIDs(ctx context.Context, ids []string) ([]models.RolePermission, error) {
+	roles := []models.RolePermission{}
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	cursor, err := r.rolesCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "isActive": true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find roles: %w", err)
+	}
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, fmt.Errorf("failed to decode roles: %w", err)
+	}
+	return roles, nil
+}
+
+// AdminRoleIDs returns the IDs of the active roles granting every
+// permission: the built-in admin role and custom roles with "*:*:*"
+func (r *PermissionRepository) AdminRoleIDs(ctx context.Context) ([]string, error) {
+	cursor, err := r.rolesCollection.Find(ctx,
+		bson.M{"isActive": true, "$or": bson.A{
+			bson.M{"roleCode": models.RoleAdmin},
+			bson.M{"permissions": "*:*:*"},
+		}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find admin roles: %w", err)
+	}
+	var roles []models.RolePermission
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, fmt.Errorf("failed to decode admin roles: %w", err)
+	}
+	ids := make([]string, 0, len(roles))
+	for _, role := range roles {
+		ids = append(ids, role.ID)
+	}
+	return ids, nil
+}
+
+// roleHoldersFilter matches the users who hold role, by ID or as their role
+func roleHoldersFilter(role *models.RolePermission) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"role_ids": role.ID},
+		bson.M{"role": role.RoleCode},
+	}}
+}
+
+// CountRoleHolders counts the users, active or not, who hold role
+func (r *PermissionRepository) CountRoleHolders(ctx context.Context, role *models.RolePermission) (int64, error) {
+	count, err := r.usersCollection.CountDocuments(ctx, roleHoldersFilter(role))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count role holders: %w", err)
+	}
+	return count, nil
+}
+
+// ReassignRoleHolders moves the users who hold from to to: users holding it
+// by ID get to's ID instead, and users whose role is from get to's code. It
+// returns how many users were moved.
+func (r *PermissionRepository) ReassignRoleHolders(ctx context.Context, from, to *models.RolePermission) (int64, error) {
+	now := time.Now()
+	if _, err := r.usersCollection.UpdateMany(ctx,
+		bson.M{"role_ids": from.ID},
+		bson.M{"$addToSet": bson.M{"role_ids": to.ID}, "$set": bson.M{"updated_at": now}},
+	); err != nil {
+		return 0, fmt.Errorf("failed to reassign role holders: %w", err)
+	}
+	byID, err := r.usersCollection.UpdateMany(ctx,
+		bson.M{"role_ids": from.ID},
+		bson.M{"$pull": bson.M{"role_ids": from.ID}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign role holders: %w", err)
+	}
+	byCode, err := r.usersCollection.UpdateMany(ctx,
+		bson.M{"role": from.RoleCode},
+		bson.M{"$set": bson.M{"role": to.RoleCode, "updated_at": now}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign role holders: %w", err)
+	}
+	return byID.ModifiedCount + byCode.ModifiedCount, nil
+}
+
 // GetPermissionsForRole retrieves the permissions array for a specific role
 // This is the main method used for permission checking
 func (r *PermissionRepository) GetPermissionsForRole(ctx context.Context, roleCode string) ([]string, *models.DataScope, error) {
@@ -240,6 +342,99 @@ func (r *PermissionRepository) GetPermissionsForRole(ctx context.Context, roleCo
 	return role.Permissions, &role.DataScope, nil
 }
 
+// ================================
+// Built-in Roles
+// ================================
+
+// builtInRoles are the default permissions and data scopes of the roles
+// behind the UserRole values. Admins may change them after seeding; they
+// cannot be deleted.
+var builtInRoles = []models.RolePermission{
+	{
+		RoleCode:    models.RoleAdmin,
+		RoleName:    "Administrator",
+		Description: "Full access to all features",
+		Permissions: []string{"*:*:*"},
+		DataScope:   models.DataScope{Customers: models.DataScopeAll, Campaigns: models.DataScopeAll, Users: models.DataScopeAll},
+	},
+	{
+		RoleCode:    models.RoleManager,
+		RoleName:    "Manager",
+		Description: "Manages a team and approves its templates",
+		Permissions: []string{
+			models.PermTeamMembersView,
+			models.PermTeamMembersInvite,
+			models.PermTeamMembersUpdate,
+			models.PermTemplatesApprove,
+			models.PermAuditLogsView,
+		},
+		DataScope: models.DataScope{Customers: models.DataScopeTeam, Campaigns: models.DataScopeTeam, Users: models.DataScopeTeam},
+	},
+	{
+		RoleCode:    models.RoleSalesRep,
+		RoleName:    "Sales Representative",
+		Description: "Works their own customers and campaigns",
+		Permissions: []string{models.PermTeamMembersView},
+		DataScope:   models.DataScope{Customers: models.DataScopeOwn, Campaigns: models.DataScopeOwn, Users: models.DataScopeTeam},
+	},
+	{
+		RoleCode:    models.RoleHunting,
+		RoleName:    "Hunting",
+		Description: "Prospects for new customers",
+		Permissions: []string{models.PermTeamMembersView},
+		DataScope:   models.DataScope{Customers: models.DataScopeOwn, Campaigns: models.DataScopeOwn, Users: models.DataScopeTeam},
+	},
+	{
+		RoleCode:    models.RoleFarming,
+		RoleName:    "Farming",
+		Description: "Grows existing customer accounts",
+		Permissions: []string{models.PermTeamMembersView},
+		DataScope:   models.DataScope{Customers: models.DataScopeOwn, Campaigns: models.DataScopeOwn, Users: models.DataScopeTeam},
+	},
+	{
+		RoleCode:    models.RoleGenOps,
+		RoleName:    "Growth Operations",
+		Description: "Runs campaigns for the sales teams",
+		Permissions: []string{models.PermTeamMembersView},
+		DataScope:   models.DataScope{Customers: models.DataScopeTeam, Campaigns: models.DataScopeTeam, Users: models.DataScopeTeam},
+	},
+}
+
+// SeedBuiltInRoles creates the built-in roles that do not exist yet and
+// marks existing ones as built-in and active. Permissions an admin has
+// changed are kept. It returns how many roles were created.
+func (r *PermissionRepository) SeedBuiltInRoles(ctx context.Context) (int, error) {
+	created := 0
+	for _, role := range builtInRoles {
+		now := time.Now()
+		result, err := r.rolesCollection.UpdateOne(ctx,
+			bson.M{"roleCode": role.RoleCode},
+			bson.M{
+				"$set": bson.M{"isSystemRole": true, "isActive": true},
+				"$setOnInsert": bson.M{
+					"_id":         uuid.MustNewUUID(),
+					"roleName":    role.RoleName,
+					"description": role.Description,
+					"permissions": role.Permissions,
+					"dataScope":   role.DataScope,
+					"createdBy":   "system",
+					"updatedBy":   "system",
+					"createdAt":   now,
+					"updatedAt":   now,
+				},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return created, fmt.Errorf("failed to seed role %s: %w", role.RoleCode, err)
+		}
+		if result.UpsertedCount > 0 {
+			created++
+		}
+	}
+	return created, nil
+}
+
 // ================================
 // Index Management
 // ================================
@@ -247,24 +442,24 @@ func (r *PermissionRepository) GetPermissionsForRole(ctx context.Context, roleCo
 // EnsureIndexes creates necessary indexes for permission collections
 func (r *PermissionRepository) EnsureIndexes(ctx context.Context) error {
 	// Unique index on permission_resources.code
-	resourceIndex := mongo.IndexModel{
+	resourceErr := createIndexes(ctx, r.resourcesCollection, []mongo.IndexModel{{
 		Keys:    bson.D{{Key: "code", Value: 1}},
 		Options: options.Index().SetUnique(true).SetName("code_unique"),
-	}
-	if _, err := r.resourcesCollection.Indexes().CreateOne(ctx, resourceIndex); err != nil {
-		return fmt.Errorf("failed to create index on permission_resources.code: %w", err)
-	}
+	}})
 
 	// Unique index on role_permissions.roleCode
-	roleIndex := mongo.IndexModel{
+	roleErr := createIndexes(ctx, r.rolesCollection, []mongo.IndexModel{{
 		Keys:    bson.D{{Key: "roleCode", Value: 1}},
 		Options: options.Index().SetUnique(true).SetName("roleCode_unique"),
-	}
-	if _, err := r.rolesCollection.Indexes().CreateOne(ctx, roleIndex); err != nil {
-		return fmt.Errorf("failed to create index on role_permissions.roleCode: %w", err)
-	}
+	}})
 
-	return nil
+	// Holders of a custom role, for the deletion guard
+	holderErr := createIndexes(ctx, r.usersCollection, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "role_ids", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}})
+
+	return errors.Join(resourceErr, roleErr, holderErr)
 }
 
 // ================================
@@ -321,7 +516,7 @@ func (r *PermissionRepository) ValidatePermissions(ctx context.Context, permissi
 
 		// Exact permission must exist
 		if !validMap[perm] {
-			return fmt.Errorf("invalid permission code: %s", perm)
+			return fmt.Errorf("%w: invalid permission code: %s", ErrInvalidInput, perm)
 		}
 	}
 
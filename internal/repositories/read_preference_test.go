@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// TestReportsReadFromSecondaries checks the list and report queries get
+// collections preferring a secondary while reads that follow a write, as
+// user, session and OTP lookups, stay on the primary, and that turning
+// SecondaryReads off puts everything back on the primary
+func TestReportsReadFromSecondaries(t *testing.T) {
+	connected, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = connected.Disconnect(context.Background()) })
+
+	for _, secondaryReads := range []bool{true, false} {
+		client := mongodb.Wrap(connected, mongodb.Config{Database: "reports", SecondaryReads: secondaryReads})
+		reporting := readpref.PrimaryMode
+		if secondaryReads {
+			reporting = readpref.SecondaryPreferredMode
+		}
+
+		users := NewMongoUserRepository(client)
+		templates := NewMongoTemplateRepository(client)
+		settings := NewSettingsRepository(client)
+		codes := NewTwoFactorCodeRepository(client)
+		for name, tt := range map[string]struct {
+			collection *mongo.Collection
+			want       readpref.Mode
+		}{
+			"user listings":       {users.reports, reporting},
+			"template listings":   {templates.reports, reporting},
+			"template statistics": {templates.stats.reports, reporting},
+			"audit logs":          {settings.auditLogReports, reporting},
+			"user lookups":        {users.collection, readpref.PrimaryMode},
+			"template lookups":    {templates.collection, readpref.PrimaryMode},
+			"template counters":   {templates.stats.collection, readpref.PrimaryMode},
+			"audit log writes":    {settings.auditLogs, readpref.PrimaryMode},
+			"sessions":            {client.Collection("sessions"), readpref.PrimaryMode},
+			"OTPs":                {codes.collection, readpref.PrimaryMode},
+		} {
+			if got := tt.collection.Database().ReadPreference().Mode(); got != tt.want {
+				t.Errorf("SecondaryReads %v: %s read preference = %v, want %v", secondaryReads, name, got, tt.want)
+			}
+		}
+	}
+}
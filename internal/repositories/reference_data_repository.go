@@ -0,0 +1,226 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// referenceUserFields maps each reference data kind to the user field
+// holding its codes
+var referenceUserFields = map[string]string{
+	models.ReferenceKindRegions: "region",
+	models.ReferenceKindTeams:   "team",
+}
+
+// ReferenceDataRepository stores the managed regions and teams, and moves
+// users between them
+type ReferenceDataRepository struct {
+	collections map[string]*mongo.Collection
+	users       *mongo.Collection
+}
+
+// NewReferenceDataRepository creates a new ReferenceDataRepository
+func NewReferenceDataRepository(client *mongodb.Client) *ReferenceDataRepository {
+	return &ReferenceDataRepository{
+		collections: map[string]*mongo.Collection{
+			models.ReferenceKindRegions: client.Collection(models.ReferenceKindRegions),
+			models.ReferenceKindTeams:   client.Collection(models.ReferenceKindTeams),
+		},
+		users: client.Collection("users"),
+	}
+}
+
+// EnsureIndexes creates the active-entry indexes
+func (r *ReferenceDataRepository) EnsureIndexes(ctx context.Context) error {
+	for _, collection := range r.collections {
+		if err := createIndexes(ctx, collection, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "is_active", Value: 1}, {Key: "name", Value: 1}}},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ReferenceDataRepository) collection(kind string) (*mongo.Collection, string, error) {
+	collection, ok := r.collections[kind]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown reference data kind %q", kind)
+	}
+	return collection, referenceUserFields[kind], nil
+}
+
+// List returns the entries of a kind sorted by name, only the active ones
+// when activeOnly is set
+func (r *ReferenceDataRepository) List(ctx context.Context, kind string, activeOnly bool) ([]*models.ReferenceEntry, error) {
+	collection, _, err := r.collection(kind)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{}
+	if activeOnly {
+		filter["is_active"] = true
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", kind, err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*models.ReferenceEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", kind, err)
+	}
+	return entries, nil
+}
+
+// Get retrieves an entry by code
+func (r *ReferenceDataRepository) Get(ctx context.Context, kind, code string) (*models.ReferenceEntry, error) {
+	collection, _, err := r.collection(kind)
+	if err != nil {
+		return nil, err
+	}
+	var entry models.ReferenceEntry
+	err = collection.FindOne(ctx, bson.M{"_id": code}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrReferenceEntryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s entry: %w", kind, err)
+	}
+	return &entry, nil
+}
+
+// IsActive reports whether code names an active entry
+func (r *ReferenceDataRepository) IsActive(ctx context.Context, kind, code string) (bool, error) {
+	collection, _, err := r.collection(kind)
+	if err != nil {
+		return false, err
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": code, "is_active": true}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("error checking %s entry: %w", kind, err)
+	}
+	return count > 0, nil
+}
+
+// Create stores a new entry. An existing code is a duplicate key error.
+func (r *ReferenceDataRepository) Create(ctx context.Context, kind string, entry *models.ReferenceEntry) error {
+	collection, _, err := r.collection(kind)
+	if err != nil {
+		return err
+	}
+	if _, err := collection.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("error creating %s entry: %w", kind, err)
+	}
+	return nil
+}
+
+// Update applies the given name and active flag to an entry and returns it
+// updated
+func (r *ReferenceDataRepository) Update(ctx context.Context, kind, code string, name *string, isActive *bool, at time.Time) (*models.ReferenceEntry, error) {
+	collection, _, err := r.collection(kind)
+	if err != nil {
+		return nil, err
+	}
+	setFields := bson.M{"updated_at": at}
+	if name != nil {
+		setFields["name"] = *name
+	}
+	if isActive != nil {
+		setFields["is_active"] = *isActive
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var entry models.ReferenceEntry
+	err = collection.FindOneAndUpdate(ctx, bson.M{"_id": code}, bson.M{"$set": setFields}, opts).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrReferenceEntryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating %s entry: %w", kind, err)
+	}
+	return &entry, nil
+}
+
+// CountAssignedUsers counts the users assigned to an entry
+func (r *ReferenceDataRepository) CountAssignedUsers(ctx context.Context, kind, code string) (int64, error) {
+	_, field, err := r.collection(kind)
+	if err != nil {
+		return 0, err
+	}
+	count, err := r.users.CountDocuments(ctx, bson.M{field: code})
+	if err != nil {
+		return 0, fmt.Errorf("error counting users in %s entry: %w", kind, err)
+	}
+	return count, nil
+}
+
+// ReassignUsers moves every user assigned to from over to to, returning how
+// many were moved
+func (r *ReferenceDataRepository) ReassignUsers(ctx context.Context, kind, from, to string, at time.Time) (int64, error) {
+	_, field, err := r.collection(kind)
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.users.UpdateMany(ctx,
+		bson.M{field: from},
+		bson.M{"$set": bson.M{field: to, "updated_at": at}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error reassigning users: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// DistinctUserCodes returns every non-empty code of a kind that users are
+// assigned to
+func (r *ReferenceDataRepository) DistinctUserCodes(ctx context.Context, kind string) ([]string, error) {
+	_, field, err := r.collection(kind)
+	if err != nil {
+		return nil, err
+	}
+	values, err := r.users.Distinct(ctx, field, bson.M{field: bson.M{"$nin": bson.A{nil, ""}}})
+	if err != nil {
+		return nil, fmt.Errorf("error listing user %s values: %w", field, err)
+	}
+	codes := make([]string, 0, len(values))
+	for _, value := range values {
+		if code, ok := value.(string); ok {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+// Register adds an active entry named after its code for each code not
+// stored yet, returning how many were added. Existing entries are left as
+// they are.
+func (r *ReferenceDataRepository) Register(ctx context.Context, kind string, codes []string, at time.Time) (int64, error) {
+	collection, _, err := r.collection(kind)
+	if err != nil {
+		return 0, err
+	}
+	var added int64
+	for _, code := range codes {
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": code},
+			bson.M{"$setOnInsert": bson.M{"name": code, "is_active": true, "created_at": at, "updated_at": at}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return added, fmt.Errorf("error registering %s entry %q: %w", kind, code, err)
+		}
+		added += result.UpsertedCount
+	}
+	return added, nil
+}
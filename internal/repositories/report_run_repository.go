@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReportRunRepository guards scheduled reports against being sent twice for
+// the same period when several instances run the schedule
+type ReportRunRepository struct {
+	collection *mongo.Collection
+}
+
+// NewReportRunRepository creates a new ReportRunRepository
+func NewReportRunRepository(client *mongodb.Client) *ReportRunRepository {
+	return &ReportRunRepository{
+		collection: client.Collection("report_runs"),
+	}
+}
+
+// ClaimRun records the start of run. It returns false, and records nothing,
+// when a run for the same kind and period was already claimed.
+func (r *ReportRunRepository) ClaimRun(ctx context.Context, run *models.ReportRun) (bool, error) {
+	if _, err := r.collection.InsertOne(ctx, run); err != nil {
+		if IsDuplicateKey(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error claiming report run: %w", err)
+	}
+	return true, nil
+}
+
+// GetRun retrieves a report run by ID
+func (r *ReportRunRepository) GetRun(ctx context.Context, id string) (*models.ReportRun, error) {
+	var run models.ReportRun
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrReportRunNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting report run: %w", err)
+	}
+	return &run, nil
+}
+
+// FinishRun records the outcome of a claimed run
+func (r *ReportRunRepository) FinishRun(ctx context.Context, run *models.ReportRun, finishedAt time.Time) error {
+	run.FinishedAt = &finishedAt
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": run.ID}, bson.M{"$set": bson.M{
+		"finished_at": finishedAt,
+		"sent":        run.Sent,
+		"skipped":     run.Skipped,
+		"failed":      run.Failed,
+		"error":       run.Error,
+	}})
+	if err != nil {
+		return fmt.Errorf("error finishing report run: %w", err)
+	}
+	return nil
+}
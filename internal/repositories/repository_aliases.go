@@ -1,9 +1,10 @@
 package repositories
 
 import (
+	"time"
 
+	"github.com/white/user-management/internal/pagination"
 	"github.com/white/user-management/pkg/mongodb"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 
 )
 
@@ -18,9 +19,7 @@ type UserRepository = MongoUserRepository
 type UserManagementRepository = MongoUserRepository
 type SessionRepository = MongoUserRepository
 type PasswordResetRepository = MongoUserRepository
-type TemplateRepository = MongoTemplateRepository
 type ActivityRepository = MongoActivityRepository
-type SequenceTemplateRepository = MongoTemplateRepository
 
 
 // RegionalDashboardRepository is defined in mongo_regional_dashboard_repository.go
@@ -42,20 +41,6 @@ func NewPasswordResetRepository(client *mongodb.Client) *MongoUserRepository {
 	return NewMongoUserRepository(client)
 }
 
-// SequenceTemplateFilters contains filters for querying sequence templates
-type SequenceTemplateFilters struct {
-	Channel   string
-	IsActive  *bool
-	Category  string
-	Tags      []string
-	Search    string
-	CreatedBy primitive.ObjectID
-	Limit     int
-	Offset    int
-	SortBy    string
-	SortOrder string
-}
-
 // TemplateFilters contains filters for querying templates
 type TemplateFilters struct {
 	Type         string
@@ -74,7 +59,25 @@ type TemplateFilters struct {
 	Page         int
 	ForStage     []string // Filter by funnel stages (prospect, mql, sql, etc.)
 	Industries   []string // Filter by industries
-	ApprovalFlag string             // Filter by approval flag (green, yellow, red)
+	ApprovalFlag string             // Filter by approval flag (green, yellow, red) or review status (pending, approved, rejected)
 	Performance  string             // Filter by performance level (high, medium, low)
 	ServiceID    string // Filter by service ID (ObjectID reference)
+	ScopeCreatedBy []string // Data scope: only templates created by these users (nil = unrestricted)
+}
+
+// UserFilters contains filters for the admin user listing. Empty fields do
+// not filter.
+type UserFilters struct {
+	Role          string
+	Region        string
+	Team          string
+	IsActive      *bool
+	Search        string // Case-insensitive match on name or email
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	SortBy        string // name, email, role, created_at or last_login_at
+	SortOrder     string // asc or desc (default)
+	Limit         int    // 0 means no limit
+	Offset        int
+	After         *pagination.Cursor // Lists the users after it; only with SortBy created_at
 }
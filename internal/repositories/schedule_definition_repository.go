@@ -27,6 +27,19 @@ func NewScheduleDefinitionRepository(client *mongodb.Client) *ScheduleDefinition
 	}
 }
 
+// EnsureIndexes creates the index for listing active schedule definitions
+func (r *ScheduleDefinitionRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "is_active", Value: 1},
+				{Key: "name", Value: 1},
+			},
+		},
+	}
+	return createIndexes(ctx, r.collection, indexes)
+}
+
 // CreateScheduleDefinition creates a new schedule definition
 func (r *ScheduleDefinitionRepository) CreateScheduleDefinition(schedule *models.ScheduleDefinition) error {
 	if schedule == nil {
@@ -0,0 +1,384 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"github.com/white/user-management/pkg/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SequenceTemplateRepository handles sequence template data access with
+// MongoDB. Sequence templates keep their steps embedded in one document of
+// the sequence_templates collection.
+type SequenceTemplateRepository struct {
+	collection *mongo.Collection
+	campaigns  *mongo.Collection
+}
+
+// NewSequenceTemplateRepository creates a new SequenceTemplateRepository
+func NewSequenceTemplateRepository(client *mongodb.Client) *SequenceTemplateRepository {
+	return &SequenceTemplateRepository{
+		collection: client.Collection("sequence_templates"),
+		campaigns:  client.Collection("campaigns"),
+	}
+}
+
+// SequenceTemplateFilters contains filters for querying sequence templates
+type SequenceTemplateFilters struct {
+	TenantID  string
+	Channel   string
+	IsActive  *bool
+	Category  string
+	Tags      []string
+	Search    string
+	CreatedBy primitive.ObjectID
+	Limit     int
+	Offset    int
+	SortBy    string
+	SortOrder string
+
+	// ScopeCreatedBy restricts results to sequences created by these users (RBAC data scope); nil means unrestricted
+	ScopeCreatedBy []string
+}
+
+// FindActiveSequencesUsingTemplate returns the active sequence templates of
+// a tenant with a step whose content template is templateID
+func (r *SequenceTemplateRepository) FindActiveSequencesUsingTemplate(ctx context.Context, tenantID, templateID string) ([]*models.SequenceTemplate, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, ErrTenantRequired
+	}
+	filter := bson.M{
+		"tenant_id":                 tenantMatch(tenantID),
+		"is_active":                 true,
+		"steps.content_template_id": templateID,
+	}
+	opts := options.Find().SetProjection(bson.M{"steps": 0})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding sequences using template: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var sequences []*models.SequenceTemplate
+	if err := cursor.All(ctx, &sequences); err != nil {
+		return nil, fmt.Errorf("error decoding sequence templates: %w", err)
+	}
+
+	return sequences, nil
+}
+
+// GetSequenceTemplateByID retrieves a sequence template of a tenant by ID
+// with its steps
+func (r *SequenceTemplateRepository) GetSequenceTemplateByID(ctx context.Context, tenantID, templateID string) (*models.SequenceTemplateWithSteps, error) {
+	var template models.SequenceTemplateWithSteps
+	filter := bson.M{"_id": templateID, "tenant_id": tenantMatch(tenantID)}
+
+	err := r.collection.FindOne(ctx, filter).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+		}
+		return nil, fmt.Errorf("error finding sequence template by ID: %w", err)
+	}
+
+	return &template, nil
+}
+
+// CreateSequenceTemplate creates a sequence template with steps
+func (r *SequenceTemplateRepository) CreateSequenceTemplate(ctx context.Context, template *models.SequenceTemplateWithSteps) error {
+	// Generate new ID if not set
+	if template.Template.TemplateID == "" {
+		template.Template.TemplateID = uuid.MustNewUUID()
+	}
+
+	// Set timestamps
+	now := time.Now()
+	template.Template.CreatedAt = now
+	template.Template.UpdatedAt = now
+
+	// Set step timestamps and template IDs
+	for i := range template.Steps {
+		template.Steps[i].TemplateID = template.Template.TemplateID
+		template.Steps[i].CreatedAt = now
+		// Ensure step_order is set correctly
+		if template.Steps[i].StepOrder == 0 {
+			template.Steps[i].StepOrder = i + 1
+		}
+	}
+
+	// Insert into sequence_templates collection
+	_, err := r.collection.InsertOne(ctx, template)
+	if err != nil {
+		return fmt.Errorf("error creating sequence template: %w", err)
+	}
+
+	return nil
+}
+
+// ListSequenceTemplatesPage returns one page of sequence templates matching
+// filters (newest first) together with the total number of matches
+func (r *SequenceTemplateRepository) ListSequenceTemplatesPage(ctx context.Context, filters SequenceTemplateFilters) ([]*models.SequenceTemplateWithSteps, int64, error) {
+	filter := bson.M{"tenant_id": tenantMatch(filters.TenantID)}
+
+	if filters.Channel != "" {
+		filter["steps.channel"] = filters.Channel
+	}
+	if filters.IsActive != nil {
+		filter["is_active"] = *filters.IsActive
+	}
+	if filters.Search != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(filters.Search), "$options": "i"}
+	}
+	if filters.ScopeCreatedBy != nil {
+		filter["created_by"] = bson.M{"$in": filters.ScopeCreatedBy}
+	}
+
+	limit := filters.Limit
+	if limit == 0 {
+		limit = 20
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64(filters.Offset)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing sequence templates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	templates := []*models.SequenceTemplateWithSteps{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, 0, fmt.Errorf("error decoding sequence templates: %w", err)
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting sequence templates: %w", err)
+	}
+
+	return templates, total, nil
+}
+
+// CountCampaignsUsingSequence returns how many campaigns reference a sequence template
+func (r *SequenceTemplateRepository) CountCampaignsUsingSequence(ctx context.Context, templateID string) (int64, error) {
+	count, err := r.campaigns.CountDocuments(ctx, bson.M{"sequence_template_id": templateID})
+	if err != nil {
+		return 0, fmt.Errorf("error counting campaigns using sequence template: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateSequenceTemplate updates a sequence template of a tenant with its
+// steps
+func (r *SequenceTemplateRepository) UpdateSequenceTemplate(ctx context.Context, tenantID string, template *models.SequenceTemplateWithSteps) error {
+	// Update timestamp
+	template.Template.UpdatedAt = time.Now()
+
+	// Update step timestamps and template IDs
+	for i := range template.Steps {
+		template.Steps[i].TemplateID = template.Template.TemplateID
+		if template.Steps[i].StepOrder == 0 {
+			template.Steps[i].StepOrder = i + 1
+		}
+	}
+
+	filter := bson.M{"_id": template.Template.TemplateID, "tenant_id": tenantMatch(tenantID)}
+	update := bson.M{
+		"$set": bson.M{
+			"name":        template.Template.Name,
+			"description": template.Template.Description,
+			"service_id":  template.Template.ServiceID,
+			"schedule_id": template.Template.ScheduleID,
+			"version":     template.Template.Version,
+			"is_active":   template.Template.IsActive,
+			"updated_at":  template.Template.UpdatedAt,
+			"steps":       template.Steps,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error updating sequence template: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+	}
+
+	return nil
+}
+
+// DeleteSequenceTemplate deletes a sequence template of a tenant
+func (r *SequenceTemplateRepository) DeleteSequenceTemplate(ctx context.Context, tenantID, templateID string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": templateID, "tenant_id": tenantMatch(tenantID)})
+	if err != nil {
+		return fmt.Errorf("error deleting sequence template: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+	}
+
+	return nil
+}
+
+// Clone clones a sequence template of a tenant
+func (r *SequenceTemplateRepository) Clone(ctx context.Context, tenantID, templateID string, newName string, createdBy string) (*models.SequenceTemplateWithSteps, error) {
+	// Get the original template
+	original, err := r.GetSequenceTemplateByID(ctx, tenantID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	newID := uuid.MustNewUUID()
+
+	// Create a clone with new ID
+	clone := &models.SequenceTemplateWithSteps{
+		Template: models.SequenceTemplate{
+			TemplateID:  newID,
+			TenantID:    tenantID,
+			Name:        newName,
+			Description: original.Template.Description,
+			ServiceID:   original.Template.ServiceID,
+			ScheduleID:  original.Template.ScheduleID,
+			Version:     1,
+			IsActive:    true,
+			CreatedBy:   createdBy,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		Steps: make([]models.CampaignSequenceStep, len(original.Steps)),
+	}
+
+	// Copy and update step IDs for the clone
+	for i, step := range original.Steps {
+		clone.Steps[i] = step
+		clone.Steps[i].TemplateID = newID
+		clone.Steps[i].CreatedAt = now
+	}
+
+	// Save the clone
+	if err := r.CreateSequenceTemplate(ctx, clone); err != nil {
+		return nil, err
+	}
+
+	return clone, nil
+}
+
+// ValidateSequence validates a sequence template of a tenant and returns
+// validation errors
+func (r *SequenceTemplateRepository) ValidateSequence(ctx context.Context, tenantID, templateID string) (bool, []models.SequenceValidationIssue, error) {
+	// Get template with steps
+	template, err := r.GetSequenceTemplateByID(ctx, tenantID, templateID)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	if template == nil {
+		return false, nil, fmt.Errorf("template not found")
+	}
+
+	// Build error list: sequence-level problems first, then per-step checks
+	errors := []models.SequenceValidationIssue{}
+	if validationErr := template.Validate(); validationErr != nil {
+		errors = append(errors, models.SequenceValidationIssue{
+			StepOrder: 0,
+			Field:     "general",
+			Message:   validationErr.Error(),
+		})
+	}
+
+	// Additional validations
+	for i, step := range template.Steps {
+		stepOrder := i + 1
+
+		// Check required fields
+		if step.Channel == "" {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "communicationType",
+				Message:   "Communication type is required",
+			})
+		}
+
+		if step.ContentTemplateID == "" {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "templateId",
+				Message:   "Template is required",
+			})
+		}
+
+		if step.Body == "" {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "message",
+				Message:   "Message content is required",
+			})
+		}
+
+		// Email requires subject
+		if step.Channel == "email" && step.Subject == "" {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "subject",
+				Message:   "Subject is required for email steps",
+			})
+		}
+
+		// Send time is required in 24h HH:MM
+		if sendAt := step.EffectiveSendAt(); sendAt == "" {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "sendAt",
+				Message:   "Send time is required (HH:MM)",
+			})
+		} else if !models.ValidateSendAtFormat(sendAt) {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "sendAt",
+				Message:   fmt.Sprintf("Send time must be HH:MM (24h), got %q", sendAt),
+			})
+		}
+
+		// Timezone, when set, must be a known IANA name
+		if err := models.ValidateStepTimezone(step.Timezone); err != nil {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "timezone",
+				Message:   "Unknown timezone: " + step.Timezone,
+			})
+		}
+
+		// First step should have 0 wait days
+		if stepOrder == 1 && step.WaitDays != 0 {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "waitDays",
+				Message:   "First step should have 0 wait days",
+			})
+		}
+
+		// Check wait days is non-negative
+		if step.WaitDays < 0 {
+			errors = append(errors, models.SequenceValidationIssue{
+				StepOrder: stepOrder,
+				Field:     "waitDays",
+				Message:   "Wait days cannot be negative",
+			})
+		}
+	}
+
+	isValid := len(errors) == 0
+	return isValid, errors, nil
+}
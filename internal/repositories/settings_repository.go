@@ -2,11 +2,12 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
-	// "fmt"
-
 	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
 	"github.com/white/user-management/pkg/mongodb"
 	"github.com/white/user-management/pkg/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -24,11 +25,13 @@ type SettingsRepository struct {
 	companyInfo                 *mongo.Collection
 	notificationSettings        *mongo.Collection
 	auditLogs                   *mongo.Collection
+	auditLogReports             *mongo.Collection
 	users                       *mongo.Collection
 	systemDefaults              *mongo.Collection
 	systemSecurity              *mongo.Collection
 	dataPrivacy                 *mongo.Collection
 	systemEmailNotifications    *mongo.Collection
+	onboarding                  *mongo.Collection
 }
 
 func NewSettingsRepository(client *mongodb.Client) *SettingsRepository {
@@ -41,11 +44,13 @@ func NewSettingsRepository(client *mongodb.Client) *SettingsRepository {
 		companyInfo:              client.Collection("company_info"),
 		notificationSettings:     client.Collection("notification_settings"),
 		auditLogs:                client.Collection("audit_logs"),
+		auditLogReports:          client.ReportingCollection("audit_logs"),
 		users:                    client.Collection("users"),
 		systemDefaults:           client.Collection("system_defaults"),
 		systemSecurity:           client.Collection("system_security"),
 		dataPrivacy:              client.Collection("data_privacy"),
 		systemEmailNotifications: client.Collection("system_email_notifications"),
+		onboarding:               client.Collection("onboarding_progress"),
 	}
 }
 
@@ -62,7 +67,7 @@ func (r *SettingsRepository) GetUserProfile(ctx context.Context, userID string)
 
 	// If not found, create from users collection
 	if err == mongo.ErrNoDocuments {
-		var user models.MongoUser
+		var user models.User
 		err = r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
 		if err != nil {
 			return nil, err
@@ -168,18 +173,23 @@ func (r *SettingsRepository) UpdateEmailSignature(ctx context.Context, userID st
 }
 
 // ==================== Security Settings ====================
+
+// DefaultSecuritySettings returns the security settings of a user who has saved none
+func DefaultSecuritySettings(userID string) *models.SettingsUserSecuritySettings {
+	return &models.SettingsUserSecuritySettings{
+		UserID:           userID,
+		TwoFactorEnabled: false,
+		SessionTimeout:   30, // 30 minutes default
+		UpdatedAt:        time.Now(),
+	}
+}
+
 // GetSecuritySettings retrieves security settings by user ID
 func (r *SettingsRepository) GetSecuritySettings(ctx context.Context, userID string) (*models.SettingsUserSecuritySettings, error) {
 	var settings models.SettingsUserSecuritySettings
 	err := r.securitySettings.FindOne(ctx, bson.M{"user_id": userID}).Decode(&settings)
 	if err == mongo.ErrNoDocuments {
-		// Return default settings
-		return &models.SettingsUserSecuritySettings{
-			UserID:           userID,
-			TwoFactorEnabled: false,
-			SessionTimeout:   30, // 30 minutes default
-			UpdatedAt:        time.Now(),
-		}, nil
+		return DefaultSecuritySettings(userID), nil
 	}
 	return &settings, err
 }
@@ -192,8 +202,14 @@ func (r *SettingsRepository) UpdateSecuritySettings(ctx context.Context, userID
 	if update.TwoFactorEnabled != nil {
 		updateDoc["$set"].(bson.M)["two_factor_enabled"] = *update.TwoFactorEnabled
 	}
+	if update.TwoFactorMethod != nil {
+		updateDoc["$set"].(bson.M)["two_factor_method"] = *update.TwoFactorMethod
+	}
 	if update.SessionTimeout != nil {
 		updateDoc["$set"].(bson.M)["session_timeout"] = *update.SessionTimeout
+	} else {
+		// Settings saved for the first time keep the default timeout
+		updateDoc["$setOnInsert"] = bson.M{"session_timeout": DefaultSecuritySettings(userID).SessionTimeout}
 	}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
@@ -206,6 +222,68 @@ func (r *SettingsRepository) UpdateSecuritySettings(ctx context.Context, userID
 	return &settings, nil
 }
 
+// StartPhoneVerification stores a code texted to a phone number, replacing
+// any verification in progress
+func (r *SettingsRepository) StartPhoneVerification(ctx context.Context, userID string, verification models.PhoneVerification) error {
+	updateDoc := bson.M{
+		"$set":         bson.M{"phone_verification": verification, "updated_at": time.Now()},
+		"$setOnInsert": bson.M{"session_timeout": DefaultSecuritySettings(userID).SessionTimeout},
+	}
+	_, err := r.securitySettings.UpdateOne(ctx, bson.M{"user_id": userID}, updateDoc, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error starting phone verification: %w", err)
+	}
+	return nil
+}
+
+// RecordPhoneVerificationAttempt counts a wrong code entered for the
+// verification in progress
+func (r *SettingsRepository) RecordPhoneVerificationAttempt(ctx context.Context, userID string) error {
+	_, err := r.securitySettings.UpdateOne(ctx,
+		bson.M{"user_id": userID, "phone_verification": bson.M{"$ne": nil}},
+		bson.M{"$inc": bson.M{"phone_verification.attempts": 1}},
+	)
+	if err != nil {
+		return fmt.Errorf("error recording phone verification attempt: %w", err)
+	}
+	return nil
+}
+
+// ConfirmPhoneNumber makes the phone number of the verification in progress
+// the user's. It returns ErrNotFound when phoneNumber is no longer being
+// verified, e.g. because a new code was requested meanwhile.
+func (r *SettingsRepository) ConfirmPhoneNumber(ctx context.Context, userID, phoneNumber string, at time.Time) (*models.SettingsUserSecuritySettings, error) {
+	filter := bson.M{"user_id": userID, "phone_verification.phone_number": phoneNumber}
+	updateDoc := bson.M{
+		"$set":   bson.M{"phone_number": phoneNumber, "phone_verified_at": at, "updated_at": at},
+		"$unset": bson.M{"phone_verification": ""},
+	}
+	var settings models.SettingsUserSecuritySettings
+	err := r.securitySettings.FindOneAndUpdate(ctx, filter, updateDoc, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&settings)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// RemovePhoneNumber removes the user's phone number and any verification in
+// progress. 2FA codes go back to email.
+func (r *SettingsRepository) RemovePhoneNumber(ctx context.Context, userID string) (*models.SettingsUserSecuritySettings, error) {
+	updateDoc := bson.M{
+		"$set":   bson.M{"two_factor_method": models.TwoFactorMethodEmail, "updated_at": time.Now()},
+		"$unset": bson.M{"phone_number": "", "phone_verified_at": "", "phone_verification": ""},
+	}
+	var settings models.SettingsUserSecuritySettings
+	err := r.securitySettings.FindOneAndUpdate(ctx, bson.M{"user_id": userID}, updateDoc, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return DefaultSecuritySettings(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
 // UpdateLastPasswordChange updates the last password change timestamp
 func (r *SettingsRepository) UpdateLastPasswordChange(ctx context.Context, userID string) error {
 	filter := bson.M{"user_id": userID}
@@ -227,25 +305,30 @@ func (r *SettingsRepository) UpdateLastPasswordChange(ctx context.Context, userI
 
 // ==================== Communication Preferences ====================
 
+// DefaultCommunicationPreferences returns the communication preferences of a user
+// who has saved none
+func DefaultCommunicationPreferences(userID string) *models.SettingsCommunicationPreferences {
+	return &models.SettingsCommunicationPreferences{
+		UserID:          userID,
+		DefaultChannels: []string{"email"},
+		EmailPreferences: models.SettingsEmailPreferences{
+			EnableTracking:     true,
+			EnableReadReceipts: true,
+			AutoFollowUpDays:   3,
+		},
+		WhatsAppPreferences: models.SettingsWhatsAppPreferences{
+			UseTemplates: true,
+		},
+		UpdatedAt: time.Now(),
+	}
+}
+
 // GetCommunicationPreferences retrieves communication preferences by user ID
 func (r *SettingsRepository) GetCommunicationPreferences(ctx context.Context, userID string) (*models.SettingsCommunicationPreferences, error) {
 	var prefs models.SettingsCommunicationPreferences
 	err := r.communicationPrefs.FindOne(ctx, bson.M{"user_id": userID}).Decode(&prefs)
 	if err == mongo.ErrNoDocuments {
-		// Return default preferences
-		return &models.SettingsCommunicationPreferences{
-			UserID:          userID,
-			DefaultChannels: []string{"email"},
-			EmailPreferences: models.SettingsEmailPreferences{
-				EnableTracking:     true,
-				EnableReadReceipts: true,
-				AutoFollowUpDays:   3,
-			},
-			WhatsAppPreferences: models.SettingsWhatsAppPreferences{
-				UseTemplates: true,
-			},
-			UpdatedAt: time.Now(),
-		}, nil
+		return DefaultCommunicationPreferences(userID), nil
 	}
 	return &prefs, err
 }
@@ -284,20 +367,24 @@ func (r *SettingsRepository) UpdateCommunicationPreferences(ctx context.Context,
 
 // ==================== Company Info ====================
 
+// DefaultCompanyInfo returns the company info used until one is saved
+func DefaultCompanyInfo() *models.SettingsCompanyInfo {
+	return &models.SettingsCompanyInfo{
+		ID:        primitive.NewObjectID(),
+		Name:      "SkillMine Technologies",
+		Industry:  "Technology",
+		Size:      "50-200",
+		Website:   "https://skillmine.com",
+		UpdatedAt: time.Now(),
+	}
+}
+
 // GetCompanyInfo retrieves company info (singleton)
 func (r *SettingsRepository) GetCompanyInfo(ctx context.Context) (*models.SettingsCompanyInfo, error) {
 	var info models.SettingsCompanyInfo
 	err := r.companyInfo.FindOne(ctx, bson.M{}).Decode(&info)
 	if err == mongo.ErrNoDocuments {
-		// Return default company info
-		return &models.SettingsCompanyInfo{
-			ID:        primitive.NewObjectID(),
-			Name:      "SkillMine Technologies",
-			Industry:  "Technology",
-			Size:      "50-200",
-			Website:   "https://skillmine.com",
-			UpdatedAt: time.Now(),
-		}, nil
+		return DefaultCompanyInfo(), nil
 	}
 	return &info, err
 }
@@ -325,6 +412,9 @@ func (r *SettingsRepository) UpdateCompanyInfo(ctx context.Context, update *mode
 	if update.Address != "" {
 		setFields["address"] = update.Address
 	}
+	if update.EmailBranding != nil {
+		setFields["email_branding"] = *update.EmailBranding
+	}
 
 	updateDoc := bson.M{"$set": setFields}
 
@@ -340,27 +430,36 @@ func (r *SettingsRepository) UpdateCompanyInfo(ctx context.Context, update *mode
 
 // ==================== Notification Settings ====================
 
+// DefaultNotificationSettings returns the notification settings of a user who has
+// saved none
+func DefaultNotificationSettings(userID string) *models.SettingsNotificationSettings {
+	return &models.SettingsNotificationSettings{
+		UserID: userID,
+		EmailNotifications: models.SettingsEmailNotificationSettings{
+			TaskReminder:     true,
+			WeeklyReport:     true,
+			TemplateApproval: true,
+			SecurityAlert:    true,
+		},
+		BrowserNotifications: models.SettingsBrowserNotificationSettings{
+			Enabled:    true,
+			NewMessage: true,
+			TaskDue:    true,
+		},
+		UpdatedAt: time.Now(),
+	}
+}
+
 // GetNotificationSettings retrieves notification settings by user ID
 func (r *SettingsRepository) GetNotificationSettings(ctx context.Context, userID string) (*models.SettingsNotificationSettings, error) {
-	var settings models.SettingsNotificationSettings
-	err := r.notificationSettings.FindOne(ctx, bson.M{"user_id": userID}).Decode(&settings)
+	// Decoding over the defaults keeps toggles added after the document was
+	// saved at their default
+	settings := DefaultNotificationSettings(userID)
+	err := r.notificationSettings.FindOne(ctx, bson.M{"user_id": userID}).Decode(settings)
 	if err == mongo.ErrNoDocuments {
-		// Return default settings
-		return &models.SettingsNotificationSettings{
-			UserID: userID,
-			EmailNotifications: models.SettingsEmailNotificationSettings{
-				TaskReminder:    true,
-				WeeklyReport:    true,
-			},
-			BrowserNotifications: models.SettingsBrowserNotificationSettings{
-				Enabled:    true,
-				NewMessage: true,
-				TaskDue:    true,
-			},
-			UpdatedAt: time.Now(),
-		}, nil
+		return DefaultNotificationSettings(userID), nil
 	}
-	return &settings, err
+	return settings, err
 }
 
 
@@ -375,6 +474,9 @@ func (r *SettingsRepository) UpdateNotificationSettings(ctx context.Context, use
 	if update.BrowserNotifications != nil {
 		setFields["browser_notifications"] = update.BrowserNotifications
 	}
+	if update.DigestFrequency != nil {
+		setFields["digest_frequency"] = *update.DigestFrequency
+	}
 
 	updateDoc := bson.M{
 		"$set": setFields,
@@ -393,45 +495,113 @@ func (r *SettingsRepository) UpdateNotificationSettings(ctx context.Context, use
 	return &settings, nil
 }
 
-// ==================== Audit Logs ====================
+// ==================== Onboarding ====================
 
-// GetAuditLogs retrieves audit logs with pagination
-func (r *SettingsRepository) GetAuditLogs(ctx context.Context, limit, offset int) ([]models.SettingsAuditLog, int64, error) {
-	if limit <= 0 {
-		limit = 10
+// GetOnboardingProgress retrieves a user's onboarding choices; a user who
+// made none gets an empty progress
+func (r *SettingsRepository) GetOnboardingProgress(ctx context.Context, userID string) (*models.OnboardingProgress, error) {
+	var progress models.OnboardingProgress
+	err := r.onboarding.FindOne(ctx, bson.M{"user_id": userID}).Decode(&progress)
+	if err == mongo.ErrNoDocuments {
+		return &models.OnboardingProgress{UserID: userID, Dismissed: []string{}}, nil
 	}
-	if limit > 100 {
-		limit = 100
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving onboarding progress: %w", err)
 	}
+	return &progress, nil
+}
 
-	// Get total count
-	total, err := r.auditLogs.CountDocuments(ctx, bson.M{})
-	if err != nil {
-		return nil, 0, err
+// DismissOnboardingItem hides an onboarding checklist item for a user;
+// dismissing it again changes nothing
+func (r *SettingsRepository) DismissOnboardingItem(ctx context.Context, userID, item string) (*models.OnboardingProgress, error) {
+	update := bson.M{
+		"$addToSet":    bson.M{"dismissed": item},
+		"$set":         bson.M{"updated_at": time.Now()},
+		"$setOnInsert": bson.M{"user_id": userID},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
+	var progress models.OnboardingProgress
+	if err := r.onboarding.FindOneAndUpdate(ctx, bson.M{"user_id": userID}, update, opts).Decode(&progress); err != nil {
+		return nil, fmt.Errorf("error dismissing onboarding item: %w", err)
+	}
+	return &progress, nil
+}
+
+// ==================== Audit Logs ====================
+
+// GetAuditLogs retrieves up to page.FetchLimit() audit logs newest first,
+// after page.After in cursor mode or skipping page.Offset in page mode. A
+// non-nil userIDs only returns the logs of those users. Audit logs are read
+// from a secondary when one is available, so the newest entries can be
+// missing for as long as replication lags.
+func (r *SettingsRepository) GetAuditLogs(ctx context.Context, userIDs []string, page pagination.Request) ([]models.SettingsAuditLog, error) {
+	filter := auditLogFilter(userIDs)
+	if page.After != nil {
+		id, err := page.After.ObjectID()
+		if err != nil {
+			return nil, err
+		}
+		filter = pagination.And(filter, pagination.After("timestamp", true, page.After, id))
 	}
 
-	// Get logs with pagination
 	opts := options.Find().
-		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset))
+		SetSort(pagination.Sort("timestamp", true)).
+		SetLimit(int64(page.FetchLimit())).
+		SetSkip(int64(page.Offset))
 
-	cursor, err := r.auditLogs.Find(ctx, bson.M{}, opts)
+	cursor, err := r.auditLogReports.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
 	var logs []models.SettingsAuditLog
 	if err := cursor.All(ctx, &logs); err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
 	if logs == nil {
 		logs = []models.SettingsAuditLog{}
 	}
 
-	return logs, total, nil
+	return logs, nil
+}
+
+// CountAuditLogs counts the audit logs, only those of userIDs when non-nil
+func (r *SettingsRepository) CountAuditLogs(ctx context.Context, userIDs []string) (int64, error) {
+	return r.auditLogReports.CountDocuments(ctx, auditLogFilter(userIDs))
+}
+
+// EachAuditLog calls fn with every audit log newest first, only those of
+// userIDs when non-nil, reading them one at a time so exports stay flat in
+// memory. An error from fn stops the iteration and is returned.
+func (r *SettingsRepository) EachAuditLog(ctx context.Context, userIDs []string, fn func(*models.SettingsAuditLog) error) error {
+	opts := options.Find().SetSort(pagination.Sort("timestamp", true))
+	cursor, err := r.auditLogReports.Find(ctx, auditLogFilter(userIDs), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var log models.SettingsAuditLog
+		if err := cursor.Decode(&log); err != nil {
+			return fmt.Errorf("error decoding audit log: %w", err)
+		}
+		if err := fn(&log); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// auditLogFilter matches the audit logs of userIDs, or all when nil
+func auditLogFilter(userIDs []string) bson.M {
+	filter := bson.M{}
+	if userIDs != nil {
+		filter["user_id"] = bson.M{"$in": userIDs}
+	}
+	return filter
 }
 
 // CreateAuditLog creates a new audit log entry
@@ -444,24 +614,30 @@ func (r *SettingsRepository) CreateAuditLog(ctx context.Context, log *models.Set
 
 // ==================== System Default Settings ====================
 
+// DefaultSystemDefaultSettings returns the system defaults used until they are saved
+func DefaultSystemDefaultSettings() *models.SystemDefaultSettings {
+	return &models.SystemDefaultSettings{
+		ID:                primitive.NewObjectID(),
+		Timezone:          "Asia/Kolkata",
+		Currency:          "INR",
+		Language:          "english",
+		DateFormat:        "dd-mm-yyyy",
+		WorkingHoursStart: "09:00",
+		WorkingHoursEnd:   "18:00",
+		WorkingDays:       models.DefaultWorkingDays,
+		UpdatedAt:         time.Now(),
+	}
+}
+
 // GetSystemDefaultSettings retrieves system default settings (singleton)
 func (r *SettingsRepository) GetSystemDefaultSettings(ctx context.Context) (*models.SystemDefaultSettings, error) {
-	var settings models.SystemDefaultSettings
-	err := r.systemDefaults.FindOne(ctx, bson.M{}).Decode(&settings)
+	// Fields missing from the stored document keep their defaults
+	settings := DefaultSystemDefaultSettings()
+	err := r.systemDefaults.FindOne(ctx, bson.M{}).Decode(settings)
 	if err == mongo.ErrNoDocuments {
-		// Return default settings
-		return &models.SystemDefaultSettings{
-			ID:                primitive.NewObjectID(),
-			Timezone:          "Asia/Kolkata",
-			Currency:          "INR",
-			Language:          "english",
-			DateFormat:        "dd-mm-yyyy",
-			WorkingHoursStart: "9am",
-			WorkingHoursEnd:   "6pm",
-			UpdatedAt:         time.Now(),
-		}, nil
+		return DefaultSystemDefaultSettings(), nil
 	}
-	return &settings, err
+	return settings, err
 }
 
 // UpdateSystemDefaultSettings updates system default settings
@@ -487,40 +663,54 @@ func (r *SettingsRepository) UpdateSystemDefaultSettings(ctx context.Context, up
 	if update.WorkingHoursEnd != "" {
 		setFields["working_hours_end"] = update.WorkingHoursEnd
 	}
+	if update.WorkingDays != nil {
+		setFields["working_days"] = update.WorkingDays
+	}
 
 	updateDoc := bson.M{"$set": setFields}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
-	var settings models.SystemDefaultSettings
-	err := r.systemDefaults.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(&settings)
+	settings := DefaultSystemDefaultSettings()
+	err := r.systemDefaults.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(settings)
 	if err != nil {
 		return nil, err
 	}
 
-	return &settings, nil
+	return settings, nil
 }
 
 // ==================== System Security Settings ====================
 
+// DefaultSystemSecuritySettings returns the system security settings used
+// until they are saved
+func DefaultSystemSecuritySettings() *models.SystemSecuritySettings {
+	return &models.SystemSecuritySettings{
+		ID:                    primitive.NewObjectID(),
+		TwoFactorRequired:     true,
+		MinPasswordLength:     12,
+		PasswordExpiryDays:    90,
+		RequireSpecialChars:   true,
+		PasswordHistoryCount:  5,
+		SessionTimeoutMinutes: 30,
+		IPWhitelist:           "",
+		SSOEnabled:            false,
+		JITDefaultRole:        string(models.UserRoleSalesRep),
+		UpdatedAt:             time.Now(),
+	}
+}
+
 // GetSystemSecuritySettings retrieves system security settings (singleton)
 func (r *SettingsRepository) GetSystemSecuritySettings(ctx context.Context) (*models.SystemSecuritySettings, error) {
-	var settings models.SystemSecuritySettings
-	err := r.systemSecurity.FindOne(ctx, bson.M{}).Decode(&settings)
+	// Fields missing from the stored document keep their defaults
+	settings := DefaultSystemSecuritySettings()
+	err := r.systemSecurity.FindOne(ctx, bson.M{}).Decode(settings)
 	if err == mongo.ErrNoDocuments {
-		// Return default settings
-		return &models.SystemSecuritySettings{
-			ID:                    primitive.NewObjectID(),
-			TwoFactorRequired:     true,
-			MinPasswordLength:     12,
-			PasswordExpiryDays:    90,
-			RequireSpecialChars:   true,
-			SessionTimeoutMinutes: 30,
-			IPWhitelist:           "",
-			SSOEnabled:            false,
-			UpdatedAt:             time.Now(),
-		}, nil
+		return DefaultSystemSecuritySettings(), nil
 	}
-	return &settings, err
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
 }
 
 // UpdateSystemSecuritySettings updates system security settings
@@ -540,6 +730,9 @@ func (r *SettingsRepository) UpdateSystemSecuritySettings(ctx context.Context, u
 	if update.RequireSpecialChars != nil {
 		setFields["require_special_chars"] = *update.RequireSpecialChars
 	}
+	if update.PasswordHistoryCount != nil {
+		setFields["password_history_count"] = *update.PasswordHistoryCount
+	}
 	if update.SessionTimeoutMinutes != nil {
 		setFields["session_timeout_minutes"] = *update.SessionTimeoutMinutes
 	}
@@ -549,17 +742,52 @@ func (r *SettingsRepository) UpdateSystemSecuritySettings(ctx context.Context, u
 	if update.SSOEnabled != nil {
 		setFields["sso_enabled"] = *update.SSOEnabled
 	}
+	if update.AllowJITProvisioning != nil {
+		setFields["allow_jit_provisioning"] = *update.AllowJITProvisioning
+	}
+	if update.JITDefaultRole != nil {
+		setFields["jit_default_role"] = *update.JITDefaultRole
+	}
+	if update.PasswordLoginDisabled != nil {
+		setFields["password_login_disabled"] = *update.PasswordLoginDisabled
+	}
+	if update.TemplateApprovalRequired != nil {
+		setFields["template_approval_required"] = *update.TemplateApprovalRequired
+	}
+	if update.RequiresUnsubscribe != nil {
+		setFields["requires_unsubscribe"] = *update.RequiresUnsubscribe
+	}
 
-	updateDoc := bson.M{"$set": setFields}
+	updateDoc := bson.M{"$set": setFields, "$inc": bson.M{"version": 1}}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
-	var settings models.SystemSecuritySettings
-	err := r.systemSecurity.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(&settings)
+	if update.Version != nil {
+		// The singleton is only created by an update at version 0; once it
+		// exists the update must match its ID and version
+		var stored struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		err := r.systemSecurity.FindOne(ctx, bson.M{}).Decode(&stored)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if err == nil {
+			filter = bson.M{"_id": stored.ID, "version": VersionFilter(*update.Version)}
+			opts.SetUpsert(false)
+		} else if *update.Version != 0 {
+			return nil, ErrVersionConflict
+		}
+	}
+	settings := DefaultSystemSecuritySettings()
+	err := r.systemSecurity.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(settings)
+	if err == mongo.ErrNoDocuments && update.Version != nil {
+		return nil, ErrVersionConflict
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &settings, nil
+	return settings, nil
 }
 
 // ==================== Data & Privacy Settings ====================
@@ -606,21 +834,30 @@ func (r *SettingsRepository) UpdateDataPrivacySettings(ctx context.Context, upda
 
 // ==================== System Email & Notification Settings ====================
 
+// DefaultSystemEmailNotificationSettings returns the system email notification
+// settings used until they are saved
+func DefaultSystemEmailNotificationSettings() *models.SystemEmailNotificationSettings {
+	return &models.SystemEmailNotificationSettings{
+		ID:                         primitive.NewObjectID(),
+		SystemNotificationEmail:    "sivaganesz7482@skillmine.com",
+		WeeklyReportSchedule:       "monday",
+		EmailSendLimitAlertPercent: 90,
+		UpdatedAt:                  time.Now(),
+	}
+}
+
 // GetSystemEmailNotificationSettings retrieves system email notification settings (singleton)
 func (r *SettingsRepository) GetSystemEmailNotificationSettings(ctx context.Context) (*models.SystemEmailNotificationSettings, error) {
-	var settings models.SystemEmailNotificationSettings
-	err := r.systemEmailNotifications.FindOne(ctx, bson.M{}).Decode(&settings)
+	// Fields missing from the stored document keep their defaults
+	settings := DefaultSystemEmailNotificationSettings()
+	err := r.systemEmailNotifications.FindOne(ctx, bson.M{}).Decode(settings)
 	if err == mongo.ErrNoDocuments {
-		// Return default settings
-		return &models.SystemEmailNotificationSettings{
-			ID:                         primitive.NewObjectID(),
-			SystemNotificationEmail:    "sivaganesz7482@skillmine.com",
-			WeeklyReportSchedule:       "monday",
-			EmailSendLimitAlertPercent: 90,
-			UpdatedAt:                  time.Now(),
-		}, nil
+		return DefaultSystemEmailNotificationSettings(), nil
 	}
-	return &settings, err
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
 }
 
 // UpdateSystemEmailNotificationSettings updates system email notification settings
@@ -637,15 +874,198 @@ func (r *SettingsRepository) UpdateSystemEmailNotificationSettings(ctx context.C
 	if update.EmailSendLimitAlertPercent != nil {
 		setFields["email_send_limit_alert_percent"] = *update.EmailSendLimitAlertPercent
 	}
+	if update.DailySendLimit != nil {
+		setFields["daily_send_limit"] = *update.DailySendLimit
+	}
+	if update.MonthlySendLimit != nil {
+		setFields["monthly_send_limit"] = *update.MonthlySendLimit
+	}
 
 	updateDoc := bson.M{"$set": setFields}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
-	var settings models.SystemEmailNotificationSettings
-	err := r.systemEmailNotifications.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(&settings)
+	settings := DefaultSystemEmailNotificationSettings()
+	err := r.systemEmailNotifications.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(settings)
 	if err != nil {
 		return nil, err
 	}
 
-	return &settings, nil
+	return settings, nil
+}
+
+// DeleteUserSettings removes every per-user setting of a user: profile,
+// email signature, security settings with the phone number, communication
+// preferences, notification settings and onboarding progress
+func (r *SettingsRepository) DeleteUserSettings(ctx context.Context, userID string) error {
+	for _, collection := range []*mongo.Collection{r.userProfiles, r.emailSignatures, r.securitySettings, r.communicationPrefs, r.notificationSettings, r.onboarding} {
+		if _, err := collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+			return fmt.Errorf("error removing %s of user: %w", collection.Name(), err)
+		}
+	}
+	return nil
+}
+
+// EnsureIndexes creates the indexes of the settings collections: per-user
+// settings are looked up by user, audit logs are listed newest first
+func (r *SettingsRepository) EnsureIndexes(ctx context.Context) error {
+	perUser := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}}
+	var errs []error
+	for _, collection := range []*mongo.Collection{r.userProfiles, r.emailSignatures, r.securitySettings, r.communicationPrefs, r.notificationSettings, r.onboarding} {
+		errs = append(errs, createIndexes(ctx, collection, perUser))
+	}
+
+	auditIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "timestamp", Value: -1}},
+		},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "timestamp", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "resource", Value: 1},
+				{Key: "timestamp", Value: -1},
+			},
+		},
+	}
+	errs = append(errs, createIndexes(ctx, r.auditLogs, auditIndexes))
+
+	return errors.Join(errs...)
+}
+
+// ==================== User ID Migration ====================
+
+// UserIDMigrationResult counts the documents of one collection rewritten by
+// MigrateObjectIDUserIDs
+type UserIDMigrationResult struct {
+	Collection string
+	Converted  int64 // user_id rewritten as a string
+	Dropped    int64 // Removed because the user already had a document keyed by the string ID
+}
+
+// MigrateObjectIDUserIDs rewrites settings documents whose user_id was stored
+// as an ObjectID to the string form every lookup uses; until then they are
+// never found. In the per-user collections a document already stored under
+// the string ID is the one kept. It is safe to run again.
+func (r *SettingsRepository) MigrateObjectIDUserIDs(ctx context.Context) ([]UserIDMigrationResult, error) {
+	perUser := []*mongo.Collection{r.userProfiles, r.emailSignatures, r.securitySettings, r.communicationPrefs, r.notificationSettings}
+
+	var results []UserIDMigrationResult
+	for _, collection := range perUser {
+		result, err := migrateObjectIDUserIDs(ctx, collection, true)
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+	}
+	result, err := migrateObjectIDUserIDs(ctx, r.auditLogs, false)
+	results = append(results, result)
+	return results, err
+}
+
+// migrateObjectIDUserIDs rewrites one collection's ObjectID user_id values.
+// With unique set, a document whose user already has a string-keyed one is
+// dropped instead.
+func migrateObjectIDUserIDs(ctx context.Context, collection *mongo.Collection, unique bool) (UserIDMigrationResult, error) {
+	result := UserIDMigrationResult{Collection: collection.Name()}
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": bson.M{"$type": "objectId"}},
+		options.Find().SetProjection(bson.M{"_id": 1, "user_id": 1}))
+	if err != nil {
+		return result, fmt.Errorf("error finding %s documents to migrate: %w", result.Collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID     interface{}        `bson:"_id"`
+			UserID primitive.ObjectID `bson:"user_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return result, fmt.Errorf("error decoding %s document: %w", result.Collection, err)
+		}
+		userID := doc.UserID.Hex()
+
+		if unique {
+			existing, err := collection.CountDocuments(ctx, bson.M{"user_id": userID})
+			if err != nil {
+				return result, fmt.Errorf("error checking %s for user %s: %w", result.Collection, userID, err)
+			}
+			if existing > 0 {
+				if _, err := collection.DeleteOne(ctx, bson.M{"_id": doc.ID}); err != nil {
+					return result, fmt.Errorf("error removing duplicate %s document: %w", result.Collection, err)
+				}
+				result.Dropped++
+				continue
+			}
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"user_id": userID}}); err != nil {
+			return result, fmt.Errorf("error migrating %s document: %w", result.Collection, err)
+		}
+		result.Converted++
+	}
+	if err := cursor.Err(); err != nil {
+		return result, fmt.Errorf("error reading %s documents: %w", result.Collection, err)
+	}
+	return result, nil
+}
+
+// ==================== Working Hours Migration ====================
+
+// WorkingHoursMigrationResult reports what MigrateWorkingHours changed
+type WorkingHoursMigrationResult struct {
+	Migrated bool   // The stored working hours or days were rewritten
+	Start    string // Working hours after the migration, HH:MM
+	End      string
+}
+
+// MigrateWorkingHours rewrites working hours stored in the legacy free-text
+// form (9am, 6:30pm) of the system default settings as HH:MM and stores
+// the default working days when none are set. Values that cannot be read
+// are replaced by the defaults. It is safe to run again.
+func (r *SettingsRepository) MigrateWorkingHours(ctx context.Context) (WorkingHoursMigrationResult, error) {
+	var settings models.SystemDefaultSettings
+	err := r.systemDefaults.FindOne(ctx, bson.M{}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return WorkingHoursMigrationResult{}, nil
+	}
+	if err != nil {
+		return WorkingHoursMigrationResult{}, fmt.Errorf("error reading system default settings: %w", err)
+	}
+
+	defaults := DefaultSystemDefaultSettings()
+	start, startOK := models.NormalizeWorkingHours(settings.WorkingHoursStart)
+	end, endOK := models.NormalizeWorkingHours(settings.WorkingHoursEnd)
+	if !startOK || !endOK || start >= end {
+		start, end = defaults.WorkingHoursStart, defaults.WorkingHoursEnd
+	}
+	result := WorkingHoursMigrationResult{Start: start, End: end}
+
+	setFields := bson.M{}
+	if start != settings.WorkingHoursStart {
+		setFields["working_hours_start"] = start
+	}
+	if end != settings.WorkingHoursEnd {
+		setFields["working_hours_end"] = end
+	}
+	if len(settings.WorkingDays) == 0 {
+		setFields["working_days"] = defaults.WorkingDays
+	}
+	if len(setFields) == 0 {
+		return result, nil
+	}
+
+	setFields["updated_at"] = time.Now()
+	if _, err := r.systemDefaults.UpdateOne(ctx, bson.M{"_id": settings.ID}, bson.M{"$set": setFields}); err != nil {
+		return result, fmt.Errorf("error migrating working hours: %w", err)
+	}
+	result.Migrated = true
+	return result, nil
 }
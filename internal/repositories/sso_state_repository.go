@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SSOStateRepository keeps the state and nonce of SSO sign-ins in progress
+type SSOStateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewSSOStateRepository creates a new SSOStateRepository
+func NewSSOStateRepository(client *mongodb.Client) *SSOStateRepository {
+	return &SSOStateRepository{
+		collection: client.Collection("sso_states"),
+	}
+}
+
+// EnsureIndexes creates the TTL index that removes expired states
+func (r *SSOStateRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, r.collection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+}
+
+// SaveSSOState stores the state of a new SSO sign-in
+func (r *SSOStateRepository) SaveSSOState(ctx context.Context, state *models.SSOState) error {
+	if _, err := r.collection.InsertOne(ctx, state); err != nil {
+		return fmt.Errorf("error saving SSO state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeSSOState removes and returns an unexpired state. A state that was
+// already consumed or has expired returns ErrSSOStateNotFound, so a callback
+// cannot be replayed.
+func (r *SSOStateRepository) ConsumeSSOState(ctx context.Context, id string, now time.Time) (*models.SSOState, error) {
+	var state models.SSOState
+	err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": id, "expires_at": bson.M{"$gt": now}}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrSSOStateNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consuming SSO state: %w", err)
+	}
+	return &state, nil
+}
@@ -0,0 +1,290 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+)
+
+// The store interfaces below cover exactly the repository methods that
+// handlers and services call, one per domain, so those callers can run
+// against the in-memory stores in the memory package as well as MongoDB.
+// Methods are added here only when a caller needs them.
+
+// UserStore reads and updates user accounts
+type UserStore interface {
+	GetByID(ctx context.Context, id string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByInviteToken(ctx context.Context, token string) (*models.User, error)
+	GetUsersByIDs(ctx context.Context, ids []string) ([]*models.User, error)
+	ListByTeam(ctx context.Context, team string, limit, offset int) ([]*models.User, error)
+	ListDirectReports(ctx context.Context, managerID string) ([]*models.User, error)
+	ListUsersFiltered(ctx context.Context, filters UserFilters) ([]*models.User, int64, error)
+	EachUserFiltered(ctx context.Context, filters UserFilters, fn func(user *models.User) error) error
+	UserStats(ctx context.Context, now time.Time) (*UserStats, error)
+	UpdateDataScope(ctx context.Context, id string, scope *models.DataScope) (*models.User, error)
+	UpdateRoleIDs(ctx context.Context, id string, roleIDs []string) (*models.User, error)
+	UpdatePassword(ctx context.Context, id string, passwordHash string) error
+	ReplacePasswordHash(ctx context.Context, id string, passwordHash string) error
+	UpdateLastLogin(ctx context.Context, userID string, loginTime time.Time) error
+	UpdateLastSeen(ctx context.Context, userID string, at time.Time, interval time.Duration) error
+	Create(ctx context.Context, user *models.User) error
+	AcceptInvitation(ctx context.Context, token, passwordHash, phone string, at time.Time) (*models.User, error)
+	CountAdmins(ctx context.Context, adminRoleIDs []string) (int64, error)
+}
+
+// RoleSeedStore creates the built-in roles and finds those granting admin
+// access
+type RoleSeedStore interface {
+	SeedBuiltInRoles(ctx context.Context) (int, error)
+	AdminRoleIDs(ctx context.Context) ([]string, error)
+}
+
+// SessionStore keeps the refresh-token sessions of signed-in users
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	HasDeviceSession(ctx context.Context, userID, userAgent string) (bool, error)
+	GetByRefreshToken(ctx context.Context, refreshToken string) (*models.Session, error)
+	Revoke(ctx context.Context, refreshToken string) error
+	ReplaceRefreshToken(ctx context.Context, refreshToken, replacement string) error
+	TouchSession(ctx context.Context, tokenID string, at time.Time, interval, idle time.Duration) error
+	ListUserSessions(ctx context.Context, userID string, now time.Time) ([]*models.Session, error)
+}
+
+// PasswordResetStore keeps password reset tokens
+type PasswordResetStore interface {
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+	GetPasswordReset(ctx context.Context, token string) (*models.PasswordReset, error)
+	MarkPasswordResetUsed(ctx context.Context, resetToken string) error
+}
+
+// Transactor runs fn as one transaction. fn must use the context it is given
+// for its operations to take part, and may be run more than once.
+// *mongodb.Client implements it.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// TemplateStore reads and writes a tenant's message templates, including
+// the trash, bulk updates and tags
+type TemplateStore interface {
+	GetByID(ctx context.Context, tenantID, id string) (*models.MongoTemplate, error)
+	GetByIDAnyState(ctx context.Context, tenantID, id string) (*models.MongoTemplate, error)
+	GetByIDs(ctx context.Context, tenantID string, ids []string) ([]*models.MongoTemplate, error)
+	GetByNames(ctx context.Context, tenantID string, names []string) ([]*models.MongoTemplate, error)
+	ListTemplatesPage(ctx context.Context, filters TemplateFilters) ([]*models.MongoTemplate, int64, error)
+	ListNamesWithPrefix(ctx context.Context, tenantID, prefix string) ([]string, error)
+	FindActiveSequencesUsingTemplate(ctx context.Context, tenantID, templateID string) ([]*models.SequenceTemplate, error)
+	GetUsageStats(ctx context.Context, tenantID, templateID string, windowDays int) (*models.TemplateStats, error)
+
+	Create(ctx context.Context, template *models.MongoTemplate) error
+	UpdateTemplate(ctx context.Context, template *models.MongoTemplate) error
+	UpdateTemplateAtVersion(ctx context.Context, template *models.MongoTemplate, version int) error
+	Replace(ctx context.Context, template *models.MongoTemplate) error
+	SetPublishState(ctx context.Context, tenantID, id, status string, publishedAt *time.Time, publishedBy string) error
+	Delete(ctx context.Context, tenantID, id string) error
+
+	SoftDelete(ctx context.Context, tenantID, id, deletedBy string) error
+	ListTrash(ctx context.Context, tenantID string, scopeCreatedBy []string, page, limit int) ([]*models.MongoTemplate, int64, error)
+	RestoreFromTrash(ctx context.Context, tenantID, id string) error
+
+	SoftDeleteMany(ctx context.Context, tenantID string, ids []string, deletedBy string) (int64, error)
+	SetStatusMany(ctx context.Context, tenantID string, ids []string, status string) (int64, error)
+	AddTagsMany(ctx context.Context, tenantID string, ids, tags []string) (int64, error)
+	RemoveTagsMany(ctx context.Context, tenantID string, ids, tags []string) (int64, error)
+
+	ListTagCounts(ctx context.Context, tenantID string) ([]models.TemplateTagCount, error)
+	RenameTag(ctx context.Context, tenantID, oldName, newName string) ([]string, error)
+
+	SetApprovalState(ctx context.Context, tenantID, id, fromStatus, toStatus string, entry models.TemplateApproval) error
+}
+
+// EmailStore stores the outbound emails that handlers send
+type EmailStore interface {
+	CreateCommMessage(ctx context.Context, msg *models.CommMessage) error
+	GetMessageByID(ctx context.Context, id string) (*models.MongoCommunication, error)
+	UpdateMessageStatus(ctx context.Context, id string, status string) error
+	MarkSent(ctx context.Context, id, provider, externalID string) error
+	CountPendingForDistributionList(ctx context.Context, listID string) (int64, error)
+}
+
+// MailboxStore serves the inbox, threads, attachments, delivery tracking and
+// outbound email administration on top of EmailStore
+type MailboxStore interface {
+	EmailStore
+
+	GetCommInbox(ctx context.Context, userID string, filters EmailFilters) ([]*models.CommMessage, error)
+	CountInbox(ctx context.Context, userID string, filters EmailFilters) (int64, error)
+	GetInboxSummary(ctx context.Context, userID string) (*InboxSummary, error)
+	SearchMessages(ctx context.Context, userID, query string, filters EmailFilters) ([]*MessageSearchResult, int64, error)
+	GetCommMessagesByThread(ctx context.Context, threadID string) ([]*models.CommMessage, error)
+
+	ListThreads(ctx context.Context, userID string, archived *bool, limit, offset int) ([]*MessageThread, int64, error)
+	GetUserThread(ctx context.Context, threadID, userID string) (*MessageThread, error)
+	SetThreadArchived(ctx context.Context, threadID, userID string, archived bool) (*MessageThread, error)
+
+	SaveCommAttachment(ctx context.Context, att *models.MessageAttachment) error
+	AddMessageAttachment(ctx context.Context, messageID string, att models.CommunicationAttachment) error
+	GetAttachmentByID(ctx context.Context, attachmentID string) (*MessageAttachment, error)
+	IncrementAttachmentDownloadCount(ctx context.Context, attachmentID string) error
+
+	MarkOpened(ctx context.Context, id string, at time.Time) error
+	RecordClick(ctx context.Context, id, link string, at time.Time) error
+	UpdateDeliveryStatus(ctx context.Context, ev *models.EmailDeliveryWebhook) (*models.MongoCommunication, bool, error)
+
+	ListOutboundEmails(ctx context.Context, status string, limit, offset int) ([]*models.MongoCommunication, int64, error)
+	RequeueEmail(ctx context.Context, id string) (*models.MongoCommunication, error)
+	CancelScheduledEmail(ctx context.Context, id, userID string) error
+}
+
+// SettingsStore reads and writes user preferences, company information and
+// system-wide settings
+type SettingsStore interface {
+	GetUserProfile(ctx context.Context, userID string) (*models.SettingsUserProfile, error)
+	GetEmailSignature(ctx context.Context, userID string) (*models.SettingsEmailSignature, error)
+	UpdateEmailSignature(ctx context.Context, userID string, update models.SettingsUpdateEmailSignatureRequest) (*models.SettingsEmailSignature, error)
+	GetSecuritySettings(ctx context.Context, userID string) (*models.SettingsUserSecuritySettings, error)
+	UpdateSecuritySettings(ctx context.Context, userID string, update models.SettingsUpdateSecuritySettingsRequest) (*models.SettingsUserSecuritySettings, error)
+	StartPhoneVerification(ctx context.Context, userID string, verification models.PhoneVerification) error
+	RecordPhoneVerificationAttempt(ctx context.Context, userID string) error
+	ConfirmPhoneNumber(ctx context.Context, userID, phoneNumber string, at time.Time) (*models.SettingsUserSecuritySettings, error)
+	RemovePhoneNumber(ctx context.Context, userID string) (*models.SettingsUserSecuritySettings, error)
+	GetCommunicationPreferences(ctx context.Context, userID string) (*models.SettingsCommunicationPreferences, error)
+	GetNotificationSettings(ctx context.Context, userID string) (*models.SettingsNotificationSettings, error)
+	UpdateNotificationSettings(ctx context.Context, userID string, update *models.SettingsUpdateNotificationSettingsRequest) (*models.SettingsNotificationSettings, error)
+
+	GetCompanyInfo(ctx context.Context) (*models.SettingsCompanyInfo, error)
+	UpdateCompanyInfo(ctx context.Context, update *models.SettingsUpdateCompanyInfoRequest) (*models.SettingsCompanyInfo, error)
+	GetSystemDefaultSettings(ctx context.Context) (*models.SystemDefaultSettings, error)
+	UpdateSystemDefaultSettings(ctx context.Context, update *models.UpdateSystemDefaultSettingsRequest) (*models.SystemDefaultSettings, error)
+	GetSystemSecuritySettings(ctx context.Context) (*models.SystemSecuritySettings, error)
+	UpdateSystemSecuritySettings(ctx context.Context, update *models.UpdateSystemSecuritySettingsRequest) (*models.SystemSecuritySettings, error)
+	GetSystemEmailNotificationSettings(ctx context.Context) (*models.SystemEmailNotificationSettings, error)
+	UpdateSystemEmailNotificationSettings(ctx context.Context, update *models.UpdateSystemEmailNotificationSettingsRequest) (*models.SystemEmailNotificationSettings, error)
+
+	GetAuditLogs(ctx context.Context, userIDs []string, page pagination.Request) ([]models.SettingsAuditLog, error)
+	CountAuditLogs(ctx context.Context, userIDs []string) (int64, error)
+	EachAuditLog(ctx context.Context, userIDs []string, fn func(*models.SettingsAuditLog) error) error
+}
+
+// NotificationStore keeps the in-app notification feed of every user
+type NotificationStore interface {
+	CreateNotification(ctx context.Context, n *models.Notification) error
+	ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit, offset int) ([]*models.Notification, int64, error)
+	CountUnreadNotifications(ctx context.Context, userID string) (int64, error)
+	MarkNotificationRead(ctx context.Context, userID, id string, at time.Time) (*models.Notification, error)
+}
+
+// PendingNotificationStore holds notification emails for the recipients'
+// digests until a worker claims and sends them
+type PendingNotificationStore interface {
+	AddPendingNotification(ctx context.Context, n *models.PendingNotification) error
+	ClaimDueDigest(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.PendingNotification, error)
+	DeletePendingNotifications(ctx context.Context, owner string, ids []string) error
+}
+
+// EmailUsageStore counts outbound emails per send quota period
+type EmailUsageStore interface {
+	IncrementEmailUsage(ctx context.Context, period string, start time.Time, n int64, at time.Time) (*models.EmailUsage, error)
+	GetEmailUsage(ctx context.Context, period string, start time.Time) (*models.EmailUsage, error)
+	ClaimUsageAlert(ctx context.Context, period string, start time.Time, at time.Time) (bool, error)
+}
+
+// SSOStateStore keeps the state of SSO sign-ins between the redirect to the
+// identity provider and its callback
+type SSOStateStore interface {
+	SaveSSOState(ctx context.Context, state *models.SSOState) error
+	ConsumeSSOState(ctx context.Context, id string, now time.Time) (*models.SSOState, error)
+}
+
+// ImpersonationStore keeps the impersonation sessions of support operators
+type ImpersonationStore interface {
+	CreateImpersonation(ctx context.Context, session *models.ImpersonationSession) error
+	GetImpersonation(ctx context.Context, id string) (*models.ImpersonationSession, error)
+	ListActiveImpersonations(ctx context.Context, actorID, targetUserID string, now time.Time) ([]*models.ImpersonationSession, error)
+	EndImpersonation(ctx context.Context, id string, at time.Time) (bool, error)
+}
+
+// LoginHistoryStore keeps the sign-in attempts of every user
+type LoginHistoryStore interface {
+	CreateLoginRecord(ctx context.Context, record *models.LoginRecord) error
+	ListLoginHistory(ctx context.Context, userID string, filter models.LoginHistoryFilter, page pagination.Request) ([]models.LoginRecord, error)
+	CountLoginHistory(ctx context.Context, userID string, filter models.LoginHistoryFilter) (int64, error)
+	HasSuccessfulLogin(ctx context.Context, userID, userAgent string) (bool, error)
+}
+
+// TwoFactorCodeStore keeps the codes of sign-ins waiting for their second
+// factor
+type TwoFactorCodeStore interface {
+	CreateTwoFactorCode(ctx context.Context, code *models.TwoFAOTP) error
+	GetTwoFactorCode(ctx context.Context, tempToken string) (*models.TwoFAOTP, error)
+	MarkTwoFactorCodeUsed(ctx context.Context, id string) error
+}
+
+// ActivityStore records the activity timeline entries of handler operations
+type ActivityStore interface {
+	CreateActivity(ctx context.Context, activity *models.Activity) error
+}
+
+// PermissionDenialStore keeps the requests refused for a missing
+// permission or role
+type PermissionDenialStore interface {
+	CreatePermissionDenial(ctx context.Context, denial *models.PermissionDenial) error
+	ListPermissionDenials(ctx context.Context, userID string, page pagination.Request) ([]models.PermissionDenial, error)
+	CountPermissionDenials(ctx context.Context, userID string) (int64, error)
+}
+
+// EventOutboxStore keeps the domain events waiting for the Kafka relay,
+// their delivery attempts and the replays started by operators
+type EventOutboxStore interface {
+	RecordWithID(ctx context.Context, eventID, topic, key string, payload interface{}) error
+	ListUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, eventID string) error
+	MarkFailed(ctx context.Context, eventID string, cause error, setAside bool) error
+	ListEvents(ctx context.Context, filter models.OutboxEventFilter, limit, offset int) ([]*models.OutboxEvent, int64, error)
+	GetEvent(ctx context.Context, eventID string) (*models.OutboxEvent, error)
+	Requeue(ctx context.Context, eventID, replayedBy string) (*models.OutboxEvent, error)
+	ListFailedIDs(ctx context.Context, from, to time.Time, limit int) ([]string, error)
+	CreateReplayJob(ctx context.Context, job *models.EventReplayJob) error
+	SaveReplayJob(ctx context.Context, job *models.EventReplayJob) error
+	GetReplayJob(ctx context.Context, jobID string) (*models.EventReplayJob, error)
+}
+
+// DistributionListStore keeps distribution lists and their members
+type DistributionListStore interface {
+	CreateList(ctx context.Context, list *models.DistributionList) error
+	GetList(ctx context.Context, tenantID, id string) (*models.DistributionList, error)
+	GetListAnyTenant(ctx context.Context, id string) (*models.DistributionList, error)
+	ListLists(ctx context.Context, filters DistributionListFilters, page pagination.Request) ([]*models.DistributionList, error)
+	CountLists(ctx context.Context, filters DistributionListFilters) (int64, error)
+	UpdateList(ctx context.Context, tenantID, id string, update *models.UpdateDistributionListRequest, at time.Time) (*models.DistributionList, error)
+	DeleteList(ctx context.Context, tenantID, id string) error
+	AddMembers(ctx context.Context, listID string, members []models.DistributionListMemberInput, addedBy string, at time.Time) (int, error)
+	RemoveMembers(ctx context.Context, listID string, members []models.DistributionListMemberInput, at time.Time) (int, error)
+	CountMembers(ctx context.Context, listID string) (int64, error)
+	ListMembers(ctx context.Context, listID string, page pagination.Request) ([]*models.DistributionListMember, error)
+	AllMembers(ctx context.Context, listID string) ([]*models.DistributionListMember, error)
+}
+
+var (
+	_ UserStore          = (*MongoUserRepository)(nil)
+	_ SessionStore       = (*MongoUserRepository)(nil)
+	_ PasswordResetStore = (*MongoUserRepository)(nil)
+	_ RoleSeedStore      = (*PermissionRepository)(nil)
+	_ TemplateStore      = (*MongoTemplateRepository)(nil)
+	_ MailboxStore       = (*MongoEmailRepository)(nil)
+	_ SettingsStore      = (*SettingsRepository)(nil)
+	_ NotificationStore  = (*NotificationRepository)(nil)
+	_ EmailUsageStore    = (*EmailUsageRepository)(nil)
+	_ SSOStateStore      = (*SSOStateRepository)(nil)
+	_ ImpersonationStore = (*ImpersonationRepository)(nil)
+	_ LoginHistoryStore  = (*LoginHistoryRepository)(nil)
+	_ ActivityStore      = (*MongoActivityRepository)(nil)
+	_ TwoFactorCodeStore = (*TwoFactorCodeRepository)(nil)
+
+	_ PermissionDenialStore = (*PermissionDenialRepository)(nil)
+	_ EventOutboxStore      = (*EventOutboxRepository)(nil)
+	_ DistributionListStore = (*DistributionListRepository)(nil)
+)
@@ -2,40 +2,84 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/white/user-management/internal/models"
 	"github.com/white/user-management/pkg/mongodb"
 	"github.com/white/user-management/pkg/uuid"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// MongoTemplateRepository handles template data access with MongoDB
+// MongoTemplateRepository handles template data access with MongoDB.
+// Sequence templates are persisted by SequenceTemplateRepository.
+// Listings and tag counts read through reports, which may lag the primary.
 type MongoTemplateRepository struct {
-	client             *mongodb.Client
-	collection         *mongo.Collection
-	sequenceCollection *mongo.Collection
+	collection *mongo.Collection
+	reports    *mongo.Collection
+	stats      *TemplateStatsRepository
+	sequences  *SequenceTemplateRepository
 }
 
 // NewMongoTemplateRepository creates a new MongoTemplateRepository
 func NewMongoTemplateRepository(client *mongodb.Client) *MongoTemplateRepository {
 	return &MongoTemplateRepository{
-		client:             client,
-		collection:         client.Collection("templates"),
-		sequenceCollection: client.Collection("sequence_templates"),
+		collection: client.Collection("templates"),
+		reports:    client.ReportingCollection("templates"),
+		stats:      NewTemplateStatsRepository(client),
+		sequences:  NewSequenceTemplateRepository(client),
 	}
 }
 
-// GetByID retrieves a template by its ObjectID
-func (r *MongoTemplateRepository) GetByID(ctx context.Context, id string) (*models.MongoTemplate, error) {
+// tenantFilter scopes a templates query to a tenant and hides soft-deleted
+// templates. Every template query goes through it (or trashFilter/anyStateFilter)
+// so a guessed ID can never reach another tenant's document and trashed
+// templates never show up in normal reads.
+func tenantFilter(tenantID string, filter bson.M) (bson.M, error) {
+	filter, err := anyStateFilter(tenantID, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter["deleted_at"] = nil // matches missing or null
+	return filter, nil
+}
+
+// trashFilter scopes a templates query to a tenant's soft-deleted templates
+func trashFilter(tenantID string, filter bson.M) (bson.M, error) {
+	filter, err := anyStateFilter(tenantID, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter["deleted_at"] = bson.M{"$ne": nil}
+	return filter, nil
+}
+
+// anyStateFilter scopes a templates query to a tenant, deleted or not
+func anyStateFilter(tenantID string, filter bson.M) (bson.M, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, ErrTenantRequired
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["tenant_id"] = tenantID
+	return filter, nil
+}
+
+// GetByID retrieves a tenant's template by ID. Templates belonging to other
+// tenants are reported as not found.
+func (r *MongoTemplateRepository) GetByID(ctx context.Context, tenantID, id string) (*models.MongoTemplate, error) {
 	var template models.MongoTemplate
 
-	filter := bson.M{"_id": id}
-	err := r.collection.FindOne(ctx, filter).Decode(&template)
+	filter, err := tenantFilter(tenantID, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	err = r.collection.FindOne(ctx, filter).Decode(&template)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
@@ -48,6 +92,10 @@ func (r *MongoTemplateRepository) GetByID(ctx context.Context, id string) (*mode
 
 // Create inserts a new template document
 func (r *MongoTemplateRepository) Create(ctx context.Context, template *models.MongoTemplate) error {
+	if uuid.IsEmptyUUID(template.TenantID) {
+		return ErrTenantRequired
+	}
+
 	// Set timestamp
 	template.CreatedAt = time.Now()
 
@@ -65,27 +113,34 @@ func (r *MongoTemplateRepository) Create(ctx context.Context, template *models.M
 	return nil
 }
 
-// Update modifies an existing template document
-func (r *MongoTemplateRepository) Update(ctx context.Context, template *models.MongoTemplate) error {
-	filter := bson.M{"_id": template.ID}
+// UpdateTemplate stamps UpdatedAt and updates a template
+func (r *MongoTemplateRepository) UpdateTemplate(ctx context.Context, template *models.MongoTemplate) error {
+	template.UpdatedAt = time.Now()
+	return r.update(ctx, template, nil)
+}
+
+// UpdateTemplateAtVersion stamps UpdatedAt and updates a template only if
+// its stored version is still version, returning ErrVersionConflict
+// otherwise
+func (r *MongoTemplateRepository) UpdateTemplateAtVersion(ctx context.Context, template *models.MongoTemplate, version int) error {
+	template.UpdatedAt = time.Now()
+	return r.update(ctx, template, &version)
+}
+
+// update writes the editable fields of a template and bumps its version.
+// A non-nil version must match the stored one.
+func (r *MongoTemplateRepository) update(ctx context.Context, template *models.MongoTemplate, version *int) error {
+	match := bson.M{"_id": template.ID}
+	if version != nil {
+		match["version"] = VersionFilter(*version)
+	}
+	filter, err := tenantFilter(template.TenantID, match)
+	if err != nil {
+		return err
+	}
 	update := bson.M{
-		"$set": bson.M{
-			"name":          template.Name,
-			"type":          template.Type,
-			"channel":       template.Channel,
-			"subject":       template.Subject,
-			"body":          template.Body,
-			"variables":     template.Variables,
-			"category":      template.Category,
-			"tags":          template.Tags,
-			"status":        template.Status,
-			"for_stage":     template.ForStage,
-			"industries":    template.Industries,
-			"approval_flag": template.ApprovalFlag,
-			"ai_enhanced":   template.AiEnhanced,
-			"service_id":    template.ServiceID,
-			"updated_at":    time.Now(),
-		},
+		"$set": editableTemplateFields(template),
+		"$inc": bson.M{"version": 1},
 	}
 
 	result, err := r.collection.UpdateOne(ctx, filter, update)
@@ -94,192 +149,208 @@ func (r *MongoTemplateRepository) Update(ctx context.Context, template *models.M
 	}
 
 	if result.MatchedCount == 0 {
+		if version != nil {
+			if _, err := r.GetByID(ctx, template.TenantID, template.ID); err == nil {
+				return ErrVersionConflict
+			}
+		}
 		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
 	}
+	template.Version++
 
 	return nil
 }
 
-// Delete removes a template by ID
-func (r *MongoTemplateRepository) Delete(ctx context.Context, id string) error {
-	filter := bson.M{"_id": id}
-
-	result, err := r.collection.DeleteOne(ctx, filter)
-	if err != nil {
-		return fmt.Errorf("error deleting template: %w", err)
+// editableTemplateFields maps the fields a template update writes to their
+// bson names; it is the only such mapping. Create stores the whole document,
+// and the remaining fields (creation stamp, version, publication, review,
+// trash, system key and Meta review state) are changed only by their own
+// methods.
+func editableTemplateFields(template *models.MongoTemplate) bson.M {
+	return bson.M{
+		"name":               template.Name,
+		"description":        template.Description,
+		"type":               template.Type,
+		"channel":            template.Channel,
+		"status":             template.Status,
+		"content":            template.Content,
+		"subject":            template.Subject,
+		"body":               template.Body,
+		"variables":          template.Variables,
+		"variables_schema":   template.VariablesSchema,
+		"custom_fields":      template.CustomFields,
+		"category":           template.Category,
+		"tags":               template.Tags,
+		"for_stage":          template.ForStage,
+		"industries":         template.Industries,
+		"approval_flag":      template.ApprovalFlag,
+		"ai_enhanced":        template.AiEnhanced,
+		"service_id":         template.ServiceID,
+		"meta_template_name": template.MetaTemplateName,
+		"template_type":      template.TemplateType,
+		"kosh_document_ids":  template.KoshDocumentIds,
+		"updated_at":         template.UpdatedAt,
 	}
-
-	if result.DeletedCount == 0 {
-		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
-	}
-
-	return nil
 }
 
-// ListByType retrieves templates of a specific type with pagination
-func (r *MongoTemplateRepository) ListByType(ctx context.Context, templateType string, limit, offset int) ([]*models.MongoTemplate, error) {
-	filter := bson.M{"type": templateType}
-
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "name", Value: 1}}) // Sort alphabetically by name
-
-	cursor, err := r.collection.Find(ctx, filter, opts)
+// SetPublishState updates a template's status and publication stamp.
+// Pass a nil publishedAt to clear the stamp (unpublish).
+func (r *MongoTemplateRepository) SetPublishState(ctx context.Context, tenantID, id, status string, publishedAt *time.Time, publishedBy string) error {
+	filter, err := tenantFilter(tenantID, bson.M{"_id": id})
 	if err != nil {
-		return nil, fmt.Errorf("error listing templates by type: %w", err)
+		return err
 	}
-	defer cursor.Close(ctx)
-
-	var templates []*models.MongoTemplate
-	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding templates: %w", err)
+	update := bson.M{
+		"$set": bson.M{
+			"status":     status,
+			"updated_at": time.Now(),
+		},
+	}
+	if publishedAt != nil {
+		update["$set"].(bson.M)["published_at"] = publishedAt
+		update["$set"].(bson.M)["published_by"] = publishedBy
+	} else {
+		update["$unset"] = bson.M{"published_at": "", "published_by": ""}
 	}
 
-	return templates, nil
-}
-
-// ListByChannel retrieves templates for a specific channel with pagination
-func (r *MongoTemplateRepository) ListByChannel(ctx context.Context, channel string, limit, offset int) ([]*models.MongoTemplate, error) {
-	filter := bson.M{"channel": channel}
-
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "name", Value: 1}})
-
-	cursor, err := r.collection.Find(ctx, filter, opts)
+	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return nil, fmt.Errorf("error listing templates by channel: %w", err)
+		return fmt.Errorf("error updating template publish state: %w", err)
 	}
-	defer cursor.Close(ctx)
 
-	var templates []*models.MongoTemplate
-	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding templates: %w", err)
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
 	}
 
-	return templates, nil
+	return nil
 }
 
-// ListByCategory retrieves templates in a specific category with pagination
-func (r *MongoTemplateRepository) ListByCategory(ctx context.Context, category string, limit, offset int) ([]*models.MongoTemplate, error) {
-	filter := bson.M{"category": category}
-
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "name", Value: 1}})
+// ErrApprovalStateChanged is returned by SetApprovalState when the template
+// left the expected approval status since it was read
+var ErrApprovalStateChanged = errors.New("template approval status has changed")
 
-	cursor, err := r.collection.Find(ctx, filter, opts)
-	if err != nil {
-		return nil, fmt.Errorf("error listing templates by category: %w", err)
+// SetApprovalState moves a template from fromStatus to toStatus in the review
+// cycle and appends entry to its review history. fromStatus "" matches a
+// template that was never submitted or was reset. The status check and update
+// are one operation, so concurrent reviews cannot both succeed.
+func (r *MongoTemplateRepository) SetApprovalState(ctx context.Context, tenantID, id, fromStatus, toStatus string, entry models.TemplateApproval) error {
+	current := interface{}(fromStatus)
+	if fromStatus == "" {
+		current = bson.M{"$in": bson.A{nil, ""}} // Also matches a missing field
 	}
-	defer cursor.Close(ctx)
-
-	var templates []*models.MongoTemplate
-	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding templates: %w", err)
+	filter, err := tenantFilter(tenantID, bson.M{"_id": id, "approval_status": current})
+	if err != nil {
+		return err
 	}
 
-	return templates, nil
-}
-
-// SearchByTags retrieves templates that have any of the specified tags
-func (r *MongoTemplateRepository) SearchByTags(ctx context.Context, tags []string, limit, offset int) ([]*models.MongoTemplate, error) {
-	filter := bson.M{}
-	if len(tags) > 0 {
-		filter["tags"] = bson.M{"$in": tags}
+	set := bson.M{"updated_at": time.Now()}
+	update := bson.M{"$set": set, "$push": bson.M{"approvals": entry}}
+	if toStatus == "" {
+		update["$unset"] = bson.M{"approval_status": ""}
+	} else {
+		set["approval_status"] = toStatus
 	}
 
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "name", Value: 1}})
-
-	cursor, err := r.collection.Find(ctx, filter, opts)
+	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return nil, fmt.Errorf("error searching templates by tags: %w", err)
+		return fmt.Errorf("error updating template approval state: %w", err)
 	}
-	defer cursor.Close(ctx)
-
-	var templates []*models.MongoTemplate
-	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding templates: %w", err)
+	if result.MatchedCount > 0 {
+		return nil
 	}
 
-	return templates, nil
+	if _, err := r.GetByID(ctx, tenantID, id); err != nil {
+		return err
+	}
+	return ErrApprovalStateChanged
 }
 
-// SearchByName searches for templates by name using regex
-func (r *MongoTemplateRepository) SearchByName(ctx context.Context, searchTerm string, limit, offset int) ([]*models.MongoTemplate, error) {
-	filter := bson.M{
-		"name": bson.M{
-			"$regex":   searchTerm,
-			"$options": "i", // Case-insensitive
-		},
+// ListNamesWithPrefix returns the names of a tenant's templates starting with prefix
+func (r *MongoTemplateRepository) ListNamesWithPrefix(ctx context.Context, tenantID, prefix string) ([]string, error) {
+	filter, err := tenantFilter(tenantID, bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}})
+	if err != nil {
+		return nil, err
 	}
-
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "name", Value: 1}})
+	opts := options.Find().SetProjection(bson.M{"name": 1})
 
 	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, fmt.Errorf("error searching templates by name: %w", err)
+		return nil, fmt.Errorf("error listing template names: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var templates []*models.MongoTemplate
-	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding templates: %w", err)
+	var docs []struct {
+		Name string `bson:"name"`
 	}
-
-	return templates, nil
-}
-
-// ListAll retrieves all templates with pagination
-func (r *MongoTemplateRepository) ListAll(ctx context.Context, limit, offset int) ([]*models.MongoTemplate, error) {
-	filter := bson.M{}
-
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "created_at", Value: -1}}) // Sort by newest first
-
-	cursor, err := r.collection.Find(ctx, filter, opts)
-	if err != nil {
-		return nil, fmt.Errorf("error listing all templates: %w", err)
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("error decoding template names: %w", err)
 	}
-	defer cursor.Close(ctx)
 
-	var templates []*models.MongoTemplate
-	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding templates: %w", err)
+	names := make([]string, 0, len(docs))
+	for _, d := range docs {
+		names = append(names, d.Name)
 	}
-
-	return templates, nil
+	return names, nil
 }
 
-// Count returns the total number of templates (optionally filtered by type)
-func (r *MongoTemplateRepository) Count(ctx context.Context, templateType string) (int64, error) {
-	filter := bson.M{}
-	if templateType != "" {
-		filter["type"] = templateType
+// Delete permanently removes a tenant's template by ID, whether or not it is in the trash
+func (r *MongoTemplateRepository) Delete(ctx context.Context, tenantID, id string) error {
+	filter, err := anyStateFilter(tenantID, bson.M{"_id": id})
+	if err != nil {
+		return err
 	}
 
-	count, err := r.collection.CountDocuments(ctx, filter)
+	result, err := r.collection.DeleteOne(ctx, filter)
 	if err != nil {
-		return 0, fmt.Errorf("error counting templates: %w", err)
+		return fmt.Errorf("error deleting template: %w", err)
 	}
 
-	return count, nil
+	if result.DeletedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+	}
+
+	return nil
 }
 
 // EnsureIndexes creates the required indexes for the templates collection
 func (r *MongoTemplateRepository) EnsureIndexes(ctx context.Context) error {
 	indexes := []mongo.IndexModel{
+		{
+			// Tenant-scoped lookups by ID
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "_id", Value: 1},
+			},
+		},
+		{
+			// Tenant-scoped list filtering
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "status", Value: 1},
+				{Key: "channel", Value: 1},
+			},
+		},
+		{
+			// Listings narrowed to a team's or the caller's own templates
+			// by data scope, newest first
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "created_by", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+		{
+			// System email overrides, looked up by key on every send
+			Keys:    bson.D{{Key: "system_key", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			// Trash listing and retention sweep
+			Keys: bson.D{
+				{Key: "deleted_at", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
 		{
 			Keys: bson.D{
 				{Key: "type", Value: 1},
@@ -300,459 +371,611 @@ func (r *MongoTemplateRepository) EnsureIndexes(ctx context.Context) error {
 		},
 	}
 
-	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return createIndexes(ctx, r.collection, indexes)
+}
+
+
+// buildTemplateListFilter compiles TemplateFilters into a tenant-scoped Mongo query
+func buildTemplateListFilter(filters TemplateFilters) (bson.M, error) {
+	filter, err := tenantFilter(filters.TenantID, nil)
 	if err != nil {
-		return fmt.Errorf("error creating indexes: %w", err)
+		return nil, err
 	}
+	var and []bson.M
 
-	return nil
-}
+	// Channel filter
+	if filters.Channel != "" {
+		filter["channel"] = filters.Channel
+	}
 
+	// Type filter
+	if filters.Type != "" {
+		filter["type"] = filters.Type
+	}
 
-// =============================================================================
-// Service layer compatibility methods
-// =============================================================================
+	// Category filter
+	if filters.Category != "" {
+		filter["category"] = filters.Category
+	}
 
-// GetByIDCompat retrieves a sequence template by ID with its steps
-func (r *MongoTemplateRepository) GetByIDCompat(templateID primitive.ObjectID) (*models.SequenceTemplateWithSteps, error) {
-	ctx := context.Background()
+	// Status filter
+	if filters.Status != "" {
+		filter["status"] = filters.Status
+	}
 
-	var template models.SequenceTemplateWithSteps
-	filter := bson.M{"_id": templateID}
+	// Tags filter (template must have ALL tags)
+	if len(filters.Tags) > 0 {
+		filter["tags"] = bson.M{"$all": filters.Tags}
+	}
 
-	err := r.sequenceCollection.FindOne(ctx, filter).Decode(&template)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
-		}
-		return nil, fmt.Errorf("error finding sequence template by ID: %w", err)
+	// ForStage filter (array contains any of the specified stages)
+	if len(filters.ForStage) > 0 {
+		filter["for_stage"] = bson.M{"$in": filters.ForStage}
 	}
 
-	return &template, nil
-}
+	// Industries filter (array contains any of the specified industries)
+	if len(filters.Industries) > 0 {
+		filter["industries"] = bson.M{"$in": filters.Industries}
+	}
 
-// CreateSequenceTemplate creates a sequence template with steps
-func (r *MongoTemplateRepository) CreateSequenceTemplate(template *models.SequenceTemplateWithSteps) error {
-	ctx := context.Background()
+	// ApprovalFlag filter; a review status (pending, approved, rejected)
+	// filters on the review cycle instead, so ?approvalFlag=pending is the
+	// approvers' queue
+	if models.IsTemplateApprovalStatus(filters.ApprovalFlag) {
+		filter["approval_status"] = filters.ApprovalFlag
+	} else if filters.ApprovalFlag != "" {
+		filter["approval_flag"] = filters.ApprovalFlag
+	}
 
-	// Generate new ID if not set
-	if template.Template.TemplateID == "" {
-		template.Template.TemplateID = uuid.MustNewUUID()
+	// ServiceID filter
+	if !uuid.IsEmptyUUID(filters.ServiceID) {
+		filter["service_id"] = filters.ServiceID
 	}
 
-	// Set timestamps
-	now := time.Now()
-	template.Template.CreatedAt = now
-	template.Template.UpdatedAt = now
-
-	// Set step timestamps and template IDs
-	for i := range template.Steps {
-		template.Steps[i].TemplateID = template.Template.TemplateID
-		template.Steps[i].CreatedAt = now
-		// Ensure step_order is set correctly
-		if template.Steps[i].StepOrder == 0 {
-			template.Steps[i].StepOrder = i + 1
-		}
+	// CreatedBy filter
+	if !uuid.IsEmptyUUID(filters.CreatedBy) {
+		filter["created_by"] = filters.CreatedBy
 	}
 
-	// Insert into sequence_templates collection
-	_, err := r.sequenceCollection.InsertOne(ctx, template)
-	if err != nil {
-		return fmt.Errorf("error creating sequence template: %w", err)
+	// Data scope (ANDed so it composes with an explicit created_by filter)
+	if filters.ScopeCreatedBy != nil {
+		and = append(and, bson.M{"created_by": bson.M{"$in": filters.ScopeCreatedBy}})
 	}
 
-	return nil
-}
+	// Search filter (name, description, subject or body contains search term)
+	if filters.Search != "" {
+		pattern := regexp.QuoteMeta(filters.Search)
+		and = append(and, bson.M{"$or": []bson.M{
+			{"name": bson.M{"$regex": pattern, "$options": "i"}},
+			{"description": bson.M{"$regex": pattern, "$options": "i"}},
+			{"subject": bson.M{"$regex": pattern, "$options": "i"}},
+			{"body": bson.M{"$regex": pattern, "$options": "i"}},
+		}})
+	}
 
-// List lists sequence templates with filters
-func (r *MongoTemplateRepository) List(filters SequenceTemplateFilters) ([]*models.SequenceTemplateWithSteps, error) {
-	ctx := context.Background()
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	return filter, nil
+}
 
-	filter := bson.M{}
+// ListTemplatesPage returns one page of a tenant's templates matching filters together
+// with the total number of matches. Filtering, sorting and pagination all run in Mongo.
+// It may read a secondary, so a template saved a moment ago can be missing.
+func (r *MongoTemplateRepository) ListTemplatesPage(ctx context.Context, filters TemplateFilters) ([]*models.MongoTemplate, int64, error) {
+	limit := filters.Limit
+	if limit == 0 {
+		limit = 50
+	}
 
-	if filters.Channel != "" {
-		filter["steps.channel"] = filters.Channel
+	filter, err := buildTemplateListFilter(filters)
+	if err != nil {
+		return nil, 0, err
 	}
-	if filters.IsActive != nil {
-		filter["is_active"] = *filters.IsActive
+	if filters.Performance != "" {
+		clause, err := r.performanceClause(ctx, filters.TenantID, filters.Performance)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter = bson.M{"$and": []bson.M{filter, clause}}
 	}
-	if filters.Search != "" {
-		filter["name"] = bson.M{"$regex": filters.Search, "$options": "i"}
+
+	// Build sort options
+	sortField := "created_at"
+	sortOrder := -1 // Default: newest first
+
+	if filters.SortBy != "" {
+		switch filters.SortBy {
+		case "name":
+			sortField = "name"
+		case "date", "created_at", "createdAt":
+			sortField = "created_at"
+		case "updated_at", "updatedAt":
+			sortField = "updated_at"
+		case "status":
+			sortField = "status"
+		case "performance":
+			sortField = "updated_at"
+		case "usage":
+			sortField = "updated_at"
+		}
 	}
 
-	limit := filters.Limit
-	if limit == 0 {
-		limit = 20
+	if filters.SortOrder == "asc" {
+		sortOrder = 1
 	}
 
-	cursor, err := r.sequenceCollection.Find(ctx, filter, options.Find().
+	// Calculate skip for pagination
+	skip := filters.Offset
+	if filters.Page > 0 {
+		skip = (filters.Page - 1) * limit
+	}
+
+	// _id tiebreaker keeps pages stable when the sort field has duplicates
+	opts := options.Find().
 		SetLimit(int64(limit)).
-		SetSkip(int64(filters.Offset)).
-		SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		SetSkip(int64(skip)).
+		SetSort(bson.D{{Key: sortField, Value: sortOrder}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.reports.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, fmt.Errorf("error listing sequence templates: %w", err)
+		return nil, 0, fmt.Errorf("error listing templates: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var templates []*models.SequenceTemplateWithSteps
+	templates := []*models.MongoTemplate{}
 	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding sequence templates: %w", err)
+		return nil, 0, fmt.Errorf("error decoding templates: %w", err)
 	}
 
-	return templates, nil
-}
-
-// GetStepCount returns the number of steps for a template
-func (r *MongoTemplateRepository) GetStepCount(templateID primitive.ObjectID) (int, error) {
-	template, err := r.GetByIDCompat(templateID)
+	total, err := r.reports.CountDocuments(ctx, filter)
 	if err != nil {
-		return 0, err
+		return nil, 0, fmt.Errorf("error counting templates: %w", err)
 	}
-	return len(template.Steps), nil
-}
 
-// UpdateSequenceTemplate updates a sequence template with its steps
-func (r *MongoTemplateRepository) UpdateSequenceTemplate(template *models.SequenceTemplateWithSteps) error {
-	ctx := context.Background()
+	if err := r.attachUsage(ctx, filters.TenantID, templates); err != nil {
+		return nil, 0, err
+	}
 
-	// Update timestamp
-	template.Template.UpdatedAt = time.Now()
+	return templates, total, nil
+}
 
-	// Update step timestamps and template IDs
-	for i := range template.Steps {
-		template.Steps[i].TemplateID = template.Template.TemplateID
-		if template.Steps[i].StepOrder == 0 {
-			template.Steps[i].StepOrder = i + 1
+// attachUsage fills in the usage summary of listed templates
+func (r *MongoTemplateRepository) attachUsage(ctx context.Context, tenantID string, templates []*models.MongoTemplate) error {
+	ids := make([]string, 0, len(templates))
+	for _, t := range templates {
+		ids = append(ids, t.ID)
+	}
+	usage, err := r.stats.UsageByTemplate(ctx, tenantID, ids)
+	if err != nil {
+		return err
+	}
+	for _, t := range templates {
+		if u, ok := usage[t.ID]; ok {
+			t.Usage = u
+		} else {
+			t.Usage = &models.TemplateUsage{}
 		}
 	}
+	return nil
+}
 
-	filter := bson.M{"_id": template.Template.TemplateID}
-	update := bson.M{
-		"$set": bson.M{
-			"name":        template.Template.Name,
-			"description": template.Template.Description,
-			"schedule_id": template.Template.ScheduleID,
-			"version":     template.Template.Version,
-			"is_active":   template.Template.IsActive,
-			"updated_at":  template.Template.UpdatedAt,
-			"steps":       template.Steps,
-		},
+// performanceClause restricts a listing to templates whose sends over the stats
+// window fall in the given quartile band of the tenant's library
+func (r *MongoTemplateRepository) performanceClause(ctx context.Context, tenantID, level string) (bson.M, error) {
+	library, err := tenantFilter(tenantID, nil)
+	if err != nil {
+		return nil, err
 	}
-
-	result, err := r.sequenceCollection.UpdateOne(ctx, filter, update)
+	total, err := r.reports.CountDocuments(ctx, library)
 	if err != nil {
-		return fmt.Errorf("error updating sequence template: %w", err)
+		return nil, fmt.Errorf("error counting templates: %w", err)
+	}
+	sends, err := r.stats.WindowSends(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	low, high := performanceThresholds(sends, total)
+
+	ids := []string{}
+	for id, n := range sends {
+		switch level {
+		case models.TemplatePerformanceHigh:
+			if n >= high && n > 0 {
+				ids = append(ids, id)
+			}
+		case models.TemplatePerformanceMedium:
+			if n > low && n < high {
+				ids = append(ids, id)
+			}
+		case models.TemplatePerformanceLow:
+			// Unused templates are low too, so exclude the ones above the band
+			if n > low {
+				ids = append(ids, id)
+			}
+		}
 	}
 
-	if result.MatchedCount == 0 {
-		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+	if level == models.TemplatePerformanceLow {
+		return bson.M{"_id": bson.M{"$nin": ids}}, nil
 	}
+	return bson.M{"_id": bson.M{"$in": ids}}, nil
+}
 
-	return nil
+// GetUsageStats returns a tenant's template send statistics over the last windowDays days
+func (r *MongoTemplateRepository) GetUsageStats(ctx context.Context, tenantID, templateID string, windowDays int) (*models.TemplateStats, error) {
+	return r.stats.GetStats(ctx, tenantID, templateID, windowDays)
 }
 
-// DeleteSequenceTemplate deletes a sequence template
-func (r *MongoTemplateRepository) DeleteSequenceTemplate(templateID primitive.ObjectID) error {
-	ctx := context.Background()
+// FindActiveSequencesUsingTemplate returns the active sequence templates of
+// a tenant with a step whose content template is templateID
+func (r *MongoTemplateRepository) FindActiveSequencesUsingTemplate(ctx context.Context, tenantID, templateID string) ([]*models.SequenceTemplate, error) {
+	return r.sequences.FindActiveSequencesUsingTemplate(ctx, tenantID, templateID)
+}
 
-	result, err := r.sequenceCollection.DeleteOne(ctx, bson.M{"_id": templateID})
+// =============================================================================
+// Trash (soft delete)
+// =============================================================================
+
+// SoftDelete moves a tenant's template to the trash
+func (r *MongoTemplateRepository) SoftDelete(ctx context.Context, tenantID, id, deletedBy string) error {
+	matched, err := r.SoftDeleteMany(ctx, tenantID, []string{id}, deletedBy)
 	if err != nil {
-		return fmt.Errorf("error deleting sequence template: %w", err)
+		return err
 	}
-
-	if result.DeletedCount == 0 {
+	if matched == 0 {
 		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
 	}
-
 	return nil
 }
 
-// Clone clones a sequence template
-func (r *MongoTemplateRepository) Clone(templateID primitive.ObjectID, newName string, createdBy string) (*models.SequenceTemplateWithSteps, error) {
-	// Get the original template
-	original, err := r.GetByIDCompat(templateID)
+// GetByIDAnyState retrieves a tenant's template by ID, including trashed ones
+func (r *MongoTemplateRepository) GetByIDAnyState(ctx context.Context, tenantID, id string) (*models.MongoTemplate, error) {
+	filter, err := anyStateFilter(tenantID, bson.M{"_id": id})
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now()
-	newID := uuid.MustNewUUID()
-
-	// Create a clone with new ID
-	clone := &models.SequenceTemplateWithSteps{
-		Template: models.SequenceTemplate{
-			TemplateID:  newID,
-			Name:        newName,
-			Description: original.Template.Description,
-			ScheduleID:  original.Template.ScheduleID,
-			Version:     1,
-			IsActive:    true,
-			CreatedBy:   createdBy,
-			CreatedAt:   now,
-			UpdatedAt:   now,
-		},
-		Steps: make([]models.CampaignSequenceStep, len(original.Steps)),
+	var template models.MongoTemplate
+	if err := r.collection.FindOne(ctx, filter).Decode(&template); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+		}
+		return nil, fmt.Errorf("error finding template by ID: %w", err)
 	}
 
-	// Copy and update step IDs for the clone
-	for i, step := range original.Steps {
-		clone.Steps[i] = step
-		clone.Steps[i].TemplateID = newID
-		clone.Steps[i].CreatedAt = now
+	return &template, nil
+}
+
+// GetSystemEmailOverride retrieves the template overriding the system email
+// with key. Overrides apply to the whole deployment, so unlike every other
+// read this one is not tenant-scoped. With publishedOnly only a published
+// override is returned; otherwise the most recently updated one is, for
+// previewing drafts. None is reported as not found.
+func (r *MongoTemplateRepository) GetSystemEmailOverride(ctx context.Context, key string, publishedOnly bool) (*models.MongoTemplate, error) {
+	filter := bson.M{
+		"system_key": key,
+		"is_system":  true,
+		"channel":    string(models.TemplateChannelEmail),
+		"deleted_at": nil,
+	}
+	if publishedOnly {
+		filter["status"] = bson.M{"$in": []string{string(models.TemplateStatusPublished), string(models.TemplateStatusActive)}}
 	}
 
-	// Save the clone
-	if err := r.CreateSequenceTemplate(clone); err != nil {
-		return nil, err
+	var template models.MongoTemplate
+	opts := options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	if err := r.collection.FindOne(ctx, filter, opts).Decode(&template); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+		}
+		return nil, fmt.Errorf("error finding system email override: %w", err)
 	}
 
-	return clone, nil
+	return &template, nil
 }
 
-// ValidateSequence validates a sequence template and returns validation errors
-func (r *MongoTemplateRepository) ValidateSequence(templateID primitive.ObjectID) (bool, []map[string]interface{}, error) {
-	// Get template with steps
-	template, err := r.GetByIDCompat(templateID)
+// ListTrash returns one page of a tenant's trashed templates (most recently
+// deleted first) and the total number in the trash. scopeCreatedBy limits the
+// result to templates created by those users when non-nil.
+func (r *MongoTemplateRepository) ListTrash(ctx context.Context, tenantID string, scopeCreatedBy []string, page, limit int) ([]*models.MongoTemplate, int64, error) {
+	filter, err := trashFilter(tenantID, nil)
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to get template: %w", err)
+		return nil, 0, err
 	}
-	if template == nil {
-		return false, nil, fmt.Errorf("template not found")
+	if scopeCreatedBy != nil {
+		filter["created_by"] = bson.M{"$in": scopeCreatedBy}
 	}
 
-	// Validate using model validation
-	validationErr := template.Validate()
-	if validationErr == nil {
-		return true, []map[string]interface{}{}, nil
+	opts := options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64((page - 1) * limit)).
+		SetSort(bson.D{{Key: "deleted_at", Value: -1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing trashed templates: %w", err)
 	}
+	defer cursor.Close(ctx)
 
-	// Build error list
-	errors := []map[string]interface{}{
-		{
-			"stepOrder": 0,
-			"field":     "general",
-			"message":   validationErr.Error(),
-		},
+	templates := []*models.MongoTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, 0, fmt.Errorf("error decoding templates: %w", err)
 	}
 
-	// Additional validations
-	for i, step := range template.Steps {
-		stepOrder := i + 1
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting trashed templates: %w", err)
+	}
 
-		// Check required fields
-		if step.Channel == "" {
-			errors = append(errors, map[string]interface{}{
-				"stepOrder": stepOrder,
-				"field":     "communicationType",
-				"message":   "Communication type is required",
-			})
-		}
+	return templates, total, nil
+}
 
-		if step.ContentTemplateID == "" {
-			errors = append(errors, map[string]interface{}{
-				"stepOrder": stepOrder,
-				"field":     "templateId",
-				"message":   "Template is required",
-			})
-		}
+// RestoreFromTrash takes a tenant's template out of the trash
+func (r *MongoTemplateRepository) RestoreFromTrash(ctx context.Context, tenantID, id string) error {
+	filter, err := trashFilter(tenantID, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
 
-		if step.Body == "" {
-			errors = append(errors, map[string]interface{}{
-				"stepOrder": stepOrder,
-				"field":     "message",
-				"message":   "Message content is required",
-			})
-		}
+	update := bson.M{
+		"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error restoring template: %w", err)
+	}
 
-		// Email requires subject
-		if step.Channel == "email" && step.Subject == "" {
-			errors = append(errors, map[string]interface{}{
-				"stepOrder": stepOrder,
-				"field":     "subject",
-				"message":   "Subject is required for email steps",
-			})
-		}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
+	}
 
-		// First step should have 0 wait days
-		if stepOrder == 1 && step.WaitDays != 0 {
-			errors = append(errors, map[string]interface{}{
-				"stepOrder": stepOrder,
-				"field":     "waitDays",
-				"message":   "First step should have 0 wait days",
-			})
-		}
+	return nil
+}
 
-		// Check wait days is non-negative
-		if step.WaitDays < 0 {
-			errors = append(errors, map[string]interface{}{
-				"stepOrder": stepOrder,
-				"field":     "waitDays",
-				"message":   "Wait days cannot be negative",
-			})
-		}
+// PurgedTemplate identifies a template removed by PurgeTrashedBefore
+type PurgedTemplate struct {
+	ID       string `bson:"_id"`
+	TenantID string `bson:"tenant_id"`
+}
+
+// PurgeTrashedBefore permanently removes templates of every tenant that were
+// trashed before cutoff. It is the one cross-tenant operation, reserved for the
+// retention sweep.
+func (r *MongoTemplateRepository) PurgeTrashedBefore(ctx context.Context, cutoff time.Time) ([]PurgedTemplate, error) {
+	filter := bson.M{"deleted_at": bson.M{"$ne": nil, "$lt": cutoff}}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "tenant_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error finding expired trashed templates: %w", err)
+	}
+	var purged []PurgedTemplate
+	if err := cursor.All(ctx, &purged); err != nil {
+		return nil, fmt.Errorf("error decoding expired trashed templates: %w", err)
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(purged))
+	for _, p := range purged {
+		ids = append(ids, p.ID)
+	}
+	// Re-check the cutoff so a template restored meanwhile is kept
+	filter["_id"] = bson.M{"$in": ids}
+	if _, err := r.collection.DeleteMany(ctx, filter); err != nil {
+		return nil, fmt.Errorf("error purging trashed templates: %w", err)
 	}
 
-	isValid := len(errors) == 0
-	return isValid, errors, nil
+	return purged, nil
 }
 
 // =============================================================================
-// Template Handler Compatibility Methods
+// Bulk Operations
 // =============================================================================
 
-// CreateTemplateCompat creates a template (no context)
-func (r *MongoTemplateRepository) CreateTemplateCompat(template *models.MongoTemplate) error {
-	return r.Create(context.Background(), template)
-}
+// GetByIDs retrieves a tenant's templates by ID in one query. IDs that do not
+// exist (or belong to another tenant) are simply absent from the result.
+func (r *MongoTemplateRepository) GetByIDs(ctx context.Context, tenantID string, ids []string) ([]*models.MongoTemplate, error) {
+	filter, err := tenantFilter(tenantID, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
 
-// GetTemplatesByTag retrieves templates by tag - returns MongoTemplate directly
-func (r *MongoTemplateRepository) GetTemplatesByTag(tag string, limit int) ([]*models.MongoTemplate, error) {
-	return r.SearchByTags(context.Background(), []string{tag}, limit, 0)
-}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error finding templates by IDs: %w", err)
+	}
+	defer cursor.Close(ctx)
 
-// ListMongo lists templates with filters - returns MongoTemplate directly (no conversion)
-func (r *MongoTemplateRepository) ListMongo(filters TemplateFilters) ([]*models.MongoTemplate, error) {
-	ctx := context.Background()
-	limit := filters.Limit
-	if limit == 0 {
-		limit = 50
+	var templates []*models.MongoTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, fmt.Errorf("error decoding templates: %w", err)
 	}
 
-	// Build MongoDB filter
-	filter := bson.M{}
+	return templates, nil
+}
 
-	// Channel filter
-	if filters.Channel != "" {
-		filter["channel"] = filters.Channel
+// GetByNames retrieves a tenant's templates with any of the given names
+func (r *MongoTemplateRepository) GetByNames(ctx context.Context, tenantID string, names []string) ([]*models.MongoTemplate, error) {
+	filter, err := tenantFilter(tenantID, bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, err
 	}
 
-	// Type filter
-	if filters.Type != "" {
-		filter["type"] = filters.Type
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error finding templates by name: %w", err)
 	}
+	defer cursor.Close(ctx)
 
-	// Category filter
-	if filters.Category != "" {
-		filter["category"] = filters.Category
+	var templates []*models.MongoTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, fmt.Errorf("error decoding templates: %w", err)
 	}
 
-	// Status filter
-	if filters.Status != "" {
-		filter["status"] = filters.Status
-	}
+	return templates, nil
+}
 
-	// ForStage filter (array contains any of the specified stages)
-	if len(filters.ForStage) > 0 {
-		filter["for_stage"] = bson.M{"$in": filters.ForStage}
+// Replace overwrites a template document within its tenant
+func (r *MongoTemplateRepository) Replace(ctx context.Context, template *models.MongoTemplate) error {
+	filter, err := tenantFilter(template.TenantID, bson.M{"_id": template.ID})
+	if err != nil {
+		return err
 	}
 
-	// Industries filter (array contains any of the specified industries)
-	if len(filters.Industries) > 0 {
-		filter["industries"] = bson.M{"$in": filters.Industries}
+	template.UpdatedAt = time.Now()
+	result, err := r.collection.ReplaceOne(ctx, filter, template)
+	if err != nil {
+		return fmt.Errorf("error replacing template: %w", err)
 	}
 
-	// ApprovalFlag filter
-	if filters.ApprovalFlag != "" {
-		filter["approval_flag"] = filters.ApprovalFlag
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrTemplateNotFound)
 	}
 
-	// ServiceID filter
-	if !uuid.IsEmptyUUID(filters.ServiceID) {
-		filter["service_id"] = filters.ServiceID
-	}
+	return nil
+}
 
-	// TenantID filter
-	if !uuid.IsEmptyUUID(filters.TenantID) {
-		filter["tenant_id"] = filters.TenantID
-	}
+// SoftDeleteMany moves a tenant's templates to the trash and returns how many were moved
+func (r *MongoTemplateRepository) SoftDeleteMany(ctx context.Context, tenantID string, ids []string, deletedBy string) (int64, error) {
+	now := time.Now()
+	return r.updateMany(ctx, tenantID, ids, bson.M{
+		"$set": bson.M{"deleted_at": now, "deleted_by": deletedBy, "updated_at": now},
+	})
+}
 
-	// CreatedBy filter
-	if !uuid.IsEmptyUUID(filters.CreatedBy) {
-		filter["created_by"] = filters.CreatedBy
-	}
+// AddTagsMany adds tags to a tenant's templates, skipping tags already present
+func (r *MongoTemplateRepository) AddTagsMany(ctx context.Context, tenantID string, ids, tags []string) (int64, error) {
+	return r.updateMany(ctx, tenantID, ids, bson.M{
+		"$addToSet": bson.M{"tags": bson.M{"$each": tags}},
+		"$set":      bson.M{"updated_at": time.Now()},
+	})
+}
 
-	// Search filter (name or body contains search term)
-	if filters.Search != "" {
-		filter["$or"] = []bson.M{
-			{"name": bson.M{"$regex": filters.Search, "$options": "i"}},
-			{"body": bson.M{"$regex": filters.Search, "$options": "i"}},
-			{"subject": bson.M{"$regex": filters.Search, "$options": "i"}},
-		}
-	}
+// RemoveTagsMany removes tags from a tenant's templates
+func (r *MongoTemplateRepository) RemoveTagsMany(ctx context.Context, tenantID string, ids, tags []string) (int64, error) {
+	return r.updateMany(ctx, tenantID, ids, bson.M{
+		"$pull": bson.M{"tags": bson.M{"$in": tags}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	})
+}
 
-	// Build sort options
-	sortField := "created_at"
-	sortOrder := -1 // Default: newest first
+// SetStatusMany sets the status of a tenant's templates. Leaving the published
+// state clears the publication stamp, as SetPublishState does.
+func (r *MongoTemplateRepository) SetStatusMany(ctx context.Context, tenantID string, ids []string, status string) (int64, error) {
+	update := bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}}
+	if status != string(models.TemplateStatusPublished) && status != string(models.TemplateStatusActive) {
+		update["$unset"] = bson.M{"published_at": "", "published_by": ""}
+	}
+	return r.updateMany(ctx, tenantID, ids, update)
+}
 
-	if filters.SortBy != "" {
-		switch filters.SortBy {
-		case "name":
-			sortField = "name"
-		case "date", "created_at", "createdAt":
-			sortField = "created_at"
-		case "updated_at", "updatedAt":
-			sortField = "updated_at"
-		case "status":
-			sortField = "status"
-		case "performance":
-			sortField = "updated_at"
-		case "usage":
-			sortField = "updated_at"
-		}
+// updateMany applies update to a tenant's templates by ID and returns the matched count
+func (r *MongoTemplateRepository) updateMany(ctx context.Context, tenantID string, ids []string, update bson.M) (int64, error) {
+	filter, err := tenantFilter(tenantID, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
 	}
 
-	if filters.SortOrder == "asc" {
-		sortOrder = 1
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error updating templates: %w", err)
 	}
 
-	// Calculate skip for pagination
-	skip := filters.Offset
-	if filters.Page > 0 {
-		skip = (filters.Page - 1) * limit
+	return result.MatchedCount, nil
+}
+
+// =============================================================================
+// Template Tags
+// =============================================================================
+//
+// Tags live only on the template documents' indexed tags array. Usage counts are
+// aggregated from it, so they can never drift from list-by-tag results.
+
+// ListTagCounts returns every tag used by a tenant's templates with its usage count,
+// most used first
+func (r *MongoTemplateRepository) ListTagCounts(ctx context.Context, tenantID string) ([]models.TemplateTagCount, error) {
+	match, err := tenantFilter(tenantID, bson.M{"tags.0": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
 	}
 
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(skip)).
-		SetSort(bson.D{{Key: sortField, Value: sortOrder}})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
 
-	cursor, err := r.collection.Find(ctx, filter, opts)
+	cursor, err := r.reports.Aggregate(ctx, pipeline)
 	if err != nil {
-		return nil, fmt.Errorf("error listing templates: %w", err)
+		return nil, fmt.Errorf("error aggregating template tags: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var templates []*models.MongoTemplate
-	if err := cursor.All(ctx, &templates); err != nil {
-		return nil, fmt.Errorf("error decoding templates: %w", err)
+	var rows []struct {
+		Name  string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding template tags: %w", err)
 	}
 
-	return templates, nil
+	tags := make([]models.TemplateTagCount, 0, len(rows))
+	for _, row := range rows {
+		tags = append(tags, models.TemplateTagCount{Name: row.Name, Count: row.Count})
+	}
+	return tags, nil
 }
 
-// ListTemplates lists templates with filters - returns MongoTemplate directly
-func (r *MongoTemplateRepository) ListTemplates(filters TemplateFilters) ([]*models.MongoTemplate, error) {
-	return r.ListMongo(filters)
-}
+// RenameTag renames a tag on every template of a tenant and returns the IDs of the
+// templates changed. Each template is rewritten by a single pipeline update, so a
+// template that already carries newName ends up with it exactly once.
+func (r *MongoTemplateRepository) RenameTag(ctx context.Context, tenantID, oldName, newName string) ([]string, error) {
+	filter, err := tenantFilter(tenantID, bson.M{"tags": oldName})
+	if err != nil {
+		return nil, err
+	}
 
-// UpdateTemplateCompat updates a template (no context)
-func (r *MongoTemplateRepository) UpdateTemplateCompat(template *models.MongoTemplate) error {
-	template.UpdatedAt = time.Now()
-	return r.Update(context.Background(), template)
-}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error finding templates with tag: %w", err)
+	}
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("error decoding template IDs: %w", err)
+	}
+	if len(docs) == 0 {
+		return []string{}, nil
+	}
 
-// GetTemplateByIDCompat retrieves a template by ID (no context)
-func (r *MongoTemplateRepository) GetTemplateByIDCompat(tenantID, templateID string) (*models.MongoTemplate, error) {
-	return r.GetByID(context.Background(), templateID)
-}
+	renamed := bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$$this", oldName}}, newName, "$$this"}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tags": bson.M{"$reduce": bson.M{
+				"input":        "$tags",
+				"initialValue": bson.A{},
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$in": bson.A{renamed, "$$value"}},
+					"$$value",
+					bson.M{"$concatArrays": bson.A{"$$value", bson.A{renamed}}},
+				}},
+			}},
+			"updated_at": time.Now(),
+		}}},
+	}
 
-// DeleteTemplateCompat deletes a template (no context) - stub
-func (r *MongoTemplateRepository) DeleteTemplateCompat(tenantID, templateID string) error {
-	return r.Delete(context.Background(), templateID)
-}
+	if _, err := r.collection.UpdateMany(ctx, filter, update); err != nil {
+		return nil, fmt.Errorf("error renaming template tag: %w", err)
+	}
 
-// RemoveTagFromTemplateCompat removes a tag from all templates - stub
-func (r *MongoTemplateRepository) RemoveTagFromTemplateCompat(tenantID string, tag string) error {
-	// Stub - would need to iterate and update templates
-	return nil
+	ids := make([]string, 0, len(docs))
+	for _, d := range docs {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
 }
@@ -0,0 +1,241 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestBuildTemplateListFilter checks the listing filters, tags and data
+// scope included, become one query, so that the total counts exactly the
+// templates that can be paged through
+func TestBuildTemplateListFilter(t *testing.T) {
+	filter, err := buildTemplateListFilter(TemplateFilters{
+		TenantID:       "acme",
+		Channel:        "email",
+		Status:         "published",
+		Tags:           []string{"vip", "onboarding"},
+		CreatedBy:      "user-1",
+		ScopeCreatedBy: []string{"user-1", "user-2"},
+		Search:         "50% off (today)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := `50% off \(today\)`
+	want := bson.M{
+		"tenant_id":  "acme",
+		"deleted_at": nil,
+		"channel":    "email",
+		"status":     "published",
+		"tags":       bson.M{"$all": []string{"vip", "onboarding"}},
+		"created_by": "user-1",
+		"$and": []bson.M{
+			{"created_by": bson.M{"$in": []string{"user-1", "user-2"}}},
+			{"$or": []bson.M{
+				{"name": bson.M{"$regex": pattern, "$options": "i"}},
+				{"description": bson.M{"$regex": pattern, "$options": "i"}},
+				{"subject": bson.M{"$regex": pattern, "$options": "i"}},
+				{"body": bson.M{"$regex": pattern, "$options": "i"}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("filter =\n%v\nwant\n%v", filter, want)
+	}
+}
+
+func TestBuildTemplateListFilterWithoutFilters(t *testing.T) {
+	filter, err := buildTemplateListFilter(TemplateFilters{TenantID: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (bson.M{"tenant_id": "acme", "deleted_at": nil}); !reflect.DeepEqual(filter, want) {
+		t.Errorf("filter = %v, want %v", filter, want)
+	}
+
+	// An empty scope, a user who may see no one's templates, still filters
+	filter, err = buildTemplateListFilter(TemplateFilters{TenantID: "acme", ScopeCreatedBy: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := filter["$and"]; !ok {
+		t.Errorf("filter = %v, want an empty scope to match nothing", filter)
+	}
+}
+
+func TestBuildTemplateListFilterNeedsATenant(t *testing.T) {
+	if _, err := buildTemplateListFilter(TemplateFilters{Tags: []string{"vip"}}); !errors.Is(err, ErrTenantRequired) {
+		t.Errorf("filter without a tenant = %v, want ErrTenantRequired", err)
+	}
+}
+
+// fullTemplate returns a template with every stored field set, so that a
+// field lost on the way to MongoDB and back shows up in a diff
+func fullTemplate() *models.MongoTemplate {
+	at := func(day int) *time.Time {
+		t := time.Date(2026, 3, day, 9, 30, 15, 250_000_000, time.UTC)
+		return &t
+	}
+	return &models.MongoTemplate{
+		ID:          "65f0c0ffee0000000000a001",
+		TenantID:    "3f2b8c1e-5d4a-4e6f-9a7b-1c2d3e4f5a6b",
+		Name:        "Spring follow-up",
+		Description: "Second touch after a demo",
+		Type:        "email",
+		Channel:     "email",
+		Status:      "published",
+		Content:     map[string]string{"subject": "Hi {{first_name}}", "body_html": "<p>Thanks for your time</p>"},
+		Subject:     "Hi {{first_name}}",
+		Body:        "Thanks for your time, {{first_name}}",
+		Variables:   []string{"first_name"},
+		VariablesSchema: []models.TemplateVariable{{
+			Name:     "first_name",
+			Type:     models.TemplateVariableString,
+			Required: true,
+			Default:  "there",
+			Example:  "Dana",
+		}},
+		CustomFields:     map[string]string{"region": "emea"},
+		Category:         "follow-up",
+		Tags:             []string{"demo", "spring"},
+		Version:          3,
+		IsSystem:         true,
+		SystemKey:        "system.2fa_otp",
+		CreatedAt:        *at(1),
+		UpdatedAt:        *at(2),
+		CreatedBy:        "user-1",
+		PublishedAt:      at(3),
+		PublishedBy:      "user-2",
+		DeletedAt:        at(4),
+		DeletedBy:        "user-3",
+		ForStage:         []string{"mql", "sql"},
+		Industries:       []string{"saas"},
+		ApprovalFlag:     "green",
+		AiEnhanced:       true,
+		ServiceID:        "service-1",
+		ApprovalStatus:   "approved",
+		Approvals:        []models.TemplateApproval{{Action: models.TemplateApprovalApprove, ActorID: "user-2", Comment: "Looks good", At: *at(5)}},
+		MetaTemplateName: "spring_follow_up",
+		MetaStatus:       "approved",
+		SubmittedDate:    at(6),
+		ExpectedApproval: at(7),
+		TemplateType:     "InMail Message",
+		KoshDocumentIds:  []string{"kosh-1", "kosh-2"},
+	}
+}
+
+// templateDocumentKeys are the bson names of a stored template. Documents
+// with these names are in production, so renaming one strands their data.
+var templateDocumentKeys = []string{
+	"_id", "tenant_id", "name", "description", "type", "channel", "status",
+	"content", "subject", "body", "variables", "variables_schema", "custom_fields",
+	"category", "tags", "version", "is_system", "system_key",
+	"created_at", "updated_at", "created_by", "published_at", "published_by",
+	"deleted_at", "deleted_by", "for_stage", "industries", "approval_flag",
+	"ai_enhanced", "service_id", "approval_status", "approvals",
+	"meta_template_name", "meta_status", "submitted_date", "expected_approval",
+	"template_type", "kosh_document_ids",
+}
+
+// templateJSONKeys are the names the frontend reads a template by
+var templateJSONKeys = []string{
+	"id", "tenantId", "name", "description", "type", "channel", "status",
+	"content", "subject", "message", "variables", "variablesSchema", "customFields",
+	"category", "tags", "version", "isSystem", "systemKey",
+	"createdAt", "updatedAt", "createdBy", "publishedAt", "publishedBy",
+	"deletedAt", "deletedBy", "usage", "forStage", "industries", "approvalFlag",
+	"aiEnhanced", "serviceId", "approvalStatus", "approvals",
+	"metaTemplateName", "metaStatus", "submittedDate", "expectedApproval",
+	"templateType", "koshDocumentIds",
+}
+
+// TestFullTemplateSetsEveryField keeps fullTemplate complete: a field added
+// to MongoTemplate fails here until the round trips below cover it
+func TestFullTemplateSetsEveryField(t *testing.T) {
+	v := reflect.ValueOf(fullTemplate()).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("bson") != "-" && v.Field(i).IsZero() {
+			t.Errorf("fullTemplate leaves %s unset", field.Name)
+		}
+	}
+}
+
+// TestTemplateRoundTripsThroughBSON stores and reloads a fully populated
+// template and checks every field survives under its production name
+func TestTemplateRoundTripsThroughBSON(t *testing.T) {
+	want := fullTemplate()
+	data, err := bson.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := slices.Sorted(maps.Keys(doc)); !slices.Equal(got, slices.Sorted(slices.Values(templateDocumentKeys))) {
+		t.Errorf("stored keys = %v, want %v", got, templateDocumentKeys)
+	}
+
+	var got models.MongoTemplate
+	if err := bson.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("reloaded template differs:\n got %+v\nwant %+v", got, *want)
+	}
+}
+
+// TestTemplateJSONNamesAreStable checks the API names of a template
+func TestTemplateJSONNamesAreStable(t *testing.T) {
+	template := fullTemplate()
+	template.Usage = &models.TemplateUsage{}
+	data, err := json.Marshal(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if got := slices.Sorted(maps.Keys(fields)); !slices.Equal(got, slices.Sorted(slices.Values(templateJSONKeys))) {
+		t.Errorf("JSON keys = %v, want %v", got, templateJSONKeys)
+	}
+}
+
+// TestEditableTemplateFieldsAreStoredFields checks an update writes only
+// names Create stores, and that every stored field is either editable or
+// one of those changed by their own methods
+func TestEditableTemplateFieldsAreStoredFields(t *testing.T) {
+	ownMethods := []string{
+		"_id", "tenant_id", "version", "is_system", "system_key",
+		"created_at", "created_by", "published_at", "published_by",
+		"deleted_at", "deleted_by", "approval_status", "approvals",
+		"meta_status", "submitted_date", "expected_approval",
+	}
+	editable := editableTemplateFields(fullTemplate())
+
+	var rest []string
+	for _, key := range templateDocumentKeys {
+		if _, ok := editable[key]; !ok {
+			rest = append(rest, key)
+		}
+	}
+	if !slices.Equal(slices.Sorted(slices.Values(rest)), slices.Sorted(slices.Values(ownMethods))) {
+		t.Errorf("stored fields an update leaves alone = %v, want %v", rest, ownMethods)
+	}
+	for key := range editable {
+		if !slices.Contains(templateDocumentKeys, key) {
+			t.Errorf("an update writes %q, which Create does not store", key)
+		}
+	}
+}
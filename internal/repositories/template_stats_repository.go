@@ -0,0 +1,247 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"github.com/white/user-management/pkg/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TemplateStatsRepository keeps per-day send counters for templates in
+// template_stats. Writes are single $inc upserts so the send path stays cheap;
+// reads aggregate the day buckets, preferring a secondary, so the latest
+// sends may not be counted yet.
+type TemplateStatsRepository struct {
+	collection *mongo.Collection
+	reports    *mongo.Collection
+}
+
+// NewTemplateStatsRepository creates a new TemplateStatsRepository
+func NewTemplateStatsRepository(client *mongodb.Client) *TemplateStatsRepository {
+	return &TemplateStatsRepository{
+		collection: client.Collection("template_stats"),
+		reports:    client.ReportingCollection("template_stats"),
+	}
+}
+
+// RecordSend counts one send of a template on the day of at, and a failure too when failed
+func (r *TemplateStatsRepository) RecordSend(ctx context.Context, tenantID, templateID string, at time.Time, failed bool) error {
+	inc := bson.M{"sends": 1}
+	if failed {
+		inc["failures"] = 1
+	}
+	return r.increment(ctx, tenantID, templateID, at, inc)
+}
+
+// RecordFailure counts a failure of a send made on the day of at
+func (r *TemplateStatsRepository) RecordFailure(ctx context.Context, tenantID, templateID string, at time.Time) error {
+	return r.increment(ctx, tenantID, templateID, at, bson.M{"failures": 1})
+}
+
+func (r *TemplateStatsRepository) increment(ctx context.Context, tenantID, templateID string, at time.Time, inc bson.M) error {
+	if uuid.IsEmptyUUID(tenantID) {
+		return ErrTenantRequired
+	}
+
+	id := models.TemplateStatsBucketID(tenantID, templateID, at)
+	update := bson.M{
+		"$inc":         inc,
+		"$max":         bson.M{"last_used_at": at},
+		"$setOnInsert": bson.M{"tenant_id": tenantID, "template_id": templateID, "day": models.TemplateStatsDay(at)},
+	}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("error updating template stats: %w", err)
+	}
+	return nil
+}
+
+// SetBucket overwrites a day bucket. Used by the backfill, which recomputes
+// whole days so it can be re-run safely.
+func (r *TemplateStatsRepository) SetBucket(ctx context.Context, bucket *models.TemplateStatsBucket) error {
+	if uuid.IsEmptyUUID(bucket.TenantID) {
+		return ErrTenantRequired
+	}
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": bucket.ID}, bucket, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error setting template stats: %w", err)
+	}
+	return nil
+}
+
+// GetStats returns a template's all-time counters and the day buckets of the last windowDays days
+func (r *TemplateStatsRepository) GetStats(ctx context.Context, tenantID, templateID string, windowDays int) (*models.TemplateStats, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, ErrTenantRequired
+	}
+
+	filter := bson.M{"tenant_id": tenantID, "template_id": templateID}
+	cursor, err := r.reports.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "day", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error finding template stats: %w", err)
+	}
+	var buckets []*models.TemplateStatsBucket
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, fmt.Errorf("error decoding template stats: %w", err)
+	}
+
+	since := windowStartDay(windowDays)
+	stats := &models.TemplateStats{
+		TemplateID: templateID,
+		WindowDays: windowDays,
+		Daily:      []*models.TemplateStatsBucket{},
+	}
+	for _, b := range buckets {
+		stats.Sends += b.Sends
+		stats.Failures += b.Failures
+		if stats.LastUsedAt == nil || b.LastUsedAt.After(*stats.LastUsedAt) {
+			lastUsed := b.LastUsedAt
+			stats.LastUsedAt = &lastUsed
+		}
+		if b.Day >= since {
+			stats.WindowSends += b.Sends
+			stats.WindowFailures += b.Failures
+			stats.Daily = append(stats.Daily, b)
+		}
+	}
+	if stats.Sends > 0 {
+		stats.FailureRate = float64(stats.Failures) / float64(stats.Sends)
+	}
+
+	return stats, nil
+}
+
+// UsageByTemplate returns the usage summary of the given templates. Templates
+// that were never sent are missing from the map.
+func (r *TemplateStatsRepository) UsageByTemplate(ctx context.Context, tenantID string, templateIDs []string) (map[string]*models.TemplateUsage, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, ErrTenantRequired
+	}
+	if len(templateIDs) == 0 {
+		return map[string]*models.TemplateUsage{}, nil
+	}
+
+	since := windowStartDay(models.TemplateStatsWindowDays)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant_id": tenantID, "template_id": bson.M{"$in": templateIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": "$template_id",
+			"sends_30d": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$gte": bson.A{"$day", since}}, "$sends", 0},
+			}},
+			"last_used_at": bson.M{"$max": "$last_used_at"},
+		}}},
+	}
+	cursor, err := r.reports.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating template usage: %w", err)
+	}
+
+	var rows []struct {
+		TemplateID string    `bson:"_id"`
+		Sends30d   int64     `bson:"sends_30d"`
+		LastUsedAt time.Time `bson:"last_used_at"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding template usage: %w", err)
+	}
+
+	usage := make(map[string]*models.TemplateUsage, len(rows))
+	for _, row := range rows {
+		lastUsed := row.LastUsedAt
+		usage[row.TemplateID] = &models.TemplateUsage{Sends30d: row.Sends30d, LastUsedAt: &lastUsed}
+	}
+	return usage, nil
+}
+
+// WindowSends returns the sends of every template of a tenant used within the stats window
+func (r *TemplateStatsRepository) WindowSends(ctx context.Context, tenantID string) (map[string]int64, error) {
+	if uuid.IsEmptyUUID(tenantID) {
+		return nil, ErrTenantRequired
+	}
+
+	since := windowStartDay(models.TemplateStatsWindowDays)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant_id": tenantID, "day": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$template_id", "sends": bson.M{"$sum": "$sends"}}}},
+	}
+	cursor, err := r.reports.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating template sends: %w", err)
+	}
+
+	var rows []struct {
+		TemplateID string `bson:"_id"`
+		Sends      int64  `bson:"sends"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding template sends: %w", err)
+	}
+
+	sends := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		sends[row.TemplateID] = row.Sends
+	}
+	return sends, nil
+}
+
+// EnsureIndexes creates the indexes used by the stats reads
+func (r *TemplateStatsRepository) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "template_id", Value: 1},
+				{Key: "day", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: 1},
+				{Key: "day", Value: 1},
+			},
+		},
+	}
+
+	return createIndexes(ctx, r.collection, indexes)
+}
+
+// windowStartDay returns the first bucket day of a window of days ending today
+func windowStartDay(days int) string {
+	return models.TemplateStatsDay(time.Now().AddDate(0, 0, -(days - 1)))
+}
+
+// performanceThresholds returns the bottom and top quartile boundaries of the
+// sends of a library of total templates, where templates missing from sends
+// have zero sends
+func performanceThresholds(sends map[string]int64, total int64) (low, high int64) {
+	values := make([]int64, 0, total)
+	for _, n := range sends {
+		values = append(values, n)
+	}
+	for int64(len(values)) < total {
+		values = append(values, 0)
+	}
+	if len(values) == 0 {
+		return 0, 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// Nearest-rank percentiles
+	rank := func(p float64) int64 {
+		i := int(math.Ceil(p*float64(len(values)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return values[i]
+	}
+	return rank(0.25), rank(0.75)
+}
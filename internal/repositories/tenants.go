@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tenantMatch is the tenant_id filter value matching the documents of
+// tenantID. Documents written before tenants were recorded carry no tenant,
+// or an empty one, and belong to the default tenant.
+func tenantMatch(tenantID string) interface{} {
+	if tenantID == models.DefaultTenantID {
+		return bson.M{"$in": bson.A{tenantID, nil, ""}}
+	}
+	return tenantID
+}
+
+// TenantMigrationResult counts the documents of one collection given their
+// tenant by MigrateTenants
+type TenantMigrationResult struct {
+	Collection string
+	Updated    int64 // tenant_id set or corrected
+	Deleted    int64 // Removed, to be rebuilt under the tenant
+}
+
+// tenantOwnedCollections are the collections whose documents belong to a
+// tenant, with the field naming the user who owns each document
+var tenantOwnedCollections = []struct {
+	Name  string
+	Owner string
+}{
+	{Name: "templates", Owner: "created_by"},
+	{Name: "communication", Owner: "user_id"},
+	{Name: "distribution_lists", Owner: "owner_id"},
+	{Name: "sequence_templates", Owner: "created_by"},
+}
+
+// tenantMigrationBatch bounds the user IDs one filter of MigrateTenants
+// lists, keeping it well under the 16MB document limit
+const tenantMigrationBatch = 10000
+
+// MigrateTenants gives every user without a tenant the default tenant, then
+// gives the documents of tenantOwnedCollections their owner's tenant. The
+// tenant of templates used to be the ID of the user who created them, and
+// is rewritten to that user's tenant. Template stats buckets kept under a
+// user ID are deleted; rebuild them with backfill-template-stats. It is safe
+// to run again.
+//
+// Each collection is migrated with one bulk write holding an update per
+// tenant, keyed on the IDs of the tenant's users.
+func MigrateTenants(ctx context.Context, client *mongodb.Client) ([]TenantMigrationResult, error) {
+	users := client.Collection("users")
+	result := TenantMigrationResult{Collection: "users"}
+	updated, err := users.UpdateMany(ctx,
+		bson.M{"tenant_id": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"$set": bson.M{"tenant_id": models.DefaultTenantID}})
+	if err != nil {
+		return nil, fmt.Errorf("error setting the tenant of users: %w", err)
+	}
+	result.Updated = updated.ModifiedCount
+	results := []TenantMigrationResult{result}
+
+	tenants, err := userTenants(ctx, users)
+	if err != nil {
+		return results, err
+	}
+	batches := tenantUserBatches(tenants)
+
+	for _, owned := range tenantOwnedCollections {
+		result := TenantMigrationResult{Collection: owned.Name}
+		writes := make([]mongo.WriteModel, 0, len(batches))
+		for _, batch := range batches {
+			writes = append(writes, mongo.NewUpdateManyModel().
+				SetFilter(bson.M{"$or": bson.A{
+					bson.M{"tenant_id": bson.M{"$in": batch.userIDs}},
+					bson.M{owned.Owner: bson.M{"$in": batch.userIDs}, "tenant_id": bson.M{"$in": bson.A{nil, ""}}},
+				}}).
+				SetUpdate(bson.M{"$set": bson.M{"tenant_id": batch.tenantID}}))
+		}
+		if len(writes) > 0 {
+			written, err := client.Collection(owned.Name).BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+			if written != nil {
+				result.Updated = written.ModifiedCount
+			}
+			if err != nil {
+				results = append(results, result)
+				return results, fmt.Errorf("error setting the tenant of %s: %w", owned.Name, err)
+			}
+		}
+		results = append(results, result)
+	}
+
+	// Bucket IDs start with the tenant, so stale buckets cannot be rewritten
+	result = TenantMigrationResult{Collection: "template_stats"}
+	for _, batch := range batches {
+		deleted, err := client.Collection("template_stats").DeleteMany(ctx, bson.M{"tenant_id": bson.M{"$in": batch.userIDs}})
+		if err != nil {
+			results = append(results, result)
+			return results, fmt.Errorf("error deleting template stats kept under a user ID: %w", err)
+		}
+		result.Deleted += deleted.DeletedCount
+	}
+	return append(results, result), nil
+}
+
+// tenantUserBatch is up to tenantMigrationBatch users of one tenant
+type tenantUserBatch struct {
+	tenantID string
+	userIDs  bson.A
+}
+
+// tenantUserBatches groups the users of tenants, a user ID to tenant map,
+// by tenant in batches of at most tenantMigrationBatch, ordered by tenant
+func tenantUserBatches(tenants map[string]string) []tenantUserBatch {
+	byTenant := map[string][]string{}
+	for userID, tenantID := range tenants {
+		byTenant[tenantID] = append(byTenant[tenantID], userID)
+	}
+	tenantIDs := make([]string, 0, len(byTenant))
+	for tenantID := range byTenant {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	var batches []tenantUserBatch
+	for _, tenantID := range tenantIDs {
+		userIDs := byTenant[tenantID]
+		sort.Strings(userIDs)
+		for start := 0; start < len(userIDs); start += tenantMigrationBatch {
+			end := min(start+tenantMigrationBatch, len(userIDs))
+			batch := tenantUserBatch{tenantID: tenantID, userIDs: make(bson.A, 0, end-start)}
+			for _, userID := range userIDs[start:end] {
+				batch.userIDs = append(batch.userIDs, userID)
+			}
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+// userTenants maps the ID of every user to their tenant
+func userTenants(ctx context.Context, users *mongo.Collection) (map[string]string, error) {
+	cursor, err := users.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1, "tenant_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error finding users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	tenants := map[string]string{}
+	for cursor.Next(ctx) {
+		var user struct {
+			ID       string `bson:"_id"`
+			TenantID string `bson:"tenant_id"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return nil, fmt.Errorf("error decoding user: %w", err)
+		}
+		tenants[user.ID] = models.TenantOf(user.TenantID)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error reading users: %w", err)
+	}
+	return tenants, nil
+}
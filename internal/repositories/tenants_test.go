@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTenantUserBatches(t *testing.T) {
+	tenants := map[string]string{}
+	for i := 0; i < tenantMigrationBatch+1; i++ {
+		tenants[fmt.Sprintf("acme-user-%05d", i)] = "acme"
+	}
+	tenants["globex-user"] = "globex"
+
+	batches := tenantUserBatches(tenants)
+	if len(batches) != 3 {
+		t.Fatalf("got %d batches, want 2 for acme and 1 for globex", len(batches))
+	}
+	want := []struct {
+		tenantID string
+		users    int
+	}{
+		{"acme", tenantMigrationBatch},
+		{"acme", 1},
+		{"globex", 1},
+	}
+	seen := map[interface{}]bool{}
+	for i, batch := range batches {
+		if batch.tenantID != want[i].tenantID || len(batch.userIDs) != want[i].users {
+			t.Errorf("batch %d = %s with %d users, want %s with %d", i, batch.tenantID, len(batch.userIDs), want[i].tenantID, want[i].users)
+		}
+		for _, userID := range batch.userIDs {
+			if seen[userID] {
+				t.Errorf("user %v is in two batches", userID)
+			}
+			seen[userID] = true
+			if tenants[userID.(string)] != batch.tenantID {
+				t.Errorf("user %v of %s is in a batch of %s", userID, tenants[userID.(string)], batch.tenantID)
+			}
+		}
+	}
+	if len(seen) != len(tenants) {
+		t.Errorf("batches hold %d users, want %d", len(seen), len(tenants))
+	}
+}
+
+func TestTenantUserBatchesNoUsers(t *testing.T) {
+	if batches := tenantUserBatches(map[string]string{}); len(batches) != 0 {
+		t.Errorf("got %d batches without users", len(batches))
+	}
+}
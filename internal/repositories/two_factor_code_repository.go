@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// twoFactorOTPRetention keeps used and expired 2FA codes briefly for support
+// before the TTL index removes them
+const twoFactorOTPRetention = time.Hour
+
+// TwoFactorCodeRepository keeps the hashed codes of sign-ins waiting for
+// their second factor, by the temp token the client was given
+type TwoFactorCodeRepository struct {
+	collection *mongo.Collection
+}
+
+// NewTwoFactorCodeRepository creates a new TwoFactorCodeRepository
+func NewTwoFactorCodeRepository(client *mongodb.Client) *TwoFactorCodeRepository {
+	return &TwoFactorCodeRepository{
+		collection: client.Collection("two_factor_otps"),
+	}
+}
+
+// EnsureIndexes creates the temp token index and the TTL index that removes
+// codes a while after they expire
+func (r *TwoFactorCodeRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, r.collection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "temp_token", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(twoFactorOTPRetention.Seconds())),
+		},
+	})
+}
+
+// CreateTwoFactorCode stores the code of a new 2FA sign-in
+func (r *TwoFactorCodeRepository) CreateTwoFactorCode(ctx context.Context, code *models.TwoFAOTP) error {
+	if _, err := r.collection.InsertOne(ctx, code); err != nil {
+		return fmt.Errorf("error saving 2FA code: %w", err)
+	}
+	return nil
+}
+
+// GetTwoFactorCode returns the unused code of a temp token. Expired codes
+// are returned too; the caller decides what to tell the user.
+func (r *TwoFactorCodeRepository) GetTwoFactorCode(ctx context.Context, tempToken string) (*models.TwoFAOTP, error) {
+	var code models.TwoFAOTP
+	err := r.collection.FindOne(ctx, bson.M{"temp_token": tempToken, "used": false}).Decode(&code)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrTwoFactorCodeNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting 2FA code: %w", err)
+	}
+	return &code, nil
+}
+
+// MarkTwoFactorCodeUsed marks an unused code as used. A code that was used
+// already returns ErrTwoFactorCodeNotFound, so it cannot sign in twice.
+func (r *TwoFactorCodeRepository) MarkTwoFactorCodeUsed(ctx context.Context, id string) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+	if err != nil {
+		return fmt.Errorf("error marking 2FA code used: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrTwoFactorCodeNotFound)
+	}
+	return nil
+}
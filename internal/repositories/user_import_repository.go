@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userImportRetention is how long import jobs and their reports are kept
+const userImportRetention = 30 * 24 * time.Hour
+
+// UserImportRepository stores user import jobs and creates the users they
+// import
+type UserImportRepository struct {
+	jobs  *mongo.Collection
+	users *mongo.Collection
+}
+
+// NewUserImportRepository creates a new UserImportRepository
+func NewUserImportRepository(client *mongodb.Client) *UserImportRepository {
+	return &UserImportRepository{
+		jobs:  client.Collection("user_import_jobs"),
+		users: client.Collection("users"),
+	}
+}
+
+// EnsureIndexes expires import jobs after userImportRetention
+func (r *UserImportRepository) EnsureIndexes(ctx context.Context) error {
+	return createIndexes(ctx, r.jobs, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(userImportRetention.Seconds())),
+	}})
+}
+
+// CreateJob stores a new import job
+func (r *UserImportRepository) CreateJob(ctx context.Context, job *models.UserImportJob) error {
+	if _, err := r.jobs.InsertOne(ctx, job); err != nil {
+		return fmt.Errorf("error creating user import: %w", err)
+	}
+	return nil
+}
+
+// SaveJob stores the progress and report of an import job
+func (r *UserImportRepository) SaveJob(ctx context.Context, job *models.UserImportJob) error {
+	if _, err := r.jobs.ReplaceOne(ctx, bson.M{"_id": job.ID}, job); err != nil {
+		return fmt.Errorf("error saving user import: %w", err)
+	}
+	return nil
+}
+
+// GetJob retrieves an import job by ID
+func (r *UserImportRepository) GetJob(ctx context.Context, id string) (*models.UserImportJob, error) {
+	var job models.UserImportJob
+	err := r.jobs.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrUserImportNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user import: %w", err)
+	}
+	return &job, nil
+}
+
+// ExistingEmails returns which of emails already belong to a user
+func (r *UserImportRepository) ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(emails) == 0 {
+		return existing, nil
+	}
+	values, err := r.users.Distinct(ctx, "email", bson.M{"email": bson.M{"$in": emails}})
+	if err != nil {
+		return nil, fmt.Errorf("error looking up existing users: %w", err)
+	}
+	for _, value := range values {
+		if email, ok := value.(string); ok {
+			existing[email] = true
+		}
+	}
+	return existing, nil
+}
+
+// InsertUsers inserts user documents unordered, so one failure does not stop
+// the rest. It returns the error of each document that was not inserted by
+// its index; a user created meanwhile with the same email fails with a
+// duplicate key error. A non-nil error means the insert failed as a whole.
+func (r *UserImportRepository) InsertUsers(ctx context.Context, users []interface{}) (map[int]error, error) {
+	failed := make(map[int]error)
+	if len(users) == 0 {
+		return failed, nil
+	}
+	_, err := r.users.InsertMany(ctx, users, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return failed, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		return nil, fmt.Errorf("error creating users: %w", err)
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if mongo.IsDuplicateKeyError(writeErr) {
+			failed[writeErr.Index] = ErrDuplicateKey
+			continue
+		}
+		failed[writeErr.Index] = errors.New(writeErr.Message)
+	}
+	return failed, nil
+}
@@ -2,10 +2,13 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
 	"github.com/white/user-management/pkg/mongodb"
 	"github.com/white/user-management/pkg/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,17 +19,21 @@ import (
 type MongoUserRepository struct {
 	client     *mongodb.Client
 	collection *mongo.Collection
+	// reports serves listings and statistics that tolerate replication lag;
+	// anything read back right after a write uses collection
+	reports *mongo.Collection
 }
 
 func NewMongoUserRepository(client *mongodb.Client) *MongoUserRepository {
 	return &MongoUserRepository{
 		client:     client,
 		collection: client.Collection("users"),
+		reports:    client.ReportingCollection("users"),
 	}
 }
 
-func (r *MongoUserRepository) GetByID(ctx context.Context, id string) (*models.MongoUser, error) {
-	var user models.MongoUser
+func (r *MongoUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
 
 	filter := bson.M{"_id": id}
 	err := r.collection.FindOne(ctx, filter).Decode(&user)
@@ -37,9 +44,30 @@ func (r *MongoUserRepository) GetByID(ctx context.Context, id string) (*models.M
 	return &user, nil
 }
 
+// GetUsersByIDs retrieves the users with the given IDs in one query. IDs
+// without a user are left out. Password hashes and OTP fields are not read.
+func (r *MongoUserRepository) GetUsersByIDs(ctx context.Context, ids []string) ([]*models.User, error) {
+	users := []*models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{"password_hash": 0, "otp_hash": 0, "otp_expires_at": 0})
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error getting users by IDs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+	return users, nil
+}
+
 // GetByEmail retrieves a user by their email address
-func (r *MongoUserRepository) GetByEmail(ctx context.Context, email string) (*models.MongoUser, error) {
-	var user models.MongoUser
+func (r *MongoUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
 
 	filter := bson.M{"email": email}
 	err := r.collection.FindOne(ctx, filter).Decode(&user)
@@ -53,12 +81,14 @@ func (r *MongoUserRepository) GetByEmail(ctx context.Context, email string) (*mo
 	return &user, nil
 }
 
-// Create inserts a new user document
-func (r *MongoUserRepository) Create(ctx context.Context, user *models.MongoUser) error {
+// Create inserts a new user document. A user created without a tenant
+// joins the default tenant.
+func (r *MongoUserRepository) Create(ctx context.Context, user *models.User) error {
 	now := time.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
 	user.ID = uuid.MustNewUUID()
+	user.TenantID = user.Tenant()
 	_, err := r.collection.InsertOne(ctx, user)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
@@ -69,23 +99,76 @@ func (r *MongoUserRepository) Create(ctx context.Context, user *models.MongoUser
 	return nil
 }
 
+// GetByInviteToken retrieves the invited user holding a signup token,
+// expired or not
+func (r *MongoUserRepository) GetByInviteToken(ctx context.Context, token string) (*models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, bson.M{"invite_token": token, "status": "invited"}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, WrapNotFound(err, ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("error finding user by invite token: %w", err)
+	}
+	return &user, nil
+}
+
+// AcceptInvitation activates the invited user holding token with a password
+// and, when set, a phone number, and spends the token. An expired
+// invitation returns ErrInvitationExpired. The update matches the token, so
+// of two signups with the same token only one succeeds.
+func (r *MongoUserRepository) AcceptInvitation(ctx context.Context, token, passwordHash, phone string, at time.Time) (*models.User, error) {
+	user, err := r.GetByInviteToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user.InviteExpiry != nil && at.After(*user.InviteExpiry) {
+		return nil, ErrInvitationExpired
+	}
+
+	set := bson.M{
+		"password_hash": passwordHash,
+		"status":        "active",
+		"is_active":     true, // Required for login authentication check
+		"updated_at":    at,
+		"activated_at":  at,
+	}
+	if phone != "" {
+		set["phone"] = phone
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "invite_token": token},
+		bson.M{"$set": set, "$unset": bson.M{"invite_token": "", "invite_expires_at": ""}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error accepting invitation: %w", err)
+	}
+	if result.ModifiedCount == 0 {
+		return nil, WrapNotFound(mongo.ErrNoDocuments, ErrUserNotFound)
+	}
+	return user, nil
+}
+
 // Update modifies an existing user document
-func (r *MongoUserRepository) Update(ctx context.Context, user *models.MongoUser) error {
+func (r *MongoUserRepository) Update(ctx context.Context, user *models.User) error {
 	// Update timestamp
 	user.UpdatedAt = time.Now()
 
 	filter := bson.M{"_id": user.ID}
 	update := bson.M{
 		"$set": bson.M{
-			"email":          user.Email,
-			"name":           user.Name,
-			"role":           user.Role,
-			"region":         user.Region,
-			"team":           user.Team,
-			"permissions":    user.Permissions,
-			"preferences":    user.Preferences,
-			"emailSignature": user.EmailSignature,
-			"updated_at":     user.UpdatedAt,
+			"email":           user.Email,
+			"name":            user.Name,
+			"role":            user.Role,
+			"region":          user.Region,
+			"team":            user.Team,
+			"job_title":       user.JobTitle,
+			"phone":           user.Phone,
+			"manager_id":      user.ManagerID,
+			"permissions":     user.Permissions,
+			"preferences":     user.Preferences,
+			"email_signature": user.EmailSignature,
+			"updated_at":      user.UpdatedAt,
 		},
 	}
 
@@ -101,15 +184,69 @@ func (r *MongoUserRepository) Update(ctx context.Context, user *models.MongoUser
 	return nil
 }
 
-// UpdatePassword updates the user's password hash
+// UpdateDataScope sets the user's data scope override and returns the user
+// updated. A nil scope removes the override.
+func (r *MongoUserRepository) UpdateDataScope(ctx context.Context, id string, scope *models.DataScope) (*models.User, error) {
+	update := bson.M{"$set": bson.M{"data_scope": scope, "updated_at": time.Now()}}
+	if scope == nil {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"data_scope": ""}}
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"password_hash": 0, "otp_hash": 0, "otp_expires_at": 0})
+	var user models.User
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating user data scope: %w", err)
+	}
+	return &user, nil
+}
+
+// UpdateRoleIDs sets the custom roles the user holds and returns the user
+// without credentials. An empty list removes them all.
+func (r *MongoUserRepository) UpdateRoleIDs(ctx context.Context, id string, roleIDs []string) (*models.User, error) {
+	update := bson.M{"$set": bson.M{"role_ids": roleIDs, "updated_at": time.Now()}}
+	if len(roleIDs) == 0 {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"role_ids": ""}}
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"password_hash": 0, "otp_hash": 0, "otp_expires_at": 0})
+	var user models.User
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating user roles: %w", err)
+	}
+	return &user, nil
+}
+
+// UpdatePassword updates the user's password hash and lifts a required
+// password reset. The hash replaced goes to the front of the password
+// history, which keeps the last models.MaxPasswordHistory.
 func (r *MongoUserRepository) UpdatePassword(ctx context.Context, id string, passwordHash string) error {
-	filter := bson.M{"_id": id}
-	update := bson.M{
+	history := bson.M{"$ifNull": bson.A{"$password_history", bson.A{}}}
+	update := bson.A{bson.M{
 		"$set": bson.M{
-			"password_hash": passwordHash,
+			// Expressions read the document before the update, so this is the hash replaced
+			"password_history": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$password_hash", ""}},
+				bson.M{"$slice": bson.A{bson.M{"$concatArrays": bson.A{bson.A{"$password_hash"}, history}}, models.MaxPasswordHistory}},
+				history,
+			}},
+			// Hashes start with $, which would otherwise read as a field path
+			"password_hash":       bson.M{"$literal": passwordHash},
+			"must_reset_password": false, // A chosen password replaces a one-time one
 		},
-	}
-	result, err := r.collection.UpdateOne(ctx, filter, update)
+	}}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		return fmt.Errorf("error updating password %w", err)
 	}
@@ -119,6 +256,19 @@ func (r *MongoUserRepository) UpdatePassword(ctx context.Context, id string, pas
 	return nil
 }
 
+// ReplacePasswordHash rewrites the hash of the user's current password, as
+// when it is rehashed at a new cost, leaving the password history as it is
+func (r *MongoUserRepository) ReplacePasswordHash(ctx context.Context, id string, passwordHash string) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"password_hash": passwordHash}})
+	if err != nil {
+		return fmt.Errorf("error replacing password hash: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrUserNotFound)
+	}
+	return nil
+}
+
 // SetOTP sets the OTP hash and expiry time for password reset
 func (r *MongoUserRepository) SetOTP(ctx context.Context, userID string, otpHash string, expiresAt time.Time) error {
 	filter := bson.M{"_id": userID}
@@ -166,7 +316,7 @@ func (r *MongoUserRepository) ClearOTP(ctx context.Context, userID string) error
 }
 
 // ListByRegion retrieves users in a specific region with pagination
-func (r *MongoUserRepository) ListByRegion(ctx context.Context, region string, limit, offset int) ([]*models.MongoUser, error) {
+func (r *MongoUserRepository) ListByRegion(ctx context.Context, region string, limit, offset int) ([]*models.User, error) {
 	filter := bson.M{"region": region}
 
 	opts := options.Find().
@@ -180,7 +330,7 @@ func (r *MongoUserRepository) ListByRegion(ctx context.Context, region string, l
 	}
 	defer cursor.Close(ctx)
 
-	var users []*models.MongoUser
+	var users []*models.User
 	if err := cursor.All(ctx, &users); err != nil {
 		return nil, fmt.Errorf("error decoding users: %w", err)
 	}
@@ -189,7 +339,7 @@ func (r *MongoUserRepository) ListByRegion(ctx context.Context, region string, l
 }
 
 // ListByRole retrieves users with a specific role with pagination
-func (r *MongoUserRepository) ListByRole(ctx context.Context, role models.UserRole, limit, offset int) ([]*models.MongoUser, error) {
+func (r *MongoUserRepository) ListByRole(ctx context.Context, role models.UserRole, limit, offset int) ([]*models.User, error) {
 	filter := bson.M{"role": role}
 
 	opts := options.Find().
@@ -203,7 +353,7 @@ func (r *MongoUserRepository) ListByRole(ctx context.Context, role models.UserRo
 	}
 	defer cursor.Close(ctx)
 
-	var users []*models.MongoUser
+	var users []*models.User
 	if err := cursor.All(ctx, &users); err != nil {
 		return nil, fmt.Errorf("error decoding users: %w", err)
 	}
@@ -212,7 +362,7 @@ func (r *MongoUserRepository) ListByRole(ctx context.Context, role models.UserRo
 }
 
 // ListByTeam retrieves users in a specific team with pagination
-func (r *MongoUserRepository) ListByTeam(ctx context.Context, team string, limit, offset int) ([]*models.MongoUser, error) {
+func (r *MongoUserRepository) ListByTeam(ctx context.Context, team string, limit, offset int) ([]*models.User, error) {
 	filter := bson.M{"team": team}
 
 	opts := options.Find().
@@ -226,7 +376,25 @@ func (r *MongoUserRepository) ListByTeam(ctx context.Context, team string, limit
 	}
 	defer cursor.Close(ctx)
 
-	var users []*models.MongoUser
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+
+	return users, nil
+}
+
+// ListDirectReports retrieves the users whose manager is managerID, sorted
+// by name
+func (r *MongoUserRepository) ListDirectReports(ctx context.Context, managerID string) ([]*models.User, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"manager_id": managerID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing direct reports: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []*models.User{}
 	if err := cursor.All(ctx, &users); err != nil {
 		return nil, fmt.Errorf("error decoding users: %w", err)
 	}
@@ -286,12 +454,31 @@ func (r *MongoUserRepository) UpdateLastLogin(ctx context.Context, userID string
 	return nil
 }
 
+// UpdateLastSeen records that userID made a request at at. The write is
+// skipped when the user was seen less than interval before, so instances
+// that all let a request through still write a busy user about once per
+// interval. It leaves updated_at alone: being seen is not an edit.
+func (r *MongoUserRepository) UpdateLastSeen(ctx context.Context, userID string, at time.Time, interval time.Duration) error {
+	filter := bson.M{
+		"_id": userID,
+		"$or": bson.A{
+			bson.M{"last_seen_at": bson.M{"$lte": at.Add(-interval)}},
+			bson.M{"last_seen_at": bson.M{"$exists": false}},
+		},
+	}
+	if _, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_seen_at": at}}); err != nil {
+		return fmt.Errorf("error updating last seen: %w", err)
+	}
+	return nil
+}
+
 // ActivateUser activates a user account
 func (r *MongoUserRepository) ActivateUser(ctx context.Context, userID string) error {
 	filter := bson.M{"_id": userID}
 	update := bson.M{
 		"$set": bson.M{
-			"isActive":   true,
+			"is_active":  true,
+			"status":     "active",
 			"updated_at": time.Now(),
 		},
 	}
@@ -313,7 +500,8 @@ func (r *MongoUserRepository) DeactivateUser(ctx context.Context, userID string)
 	filter := bson.M{"_id": userID}
 	update := bson.M{
 		"$set": bson.M{
-			"isActive":   false,
+			"is_active":  false,
+			"status":     "inactive",
 			"updated_at": time.Now(),
 		},
 	}
@@ -330,20 +518,88 @@ func (r *MongoUserRepository) DeactivateUser(ctx context.Context, userID string)
 	return nil
 }
 
-// GetAllUsers retrieves all users with pagination (from UserManagementRepository)
-func (r *MongoUserRepository) GetAllUsers(ctx context.Context, limit, offset int) ([]*models.MongoUser, error) {
+// CountActiveAdmins counts the active users holding the admin role
+func (r *MongoUserRepository) CountActiveAdmins(ctx context.Context) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"role": models.UserRoleAdmin, "is_active": true})
+	if err != nil {
+		return 0, fmt.Errorf("error counting admins: %w", err)
+	}
+	return count, nil
+}
+
+// CountAdmins counts the users, active or not, holding the admin role or
+// one of adminRoleIDs. Anonymized accounts are left out; they can never
+// sign in again.
+func (r *MongoUserRepository) CountAdmins(ctx context.Context, adminRoleIDs []string) (int64, error) {
+	holders := bson.A{bson.M{"role": models.UserRoleAdmin}}
+	if len(adminRoleIDs) > 0 {
+		holders = append(holders, bson.M{"role_ids": bson.M{"$in": adminRoleIDs}})
+	}
+	count, err := r.collection.CountDocuments(ctx, bson.M{"$or": holders, "status": bson.M{"$ne": UserStatusDeleted}})
+	if err != nil {
+		return 0, fmt.Errorf("error counting admins: %w", err)
+	}
+	return count, nil
+}
+
+// AnonymizeUser removes everything identifying a user from their account,
+// which stays behind deactivated with status deleted so records pointing at
+// it still resolve. Their sessions are revoked and reset tokens removed.
+func (r *MongoUserRepository) AnonymizeUser(ctx context.Context, userID string, at time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"email":         "deleted-" + userID + "@deleted.invalid", // Unique like the address it replaces
+			"name":          "Deleted user",
+			"password_hash": "",
+			"is_active":     false,
+			"status":        UserStatusDeleted,
+			"updated_at":    at,
+		},
+		"$unset": bson.M{
+			"preferences":       "",
+			"email_signature":   "",
+			"permissions":       "",
+			"role_ids":          "",
+			"data_scope":        "",
+			"otp_hash":          "",
+			"otp_expires_at":    "",
+			"password_history":  "",
+			"invite_token":      "",
+			"invite_expires_at": "",
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("error anonymizing user: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrUserNotFound)
+	}
+
+	if _, err := r.RevokeUserSessions(ctx, userID, at); err != nil {
+		return err
+	}
+	if _, err := r.client.Collection("password_resets").DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return fmt.Errorf("error removing password resets: %w", err)
+	}
+	return nil
+}
+
+// GetAllUsers retrieves all users with pagination (from UserManagementRepository).
+// It may read a secondary, so a user created a moment ago can be missing.
+func (r *MongoUserRepository) GetAllUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	opts := options.Find().
 		SetLimit(int64(limit)).
 		SetSkip(int64(offset)).
 		SetSort(bson.D{{Key: "created_at", Value: -1}})
 
-	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := r.reports.Find(ctx, bson.M{}, opts)
 	if err != nil {
 		return nil, fmt.Errorf("error listing all users: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var users []*models.MongoUser
+	var users []*models.User
 	if err := cursor.All(ctx, &users); err != nil {
 		return nil, fmt.Errorf("error decoding users: %w", err)
 	}
@@ -352,12 +608,12 @@ func (r *MongoUserRepository) GetAllUsers(ctx context.Context, limit, offset int
 }
 
 // GetUsersByRole retrieves users by role (from UserManagementRepository)
-func (r *MongoUserRepository) GetUsersByRole(ctx context.Context, role models.UserRole, limit, offset int) ([]*models.MongoUser, error) {
+func (r *MongoUserRepository) GetUsersByRole(ctx context.Context, role models.UserRole, limit, offset int) ([]*models.User, error) {
 	return r.ListByRole(ctx, role, limit, offset)
 }
 
 // GetUsersByTeam retrieves users by team (from UserManagementRepository)
-func (r *MongoUserRepository) GetUsersByTeam(ctx context.Context, team string, limit, offset int) ([]*models.MongoUser, error) {
+func (r *MongoUserRepository) GetUsersByTeam(ctx context.Context, team string, limit, offset int) ([]*models.User, error) {
 	return r.ListByTeam(ctx, team, limit, offset)
 }
 
@@ -384,9 +640,10 @@ func (r *MongoUserRepository) UpdateUserProfile(ctx context.Context, userID stri
 	return nil
 }
 
-// EnsureIndexes creates the required indexes for the users collection
+// EnsureIndexes creates the required indexes for the users collection and
+// the session, password reset and activity log collections kept alongside it
 func (r *MongoUserRepository) EnsureIndexes(ctx context.Context) error {
-	indexes := []mongo.IndexModel{
+	userIndexes := []mongo.IndexModel{
 		{
 			Keys:    bson.D{{Key: "email", Value: 1}},
 			Options: options.Index().SetUnique(true),
@@ -401,42 +658,97 @@ func (r *MongoUserRepository) EnsureIndexes(ctx context.Context) error {
 			Keys: bson.D{{Key: "team", Value: 1}},
 		},
 		{
-			Keys: bson.D{{Key: "isActive", Value: 1}},
+			Keys: bson.D{{Key: "is_active", Value: 1}},
+		},
+		{
+			// Direct reports
+			Keys:    bson.D{{Key: "manager_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			// Users active in the last day, for the dashboard statistics
+			Keys:    bson.D{{Key: "last_seen_at", Value: -1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			// Admin user listing, newest first and by creation date range
+			Keys: bson.D{{Key: "created_at", Value: -1}},
+		},
+		{
+			// Dashboard login counts
+			Keys: bson.D{{Key: "last_login_at", Value: -1}},
+		},
+		{
+			// Pending invitations
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "invite_expires_at", Value: 1},
+			},
+		},
+		{
+			// Invitation acceptance
+			Keys:    bson.D{{Key: "invite_token", Value: 1}},
+			Options: options.Index().SetSparse(true),
 		},
 	}
+	userErr := createIndexes(ctx, r.collection, userIndexes)
 
-	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
-	if err != nil {
-		return fmt.Errorf("error creating indexes: %w", err)
+	sessionIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "refresh_token", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Active sessions of a user
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "expires_at", Value: 1},
+			},
+		},
+		{
+			// Activity of a session, recorded by the access tokens issued for it
+			Keys: bson.D{{Key: "token_id", Value: 1}},
+		},
+		{
+			// Devices a user has signed in from
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "user_agent", Value: 1},
+			},
+		},
 	}
+	sessionErr := createIndexes(ctx, r.client.Collection("sessions"), sessionIndexes)
 
-	return nil
+	resetIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "reset_token", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Reset tokens are useless once expired
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	resetErr := createIndexes(ctx, r.client.Collection("password_resets"), resetIndexes)
+
+	activityIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "created_at", Value: -1},
+			},
+		},
+	}
+	activityErr := createIndexes(ctx, r.client.Collection("user_activity_logs"), activityIndexes)
+
+	return errors.Join(userErr, sessionErr, resetErr, activityErr)
 }
 
 // ============================================================================
 // SERVICE LAYER COMPATIBILITY METHODS
 // ============================================================================
 
-// GetByIDCompat retrieves a user by ID (service layer compatibility - returns models.User)
-func (r *MongoUserRepository) GetByIDCompat(id string) (*models.User, error) {
-	ctx := context.Background()
-	mongoUser, err := r.GetByID(ctx, id)
-	if err != nil {
-		return nil, err
-	}
-	return mongoUser.ToUser(), nil
-}
-
-// GetByEmailCompat retrieves a user by email (service layer compatibility - returns models.User)
-func (r *MongoUserRepository) GetByEmailCompat(email string) (*models.User, error) {
-	ctx := context.Background()
-	mongoUser, err := r.GetByEmail(ctx, email)
-	if err != nil {
-		return nil, err
-	}
-	return mongoUser.ToUser(), nil
-}
-
 // UpdateLastLoginCompat updates the last login timestamp (service layer compatibility)
 func (r *MongoUserRepository) UpdateLastLoginCompat(userID string, loginTime time.Time) error {
 	ctx := context.Background()
@@ -469,9 +781,21 @@ func (r *MongoUserRepository) CreateSessionCompat(session models.Session) error
 	return r.CreateSession(ctx, &session)
 }
 
+// HasDeviceSession reports whether the user has a session, current or past,
+// from userAgent
+func (r *MongoUserRepository) HasDeviceSession(ctx context.Context, userID, userAgent string) (bool, error) {
+	count, err := r.client.Collection("sessions").CountDocuments(ctx,
+		bson.M{"user_id": userID, "user_agent": userAgent},
+		options.Count().SetLimit(1),
+	)
+	if err != nil {
+		return false, fmt.Errorf("error checking sessions: %w", err)
+	}
+	return count > 0, nil
+}
+
 // GetByRefreshToken retrieves a session by refresh token
-func (r *MongoUserRepository) GetByRefreshToken(refreshToken string) (*models.Session, error) {
-	ctx := context.Background()
+func (r *MongoUserRepository) GetByRefreshToken(ctx context.Context, refreshToken string) (*models.Session, error) {
 	collection := r.client.Collection("sessions")
 	var session models.Session
 
@@ -489,9 +813,69 @@ func (r *MongoUserRepository) GetByRefreshToken(refreshToken string) (*models.Se
 	return &session, nil
 }
 
+// ReplaceRefreshToken swaps the refresh token of the session holding
+// refreshToken for replacement
+func (r *MongoUserRepository) ReplaceRefreshToken(ctx context.Context, refreshToken, replacement string) error {
+	result, err := r.client.Collection("sessions").UpdateOne(ctx,
+		bson.M{"refresh_token": refreshToken},
+		bson.M{"$set": bson.M{"refresh_token": replacement}},
+	)
+	if err != nil {
+		return fmt.Errorf("error replacing refresh token: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, fmt.Errorf("session not found"))
+	}
+	return nil
+}
+
+// TouchSession records activity on the session tokenID at at. The write is
+// skipped when activity was recorded less than interval ago, so a busy
+// session is written at most once per interval, and when the session has
+// already timed out after idle, so activity cannot revive it. An idle of
+// zero or less disables the timeout.
+func (r *MongoUserRepository) TouchSession(ctx context.Context, tokenID string, at time.Time, interval, idle time.Duration) error {
+	lastActive := bson.M{"$lte": at.Add(-interval)}
+	if idle > 0 {
+		lastActive["$gt"] = at.Add(-idle)
+	}
+	filter := bson.M{
+		"token_id":   tokenID,
+		"is_revoked": bson.M{"$ne": true},
+		"expires_at": bson.M{"$gt": at},
+		"$or": bson.A{
+			bson.M{"last_activity_at": lastActive},
+			// Sessions created before activity was recorded
+			bson.M{"last_activity_at": bson.M{"$exists": false}, "issued_at": lastActive},
+		},
+	}
+	if _, err := r.client.Collection("sessions").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_activity_at": at}}); err != nil {
+		return fmt.Errorf("error recording session activity: %w", err)
+	}
+	return nil
+}
+
+// ListUserSessions returns the sessions of a user that are not revoked and
+// not past their absolute expiry at now, most recently issued first
+func (r *MongoUserRepository) ListUserSessions(ctx context.Context, userID string, now time.Time) ([]*models.Session, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"is_revoked": bson.M{"$ne": true},
+		"expires_at": bson.M{"$gt": now},
+	}
+	cursor, err := r.client.Collection("sessions").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "issued_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	sessions := []*models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("error decoding sessions: %w", err)
+	}
+	return sessions, nil
+}
+
 // Revoke revokes a session by marking it as revoked
-func (r *MongoUserRepository) Revoke(refreshToken string) error {
-	ctx := context.Background()
+func (r *MongoUserRepository) Revoke(ctx context.Context, refreshToken string) error {
 	collection := r.client.Collection("sessions")
 
 	filter := bson.M{"refresh_token": refreshToken}
@@ -534,9 +918,13 @@ func (r *MongoUserRepository) CreateReset(reset models.PasswordReset) error {
 	return r.CreatePasswordReset(ctx, &reset)
 }
 
-// GetByToken retrieves a password reset by token
+// GetByToken retrieves a password reset by token (service layer compatibility - no context)
 func (r *MongoUserRepository) GetByToken(token string) (*models.PasswordReset, error) {
-	ctx := context.Background()
+	return r.GetPasswordReset(context.Background(), token)
+}
+
+// GetPasswordReset retrieves a password reset by token
+func (r *MongoUserRepository) GetPasswordReset(ctx context.Context, token string) (*models.PasswordReset, error) {
 	collection := r.client.Collection("password_resets")
 
 	var reset models.PasswordReset
@@ -554,12 +942,17 @@ func (r *MongoUserRepository) GetByToken(token string) (*models.PasswordReset, e
 	return &reset, nil
 }
 
-// MarkAsUsed marks a password reset token as used
+// MarkAsUsed marks a password reset token as used (service layer compatibility - no context)
 func (r *MongoUserRepository) MarkAsUsed(resetToken string) error {
-	ctx := context.Background()
+	return r.MarkPasswordResetUsed(context.Background(), resetToken)
+}
+
+// MarkPasswordResetUsed marks an unused password reset token as used. A
+// token already used is reported as not found.
+func (r *MongoUserRepository) MarkPasswordResetUsed(ctx context.Context, resetToken string) error {
 	collection := r.client.Collection("password_resets")
 
-	filter := bson.M{"reset_token": resetToken}
+	filter := bson.M{"reset_token": resetToken, "is_used": false}
 	update := bson.M{
 		"$set": bson.M{
 			"is_used": true,
@@ -582,86 +975,6 @@ func (r *MongoUserRepository) MarkAsUsed(resetToken string) error {
 // USER MANAGEMENT SERVICE LAYER COMPATIBILITY METHODS
 // =============================================================================
 
-// GetAllUsersCompat retrieves all users with a limit (service layer compatibility)
-func (r *MongoUserRepository) GetAllUsersCompat(limit int) ([]*models.User, error) {
-	ctx := context.Background()
-	mongoUsers, err := r.GetAllUsers(ctx, limit, 0)
-	if err != nil {
-		return nil, err
-	}
-	// Convert MongoUser to User
-	users := make([]*models.User, len(mongoUsers))
-	for i, mu := range mongoUsers {
-		users[i] = mu.ToUser()
-	}
-	return users, nil
-}
-
-// GetUsersByTeamCompat retrieves users by team (service layer compatibility)
-func (r *MongoUserRepository) GetUsersByTeamCompat(team string, limit int) ([]*models.User, error) {
-	ctx := context.Background()
-	collection := r.client.Collection("users")
-
-	filter := bson.M{"team": team}
-	opts := options.Find().SetLimit(int64(limit))
-
-	cursor, err := collection.Find(ctx, filter, opts)
-	if err != nil {
-		return nil, fmt.Errorf("error finding users by team: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var mongoUsers []*models.MongoUser
-	if err := cursor.All(ctx, &mongoUsers); err != nil {
-		return nil, fmt.Errorf("error decoding users: %w", err)
-	}
-
-	// Convert to User
-	users := make([]*models.User, len(mongoUsers))
-	for i, mu := range mongoUsers {
-		users[i] = mu.ToUser()
-	}
-	return users, nil
-}
-
-// CreateCompat creates a user (service layer compatibility)
-func (r *MongoUserRepository) CreateCompat(user *models.User) error {
-	ctx := context.Background()
-	// Convert User to MongoUser for storage
-	mongoUser := &models.MongoUser{
-		ID:           user.ID,
-		Email:        user.Email,
-		PasswordHash: user.PasswordHash,
-		Name:         user.Name,
-		Role:         models.UserRole(user.Role), // Convert string to UserRole
-		Region:       user.Region,
-		Team:         user.Team,
-		Permissions:  user.Permissions,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-	}
-	return r.Create(ctx, mongoUser)
-}
-
-// UpdateCompat updates a user (service layer compatibility)
-func (r *MongoUserRepository) UpdateCompat(user *models.User) error {
-	ctx := context.Background()
-	// Convert User to MongoUser for storage
-	mongoUser := &models.MongoUser{
-		ID:           user.ID,
-		Email:        user.Email,
-		PasswordHash: user.PasswordHash,
-		Name:         user.Name,
-		Role:         models.UserRole(user.Role), // Convert string to UserRole
-		Region:       user.Region,
-		Team:         user.Team,
-		Permissions:  user.Permissions,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-	}
-	return r.Update(ctx, mongoUser)
-}
-
 // LogActivity logs user activity (service layer compatibility)
 func (r *MongoUserRepository) LogActivity(activity *models.UserActivityLog) error {
 	ctx := context.Background()
@@ -777,6 +1090,19 @@ func (r *MongoUserRepository) TerminateSession(sessionID string) error {
 	return nil
 }
 
+// RevokeUserSessions revokes every session of a user that is not revoked
+// yet and returns how many were
+func (r *MongoUserRepository) RevokeUserSessions(ctx context.Context, userID string, at time.Time) (int64, error) {
+	result, err := r.client.Collection("sessions").UpdateMany(ctx,
+		bson.M{"user_id": userID, "is_revoked": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"is_revoked": true, "revoked_at": at}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
 // RefreshSession refreshes a session with new expiry time
 func (r *MongoUserRepository) RefreshSession(sessionID string, newExpiry time.Time) error {
 	ctx := context.Background()
@@ -799,63 +1125,158 @@ func (r *MongoUserRepository) RefreshSession(sessionID string, newExpiry time.Ti
 }
 
 // ListUsers lists all users with pagination - stub for handler compatibility
-func (r *MongoUserRepository) ListUsers(limit, offset int) ([]*models.MongoUser, error) {
+func (r *MongoUserRepository) ListUsers(limit, offset int) ([]*models.User, error) {
 	ctx := context.Background()
 	return r.GetAllUsers(ctx, limit, offset)
 }
 
-// GetByIDForHandler gets a user by ID (no context) - returns MongoUser
-func (r *MongoUserRepository) GetByIDForHandler(id string) (*models.MongoUser, error) {
+// GetByIDForHandler gets a user by ID (no context)
+func (r *MongoUserRepository) GetByIDForHandler(id string) (*models.User, error) {
 	return r.GetByID(context.Background(), id)
 }
 
 // GetByEmailForHandler gets a user by email (no context)
-func (r *MongoUserRepository) GetByEmailForHandler(email string) (*models.MongoUser, error) {
+func (r *MongoUserRepository) GetByEmailForHandler(email string) (*models.User, error) {
 	return r.GetByEmail(context.Background(), email)
 }
 
 // CreateForHandler creates a user (no context)
-func (r *MongoUserRepository) CreateForHandler(user *models.MongoUser) error {
+func (r *MongoUserRepository) CreateForHandler(user *models.User) error {
 	return r.Create(context.Background(), user)
 }
 
 // UpdateForHandler updates a user (no context)
-func (r *MongoUserRepository) UpdateForHandler(user *models.MongoUser) error {
+func (r *MongoUserRepository) UpdateForHandler(user *models.User) error {
 	return r.Update(context.Background(), user)
 }
 
-// ListUsersFiltered lists users with filters (handler compatibility)
-func (r *MongoUserRepository) ListUsersFiltered(role, region string, isActive *bool, limit, offset int) ([]*models.MongoUser, error) {
-	ctx := context.Background()
-	filter := bson.M{}
+// ListUsersFiltered lists users matching filters, along with the number of
+// matches ignoring pagination. Password hashes and OTP fields are not read.
+func (r *MongoUserRepository) ListUsersFiltered(ctx context.Context, filters UserFilters) ([]*models.User, int64, error) {
+	filter := buildUserListFilter(filters)
 
-	if role != "" {
-		filter["role"] = role
+	cursor, err := r.collection.Find(ctx, userListPageFilter(filter, filters), userListOptions(filters))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing users: %w", err)
 	}
-	if region != "" {
-		filter["region"] = region
+	defer cursor.Close(ctx)
+
+	users := []*models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, fmt.Errorf("error decoding users: %w", err)
 	}
-	if isActive != nil {
-		filter["is_active"] = *isActive
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting users: %w", err)
 	}
 
-	opts := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "created_at", Value: -1}})
+	return users, total, nil
+}
 
-	cursor, err := r.collection.Find(ctx, filter, opts)
+// EachUserFiltered calls fn for every user matching filters in listing order,
+// stopping at the first error. Users are decoded one at a time, so exporting
+// every user does not hold them all in memory. Exports read a secondary when
+// one is available.
+func (r *MongoUserRepository) EachUserFiltered(ctx context.Context, filters UserFilters, fn func(user *models.User) error) error {
+	cursor, err := r.reports.Find(ctx, userListPageFilter(buildUserListFilter(filters), filters), userListOptions(filters))
 	if err != nil {
-		return nil, fmt.Errorf("error listing users: %w", err)
+		return fmt.Errorf("error listing users: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var users []*models.MongoUser
-	if err := cursor.All(ctx, &users); err != nil {
-		return nil, fmt.Errorf("error decoding users: %w", err)
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return fmt.Errorf("error decoding user: %w", err)
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
 	}
+	return cursor.Err()
+}
 
-	return users, nil
+// buildUserListFilter translates UserFilters into a MongoDB filter
+func buildUserListFilter(filters UserFilters) bson.M {
+	filter := bson.M{}
+
+	if filters.Role != "" {
+		filter["role"] = filters.Role
+	}
+	if filters.Region != "" {
+		filter["region"] = filters.Region
+	}
+	if filters.Team != "" {
+		filter["team"] = filters.Team
+	}
+	if filters.IsActive != nil {
+		filter["is_active"] = *filters.IsActive
+	}
+	if filters.Search != "" {
+		pattern := regexp.QuoteMeta(filters.Search)
+		filter["$or"] = []bson.M{
+			{"name": bson.M{"$regex": pattern, "$options": "i"}},
+			{"email": bson.M{"$regex": pattern, "$options": "i"}},
+		}
+	}
+
+	created := bson.M{}
+	if filters.CreatedAfter != nil {
+		created["$gte"] = *filters.CreatedAfter
+	}
+	if filters.CreatedBefore != nil {
+		created["$lt"] = *filters.CreatedBefore
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	return filter
+}
+
+// userListPageFilter narrows a user listing down to the users after
+// filters.After, leaving the filter used for the total unchanged
+func userListPageFilter(filter bson.M, filters UserFilters) bson.M {
+	if filters.After == nil {
+		return filter
+	}
+	return pagination.And(filter, pagination.After("created_at", filters.SortOrder != "asc", filters.After, filters.After.ID))
+}
+
+// userSortFields maps the accepted sort keys to user document fields
+var userSortFields = map[string]string{
+	"name":          "name",
+	"email":         "email",
+	"role":          "role",
+	"created_at":    "created_at",
+	"last_login_at": "last_login_at",
+}
+
+// userListOptions sorts (newest first by default) and paginates a user
+// listing, leaving out password hashes and OTP fields
+func userListOptions(filters UserFilters) *options.FindOptions {
+	sortField, ok := userSortFields[filters.SortBy]
+	if !ok {
+		sortField = "created_at"
+	}
+	sortOrder := -1
+	if filters.SortOrder == "asc" {
+		sortOrder = 1
+	}
+
+	// _id tiebreaker keeps pages stable when the sort field has duplicates,
+	// and orders users like pagination.After when paging by cursor
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: sortOrder}, {Key: "_id", Value: sortOrder}}).
+		SetProjection(bson.M{"password_hash": 0, "otp_hash": 0, "otp_expires_at": 0})
+	if filters.Limit > 0 {
+		opts.SetLimit(int64(filters.Limit))
+	}
+	if filters.Offset > 0 {
+		opts.SetSkip(int64(filters.Offset))
+	}
+	return opts
 }
 
 // ActivateUserForHandler activates a user (no context)
@@ -921,7 +1342,7 @@ func (r *MongoUserRepository) GetUserSettings(userID string) (*models.UserSettin
 }
 
 // GetUserByID retrieves a user by ID (handler compatibility - no context)
-func (r *MongoUserRepository) GetUserByID(userID string) (*models.MongoUser, error) {
+func (r *MongoUserRepository) GetUserByID(userID string) (*models.User, error) {
 	return r.GetByID(context.Background(), userID)
 }
 
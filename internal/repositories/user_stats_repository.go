@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// User account states counted by CountByStatus
+const (
+	UserStatusActive      = "active"
+	UserStatusInvited     = "invited"
+	UserStatusDeactivated = "deactivated"
+	UserStatusDeleted     = "deleted" // Anonymized; the record stays behind
+)
+
+// UserStats holds the headline user numbers of the admin dashboard
+type UserStats struct {
+	Total              int64            `json:"total"`
+	ByStatus           map[string]int64 `json:"byStatus"`
+	ByRole             map[string]int64 `json:"byRole"`
+	ByRegion           map[string]int64 `json:"byRegion"`
+	ByTeam             map[string]int64 `json:"byTeam"`
+	LoginsLast24h      int64            `json:"loginsLast24h"`
+	LoginsLast7d       int64            `json:"loginsLast7d"`
+	ActiveLast24h      int64            `json:"activeLast24h"` // Users who made any request, by last_seen_at
+	PendingInvitations int64            `json:"pendingInvitations"`
+	ActiveSessions     int64            `json:"activeSessions"`
+	GeneratedAt        time.Time        `json:"generatedAt"`
+}
+
+// UserStats computes the dashboard numbers as of now. Every count runs in
+// MongoDB; no user document is loaded. Counts read a secondary when one is
+// available, so they can trail the latest changes by the replication lag.
+func (r *MongoUserRepository) UserStats(ctx context.Context, now time.Time) (*UserStats, error) {
+	stats := &UserStats{GeneratedAt: now}
+
+	var err error
+	if stats.ByStatus, err = r.CountByStatus(ctx); err != nil {
+		return nil, err
+	}
+	for _, count := range stats.ByStatus {
+		stats.Total += count
+	}
+	if stats.ByRole, err = r.CountByRole(ctx); err != nil {
+		return nil, err
+	}
+	if stats.ByRegion, err = r.CountByRegion(ctx); err != nil {
+		return nil, err
+	}
+	if stats.ByTeam, err = r.CountByTeam(ctx); err != nil {
+		return nil, err
+	}
+	if stats.LoginsLast24h, err = r.LoginsSince(ctx, now.Add(-24*time.Hour)); err != nil {
+		return nil, err
+	}
+	if stats.LoginsLast7d, err = r.LoginsSince(ctx, now.Add(-7*24*time.Hour)); err != nil {
+		return nil, err
+	}
+	if stats.ActiveLast24h, err = r.SeenSince(ctx, now.Add(-24*time.Hour)); err != nil {
+		return nil, err
+	}
+	if stats.PendingInvitations, err = r.CountPendingInvitations(ctx, now); err != nil {
+		return nil, err
+	}
+	if stats.ActiveSessions, err = r.CountActiveSessions(ctx, now); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// CountByStatus counts users by account state: invited users that have not
+// signed up yet, active users and deactivated users
+func (r *MongoUserRepository) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	status := bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{"case": bson.M{"$eq": bson.A{"$status", UserStatusInvited}}, "then": UserStatusInvited},
+			bson.M{"case": bson.M{"$eq": bson.A{"$is_active", true}}, "then": UserStatusActive},
+		},
+		"default": UserStatusDeactivated,
+	}}
+	return r.countBy(ctx, status)
+}
+
+// CountByRole counts users by role
+func (r *MongoUserRepository) CountByRole(ctx context.Context) (map[string]int64, error) {
+	return r.countBy(ctx, "$role")
+}
+
+// CountByRegion counts users by region
+func (r *MongoUserRepository) CountByRegion(ctx context.Context) (map[string]int64, error) {
+	return r.countBy(ctx, "$region")
+}
+
+// CountByTeam counts users by team
+func (r *MongoUserRepository) CountByTeam(ctx context.Context) (map[string]int64, error) {
+	return r.countBy(ctx, "$team")
+}
+
+// countBy groups every user by key and counts each group. Users without a
+// value for key are counted under "".
+func (r *MongoUserRepository) countBy(ctx context.Context, key interface{}) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$ifNull": bson.A{key, ""}},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := r.reports.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating user counts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Key   string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding user counts: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Key] = row.Count
+	}
+	return counts, nil
+}
+
+// LoginsSince counts users whose last login is at or after since
+func (r *MongoUserRepository) LoginsSince(ctx context.Context, since time.Time) (int64, error) {
+	count, err := r.reports.CountDocuments(ctx, bson.M{"last_login_at": bson.M{"$gte": since}})
+	if err != nil {
+		return 0, fmt.Errorf("error counting logins: %w", err)
+	}
+	return count, nil
+}
+
+// SeenSince counts users who made a request at or after since
+func (r *MongoUserRepository) SeenSince(ctx context.Context, since time.Time) (int64, error) {
+	count, err := r.reports.CountDocuments(ctx, bson.M{"last_seen_at": bson.M{"$gte": since}})
+	if err != nil {
+		return 0, fmt.Errorf("error counting active users: %w", err)
+	}
+	return count, nil
+}
+
+// CountPendingInvitations counts invitations that can still be accepted
+func (r *MongoUserRepository) CountPendingInvitations(ctx context.Context, now time.Time) (int64, error) {
+	count, err := r.reports.CountDocuments(ctx, bson.M{
+		"status":            UserStatusInvited,
+		"invite_expires_at": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error counting pending invitations: %w", err)
+	}
+	return count, nil
+}
+
+// CountActiveSessions counts sessions that are neither revoked nor expired
+func (r *MongoUserRepository) CountActiveSessions(ctx context.Context, now time.Time) (int64, error) {
+	count, err := r.client.ReportingCollection("sessions").CountDocuments(ctx, bson.M{
+		"is_revoked": bson.M{"$ne": true},
+		"expires_at": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error counting active sessions: %w", err)
+	}
+	return count, nil
+}
+
+// CountUserLogins counts the sessions a user started in [since, until); every
+// sign-in issues a session
+func (r *MongoUserRepository) CountUserLogins(ctx context.Context, userID string, since, until time.Time) (int64, error) {
+	count, err := r.client.ReportingCollection("sessions").CountDocuments(ctx, bson.M{
+		"user_id":   userID,
+		"issued_at": bson.M{"$gte": since, "$lt": until},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error counting user logins: %w", err)
+	}
+	return count, nil
+}
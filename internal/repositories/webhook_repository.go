@@ -0,0 +1,295 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// webhookDeliveryRetention is how long finished deliveries are kept in the
+// delivery log
+const webhookDeliveryRetention = 30 * 24 * time.Hour
+
+// webhookCursorID is the document holding the dispatcher's position in the
+// events outbox
+const webhookCursorID = "events_outbox"
+
+// WebhookRepository stores webhook subscriptions, their delivery log and
+// the dispatcher's position in the events outbox
+type WebhookRepository struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+	cursors       *mongo.Collection
+}
+
+// NewWebhookRepository creates a new WebhookRepository
+func NewWebhookRepository(client *mongodb.Client) *WebhookRepository {
+	return &WebhookRepository{
+		subscriptions: client.Collection("webhook_subscriptions"),
+		deliveries:    client.Collection("webhook_deliveries"),
+		cursors:       client.Collection("webhook_cursors"),
+	}
+}
+
+// EnsureIndexes creates the delivery log, retry queue and retention indexes
+func (r *WebhookRepository) EnsureIndexes(ctx context.Context) error {
+	if err := createIndexes(ctx, r.subscriptions, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "is_active", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+	return createIndexes(ctx, r.deliveries, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(webhookDeliveryRetention.Seconds())).SetName("created_at_ttl"),
+		},
+	})
+}
+
+// CreateSubscription stores a new subscription
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	if _, err := r.subscriptions.InsertOne(ctx, sub); err != nil {
+		return fmt.Errorf("error creating webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// GetSubscription retrieves a subscription by ID
+func (r *WebhookRepository) GetSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := r.subscriptions.FindOne(ctx, bson.M{"_id": id}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrWebhookNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// ListSubscriptions returns every subscription, newest first
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{})
+}
+
+// ListActiveSubscriptions returns the subscriptions that receive events
+func (r *WebhookRepository) ListActiveSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{"is_active": true})
+}
+
+func (r *WebhookRepository) findSubscriptions(ctx context.Context, filter bson.M) ([]*models.WebhookSubscription, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.subscriptions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	subs := []*models.WebhookSubscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("error decoding webhook subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// UpdateSubscription applies the given fields of update to a subscription
+// and returns it updated. Activating a subscription clears its failures.
+func (r *WebhookRepository) UpdateSubscription(ctx context.Context, id string, update *models.UpdateWebhookSubscriptionRequest, at time.Time) (*models.WebhookSubscription, error) {
+	setFields := bson.M{"updated_at": at}
+	unsetFields := bson.M{}
+	if update.URL != nil {
+		setFields["url"] = *update.URL
+	}
+	if update.Description != nil {
+		setFields["description"] = *update.Description
+	}
+	if update.Secret != nil {
+		setFields["secret"] = *update.Secret
+	}
+	if update.EventTypes != nil {
+		setFields["event_types"] = *update.EventTypes
+	}
+	if update.IsActive != nil {
+		setFields["is_active"] = *update.IsActive
+		if *update.IsActive {
+			setFields["consecutive_failures"] = 0
+			unsetFields["disabled_at"] = ""
+			unsetFields["disabled_reason"] = ""
+		}
+	}
+	updateDoc := bson.M{"$set": setFields}
+	if len(unsetFields) > 0 {
+		updateDoc["$unset"] = unsetFields
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var sub models.WebhookSubscription
+	err := r.subscriptions.FindOneAndUpdate(ctx, bson.M{"_id": id}, updateDoc, opts).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrWebhookNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// DeleteSubscription removes a subscription along with its delivery log
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	result, err := r.subscriptions.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("error deleting webhook subscription: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return WrapNotFound(mongo.ErrNoDocuments, ErrWebhookNotFound)
+	}
+	if _, err := r.deliveries.DeleteMany(ctx, bson.M{"subscription_id": id}); err != nil {
+		return fmt.Errorf("error deleting webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// RecordAttemptResult resets the failure count of a subscription after a
+// successful attempt, or counts a failed one. It returns the subscription
+// updated.
+func (r *WebhookRepository) RecordAttemptResult(ctx context.Context, id string, success bool) (*models.WebhookSubscription, error) {
+	update := bson.M{"$inc": bson.M{"consecutive_failures": 1}}
+	if success {
+		update = bson.M{"$set": bson.M{"consecutive_failures": 0}}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var sub models.WebhookSubscription
+	err := r.subscriptions.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, WrapNotFound(err, ErrWebhookNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error recording webhook attempt: %w", err)
+	}
+	return &sub, nil
+}
+
+// DisableSubscription turns off an active subscription. It returns false
+// when the subscription was already inactive, so only one caller reports it.
+func (r *WebhookRepository) DisableSubscription(ctx context.Context, id, reason string, at time.Time) (bool, error) {
+	result, err := r.subscriptions.UpdateOne(ctx,
+		bson.M{"_id": id, "is_active": true},
+		bson.M{"$set": bson.M{"is_active": false, "disabled_at": at, "disabled_reason": reason, "updated_at": at}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error disabling webhook subscription: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// QueueDelivery stores a pending delivery. An event already queued for the
+// subscription is left as it is.
+func (r *WebhookRepository) QueueDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if _, err := r.deliveries.InsertOne(ctx, delivery); err != nil {
+		if IsDuplicateKey(err) {
+			return nil
+		}
+		return fmt.Errorf("error queueing webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// SaveDelivery stores a delivery as it is, replacing any earlier version
+func (r *WebhookRepository) SaveDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.deliveries.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery, opts); err != nil {
+		return fmt.Errorf("error saving webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueDelivery takes the pending delivery that has been due the longest
+// and pushes its next attempt out by lease, so no other dispatcher sends it
+// meanwhile. It returns nil when nothing is due.
+func (r *WebhookRepository) ClaimDueDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.Before)
+	var delivery models.WebhookDelivery
+	err := r.deliveries.FindOneAndUpdate(ctx,
+		bson.M{"status": models.WebhookDeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}},
+		opts,
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// ListDeliveries returns the deliveries of a subscription newest first,
+// along with the number of matches ignoring pagination. An empty status
+// lists every status.
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID, status string, limit, offset int) ([]*models.WebhookDelivery, int64, error) {
+	filter := bson.M{"subscription_id": subscriptionID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	total, err := r.deliveries.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting webhook deliveries: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.deliveries.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []*models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, fmt.Errorf("error decoding webhook deliveries: %w", err)
+	}
+	return deliveries, total, nil
+}
+
+// GetCursor returns the outbox sequence up to which events have been queued
+// for delivery, and false when the dispatcher has not run yet
+func (r *WebhookRepository) GetCursor(ctx context.Context) (int64, bool, error) {
+	var cursor struct {
+		Sequence int64 `bson:"sequence"`
+	}
+	err := r.cursors.FindOne(ctx, bson.M{"_id": webhookCursorID}).Decode(&cursor)
+	if err == mongo.ErrNoDocuments {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting webhook cursor: %w", err)
+	}
+	return cursor.Sequence, true, nil
+}
+
+// AdvanceCursor moves the dispatcher's outbox position forward to sequence.
+// A position already further along is kept.
+func (r *WebhookRepository) AdvanceCursor(ctx context.Context, sequence int64) error {
+	_, err := r.cursors.UpdateOne(ctx,
+		bson.M{"_id": webhookCursorID},
+		bson.M{"$max": bson.M{"sequence": sequence}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("error advancing webhook cursor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// basePath and adminBasePath are where the API and its admin routes are
+// mounted
+const (
+	basePath      = "/api/v1"
+	adminBasePath = basePath + "/admin"
+)
+
+// movedRoute is an admin route served at another path before admin routes
+// were all mounted under /admin. Paths are relative to /api/v1.
+type movedRoute struct {
+	From string
+	To   string
+}
+
+// movedRoutes are the admin routes that moved under /admin. Their old
+// paths keep working for one release, answering with a Deprecation header
+// and a Link to the new path; remove an entry to stop serving its old path.
+var movedRoutes = []movedRoute{
+	{From: "/team/members", To: "/admin/team/members"},
+	{From: "/team/members/invite", To: "/admin/team/members/invite"},
+	{From: "/team/members/export", To: "/admin/team/members/export"},
+	{From: "/team/members/{id}", To: "/admin/team/members/{id}"},
+	{From: "/team/members/{id}/deactivate", To: "/admin/team/members/{id}/deactivate"},
+	{From: "/team/members/{id}/reactivate", To: "/admin/team/members/{id}/reactivate"},
+
+	{From: "/users", To: "/admin/users"},
+	{From: "/users/stats", To: "/admin/users/stats"},
+	{From: "/users/{id}/data-scope", To: "/admin/users/{id}/data-scope"},
+	{From: "/users/{id}/reports", To: "/admin/users/{id}/reports"},
+	{From: "/users/{id}/management-chain", To: "/admin/users/{id}/management-chain"},
+	{From: "/users/{id}/login-history", To: "/admin/users/{id}/login-history"},
+
+	{From: "/system/company", To: "/admin/system/company"},
+	{From: "/system/notifications", To: "/admin/system/notifications"},
+	{From: "/system/defaults", To: "/admin/system/defaults"},
+	{From: "/system/security", To: "/admin/system/security"},
+	{From: "/system/email-notifications", To: "/admin/system/email-notifications"},
+	{From: "/system/audit-logs", To: "/admin/system/audit-logs"},
+	{From: "/system/audit-logs/export", To: "/admin/system/audit-logs/export"},
+	{From: "/system/audit-logs/permission-denials", To: "/admin/system/audit-logs/permission-denials"},
+}
+
+// movedFrom returns the old path of the admin route at path, relative to
+// /api/v1, if it moved
+func movedFrom(path string) (string, bool) {
+	for _, moved := range movedRoutes {
+		if moved.To == path {
+			return moved.From, true
+		}
+	}
+	return "", false
+}
+
+// adminHandler is the handler of every route mounted under /api/v1/admin,
+// built by adminRoute. It keeps the authorization middleware of its chain,
+// so the route table can be checked for routes mounted without one.
+type adminHandler struct {
+	http.Handler
+	authz middlewareFunc
+}
+
+// adminRoute mounts an admin route for method on path, relative to
+// /api/v1/admin. Its handler always runs JWT authentication, then authz,
+// the role or permission check of the route, then mws. A route that moved
+// is served at its old path too, as a deprecated alias.
+func (g *routeGroup) adminRoute(method, path string, hf http.HandlerFunc, authz middlewareFunc, mws ...middlewareFunc) {
+	if authz == nil {
+		panic(fmt.Sprintf("routes: admin route %s %s has no authorization check", method, path))
+	}
+	h := &adminHandler{
+		Handler: g.protected(hf, append([]middlewareFunc{authz}, mws...)...),
+		authz:   authz,
+	}
+	g.admin.Handle(path, h).Methods(method, http.MethodOptions)
+	if from, ok := movedFrom("/admin" + path); ok {
+		g.api.Handle(from, deprecated(adminBasePath+path, h)).Methods(method, http.MethodOptions)
+	}
+}
+
+// deprecated serves h at the old path of a moved route, with a Deprecation
+// header and a Link to successor, the path template of the route now
+func deprecated(successor string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		link := successor
+		for name, value := range mux.Vars(r) {
+			link = strings.ReplaceAll(link, "{"+name+"}", url.PathEscape(value))
+		}
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// checkAdminRoutes returns an error naming every route served under
+// /api/v1/admin whose middleware chain has no authorization check, having
+// been mounted other than by adminRoute
+func checkAdminRoutes(router *mux.Router) error {
+	var errs []error
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, adminBasePath+"/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // A subrouter's prefix, not an endpoint
+		}
+		if h, ok := route.GetHandler().(*adminHandler); !ok || h.authz == nil {
+			errs = append(errs, fmt.Errorf("%s %s is mounted under %s without an authorization check", strings.Join(methods, ","), template, adminBasePath))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,206 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// adminFixture is a route group authorizing by the claims of the token
+// alone, standing in for the Mongo-backed one RegisterRoutes builds
+type adminFixture struct {
+	t      *testing.T
+	router *mux.Router
+	group  *routeGroup
+	jwt    *utils.JWTService
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	jwtService, err := utils.NewJWTService(config.JWTConfig{
+		Algorithm:          utils.AlgorithmHS256,
+		Secret:             "routes-tests-only-secret-0123456789abcdef",
+		AccessTokenExpiry:  15,
+		RefreshTokenExpiry: 7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	api := router.PathPrefix(basePath).Subrouter()
+	return &adminFixture{
+		t:      t,
+		router: router,
+		jwt:    jwtService,
+		group: &routeGroup{
+			api:   api,
+			admin: api.PathPrefix("/admin").Subrouter(),
+			auth:  middleware.JWTAuth(jwtService),
+			limit: func(h http.Handler) http.Handler { return h },
+			perms: middleware.NewPermissionEnforcer(nil),
+		},
+	}
+}
+
+// ok answers 200 with the route's id variable, if it has one
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(mux.Vars(r)["id"]))
+}
+
+// get requests path as user, or without a token when user is nil
+func (f *adminFixture) get(user *models.User, path string) *httptest.ResponseRecorder {
+	f.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if user != nil {
+		token, err := f.jwt.GenerateAccessToken(user, "")
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func caller(role models.UserRole, permissions ...string) *models.User {
+	return &models.User{ID: uuid.MustNewUUID(), Email: string(role) + "@example.com", Role: role, Permissions: permissions}
+}
+
+// TestAdminRoutesRejectCallersWithoutPermission mounts admin routes behind
+// a role and a permission check, and checks callers without them are
+// refused at the new path and the deprecated one alike
+func TestAdminRoutesRejectCallersWithoutPermission(t *testing.T) {
+	f := newAdminFixture(t)
+	f.group.adminRoute("GET", "/users", ok, f.group.perms.RequireRole(models.RoleAdmin))
+	f.group.adminRoute("GET", "/team/members", ok, f.group.perms.RequirePermission(models.PermTeamMembersView))
+
+	admin := caller(models.UserRoleAdmin)
+	rep := caller(models.UserRoleSalesRep)
+	viewer := caller(models.UserRoleManager, models.PermTeamMembersView)
+	for _, tt := range []struct {
+		name   string
+		user   *models.User
+		path   string
+		status int
+	}{
+		{"no token", nil, "/admin/users", http.StatusUnauthorized},
+		{"no token", nil, "/users", http.StatusUnauthorized},
+		{"sales rep", rep, "/admin/users", http.StatusForbidden},
+		{"sales rep", rep, "/users", http.StatusForbidden},
+		{"sales rep", rep, "/admin/team/members", http.StatusForbidden},
+		{"sales rep", rep, "/team/members", http.StatusForbidden},
+		{"team viewer", viewer, "/admin/users", http.StatusForbidden},
+		{"team viewer", viewer, "/admin/team/members", http.StatusOK},
+		{"team viewer", viewer, "/team/members", http.StatusOK},
+		{"admin", admin, "/admin/users", http.StatusOK},
+		{"admin", admin, "/users", http.StatusOK},
+	} {
+		if rec := f.get(tt.user, basePath+tt.path); rec.Code != tt.status {
+			t.Errorf("%s: GET %s = %d %s, want %d", tt.name, tt.path, rec.Code, rec.Body, tt.status)
+		}
+	}
+}
+
+// TestMovedRoutesKeepTheirOldPaths checks the old path of a moved admin
+// route still serves it, marked deprecated with a link to the new path,
+// and that routes which did not move get no alias
+func TestMovedRoutesKeepTheirOldPaths(t *testing.T) {
+	f := newAdminFixture(t)
+	adminOnly := f.group.perms.RequireRole(models.RoleAdmin)
+	f.group.adminRoute("GET", "/users/{id}/login-history", ok, adminOnly)
+	f.group.adminRoute("GET", "/emails", ok, adminOnly)
+	admin := caller(models.UserRoleAdmin)
+
+	rec := f.get(admin, "/api/v1/users/a%20b/login-history")
+	if rec.Code != http.StatusOK || rec.Body.String() != "a b" {
+		t.Fatalf("old path = %d %q, want the route served", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Errorf("Deprecation = %q, want true", rec.Header().Get("Deprecation"))
+	}
+	if want := `</api/v1/admin/users/a%20b/login-history>; rel="successor-version"`; rec.Header().Get("Link") != want {
+		t.Errorf("Link = %q, want %q", rec.Header().Get("Link"), want)
+	}
+
+	rec = f.get(admin, "/api/v1/admin/users/42/login-history")
+	if rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" || rec.Header().Get("Link") != "" {
+		t.Errorf("new path = %d, Deprecation %q, Link %q; want it served undeprecated", rec.Code, rec.Header().Get("Deprecation"), rec.Header().Get("Link"))
+	}
+
+	if rec := f.get(admin, "/api/v1/emails"); rec.Code != http.StatusNotFound {
+		t.Errorf("old path of a route that never moved = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminRouteRequiresAnAuthorizationCheck(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("adminRoute mounted a route without an authorization check")
+		}
+	}()
+	f := newAdminFixture(t)
+	f.group.adminRoute("GET", "/users", ok, nil)
+}
+
+// TestCheckAdminRoutesNamesRoutesWithoutAuthorization mounts a route on
+// the admin subrouter directly, bypassing adminRoute, and checks the route
+// table check names it
+func TestCheckAdminRoutesNamesRoutesWithoutAuthorization(t *testing.T) {
+	f := newAdminFixture(t)
+	f.group.adminRoute("GET", "/users", ok, f.group.perms.RequireRole(models.RoleAdmin))
+	if err := checkAdminRoutes(f.router); err != nil {
+		t.Fatalf("checkAdminRoutes = %v, want every admin route authorized", err)
+	}
+
+	f.group.admin.Handle("/cleanup", f.group.protected(ok)).Methods("POST")
+	err := checkAdminRoutes(f.router)
+	if err == nil || !strings.Contains(err.Error(), "POST /api/v1/admin/cleanup") {
+		t.Errorf("checkAdminRoutes = %v, want the route without a check named", err)
+	}
+	if strings.Contains(err.Error(), "/admin/users") {
+		t.Errorf("checkAdminRoutes = %v, want only the unchecked route named", err)
+	}
+}
+
+// TestMovedRoutesAreServedAtBothPaths checks every entry of movedRoutes
+// names an admin route RegisterRoutes mounts, and that its old path
+// answers the same methods
+func TestMovedRoutesAreServedAtBothPaths(t *testing.T) {
+	methods := map[string][]string{}
+	err := newTestRouter(t).Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		if ms, err := route.GetMethods(); err == nil {
+			methods[template] = append(methods[template], ms...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, moved := range movedRoutes {
+		to, from := methods[basePath+moved.To], methods[basePath+moved.From]
+		if len(to) == 0 {
+			t.Errorf("%s moved to %s, which is not served", moved.From, moved.To)
+			continue
+		}
+		slices.Sort(to)
+		slices.Sort(from)
+		if !slices.Equal(to, from) {
+			t.Errorf("%s answers %v, but %s answers %v", moved.From, from, moved.To, to)
+		}
+	}
+}
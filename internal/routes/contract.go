@@ -0,0 +1,1256 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/openapi"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+)
+
+// Contract returns the OpenAPI description of the API routes. Every route
+// RegisterRoutes mounts under /api/v1 has an operation here, VerifyContract
+// checks it, so a route added without one fails the build.
+func Contract() *openapi.Spec {
+	spec := openapi.NewSpec("User Management API", "1.0", basePath, handlers.ErrorResponse{}, handlers.CodedErrorResponse{})
+	spec.Add(operations...)
+	spec.Add(movedOperations(operations)...)
+	// Any JSON body can be too large or sent as another content type
+	spec.BodyErrors(http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType)
+	describeEnums(spec)
+	return spec
+}
+
+// VerifyContract returns an error naming the routes of router missing
+// from the Contract, the documented responses whose JSON does not match
+// their schema, and the admin routes mounted without an authorization check
+func VerifyContract(router *mux.Router) error {
+	spec := Contract()
+	return errors.Join(spec.CheckRoutes(router), spec.CheckResponses(), checkAdminRoutes(router))
+}
+
+// movedOperations documents the old paths of the admin routes in
+// movedRoutes as deprecated copies of the operations at their new paths
+func movedOperations(ops []openapi.Op) []openapi.Op {
+	var moved []openapi.Op
+	for _, op := range ops {
+		for _, route := range movedRoutes {
+			if op.Path != route.To {
+				continue
+			}
+			op.Path = route.From
+			op.ID = "Deprecated" + op.ID
+			op.Summary += " (deprecated: use " + route.To + ")"
+			op.Deprecated = true
+			moved = append(moved, op)
+		}
+	}
+	return moved
+}
+
+// serveContract answers with the OpenAPI document of the Contract, built
+// once when the routes are registered
+func serveContract() http.HandlerFunc {
+	document, err := json.Marshal(Contract().Document())
+	if err != nil {
+		log.Printf("Warning: failed to build the OpenAPI document: %v", err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if document == nil {
+			http.Error(w, "OpenAPI document unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(document)
+	}
+}
+
+// describeEnums describes the fields holding one of a set of constants as
+// enums, so clients get the values rather than a bare string
+func describeEnums(spec *openapi.Spec) {
+	roles := []string{models.RoleAdmin, models.RoleManager, models.RoleSalesRep, models.RoleHunting, models.RoleFarming, models.RoleGenOps}
+	openapi.Enum(spec, toUserRoles(roles)...)
+	spec.FieldEnum(models.UserProfile{}, "Role", roles...)
+	spec.FieldEnum(handlers.TeamMember{}, "Role", roles...)
+	spec.FieldEnum(handlers.MeResponse{}, "Role", roles...)
+	spec.FieldEnum(handlers.UserLookupEntry{}, "Role", roles...)
+	spec.FieldEnum(handlers.TeamMember{}, "Status", "invited", "active", "inactive", "deleted")
+
+	scopes := []string{models.DataScopeOwn, models.DataScopeTeam, models.DataScopeRegion, models.DataScopeAll, models.DataScopeNone}
+	spec.FieldEnum(models.DataScope{}, "Customers", scopes...)
+	spec.FieldEnum(models.DataScope{}, "Campaigns", scopes...)
+	spec.FieldEnum(models.DataScope{}, "Users", scopes...)
+
+	spec.FieldEnum(models.CommMessage{}, "Channel", models.ChannelEmail, models.ChannelSMS, models.ChannelWhatsApp, models.ChannelLinkedIn, models.ChannelCall, models.ChannelChat)
+	spec.FieldEnum(models.CommMessage{}, "Direction", models.DirectionInbound, models.DirectionOutbound)
+	spec.FieldEnum(models.CommMessage{}, "Status",
+		models.MessageStatusDraft, models.MessageStatusQueued, models.MessageStatusScheduled, models.MessageStatusSent,
+		models.MessageStatusDelivered, models.MessageStatusFailed, models.MessageStatusBounced, models.MessageStatusDeferred, models.MessageStatusSpam)
+	spec.FieldEnum(models.CommMessage{}, "Priority", models.PriorityLow, models.PriorityNormal, models.PriorityHigh, models.PriorityUrgent)
+	spec.FieldEnum(models.DistributionList{}, "Status", models.DistributionListStatusActive, models.DistributionListStatusArchived)
+
+	openapi.Enum(spec, models.TemplateChannelEmail, models.TemplateChannelSMS, models.TemplateChannelWhatsApp, models.TemplateChannelLinkedIn)
+	openapi.Enum(spec, models.SequenceStepChannelEmail, models.SequenceStepChannelSMS, models.SequenceStepChannelWhatsApp, models.SequenceStepChannelLinkedIn)
+	openapi.Enum(spec, models.TemplateApprovalSubmitted, models.TemplateApprovalApprove, models.TemplateApprovalReject, models.TemplateApprovalReset)
+	openapi.Enum(spec, models.TemplateVariableString, models.TemplateVariableNumber, models.TemplateVariableDate, models.TemplateVariableURL)
+	openapi.Enum(spec, models.NotificationNewDeviceLogin, models.NotificationTemplateApprovalRequest, models.NotificationTaskReminder, models.NotificationWeeklyReport)
+	spec.FieldEnum(models.MongoTemplate{}, "Channel", models.ChannelEmail, models.ChannelSMS, models.ChannelWhatsApp, models.ChannelLinkedIn)
+	spec.FieldEnum(models.MongoTemplate{}, "Status",
+		string(models.TemplateStatusDraft), string(models.TemplateStatusActive), string(models.TemplateStatusArchived), string(models.TemplateStatusPublished),
+		string(models.TemplateStatusPending), string(models.TemplateStatusApproved), string(models.TemplateStatusRejected))
+	spec.FieldEnum(models.MongoTemplate{}, "ApprovalStatus", string(models.TemplateApprovalPending), string(models.TemplateApprovalApproved), string(models.TemplateApprovalRejected))
+	spec.FieldEnum(models.MongoTemplate{}, "ApprovalFlag", string(models.ApprovalFlagGreen), string(models.ApprovalFlagYellow), string(models.ApprovalFlagRed))
+}
+
+// toUserRoles converts role names to the UserRole they are stored as
+func toUserRoles(roles []string) []models.UserRole {
+	userRoles := make([]models.UserRole, len(roles))
+	for i, role := range roles {
+		userRoles[i] = models.UserRole(role)
+	}
+	return userRoles
+}
+
+// operations documents the API routes, in the order RegisterRoutes mounts
+// them
+var operations = []openapi.Op{
+	// Authentication
+	{
+		Method: http.MethodPost, Path: "/auth/login", ID: "Login", Tag: "Authentication", Summary: "User login", Public: true,
+		Body:      handlers.LoginRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.LoginResponse{}).Described("Login successful or 2FA required")},
+		Errors:    []int{400, 401, 403, 429},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/verify-2fa", ID: "Verify2FA", Tag: "Authentication", Summary: "Verify 2FA code", Public: true,
+		Body:      handlers.Verify2FARequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.LoginResponse{}).Described("Login successful")},
+		Errors:    []int{400, 401, 429, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/logout", ID: "Logout", Tag: "Authentication", Summary: "User logout", Public: true,
+		Body:      handlers.LogoutRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.MessageResponse{}).Described("Logout successful")},
+		Errors:    []int{400, 401, 429},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/refresh", ID: "RefreshToken", Tag: "Authentication", Summary: "Refresh access token", Public: true,
+		Body:      handlers.RefreshTokenRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.RefreshTokenResponse{}).Described("Token refreshed successfully")},
+		Errors:    []int{400, 401, 429},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/password/change", ID: "ChangePassword", Tag: "Authentication", Summary: "Change password",
+		Body:      handlers.ChangePasswordRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.MessageResponse{}).Described("Password changed successfully")},
+		Errors:    []int{400, 401, 429},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/password/forgot", ID: "ForgotPassword", Tag: "Authentication", Summary: "Request password reset", Public: true,
+		Body:      handlers.ForgotPasswordRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.ForgotPasswordResponse{}).Described("Password reset email sent")},
+		Errors:    []int{400, 429, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/password/reset", ID: "ResetPassword", Tag: "Authentication", Summary: "Reset password with token", Public: true,
+		Body:      handlers.ResetPasswordRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.MessageResponse{}).Described("Password reset successfully")},
+		Errors:    []int{400, 429},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/me", ID: "Me", Tag: "Authentication", Summary: "Get the signed-in principal",
+		Responses: []openapi.Response{openapi.OK(handlers.MeResponse{})},
+		Errors:    []int{401},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/sessions", ID: "ListSessions", Tag: "Authentication", Summary: "List my sessions",
+		Responses: []openapi.Response{openapi.OK(handlers.SessionListResponse{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/login-history", ID: "GetMyLoginHistory", Tag: "Authentication", Summary: "List my sign-in attempts",
+		Query: []openapi.Param{
+			openapi.Query("success", openapi.Boolean, "Only successful (true) or rejected (false) sign-ins"),
+			openapi.Query("from", openapi.String, "Only sign-ins at or after this time (RFC 3339)"),
+			openapi.Query("to", openapi.String, "Only sign-ins before this time (RFC 3339)"),
+			openapi.Query("limit", openapi.Integer, "Number of sign-ins to return (default 50, max 100)"),
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("offset", openapi.Integer, "Number of sign-ins to skip, for offset paging with a total"),
+			openapi.Query("page", openapi.Integer, "Page number, for page paging with a total"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.LoginRecord]{}).Described("total only with offset or page paging")},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/sso/login", ID: "SSOLogin", Tag: "Authentication", Summary: "Start SSO sign-in", Public: true,
+		Responses: []openapi.Response{openapi.Redirect("Redirect to the identity provider")},
+		Errors:    []int{403, 429, 503},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/sso/callback", ID: "SSOCallback", Tag: "Authentication", Summary: "Complete SSO sign-in", Public: true,
+		Query: []openapi.Param{
+			openapi.RequiredQuery("code", openapi.String, "Authorization code"),
+			openapi.RequiredQuery("state", openapi.String, "State issued by /auth/sso/login"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.LoginResponse{}).Described("Login successful")},
+		Errors:    []int{400, 401, 403, 429, 503},
+	},
+
+	// Team
+	{
+		Method: http.MethodGet, Path: "/admin/team/members", ID: "ListTeamMembers", Tag: "Team", Summary: "List team members",
+		Query: []openapi.Param{
+			openapi.Query("role", openapi.String, "Role"),
+			openapi.Query("region", openapi.String, "Region"),
+			openapi.Query("team", openapi.String, "Team"),
+			openapi.Query("status", openapi.String, "invited, active or inactive"),
+			openapi.Query("search", openapi.String, "Name or email contains"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+			openapi.Query("offset", openapi.Integer, "Members to skip"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.TeamMembersResponse{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/team/members/invite", ID: "InviteTeamMember", Tag: "Team", Summary: "Invite a team member",
+		Body:      handlers.InviteTeamMemberRequest{},
+		Responses: []openapi.Response{openapi.Created(handlers.InviteTeamMemberResponse{}).Described("Invited; emailSent reports whether the email went out")},
+		Errors:    []int{400, 401, 403, 409, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/team/members/export", ID: "ExportTeamMembers", Tag: "Team", Summary: "Export team members",
+		Query: []openapi.Param{
+			openapi.Query("format", openapi.String, "xlsx (default) or csv"),
+			openapi.Query("role", openapi.String, "Role"),
+			openapi.Query("region", openapi.String, "Region"),
+			openapi.Query("team", openapi.String, "Team"),
+			openapi.Query("status", openapi.String, "invited, active or inactive"),
+			openapi.Query("search", openapi.String, "Name or email contains"),
+		},
+		Responses: []openapi.Response{openapi.Download(openapi.XLSX, openapi.CSV).Described("team-members-<date>.xlsx or .csv")},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/team/members/{id}", ID: "GetTeamMember", Tag: "Team", Summary: "Get a team member",
+		Responses: []openapi.Response{openapi.OK(handlers.TeamMemberResponse{})},
+		Errors:    []int{400, 401, 404},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/team/members/{id}", ID: "UpdateTeamMember", Tag: "Team", Summary: "Update a team member",
+		Header:    []openapi.Param{openapi.Header("If-Match", false, "Version last read")},
+		Body:      handlers.UpdateTeamMemberRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.TeamMemberResponse{})},
+		Errors:    []int{400, 401, 403, 404, 409, 428, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/admin/team/members/{id}", ID: "DeleteTeamMember", Tag: "Team", Summary: "Delete a team member",
+		Responses: []openapi.Response{openapi.OK(handlers.SuccessResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/team/members/{id}/deactivate", ID: "DeactivateTeamMember", Tag: "Team", Summary: "Deactivate a team member",
+		Responses: []openapi.Response{openapi.OK(handlers.SuccessResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/team/members/{id}/reactivate", ID: "ReactivateTeamMember", Tag: "Team", Summary: "Reactivate a team member",
+		Responses: []openapi.Response{openapi.OK(handlers.SuccessResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/users/import", ID: "ImportUsers", Tag: "Users", Summary: "Import users from CSV",
+		Form: []openapi.Param{
+			openapi.FormFile("file", "CSV file"),
+			openapi.FormField("send_invites", false, "Email the invitations (default true)"),
+			openapi.FormField("async", false, "Import in the background"),
+		},
+		Responses: []openapi.Response{openapi.OK(models.UserImportJob{}).Described("Imported, with the report of every row"), openapi.Accepted(models.UserImportJob{}).Described("Importing in the background")},
+		Errors:    []int{400, 401, 403, 413, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/users/import/{jobID}", ID: "GetUserImport", Tag: "Users", Summary: "Get a user import",
+		Query: []openapi.Param{
+			openapi.Query("format", openapi.String, "json (default) or csv"),
+		},
+		Responses: []openapi.Response{openapi.OK(models.UserImportJob{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/verify-invite", ID: "VerifyInviteToken", Tag: "Team", Summary: "Verify an invitation", Public: true,
+		Query: []openapi.Param{
+			openapi.RequiredQuery("token", openapi.String, "Invitation token"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[handlers.InvitationDetails]{}).Described("Invitation details")},
+		Errors:    []int{400, 404, 410, 429},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/complete-signup", ID: "CompleteSignup", Tag: "Team", Summary: "Complete signup", Public: true,
+		Body:      handlers.CompleteSignupRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[handlers.SignedUpUser]{}).Described("Signup completed")},
+		Errors:    []int{400, 404, 410, 429, 500},
+	},
+
+	// User Directory
+	{
+		Method: http.MethodGet, Path: "/users/me/onboarding", ID: "GetMyOnboarding", Tag: "Users", Summary: "Get my onboarding checklist",
+		Responses: []openapi.Response{openapi.OK(models.OnboardingChecklist{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPatch, Path: "/users/me/onboarding/{item}/dismiss", ID: "DismissOnboardingItem", Tag: "Users", Summary: "Dismiss an onboarding checklist item",
+		Responses: []openapi.Response{openapi.OK(models.OnboardingChecklist{})},
+		Errors:    []int{401, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/users", ID: "ListUsers", Tag: "Users", Summary: "List users",
+		Query: []openapi.Param{
+			openapi.Query("role", openapi.String, "Role"),
+			openapi.Query("region", openapi.String, "Region"),
+			openapi.Query("team", openapi.String, "Team"),
+			openapi.Query("is_active", openapi.Boolean, "Active flag"),
+			openapi.Query("search", openapi.String, "Name or email contains"),
+			openapi.Query("created_after", openapi.String, "Created at or after (RFC 3339)"),
+			openapi.Query("created_before", openapi.String, "Created at or before (RFC 3339)"),
+			openapi.Query("sort", openapi.String, "name, email, role, created_at or last_login_at, prefixed with - for descending (default -created_at)"),
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("page", openapi.Integer, "Page number"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+			openapi.Query("format", openapi.String, "json (default) or csv"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.UserProfile]{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/users/stats", ID: "GetUserStats", Tag: "Users", Summary: "User statistics",
+		Responses: []openapi.Response{openapi.OK(repositories.UserStats{})},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/users/lookup", ID: "LookupUsers", Tag: "Users", Summary: "Look up users",
+		Body:      handlers.UserLookupRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.UserLookupResponse{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/users/{id}/data-scope", ID: "GetUserDataScope", Tag: "Users", Summary: "Get a user's data scope",
+		Responses: []openapi.Response{openapi.OK(handlers.UserDataScopeResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/users/{id}/data-scope", ID: "UpdateUserDataScope", Tag: "Users", Summary: "Update a user's data scope",
+		Body:      map[string]string{},
+		Responses: []openapi.Response{openapi.OK(handlers.UserDataScopeResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/users/{id}/reports", ID: "GetUserReports", Tag: "Users", Summary: "List a user's direct reports",
+		Responses: []openapi.Response{openapi.OK(handlers.UserReportsResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/users/{id}/management-chain", ID: "GetUserManagementChain", Tag: "Users", Summary: "Get a user's management chain",
+		Responses: []openapi.Response{openapi.OK(handlers.ManagementChainResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/users/{id}/login-history", ID: "GetUserLoginHistory", Tag: "Users", Summary: "List a user's sign-in attempts",
+		Query: []openapi.Param{
+			openapi.Query("success", openapi.Boolean, "Only successful (true) or rejected (false) sign-ins"),
+			openapi.Query("from", openapi.String, "Only sign-ins at or after this time (RFC 3339)"),
+			openapi.Query("to", openapi.String, "Only sign-ins before this time (RFC 3339)"),
+			openapi.Query("limit", openapi.Integer, "Number of sign-ins to return (default 50, max 100)"),
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("offset", openapi.Integer, "Number of sign-ins to skip, for offset paging with a total"),
+			openapi.Query("page", openapi.Integer, "Page number, for page paging with a total"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.LoginRecord]{}).Described("total only with offset or page paging")},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+
+	// Settings
+	{
+		Method: http.MethodGet, Path: "/settings/profile", ID: "GetProfile", Tag: "Settings", Summary: "Get user profile",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SettingsUserProfile]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/settings/email-signature", ID: "GetEmailSignature", Tag: "Settings", Summary: "Get email signature",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SettingsEmailSignature]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/settings/email-signature", ID: "UpdateEmailSignature", Tag: "Settings", Summary: "Update email signature",
+		Body:      models.SettingsUpdateEmailSignatureRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SettingsEmailSignature]{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/settings/email-signature/preview", ID: "PreviewEmailSignature", Tag: "Settings", Summary: "Preview email signature",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[handlers.EmailSignaturePreview]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/settings/send-window", ID: "GetSendWindow", Tag: "Settings", Summary: "Get the send window",
+		Responses: []openapi.Response{openapi.OK(models.SendWindowStatus{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/settings/account/deactivate", ID: "DeactivateAccount", Tag: "Settings", Summary: "Deactivate own account",
+		Body:      models.DeactivateAccountRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.AccountDeactivatedResponse{})},
+		Errors:    []int{400, 401, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/settings/account/delete-request", ID: "RequestAccountDeletion", Tag: "Settings", Summary: "Request deletion of own account",
+		Body:      models.AccountDeletionRequestBody{},
+		Responses: []openapi.Response{openapi.Created(handlers.DataResponse[*models.AccountDeletionRequest]{})},
+		Errors:    []int{400, 401, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/settings/account/cancel-deletion", ID: "CancelAccountDeletion", Tag: "Settings", Summary: "Cancel deletion of own account",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.AccountDeletionRequest]{})},
+		Errors:    []int{401, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/settings/security", ID: "GetSecuritySettings", Tag: "Settings", Summary: "Get my security settings",
+		Responses: []openapi.Response{openapi.OK(models.SettingsUserSecuritySettings{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/settings/security", ID: "UpdateSecuritySettings", Tag: "Settings", Summary: "Update my security settings",
+		Body:      models.SettingsUpdateSecuritySettingsRequest{},
+		Responses: []openapi.Response{openapi.OK(models.SettingsUserSecuritySettings{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/settings/security/phone", ID: "StartPhoneVerification", Tag: "Settings", Summary: "Add a phone number for 2FA",
+		Body:      models.SettingsPhoneNumberRequest{},
+		Responses: []openapi.Response{openapi.Accepted(handlers.PhoneVerificationStarted{})},
+		Errors:    []int{400, 401, 403, 429, 502, 503},
+	},
+	{
+		Method: http.MethodDelete, Path: "/settings/security/phone", ID: "RemovePhoneNumber", Tag: "Settings", Summary: "Remove my 2FA phone number",
+		Responses: []openapi.Response{openapi.OK(models.SettingsUserSecuritySettings{})},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/settings/security/phone/verify", ID: "VerifyPhoneNumber", Tag: "Settings", Summary: "Confirm a phone number for 2FA",
+		Body:      models.SettingsVerifyPhoneNumberRequest{},
+		Responses: []openapi.Response{openapi.OK(models.SettingsUserSecuritySettings{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/company", ID: "GetCompanyInfo", Tag: "Settings", Summary: "Get company information",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SettingsCompanyInfo]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/system/company", ID: "UpdateCompanyInfo", Tag: "Settings", Summary: "Update company information",
+		Query: []openapi.Param{
+			openapi.Query("dry_run", openapi.Boolean, "Validate and return the changes without saving"),
+		},
+		Body:      models.SettingsUpdateCompanyInfoRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.SettingsUpdateResponse[*models.SettingsCompanyInfo]{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/notifications", ID: "GetNotificationSettings", Tag: "Settings", Summary: "Get notification settings",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SettingsNotificationSettings]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/system/notifications", ID: "UpdateNotificationSettings", Tag: "Settings", Summary: "Update notification settings",
+		Body:      models.SettingsUpdateNotificationSettingsRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SettingsNotificationSettings]{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/defaults", ID: "GetSystemDefaultSettings", Tag: "Settings", Summary: "Get system default settings",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SystemDefaultSettings]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/system/defaults", ID: "UpdateSystemDefaultSettings", Tag: "Settings", Summary: "Update system default settings",
+		Query: []openapi.Param{
+			openapi.Query("dry_run", openapi.Boolean, "Validate and return the changes without saving"),
+		},
+		Body:      models.UpdateSystemDefaultSettingsRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.SettingsUpdateResponse[*models.SystemDefaultSettings]{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/security", ID: "GetSystemSecuritySettings", Tag: "Settings", Summary: "Get system security settings",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SystemSecuritySettings]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/system/security", ID: "UpdateSystemSecuritySettings", Tag: "Settings", Summary: "Update system security settings",
+		Query: []openapi.Param{
+			openapi.Query("dry_run", openapi.Boolean, "Validate and return the changes without saving"),
+		},
+		Header:    []openapi.Param{openapi.Header("If-Match", false, "Version last read, as returned in the ETag header")},
+		Body:      models.UpdateSystemSecuritySettingsRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.SettingsUpdateResponse[*models.SystemSecuritySettings]{})},
+		Errors:    []int{400, 401, 409, 428, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/email-notifications", ID: "GetSystemEmailNotificationSettings", Tag: "Settings", Summary: "Get system email notification settings",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SystemEmailNotificationSettings]{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/system/email-notifications", ID: "UpdateSystemEmailNotificationSettings", Tag: "Settings", Summary: "Update system email notification settings",
+		Body:      models.UpdateSystemEmailNotificationSettingsRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.SystemEmailNotificationSettings]{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/audit-logs", ID: "GetAuditLogs", Tag: "Settings", Summary: "Get audit logs",
+		Query: []openapi.Param{
+			openapi.Query("limit", openapi.Integer, "Number of logs to return (default 10, max 100)"),
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("offset", openapi.Integer, "Number of logs to skip, for offset paging with a total"),
+			openapi.Query("page", openapi.Integer, "Page number, for page paging with a total"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.SettingsAuditLog]{}).Described("total only with offset or page paging")},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/audit-logs/export", ID: "ExportAuditLogs", Tag: "Settings", Summary: "Export audit logs",
+		Query: []openapi.Param{
+			openapi.Query("format", openapi.String, "xlsx (default) or csv"),
+		},
+		Responses: []openapi.Response{openapi.Download(openapi.XLSX, openapi.CSV).Described("audit-logs-<date>.xlsx or .csv")},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system/audit-logs/permission-denials", ID: "GetPermissionDenials", Tag: "Settings", Summary: "List refused requests",
+		Query: []openapi.Param{
+			openapi.Query("user_id", openapi.String, "Only the denials of this user"),
+			openapi.Query("limit", openapi.Integer, "Number of denials to return (default 50, max 100)"),
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("offset", openapi.Integer, "Number of denials to skip, for offset paging with a total"),
+			openapi.Query("page", openapi.Integer, "Page number, for page paging with a total"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.PermissionDenial]{}).Described("total only with offset or page paging")},
+		Errors:    []int{400, 401, 403, 500},
+	},
+
+	// Notification
+	{
+		Method: http.MethodGet, Path: "/notifications", ID: "ListNotifications", Tag: "Notifications", Summary: "List notifications",
+		Query: []openapi.Param{
+			openapi.Query("unread", openapi.Boolean, "Only unread notifications"),
+			openapi.Query("page", openapi.Integer, "Page number (default 1)"),
+			openapi.Query("limit", openapi.Integer, "Page size"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.NotificationListResponse{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodPatch, Path: "/notifications/{id}/read", ID: "MarkNotificationRead", Tag: "Notifications", Summary: "Mark a notification read",
+		Responses: []openapi.Response{openapi.OK(handlers.NotificationReadResponse{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+
+	// Template
+	{
+		Method: http.MethodGet, Path: "/templates", ID: "ListTemplates", Tag: "Templates", Summary: "List templates with filters",
+		Query: []openapi.Param{
+			openapi.Query("channel", openapi.String, "Filter by channel (email, sms, whatsapp, linkedin)"),
+			openapi.Query("status", openapi.String, "Filter by status (draft, published)"),
+			openapi.Query("created_by", openapi.String, "Filter by creator user ID (UUID)"),
+			openapi.Query("tag", openapi.String, "Filter by tag (single tag name or comma-separated for multiple tags, uses AND logic)"),
+			openapi.Query("search", openapi.String, "Search in template name, description, subject and body"),
+			openapi.Query("performance", openapi.String, "Quartile of 30-day sends within the tenant (high = top quartile, low = bottom quartile including unused, medium = the rest)"),
+			openapi.Query("page", openapi.Integer, "Page number (default: 1)"),
+			openapi.Query("limit", openapi.Integer, "Items per page (default: 50, max: 100)"),
+			openapi.Query("sort_by", openapi.String, "Sort by field (name, created_at, updated_at)"),
+			openapi.Query("sort_order", openapi.String, "Sort order (asc, desc)"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.TemplateListResponse{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates", ID: "CreateTemplate", Tag: "Templates", Summary: "Create a new template",
+		Body:      models.CreateTemplateRequest{},
+		Responses: []openapi.Response{openapi.Created(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/bulk", ID: "BulkTemplates", Tag: "Templates", Summary: "Apply one action to many templates",
+		Body:      models.BulkTemplateRequest{},
+		Responses: []openapi.Response{openapi.OK(models.BulkTemplateResponse{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/templates/export", ID: "ExportTemplates", Tag: "Templates", Summary: "Export templates as JSON",
+		Query: []openapi.Param{
+			openapi.Query("ids", openapi.String, "Template IDs (comma-separated)"),
+			openapi.Query("channel", openapi.String, "Filter by channel (email, sms, whatsapp, linkedin)"),
+		},
+		Responses: []openapi.Response{openapi.OK(models.TemplateExportDocument{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/import", ID: "ImportTemplates", Tag: "Templates", Summary: "Import templates from JSON",
+		Query: []openapi.Param{
+			openapi.Query("conflict", openapi.String, "Conflict strategy: skip, overwrite or duplicate (default: skip)"),
+		},
+		Body:      models.TemplateExportDocument{},
+		Responses: []openapi.Response{openapi.OK(models.TemplateImportResponse{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/templates/tags", ID: "ListTemplateTags", Tag: "Templates", Summary: "List template tags",
+		Responses: []openapi.Response{openapi.OK(handlers.TemplateTagsResponse{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/templates/tags/{name}", ID: "RenameTemplateTag", Tag: "Templates", Summary: "Rename a template tag",
+		Body:      models.RenameTemplateTagRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.TemplateTagRenamed{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/preview", ID: "PreviewDraftTemplate", Tag: "Templates", Summary: "Preview an unsaved template",
+		Body:      models.DraftTemplatePreviewRequest{},
+		Responses: []openapi.Response{openapi.OK(models.TemplatePreviewResponse{})},
+		Errors:    []int{400, 401},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/lint", ID: "LintDraftTemplate", Tag: "Templates", Summary: "Lint an unsaved template",
+		Query: []openapi.Param{
+			openapi.Query("check_links", openapi.Boolean, "Request every link (default true)"),
+		},
+		Body:      models.DraftTemplateLintRequest{},
+		Responses: []openapi.Response{openapi.OK(models.TemplateLintReport{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/templates/trash", ID: "ListTrashTemplates", Tag: "Templates", Summary: "List trashed templates",
+		Query: []openapi.Param{
+			openapi.Query("page", openapi.Integer, "Page number (default 1)"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.TemplateListResponse{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/templates/{id}", ID: "GetTemplate", Tag: "Templates", Summary: "Get template by ID",
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/templates/{id}", ID: "UpdateTemplate", Tag: "Templates", Summary: "Update a template",
+		Header:    []openapi.Param{openapi.Header("If-Match", false, "Version last read, as returned in the ETag header")},
+		Body:      models.UpdateTemplateRequest{},
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 404, 409, 428, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/templates/{id}", ID: "DeleteTemplate", Tag: "Templates", Summary: "Delete a template",
+		Query: []openapi.Param{
+			openapi.Query("permanent", openapi.Boolean, "Permanently delete (admin only)"),
+		},
+		Responses: []openapi.Response{openapi.NoContent().Described("No Content - Template deleted successfully")},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/duplicate", ID: "DuplicateTemplate", Tag: "Templates", Summary: "Clone a template",
+		Body:      models.DuplicateTemplateRequest{},
+		Responses: []openapi.Response{openapi.Created(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/convert", ID: "ConvertTemplate", Tag: "Templates", Summary: "Convert a template to another channel",
+		Query: []openapi.Param{
+			openapi.RequiredQuery("target", openapi.String, "Channel to convert to (sms, whatsapp, linkedin)"),
+		},
+		Responses: []openapi.Response{openapi.Created(models.TemplateConversionResult{})},
+		Errors:    []int{400, 401, 403, 404, 422, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/templates/{id}/archive", ID: "ArchiveTemplate", Tag: "Templates", Summary: "Archive a template",
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/templates/{id}/restore", ID: "RestoreTemplate", Tag: "Templates", Summary: "Restore an archived template",
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/restore", ID: "RestoreDeletedTemplate", Tag: "Templates", Summary: "Restore a template from the trash",
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/submit-for-approval", ID: "SubmitTemplateForApproval", Tag: "Templates", Summary: "Submit a template for approval",
+		Body:      models.TemplateApprovalRequest{},
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/approve", ID: "ApproveTemplate", Tag: "Templates", Summary: "Approve a template",
+		Body:      models.TemplateApprovalRequest{},
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/reject", ID: "RejectTemplate", Tag: "Templates", Summary: "Reject a template",
+		Body:      models.TemplateApprovalRequest{},
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/publish", ID: "PublishTemplate", Tag: "Templates", Summary: "Publish a template",
+		Query: []openapi.Param{
+			openapi.Query("force", openapi.Boolean, "Publish even if merge tags are unresolved"),
+			openapi.Query("require_clean_lint", openapi.Boolean, "Refuse to publish while the lint reports errors (links are checked)"),
+		},
+		Body:      models.PublishTemplateRequest{},
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 403, 404, 409, 422, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/unpublish", ID: "UnpublishTemplate", Tag: "Templates", Summary: "Unpublish a template",
+		Responses: []openapi.Response{openapi.OK(models.MongoTemplate{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/preview", ID: "PreviewTemplate", Tag: "Templates", Summary: "Preview a template",
+		Body:      models.TemplatePreviewRequest{},
+		Responses: []openapi.Response{openapi.OK(models.TemplatePreviewResponse{})},
+		Errors:    []int{400, 401, 403, 404},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/lint", ID: "LintTemplate", Tag: "Templates", Summary: "Lint a template",
+		Query: []openapi.Param{
+			openapi.Query("check_links", openapi.Boolean, "Request every link (default true)"),
+		},
+		Responses: []openapi.Response{openapi.OK(models.TemplateLintReport{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/templates/{id}/send-test", ID: "SendTestTemplate", Tag: "Templates", Summary: "Send a test email for a template",
+		Body:      models.SendTestTemplateRequest{},
+		Responses: []openapi.Response{openapi.OK(models.SendTestTemplateResponse{})},
+		Errors:    []int{400, 401, 403, 404, 429, 502},
+	},
+	{
+		Method: http.MethodGet, Path: "/templates/{id}/stats", ID: "GetTemplateStats", Tag: "Templates", Summary: "Get template usage statistics",
+		Query: []openapi.Param{
+			openapi.Query("days", openapi.Integer, "Window in days (default 30, max 365)"),
+		},
+		Responses: []openapi.Response{openapi.OK(models.TemplateStats{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+
+	// Sequence
+	{
+		Method: http.MethodGet, Path: "/sequences", ID: "ListSequenceTemplates", Tag: "Sequences", Summary: "List sequence templates",
+		Query: []openapi.Param{
+			openapi.Query("channel", openapi.String, "Only sequences with a step on this channel (email, sms, whatsapp, linkedin)"),
+			openapi.Query("is_active", openapi.Boolean, "Filter by active flag"),
+			openapi.Query("search", openapi.String, "Search in sequence name"),
+			openapi.Query("page", openapi.Integer, "Page number (default: 1)"),
+			openapi.Query("limit", openapi.Integer, "Items per page (default: 20, max: 100)"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.SequenceTemplateListResponse{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/sequences", ID: "CreateSequenceTemplate", Tag: "Sequences", Summary: "Create a new sequence template",
+		Body:      models.SequenceTemplateWithSteps{},
+		Responses: []openapi.Response{openapi.Created(models.SequenceTemplateWithSteps{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/sequences/{id}", ID: "GetSequenceTemplate", Tag: "Sequences", Summary: "Get a sequence template",
+		Responses: []openapi.Response{openapi.OK(models.SequenceTemplateWithSteps{})},
+		Errors:    []int{400, 401, 403, 404},
+	},
+	{
+		Method: http.MethodPut, Path: "/sequences/{id}", ID: "UpdateSequenceTemplate", Tag: "Sequences", Summary: "Update a sequence template",
+		Body:      models.SequenceTemplateWithSteps{},
+		Responses: []openapi.Response{openapi.OK(models.SequenceTemplateWithSteps{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/sequences/{id}", ID: "DeleteSequenceTemplate", Tag: "Sequences", Summary: "Delete a sequence template",
+		Responses: []openapi.Response{openapi.NoContent().Described("No Content - Sequence template deleted")},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/sequences/{id}/clone", ID: "CloneSequenceTemplate", Tag: "Sequences", Summary: "Clone a sequence template",
+		Body:      models.DuplicateTemplateRequest{},
+		Responses: []openapi.Response{openapi.Created(models.SequenceTemplateWithSteps{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/sequences/{id}/validate", ID: "ValidateSequenceTemplate", Tag: "Sequences", Summary: "Validate a stored sequence template",
+		Responses: []openapi.Response{openapi.OK(handlers.SequenceValidationResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/sequences/{id}/schedule-preview", ID: "PreviewSequenceSchedule", Tag: "Sequences", Summary: "Preview a sequence's send schedule",
+		Query: []openapi.Param{
+			openapi.Query("start", openapi.String, "Enrollment date, YYYY-MM-DD (default: today)"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.SequenceSchedulePreview{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+
+	// Campaign Schedule Definition
+	{
+		Method: http.MethodGet, Path: "/campaigns/schedule-definitions", ID: "GetScheduleDefinitions", Tag: "Communications - Scheduler", Summary: "Get campaign schedule definitions",
+		Responses: []openapi.Response{openapi.OK([]models.ScheduleDefinition{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/campaigns/schedule-definitions", ID: "CreateScheduleDefinition", Tag: "Communications - Scheduler", Summary: "Create a campaign schedule definition",
+		Body:      handlers.CreateScheduleDefinitionRequest{},
+		Responses: []openapi.Response{openapi.Created(models.ScheduleDefinition{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/campaigns/schedule-definitions/{id}", ID: "UpdateScheduleDefinition", Tag: "Communications - Scheduler", Summary: "Update a campaign schedule definition",
+		Body:      handlers.CreateScheduleDefinitionRequest{},
+		Responses: []openapi.Response{openapi.OK(models.ScheduleDefinition{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/campaigns/schedule-definitions/{id}", ID: "DeleteScheduleDefinition", Tag: "Communications - Scheduler", Summary: "Delete a campaign schedule definition",
+		Responses: []openapi.Response{openapi.NoContent()},
+		Errors:    []int{400, 401, 404, 500},
+	},
+
+	// Communication
+	{
+		Method: http.MethodGet, Path: "/communications/inbox", ID: "GetInbox", Tag: "Communications", Summary: "List inbox messages",
+		Query: []openapi.Param{
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("page", openapi.Integer, "Page number, for page paging with a total"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+			openapi.Query("unread", openapi.Boolean, "Only unread (true) or only read (false) messages"),
+			openapi.Query("starred", openapi.Boolean, "Only starred (true) or only unstarred (false) messages"),
+			openapi.Query("direction", openapi.String, "inbound or outbound"),
+			openapi.Query("status", openapi.String, "Message status; scheduled lists messages waiting for their send time"),
+			openapi.Query("from", openapi.String, "Sent at or after (RFC 3339)"),
+			openapi.Query("to", openapi.String, "Sent at or before (RFC 3339)"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.CommMessage]{}).Described("total only with page paging")},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/inbox/summary", ID: "GetInboxSummary", Tag: "Communications", Summary: "Inbox summary",
+		Responses: []openapi.Response{openapi.OK(repositories.InboxSummary{})},
+		Errors:    []int{401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/search", ID: "SearchMessages", Tag: "Communications", Summary: "Search messages",
+		Query: []openapi.Param{
+			openapi.RequiredQuery("q", openapi.String, "Search text (at least 3 characters)"),
+			openapi.Query("channel", openapi.String, "Channel (default email)"),
+			openapi.Query("from", openapi.String, "Sent at or after (RFC 3339)"),
+			openapi.Query("to", openapi.String, "Sent at or before (RFC 3339)"),
+			openapi.Query("page", openapi.Integer, "Page number (default 1)"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.MessageSearchResponse{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/threads", ID: "ListThreads", Tag: "Communications", Summary: "List conversation threads",
+		Query: []openapi.Param{
+			openapi.Query("page", openapi.Integer, "Page number (default 1)"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+			openapi.Query("archived", openapi.Boolean, "Only archived (true) or only active (false) threads"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.ThreadListResponse{})},
+		Errors:    []int{400, 401, 500},
+	},
+	{
+		Method: http.MethodPatch, Path: "/communications/threads/{id}", ID: "UpdateThread", Tag: "Communications", Summary: "Update a thread",
+		Body:      handlers.UpdateThreadRequest{},
+		Responses: []openapi.Response{openapi.OK(repositories.MessageThread{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/threads/{id}/messages", ID: "GetThreadMessages", Tag: "Communications", Summary: "List thread messages",
+		Responses: []openapi.Response{openapi.OK(handlers.ThreadMessagesResponse{})},
+		Errors:    []int{400, 401, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/communications/messages", ID: "SendMessage", Tag: "Communications", Summary: "Send an email",
+		Body:      models.SendMessageRequest{},
+		Responses: []openapi.Response{openapi.Created(models.CommMessage{}).Described("Sent"), openapi.Accepted(models.CommMessage{}).Described("Scheduled, deferred to the send window, or queued for retry after a failed send")},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/communications/messages/{id}", ID: "CancelScheduledMessage", Tag: "Communications", Summary: "Cancel a scheduled email",
+		Responses: []openapi.Response{openapi.NoContent().Described("Cancelled")},
+		Errors:    []int{400, 401, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/communications/messages/{id}/attachments", ID: "UploadAttachment", Tag: "Communications", Summary: "Upload a message attachment",
+		Form: []openapi.Param{
+			openapi.FormFile("file", "File to attach"),
+			openapi.FormField("contentId", false, "Content-ID for inline images"),
+		},
+		Responses: []openapi.Response{openapi.Created(models.MessageAttachment{})},
+		Errors:    []int{400, 401, 403, 404, 413, 415, 422, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/attachments/{id}", ID: "DownloadAttachment", Tag: "Communications", Summary: "Download a message attachment",
+		Responses: []openapi.Response{openapi.Download(openapi.Binary)},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/lists", ID: "ListLists", Tag: "Communications", Summary: "List distribution lists",
+		Query: []openapi.Param{
+			openapi.Query("search", openapi.String, "Search in list name"),
+			openapi.Query("archived", openapi.Boolean, "Include archived lists"),
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("page", openapi.Integer, "Page number, for page paging with a total"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.DistributionList]{}).Described("total only with page paging")},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/communications/lists", ID: "CreateList", Tag: "Communications", Summary: "Create a distribution list",
+		Body:      models.CreateDistributionListRequest{},
+		Responses: []openapi.Response{openapi.Created(models.DistributionList{})},
+		Errors:    []int{400, 401, 409, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/lists/{id}", ID: "GetList", Tag: "Communications", Summary: "Get a distribution list",
+		Responses: []openapi.Response{openapi.OK(models.DistributionList{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPatch, Path: "/communications/lists/{id}", ID: "UpdateList", Tag: "Communications", Summary: "Update a distribution list",
+		Body:      models.UpdateDistributionListRequest{},
+		Responses: []openapi.Response{openapi.OK(models.DistributionList{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/communications/lists/{id}", ID: "DeleteList", Tag: "Communications", Summary: "Delete a distribution list",
+		Responses: []openapi.Response{openapi.NoContent().Described("Deleted")},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/lists/{id}/members", ID: "ListMembers", Tag: "Communications", Summary: "List distribution list members",
+		Query: []openapi.Param{
+			openapi.Query("cursor", openapi.String, "next_cursor of the previous page"),
+			openapi.Query("page", openapi.Integer, "Page number, for page paging with a total"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 100)"),
+		},
+		Responses: []openapi.Response{openapi.OK(pagination.Envelope[models.DistributionListMember]{}).Described("total only with page paging")},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/communications/lists/{id}/members", ID: "AddMembers", Tag: "Communications", Summary: "Add distribution list members",
+		Body:      models.DistributionListMembersRequest{},
+		Responses: []openapi.Response{openapi.OK(models.DistributionListMembersResult{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/communications/lists/{id}/members/remove", ID: "RemoveMembers", Tag: "Communications", Summary: "Remove distribution list members",
+		Body:      models.DistributionListMembersRequest{},
+		Responses: []openapi.Response{openapi.OK(models.DistributionListMembersResult{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/communications/lists/{id}/recipients", ID: "GetRecipients", Tag: "Communications", Summary: "Preview distribution list recipients",
+		Responses: []openapi.Response{openapi.OK(models.DistributionListExpansion{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+
+	// Email Tracking
+	{
+		Method: http.MethodGet, Path: "/track/open/{messageID}.gif", ID: "TrackOpen", Tag: "tracking", Summary: "Email open pixel", Public: true,
+		Responses: []openapi.Response{openapi.Download(openapi.GIF)},
+	},
+	{
+		Method: http.MethodGet, Path: "/track/click/{messageID}", ID: "TrackClick", Tag: "tracking", Summary: "Email click redirect", Public: true,
+		Query: []openapi.Param{
+			openapi.RequiredQuery("url", openapi.String, "Original link"),
+			openapi.RequiredQuery("sig", openapi.String, "Link signature"),
+		},
+		Responses: []openapi.Response{openapi.Redirect("Redirect")},
+		Errors:    []int{400},
+	},
+
+	// Provider Webhook
+	{
+		Method: http.MethodPost, Path: "/webhooks/email/delivery", ID: "HandleDeliveryStatus", Tag: "webhooks", Summary: "Email delivery status webhook", Public: true,
+		Header:    []openapi.Param{openapi.Header("X-Webhook-Signature", true, "HMAC-SHA256 of the body")},
+		Body:      []models.EmailDeliveryWebhook{},
+		Responses: []openapi.Response{openapi.OK(handlers.DeliveryWebhookResult{})},
+		Errors:    []int{400, 401, 503},
+	},
+
+	// Admin
+	{
+		Method: http.MethodPost, Path: "/admin/jwt/reload-keys", ID: "ReloadJWTKeys", Tag: "Admin", Summary: "Reload JWT keys",
+		Responses: []openapi.Response{openapi.OK(handlers.JWTKeysReloaded{}).Described("Keys reloaded")},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/cache/templates/stats", ID: "GetTemplateCacheStats", Tag: "Admin", Summary: "Template cache statistics",
+		Responses: []openapi.Response{openapi.OK(handlers.TemplateCacheStatsResponse{})},
+		Errors:    []int{401, 403},
+	},
+	{
+		Method: http.MethodDelete, Path: "/admin/cache/templates/{tenantId}", ID: "FlushTenantTemplateCache", Tag: "Admin", Summary: "Flush a tenant's template cache",
+		Responses: []openapi.Response{openapi.OK(handlers.TemplateCacheFlushed{}).Described("Cache flushed")},
+		Errors:    []int{400, 401, 403, 500, 503},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/emails", ID: "ListEmails", Tag: "Admin", Summary: "List outbound emails",
+		Query: []openapi.Param{
+			openapi.Query("status", openapi.String, "Delivery status, e.g. failed"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 200)"),
+			openapi.Query("offset", openapi.Integer, "Emails to skip"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[handlers.OutboundEmailPage]{})},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/emails/{id}/retry", ID: "RetryEmail", Tag: "Admin", Summary: "Retry an email",
+		Responses: []openapi.Response{openapi.Accepted(handlers.EmailRequeued{}).Described("Email requeued")},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/email-usage", ID: "GetEmailUsage", Tag: "Admin", Summary: "Email usage",
+		Responses: []openapi.Response{openapi.OK(services.EmailUsageReport{})},
+		Errors:    []int{401, 403, 500, 503},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/reports/weekly/trigger", ID: "TriggerWeeklyReport", Tag: "Admin", Summary: "Trigger the weekly reports",
+		Query: []openapi.Param{
+			openapi.Query("dryRun", openapi.Boolean, "Render without sending"),
+			openapi.Query("userId", openapi.String, "Send only this user's report"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.WeeklyReportTriggered{}).Described("Run summary, or the rendered reports on a dry run")},
+		Errors:    []int{400, 401, 403, 404, 409, 500, 503},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/roles", ID: "ListRoles", Tag: "Roles", Summary: "List roles",
+		Responses: []openapi.Response{openapi.OK(models.RolePermissionListResponse{})},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/roles", ID: "CreateRole", Tag: "Roles", Summary: "Create a custom role",
+		Body:      models.CreateCustomRoleRequest{},
+		Responses: []openapi.Response{openapi.Created(models.RolePermission{})},
+		Errors:    []int{400, 401, 403, 409, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/roles/{id}", ID: "GetRole", Tag: "Roles", Summary: "Get a role",
+		Responses: []openapi.Response{openapi.OK(models.RolePermission{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/roles/{id}", ID: "UpdateRole", Tag: "Roles", Summary: "Update a role",
+		Body:      models.UpdateRolePermissionsRequest{},
+		Responses: []openapi.Response{openapi.OK(models.RolePermission{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/admin/roles/{id}", ID: "DeleteRole", Tag: "Roles", Summary: "Delete a custom role",
+		Query: []openapi.Param{
+			openapi.Query("reassign_to", openapi.String, "ID of the role to move the role's users to"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.RoleDeletedResponse{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/users/{id}/roles", ID: "AssignUserRoles", Tag: "Roles", Summary: "Assign custom roles to a user",
+		Body:      models.AssignRolesRequest{},
+		Responses: []openapi.Response{openapi.OK(models.UserProfile{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/events", ID: "ListEvents", Tag: "Admin", Summary: "List outbox events",
+		Query: []openapi.Param{
+			openapi.Query("status", openapi.String, "pending, failed or published"),
+			openapi.Query("topic", openapi.String, "Kafka topic"),
+			openapi.Query("type", openapi.String, "Event type, e.g. template.created"),
+			openapi.Query("from", openapi.String, "Recorded at or after (RFC 3339)"),
+			openapi.Query("to", openapi.String, "Recorded before (RFC 3339)"),
+			openapi.Query("limit", openapi.Integer, "Page size (default 50, max 200)"),
+			openapi.Query("offset", openapi.Integer, "Events to skip"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[handlers.OutboxEventPage]{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/events/replay-failed", ID: "ReplayFailedEvents", Tag: "Admin", Summary: "Replay failed outbox events",
+		Body:      models.ReplayFailedEventsRequest{},
+		Responses: []openapi.Response{openapi.Accepted(models.EventReplayJob{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/events/replay-failed/{jobID}", ID: "GetReplayJob", Tag: "Admin", Summary: "Get a failed events replay",
+		Responses: []openapi.Response{openapi.OK(models.EventReplayJob{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/events/{id}", ID: "GetEvent", Tag: "Admin", Summary: "Get an outbox event",
+		Responses: []openapi.Response{openapi.OK(models.OutboxEvent{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/events/{id}/replay", ID: "ReplayEvent", Tag: "Admin", Summary: "Replay an outbox event",
+		Responses: []openapi.Response{openapi.Accepted(models.OutboxEvent{})},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/impersonate/{userID}", ID: "StartImpersonation", Tag: "Admin", Summary: "Start impersonating a user",
+		Body:      models.StartImpersonationRequest{},
+		Responses: []openapi.Response{openapi.Created(handlers.ImpersonationResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/admin/impersonate/{userID}", ID: "EndImpersonation", Tag: "Admin", Summary: "End impersonating a user",
+		Responses: []openapi.Response{openapi.OK(handlers.ImpersonationEnded{}).Described("Impersonation ended")},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/webhooks", ID: "ListWebhooks", Tag: "Webhooks", Summary: "List webhooks",
+		Responses: []openapi.Response{openapi.OK(handlers.WebhookListResponse{})},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/webhooks", ID: "CreateWebhook", Tag: "Webhooks", Summary: "Create a webhook",
+		Body:      models.CreateWebhookSubscriptionRequest{},
+		Responses: []openapi.Response{openapi.Created(handlers.WebhookSubscriptionCreated{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/webhooks/{id}", ID: "GetWebhook", Tag: "Webhooks", Summary: "Get a webhook",
+		Responses: []openapi.Response{openapi.OK(models.WebhookSubscription{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/webhooks/{id}", ID: "UpdateWebhook", Tag: "Webhooks", Summary: "Update a webhook",
+		Body:      models.UpdateWebhookSubscriptionRequest{},
+		Responses: []openapi.Response{openapi.OK(models.WebhookSubscription{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodDelete, Path: "/admin/webhooks/{id}", ID: "DeleteWebhook", Tag: "Webhooks", Summary: "Delete a webhook",
+		Responses: []openapi.Response{openapi.OK(handlers.MessageResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/webhooks/{id}/deliveries", ID: "ListWebhookDeliveries", Tag: "Webhooks", Summary: "List webhook deliveries",
+		Query: []openapi.Param{
+			openapi.Query("status", openapi.String, "pending, succeeded or failed"),
+			openapi.Query("page", openapi.Integer, "Page number (default 1)"),
+			openapi.Query("limit", openapi.Integer, "Page size"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.WebhookDeliveryListResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/webhooks/{id}/test", ID: "TestWebhook", Tag: "Webhooks", Summary: "Test a webhook",
+		Responses: []openapi.Response{openapi.OK(models.WebhookDelivery{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/deletion-requests", ID: "ListDeletionRequests", Tag: "Admin", Summary: "List account deletion requests",
+		Query: []openapi.Param{
+			openapi.Query("status", openapi.String, "pending, cancelled, completed or all"),
+			openapi.Query("page", openapi.Integer, "Page number"),
+			openapi.Query("limit", openapi.Integer, "Page size, at most 100"),
+		},
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[handlers.DeletionRequestPage]{})},
+		Errors:    []int{400, 401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/deletion-requests/{id}/cancel", ID: "CancelDeletionRequest", Tag: "Admin", Summary: "Cancel an account deletion request",
+		Responses: []openapi.Response{openapi.OK(handlers.DataResponse[*models.AccountDeletionRequest]{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/system-emails", ID: "ListSystemEmails", Tag: "Admin", Summary: "List system emails",
+		Responses: []openapi.Response{openapi.OK(map[string][]handlers.SystemEmailSummary{})},
+		Errors:    []int{401, 403},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/system-emails/{key}/preview", ID: "PreviewSystemEmail", Tag: "Admin", Summary: "Preview a system email override",
+		Query: []openapi.Param{
+			openapi.Query("locale", openapi.String, "Language of the default, e.g. es"),
+		},
+		Body:      handlers.SystemEmailPreviewRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.SystemEmailPreviewResponse{})},
+		Errors:    []int{400, 401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/regions", ID: "ListActiveRegions", Tag: "Reference Data", Summary: "List active regions or teams", Public: true,
+		Responses: []openapi.Response{openapi.OK(map[string][]models.ReferenceEntry{})},
+		Errors:    []int{500},
+	},
+	{
+		Method: http.MethodGet, Path: "/teams", ID: "ListActiveTeams", Tag: "Reference Data", Summary: "List active regions or teams", Public: true,
+		Responses: []openapi.Response{openapi.OK(map[string][]models.ReferenceEntry{})},
+		Errors:    []int{500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/regions", ID: "ListRegions", Tag: "Reference Data", Summary: "List all regions or teams",
+		Responses: []openapi.Response{openapi.OK(map[string][]models.ReferenceEntry{})},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/teams", ID: "ListTeams", Tag: "Reference Data", Summary: "List all regions or teams",
+		Responses: []openapi.Response{openapi.OK(map[string][]models.ReferenceEntry{})},
+		Errors:    []int{401, 403, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/regions", ID: "CreateRegion", Tag: "Reference Data", Summary: "Create a region or team",
+		Body:      models.CreateReferenceEntryRequest{},
+		Responses: []openapi.Response{openapi.Created(models.ReferenceEntry{})},
+		Errors:    []int{400, 401, 403, 409, 500},
+	},
+	{
+		Method: http.MethodPost, Path: "/admin/teams", ID: "CreateTeam", Tag: "Reference Data", Summary: "Create a region or team",
+		Body:      models.CreateReferenceEntryRequest{},
+		Responses: []openapi.Response{openapi.Created(models.ReferenceEntry{})},
+		Errors:    []int{400, 401, 403, 409, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/regions/{code}", ID: "GetRegion", Tag: "Reference Data", Summary: "Get a region or team",
+		Responses: []openapi.Response{openapi.OK(models.ReferenceEntry{})},
+		Errors:    []int{401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodGet, Path: "/admin/teams/{code}", ID: "GetTeam", Tag: "Reference Data", Summary: "Get a region or team",
+		Responses: []openapi.Response{openapi.OK(models.ReferenceEntry{})},
+		Errors:    []int{401, 403, 404, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/regions/{code}", ID: "UpdateRegion", Tag: "Reference Data", Summary: "Update a region or team",
+		Body:      models.UpdateReferenceEntryRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.ReferenceEntryUpdated{}).Described("entry and the number of users reassigned")},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+	{
+		Method: http.MethodPut, Path: "/admin/teams/{code}", ID: "UpdateTeam", Tag: "Reference Data", Summary: "Update a region or team",
+		Body:      models.UpdateReferenceEntryRequest{},
+		Responses: []openapi.Response{openapi.OK(handlers.ReferenceEntryUpdated{}).Described("entry and the number of users reassigned")},
+		Errors:    []int{400, 401, 403, 404, 409, 500},
+	},
+}
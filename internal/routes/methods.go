@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// allowCandidates are the methods checked when computing the Allow header
+var allowCandidates = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// methodNotAllowedHandler answers requests whose path matches a route of
+// router but whose method does not with 405 and an Allow header listing the
+// methods the path is registered for. Preflight OPTIONS requests are passed
+// to notFound, which answers them for paths that do not register OPTIONS.
+func methodNotAllowedHandler(router *mux.Router, notFound http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowedMethods(router, r), ", "))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(`{"error":{"code":"METHOD_NOT_ALLOWED","message":"Method not allowed"}}`))
+	})
+}
+
+// methodCheckedNotFound answers through methodNotAllowed the requests mux
+// found no route for whose path a route of router accepts with another
+// method, and passes the rest to notFound. Routes of a subrouter repeat its
+// path prefix matcher, which clears mux's method mismatch, so paths under
+// /api/v1 reach the not found handler rather than MethodNotAllowedHandler.
+func methodCheckedNotFound(router *mux.Router, notFound, methodNotAllowed http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(allowedMethods(router, r)) > 0 {
+			methodNotAllowed.ServeHTTP(w, r)
+			return
+		}
+		notFound.ServeHTTP(w, r)
+	})
+}
+
+// allowedMethods returns the methods a route of router accepts for the path
+// of r
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range allowCandidates {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
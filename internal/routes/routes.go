@@ -0,0 +1,609 @@
+// Package routes declares every HTTP route exposed by the User Management API.
+// Handlers are constructed here from a single dependency container so that each
+// path, method and middleware chain is visible in one place.
+package routes
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/cache"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/handlers"
+	"github.com/white/user-management/internal/middleware"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/mongodb"
+	"github.com/white/user-management/pkg/siem"
+	"github.com/white/user-management/pkg/smtp"
+	"github.com/white/user-management/pkg/storage"
+)
+
+// Dependencies holds the shared clients and services needed to build handlers.
+// Config and EmailSender are required; optional clients (Kafka, Redis, template cache) may be nil.
+type Dependencies struct {
+	Config         *config.Config
+	MongoClient    *mongodb.Client
+	KafkaProducer  *kafka.Producer
+	EmailSender    email.EmailSender
+	RedisClient    *redis.Client
+	TemplateCache  *cache.TemplateCache
+	AuditPublisher *events.AuditPublisher
+	JWTService     *utils.JWTService
+	JWKSCache      *utils.JWKSCache
+	RBACService    *services.RBACService
+	EmailTracker   *smtp.Tracker        // nil when open/click tracking is not configured
+	EmailQueue     *services.EmailQueue // nil sends system emails during the request
+	Notifications  *services.NotificationService
+	WeeklyReports  *services.WeeklyReportJob
+	EmailQuota     *services.EmailQuota // nil when send limits are not tracked
+	SSO            *services.SSOService // nil when OIDC is not configured
+	Webhooks       *services.WebhookDispatcher
+	Passwords      *password.Hasher // Hashes passwords at the configured cost
+	SystemEmails   *services.SystemEmails
+	EmailBranding  *services.EmailBranding        // Branding of system emails, from the company info
+	LoginHistory   *services.LoginHistoryRecorder // nil records no sign-in attempts
+	SMSCodes       *services.SMSCodes             // Texts 2FA and phone verification codes
+	AuditForwarder *siem.Forwarder                // nil when audit events are not sent to a SIEM
+	Sessions       *services.SessionActivity      // Times out sessions left idle; nil records no activity
+	Presence       *services.Presence             // Records when users were last seen; nil records nothing
+	Languages      *services.UserLanguages        // Users' language preferences; nil localizes by Accept-Language alone
+	SendWindow     *services.SendWindowEnforcer   // Holds messages sent outside working hours; nil sends at any time
+	AccountClosing *services.AccountClosing       // Self-service deactivation and deletion; nil leaves the routes out
+	Denials        *services.PermissionDenials    // Audits and throttles denied requests; nil only answers them with 403
+	Lists          *services.DistributionLists    // Resolves distribution lists of messages; nil leaves the routes out
+
+	AttachmentStorage storage.Storage
+	AttachmentScanner storage.Scanner // nil accepts every upload unscanned
+}
+
+// middlewareFunc is the signature shared by every gorilla/mux compatible middleware
+type middlewareFunc func(http.Handler) http.Handler
+
+// routeGroup bundles a subrouter with the auth middleware used by its routes.
+// Admin routes are mounted on admin by adminRoute, self-service routes on
+// api with protected, and the unauthenticated auth routes with public.
+type routeGroup struct {
+	api   *mux.Router
+	admin *mux.Router // /api/v1/admin
+	auth  middlewareFunc
+	limit middlewareFunc // Per-client rate limit of the unauthenticated auth routes
+	perms *middleware.PermissionEnforcer
+}
+
+// protected wraps a handler with JWT authentication and the DB-backed RBAC context,
+// followed by any route-specific authorization middleware (applied in order)
+func (g *routeGroup) protected(hf http.HandlerFunc, mws ...middlewareFunc) http.Handler {
+	var h http.Handler = hf
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return g.auth(h)
+}
+
+// public wraps the handler of an unauthenticated auth route with the
+// per-client rate limit
+func (g *routeGroup) public(hf http.HandlerFunc) http.Handler {
+	return g.limit(hf)
+}
+
+// RegisterRoutes constructs all handlers from deps and mounts them on router.
+// API routes live under /api/v1; /health and /openapi.json are mounted at the root.
+func RegisterRoutes(router *mux.Router, deps *Dependencies) {
+	// Paths that exist but not for the request's method answer 405 with the
+	// methods they do accept, rather than a misleading 404. The not found
+	// handler the caller installed answers the rest.
+	notFound := router.NotFoundHandler
+	if notFound == nil {
+		notFound = http.NotFoundHandler()
+	}
+	router.MethodNotAllowedHandler = methodNotAllowedHandler(router, notFound)
+	router.NotFoundHandler = methodCheckedNotFound(router, notFound, router.MethodNotAllowedHandler)
+
+	// Health check endpoints
+	healthHandler := handlers.NewHealthHandler(deps.KafkaProducer)
+	healthHandler.SetAuditForwarder(deps.AuditForwarder)
+	router.HandleFunc("/health", healthHandler.GetOverallHealth).Methods("GET", "OPTIONS")
+	// OpenAPI 3 description of the routes below, for client generators
+	router.HandleFunc("/openapi.json", serveContract()).Methods("GET", "OPTIONS")
+
+	// JWT authentication followed by DB-backed RBAC context for authZ
+	baseAuth := middleware.JWTAuthDualAlg(deps.JWTService, deps.JWKSCache, deps.Config.JWT.SharedSecret)
+	rbacContext := middleware.RBACContext(deps.RBACService)
+	// Responses are in the language of the user's preferences when they chose one
+	language := middleware.Language(deps.Languages)
+	// Impersonation tokens stop working as soon as their session is ended
+	impersonationGuard := middleware.ImpersonationGuard(repositories.NewImpersonationRepository(deps.MongoClient))
+	// Requests keep the session their token was issued for from timing out
+	sessionActivity := middleware.SessionActivity(deps.Sessions)
+	// Requests mark their user as seen, for presence on the team pages
+	presence := middleware.Presence(deps.Presence)
+
+	// Route-level authorization, falling back to a repository lookup when a
+	// request carries no permission claims
+	var permissionLookup middleware.PermissionLookup
+	if deps.RBACService != nil {
+		permissionLookup = deps.RBACService.UserPermissionLookup(repositories.NewMongoUserRepository(deps.MongoClient))
+	}
+
+	api := router.PathPrefix(basePath).Subrouter()
+	group := &routeGroup{
+		api:   api,
+		admin: api.PathPrefix("/admin").Subrouter(),
+		auth: func(h http.Handler) http.Handler {
+			return baseAuth(language(impersonationGuard(sessionActivity(presence(rbacContext(h))))))
+		},
+		limit: middleware.RateLimit(deps.Config.Server.AuthRateLimit, time.Minute),
+		perms: middleware.NewPermissionEnforcer(permissionLookup),
+	}
+	if deps.Denials != nil {
+		group.perms.SetDenials(deps.Denials)
+	}
+	// JSON bodies over the configured size are refused before they are read
+	group.api.Use(middleware.BodyLimit(int64(deps.Config.Server.MaxBodyBytes)))
+
+	registerAuthRoutes(group, deps)
+	registerTeamRoutes(group, deps)
+	registerUserRoutes(group, deps)
+	registerSettingsRoutes(group, deps)
+	registerNotificationRoutes(group, deps)
+	registerTemplateRoutes(group, deps)
+	registerSequenceRoutes(group, deps)
+	registerScheduleRoutes(group, deps)
+	registerCommunicationRoutes(group, deps)
+	registerTrackingRoutes(group, deps)
+	registerWebhookRoutes(group, deps)
+	registerAdminRoutes(group, deps)
+}
+
+// =====================================================
+// Authentication Routes
+// =====================================================
+
+func registerAuthRoutes(g *routeGroup, deps *Dependencies) {
+	authHandler := handlers.NewAuthHandler(deps.MongoClient, deps.Config, deps.KafkaProducer, deps.EmailSender, deps.JWTService)
+	authHandler.SetAuditPublisher(deps.AuditPublisher)
+	authHandler.SetEmailQueue(deps.EmailQueue)
+	authHandler.SetNotificationService(deps.Notifications)
+	authHandler.SetSSOService(deps.SSO)
+	authHandler.SetRBACService(deps.RBACService)
+	authHandler.SetPasswordHasher(deps.Passwords)
+	authHandler.SetSystemEmails(deps.SystemEmails)
+	authHandler.SetLoginHistory(deps.LoginHistory)
+	authHandler.SetSMSCodes(deps.SMSCodes)
+	authHandler.SetSessionActivity(deps.Sessions)
+	loginHistoryHandler := handlers.NewLoginHistoryHandler(repositories.NewLoginHistoryRepository(deps.MongoClient), repositories.NewMongoUserRepository(deps.MongoClient))
+
+	g.api.Handle("/auth/login", g.public(authHandler.Login)).Methods("POST", "OPTIONS")
+	g.api.Handle("/auth/verify-2fa", g.public(authHandler.Verify2FA)).Methods("POST", "OPTIONS")
+	g.api.Handle("/auth/logout", g.public(authHandler.Logout)).Methods("POST", "OPTIONS")
+	g.api.Handle("/auth/refresh", g.public(authHandler.RefreshToken)).Methods("POST", "OPTIONS")
+	g.api.Handle("/auth/password/change", g.public(authHandler.ChangePassword)).Methods("POST", "OPTIONS")
+	g.api.Handle("/auth/password/forgot", g.public(authHandler.ForgotPassword)).Methods("POST", "OPTIONS")
+	g.api.Handle("/auth/password/reset", g.public(authHandler.ResetPassword)).Methods("POST", "OPTIONS")
+	g.api.Handle("/auth/me", g.protected(authHandler.Me)).Methods("GET", "OPTIONS")
+	g.api.Handle("/auth/sessions", g.protected(authHandler.ListSessions)).Methods("GET", "OPTIONS")
+	g.api.Handle("/auth/login-history", g.protected(loginHistoryHandler.GetMyLoginHistory)).Methods("GET", "OPTIONS")
+
+	// SSO sign-in is public - the identity provider authenticates the caller
+	g.api.Handle("/auth/sso/login", g.public(authHandler.SSOLogin)).Methods("GET", "OPTIONS")
+	g.api.Handle("/auth/sso/callback", g.public(authHandler.SSOCallback)).Methods("GET", "OPTIONS")
+}
+
+// =====================================================
+// Team Routes
+// =====================================================
+
+func registerTeamRoutes(g *routeGroup, deps *Dependencies) {
+	teamHandler := handlers.NewTeamHandler(deps.MongoClient, deps.EmailSender, deps.KafkaProducer, deps.AuditPublisher, deps.Config.App.BaseURL)
+	teamHandler.SetRequireVersion(deps.Config.App.RequiresVersion(config.VersionedTeamMembers))
+	teamHandler.SetEmailQueue(deps.EmailQueue)
+	teamHandler.SetPasswordHasher(deps.Passwords)
+	teamHandler.SetSystemEmails(deps.SystemEmails)
+	teamHandler.SetRBACService(deps.RBACService)
+	teamHandler.SetExportMaxRows(deps.Config.Reports.ExportMaxRows)
+
+	canView := g.perms.RequirePermission(models.PermTeamMembersView)
+	canInvite := g.perms.RequirePermission(models.PermTeamMembersInvite)
+	canUpdate := g.perms.RequirePermission(models.PermTeamMembersUpdate)
+	canDelete := g.perms.RequirePermission(models.PermTeamMembersDelete)
+
+	adminOnly := g.perms.RequireRole(models.RoleAdmin)
+
+	g.adminRoute("GET", "/team/members", teamHandler.ListTeamMembers, canView)
+	g.adminRoute("POST", "/team/members/invite", teamHandler.InviteTeamMember, canInvite)
+	// Registered before /team/members/{id}, which would otherwise take it
+	g.adminRoute("GET", "/team/members/export", teamHandler.ExportTeamMembers, adminOnly)
+	g.adminRoute("GET", "/team/members/{id}", teamHandler.GetTeamMember, canView)
+	g.adminRoute("PUT", "/team/members/{id}", teamHandler.UpdateTeamMember, canUpdate)
+	g.adminRoute("DELETE", "/team/members/{id}", teamHandler.DeleteTeamMember, canDelete)
+	g.adminRoute("POST", "/team/members/{id}/deactivate", teamHandler.DeactivateTeamMember, canUpdate)
+	g.adminRoute("POST", "/team/members/{id}/reactivate", teamHandler.ReactivateTeamMember, canUpdate)
+
+	// Bulk import creates invited users like the invite endpoint does
+	userImports := repositories.NewUserImportRepository(deps.MongoClient)
+	importer := services.NewUserImporter(userImports, repositories.NewReferenceDataRepository(deps.MongoClient), deps.Config.App.BaseURL)
+	importer.SetInviteHook(teamHandler.InviteImportedUsers)
+	userImportHandler := handlers.NewUserImportHandler(importer, userImports, deps.AuditPublisher)
+	g.adminRoute("POST", "/users/import", userImportHandler.ImportUsers, adminOnly)
+	g.adminRoute("GET", "/users/import/{jobID}", userImportHandler.GetUserImport, adminOnly)
+
+	// Invitation acceptance is public - the invite token authenticates the caller
+	g.api.Handle("/auth/verify-invite", g.public(teamHandler.VerifyInviteToken)).Methods("GET", "OPTIONS")
+	g.api.Handle("/auth/complete-signup", g.public(teamHandler.CompleteSignup)).Methods("POST", "OPTIONS")
+}
+
+// =====================================================
+// User Directory Routes (Admin)
+// =====================================================
+
+func registerUserRoutes(g *routeGroup, deps *Dependencies) {
+	userHandler := handlers.NewUserHandler(repositories.NewMongoUserRepository(deps.MongoClient))
+	userHandler.SetRBACService(deps.RBACService)
+	loginHistoryHandler := handlers.NewLoginHistoryHandler(repositories.NewLoginHistoryRepository(deps.MongoClient), repositories.NewMongoUserRepository(deps.MongoClient))
+	onboardingHandler := handlers.NewOnboardingHandler(services.NewOnboardingService(
+		repositories.NewSettingsRepository(deps.MongoClient),
+		repositories.NewLoginHistoryRepository(deps.MongoClient),
+		repositories.NewMongoActivityRepository(deps.MongoClient),
+		repositories.NewMongoEmailRepository(deps.MongoClient),
+	))
+	adminOnly := g.perms.RequireRole(models.RoleAdmin)
+
+	// Self-service; registered before /users/{id} routes
+	g.api.Handle("/users/me/onboarding", g.protected(onboardingHandler.GetMyOnboarding)).Methods("GET", "OPTIONS")
+	g.api.Handle("/users/me/onboarding/{item}/dismiss", g.protected(onboardingHandler.DismissOnboardingItem)).Methods("PATCH", "OPTIONS")
+
+	// Batch lookup for other services, which authenticate with a users:read service token
+	g.api.Handle("/users/lookup", g.protected(userHandler.LookupUsers, g.perms.RequireRoleOrPermission("users:read", models.RoleAdmin))).Methods("POST", "OPTIONS")
+
+	g.adminRoute("GET", "/users", userHandler.ListUsers, adminOnly)
+	g.adminRoute("GET", "/users/stats", userHandler.GetUserStats, adminOnly)
+	g.adminRoute("GET", "/users/{id}/data-scope", userHandler.GetUserDataScope, adminOnly)
+	g.adminRoute("PUT", "/users/{id}/data-scope", userHandler.UpdateUserDataScope, adminOnly, middleware.RefuseImpersonation)
+	g.adminRoute("GET", "/users/{id}/reports", userHandler.GetUserReports, adminOnly)
+	g.adminRoute("GET", "/users/{id}/management-chain", userHandler.GetUserManagementChain, adminOnly)
+	g.adminRoute("GET", "/users/{id}/login-history", loginHistoryHandler.GetUserLoginHistory, adminOnly)
+}
+
+// =====================================================
+// Settings Routes
+// =====================================================
+
+func registerSettingsRoutes(g *routeGroup, deps *Dependencies) {
+	settingsRepo := repositories.NewSettingsRepository(deps.MongoClient)
+	settingsHandler := handlers.NewSettingsHandler(settingsRepo, deps.AuditPublisher)
+	settingsHandler.SetUserStore(repositories.NewMongoUserRepository(deps.MongoClient))
+	settingsHandler.SetRequireVersion(deps.Config.App.RequiresVersion(config.VersionedSystemSecurity))
+	settingsHandler.SetEmailBranding(deps.EmailBranding)
+	settingsHandler.SetSendWindow(deps.SendWindow)
+	settingsHandler.SetExportMaxRows(deps.Config.Reports.ExportMaxRows)
+
+	// User Settings (Profile is read-only - managed by O365)
+	g.api.Handle("/settings/profile", g.protected(settingsHandler.GetProfile)).Methods("GET", "OPTIONS")
+	// Appended to the emails the user sends while enabled
+	g.api.Handle("/settings/email-signature", g.protected(settingsHandler.GetEmailSignature)).Methods("GET", "OPTIONS")
+	g.api.Handle("/settings/email-signature", g.protected(settingsHandler.UpdateEmailSignature, middleware.RefuseImpersonation)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/settings/email-signature/preview", g.protected(settingsHandler.PreviewEmailSignature)).Methods("GET", "OPTIONS")
+	// When outbound messages are sent, so deferrals can be explained
+	g.api.Handle("/settings/send-window", g.protected(settingsHandler.GetSendWindow)).Methods("GET", "OPTIONS")
+
+	// Closing the caller's own account; deletions can be cancelled during
+	// the grace period
+	if deps.AccountClosing != nil {
+		accountHandler := newAccountHandler(deps)
+		g.api.Handle("/settings/account/deactivate", g.protected(accountHandler.DeactivateAccount, middleware.RefuseImpersonation)).Methods("POST", "OPTIONS")
+		g.api.Handle("/settings/account/delete-request", g.protected(accountHandler.RequestAccountDeletion, middleware.RefuseImpersonation)).Methods("POST", "OPTIONS")
+		g.api.Handle("/settings/account/cancel-deletion", g.protected(accountHandler.CancelAccountDeletion, middleware.RefuseImpersonation)).Methods("POST", "OPTIONS")
+	}
+
+	// The caller's own 2FA settings and phone number
+	securityHandler := handlers.NewSecuritySettingsHandler(settingsRepo, deps.SMSCodes)
+	g.api.Handle("/settings/security", g.protected(securityHandler.GetSecuritySettings)).Methods("GET", "OPTIONS")
+	g.api.Handle("/settings/security", g.protected(securityHandler.UpdateSecuritySettings, middleware.RefuseImpersonation)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/settings/security/phone", g.protected(securityHandler.StartPhoneVerification, middleware.RefuseImpersonation)).Methods("POST", "OPTIONS")
+	g.api.Handle("/settings/security/phone", g.protected(securityHandler.RemovePhoneNumber, middleware.RefuseImpersonation)).Methods("DELETE", "OPTIONS")
+	g.api.Handle("/settings/security/phone/verify", g.protected(securityHandler.VerifyPhoneNumber, middleware.RefuseImpersonation)).Methods("POST", "OPTIONS")
+
+	// System Settings (Admin)
+	canView := g.perms.RequirePermission(models.PermSystemSettingsView)
+	canUpdate := g.perms.RequirePermission(models.PermSystemSettingsUpdate)
+
+	g.adminRoute("GET", "/system/company", settingsHandler.GetCompanyInfo, canView)
+	g.adminRoute("PUT", "/system/company", settingsHandler.UpdateCompanyInfo, canUpdate)
+	g.adminRoute("GET", "/system/notifications", settingsHandler.GetNotificationSettings, canView)
+	g.adminRoute("PUT", "/system/notifications", settingsHandler.UpdateNotificationSettings, canUpdate)
+	g.adminRoute("GET", "/system/defaults", settingsHandler.GetSystemDefaultSettings, canView)
+	g.adminRoute("PUT", "/system/defaults", settingsHandler.UpdateSystemDefaultSettings, canUpdate)
+	g.adminRoute("GET", "/system/security", settingsHandler.GetSystemSecuritySettings, canView)
+	g.adminRoute("PUT", "/system/security", settingsHandler.UpdateSystemSecuritySettings, canUpdate, middleware.RefuseImpersonation)
+	g.adminRoute("GET", "/system/email-notifications", settingsHandler.GetSystemEmailNotificationSettings, canView)
+	g.adminRoute("PUT", "/system/email-notifications", settingsHandler.UpdateSystemEmailNotificationSettings, canUpdate)
+	g.adminRoute("GET", "/system/audit-logs", settingsHandler.GetAuditLogs, g.perms.RequirePermission(models.PermAuditLogsView))
+	g.adminRoute("GET", "/system/audit-logs/export", settingsHandler.ExportAuditLogs, g.perms.RequirePermission(models.PermAuditLogsView))
+	// Requests refused for a missing permission or role, for security review
+	if deps.Denials != nil {
+		settingsHandler.SetPermissionDenials(deps.Denials)
+		g.adminRoute("GET", "/system/audit-logs/permission-denials", settingsHandler.GetPermissionDenials, g.perms.RequirePermission(models.PermAuditLogsView))
+	}
+}
+
+// =====================================================
+// Notification Routes
+// =====================================================
+
+func registerNotificationRoutes(g *routeGroup, deps *Dependencies) {
+	notificationHandler := handlers.NewNotificationHandler(repositories.NewNotificationRepository(deps.MongoClient))
+
+	g.api.Handle("/notifications", g.protected(notificationHandler.ListNotifications)).Methods("GET", "OPTIONS")
+	g.api.Handle("/notifications/{id}/read", g.protected(notificationHandler.MarkNotificationRead)).Methods("PATCH", "OPTIONS")
+}
+
+// =====================================================
+// Template Routes
+// =====================================================
+
+func registerTemplateRoutes(g *routeGroup, deps *Dependencies) {
+	templateRepo := repositories.NewMongoTemplateRepository(deps.MongoClient)
+	activityRepo := repositories.NewMongoActivityRepository(deps.MongoClient)
+	userRepo := repositories.NewMongoUserRepository(deps.MongoClient)
+	emailRepo := repositories.NewMongoEmailRepository(deps.MongoClient)
+	settingsRepo := repositories.NewSettingsRepository(deps.MongoClient)
+	eventOutbox := repositories.NewEventOutboxRepository(deps.MongoClient)
+	templateHandler := handlers.NewTemplateHandler(templateRepo, activityRepo, eventOutbox, userRepo, deps.TemplateCache, emailRepo, settingsRepo, deps.EmailSender, g.perms)
+	templateHandler.SetNotificationService(deps.Notifications)
+	templateHandler.SetRequireVersion(deps.Config.App.RequiresVersion(config.VersionedTemplates))
+	if deps.RBACService != nil {
+		templateHandler.SetApproverLookup(func(ctx context.Context) ([]*models.User, error) {
+			return deps.RBACService.UsersWithPermission(ctx, userRepo, models.PermTemplatesApprove)
+		})
+	}
+
+	g.api.Handle("/templates", g.protected(templateHandler.ListTemplates)).Methods("GET", "OPTIONS")
+	g.api.Handle("/templates", g.protected(templateHandler.CreateTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/bulk", g.protected(templateHandler.BulkTemplates)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/export", g.protected(templateHandler.ExportTemplates)).Methods("GET", "OPTIONS")
+	g.api.Handle("/templates/import", g.protected(templateHandler.ImportTemplates)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/tags", g.protected(templateHandler.ListTemplateTags)).Methods("GET", "OPTIONS")
+	g.api.Handle("/templates/tags/{name}", g.protected(templateHandler.RenameTemplateTag)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/templates/preview", g.protected(templateHandler.PreviewDraftTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/lint", g.protected(templateHandler.LintDraftTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/trash", g.protected(templateHandler.ListTrashTemplates)).Methods("GET", "OPTIONS")
+	g.api.Handle("/templates/{id}", g.protected(templateHandler.GetTemplate)).Methods("GET", "OPTIONS")
+	g.api.Handle("/templates/{id}", g.protected(templateHandler.UpdateTemplate)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/templates/{id}", g.protected(templateHandler.DeleteTemplate, g.perms.RequirePermission(models.PermTemplatesDelete))).Methods("DELETE", "OPTIONS")
+	g.api.Handle("/templates/{id}/duplicate", g.protected(templateHandler.DuplicateTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/convert", g.protected(templateHandler.ConvertTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/archive", g.protected(templateHandler.ArchiveTemplate)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/templates/{id}/restore", g.protected(templateHandler.RestoreTemplate)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/templates/{id}/restore", g.protected(templateHandler.RestoreDeletedTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/submit-for-approval", g.protected(templateHandler.SubmitTemplateForApproval)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/approve", g.protected(templateHandler.ApproveTemplate, g.perms.RequirePermission(models.PermTemplatesApprove))).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/reject", g.protected(templateHandler.RejectTemplate, g.perms.RequirePermission(models.PermTemplatesApprove))).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/publish", g.protected(templateHandler.PublishTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/unpublish", g.protected(templateHandler.UnpublishTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/preview", g.protected(templateHandler.PreviewTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/lint", g.protected(templateHandler.LintTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/send-test", g.protected(templateHandler.SendTestTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/templates/{id}/stats", g.protected(templateHandler.GetTemplateStats)).Methods("GET", "OPTIONS")
+}
+
+// =====================================================
+// Sequence Routes
+// =====================================================
+
+func registerSequenceRoutes(g *routeGroup, deps *Dependencies) {
+	sequenceRepo := repositories.NewSequenceTemplateRepository(deps.MongoClient)
+	activityRepo := repositories.NewMongoActivityRepository(deps.MongoClient)
+	userRepo := repositories.NewMongoUserRepository(deps.MongoClient)
+	scheduleRepo := repositories.NewScheduleDefinitionRepository(deps.MongoClient)
+	settingsRepo := repositories.NewSettingsRepository(deps.MongoClient)
+	eventOutbox := repositories.NewEventOutboxRepository(deps.MongoClient)
+	sequenceHandler := handlers.NewSequenceTemplateHandler(sequenceRepo, activityRepo, userRepo, scheduleRepo, settingsRepo, eventOutbox)
+
+	g.api.Handle("/sequences", g.protected(sequenceHandler.ListSequenceTemplates)).Methods("GET", "OPTIONS")
+	g.api.Handle("/sequences", g.protected(sequenceHandler.CreateSequenceTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/sequences/{id}", g.protected(sequenceHandler.GetSequenceTemplate)).Methods("GET", "OPTIONS")
+	g.api.Handle("/sequences/{id}", g.protected(sequenceHandler.UpdateSequenceTemplate)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/sequences/{id}", g.protected(sequenceHandler.DeleteSequenceTemplate)).Methods("DELETE", "OPTIONS")
+	g.api.Handle("/sequences/{id}/clone", g.protected(sequenceHandler.CloneSequenceTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/sequences/{id}/validate", g.protected(sequenceHandler.ValidateSequenceTemplate)).Methods("POST", "OPTIONS")
+	g.api.Handle("/sequences/{id}/schedule-preview", g.protected(sequenceHandler.PreviewSequenceSchedule)).Methods("GET", "OPTIONS")
+}
+
+// =====================================================
+// Campaign Schedule Definition Routes
+// =====================================================
+
+func registerScheduleRoutes(g *routeGroup, deps *Dependencies) {
+	scheduleDefinitionRepo := repositories.NewScheduleDefinitionRepository(deps.MongoClient)
+	activityRepo := repositories.NewMongoActivityRepository(deps.MongoClient)
+	schedulerHandler := handlers.NewSchedulerHandler(scheduleDefinitionRepo, activityRepo)
+
+	// Campaign Schedule Definitions - MUST come BEFORE /campaigns/{id} to avoid route conflict
+	g.api.Handle("/campaigns/schedule-definitions", g.protected(schedulerHandler.GetScheduleDefinitions)).Methods("GET", "OPTIONS")
+	g.api.Handle("/campaigns/schedule-definitions", g.protected(schedulerHandler.CreateScheduleDefinition)).Methods("POST", "OPTIONS")
+	g.api.Handle("/campaigns/schedule-definitions/{id}", g.protected(schedulerHandler.UpdateScheduleDefinition)).Methods("PUT", "OPTIONS")
+	g.api.Handle("/campaigns/schedule-definitions/{id}", g.protected(schedulerHandler.DeleteScheduleDefinition)).Methods("DELETE", "OPTIONS")
+	log.Println("Campaign Schedule Definition CRUD routes registered (4 endpoints)")
+}
+
+// =====================================================
+// Communication Routes
+// =====================================================
+
+func registerCommunicationRoutes(g *routeGroup, deps *Dependencies) {
+	emailRepo := repositories.NewMongoEmailRepository(deps.MongoClient)
+	settingsRepo := repositories.NewSettingsRepository(deps.MongoClient)
+	communicationHandler := handlers.NewCommunicationHandler(emailRepo, deps.EmailSender, settingsRepo)
+	communicationHandler.SetSendWindow(deps.SendWindow)
+	attachmentHandler := handlers.NewAttachmentHandler(
+		emailRepo,
+		deps.AttachmentStorage,
+		deps.AttachmentScanner,
+		g.perms,
+		deps.Config.Attachments.MaxUploadMB,
+		deps.Config.Attachments.AllowedTypes,
+	)
+
+	g.api.Handle("/communications/inbox", g.protected(communicationHandler.GetInbox)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/inbox/summary", g.protected(communicationHandler.GetInboxSummary)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/search", g.protected(communicationHandler.SearchMessages)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/threads", g.protected(communicationHandler.ListThreads)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/threads/{id}", g.protected(communicationHandler.UpdateThread)).Methods("PATCH", "OPTIONS")
+	g.api.Handle("/communications/threads/{id}/messages", g.protected(communicationHandler.GetThreadMessages)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/messages", g.protected(communicationHandler.SendMessage)).Methods("POST", "OPTIONS")
+	g.api.Handle("/communications/messages/{id}", g.protected(communicationHandler.CancelScheduledMessage)).Methods("DELETE", "OPTIONS")
+	g.api.Handle("/communications/messages/{id}/attachments", g.protected(attachmentHandler.UploadAttachment)).Methods("POST", "OPTIONS")
+	g.api.Handle("/communications/attachments/{id}", g.protected(attachmentHandler.DownloadAttachment)).Methods("GET", "OPTIONS")
+
+	// Distribution lists, scoped like campaigns
+	if deps.Lists == nil {
+		return
+	}
+	listRepo := repositories.NewDistributionListRepository(deps.MongoClient)
+	userRepo := repositories.NewMongoUserRepository(deps.MongoClient)
+	communicationHandler.SetDistributionLists(listRepo, deps.Lists, userRepo)
+	listHandler := handlers.NewDistributionListHandler(listRepo, deps.Lists, emailRepo, userRepo)
+	g.api.Handle("/communications/lists", g.protected(listHandler.ListLists)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/lists", g.protected(listHandler.CreateList)).Methods("POST", "OPTIONS")
+	g.api.Handle("/communications/lists/{id}", g.protected(listHandler.GetList)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/lists/{id}", g.protected(listHandler.UpdateList)).Methods("PATCH", "OPTIONS")
+	g.api.Handle("/communications/lists/{id}", g.protected(listHandler.DeleteList)).Methods("DELETE", "OPTIONS")
+	g.api.Handle("/communications/lists/{id}/members", g.protected(listHandler.ListMembers)).Methods("GET", "OPTIONS")
+	g.api.Handle("/communications/lists/{id}/members", g.protected(listHandler.AddMembers)).Methods("POST", "OPTIONS")
+	g.api.Handle("/communications/lists/{id}/members/remove", g.protected(listHandler.RemoveMembers)).Methods("POST", "OPTIONS")
+	g.api.Handle("/communications/lists/{id}/recipients", g.protected(listHandler.GetRecipients)).Methods("GET", "OPTIONS")
+}
+
+// =====================================================
+// Email Tracking Routes (public - hit by mail clients)
+// =====================================================
+
+func registerTrackingRoutes(g *routeGroup, deps *Dependencies) {
+	trackingHandler := handlers.NewTrackingHandler(repositories.NewMongoEmailRepository(deps.MongoClient), deps.EmailTracker)
+
+	g.api.HandleFunc("/track/open/{messageID}.gif", trackingHandler.TrackOpen).Methods("GET", "HEAD")
+	g.api.HandleFunc("/track/click/{messageID}", trackingHandler.TrackClick).Methods("GET", "HEAD")
+}
+
+// =====================================================
+// Provider Webhook Routes (public - authenticated by signature)
+// =====================================================
+
+func registerWebhookRoutes(g *routeGroup, deps *Dependencies) {
+	webhookHandler := handlers.NewEmailWebhookHandler(
+		repositories.NewMongoEmailRepository(deps.MongoClient),
+		repositories.NewEmailSuppressionRepository(deps.MongoClient),
+		deps.KafkaProducer,
+		deps.Config.Email.WebhookSecret,
+	)
+
+	g.api.HandleFunc("/webhooks/email/delivery", webhookHandler.HandleDeliveryStatus).Methods("POST")
+}
+
+// =====================================================
+// Admin Routes
+// =====================================================
+
+func registerAdminRoutes(g *routeGroup, deps *Dependencies) {
+	adminHandler := handlers.NewAdminHandler(deps.JWTService, deps.TemplateCache, repositories.NewMongoEmailRepository(deps.MongoClient))
+	adminHandler.SetWeeklyReportJob(deps.WeeklyReports)
+	adminHandler.SetEmailQuota(deps.EmailQuota)
+	adminOnly := g.perms.RequireRole(models.RoleAdmin)
+
+	g.adminRoute("POST", "/jwt/reload-keys", adminHandler.ReloadJWTKeys, adminOnly)
+	g.adminRoute("GET", "/cache/templates/stats", adminHandler.GetTemplateCacheStats, adminOnly)
+	g.adminRoute("DELETE", "/cache/templates/{tenantId}", adminHandler.FlushTenantTemplateCache, adminOnly)
+	g.adminRoute("GET", "/emails", adminHandler.ListEmails, adminOnly)
+	g.adminRoute("POST", "/emails/{id}/retry", adminHandler.RetryEmail, adminOnly)
+	g.adminRoute("GET", "/email-usage", adminHandler.GetEmailUsage, adminOnly)
+	g.adminRoute("POST", "/reports/weekly/trigger", adminHandler.TriggerWeeklyReport, adminOnly)
+
+	// Built-in and custom roles; users hold custom roles on top of their own
+	if deps.RBACService != nil {
+		roleHandler := handlers.NewRoleHandler(deps.RBACService, repositories.NewMongoUserRepository(deps.MongoClient), deps.AuditPublisher)
+		canManageRoles := g.perms.RequirePermission(models.PermRolesManage)
+		g.adminRoute("GET", "/roles", roleHandler.ListRoles, canManageRoles)
+		g.adminRoute("POST", "/roles", roleHandler.CreateRole, canManageRoles, middleware.RefuseImpersonation)
+		g.adminRoute("GET", "/roles/{id}", roleHandler.GetRole, canManageRoles)
+		g.adminRoute("PUT", "/roles/{id}", roleHandler.UpdateRole, canManageRoles, middleware.RefuseImpersonation)
+		g.adminRoute("DELETE", "/roles/{id}", roleHandler.DeleteRole, canManageRoles, middleware.RefuseImpersonation)
+		g.adminRoute("PUT", "/users/{id}/roles", roleHandler.AssignUserRoles, canManageRoles, middleware.RefuseImpersonation)
+	}
+
+	// Events outbox inspection and replays
+	eventAdminHandler := handlers.NewEventAdminHandler(
+		repositories.NewEventOutboxRepository(deps.MongoClient),
+		services.NewEventReplays(repositories.NewEventOutboxRepository(deps.MongoClient)),
+		deps.AuditPublisher,
+	)
+	canAdminEvents := g.perms.RequirePermission(models.PermEventsAdmin)
+	g.adminRoute("GET", "/events", eventAdminHandler.ListEvents, canAdminEvents)
+	g.adminRoute("POST", "/events/replay-failed", eventAdminHandler.ReplayFailedEvents, canAdminEvents, middleware.RefuseImpersonation)
+	g.adminRoute("GET", "/events/replay-failed/{jobID}", eventAdminHandler.GetReplayJob, canAdminEvents)
+	g.adminRoute("GET", "/events/{id}", eventAdminHandler.GetEvent, canAdminEvents)
+	g.adminRoute("POST", "/events/{id}/replay", eventAdminHandler.ReplayEvent, canAdminEvents, middleware.RefuseImpersonation)
+
+	// Support impersonation - the end route also accepts the impersonation
+	// token itself, which carries the user's permissions, not the operator's
+	impersonationHandler := handlers.NewImpersonationHandler(
+		repositories.NewMongoUserRepository(deps.MongoClient),
+		repositories.NewImpersonationRepository(deps.MongoClient),
+		deps.JWTService,
+		deps.AuditPublisher,
+	)
+	canImpersonate := g.perms.RequirePermission(models.PermSupportImpersonate)
+	g.adminRoute("POST", "/impersonate/{userID}", impersonationHandler.StartImpersonation, canImpersonate, middleware.RefuseImpersonation)
+	g.adminRoute("DELETE", "/impersonate/{userID}", impersonationHandler.EndImpersonation, g.perms.RequirePermissionUnlessImpersonated(models.PermSupportImpersonate))
+
+	webhookHandler := handlers.NewWebhookSubscriptionHandler(repositories.NewWebhookRepository(deps.MongoClient), deps.Webhooks)
+	g.adminRoute("GET", "/webhooks", webhookHandler.ListWebhooks, adminOnly)
+	g.adminRoute("POST", "/webhooks", webhookHandler.CreateWebhook, adminOnly)
+	g.adminRoute("GET", "/webhooks/{id}", webhookHandler.GetWebhook, adminOnly)
+	g.adminRoute("PUT", "/webhooks/{id}", webhookHandler.UpdateWebhook, adminOnly)
+	g.adminRoute("DELETE", "/webhooks/{id}", webhookHandler.DeleteWebhook, adminOnly)
+	g.adminRoute("GET", "/webhooks/{id}/deliveries", webhookHandler.ListWebhookDeliveries, adminOnly)
+	g.adminRoute("POST", "/webhooks/{id}/test", webhookHandler.TestWebhook, adminOnly)
+
+	// Pending self-service account deletions, which admins can cancel
+	if deps.AccountClosing != nil {
+		accountHandler := newAccountHandler(deps)
+		g.adminRoute("GET", "/deletion-requests", accountHandler.ListDeletionRequests, adminOnly)
+		g.adminRoute("POST", "/deletion-requests/{id}/cancel", accountHandler.CancelDeletionRequest, adminOnly)
+	}
+
+	// Overrides of the 2FA, password reset, invitation and deactivation emails
+	systemEmailHandler := handlers.NewSystemEmailHandler(repositories.NewMongoTemplateRepository(deps.MongoClient))
+	systemEmailHandler.SetBranding(deps.EmailBranding)
+	g.adminRoute("GET", "/system-emails", systemEmailHandler.ListSystemEmails, adminOnly)
+	g.adminRoute("POST", "/system-emails/{key}/preview", systemEmailHandler.PreviewSystemEmail, adminOnly)
+
+	// Regions and teams that user region and team fields must name. The
+	// active ones are public for populating dropdowns, signup included.
+	referenceData := repositories.NewReferenceDataRepository(deps.MongoClient)
+	for _, kind := range []string{models.ReferenceKindRegions, models.ReferenceKindTeams} {
+		referenceHandler := handlers.NewReferenceDataHandler(referenceData, kind)
+		g.api.HandleFunc("/"+kind, referenceHandler.ListActive).Methods("GET", "OPTIONS")
+		g.adminRoute("GET", "/"+kind, referenceHandler.List, adminOnly)
+		g.adminRoute("POST", "/"+kind, referenceHandler.Create, adminOnly)
+		g.adminRoute("GET", "/"+kind+"/{code}", referenceHandler.Get, adminOnly)
+		g.adminRoute("PUT", "/"+kind+"/{code}", referenceHandler.Update, adminOnly)
+	}
+}
+
+// newAccountHandler builds the handler of the account closing routes
+func newAccountHandler(deps *Dependencies) *handlers.AccountHandler {
+	accountHandler := handlers.NewAccountHandler(deps.AccountClosing, repositories.NewMongoUserRepository(deps.MongoClient), deps.AuditPublisher)
+	accountHandler.SetConfirmationEmails(deps.SystemEmails, deps.EmailSender, repositories.NewMongoEmailRepository(deps.MongoClient), deps.EmailQueue)
+	return accountHandler
+}
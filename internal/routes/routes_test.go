@@ -0,0 +1,243 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/openapi"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newTestRouter registers the routes as cmd/openapi does, over a MongoDB
+// client that is never connected
+func newTestRouter(t *testing.T) *mux.Router {
+	t.Helper()
+	t.Setenv("MONGODB_URL", "mongodb://localhost:27017")
+	t.Setenv("JWT_ALGORITHM", "HS256")
+	t.Setenv("JWT_SECRET", "routes-tests-only-secret-0123456789abcdef")
+	t.Setenv("JWT_PRIVATE_KEY_PATH", "")
+	t.Setenv("JWT_PUBLIC_KEY_PATH", "")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	cfg.Kafka.Brokers = nil
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.MongoDB.URI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mongoClient := &mongodb.Client{Client: client, DB: client.Database(cfg.MongoDB.Database)}
+	jwtService, err := utils.NewJWTService(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kafkaProducer := kafka.NewProducer(cfg.Kafka)
+	auditPublisher := events.NewAuditPublisher(kafkaProducer)
+	users := repositories.NewMongoUserRepository(mongoClient)
+	settings := repositories.NewSettingsRepository(mongoClient)
+
+	router := mux.NewRouter()
+	RegisterRoutes(router, &Dependencies{
+		Config:         cfg,
+		MongoClient:    mongoClient,
+		KafkaProducer:  kafkaProducer,
+		EmailSender:    email.NewLogSender(cfg.Email.FromEmail),
+		AuditPublisher: auditPublisher,
+		JWTService:     jwtService,
+		RBACService:    services.NewRBACService(repositories.NewPermissionRepository(mongoClient), nil),
+		AccountClosing: services.NewAccountClosing(users, settings, repositories.NewAccountDeletionRepository(mongoClient), repositories.NewEventOutboxRepository(mongoClient), auditPublisher, nil, 30, time.Hour),
+		Denials:        services.NewPermissionDenials(repositories.NewPermissionDenialRepository(mongoClient), settings, auditPublisher, 10, time.Minute),
+		Lists:          services.NewDistributionLists(repositories.NewDistributionListRepository(mongoClient), users, nil),
+	})
+	return router
+}
+
+func TestRegisterRoutesCoversTheContract(t *testing.T) {
+	if err := VerifyContract(newTestRouter(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRegisterRoutesAnswersWrongMethodsWith405 checks a path registered for
+// other methods answers 405 with those methods in Allow, on every router
+// RegisterRoutes builds rather than only the one cmd/api serves
+func TestRegisterRoutesAnswersWrongMethodsWith405(t *testing.T) {
+	router := newTestRouter(t)
+	tests := []struct {
+		method string
+		path   string
+		allow  []string
+	}{
+		{http.MethodPost, "/health", []string{"GET", "OPTIONS"}},
+		{http.MethodDelete, "/api/v1/admin/users/0190a8f5-1c2b-7d3e-8f40-123456789abc/data-scope", []string{"GET", "OPTIONS", "PUT"}},
+		{http.MethodGet, "/api/v1/auth/login", []string{"OPTIONS", "POST"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d %s, want 405", rec.Code, rec.Body)
+			}
+			allow := strings.Split(rec.Header().Get("Allow"), ", ")
+			sort.Strings(allow)
+			if strings.Join(allow, ", ") != strings.Join(tt.allow, ", ") {
+				t.Errorf("Allow = %q, want %s", rec.Header().Get("Allow"), strings.Join(tt.allow, ", "))
+			}
+			if !strings.Contains(rec.Body.String(), `"METHOD_NOT_ALLOWED"`) {
+				t.Errorf("body = %s, want the METHOD_NOT_ALLOWED code", rec.Body)
+			}
+		})
+	}
+}
+
+func TestRegisterRoutesUnknownPathIsNotFound(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestRouter(t).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/no-such-route", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if rec.Header().Get("Allow") != "" {
+		t.Errorf("Allow = %q on an unknown path", rec.Header().Get("Allow"))
+	}
+}
+
+// TestMethodCheckedNotFound checks the 404 handler a caller installed is
+// kept for unknown paths and preflight requests, and paths of a subrouter
+// with other methods answer 405
+func TestMethodCheckedNotFound(t *testing.T) {
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	api := router.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/things", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet, http.MethodPost)
+	router.MethodNotAllowedHandler = methodNotAllowedHandler(router, router.NotFoundHandler)
+	router.NotFoundHandler = methodCheckedNotFound(router, router.NotFoundHandler, router.MethodNotAllowedHandler)
+
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{http.MethodGet, "/api/things", http.StatusOK, ""},
+		{http.MethodPost, "/health", http.StatusMethodNotAllowed, "GET"},
+		{http.MethodOptions, "/health", http.StatusTeapot, ""},
+		{http.MethodDelete, "/api/things", http.StatusMethodNotAllowed, "GET, POST"},
+		{http.MethodOptions, "/api/things", http.StatusTeapot, ""},
+		{http.MethodDelete, "/api/other", http.StatusTeapot, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status || rec.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s = %d with Allow %q, want %d with %q", tt.method, tt.path, rec.Code, rec.Header().Get("Allow"), tt.status, tt.allow)
+		}
+	}
+}
+
+// TestRegisterRoutesRequiresATokenOnProtectedRoutes checks the routes are
+// mounted under /api/v1 behind the JWT middleware, except the public sign-in
+// routes and the root /openapi.json
+func TestRegisterRoutesRequiresATokenOnProtectedRoutes(t *testing.T) {
+	router := newTestRouter(t)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/api/v1/auth/me", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/templates", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/sequences", "{}", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/admin/team/members", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/auth/login", "{}", http.StatusBadRequest},
+		{http.MethodGet, "/openapi.json", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s without a token = %d %s, want %d", tt.method, tt.path, rec.Code, rec.Body, tt.status)
+		}
+	}
+}
+
+// TestVerifyContractFailsOnUndocumentedRoutes mounts a route the Contract
+// does not describe and checks VerifyContract names it
+func TestVerifyContractFailsOnUndocumentedRoutes(t *testing.T) {
+	router := newTestRouter(t)
+	router.HandleFunc("/api/v1/widgets", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+
+	err := VerifyContract(router)
+	if err == nil || !strings.Contains(err.Error(), "GET /api/v1/widgets is served but not documented") {
+		t.Errorf("VerifyContract = %v, want the undocumented route named", err)
+	}
+}
+
+// TestOpenAPIDocumentIsServed reads /openapi.json and checks it is an
+// OpenAPI 3 document with the routes and the role, channel and status enums
+// clients generate unions from
+func TestOpenAPIDocumentIsServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestRouter(t).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != openapi.Version || doc.Paths["/auth/login"] == nil || doc.Paths["/auth/login"].Post == nil {
+		t.Fatalf("document = %s with %d paths, want OpenAPI %s documenting POST /auth/login", doc.OpenAPI, len(doc.Paths), openapi.Version)
+	}
+
+	enum := func(component, property string) []interface{} {
+		t.Helper()
+		schema, ok := doc.Components.Schemas[component]
+		if !ok || schema.Properties[property] == nil {
+			t.Fatalf("no %s.%s in the document", component, property)
+		}
+		return schema.Properties[property].Enum
+	}
+	for _, tt := range []struct {
+		component, property string
+		value               string
+	}{
+		{"handlers.TeamMember", "role", models.RoleSalesRep},
+		{"models.CommMessage", "channel", models.ChannelEmail},
+		{"models.CommMessage", "status", models.MessageStatusScheduled},
+		{"models.DistributionList", "status", models.DistributionListStatusArchived},
+	} {
+		if values := enum(tt.component, tt.property); !slices.Contains(values, interface{}(tt.value)) {
+			t.Errorf("%s.%s enum = %v, want it to hold %q", tt.component, tt.property, values, tt.value)
+		}
+	}
+}
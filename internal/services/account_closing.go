@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+var (
+	// ErrWrongPassword is returned when the current password re-entered to
+	// confirm an action does not match
+	ErrWrongPassword = errors.New("current password is incorrect")
+
+	// ErrLastAdmin is returned when the only active admin tries to close
+	// their account, which would leave nobody to administer the organization
+	ErrLastAdmin = errors.New("the last active admin cannot close their account")
+
+	// ErrDeletionAlreadyRequested is returned when a user with a pending
+	// deletion request asks again
+	ErrDeletionAlreadyRequested = errors.New("account deletion is already requested")
+)
+
+// accountDeletionBatch bounds how many due deletions one sweep carries out
+const accountDeletionBatch = 100
+
+// AccountClosing lets users deactivate their own account or have it deleted.
+// A deletion waits out a grace period during which the user or an admin can
+// cancel it; afterwards Run anonymizes the account. A deletion request does
+// not deactivate the account by itself, so the user can still sign in to
+// cancel it, and an already deactivated account can still be deleted.
+type AccountClosing struct {
+	users    *repositories.MongoUserRepository
+	settings *repositories.SettingsRepository
+	requests *repositories.AccountDeletionRepository
+	events   *repositories.EventOutboxRepository
+	audit    *events.AuditPublisher // nil leaves deletions carried out by Run unaudited
+	hasher   PasswordHasher
+	grace    time.Duration
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewAccountClosing creates a new AccountClosing. Deletions are carried out
+// graceDays after they are requested, checked every interval.
+func NewAccountClosing(users *repositories.MongoUserRepository, settings *repositories.SettingsRepository, requests *repositories.AccountDeletionRepository, eventOutbox *repositories.EventOutboxRepository, auditPublisher *events.AuditPublisher, hasher PasswordHasher, graceDays int, interval time.Duration) *AccountClosing {
+	return &AccountClosing{
+		users:    users,
+		settings: settings,
+		requests: requests,
+		events:   eventOutbox,
+		audit:    auditPublisher,
+		hasher:   hasher,
+		grace:    time.Duration(graceDays) * 24 * time.Hour,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// SetClock sets the clock grace periods are measured with
+func (c *AccountClosing) SetClock(now func() time.Time) {
+	if now != nil {
+		c.now = now
+	}
+}
+
+// GracePeriod returns how long deletions wait after they are requested
+func (c *AccountClosing) GracePeriod() time.Duration {
+	return c.grace
+}
+
+// Deactivate deactivates the account of user once currentPassword is
+// confirmed and revokes all of their sessions, returning how many were
+// revoked. The last active admin cannot deactivate their account.
+func (c *AccountClosing) Deactivate(ctx context.Context, user *models.User, currentPassword string) (int64, error) {
+	if err := c.hasher.Compare(user.PasswordHash, currentPassword); err != nil {
+		return 0, ErrWrongPassword
+	}
+	if err := c.ensureNotLastAdmin(ctx, user); err != nil {
+		return 0, err
+	}
+
+	if err := c.users.DeactivateUser(ctx, user.ID); err != nil {
+		return 0, err
+	}
+	revoked, err := c.users.RevokeUserSessions(ctx, user.ID, c.now())
+	if err != nil {
+		return 0, err
+	}
+	c.record(ctx, events.NewTeamMemberStatusChanged(events.TypeTeamMemberDeactivated, user.ID, user.ID, "inactive"))
+	return revoked, nil
+}
+
+// RequestDeletion schedules the anonymization of user's account at the end
+// of the grace period. The account may already be inactive; the last active
+// admin cannot request deletion.
+func (c *AccountClosing) RequestDeletion(ctx context.Context, user *models.User, reason string) (*models.AccountDeletionRequest, error) {
+	if err := c.ensureNotLastAdmin(ctx, user); err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	request := &models.AccountDeletionRequest{
+		ID:           uuid.MustNewUUID(),
+		UserID:       user.ID,
+		Email:        user.Email,
+		Name:         user.Name,
+		Reason:       strings.TrimSpace(reason),
+		Status:       models.AccountDeletionPending,
+		RequestedAt:  now,
+		ScheduledFor: now.Add(c.grace),
+	}
+	if err := c.requests.CreateDeletionRequest(ctx, request); err != nil {
+		if repositories.IsDuplicateKey(err) {
+			return nil, ErrDeletionAlreadyRequested
+		}
+		return nil, err
+	}
+	return request, nil
+}
+
+// PendingDeletion returns the pending deletion request of a user
+func (c *AccountClosing) PendingDeletion(ctx context.Context, userID string) (*models.AccountDeletionRequest, error) {
+	return c.requests.GetPendingDeletionRequest(ctx, userID)
+}
+
+// CancelDeletion cancels the pending deletion request of userID on their
+// own behalf
+func (c *AccountClosing) CancelDeletion(ctx context.Context, userID string) (*models.AccountDeletionRequest, error) {
+	request, err := c.requests.GetPendingDeletionRequest(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return c.requests.CancelDeletionRequest(ctx, request.ID, userID, c.now())
+}
+
+// CancelDeletionRequest cancels a pending deletion request by ID on behalf
+// of cancelledBy, an admin
+func (c *AccountClosing) CancelDeletionRequest(ctx context.Context, id, cancelledBy string) (*models.AccountDeletionRequest, error) {
+	return c.requests.CancelDeletionRequest(ctx, id, cancelledBy, c.now())
+}
+
+// ListDeletionRequests returns a page of deletion requests, optionally of
+// one status, those due soonest first
+func (c *AccountClosing) ListDeletionRequests(ctx context.Context, status string, page, limit int) ([]*models.AccountDeletionRequest, int64, error) {
+	return c.requests.ListDeletionRequests(ctx, status, page, limit)
+}
+
+// ensureNotLastAdmin fails with ErrLastAdmin when user is the only active
+// admin
+func (c *AccountClosing) ensureNotLastAdmin(ctx context.Context, user *models.User) error {
+	if user.Role != models.UserRoleAdmin || !user.IsActive {
+		return nil
+	}
+	admins, err := c.users.CountActiveAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// Run carries out due deletions immediately and then on every interval
+// until ctx is cancelled
+func (c *AccountClosing) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.DeleteDue(ctx); err != nil {
+			log.Printf("Warning: account deletion sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeleteDue anonymizes the accounts whose deletion grace period has ended
+// and returns how many were. An account that is the last active admin by
+// then is left for a later sweep.
+func (c *AccountClosing) DeleteDue(ctx context.Context) (int, error) {
+	now := c.now()
+	due, err := c.requests.ListDueDeletionRequests(ctx, now, accountDeletionBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, request := range due {
+		if err := c.delete(ctx, request, now); err != nil {
+			log.Printf("Warning: failed to delete account %s: %v", request.UserID, err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("Account deletion sweep anonymized %d account(s)", deleted)
+	}
+	return deleted, nil
+}
+
+// delete anonymizes the account of one due request and completes it
+func (c *AccountClosing) delete(ctx context.Context, request *models.AccountDeletionRequest, now time.Time) error {
+	user, err := c.users.GetByID(ctx, request.UserID)
+	if err != nil && !repositories.IsUserNotFound(err) {
+		return err
+	}
+	if user != nil {
+		if err := c.ensureNotLastAdmin(ctx, user); err != nil {
+			return err
+		}
+		if err := c.users.AnonymizeUser(ctx, user.ID, now); err != nil {
+			return err
+		}
+		if err := c.settings.DeleteUserSettings(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	completed, err := c.requests.CompleteDeletionRequest(ctx, request.ID, now)
+	if err != nil {
+		return err
+	}
+	if !completed {
+		return fmt.Errorf("deletion request %s is no longer pending", request.ID)
+	}
+
+	c.record(ctx, events.NewTeamMemberStatusChanged(events.TypeTeamMemberDeleted, events.SystemActor, request.UserID, "deleted"))
+	if c.audit != nil {
+		c.audit.PublishSystemAccountEvent(events.ActionAccountAnonymized, request.UserID,
+			fmt.Sprintf("Account anonymized %s after deletion request %s", now.Format(time.RFC3339), request.ID))
+	}
+	return nil
+}
+
+// record records a user lifecycle event for webhooks, logging a failure
+func (c *AccountClosing) record(ctx context.Context, event events.Event) {
+	if err := events.Record(ctx, c.events, event); err != nil {
+		log.Printf("Warning: failed to record %s event: %v", event.Topic(), err)
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/storage"
+)
+
+const (
+	// orphanAttachmentGrace leaves recent uploads alone while their message
+	// is still being written
+	orphanAttachmentGrace = time.Hour
+	orphanAttachmentBatch = 500
+)
+
+// AttachmentPurger removes stored attachments whose message no longer exists
+type AttachmentPurger struct {
+	repo     *repositories.MongoEmailRepository
+	storage  storage.Storage
+	interval time.Duration
+}
+
+// NewAttachmentPurger creates a new AttachmentPurger
+func NewAttachmentPurger(repo *repositories.MongoEmailRepository, store storage.Storage, interval time.Duration) *AttachmentPurger {
+	return &AttachmentPurger{
+		repo:     repo,
+		storage:  store,
+		interval: interval,
+	}
+}
+
+// Run purges orphaned attachments immediately and then on every interval until ctx is cancelled
+func (p *AttachmentPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PurgeOrphans(ctx); err != nil {
+			log.Printf("Warning: orphaned attachment purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOrphans deletes the files and metadata of attachments whose message
+// was deleted and returns how many were removed. The file goes first, so a
+// failure leaves the metadata for the next sweep to retry.
+func (p *AttachmentPurger) PurgeOrphans(ctx context.Context) (int, error) {
+	orphans, err := p.repo.ListOrphanedAttachments(ctx, time.Now().Add(-orphanAttachmentGrace), orphanAttachmentBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, att := range orphans {
+		if att.StorageLocation != "" {
+			if err := p.storage.Delete(ctx, att.StorageLocation); err != nil {
+				log.Printf("Warning: failed to delete orphaned attachment file %s: %v", att.StorageLocation, err)
+				continue
+			}
+		}
+		if err := p.repo.DeleteAttachment(ctx, att.ID); err != nil && !repositories.IsAttachmentNotFound(err) {
+			log.Printf("Warning: failed to delete orphaned attachment %s: %v", att.ID, err)
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		log.Printf("Attachment purge removed %d orphaned attachment(s)", purged)
+	}
+	return purged, nil
+}
@@ -5,29 +5,67 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 	"log"
+	"sync"
 
 	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
 	"github.com/white/user-management/internal/repositories"
 	"github.com/white/user-management/internal/utils"
 	"github.com/white/user-management/pkg/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidCredentials is returned by Login for every rejected sign-in:
+// unknown email, wrong password or inactive account. The wrapped message
+// carries the actual reason for audit logs; it must never reach the client.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrPasswordLoginDisabled is returned by Login when the user must sign in
+// through SSO instead. It is only returned after the password was verified.
+var ErrPasswordLoginDisabled = errors.New("password sign-in is disabled, sign in with SSO")
+
+// LoginPolicy decides whether a user who gave the right password may sign in
+// with it
+type LoginPolicy func(ctx context.Context, user *models.User) error
+
+// PasswordHasher hashes passwords and compares them with stored hashes
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) error
+	NeedsRehash(hash string) bool
+}
+
+// passwordUpgradeTimeout bounds rewriting a password hash after a sign-in
+const passwordUpgradeTimeout = 30 * time.Second
+
+// PasswordResetValidity is how long a password reset link can be used
+const PasswordResetValidity = time.Hour
+
 type AuthService struct {
-	userRepo          *repositories.UserRepository
-	sessionRepo       *repositories.SessionRepository
-	passwordResetRepo *repositories.PasswordResetRepository
+	userRepo          repositories.UserStore
+	sessionRepo       repositories.SessionStore
+	passwordResetRepo repositories.PasswordResetStore
 	permissionRepo    *repositories.PermissionRepository
 	jwtService        *utils.JWTService
+	hasher            PasswordHasher
+	dummyHashOnce     sync.Once
+	dummyHash         string
+	upgrading         sync.Map                // User IDs whose password hash is being rewritten
+	notifier          *NotificationService    // New-device sign-in alerts; nil sends none
+	loginPolicy       LoginPolicy             // nil allows every password sign-in
+	transactor        repositories.Transactor // nil runs multi-document writes one by one
+	loginHistory      *LoginHistoryRecorder   // nil records no sign-in attempts
+	activity          *SessionActivity        // nil applies no inactivity timeout
+	passwordHistory   SecuritySettingsReader  // nil allows reusing any password
 }
 
 func NewAuthService(
-	userRepo *repositories.MongoUserRepository,
-	sessionRepo *repositories.SessionRepository,
-	passwordResetRepo *repositories.PasswordResetRepository,
+	userRepo repositories.UserStore,
+	sessionRepo repositories.SessionStore,
+	passwordResetRepo repositories.PasswordResetStore,
 	permissionRepo *repositories.PermissionRepository,
 	jwtService *utils.JWTService,
 ) *AuthService {
@@ -37,38 +75,133 @@ func NewAuthService(
 		passwordResetRepo: passwordResetRepo,
 		permissionRepo:    permissionRepo,
 		jwtService:        jwtService,
+		hasher:            password.Default(),
+	}
+}
+
+// SetPasswordHasher sets the hasher passwords are hashed and compared with,
+// e.g. one at the configured cost
+func (s *AuthService) SetPasswordHasher(hasher PasswordHasher) {
+	s.hasher = hasher
+}
+
+// dummyPasswordHash returns a hash, at the cost real passwords are hashed
+// with, to compare against when the email is unknown so that the response
+// takes as long as for a wrong password
+func (s *AuthService) dummyPasswordHash() string {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.hasher.Hash(uuid.MustNewUUID())
+		if err != nil {
+			log.Printf("Warning: failed to generate dummy password hash: %v", err)
+			return
+		}
+		s.dummyHash = hash
+	})
+	return s.dummyHash
+}
+
+// SetNotificationService alerts users when they sign in from a new device
+func (s *AuthService) SetNotificationService(notifier *NotificationService) {
+	s.notifier = notifier
+}
+
+// SetLoginPolicy restricts password sign-ins, e.g. to admins when SSO is required
+func (s *AuthService) SetLoginPolicy(policy LoginPolicy) {
+	s.loginPolicy = policy
+}
+
+// SetLoginHistory records the rejected password sign-ins of known users and
+// makes the login history the source of new-device alerts
+func (s *AuthService) SetLoginHistory(recorder *LoginHistoryRecorder) {
+	s.loginHistory = recorder
+}
+
+// SetSessionActivity times out sessions left unused longer than their user's
+// SessionTimeout and records refreshes as activity
+func (s *AuthService) SetSessionActivity(activity *SessionActivity) {
+	s.activity = activity
+}
+
+// sessionNow returns the current time of the session activity clock
+func (s *AuthService) sessionNow() time.Time {
+	if s.activity != nil {
+		return s.activity.Now()
+	}
+	return time.Now()
+}
+
+// SetTransactor runs the multi-document writes of password resets and
+// session creation as transactions
+func (s *AuthService) SetTransactor(transactor repositories.Transactor) {
+	s.transactor = transactor
+}
+
+// inTransaction runs fn in a transaction when a transactor is set, and
+// directly otherwise
+func (s *AuthService) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.transactor == nil {
+		return fn(ctx)
 	}
+	return s.transactor.WithTransaction(ctx, fn)
 }
 
-// Login authenticates a user and returns tokens
-func (s *AuthService) Login(email, password, ipAddress, userAgent string) (*models.User, *models.TokenPair, error) {
-	user, err := s.userRepo.GetByEmailCompat(email)
+// newDeviceNotifyTimeout bounds the new-device alert sent after a sign-in
+const newDeviceNotifyTimeout = 30 * time.Second
+
+// Login authenticates a user and returns tokens. Every rejected sign-in
+// returns ErrInvalidCredentials after a password comparison, so neither the
+// error nor the response time reveals whether the email exists.
+func (s *AuthService) Login(ctx context.Context, email, password, ipAddress, userAgent string) (*models.User, *models.TokenPair, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Invalid Credentials")
+		_ = s.hasher.Compare(s.dummyPasswordHash(), password)
+		if !repositories.IsUserNotFound(err) {
+			return nil, nil, fmt.Errorf("failed to look up user: %w", err)
+		}
+		return nil, nil, fmt.Errorf("%w: unknown email", ErrInvalidCredentials)
+	}
+
+	// Rejected sign-ins of known users go to their login history
+	failed := func(reason string) {
+		s.loginHistory.Record(models.LoginRecord{
+			UserID:        user.ID,
+			Email:         user.Email,
+			FailureReason: reason,
+			Method:        models.LoginMethodPassword,
+			IPAddress:     ipAddress,
+			UserAgent:     userAgent,
+		})
+	}
+
+	if err := s.hasher.Compare(user.PasswordHash, password); err != nil {
+		failed(models.LoginFailureWrongPassword)
+		return nil, nil, fmt.Errorf("%w: wrong password", ErrInvalidCredentials)
 	}
 
 	if !user.IsActive {
-		return nil, nil, fmt.Errorf("Account is inactive")
+		failed(models.LoginFailureInactive)
+		return nil, nil, fmt.Errorf("%w: account is inactive", ErrInvalidCredentials)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		println("Password mismatch:", err.Error())
-		return nil, nil, fmt.Errorf("Invalid Credentials")
+	// Rewrite hashes made at a lower cost now that the password is known,
+	// without holding up the sign-in
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		go s.upgradePasswordHash(user.ID, password)
 	}
 
-		// Load permissions from role_permissions collection
-	if s.permissionRepo != nil {
-		ctx := context.Background()
-		permissions, _, err := s.permissionRepo.GetPermissionsForRole(ctx, user.Role)
-		if err != nil {
-			log.Printf("Auth: failed to load permissions for role %s: %v", user.Role, err)
-		} else if len(permissions) > 0 {
-			user.Permissions = permissions
-			log.Printf("Auth: loaded %d permissions for role %s", len(permissions), user.Role)
+	if s.loginPolicy != nil {
+		if err := s.loginPolicy(ctx, user); err != nil {
+			if errors.Is(err, ErrPasswordLoginDisabled) {
+				failed(models.LoginFailureSSORequired)
+			}
+			return nil, nil, err
 		}
 	}
 
-	accessToken, err := s.jwtService.GenerateAccessToken(user)
+	s.loadRolePermissions(ctx, user)
+
+	tokenID := uuid.MustNewUUID()
+	accessToken, err := s.jwtService.GenerateAccessToken(user, tokenID)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to generate access token: %v", err)
@@ -80,25 +213,44 @@ func (s *AuthService) Login(email, password, ipAddress, userAgent string) (*mode
 		return nil, nil, fmt.Errorf("Failed to generate refresh token: %v", err)
 	}
 
-	tokenID := uuid.MustNewUUID()
-	//create session
-	session := models.Session{
-		TokenID:      tokenID,
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		IssuedAt:     time.Now(),
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour), // 7 days
-		IPAddress:    ipAddress,
-		UserAgent:    userAgent,
-		IsRevoked:    false,
+	// A sign-in from a device the user has never used is worth telling them
+	// about; their very first sign-in is not
+	newDevice := false
+	if s.notifier != nil && user.LastLoginAt != nil {
+		known, err := s.knownDevice(ctx, user.ID, userAgent)
+		if err != nil {
+			log.Printf("Auth: failed to check devices of user %s: %v", user.ID, err)
+		}
+		newDevice = err == nil && !known
 	}
 
-	if err := s.sessionRepo.CreateSessionCompat(session); err != nil {
+	//create session
+	issuedAt := s.sessionNow()
+	session := models.Session{
+		TokenID:        tokenID,
+		UserID:         user.ID,
+		RefreshToken:   refreshToken,
+		IssuedAt:       issuedAt,
+		ExpiresAt:      issuedAt.Add(7 * 24 * time.Hour), // 7 days
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		IsRevoked:      false,
+		LastActivityAt: &issuedAt,
+	}
+
+	if err := s.sessionRepo.CreateSession(ctx, &session); err != nil {
 		return nil, nil, fmt.Errorf("Failed to create session: %v", err)
 	}
+	if s.activity != nil {
+		s.activity.started(tokenID, issuedAt)
+	}
 
 	// update last login time
-	s.userRepo.UpdateLastLoginCompat(user.ID, time.Now())
+	s.userRepo.UpdateLastLogin(ctx, user.ID, time.Now())
+
+	if newDevice {
+		go s.notifyNewDevice(user.ID, ipAddress, userAgent, session.IssuedAt)
+	}
 
 	token := &models.TokenPair{
 		AccessToken:  accessToken,
@@ -110,15 +262,81 @@ func (s *AuthService) Login(email, password, ipAddress, userAgent string) (*mode
 	return user, token, nil
 }
 
+// knownDevice reports whether a user signed in with userAgent before, from
+// the login history when it is kept and from their sessions otherwise
+func (s *AuthService) knownDevice(ctx context.Context, userID, userAgent string) (bool, error) {
+	if s.loginHistory == nil {
+		return s.sessionRepo.HasDeviceSession(ctx, userID, userAgent)
+	}
+	return s.loginHistory.KnownDevice(ctx, s.sessionRepo, userID, userAgent)
+}
+
+// upgradePasswordHash rehashes a user's password at the current cost. Only
+// one rewrite per user runs at a time, and it rereads the stored hash first,
+// so sign-ins racing the first one do not upgrade it again.
+func (s *AuthService) upgradePasswordHash(userID, plaintext string) {
+	if _, running := s.upgrading.LoadOrStore(userID, struct{}{}); running {
+		return
+	}
+	defer s.upgrading.Delete(userID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), passwordUpgradeTimeout)
+	defer cancel()
+	current, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil || !s.hasher.NeedsRehash(current.PasswordHash) {
+		return
+	}
+
+	hash, err := s.hasher.Hash(plaintext)
+	if err != nil {
+		log.Printf("Auth: failed to rehash password of user %s: %v", userID, err)
+		return
+	}
+	if err := s.userRepo.ReplacePasswordHash(ctx, userID, hash); err != nil {
+		log.Printf("Auth: failed to store upgraded password hash of user %s: %v", userID, err)
+	}
+}
+
+// loadRolePermissions loads the permissions of the user's role from the
+// role_permissions collection into user, keeping the stored ones on failure
+func (s *AuthService) loadRolePermissions(ctx context.Context, user *models.User) {
+	if s.permissionRepo == nil {
+		return
+	}
+	permissions, _, err := s.permissionRepo.GetPermissionsForRole(ctx, string(user.Role))
+	if err != nil {
+		log.Printf("Auth: failed to load permissions for role %s: %v", user.Role, err)
+	} else if len(permissions) > 0 {
+		user.Permissions = permissions
+		log.Printf("Auth: loaded %d permissions for role %s", len(permissions), user.Role)
+	}
+}
+
+// notifyNewDevice alerts a user to a sign-in from a new device
+func (s *AuthService) notifyNewDevice(userID, ipAddress, userAgent string, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), newDeviceNotifyTimeout)
+	defer cancel()
+
+	payload := models.NotificationPayload{
+		Title: "New sign-in to your account",
+		Body: fmt.Sprintf("Your account was signed in to from a new device.\n\nDevice: %s\nIP address: %s\nTime: %s\n\nIf this was not you, change your password now.",
+			userAgent, ipAddress, at.UTC().Format(time.RFC1123)),
+		Data: map[string]string{"ipAddress": ipAddress, "userAgent": userAgent},
+	}
+	if err := s.notifier.Notify(ctx, userID, models.NotificationNewDeviceLogin, payload); err != nil {
+		log.Printf("Auth: failed to send new device alert to user %s: %v", userID, err)
+	}
+}
+
 // Logout revokes a user's session and returns the user info for event publishing
-func (s *AuthService) Logout(refreshToken string) (*models.User, error) {
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) (*models.User, error) {
 	userID, err := s.jwtService.ValidateRefreshToken(refreshToken)
 	if err != nil {
 		return nil, fmt.Errorf("invalid refresh token")
 	}
 
 	// Get session to verify it exists
-	session, err := s.sessionRepo.GetByRefreshToken(refreshToken)
+	session, err := s.sessionRepo.GetByRefreshToken(ctx, refreshToken)
 	if err != nil {
 		return nil, fmt.Errorf("session not found")
 	}
@@ -129,13 +347,13 @@ func (s *AuthService) Logout(refreshToken string) (*models.User, error) {
 	}
 
 	// Get user info before revoking session
-	user, err := s.userRepo.GetByIDCompat(userID)
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
 
 	// Revoke session
-	if err := s.sessionRepo.Revoke(refreshToken); err != nil {
+	if err := s.sessionRepo.Revoke(ctx, refreshToken); err != nil {
 		return nil, fmt.Errorf("failed to revoke session: %v", err)
 	}
 
@@ -143,7 +361,7 @@ func (s *AuthService) Logout(refreshToken string) (*models.User, error) {
 
 }
 // RefreshToken generates a new access token using a refresh token
-func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenPair, error) {
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
 	// Validate refresh token
 	userID, err := s.jwtService.ValidateRefreshToken(refreshToken)
 	if err != nil {
@@ -151,7 +369,7 @@ func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenPair, erro
 	}
 
 	// Get session
-	session, err := s.sessionRepo.GetByRefreshToken(refreshToken)
+	session, err := s.sessionRepo.GetByRefreshToken(ctx, refreshToken)
 	if err != nil {
 		return nil, fmt.Errorf("session not found")
 	}
@@ -161,8 +379,13 @@ func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenPair, erro
 		return nil, fmt.Errorf("session expired or revoked")
 	}
 
+	// A session left unused too long times out before its absolute expiry
+	if s.activity != nil && !s.activity.Active(ctx, session) {
+		return nil, fmt.Errorf("session expired due to inactivity")
+	}
+
 	// Get user
-	user, err := s.userRepo.GetByIDCompat(userID)
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
@@ -174,8 +397,7 @@ func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenPair, erro
 	
 	// Load permissions from role_permissions collection
 	if s.permissionRepo != nil {
-		ctx := context.Background()
-		permissions, _, err := s.permissionRepo.GetPermissionsForRole(ctx, user.Role)
+		permissions, _, err := s.permissionRepo.GetPermissionsForRole(ctx, string(user.Role))
 		if err != nil {
 			log.Printf("Auth: failed to load permissions for role %s: %v", user.Role, err)
 		} else if len(permissions) > 0 {
@@ -184,15 +406,34 @@ func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenPair, erro
 	}
 
 	// Generate new access token
-	accessToken, err := s.jwtService.GenerateAccessToken(user)
+	accessToken, err := s.jwtService.GenerateAccessToken(user, session.TokenID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
+	// Refreshing counts as using the session
+	if s.activity != nil {
+		s.activity.Record(ctx, user.ID, session.TokenID)
+	}
+
+	// A refresh token minted before the iss and aud claims were configured
+	// is replaced by one that has them, so the session outlives the
+	// transition window
+	if s.jwtService.IsLegacyToken(refreshToken) {
+		replacement, err := s.jwtService.GenerateRefreshToken(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		}
+		if err := s.sessionRepo.ReplaceRefreshToken(ctx, refreshToken, replacement); err != nil {
+			return nil, fmt.Errorf("failed to replace refresh token: %w", err)
+		}
+		refreshToken = replacement
+	}
+
 	// Return tokens
 	tokens := &models.TokenPair{
 		AccessToken:  accessToken,
-		RefreshToken: refreshToken, // Keep the same refresh token
+		RefreshToken: refreshToken, // The same one, unless it was replaced above
 		TokenType:    "Bearer",
 		ExpiresIn:    900, // 15 minutes in seconds
 	}
@@ -200,30 +441,16 @@ func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenPair, erro
 	return tokens, nil
 }
 
-// HashPassword hashes a password using bcrypt
-func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("failed to hash password: %v", err)
-	}
-	return string(hashedBytes), nil
-}
-
-// VerifyPassword verifies a password against a hash
-func VerifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
-
 // ChangePassword changes a user's password (requires old password verification)
-func (s *AuthService) ChangePassword(userID string, oldPassword, newPassword string) error {
+func (s *AuthService) ChangePassword(ctx context.Context, userID string, oldPassword, newPassword string) error {
 	// Get user
-	user, err := s.userRepo.GetByIDCompat(userID)
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return fmt.Errorf("user not found")
 	}
 
 	// Verify old password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)); err != nil {
+	if err := s.hasher.Compare(user.PasswordHash, oldPassword); err != nil {
 		return fmt.Errorf("invalid current password")
 	}
 
@@ -231,15 +458,18 @@ func (s *AuthService) ChangePassword(userID string, oldPassword, newPassword str
 	if len(newPassword) < 8 {
 		return fmt.Errorf("new password must be at least 8 characters")
 	}
+	if err := s.checkPasswordReuse(ctx, user, newPassword); err != nil {
+		return err
+	}
 
 	// Hash new password
-	newHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	newHash, err := s.hasher.Hash(newPassword)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+		return err
 	}
 
 	// Update password
-	if err := s.userRepo.UpdatePasswordCompat(userID, string(newHash)); err != nil {
+	if err := s.userRepo.UpdatePassword(ctx, userID, newHash); err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
@@ -247,8 +477,8 @@ func (s *AuthService) ChangePassword(userID string, oldPassword, newPassword str
 }
 
 // ForgotPassword creates a password reset token for a user
-func (s *AuthService) ForgotPassword(email,ipAddress, userAgent string) (string, error) {
-	user, err := s.userRepo.GetByEmailCompat(email)
+func (s *AuthService) ForgotPassword(ctx context.Context, email, ipAddress, userAgent string) (string, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
 		// Don't reveal if user exists or not (security best practice)
 		// Return a dummy token to prevent user enumeration
@@ -260,34 +490,50 @@ func (s *AuthService) ForgotPassword(email,ipAddress, userAgent string) (string,
 		return "", nil
 	}
 
-		// Create reset token
-	resetToken,err :=generateInviteToken()
+	return s.issuePasswordReset(ctx, user, ipAddress, userAgent)
+}
+
+// StartForcedPasswordReset issues a reset token for a user who signed in
+// with a password they must change first, such as the master admin's
+// one-time password. The token is redeemed like a forgotten password's.
+func (s *AuthService) StartForcedPasswordReset(ctx context.Context, user *models.User, ipAddress, userAgent string) (string, error) {
+	return s.issuePasswordReset(ctx, user, ipAddress, userAgent)
+}
+
+// issuePasswordReset stores the hash of a new reset token for user and
+// returns the token
+func (s *AuthService) issuePasswordReset(ctx context.Context, user *models.User, ipAddress, userAgent string) (string, error) {
+	resetToken, err := generateInviteToken()
 	if err != nil {
 		return "", err
 	}
-	resetTokenHash := hashToken(resetToken)
 	reset := models.PasswordReset{
-		ResetToken: resetTokenHash,
+		ResetToken: hashToken(resetToken),
 		UserID:     user.ID,
 		Email:      user.Email,
 		CreatedAt:  time.Now(),
-		ExpiresAt:  time.Now().Add(1 * time.Hour),
+		ExpiresAt:  time.Now().Add(PasswordResetValidity),
 		IsUsed:     false,
 		IPAddress:  ipAddress,
 		UserAgent:  userAgent,
 	}
 
-	if err := s.passwordResetRepo.CreateReset(reset); err != nil {
+	if err := s.passwordResetRepo.CreatePasswordReset(ctx, &reset); err != nil {
 		return "", fmt.Errorf("failed to create reset token: %w", err)
 	}
 
 	return resetToken, nil
 }
 
-// ResetPassword resets a user's password using a reset token
-func (s *AuthService) ResetPassword(resetToken, newPassword string) error {
+// ResetPassword resets a user's password using a reset token. Using up the
+// token and setting the password happen in one transaction, so a token is
+// never left unused once its password is set, nor used without it.
+func (s *AuthService) ResetPassword(ctx context.Context, resetToken, newPassword string) error {
+	// Only the hash of the token is stored
+	tokenHash := hashToken(resetToken)
+
 	// Get reset token
-	reset, err := s.passwordResetRepo.GetByToken(resetToken)
+	reset, err := s.passwordResetRepo.GetPasswordReset(ctx, tokenHash)
 	if err != nil {
 		return fmt.Errorf("invalid or expired reset token")
 	}
@@ -301,31 +547,47 @@ func (s *AuthService) ResetPassword(resetToken, newPassword string) error {
 	if len(newPassword) < 8 {
 		return fmt.Errorf("new password must be at least 8 characters")
 	}
-
-	// Hash new password
-	newHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	// Covers forced resets too, so a one-time password cannot be kept
+	user, err := s.userRepo.GetByID(ctx, reset.UserID)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+		return fmt.Errorf("invalid or expired reset token")
 	}
-
-	// Update password
-	if err := s.userRepo.UpdatePasswordCompat(reset.UserID, string(newHash)); err != nil {
-		return fmt.Errorf("failed to update password: %w", err)
+	if err := s.checkPasswordReuse(ctx, user, newPassword); err != nil {
+		return err
 	}
 
-	// Mark token as used
-	if err := s.passwordResetRepo.MarkAsUsed(resetToken); err != nil {
-		// Log error but don't fail the password reset
-		fmt.Printf("Warning: failed to mark reset token as used: %v\n", err)
+	// Hash new password
+	newHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return s.inTransaction(ctx, func(ctx context.Context) error {
+		// Mark token as used; a concurrent reset with the same token finds it used
+		if err := s.passwordResetRepo.MarkPasswordResetUsed(ctx, tokenHash); err != nil {
+			if repositories.IsNotFound(err) {
+				return fmt.Errorf("reset token has expired or already been used")
+			}
+			return fmt.Errorf("failed to mark reset token as used: %w", err)
+		}
+
+		// Update password
+		if err := s.userRepo.UpdatePassword(ctx, reset.UserID, newHash); err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		return nil
+	})
 }
 
-// CreateSessionForUser creates a session for a user (used for 2FA flow)
-func (s *AuthService) CreateSessionForUser(user *models.User, ipAddress, userAgent string) (*models.TokenPair, error) {
+// CreateSessionForUser creates a session for a user who was authenticated
+// another way (2FA codes, SSO). Its writes use ctx, so they join a
+// transaction ctx belongs to.
+func (s *AuthService) CreateSessionForUser(ctx context.Context, user *models.User, ipAddress, userAgent string) (*models.TokenPair, error) {
+	s.loadRolePermissions(ctx, user)
+
 	// Generate tokens
-	accessToken, err := s.jwtService.GenerateAccessToken(user)
+	tokenID := uuid.MustNewUUID()
+	accessToken, err := s.jwtService.GenerateAccessToken(user, tokenID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -335,25 +597,29 @@ func (s *AuthService) CreateSessionForUser(user *models.User, ipAddress, userAge
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	tokenID := uuid.MustNewUUID()
 	// Create session
+	issuedAt := s.sessionNow()
 	session := models.Session{
-		TokenID:      tokenID,
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		IssuedAt:     time.Now(),
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour),
-		IPAddress:    ipAddress,
-		UserAgent:    userAgent,
-		IsRevoked:    false,
-	}
-
-	if err := s.sessionRepo.CreateSessionCompat(session); err != nil {
+		TokenID:        tokenID,
+		UserID:         user.ID,
+		RefreshToken:   refreshToken,
+		IssuedAt:       issuedAt,
+		ExpiresAt:      issuedAt.Add(7 * 24 * time.Hour),
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		IsRevoked:      false,
+		LastActivityAt: &issuedAt,
+	}
+
+	if err := s.sessionRepo.CreateSession(ctx, &session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
+	if s.activity != nil {
+		s.activity.started(tokenID, issuedAt)
+	}
 
 	// Update last login time
-	s.userRepo.UpdateLastLoginCompat(user.ID, time.Now())
+	s.userRepo.UpdateLastLogin(ctx, user.ID, time.Now())
 
 	// Return tokens
 	tokens := &models.TokenPair{
@@ -366,9 +632,9 @@ func (s *AuthService) CreateSessionForUser(user *models.User, ipAddress, userAge
 	return tokens, nil
 }
 
-func (s *AuthService) CreateForHandler(user *models.MongoUser) error {
+func (s *AuthService) CreateForHandler(ctx context.Context, user *models.User) error {
 	// Create user in database
-	if err := s.userRepo.CreateForHandler(user); err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
 		return fmt.Errorf("failed to create user: %v", err)
 	}
 	return nil
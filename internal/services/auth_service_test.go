@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "Correct-Horse-9"
+
+func newTestJWTService(t *testing.T) *utils.JWTService {
+	t.Helper()
+	jwtService, err := utils.NewJWTService(config.JWTConfig{
+		Algorithm:          "HS256",
+		Secret:             "services-tests-only-secret-0123456789abcdef",
+		AccessTokenExpiry:  15,
+		RefreshTokenExpiry: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewJWTService: %v", err)
+	}
+	return jwtService
+}
+
+// newTestAuthService returns an AuthService over users, hashing at the
+// lowest cost, and a user of it who signs in with testPassword
+func newTestAuthService(t *testing.T, users *memory.UserStore) (*AuthService, *models.User) {
+	t.Helper()
+	hasher := mustHasher(t)
+	hash, err := hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := users.Add(&models.User{
+		Email:        "ana@example.com",
+		Name:         "Ana",
+		PasswordHash: hash,
+		Role:         models.UserRoleSalesRep,
+		IsActive:     true,
+		Status:       repositories.UserStatusActive,
+	})
+	auth := NewAuthService(users, users, users, nil, newTestJWTService(t))
+	auth.SetPasswordHasher(hasher)
+	return auth, user
+}
+
+type requestKey struct{}
+
+// contextRecordingStore records whether each store call it sees was given
+// the request's context
+type contextRecordingStore struct {
+	*memory.UserStore
+
+	mu    sync.Mutex
+	calls map[string]bool // Method -> whether every call carried the request context
+}
+
+func (s *contextRecordingStore) record(method string, ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls == nil {
+		s.calls = make(map[string]bool)
+	}
+	carried := ctx.Value(requestKey{}) == "request"
+	if previous, seen := s.calls[method]; seen {
+		carried = carried && previous
+	}
+	s.calls[method] = carried
+}
+
+func (s *contextRecordingStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.record("GetByEmail", ctx)
+	return s.UserStore.GetByEmail(ctx, email)
+}
+
+func (s *contextRecordingStore) GetByID(ctx context.Context, id string) (*models.User, error) {
+	s.record("GetByID", ctx)
+	return s.UserStore.GetByID(ctx, id)
+}
+
+func (s *contextRecordingStore) CreateSession(ctx context.Context, session *models.Session) error {
+	s.record("CreateSession", ctx)
+	return s.UserStore.CreateSession(ctx, session)
+}
+
+func (s *contextRecordingStore) GetByRefreshToken(ctx context.Context, refreshToken string) (*models.Session, error) {
+	s.record("GetByRefreshToken", ctx)
+	return s.UserStore.GetByRefreshToken(ctx, refreshToken)
+}
+
+func (s *contextRecordingStore) Revoke(ctx context.Context, refreshToken string) error {
+	s.record("Revoke", ctx)
+	return s.UserStore.Revoke(ctx, refreshToken)
+}
+
+func (s *contextRecordingStore) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	s.record("UpdatePassword", ctx)
+	return s.UserStore.UpdatePassword(ctx, id, passwordHash)
+}
+
+func (s *contextRecordingStore) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	s.record("CreatePasswordReset", ctx)
+	return s.UserStore.CreatePasswordReset(ctx, reset)
+}
+
+// TestAuthServicePassesTheRequestContext checks the store calls of the
+// sign-in, refresh, password and sign-out flows run with the caller's
+// context, so its cancellation and deadline reach the database
+func TestAuthServicePassesTheRequestContext(t *testing.T) {
+	store := &contextRecordingStore{UserStore: memory.NewUserStore()}
+	_, user := newTestAuthService(t, store.UserStore)
+	auth := NewAuthService(store, store, store, nil, newTestJWTService(t))
+	auth.SetPasswordHasher(mustHasher(t))
+
+	ctx := context.WithValue(context.Background(), requestKey{}, "request")
+
+	_, tokens, err := auth.Login(ctx, user.Email, testPassword, "203.0.113.7", "test-agent")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := auth.RefreshToken(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if err := auth.ChangePassword(ctx, user.ID, testPassword, "Another-Horse-10"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if _, err := auth.ForgotPassword(ctx, user.Email, "203.0.113.7", "test-agent"); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	if _, err := auth.Logout(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	for _, method := range []string{"GetByEmail", "GetByID", "CreateSession", "GetByRefreshToken", "Revoke", "UpdatePassword", "CreatePasswordReset"} {
+		carried, called := store.calls[method]
+		switch {
+		case !called:
+			t.Errorf("%s was not called", method)
+		case !carried:
+			t.Errorf("%s was called without the request context", method)
+		}
+	}
+}
+
+func TestAuthServiceLoginRejectsCancelledContexts(t *testing.T) {
+	users := memory.NewUserStore()
+	auth, user := newTestAuthService(t, users)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store := &cancellingStore{UserStore: users}
+	auth.userRepo = store
+	if _, _, err := auth.Login(ctx, user.Email, testPassword, "", ""); err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("Login with a cancelled context = %v, want the cancellation", err)
+	}
+}
+
+// cancellingStore fails lookups made with a finished context, as the Mongo
+// driver does
+type cancellingStore struct {
+	*memory.UserStore
+}
+
+func (s *cancellingStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.UserStore.GetByEmail(ctx, email)
+}
+
+type transactionKey struct{}
+
+// recordingTransactor runs fn with a context marking the transaction, as
+// the MongoDB client runs it with a session context
+type recordingTransactor struct {
+	runs int
+}
+
+func (tx *recordingTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx.runs++
+	return fn(context.WithValue(ctx, transactionKey{}, true))
+}
+
+// transactionalResets records whether the reset writes joined the
+// transaction, and fails the password update when failPassword is set
+type transactionalResets struct {
+	*memory.UserStore
+	failPassword bool
+	inTx         map[string]bool
+}
+
+func (s *transactionalResets) MarkPasswordResetUsed(ctx context.Context, resetToken string) error {
+	s.inTx["MarkPasswordResetUsed"] = ctx.Value(transactionKey{}) == true
+	return s.UserStore.MarkPasswordResetUsed(ctx, resetToken)
+}
+
+func (s *transactionalResets) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	s.inTx["UpdatePassword"] = ctx.Value(transactionKey{}) == true
+	if s.failPassword {
+		return errors.New("connection reset")
+	}
+	return s.UserStore.UpdatePassword(ctx, id, passwordHash)
+}
+
+// TestResetPasswordRunsInOneTransaction checks both writes of a reset join
+// the transaction, so a failed password update rolls back the used token
+func TestResetPasswordRunsInOneTransaction(t *testing.T) {
+	users := memory.NewUserStore()
+	_, user := newTestAuthService(t, users)
+	store := &transactionalResets{UserStore: users, failPassword: true, inTx: map[string]bool{}}
+	auth := NewAuthService(store, store, store, nil, newTestJWTService(t))
+	auth.SetPasswordHasher(mustHasher(t))
+	tx := &recordingTransactor{}
+	auth.SetTransactor(tx)
+	ctx := context.Background()
+
+	token, err := auth.ForgotPassword(ctx, user.Email, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ResetPassword(ctx, token, "Another-Horse-10"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("ResetPassword with a failing update = %v, want the failure", err)
+	}
+	if tx.runs != 1 || !store.inTx["MarkPasswordResetUsed"] || !store.inTx["UpdatePassword"] {
+		t.Errorf("%d transactions, writes in the transaction: %v; want one with both writes", tx.runs, store.inTx)
+	}
+
+	// The emailed token, not its stored hash, redeems the reset, once
+	store.failPassword = false
+	token, err = auth.ForgotPassword(ctx, user.Email, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ResetPassword(ctx, token, "Another-Horse-10"); err != nil {
+		t.Fatalf("ResetPassword = %v", err)
+	}
+	if _, _, err := auth.Login(ctx, user.Email, "Another-Horse-10", "", ""); err != nil {
+		t.Errorf("signing in with the new password = %v", err)
+	}
+	if err := auth.ResetPassword(ctx, token, "Third-Horse-11"); err == nil {
+		t.Error("a used reset token reset the password again")
+	}
+}
+
+func mustHasher(t *testing.T) *password.Hasher {
+	t.Helper()
+	hasher, err := password.New(password.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hasher
+}
+
+// blockingRehashes holds password hash rewrites until release is closed,
+// counting them
+type blockingRehashes struct {
+	*memory.UserStore
+	release  chan struct{}
+	rewrites chan string
+}
+
+func (s *blockingRehashes) ReplacePasswordHash(ctx context.Context, id, passwordHash string) error {
+	<-s.release
+	err := s.UserStore.ReplacePasswordHash(ctx, id, passwordHash)
+	s.rewrites <- passwordHash
+	return err
+}
+
+// TestLoginUpgradesLowCostHashesOnce signs in a user whose hash was made at
+// a lower cost several times at once, and checks the sign-ins return while
+// the rewrite is still held up and the hash is rewritten exactly once
+func TestLoginUpgradesLowCostHashesOnce(t *testing.T) {
+	users := memory.NewUserStore()
+	auth, user := newTestAuthService(t, users)
+	low, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.ReplacePasswordHash(context.Background(), user.ID, string(low))
+	store := &blockingRehashes{UserStore: users, release: make(chan struct{}), rewrites: make(chan string, 10)}
+	auth.userRepo = store
+
+	const logins = 5
+	done := make(chan error, logins)
+	for i := 0; i < logins; i++ {
+		go func() {
+			_, _, err := auth.Login(context.Background(), user.Email, testPassword, "", "")
+			done <- err
+		}()
+	}
+	for i := 0; i < logins; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Login = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Login waited for the hash rewrite")
+		}
+	}
+
+	close(store.release)
+	var rewritten string
+	select {
+	case rewritten = <-store.rewrites:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the low cost hash was not rewritten")
+	}
+	if cost, _ := bcrypt.Cost([]byte(rewritten)); cost != password.MinCost {
+		t.Errorf("rewritten hash cost = %d, want %d", cost, password.MinCost)
+	}
+	if stored, _ := users.GetByID(context.Background(), user.ID); stored.PasswordHash != rewritten {
+		t.Error("the rewritten hash was not stored")
+	}
+
+	// Signing in with the upgraded hash leaves it alone
+	if _, _, err := auth.Login(context.Background(), user.Email, testPassword, "", ""); err != nil {
+		t.Fatalf("Login after the upgrade = %v", err)
+	}
+	select {
+	case <-store.rewrites:
+		t.Error("the hash was rewritten again")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestRefreshReplacesTokensWithoutIssuerAndAudience refreshes a session
+// whose refresh token was minted before iss and aud were configured, and
+// checks it gets one that has them, so the session outlives the transition
+func TestRefreshReplacesTokensWithoutIssuerAndAudience(t *testing.T) {
+	ctx := context.Background()
+	const secret = "services-tests-only-secret-0123456789abcdef"
+	cfg := config.JWTConfig{
+		Algorithm:          "HS256",
+		Secret:             secret,
+		AccessTokenExpiry:  15,
+		RefreshTokenExpiry: 7,
+		Issuer:             "white-api-production",
+		Audience:           "white-crm",
+		AllowMissingClaims: true,
+	}
+	during, err := utils.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := memory.NewUserStore()
+	_, user := newTestAuthService(t, users)
+	auth := NewAuthService(users, users, users, nil, during)
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ID:        "legacy-session",
+		Subject:   user.ID,
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.CreateSession(ctx, &models.Session{TokenID: "legacy-session", UserID: user.ID, RefreshToken: legacy, IssuedAt: time.Now(), ExpiresAt: time.Now().Add(24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := auth.RefreshToken(ctx, legacy)
+	if err != nil {
+		t.Fatalf("refreshing a legacy token during the transition: %v", err)
+	}
+	if tokens.RefreshToken == legacy || during.IsLegacyToken(tokens.RefreshToken) || during.IsLegacyToken(tokens.AccessToken) {
+		t.Fatal("refresh kept a token without iss and aud")
+	}
+	if _, err := users.GetByRefreshToken(ctx, legacy); err == nil {
+		t.Error("the legacy refresh token still finds the session")
+	}
+	if session, err := users.GetByRefreshToken(ctx, tokens.RefreshToken); err != nil || session.TokenID != "legacy-session" {
+		t.Errorf("session of the new refresh token = %+v, %v; want the same session", session, err)
+	}
+
+	// Once the transition ends the new token keeps working and the old one
+	// would not have
+	cfg.AllowMissingClaims = false
+	after, err := utils.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = NewAuthService(users, users, users, nil, after)
+	if _, err := auth.RefreshToken(ctx, tokens.RefreshToken); err != nil {
+		t.Errorf("refreshing the replacement after the transition: %v", err)
+	}
+	if _, err := after.ValidateRefreshToken(legacy); !errors.Is(err, utils.ErrInvalidIssuer) {
+		t.Errorf("legacy refresh token after the transition = %v, want ErrInvalidIssuer", err)
+	}
+}
+
+// countingHasher records the hashes passwords are compared with
+type countingHasher struct {
+	PasswordHasher
+
+	mu       sync.Mutex
+	compared []string
+}
+
+func (h *countingHasher) Compare(hash, password string) error {
+	h.mu.Lock()
+	h.compared = append(h.compared, hash)
+	h.mu.Unlock()
+	return h.PasswordHasher.Compare(hash, password)
+}
+
+// TestLoginComparesOncePerRejection checks an unknown email and a wrong
+// password each cost exactly one password comparison, the unknown email's
+// against the dummy hash, and fail with the same error
+func TestLoginComparesOncePerRejection(t *testing.T) {
+	users := memory.NewUserStore()
+	auth, user := newTestAuthService(t, users)
+	hasher := &countingHasher{PasswordHasher: mustHasher(t)}
+	auth.SetPasswordHasher(hasher)
+
+	for _, tt := range []struct {
+		name, email, password string
+		hash                  string
+	}{
+		{"unknown email", "nobody@example.com", testPassword, auth.dummyPasswordHash()},
+		{"wrong password", user.Email, "Wrong-Horse-1", user.PasswordHash},
+	} {
+		hasher.compared = nil
+		_, _, err := auth.Login(context.Background(), tt.email, tt.password, "203.0.113.7", "test-agent")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: Login = %v, want ErrInvalidCredentials", tt.name, err)
+		}
+		if len(hasher.compared) != 1 || hasher.compared[0] != tt.hash {
+			t.Errorf("%s: compared with %q, want once with %q", tt.name, hasher.compared, tt.hash)
+		}
+	}
+}
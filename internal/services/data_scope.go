@@ -28,8 +28,10 @@ func ScopeFieldForResource(resource string) string {
 	switch strings.ToLower(strings.TrimSpace(resource)) {
 	case "customer", "customers", "company", "companies":
 		return "companies"
-	case "campaign", "campaigns", "template", "templates", "sequence", "sequences", "schedule", "schedules":
+	case "campaign", "campaigns", "template", "templates", "sequence", "sequences", "schedule", "schedules", "distribution_lists":
 		return "campaigns"
+	case "user", "users", "team_member", "team_members", "activity", "audit_logs":
+		return "users"
 	default:
 		// Unknown resources default to the strictest shared knob we have.
 		return "campaigns"
@@ -42,6 +44,8 @@ func ScopeValueForResource(scope models.DataScope, resource string) string {
 		return scope.Customers
 	case "campaigns":
 		return scope.Campaigns
+	case "users":
+		return scope.Users
 	default:
 		return scope.Campaigns
 	}
@@ -49,15 +53,25 @@ func ScopeValueForResource(scope models.DataScope, resource string) string {
 
 // GetTeamUserIDs resolves all active users in a given team.
 // Used for DataScope=team enforcement where documents store user IDs (owner/assigned).
-func GetTeamUserIDs(ctx context.Context, userRepo *repositories.MongoUserRepository, team string) ([]string, error) {
+// The team is matched by its canonical reference data code, the form user
+// team fields are validated and stored in. Within a request the RBAC
+// middleware handled, the IDs come from the user scope cache.
+func GetTeamUserIDs(ctx context.Context, userRepo repositories.UserStore, team string) ([]string, error) {
 	if userRepo == nil {
 		return nil, nil
 	}
-	team = strings.TrimSpace(team)
+	team = models.NormalizeReferenceCode(team)
 	if team == "" {
 		return nil, nil
 	}
+	if cached, ok := ctx.Value(teamMembersKey{}).(*userScopeCache); ok {
+		return cached.teamUserIDs(ctx, team)
+	}
+	return listTeamUserIDs(ctx, userRepo, team)
+}
 
+// listTeamUserIDs reads the IDs of the users in a normalized team code
+func listTeamUserIDs(ctx context.Context, userRepo repositories.UserStore, team string) ([]string, error) {
 	users, err := userRepo.ListByTeam(ctx, team, 200, 0)
 	if err != nil {
 		return nil, err
@@ -115,10 +129,31 @@ func IsInScope(resource string, dataScope models.DataScope, claims ScopeClaims,
 			}
 			// Campaigns use owner_id rather than created_by
 			return isCreatedByScoped(scopeValue, claims, v.OwnerID)
+		case *models.DistributionList:
+			if v == nil {
+				return false
+			}
+			return isCreatedByScoped(scopeValue, claims, v.OwnerID)
 		default:
 			// Unknown campaign-like object: safest is allow only for "all"
 			return scopeValue == "all"
 		}
+	case "users":
+		v, ok := obj.(*models.User)
+		if !ok || v == nil {
+			return scopeValue == "all"
+		}
+		// Mirrors the users filters of BuildScopeFilter
+		switch scopeValue {
+		case "all":
+			return true
+		case "region":
+			return v.Region == claims.Region
+		case "team":
+			return v.Team == claims.Team
+		default:
+			return v.ID == claims.UserID
+		}
 	default:
 		// Unknown => allow only for "all", otherwise deny for safety.
 		return scopeValue == "all"
@@ -144,6 +179,25 @@ func isCreatedByScoped(scopeValue string, claims ScopeClaims, createdBy string)
 	}
 }
 
+// CreatedByScope returns the creator IDs a user may see for created_by-owned
+// resources (templates, sequences), mirroring IsInScope. A nil slice means no
+// restriction; denyAll is true for scope "none".
+func CreatedByScope(resource string, dataScope models.DataScope, claims ScopeClaims) (createdBy []string, denyAll bool) {
+	scopeValue := normalizeScopeValue(ScopeValueForResource(dataScope, resource))
+	switch scopeValue {
+	case "", "all":
+		return nil, false
+	case "none":
+		return nil, true
+	case "team":
+		if strings.TrimSpace(claims.Team) != "" && len(claims.TeamUserIDs) > 0 {
+			return claims.TeamUserIDs, false
+		}
+	}
+	// own, region (templates carry no region) and unknown values
+	return []string{claims.UserID}, false
+}
+
 // BuildScopeFilter returns:
 // - filter: MongoDB filter to apply to list queries for the given resource
 // - denyAll: true if access should be blocked entirely (DataScope=none)
@@ -231,6 +285,9 @@ func buildOwnFilter(resource string, claims ScopeClaims) bson.M {
 				{"created_by": claims.UserID},
 			},
 		}
+	case "users":
+		// User documents; activity is scoped by user ID with CreatedByScope
+		return bson.M{"_id": claims.UserID}
 	default:
 		return bson.M{}
 	}
@@ -249,6 +306,8 @@ func buildRegionFilter(resource string, region string) bson.M {
 				{"region": region},
 			},
 		}
+	case "users":
+		return bson.M{"region": region}
 	default:
 		return bson.M{}
 	}
@@ -278,6 +337,8 @@ func buildTeamFilter(resource string, team string, teamUserIDs []string) bson.M
 			)
 		}
 		return bson.M{"$or": or}
+	case "users":
+		return bson.M{"team": team}
 	default:
 		return bson.M{}
 	}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/email"
+)
+
+// ErrDistributionListEmpty is returned when a distribution list has nobody
+// to send to: it has no members, or they are all deactivated, unknown or
+// suppressed
+var ErrDistributionListEmpty = errors.New("distribution list has no recipients")
+
+// errDistributionListsUnavailable is returned by a nil DistributionLists
+// asked to resolve a list
+var errDistributionListsUnavailable = errors.New("distribution lists are not available")
+
+// DistributionLists resolves distribution lists into the addresses their
+// messages are sent to. Lists are resolved when a message goes out, not when
+// it is scheduled, so a member deactivated or suppressed in between is not
+// sent to.
+type DistributionLists struct {
+	repo         repositories.DistributionListStore
+	users        repositories.UserStore
+	suppressions email.SuppressionList
+}
+
+// NewDistributionLists creates a new DistributionLists
+// suppressions can be nil - suppressed addresses are then only dropped by
+// the sender
+func NewDistributionLists(repo repositories.DistributionListStore, users repositories.UserStore, suppressions email.SuppressionList) *DistributionLists {
+	return &DistributionLists{repo: repo, users: users, suppressions: suppressions}
+}
+
+// Expand resolves the members of a list into addresses, in the order they
+// were added. User members are sent to at their account's current address
+// and skipped when deactivated or deleted; addresses on the suppression
+// list and repeats are left out. Archived lists still expand, for the
+// messages scheduled to them before they were archived.
+func (d *DistributionLists) Expand(ctx context.Context, listID string) (*models.DistributionListExpansion, error) {
+	if _, err := d.repo.GetListAnyTenant(ctx, listID); err != nil {
+		return nil, err
+	}
+	members, err := d.repo.AllMembers(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	for _, member := range members {
+		if member.UserID != "" {
+			userIDs = append(userIDs, member.UserID)
+		}
+	}
+	users := make(map[string]*models.User, len(userIDs))
+	if len(userIDs) > 0 {
+		found, err := d.users.GetUsersByIDs(ctx, userIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving distribution list users: %w", err)
+		}
+		for _, user := range found {
+			users[user.ID] = user
+		}
+	}
+
+	expansion := &models.DistributionListExpansion{ListID: listID, Addresses: []string{}}
+	seen := make(map[string]bool, len(members))
+	for _, member := range members {
+		address := member.Email
+		if member.UserID != "" {
+			user := users[member.UserID]
+			switch {
+			case user == nil:
+				expansion.SkippedUnknown++
+				continue
+			case !user.IsActive:
+				expansion.SkippedInactive++
+				continue
+			}
+			address = user.Email
+		}
+		key := strings.ToLower(strings.TrimSpace(address))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		expansion.Addresses = append(expansion.Addresses, address)
+	}
+
+	return d.withoutSuppressed(ctx, expansion), nil
+}
+
+// withoutSuppressed drops the suppressed addresses of an expansion. When
+// the suppression list cannot be read the addresses are kept; the sender
+// filters them again.
+func (d *DistributionLists) withoutSuppressed(ctx context.Context, expansion *models.DistributionListExpansion) *models.DistributionListExpansion {
+	if d.suppressions == nil || len(expansion.Addresses) == 0 {
+		return expansion
+	}
+	suppressed, err := d.suppressions.FilterSuppressed(ctx, expansion.Addresses)
+	if err != nil {
+		log.Printf("Warning: suppression list unavailable, expanding distribution list %s unfiltered: %v", expansion.ListID, err)
+		return expansion
+	}
+	if len(suppressed) == 0 {
+		return expansion
+	}
+
+	skip := make(map[string]bool, len(suppressed))
+	for _, address := range suppressed {
+		skip[address] = true
+	}
+	kept := expansion.Addresses[:0]
+	for _, address := range expansion.Addresses {
+		if skip[strings.ToLower(strings.TrimSpace(address))] {
+			expansion.SkippedSuppressed++
+			continue
+		}
+		kept = append(kept, address)
+	}
+	expansion.Addresses = kept
+	return expansion
+}
+
+// Apply returns the message to send for msg: msg itself when it has no
+// distribution list, otherwise msg with the list's addresses added by
+// WithRecipients. It returns ErrDistributionListEmpty when the list
+// resolves to no address. A nil DistributionLists sends messages without a
+// list as they are.
+func (d *DistributionLists) Apply(ctx context.Context, msg *models.CommMessage) (*models.CommMessage, error) {
+	if msg.DistributionListID == "" {
+		return msg, nil
+	}
+	if d == nil {
+		return nil, errDistributionListsUnavailable
+	}
+	expansion, err := d.Expand(ctx, msg.DistributionListID)
+	if err != nil {
+		return nil, err
+	}
+	if len(expansion.Addresses) == 0 {
+		return nil, ErrDistributionListEmpty
+	}
+	return WithRecipients(msg, expansion), nil
+}
+
+// WithRecipients returns a copy of msg with the addresses of a distribution
+// list added as BCC recipients, leaving out those msg already goes to.
+// Members never see each other's addresses.
+func WithRecipients(msg *models.CommMessage, expansion *models.DistributionListExpansion) *models.CommMessage {
+	addressed := make(map[string]bool)
+	for _, list := range [][]string{msg.ToAddresses, msg.CCAddresses, msg.BCCAddresses} {
+		for _, address := range list {
+			addressed[strings.ToLower(strings.TrimSpace(address))] = true
+		}
+	}
+	sending := *msg
+	sending.BCCAddresses = append([]string(nil), msg.BCCAddresses...)
+	for _, address := range expansion.Addresses {
+		if !addressed[strings.ToLower(strings.TrimSpace(address))] {
+			sending.BCCAddresses = append(sending.BCCAddresses, address)
+		}
+	}
+	return &sending
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// suppressedAddresses is a SuppressionList of fixed lower-cased addresses,
+// failing every lookup when err is set
+type suppressedAddresses struct {
+	addresses []string
+	err       error
+}
+
+func (s suppressedAddresses) FilterSuppressed(ctx context.Context, addrs []string) ([]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var suppressed []string
+	for _, address := range addrs {
+		if normalized := strings.ToLower(strings.TrimSpace(address)); slices.Contains(s.addresses, normalized) {
+			suppressed = append(suppressed, normalized)
+		}
+	}
+	return suppressed, nil
+}
+
+// listFixture is a distribution list with an active member, a deactivated
+// one, a deleted one, a member repeated by address and a suppressed address
+type listFixture struct {
+	lists  *memory.DistributionListStore
+	users  *memory.UserStore
+	listID string
+}
+
+func newListFixture(t *testing.T) *listFixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &listFixture{lists: memory.NewDistributionListStore(), users: memory.NewUserStore(), listID: uuid.MustNewUUID()}
+	active := f.users.Add(&models.User{Email: "Ana@Example.com", IsActive: true})
+	inactive := f.users.Add(&models.User{Email: "ben@example.com", IsActive: false})
+	if err := f.lists.CreateList(ctx, &models.DistributionList{ID: f.listID, Name: "APAC sales", Status: models.DistributionListStatusActive}); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	for i, member := range []models.DistributionListMemberInput{
+		{UserID: active.ID},
+		{UserID: inactive.ID},
+		{UserID: uuid.MustNewUUID()},
+		{Email: "ana@example.com"},
+		{Email: "blocked@example.com"},
+		{Email: "cy@example.com"},
+	} {
+		// One at a time, so the members expand in the order they were added
+		if _, err := f.lists.AddMembers(ctx, f.listID, []models.DistributionListMemberInput{member}, "owner", at.Add(time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+// TestExpandSkipsInactiveAndSuppressedRecipients expands a list and checks
+// deactivated and deleted users, suppressed addresses and repeats are left
+// out and counted
+func TestExpandSkipsInactiveAndSuppressedRecipients(t *testing.T) {
+	f := newListFixture(t)
+	lists := NewDistributionLists(f.lists, f.users, suppressedAddresses{addresses: []string{"blocked@example.com"}})
+
+	expansion, err := lists.Expand(context.Background(), f.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Ana@Example.com", "cy@example.com"}; !slices.Equal(expansion.Addresses, want) {
+		t.Errorf("addresses = %v, want %v", expansion.Addresses, want)
+	}
+	if expansion.SkippedInactive != 1 || expansion.SkippedUnknown != 1 || expansion.SkippedSuppressed != 1 {
+		t.Errorf("skipped %d inactive, %d unknown, %d suppressed; want 1 each", expansion.SkippedInactive, expansion.SkippedUnknown, expansion.SkippedSuppressed)
+	}
+}
+
+// TestExpandResolvesUsersAtSendTime deactivates a member and changes
+// another's address after the list was built, and checks the expansion
+// follows the accounts as they are now
+func TestExpandResolvesUsersAtSendTime(t *testing.T) {
+	ctx := context.Background()
+	lists := memory.NewDistributionListStore()
+	users := memory.NewUserStore()
+	moving := users.Add(&models.User{Email: "old@example.com", IsActive: true})
+	leaving := users.Add(&models.User{Email: "leaving@example.com", IsActive: true})
+	listID := uuid.MustNewUUID()
+	if err := lists.CreateList(ctx, &models.DistributionList{ID: listID, Status: models.DistributionListStatusActive}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lists.AddMembers(ctx, listID, []models.DistributionListMemberInput{{UserID: moving.ID}, {UserID: leaving.ID}}, "owner", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	moving.Email = "new@example.com"
+	users.Add(moving)
+	leaving.IsActive = false
+	users.Add(leaving)
+
+	expansion, err := NewDistributionLists(lists, users, nil).Expand(ctx, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(expansion.Addresses, []string{"new@example.com"}) || expansion.SkippedInactive != 1 {
+		t.Errorf("expansion = %+v, want only the new address and the deactivated user skipped", expansion)
+	}
+}
+
+// TestExpandKeepsAddressesWithoutTheSuppressionList checks an unreadable
+// suppression list leaves the addresses for the sender to filter
+func TestExpandKeepsAddressesWithoutTheSuppressionList(t *testing.T) {
+	f := newListFixture(t)
+	lists := NewDistributionLists(f.lists, f.users, suppressedAddresses{err: errors.New("mongo unavailable")})
+
+	expansion, err := lists.Expand(context.Background(), f.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Ana@Example.com", "blocked@example.com", "cy@example.com"}; !slices.Equal(expansion.Addresses, want) || expansion.SkippedSuppressed != 0 {
+		t.Errorf("expansion = %+v, want %v unfiltered", expansion, want)
+	}
+}
+
+// TestExpandArchivedAndMissingLists checks an archived list still expands
+// for the messages scheduled to it, and a deleted one is not found
+func TestExpandArchivedAndMissingLists(t *testing.T) {
+	ctx := context.Background()
+	f := newListFixture(t)
+	archived := true
+	if _, err := f.lists.UpdateList(ctx, "", f.listID, &models.UpdateDistributionListRequest{Archived: &archived}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	lists := NewDistributionLists(f.lists, f.users, nil)
+
+	if expansion, err := lists.Expand(ctx, f.listID); err != nil || len(expansion.Addresses) != 3 {
+		t.Errorf("archived list = %+v, %v; want it expanded", expansion, err)
+	}
+	if _, err := lists.Expand(ctx, uuid.MustNewUUID()); !errors.Is(err, repositories.ErrDistributionListNotFound) {
+		t.Errorf("unknown list = %v, want ErrDistributionListNotFound", err)
+	}
+}
+
+// TestApplyAddsMembersAsBCC checks a message to a list goes to its members
+// as BCC recipients, without repeating its own recipients, and that a list
+// resolving to nobody refuses the message
+func TestApplyAddsMembersAsBCC(t *testing.T) {
+	ctx := context.Background()
+	f := newListFixture(t)
+	lists := NewDistributionLists(f.lists, f.users, suppressedAddresses{addresses: []string{"blocked@example.com"}})
+
+	msg := &models.CommMessage{ToAddresses: []string{"owner@example.com"}, CCAddresses: []string{"CY@example.com"}, DistributionListID: f.listID}
+	sending, err := lists.Apply(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(sending.BCCAddresses, []string{"Ana@Example.com"}) || !slices.Equal(sending.ToAddresses, msg.ToAddresses) {
+		t.Errorf("sending to %v, BCC %v; want the member not already addressed as BCC", sending.ToAddresses, sending.BCCAddresses)
+	}
+	if msg.BCCAddresses != nil {
+		t.Errorf("Apply changed the message: BCC %v", msg.BCCAddresses)
+	}
+
+	plain := &models.CommMessage{ToAddresses: []string{"owner@example.com"}}
+	if sending, err := lists.Apply(ctx, plain); err != nil || sending != plain {
+		t.Errorf("message without a list = %v, %v; want it unchanged", sending, err)
+	}
+	var none *DistributionLists
+	if _, err := none.Apply(ctx, msg); err == nil {
+		t.Error("nil DistributionLists applied a list")
+	}
+
+	emptyID := uuid.MustNewUUID()
+	if err := f.lists.CreateList(ctx, &models.DistributionList{ID: emptyID, Status: models.DistributionListStatusActive}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.lists.AddMembers(ctx, emptyID, []models.DistributionListMemberInput{{Email: "blocked@example.com"}}, "owner", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lists.Apply(ctx, &models.CommMessage{DistributionListID: emptyID}); !errors.Is(err, ErrDistributionListEmpty) {
+		t.Errorf("list of suppressed addresses = %v, want ErrDistributionListEmpty", err)
+	}
+}
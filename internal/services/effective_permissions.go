@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// EffectivePermissions is what a user may do: the union of their role's
+// permissions, the permissions of their custom roles and the permissions
+// granted to them directly, and the role's data scope with the user's own
+// override applied
+type EffectivePermissions struct {
+	Role        string
+	Permissions []string
+	DataScope   *models.DataScope // nil when neither the role nor the user defines one
+}
+
+// MergePermissions returns role permissions followed by the grants not
+// already among them
+func MergePermissions(rolePermissions, grants []string) []string {
+	merged := make([]string, 0, len(rolePermissions)+len(grants))
+	seen := make(map[string]bool, len(rolePermissions)+len(grants))
+	for _, list := range [][]string{rolePermissions, grants} {
+		for _, permission := range list {
+			if !seen[permission] {
+				seen[permission] = true
+				merged = append(merged, permission)
+			}
+		}
+	}
+	return merged
+}
+
+// permissionMemo keeps the effective permissions resolved during one request
+type permissionMemo struct {
+	mu     sync.Mutex
+	byUser map[string]*EffectivePermissions
+}
+
+type permissionMemoKey struct{}
+
+// WithPermissionMemo returns a context in which EffectivePermissions resolves
+// each user once. The RBAC middleware installs it on every request.
+func WithPermissionMemo(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(permissionMemoKey{}).(*permissionMemo); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, permissionMemoKey{}, &permissionMemo{byUser: make(map[string]*EffectivePermissions)})
+}
+
+// EffectivePermissions resolves the effective permissions of user. Route
+// authorization and GET /auth/me both use it so they cannot disagree.
+func (s *RBACService) EffectivePermissions(ctx context.Context, user *models.User) (*EffectivePermissions, error) {
+	memo, _ := ctx.Value(permissionMemoKey{}).(*permissionMemo)
+	if memo != nil {
+		memo.mu.Lock()
+		cached, ok := memo.byUser[user.ID]
+		memo.mu.Unlock()
+		if ok {
+			return cached, nil
+		}
+	}
+
+	role := string(user.Role)
+	permissions, dataScope, err := s.GetPermissionsForRole(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	customPermissions, err := s.PermissionsForRoleIDs(ctx, user.RoleIDs)
+	if err != nil {
+		return nil, err
+	}
+	effective := &EffectivePermissions{
+		Role:        role,
+		Permissions: MergePermissions(MergePermissions(permissions, customPermissions), user.Permissions),
+		DataScope:   dataScope,
+	}
+	if user.DataScope != nil {
+		scope := models.DataScope{}
+		if dataScope != nil {
+			scope = *dataScope
+		}
+		scope = scope.WithOverride(user.DataScope)
+		effective.DataScope = &scope
+	}
+
+	if memo != nil {
+		memo.mu.Lock()
+		memo.byUser[user.ID] = effective
+		memo.mu.Unlock()
+	}
+	return effective, nil
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergePermissions(t *testing.T) {
+	for _, tt := range []struct {
+		role, grants, want []string
+	}{
+		{nil, nil, []string{}},
+		{[]string{"a:b:c"}, nil, []string{"a:b:c"}},
+		{nil, []string{"x:y:z"}, []string{"x:y:z"}},
+		{[]string{"a:b:c", "d:e:f"}, []string{"x:y:z", "a:b:c"}, []string{"a:b:c", "d:e:f", "x:y:z"}},
+		{[]string{"a:b:c", "a:b:c"}, []string{"x:y:z", "x:y:z"}, []string{"a:b:c", "x:y:z"}},
+	} {
+		if got := MergePermissions(tt.role, tt.grants); !slices.Equal(got, tt.want) {
+			t.Errorf("MergePermissions(%v, %v) = %v, want %v", tt.role, tt.grants, got, tt.want)
+		}
+	}
+}
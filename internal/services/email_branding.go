@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/emailtemplates"
+	"github.com/white/user-management/internal/models"
+)
+
+// emailBrandingCacheTTL bounds how long the branding read from the company
+// info is reused, so sending an email does not read the settings every
+// time. Changes made on this instance apply at once; other instances pick
+// them up within the TTL.
+const emailBrandingCacheTTL = 5 * time.Minute
+
+// CompanyInfoReader reads the company info the email branding is kept in
+type CompanyInfoReader interface {
+	GetCompanyInfo(ctx context.Context) (*models.SettingsCompanyInfo, error)
+}
+
+// EmailBranding provides the organisation's branding of the emails the
+// platform sends on its own, from the company info settings
+type EmailBranding struct {
+	settings CompanyInfoReader
+	name     string // Product name, the configured sender name
+
+	mu        sync.Mutex
+	cached    *emailtemplates.Branding
+	expiresAt time.Time
+}
+
+// NewEmailBranding creates an EmailBranding reading the company info from
+// settings, with name as the product name in the emails
+func NewEmailBranding(settings CompanyInfoReader, name string) *EmailBranding {
+	return &EmailBranding{settings: settings, name: name}
+}
+
+// Get returns the current branding. When the company info cannot be read it
+// returns the last branding read, or the defaults when there is none. A nil
+// EmailBranding returns emailtemplates.DefaultBranding.
+func (b *EmailBranding) Get(ctx context.Context) emailtemplates.Branding {
+	if b == nil {
+		return emailtemplates.DefaultBranding
+	}
+	now := time.Now()
+	b.mu.Lock()
+	cached, expiresAt := b.cached, b.expiresAt
+	b.mu.Unlock()
+	if cached != nil && now.Before(expiresAt) {
+		return *cached
+	}
+
+	info, err := b.settings.GetCompanyInfo(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to load company info, emails use the last known branding: %v", err)
+		if cached != nil {
+			return *cached
+		}
+		return emailtemplates.Branding{Name: b.name}.WithDefaults()
+	}
+
+	brand := brandingFromCompanyInfo(info, b.name)
+	b.mu.Lock()
+	b.cached, b.expiresAt = &brand, now.Add(emailBrandingCacheTTL)
+	b.mu.Unlock()
+	return brand
+}
+
+// Invalidate drops the cached branding (call after changing the company
+// info)
+func (b *EmailBranding) Invalidate() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.cached = nil
+	b.mu.Unlock()
+}
+
+// brandingFromCompanyInfo builds the branding of info. The company logo is
+// used when no email logo is set and it is an https URL, since mail clients
+// block other images.
+func brandingFromCompanyInfo(info *models.SettingsCompanyInfo, name string) emailtemplates.Branding {
+	settings := info.EmailBranding
+	brand := emailtemplates.Branding{
+		Name:         name,
+		PrimaryColor: settings.PrimaryColor,
+		LogoURL:      settings.LogoURL,
+		FooterText:   settings.FooterText,
+		SupportEmail: settings.SupportEmail,
+		Tagline:      settings.Tagline,
+	}
+	if brand.LogoURL == "" {
+		if u, err := url.Parse(info.Logo); err == nil && u.Scheme == "https" && u.Host != "" {
+			brand.LogoURL = info.Logo
+		}
+	}
+	return brand.WithDefaults()
+}
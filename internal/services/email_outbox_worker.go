@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// outboxBatchLimit bounds how many emails one sweep sends, so a large
+// backlog cannot keep a sweep running past shutdown for long
+const outboxBatchLimit = 100
+
+// EmailOutboxWorker sends scheduled emails once due and retries outbound
+// emails left in queued status, either because the sending request failed to
+// deliver them or because an earlier retry failed. Claims are leased, so several API instances can run it.
+type EmailOutboxWorker struct {
+	repo     *repositories.MongoEmailRepository
+	sender   email.EmailSender
+	producer *kafka.Producer
+	config   config.OutboxConfig
+	owner    string
+	window   *SendWindowEnforcer // nil sends at any time of day
+	lists    *DistributionLists  // Resolves the recipients of emails to a distribution list
+}
+
+// NewEmailOutboxWorker creates a new EmailOutboxWorker
+// producer can be nil - failure events are skipped
+func NewEmailOutboxWorker(repo *repositories.MongoEmailRepository, sender email.EmailSender, producer *kafka.Producer, cfg config.OutboxConfig) *EmailOutboxWorker {
+	hostname, _ := os.Hostname()
+	return &EmailOutboxWorker{
+		repo:     repo,
+		sender:   sender,
+		producer: producer,
+		config:   cfg,
+		owner:    fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.MustNewUUID()),
+	}
+}
+
+// SetSendWindow holds emails that are not urgent until the organization's
+// working hours
+func (w *EmailOutboxWorker) SetSendWindow(window *SendWindowEnforcer) {
+	w.window = window
+}
+
+// SetDistributionLists resolves the members of the distribution list an
+// email is sent to when it is sent. Without it, emails to a list fail.
+func (w *EmailOutboxWorker) SetDistributionLists(lists *DistributionLists) {
+	w.lists = lists
+}
+
+// Run sweeps the outbox immediately and then on every poll interval until ctx is cancelled
+func (w *EmailOutboxWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: email outbox sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue sends scheduled emails that have come due, then claims and
+// sends queued emails until none are left (or the batch limit is reached),
+// and returns how many were sent
+func (w *EmailOutboxWorker) ProcessDue(ctx context.Context) (int, error) {
+	opts := repositories.OutboxClaimOptions{
+		Owner:       w.owner,
+		Lease:       w.config.Lease,
+		RetryAfter:  w.config.RetryAfter,
+		MaxAge:      w.config.MaxAge,
+		MaxAttempts: w.config.MaxAttempts,
+	}
+
+	sent := 0
+	for i := 0; i < outboxBatchLimit && ctx.Err() == nil; i++ {
+		scheduled, err := w.repo.ClaimScheduledEmail(ctx, w.owner, w.config.Lease)
+		if err != nil {
+			return sent, err
+		}
+		if scheduled == nil {
+			break
+		}
+		if w.process(context.WithoutCancel(ctx), scheduled) {
+			sent++
+		}
+	}
+
+	for i := 0; i < outboxBatchLimit && ctx.Err() == nil; i++ {
+		queued, err := w.repo.ClaimQueuedEmail(ctx, opts)
+		if err != nil {
+			return sent, err
+		}
+		if queued == nil {
+			break
+		}
+		// A claimed email is finished even if shutdown starts mid-send
+		if w.process(context.WithoutCancel(ctx), queued) {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("Email outbox sent %d queued email(s)", sent)
+	}
+	return sent, nil
+}
+
+// process makes one send attempt for a claimed email and records the outcome
+func (w *EmailOutboxWorker) process(ctx context.Context, queued *models.MongoCommunication) bool {
+	if queued.ExpiresAt != nil && time.Now().After(*queued.ExpiresAt) {
+		w.fail(ctx, queued, "expired before delivery", nil)
+		return false
+	}
+
+	if opening := w.window.DeferUntil(ctx, queued.Priority); opening != nil {
+		w.holdForSendWindow(ctx, queued.ID, *opening)
+		return false
+	}
+
+	msg, err := w.lists.Apply(ctx, outboxMessage(queued))
+	if err != nil {
+		// A list deleted or left without recipients since is not retried
+		if errors.Is(err, ErrDistributionListEmpty) || errors.Is(err, repositories.ErrDistributionListNotFound) {
+			w.fail(ctx, queued, err.Error(), nil)
+			return false
+		}
+		w.fail(ctx, queued, err.Error(), w.nextAttempt(queued))
+		return false
+	}
+	if err := w.sender.SendEmail(ctx, msg); err != nil {
+		if deferred := w.deferOverQuota(ctx, queued.ID, err); deferred {
+			return false
+		}
+		w.fail(ctx, queued, err.Error(), w.nextAttempt(queued))
+		return false
+	}
+
+	if err := w.repo.MarkSent(ctx, queued.ID, w.sender.Name(), msg.ExternalID); err != nil {
+		log.Printf("Warning: email %s was sent but could not be marked sent: %v", queued.ID, err)
+	}
+	return true
+}
+
+// deferOverQuota keeps an email held back by a send limit queued until the
+// limit resets, without spending one of its attempts. It reports whether err
+// was a send limit.
+func (w *EmailOutboxWorker) deferOverQuota(ctx context.Context, id string, err error) bool {
+	var quotaErr *email.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	if deferErr := w.repo.DeferEmail(ctx, id, w.owner, err.Error(), quotaErr.ResetsAt); deferErr != nil {
+		log.Printf("Warning: failed to defer email %s over the send limit: %v", id, deferErr)
+		return true
+	}
+	log.Printf("Email %s held back until %s: %v", id, quotaErr.ResetsAt.Format(time.RFC3339), err)
+	return true
+}
+
+// holdForSendWindow reschedules an email due outside the send window for
+// the window's next opening, without spending one of its attempts
+func (w *EmailOutboxWorker) holdForSendWindow(ctx context.Context, id string, opening time.Time) {
+	if err := w.repo.RescheduleEmail(ctx, id, w.owner, opening); err != nil {
+		log.Printf("Warning: failed to hold email %s for the send window: %v", id, err)
+		return
+	}
+	log.Printf("Email %s held for the send window until %s", id, opening.Format(time.RFC3339))
+}
+
+// fail records a failed attempt; without a next attempt the email is marked
+// failed for good and a failure event is published
+func (w *EmailOutboxWorker) fail(ctx context.Context, queued *models.MongoCommunication, reason string, next *time.Time) {
+	if err := w.repo.RecordSendFailure(ctx, queued.ID, w.owner, reason, next); err != nil {
+		log.Printf("Warning: failed to record send failure for email %s: %v", queued.ID, err)
+		return
+	}
+	if next != nil {
+		log.Printf("Email %s attempt %d failed, retrying at %s: %s", queued.ID, queued.SendAttempts, next.Format(time.RFC3339), reason)
+		return
+	}
+
+	log.Printf("Email %s failed after %d attempt(s): %s", queued.ID, queued.SendAttempts, reason)
+	_ = events.Publish(ctx, w.producer, events.EmailFailed{
+		Envelope:  events.NewEnvelope(events.TypeEmailFailed, "", queued.TenantID),
+		MessageID: queued.ID,
+		UserID:    queued.UserID,
+		Attempts:  queued.SendAttempts,
+		Reason:    reason,
+	})
+}
+
+// nextAttempt returns when a failed email is tried again, nil when it has
+// used up its attempts
+func (w *EmailOutboxWorker) nextAttempt(queued *models.MongoCommunication) *time.Time {
+	if queued.SendAttempts >= w.config.MaxAttempts {
+		return nil
+	}
+	at := time.Now().Add(w.backoff(queued.SendAttempts))
+	return &at
+}
+
+// backoff returns the delay after the given number of failed attempts:
+// Backoff doubled per attempt, capped at MaxBackoff
+func (w *EmailOutboxWorker) backoff(attempts int) time.Duration {
+	delay := w.config.Backoff
+	for i := 1; i < attempts && delay < w.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.config.MaxBackoff {
+		delay = w.config.MaxBackoff
+	}
+	return delay
+}
+
+// outboxMessage rebuilds the message to send from its stored record
+func outboxMessage(queued *models.MongoCommunication) *models.CommMessage {
+	to := queued.ToEmail
+	if to == "" {
+		to = queued.To
+	}
+	return &models.CommMessage{
+		MessageID:          queued.ID,
+		ThreadID:           queued.ThreadID,
+		Channel:            queued.Channel,
+		Direction:          queued.Direction,
+		Status:             queued.Status,
+		FromAddress:        queued.FromEmail,
+		FromName:           queued.From,
+		ToAddresses:        []string{to},
+		CCAddresses:        queued.CC,
+		BCCAddresses:       queued.BCC,
+		Subject:            queued.Subject,
+		BodyText:           queued.Body,
+		BodyHTML:           queued.BodyHTML,
+		Attachments:        queued.Attachments,
+		UserID:             queued.UserID,
+		TenantID:           queued.TenantID,
+		Priority:           queued.Priority,
+		SignatureApplied:   queued.SignatureApplied,
+		DistributionListID: queued.DistributionListID,
+		CreatedAt:          queued.CreatedAt,
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/uuid"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// ErrEmailQueueDisabled is returned by Enqueue when emails are not queued on
+// Kafka; callers send the email directly instead
+var ErrEmailQueueDisabled = errors.New("email queue is disabled")
+
+// workerRestartDelay is how long the worker waits before reconnecting after
+// its consumer stops on an error
+const workerRestartDelay = 5 * time.Second
+
+// EmailQueue hands stored outbound emails to the email worker through Kafka,
+// so requests don't wait on the email provider. A nil *EmailQueue is
+// disabled.
+type EmailQueue struct {
+	producer *kafka.Producer
+	topics   config.KafkaTopics
+}
+
+// NewEmailQueue creates an EmailQueue, or returns nil (disabled) when the
+// worker is off or Kafka has no brokers
+func NewEmailQueue(producer *kafka.Producer, cfg *config.Config) *EmailQueue {
+	if !cfg.Worker.Enabled || !producer.Enabled() {
+		return nil
+	}
+	return &EmailQueue{producer: producer, topics: cfg.Kafka.Topics}
+}
+
+// Enqueue publishes msg, which must already be stored with queued status, to
+// the queue topic for its priority and waits for the broker to accept it
+func (q *EmailQueue) Enqueue(ctx context.Context, msg *models.CommMessage) error {
+	if q == nil {
+		return ErrEmailQueueDisabled
+	}
+	data, err := json.Marshal(models.NewEmailQueueMessage(msg.MessageID, msg.Priority))
+	if err != nil {
+		return fmt.Errorf("failed to marshal queued email: %w", err)
+	}
+	return q.producer.ProduceSync(ctx, emailQueueTopic(q.topics, msg.Priority), []byte(msg.MessageID), data, nil)
+}
+
+// emailQueueTopic returns the queue topic for an email priority
+func emailQueueTopic(topics config.KafkaTopics, priority string) string {
+	if priority == models.PriorityUrgent {
+		return topics.EmailQueuedUrgent
+	}
+	return topics.EmailQueued
+}
+
+// EmailQueueWorker consumes queued emails from Kafka and sends them. Each
+// queue topic has its own consumer, so urgent emails are never stuck behind
+// bulk ones. An offset is committed only once the email's status is saved;
+// emails that fail every attempt go to the dead-letter topic.
+type EmailQueueWorker struct {
+	repo     *repositories.MongoEmailRepository
+	sender   email.EmailSender
+	producer *kafka.Producer
+	kafka    config.KafkaConfig
+	config   config.WorkerConfig
+	lease    time.Duration
+	owner    string
+}
+
+// NewEmailQueueWorker creates a new EmailQueueWorker. Claims use the email
+// outbox lease, so the worker and the outbox sweep never send the same email
+// at once.
+func NewEmailQueueWorker(repo *repositories.MongoEmailRepository, sender email.EmailSender, producer *kafka.Producer, cfg *config.Config) *EmailQueueWorker {
+	hostname, _ := os.Hostname()
+	return &EmailQueueWorker{
+		repo:     repo,
+		sender:   sender,
+		producer: producer,
+		kafka:    cfg.Kafka,
+		config:   cfg.Worker,
+		lease:    cfg.Outbox.Lease,
+		owner:    fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.MustNewUUID()),
+	}
+}
+
+// Run consumes every queue topic until ctx is cancelled
+func (w *EmailQueueWorker) Run(ctx context.Context) {
+	topics := []string{w.kafka.Topics.EmailQueuedUrgent, w.kafka.Topics.EmailQueued}
+	done := make(chan struct{}, len(topics))
+	for _, topic := range topics {
+		go func() {
+			w.consume(ctx, topic)
+			done <- struct{}{}
+		}()
+	}
+	for range topics {
+		<-done
+	}
+}
+
+// consume reads one topic, reconnecting after errors. Reconnecting resumes
+// from the last committed offset, so a message whose handling failed is
+// delivered again.
+func (w *EmailQueueWorker) consume(ctx context.Context, topic string) {
+	for ctx.Err() == nil {
+		consumer, err := kafka.NewConsumer(w.kafka, topic)
+		if err != nil {
+			log.Printf("Warning: email worker cannot consume %s: %v", topic, err)
+			return
+		}
+		err = consumer.Consume(ctx, w.handle)
+		if closeErr := consumer.Close(); closeErr != nil {
+			log.Printf("Warning: failed to close %s consumer: %v", topic, closeErr)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Warning: email worker stopped consuming %s, restarting in %s: %v", topic, workerRestartDelay, err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(workerRestartDelay):
+		}
+	}
+}
+
+// handle sends the email a queue message refers to, retrying up to
+// MaxAttempts times. It returns an error only when the outcome could not be
+// saved, leaving the message uncommitted.
+func (w *EmailQueueWorker) handle(ctx context.Context, message kafkago.Message) error {
+	var queued models.EmailQueueMessage
+	if err := json.Unmarshal(message.Value, &queued); err != nil || queued.MessageID == "" {
+		return w.deadLetter(ctx, message, "invalid queue message", 0)
+	}
+
+	for attempt := 1; ; attempt++ {
+		claimed, err := w.repo.ClaimEmail(ctx, queued.MessageID, w.owner, w.lease)
+		if err != nil {
+			return err
+		}
+		if claimed == nil {
+			// Already sent, failed for good, or being sent by the outbox sweep
+			return nil
+		}
+		if claimed.ExpiresAt != nil && time.Now().After(*claimed.ExpiresAt) {
+			return w.repo.RecordSendFailure(ctx, claimed.ID, w.owner, "expired before delivery", nil)
+		}
+
+		// A claimed email is finished even if shutdown starts mid-send
+		sendCtx := context.WithoutCancel(ctx)
+		msg := outboxMessage(claimed)
+		sendErr := w.sender.SendEmail(sendCtx, msg)
+		if sendErr == nil {
+			return w.repo.MarkSent(sendCtx, claimed.ID, w.sender.Name(), msg.ExternalID)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Over a send limit: the outbox sweep sends it once the limit resets
+		var quotaErr *email.QuotaExceededError
+		if errors.As(sendErr, &quotaErr) {
+			log.Printf("Email %s held back until %s: %v", claimed.ID, quotaErr.ResetsAt.Format(time.RFC3339), sendErr)
+			return w.repo.DeferEmail(ctx, claimed.ID, w.owner, sendErr.Error(), quotaErr.ResetsAt)
+		}
+
+		if attempt >= w.config.MaxAttempts {
+			if err := w.repo.RecordSendFailure(ctx, claimed.ID, w.owner, sendErr.Error(), nil); err != nil {
+				return err
+			}
+			log.Printf("Email %s failed after %d attempt(s), dead-lettered: %v", claimed.ID, attempt, sendErr)
+			_ = events.Publish(ctx, w.producer, events.EmailFailed{
+				Envelope:  events.NewEnvelope(events.TypeEmailFailed, "", claimed.TenantID),
+				MessageID: claimed.ID,
+				UserID:    claimed.UserID,
+				Attempts:  claimed.SendAttempts,
+				Reason:    sendErr.Error(),
+			})
+			return w.deadLetter(ctx, message, sendErr.Error(), attempt)
+		}
+
+		next := time.Now().Add(w.config.Backoff)
+		if err := w.repo.RecordSendFailure(ctx, claimed.ID, w.owner, sendErr.Error(), &next); err != nil {
+			return err
+		}
+		log.Printf("Email %s attempt %d failed, retrying in %s: %v", claimed.ID, attempt, w.config.Backoff, sendErr)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.config.Backoff):
+		}
+	}
+}
+
+// deadLetter copies a queue message to the dead-letter topic with the reason
+// it could not be processed
+func (w *EmailQueueWorker) deadLetter(ctx context.Context, message kafkago.Message, reason string, attempts int) error {
+	headers := map[string]string{
+		"source_topic": message.Topic,
+		"error":        reason,
+		"attempts":     strconv.Itoa(attempts),
+	}
+	if err := w.producer.ProduceSync(ctx, w.kafka.Topics.EmailDeadLetter, message.Key, message.Value, headers); err != nil {
+		return fmt.Errorf("failed to dead-letter queued email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// emailUsagePeriods are the quota periods every sent email counts against
+var emailUsagePeriods = []string{models.EmailUsageDay, models.EmailUsageMonth}
+
+// EmailUsagePeriod is the usage of one quota period
+type EmailUsagePeriod struct {
+	Period      string     `json:"period"`
+	Start       time.Time  `json:"start"`
+	ResetsAt    time.Time  `json:"resetsAt"`
+	Sent        int64      `json:"sent"`
+	Limit       int64      `json:"limit"`   // 0 means no limit
+	Percent     float64    `json:"percent"` // Share of the limit used, 0 without a limit
+	Exceeded    bool       `json:"exceeded"`
+	AlertSentAt *time.Time `json:"alertSentAt,omitempty"`
+}
+
+// EmailUsageReport is the current usage of every quota period
+type EmailUsageReport struct {
+	Daily        EmailUsagePeriod `json:"daily"`
+	Monthly      EmailUsagePeriod `json:"monthly"`
+	AlertPercent int              `json:"alertPercent"`
+}
+
+// EmailQuota enforces the daily and monthly outbound email limits of the
+// system email notification settings. Urgent emails such as 2FA codes are
+// never held back, but count towards usage like any other. When usage
+// crosses EmailSendLimitAlertPercent of a limit, the system notification
+// email is alerted once per period. Periods follow UTC.
+type EmailQuota struct {
+	settings repositories.SettingsStore
+	usage    repositories.EmailUsageStore
+	alerts   email.EmailSender // nil logs alerts instead of emailing them
+	now      func() time.Time
+}
+
+// NewEmailQuota creates a new EmailQuota
+func NewEmailQuota(settings repositories.SettingsStore, usage repositories.EmailUsageStore) *EmailQuota {
+	return &EmailQuota{settings: settings, usage: usage, now: time.Now}
+}
+
+// SetAlertSender sets the sender of usage alerts. It is set after the quota
+// wraps the provider, so alerts go through the same pipeline.
+func (q *EmailQuota) SetAlertSender(sender email.EmailSender) {
+	q.alerts = sender
+}
+
+// CheckSend returns a *email.QuotaExceededError when a send limit has been
+// reached and msg is not urgent
+func (q *EmailQuota) CheckSend(ctx context.Context, msg *models.CommMessage) error {
+	if msg.Priority == models.PriorityUrgent {
+		return nil
+	}
+	settings, err := q.settings.GetSystemEmailNotificationSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := q.now()
+	for _, period := range emailUsagePeriods {
+		limit := sendLimit(settings, period)
+		if limit <= 0 {
+			continue
+		}
+		start := models.EmailUsageStart(period, now)
+		usage, err := q.usage.GetEmailUsage(ctx, period, start)
+		if err != nil {
+			return err
+		}
+		if usage.Sent >= limit {
+			return &email.QuotaExceededError{Period: period, Limit: limit, ResetsAt: models.EmailUsageEnd(period, start)}
+		}
+	}
+	return nil
+}
+
+// RecordSend counts msg in every period and alerts when this send took usage
+// over the alert percentage of a limit
+func (q *EmailQuota) RecordSend(ctx context.Context, msg *models.CommMessage) error {
+	now := q.now()
+	counted := make(map[string]*models.EmailUsage, len(emailUsagePeriods))
+	for _, period := range emailUsagePeriods {
+		usage, err := q.usage.IncrementEmailUsage(ctx, period, models.EmailUsageStart(period, now), 1, now)
+		if err != nil {
+			return err
+		}
+		counted[period] = usage
+	}
+
+	settings, err := q.settings.GetSystemEmailNotificationSettings(ctx)
+	if err != nil {
+		return err
+	}
+	for _, period := range emailUsagePeriods {
+		usage := counted[period]
+		limit := sendLimit(settings, period)
+		if !overAlertThreshold(usage.Sent, limit, settings.EmailSendLimitAlertPercent) {
+			continue
+		}
+		claimed, err := q.usage.ClaimUsageAlert(ctx, period, usage.Start, now)
+		if err != nil {
+			return err
+		}
+		if claimed {
+			q.sendAlert(ctx, settings, usage, limit)
+		}
+	}
+	return nil
+}
+
+// Usage returns the usage of the periods now falls in, along with their limits
+func (q *EmailQuota) Usage(ctx context.Context, now time.Time) (*EmailUsageReport, error) {
+	settings, err := q.settings.GetSystemEmailNotificationSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EmailUsageReport{AlertPercent: settings.EmailSendLimitAlertPercent}
+	for _, period := range emailUsagePeriods {
+		start := models.EmailUsageStart(period, now)
+		usage, err := q.usage.GetEmailUsage(ctx, period, start)
+		if err != nil {
+			return nil, err
+		}
+		limit := sendLimit(settings, period)
+		current := EmailUsagePeriod{
+			Period:      period,
+			Start:       start,
+			ResetsAt:    models.EmailUsageEnd(period, start),
+			Sent:        usage.Sent,
+			Limit:       limit,
+			Exceeded:    limit > 0 && usage.Sent >= limit,
+			AlertSentAt: usage.AlertSentAt,
+		}
+		if limit > 0 {
+			current.Percent = float64(usage.Sent) * 100 / float64(limit)
+		}
+		if period == models.EmailUsageMonth {
+			report.Monthly = current
+		} else {
+			report.Daily = current
+		}
+	}
+	return report, nil
+}
+
+// sendAlert emails the system notification address that usage crossed the
+// alert percentage. Failures are logged; the alert is not retried.
+func (q *EmailQuota) sendAlert(ctx context.Context, settings *models.SystemEmailNotificationSettings, usage *models.EmailUsage, limit int64) {
+	resetsAt := models.EmailUsageEnd(usage.Period, usage.Start)
+	summary := fmt.Sprintf("%d of the %d emails allowed this %s have been sent (%d%% alert threshold). Usage resets at %s UTC.",
+		usage.Sent, limit, usage.Period, settings.EmailSendLimitAlertPercent, resetsAt.Format("2006-01-02 15:04"))
+	if q.alerts == nil || settings.SystemNotificationEmail == "" {
+		log.Printf("Email send limit alert: %s", summary)
+		return
+	}
+
+	now := q.now()
+	msg := &models.CommMessage{
+		MessageID:   uuid.MustNewUUID(),
+		Channel:     models.ChannelEmail,
+		Direction:   models.DirectionOutbound,
+		Status:      models.MessageStatusQueued,
+		FromAddress: q.alerts.FromAddress(),
+		FromName:    "White Platform",
+		ToAddresses: []string{settings.SystemNotificationEmail},
+		Subject:     fmt.Sprintf("Email send limit: %d%% of the %s limit used", usage.Sent*100/limit, usage.Period),
+		BodyText:    summary + "\n\nNon-urgent emails are held back once the limit is reached. Raise the limit in the system email notification settings if needed.",
+		BodyHTML: "<p>" + html.EscapeString(summary) + "</p>" +
+			"<p>Non-urgent emails are held back once the limit is reached. Raise the limit in the system email notification settings if needed.</p>",
+		Priority:  models.PriorityUrgent,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := q.alerts.SendEmail(ctx, msg); err != nil {
+		log.Printf("Warning: failed to send email send limit alert to %s: %v", settings.SystemNotificationEmail, err)
+		return
+	}
+	log.Printf("Email send limit alert sent to %s: %s", settings.SystemNotificationEmail, summary)
+}
+
+// sendLimit returns the configured limit of a period, 0 when there is none
+func sendLimit(settings *models.SystemEmailNotificationSettings, period string) int64 {
+	if period == models.EmailUsageMonth {
+		return settings.MonthlySendLimit
+	}
+	return settings.DailySendLimit
+}
+
+// overAlertThreshold reports whether sent is at or over percent of limit
+func overAlertThreshold(sent, limit int64, percent int) bool {
+	return limit > 0 && percent > 0 && sent*100 >= limit*int64(percent)
+}
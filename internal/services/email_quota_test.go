@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/pkg/email"
+)
+
+// TestEmailQuotaHoldsBackSendsOverTheDailyLimit sends up to a daily limit of
+// 4 with an alert at 50%, checking the alert goes out once and urgent
+// emails still pass the limit
+func TestEmailQuotaHoldsBackSendsOverTheDailyLimit(t *testing.T) {
+	ctx := context.Background()
+	settings := memory.NewSettingsStore(memory.NewUserStore())
+	limit, percent, notify := int64(4), 50, "ops@example.test"
+	if _, err := settings.UpdateSystemEmailNotificationSettings(ctx, &models.UpdateSystemEmailNotificationSettingsRequest{
+		SystemNotificationEmail:    &notify,
+		EmailSendLimitAlertPercent: &percent,
+		DailySendLimit:             &limit,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	alerts := &recordingSender{}
+	quota := NewEmailQuota(settings, memory.NewEmailUsageStore())
+	quota.SetAlertSender(alerts)
+	now := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+	quota.now = func() time.Time { return now }
+
+	msg := &models.CommMessage{Priority: models.PriorityNormal}
+	for i := 0; i < 4; i++ {
+		if err := quota.CheckSend(ctx, msg); err != nil {
+			t.Fatalf("send %d: %v", i+1, err)
+		}
+		if err := quota.RecordSend(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		if want := min(1, (i+1)/2); alerts.count() != want {
+			t.Errorf("after %d sends %d alerts were sent, want %d", i+1, alerts.count(), want)
+		}
+	}
+
+	var exceeded *email.QuotaExceededError
+	if err := quota.CheckSend(ctx, msg); !errors.As(err, &exceeded) || exceeded.Period != models.EmailUsageDay {
+		t.Fatalf("send over the limit = %v, want the daily quota exceeded", err)
+	}
+	if !exceeded.ResetsAt.Equal(time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("resets at %v, want midnight UTC", exceeded.ResetsAt)
+	}
+	if err := quota.CheckSend(ctx, &models.CommMessage{Priority: models.PriorityUrgent}); err != nil {
+		t.Errorf("urgent send over the limit = %v, want it allowed", err)
+	}
+
+	report, err := quota.Usage(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Daily.Sent != 4 || !report.Daily.Exceeded || report.Daily.AlertSentAt == nil || report.Monthly.Sent != 4 || report.Monthly.Exceeded {
+		t.Errorf("usage = %+v", report)
+	}
+
+	// A new day starts over
+	now = now.Add(24 * time.Hour)
+	if err := quota.CheckSend(ctx, msg); err != nil {
+		t.Errorf("first send of the next day = %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"strings"
+
+	"github.com/white/user-management/internal/models"
+	xhtml "golang.org/x/net/html"
+)
+
+// signatureMarker starts the signature in an HTML body; a body that
+// contains it is never signed again
+const signatureMarker = "<!-- email-signature -->"
+
+// signatureTextSeparator starts the signature in a plain text body, the
+// usual "-- " signature delimiter
+const signatureTextSeparator = "\n\n-- \n"
+
+// signatureDroppedElements are removed from signatures with everything in
+// them: they run code, load other pages or restyle the whole message
+var signatureDroppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "form": true, "input": true,
+	"button": true, "textarea": true, "select": true, "link": true, "meta": true,
+	"base": true, "head": true, "title": true, "svg": true, "math": true, "noscript": true,
+}
+
+// signatureVoidElements are dropped elements without content or end tag
+var signatureVoidElements = map[string]bool{"input": true, "link": true, "meta": true, "base": true, "embed": true, "frame": true}
+
+// signatureURLAttributes hold URLs, which may only be http(s), mailto or tel
+var signatureURLAttributes = map[string]bool{"href": true, "src": true, "background": true, "action": true, "formaction": true}
+
+// SanitizeSignatureHTML makes a user's signature safe to put into the emails
+// they send: scripts, styles, frames, forms and similar elements are dropped
+// with their content, as are event handler attributes and URLs other than
+// http(s), mailto and tel. The remaining markup is kept.
+func SanitizeSignatureHTML(signature string) string {
+	var out bytes.Buffer
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(signature))
+	dropping := "" // Element whose content is being dropped
+	depth := 0
+	for {
+		tt := tokenizer.Next()
+		if tt == xhtml.ErrorToken {
+			return strings.TrimSpace(out.String())
+		}
+		token := tokenizer.Token()
+		name := strings.ToLower(token.Data)
+
+		if dropping != "" {
+			switch {
+			case tt == xhtml.StartTagToken && name == dropping:
+				depth++
+			case tt == xhtml.EndTagToken && name == dropping:
+				depth--
+				if depth == 0 {
+					dropping = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if signatureDroppedElements[name] {
+				if tt == xhtml.StartTagToken && !signatureVoidElements[name] {
+					dropping, depth = name, 1
+				}
+				continue
+			}
+			token.Attr = safeSignatureAttributes(token.Attr)
+			out.WriteString(token.String())
+		case xhtml.EndTagToken:
+			if !signatureDroppedElements[name] {
+				out.WriteString(token.String())
+			}
+		case xhtml.TextToken:
+			out.WriteString(token.String())
+		}
+		// Comments and doctypes are dropped
+	}
+}
+
+// safeSignatureAttributes drops event handlers and unsafe URLs
+func safeSignatureAttributes(attrs []xhtml.Attribute) []xhtml.Attribute {
+	kept := attrs[:0]
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+		if strings.HasPrefix(key, "on") || key == "srcdoc" || key == "formaction" {
+			continue
+		}
+		if signatureURLAttributes[key] && !safeSignatureURL(attr.Val) {
+			continue
+		}
+		if key == "style" && strings.Contains(strings.ToLower(attr.Val), "url(") {
+			continue
+		}
+		kept = append(kept, attr)
+	}
+	return kept
+}
+
+// safeSignatureURL allows relative, http(s), mailto and tel URLs
+func safeSignatureURL(value string) bool {
+	value = strings.ToLower(strings.Join(strings.Fields(value), ""))
+	scheme, _, found := strings.Cut(value, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	switch scheme {
+	case "http", "https", "mailto", "tel":
+		return true
+	}
+	return false
+}
+
+// SignatureText returns the plain text of a signature for text bodies, with
+// line breaks where the HTML breaks lines
+func SignatureText(signature string) string {
+	var out strings.Builder
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(signature))
+	for {
+		tt := tokenizer.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			lines := strings.Split(out.String(), "\n")
+			kept := lines[:0]
+			for _, line := range lines {
+				if line = strings.Join(strings.Fields(line), " "); line != "" {
+					kept = append(kept, line)
+				}
+			}
+			return strings.Join(kept, "\n")
+		case xhtml.TextToken:
+			out.WriteString(html.UnescapeString(string(tokenizer.Text())))
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "br", "p", "div", "tr", "li", "h1", "h2", "h3", "h4", "h5", "h6", "table":
+				out.WriteString("\n")
+			case "td", "th":
+				out.WriteString(" ")
+			}
+		}
+	}
+}
+
+// SignatureStore reads the email signatures of users
+type SignatureStore interface {
+	GetEmailSignature(ctx context.Context, userID string) (*models.SettingsEmailSignature, error)
+}
+
+// EmailSignatures appends senders' email signatures to the messages they
+// send themselves. System emails (sign-in codes, invitations, password
+// resets) are not sent through it and never carry a signature.
+type EmailSignatures struct {
+	store SignatureStore
+}
+
+// NewEmailSignatures creates a new EmailSignatures
+func NewEmailSignatures(store SignatureStore) *EmailSignatures {
+	return &EmailSignatures{store: store}
+}
+
+// Apply appends the enabled signature of msg's sender to its bodies. A
+// message already signed is left alone, so it can be applied again on
+// re-sends and retries.
+func (s *EmailSignatures) Apply(ctx context.Context, msg *models.CommMessage) error {
+	if s == nil || msg.UserID == "" || msg.SignatureApplied {
+		return nil
+	}
+	signature, err := s.store.GetEmailSignature(ctx, msg.UserID)
+	if err != nil {
+		return err
+	}
+	if !signature.Enabled {
+		return nil
+	}
+	AppendSignature(msg, signature.Signature)
+	return nil
+}
+
+// AppendSignature appends signature, sanitized, to the HTML body and its text
+// to the text body of msg, unless msg is signed already
+func AppendSignature(msg *models.CommMessage, signature string) {
+	if msg.SignatureApplied || strings.Contains(msg.BodyHTML, signatureMarker) {
+		msg.SignatureApplied = true
+		return
+	}
+	signatureHTML := SanitizeSignatureHTML(signature)
+	if signatureHTML == "" {
+		return
+	}
+	if msg.BodyHTML != "" {
+		msg.BodyHTML += "\n" + signatureMarker + `<div class="email-signature">` + signatureHTML + "</div>"
+	}
+	if text := SignatureText(signatureHTML); text != "" && (msg.BodyText != "" || msg.BodyHTML == "") {
+		msg.BodyText += signatureTextSeparator + text
+	}
+	msg.SignatureApplied = true
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+func TestSanitizeSignatureHTML(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{`<p>Dana Smith<br>Sales</p>`, `<p>Dana Smith<br>Sales</p>`},
+		{`<b>Dana</b><script>alert(1)</script>`, `<b>Dana</b>`},
+		{`<style>body{display:none}</style><i>Dana</i>`, `<i>Dana</i>`},
+		{`Dana<iframe src="https://evil.example"><p>inside</p></iframe>`, `Dana`},
+		{`<img src="https://cdn.example.com/logo.png" onerror="alert(1)" alt="Logo">`, `<img src="https://cdn.example.com/logo.png" alt="Logo">`},
+		{`<a href="javascript:alert(1)">site</a>`, `<a>site</a>`},
+		{`<a href=" JaVa&#09;Script:alert(1)">site</a>`, `<a>site</a>`},
+		{`<a href="mailto:dana@example.com">mail</a> <a href="tel:+911234">call</a>`, `<a href="mailto:dana@example.com">mail</a> <a href="tel:+911234">call</a>`},
+		{`<a href="/about">about</a>`, `<a href="/about">about</a>`},
+		{`<img src="data:image/svg+xml;base64,AAAA">`, `<img>`},
+		{`<span style="color:red">red</span><span style="background:url(https://t.example/px)">x</span>`, `<span style="color:red">red</span><span>x</span>`},
+		{`<form action="https://evil.example"><input name="q"><button>Go</button></form>Dana`, `Dana`},
+		{`<svg><a href="https://example.com">x</a></svg>Dana`, `Dana`},
+		{`<!-- email-signature -->Dana`, `Dana`},
+		{`  <p>Dana</p>  `, `<p>Dana</p>`},
+		{`Tom &amp; Jerry &lt;3`, `Tom &amp; Jerry &lt;3`},
+	} {
+		if got := SanitizeSignatureHTML(tt.in); got != tt.want {
+			t.Errorf("SanitizeSignatureHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSignatureText(t *testing.T) {
+	got := SignatureText(`<p>Dana Smith</p><p>Sales &amp; Marketing<br>Acme</p><table><tr><td>T</td><td>+91 12</td></tr></table>`)
+	if want := "Dana Smith\nSales & Marketing\nAcme\nT +91 12"; got != want {
+		t.Errorf("SignatureText = %q, want %q", got, want)
+	}
+}
+
+// TestEmailSignaturesApply checks the sender's signature is appended only
+// while enabled, only to messages sent by a user, and only once
+func TestEmailSignaturesApply(t *testing.T) {
+	ctx := context.Background()
+	settings := memory.NewSettingsStore(memory.NewUserStore())
+	signatures := NewEmailSignatures(settings)
+	newMessage := func(userID string) *models.CommMessage {
+		return &models.CommMessage{UserID: userID, BodyHTML: "<p>Hello</p>", BodyText: "Hello"}
+	}
+
+	// Nothing saved yet
+	msg := newMessage("dana")
+	if err := signatures.Apply(ctx, msg); err != nil || msg.BodyHTML != "<p>Hello</p>" || msg.BodyText != "Hello" || msg.SignatureApplied {
+		t.Errorf("without a signature: %+v, %v", msg, err)
+	}
+
+	if _, err := settings.UpdateEmailSignature(ctx, "dana", models.SettingsUpdateEmailSignatureRequest{Signature: "<p>Dana<br>Acme</p>", Enabled: false}); err != nil {
+		t.Fatal(err)
+	}
+	msg = newMessage("dana")
+	if err := signatures.Apply(ctx, msg); err != nil || msg.BodyHTML != "<p>Hello</p>" || msg.SignatureApplied {
+		t.Errorf("disabled signature applied: %+v, %v", msg, err)
+	}
+
+	if _, err := settings.UpdateEmailSignature(ctx, "dana", models.SettingsUpdateEmailSignatureRequest{Signature: "<p>Dana<br>Acme</p>", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	msg = newMessage("dana")
+	if err := signatures.Apply(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	wantHTML := "<p>Hello</p>\n" + signatureMarker + `<div class="email-signature"><p>Dana<br>Acme</p></div>`
+	wantText := "Hello\n\n-- \nDana\nAcme"
+	if msg.BodyHTML != wantHTML || msg.BodyText != wantText || !msg.SignatureApplied {
+		t.Errorf("signed message = %q / %q, want %q / %q", msg.BodyHTML, msg.BodyText, wantHTML, wantText)
+	}
+
+	// Applying again, as a retry or re-send does, changes nothing
+	if err := signatures.Apply(ctx, msg); err != nil || msg.BodyHTML != wantHTML || msg.BodyText != wantText {
+		t.Errorf("signed twice: %q / %q", msg.BodyHTML, msg.BodyText)
+	}
+	// Neither does a copy that lost the flag but kept the signed body
+	resent := &models.CommMessage{UserID: "dana", BodyHTML: wantHTML, BodyText: wantText}
+	if err := signatures.Apply(ctx, resent); err != nil || resent.BodyHTML != wantHTML || resent.BodyText != wantText || !resent.SignatureApplied {
+		t.Errorf("re-sent signed body signed again: %q / %q", resent.BodyHTML, resent.BodyText)
+	}
+
+	// System emails have no sender
+	system := newMessage("")
+	if err := signatures.Apply(ctx, system); err != nil || system.BodyHTML != "<p>Hello</p>" || system.SignatureApplied {
+		t.Errorf("system email signed: %+v, %v", system, err)
+	}
+	var none *EmailSignatures
+	if err := none.Apply(ctx, newMessage("dana")); err != nil {
+		t.Errorf("Apply without signatures = %v", err)
+	}
+}
+
+func TestAppendSignatureBodies(t *testing.T) {
+	text := &models.CommMessage{BodyText: "Hello"}
+	AppendSignature(text, "<p>Dana</p>")
+	if text.BodyHTML != "" || text.BodyText != "Hello\n\n-- \nDana" {
+		t.Errorf("text-only message = %q / %q", text.BodyHTML, text.BodyText)
+	}
+
+	// The HTML carries the signature; no text body is made up for it
+	htmlOnly := &models.CommMessage{BodyHTML: "<p>Hello</p>"}
+	AppendSignature(htmlOnly, "<p>Dana</p>")
+	if !strings.HasSuffix(htmlOnly.BodyHTML, "<p>Dana</p></div>") || htmlOnly.BodyText != "" {
+		t.Errorf("HTML-only message = %q / %q", htmlOnly.BodyHTML, htmlOnly.BodyText)
+	}
+
+	// A signature that is nothing once sanitized is not appended
+	empty := &models.CommMessage{BodyHTML: "<p>Hello</p>", BodyText: "Hello"}
+	AppendSignature(empty, "<script>alert(1)</script>")
+	if empty.BodyHTML != "<p>Hello</p>" || empty.BodyText != "Hello" || empty.SignatureApplied {
+		t.Errorf("message with an empty signature = %+v", empty)
+	}
+}
+
+// TestOutboxMessageKeepsTheSignatureFlag checks a stored message rebuilt
+// for a retry by the outbox is known to be signed already
+func TestOutboxMessageKeepsTheSignatureFlag(t *testing.T) {
+	stored := &models.MongoCommunication{ID: "m1", UserID: "dana", BodyHTML: "<p>Hi</p>", Body: "Hi", SignatureApplied: true}
+	if msg := outboxMessage(stored); !msg.SignatureApplied || msg.BodyText != "Hi" || msg.UserID != "dana" {
+		t.Errorf("outbox message = %+v, want it marked signed", msg)
+	}
+}
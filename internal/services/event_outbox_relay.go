@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/kafka"
+)
+
+// eventRelayBatchSize is the most outbox events read per query
+const eventRelayBatchSize = 100
+
+// EventPublisher writes one event to the broker, returning once it is
+// acknowledged. *kafka.Producer implements it.
+type EventPublisher interface {
+	ProduceSync(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
+}
+
+// EventOutboxRelay publishes recorded domain events to Kafka in the order
+// they were recorded. An event the broker keeps refusing is set aside as
+// failed after maxAttempts, so it does not hold up the events after it; it
+// is published again, out of order, once replayed.
+type EventOutboxRelay struct {
+	repo        repositories.EventOutboxStore
+	producer    EventPublisher
+	interval    time.Duration
+	maxAttempts int // 0 never sets events aside
+}
+
+// NewEventOutboxRelay creates a new EventOutboxRelay
+func NewEventOutboxRelay(repo repositories.EventOutboxStore, producer EventPublisher, interval time.Duration) *EventOutboxRelay {
+	return &EventOutboxRelay{
+		repo:     repo,
+		producer: producer,
+		interval: interval,
+	}
+}
+
+// SetMaxAttempts sets how many times the broker may refuse an event before
+// it is set aside as failed; 0 retries it forever
+func (r *EventOutboxRelay) SetMaxAttempts(attempts int) {
+	r.maxAttempts = attempts
+}
+
+// Run relays pending events immediately and then on every interval until ctx is cancelled
+func (r *EventOutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	// Log each distinct failure once, not on every tick of an outage
+	lastErr := ""
+	for {
+		_, err := r.RelayPending(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil && err.Error() != lastErr:
+			log.Printf("Warning: event outbox relay paused: %v", err)
+			lastErr = err.Error()
+		case err == nil:
+			lastErr = ""
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes pending events oldest first and returns how many
+// were published. It stops at the first failure so later events never
+// overtake an earlier one; the failed event is retried on the next run. Only
+// an event the broker refused outright maxAttempts times is set aside and
+// passed; a broker that cannot be reached sets nothing aside.
+func (r *EventOutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	relayed := 0
+	for {
+		pending, err := r.repo.ListUnpublished(ctx, eventRelayBatchSize)
+		if err != nil {
+			return relayed, err
+		}
+
+		for _, event := range pending {
+			headers := map[string]string{"event_id": event.ID}
+			if err := r.producer.ProduceSync(ctx, event.Topic, []byte(event.Key), []byte(event.Payload), headers); err != nil {
+				setAside := r.maxAttempts > 0 && event.Attempts+1 >= r.maxAttempts && kafka.IsPermanent(err)
+				if markErr := r.repo.MarkFailed(ctx, event.ID, err, setAside); markErr != nil {
+					log.Printf("Warning: %v", markErr)
+					return relayed, err
+				}
+				if !setAside {
+					return relayed, err
+				}
+				log.Printf("Warning: event %s (%s) set aside as failed after %d attempts: %v", event.ID, event.Topic, event.Attempts+1, err)
+				continue
+			}
+			// A failure here republishes the event; consumers dedupe on event_id
+			if err := r.repo.MarkPublished(ctx, event.ID); err != nil {
+				return relayed, err
+			}
+			relayed++
+		}
+
+		if len(pending) < eventRelayBatchSize {
+			return relayed, nil
+		}
+	}
+}
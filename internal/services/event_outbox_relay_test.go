@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+// fakeBroker is an EventPublisher whose answer per event ID the test sets
+type fakeBroker struct {
+	mu        sync.Mutex
+	refuse    map[string]error // Error returned for an event ID
+	published []string         // event_id headers acknowledged, in order
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{refuse: make(map[string]error)}
+}
+
+func (b *fakeBroker) ProduceSync(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.refuse[headers["event_id"]]; err != nil {
+		return err
+	}
+	b.published = append(b.published, headers["event_id"])
+	return nil
+}
+
+func (b *fakeBroker) setRefusal(eventID string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refuse[eventID] = err
+}
+
+func (b *fakeBroker) acknowledged() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.published)
+}
+
+// recordEvents records one event per ID on the audit topic
+func recordEvents(t *testing.T, outbox *memory.EventOutbox, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := outbox.RecordWithID(context.Background(), id, "audit-events", "", map[string]string{"event_id": id, "event_type": "template.created"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func eventStatus(t *testing.T, outbox *memory.EventOutbox, id string) *models.OutboxEvent {
+	t.Helper()
+	event, err := outbox.GetEvent(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// TestRefusedEventIsSetAsideAndReplayed has the broker refuse an event
+// until it is set aside, checks the events after it still go out, then
+// replays it and checks it is published under its original ID
+func TestRefusedEventIsSetAsideAndReplayed(t *testing.T) {
+	ctx := context.Background()
+	outbox := memory.NewEventOutbox()
+	broker := newFakeBroker()
+	relay := NewEventOutboxRelay(outbox, broker, time.Minute)
+	relay.SetMaxAttempts(2)
+	recordEvents(t, outbox, "e1", "e2")
+	broker.setRefusal("e1", kafka.MessageSizeTooLarge)
+
+	// The first refusal holds back the events after it
+	if relayed, err := relay.RelayPending(ctx); !errors.Is(err, kafka.MessageSizeTooLarge) || relayed != 0 {
+		t.Fatalf("first run = %d, %v; want the refusal and nothing relayed", relayed, err)
+	}
+	if event := eventStatus(t, outbox, "e1"); event.Status != models.OutboxEventPending || event.Attempts != 1 || event.LastError == "" {
+		t.Errorf("after one refusal e1 = %s, %d attempts, %q", event.Status, event.Attempts, event.LastError)
+	}
+
+	// The last allowed refusal sets it aside and lets e2 through
+	if relayed, err := relay.RelayPending(ctx); err != nil || relayed != 1 {
+		t.Fatalf("second run = %d, %v; want e2 relayed", relayed, err)
+	}
+	failed := eventStatus(t, outbox, "e1")
+	if failed.Status != models.OutboxEventFailed || failed.Attempts != 2 || len(failed.DeliveryAttempts) != 2 || failed.DeliveryAttempts[1].Error == "" {
+		t.Errorf("e1 = %+v, want it failed after 2 attempts", failed)
+	}
+	if got := broker.acknowledged(); !slices.Equal(got, []string{"e2"}) {
+		t.Errorf("published %v, want e2", got)
+	}
+
+	replays := NewEventReplays(outbox)
+	if _, err := replays.Replay(ctx, "e2", "admin-1"); err != nil {
+		t.Fatalf("replaying a published event: %v", err)
+	}
+	broker.setRefusal("e1", nil)
+	replayed, err := replays.Replay(ctx, "e1", "admin-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Status != models.OutboxEventPending || replayed.Attempts != 0 || replayed.Replays != 1 || replayed.LastReplayedBy != "admin-1" {
+		t.Errorf("replayed = %+v, want it pending with a fresh budget", replayed)
+	}
+	if _, err := replays.Replay(ctx, "e1", "admin-1"); !errors.Is(err, repositories.ErrOutboxEventNotReplayable) {
+		t.Errorf("replaying a pending event = %v, want ErrOutboxEventNotReplayable", err)
+	}
+	if _, err := replays.Replay(ctx, "missing", "admin-1"); !repositories.IsNotFound(err) {
+		t.Errorf("replaying an unknown event = %v, want not found", err)
+	}
+
+	if relayed, err := relay.RelayPending(ctx); err != nil || relayed != 2 {
+		t.Fatalf("run after the replays = %d, %v; want both relayed", relayed, err)
+	}
+	if event := eventStatus(t, outbox, "e1"); event.Status != models.OutboxEventPublished {
+		t.Errorf("e1 after its replay = %s, want published", event.Status)
+	}
+	// Both go out again under their original event_id, in recorded order
+	if got := broker.acknowledged(); !slices.Equal(got, []string{"e2", "e1", "e2"}) {
+		t.Errorf("published %v, want e2, then e1 and e2 again", got)
+	}
+}
+
+// TestUnreachableBrokerSetsNothingAside checks only the broker refusing an
+// event counts towards setting it aside, not failing to reach the broker
+func TestUnreachableBrokerSetsNothingAside(t *testing.T) {
+	outbox := memory.NewEventOutbox()
+	broker := newFakeBroker()
+	relay := NewEventOutboxRelay(outbox, broker, time.Minute)
+	relay.SetMaxAttempts(2)
+	recordEvents(t, outbox, "e1")
+	broker.setRefusal("e1", errors.New("dial tcp 127.0.0.1:9092: connection refused"))
+
+	for range 5 {
+		if _, err := relay.RelayPending(context.Background()); err == nil {
+			t.Fatal("relay succeeded without a broker")
+		}
+	}
+	if event := eventStatus(t, outbox, "e1"); event.Status != models.OutboxEventPending || event.Attempts != 5 {
+		t.Errorf("e1 = %s after %d attempts, want it still pending", event.Status, event.Attempts)
+	}
+}
+
+// TestReplayFailedEventsJob sets aside three events, and replays those
+// recorded in a window with a limit in the background
+func TestReplayFailedEventsJob(t *testing.T) {
+	ctx := context.Background()
+	outbox := memory.NewEventOutbox()
+	broker := newFakeBroker()
+	relay := NewEventOutboxRelay(outbox, broker, time.Minute)
+	relay.SetMaxAttempts(1)
+	from := time.Now()
+	recordEvents(t, outbox, "e1", "e2", "e3", "e4")
+	for _, id := range []string{"e1", "e2", "e3"} {
+		broker.setRefusal(id, kafka.TopicAuthorizationFailed)
+	}
+	if relayed, err := relay.RelayPending(ctx); err != nil || relayed != 1 {
+		t.Fatalf("relay = %d, %v; want e4 relayed and the others set aside", relayed, err)
+	}
+
+	replays := NewEventReplays(outbox)
+	started, err := replays.StartReplayFailed(ctx, from.Add(-time.Second), time.Now().Add(time.Second), 2, "admin-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started.Status != models.EventReplayRunning || started.Limit != 2 || started.CreatedBy != "admin-1" {
+		t.Errorf("started job = %+v", started)
+	}
+	var job *models.EventReplayJob
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if job, err = replays.GetReplayJob(ctx, started.ID); err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != models.EventReplayRunning || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Status != models.EventReplayCompleted || job.Matched != 2 || job.Replayed != 2 || job.FinishedAt == nil {
+		t.Fatalf("job = %+v, want the 2 oldest failed events replayed", job)
+	}
+
+	var statuses []string
+	for _, id := range []string{"e1", "e2", "e3"} {
+		statuses = append(statuses, eventStatus(t, outbox, id).Status)
+	}
+	if want := []string{models.OutboxEventPending, models.OutboxEventPending, models.OutboxEventFailed}; !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+
+	// A window before the events matches none of them
+	empty, err := replays.StartReplayFailed(ctx, from.Add(-time.Hour), from.Add(-time.Minute), 0, "admin-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Limit != DefaultEventReplayLimit {
+		t.Errorf("default limit = %d, want %d", empty.Limit, DefaultEventReplayLimit)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+const (
+	// DefaultEventReplayLimit is how many failed events a replay re-enqueues
+	// when the request sets no limit
+	DefaultEventReplayLimit = 1000
+
+	// eventReplaySaveEvery is how many events a replay job re-enqueues
+	// between saves of its progress
+	eventReplaySaveEvery = 100
+)
+
+// EventReplays re-enqueues outbox events for the relay to publish again.
+// A replayed event keeps its ID, which is the event_id consumers dedupe on.
+type EventReplays struct {
+	repo repositories.EventOutboxStore
+}
+
+// NewEventReplays creates a new EventReplays
+func NewEventReplays(repo repositories.EventOutboxStore) *EventReplays {
+	return &EventReplays{repo: repo}
+}
+
+// Replay re-enqueues one failed or published event on behalf of actorID
+func (s *EventReplays) Replay(ctx context.Context, eventID, actorID string) (*models.OutboxEvent, error) {
+	return s.repo.Requeue(ctx, eventID, actorID)
+}
+
+// StartReplayFailed creates a job re-enqueuing the failed events recorded in
+// [from, to), at most limit of them, and runs it in the background. The job
+// finishes even if ctx is cancelled; GetReplayJob follows its progress.
+func (s *EventReplays) StartReplayFailed(ctx context.Context, from, to time.Time, limit int, actorID string) (*models.EventReplayJob, error) {
+	if limit <= 0 {
+		limit = DefaultEventReplayLimit
+	}
+	job := &models.EventReplayJob{
+		ID:        uuid.MustNewUUID(),
+		Status:    models.EventReplayRunning,
+		From:      from,
+		To:        to,
+		Limit:     limit,
+		CreatedBy: actorID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateReplayJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	started := *job
+	go s.run(context.WithoutCancel(ctx), job)
+	return &started, nil
+}
+
+// GetReplayJob returns a replay job
+func (s *EventReplays) GetReplayJob(ctx context.Context, jobID string) (*models.EventReplayJob, error) {
+	return s.repo.GetReplayJob(ctx, jobID)
+}
+
+// run re-enqueues the failed events of job oldest first, saving its
+// progress as it goes
+func (s *EventReplays) run(ctx context.Context, job *models.EventReplayJob) {
+	ids, err := s.repo.ListFailedIDs(ctx, job.From, job.To, job.Limit)
+	if err == nil {
+		job.Matched = len(ids)
+		for i, id := range ids {
+			if _, requeueErr := s.repo.Requeue(ctx, id, job.CreatedBy); requeueErr == nil {
+				job.Replayed++
+			} else if !errors.Is(requeueErr, repositories.ErrOutboxEventNotReplayable) && !errors.Is(requeueErr, repositories.ErrOutboxEventNotFound) {
+				err = requeueErr
+				break
+			}
+			if (i+1)%eventReplaySaveEvery == 0 {
+				if saveErr := s.repo.SaveReplayJob(ctx, job); saveErr != nil {
+					log.Printf("Warning: event replay %s: %v", job.ID, saveErr)
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = models.EventReplayCompleted
+	if err != nil {
+		job.Status = models.EventReplayFailed
+		job.Error = err.Error()
+		log.Printf("Warning: event replay %s stopped after %d events: %v", job.ID, job.Replayed, err)
+	}
+	if err := s.repo.SaveReplayJob(ctx, job); err != nil {
+		log.Printf("Warning: event replay %s: %v", job.ID, err)
+	}
+}
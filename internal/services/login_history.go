@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/useragent"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// loginHistoryQueueSize bounds the sign-in attempts waiting to be
+	// stored; attempts beyond it are dropped rather than slowing sign-ins
+	loginHistoryQueueSize = 1000
+	// loginHistoryWriteTimeout bounds storing one sign-in attempt
+	loginHistoryWriteTimeout = 10 * time.Second
+)
+
+// LoginHistoryRecorder stores sign-in attempts in the background, so that
+// recording them never slows down or fails a sign-in
+type LoginHistoryRecorder struct {
+	store repositories.LoginHistoryStore
+	queue chan models.LoginRecord
+}
+
+// NewLoginHistoryRecorder creates a LoginHistoryRecorder writing to store.
+// Attempts are only stored while Run is running.
+func NewLoginHistoryRecorder(store repositories.LoginHistoryStore) *LoginHistoryRecorder {
+	return &LoginHistoryRecorder{
+		store: store,
+		queue: make(chan models.LoginRecord, loginHistoryQueueSize),
+	}
+}
+
+// Record queues a sign-in attempt, filling in its ID, time and the client
+// read from its user agent. It never blocks: when the queue is full the
+// attempt is logged and dropped. A nil LoginHistoryRecorder records nothing.
+func (r *LoginHistoryRecorder) Record(record models.LoginRecord) {
+	if r == nil {
+		return
+	}
+	record.ID = primitive.NewObjectID()
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	client := useragent.Parse(record.UserAgent)
+	record.Browser, record.OS, record.Device = client.Browser, client.OS, client.Device
+
+	select {
+	case r.queue <- record:
+	default:
+		log.Printf("Warning: login history queue is full, dropping sign-in attempt of user %s", record.UserID)
+	}
+}
+
+// Run stores queued sign-in attempts until ctx is cancelled, then stores
+// the ones still queued
+func (r *LoginHistoryRecorder) Run(ctx context.Context) {
+	for {
+		select {
+		case record := <-r.queue:
+			r.write(record)
+		case <-ctx.Done():
+			for {
+				select {
+				case record := <-r.queue:
+					r.write(record)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write stores one sign-in attempt, logging failures
+func (r *LoginHistoryRecorder) write(record models.LoginRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), loginHistoryWriteTimeout)
+	defer cancel()
+	if err := r.store.CreateLoginRecord(ctx, &record); err != nil {
+		log.Printf("Warning: failed to store sign-in attempt of user %s: %v", record.UserID, err)
+	}
+}
+
+// KnownDevice reports whether a user signed in successfully with userAgent
+// before, according to the login history. Users with no successful sign-in
+// in the history, such as those who last signed in before it was kept, are
+// checked against their sessions instead.
+func (r *LoginHistoryRecorder) KnownDevice(ctx context.Context, sessions repositories.SessionStore, userID, userAgent string) (bool, error) {
+	known, err := r.store.HasSuccessfulLogin(ctx, userID, userAgent)
+	if err != nil || known {
+		return known, err
+	}
+	hasHistory, err := r.store.HasSuccessfulLogin(ctx, userID, "")
+	if err != nil {
+		return false, err
+	}
+	if hasHistory {
+		return false, nil
+	}
+	return sessions.HasDeviceSession(ctx, userID, userAgent)
+}
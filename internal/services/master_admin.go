@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// ErrMasterAdminEmailMissing is returned by MasterAdminSeed.Seed when no
+// admin exists and no email is configured to create one with
+var ErrMasterAdminEmailMissing = errors.New("no admin exists and MASTER_ADMIN_EMAIL is not set")
+
+// masterAdminPasswordBytes is the randomness of a generated one-time
+// password, 144 bits written as 24 characters
+const masterAdminPasswordBytes = 18
+
+// MasterAdminSeed prepares a deployment to be signed in to. It creates the
+// built-in roles and, while no admin exists, a master admin account that
+// must change its password at the first sign-in. Deactivated admins and
+// users holding an admin role by ID count as admins: a deployment whose
+// admins are all deactivated is recovered by reactivating one, not by a
+// new account from the environment. Running it again
+// changes nothing; of instances starting together only one creates the
+// admin, the others failing on the unique email index.
+type MasterAdminSeed struct {
+	users  repositories.UserStore
+	roles  repositories.RoleSeedStore
+	hasher PasswordHasher
+	audit  *events.AuditPublisher // nil leaves the creation unaudited
+	out    io.Writer
+}
+
+// NewMasterAdminSeed creates a MasterAdminSeed. A generated password is
+// written to out, and nowhere else.
+func NewMasterAdminSeed(users repositories.UserStore, roles repositories.RoleSeedStore, hasher PasswordHasher, auditPublisher *events.AuditPublisher, out io.Writer) *MasterAdminSeed {
+	return &MasterAdminSeed{
+		users:  users,
+		roles:  roles,
+		hasher: hasher,
+		audit:  auditPublisher,
+		out:    out,
+	}
+}
+
+// MasterAdminSeedResult reports what Seed did
+type MasterAdminSeedResult struct {
+	RolesCreated int
+	Admin        *models.User // The admin created, nil when one already existed
+}
+
+// Seed creates the missing built-in roles, then the master admin named
+// email and name when no admin exists. An empty password generates
+// a one-time one. Without an email and an admin it returns
+// ErrMasterAdminEmailMissing once the roles are created.
+func (s *MasterAdminSeed) Seed(ctx context.Context, email, name, password string) (*MasterAdminSeedResult, error) {
+	result := &MasterAdminSeedResult{}
+	created, err := s.roles.SeedBuiltInRoles(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.RolesCreated = created
+
+	adminRoleIDs, err := s.roles.AdminRoleIDs(ctx)
+	if err != nil {
+		return result, err
+	}
+	admins, err := s.users.CountAdmins(ctx, adminRoleIDs)
+	if err != nil {
+		return result, err
+	}
+	if admins > 0 {
+		return result, nil
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return result, ErrMasterAdminEmailMissing
+	}
+	if _, err := s.users.GetByEmail(ctx, email); err == nil {
+		return result, fmt.Errorf("no admin exists but %s is taken by another account; make it an admin or set another MASTER_ADMIN_EMAIL", email)
+	} else if !repositories.IsUserNotFound(err) {
+		return result, err
+	}
+
+	generated := password == ""
+	if generated {
+		if password, err = newMasterAdminPassword(); err != nil {
+			return result, fmt.Errorf("failed to generate master admin password: %w", err)
+		}
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return result, err
+	}
+
+	admin := &models.User{
+		Email:             email,
+		PasswordHash:      hash,
+		Name:              name,
+		Role:              models.UserRoleAdmin,
+		Region:            "pan_india",
+		Permissions:       []string{},
+		IsActive:          true,
+		Status:            repositories.UserStatusActive,
+		IsMasterAdmin:     true,
+		MustResetPassword: true,
+	}
+	if err := s.users.Create(ctx, admin); err != nil {
+		return result, err
+	}
+	result.Admin = admin
+
+	if generated {
+		fmt.Fprintf(s.out, "Master admin %s created with the one-time password %s\nIt must be changed at the first sign-in and is not shown again.\n", email, password)
+	}
+	if s.audit != nil {
+		s.audit.PublishSystemAccountEvent(events.ActionMasterAdminCreated, admin.ID,
+			fmt.Sprintf("Master admin %s created at startup: no admin existed", email))
+	}
+	return result, nil
+}
+
+// newMasterAdminPassword returns a random URL-safe one-time password
+func newMasterAdminPassword() (string, error) {
+	raw := make([]byte, masterAdminPasswordBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+// fakeRoles seeds nothing; adminRoleIDs are the roles granting admin access
+type fakeRoles struct {
+	seeded       int
+	adminRoleIDs []string
+}
+
+func (r *fakeRoles) SeedBuiltInRoles(ctx context.Context) (int, error) {
+	r.seeded++
+	if r.seeded == 1 {
+		return 5, nil
+	}
+	return 0, nil
+}
+
+func (r *fakeRoles) AdminRoleIDs(ctx context.Context) ([]string, error) {
+	return r.adminRoleIDs, nil
+}
+
+func newTestMasterAdminSeed(t *testing.T, users *memory.UserStore, roles *fakeRoles) (*MasterAdminSeed, *bytes.Buffer) {
+	t.Helper()
+	hasher, err := password.New(password.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	return NewMasterAdminSeed(users, roles, hasher, nil, out), out
+}
+
+func TestMasterAdminSeedEmptyDatabase(t *testing.T) {
+	users := memory.NewUserStore()
+	seed, out := newTestMasterAdminSeed(t, users, &fakeRoles{})
+
+	result, err := seed.Seed(context.Background(), " Root@Example.com ", "Master Admin", "")
+	if err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	if result.RolesCreated != 5 {
+		t.Errorf("RolesCreated = %d, want 5", result.RolesCreated)
+	}
+	if result.Admin == nil {
+		t.Fatal("no master admin was created")
+	}
+
+	admin, err := users.GetByEmail(context.Background(), "root@example.com")
+	if err != nil {
+		t.Fatalf("master admin not stored: %v", err)
+	}
+	if admin.Role != models.UserRoleAdmin || !admin.IsActive || !admin.IsMasterAdmin || !admin.MustResetPassword {
+		t.Errorf("master admin = %+v, want an active admin that must reset its password", admin)
+	}
+
+	// The generated password is printed once, and is the one stored
+	printed := out.String()
+	if !strings.Contains(printed, "root@example.com") {
+		t.Fatalf("output %q does not name the admin", printed)
+	}
+	generated := strings.Fields(strings.SplitN(printed, "one-time password ", 2)[1])[0]
+	hasher, _ := password.New(password.MinCost)
+	if err := hasher.Compare(admin.PasswordHash, generated); err != nil {
+		t.Errorf("printed password does not match the stored hash: %v", err)
+	}
+}
+
+func TestMasterAdminSeedConfiguredPasswordIsNotPrinted(t *testing.T) {
+	users := memory.NewUserStore()
+	seed, out := newTestMasterAdminSeed(t, users, &fakeRoles{})
+
+	if _, err := seed.Seed(context.Background(), "root@example.com", "Master Admin", "Configured-Passw0rd!"); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("output = %q, want nothing for a configured password", out.String())
+	}
+}
+
+func TestMasterAdminSeedIsIdempotent(t *testing.T) {
+	users := memory.NewUserStore()
+	roles := &fakeRoles{}
+	seed, out := newTestMasterAdminSeed(t, users, roles)
+
+	if _, err := seed.Seed(context.Background(), "root@example.com", "Master Admin", ""); err != nil {
+		t.Fatalf("first Seed: %v", err)
+	}
+	out.Reset()
+
+	result, err := seed.Seed(context.Background(), "other@example.com", "Master Admin", "")
+	if err != nil {
+		t.Fatalf("second Seed: %v", err)
+	}
+	if result.Admin != nil || result.RolesCreated != 0 || out.Len() != 0 {
+		t.Errorf("second Seed = %+v with output %q, want nothing done", result, out.String())
+	}
+	if _, err := users.GetByEmail(context.Background(), "other@example.com"); !repositories.IsUserNotFound(err) {
+		t.Errorf("second admin created: %v", err)
+	}
+}
+
+func TestMasterAdminSeedSkipsWhenAnAdminExists(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  models.User
+		roles []string
+	}{
+		{
+			name: "active admin",
+			user: models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true, Status: repositories.UserStatusActive},
+		},
+		{
+			name: "deactivated admin",
+			user: models.User{Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: false, Status: repositories.UserStatusDeactivated},
+		},
+		{
+			name:  "admin by role ID",
+			user:  models.User{Email: "admin@example.com", Role: models.UserRoleSalesRep, RoleIDs: []string{"role-full-access"}, IsActive: true, Status: repositories.UserStatusActive},
+			roles: []string{"role-full-access"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := memory.NewUserStore()
+			users.Add(&tt.user)
+			seed, _ := newTestMasterAdminSeed(t, users, &fakeRoles{adminRoleIDs: tt.roles})
+
+			result, err := seed.Seed(context.Background(), "root@example.com", "Master Admin", "")
+			if err != nil {
+				t.Fatalf("Seed: %v", err)
+			}
+			if result.Admin != nil {
+				t.Errorf("master admin created although %s exists", tt.name)
+			}
+		})
+	}
+}
+
+func TestMasterAdminSeedIgnoresAnonymizedAdmins(t *testing.T) {
+	users := memory.NewUserStore()
+	users.Add(&models.User{Email: "deleted-1@deleted.invalid", Role: models.UserRoleAdmin, Status: repositories.UserStatusDeleted})
+	seed, _ := newTestMasterAdminSeed(t, users, &fakeRoles{})
+
+	result, err := seed.Seed(context.Background(), "root@example.com", "Master Admin", "")
+	if err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	if result.Admin == nil {
+		t.Error("no master admin created although the only admin was anonymized")
+	}
+}
+
+func TestMasterAdminSeedMissingEmail(t *testing.T) {
+	users := memory.NewUserStore()
+	seed, _ := newTestMasterAdminSeed(t, users, &fakeRoles{})
+
+	result, err := seed.Seed(context.Background(), "  ", "Master Admin", "")
+	if !errors.Is(err, ErrMasterAdminEmailMissing) {
+		t.Fatalf("Seed error = %v, want ErrMasterAdminEmailMissing", err)
+	}
+	// The roles are created all the same
+	if result.RolesCreated != 5 || result.Admin != nil {
+		t.Errorf("result = %+v, want the roles created and no admin", result)
+	}
+}
+
+func TestMasterAdminSeedEmailTaken(t *testing.T) {
+	users := memory.NewUserStore()
+	users.Add(&models.User{Email: "root@example.com", Role: models.UserRoleSalesRep, IsActive: true})
+	seed, _ := newTestMasterAdminSeed(t, users, &fakeRoles{})
+
+	if _, err := seed.Seed(context.Background(), "root@example.com", "Master Admin", ""); err == nil {
+		t.Fatal("Seed succeeded although the email belongs to another account")
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// digestsPerFlush bounds how many digests one flush sends, so a backlog
+// cannot keep a flush running past shutdown for long
+const digestsPerFlush = 200
+
+// NotificationDigests sends the notification emails NotificationService
+// held back, one email per recipient and type, once the oldest of them is
+// due. Batches are leased, so several API instances can run it; a digest
+// that fails to send is retried once its lease runs out.
+type NotificationDigests struct {
+	notifier *NotificationService
+	pending  repositories.PendingNotificationStore
+	interval time.Duration
+	lease    time.Duration
+	owner    string
+	now      func() time.Time
+}
+
+// NewNotificationDigests creates a NotificationDigests flushing due digests
+// every interval
+func NewNotificationDigests(notifier *NotificationService, pending repositories.PendingNotificationStore, interval, lease time.Duration) *NotificationDigests {
+	hostname, _ := os.Hostname()
+	return &NotificationDigests{
+		notifier: notifier,
+		pending:  pending,
+		interval: interval,
+		lease:    lease,
+		owner:    fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.MustNewUUID()),
+		now:      time.Now,
+	}
+}
+
+// SetClock replaces the clock deciding which digests are due
+func (d *NotificationDigests) SetClock(now func() time.Time) {
+	d.now = now
+}
+
+// Run flushes due digests immediately and then on every interval until ctx
+// is cancelled
+func (d *NotificationDigests) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.FlushDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: notification digest flush failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FlushDue claims and sends due digests until none are left, and returns
+// how many were sent. A digest that cannot be sent is logged and left
+// leased, so this flush moves on and a later one retries it.
+func (d *NotificationDigests) FlushDue(ctx context.Context) (int, error) {
+	sent := 0
+	for attempts := 0; attempts < digestsPerFlush; attempts++ {
+		batch, err := d.pending.ClaimDueDigest(ctx, d.owner, d.now(), d.lease)
+		if err != nil {
+			return sent, err
+		}
+		if len(batch) == 0 {
+			return sent, nil
+		}
+
+		if err := d.notifier.sendDigest(ctx, batch); err != nil {
+			log.Printf("Warning: digest of %d %s notifications for user %s not sent, retrying in %s: %v",
+				len(batch), batch[0].Type, batch[0].UserID, d.lease, err)
+			continue
+		}
+		if err := d.pending.DeletePendingNotifications(ctx, d.owner, pendingIDs(batch)); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func pendingIDs(batch []*models.PendingNotification) []string {
+	ids := make([]string, len(batch))
+	for i, n := range batch {
+		ids[i] = n.ID
+	}
+	return ids
+}
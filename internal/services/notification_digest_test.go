@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/pkg/email"
+)
+
+// recordingSender keeps the emails it is asked to send
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []*models.CommMessage
+}
+
+func (s *recordingSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func (s *recordingSender) Name() string        { return "recording" }
+func (s *recordingSender) FromAddress() string { return "noreply@example.test" }
+func (s *recordingSender) Capabilities() email.Capabilities {
+	return email.Capabilities{Delivers: true}
+}
+
+func (s *recordingSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+// TestNotificationDigestsBatchEmails notifies a user with an hourly digest
+// twice and checks both show up in the feed at once, while the emails wait
+// for one digest sent when the hour is up
+func TestNotificationDigestsBatchEmails(t *testing.T) {
+	ctx := context.Background()
+	users := memory.NewUserStore()
+	user := users.Add(&models.User{Email: "dana@example.test", IsActive: true})
+	settings := memory.NewSettingsStore(users)
+	hourly := models.DigestHourly
+	if _, err := settings.UpdateNotificationSettings(ctx, user.ID, &models.SettingsUpdateNotificationSettingsRequest{
+		EmailNotifications:   &models.SettingsEmailNotificationSettings{TaskReminder: true},
+		BrowserNotifications: &models.SettingsBrowserNotificationSettings{Enabled: true, TaskDue: true},
+		DigestFrequency:      &hourly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	notifications := memory.NewNotificationStore()
+	pending := memory.NewPendingNotificationStore()
+	sender := &recordingSender{}
+	now := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	notifier := NewNotificationService(users, settings, notifications, memory.NewEmailStore(), sender, nil)
+	notifier.SetDigests(pending, 0)
+	notifier.SetClock(clock)
+	digests := NewNotificationDigests(notifier, pending, time.Minute, time.Minute)
+	digests.SetClock(clock)
+
+	for _, title := range []string{"Call Acme", "Send the proposal"} {
+		if err := notifier.Notify(ctx, user.ID, models.NotificationTaskReminder, models.NotificationPayload{Title: title, Body: "Due today"}); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * time.Minute)
+	}
+	if unread, err := notifications.CountUnreadNotifications(ctx, user.ID); err != nil || unread != 2 {
+		t.Errorf("unread in-app notifications = %d, %v; want 2", unread, err)
+	}
+	if sent, err := digests.FlushDue(ctx); err != nil || sent != 0 || sender.count() != 0 {
+		t.Fatalf("flush before the hour = %d sent, %d emails, %v; want nothing", sent, sender.count(), err)
+	}
+
+	now = now.Add(time.Hour)
+	if sent, err := digests.FlushDue(ctx); err != nil || sent != 1 {
+		t.Fatalf("flush after the hour = %d, %v; want one digest", sent, err)
+	}
+	if sender.count() != 1 {
+		t.Fatalf("%d emails sent, want one digest", sender.count())
+	}
+	if digest := sender.sent[0]; digest.Subject != "2 task reminders" || digest.ToAddresses[0] != user.Email {
+		t.Errorf("digest = %q to %v", digest.Subject, digest.ToAddresses)
+	}
+	if sent, err := digests.FlushDue(ctx); err != nil || sent != 0 {
+		t.Errorf("second flush = %d, %v; want nothing left", sent, err)
+	}
+}
+
+// failingSender fails its first failures sends and records the rest
+type failingSender struct {
+	recordingSender
+	failures int
+}
+
+func (s *failingSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	s.mu.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mu.Unlock()
+		return errors.New("smtp: connection refused")
+	}
+	s.mu.Unlock()
+	return s.recordingSender.SendEmail(ctx, msg)
+}
+
+// digestFixture is a notification service holding emails in a pending
+// store, on a clock the test moves
+type digestFixture struct {
+	users    *memory.UserStore
+	settings *memory.SettingsStore
+	pending  *memory.PendingNotificationStore
+	notifier *NotificationService
+	now      time.Time
+}
+
+func newDigestFixture(t *testing.T, sender email.EmailSender, window time.Duration) *digestFixture {
+	t.Helper()
+	users := memory.NewUserStore()
+	f := &digestFixture{
+		users:    users,
+		settings: memory.NewSettingsStore(users),
+		pending:  memory.NewPendingNotificationStore(),
+		now:      time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC),
+	}
+	f.notifier = NewNotificationService(users, f.settings, memory.NewNotificationStore(), memory.NewEmailStore(), sender, nil)
+	f.notifier.SetDigests(f.pending, window)
+	f.notifier.SetClock(f.clock)
+	return f
+}
+
+func (f *digestFixture) clock() time.Time { return f.now }
+
+// addUser adds a user receiving task reminder and security alert emails,
+// with digest frequency when set
+func (f *digestFixture) addUser(t *testing.T, emailAddress, frequency string) *models.User {
+	t.Helper()
+	user := f.users.Add(&models.User{Email: emailAddress, IsActive: true})
+	update := &models.SettingsUpdateNotificationSettingsRequest{
+		EmailNotifications: &models.SettingsEmailNotificationSettings{TaskReminder: true, SecurityAlert: true},
+	}
+	if frequency != "" {
+		update.DigestFrequency = &frequency
+	}
+	if _, err := f.settings.UpdateNotificationSettings(context.Background(), user.ID, update); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func (f *digestFixture) digests(lease time.Duration) *NotificationDigests {
+	digests := NewNotificationDigests(f.notifier, f.pending, time.Minute, lease)
+	digests.SetClock(f.clock)
+	return digests
+}
+
+// TestRapidNotificationsBecomeOneDigest sends three task reminders within
+// seconds of each other and a new device sign-in between them, checking the
+// sign-in alert goes out alone at once and the reminders as one email when
+// the default window is up
+func TestRapidNotificationsBecomeOneDigest(t *testing.T) {
+	ctx := context.Background()
+	sender := &recordingSender{}
+	f := newDigestFixture(t, sender, 15*time.Minute)
+	user := f.addUser(t, "dana@example.test", "")
+	digests := f.digests(time.Minute)
+
+	for i, title := range []string{"Call Acme", "Send the proposal", "Book the demo"} {
+		if err := f.notifier.Notify(ctx, user.ID, models.NotificationTaskReminder, models.NotificationPayload{Title: title, Body: "Due today"}); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if err := f.notifier.Notify(ctx, user.ID, models.NotificationNewDeviceLogin, models.NotificationPayload{Title: "New sign-in", Body: "Firefox on Linux"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.now = f.now.Add(5 * time.Second)
+	}
+	if sender.count() != 1 || sender.sent[0].Subject != "New sign-in" || sender.sent[0].Priority != models.PriorityHigh {
+		t.Fatalf("emails sent right away = %d, want the sign-in alert alone", sender.count())
+	}
+
+	f.now = f.now.Add(14 * time.Minute)
+	if sent, err := digests.FlushDue(ctx); err != nil || sent != 0 {
+		t.Fatalf("flush within the window = %d, %v; want nothing", sent, err)
+	}
+	f.now = f.now.Add(time.Minute)
+	if sent, err := digests.FlushDue(ctx); err != nil || sent != 1 {
+		t.Fatalf("flush after the window = %d, %v; want one digest", sent, err)
+	}
+	if sender.count() != 2 {
+		t.Fatalf("%d emails sent, want the alert and one digest", sender.count())
+	}
+	digest := sender.sent[1]
+	if digest.Subject != "3 task reminders" {
+		t.Errorf("digest subject = %q", digest.Subject)
+	}
+	for i, title := range []string{"Call Acme", "Send the proposal", "Book the demo"} {
+		if at := strings.Index(digest.BodyText, title); at < 0 || (i > 0 && at < strings.Index(digest.BodyText, "Call Acme")) {
+			t.Errorf("digest text %q, want %q listed in order", digest.BodyText, title)
+		}
+	}
+	if strings.Count(digest.BodyHTML, "<li>") != 3 {
+		t.Errorf("digest HTML = %q, want three items", digest.BodyHTML)
+	}
+}
+
+// TestDigestFrequencies checks each frequency holds emails for its period,
+// and immediate ones and services without digests send them at once
+func TestDigestFrequencies(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		frequency string
+		window    time.Duration
+		held      time.Duration // Zero when sent at once
+	}{
+		{models.DigestImmediate, 15 * time.Minute, 0},
+		{models.Digest15Minutes, 0, 15 * time.Minute},
+		{models.DigestHourly, 15 * time.Minute, time.Hour},
+		{models.DigestDaily, 15 * time.Minute, 24 * time.Hour},
+		{"", 15 * time.Minute, 15 * time.Minute},
+		{"", 0, 0},
+	} {
+		sender := &recordingSender{}
+		f := newDigestFixture(t, sender, tt.window)
+		user := f.addUser(t, "dana@example.test", tt.frequency)
+		digests := f.digests(time.Minute)
+		if err := f.notifier.Notify(ctx, user.ID, models.NotificationTaskReminder, models.NotificationPayload{Title: "Call Acme", Body: "Due today"}); err != nil {
+			t.Fatal(err)
+		}
+		if tt.held == 0 {
+			if sender.count() != 1 {
+				t.Errorf("%q with a %s window: %d emails sent at once, want 1", tt.frequency, tt.window, sender.count())
+			}
+			continue
+		}
+		f.now = f.now.Add(tt.held - time.Second)
+		if sent, _ := digests.FlushDue(ctx); sent != 0 || sender.count() != 0 {
+			t.Errorf("%q: sent a second before %s", tt.frequency, tt.held)
+		}
+		f.now = f.now.Add(time.Second)
+		// A digest of one is the notification as it was
+		if sent, _ := digests.FlushDue(ctx); sent != 1 || sender.count() != 1 || sender.sent[0].Subject != "Call Acme" {
+			t.Errorf("%q: %d emails after %s, want the reminder", tt.frequency, sender.count(), tt.held)
+		}
+	}
+
+	sender := &recordingSender{}
+	notifier := NewNotificationService(memory.NewUserStore(), memory.NewSettingsStore(memory.NewUserStore()), nil, nil, sender, nil)
+	if period := notifier.digestPeriod(notificationRules[models.NotificationTaskReminder], &models.SettingsNotificationSettings{DigestFrequency: models.DigestDaily}); period != 0 {
+		t.Errorf("digest period without digests = %s, want none", period)
+	}
+}
+
+// TestDigestIsClaimedByOneInstance flushes the same digests from several
+// instances at once, checking each goes out once, and that a digest whose
+// send failed is retried once its lease has run out
+func TestDigestIsClaimedByOneInstance(t *testing.T) {
+	ctx := context.Background()
+	sender := &failingSender{}
+	f := newDigestFixture(t, sender, 15*time.Minute)
+	for i := range 5 {
+		user := f.addUser(t, fmt.Sprintf("user%d@example.test", i), "")
+		for range 3 {
+			if err := f.notifier.Notify(ctx, user.ID, models.NotificationTaskReminder, models.NotificationPayload{Title: "Call Acme", Body: "Due today"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	f.now = f.now.Add(15 * time.Minute)
+
+	var wg sync.WaitGroup
+	var total atomic.Int32
+	for range 4 {
+		digests := f.digests(time.Minute)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sent, err := digests.FlushDue(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+			total.Add(int32(sent))
+		}()
+	}
+	wg.Wait()
+	if total.Load() != 5 || sender.count() != 5 {
+		t.Fatalf("instances sent %d digests in %d emails, want 5", total.Load(), sender.count())
+	}
+	recipients := map[string]bool{}
+	for _, msg := range sender.sent {
+		if msg.Subject != "3 task reminders" || recipients[msg.ToAddresses[0]] {
+			t.Errorf("digest %q to %v, want one of 3 reminders per user", msg.Subject, msg.ToAddresses)
+		}
+		recipients[msg.ToAddresses[0]] = true
+	}
+
+	// A failed send is left leased, and retried when the lease is up
+	user := f.addUser(t, "late@example.test", "")
+	if err := f.notifier.Notify(ctx, user.ID, models.NotificationTaskReminder, models.NotificationPayload{Title: "Call Acme", Body: "Due today"}); err != nil {
+		t.Fatal(err)
+	}
+	f.now = f.now.Add(15 * time.Minute)
+	sender.failures = 1
+	digests := f.digests(time.Minute)
+	if sent, err := digests.FlushDue(ctx); err != nil || sent != 0 {
+		t.Fatalf("flush with a failing sender = %d, %v", sent, err)
+	}
+	if sent, _ := f.digests(time.Minute).FlushDue(ctx); sent != 0 {
+		t.Error("another instance sent a digest still leased")
+	}
+	f.now = f.now.Add(time.Minute)
+	if sent, err := f.digests(time.Minute).FlushDue(ctx); err != nil || sent != 1 || sender.count() != 6 {
+		t.Errorf("flush after the lease = %d, %v; want the digest retried", sent, err)
+	}
+}
+
+// TestDigestTurnedOffSince checks held emails the recipient turned off
+// before their digest went out are dropped
+func TestDigestTurnedOffSince(t *testing.T) {
+	ctx := context.Background()
+	sender := &recordingSender{}
+	f := newDigestFixture(t, sender, 15*time.Minute)
+	user := f.addUser(t, "dana@example.test", "")
+	for range 2 {
+		if err := f.notifier.Notify(ctx, user.ID, models.NotificationTaskReminder, models.NotificationPayload{Title: "Call Acme"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.settings.UpdateNotificationSettings(ctx, user.ID, &models.SettingsUpdateNotificationSettingsRequest{
+		EmailNotifications: &models.SettingsEmailNotificationSettings{SecurityAlert: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	f.now = f.now.Add(15 * time.Minute)
+	digests := f.digests(time.Minute)
+	if _, err := digests.FlushDue(ctx); err != nil || sender.count() != 0 {
+		t.Errorf("%d emails sent after being turned off, %v", sender.count(), err)
+	}
+	f.now = f.now.Add(time.Hour)
+	if batch, _ := f.pending.ClaimDueDigest(ctx, "check", f.now, time.Minute); len(batch) != 0 {
+		t.Errorf("%d notifications still held, want them dropped", len(batch))
+	}
+}
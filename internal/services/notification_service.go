@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// notificationRule says which settings let a notification type through on
+// each channel. A nil check means the type is never sent on that channel.
+type notificationRule struct {
+	email    func(prefs *models.SettingsNotificationSettings) bool
+	inApp    func(prefs *models.SettingsNotificationSettings) bool
+	system   func(system *models.SystemEmailNotificationSettings) bool // Org-wide switch for the email, when there is one
+	priority string
+	// immediate emails are never held for a digest: security alerts, and
+	// emails laid out on their own such as the weekly report
+	immediate bool
+	// digestTitle is the subject of a digest, given the number of
+	// notifications it lists
+	digestTitle string
+}
+
+// notificationRules maps every notification type to the user's settings.
+// In-app notifications follow the browser notification switch.
+var notificationRules = map[models.NotificationType]notificationRule{
+	models.NotificationNewDeviceLogin: {
+		email:     func(p *models.SettingsNotificationSettings) bool { return p.EmailNotifications.SecurityAlert },
+		inApp:     func(p *models.SettingsNotificationSettings) bool { return p.BrowserNotifications.Enabled },
+		priority:  models.PriorityHigh,
+		immediate: true,
+	},
+	models.NotificationTemplateApprovalRequest: {
+		email:       func(p *models.SettingsNotificationSettings) bool { return p.EmailNotifications.TemplateApproval },
+		inApp:       func(p *models.SettingsNotificationSettings) bool { return p.BrowserNotifications.Enabled },
+		priority:    models.PriorityNormal,
+		digestTitle: "%d templates are waiting for your approval",
+	},
+	models.NotificationTaskReminder: {
+		email: func(p *models.SettingsNotificationSettings) bool { return p.EmailNotifications.TaskReminder },
+		inApp: func(p *models.SettingsNotificationSettings) bool {
+			return p.BrowserNotifications.Enabled && p.BrowserNotifications.TaskDue
+		},
+		priority:    models.PriorityNormal,
+		digestTitle: "%d task reminders",
+	},
+	models.NotificationWeeklyReport: {
+		email:     func(p *models.SettingsNotificationSettings) bool { return p.EmailNotifications.WeeklyReport },
+		system:    func(s *models.SystemEmailNotificationSettings) bool { return s.WeeklyReportSchedule != "" },
+		priority:  models.PriorityLow,
+		immediate: true,
+	},
+}
+
+// NotificationService notifies users by email and in their in-app feed, as
+// far as their notification settings allow. Users who never saved settings
+// get the defaults. Without an email provider that delivers, emails are
+// skipped and logged. With digests set, emails that are not urgent are held
+// and sent together per recipient and type by NotificationDigests.
+type NotificationService struct {
+	users         repositories.UserStore
+	settings      repositories.SettingsStore
+	notifications repositories.NotificationStore
+	emails        repositories.EmailStore
+	sender        email.EmailSender
+	queue         *EmailQueue                           // nil sends emails during the call
+	pending       repositories.PendingNotificationStore // nil emails every notification right away
+	digestWindow  time.Duration                         // Digest period of users who chose none
+	now           func() time.Time
+}
+
+// NewNotificationService creates a new NotificationService
+func NewNotificationService(users repositories.UserStore, settings repositories.SettingsStore, notifications repositories.NotificationStore, emails repositories.EmailStore, sender email.EmailSender, queue *EmailQueue) *NotificationService {
+	return &NotificationService{
+		users:         users,
+		settings:      settings,
+		notifications: notifications,
+		emails:        emails,
+		sender:        sender,
+		queue:         queue,
+		now:           time.Now,
+	}
+}
+
+// SetDigests holds notification emails that are not urgent in pending, to
+// be sent as one digest per recipient and type once the recipient's digest
+// period has passed. window is the period of users who chose none; zero
+// sends their emails right away.
+func (s *NotificationService) SetDigests(pending repositories.PendingNotificationStore, window time.Duration) {
+	s.pending = pending
+	s.digestWindow = window
+}
+
+// SetClock replaces the clock digest periods are counted with
+func (s *NotificationService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Notify sends payload to a user on every channel their settings allow for
+// notificationType. A failure on one channel does not stop the other; all
+// failures are returned together.
+func (s *NotificationService) Notify(ctx context.Context, userID string, notificationType models.NotificationType, payload models.NotificationPayload) error {
+	rule, ok := notificationRules[notificationType]
+	if !ok {
+		return fmt.Errorf("unknown notification type %q", notificationType)
+	}
+	prefs, err := s.settings.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load notification settings: %w", err)
+	}
+
+	var errs []error
+	if rule.inApp != nil && rule.inApp(prefs) {
+		n := &models.Notification{
+			ID:        uuid.MustNewUUID(),
+			UserID:    userID,
+			Type:      notificationType,
+			Title:     payload.Title,
+			Body:      payload.Body,
+			Link:      payload.Link,
+			Data:      payload.Data,
+			CreatedAt: time.Now(),
+		}
+		if err := s.notifications.CreateNotification(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if rule.email != nil && rule.email(prefs) {
+		if period := s.digestPeriod(rule, prefs); period > 0 {
+			if err := s.holdForDigest(ctx, userID, notificationType, payload, period); err != nil {
+				errs = append(errs, err)
+			}
+		} else if err := s.sendEmail(ctx, userID, notificationType, rule, payload); err != nil {
+			errs = append(errs, fmt.Errorf("failed to email notification: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// digestPeriod returns how long emails of rule are held for the recipient's
+// digest, zero to send them right away
+func (s *NotificationService) digestPeriod(rule notificationRule, prefs *models.SettingsNotificationSettings) time.Duration {
+	if s.pending == nil || rule.immediate {
+		return 0
+	}
+	switch prefs.DigestFrequency {
+	case models.DigestImmediate:
+		return 0
+	case models.Digest15Minutes:
+		return 15 * time.Minute
+	case models.DigestHourly:
+		return time.Hour
+	case models.DigestDaily:
+		return 24 * time.Hour
+	default:
+		return s.digestWindow
+	}
+}
+
+// holdForDigest stores the notification email for the digest going out
+// period from now, or earlier when one of its type is already waiting
+func (s *NotificationService) holdForDigest(ctx context.Context, userID string, notificationType models.NotificationType, payload models.NotificationPayload, period time.Duration) error {
+	now := s.now()
+	err := s.pending.AddPendingNotification(ctx, &models.PendingNotification{
+		ID:        uuid.MustNewUUID(),
+		UserID:    userID,
+		Type:      notificationType,
+		Title:     payload.Title,
+		Body:      payload.Body,
+		Link:      payload.Link,
+		CreatedAt: now,
+		DueAt:     now.Add(period),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hold notification email for the digest: %w", err)
+	}
+	return nil
+}
+
+// sendDigest emails the held notifications of one recipient and type as a
+// single email listing them oldest first, unless the recipient turned that
+// email off since. One notification is sent as it was.
+func (s *NotificationService) sendDigest(ctx context.Context, batch []*models.PendingNotification) error {
+	first := batch[0]
+	rule, ok := notificationRules[first.Type]
+	if !ok {
+		return fmt.Errorf("unknown notification type %q", first.Type)
+	}
+	prefs, err := s.settings.GetNotificationSettings(ctx, first.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load notification settings: %w", err)
+	}
+	if !rule.email(prefs) {
+		log.Printf("Digest of %d %s notifications for user %s not emailed: turned off since", len(batch), first.Type, first.UserID)
+		return nil
+	}
+
+	if len(batch) == 1 {
+		return s.sendEmail(ctx, first.UserID, first.Type, rule, models.NotificationPayload{
+			Title: first.Title,
+			Body:  first.Body,
+			Link:  first.Link,
+		})
+	}
+	var text, items strings.Builder
+	for _, n := range batch {
+		at := n.CreatedAt.UTC().Format("Jan 2 15:04 UTC")
+		fmt.Fprintf(&text, "- %s, %s: %s", at, n.Title, n.Body)
+		fmt.Fprintf(&items, "<li><strong>%s</strong> <small>(%s)</small><br>%s", html.EscapeString(n.Title), at,
+			strings.ReplaceAll(html.EscapeString(n.Body), "\n", "<br>"))
+		if n.Link != "" {
+			fmt.Fprintf(&text, " (%s)", n.Link)
+			fmt.Fprintf(&items, `<br><a href="%s">Open</a>`, html.EscapeString(n.Link))
+		}
+		text.WriteString("\n")
+		items.WriteString("</li>")
+	}
+	return s.sendEmail(ctx, first.UserID, first.Type, rule, models.NotificationPayload{
+		Title: fmt.Sprintf(rule.digestTitle, len(batch)),
+		Body:  text.String(),
+		HTML:  "<ul>" + items.String() + "</ul>",
+	})
+}
+
+// sendEmail stores the notification email as queued and hands it to the
+// email worker, sending it through the provider during the call when emails
+// are not queued or it could not be stored or queued
+func (s *NotificationService) sendEmail(ctx context.Context, userID string, notificationType models.NotificationType, rule notificationRule, payload models.NotificationPayload) error {
+	if s.sender == nil || !s.sender.Capabilities().Delivers {
+		log.Printf("Notification %s for user %s not emailed: no email provider configured", notificationType, userID)
+		return nil
+	}
+	if rule.system != nil {
+		system, err := s.settings.GetSystemEmailNotificationSettings(ctx)
+		if err != nil {
+			return err
+		}
+		if !rule.system(system) {
+			log.Printf("Notification %s for user %s not emailed: turned off in the system email settings", notificationType, userID)
+			return nil
+		}
+	}
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		log.Printf("Notification %s for user %s not emailed: user has no email address", notificationType, userID)
+		return nil
+	}
+
+	bodyHTML := payload.HTML
+	if bodyHTML == "" {
+		bodyHTML = "<p>" + strings.ReplaceAll(html.EscapeString(payload.Body), "\n", "<br>") + "</p>"
+	}
+	// No UserID: the user is the recipient, not the sender, so the email
+	// must not show up in their mailbox or count as an email they sent
+	now := time.Now()
+	msg := &models.CommMessage{
+		MessageID:   uuid.MustNewUUID(),
+		Channel:     models.ChannelEmail,
+		Direction:   models.DirectionOutbound,
+		Status:      models.MessageStatusQueued,
+		FromAddress: s.sender.FromAddress(),
+		FromName:    "White Platform",
+		ToAddresses: []string{user.Email},
+		Subject:     payload.Title,
+		BodyHTML:    bodyHTML,
+		BodyText:    payload.Body,
+		Priority:    rule.priority,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if s.emails != nil {
+		if err := s.emails.CreateCommMessage(ctx, msg); err != nil {
+			log.Printf("Warning: failed to store notification email %s: %v", msg.MessageID, err)
+		} else if err := s.queue.Enqueue(ctx, msg); err == nil {
+			return nil
+		} else if !errors.Is(err, ErrEmailQueueDisabled) {
+			log.Printf("Warning: failed to queue notification email %s: %v", msg.MessageID, err)
+		}
+	}
+
+	if err := s.sender.SendEmail(ctx, msg); err != nil {
+		return err
+	}
+	if s.emails != nil {
+		if err := s.emails.MarkSent(ctx, msg.MessageID, s.sender.Name(), msg.ExternalID); err != nil {
+			log.Printf("Warning: failed to mark notification email %s as sent: %v", msg.MessageID, err)
+		}
+	}
+	return nil
+}
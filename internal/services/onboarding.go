@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// ErrUnknownOnboardingItem is returned when dismissing an item that is not
+// on the onboarding checklist
+var ErrUnknownOnboardingItem = errors.New("unknown onboarding item")
+
+// onboardingCheck is one item of the onboarding checklist and how to tell
+// whether a user has done it
+type onboardingCheck struct {
+	key   string
+	title string
+	done  func(ctx context.Context, s *OnboardingService, userID string) (bool, error)
+}
+
+// onboardingChecks is the onboarding checklist, in the order it is shown
+var onboardingChecks = []onboardingCheck{
+	{
+		key:   "profile",
+		title: "Complete your profile",
+		done: func(ctx context.Context, s *OnboardingService, userID string) (bool, error) {
+			profile, err := s.settings.GetUserProfile(ctx, userID)
+			if err != nil {
+				return false, err
+			}
+			return profile.FirstName != "" && profile.LastName != "" && profile.JobTitle != "", nil
+		},
+	},
+	{
+		key:   "avatar",
+		title: "Add a profile picture",
+		done: func(ctx context.Context, s *OnboardingService, userID string) (bool, error) {
+			profile, err := s.settings.GetUserProfile(ctx, userID)
+			if err != nil {
+				return false, err
+			}
+			return profile.Avatar != "", nil
+		},
+	},
+	{
+		key:   "verify_phone",
+		title: "Verify your phone number",
+		done: func(ctx context.Context, s *OnboardingService, userID string) (bool, error) {
+			security, err := s.settings.GetSecuritySettings(ctx, userID)
+			if err != nil {
+				return false, err
+			}
+			return security.PhoneNumber != "", nil
+		},
+	},
+	{
+		key:   "two_factor",
+		title: "Turn on two-factor authentication",
+		done: func(ctx context.Context, s *OnboardingService, userID string) (bool, error) {
+			security, err := s.settings.GetSecuritySettings(ctx, userID)
+			if err != nil {
+				return false, err
+			}
+			return security.TwoFactorEnabled, nil
+		},
+	},
+	{
+		key:   "email_signature",
+		title: "Save an email signature",
+		done: func(ctx context.Context, s *OnboardingService, userID string) (bool, error) {
+			signature, err := s.settings.GetEmailSignature(ctx, userID)
+			if err != nil {
+				return false, err
+			}
+			return strings.TrimSpace(signature.Signature) != "", nil
+		},
+	},
+	{
+		key:   "return_login",
+		title: "Sign in again after your first sign-in",
+		done: func(ctx context.Context, s *OnboardingService, userID string) (bool, error) {
+			success := true
+			count, err := s.logins.CountLoginHistory(ctx, userID, models.LoginHistoryFilter{Success: &success})
+			if err != nil {
+				return false, err
+			}
+			return count >= 2, nil
+		},
+	},
+	{
+		key:   "first_content",
+		title: "Create a template or send your first email",
+		done: func(ctx context.Context, s *OnboardingService, userID string) (bool, error) {
+			now := time.Now()
+			sent, err := s.emails.CountSentEmails(ctx, userID, time.Time{}, now)
+			if err != nil || sent > 0 {
+				return sent > 0, err
+			}
+			templates, err := s.activities.CountActivitiesByTitle(ctx, userID, "template", time.Time{}, now)
+			if err != nil {
+				return false, err
+			}
+			return templates["Template Created"]+templates["Template Duplicated"] > 0, nil
+		},
+	},
+}
+
+// OnboardingService computes the onboarding checklist of new users from
+// their existing data and keeps the items they dismissed
+type OnboardingService struct {
+	settings   *repositories.SettingsRepository
+	logins     repositories.LoginHistoryStore
+	activities *repositories.MongoActivityRepository
+	emails     *repositories.MongoEmailRepository
+}
+
+// NewOnboardingService creates a new OnboardingService
+func NewOnboardingService(settings *repositories.SettingsRepository, logins repositories.LoginHistoryStore, activities *repositories.MongoActivityRepository, emails *repositories.MongoEmailRepository) *OnboardingService {
+	return &OnboardingService{
+		settings:   settings,
+		logins:     logins,
+		activities: activities,
+		emails:     emails,
+	}
+}
+
+// Checklist computes a user's onboarding checklist. An item whose check
+// fails is logged and shown as not done rather than failing the checklist.
+func (s *OnboardingService) Checklist(ctx context.Context, userID string) (*models.OnboardingChecklist, error) {
+	progress, err := s.settings.GetOnboardingProgress(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	checklist := &models.OnboardingChecklist{Items: make([]models.OnboardingItem, 0, len(onboardingChecks))}
+	for _, check := range onboardingChecks {
+		done, err := check.done(ctx, s, userID)
+		if err != nil {
+			log.Printf("Warning: onboarding check %s failed for user %s: %v", check.key, userID, err)
+			done = false
+		}
+		item := models.OnboardingItem{
+			Key:       check.key,
+			Title:     check.title,
+			Done:      done,
+			Dismissed: slices.Contains(progress.Dismissed, check.key),
+		}
+		checklist.Items = append(checklist.Items, item)
+
+		if item.Dismissed {
+			continue
+		}
+		checklist.Total++
+		if item.Done {
+			checklist.Completed++
+		}
+	}
+
+	checklist.Percent = 100
+	if checklist.Total > 0 {
+		checklist.Percent = checklist.Completed * 100 / checklist.Total
+	}
+	return checklist, nil
+}
+
+// Dismiss hides an item of a user's onboarding checklist and returns the
+// updated checklist
+func (s *OnboardingService) Dismiss(ctx context.Context, userID, item string) (*models.OnboardingChecklist, error) {
+	known := slices.ContainsFunc(onboardingChecks, func(check onboardingCheck) bool {
+		return check.key == item
+	})
+	if !known {
+		return nil, ErrUnknownOnboardingItem
+	}
+	if _, err := s.settings.DismissOnboardingItem(ctx, userID, item); err != nil {
+		return nil, err
+	}
+	return s.Checklist(ctx, userID)
+}
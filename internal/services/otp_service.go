@@ -70,6 +70,11 @@ func (s *OTPService) GetExpiryTime() time.Time {
 	return time.Now().Add(time.Duration(s.expiryMinutes) * time.Minute)
 }
 
+// ExpiryMinutes returns how many minutes a new OTP stays valid
+func (s *OTPService) ExpiryMinutes() int {
+	return s.expiryMinutes
+}
+
 // IsOTPExpired checks if an OTP has expired
 func (s *OTPService) IsOTPExpired(expiresAt time.Time) bool {
 	return time.Now().After(expiresAt)
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// ErrPasswordRecentlyUsed is returned when a new password is one of the
+// user's recent passwords
+var ErrPasswordRecentlyUsed = errors.New("password was used recently, choose a different one")
+
+// passwordHistoryTimeout bounds comparing a new password against the
+// recent ones; each compare costs a full bcrypt hash
+const passwordHistoryTimeout = 5 * time.Second
+
+// SecuritySettingsReader reads the system security settings
+type SecuritySettingsReader interface {
+	GetSystemSecuritySettings(ctx context.Context) (*models.SystemSecuritySettings, error)
+}
+
+// SetPasswordHistory refuses new passwords that are one of the user's last
+// PasswordHistoryCount passwords of the system security settings
+func (s *AuthService) SetPasswordHistory(settings SecuritySettingsReader) {
+	s.passwordHistory = settings
+}
+
+// checkPasswordReuse returns ErrPasswordRecentlyUsed when newPassword is
+// the user's current password or one of the replaced ones the history count
+// covers. The hashes are compared concurrently.
+func (s *AuthService) checkPasswordReuse(ctx context.Context, user *models.User, newPassword string) error {
+	if s.passwordHistory == nil {
+		return nil
+	}
+	count := s.passwordHistoryCount(ctx)
+	if count == 0 {
+		return nil
+	}
+
+	hashes := make([]string, 0, 1+len(user.PasswordHistory))
+	if user.PasswordHash != "" {
+		hashes = append(hashes, user.PasswordHash)
+	}
+	hashes = append(hashes, user.PasswordHistory...)
+	if len(hashes) > count {
+		hashes = hashes[:count]
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, passwordHistoryTimeout)
+	defer cancel()
+	matches := make(chan bool, len(hashes))
+	for _, hash := range hashes {
+		go func(hash string) {
+			matches <- s.hasher.Compare(hash, newPassword) == nil
+		}(hash)
+	}
+	for range hashes {
+		select {
+		case matched := <-matches:
+			if matched {
+				return ErrPasswordRecentlyUsed
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("checking password history: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
+// passwordHistoryCount returns how many recent passwords may not be reused,
+// at most models.MaxPasswordHistory. The default applies when the settings
+// cannot be read.
+func (s *AuthService) passwordHistoryCount(ctx context.Context) int {
+	settings, err := s.passwordHistory.GetSystemSecuritySettings(ctx)
+	if err != nil {
+		log.Printf("Auth: failed to load security settings, using the default password history: %v", err)
+		settings = repositories.DefaultSystemSecuritySettings()
+	}
+	count := settings.PasswordHistoryCount
+	if count > models.MaxPasswordHistory {
+		count = models.MaxPasswordHistory
+	}
+	if count < 0 {
+		count = 0
+	}
+	return count
+}
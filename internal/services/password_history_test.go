@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+// historyCount is a SecuritySettingsReader of a fixed password history
+type historyCount int
+
+func (c historyCount) GetSystemSecuritySettings(ctx context.Context) (*models.SystemSecuritySettings, error) {
+	return &models.SystemSecuritySettings{PasswordHistoryCount: int(c)}, nil
+}
+
+// changePasswords changes the user's password from testPassword through
+// each of passwords in turn
+func changePasswords(t *testing.T, auth *AuthService, user *models.User, passwords ...string) {
+	t.Helper()
+	current := testPassword
+	for _, next := range passwords {
+		if err := auth.ChangePassword(context.Background(), user.ID, current, next); err != nil {
+			t.Fatalf("changing to %s: %v", next, err)
+		}
+		current = next
+	}
+}
+
+func TestPasswordHistoryRefusesRecentPasswords(t *testing.T) {
+	users := memory.NewUserStore()
+	auth, user := newTestAuthService(t, users)
+	auth.SetPasswordHistory(historyCount(3))
+	changePasswords(t, auth, user, "Second-Horse-2", "Third-Horse-3", "Fourth-Horse-4")
+
+	// The current password and the last two replaced are three passwords
+	for _, tt := range []struct {
+		name, password string
+		want           error
+	}{
+		{"current", "Fourth-Horse-4", ErrPasswordRecentlyUsed},
+		{"immediately previous", "Third-Horse-3", ErrPasswordRecentlyUsed},
+		{"older, inside the window", "Second-Horse-2", ErrPasswordRecentlyUsed},
+		{"out of the window", testPassword, nil},
+	} {
+		stored, err := users.GetByID(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := auth.checkPasswordReuse(context.Background(), stored, tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := auth.ChangePassword(context.Background(), user.ID, "Fourth-Horse-4", "Third-Horse-3"); !errors.Is(err, ErrPasswordRecentlyUsed) {
+		t.Errorf("ChangePassword to the previous password = %v, want ErrPasswordRecentlyUsed", err)
+	}
+	if err := auth.ChangePassword(context.Background(), user.ID, "Fourth-Horse-4", testPassword); err != nil {
+		t.Errorf("ChangePassword to a password out of the window = %v", err)
+	}
+}
+
+func TestPasswordHistoryOfZeroAllowsReuse(t *testing.T) {
+	users := memory.NewUserStore()
+	auth, user := newTestAuthService(t, users)
+	auth.SetPasswordHistory(historyCount(0))
+	changePasswords(t, auth, user, "Second-Horse-2")
+
+	if err := auth.ChangePassword(context.Background(), user.ID, "Second-Horse-2", testPassword); err != nil {
+		t.Errorf("ChangePassword to the previous password with no history = %v", err)
+	}
+}
+
+// TestReplacePasswordHashKeepsTheHistory checks rehashing the current
+// password at a new cost, unlike changing it, adds nothing to the history
+func TestReplacePasswordHashKeepsTheHistory(t *testing.T) {
+	ctx := context.Background()
+	users := memory.NewUserStore()
+	auth, user := newTestAuthService(t, users)
+	changePasswords(t, auth, user, "Second-Horse-2")
+
+	before, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rehashed, err := mustHasher(t).Hash("Second-Horse-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.ReplacePasswordHash(ctx, user.ID, rehashed); err != nil {
+		t.Fatal(err)
+	}
+	after, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.PasswordHash != rehashed || len(after.PasswordHistory) != len(before.PasswordHistory) || after.PasswordHistory[0] != before.PasswordHistory[0] {
+		t.Errorf("history after a rehash = %d entries, want the %d there were", len(after.PasswordHistory), len(before.PasswordHistory))
+	}
+}
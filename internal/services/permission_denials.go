@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/clientip"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/requestid"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// permissionDenialWriteTimeout bounds storing a refused request and sending
+// the alert about a throttled user
+const permissionDenialWriteTimeout = 5 * time.Second
+
+// DeniedRequest is a request refused because the caller lacks the
+// permission or role its route requires
+type DeniedRequest struct {
+	UserID   string
+	UserName string
+	Role     string
+	Required string // The permission, or the roles, the route requires
+	Route    string // The route template
+}
+
+// PermissionDenials records requests refused for a missing permission or
+// role, which a compromised low-privilege account probing admin endpoints
+// collects quickly. Every denial is audited and kept for review. A user
+// denied more than limit times within window is throttled for window: their
+// further denied attempts are refused with 429, and the system notification
+// address is alerted once. Counts are kept per instance.
+type PermissionDenials struct {
+	repo     repositories.PermissionDenialStore
+	settings repositories.SettingsStore
+	audit    *events.AuditPublisher // nil leaves denials unaudited
+	alerts   email.EmailSender      // nil logs alerts instead of emailing them
+	counter  *utils.RateLimiter
+	limit    int
+	window   time.Duration
+
+	mu        sync.Mutex
+	throttled map[string]time.Time // Until when, by user ID
+}
+
+// NewPermissionDenials creates a PermissionDenials throttling users denied
+// more than limit times within window
+func NewPermissionDenials(repo repositories.PermissionDenialStore, settings repositories.SettingsStore, auditPublisher *events.AuditPublisher, limit int, window time.Duration) *PermissionDenials {
+	return &PermissionDenials{
+		repo:      repo,
+		settings:  settings,
+		audit:     auditPublisher,
+		counter:   utils.NewRateLimiter(limit, window),
+		limit:     limit,
+		window:    window,
+		throttled: make(map[string]time.Time),
+	}
+}
+
+// SetAlertSender sets the sender of the alerts about throttled users
+func (d *PermissionDenials) SetAlertSender(sender email.EmailSender) {
+	d.alerts = sender
+}
+
+// Record audits and stores a denied request and counts it against the user.
+// It returns true, with how long until the throttle lifts, when the user is
+// throttled and the request should be refused with 429 instead of 403.
+func (d *PermissionDenials) Record(r *http.Request, denied DeniedRequest) (throttled bool, retryAfter time.Duration) {
+	now := time.Now()
+	startsThrottle := false
+	if denied.UserID != "" {
+		throttled, retryAfter = d.throttledFor(denied.UserID, now)
+		if !throttled {
+			if ok, _ := d.counter.Allow(denied.UserID); !ok {
+				throttled, retryAfter, startsThrottle = true, d.window, true
+				d.mu.Lock()
+				d.throttled[denied.UserID] = now.Add(d.window)
+				d.mu.Unlock()
+			}
+		}
+	}
+
+	if d.audit != nil {
+		d.audit.PublishPermissionDenied(r, denied.UserID, denied.UserName, denied.Required, denied.Route, throttled)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), permissionDenialWriteTimeout)
+	defer cancel()
+	err := d.repo.CreatePermissionDenial(ctx, &models.PermissionDenial{
+		UserID:     denied.UserID,
+		UserName:   denied.UserName,
+		Role:       denied.Role,
+		Required:   denied.Required,
+		Method:     r.Method,
+		Route:      denied.Route,
+		IPAddress:  clientip.FromRequest(r),
+		RequestID:  requestid.FromContext(r.Context()),
+		Throttled:  throttled,
+		OccurredAt: now,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to store permission denial of user %s: %v", denied.UserID, err)
+	}
+
+	if startsThrottle {
+		d.sendAlert(ctx, denied, clientip.FromRequest(r), now)
+	}
+	return throttled, retryAfter
+}
+
+// throttledFor reports whether userID is throttled at now and for how long
+func (d *PermissionDenials) throttledFor(userID string, now time.Time) (bool, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	until, ok := d.throttled[userID]
+	if !ok {
+		return false, 0
+	}
+	if !now.Before(until) {
+		delete(d.throttled, userID)
+		return false, 0
+	}
+	return true, until.Sub(now)
+}
+
+// List returns a page of refused requests, only those of userID when set,
+// newest first
+func (d *PermissionDenials) List(ctx context.Context, userID string, page pagination.Request) ([]models.PermissionDenial, error) {
+	return d.repo.ListPermissionDenials(ctx, userID, page)
+}
+
+// Count counts the refused requests, only those of userID when set
+func (d *PermissionDenials) Count(ctx context.Context, userID string) (int64, error) {
+	return d.repo.CountPermissionDenials(ctx, userID)
+}
+
+// sendAlert emails the system notification address that a user was
+// throttled. Failures are logged; the alert is not retried.
+func (d *PermissionDenials) sendAlert(ctx context.Context, denied DeniedRequest, ip string, now time.Time) {
+	who := denied.UserID
+	if denied.UserName != "" {
+		who = fmt.Sprintf("%s (%s)", denied.UserName, denied.UserID)
+	}
+	summary := fmt.Sprintf("%s, role %q, was denied access more than %d times within %s, most recently to %s %s from %s. Their further denied requests are refused for %s.",
+		who, denied.Role, d.limit, d.window, denied.Required, denied.Route, ip, d.window)
+
+	settings, err := d.settings.GetSystemEmailNotificationSettings(ctx)
+	if err != nil || d.alerts == nil || settings.SystemNotificationEmail == "" {
+		log.Printf("Permission denial alert: %s", summary)
+		return
+	}
+
+	msg := &models.CommMessage{
+		MessageID:   uuid.MustNewUUID(),
+		Channel:     models.ChannelEmail,
+		Direction:   models.DirectionOutbound,
+		Status:      models.MessageStatusQueued,
+		FromAddress: d.alerts.FromAddress(),
+		FromName:    "White Platform",
+		ToAddresses: []string{settings.SystemNotificationEmail},
+		Subject:     "Repeated access denials: " + who,
+		BodyText:    summary + "\n\nReview the recent denials under /api/v1/admin/system/audit-logs/permission-denials and deactivate the account if it may be compromised.",
+		BodyHTML: "<p>" + html.EscapeString(summary) + "</p>" +
+			"<p>Review the recent denials under /api/v1/admin/system/audit-logs/permission-denials and deactivate the account if it may be compromised.</p>",
+		Priority:  models.PriorityUrgent,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := d.alerts.SendEmail(ctx, msg); err != nil {
+		log.Printf("Warning: failed to send permission denial alert to %s: %v", settings.SystemNotificationEmail, err)
+		return
+	}
+	log.Printf("Permission denial alert sent to %s: %s", settings.SystemNotificationEmail, summary)
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/pagination"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+// TestPermissionDenialsThrottleABurst simulates a burst of denials from one
+// account and checks the throttle engages past the limit, the alert is sent
+// once, and every denial is kept for review
+func TestPermissionDenialsThrottleABurst(t *testing.T) {
+	ctx := context.Background()
+	settings := memory.NewSettingsStore(memory.NewUserStore())
+	notify := "security@example.test"
+	if _, err := settings.UpdateSystemEmailNotificationSettings(ctx, &models.UpdateSystemEmailNotificationSettingsRequest{SystemNotificationEmail: &notify}); err != nil {
+		t.Fatal(err)
+	}
+	store := memory.NewPermissionDenialStore()
+	alerts := &recordingSender{}
+	denials := NewPermissionDenials(store, settings, nil, 3, time.Minute)
+	denials.SetAlertSender(alerts)
+
+	probe := DeniedRequest{UserID: "mallory", UserName: "Mallory", Role: "sales_rep", Required: models.PermTemplatesDelete, Route: "/api/v1/admin/roles"}
+	record := func(denied DeniedRequest) (bool, time.Duration) {
+		r := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/roles", nil)
+		r.RemoteAddr = "203.0.113.7:5000"
+		return denials.Record(r, denied)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if throttled, _ := record(probe); throttled {
+			t.Fatalf("denial %d of a limit of 3 throttled", i)
+		}
+	}
+	if alerts.count() != 0 {
+		t.Fatalf("%d alerts before the limit was passed", alerts.count())
+	}
+	for i := 4; i <= 8; i++ {
+		throttled, retryAfter := record(probe)
+		if !throttled || retryAfter <= 0 || retryAfter > time.Minute {
+			t.Errorf("denial %d = %v, retry after %v, want throttled for up to a minute", i, throttled, retryAfter)
+		}
+	}
+	if alerts.count() != 1 {
+		t.Fatalf("%d alerts sent, want 1", alerts.count())
+	}
+	alert := alerts.sent[0]
+	if len(alert.ToAddresses) != 1 || alert.ToAddresses[0] != notify || !strings.Contains(alert.Subject, "Mallory") ||
+		!strings.Contains(alert.BodyText, "203.0.113.7") || !strings.Contains(alert.BodyText, models.PermTemplatesDelete) {
+		t.Errorf("alert = %+v", alert)
+	}
+
+	// Other users are not held back by Mallory's denials
+	if throttled, _ := record(DeniedRequest{UserID: "dana", Required: models.PermTemplatesDelete, Route: "/api/v1/admin/roles"}); throttled {
+		t.Error("another user throttled")
+	}
+
+	stored, err := denials.List(ctx, "mallory", pagination.Request{Limit: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 8 {
+		t.Fatalf("%d denials kept, want 8", len(stored))
+	}
+	throttled := 0
+	for _, denial := range stored {
+		if denial.Throttled {
+			throttled++
+		}
+		if denial.Method != http.MethodDelete || denial.Route != probe.Route || denial.Required != probe.Required || denial.IPAddress != "203.0.113.7" || denial.Role != "sales_rep" {
+			t.Errorf("denial = %+v", denial)
+		}
+	}
+	if throttled != 5 {
+		t.Errorf("%d denials marked throttled, want 5", throttled)
+	}
+	if n, err := denials.Count(ctx, ""); err != nil || n != 9 {
+		t.Errorf("count of every denial = %d, %v, want 9", n, err)
+	}
+}
+
+// TestPermissionDenialsThrottleLifts checks a throttled user is let through
+// to 403 again once the window has passed, and alerted about again when
+// they pass the limit anew
+func TestPermissionDenialsThrottleLifts(t *testing.T) {
+	settings := memory.NewSettingsStore(memory.NewUserStore())
+	notify := "security@example.test"
+	if _, err := settings.UpdateSystemEmailNotificationSettings(context.Background(), &models.UpdateSystemEmailNotificationSettingsRequest{SystemNotificationEmail: &notify}); err != nil {
+		t.Fatal(err)
+	}
+	alerts := &recordingSender{}
+	const window = 200 * time.Millisecond
+	denials := NewPermissionDenials(memory.NewPermissionDenialStore(), settings, nil, 1, window)
+	denials.SetAlertSender(alerts)
+	probe := DeniedRequest{UserID: "mallory", Required: models.PermTemplatesDelete, Route: "/api/v1/admin/roles"}
+	record := func() bool {
+		throttled, _ := denials.Record(httptest.NewRequest(http.MethodGet, "/api/v1/admin/roles", nil), probe)
+		return throttled
+	}
+
+	if record() || !record() {
+		t.Fatal("want the second denial throttled with a limit of 1")
+	}
+	time.Sleep(window + 50*time.Millisecond)
+	if record() {
+		t.Error("still throttled after the window")
+	}
+	if !record() || alerts.count() != 2 {
+		t.Errorf("throttled again with %d alerts, want 2", alerts.count())
+	}
+}
+
+// TestPermissionDenialsWithoutAlertSender checks the throttle engages when
+// alerts can only be logged
+func TestPermissionDenialsWithoutAlertSender(t *testing.T) {
+	denials := NewPermissionDenials(memory.NewPermissionDenialStore(), memory.NewSettingsStore(memory.NewUserStore()), nil, 1, time.Minute)
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/roles", nil)
+	denials.Record(r, DeniedRequest{UserID: "mallory"})
+	if throttled, _ := denials.Record(r, DeniedRequest{UserID: "mallory"}); !throttled {
+		t.Error("not throttled past the limit")
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// PresenceInterval is how often the last seen time of a busy user is
+// written; presence is only as precise as this
+const PresenceInterval = 5 * time.Minute
+
+// presenceKeyPrefix namespaces the Redis keys claiming a user's next write
+const presenceKeyPrefix = "presence:"
+
+// Presence records when users were last seen making a request, without a
+// write per request. Each instance remembers whom it wrote recently; with
+// Redis the instances also claim each write there, so a user busy on
+// several instances is still written about once per PresenceInterval. The
+// store skips users written more recently either way, which is all that
+// stops an instance whose Redis is unreachable from writing a little more.
+type Presence struct {
+	users repositories.UserStore
+	redis *redis.Client // nil leaves the throttle to this instance and the store
+	now   func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // User ID -> when this instance last wrote them
+	lastSweep time.Time
+}
+
+// NewPresence creates a new Presence
+func NewPresence(users repositories.UserStore) *Presence {
+	return &Presence{
+		users: users,
+		now:   time.Now,
+		seen:  make(map[string]time.Time),
+	}
+}
+
+// SetRedis shares the write throttle between instances through client
+func (p *Presence) SetRedis(client *redis.Client) {
+	p.redis = client
+}
+
+// SetClock sets the clock users are seen by
+func (p *Presence) SetClock(now func() time.Time) {
+	if now != nil {
+		p.now = now
+	}
+}
+
+// Record records that userID made a request now. Failures are logged; they
+// never fail the request.
+func (p *Presence) Record(ctx context.Context, userID string) {
+	if userID == "" {
+		return
+	}
+	now := p.now()
+	if !p.due(userID, now) || !p.claim(ctx, userID) {
+		return
+	}
+	if err := p.users.UpdateLastSeen(ctx, userID, now, PresenceInterval); err != nil {
+		log.Printf("Presence: failed to record user %s as seen: %v", userID, err)
+	}
+}
+
+// due reports whether userID should be written at now as far as this
+// instance knows, and if so notes that it is
+func (p *Presence) due(userID string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Forget users not seen for a while so the map does not grow forever
+	if now.Sub(p.lastSweep) > 10*PresenceInterval {
+		for id, at := range p.seen {
+			if now.Sub(at) > PresenceInterval {
+				delete(p.seen, id)
+			}
+		}
+		p.lastSweep = now
+	}
+
+	if at, ok := p.seen[userID]; ok && now.Sub(at) < PresenceInterval {
+		return false
+	}
+	p.seen[userID] = now
+	return true
+}
+
+// claim takes the next write of userID for this instance in Redis. Without
+// Redis, or when it fails, the write goes ahead.
+func (p *Presence) claim(ctx context.Context, userID string) bool {
+	if p.redis == nil {
+		return true
+	}
+	claimed, err := p.redis.SetNX(ctx, presenceKeyPrefix+userID, 1, PresenceInterval).Result()
+	if err != nil {
+		return true
+	}
+	return claimed
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+// lastSeenWrites counts the last seen writes reaching a user store
+type lastSeenWrites struct {
+	*memory.UserStore
+
+	mu     sync.Mutex
+	writes int
+}
+
+func (s *lastSeenWrites) UpdateLastSeen(ctx context.Context, userID string, at time.Time, interval time.Duration) error {
+	s.mu.Lock()
+	s.writes++
+	s.mu.Unlock()
+	return s.UserStore.UpdateLastSeen(ctx, userID, at, interval)
+}
+
+func (s *lastSeenWrites) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writes
+}
+
+func TestPresenceWritesAtMostOncePerInterval(t *testing.T) {
+	ctx := context.Background()
+	users := &lastSeenWrites{UserStore: memory.NewUserStore()}
+	user := users.Add(&models.User{Email: "ana@example.com", IsActive: true})
+	clock := newFakeClock()
+	presence := NewPresence(users)
+	presence.SetClock(clock.Now)
+
+	lastSeen := func() time.Time {
+		t.Helper()
+		stored, err := users.GetByID(ctx, user.ID)
+		if err != nil || stored.LastSeenAt == nil {
+			t.Fatalf("user not seen: %v", err)
+		}
+		return *stored.LastSeenAt
+	}
+
+	first := clock.Now()
+	presence.Record(ctx, user.ID)
+	if users.count() != 1 || !lastSeen().Equal(first) {
+		t.Fatalf("first request: %d writes, last seen %v; want one write at %v", users.count(), lastSeen(), first)
+	}
+
+	// Requests inside the interval are not written
+	clock.Advance(time.Minute)
+	presence.Record(ctx, user.ID)
+	clock.Advance(PresenceInterval - time.Minute - time.Nanosecond)
+	presence.Record(ctx, user.ID)
+	if users.count() != 1 || !lastSeen().Equal(first) {
+		t.Errorf("requests inside the interval: %d writes, last seen %v; want still one at %v", users.count(), lastSeen(), first)
+	}
+
+	// The first request once the interval is up is
+	clock.Advance(time.Nanosecond)
+	presence.Record(ctx, user.ID)
+	if users.count() != 2 || !lastSeen().Equal(first.Add(PresenceInterval)) {
+		t.Errorf("request after the interval: %d writes, last seen %v; want a second write at %v", users.count(), lastSeen(), first.Add(PresenceInterval))
+	}
+}
+
+// TestPresenceStoreSkipsRecentWrites checks an instance that has not seen
+// the user, such as another one without Redis, does not move their last
+// seen time within the interval
+func TestPresenceStoreSkipsRecentWrites(t *testing.T) {
+	ctx := context.Background()
+	users := memory.NewUserStore()
+	user := users.Add(&models.User{Email: "ana@example.com", IsActive: true})
+	clock := newFakeClock()
+	first := clock.Now()
+
+	for range 2 {
+		presence := NewPresence(users)
+		presence.SetClock(clock.Now)
+		presence.Record(ctx, user.ID)
+		clock.Advance(time.Minute)
+	}
+	stored, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastSeenAt == nil || !stored.LastSeenAt.Equal(first) {
+		t.Errorf("last seen = %v, want the first instance's %v", stored.LastSeenAt, first)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/white/user-management/internal/cache/userscope"
 	"github.com/white/user-management/internal/models"
 	"github.com/white/user-management/internal/repositories"
 	"github.com/redis/go-redis/v9"
@@ -19,6 +20,8 @@ type RBACService struct {
 	repo        *repositories.PermissionRepository
 	redisClient *redis.Client
 	cacheTTL    time.Duration
+	userScopes  *userScopeCache // nil when per-user data scopes are not loaded
+	scopes      userscope.Cache // Where userScopes keeps users and teams; in memory unless set
 }
 
 // CachedRolePermissions is the structure stored in Redis
@@ -108,6 +111,98 @@ func (s *RBACService) GetPermissionsForRole(ctx context.Context, roleCode string
 	return permissions, dataScope, nil
 }
 
+// UserPermissionLookup returns a function that loads a user's role and effective
+// permissions (role permissions plus any granted directly on the user).
+// Used by middleware when a request carries no permission claims.
+func (s *RBACService) UserPermissionLookup(userRepo *repositories.MongoUserRepository) func(ctx context.Context, userID string) (string, []string, error) {
+	return func(ctx context.Context, userID string) (string, []string, error) {
+		user, err := s.lookupUser(ctx, userRepo, userID)
+		if err != nil {
+			return "", nil, err
+		}
+		if user == nil {
+			return "", nil, fmt.Errorf("user not found: %s", userID)
+		}
+		if !user.IsActive {
+			return "", nil, fmt.Errorf("user is inactive: %s", userID)
+		}
+
+		effective, err := s.EffectivePermissions(ctx, user)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return effective.Role, effective.Permissions, nil
+	}
+}
+
+// lookupUser returns the access-control fields of a user, through the user
+// scope cache when a user store is set
+func (s *RBACService) lookupUser(ctx context.Context, userRepo *repositories.MongoUserRepository, userID string) (*models.User, error) {
+	if s.userScopes == nil {
+		return userRepo.GetByID(ctx, userID)
+	}
+	entry, err := s.userScopes.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Exists {
+		return nil, nil
+	}
+	return &models.User{
+		ID:          userID,
+		Role:        models.UserRole(entry.Role),
+		Team:        entry.Team,
+		IsActive:    entry.IsActive,
+		RoleIDs:     entry.RoleIDs,
+		Permissions: entry.Grants,
+		DataScope:   entry.DataScope,
+	}, nil
+}
+
+// UsersWithPermission returns the active users whose role permissions,
+// custom role permissions or directly granted permissions include
+// permission, e.g. to find who to notify about work waiting for them
+func (s *RBACService) UsersWithPermission(ctx context.Context, users repositories.UserStore, permission string) ([]*models.User, error) {
+	active := true
+	rolePermissions := make(map[string][]string)
+	customPermissions := make(map[string][]string) // By role ID
+	var holders []*models.User
+	err := users.EachUserFiltered(ctx, repositories.UserFilters{IsActive: &active}, func(user *models.User) error {
+		role := string(user.Role)
+		permissions, ok := rolePermissions[role]
+		if !ok {
+			loaded, _, err := s.GetPermissionsForRole(ctx, role)
+			if err != nil {
+				// Unknown roles grant nothing; the user may still hold it directly
+				log.Printf("Warning: failed to load permissions for role %s: %v", role, err)
+			}
+			permissions = loaded
+			rolePermissions[role] = permissions
+		}
+		for _, id := range user.RoleIDs {
+			custom, ok := customPermissions[id]
+			if !ok {
+				loaded, err := s.PermissionsForRoleIDs(ctx, []string{id})
+				if err != nil {
+					return err
+				}
+				custom = loaded
+				customPermissions[id] = custom
+			}
+			permissions = MergePermissions(permissions, custom)
+		}
+		if models.HasPermission(MergePermissions(permissions, user.Permissions), permission) {
+			holders = append(holders, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holders, nil
+}
+
 // GetDataScopeForRole retrieves the data scope for a role
 func (s *RBACService) GetDataScopeForRole(ctx context.Context, roleCode string) (*models.DataScope, error) {
 	_, dataScope, err := s.GetPermissionsForRole(ctx, roleCode)
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var (
+	// ErrBuiltInRole is returned when deleting a built-in role
+	ErrBuiltInRole = errors.New("built-in roles cannot be deleted")
+
+	// ErrRoleInUse is returned when deleting a role users still hold
+	// without naming a role to move them to
+	ErrRoleInUse = errors.New("role is assigned to users")
+
+	// ErrInvalidRoleReassignment is returned when the role to move users to
+	// is the deleted role itself
+	ErrInvalidRoleReassignment = errors.New("users cannot be reassigned to the deleted role")
+
+	// ErrInvalidRoleCode is returned for role codes that are not lowercase
+	// letters, digits and underscores
+	ErrInvalidRoleCode = errors.New("role code must start with a letter and contain only lowercase letters, digits and underscores")
+)
+
+// roleCodePattern is the format of role codes, which users may hold as their
+// role and which cannot change once created
+var roleCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// PermissionsForRoleIDs returns the permissions of the roles ids merged in
+// order. Deleted and unknown roles grant nothing.
+func (s *RBACService) PermissionsForRoleIDs(ctx context.Context, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	roles, err := s.repo.GetRolesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var permissions []string
+	for _, role := range roles {
+		permissions = MergePermissions(permissions, role.Permissions)
+	}
+	return permissions, nil
+}
+
+// GetRoleByID retrieves an active role by ID
+func (s *RBACService) GetRoleByID(ctx context.Context, id string) (*models.RolePermission, error) {
+	return s.repo.GetRoleByID(ctx, id)
+}
+
+// CreateCustomRole creates a role users can be assigned alongside their own.
+// The code cannot be changed later; the name, description, permissions and
+// data scope can.
+func (s *RBACService) CreateCustomRole(ctx context.Context, req models.CreateCustomRoleRequest, createdBy string) (*models.RolePermission, error) {
+	if !roleCodePattern.MatchString(req.RoleCode) {
+		return nil, ErrInvalidRoleCode
+	}
+	role := &models.RolePermission{
+		RoleCode:    req.RoleCode,
+		RoleName:    req.RoleName,
+		Description: req.Description,
+		IsActive:    true,
+		Permissions: nonNilPermissions(req.Permissions),
+		DataScope:   req.DataScope,
+		CreatedBy:   createdBy,
+		UpdatedBy:   createdBy,
+	}
+	if err := s.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRoleByID replaces the name, description, permissions and data scope
+// of a role. Users hold roles by ID or code, neither of which changes, so a
+// renamed role keeps working for signed-in users.
+func (s *RBACService) UpdateRoleByID(ctx context.Context, id string, update models.UpdateRolePermissionsRequest, updatedBy string) (*models.RolePermission, error) {
+	role, err := s.repo.GetRoleByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	update.Permissions = nonNilPermissions(update.Permissions)
+	if err := s.UpdateRole(ctx, role.RoleCode, &update, updatedBy); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRoleByID(ctx, id)
+}
+
+// DeleteRoleByID deletes a custom role. While users hold it, either by ID or
+// as their role, it fails with ErrRoleInUse unless reassignTo names the role
+// to move them to first. It returns the deleted role and how many users
+// were moved.
+func (s *RBACService) DeleteRoleByID(ctx context.Context, id, reassignTo string) (*models.RolePermission, int64, error) {
+	role, err := s.repo.GetRoleByID(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if role.IsSystemRole || models.IsSystemRole(role.RoleCode) {
+		return nil, 0, ErrBuiltInRole
+	}
+
+	var moved int64
+	if reassignTo == "" {
+		holders, err := s.repo.CountRoleHolders(ctx, role)
+		if err != nil {
+			return nil, 0, err
+		}
+		if holders > 0 {
+			return nil, 0, fmt.Errorf("%w: %d users hold %s", ErrRoleInUse, holders, role.RoleCode)
+		}
+	} else {
+		if reassignTo == role.ID {
+			return nil, 0, ErrInvalidRoleReassignment
+		}
+		target, err := s.repo.GetRoleByID(ctx, reassignTo)
+		if err != nil {
+			return nil, 0, err
+		}
+		if moved, err = s.repo.ReassignRoleHolders(ctx, role, target); err != nil {
+			return nil, 0, err
+		}
+		s.invalidateAllUsers()
+	}
+
+	if err := s.DeleteRole(ctx, role.RoleCode); err != nil {
+		return nil, moved, err
+	}
+	return role, moved, nil
+}
+
+// AssignRoles sets the custom roles of a user, replacing the ones they held.
+// Every role must exist; the user's own role is unchanged.
+func (s *RBACService) AssignRoles(ctx context.Context, users repositories.UserStore, userID string, roleIDs []string) (*models.User, error) {
+	ids := make([]string, 0, len(roleIDs))
+	for _, id := range roleIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	roles, err := s.repo.GetRolesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) != len(ids) {
+		for _, id := range ids {
+			if !slices.ContainsFunc(roles, func(role models.RolePermission) bool { return role.ID == id }) {
+				return nil, fmt.Errorf("%w: %s", repositories.ErrRoleNotFound, id)
+			}
+		}
+	}
+
+	user, err := users.UpdateRoleIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	s.InvalidateUserDataScope(userID)
+	return user, nil
+}
+
+// nonNilPermissions stores an empty list rather than null for roles that
+// grant nothing
+func nonNilPermissions(permissions []string) []string {
+	if permissions == nil {
+		return []string{}
+	}
+	return permissions
+}
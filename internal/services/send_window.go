@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// SendWindowEnforcer holds outbound messages that are not urgent until the
+// organization's working hours, read from the system default settings.
+// Urgent messages such as 2FA codes and password resets are never held
+// back. Settings that cannot be read or are invalid let messages through.
+type SendWindowEnforcer struct {
+	settings repositories.SettingsStore
+	now      func() time.Time
+}
+
+// NewSendWindowEnforcer creates a new SendWindowEnforcer
+func NewSendWindowEnforcer(settings repositories.SettingsStore) *SendWindowEnforcer {
+	return &SendWindowEnforcer{settings: settings, now: time.Now}
+}
+
+// SetClock sets the clock the window is checked against
+func (e *SendWindowEnforcer) SetClock(now func() time.Time) {
+	if now != nil {
+		e.now = now
+	}
+}
+
+// Now returns the current time of the enforcer's clock
+func (e *SendWindowEnforcer) Now() time.Time {
+	return e.now()
+}
+
+// Window returns the organization's send window
+func (e *SendWindowEnforcer) Window(ctx context.Context) (*models.SendWindow, error) {
+	settings, err := e.settings.GetSystemDefaultSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return settings.SendWindow()
+}
+
+// Status returns the send window and whether it is open now
+func (e *SendWindowEnforcer) Status(ctx context.Context) (*models.SendWindowStatus, error) {
+	window, err := e.Window(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return window.Status(e.now()), nil
+}
+
+// DeferUntil returns when a message of the given priority may be sent if it
+// cannot be sent now, or nil when it can
+func (e *SendWindowEnforcer) DeferUntil(ctx context.Context, priority string) *time.Time {
+	if e == nil || priority == models.PriorityUrgent {
+		return nil
+	}
+	window, err := e.Window(ctx)
+	if err != nil {
+		log.Printf("Send window: not enforced, settings unusable: %v", err)
+		return nil
+	}
+	now := e.now()
+	if window.Contains(now) {
+		return nil
+	}
+	opening := window.NextOpening(now)
+	if opening.IsZero() {
+		return nil
+	}
+	return &opening
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+// TestSendWindowDefersOutsideWorkingHours moves a fake clock across the
+// edges of the working day and checks which messages are held and until
+// when, with urgent ones never held
+func TestSendWindowDefersOutsideWorkingHours(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2026, 3, 4, 3, 0, 0, 0, kolkata)} // A Wednesday
+	enforcer := NewSendWindowEnforcer(memory.NewSettingsStore(memory.NewUserStore()))
+	enforcer.SetClock(clock.Now)
+
+	opening := time.Date(2026, 3, 4, 9, 0, 0, 0, kolkata)
+	nextOpening := time.Date(2026, 3, 5, 9, 0, 0, 0, kolkata)
+	for _, tt := range []struct {
+		name    string
+		advance time.Duration
+		want    time.Time // Zero when sent now
+	}{
+		{"3am", 0, opening},
+		{"08:59", 5*time.Hour + 59*time.Minute, opening},
+		{"09:00", time.Minute, time.Time{}},
+		{"17:59", 8*time.Hour + 59*time.Minute, time.Time{}},
+		{"18:00", time.Minute, nextOpening},
+		{"23:59", 5*time.Hour + 59*time.Minute, nextOpening},
+	} {
+		clock.Advance(tt.advance)
+		for _, priority := range []string{models.PriorityLow, models.PriorityNormal, models.PriorityHigh, ""} {
+			got := enforcer.DeferUntil(ctx, priority)
+			if tt.want.IsZero() != (got == nil) || (got != nil && !got.Equal(tt.want)) {
+				t.Errorf("%s: %q message deferred until %v, want %v", tt.name, priority, got, tt.want)
+			}
+		}
+		if got := enforcer.DeferUntil(ctx, models.PriorityUrgent); got != nil {
+			t.Errorf("%s: urgent message deferred until %v, want it sent now", tt.name, got)
+		}
+		if status, err := enforcer.Status(ctx); err != nil || status.Open != tt.want.IsZero() {
+			t.Errorf("%s: status %+v (%v), want open %v", tt.name, status, err, tt.want.IsZero())
+		}
+	}
+
+	var enforcerless *SendWindowEnforcer
+	if got := enforcerless.DeferUntil(ctx, models.PriorityNormal); got != nil {
+		t.Errorf("without an enforcer deferred until %v, want no window", got)
+	}
+}
+
+// TestSendWindowFollowsTheSettings checks changed working hours and days
+// apply to the next message, and that unusable settings hold nothing back
+func TestSendWindowFollowsTheSettings(t *testing.T) {
+	ctx := context.Background()
+	settings := memory.NewSettingsStore(memory.NewUserStore())
+	saturday := time.Date(2026, 3, 7, 7, 30, 0, 0, time.UTC)
+	enforcer := NewSendWindowEnforcer(settings)
+	enforcer.SetClock(func() time.Time { return saturday })
+
+	if _, err := settings.UpdateSystemDefaultSettings(ctx, &models.UpdateSystemDefaultSettingsRequest{
+		Timezone: "UTC", WorkingHoursStart: "07:30", WorkingHoursEnd: "07:31", WorkingDays: []string{"saturday"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := enforcer.DeferUntil(ctx, models.PriorityNormal); got != nil {
+		t.Errorf("deferred until %v inside a one minute saturday window", got)
+	}
+
+	if _, err := settings.UpdateSystemDefaultSettings(ctx, &models.UpdateSystemDefaultSettingsRequest{WorkingDays: []string{"sunday"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := enforcer.DeferUntil(ctx, models.PriorityNormal), saturday.Add(24*time.Hour); got == nil || !got.Equal(want) {
+		t.Errorf("deferred until %v, want sunday's opening %v", got, want)
+	}
+
+	// Stored before validation: end before start
+	if _, err := settings.UpdateSystemDefaultSettings(ctx, &models.UpdateSystemDefaultSettingsRequest{WorkingHoursStart: "08:00"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := enforcer.DeferUntil(ctx, models.PriorityNormal); got != nil {
+		t.Errorf("deferred until %v with unusable working hours, want sent now", got)
+	}
+	if _, err := enforcer.Status(ctx); err == nil {
+		t.Error("status of unusable working hours, want an error")
+	}
+}
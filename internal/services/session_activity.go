@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// sessionActivityInterval is how often the activity of a busy session is
+// written; the inactivity timeout is only as precise as this
+const sessionActivityInterval = time.Minute
+
+// SessionActivity tracks when sessions were last used and times out those
+// left idle longer than their user's SessionTimeout security setting. The
+// absolute expiry of a session still applies however active it is.
+type SessionActivity struct {
+	sessions repositories.SessionStore
+	settings repositories.SettingsStore // nil applies the default timeout to everyone
+	now      func() time.Time
+
+	mu        sync.Mutex
+	touched   map[string]time.Time // Session ID -> when this instance last wrote its activity
+	lastSweep time.Time
+}
+
+// NewSessionActivity creates a new SessionActivity
+func NewSessionActivity(sessions repositories.SessionStore, settings repositories.SettingsStore) *SessionActivity {
+	return &SessionActivity{
+		sessions: sessions,
+		settings: settings,
+		now:      time.Now,
+		touched:  make(map[string]time.Time),
+	}
+}
+
+// SetClock sets the clock activity and timeouts are measured with
+func (a *SessionActivity) SetClock(now func() time.Time) {
+	if now != nil {
+		a.now = now
+	}
+}
+
+// IdleTimeout returns how long a session of userID may go unused. A
+// failure to read the settings falls back to the default timeout.
+func (a *SessionActivity) IdleTimeout(ctx context.Context, userID string) time.Duration {
+	minutes := repositories.DefaultSecuritySettings(userID).SessionTimeout
+	if a.settings != nil {
+		settings, err := a.settings.GetSecuritySettings(ctx, userID)
+		if err != nil {
+			log.Printf("Sessions: failed to load security settings of user %s: %v", userID, err)
+		} else if settings.SessionTimeout > 0 {
+			minutes = settings.SessionTimeout
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Active reports whether session can still be used, i.e. it is not revoked,
+// expired or timed out after inactivity
+func (a *SessionActivity) Active(ctx context.Context, session *models.Session) bool {
+	return session.IsActiveAt(a.now(), a.IdleTimeout(ctx, session.UserID))
+}
+
+// Record records that the session sessionID of userID was used. Each
+// instance writes a session at most once per sessionActivityInterval, and
+// the store skips sessions written more recently by another instance.
+func (a *SessionActivity) Record(ctx context.Context, userID, sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	now := a.now()
+	if !a.due(sessionID, now) {
+		return
+	}
+	idle := a.IdleTimeout(ctx, userID)
+	if err := a.sessions.TouchSession(ctx, sessionID, now, sessionActivityInterval, idle); err != nil {
+		log.Printf("Sessions: failed to record activity of session %s: %v", sessionID, err)
+	}
+}
+
+// started notes that sessionID was issued at at with its activity set, so
+// the first request made with it is not mistaken for a write that is due
+func (a *SessionActivity) started(sessionID string, at time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.touched[sessionID] = at
+}
+
+// due reports whether the activity of sessionID should be written at now,
+// and if so notes that it is
+func (a *SessionActivity) due(sessionID string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Forget sessions not used for a while so the map does not grow forever
+	if now.Sub(a.lastSweep) > 10*sessionActivityInterval {
+		for id, at := range a.touched {
+			if now.Sub(at) > sessionActivityInterval {
+				delete(a.touched, id)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	if at, ok := a.touched[sessionID]; ok && now.Sub(at) < sessionActivityInterval {
+		return false
+	}
+	a.touched[sessionID] = now
+	return true
+}
+
+// List returns the sessions of userID that can still be used; sessions timed
+// out after inactivity are left out like expired ones. currentID marks the
+// session of the caller.
+func (a *SessionActivity) List(ctx context.Context, userID, currentID string) ([]models.SessionInfo, time.Duration, error) {
+	now := a.now()
+	sessions, err := a.sessions.ListUserSessions(ctx, userID, now)
+	if err != nil {
+		return nil, 0, err
+	}
+	idle := a.IdleTimeout(ctx, userID)
+
+	infos := []models.SessionInfo{}
+	for _, session := range sessions {
+		if !session.IsActiveAt(now, idle) {
+			continue
+		}
+		infos = append(infos, models.SessionInfo{
+			ID:             session.TokenID,
+			IPAddress:      session.IPAddress,
+			UserAgent:      session.UserAgent,
+			IssuedAt:       session.IssuedAt,
+			LastActivityAt: session.LastActive(),
+			IdleExpiresAt:  session.IdleExpiresAt(idle),
+			ExpiresAt:      session.ExpiresAt,
+			Current:        currentID != "" && session.TokenID == currentID,
+		})
+	}
+	return infos, idle, nil
+}
+
+// Now returns the current time of the activity clock
+func (a *SessionActivity) Now() time.Time {
+	return a.now()
+}
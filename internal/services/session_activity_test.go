@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories/memory"
+)
+
+// fakeClock is a clock tests move forward by hand
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newSessionTest returns an AuthService timing out idle sessions on clock,
+// its activity tracker, the stores behind them and a user who can sign in
+func newSessionTest(t *testing.T) (*AuthService, *SessionActivity, *memory.UserStore, *memory.SettingsStore, *models.User, *fakeClock) {
+	t.Helper()
+	users := memory.NewUserStore()
+	settings := memory.NewSettingsStore(users)
+	auth, user := newTestAuthService(t, users)
+	clock := newFakeClock()
+	activity := NewSessionActivity(users, settings)
+	activity.SetClock(clock.Now)
+	auth.SetSessionActivity(activity)
+	return auth, activity, users, settings, user, clock
+}
+
+func TestSessionTimesOutAfterInactivity(t *testing.T) {
+	ctx := context.Background()
+	auth, activity, users, _, user, clock := newSessionTest(t)
+	_, tokens, err := auth.Login(ctx, user.Email, testPassword, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each refresh within the default 30 minutes keeps the session alive
+	for i := 0; i < 3; i++ {
+		clock.Advance(29 * time.Minute)
+		if _, err := auth.RefreshToken(ctx, tokens.RefreshToken); err != nil {
+			t.Fatalf("refresh %d, 29 minutes after the last use: %v", i, err)
+		}
+	}
+
+	clock.Advance(31 * time.Minute)
+	if _, err := auth.RefreshToken(ctx, tokens.RefreshToken); err == nil || !strings.Contains(err.Error(), "inactivity") {
+		t.Errorf("refresh after 31 idle minutes = %v, want the session timed out", err)
+	}
+	session, _ := users.GetByRefreshToken(ctx, tokens.RefreshToken)
+	if session.IsRevoked || !clock.Now().Before(session.ExpiresAt) {
+		t.Fatal("the session should time out while neither revoked nor expired")
+	}
+
+	// Using a timed-out session does not bring it back
+	activity.Record(ctx, user.ID, session.TokenID)
+	if activity.Active(ctx, session) {
+		t.Error("a timed-out session is active again after being used")
+	}
+	if listed, _, _ := activity.List(ctx, user.ID, ""); len(listed) != 0 {
+		t.Errorf("listed %d sessions, want the timed-out one left out", len(listed))
+	}
+}
+
+func TestSessionTimeoutFollowsSecuritySettings(t *testing.T) {
+	ctx := context.Background()
+	auth, activity, _, settings, user, clock := newSessionTest(t)
+	settings.SetSecuritySettings(models.SettingsUserSecuritySettings{UserID: user.ID, SessionTimeout: 5})
+	if idle := activity.IdleTimeout(ctx, user.ID); idle != 5*time.Minute {
+		t.Fatalf("IdleTimeout = %v, want the user's 5 minutes", idle)
+	}
+	if idle := activity.IdleTimeout(ctx, "someone-else"); idle != 30*time.Minute {
+		t.Errorf("IdleTimeout without settings = %v, want the 30 minute default", idle)
+	}
+
+	_, tokens, err := auth.Login(ctx, user.Email, testPassword, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(6 * time.Minute)
+	if _, err := auth.RefreshToken(ctx, tokens.RefreshToken); err == nil {
+		t.Error("refreshed a session idle beyond the user's 5 minute timeout")
+	}
+}
+
+func TestSessionActivityIsWrittenOncePerMinute(t *testing.T) {
+	ctx := context.Background()
+	auth, activity, users, settings, user, clock := newSessionTest(t)
+	_, tokens, err := auth.Login(ctx, user.Email, testPassword, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastActive := func() time.Time {
+		session, err := users.GetByRefreshToken(ctx, tokens.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session.LastActive()
+	}
+	session, _ := users.GetByRefreshToken(ctx, tokens.RefreshToken)
+	signedIn := lastActive()
+
+	clock.Advance(30 * time.Second)
+	activity.Record(ctx, user.ID, session.TokenID)
+	if got := lastActive(); !got.Equal(signedIn) {
+		t.Errorf("activity 30s after sign-in was written: %v", got.Sub(signedIn))
+	}
+
+	clock.Advance(31 * time.Second)
+	activity.Record(ctx, user.ID, session.TokenID)
+	written := lastActive()
+	if !written.Equal(clock.Now()) {
+		t.Errorf("activity 61s after sign-in = %v after sign-in, want it written", written.Sub(signedIn))
+	}
+
+	// Another API instance sees the session was written moments ago
+	other := NewSessionActivity(users, settings)
+	other.SetClock(clock.Now)
+	clock.Advance(20 * time.Second)
+	other.Record(ctx, user.ID, session.TokenID)
+	if got := lastActive(); !got.Equal(written) {
+		t.Errorf("another instance wrote activity %v after this one", got.Sub(written))
+	}
+}
+
+func TestActiveSessionsStillEndAtTheirAbsoluteExpiry(t *testing.T) {
+	ctx := context.Background()
+	auth, activity, users, _, user, clock := newSessionTest(t)
+	_, tokens, err := auth.Login(ctx, user.Email, testPassword, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _ := users.GetByRefreshToken(ctx, tokens.RefreshToken)
+
+	for clock.Now().Before(session.ExpiresAt.Add(-20 * time.Minute)) {
+		clock.Advance(20 * time.Minute)
+		activity.Record(ctx, user.ID, session.TokenID)
+	}
+	session, _ = users.GetByRefreshToken(ctx, tokens.RefreshToken)
+	if !activity.Active(ctx, session) {
+		t.Fatal("a session used every 20 minutes timed out before its expiry")
+	}
+	if got := session.IdleExpiresAt(30 * time.Minute); !got.Equal(session.ExpiresAt) {
+		t.Errorf("IdleExpiresAt = %v, want capped at the absolute expiry %v", got, session.ExpiresAt)
+	}
+
+	clock.Advance(session.ExpiresAt.Sub(clock.Now()))
+	if activity.Active(ctx, session) {
+		t.Error("a session used up to its expiry is active past it")
+	}
+	if _, err := auth.RefreshToken(ctx, tokens.RefreshToken); err == nil {
+		t.Error("refreshed a session at its absolute expiry")
+	}
+}
+
+func TestListSessionsShowsActivityAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	auth, activity, users, _, user, clock := newSessionTest(t)
+	_, first, err := auth.Login(ctx, user.Email, testPassword, "203.0.113.7", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	_, second, err := auth.Login(ctx, user.Email, testPassword, "198.51.100.9", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstSession, _ := users.GetByRefreshToken(ctx, first.RefreshToken)
+	secondSession, _ := users.GetByRefreshToken(ctx, second.RefreshToken)
+
+	clock.Advance(10 * time.Minute)
+	activity.Record(ctx, user.ID, firstSession.TokenID)
+	usedAt := clock.Now()
+
+	listed, idle, err := activity.List(ctx, user.ID, secondSession.TokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idle != 30*time.Minute || len(listed) != 2 {
+		t.Fatalf("List = %d sessions with a %v timeout", len(listed), idle)
+	}
+	want := map[string]models.SessionInfo{
+		firstSession.TokenID: {
+			ID: firstSession.TokenID, IPAddress: "203.0.113.7", UserAgent: "laptop",
+			IssuedAt: firstSession.IssuedAt, LastActivityAt: usedAt, IdleExpiresAt: usedAt.Add(idle), ExpiresAt: firstSession.ExpiresAt,
+		},
+		secondSession.TokenID: {
+			ID: secondSession.TokenID, IPAddress: "198.51.100.9", UserAgent: "phone",
+			IssuedAt: secondSession.IssuedAt, LastActivityAt: secondSession.IssuedAt, IdleExpiresAt: secondSession.IssuedAt.Add(idle), ExpiresAt: secondSession.ExpiresAt,
+			Current: true,
+		},
+	}
+	for _, got := range listed {
+		if got != want[got.ID] {
+			t.Errorf("listed %+v, want %+v", got, want[got.ID])
+		}
+	}
+
+	// The session not used since sign-in times out first
+	clock.Advance(25 * time.Minute)
+	listed, _, _ = activity.List(ctx, user.ID, "")
+	if len(listed) != 1 || listed[0].ID != firstSession.TokenID {
+		t.Errorf("listed %+v after the second session went idle, want only the first", listed)
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/validation"
+)
+
+const (
+	// minPasswordLengthFloor and minPasswordLengthCeiling bound the minimum
+	// password length the system security settings may require
+	minPasswordLengthFloor   = 8
+	minPasswordLengthCeiling = 128
+)
+
+// SettingsChanges maps the JSON path of each changed settings field to its
+// value before and after an update
+type SettingsChanges map[string]models.SettingsFieldChange
+
+// Fields returns the changed fields in path order
+func (c SettingsChanges) Fields() []string {
+	fields := make([]string, 0, len(c))
+	for field := range c {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Describe summarizes the changes for an audit entry, e.g.
+// "System security settings updated: minPasswordLength, ssoEnabled"
+func (c SettingsChanges) Describe(subject string) string {
+	if len(c) == 0 {
+		return subject + " saved without changes"
+	}
+	return subject + " updated: " + strings.Join(c.Fields(), ", ")
+}
+
+// Metadata returns the changes as audit event metadata
+func (c SettingsChanges) Metadata() map[string]interface{} {
+	changes := make(map[string]interface{}, len(c))
+	for field, change := range c {
+		changes[field] = map[string]interface{}{"old": change.Old, "new": change.New}
+	}
+	return map[string]interface{}{"changes": changes}
+}
+
+// DiffSettings compares two values of the same settings struct field by
+// field. Fields are named by their JSON name, nested structs as
+// parent.field, and fields tagged diff:"-" (IDs, versions, timestamps) are
+// skipped.
+func DiffSettings(before, after interface{}) SettingsChanges {
+	changes := SettingsChanges{}
+	diffValues(reflect.ValueOf(before), reflect.ValueOf(after), "", changes)
+	return changes
+}
+
+func diffValues(before, after reflect.Value, prefix string, changes SettingsChanges) {
+	for before.Kind() == reflect.Pointer {
+		if before.IsNil() || after.IsNil() {
+			if before.IsNil() != after.IsNil() {
+				changes[prefix] = models.SettingsFieldChange{Old: interfaceOrNil(before), New: interfaceOrNil(after)}
+			}
+			return
+		}
+		before, after = before.Elem(), after.Elem()
+	}
+
+	if before.Kind() != reflect.Struct || before.Type() == reflect.TypeOf(time.Time{}) {
+		if !reflect.DeepEqual(before.Interface(), after.Interface()) {
+			changes[prefix] = models.SettingsFieldChange{Old: before.Interface(), New: after.Interface()}
+		}
+		return
+	}
+
+	t := before.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("diff") == "-" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		diffValues(before.Field(i), after.Field(i), name, changes)
+	}
+}
+
+func interfaceOrNil(value reflect.Value) interface{} {
+	if value.IsNil() {
+		return nil
+	}
+	return value.Elem().Interface()
+}
+
+// ValidateSystemSecuritySettings checks the rules that span fields of the
+// system security settings, as they would be after an update
+func ValidateSystemSecuritySettings(settings *models.SystemSecuritySettings) validation.Errors {
+	errs := validation.Errors{}
+	if settings.MinPasswordLength < minPasswordLengthFloor || settings.MinPasswordLength > minPasswordLengthCeiling {
+		errs["minPasswordLength"] = fmt.Sprintf("must be between %d and %d", minPasswordLengthFloor, minPasswordLengthCeiling)
+	}
+	if settings.SessionTimeoutMinutes <= 0 {
+		errs["sessionTimeoutMinutes"] = "must be positive"
+	}
+	if settings.PasswordExpiryDays < 0 {
+		errs["passwordExpiryDays"] = "must not be negative"
+	}
+	if settings.JITDefaultRole != "" && !models.IsValidUserRole(settings.JITDefaultRole) {
+		errs["jitDefaultRole"] = "must be a valid role"
+	}
+	if entry, ok := invalidIPWhitelistEntry(settings.IPWhitelist); !ok {
+		errs["ipWhitelist"] = fmt.Sprintf("%q is not an IP address or CIDR range", entry)
+	}
+	return errs
+}
+
+// ValidateSystemDefaultSettings checks the rules that span fields of the
+// system default settings, as they would be after an update
+func ValidateSystemDefaultSettings(settings *models.SystemDefaultSettings) validation.Errors {
+	errs := validation.Errors{}
+	if settings.Timezone != "" {
+		if _, err := time.LoadLocation(settings.Timezone); err != nil || settings.Timezone == "Local" {
+			errs["timezone"] = "must be an IANA timezone such as Asia/Kolkata"
+		}
+	}
+	start, startOK := parseWorkingHours(settings.WorkingHoursStart)
+	if !startOK {
+		errs["workingHoursStart"] = "must be a time such as 09:00 (HH:MM, 24h)"
+	}
+	end, endOK := parseWorkingHours(settings.WorkingHoursEnd)
+	if !endOK {
+		errs["workingHoursEnd"] = "must be a time such as 18:00 (HH:MM, 24h)"
+	}
+	if startOK && endOK && !start.Before(end) {
+		errs["workingHoursEnd"] = "must be after workingHoursStart"
+	}
+	if settings.WorkingDays != nil {
+		if day, ok := invalidWorkingDay(settings.WorkingDays); !ok {
+			errs["workingDays"] = fmt.Sprintf("%q is not a weekday name such as monday, or is listed twice", day)
+		} else if len(settings.WorkingDays) == 0 {
+			errs["workingDays"] = "must list at least one day"
+		}
+	}
+	return errs
+}
+
+// parseWorkingHours parses a time of day in HH:MM (24h) form
+func parseWorkingHours(value string) (time.Time, bool) {
+	t, err := time.Parse(models.WorkingHoursLayout, value)
+	return t, err == nil && t.Format(models.WorkingHoursLayout) == value
+}
+
+// invalidWorkingDay returns the first working day that is not a weekday
+// name or repeats an earlier one
+func invalidWorkingDay(days []string) (string, bool) {
+	seen := make(map[time.Weekday]bool, len(days))
+	for _, day := range days {
+		weekday, ok := models.ParseWeekday(day)
+		if !ok || seen[weekday] {
+			return day, false
+		}
+		seen[weekday] = true
+	}
+	return "", true
+}
+
+// invalidIPWhitelistEntry checks every entry of a whitelist separated by
+// commas, spaces or newlines, returning the first that is neither an IP
+// address nor a CIDR range
+func invalidIPWhitelistEntry(whitelist string) (string, bool) {
+	entries := strings.FieldsFunc(whitelist, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	for _, entry := range entries {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err == nil {
+			continue
+		}
+		return entry, false
+	}
+	return "", true
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiffSettings(t *testing.T) {
+	before := &models.SettingsCompanyInfo{
+		ID:            primitive.NewObjectID(),
+		Name:          "Acme",
+		Website:       "https://acme.example",
+		EmailBranding: models.SettingsEmailBranding{PrimaryColor: "#112233"},
+		UpdatedAt:     time.Now(),
+	}
+	after := *before
+	after.ID = primitive.NewObjectID()
+	after.UpdatedAt = before.UpdatedAt.Add(time.Hour)
+	if changes := DiffSettings(before, &after); len(changes) != 0 {
+		t.Errorf("changes with only the ID and timestamp changed = %v, want none", changes)
+	}
+
+	after.Name = "Acme Ltd"
+	after.EmailBranding.PrimaryColor = "#445566"
+	want := SettingsChanges{
+		"name":                       {Old: "Acme", New: "Acme Ltd"},
+		"emailBranding.primaryColor": {Old: "#112233", New: "#445566"},
+	}
+	changes := DiffSettings(before, &after)
+	if !maps.Equal(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+	if got := changes.Fields(); !slices.Equal(got, []string{"emailBranding.primaryColor", "name"}) {
+		t.Errorf("fields = %v, want them in path order", got)
+	}
+	if got, want := changes.Describe("Company information"), "Company information updated: emailBranding.primaryColor, name"; got != want {
+		t.Errorf("Describe = %q, want %q", got, want)
+	}
+	if got, want := (SettingsChanges{}).Describe("Company information"), "Company information saved without changes"; got != want {
+		t.Errorf("Describe without changes = %q, want %q", got, want)
+	}
+
+	wantMetadata := map[string]interface{}{"changes": map[string]interface{}{
+		"name":                       map[string]interface{}{"old": "Acme", "new": "Acme Ltd"},
+		"emailBranding.primaryColor": map[string]interface{}{"old": "#112233", "new": "#445566"},
+	}}
+	if got := changes.Metadata(); !reflect.DeepEqual(got, wantMetadata) {
+		t.Errorf("Metadata = %v, want %v", got, wantMetadata)
+	}
+
+	// Slices compare by value
+	defaults := &models.SystemDefaultSettings{WorkingDays: []string{"monday", "tuesday"}}
+	same := &models.SystemDefaultSettings{WorkingDays: []string{"monday", "tuesday"}}
+	if changes := DiffSettings(defaults, same); len(changes) != 0 {
+		t.Errorf("changes between equal working days = %v", changes)
+	}
+	same.WorkingDays = []string{"monday"}
+	if changes := DiffSettings(defaults, same); len(changes) != 1 || !reflect.DeepEqual(changes["workingDays"].New, []string{"monday"}) {
+		t.Errorf("changes = %v, want workingDays only", changes)
+	}
+}
+
+func TestValidateSystemSecuritySettings(t *testing.T) {
+	valid := models.SystemSecuritySettings{MinPasswordLength: 12, SessionTimeoutMinutes: 30, JITDefaultRole: string(models.UserRoleSalesRep)}
+	for _, tt := range []struct {
+		name   string
+		change func(*models.SystemSecuritySettings)
+		fields []string
+	}{
+		{"valid", func(*models.SystemSecuritySettings) {}, nil},
+		{"shortest password", func(s *models.SystemSecuritySettings) { s.MinPasswordLength = 8 }, nil},
+		{"longest password", func(s *models.SystemSecuritySettings) { s.MinPasswordLength = 128 }, nil},
+		{"password too short", func(s *models.SystemSecuritySettings) { s.MinPasswordLength = 7 }, []string{"minPasswordLength"}},
+		{"password too long", func(s *models.SystemSecuritySettings) { s.MinPasswordLength = 129 }, []string{"minPasswordLength"}},
+		{"no session timeout", func(s *models.SystemSecuritySettings) { s.SessionTimeoutMinutes = 0 }, []string{"sessionTimeoutMinutes"}},
+		{"negative expiry", func(s *models.SystemSecuritySettings) { s.PasswordExpiryDays = -1 }, []string{"passwordExpiryDays"}},
+		{"unknown JIT role", func(s *models.SystemSecuritySettings) { s.JITDefaultRole = "owner" }, []string{"jitDefaultRole"}},
+		{"whitelist", func(s *models.SystemSecuritySettings) { s.IPWhitelist = "10.0.0.1, 192.168.0.0/16\n2001:db8::/32" }, nil},
+		{"bad whitelist entry", func(s *models.SystemSecuritySettings) { s.IPWhitelist = "10.0.0.1,10.0.0.300" }, []string{"ipWhitelist"}},
+		{"several", func(s *models.SystemSecuritySettings) { s.MinPasswordLength, s.SessionTimeoutMinutes = 4, -5 }, []string{"minPasswordLength", "sessionTimeoutMinutes"}},
+	} {
+		settings := valid
+		tt.change(&settings)
+		if got := slices.Sorted(maps.Keys(ValidateSystemSecuritySettings(&settings))); !slices.Equal(got, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+func TestValidateSystemDefaultSettings(t *testing.T) {
+	valid := models.SystemDefaultSettings{Timezone: "Asia/Kolkata", WorkingHoursStart: "09:00", WorkingHoursEnd: "18:00"}
+	for _, tt := range []struct {
+		name   string
+		change func(*models.SystemDefaultSettings)
+		fields []string
+	}{
+		{"valid", func(*models.SystemDefaultSettings) {}, nil},
+		{"end before start", func(s *models.SystemDefaultSettings) { s.WorkingHoursStart, s.WorkingHoursEnd = "18:00", "09:00" }, []string{"workingHoursEnd"}},
+		{"start equals end", func(s *models.SystemDefaultSettings) { s.WorkingHoursEnd = "09:00" }, []string{"workingHoursEnd"}},
+		{"unpadded hour", func(s *models.SystemDefaultSettings) { s.WorkingHoursStart = "9:00" }, []string{"workingHoursStart"}},
+		{"12h clock", func(s *models.SystemDefaultSettings) { s.WorkingHoursEnd = "6:00pm" }, []string{"workingHoursEnd"}},
+		{"unknown timezone", func(s *models.SystemDefaultSettings) { s.Timezone = "Mars/Olympus" }, []string{"timezone"}},
+		{"local timezone", func(s *models.SystemDefaultSettings) { s.Timezone = "Local" }, []string{"timezone"}},
+		{"working days", func(s *models.SystemDefaultSettings) { s.WorkingDays = []string{"sunday", "monday"} }, nil},
+		{"repeated day", func(s *models.SystemDefaultSettings) { s.WorkingDays = []string{"monday", "monday"} }, []string{"workingDays"}},
+		{"no days", func(s *models.SystemDefaultSettings) { s.WorkingDays = []string{} }, []string{"workingDays"}},
+	} {
+		settings := valid
+		tt.change(&settings)
+		if got := slices.Sorted(maps.Keys(ValidateSystemDefaultSettings(&settings))); !slices.Equal(got, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
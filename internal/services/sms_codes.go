@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/sms"
+)
+
+// ErrSMSRateLimited is returned when too many codes were texted to a phone
+// number recently
+var ErrSMSRateLimited = errors.New("too many codes sent to this phone number, try again later")
+
+const (
+	// smsCodesPerNumber codes can be texted to one number per smsCodeWindow,
+	// which bounds the cost of and the spam sent by repeated requests
+	smsCodesPerNumber = 5
+	smsCodeWindow     = time.Hour
+
+	// smsProductNameLength keeps the product name from pushing a text past
+	// a single message
+	smsProductNameLength = 30
+)
+
+// SMSCodes texts one-time codes: 2FA sign-in codes and phone number
+// verifications. Texts are plain and short, limited per phone number, and
+// each provider call is bounded by the configured timeout.
+type SMSCodes struct {
+	sender          sms.Sender
+	limiter         *utils.RateLimiter
+	timeout         time.Duration
+	fallbackToEmail bool
+	productName     string
+}
+
+// NewSMSCodes creates an SMSCodes sending through sender. With
+// fallbackToEmail, sign-in codes that cannot be texted are emailed instead.
+func NewSMSCodes(sender sms.Sender, productName string, timeout time.Duration, fallbackToEmail bool) *SMSCodes {
+	if len(productName) > smsProductNameLength {
+		productName = productName[:smsProductNameLength]
+	}
+	return &SMSCodes{
+		sender:          sender,
+		limiter:         utils.NewRateLimiter(smsCodesPerNumber, smsCodeWindow),
+		timeout:         timeout,
+		fallbackToEmail: fallbackToEmail,
+		productName:     productName,
+	}
+}
+
+// FallbackToEmail reports whether a sign-in code that cannot be texted is
+// emailed instead
+func (c *SMSCodes) FallbackToEmail() bool {
+	return c.fallbackToEmail
+}
+
+// SendSignInCode texts a 2FA sign-in code to phoneNumber
+func (c *SMSCodes) SendSignInCode(ctx context.Context, phoneNumber, code string, validMinutes int) error {
+	return c.send(ctx, phoneNumber, fmt.Sprintf("%s is your %s sign-in code. It expires in %d minutes. Never share it.", code, c.productName, validMinutes))
+}
+
+// SendVerificationCode texts the code confirming that phoneNumber belongs to
+// the user adding it
+func (c *SMSCodes) SendVerificationCode(ctx context.Context, phoneNumber, code string, validMinutes int) error {
+	return c.send(ctx, phoneNumber, fmt.Sprintf("%s is your %s code to add this phone number. It expires in %d minutes.", code, c.productName, validMinutes))
+}
+
+func (c *SMSCodes) send(ctx context.Context, phoneNumber, body string) error {
+	if ok, _ := c.limiter.Allow(phoneNumber); !ok {
+		return ErrSMSRateLimited
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err := c.sender.SendSMS(ctx, phoneNumber, body); err != nil {
+		return fmt.Errorf("failed to text %s via %s: %w", sms.MaskNumber(phoneNumber), c.sender.Name(), err)
+	}
+	return nil
+}
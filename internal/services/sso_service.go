@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+var (
+	// ErrSSODisabled is returned when SSO is turned off in the system security settings
+	ErrSSODisabled = errors.New("SSO sign-in is disabled")
+	// ErrSSOInvalidState is returned when the callback state is unknown,
+	// expired or was already used
+	ErrSSOInvalidState = errors.New("invalid or expired SSO state")
+	// ErrSSOInvalidToken is returned when the code exchange or ID token
+	// validation fails
+	ErrSSOInvalidToken = errors.New("SSO sign-in could not be verified")
+	// ErrSSOEmailNotVerified is returned when the identity provider has not
+	// verified the user's email
+	ErrSSOEmailNotVerified = errors.New("SSO email address is not verified")
+	// ErrSSONoAccount is returned when no user has the SSO email and
+	// provisioning is off
+	ErrSSONoAccount = errors.New("no account for this SSO email")
+	// ErrSSOAccountInactive is returned when the matched user is deactivated
+	ErrSSOAccountInactive = errors.New("account is inactive")
+)
+
+// SSOService signs users in through an OpenID Connect provider. The state,
+// nonce and PKCE verifier of each sign-in are kept server-side and consumed
+// by the callback, so a callback can only be completed once.
+type SSOService struct {
+	provider *utils.OIDCProvider
+	states   repositories.SSOStateStore
+	users    repositories.UserStore
+	settings repositories.SettingsStore
+	stateTTL time.Duration
+	now      func() time.Time
+}
+
+// NewSSOService creates a new SSOService
+func NewSSOService(
+	provider *utils.OIDCProvider,
+	states repositories.SSOStateStore,
+	users repositories.UserStore,
+	settings repositories.SettingsStore,
+	stateTTL time.Duration,
+) *SSOService {
+	return &SSOService{
+		provider: provider,
+		states:   states,
+		users:    users,
+		settings: settings,
+		stateTTL: stateTTL,
+		now:      time.Now,
+	}
+}
+
+// Start begins an SSO sign-in and returns the identity provider URL to
+// redirect the user to
+func (s *SSOService) Start(ctx context.Context) (string, error) {
+	if _, err := s.enabledSettings(ctx); err != nil {
+		return "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := s.now()
+	if err := s.states.SaveSSOState(ctx, &models.SSOState{
+		ID:           state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.stateTTL),
+	}); err != nil {
+		return "", err
+	}
+	return s.provider.AuthCodeURL(ctx, state, nonce, utils.PKCEChallenge(verifier))
+}
+
+// Complete finishes an SSO sign-in from the provider callback and returns
+// the signed-in user, matched by verified email or provisioned when the
+// security settings allow it. The caller creates the session.
+func (s *SSOService) Complete(ctx context.Context, code, state string) (*models.User, error) {
+	settings, err := s.enabledSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if state == "" || code == "" {
+		return nil, ErrSSOInvalidState
+	}
+
+	// The state is consumed before anything else so it cannot be retried
+	saved, err := s.states.ConsumeSSOState(ctx, state, s.now())
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			return nil, ErrSSOInvalidState
+		}
+		return nil, err
+	}
+
+	rawIDToken, err := s.provider.Exchange(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSSOInvalidToken, err)
+	}
+	claims, err := s.provider.VerifyIDToken(ctx, rawIDToken, saved.Nonce)
+	if err != nil {
+		if errors.Is(err, utils.ErrOIDCEmailNotVerified) {
+			return nil, ErrSSOEmailNotVerified
+		}
+		return nil, fmt.Errorf("%w: %w", ErrSSOInvalidToken, err)
+	}
+
+	user, err := s.users.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if !user.IsActive {
+			return nil, ErrSSOAccountInactive
+		}
+	case repositories.IsUserNotFound(err):
+		if !settings.AllowJITProvisioning {
+			return nil, ErrSSONoAccount
+		}
+		if user, err = s.provision(ctx, settings, claims); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	return user, nil
+}
+
+// PasswordLoginPolicy is the AuthService login policy that keeps non-admins
+// on SSO when SSO is enabled and password sign-in is disabled
+func (s *SSOService) PasswordLoginPolicy(ctx context.Context, user *models.User) error {
+	settings, err := s.settings.GetSystemSecuritySettings(ctx)
+	if err != nil {
+		// Admins must always be able to get in, so a settings outage does
+		// not lock anyone out
+		log.Printf("SSO: failed to load security settings, allowing password sign-in: %v", err)
+		return nil
+	}
+	if settings.SSOEnabled && settings.PasswordLoginDisabled && user.Role != models.UserRoleAdmin {
+		return ErrPasswordLoginDisabled
+	}
+	return nil
+}
+
+// enabledSettings returns the security settings, or ErrSSODisabled when SSO
+// is turned off
+func (s *SSOService) enabledSettings(ctx context.Context) (*models.SystemSecuritySettings, error) {
+	settings, err := s.settings.GetSystemSecuritySettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.SSOEnabled {
+		return nil, ErrSSODisabled
+	}
+	return settings, nil
+}
+
+// provision creates an active, password-less user for an SSO sign-in
+func (s *SSOService) provision(ctx context.Context, settings *models.SystemSecuritySettings, claims *utils.OIDCClaims) (*models.User, error) {
+	role := models.UserRole(settings.JITDefaultRole)
+	if !models.IsValidUserRole(string(role)) {
+		role = models.UserRoleSalesRep
+	}
+	name := claims.Name
+	if name == "" {
+		name = strings.TrimSpace(claims.GivenName + " " + claims.FamilyName)
+	}
+	if name == "" {
+		name = claims.Email
+	}
+
+	now := s.now()
+	user := &models.User{
+		ID:        uuid.MustNewUUID(),
+		Email:     claims.Email,
+		Name:      name,
+		Role:      role,
+		IsActive:  true,
+		Status:    repositories.UserStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to provision SSO user: %w", err)
+	}
+	log.Printf("SSO: provisioned user %s (%s) with role %s", user.ID, user.Email, user.Role)
+	return user, nil
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/repositories/memory"
+	"github.com/white/user-management/internal/utils"
+)
+
+const ssoClientID = "user-management"
+
+// fakeIdP is an OpenID Connect provider serving discovery, its signing key
+// and a token endpoint that checks the PKCE verifier of each code
+type fakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	issued map[string]url.Values // code -> authorization request
+	// edit changes the claims of the next ID tokens
+	edit func(claims jwt.MapClaims)
+}
+
+func startFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, issued: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.JWKS{Keys: []utils.JWK{{
+			Kty: "RSA",
+			Use: "sig",
+			Kid: "test-key",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the user signing in at the provider and returns the
+// code and state the callback receives
+func (idp *fakeIdP) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != ssoClientID || query.Get("code_challenge_method") != "S256" || query.Get("nonce") == "" {
+		t.Fatalf("authorization URL %s lacks the client, nonce or S256 challenge", authURL)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code = "code-" + query.Get("state")
+	idp.issued[code] = query
+	return code, query.Get("state")
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	request, ok := idp.issued[r.PostForm.Get("code")]
+	delete(idp.issued, r.PostForm.Get("code"))
+	edit := idp.edit
+	idp.mu.Unlock()
+	if !ok || utils.PKCEChallenge(r.PostForm.Get("code_verifier")) != request.Get("code_challenge") {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            ssoClientID,
+		"sub":            "idp-user-1",
+		"email":          "Ana@Example.com",
+		"email_verified": true,
+		"name":           "Ana Lima",
+		"nonce":          request.Get("nonce"),
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+}
+
+// ssoFixture is an SSOService with SSO enabled against a fake provider
+type ssoFixture struct {
+	sso      *SSOService
+	idp      *fakeIdP
+	states   *memory.SSOStateStore
+	users    *memory.UserStore
+	settings *memory.SettingsStore
+}
+
+func newSSOFixture(t *testing.T) *ssoFixture {
+	t.Helper()
+	idp := startFakeIdP(t)
+	users := memory.NewUserStore()
+	f := &ssoFixture{
+		idp:      idp,
+		states:   memory.NewSSOStateStore(),
+		users:    users,
+		settings: memory.NewSettingsStore(users),
+	}
+	provider := utils.NewOIDCProvider(utils.OIDCProviderConfig{
+		IssuerURL:    idp.server.URL,
+		ClientID:     ssoClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/api/v1/auth/sso/callback",
+		ClockSkew:    time.Minute,
+	})
+	f.sso = NewSSOService(provider, f.states, users, f.settings, 10*time.Minute)
+	enabled := true
+	f.updateSettings(t, &models.UpdateSystemSecuritySettingsRequest{SSOEnabled: &enabled})
+	return f
+}
+
+func (f *ssoFixture) updateSettings(t *testing.T, update *models.UpdateSystemSecuritySettingsRequest) {
+	t.Helper()
+	if _, err := f.settings.UpdateSystemSecuritySettings(context.Background(), update); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signIn runs a whole sign-in, the ID token claims changed by edit
+func (f *ssoFixture) signIn(t *testing.T, edit func(jwt.MapClaims)) (*models.User, error) {
+	t.Helper()
+	authURL, err := f.sso.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := f.idp.authorize(t, authURL)
+	f.idp.mu.Lock()
+	f.idp.edit = edit
+	f.idp.mu.Unlock()
+	return f.sso.Complete(context.Background(), code, state)
+}
+
+func (f *ssoFixture) addUser(active bool) *models.User {
+	return f.users.Add(&models.User{
+		Email:    "ana@example.com",
+		Name:     "Ana",
+		Role:     models.UserRoleManager,
+		IsActive: active,
+		Status:   repositories.UserStatusActive,
+	})
+}
+
+func TestSSOSignsInTheUserWithTheVerifiedEmail(t *testing.T) {
+	f := newSSOFixture(t)
+	existing := f.addUser(true)
+
+	user, err := f.signIn(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("signed in %s, want %s matched by its lower-cased email", user.ID, existing.ID)
+	}
+}
+
+// TestSSOStateIsUsedOnce replays a callback and one that arrives after the
+// state expired
+func TestSSOStateIsUsedOnce(t *testing.T) {
+	f := newSSOFixture(t)
+	f.addUser(true)
+	ctx := context.Background()
+
+	authURL, err := f.sso.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := f.idp.authorize(t, authURL)
+	if _, err := f.sso.Complete(ctx, code, state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.sso.Complete(ctx, code, state); !errors.Is(err, ErrSSOInvalidState) {
+		t.Errorf("replayed callback = %v, want ErrSSOInvalidState", err)
+	}
+	if _, err := f.sso.Complete(ctx, "code-unknown", "unknown"); !errors.Is(err, ErrSSOInvalidState) {
+		t.Errorf("unknown state = %v, want ErrSSOInvalidState", err)
+	}
+
+	authURL, err = f.sso.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state = f.idp.authorize(t, authURL)
+	f.sso.now = func() time.Time { return time.Now().Add(11 * time.Minute) }
+	if _, err := f.sso.Complete(ctx, code, state); !errors.Is(err, ErrSSOInvalidState) {
+		t.Errorf("expired state = %v, want ErrSSOInvalidState", err)
+	}
+	// The expired state was removed all the same
+	if _, err := f.states.ConsumeSSOState(ctx, state, time.Now()); !repositories.IsNotFound(err) {
+		t.Errorf("expired state still stored: %v", err)
+	}
+}
+
+func TestSSORejectsInvalidIDTokens(t *testing.T) {
+	for name, edit := range map[string]func(jwt.MapClaims){
+		"nonce of another sign-in": func(c jwt.MapClaims) { c["nonce"] = "other" },
+		"no nonce":                 func(c jwt.MapClaims) { delete(c, "nonce") },
+		"other audience":           func(c jwt.MapClaims) { c["aud"] = "another-app" },
+		"several audiences, no azp": func(c jwt.MapClaims) {
+			c["aud"] = []string{ssoClientID, "another-app"}
+		},
+		"several audiences, other azp": func(c jwt.MapClaims) {
+			c["aud"] = []string{ssoClientID, "another-app"}
+			c["azp"] = "another-app"
+		},
+		"other issuer":         func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired beyond skew":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"issued in the future": func(c jwt.MapClaims) { c["iat"] = time.Now().Add(2 * time.Minute).Unix() },
+		"no expiry":            func(c jwt.MapClaims) { delete(c, "exp") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newSSOFixture(t)
+			f.addUser(true)
+			if _, err := f.signIn(t, edit); !errors.Is(err, ErrSSOInvalidToken) {
+				t.Errorf("Complete = %v, want ErrSSOInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestSSOAcceptsValidVariants(t *testing.T) {
+	for name, edit := range map[string]func(jwt.MapClaims){
+		"several audiences with azp": func(c jwt.MapClaims) {
+			c["aud"] = []string{ssoClientID, "another-app"}
+			c["azp"] = ssoClientID
+		},
+		"email_verified as a string": func(c jwt.MapClaims) { c["email_verified"] = "true" },
+		"expired within skew":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() },
+		"issued within skew":         func(c jwt.MapClaims) { c["iat"] = time.Now().Add(30 * time.Second).Unix() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newSSOFixture(t)
+			f.addUser(true)
+			if _, err := f.signIn(t, edit); err != nil {
+				t.Errorf("Complete = %v, want a sign-in", err)
+			}
+		})
+	}
+}
+
+func TestSSORequiresAVerifiedEmail(t *testing.T) {
+	for name, edit := range map[string]func(jwt.MapClaims){
+		"unverified":        func(c jwt.MapClaims) { c["email_verified"] = false },
+		"unverified string": func(c jwt.MapClaims) { c["email_verified"] = "false" },
+		"no email_verified": func(c jwt.MapClaims) { delete(c, "email_verified") },
+		"no email":          func(c jwt.MapClaims) { delete(c, "email") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newSSOFixture(t)
+			f.addUser(true)
+			if _, err := f.signIn(t, edit); !errors.Is(err, ErrSSOEmailNotVerified) {
+				t.Errorf("Complete = %v, want ErrSSOEmailNotVerified", err)
+			}
+		})
+	}
+}
+
+func TestSSOAccountMatching(t *testing.T) {
+	t.Run("unknown email without provisioning", func(t *testing.T) {
+		f := newSSOFixture(t)
+		if _, err := f.signIn(t, nil); !errors.Is(err, ErrSSONoAccount) {
+			t.Errorf("Complete = %v, want ErrSSONoAccount", err)
+		}
+	})
+	t.Run("unknown email provisioned", func(t *testing.T) {
+		f := newSSOFixture(t)
+		allow, role := true, string(models.UserRoleManager)
+		f.updateSettings(t, &models.UpdateSystemSecuritySettingsRequest{AllowJITProvisioning: &allow, JITDefaultRole: &role})
+		user, err := f.signIn(t, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "ana@example.com" || user.Name != "Ana Lima" || user.Role != models.UserRoleManager || !user.IsActive {
+			t.Errorf("provisioned %+v, want an active manager named from the token", user)
+		}
+		if stored, err := f.users.GetByEmail(context.Background(), "ana@example.com"); err != nil || stored.ID != user.ID {
+			t.Errorf("stored user = %v, %v", stored, err)
+		}
+	})
+	t.Run("invalid default role", func(t *testing.T) {
+		f := newSSOFixture(t)
+		allow, role := true, "superuser"
+		f.updateSettings(t, &models.UpdateSystemSecuritySettingsRequest{AllowJITProvisioning: &allow, JITDefaultRole: &role})
+		user, err := f.signIn(t, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != models.UserRoleSalesRep {
+			t.Errorf("provisioned role = %s, want sales_rep", user.Role)
+		}
+	})
+	t.Run("inactive user", func(t *testing.T) {
+		f := newSSOFixture(t)
+		f.addUser(false)
+		if _, err := f.signIn(t, nil); !errors.Is(err, ErrSSOAccountInactive) {
+			t.Errorf("Complete = %v, want ErrSSOAccountInactive", err)
+		}
+	})
+}
+
+func TestSSODisabled(t *testing.T) {
+	f := newSSOFixture(t)
+	disabled := false
+	f.updateSettings(t, &models.UpdateSystemSecuritySettingsRequest{SSOEnabled: &disabled})
+	if _, err := f.sso.Start(context.Background()); !errors.Is(err, ErrSSODisabled) {
+		t.Errorf("Start = %v, want ErrSSODisabled", err)
+	}
+	if _, err := f.sso.Complete(context.Background(), "code", "state"); !errors.Is(err, ErrSSODisabled) {
+		t.Errorf("Complete = %v, want ErrSSODisabled", err)
+	}
+}
+
+func TestSSOPasswordLoginPolicy(t *testing.T) {
+	f := newSSOFixture(t)
+	ctx := context.Background()
+	rep := &models.User{Role: models.UserRoleSalesRep}
+	admin := &models.User{Role: models.UserRoleAdmin}
+
+	if err := f.sso.PasswordLoginPolicy(ctx, rep); err != nil {
+		t.Errorf("password sign-in allowed = %v, want nil", err)
+	}
+	disabled := true
+	f.updateSettings(t, &models.UpdateSystemSecuritySettingsRequest{PasswordLoginDisabled: &disabled})
+	if err := f.sso.PasswordLoginPolicy(ctx, rep); !errors.Is(err, ErrPasswordLoginDisabled) {
+		t.Errorf("sales rep = %v, want ErrPasswordLoginDisabled", err)
+	}
+	if err := f.sso.PasswordLoginPolicy(ctx, admin); err != nil {
+		t.Errorf("admin = %v, want password sign-in kept", err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/emailtemplates"
+	"github.com/white/user-management/internal/i18n"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// SystemEmailOverrides looks up the templates overriding system emails
+type SystemEmailOverrides interface {
+	GetSystemEmailOverride(ctx context.Context, key string, publishedOnly bool) (*models.MongoTemplate, error)
+}
+
+// SystemEmails renders the emails the platform sends on its own, such as
+// sign-in codes and invitations, and addresses them from the configured
+// sender. A published override in the templates collection replaces the
+// embedded default of an email; an override that cannot be loaded or
+// rendered completely is skipped so the email still goes out.
+//
+// Defaults are rendered in the language of the translator carried by the
+// context (see i18n.WithPreference), English without one. Overrides are
+// single-language and used whatever the recipient's language.
+type SystemEmails struct {
+	overrides   SystemEmailOverrides // nil always uses the embedded defaults
+	branding    *EmailBranding       // nil uses the default branding
+	fromAddress string
+	fromName    string
+}
+
+// NewSystemEmails creates a SystemEmails sending from fromAddress and
+// fromName. overrides may be nil.
+func NewSystemEmails(overrides SystemEmailOverrides, fromAddress, fromName string) *SystemEmails {
+	return &SystemEmails{overrides: overrides, fromAddress: fromAddress, fromName: fromName}
+}
+
+// SetBranding makes the emails use the organisation's branding
+func (s *SystemEmails) SetBranding(branding *EmailBranding) {
+	s.branding = branding
+}
+
+// Render renders the email data is for, from its published override when
+// there is one that renders completely and from the embedded default
+// otherwise, in the organisation's branding and the language of ctx
+func (s *SystemEmails) Render(ctx context.Context, data emailtemplates.Data) (*emailtemplates.Email, error) {
+	brand := s.branding.Get(ctx)
+	if s.overrides != nil {
+		override, err := s.overrides.GetSystemEmailOverride(ctx, data.Key(), true)
+		switch {
+		case err == nil:
+			email, _, err := RenderSystemEmailOverride(override, emailtemplates.Variables(data, brand))
+			if err == nil {
+				return email, nil
+			}
+			log.Printf("Warning: system email override %s (%s) not used: %v", override.ID, data.Key(), err)
+		case !repositories.IsNotFound(err):
+			log.Printf("Warning: failed to load override of system email %s: %v", data.Key(), err)
+		}
+	}
+	return emailtemplates.Render(data, brand, i18n.FromContext(ctx))
+}
+
+// Compose renders the email data is for into a queued message to to, from
+// the configured sender
+func (s *SystemEmails) Compose(ctx context.Context, to string, data emailtemplates.Data) (*models.CommMessage, error) {
+	email, err := s.Render(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &models.CommMessage{
+		MessageID:   uuid.MustNewUUID(),
+		Channel:     models.ChannelEmail,
+		Direction:   models.DirectionOutbound,
+		Status:      models.MessageStatusQueued,
+		FromAddress: s.fromAddress,
+		FromName:    s.fromName,
+		ToAddresses: []string{to},
+		Subject:     email.Subject,
+		BodyHTML:    email.HTML,
+		BodyText:    email.Text,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// RenderSystemEmailOverride renders an override template with the template
+// preview machinery, so its merge tags behave exactly as in a preview. It
+// returns the preview alongside the email, and fails when the override has
+// no subject or HTML body or leaves merge tags without a value, since
+// sending those would show raw {{tags}} to the recipient.
+func RenderSystemEmailOverride(t *models.MongoTemplate, variables map[string]string) (*emailtemplates.Email, *models.TemplatePreviewResponse, error) {
+	vars := make(map[string]models.PreviewVariable, len(variables))
+	for key, value := range variables {
+		vars[key] = models.PreviewVariable{Value: value}
+	}
+
+	preview, err := RenderTemplatePreview(t, string(models.TemplateChannelEmail), vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(preview.MissingTags) > 0 {
+		return nil, preview, fmt.Errorf("unknown merge tags: %s", strings.Join(preview.MissingTags, ", "))
+	}
+	if strings.TrimSpace(preview.Subject) == "" || strings.TrimSpace(preview.Body) == "" {
+		return nil, preview, errors.New("subject and HTML body are required")
+	}
+	return &emailtemplates.Email{
+		Subject: preview.Subject,
+		HTML:    preview.Body,
+		Text:    preview.BodyText,
+	}, preview, nil
+}
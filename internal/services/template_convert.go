@@ -0,0 +1,354 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/white/user-management/internal/models"
+	xhtml "golang.org/x/net/html"
+)
+
+var (
+	// ErrConversionTarget is returned when a template cannot be converted
+	// to the requested channel
+	ErrConversionTarget = errors.New("templates cannot be converted to this channel")
+
+	// ErrConversionSameChannel is returned when a template is converted to
+	// the channel it is already on
+	ErrConversionSameChannel = errors.New("template is already on this channel")
+)
+
+// conversionEllipsis ends content cut to fit a channel
+const conversionEllipsis = "…"
+
+// htmlSpacePattern matches a run of white space, which HTML shows as one space
+var htmlSpacePattern = regexp.MustCompile(`\s+`)
+
+// templateChannelAdapter says how content is adapted to a channel it is
+// converted to
+type templateChannelAdapter struct {
+	label     string // Appended to the name of converted templates
+	bodyLimit int    // Characters the body is cut to
+	limitName string // What bodyLimit is, for the truncation warning
+
+	// finish sets the channel-specific fields of the converted template,
+	// returning warnings for what is left to the user; nil when there are none
+	finish func(t *models.MongoTemplate) []string
+}
+
+// templateChannelAdapters are the channels templates can be converted to.
+// Email is not one: a subject cannot be made up from a message.
+var templateChannelAdapters = map[string]templateChannelAdapter{
+	string(models.TemplateChannelSMS): {
+		label:     "SMS",
+		bodyLimit: models.SMSSegmentLength,
+		limitName: "one SMS segment",
+	},
+	string(models.TemplateChannelWhatsApp): {
+		label:     "WhatsApp",
+		bodyLimit: models.WhatsAppBodyMaxLength,
+		limitName: "the WhatsApp body limit",
+		finish: func(t *models.MongoTemplate) []string {
+			return []string{"metaTemplateName is blank: set it to the name approved by Meta before publishing"}
+		},
+	},
+	string(models.TemplateChannelLinkedIn): {
+		label:     "LinkedIn",
+		bodyLimit: models.LinkedInInMailMaxLength,
+		limitName: "the LinkedIn InMail limit",
+		finish: func(t *models.MongoTemplate) []string {
+			t.TemplateType = "InMail Message"
+			return []string{fmt.Sprintf("converted as an InMail message; connection requests are limited to %d characters", models.LinkedInConnectionMaxLength)}
+		},
+	},
+}
+
+// TemplateConversionTargets lists the channels templates can be converted to
+func TemplateConversionTargets() []string {
+	targets := make([]string, 0, len(templateChannelAdapters))
+	for channel := range templateChannelAdapters {
+		targets = append(targets, channel)
+	}
+	slices.Sort(targets)
+	return targets
+}
+
+// templateBodyFields are the content fields a conversion reads the body
+// from and replaces; any other content field of the source is dropped
+var templateBodyFields = map[string]bool{
+	"subject":       true,
+	"body":          true,
+	"body_html":     true,
+	"body_text":     true,
+	"segment_count": true,
+}
+
+// ConvertTemplate returns source adapted to the target channel as a new
+// draft, without an ID, owner or timestamps, named after the source and
+// the channel. The body becomes plain text cut to the channel's limit;
+// merge tags, custom fields, tags and the filter fields are carried over,
+// and fields the target has no use for are dropped. The warnings say what
+// was changed. The result is not validated.
+func ConvertTemplate(source *models.MongoTemplate, target string) (*models.MongoTemplate, []string, error) {
+	adapter, ok := templateChannelAdapters[target]
+	if !ok {
+		return nil, nil, ErrConversionTarget
+	}
+	if source.Channel == target {
+		return nil, nil, ErrConversionSameChannel
+	}
+
+	warnings := []string{}
+	body, truncated := truncateTemplateText(conversionSourceText(source), adapter.bodyLimit)
+	if truncated {
+		warnings = append(warnings, fmt.Sprintf("content truncated to %d characters, %s", adapter.bodyLimit, adapter.limitName))
+	}
+
+	subject := source.Subject
+	if subject == "" {
+		subject = source.Content["subject"]
+	}
+	if subject != "" {
+		warnings = append(warnings, "subject discarded: "+adapter.label+" templates have no subject")
+	}
+	dropped := make([]string, 0)
+	for field, value := range source.Content {
+		if !templateBodyFields[field] && value != "" {
+			dropped = append(dropped, field)
+		}
+	}
+	slices.Sort(dropped)
+	for _, field := range dropped {
+		warnings = append(warnings, field+" discarded: "+adapter.label+" templates have no "+field)
+	}
+	if len(source.KoshDocumentIds) > 0 {
+		warnings = append(warnings, fmt.Sprintf("attached documents dropped (%d): only email templates carry attachments", len(source.KoshDocumentIds)))
+	}
+
+	converted := &models.MongoTemplate{
+		Name:         source.Name + " (" + adapter.label + ")",
+		Description:  source.Description,
+		Channel:      target,
+		Status:       string(models.TemplateStatusDraft),
+		Content:      map[string]string{"body": body},
+		Body:         body,
+		CustomFields: copyStringMap(source.CustomFields),
+		Category:     source.Category,
+		Tags:         slices.Clone(source.Tags),
+		Version:      1,
+
+		ForStage:     slices.Clone(source.ForStage),
+		Industries:   slices.Clone(source.Industries),
+		ApprovalFlag: source.ApprovalFlag,
+		AiEnhanced:   source.AiEnhanced,
+		ServiceID:    source.ServiceID,
+	}
+	converted.Variables = converted.ExtractMergeTags()
+	slices.Sort(converted.Variables)
+
+	kept := make(map[string]bool, len(converted.Variables))
+	for _, tag := range converted.Variables {
+		kept[tag] = true
+		if variable, ok := source.Variable(tag); ok {
+			converted.VariablesSchema = append(converted.VariablesSchema, *variable)
+		}
+	}
+	converted.SyncVariablesSchema()
+	lost := make([]string, 0)
+	for _, tag := range source.ExtractMergeTags() {
+		if !kept[tag] {
+			lost = append(lost, tag)
+		}
+	}
+	slices.Sort(lost)
+	for _, tag := range lost {
+		warnings = append(warnings, "merge tag {{"+tag+"}} dropped with the content cut or discarded")
+	}
+	if len(converted.Variables) > 0 || len(lost) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d merge tags kept", len(converted.Variables)))
+	}
+
+	if adapter.finish != nil {
+		warnings = append(warnings, adapter.finish(converted)...)
+	}
+	return converted, warnings, nil
+}
+
+// copyStringMap returns a copy of m, nil for nil
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// conversionSourceText returns the body of t as plain text. Email bodies
+// are converted from their HTML, or taken from body_text without one.
+func conversionSourceText(t *models.MongoTemplate) string {
+	if t.Channel != string(models.TemplateChannelEmail) {
+		body := t.Content["body"]
+		if body == "" {
+			body = t.Body
+		}
+		return strings.TrimSpace(body)
+	}
+	body := t.Content["body_html"]
+	if body == "" {
+		body = t.Body
+	}
+	if body == "" {
+		return strings.TrimSpace(t.Content["body_text"])
+	}
+	return TemplateHTMLText(body)
+}
+
+// truncateTemplateText cuts text to at most limit characters, ending it
+// with an ellipsis. A merge tag is never cut in half: the cut moves before
+// it. It reports whether the text was cut.
+func truncateTemplateText(text string, limit int) (string, bool) {
+	if utf8.RuneCountInString(text) <= limit {
+		return text, false
+	}
+	runes := []rune(text)
+	cut := string(runes[:limit-utf8.RuneCountInString(conversionEllipsis)])
+	if open := strings.LastIndex(cut, "{{"); open >= 0 && !strings.Contains(cut[open:], "}}") {
+		cut = cut[:open]
+	}
+	return strings.TrimRight(cut, " \t\n") + conversionEllipsis, true
+}
+
+// TemplateHTMLText returns the text of an HTML body as a plain-text
+// message: paragraphs and headings are separated by a blank line, list
+// items start lines with "- " or their number and links are followed by
+// their URL in brackets. Scripts, styles and the head are left out.
+func TemplateHTMLText(body string) string {
+	var (
+		out      strings.Builder
+		lists    []int // Items written of each open list; -1 for unordered lists
+		linkHref string
+		linkAt   int  // Where the text of the open link starts in out
+		skip     int  // Depth inside elements whose text is not shown
+		inLink   bool // Whether a link is open
+	)
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := tokenizer.Next()
+		if tt == xhtml.ErrorToken {
+			return plainTextLines(out.String())
+		}
+		token := tokenizer.Token()
+		switch tt {
+		case xhtml.TextToken:
+			if skip == 0 {
+				out.WriteString(htmlSpacePattern.ReplaceAllString(token.Data, " "))
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			switch token.Data {
+			case "script", "style", "head", "title":
+				if tt == xhtml.StartTagToken {
+					skip++
+				}
+			case "br", "tr":
+				out.WriteString("\n")
+			case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "blockquote", "hr":
+				out.WriteString("\n\n")
+			case "ul":
+				lists = append(lists, -1)
+				out.WriteString("\n")
+			case "ol":
+				lists = append(lists, 0)
+				out.WriteString("\n")
+			case "li":
+				out.WriteString("\n")
+				if n := len(lists); n > 0 && lists[n-1] >= 0 {
+					lists[n-1]++
+					fmt.Fprintf(&out, "%d. ", lists[n-1])
+				} else {
+					out.WriteString("- ")
+				}
+			case "td", "th":
+				out.WriteString(" ")
+			case "img":
+				if alt := htmlAttr(token, "alt"); alt != "" {
+					out.WriteString(" " + alt + " ")
+				}
+			case "a":
+				inLink = tt == xhtml.StartTagToken
+				linkHref = strings.TrimSpace(htmlAttr(token, "href"))
+				linkAt = out.Len()
+			}
+		case xhtml.EndTagToken:
+			switch token.Data {
+			case "script", "style", "head", "title":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "blockquote":
+				out.WriteString("\n\n")
+			case "ul", "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+				out.WriteString("\n")
+			case "td", "th":
+				out.WriteString(" ")
+			case "a":
+				if inLink {
+					writeLinkTarget(&out, out.String()[linkAt:], linkHref)
+				}
+				inLink = false
+			}
+		}
+	}
+}
+
+// writeLinkTarget writes the URL a link goes to after its text, unless the
+// text already says it or the link goes nowhere
+func writeLinkTarget(out *strings.Builder, text, href string) {
+	href = strings.TrimPrefix(href, "mailto:")
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+	text = strings.TrimSpace(text)
+	if text == href {
+		return
+	}
+	if text == "" {
+		out.WriteString(href)
+		return
+	}
+	out.WriteString(" (" + href + ")")
+}
+
+// htmlAttr returns the value of the named attribute of token
+func htmlAttr(token xhtml.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// plainTextLines tidies converted text: spaces are collapsed within lines
+// and runs of blank lines become one
+func plainTextLines(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" && (len(kept) == 0 || kept[len(kept)-1] == "") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
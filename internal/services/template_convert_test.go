@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/white/user-management/internal/models"
+)
+
+func TestTemplateHTMLText(t *testing.T) {
+	for _, tt := range []struct{ name, html, want string }{
+		{"paragraphs", `<h1>Hello</h1><p>First   line<br>second line</p><p>Next</p>`, "Hello\n\nFirst line\nsecond line\n\nNext"},
+		{"unordered list", `<p>Includes:</p><ul><li>Setup</li><li>Training</li></ul>`, "Includes:\n\n- Setup\n- Training"},
+		{"ordered list", `<ol><li>Sign</li><li>Pay</li><li>Start</li></ol>`, "1. Sign\n2. Pay\n3. Start"},
+		{"nested lists", `<ol><li>Plans<ul><li>Basic</li><li>Pro</li></ul></li><li>Support</li></ol>`, "1. Plans\n\n- Basic\n- Pro\n\n2. Support"},
+		{"link", `<p>Read <a href="https://example.com/terms">our terms</a>.</p>`, "Read our terms (https://example.com/terms)."},
+		{"link showing its URL", `<a href="https://example.com">https://example.com</a>`, "https://example.com"},
+		{"mailto link", `<a href="mailto:sales@example.com">sales@example.com</a>`, "sales@example.com"},
+		{"image link", `<a href="https://example.com/demo"><img src="x.png"></a>`, "https://example.com/demo"},
+		{"links going nowhere", `<a href="#top">Top</a> <a href="javascript:void(0)">Open</a>`, "Top Open"},
+		{"hidden content", `<html><head><title>T</title><style>p{color:red}</style></head><body><script>track()</script><p>Hi {{first_name}}</p></body></html>`, "Hi {{first_name}}"},
+		{"table and image", `<table><tr><td>Plan</td><td>Pro</td></tr><tr><td>Price</td><td>$10</td></tr></table><img src="logo.png" alt="Acme">`, "Plan Pro\nPrice $10\n\nAcme"},
+		{"entities", `<p>Tom &amp; Jerry&nbsp;&lt;3</p>`, "Tom & Jerry <3"},
+	} {
+		if got := TemplateHTMLText(tt.html); got != tt.want {
+			t.Errorf("%s: TemplateHTMLText = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateTemplateText(t *testing.T) {
+	if got, cut := truncateTemplateText("short", 10); got != "short" || cut {
+		t.Errorf("text under the limit = %q, %v", got, cut)
+	}
+	got, cut := truncateTemplateText("Hello there, general", 10)
+	if !cut || got != "Hello the…" || utf8.RuneCountInString(got) != 10 {
+		t.Errorf("cut text = %q, %v; want 10 characters ending in an ellipsis", got, cut)
+	}
+	// Characters, not bytes, are counted
+	if got, cut := truncateTemplateText(strings.Repeat("é", 10), 10); got != strings.Repeat("é", 10) || cut {
+		t.Errorf("10 accented characters = %q, %v; want them kept", got, cut)
+	}
+	// A merge tag is never cut in half
+	if got, _ := truncateTemplateText("Hi {{first_name}}, welcome", 12); got != "Hi…" {
+		t.Errorf("cut through a merge tag = %q, want it cut before the tag", got)
+	}
+}
+
+// welcomeEmail returns an email template with an HTML body, a subject
+// and a merge tag in each
+func welcomeEmail(body string) *models.MongoTemplate {
+	return &models.MongoTemplate{
+		ID:       "t1",
+		TenantID: "acme",
+		Name:     "Welcome",
+		Channel:  string(models.TemplateChannelEmail),
+		Status:   string(models.TemplateStatusPublished),
+		Subject:  "Hello {{first_name}}",
+		Body:     body,
+		Content: map[string]string{
+			"subject":   "Hello {{first_name}}",
+			"body_html": body,
+			"preheader": "Your account is ready",
+		},
+		Tags:            []string{"onboarding"},
+		Category:        "welcome",
+		KoshDocumentIds: []string{"doc-1"},
+		VariablesSchema: []models.TemplateVariable{{Name: "first_name", Type: models.TemplateVariableString, Default: "there"}},
+	}
+}
+
+func TestConvertTemplateToSMS(t *testing.T) {
+	source := welcomeEmail(`<p>Hi {{first_name}},</p><ul><li>Log in at <a href="https://app.example.com">the app</a></li><li>Invite your team</li></ul>`)
+	converted, warnings, err := ConvertTemplate(source, "sms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBody := "Hi {{first_name}},\n\n- Log in at the app (https://app.example.com)\n- Invite your team"
+	if converted.Body != wantBody || converted.Content["body"] != wantBody || len(converted.Content) != 1 {
+		t.Errorf("body = %q, content %v; want %q only", converted.Body, converted.Content, wantBody)
+	}
+	if converted.Name != "Welcome (SMS)" || converted.Channel != "sms" || converted.Status != string(models.TemplateStatusDraft) || converted.ID != "" || converted.Subject != "" {
+		t.Errorf("converted = %+v, want an unsaved SMS draft named after the source", converted)
+	}
+	if !slices.Equal(converted.Tags, source.Tags) || converted.Category != "welcome" || len(converted.KoshDocumentIds) != 0 {
+		t.Errorf("tags %v, category %q, documents %v; want the tags and category carried, documents dropped", converted.Tags, converted.Category, converted.KoshDocumentIds)
+	}
+	if !slices.Equal(converted.Variables, []string{"first_name"}) || len(converted.VariablesSchema) != 1 || converted.VariablesSchema[0] != source.VariablesSchema[0] {
+		t.Errorf("variables = %v %+v, want first_name with its schema", converted.Variables, converted.VariablesSchema)
+	}
+	want := []string{
+		"subject discarded: SMS templates have no subject",
+		"preheader discarded: SMS templates have no preheader",
+		"attached documents dropped (1): only email templates carry attachments",
+		"1 merge tags kept",
+	}
+	if !slices.Equal(warnings, want) {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+	if err := converted.Validate(); err != nil {
+		t.Errorf("converted template is not valid: %v", err)
+	}
+	// The source is left alone
+	if source.Channel != "email" || len(source.Tags) != 1 || source.Content["preheader"] == "" {
+		t.Errorf("source changed: %+v", source)
+	}
+}
+
+func TestConvertTemplateTruncatesToTheChannelLimit(t *testing.T) {
+	source := welcomeEmail("<p>" + strings.Repeat("Our product saves you time. ", 20) + "Reply to {{sender_name}}</p>")
+	converted, warnings, err := ConvertTemplate(source, "sms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := utf8.RuneCountInString(converted.Body); n > models.SMSSegmentLength || !strings.HasSuffix(converted.Body, "…") {
+		t.Errorf("body of %d characters = %q, want at most %d ending in an ellipsis", n, converted.Body, models.SMSSegmentLength)
+	}
+	for _, want := range []string{
+		"content truncated to 160 characters, one SMS segment",
+		"merge tag {{sender_name}} dropped with the content cut or discarded",
+		"0 merge tags kept",
+	} {
+		if !slices.Contains(warnings, want) {
+			t.Errorf("warnings = %q, want %q among them", warnings, want)
+		}
+	}
+	if err := converted.Validate(); err != nil {
+		t.Errorf("converted template is not valid: %v", err)
+	}
+
+	// The same content fits a WhatsApp body
+	whatsapp, warnings, err := ConvertTemplate(source, "whatsapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasSuffix(whatsapp.Body, "…") || slices.ContainsFunc(warnings, func(w string) bool { return strings.HasPrefix(w, "content truncated") }) {
+		t.Errorf("WhatsApp body was cut: %q", warnings)
+	}
+}
+
+func TestConvertTemplateChannelAdapters(t *testing.T) {
+	source := welcomeEmail("<p>Hi {{first_name}}</p>")
+
+	whatsapp, warnings, err := ConvertTemplate(source, "whatsapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if whatsapp.MetaTemplateName != "" || whatsapp.Name != "Welcome (WhatsApp)" {
+		t.Errorf("WhatsApp draft = %+v, want metaTemplateName left blank", whatsapp)
+	}
+	if last := warnings[len(warnings)-1]; !strings.HasPrefix(last, "metaTemplateName is blank") {
+		t.Errorf("last WhatsApp warning = %q, want the metaTemplateName reminder", last)
+	}
+	if err := whatsapp.Validate(); err != nil {
+		t.Errorf("WhatsApp draft is not valid: %v", err)
+	}
+
+	linkedin, _, err := ConvertTemplate(source, "linkedin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkedin.TemplateType != "InMail Message" || linkedin.Name != "Welcome (LinkedIn)" {
+		t.Errorf("LinkedIn draft = %+v, want an InMail message", linkedin)
+	}
+
+	// An SMS converts too, without HTML to strip
+	sms := &models.MongoTemplate{Name: "Reminder", Channel: "sms", Content: map[string]string{"body": "  See you {{day}}  "}}
+	converted, warnings, err := ConvertTemplate(sms, "whatsapp")
+	if err != nil || converted.Body != "See you {{day}}" {
+		t.Errorf("SMS to WhatsApp = %q, %v", converted.Body, err)
+	}
+	if !slices.Contains(warnings, "1 merge tags kept") {
+		t.Errorf("warnings = %q, want the merge tag counted", warnings)
+	}
+
+	if _, _, err := ConvertTemplate(source, "email"); !errors.Is(err, ErrConversionTarget) {
+		t.Errorf("convert to email = %v, want ErrConversionTarget", err)
+	}
+	if _, _, err := ConvertTemplate(source, "fax"); !errors.Is(err, ErrConversionTarget) {
+		t.Errorf("convert to fax = %v, want ErrConversionTarget", err)
+	}
+	if _, _, err := ConvertTemplate(sms, "sms"); !errors.Is(err, ErrConversionSameChannel) {
+		t.Errorf("convert an SMS to SMS = %v, want ErrConversionSameChannel", err)
+	}
+	if targets := TemplateConversionTargets(); !slices.Equal(targets, []string{"linkedin", "sms", "whatsapp"}) {
+		t.Errorf("targets = %v", targets)
+	}
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/white/user-management/internal/models"
+)
+
+const (
+	// TemplateLinkTimeout bounds the check of one link, redirects included
+	TemplateLinkTimeout = 5 * time.Second
+
+	// templateLinkConcurrency is how many links of a template are checked at once
+	templateLinkConcurrency = 8
+
+	// templateMaxLinks is the most distinct URLs checked per template; the
+	// rest are reported as unchecked
+	templateMaxLinks = 50
+
+	// templateLinkMaxRedirects is how many redirects a link may follow
+	templateLinkMaxRedirects = 5
+
+	// imageTextEquivalent is how many characters of text one image is
+	// weighed as when computing the text-to-image ratio
+	imageTextEquivalent = 200
+
+	// minTextToImageRatio is the share of text below which a body is
+	// likely to be filtered as spam
+	minTextToImageRatio = 0.6
+
+	// imageOnlyTextChars is the text below which a body with images counts
+	// as image-only
+	imageOnlyTextChars = 50
+)
+
+// ErrPrivateAddress is returned when a link resolves, or redirects, to a
+// loopback, private, link-local or otherwise internal address
+var ErrPrivateAddress = errors.New("address is not public")
+
+var (
+	// lintTagPattern matches an HTML start tag
+	lintTagPattern = regexp.MustCompile(`(?is)<([a-z][a-z0-9:]*)\b[^>]*>`)
+	// lintURLAttrPattern matches href and src attributes, quoted or not
+	lintURLAttrPattern = regexp.MustCompile(`(?is)\s(href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	// lintAltAttrPattern matches an alt attribute, even an empty one
+	lintAltAttrPattern = regexp.MustCompile(`(?is)\salt\s*(=|\s|/?>)`)
+	// lintInvisiblePattern matches elements whose content is never shown
+	lintInvisiblePattern = regexp.MustCompile(`(?is)<(style|script|head)\b.*?</(style|script|head)\s*>`)
+	// lintAnyTagPattern matches any tag or comment, to strip them from text
+	lintAnyTagPattern = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+)
+
+// cgnatRange is the carrier-grade NAT range, which net.IP.IsPrivate leaves out
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// TemplateLintOptions selects the checks a lint runs
+type TemplateLintOptions struct {
+	CheckLinks         bool // Request every http(s) URL; slower, but finds dead links
+	RequireUnsubscribe bool // Email templates must contain the unsubscribe placeholder
+}
+
+// TemplateLinter finds problems in templates that make emails fail or land
+// in spam: dead links, images without alt text, image-heavy bodies, missing
+// plain-text alternatives, unresolved merge tags and missing unsubscribe
+// links
+type TemplateLinter struct {
+	client *http.Client
+}
+
+// NewTemplateLinter creates a TemplateLinter checking each link for at most
+// timeout. Links are never followed to internal addresses.
+func NewTemplateLinter(timeout time.Duration) *TemplateLinter {
+	return newTemplateLinter(timeout, isInternalAddress)
+}
+
+// newTemplateLinter creates a TemplateLinter refusing to connect to the
+// addresses, as host:port, isInternal reports
+func newTemplateLinter(timeout time.Duration, isInternal func(address string) bool) *TemplateLinter {
+	dialer := &net.Dialer{Timeout: timeout, Control: denyAddresses(isInternal)}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the link's host, bypassing the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &TemplateLinter{client: &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= templateLinkMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", templateLinkMaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirects to a %s URL", req.URL.Scheme)
+			}
+			return nil
+		},
+	}}
+}
+
+// denyAddresses returns a dialer control refusing connections to the
+// addresses isInternal reports. It runs after name resolution for every
+// connection, redirects included, so a public name resolving to an internal
+// address is refused too.
+func denyAddresses(isInternal func(address string) bool) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		if isInternal(address) {
+			host, _, _ := net.SplitHostPort(address)
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+		return nil
+	}
+}
+
+// isInternalAddress reports whether a dialed host:port is not a public IP
+// address
+func isInternalAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || isPrivateAddress(ip)
+}
+
+// isPrivateAddress reports whether ip is not reachable on the public internet
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || cgnatRange.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0)
+}
+
+// Lint checks a template and reports what it finds. Nothing in the report
+// stops the template from being saved.
+func (l *TemplateLinter) Lint(ctx context.Context, t *models.MongoTemplate, opts TemplateLintOptions) *models.TemplateLintReport {
+	report := &models.TemplateLintReport{Findings: []models.LintFinding{}}
+	fields := lintFields(t)
+
+	lintMergeTags(report, t, fields)
+
+	if t.Channel != string(models.TemplateChannelEmail) {
+		return report
+	}
+	body := fields["body_html"]
+	if body != "" && strings.TrimSpace(fields["body_text"]) == "" {
+		report.Add(models.LintSeverityWarning, models.LintRuleMissingPlainText,
+			"HTML email has no plain-text alternative; add body_text", "body_text")
+	}
+	if opts.RequireUnsubscribe && !containsMergeTag(fields, models.UnsubscribeMergeTag) {
+		report.Add(models.LintSeverityError, models.LintRuleMissingUnsubscribe,
+			"Email must contain the {{"+models.UnsubscribeMergeTag+"}} placeholder", "body_html")
+	}
+	if body == "" {
+		return report
+	}
+
+	lintImages(report, body)
+	links := lintLinks(report, body)
+	if opts.CheckLinks {
+		l.checkLinks(ctx, report, links)
+	}
+	return report
+}
+
+// lintFields returns the content fields of a template with the legacy
+// subject and body fields filled in where the content lacks them
+func lintFields(t *models.MongoTemplate) map[string]string {
+	fields := make(map[string]string, len(t.Content)+2)
+	for name, value := range t.Content {
+		fields[name] = value
+	}
+	if fields["subject"] == "" && t.Subject != "" {
+		fields["subject"] = t.Subject
+	}
+	if t.Body != "" && fields["body_html"] == "" && fields["body"] == "" && fields["body_text"] == "" {
+		if t.Channel == string(models.TemplateChannelEmail) {
+			fields["body_html"] = t.Body
+		} else {
+			fields["body"] = t.Body
+		}
+	}
+	return fields
+}
+
+// lintMergeTags reports merge tags that are neither standard tags, custom
+// fields of the template nor variables it declares required or with a
+// default, once per field
+func lintMergeTags(report *models.TemplateLintReport, t *models.MongoTemplate, fields map[string]string) {
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		value := fields[name]
+		seen := make(map[string]bool)
+		for _, match := range mergeTagPattern.FindAllStringSubmatchIndex(value, -1) {
+			tag := strings.TrimSpace(value[match[2]:match[3]])
+			if tag == "" || seen[tag] || slices.Contains(models.StandardMergeTags, tag) {
+				continue
+			}
+			if _, ok := t.CustomFields[tag]; ok {
+				continue
+			}
+			if variable, ok := t.Variable(tag); ok && variable.Guaranteed() {
+				continue
+			}
+			seen[tag] = true
+			report.Add(models.LintSeverityError, models.LintRuleUnresolvedMergeTag,
+				fmt.Sprintf("Merge tag {{%s}} is not a standard tag, custom field, or required variable or one with a default", tag), lintLocation(name, value, match[0]))
+		}
+	}
+}
+
+// containsMergeTag reports whether any field contains the merge tag
+func containsMergeTag(fields map[string]string, tag string) bool {
+	for _, value := range fields {
+		for _, match := range mergeTagPattern.FindAllStringSubmatch(value, -1) {
+			if strings.TrimSpace(match[1]) == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lintImages reports images without alt text and bodies where images
+// outweigh the text
+func lintImages(report *models.TemplateLintReport, body string) {
+	images := 0
+	for _, match := range lintTagPattern.FindAllStringSubmatchIndex(body, -1) {
+		if !strings.EqualFold(body[match[2]:match[3]], "img") {
+			continue
+		}
+		images++
+		tag := body[match[0]:match[1]]
+		if !lintAltAttrPattern.MatchString(tag) {
+			report.Add(models.LintSeverityWarning, models.LintRuleMissingAlt,
+				"Image has no alt text: "+abbreviate(tag, 120), lintLocation("body_html", body, match[0]))
+		}
+	}
+	if images == 0 {
+		return
+	}
+
+	text := lintInvisiblePattern.ReplaceAllString(body, " ")
+	text = html.UnescapeString(lintAnyTagPattern.ReplaceAllString(text, " "))
+	chars := utf8.RuneCountInString(strings.Join(strings.Fields(text), " "))
+	ratio := float64(chars) / float64(chars+images*imageTextEquivalent)
+	ratio = float64(int(ratio*100+0.5)) / 100
+	report.TextToImageRatio = &ratio
+
+	switch {
+	case chars < imageOnlyTextChars:
+		report.Add(models.LintSeverityError, models.LintRuleImageOnly,
+			fmt.Sprintf("Body is %d images with only %d characters of text; image-only emails are usually filtered as spam", images, chars), "body_html")
+	case ratio < minTextToImageRatio:
+		report.Add(models.LintSeverityWarning, models.LintRuleLowTextRatio,
+			fmt.Sprintf("Text is about %.0f%% of the body; keep it above %.0f%% to avoid spam filters", ratio*100, minTextToImageRatio*100), "body_html")
+	}
+}
+
+// lintLink is a URL found in a body and where it was first found
+type lintLink struct {
+	url      string
+	location string
+}
+
+// lintLinks collects the distinct http(s) URLs of href and src attributes,
+// reporting those that cannot work in an email or cannot be checked
+func lintLinks(report *models.TemplateLintReport, body string) []lintLink {
+	var links []lintLink
+	seen := make(map[string]bool)
+	for _, tag := range lintTagPattern.FindAllStringIndex(body, -1) {
+		for _, attr := range lintURLAttrPattern.FindAllStringSubmatchIndex(body[tag[0]:tag[1]], -1) {
+			raw := ""
+			for group := 2; group <= 4; group++ {
+				if start := attr[2*group]; start >= 0 {
+					raw = body[tag[0]+start : tag[0]+attr[2*group+1]]
+					break
+				}
+			}
+			raw = strings.TrimSpace(html.UnescapeString(raw))
+			location := lintLocation("body_html", body, tag[0]+attr[0])
+			if raw == "" || seen[raw] {
+				continue
+			}
+			seen[raw] = true
+
+			lower := strings.ToLower(raw)
+			switch {
+			case strings.HasPrefix(raw, "#"), strings.HasPrefix(lower, "mailto:"), strings.HasPrefix(lower, "tel:"),
+				strings.HasPrefix(lower, "sms:"), strings.HasPrefix(lower, "cid:"), strings.HasPrefix(lower, "data:"):
+				continue
+			case strings.Contains(raw, "{{"):
+				// Filled in per recipient; a link that is only a merge tag needs no mention
+				if match := mergeTagPattern.FindString(raw); match != raw {
+					report.Add(models.LintSeverityInfo, models.LintRuleUncheckedLink,
+						"URL contains merge tags and can only be checked once sent: "+abbreviate(raw, 200), location)
+				}
+				continue
+			}
+
+			u, err := url.Parse(raw)
+			switch {
+			case err != nil:
+				report.Add(models.LintSeverityError, models.LintRuleBrokenLink, "Invalid URL: "+abbreviate(raw, 200), location)
+			case u.Scheme == "":
+				report.Add(models.LintSeverityError, models.LintRuleBrokenLink,
+					"Relative URL does not work in an email; use an absolute https URL: "+abbreviate(raw, 200), location)
+			case u.Scheme != "http" && u.Scheme != "https":
+				report.Add(models.LintSeverityError, models.LintRuleBrokenLink,
+					fmt.Sprintf("%s URLs are not allowed: %s", u.Scheme, abbreviate(raw, 200)), location)
+			case u.Host == "":
+				report.Add(models.LintSeverityError, models.LintRuleBrokenLink, "URL has no host: "+abbreviate(raw, 200), location)
+			case len(links) >= templateMaxLinks:
+				report.Add(models.LintSeverityInfo, models.LintRuleUncheckedLink,
+					fmt.Sprintf("Not checked, only the first %d URLs are: %s", templateMaxLinks, abbreviate(raw, 200)), location)
+			default:
+				links = append(links, lintLink{url: raw, location: location})
+			}
+		}
+	}
+	return links
+}
+
+// checkLinks requests every link, a few at a time, and reports those that
+// do not answer 2xx
+func (l *TemplateLinter) checkLinks(ctx context.Context, report *models.TemplateLintReport, links []lintLink) {
+	findings := make([]*models.LintFinding, len(links))
+	sem := make(chan struct{}, templateLinkConcurrency)
+	var wg sync.WaitGroup
+	for i, link := range links {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			findings[i] = l.checkLink(ctx, link)
+		}()
+	}
+	wg.Wait()
+
+	report.LinksChecked = len(links)
+	for _, finding := range findings {
+		if finding != nil {
+			report.Add(finding.Severity, finding.Rule, finding.Message, finding.Location)
+		}
+	}
+}
+
+// checkLink requests a link with HEAD, or GET when HEAD is not supported,
+// and returns the finding to report, if any
+func (l *TemplateLinter) checkLink(ctx context.Context, link lintLink) *models.LintFinding {
+	status, err := l.request(ctx, http.MethodHead, link.url)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = l.request(ctx, http.MethodGet, link.url)
+	}
+
+	target := abbreviate(link.url, 200)
+	switch {
+	case errors.Is(err, ErrPrivateAddress):
+		return &models.LintFinding{Severity: models.LintSeverityError, Rule: models.LintRuleBlockedLink,
+			Message: "URL points or redirects to an internal address and was not followed: " + target, Location: link.location}
+	case err != nil && isTimeout(err):
+		return &models.LintFinding{Severity: models.LintSeverityWarning, Rule: models.LintRuleUncheckedLink,
+			Message: fmt.Sprintf("URL did not answer within %s: %s", TemplateLinkTimeout, target), Location: link.location}
+	case err != nil:
+		return &models.LintFinding{Severity: models.LintSeverityError, Rule: models.LintRuleBrokenLink,
+			Message: fmt.Sprintf("URL is unreachable (%v): %s", errors.Unwrap(err), target), Location: link.location}
+	case status < 200 || status > 299:
+		return &models.LintFinding{Severity: models.LintSeverityError, Rule: models.LintRuleBrokenLink,
+			Message: fmt.Sprintf("URL returned %d %s: %s", status, http.StatusText(status), target), Location: link.location}
+	}
+	return nil
+}
+
+// request sends a request without credentials and returns the final status
+func (l *TemplateLinter) request(ctx context.Context, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "user-management-template-lint/1.0")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// isTimeout reports whether err is a timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// lintLocation names a position in a field as field:line
+func lintLocation(field, value string, offset int) string {
+	return fmt.Sprintf("%s:%d", field, strings.Count(value[:offset], "\n")+1)
+}
+
+// abbreviate shortens s to at most max runes
+func abbreviate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// linkServers starts a server standing for a public site and one standing
+// for an internal service, and returns a linter that treats only the first
+// as public, with a count of the requests the internal one got
+func linkServers(t *testing.T) (public *httptest.Server, internal *httptest.Server, linter *TemplateLinter, internalHits *atomic.Int32) {
+	t.Helper()
+	internalHits = &atomic.Int32{}
+	internal = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalHits.Add(1)
+	}))
+	t.Cleanup(internal.Close)
+	_, internalPort, _ := net.SplitHostPort(internal.Listener.Addr().String())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/to-localhost", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+internalPort+"/admin", http.StatusFound)
+	})
+	mux.HandleFunc("/to-metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	mux.HandleFunc("/to-file", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	public = httptest.NewServer(mux)
+	t.Cleanup(public.Close)
+
+	publicAddress := public.Listener.Addr().String()
+	linter = newTemplateLinter(2*time.Second, func(address string) bool {
+		return address != publicAddress && isInternalAddress(address)
+	})
+	return public, internal, linter, internalHits
+}
+
+// emailTemplate is an email template with the body given and a plain-text
+// alternative
+func emailTemplate(body string) *models.MongoTemplate {
+	return &models.MongoTemplate{
+		Channel: string(models.TemplateChannelEmail),
+		Content: map[string]string{"subject": "Hello", "body_html": body, "body_text": "Hello"},
+	}
+}
+
+// TestTemplateLinterChecksLinks lints links answering 200, 404 and
+// redirecting, and checks redirects into internal addresses are reported
+// without the internal service being reached
+func TestTemplateLinterChecksLinks(t *testing.T) {
+	public, internal, linter, internalHits := linkServers(t)
+
+	links := map[string]string{
+		"/ok":           "",
+		"/get-only":     "",
+		"/moved":        "",
+		"/missing":      models.LintRuleBrokenLink,
+		"/loop":         models.LintRuleBrokenLink,
+		"/to-file":      models.LintRuleBrokenLink,
+		"/to-localhost": models.LintRuleBlockedLink,
+		"/to-metadata":  models.LintRuleBlockedLink,
+	}
+	var body strings.Builder
+	for path := range links {
+		body.WriteString(`<p><a href="` + public.URL + path + `">` + path + "</a> is a link with enough words around it.</p>\n")
+	}
+	// Linking the internal service directly is refused too
+	body.WriteString(`<a href="` + internal.URL + `/admin">internal</a>`)
+
+	report := linter.Lint(context.Background(), emailTemplate(body.String()), TemplateLintOptions{CheckLinks: true})
+	if report.LinksChecked != len(links)+1 {
+		t.Errorf("links checked = %d, want %d", report.LinksChecked, len(links)+1)
+	}
+	got := map[string]string{}
+	for _, finding := range report.Findings {
+		for path := range links {
+			if strings.HasSuffix(finding.Message, public.URL+path) {
+				got[path] = finding.Rule
+			}
+		}
+		if strings.HasSuffix(finding.Message, internal.URL+"/admin") {
+			got["internal"] = finding.Rule
+		}
+		if finding.Severity != models.LintSeverityError {
+			t.Errorf("finding %+v, want an error", finding)
+		}
+	}
+	for path, want := range links {
+		if got[path] != want {
+			t.Errorf("%s reported as %q, want %q", path, got[path], want)
+		}
+	}
+	if got["internal"] != models.LintRuleBlockedLink {
+		t.Errorf("the internal link reported as %q, want %q", got["internal"], models.LintRuleBlockedLink)
+	}
+	if n := internalHits.Load(); n != 0 {
+		t.Errorf("the internal service got %d requests, want none", n)
+	}
+	if report.Errors != 6 {
+		t.Errorf("errors = %d, want 6: %+v", report.Errors, report.Findings)
+	}
+}
+
+// TestTemplateLinterRefusesLoopback checks the linter built for production
+// does not reach a server on the loopback interface
+func TestTemplateLinterRefusesLoopback(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits.Add(1) }))
+	defer server.Close()
+
+	report := NewTemplateLinter(2*time.Second).Lint(context.Background(),
+		emailTemplate(`<a href="`+server.URL+`/">home</a>`), TemplateLintOptions{CheckLinks: true})
+	if len(report.Findings) != 1 || report.Findings[0].Rule != models.LintRuleBlockedLink {
+		t.Errorf("findings = %+v, want the link blocked", report.Findings)
+	}
+	if hits.Load() != 0 {
+		t.Errorf("the loopback server got %d requests, want none", hits.Load())
+	}
+}
+
+func TestIsInternalAddress(t *testing.T) {
+	for address, want := range map[string]bool{
+		"93.184.215.14:443":     false,
+		"[2606:2800:21f::1]:80": false,
+		"100.63.255.255:80":     false,
+		"127.0.0.1:80":          true,
+		"[::1]:80":              true,
+		"10.1.2.3:80":           true,
+		"172.16.0.1:80":         true,
+		"192.168.1.1:80":        true,
+		"169.254.169.254:80":    true,
+		"100.64.0.1:80":         true,
+		"0.0.0.0:80":            true,
+		"0.1.2.3:80":            true,
+		"[fd00::1]:80":          true,
+		"[fe80::1]:80":          true,
+		"[::ffff:127.0.0.1]:80": true,
+		"224.0.0.1:80":          true,
+		"example.com:80":        true,
+		"no-port":               true,
+	} {
+		if got := isInternalAddress(address); got != want {
+			t.Errorf("isInternalAddress(%q) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+// TestTemplateLinterContent lints the content of templates without
+// requesting their links
+func TestTemplateLinterContent(t *testing.T) {
+	linter := NewTemplateLinter(time.Second)
+	rules := func(report *models.TemplateLintReport) map[string]int {
+		counts := map[string]int{}
+		for _, finding := range report.Findings {
+			counts[finding.Rule]++
+		}
+		return counts
+	}
+
+	imageOnly := &models.MongoTemplate{
+		Channel: string(models.TemplateChannelEmail),
+		Content: map[string]string{
+			"subject":   "Hi {{first_name}}, {{offer_code}} inside",
+			"body_html": `<img src="https://cdn.example.com/a.png"><img src="https://cdn.example.com/b.png" alt="">`,
+		},
+	}
+	report := linter.Lint(context.Background(), imageOnly, TemplateLintOptions{RequireUnsubscribe: true})
+	want := map[string]int{
+		models.LintRuleMissingPlainText:   1,
+		models.LintRuleMissingUnsubscribe: 1,
+		models.LintRuleMissingAlt:         1,
+		models.LintRuleImageOnly:          1,
+		models.LintRuleUnresolvedMergeTag: 1,
+	}
+	if got := rules(report); !maps.Equal(got, want) {
+		t.Errorf("findings = %+v, want the rules %v", report.Findings, want)
+	}
+	if report.TextToImageRatio == nil || *report.TextToImageRatio != 0 {
+		t.Errorf("text to image ratio = %v, want 0", report.TextToImageRatio)
+	}
+	if report.LinksChecked != 0 {
+		t.Errorf("links checked = %d without CheckLinks", report.LinksChecked)
+	}
+
+	clean := emailTemplate(`<p>` + strings.Repeat("Plenty of words for the reader. ", 20) + `</p>` +
+		`<img src="https://cdn.example.com/a.png" alt="Logo"><a href="{{unsubscribe_url}}">Unsubscribe</a>`)
+	clean.CustomFields = map[string]string{"offer_code": "SAVE10"}
+	report = linter.Lint(context.Background(), clean, TemplateLintOptions{RequireUnsubscribe: true})
+	if len(report.Findings) != 0 {
+		t.Errorf("findings of a clean template = %+v", report.Findings)
+	}
+}
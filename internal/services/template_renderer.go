@@ -0,0 +1,169 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// ErrInvalidMergeTag is returned when a template contains a malformed merge tag
+var ErrInvalidMergeTag = errors.New("invalid merge tag")
+
+// ErrUnsupportedPreviewChannel is returned for channels that cannot be rendered
+var ErrUnsupportedPreviewChannel = errors.New("unsupported channel")
+
+var (
+	// mergeTagPattern matches {{ ... }} non-greedily so nested braces surface as invalid names
+	mergeTagPattern = regexp.MustCompile(`\{\{(.*?)\}\}`)
+	// mergeTagNamePattern is the accepted merge tag name syntax (whitespace around it is ignored)
+	mergeTagNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+)
+
+// SMS segment sizes (single / concatenated) per encoding
+const (
+	smsGSMSingle  = 160
+	smsGSMMulti   = 153
+	smsUCS2Single = 70
+	smsUCS2Multi  = 67
+)
+
+// gsm7Chars is the GSM 03.38 basic character set (the extension table is treated as non-GSM)
+const gsm7Chars = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// RenderTemplatePreview renders a template's subject and body with the supplied
+// variables. Values injected into HTML bodies are escaped unless marked raw.
+// channel overrides the template channel when non-empty.
+func RenderTemplatePreview(t *models.MongoTemplate, channel string, vars map[string]models.PreviewVariable) (*models.TemplatePreviewResponse, error) {
+	if channel == "" {
+		channel = t.Channel
+	}
+	if !models.IsValidChannel(channel) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedPreviewChannel, channel)
+	}
+
+	content := t.Content
+	if content == nil {
+		content = map[string]string{}
+	}
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	used := make(map[string]bool)
+	missing := make(map[string]bool)
+	render := func(text string, escapeHTML bool) (string, error) {
+		return renderMergeTags(text, vars, escapeHTML, used, missing)
+	}
+
+	resp := &models.TemplatePreviewResponse{Channel: channel}
+	var err error
+
+	switch models.TemplateChannel(channel) {
+	case models.TemplateChannelEmail:
+		if resp.Subject, err = render(first(content["subject"], t.Subject), false); err != nil {
+			return nil, err
+		}
+		if resp.PreHeader, err = render(content["pre_header"], false); err != nil {
+			return nil, err
+		}
+		if resp.Body, err = render(first(content["body_html"], t.Body, content["body"]), true); err != nil {
+			return nil, err
+		}
+		if resp.BodyText, err = render(content["body_text"], false); err != nil {
+			return nil, err
+		}
+	default:
+		if resp.Body, err = render(first(content["body"], t.Body, content["body_text"]), false); err != nil {
+			return nil, err
+		}
+		resp.CharacterCount = utf8.RuneCountInString(resp.Body)
+		switch models.TemplateChannel(channel) {
+		case models.TemplateChannelSMS:
+			resp.SegmentCount, resp.Encoding = SMSSegments(resp.Body)
+		case models.TemplateChannelWhatsApp:
+			resp.SegmentCount = 1 // WhatsApp messages are never split
+		}
+	}
+
+	resp.MissingTags = sortedKeys(missing)
+	resp.UnusedVariables = []string{}
+	for key := range vars {
+		if !used[key] {
+			resp.UnusedVariables = append(resp.UnusedVariables, key)
+		}
+	}
+	sort.Strings(resp.UnusedVariables)
+
+	return resp, nil
+}
+
+// renderMergeTags substitutes every {{tag}} in text. Tags without a supplied value
+// are left in place and recorded in missing; supplied keys that were used go in used.
+func renderMergeTags(text string, vars map[string]models.PreviewVariable, escapeHTML bool, used, missing map[string]bool) (string, error) {
+	var renderErr error
+	out := mergeTagPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := strings.TrimSpace(match[2 : len(match)-2])
+		if !mergeTagNamePattern.MatchString(name) {
+			if renderErr == nil {
+				renderErr = fmt.Errorf("%w: %q", ErrInvalidMergeTag, match)
+			}
+			return match
+		}
+
+		value, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			return match
+		}
+		used[name] = true
+		if escapeHTML && !value.Raw {
+			return html.EscapeString(value.Value)
+		}
+		return value.Value
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return out, nil
+}
+
+// SMSSegments returns the number of SMS segments needed for body and the encoding used
+func SMSSegments(body string) (int, string) {
+	length := utf8.RuneCountInString(body)
+	if length == 0 {
+		return 0, "GSM-7"
+	}
+
+	single, multi, encoding := smsGSMSingle, smsGSMMulti, "GSM-7"
+	for _, r := range body {
+		if !strings.ContainsRune(gsm7Chars, r) {
+			single, multi, encoding = smsUCS2Single, smsUCS2Multi, "UCS-2"
+			break
+		}
+	}
+
+	if length <= single {
+		return 1, encoding
+	}
+	return (length + multi - 1) / multi, encoding
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/cache"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// TemplateTrashPurger permanently removes templates that have been in the
+// trash longer than the retention period
+type TemplateTrashPurger struct {
+	repo      *repositories.MongoTemplateRepository
+	cache     *cache.TemplateCache
+	events    *repositories.EventOutboxRepository
+	retention time.Duration
+	interval  time.Duration
+}
+
+// NewTemplateTrashPurger creates a new TemplateTrashPurger
+// templateCache can be nil - cache eviction is skipped
+func NewTemplateTrashPurger(repo *repositories.MongoTemplateRepository, templateCache *cache.TemplateCache, eventOutbox *repositories.EventOutboxRepository, retentionDays int, interval time.Duration) *TemplateTrashPurger {
+	return &TemplateTrashPurger{
+		repo:      repo,
+		cache:     templateCache,
+		events:    eventOutbox,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+		interval:  interval,
+	}
+}
+
+// Run purges expired trash immediately and then on every interval until ctx is cancelled
+func (p *TemplateTrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PurgeExpired(ctx); err != nil {
+			log.Printf("Warning: template trash purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired permanently removes templates trashed before the retention
+// cutoff and returns how many were removed
+func (p *TemplateTrashPurger) PurgeExpired(ctx context.Context) (int, error) {
+	purged, err := p.repo.PurgeTrashedBefore(ctx, time.Now().Add(-p.retention))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, t := range purged {
+		if p.cache != nil {
+			p.cache.Delete(ctx, t.TenantID, t.ID)
+		}
+		event := events.NewTemplateEvent(events.TypeTemplatePurged, "", t.TenantID, t.ID)
+		event.Reason = "retention"
+		if err := events.Record(ctx, p.events, event); err != nil {
+			log.Printf("Warning: failed to record template.purged event for %s: %v", t.ID, err)
+		}
+	}
+
+	if len(purged) > 0 {
+		log.Printf("Template trash purge removed %d template(s)", len(purged))
+	}
+	return len(purged), nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/white/user-management/internal/cache/userscope"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// userScopeCacheTTL bounds how long a per-user data scope override, custom
+// roles, grants and team member lists are reused until SetScopeCache
+// configures the cache. Changes made through the admin endpoints apply at
+// once on the instances sharing the cache; others pick them up within the
+// TTL.
+const userScopeCacheTTL = 30 * time.Second
+
+// userScopeCacheSize bounds how many users and teams the default in-memory
+// cache holds
+const userScopeCacheSize = 10000
+
+// teamMembersKey carries the service GetTeamUserIDs reads team members
+// through
+type teamMembersKey struct{}
+
+// userScopeCache reads the per-user data scope overrides, custom roles and
+// directly granted permissions from the user documents, and the members of
+// each team, through a userscope.Cache
+type userScopeCache struct {
+	users repositories.UserStore
+	cache userscope.Cache
+}
+
+// SetUserStore makes the service apply the data scope overrides, custom
+// roles and grants stored on user documents on top of the role's
+func (s *RBACService) SetUserStore(users repositories.UserStore) {
+	s.userScopes = &userScopeCache{users: users, cache: s.scopeCache()}
+}
+
+// SetScopeCache sets the cache user entries and team member lists are kept
+// in, e.g. a userscope.Redis shared by every instance. The default is an
+// in-memory cache.
+func (s *RBACService) SetScopeCache(cache userscope.Cache) {
+	if cache == nil {
+		return
+	}
+	s.scopes = cache
+	if s.userScopes != nil {
+		s.userScopes.cache = cache
+	}
+}
+
+// scopeCache returns the configured cache, creating the in-memory default
+// on first use
+func (s *RBACService) scopeCache() userscope.Cache {
+	if s.scopes == nil {
+		s.scopes = userscope.NewMemory(userScopeCacheSize, userScopeCacheTTL)
+	}
+	return s.scopes
+}
+
+// DataScopeForUser returns the data scope of a user: the role's data scope
+// with the user's own override applied. Without a user store it is the
+// role's data scope.
+func (s *RBACService) DataScopeForUser(ctx context.Context, userID string, roleScope *models.DataScope) (models.DataScope, error) {
+	scope := models.DataScope{}
+	if roleScope != nil {
+		scope = *roleScope
+	}
+	if s.userScopes == nil || userID == "" {
+		return scope, nil
+	}
+	entry, err := s.userScopes.get(ctx, userID)
+	if err != nil {
+		return models.DataScope{}, err
+	}
+	return scope.WithOverride(entry.DataScope), nil
+}
+
+// AssignedPermissions returns the permissions a user holds besides those of
+// their role: the permissions of their custom roles merged with the ones
+// granted to them directly. Without a user store there are none.
+func (s *RBACService) AssignedPermissions(ctx context.Context, userID string) ([]string, error) {
+	if s.userScopes == nil || userID == "" {
+		return nil, nil
+	}
+	entry, err := s.userScopes.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rolePermissions, err := s.PermissionsForRoleIDs(ctx, entry.RoleIDs)
+	if err != nil {
+		return nil, err
+	}
+	return MergePermissions(rolePermissions, entry.Grants), nil
+}
+
+// WithTeamMembers returns a context in which GetTeamUserIDs reads team
+// members through the service's cache. The RBAC middleware installs it on
+// every request.
+func (s *RBACService) WithTeamMembers(ctx context.Context) context.Context {
+	if s.userScopes == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, teamMembersKey{}, s.userScopes)
+}
+
+// InvalidateUserDataScope drops the cached override, custom roles and grants
+// of a user (call after changing any of them, or their role)
+func (s *RBACService) InvalidateUserDataScope(userID string) {
+	if s.userScopes == nil {
+		return
+	}
+	s.userScopes.cache.InvalidateUser(context.Background(), userID)
+}
+
+// InvalidateTeams drops the cached member lists of teams (call after a user
+// joined or left them)
+func (s *RBACService) InvalidateTeams(teams ...string) {
+	if s.userScopes == nil {
+		return
+	}
+	for _, team := range teams {
+		if team = models.NormalizeReferenceCode(team); team != "" {
+			s.userScopes.cache.InvalidateTeam(context.Background(), team)
+		}
+	}
+}
+
+// invalidateAllUsers drops every cached user, e.g. after users were moved
+// from one role to another
+func (s *RBACService) invalidateAllUsers() {
+	if s.userScopes == nil {
+		return
+	}
+	s.userScopes.cache.InvalidateAll(context.Background())
+}
+
+// get returns the cached entry of a user, loading it when missing or
+// expired. Unknown users have no override, roles or grants.
+func (c *userScopeCache) get(ctx context.Context, userID string) (*userscope.Entry, error) {
+	if entry, ok := c.cache.GetUser(ctx, userID); ok {
+		return entry, nil
+	}
+
+	user, err := c.users.GetByID(ctx, userID)
+	if err != nil && !repositories.IsUserNotFound(err) {
+		return nil, err
+	}
+	entry := userscope.NewEntry(user)
+	c.cache.SetUser(ctx, userID, entry)
+	return entry, nil
+}
+
+// teamUserIDs returns the cached member IDs of a normalized team code,
+// loading them when missing or expired
+func (c *userScopeCache) teamUserIDs(ctx context.Context, team string) ([]string, error) {
+	if ids, ok := c.cache.GetTeam(ctx, team); ok {
+		return ids, nil
+	}
+	ids, err := listTeamUserIDs(ctx, c.users, team)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.SetTeam(ctx, team, ids)
+	return ids, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+// MaxManagementDepth is the most managers a management chain is walked up
+const MaxManagementDepth = 20
+
+// Reasons a manager cannot be assigned
+var (
+	ErrManagerNotFound = errors.New("manager not found")
+	ErrManagerInactive = errors.New("manager is not an active user")
+	ErrManagerIsSelf   = errors.New("a user cannot be their own manager")
+	ErrManagerCycle    = errors.New("manager reports, directly or not, to this user")
+)
+
+// UserHierarchy reads and checks who reports to whom. Each user names their
+// manager in manager_id; the chain above a user is followed one lookup at a
+// time, up to MaxManagementDepth managers.
+type UserHierarchy struct {
+	users repositories.UserStore
+}
+
+// NewUserHierarchy creates a UserHierarchy reading users from users
+func NewUserHierarchy(users repositories.UserStore) *UserHierarchy {
+	return &UserHierarchy{users: users}
+}
+
+// ValidateManager checks that managerID can become the manager of userID:
+// an existing active user other than userID who does not report to userID,
+// directly or through other managers. An empty managerID, which removes the
+// manager, is always valid.
+func (h *UserHierarchy) ValidateManager(ctx context.Context, userID, managerID string) error {
+	if managerID == "" {
+		return nil
+	}
+	if managerID == userID {
+		return ErrManagerIsSelf
+	}
+	manager, err := h.users.GetByID(ctx, managerID)
+	if err != nil {
+		if repositories.IsUserNotFound(err) {
+			return ErrManagerNotFound
+		}
+		return err
+	}
+	if !manager.IsActive {
+		return ErrManagerInactive
+	}
+
+	chain, _, err := h.chainAbove(ctx, manager)
+	if err != nil {
+		return err
+	}
+	for _, above := range chain {
+		if above.ID == userID {
+			return ErrManagerCycle
+		}
+	}
+	return nil
+}
+
+// DirectReports returns the users whose manager is userID, sorted by name
+func (h *UserHierarchy) DirectReports(ctx context.Context, userID string) ([]*models.User, error) {
+	return h.users.ListDirectReports(ctx, userID)
+}
+
+// ManagementChain returns the managers above user, nearest first.
+// truncated reports a chain cut at MaxManagementDepth or at a manager
+// already met, which only data written around validation can produce.
+func (h *UserHierarchy) ManagementChain(ctx context.Context, user *models.User) (chain []*models.User, truncated bool, err error) {
+	return h.chainAbove(ctx, user)
+}
+
+// chainAbove follows manager_id up from user. A manager that no longer
+// exists ends the chain.
+func (h *UserHierarchy) chainAbove(ctx context.Context, user *models.User) ([]*models.User, bool, error) {
+	chain := []*models.User{}
+	seen := map[string]bool{user.ID: true}
+	managerID := user.ManagerID
+	for managerID != "" {
+		if seen[managerID] || len(chain) == MaxManagementDepth {
+			return chain, true, nil
+		}
+		seen[managerID] = true
+		manager, err := h.users.GetByID(ctx, managerID)
+		if err != nil {
+			if repositories.IsUserNotFound(err) {
+				return chain, false, nil
+			}
+			return nil, false, fmt.Errorf("error reading manager %s: %w", managerID, err)
+		}
+		chain = append(chain, manager)
+		managerID = manager.ManagerID
+	}
+	return chain, false, nil
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+const (
+	// MaxUserImportRows caps the data rows of one import file
+	MaxUserImportRows = 10000
+
+	// userImportBatchSize is how many rows are validated and inserted
+	// together; the job is saved after each batch
+	userImportBatchSize = 500
+
+	// userImportInviteValidity matches the validity of single invitations
+	userImportInviteValidity = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrUserImportHeader is returned when an import file has no email
+	// column or no name column
+	ErrUserImportHeader = errors.New("the header must have an email column and a first name or last name column")
+
+	// ErrUserImportEmpty is returned when an import file has no data rows
+	ErrUserImportEmpty = errors.New("the file has no rows to import")
+
+	// ErrUserImportTooLarge is returned when an import file has more than
+	// MaxUserImportRows data rows
+	ErrUserImportTooLarge = fmt.Errorf("the file has more than %d rows", MaxUserImportRows)
+)
+
+// userImportRoles are the roles an imported user can be given, the same
+// ones an invitation accepts
+var userImportRoles = map[string]bool{
+	"admin": true, "manager": true, "hunting": true, "farming": true, "genops": true, "sales_rep": true,
+}
+
+// userImportColumns maps the normalized header names an import file may use
+// to the field they hold
+var userImportColumns = map[string]string{
+	"email": "email", "emailaddress": "email",
+	"firstname": "first_name", "first": "first_name",
+	"lastname": "last_name", "last": "last_name", "surname": "last_name",
+	"role":     "role",
+	"region":   "region",
+	"team":     "team",
+	"jobtitle": "job_title", "title": "job_title",
+}
+
+// ImportedUser is a user created by an import, handed to the invite hook
+type ImportedUser struct {
+	ID        string
+	Email     string
+	FirstName string
+	Role      string
+	Team      string
+	InviteURL string
+}
+
+// UserImportInviteHook is called with the users created by each batch, to
+// send their invitations and record their events. sendInvites is the
+// job's choice; events are expected either way.
+type UserImportInviteHook func(ctx context.Context, users []ImportedUser, sendInvites bool)
+
+// UserImporter creates invited users from a CSV file. Rows are checked for
+// a valid email, a known role and an active region and team, and against
+// the other rows and existing users; rows that fail are reported and the
+// others are still created. Importing the same file again skips the users
+// it created the first time.
+type UserImporter struct {
+	repo          *repositories.UserImportRepository
+	referenceData *repositories.ReferenceDataRepository
+	appBaseURL    string
+	onCreated     UserImportInviteHook // nil sends no invitations
+}
+
+// NewUserImporter creates a new UserImporter building invitation links on
+// appBaseURL
+func NewUserImporter(repo *repositories.UserImportRepository, referenceData *repositories.ReferenceDataRepository, appBaseURL string) *UserImporter {
+	return &UserImporter{repo: repo, referenceData: referenceData, appBaseURL: appBaseURL}
+}
+
+// SetInviteHook sets what is done with the users each batch creates
+func (i *UserImporter) SetInviteHook(hook UserImportInviteHook) {
+	i.onCreated = hook
+}
+
+// userImportRow is one parsed data row
+type userImportRow struct {
+	line   int
+	fields map[string]string
+}
+
+// CountRows checks the header of an import file and counts its data rows,
+// returning ErrUserImportHeader, ErrUserImportEmpty, ErrUserImportTooLarge
+// or a CSV syntax error
+func (i *UserImporter) CountRows(data io.Reader) (int, error) {
+	reader, _, err := newUserImportReader(data)
+	if err != nil {
+		return 0, err
+	}
+	rows := 0
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		rows++
+		if rows > MaxUserImportRows {
+			return 0, ErrUserImportTooLarge
+		}
+	}
+	if rows == 0 {
+		return 0, ErrUserImportEmpty
+	}
+	return rows, nil
+}
+
+// Run imports the rows of data, which CountRows accepted, into job. The job
+// is saved after every batch and when finished; an error stops the import
+// with the job marked failed and the rows before it kept.
+func (i *UserImporter) Run(ctx context.Context, job *models.UserImportJob, data io.Reader) error {
+	err := i.run(ctx, job, data)
+
+	now := time.Now()
+	job.Status = models.UserImportCompleted
+	if err != nil {
+		job.Status = models.UserImportFailed
+		job.Error = err.Error()
+	}
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	if saveErr := i.repo.SaveJob(ctx, job); saveErr != nil {
+		log.Printf("Warning: failed to save user import %s: %v", job.ID, saveErr)
+	}
+	return err
+}
+
+func (i *UserImporter) run(ctx context.Context, job *models.UserImportJob, data io.Reader) error {
+	reader, columns, err := newUserImportReader(data)
+	if err != nil {
+		return err
+	}
+	regions, err := i.activeCodes(ctx, models.ReferenceKindRegions)
+	if err != nil {
+		return err
+	}
+	teams, err := i.activeCodes(ctx, models.ReferenceKindTeams)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]int) // Email to the line that first used it
+	batch := make([]userImportRow, 0, userImportBatchSize)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := userImportRow{line: line, fields: make(map[string]string, len(columns))}
+		for index, field := range columns {
+			if field != "" && index < len(record) {
+				row.fields[field] = strings.TrimSpace(record[index])
+			}
+		}
+		batch = append(batch, row)
+		if len(batch) == userImportBatchSize {
+			if err := i.importBatch(ctx, job, batch, seen, regions, teams); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		return i.importBatch(ctx, job, batch, seen, regions, teams)
+	}
+	return nil
+}
+
+// importBatch validates a batch of rows, inserts the valid ones that are
+// new, invites them and saves the job
+func (i *UserImporter) importBatch(ctx context.Context, job *models.UserImportJob, batch []userImportRow, seen map[string]int, regions, teams map[string]bool) error {
+	results := make([]models.UserImportRow, len(batch))
+	valid := make([]int, 0, len(batch))
+	emails := make([]string, 0, len(batch))
+	for index, row := range batch {
+		email := strings.ToLower(row.fields["email"])
+		results[index] = models.UserImportRow{Line: row.line, Email: email}
+		if reason := validateImportRow(row, regions, teams); reason != "" {
+			results[index].Status, results[index].Reason = models.UserImportRowInvalid, reason
+			continue
+		}
+		if first, ok := seen[email]; ok {
+			results[index].Status = models.UserImportRowInvalid
+			results[index].Reason = fmt.Sprintf("duplicate of line %d", first)
+			continue
+		}
+		seen[email] = row.line
+		valid = append(valid, index)
+		emails = append(emails, email)
+	}
+
+	existing, err := i.repo.ExistingEmails(ctx, emails)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var docs []interface{}
+	var created []ImportedUser
+	var docRows []int
+	for _, index := range valid {
+		row := batch[index]
+		email := results[index].Email
+		if existing[email] {
+			results[index].Status, results[index].Reason = models.UserImportRowSkipped, "a user with this email already exists"
+			continue
+		}
+		doc, user, err := i.newInvitedUser(row, email, job.TenantID, now)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+		created = append(created, user)
+		docRows = append(docRows, index)
+	}
+
+	failed, err := i.repo.InsertUsers(ctx, docs)
+	if err != nil {
+		return err
+	}
+	inserted := created[:0]
+	for docIndex, index := range docRows {
+		switch err := failed[docIndex]; {
+		case err == nil:
+			results[index].Status, results[index].UserID = models.UserImportRowCreated, created[docIndex].ID
+			inserted = append(inserted, created[docIndex])
+		case errors.Is(err, repositories.ErrDuplicateKey):
+			results[index].Status, results[index].Reason = models.UserImportRowSkipped, "a user with this email already exists"
+		default:
+			results[index].Status, results[index].Reason = models.UserImportRowFailed, err.Error()
+		}
+	}
+	if len(inserted) > 0 && i.onCreated != nil {
+		i.onCreated(ctx, inserted, job.SendInvites)
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case models.UserImportRowCreated:
+			job.Created++
+		case models.UserImportRowSkipped:
+			job.Skipped++
+		case models.UserImportRowInvalid:
+			job.Invalid++
+		default:
+			job.Failed++
+		}
+	}
+	job.Rows = append(job.Rows, results...)
+	job.Processed += len(batch)
+	job.UpdatedAt = time.Now()
+	return i.repo.SaveJob(ctx, job)
+}
+
+// newInvitedUser builds the user document of a valid row, as an invitation
+// would create it
+func (i *UserImporter) newInvitedUser(row userImportRow, email, tenantID string, now time.Time) (map[string]interface{}, ImportedUser, error) {
+	token, err := newImportInviteToken()
+	if err != nil {
+		return nil, ImportedUser{}, fmt.Errorf("failed to generate invite token: %w", err)
+	}
+	firstName, lastName := row.fields["first_name"], row.fields["last_name"]
+	role := strings.ToLower(row.fields["role"])
+	if role == "" {
+		role = "sales_rep"
+	}
+
+	userID := uuid.MustNewUUID()
+	team := referenceCodeOrDefault(row.fields["team"], "sales")
+	doc := map[string]interface{}{
+		"_id":               userID,
+		"tenant_id":         models.TenantOf(tenantID),
+		"email":             email,
+		"first_name":        firstName,
+		"last_name":         lastName,
+		"name":              strings.TrimSpace(firstName + " " + lastName),
+		"role":              role,
+		"region":            referenceCodeOrDefault(row.fields["region"], "pan_india"),
+		"team":              team,
+		"job_title":         row.fields["job_title"],
+		"status":            "invited",
+		"permissions":       []string{},
+		"invite_token":      token,
+		"invite_sent_at":    now,
+		"invite_expires_at": now.Add(userImportInviteValidity),
+		"created_at":        now,
+		"updated_at":        now,
+	}
+	user := ImportedUser{
+		ID:        userID,
+		Email:     email,
+		FirstName: firstName,
+		Role:      role,
+		Team:      team,
+		InviteURL: fmt.Sprintf("%s/signup?token=%s", i.appBaseURL, token),
+	}
+	return doc, user, nil
+}
+
+// activeCodes returns the codes of the active regions or teams
+func (i *UserImporter) activeCodes(ctx context.Context, kind string) (map[string]bool, error) {
+	entries, err := i.referenceData.List(ctx, kind, true)
+	if err != nil {
+		return nil, err
+	}
+	codes := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		codes[entry.Code] = true
+	}
+	return codes, nil
+}
+
+// validateImportRow returns why a row cannot be imported, or "" when it can
+func validateImportRow(row userImportRow, regions, teams map[string]bool) string {
+	email := row.fields["email"]
+	if email == "" {
+		return "email is required"
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email || len(email) > 254 {
+		return "invalid email address"
+	}
+	if row.fields["first_name"] == "" && row.fields["last_name"] == "" {
+		return "first name or last name is required"
+	}
+	if len(row.fields["first_name"]) > 100 || len(row.fields["last_name"]) > 100 || len(row.fields["job_title"]) > 100 {
+		return "names and job title must be at most 100 characters"
+	}
+	if role := strings.ToLower(row.fields["role"]); role != "" && !userImportRoles[role] {
+		return fmt.Sprintf("unknown role %q", row.fields["role"])
+	}
+	if region := referenceCodeOrDefault(row.fields["region"], "pan_india"); !regions[region] {
+		return fmt.Sprintf("unknown or inactive region %q", region)
+	}
+	if team := referenceCodeOrDefault(row.fields["team"], "sales"); !teams[team] {
+		return fmt.Sprintf("unknown or inactive team %q", team)
+	}
+	return ""
+}
+
+// referenceCodeOrDefault normalizes a region or team code, defaulting an
+// empty one the way invitations do
+func referenceCodeOrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return models.NormalizeReferenceCode(value)
+}
+
+// newUserImportReader reads the header of an import file and returns the
+// reader positioned on the first data row and the field of each column
+// ("" for columns that are ignored)
+func newUserImportReader(data io.Reader) (*csv.Reader, []string, error) {
+	reader := csv.NewReader(data)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, ErrUserImportEmpty
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make([]string, len(header))
+	found := make(map[string]bool)
+	for index, name := range header {
+		if index == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // Byte order mark written by spreadsheet exports
+		}
+		normalized := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+		columns[index] = userImportColumns[normalized]
+		found[columns[index]] = true
+	}
+	if !found["email"] || (!found["first_name"] && !found["last_name"]) {
+		return nil, nil, ErrUserImportHeader
+	}
+	return reader, columns, nil
+}
+
+// newImportInviteToken returns an invite token in the form single
+// invitations store
+func newImportInviteToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(hex.EncodeToString(raw)))
+	return hex.EncodeToString(hash[:]), nil
+}
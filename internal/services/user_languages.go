@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/white/user-management/internal/repositories"
+)
+
+// UserLanguageTTL is how long a user's language preference is remembered;
+// a changed preference shows in responses within this
+const UserLanguageTTL = 5 * time.Minute
+
+// userLanguage is a remembered language preference
+type userLanguage struct {
+	language string
+	expires  time.Time
+}
+
+// UserLanguages looks up the language users chose in their preferences,
+// remembering each for UserLanguageTTL so requests need not read the user
+type UserLanguages struct {
+	users repositories.UserStore
+	now   func() time.Time
+
+	mu        sync.Mutex
+	cached    map[string]userLanguage // User ID -> preference, "" for none
+	lastSweep time.Time
+}
+
+// NewUserLanguages creates a new UserLanguages
+func NewUserLanguages(users repositories.UserStore) *UserLanguages {
+	return &UserLanguages{
+		users:  users,
+		now:    time.Now,
+		cached: make(map[string]userLanguage),
+	}
+}
+
+// Get returns the language preference of userID, "" when the user has
+// none or cannot be read. Failures are logged and not remembered.
+func (l *UserLanguages) Get(ctx context.Context, userID string) string {
+	if userID == "" {
+		return ""
+	}
+	now := l.now()
+	l.mu.Lock()
+	cached, ok := l.cached[userID]
+	l.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.language
+	}
+
+	user, err := l.users.GetByID(ctx, userID)
+	if err != nil {
+		if !repositories.IsNotFound(err) {
+			log.Printf("Warning: failed to load the language of user %s: %v", userID, err)
+		}
+		return ""
+	}
+	language := user.PreferredLanguage()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Forget expired preferences so the map does not grow forever
+	if now.Sub(l.lastSweep) > 10*UserLanguageTTL {
+		for id, entry := range l.cached {
+			if !now.Before(entry.expires) {
+				delete(l.cached, id)
+			}
+		}
+		l.lastSweep = now
+	}
+	l.cached[userID] = userLanguage{language: language, expires: now.Add(UserLanguageTTL)}
+	return language
+}
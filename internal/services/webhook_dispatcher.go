@@ -0,0 +1,392 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+const (
+	// webhookEventBatchSize is the most outbox events read per query
+	webhookEventBatchSize = 100
+	// webhookDeliveriesPerTick bounds the deliveries attempted per run so a
+	// backlog does not starve the event queueing
+	webhookDeliveriesPerTick = 50
+	// webhookEventSettle is how old an outbox event must be before it is
+	// queued, so events still being recorded by another instance with an
+	// earlier sequence are not skipped
+	webhookEventSettle = 5 * time.Second
+	// webhookMaxBackoff caps the wait between attempts of a delivery
+	webhookMaxBackoff = 6 * time.Hour
+	// webhookResponseLimit is how much of a receiver's response is logged
+	webhookResponseLimit = 1024
+)
+
+// Webhook request headers. The signature header is "t=<unix seconds>,v1=<hex
+// HMAC-SHA256 of "<t>.<body>" keyed with the subscription secret>".
+const (
+	WebhookSignatureHeader  = "X-Webhook-Signature"
+	WebhookEventHeader      = "X-Webhook-Event"
+	WebhookEventIDHeader    = "X-Webhook-Event-Id"
+	WebhookDeliveryIDHeader = "X-Webhook-Delivery"
+)
+
+// WebhookDispatcher delivers user lifecycle events from the events outbox to
+// webhook subscriptions. New events are queued once per subscription and
+// sent with a signature; failed attempts are retried with exponential
+// backoff. A subscription whose attempts keep failing is disabled and its
+// creator is emailed.
+type WebhookDispatcher struct {
+	repo        *repositories.WebhookRepository
+	outbox      *repositories.EventOutboxRepository
+	users       repositories.UserStore
+	settings    repositories.SettingsStore
+	alerts      email.EmailSender // nil logs disabled subscriptions instead of emailing
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	maxFailures int
+	now         func() time.Time
+}
+
+// NewWebhookDispatcher creates a new WebhookDispatcher
+func NewWebhookDispatcher(
+	repo *repositories.WebhookRepository,
+	outbox *repositories.EventOutboxRepository,
+	users repositories.UserStore,
+	settings repositories.SettingsStore,
+	alerts email.EmailSender,
+	interval, timeout time.Duration,
+	maxAttempts, maxFailures int,
+) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		repo:        repo,
+		outbox:      outbox,
+		users:       users,
+		settings:    settings,
+		alerts:      alerts,
+		client:      &http.Client{Timeout: timeout},
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		maxFailures: maxFailures,
+		now:         time.Now,
+	}
+}
+
+// Run queues new events and sends due deliveries immediately and then on
+// every interval until ctx is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.QueueNewEvents(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: webhook event queueing failed: %v", err)
+		}
+		if _, err := d.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: webhook delivery failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// QueueNewEvents queues a delivery for every active subscription of each
+// event recorded since the last run and returns how many were queued. On
+// the very first run it starts from the current events, not the history.
+func (d *WebhookDispatcher) QueueNewEvents(ctx context.Context) (int, error) {
+	until := d.now().Add(-webhookEventSettle).UnixNano()
+	after, started, err := d.repo.GetCursor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !started {
+		return 0, d.repo.AdvanceCursor(ctx, until)
+	}
+
+	subs, err := d.repo.ListActiveSubscriptions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for {
+		pending, err := d.outbox.ListEventsBetween(ctx, after, until, models.WebhookEventTypes, webhookEventBatchSize)
+		if err != nil {
+			return queued, err
+		}
+		for _, event := range pending {
+			for _, sub := range subs {
+				if !sub.Receives(event.Topic) {
+					continue
+				}
+				now := d.now()
+				if err := d.repo.QueueDelivery(ctx, &models.WebhookDelivery{
+					ID:             models.WebhookDeliveryID(sub.ID, event.ID),
+					SubscriptionID: sub.ID,
+					EventID:        event.ID,
+					EventType:      event.Topic,
+					Payload:        event.Payload,
+					Status:         models.WebhookDeliveryPending,
+					NextAttemptAt:  now,
+					CreatedAt:      now,
+					UpdatedAt:      now,
+				}); err != nil {
+					return queued, err
+				}
+				queued++
+			}
+			if err := d.repo.AdvanceCursor(ctx, event.Sequence); err != nil {
+				return queued, err
+			}
+			after = event.Sequence
+		}
+		if len(pending) < webhookEventBatchSize {
+			break
+		}
+	}
+
+	// Nothing in (after, until] is left, so later runs can skip it
+	return queued, d.repo.AdvanceCursor(ctx, until)
+}
+
+// DeliverDue sends the deliveries whose attempt is due and returns how many
+// were attempted
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context) (int, error) {
+	// The lease outlasts an attempt, so a claimed delivery is not picked up
+	// again while it is being sent
+	lease := d.client.Timeout + time.Minute
+	attempted := 0
+	for attempted < webhookDeliveriesPerTick {
+		delivery, err := d.repo.ClaimDueDelivery(ctx, d.now(), lease)
+		if err != nil {
+			return attempted, err
+		}
+		if delivery == nil {
+			return attempted, nil
+		}
+		if err := d.attempt(ctx, delivery); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// SendTest sends a webhook.test event to a subscription right away, whether
+// or not it is active, and returns the logged delivery. Test deliveries are
+// not retried and do not count towards disabling the subscription.
+func (d *WebhookDispatcher) SendTest(ctx context.Context, sub *models.WebhookSubscription, actorID string) (*models.WebhookDelivery, error) {
+	event := struct {
+		events.Envelope
+		SubscriptionID string `json:"subscription_id"`
+		Message        string `json:"message"`
+	}{
+		Envelope:       events.NewEnvelope(models.WebhookTestEventType, actorID, ""),
+		SubscriptionID: sub.ID,
+		Message:        "This is a test event sent from the webhook settings.",
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal test event: %w", err)
+	}
+
+	now := d.now()
+	delivery := &models.WebhookDelivery{
+		ID:             models.WebhookDeliveryID(sub.ID, event.EventID),
+		SubscriptionID: sub.ID,
+		EventID:        event.EventID,
+		EventType:      models.WebhookTestEventType,
+		Payload:        string(payload),
+		NextAttemptAt:  now,
+		IsTest:         true,
+		CreatedAt:      now,
+	}
+	if d.send(ctx, sub, delivery) {
+		delivery.Status = models.WebhookDeliverySucceeded
+	} else {
+		delivery.Status = models.WebhookDeliveryFailed
+	}
+	if err := d.repo.SaveDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// attempt sends a claimed delivery once and records the outcome on the
+// delivery and its subscription
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	sub, err := d.repo.GetSubscription(ctx, delivery.SubscriptionID)
+	if err != nil && !repositories.IsNotFound(err) {
+		return err
+	}
+	if sub == nil || !sub.IsActive {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.LastError = "subscription was deleted or disabled"
+		delivery.UpdatedAt = d.now()
+		return d.repo.SaveDelivery(ctx, delivery)
+	}
+
+	success := d.send(ctx, sub, delivery)
+	switch {
+	case success:
+		delivery.Status = models.WebhookDeliverySucceeded
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+	default:
+		delivery.NextAttemptAt = d.now().Add(webhookBackoff(delivery.Attempts))
+	}
+	if err := d.repo.SaveDelivery(ctx, delivery); err != nil {
+		return err
+	}
+
+	sub, err = d.repo.RecordAttemptResult(ctx, sub.ID, success)
+	if err != nil {
+		if repositories.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !success && sub.ConsecutiveFailures >= d.maxFailures {
+		d.disable(ctx, sub)
+	}
+	return nil
+}
+
+// send POSTs the delivery payload to the subscription URL and records the
+// attempt on delivery. It reports whether the receiver answered with 2xx.
+func (d *WebhookDispatcher) send(ctx context.Context, sub *models.WebhookSubscription, delivery *models.WebhookDelivery) bool {
+	started := d.now()
+	delivery.Attempts++
+	delivery.UpdatedAt = started
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+	delivery.LastResponse = ""
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.LastError = err.Error()
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "White-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookEventIDHeader, delivery.EventID)
+	req.Header.Set(WebhookDeliveryIDHeader, delivery.ID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(sub.Secret, started, body))
+
+	resp, err := d.client.Do(req)
+	delivery.DurationMs = d.now().Sub(started).Milliseconds()
+	if err != nil {
+		delivery.LastError = err.Error()
+		return false
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	delivery.LastStatusCode = resp.StatusCode
+	delivery.LastResponse = string(response)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		delivery.LastError = "receiver responded with status " + strconv.Itoa(resp.StatusCode)
+		return false
+	}
+	delivered := d.now()
+	delivery.DeliveredAt = &delivered
+	return true
+}
+
+// disable turns off a failing subscription and tells its creator
+func (d *WebhookDispatcher) disable(ctx context.Context, sub *models.WebhookSubscription) {
+	reason := fmt.Sprintf("disabled after %d consecutive failed deliveries", sub.ConsecutiveFailures)
+	disabled, err := d.repo.DisableSubscription(ctx, sub.ID, reason, d.now())
+	if err != nil {
+		log.Printf("Warning: failed to disable webhook subscription %s: %v", sub.ID, err)
+		return
+	}
+	if !disabled {
+		return
+	}
+	log.Printf("Webhook subscription %s (%s) %s", sub.ID, sub.URL, reason)
+	d.notifyDisabled(ctx, sub, reason)
+}
+
+// notifyDisabled emails the creator of a disabled subscription, or the
+// system notification address when the creator cannot be found
+func (d *WebhookDispatcher) notifyDisabled(ctx context.Context, sub *models.WebhookSubscription, reason string) {
+	if d.alerts == nil {
+		return
+	}
+
+	to := ""
+	if user, err := d.users.GetByID(ctx, sub.CreatedBy); err == nil && user.IsActive {
+		to = user.Email
+	} else if settings, err := d.settings.GetSystemEmailNotificationSettings(ctx); err == nil {
+		to = settings.SystemNotificationEmail
+	}
+	if to == "" {
+		log.Printf("Warning: nobody to tell that webhook subscription %s was disabled", sub.ID)
+		return
+	}
+
+	summary := fmt.Sprintf("The webhook subscription to %s was %s. No more events are sent to it until it is re-activated.", sub.URL, reason)
+	now := d.now()
+	msg := &models.CommMessage{
+		MessageID:   uuid.MustNewUUID(),
+		Channel:     models.ChannelEmail,
+		Direction:   models.DirectionOutbound,
+		Status:      models.MessageStatusQueued,
+		FromAddress: d.alerts.FromAddress(),
+		FromName:    "White Platform",
+		ToAddresses: []string{to},
+		Subject:     "Webhook subscription disabled: " + sub.URL,
+		BodyText:    summary + "\n\nCheck the delivery log for the errors, fix the receiver and re-activate the subscription.",
+		BodyHTML: "<p>" + html.EscapeString(summary) + "</p>" +
+			"<p>Check the delivery log for the errors, fix the receiver and re-activate the subscription.</p>",
+		Priority:  models.PriorityHigh,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := d.alerts.SendEmail(ctx, msg); err != nil {
+		log.Printf("Warning: failed to email %s about disabled webhook subscription %s: %v", to, sub.ID, err)
+	}
+}
+
+// SignWebhookPayload returns the signature header value of body sent at t
+func SignWebhookPayload(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff is the wait after the attempts-th failed attempt: 30s,
+// 2m, 8m, 32m and so on, capped at webhookMaxBackoff
+func webhookBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 4
+	}
+	return min(backoff, webhookMaxBackoff)
+}
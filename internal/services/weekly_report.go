@@ -0,0 +1,457 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/emailtemplates"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/repositories"
+)
+
+var (
+	// ErrWeeklyReportDisabled is returned when no weekly report day is set in
+	// the system email notification settings
+	ErrWeeklyReportDisabled = errors.New("weekly reports are turned off in the system email notification settings")
+
+	// ErrWeeklyReportAlreadySent is returned when this week's reports were
+	// already sent, by this instance or another one
+	ErrWeeklyReportAlreadySent = errors.New("weekly reports were already sent this week")
+)
+
+// weeklyReportPeriod is the trailing window a weekly report covers
+const weeklyReportPeriod = 7 * 24 * time.Hour
+
+// WeeklyReportSummary is what one user's weekly report says
+type WeeklyReportSummary struct {
+	UserID           string             `json:"userId"`
+	Name             string             `json:"name"`
+	Email            string             `json:"email"`
+	From             time.Time          `json:"from"`
+	To               time.Time          `json:"to"`
+	Logins           int64              `json:"logins"`
+	TemplatesCreated int64              `json:"templatesCreated"`
+	TemplatesUpdated int64              `json:"templatesUpdated"`
+	EmailsSent       int64              `json:"emailsSent"`
+	Team             *WeeklyTeamSummary `json:"team,omitempty"` // Admins only
+}
+
+// WeeklyTeamSummary is the team section of an admin's weekly report
+type WeeklyTeamSummary struct {
+	NewMembers         int64 `json:"newMembers"`
+	ActiveMembers      int64 `json:"activeMembers"`
+	PendingInvitations int64 `json:"pendingInvitations"`
+}
+
+// WeeklyReportPreview is a rendered weekly report that was not sent
+type WeeklyReportPreview struct {
+	Summary *WeeklyReportSummary `json:"summary"`
+	Subject string               `json:"subject"`
+	Text    string               `json:"text"`
+	HTML    string               `json:"html"`
+}
+
+// WeeklyReportJob emails every active user who opted into the weekly report
+// a summary of their last seven days. Reports go out on the weekday set in
+// the system email notification settings, once the send hour has passed in
+// the organisation's timezone, and at most once per ISO week.
+type WeeklyReportJob struct {
+	users      *repositories.MongoUserRepository
+	activities *repositories.MongoActivityRepository
+	emails     *repositories.MongoEmailRepository
+	settings   *repositories.SettingsRepository
+	runs       *repositories.ReportRunRepository
+	notifier   *NotificationService
+	branding   *EmailBranding // nil uses the default branding
+	interval   time.Duration
+	sendHour   int
+}
+
+// NewWeeklyReportJob creates a new WeeklyReportJob checking whether reports
+// are due on every interval
+func NewWeeklyReportJob(users *repositories.MongoUserRepository, activities *repositories.MongoActivityRepository, emails *repositories.MongoEmailRepository, settings *repositories.SettingsRepository, runs *repositories.ReportRunRepository, notifier *NotificationService, interval time.Duration, sendHour int) *WeeklyReportJob {
+	return &WeeklyReportJob{
+		users:      users,
+		activities: activities,
+		emails:     emails,
+		settings:   settings,
+		runs:       runs,
+		notifier:   notifier,
+		interval:   interval,
+		sendHour:   sendHour,
+	}
+}
+
+// SetBranding makes the reports use the organisation's email branding
+func (j *WeeklyReportJob) SetBranding(branding *EmailBranding) {
+	j.branding = branding
+}
+
+// Run sends the weekly reports when they are due, checking immediately and
+// then on every interval until ctx is cancelled
+func (j *WeeklyReportJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.RunIfDue(ctx, time.Now()); err != nil {
+			log.Printf("Warning: weekly report run failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunIfDue sends this week's reports when now is on the scheduled weekday at
+// or after the send hour, in the organisation's timezone
+func (j *WeeklyReportJob) RunIfDue(ctx context.Context, now time.Time) error {
+	weekday, ok, err := j.scheduledWeekday(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	local := now.In(j.location(ctx))
+	if local.Weekday() != weekday || local.Hour() < j.sendHour {
+		return nil
+	}
+
+	run, err := j.Send(ctx, now)
+	if errors.Is(err, ErrWeeklyReportAlreadySent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Weekly reports for %s sent to %d user(s), %d opted out, %d failed", run.Period, run.Sent, run.Skipped, run.Failed)
+	return nil
+}
+
+// Send claims the ISO week of now and sends every opted-in active user their
+// report for the seven days before now, whatever the scheduled weekday. It
+// returns ErrWeeklyReportAlreadySent when the week was already claimed.
+func (j *WeeklyReportJob) Send(ctx context.Context, now time.Time) (*models.ReportRun, error) {
+	if _, ok, err := j.scheduledWeekday(ctx); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrWeeklyReportDisabled
+	}
+
+	loc := j.location(ctx)
+	period := isoWeek(now.In(loc))
+	run := &models.ReportRun{
+		ID:        models.ReportRunID(models.ReportWeekly, period),
+		Kind:      models.ReportWeekly,
+		Period:    period,
+		StartedAt: now,
+	}
+	claimed, err := j.runs.ClaimRun(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrWeeklyReportAlreadySent
+	}
+
+	reports := j.newReportBuilder(ctx, now, loc)
+	active := true
+	err = j.users.EachUserFiltered(ctx, repositories.UserFilters{IsActive: &active, SortBy: "created_at", SortOrder: "asc"}, func(user *models.User) error {
+		sent, err := j.sendReport(ctx, reports, user)
+		switch {
+		case err != nil:
+			run.Failed++
+			log.Printf("Warning: failed to send weekly report to user %s: %v", user.ID, err)
+		case sent:
+			run.Sent++
+		default:
+			run.Skipped++
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	if finishErr := j.runs.FinishRun(ctx, run, time.Now()); finishErr != nil {
+		log.Printf("Warning: failed to record weekly report run %s: %v", run.ID, finishErr)
+	}
+	return run, err
+}
+
+// SendToUser sends one user their report for the seven days before now,
+// outside of the weekly run. The week is not claimed, so the scheduled run
+// still goes out. It returns false when the user opted out.
+func (j *WeeklyReportJob) SendToUser(ctx context.Context, now time.Time, userID string) (bool, error) {
+	if _, ok, err := j.scheduledWeekday(ctx); err != nil {
+		return false, err
+	} else if !ok {
+		return false, ErrWeeklyReportDisabled
+	}
+
+	user, err := j.users.GetByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return j.sendReport(ctx, j.newReportBuilder(ctx, now, j.location(ctx)), user)
+}
+
+// Preview renders the reports the weekly run would send at now without
+// sending them or claiming the week. With userID only that user's report is
+// rendered. At most limit reports are returned, along with how many users
+// opted in.
+func (j *WeeklyReportJob) Preview(ctx context.Context, now time.Time, userID string, limit int) ([]WeeklyReportPreview, int, error) {
+	reports := j.newReportBuilder(ctx, now, j.location(ctx))
+	previews := []WeeklyReportPreview{}
+	optedIn := 0
+
+	preview := func(user *models.User) error {
+		ok, err := j.wantsReport(ctx, user.ID)
+		if err != nil || !ok {
+			return err
+		}
+		optedIn++
+		if len(previews) >= limit {
+			return nil
+		}
+		summary, err := reports.summarize(ctx, user)
+		if err != nil {
+			return err
+		}
+		subject, text, html, err := renderWeeklyReport(summary, reports.loc, reports.brand)
+		if err != nil {
+			return err
+		}
+		previews = append(previews, WeeklyReportPreview{Summary: summary, Subject: subject, Text: text, HTML: html})
+		return nil
+	}
+
+	if userID != "" {
+		user, err := j.users.GetByID(ctx, userID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := preview(user); err != nil {
+			return nil, 0, err
+		}
+		return previews, optedIn, nil
+	}
+
+	active := true
+	err := j.users.EachUserFiltered(ctx, repositories.UserFilters{IsActive: &active, SortBy: "created_at", SortOrder: "asc"}, preview)
+	if err != nil {
+		return nil, 0, err
+	}
+	return previews, optedIn, nil
+}
+
+// sendReport sends user their report unless they opted out, returning
+// whether it was sent
+func (j *WeeklyReportJob) sendReport(ctx context.Context, reports *weeklyReportBuilder, user *models.User) (bool, error) {
+	ok, err := j.wantsReport(ctx, user.ID)
+	if err != nil || !ok {
+		return false, err
+	}
+	summary, err := reports.summarize(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	subject, text, html, err := renderWeeklyReport(summary, reports.loc, reports.brand)
+	if err != nil {
+		return false, err
+	}
+
+	payload := models.NotificationPayload{Title: subject, Body: text, HTML: html}
+	if err := j.notifier.Notify(ctx, user.ID, models.NotificationWeeklyReport, payload); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// wantsReport reports whether the user opted into the weekly report email
+func (j *WeeklyReportJob) wantsReport(ctx context.Context, userID string) (bool, error) {
+	prefs, err := j.settings.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load notification settings: %w", err)
+	}
+	return prefs.EmailNotifications.WeeklyReport, nil
+}
+
+// scheduledWeekday reads the report weekday from the system email
+// notification settings. ok is false when weekly reports are turned off or
+// the setting is not a weekday.
+func (j *WeeklyReportJob) scheduledWeekday(ctx context.Context) (time.Weekday, bool, error) {
+	system, err := j.settings.GetSystemEmailNotificationSettings(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to load system email notification settings: %w", err)
+	}
+	schedule := strings.TrimSpace(system.WeeklyReportSchedule)
+	if schedule == "" {
+		return 0, false, nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(schedule, day.String()) {
+			return day, true, nil
+		}
+	}
+	log.Printf("Warning: weekly report schedule %q is not a weekday, reports are not sent", schedule)
+	return 0, false, nil
+}
+
+// location returns the organisation's timezone from the system default
+// settings, falling back to UTC when it is unset or unknown
+func (j *WeeklyReportJob) location(ctx context.Context) *time.Location {
+	defaults, err := j.settings.GetSystemDefaultSettings(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to load system default settings, weekly reports use UTC: %v", err)
+		return time.UTC
+	}
+	if defaults.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(defaults.Timezone)
+	if err != nil {
+		log.Printf("Warning: unknown organisation timezone %q, weekly reports use UTC", defaults.Timezone)
+		return time.UTC
+	}
+	return loc
+}
+
+// isoWeek formats the ISO week t falls in, e.g. 2026-W42
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// weeklyReportBuilder summarizes users' activity for one report period. The
+// team section is the same for every admin and is computed once, and so is
+// the branding the reports are rendered in.
+type weeklyReportBuilder struct {
+	job       *WeeklyReportJob
+	from, to  time.Time
+	loc       *time.Location
+	brand     emailtemplates.Branding
+	team      *WeeklyTeamSummary
+	teamError error
+}
+
+func (j *WeeklyReportJob) newReportBuilder(ctx context.Context, now time.Time, loc *time.Location) *weeklyReportBuilder {
+	return &weeklyReportBuilder{job: j, from: now.Add(-weeklyReportPeriod), to: now, loc: loc, brand: j.branding.Get(ctx)}
+}
+
+// summarize gathers user's numbers for the report period
+func (b *weeklyReportBuilder) summarize(ctx context.Context, user *models.User) (*WeeklyReportSummary, error) {
+	summary := &WeeklyReportSummary{UserID: user.ID, Name: user.Name, Email: user.Email, From: b.from, To: b.to}
+
+	var err error
+	if summary.Logins, err = b.job.users.CountUserLogins(ctx, user.ID, b.from, b.to); err != nil {
+		return nil, err
+	}
+	templates, err := b.job.activities.CountActivitiesByTitle(ctx, user.ID, "template", b.from, b.to)
+	if err != nil {
+		return nil, err
+	}
+	summary.TemplatesCreated = templates["Template Created"] + templates["Template Duplicated"]
+	summary.TemplatesUpdated = templates["Template Updated"]
+	if summary.EmailsSent, err = b.job.emails.CountSentEmails(ctx, user.ID, b.from, b.to); err != nil {
+		return nil, err
+	}
+
+	if user.Role == models.UserRoleAdmin {
+		if summary.Team, err = b.teamSummary(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// teamSummary counts the users who joined in the report period along with
+// the current team size and pending invitations
+func (b *weeklyReportBuilder) teamSummary(ctx context.Context) (*WeeklyTeamSummary, error) {
+	if b.team != nil || b.teamError != nil {
+		return b.team, b.teamError
+	}
+
+	_, newMembers, err := b.job.users.ListUsersFiltered(ctx, repositories.UserFilters{CreatedAfter: &b.from, CreatedBefore: &b.to, Limit: 1})
+	if err != nil {
+		b.teamError = err
+		return nil, err
+	}
+	stats, err := b.job.users.UserStats(ctx, b.to)
+	if err != nil {
+		b.teamError = err
+		return nil, err
+	}
+	b.team = &WeeklyTeamSummary{
+		NewMembers:         newMembers,
+		ActiveMembers:      stats.ByStatus[repositories.UserStatusActive],
+		PendingInvitations: stats.PendingInvitations,
+	}
+	return b.team, nil
+}
+
+// weeklyReportHTML is the HTML body of the weekly report email
+var weeklyReportHTML = template.Must(template.New("weekly_report").Parse(`<div style="font-family: Arial, sans-serif; max-width: 600px; color: #333;">
+{{with .Brand.LogoURL}}<img src="{{.}}" alt="{{$.Brand.Name}}" style="max-height: 40px;">
+{{end}}<h2 style="margin-bottom: 4px; color: {{.Brand.PrimaryColor}};">Your weekly summary</h2>
+<p style="color: #777; margin-top: 0;">{{.From}} – {{.To}}</p>
+<p>Hi {{.Name}}, here is what you did this week.</p>
+<table style="border-collapse: collapse; width: 100%;">
+<tr><td style="padding: 6px 0;">Sign-ins</td><td style="text-align: right;"><strong>{{.Summary.Logins}}</strong></td></tr>
+<tr><td style="padding: 6px 0;">Templates created</td><td style="text-align: right;"><strong>{{.Summary.TemplatesCreated}}</strong></td></tr>
+<tr><td style="padding: 6px 0;">Templates updated</td><td style="text-align: right;"><strong>{{.Summary.TemplatesUpdated}}</strong></td></tr>
+<tr><td style="padding: 6px 0;">Emails sent</td><td style="text-align: right;"><strong>{{.Summary.EmailsSent}}</strong></td></tr>
+</table>
+{{with .Summary.Team}}<h3 style="margin-bottom: 4px;">Your team</h3>
+<table style="border-collapse: collapse; width: 100%;">
+<tr><td style="padding: 6px 0;">New members</td><td style="text-align: right;"><strong>{{.NewMembers}}</strong></td></tr>
+<tr><td style="padding: 6px 0;">Active members</td><td style="text-align: right;"><strong>{{.ActiveMembers}}</strong></td></tr>
+<tr><td style="padding: 6px 0;">Pending invitations</td><td style="text-align: right;"><strong>{{.PendingInvitations}}</strong></td></tr>
+</table>
+{{end}}<p style="color: #777; font-size: 12px;">You receive this email because weekly reports are turned on in your notification settings.</p>
+{{with .Brand.FooterText}}<p style="color: #777; font-size: 12px;">{{.}}</p>
+{{end}}</div>`))
+
+// renderWeeklyReport renders the subject, plain text and HTML of a report in
+// brand, showing dates in loc
+func renderWeeklyReport(summary *WeeklyReportSummary, loc *time.Location, brand emailtemplates.Branding) (subject, text, html string, err error) {
+	from := summary.From.In(loc).Format("Jan 2")
+	to := summary.To.In(loc).Format("Jan 2, 2006")
+	name := summary.Name
+	if name == "" {
+		name = summary.Email
+	}
+	subject = fmt.Sprintf("Your weekly summary: %s – %s", from, to)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s, here is what you did from %s to %s.\n\n", name, from, to)
+	fmt.Fprintf(&body, "Sign-ins: %d\n", summary.Logins)
+	fmt.Fprintf(&body, "Templates created: %d\n", summary.TemplatesCreated)
+	fmt.Fprintf(&body, "Templates updated: %d\n", summary.TemplatesUpdated)
+	fmt.Fprintf(&body, "Emails sent: %d\n", summary.EmailsSent)
+	if team := summary.Team; team != nil {
+		fmt.Fprintf(&body, "\nYour team\nNew members: %d\nActive members: %d\nPending invitations: %d\n", team.NewMembers, team.ActiveMembers, team.PendingInvitations)
+	}
+	if brand.FooterText != "" {
+		fmt.Fprintf(&body, "\n%s\n", brand.FooterText)
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		Name     string
+		From, To string
+		Summary  *WeeklyReportSummary
+		Brand    emailtemplates.Branding
+	}{name, from, to, summary, brand}
+	if err := weeklyReportHTML.Execute(&buf, data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render weekly report: %w", err)
+	}
+	return subject, body.String(), buf.String(), nil
+}
@@ -0,0 +1,420 @@
+// Package testutil runs the API end to end for integration tests: the full
+// router built by routes.RegisterRoutes over the real MongoDB repositories,
+// a database of its own for each test and a loopback SMTP server that keeps
+// every email sent, with helpers to create users, mint their access tokens
+// and make requests as them.
+//
+// The harness does not start MongoDB. TEST_MONGODB_URI names the server to
+// use, such as the mongo service container of a CI job, and tests using the
+// harness are skipped when it is not set, so `go test ./...` passes without
+// one. Each test gets a database named after it with a random suffix,
+// dropped when it ends, so tests may run in parallel against one server.
+// TEST_REDIS_URL optionally turns on the template cache, as Cache.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/cache"
+	"github.com/white/user-management/internal/cache/userscope"
+	"github.com/white/user-management/internal/events"
+	"github.com/white/user-management/internal/i18n"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/internal/password"
+	"github.com/white/user-management/internal/repositories"
+	"github.com/white/user-management/internal/routes"
+	"github.com/white/user-management/internal/services"
+	"github.com/white/user-management/internal/utils"
+	"github.com/white/user-management/pkg/email"
+	"github.com/white/user-management/pkg/kafka"
+	"github.com/white/user-management/pkg/mongodb"
+	"github.com/white/user-management/pkg/sms"
+	"github.com/white/user-management/pkg/smtp"
+	"github.com/white/user-management/pkg/storage"
+)
+
+// Environment variables configuring the harness
+const (
+	MongoURIEnv = "TEST_MONGODB_URI" // Required; tests are skipped without it
+	RedisURLEnv = "TEST_REDIS_URL"   // Optional; turns on the template cache
+)
+
+// Password is the password of the users CreateUser creates
+const Password = "Integration-Test-Passw0rd!"
+
+// setupTimeout bounds connecting to MongoDB and preparing a test database
+const setupTimeout = 30 * time.Second
+
+// Harness is the API of one test, over a database of its own
+type Harness struct {
+	t testing.TB
+
+	Config    *config.Config // The configuration routes were built with; changes made later have no effect
+	Router    http.Handler
+	Mongo     *mongodb.Client
+	Users     *repositories.MongoUserRepository
+	JWT       *utils.JWTService
+	Passwords *password.Hasher
+	Mail      *MailServer
+	Redis     *redis.Client        // nil without TEST_REDIS_URL
+	Cache     *cache.TemplateCache // nil without TEST_REDIS_URL
+}
+
+// baseConfig is loaded once, as config.Load reads process-wide settings;
+// each harness works on a copy
+var (
+	baseConfigOnce sync.Once
+	baseConfig     *config.Config
+	baseConfigErr  error
+)
+
+func loadBaseConfig(mongoURI string) (*config.Config, error) {
+	baseConfigOnce.Do(func() {
+		os.Setenv("MONGODB_URI", mongoURI)
+		os.Setenv("JWT_ALGORITHM", "HS256")
+		os.Setenv("JWT_SECRET", "integration-tests-only-secret-0123456789abcdef")
+		os.Unsetenv("JWT_PRIVATE_KEY_PATH")
+		os.Unsetenv("JWT_PUBLIC_KEY_PATH")
+		// Tests sign in far more often than a client may
+		os.Setenv("SERVER_AUTH_RATE_LIMIT", "0")
+		baseConfig, baseConfigErr = config.Load()
+	})
+	return baseConfig, baseConfigErr
+}
+
+// New starts the API for t over a fresh database, skipping t when
+// TEST_MONGODB_URI is not set. Everything is torn down when t ends.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	mongoURI := os.Getenv(MongoURIEnv)
+	if mongoURI == "" {
+		t.Skipf("%s is not set; integration tests need a MongoDB server", MongoURIEnv)
+	}
+	base, err := loadBaseConfig(mongoURI)
+	if err != nil {
+		t.Fatalf("testutil: failed to load the configuration: %v", err)
+	}
+
+	h := &Harness{t: t, Mail: StartMailServer(t)}
+
+	cfg := *base
+	cfg.MongoDB.Database = databaseName(t)
+	cfg.Kafka.Brokers = nil // Events stay in the outbox
+	cfg.Worker.Enabled = false
+	cfg.Email.Provider = config.EmailProviderSMTP
+	cfg.Email.FromEmail = "noreply@example.com"
+	cfg.SMTP.Host = h.Mail.Host()
+	cfg.SMTP.Port = h.Mail.Port()
+	cfg.SMTP.FromEmail = cfg.Email.FromEmail
+	cfg.SMTP.Username = ""
+	cfg.SMTP.Password = ""
+	cfg.SMTP.TLSEnabled = false
+	cfg.App.BaseURL = "http://app.test"
+	cfg.App.PasswordHashCost = password.MinCost // Fast; strength is not under test
+	h.Config = &cfg
+
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+
+	h.Mongo, err = mongodb.NewClient(mongodb.Config{
+		URI:         cfg.MongoDB.URI,
+		Database:    cfg.MongoDB.Database,
+		MaxPoolSize: 10,
+		MinPoolSize: 1,
+		MaxRetries:  1,
+	})
+	if err != nil {
+		t.Fatalf("testutil: failed to connect to MongoDB: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+		defer cancel()
+		if err := h.Mongo.Database().Drop(ctx); err != nil {
+			t.Logf("testutil: failed to drop database %s: %v", cfg.MongoDB.Database, err)
+		}
+		h.Mongo.Close()
+	})
+	if err := repositories.InitIndexes(ctx, h.Mongo); err != nil {
+		t.Fatalf("testutil: failed to create the indexes: %v", err)
+	}
+
+	if redisURL := os.Getenv(RedisURLEnv); redisURL != "" {
+		opt, err := redis.ParseURL(redisURL)
+		if err != nil {
+			t.Fatalf("testutil: invalid %s: %v", RedisURLEnv, err)
+		}
+		h.Redis = redis.NewClient(opt)
+		t.Cleanup(func() { h.Redis.Close() })
+		h.Cache = cache.NewTemplateCache(h.Redis, cfg.Templates.CacheTTL, cfg.Templates.ListCacheTTL)
+	}
+
+	h.Passwords, err = password.New(cfg.App.PasswordHashCost)
+	if err != nil {
+		t.Fatalf("testutil: %v", err)
+	}
+	h.JWT, err = utils.NewJWTService(cfg.JWT)
+	if err != nil {
+		t.Fatalf("testutil: failed to create the JWT service: %v", err)
+	}
+	h.Users = repositories.NewMongoUserRepository(h.Mongo)
+
+	permissionRepo := repositories.NewPermissionRepository(h.Mongo)
+	if _, err := permissionRepo.SeedBuiltInRoles(ctx); err != nil {
+		t.Fatalf("testutil: failed to seed the built-in roles: %v", err)
+	}
+
+	h.Router = h.buildRouter(permissionRepo)
+	return h
+}
+
+// buildRouter wires the dependencies as cmd/api does, leaving out Kafka,
+// the background workers and the optional integrations
+func (h *Harness) buildRouter(permissionRepo *repositories.PermissionRepository) http.Handler {
+	cfg := h.Config
+	mongoClient := h.Mongo
+
+	kafkaProducer := kafka.NewProducer(cfg.Kafka)
+	emailSender := email.NewSMTPSender(smtp.NewSMTPClient(&smtp.SMTPConfig{
+		Host:      cfg.SMTP.Host,
+		Port:      cfg.SMTP.Port,
+		FromEmail: cfg.SMTP.FromEmail,
+	}))
+
+	eventOutbox := repositories.NewEventOutboxRepository(mongoClient)
+	auditPublisher := events.NewAuditPublisher(kafkaProducer)
+	auditPublisher.SetRecorder(eventOutbox)
+
+	rbacService := services.NewRBACService(permissionRepo, h.Redis)
+	rbacService.SetUserStore(repositories.NewMongoUserRepository(mongoClient))
+	rbacService.SetScopeCache(userscope.NewMemory(cfg.ScopeCache.Size, cfg.ScopeCache.TTL))
+
+	emailBranding := services.NewEmailBranding(repositories.NewSettingsRepository(mongoClient), cfg.Email.FromName)
+	systemEmails := services.NewSystemEmails(repositories.NewMongoTemplateRepository(mongoClient), cfg.Email.FromEmail, cfg.Email.FromName)
+	systemEmails.SetBranding(emailBranding)
+
+	notificationService := services.NewNotificationService(
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		repositories.NewNotificationRepository(mongoClient),
+		repositories.NewMongoEmailRepository(mongoClient),
+		emailSender,
+		nil,
+	)
+	weeklyReports := services.NewWeeklyReportJob(
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewMongoActivityRepository(mongoClient),
+		repositories.NewMongoEmailRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		repositories.NewReportRunRepository(mongoClient),
+		notificationService,
+		cfg.Reports.WeeklyCheckInterval,
+		cfg.Reports.WeeklySendHour,
+	)
+	webhookDispatcher := services.NewWebhookDispatcher(
+		repositories.NewWebhookRepository(mongoClient),
+		eventOutbox,
+		repositories.NewMongoUserRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		emailSender,
+		cfg.Webhooks.PollInterval,
+		cfg.Webhooks.Timeout,
+		cfg.Webhooks.MaxAttempts,
+		cfg.Webhooks.MaxConsecutiveFailures,
+	)
+
+	permissionDenials := services.NewPermissionDenials(
+		repositories.NewPermissionDenialRepository(mongoClient),
+		repositories.NewSettingsRepository(mongoClient),
+		auditPublisher,
+		cfg.Security.DenialLimit,
+		cfg.Security.DenialWindow,
+	)
+	permissionDenials.SetAlertSender(emailSender)
+
+	router := mux.NewRouter()
+	router.Use(i18n.Middleware)
+	routes.RegisterRoutes(router, &routes.Dependencies{
+		Config:         cfg,
+		MongoClient:    mongoClient,
+		KafkaProducer:  kafkaProducer,
+		EmailSender:    emailSender,
+		RedisClient:    h.Redis,
+		TemplateCache:  h.Cache,
+		AuditPublisher: auditPublisher,
+		JWTService:     h.JWT,
+		RBACService:    rbacService,
+		Notifications:  notificationService,
+		WeeklyReports:  weeklyReports,
+		Webhooks:       webhookDispatcher,
+		Passwords:      h.Passwords,
+		SystemEmails:   systemEmails,
+		EmailBranding:  emailBranding,
+		SMSCodes:       services.NewSMSCodes(sms.NewLogSender(), cfg.Email.FromName, cfg.SMS.Timeout, false),
+		Sessions:       services.NewSessionActivity(repositories.NewSessionRepository(mongoClient), repositories.NewSettingsRepository(mongoClient)),
+		Denials:        permissionDenials,
+		Lists:          services.NewDistributionLists(repositories.NewDistributionListRepository(mongoClient), repositories.NewMongoUserRepository(mongoClient), repositories.NewEmailSuppressionRepository(mongoClient)),
+
+		AttachmentStorage: storage.NewGridFSStorage(mongoClient.DB, "attachments"),
+	})
+	// A route added without an operation in the contract fails every test
+	if err := routes.VerifyContract(router); err != nil {
+		h.t.Fatalf("testutil: the API contract is out of date:\n%v", err)
+	}
+	return router
+}
+
+// nonDatabaseChars matches what may not go in a database name
+var nonDatabaseChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// databaseName returns a database name unique to t: its name, cut to fit
+// MongoDB's 63 bytes, and a random suffix
+func databaseName(t testing.TB) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("testutil: %v", err)
+	}
+	name := nonDatabaseChars.ReplaceAllString(t.Name(), "_")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return "test_" + name + "_" + hex.EncodeToString(suffix)
+}
+
+// UserOption customizes a user created by CreateUser
+type UserOption func(*models.User)
+
+// WithTeam puts the user in team
+func WithTeam(team string) UserOption {
+	return func(u *models.User) { u.Team = team }
+}
+
+// WithTenant puts the user in tenant instead of the default tenant
+func WithTenant(tenantID string) UserOption {
+	return func(u *models.User) { u.TenantID = tenantID }
+}
+
+// WithLanguage sets the user's language preference
+func WithLanguage(language string) UserOption {
+	return func(u *models.User) {
+		if u.Preferences == nil {
+			u.Preferences = &models.MongoUserPreferences{}
+		}
+		u.Preferences.Language = language
+	}
+}
+
+// CreateUser creates an active user with role who signs in with Password
+func (h *Harness) CreateUser(emailAddress string, role models.UserRole, opts ...UserOption) *models.User {
+	h.t.Helper()
+	hash, err := h.Passwords.Hash(Password)
+	if err != nil {
+		h.t.Fatalf("testutil: %v", err)
+	}
+	user := &models.User{
+		Email:        strings.ToLower(emailAddress),
+		PasswordHash: hash,
+		Name:         strings.Split(emailAddress, "@")[0],
+		Role:         role,
+		Region:       "pan_india",
+		Permissions:  []string{},
+		IsActive:     true,
+		Status:       repositories.UserStatusActive,
+	}
+	for _, opt := range opts {
+		opt(user)
+	}
+	if err := h.Users.Create(context.Background(), user); err != nil {
+		h.t.Fatalf("testutil: failed to create user %s: %v", emailAddress, err)
+	}
+	return user
+}
+
+// Token returns an access token of user, issued for no session
+func (h *Harness) Token(user *models.User) string {
+	h.t.Helper()
+	token, err := h.JWT.GenerateAccessToken(user, "")
+	if err != nil {
+		h.t.Fatalf("testutil: failed to mint a token for %s: %v", user.Email, err)
+	}
+	return token
+}
+
+// Response is the recorded response to a request
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Decode decodes the JSON body into v, failing the test when it is not
+func (r *Response) Decode(t testing.TB, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("testutil: response %d is not the JSON expected: %v\n%s", r.Status, err, r.Body)
+	}
+}
+
+// Do serves a request without credentials. body is sent as JSON unless it
+// is nil, a string or an io.Reader.
+func (h *Harness) Do(method, path string, body interface{}) *Response {
+	h.t.Helper()
+	return h.do(method, path, body, "")
+}
+
+// DoAs serves a request as user, with an access token minted for them
+func (h *Harness) DoAs(user *models.User, method, path string, body interface{}) *Response {
+	h.t.Helper()
+	return h.do(method, path, body, h.Token(user))
+}
+
+// DoWithToken serves a request with a bearer token, such as one returned by
+// the sign-in endpoints
+func (h *Harness) DoWithToken(token, method, path string, body interface{}) *Response {
+	h.t.Helper()
+	return h.do(method, path, body, token)
+}
+
+func (h *Harness) do(method, path string, body interface{}, token string) *Response {
+	h.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case io.Reader:
+		reader = b
+	default:
+		content, err := json.Marshal(b)
+		if err != nil {
+			h.t.Fatalf("testutil: failed to encode the request body: %v", err)
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.Router.ServeHTTP(rec, req)
+	return &Response{Status: rec.Code, Header: rec.Header(), Body: rec.Body.Bytes()}
+}
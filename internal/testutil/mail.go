@@ -0,0 +1,234 @@
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MailServer is a loopback SMTP server keeping every message it is sent.
+// It offers no STARTTLS or AUTH, so pkg/smtp sends to it in plain text.
+type MailServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []*Mail
+	arrived  chan struct{} // Closed and replaced whenever a message arrives
+}
+
+// Mail is a message received by a MailServer
+type Mail struct {
+	From    string   // MAIL FROM address
+	To      []string // RCPT TO addresses
+	Subject string
+	Text    string // The text/plain body, decoded
+	HTML    string // The text/html body, decoded
+	Raw     []byte // The message as sent
+}
+
+// StartMailServer starts a MailServer on a free loopback port, stopped when
+// the test ends
+func StartMailServer(t testing.TB) *MailServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("testutil: failed to start the SMTP server: %v", err)
+	}
+	s := &MailServer{listener: listener, arrived: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// Host returns the address the server listens on
+func (s *MailServer) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the server listens on
+func (s *MailServer) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Messages returns the messages received so far, oldest first
+func (s *MailServer) Messages() []*Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Mail(nil), s.messages...)
+}
+
+// WaitFor returns the latest message to address, waiting up to timeout for
+// one to arrive; it fails the test when none does. Emails sent in the
+// background arrive after the request that sent them has returned.
+func (s *MailServer) WaitFor(t testing.TB, address string, timeout time.Duration) *Mail {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		arrived := s.arrived
+		for i := len(s.messages) - 1; i >= 0; i-- {
+			for _, to := range s.messages[i].To {
+				if strings.EqualFold(to, address) {
+					s.mu.Unlock()
+					return s.messages[i]
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-arrived:
+		case <-deadline:
+			t.Fatalf("testutil: no email to %s within %s", address, timeout)
+			return nil
+		}
+	}
+}
+
+func (s *MailServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // Closed
+		}
+		go s.session(conn)
+	}
+}
+
+// session speaks just enough SMTP for net/smtp: one or more transactions
+// of MAIL, RCPT and DATA
+func (s *MailServer) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP testutil")
+	var from string
+	var to []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			from, to = smtpPath(arg), nil
+			reply("250 OK")
+		case "RCPT":
+			to = append(to, smtpPath(arg))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			raw, err := readData(r)
+			if err != nil {
+				return
+			}
+			s.store(parseMail(from, to, raw))
+			from, to = "", nil
+			reply("250 OK")
+		case "RSET":
+			from, to = "", nil
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *MailServer) store(m *Mail) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, m)
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+}
+
+// smtpPath returns the address of a "FROM:<a@b>" or "TO:<a@b>" argument
+func smtpPath(arg string) string {
+	_, path, _ := strings.Cut(arg, ":")
+	path, _, _ = strings.Cut(strings.TrimSpace(path), " ")
+	return strings.Trim(path, "<>")
+}
+
+// readData reads a DATA section up to its terminating dot line, undoing the
+// dot-stuffing
+func readData(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return buf.Bytes(), nil
+		}
+		buf.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// parseMail decodes what the tests look at of a received message; a message
+// that does not parse keeps only its envelope and raw content
+func parseMail(from string, to []string, raw []byte) *Mail {
+	m := &Mail{From: from, To: to, Raw: raw}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return m
+	}
+	m.Subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		m.Subject = msg.Header.Get("Subject")
+	}
+	m.readPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	return m
+}
+
+// readPart keeps the text and HTML bodies of a MIME entity, descending into
+// multipart ones
+func (m *Mail) readPart(contentType, encoding string, body io.Reader) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err != nil {
+				return
+			}
+			m.readPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+		}
+	}
+	if strings.EqualFold(encoding, "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+	switch mediaType {
+	case "text/plain":
+		m.Text = string(content)
+	case "text/html":
+		m.HTML = string(content)
+	}
+}
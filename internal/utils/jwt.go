@@ -1,9 +1,18 @@
 package utils
 
 import (
-	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,79 +21,359 @@ import (
 	"github.com/white/user-management/pkg/uuid"
 )
 
-// JWTService handles JWT token generation and validation
+// Supported signing algorithms for tokens issued by this service
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmHS256 = "HS256"
+)
+
+// minHMACSecretLength is the minimum HS256 secret size (256 bits, per RFC 7518 section 3.2)
+const minHMACSecretLength = 32
+
+// DefaultIssuer is the iss claim of issued tokens when none is configured
+const DefaultIssuer = "white-api"
+
+// Errors of tokens signed by a key the service trusts but minted by another
+// issuer, such as another environment sharing the keys, or for another
+// audience
+var (
+	ErrInvalidIssuer   = errors.New("token was not issued by this service")
+	ErrInvalidAudience = errors.New("token is not meant for this service")
+)
+
+// JWTService handles JWT token generation and validation.
+// Tokens are signed with the current key and carry its ID in the kid header;
+// verification accepts any key in verifyKeys so tokens signed by a retired key
+// stay valid until that key is removed from the configuration.
 type JWTService struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
-	config     config.JWTConfig
+	signingMethod jwt.SigningMethod
+	config        config.JWTConfig
+
+	mu         sync.RWMutex
+	keyID      string                 // kid of the current signing key
+	signKey    interface{}            // *rsa.PrivateKey for RS256, []byte for HS256
+	verifyKeys map[string]interface{} // kid -> *rsa.PublicKey for RS256, []byte for HS256
 }
 
 // AccessTokenClaims represents the claims in an access token
 type AccessTokenClaims struct {
-	UserID      string   `json:"sub"` // Subject - User ID
-	Email       string   `json:"email"`
-	Name        string   `json:"name"`
-	Role        string   `json:"role"`
-	Roles       []string `json:"roles"` // Array of roles (admin, sales_rep, manager)
-	Region      string   `json:"region"`
-	Team        string   `json:"team"`
-	Permissions []string `json:"permissions"` // Array of permissions (read, write, delete)
+	UserID      string       `json:"sub"`                 // Subject - User ID
+	TenantID    string       `json:"tenant_id,omitempty"` // Tenant the user belongs to; tokens issued before tenants were recorded carry none
+	Email       string       `json:"email"`
+	Name        string       `json:"name"`
+	Role        string       `json:"role"`
+	Roles       []string     `json:"roles"` // Array of roles (admin, sales_rep, manager)
+	Region      string       `json:"region"`
+	Team        string       `json:"team"`
+	Permissions []string     `json:"permissions"`   // Array of permissions (read, write, delete)
+	Actor       *ActorClaims `json:"act,omitempty"` // Set on impersonation tokens only
+	SessionID   string       `json:"sid,omitempty"` // Session the token was issued for, by sign-in or refresh
 	jwt.RegisteredClaims
 }
 
-// NewJWTService creates a new JWT service
+// ActorClaims identify the real operator behind an impersonation token
+// (the RFC 8693 act claim). The token's subject is the impersonated user.
+type ActorClaims struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// IsImpersonation reports whether the token was issued to act as another user
+func (c *AccessTokenClaims) IsImpersonation() bool {
+	return c.Actor != nil && c.Actor.Subject != ""
+}
+
+// NewJWTService creates a new JWT service.
+// RS256 (the default) signs with the PEM key pair at PrivateKeyPath/PublicKeyPath;
+// HS256 signs with Secret. Mixing key files and a secret is rejected as ambiguous.
 func NewJWTService(cfg config.JWTConfig) (*JWTService, error) {
+	algorithm := strings.ToUpper(strings.TrimSpace(cfg.Algorithm))
+	if algorithm == "" {
+		algorithm = AlgorithmRS256
+	}
+	cfg.Algorithm = algorithm
+	if cfg.Issuer == "" {
+		cfg.Issuer = DefaultIssuer
+	}
+
+	switch algorithm {
+	case AlgorithmRS256:
+		if cfg.Secret != "" {
+			return nil, fmt.Errorf("ambiguous JWT configuration: a secret is set but the algorithm is RS256 (set the algorithm to HS256 or remove the secret)")
+		}
+		if cfg.PrivateKeyPath == "" || cfg.PublicKeyPath == "" {
+			return nil, fmt.Errorf("incomplete JWT configuration: RS256 requires both a private and a public key path")
+		}
+		return newRSAJWTService(cfg)
+
+	case AlgorithmHS256:
+		if cfg.PrivateKeyPath != "" || cfg.PublicKeyPath != "" {
+			return nil, fmt.Errorf("ambiguous JWT configuration: key paths are set but the algorithm is HS256 (remove the key paths or use RS256)")
+		}
+		if len(cfg.Secret) < minHMACSecretLength {
+			return nil, fmt.Errorf("incomplete JWT configuration: HS256 requires a secret of at least %d bytes", minHMACSecretLength)
+		}
+		if len(cfg.VerificationKeyPaths) > 0 || cfg.VerificationKeysDir != "" {
+			return nil, fmt.Errorf("ambiguous JWT configuration: verification key files are only supported with RS256")
+		}
+		secret := []byte(cfg.Secret)
+		keyID := cfg.KeyID
+		if keyID == "" {
+			keyID = keyThumbprint(secret)
+		}
+		return &JWTService{
+			signingMethod: jwt.SigningMethodHS256,
+			config:        cfg,
+			keyID:         keyID,
+			signKey:       secret,
+			verifyKeys:    map[string]interface{}{keyID: secret},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported JWT algorithm %q (supported: %s, %s)", cfg.Algorithm, AlgorithmRS256, AlgorithmHS256)
+}
+
+// newRSAJWTService loads the RSA key pair from disk
+func newRSAJWTService(cfg config.JWTConfig) (*JWTService, error) {
+	s := &JWTService{
+		signingMethod: jwt.SigningMethodRS256,
+		config:        cfg,
+	}
+	if err := s.loadRSAKeys(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadRSAKeys reads the signing key pair and every verification key from disk
+// and swaps them in atomically. On error the previously loaded keys are kept.
+func (s *JWTService) loadRSAKeys() error {
+	cfg := s.config
+
 	// Read private key
 	privateKeyData, err := os.ReadFile(cfg.PrivateKeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key: %w", err)
+		return fmt.Errorf("failed to read private key: %w", err)
 	}
 
 	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return fmt.Errorf("failed to parse private key: %w", err)
 	}
 
 	// Read public key
 	publicKeyData, err := os.ReadFile(cfg.PublicKeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read public key: %w", err)
+		return fmt.Errorf("failed to read public key: %w", err)
 	}
 
 	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	if !privateKey.PublicKey.Equal(publicKey) {
+		return fmt.Errorf("public key does not match private key")
+	}
+
+	keyID := cfg.KeyID
+	if keyID == "" {
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return fmt.Errorf("failed to encode public key: %w", err)
+		}
+		keyID = keyThumbprint(der)
+	}
+
+	verifyKeys := map[string]interface{}{keyID: publicKey}
+
+	// Previous (or upcoming) public keys accepted during a rotation grace window
+	for kid, path := range cfg.VerificationKeyPaths {
+		if kid == keyID {
+			return fmt.Errorf("verification key %q has the same key ID as the signing key", kid)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read verification key %q: %w", kid, err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse verification key %q: %w", kid, err)
+		}
+		verifyKeys[kid] = key
 	}
 
-	return &JWTService{
-		privateKey: privateKey,
-		publicKey:  publicKey,
-		config:     cfg,
-	}, nil
+	// Every <kid>.pem in the verification keys directory, re-scanned on reload
+	// so keys can be added or retired by managing files
+	if cfg.VerificationKeysDir != "" {
+		paths, err := filepath.Glob(filepath.Join(cfg.VerificationKeysDir, "*.pem"))
+		if err != nil {
+			return fmt.Errorf("failed to list verification keys: %w", err)
+		}
+		for _, path := range paths {
+			kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+			if _, exists := verifyKeys[kid]; exists {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read verification key %q: %w", kid, err)
+			}
+			key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+			if err != nil {
+				return fmt.Errorf("failed to parse verification key %q: %w", kid, err)
+			}
+			verifyKeys[kid] = key
+		}
+	}
+
+	s.mu.Lock()
+	s.keyID = keyID
+	s.signKey = privateKey
+	s.verifyKeys = verifyKeys
+	s.mu.Unlock()
+
+	return nil
 }
 
-// GenerateRefreshToken generates a new refresh token
-func (s *JWTService) GenerateAccessToken(user *models.User) (string, error) {
+// ReloadKeys re-reads the key files so a rotated key pair (or a retired
+// verification key) takes effect without restarting the process
+func (s *JWTService) ReloadKeys() error {
+	if s.Algorithm() != AlgorithmRS256 {
+		return fmt.Errorf("key reload is only supported for RS256 (secrets are read at startup)")
+	}
+	return s.loadRSAKeys()
+}
+
+// KeyID returns the kid of the current signing key
+func (s *JWTService) KeyID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyID
+}
+
+// VerificationKeyIDs returns the kids of every key accepted for verification
+func (s *JWTService) VerificationKeyIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.verifyKeys))
+	for kid := range s.verifyKeys {
+		ids = append(ids, kid)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// hasKey reports whether kid belongs to one of this service's verification keys
+func (s *JWTService) hasKey(kid string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.verifyKeys[kid]
+	return ok
+}
+
+// keyThumbprint derives a stable key ID from key material
+func keyThumbprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:16]
+}
+
+// Algorithm returns the signing algorithm of tokens issued by this service
+func (s *JWTService) Algorithm() string {
+	return s.signingMethod.Alg()
+}
+
+// keyFunc returns the verification key, rejecting any token whose alg header
+// differs from the configured algorithm (prevents algorithm-confusion attacks
+// such as an HS256 token signed with the RSA public key)
+func (s *JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != s.signingMethod.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// Tokens issued before key IDs were introduced were signed by the current key
+		return s.verifyKeys[s.keyID], nil
+	}
+
+	key, ok := s.verifyKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	return key, nil
+}
+
+// sign signs claims with the current key and embeds its kid header
+func (s *JWTService) sign(claims jwt.Claims) (string, error) {
+	s.mu.RLock()
+	keyID, signKey := s.keyID, s.signKey
+	s.mu.RUnlock()
+
+	token := jwt.NewWithClaims(s.signingMethod, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(signKey)
+}
+
+// GenerateAccessToken generates a new access token for user's session
+// sessionID, so requests made with it count as activity of the session
+func (s *JWTService) GenerateAccessToken(user *models.User, sessionID string) (string, error) {
 
 	expiryMinutes := time.Duration(s.config.AccessTokenExpiry) * time.Minute
 
 	claims := AccessTokenClaims{
 		UserID:      user.ID,
+		TenantID:    user.Tenant(),
 		Email:       user.Email,
 		Name:        user.Name,
-		Role:        user.Role,
+		Role:        string(user.Role),
 		Region:      user.Region,
 		Team:        user.Team,
 		Permissions: user.Permissions,
+		SessionID:   sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiryMinutes)),
-			Issuer:    "white-api",
+			Issuer:    s.config.Issuer,
+			Audience:  s.audience(),
+		},
+	}
+
+	return s.sign(claims)
+}
+
+// GenerateImpersonationToken generates an access token for target on behalf
+// of actor. The token ID is the impersonation session ID and no refresh
+// token is issued, so the token dies with the session.
+func (s *JWTService) GenerateImpersonationToken(target, actor *models.User, sessionID string, expiresAt time.Time) (string, error) {
+	claims := AccessTokenClaims{
+		UserID:      target.ID,
+		TenantID:    target.Tenant(),
+		Email:       target.Email,
+		Name:        target.Name,
+		Role:        string(target.Role),
+		Region:      target.Region,
+		Team:        target.Team,
+		Permissions: target.Permissions,
+		Actor: &ActorClaims{
+			Subject: actor.ID,
+			Email:   actor.Email,
+			Name:    actor.Name,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Issuer:    s.config.Issuer,
+			Audience:  s.audience(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(s.privateKey)
+	return s.sign(claims)
 }
 
 // GenerateRefreshToken generates a new refresh token
@@ -92,30 +381,30 @@ func (s *JWTService) GenerateRefreshToken(user *models.User) (string, error) {
 	expiryDays := time.Duration(s.config.RefreshTokenExpiry) * 24 * time.Hour
 
 	claims := jwt.RegisteredClaims{
+		// Unique per token, so two sign-ins in the same second get sessions of their own
+		ID:        uuid.MustNewUUID(),
 		Subject:   user.ID,
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiryDays)),
-		Issuer:    "white-api",
+		Issuer:    s.config.Issuer,
+		Audience:  s.audience(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(s.privateKey)
+	return s.sign(claims)
 }
 
 // ValidateAccessToken validates an access token and returns the claims
 func (s *JWTService) ValidateAccessToken(tokenString string) (*AccessTokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &AccessTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.publicKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &AccessTokenClaims{}, s.keyFunc, jwt.WithValidMethods([]string{s.signingMethod.Alg()}))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if claims, ok := token.Claims.(*AccessTokenClaims); ok && token.Valid {
+		if err := s.checkIssuerAudience(&claims.RegisteredClaims, claims.UserID); err != nil {
+			return nil, err
+		}
 		return claims, nil
 	}
 
@@ -124,19 +413,17 @@ func (s *JWTService) ValidateAccessToken(tokenString string) (*AccessTokenClaims
 
 // ValidateRefreshToken validates a refresh token and returns the user ID
 func (s *JWTService) ValidateRefreshToken(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.publicKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, s.keyFunc, jwt.WithValidMethods([]string{s.signingMethod.Alg()}))
 	if err != nil {
 		return "", fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
+		if err := s.checkIssuerAudience(claims, claims.Subject); err != nil {
+			return "", err
+		}
 		userId := claims.Subject
-		if _, err := uuid.ValidateUUID(userId); err != nil {
+		if err := uuid.ValidateUUID(userId); err != nil {
 			return "", fmt.Errorf("invalid user ID in token: %w", err)
 		}
 		return userId, nil
@@ -144,6 +431,55 @@ func (s *JWTService) ValidateRefreshToken(tokenString string) (string, error) {
 	return "", fmt.Errorf("invalid token")
 }
 
+// audience returns the aud claim of issued tokens, none when unconfigured
+func (s *JWTService) audience() jwt.ClaimStrings {
+	if s.config.Audience == "" {
+		return nil
+	}
+	return jwt.ClaimStrings{s.config.Audience}
+}
+
+// checkIssuerAudience checks the iss and aud of a token signed by one of
+// the service's keys against the configured ones. While AllowMissingClaims
+// is set a token without them, minted before they were configured, is
+// accepted with a warning; one carrying other values never is, even if
+// it lacks the other claim.
+func (s *JWTService) checkIssuerAudience(claims *jwt.RegisteredClaims, subject string) error {
+	if claims.Issuer != "" && claims.Issuer != s.config.Issuer {
+		return ErrInvalidIssuer
+	}
+	if s.config.Audience != "" && len(claims.Audience) > 0 && !slices.Contains(claims.Audience, s.config.Audience) {
+		return ErrInvalidAudience
+	}
+	if s.missingClaims(claims) {
+		if !s.config.AllowMissingClaims {
+			if claims.Issuer == "" {
+				return ErrInvalidIssuer
+			}
+			return ErrInvalidAudience
+		}
+		log.Printf("Warning: accepted a token of user %s without iss or aud claims; JWT_ALLOW_MISSING_CLAIMS is on", subject)
+	}
+	return nil
+}
+
+// missingClaims reports whether a token lacks the iss or aud claim the
+// service would have set when minting it
+func (s *JWTService) missingClaims(claims *jwt.RegisteredClaims) bool {
+	return claims.Issuer == "" || (s.config.Audience != "" && len(claims.Audience) == 0)
+}
+
+// IsLegacyToken reports whether a token, already validated, was minted
+// without the iss or aud claims the service sets now, so it can be
+// replaced by one that has them
+func (s *JWTService) IsLegacyToken(tokenString string) bool {
+	var claims jwt.RegisteredClaims
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, &claims); err != nil {
+		return false
+	}
+	return s.missingClaims(&claims)
+}
+
 func (s *JWTService) ValidateTokenAndGetUserID(tokenString string) (string, error) {
 
 	claims, err := s.ValidateAccessToken(tokenString)
@@ -152,7 +488,7 @@ func (s *JWTService) ValidateTokenAndGetUserID(tokenString string) (string, erro
 	}
 
 	userId := claims.Subject
-	if _, err := uuid.ValidateUUID(userId); err != nil {
+	if err := uuid.ValidateUUID(userId); err != nil {
 		return "", fmt.Errorf("invalid user ID in token: %w", err)
 	}
 
@@ -175,6 +511,9 @@ func (s *JWTService) ValidateAccessTokenDualAlg(tokenString string, jwksCache *J
 		// If JWKS cache isn't configured, fall back to validating with the service's public key.
 		// This keeps RS256 working in local/dev environments without JWKS.
 		if jwksCache == nil {
+			if s.Algorithm() != AlgorithmRS256 {
+				return nil, fmt.Errorf("RS256 tokens are not accepted: service is configured for %s and no JWKS is available", s.Algorithm())
+			}
 			return s.ValidateAccessToken(tokenString)
 		}
 
@@ -188,6 +527,14 @@ func (s *JWTService) ValidateAccessTokenDualAlg(tokenString string, jwksCache *J
 
 	// Handle HS256 (shared secret)
 	if algorithm == "HS256" {
+		// Tokens issued by this service when it signs with HS256
+		if s.Algorithm() == AlgorithmHS256 {
+			claims, err := s.ValidateAccessToken(tokenString)
+			if err == nil || sharedSecret == "" || errors.Is(err, ErrInvalidIssuer) || errors.Is(err, ErrInvalidAudience) {
+				return claims, err
+			}
+		}
+
 		if sharedSecret == "" {
 			return nil, fmt.Errorf("shared secret not configured for HS256 validation")
 		}
@@ -214,7 +561,10 @@ func (s *JWTService) validateRS256WithJWKS(tokenString string, jwksCache *JWKSCa
 	// Get kid from header
 	kidInterface, exists := unverifiedToken.Header["kid"]
 	if !exists {
-		// If no kid, try using the service's public key
+		// If no kid, try using the service's public key (only held in RS256 mode)
+		if s.Algorithm() != AlgorithmRS256 {
+			return nil, fmt.Errorf("RS256 token without kid cannot be verified in %s mode", s.Algorithm())
+		}
 		return s.ValidateAccessToken(tokenString)
 	}
 
@@ -223,6 +573,11 @@ func (s *JWTService) validateRS256WithJWKS(tokenString string, jwksCache *JWKSCa
 		return nil, fmt.Errorf("invalid kid type in token header")
 	}
 
+	// Tokens signed by one of our own keys are verified locally
+	if s.Algorithm() == AlgorithmRS256 && s.hasKey(kid) {
+		return s.ValidateAccessToken(tokenString)
+	}
+
 	// Get public key from JWKS cache
 	publicKey, err := jwksCache.GetPublicKey(kid)
 	if err != nil {
@@ -235,7 +590,7 @@ func (s *JWTService) validateRS256WithJWKS(tokenString string, jwksCache *JWKSCa
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return publicKey, nil
-	})
+	}, jwt.WithValidMethods([]string{AlgorithmRS256}))
 
 	if err != nil {
 		return nil, fmt.Errorf("token validation failed: %w", err)
@@ -255,7 +610,7 @@ func (s *JWTService) validateHS256(tokenString string, sharedSecret string) (*Ac
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(sharedSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{AlgorithmHS256}))
 
 	if err != nil {
 		return nil, fmt.Errorf("token validation failed: %w", err)
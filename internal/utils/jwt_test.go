@@ -0,0 +1,439 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/white/user-management/config"
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/uuid"
+)
+
+const testSecret = "utils-tests-only-secret-0123456789abcdef"
+
+func hmacConfig() config.JWTConfig {
+	return config.JWTConfig{
+		Algorithm:          AlgorithmHS256,
+		Secret:             testSecret,
+		AccessTokenExpiry:  15,
+		RefreshTokenExpiry: 7,
+	}
+}
+
+func testUser() *models.User {
+	return &models.User{ID: uuid.MustNewUUID(), Email: "dana@example.test", Name: "Dana Reyes", Role: models.UserRoleSalesRep, TenantID: "acme"}
+}
+
+// writeKeyPair writes a new RSA key pair to dir as <name>.key and
+// <name>.pem and returns their paths
+func writeKeyPair(t *testing.T, dir, name string) (privatePath, publicPath string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePath = filepath.Join(dir, name+".key")
+	publicPath = filepath.Join(dir, name+".pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestNewJWTServiceRejectsAmbiguousConfigurations(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, publicPath := writeKeyPair(t, dir, "signing")
+	tests := []struct {
+		name   string
+		modify func(*config.JWTConfig)
+		errMsg string
+	}{
+		{"short secret", func(c *config.JWTConfig) { c.Secret = "too short" }, "at least 32 bytes"},
+		{"HS256 with key files", func(c *config.JWTConfig) { c.PrivateKeyPath, c.PublicKeyPath = privatePath, publicPath }, "key paths are set"},
+		{"RS256 with a secret", func(c *config.JWTConfig) {
+			c.Algorithm = AlgorithmRS256
+			c.PrivateKeyPath, c.PublicKeyPath = privatePath, publicPath
+		}, "a secret is set"},
+		{"RS256 without keys", func(c *config.JWTConfig) { c.Algorithm, c.Secret = "", "" }, "requires both a private and a public key"},
+		{"unknown algorithm", func(c *config.JWTConfig) { c.Algorithm = "ES256" }, "unsupported JWT algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := hmacConfig()
+			tt.modify(&cfg)
+			_, err := NewJWTService(cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("NewJWTService = %v, want an error about %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestHS256TokensRoundTrip(t *testing.T) {
+	cfg := hmacConfig()
+	cfg.Algorithm = "hs256"
+	s, err := NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Algorithm() != AlgorithmHS256 {
+		t.Errorf("Algorithm = %s, want HS256", s.Algorithm())
+	}
+	user := testUser()
+
+	access, err := s.GenerateAccessToken(user, "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.ValidateAccessToken(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != user.ID || claims.TenantID != "acme" || claims.SessionID != "session-1" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	refresh, err := s.GenerateRefreshToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, err := s.ValidateRefreshToken(refresh); err != nil || userID != user.ID {
+		t.Errorf("ValidateRefreshToken = %q, %v; want %s", userID, err, user.ID)
+	}
+	// Sessions are found by their refresh token, so two in the same second
+	// must differ
+	if again, _ := s.GenerateRefreshToken(user); again == refresh {
+		t.Error("two refresh tokens minted at once are identical")
+	}
+
+	other := hmacConfig()
+	other.Secret = strings.Repeat("x", 40)
+	forger, err := NewJWTService(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := forger.GenerateAccessToken(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateAccessToken(forged); err == nil {
+		t.Error("a token signed with another secret was accepted")
+	}
+}
+
+// TestRS256ServiceRejectsHMACTokens guards against algorithm confusion: an
+// HS256 token signed with the RSA public key as the secret must not pass
+func TestRS256ServiceRejectsHMACTokens(t *testing.T) {
+	privatePath, publicPath := writeKeyPair(t, t.TempDir(), "signing")
+	s, err := NewJWTService(config.JWTConfig{PrivateKeyPath: privatePath, PublicKeyPath: publicPath, AccessTokenExpiry: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := os.ReadFile(publicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := testUser()
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessTokenClaims{
+		UserID: user.ID,
+		Role:   string(models.UserRoleAdmin),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateAccessToken(forged); err == nil {
+		t.Error("an HS256 token signed with the public key was accepted")
+	}
+}
+
+// TestKeyRotation signs with a new key while tokens of the retired key stay
+// valid until its public key is removed and the keys are reloaded
+func TestKeyRotation(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	oldPrivate, oldPublic := writeKeyPair(t, oldDir, "old")
+	newPrivate, newPublic := writeKeyPair(t, newDir, "new")
+	user := testUser()
+
+	before, err := NewJWTService(config.JWTConfig{PrivateKeyPath: oldPrivate, PublicKeyPath: oldPublic, KeyID: "old", AccessTokenExpiry: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.GenerateAccessToken(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewJWTService(config.JWTConfig{
+		PrivateKeyPath:      newPrivate,
+		PublicKeyPath:       newPublic,
+		KeyID:               "new",
+		VerificationKeysDir: oldDir,
+		AccessTokenExpiry:   15,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := after.VerificationKeyIDs(); strings.Join(got, ",") != "new,old" {
+		t.Errorf("VerificationKeyIDs = %v, want new and old", got)
+	}
+	newToken, err := after.GenerateAccessToken(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := new(jwt.Parser).ParseUnverified(newToken, &AccessTokenClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != "new" {
+		t.Errorf("kid = %v, want the current key", kid)
+	}
+	for name, tokenString := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := after.ValidateAccessToken(tokenString); err != nil {
+			t.Errorf("token of the %s key: %v", name, err)
+		}
+	}
+	if _, err := before.ValidateAccessToken(newToken); err == nil {
+		t.Error("a service without the new key accepted its token")
+	}
+
+	if err := os.Remove(filepath.Join(oldDir, "old.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := after.ReloadKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.ValidateAccessToken(oldToken); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Errorf("token of the retired key = %v, want an unknown signing key", err)
+	}
+	if _, err := after.ValidateAccessToken(newToken); err != nil {
+		t.Errorf("token of the current key after the reload: %v", err)
+	}
+}
+
+// TestTokensWithoutKeyIDUseTheSigningKey accepts tokens minted before key
+// IDs were introduced, which were signed by the current key
+func TestTokensWithoutKeyIDUseTheSigningKey(t *testing.T) {
+	s, err := NewJWTService(hmacConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := testUser()
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessTokenClaims{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateAccessToken(legacy); err != nil {
+		t.Errorf("a token without kid was rejected: %v", err)
+	}
+	if err := s.ReloadKeys(); err == nil {
+		t.Error("ReloadKeys of an HS256 service succeeded; secrets are only read at startup")
+	}
+}
+
+func TestVerificationKeyMayNotReuseTheSigningKeyID(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, publicPath := writeKeyPair(t, dir, "signing")
+	_, otherPublic := writeKeyPair(t, dir, "other")
+	_, err := NewJWTService(config.JWTConfig{
+		PrivateKeyPath:       privatePath,
+		PublicKeyPath:        publicPath,
+		KeyID:                "current",
+		VerificationKeyPaths: map[string]string{"current": otherPublic},
+	})
+	if err == nil || !strings.Contains(err.Error(), "same key ID") {
+		t.Errorf("NewJWTService = %v, want a key ID clash", err)
+	}
+}
+
+// signedClaims signs claims with the HS256 test secret and key ID, as a
+// token minted by another instance sharing the keys would be
+func signedClaims(t *testing.T, s *JWTService, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = s.KeyID()
+	signed, err := token.SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func audienceConfig() config.JWTConfig {
+	cfg := hmacConfig()
+	cfg.Issuer = "white-api-production"
+	cfg.Audience = "white-crm"
+	return cfg
+}
+
+func TestIssuedTokensCarryIssuerAndAudience(t *testing.T) {
+	s, err := NewJWTService(audienceConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := testUser()
+	access, err := s.GenerateAccessToken(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.ValidateAccessToken(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != "white-api-production" || strings.Join(claims.Audience, ",") != "white-crm" {
+		t.Errorf("iss %q, aud %v; want the configured ones", claims.Issuer, claims.Audience)
+	}
+	refresh, err := s.GenerateRefreshToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.IsLegacyToken(access) || s.IsLegacyToken(refresh) {
+		t.Error("a token minted with iss and aud is reported as legacy")
+	}
+
+	// Without configuration tokens carry the default issuer and no audience
+	plain, err := NewJWTService(hmacConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err = plain.GenerateAccessToken(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := plain.ValidateAccessToken(access); err != nil || claims.Issuer != DefaultIssuer || claims.Audience != nil {
+		t.Errorf("unconfigured claims = %+v, %v; want iss %s and no aud", claims, err, DefaultIssuer)
+	}
+}
+
+// TestTokensOfOtherIssuersAndAudiencesAreRejected signs tokens with the
+// service's own key, as a staging instance sharing it would, and checks
+// they are refused for their claims alone
+func TestTokensOfOtherIssuersAndAudiencesAreRejected(t *testing.T) {
+	for _, allowMissing := range []bool{false, true} {
+		cfg := audienceConfig()
+		cfg.AllowMissingClaims = allowMissing
+		s, err := NewJWTService(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := testUser()
+		expires := jwt.NewNumericDate(time.Now().Add(time.Hour))
+		for _, tt := range []struct {
+			name     string
+			issuer   string
+			audience jwt.ClaimStrings
+			want     error
+		}{
+			{"staging issuer", "white-api-staging", jwt.ClaimStrings{"white-crm"}, ErrInvalidIssuer},
+			{"staging issuer without aud", "white-api-staging", nil, ErrInvalidIssuer},
+			{"partner audience", "white-api-production", jwt.ClaimStrings{"partner-portal"}, ErrInvalidAudience},
+			{"partner audience without iss", "", jwt.ClaimStrings{"partner-portal"}, ErrInvalidAudience},
+		} {
+			registered := jwt.RegisteredClaims{Subject: user.ID, Issuer: tt.issuer, Audience: tt.audience, ExpiresAt: expires}
+			access := signedClaims(t, s, AccessTokenClaims{UserID: user.ID, RegisteredClaims: registered})
+			if _, err := s.ValidateAccessToken(access); !errors.Is(err, tt.want) {
+				t.Errorf("transition %v, %s access token = %v, want %v", allowMissing, tt.name, err, tt.want)
+			}
+			if _, err := s.ValidateRefreshToken(signedClaims(t, s, registered)); !errors.Is(err, tt.want) {
+				t.Errorf("transition %v, %s refresh token = %v, want %v", allowMissing, tt.name, err, tt.want)
+			}
+		}
+
+		// A token for several audiences is accepted if this service is one
+		shared := signedClaims(t, s, AccessTokenClaims{UserID: user.ID, RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: "white-api-production", Audience: jwt.ClaimStrings{"partner-portal", "white-crm"}, ExpiresAt: expires,
+		}})
+		if _, err := s.ValidateAccessToken(shared); err != nil {
+			t.Errorf("transition %v, token for two audiences: %v", allowMissing, err)
+		}
+	}
+}
+
+// TestAllowMissingClaimsTransition checks tokens minted before iss and aud
+// were configured are accepted while the transition window is open, and
+// refused once it is closed
+func TestAllowMissingClaimsTransition(t *testing.T) {
+	user := testUser()
+	expires := jwt.NewNumericDate(time.Now().Add(time.Hour))
+	for _, tt := range []struct {
+		name   string
+		claims jwt.RegisteredClaims
+		closed error
+	}{
+		{"no claims", jwt.RegisteredClaims{Subject: user.ID, ExpiresAt: expires}, ErrInvalidIssuer},
+		{"no aud", jwt.RegisteredClaims{Subject: user.ID, Issuer: "white-api-production", ExpiresAt: expires}, ErrInvalidAudience},
+		{"no iss", jwt.RegisteredClaims{Subject: user.ID, Audience: jwt.ClaimStrings{"white-crm"}, ExpiresAt: expires}, ErrInvalidIssuer},
+	} {
+		open := audienceConfig()
+		open.AllowMissingClaims = true
+		during, err := NewJWTService(open)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := NewJWTService(audienceConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		access := signedClaims(t, during, AccessTokenClaims{UserID: user.ID, RegisteredClaims: tt.claims})
+		refresh := signedClaims(t, during, tt.claims)
+
+		if _, err := during.ValidateAccessToken(access); err != nil {
+			t.Errorf("%s access token during the transition: %v", tt.name, err)
+		}
+		if userID, err := during.ValidateRefreshToken(refresh); err != nil || userID != user.ID {
+			t.Errorf("%s refresh token during the transition = %q, %v", tt.name, userID, err)
+		}
+		if !during.IsLegacyToken(refresh) {
+			t.Errorf("%s refresh token not reported as legacy, so refreshing would not replace it", tt.name)
+		}
+
+		if _, err := after.ValidateAccessToken(access); !errors.Is(err, tt.closed) {
+			t.Errorf("%s access token after the transition = %v, want %v", tt.name, err, tt.closed)
+		}
+		if _, err := after.ValidateRefreshToken(refresh); !errors.Is(err, tt.closed) {
+			t.Errorf("%s refresh token after the transition = %v, want %v", tt.name, err, tt.closed)
+		}
+	}
+}
+
+// TestDualAlgKeepsIssuerErrors checks a token of the service's own HS256
+// key refused for its issuer is not retried against the shared secret,
+// which would accept it
+func TestDualAlgKeepsIssuerErrors(t *testing.T) {
+	s, err := NewJWTService(audienceConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := testUser()
+	staging := signedClaims(t, s, AccessTokenClaims{UserID: user.ID, RegisteredClaims: jwt.RegisteredClaims{
+		Issuer: "white-api-staging", Audience: jwt.ClaimStrings{"white-crm"}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	if _, err := s.ValidateAccessTokenDualAlg(staging, nil, testSecret); !errors.Is(err, ErrInvalidIssuer) {
+		t.Errorf("ValidateAccessTokenDualAlg = %v, want ErrInvalidIssuer", err)
+	}
+}
@@ -0,0 +1,344 @@
+// Package validation checks request DTOs against the rules declared in their
+// validate struct tags, for example
+//
+//	Email string   `json:"email" validate:"required,email,max=254"`
+//	Role  string   `json:"role" validate:"omitempty,oneof=admin user"`
+//	IDs   []string `json:"ids" validate:"required,max=100,dive,uuid"`
+//
+// Rules run left to right and the first one a field breaks is reported:
+//
+//	required   not the zero value; strings must hold more than whitespace,
+//	           pointers must be set and slices and maps must not be empty
+//	omitempty  skip the remaining rules when the field is empty
+//	email      a bare address such as jane@example.com
+//	oneof=a b  one of the space-separated values
+//	min=n      at least n characters, items or, for numbers, n
+//	max=n      at most n characters, items or, for numbers, n
+//	uuid       a UUID
+//	url        an absolute http or https URL
+//	https_url  an absolute https URL
+//	hexcolor   a hex color such as #1a73e8 or #fff
+//	e164       a phone number in E.164 form such as +14155550123
+//	dive       apply the rules after it to every element of a slice or map
+//
+// Nested structs, pointers to them and slices of them are checked too, with
+// their fields reported as parent.field and parent[i].field, unless the
+// field is tagged validate:"-". Fields are reported by their JSON name, so
+// the messages match what the client sent.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// Errors maps the JSON path of each invalid field to why it is invalid
+type Errors map[string]string
+
+// Error lists the invalid fields in path order
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field + " " + e[field]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Struct validates v, a struct or a pointer to one. It returns Errors when
+// a field breaks its rules, and a plain error when a tag is malformed.
+func Struct(v interface{}) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validation: %T is not a struct", v)
+	}
+
+	errs := Errors{}
+	if err := checkStruct(value, "", errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var hexColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+func checkStruct(value reflect.Value, prefix string, errs Errors) error {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := value.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := checkStruct(fv, prefix, errs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := jsonName(field)
+		tag := field.Tag.Get("validate")
+		if name == "" || tag == "-" {
+			continue
+		}
+		path := prefix + name
+
+		if tag != "" {
+			msg, err := checkRules(fv, strings.Split(tag, ","))
+			if err != nil {
+				return fmt.Errorf("validation: %s.%s: %w", t.Name(), field.Name, err)
+			}
+			if msg != "" {
+				errs[path] = msg
+				continue
+			}
+		}
+		if err := checkNested(fv, path, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNested checks the fields of a struct, pointer to struct or slice of
+// structs held by a field
+func checkNested(value reflect.Value, path string, errs Errors) error {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() == timeType {
+			return nil
+		}
+		return checkStruct(value, path+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := checkNested(value.Index(i), fmt.Sprintf("%s[%d]", path, i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkRules returns why value breaks rules, or "" when it does not
+func checkRules(value reflect.Value, rules []string) (string, error) {
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if isEmpty(value) {
+				return "", nil
+			}
+		case "dive":
+			return checkElements(value, rules[i+1:])
+		default:
+			msg, err := checkRule(value, name, param)
+			if err != nil || msg != "" {
+				return msg, err
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkElements applies rules to every element of a slice or map
+func checkElements(value reflect.Value, rules []string) (string, error) {
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			msg, err := checkRules(value.Index(i), rules)
+			if err != nil || msg != "" {
+				return fmt.Sprintf("item %d %s", i+1, msg), err
+			}
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			msg, err := checkRules(iter.Value(), rules)
+			if err != nil || msg != "" {
+				return fmt.Sprintf("entry %v %s", iter.Key(), msg), err
+			}
+		}
+	case reflect.Invalid:
+	default:
+		return "", fmt.Errorf("dive on %s", value.Kind())
+	}
+	return "", nil
+}
+
+func checkRule(value reflect.Value, name, param string) (string, error) {
+	if name == "required" {
+		if isEmpty(value) {
+			return "is required", nil
+		}
+		return "", nil
+	}
+
+	value = indirect(value)
+	if value.Kind() == reflect.Invalid {
+		return "", nil // Unset optional pointer
+	}
+
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s needs a number, got %q", name, param)
+		}
+		return checkBound(value, name, limit, param)
+	case "oneof":
+		options := strings.Fields(param)
+		s := fmt.Sprint(value.Interface())
+		for _, option := range options {
+			if s == option {
+				return "", nil
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", "), nil
+	}
+
+	if value.Kind() != reflect.String {
+		return "", fmt.Errorf("%s applies to strings, not %s", name, value.Kind())
+	}
+	s := value.String()
+	switch name {
+	case "email":
+		if !IsEmail(s) {
+			return "must be a valid email address", nil
+		}
+	case "uuid":
+		if err := uuid.ValidateUUID(s); err != nil {
+			return "must be a UUID", nil
+		}
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an http or https URL", nil
+		}
+	case "https_url":
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return "must be an https URL", nil
+		}
+	case "hexcolor":
+		if !hexColor.MatchString(s) {
+			return "must be a hex color such as #1a73e8", nil
+		}
+	case "e164":
+		if !e164.MatchString(s) {
+			return "must be a phone number in international format such as +14155550123", nil
+		}
+	default:
+		return "", fmt.Errorf("unknown rule %q", name)
+	}
+	return "", nil
+}
+
+func checkBound(value reflect.Value, name string, limit float64, param string) (string, error) {
+	var n float64
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, unit = float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		return "", fmt.Errorf("%s does not apply to %s", name, value.Kind())
+	}
+
+	if name == "min" && n < limit {
+		return "must be at least " + param + unit, nil
+	}
+	if name == "max" && n > limit {
+		return "must be at most " + param + unit, nil
+	}
+	return "", nil
+}
+
+// IsEmail reports whether s is a bare email address, without a display name
+// or angle brackets
+func IsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s && strings.Contains(addr.Address[strings.LastIndex(addr.Address, "@"):], ".")
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// jsonName returns the JSON name of a field, or "" when it is not decoded
+func jsonName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return field.Name
+}
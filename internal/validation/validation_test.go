@@ -0,0 +1,123 @@
+package validation
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"omitempty,oneof=IN US"`
+}
+
+type signup struct {
+	Email      string            `json:"email" validate:"required,email,max=254"`
+	Name       string            `json:"name" validate:"required,min=2,max=10"`
+	Role       string            `json:"role" validate:"omitempty,oneof=admin sales_rep"`
+	ManagerID  string            `json:"managerId" validate:"omitempty,uuid"`
+	Website    string            `json:"website,omitempty" validate:"omitempty,url"`
+	Webhook    string            `json:"webhook,omitempty" validate:"omitempty,https_url"`
+	Color      string            `json:"color,omitempty" validate:"omitempty,hexcolor"`
+	Phone      string            `json:"phone,omitempty" validate:"omitempty,e164"`
+	Age        *int              `json:"age,omitempty" validate:"omitempty,min=18,max=120"`
+	Tags       []string          `json:"tags,omitempty" validate:"max=3,dive,required,max=5"`
+	Labels     map[string]string `json:"labels,omitempty" validate:"dive,max=3"`
+	Home       *address          `json:"home,omitempty"`
+	Offices    []address         `json:"offices,omitempty"`
+	Internal   string            `json:"internal" validate:"-"`
+	Ignored    string            `json:"-" validate:"required"`
+	Untagged   string            `validate:"max=1"`
+	unexported string            `validate:"required"`
+}
+
+func valid() signup {
+	return signup{Email: "jane@example.com", Name: "Jane"}
+}
+
+func TestStruct(t *testing.T) {
+	age := func(n int) *int { return &n }
+
+	for _, tt := range []struct {
+		name string
+		edit func(s *signup)
+		want Errors
+	}{
+		{"valid", func(s *signup) {}, nil},
+		{"every optional rule met", func(s *signup) {
+			s.Role, s.ManagerID = "admin", "123e4567-e89b-12d3-a456-426614174000"
+			s.Website, s.Webhook = "http://example.com/a", "https://example.com/hook"
+			s.Color, s.Phone, s.Age = "#1a73e8", "+14155550123", age(30)
+			s.Tags, s.Labels = []string{"a", "bb"}, map[string]string{"k": "v"}
+			s.Home, s.Offices = &address{City: "Pune", Country: "IN"}, []address{{City: "Austin"}}
+			s.Internal, s.Untagged = "anything goes", "x"
+		}, nil},
+		{"missing", func(s *signup) { s.Email, s.Name = "", "   " }, Errors{"email": "is required", "name": "is required"}},
+		{"bad email", func(s *signup) { s.Email = "not-an-email" }, Errors{"email": "must be a valid email address"}},
+		{"email with a display name", func(s *signup) { s.Email = "Jane <jane@example.com>" }, Errors{"email": "must be a valid email address"}},
+		{"email without a domain dot", func(s *signup) { s.Email = "jane@localhost" }, Errors{"email": "must be a valid email address"}},
+		{"short name", func(s *signup) { s.Name = "J" }, Errors{"name": "must be at least 2 characters"}},
+		{"long name in runes", func(s *signup) { s.Name = "Jéééééééééé" }, Errors{"name": "must be at most 10 characters"}},
+		{"unknown role", func(s *signup) { s.Role = "owner" }, Errors{"role": "must be one of: admin, sales_rep"}},
+		{"bad uuid", func(s *signup) { s.ManagerID = "42" }, Errors{"managerId": "must be a UUID"}},
+		{"relative url", func(s *signup) { s.Website = "/path" }, Errors{"website": "must be an http or https URL"}},
+		{"plain http webhook", func(s *signup) { s.Webhook = "http://example.com" }, Errors{"webhook": "must be an https URL"}},
+		{"bad color", func(s *signup) { s.Color = "blue" }, Errors{"color": "must be a hex color such as #1a73e8"}},
+		{"local phone", func(s *signup) { s.Phone = "4155550123" }, Errors{"phone": "must be a phone number in international format such as +14155550123"}},
+		{"number below min", func(s *signup) { s.Age = age(12) }, Errors{"age": "must be at least 18"}},
+		{"too many items", func(s *signup) { s.Tags = []string{"a", "b", "c", "d"} }, Errors{"tags": "must be at most 3 items"}},
+		{"bad item", func(s *signup) { s.Tags = []string{"a", ""} }, Errors{"tags": "item 2 is required"}},
+		{"bad map entry", func(s *signup) { s.Labels = map[string]string{"k": "long"} }, Errors{"labels": "entry k must be at most 3 characters"}},
+		{"nested struct", func(s *signup) { s.Home = &address{Country: "US"} }, Errors{"home.city": "is required"}},
+		{"nested slice", func(s *signup) { s.Offices = []address{{City: "Pune"}, {City: "Paris", Country: "FR"}} }, Errors{"offices[1].country": "must be one of: IN, US"}},
+		{"go field name without a json tag", func(s *signup) { s.Untagged = "xx" }, Errors{"Untagged": "must be at most 1 characters"}},
+	} {
+		s := valid()
+		tt.edit(&s)
+		err := Struct(&s)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: Struct = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		var got Errors
+		if !errors.As(err, &got) || !maps.Equal(got, tt.want) {
+			t.Errorf("%s: Struct = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestStructRejectsMalformedTags(t *testing.T) {
+	for name, v := range map[string]interface{}{
+		"unknown rule": &struct {
+			A string `validate:"shiny"`
+		}{A: "x"},
+		"max without number": &struct {
+			A string `validate:"max=lots"`
+		}{A: "x"},
+		"email on an int": &struct {
+			A int `validate:"email"`
+		}{A: 1},
+		"dive on a string": &struct {
+			A string `validate:"dive,required"`
+		}{A: "x"},
+		"not a struct": "just a string",
+	} {
+		err := Struct(v)
+		var fields Errors
+		if err == nil || errors.As(err, &fields) {
+			t.Errorf("%s: Struct = %v, want a plain error", name, err)
+		}
+	}
+	if err := Struct((*signup)(nil)); err != nil {
+		t.Errorf("Struct(nil) = %v", err)
+	}
+}
+
+func TestErrorsListsFieldsInOrder(t *testing.T) {
+	err := Errors{"name": "is required", "email": "must be a valid email address"}
+	if got, want := err.Error(), "email must be a valid email address; name is required"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newResolver(t *testing.T, trusted ...string) *Resolver {
+	t.Helper()
+	res, err := NewResolver(trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func request(remoteAddr string, header http.Header) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remoteAddr
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	return r
+}
+
+func TestResolveIgnoresHeadersFromUntrustedPeers(t *testing.T) {
+	spoofed := http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Real-Ip": {"5.6.7.8"}}
+
+	for _, tt := range []struct {
+		name    string
+		trusted []string
+		peer    string
+		want    string
+	}{
+		{"no trusted proxies", nil, "203.0.113.7:51234", "203.0.113.7"},
+		{"peer outside the trusted range", []string{"10.0.0.0/8"}, "203.0.113.7:51234", "203.0.113.7"},
+		{"peer next to a trusted address", []string{"10.0.0.1"}, "10.0.0.2:443", "10.0.0.2"},
+		{"IPv6 peer", []string{"fd00::/8"}, "[2001:db8::1]:443", "2001:db8::1"},
+	} {
+		if got := newResolver(t, tt.trusted...).Resolve(request(tt.peer, spoofed)); got != tt.want {
+			t.Errorf("%s: Resolve = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveWalksTrustedHops(t *testing.T) {
+	res := newResolver(t, "10.0.0.0/8", "fd00::/8", "192.0.2.10")
+
+	for _, tt := range []struct {
+		name   string
+		peer   string
+		header http.Header
+		want   string
+	}{
+		{"single proxy", "10.0.0.5:80", http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "203.0.113.7"},
+		{"chain of proxies", "10.0.0.5:80", http.Header{"X-Forwarded-For": {"203.0.113.7, 192.0.2.10, 10.1.2.3"}}, "203.0.113.7"},
+		{"forged entries left of the client", "10.0.0.5:80", http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.9, 10.1.2.3"}}, "198.51.100.9"},
+		{"repeated headers", "10.0.0.5:80", http.Header{"X-Forwarded-For": {"203.0.113.7", "10.1.2.3"}}, "203.0.113.7"},
+		{"only trusted hops", "10.0.0.5:80", http.Header{"X-Forwarded-For": {"10.9.9.9, 10.1.2.3"}}, "10.9.9.9"},
+		{"malformed hop", "10.0.0.5:80", http.Header{"X-Forwarded-For": {"203.0.113.7, garbage, 10.1.2.3"}}, "10.1.2.3"},
+		{"IPv6 client behind an IPv6 proxy", "[fd00::1]:443", http.Header{"X-Forwarded-For": {"2001:db8::7, fd00::2"}}, "2001:db8::7"},
+		{"IPv6 hop with a port", "10.0.0.5:80", http.Header{"X-Forwarded-For": {"[2001:db8::7]:5000"}}, "2001:db8::7"},
+		{"X-Real-IP without X-Forwarded-For", "10.0.0.5:80", http.Header{"X-Real-Ip": {"203.0.113.7"}}, "203.0.113.7"},
+		{"no forwarding headers", "10.0.0.5:80", nil, "10.0.0.5"},
+	} {
+		if got := res.Resolve(request(tt.peer, tt.header)); got != tt.want {
+			t.Errorf("%s: Resolve = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveParsesPeerAddresses(t *testing.T) {
+	res := newResolver(t)
+
+	for peer, want := range map[string]string{
+		"203.0.113.7":              "203.0.113.7",
+		"203.0.113.7:443":          "203.0.113.7",
+		"2001:db8::1":              "2001:db8::1",
+		"[2001:db8::1]":            "2001:db8::1",
+		"[2001:db8::1]:443":        "2001:db8::1",
+		"[fe80::1%eth0]:443":       "fe80::1",
+		"[::ffff:203.0.113.7]:443": "203.0.113.7",
+		"not an address":           "not an address",
+	} {
+		if got := res.Resolve(request(peer, nil)); got != want {
+			t.Errorf("Resolve with peer %q = %q, want %q", peer, got, want)
+		}
+	}
+}
+
+func TestNewResolverRejectsInvalidProxies(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0"} {
+		if _, err := NewResolver([]string{entry}); err == nil {
+			t.Errorf("NewResolver(%q) accepted", entry)
+		}
+	}
+	// A mapped IPv4 address trusts the plain one
+	res := newResolver(t, "::ffff:10.0.0.5")
+	if got := res.Resolve(request("10.0.0.5:80", http.Header{"X-Forwarded-For": {"203.0.113.7"}})); got != "203.0.113.7" {
+		t.Errorf("Resolve through a mapped trusted proxy = %q", got)
+	}
+}
+
+func TestMiddlewareResolvesOnce(t *testing.T) {
+	res := newResolver(t, "10.0.0.0/8")
+	var got string
+	handler := res.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), request("10.0.0.5:80", http.Header{"X-Forwarded-For": {"203.0.113.7"}}))
+	if got != "203.0.113.7" {
+		t.Errorf("FromRequest behind the middleware = %q", got)
+	}
+
+	// Without the middleware no proxy is trusted
+	if got := FromRequest(request("10.0.0.5:80", http.Header{"X-Forwarded-For": {"203.0.113.7"}})); got != "10.0.0.5" {
+		t.Errorf("FromRequest without the middleware = %q, want the peer", got)
+	}
+}
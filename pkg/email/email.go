@@ -0,0 +1,37 @@
+// Package email defines the provider-neutral interface used to deliver
+// outgoing email, with SMTP, SendGrid and logging implementations.
+package email
+
+import (
+	"context"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// Provider names, recorded on communications sent through them
+const (
+	ProviderSMTP     = "smtp"
+	ProviderSendGrid = "sendgrid"
+	ProviderLog      = "log"
+)
+
+// Capabilities describes what an EmailSender supports
+type Capabilities struct {
+	Delivers         bool // Messages actually leave the system (false for the logging sender)
+	Attachments      bool // Attachments on CommMessage are sent
+	Tracking         bool // TrackEngagement adds open/click tracking
+	RemoteMessageID  bool // SendEmail sets msg.ExternalID to the provider's message ID
+	DeliveryWebhooks bool // The provider reports delivery events by webhook
+}
+
+// EmailSender delivers a single email. On success SendEmail may set
+// msg.ExternalID to the provider's message ID so delivery events can be
+// correlated with the stored communication.
+type EmailSender interface {
+	SendEmail(ctx context.Context, msg *models.CommMessage) error
+	// Name identifies the provider (ProviderSMTP, ProviderSendGrid, ...)
+	Name() string
+	// FromAddress is the sender address messages go out with
+	FromAddress() string
+	Capabilities() Capabilities
+}
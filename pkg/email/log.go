@@ -0,0 +1,41 @@
+package email
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// LogSender logs messages instead of sending them. It is used when no
+// provider is configured so development setups work without a mail server.
+type LogSender struct {
+	fromEmail string
+}
+
+// NewLogSender creates a logging sender
+func NewLogSender(fromEmail string) *LogSender {
+	return &LogSender{fromEmail: fromEmail}
+}
+
+// SendEmail logs the recipients and subject of msg
+func (s *LogSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	log.Printf("Email provider not configured. Email %s would be sent to %s: %s", msg.MessageID, strings.Join(msg.ToAddresses, ", "), msg.Subject)
+	return nil
+}
+
+// Name returns ProviderLog
+func (s *LogSender) Name() string {
+	return ProviderLog
+}
+
+// FromAddress returns the configured sender, if any
+func (s *LogSender) FromAddress() string {
+	return s.fromEmail
+}
+
+// Capabilities reports that nothing is delivered
+func (s *LogSender) Capabilities() Capabilities {
+	return Capabilities{}
+}
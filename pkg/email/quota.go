@@ -0,0 +1,76 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// ErrSendQuotaExceeded is returned when a send limit has been reached
+var ErrSendQuotaExceeded = errors.New("email send quota exceeded")
+
+// QuotaExceededError says which send limit a rejected message ran into. It
+// matches ErrSendQuotaExceeded with errors.Is.
+type QuotaExceededError struct {
+	Period   string // day or month
+	Limit    int64
+	ResetsAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %d emails per %s, resets at %s", ErrSendQuotaExceeded, e.Limit, e.Period, e.ResetsAt.Format(time.RFC3339))
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrSendQuotaExceeded
+}
+
+// SendQuota decides whether a message may be sent and counts the messages
+// that were
+type SendQuota interface {
+	// CheckSend returns a *QuotaExceededError when msg must not be sent now
+	CheckSend(ctx context.Context, msg *models.CommMessage) error
+	// RecordSend counts msg once the provider accepted it
+	RecordSend(ctx context.Context, msg *models.CommMessage) error
+}
+
+// quotaSender checks every message against a send quota before handing it
+// to the wrapped sender
+type quotaSender struct {
+	EmailSender
+	quota SendQuota
+}
+
+// WithQuota wraps sender so messages over a send limit are rejected with a
+// *QuotaExceededError and sent messages are counted. Senders that do not
+// deliver are not limited. If the quota cannot be read the message is sent;
+// a send is never blocked by a usage lookup failure.
+func WithQuota(sender EmailSender, quota SendQuota) EmailSender {
+	return &quotaSender{EmailSender: sender, quota: quota}
+}
+
+// SendEmail sends msg unless it is over a send limit, then counts it
+func (s *quotaSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	if msg == nil || !s.Capabilities().Delivers {
+		return s.EmailSender.SendEmail(ctx, msg)
+	}
+
+	if err := s.quota.CheckSend(ctx, msg); err != nil {
+		if errors.Is(err, ErrSendQuotaExceeded) {
+			return err
+		}
+		log.Printf("Warning: email send quota unavailable, sending %s unchecked: %v", msg.MessageID, err)
+	}
+
+	if err := s.EmailSender.SendEmail(ctx, msg); err != nil {
+		return err
+	}
+	if err := s.quota.RecordSend(ctx, msg); err != nil {
+		log.Printf("Warning: email %s was sent but not counted against the send quota: %v", msg.MessageID, err)
+	}
+	return nil
+}
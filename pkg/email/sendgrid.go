@@ -0,0 +1,279 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/smtp"
+)
+
+// sendGridRequestTimeout bounds a single call to the mail send API
+const sendGridRequestTimeout = 30 * time.Second
+
+// SendGridConfig holds SendGrid API settings
+type SendGridConfig struct {
+	APIKey             string
+	APIURL             string // e.g. https://api.sendgrid.com
+	FromEmail          string
+	FromName           string
+	MaxAttachmentBytes int64                 // total attachment size cap; 0 uses smtp.DefaultMaxAttachmentBytes
+	AttachmentLoader   smtp.AttachmentLoader // fetches attachments stored by reference; nil requires Data
+}
+
+// SendGridSender sends email through the SendGrid v3 mail send API
+type SendGridSender struct {
+	config     SendGridConfig
+	httpClient *http.Client
+}
+
+// NewSendGridSender creates a SendGrid sender
+func NewSendGridSender(config SendGridConfig) *SendGridSender {
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	if config.MaxAttachmentBytes <= 0 {
+		config.MaxAttachmentBytes = smtp.DefaultMaxAttachmentBytes
+	}
+	return &SendGridSender{
+		config:     config,
+		httpClient: &http.Client{Timeout: sendGridRequestTimeout},
+	}
+}
+
+// sendGridAddress is an email address in a SendGrid payload
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To  []sendGridAddress `json:"to"`
+	CC  []sendGridAddress `json:"cc,omitempty"`
+	BCC []sendGridAddress `json:"bcc,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type,omitempty"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type sendGridToggle struct {
+	Enable bool `json:"enable"`
+}
+
+type sendGridTracking struct {
+	ClickTracking sendGridToggle `json:"click_tracking"`
+	OpenTracking  sendGridToggle `json:"open_tracking"`
+}
+
+type sendGridMail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	CustomArgs       map[string]string         `json:"custom_args,omitempty"`
+	TrackingSettings sendGridTracking          `json:"tracking_settings"`
+}
+
+// SendEmail posts msg to the SendGrid API and sets msg.ExternalID from the
+// X-Message-Id response header. Our message ID is sent as the message_id
+// custom arg, which SendGrid echoes in event webhooks.
+func (s *SendGridSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	if msg == nil {
+		return fmt.Errorf("message cannot be nil")
+	}
+	payload, err := s.buildPayload(msg)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode SendGrid request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.APIURL+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create SendGrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("SendGrid request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("SendGrid rejected message (status %d): %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+
+	msg.ExternalID = resp.Header.Get("X-Message-Id")
+	return nil
+}
+
+// buildPayload converts a CommMessage to a SendGrid mail send request
+func (s *SendGridSender) buildPayload(msg *models.CommMessage) (*sendGridMail, error) {
+	if len(msg.ToAddresses) == 0 {
+		return nil, fmt.Errorf("invalid message: at least one recipient is required")
+	}
+	if msg.Subject == "" {
+		return nil, fmt.Errorf("invalid message: subject is required")
+	}
+	if msg.BodyText == "" && msg.BodyHTML == "" {
+		return nil, fmt.Errorf("invalid message: message body is required")
+	}
+
+	fromName := msg.FromName
+	if fromName == "" {
+		fromName = s.config.FromName
+	}
+	payload := &sendGridMail{
+		Personalizations: []sendGridPersonalization{{
+			To:  sendGridAddresses(msg.ToAddresses),
+			CC:  sendGridAddresses(msg.CCAddresses),
+			BCC: sendGridAddresses(msg.BCCAddresses),
+		}},
+		// Always send as the configured sender; replies go to the original sender
+		From:    sendGridAddress{Email: s.config.FromEmail, Name: fromName},
+		Subject: msg.Subject,
+		TrackingSettings: sendGridTracking{
+			ClickTracking: sendGridToggle{Enable: msg.TrackEngagement},
+			OpenTracking:  sendGridToggle{Enable: msg.TrackEngagement},
+		},
+	}
+	if msg.FromAddress != "" && msg.FromAddress != s.config.FromEmail {
+		payload.ReplyTo = &sendGridAddress{Email: msg.FromAddress}
+	}
+
+	// SendGrid requires text/plain before text/html
+	if msg.BodyText != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/plain", Value: msg.BodyText})
+	}
+	if msg.BodyHTML != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/html", Value: msg.BodyHTML})
+	}
+
+	if msg.MessageID != "" {
+		payload.CustomArgs = map[string]string{"message_id": msg.MessageID}
+	}
+	headers := map[string]string{}
+	if msg.InReplyTo != "" {
+		headers["In-Reply-To"] = msg.InReplyTo
+	}
+	if msg.References != "" {
+		headers["References"] = msg.References
+	}
+	if len(headers) > 0 {
+		payload.Headers = headers
+	}
+
+	attachments, err := s.buildAttachments(msg.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	payload.Attachments = attachments
+	return payload, nil
+}
+
+// buildAttachments base64-encodes attachments, enforcing the size cap.
+// The API carries bytes only, so attachments without Data are loaded from
+// FileURL through the configured loader.
+func (s *SendGridSender) buildAttachments(atts []models.CommunicationAttachment) ([]sendGridAttachment, error) {
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	var total int64
+	result := make([]sendGridAttachment, 0, len(atts))
+	for i, att := range atts {
+		if att.FileName == "" {
+			return nil, fmt.Errorf("attachment %d has no file name", i)
+		}
+		data := att.Data
+		if data == nil {
+			if att.FileURL == "" || s.config.AttachmentLoader == nil {
+				return nil, fmt.Errorf("attachment %q has no data", att.FileName)
+			}
+			loaded, err := s.config.AttachmentLoader(att.FileURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load attachment %q: %w", att.FileName, err)
+			}
+			data = loaded
+		}
+		total += int64(len(data))
+		if total > s.config.MaxAttachmentBytes {
+			return nil, fmt.Errorf("%w: more than %d bytes", smtp.ErrAttachmentsTooLarge, s.config.MaxAttachmentBytes)
+		}
+
+		contentType := att.FileType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(att.FileName))
+		}
+		sgAtt := sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(data),
+			Type:        contentType,
+			Filename:    att.FileName,
+			Disposition: "attachment",
+		}
+		if cid := strings.Trim(att.ContentID, "<>"); cid != "" {
+			sgAtt.Disposition = "inline"
+			sgAtt.ContentID = cid
+		}
+		result = append(result, sgAtt)
+	}
+	return result, nil
+}
+
+func sendGridAddresses(addrs []string) []sendGridAddress {
+	if len(addrs) == 0 {
+		return nil
+	}
+	result := make([]sendGridAddress, len(addrs))
+	for i, addr := range addrs {
+		result[i] = sendGridAddress{Email: addr}
+	}
+	return result
+}
+
+// Name returns ProviderSendGrid
+func (s *SendGridSender) Name() string {
+	return ProviderSendGrid
+}
+
+// FromAddress returns the configured sender
+func (s *SendGridSender) FromAddress() string {
+	return s.config.FromEmail
+}
+
+// Capabilities reports SendGrid support: attachments, provider-side
+// tracking, message IDs and event webhooks
+func (s *SendGridSender) Capabilities() Capabilities {
+	return Capabilities{
+		Delivers:         true,
+		Attachments:      true,
+		Tracking:         true,
+		RemoteMessageID:  true,
+		DeliveryWebhooks: true,
+	}
+}
@@ -0,0 +1,47 @@
+package email
+
+import (
+	"context"
+
+	"github.com/white/user-management/internal/models"
+	"github.com/white/user-management/pkg/smtp"
+)
+
+// SMTPSender sends email through an SMTP server
+type SMTPSender struct {
+	client *smtp.SMTPClient
+}
+
+// NewSMTPSender adapts an SMTP client to the EmailSender interface
+func NewSMTPSender(client *smtp.SMTPClient) *SMTPSender {
+	return &SMTPSender{client: client}
+}
+
+// SendEmail sends msg over SMTP. The SMTP client does not honour ctx once
+// the send has started; a cancelled ctx only prevents starting it.
+func (s *SMTPSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.client.SendEmail(msg)
+}
+
+// Name returns ProviderSMTP
+func (s *SMTPSender) Name() string {
+	return ProviderSMTP
+}
+
+// FromAddress returns the configured SMTP sender
+func (s *SMTPSender) FromAddress() string {
+	return s.client.GetFromEmail()
+}
+
+// Capabilities reports SMTP support: attachments and, when a tracker is set,
+// open/click tracking
+func (s *SMTPSender) Capabilities() Capabilities {
+	return Capabilities{
+		Delivers:    true,
+		Attachments: true,
+		Tracking:    s.client.TrackingEnabled(),
+	}
+}
@@ -0,0 +1,84 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// ErrAllRecipientsSuppressed is returned when every To address of a message
+// is on the suppression list
+var ErrAllRecipientsSuppressed = errors.New("all recipients are suppressed")
+
+// SuppressionList reports which of a set of addresses must not be mailed
+type SuppressionList interface {
+	FilterSuppressed(ctx context.Context, addrs []string) ([]string, error)
+}
+
+// suppressingSender drops suppressed addresses before handing a message to
+// the wrapped sender
+type suppressingSender struct {
+	EmailSender
+	list SuppressionList
+}
+
+// WithSuppression wraps sender so suppressed addresses are removed from every
+// message. If the list cannot be read the message is sent unfiltered; a send
+// is never blocked by a suppression lookup failure.
+func WithSuppression(sender EmailSender, list SuppressionList) EmailSender {
+	return &suppressingSender{EmailSender: sender, list: list}
+}
+
+// SendEmail filters To, CC and BCC against the suppression list and sends the
+// rest. The caller's message is not modified except for ExternalID.
+func (s *suppressingSender) SendEmail(ctx context.Context, msg *models.CommMessage) error {
+	if msg == nil {
+		return s.EmailSender.SendEmail(ctx, msg)
+	}
+
+	all := make([]string, 0, len(msg.ToAddresses)+len(msg.CCAddresses)+len(msg.BCCAddresses))
+	all = append(all, msg.ToAddresses...)
+	all = append(all, msg.CCAddresses...)
+	all = append(all, msg.BCCAddresses...)
+
+	suppressed, err := s.list.FilterSuppressed(ctx, all)
+	if err != nil {
+		log.Printf("Warning: suppression list unavailable, sending %s unfiltered: %v", msg.MessageID, err)
+		return s.EmailSender.SendEmail(ctx, msg)
+	}
+	if len(suppressed) == 0 {
+		return s.EmailSender.SendEmail(ctx, msg)
+	}
+
+	skip := make(map[string]bool, len(suppressed))
+	for _, addr := range suppressed {
+		skip[addr] = true
+	}
+	filtered := *msg
+	filtered.ToAddresses = withoutSuppressed(msg.ToAddresses, skip)
+	filtered.CCAddresses = withoutSuppressed(msg.CCAddresses, skip)
+	filtered.BCCAddresses = withoutSuppressed(msg.BCCAddresses, skip)
+	log.Printf("Skipping suppressed recipients %v for email %s", suppressed, msg.MessageID)
+	if len(filtered.ToAddresses) == 0 {
+		return ErrAllRecipientsSuppressed
+	}
+
+	if err := s.EmailSender.SendEmail(ctx, &filtered); err != nil {
+		return err
+	}
+	msg.ExternalID = filtered.ExternalID
+	return nil
+}
+
+func withoutSuppressed(addrs []string, skip map[string]bool) []string {
+	var kept []string
+	for _, addr := range addrs {
+		if !skip[strings.ToLower(strings.TrimSpace(addr))] {
+			kept = append(kept, addr)
+		}
+	}
+	return kept
+}
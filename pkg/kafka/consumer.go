@@ -83,8 +83,9 @@ type Consumer struct {
 	config config.KafkaConfig
 }
 
-// MessageHandler processes Kafka messages
-type MessageHandler func(message kafka.Message) error
+// MessageHandler processes Kafka messages. A returned error stops Consume
+// without committing the message, so it is redelivered to the group.
+type MessageHandler func(ctx context.Context, message kafka.Message) error
 
 // NewConsumer creates a new Kafka consumer
 func NewConsumer(cfg config.KafkaConfig, topic string) (*Consumer, error) {
@@ -97,8 +98,9 @@ func NewConsumer(cfg config.KafkaConfig, topic string) (*Consumer, error) {
 		GroupID:     cfg.ConsumerGroup,
 		Topic:       topic,
 		StartOffset: kafka.FirstOffset,
-		MinBytes:    10e3, // 10KB
+		MinBytes:    1,    // Deliver queued work as soon as it arrives
 		MaxBytes:    10e6, // 10MB
+		Dialer:      &kafka.Dialer{Timeout: defaultProducerTimeout, ClientID: cfg.ClientID},
 	})
 
 	return &Consumer{
@@ -107,16 +109,22 @@ func NewConsumer(cfg config.KafkaConfig, topic string) (*Consumer, error) {
 	}, nil
 }
 
-// Consume reads messages and calls the handler
+// Consume reads messages and calls the handler for each, committing a
+// message's offset only after the handler succeeds. It returns when ctx is
+// cancelled, reading fails or the handler returns an error.
 func (c *Consumer) Consume(ctx context.Context, handler MessageHandler) error {
 	for {
-		msg, err := c.reader.ReadMessage(ctx)
+		msg, err := c.reader.FetchMessage(ctx)
 		if err != nil {
 			return fmt.Errorf("error reading message: %w", err)
 		}
 
-		if err := handler(msg); err != nil {
-			fmt.Printf("error processing message: %v\n", err)
+		if err := handler(ctx, msg); err != nil {
+			return fmt.Errorf("error processing message at offset %d: %w", msg.Offset, err)
+		}
+
+		if err := c.reader.CommitMessages(ctx, msg); err != nil {
+			return fmt.Errorf("error committing message: %w", err)
 		}
 	}
 }
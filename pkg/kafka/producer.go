@@ -128,31 +128,136 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/white/user-management/config"
 )
 
-// Producer wraps a kafka-go dialer for publishing to any topic
+const (
+	// defaultProducerTimeout bounds one write to the broker when
+	// KafkaConfig.ProducerTimeout is unset
+	defaultProducerTimeout = 5 * time.Second
+	// closeFlushTimeout bounds the final flush of buffered events on Close
+	closeFlushTimeout = 10 * time.Second
+	// writeBatchSize is the most buffered events written in one request
+	writeBatchSize = 100
+)
+
+// ErrProducerClosed is returned when publishing after Close
+var ErrProducerClosed = errors.New("kafka producer is closed")
+
+// ErrProducerDisabled is returned by ProduceSync when no brokers are configured
+var ErrProducerDisabled = errors.New("kafka producer has no brokers configured")
+
+// IsPermanent reports whether err is the broker refusing a message itself,
+// e.g. as too large or not authorized for its topic, so that writing it again
+// cannot succeed. Connection failures and retriable broker errors are not.
+func IsPermanent(err error) bool {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		for _, writeErr := range writeErrs {
+			if writeErr != nil && !IsPermanent(writeErr) {
+				return false
+			}
+		}
+		return writeErrs.Count() > 0
+	}
+	var kafkaErr kafka.Error
+	return errors.As(err, &kafkaErr) && !kafkaErr.Temporary()
+}
+
+// ProducerHealth is the producer's contribution to the health check
+type ProducerHealth struct {
+	Enabled   bool   `json:"enabled"`
+	Connected bool   `json:"connected"`
+	Buffered  int    `json:"buffered"`
+	Dropped   int64  `json:"dropped"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// pendingMessage is a buffered event with its position in the buffer
+type pendingMessage struct {
+	seq uint64
+	msg kafka.Message
+}
+
+// Producer publishes events to any topic without blocking callers on the
+// broker. Events are queued in a bounded in-memory buffer and written by a
+// background loop, which keeps retrying while the broker is unreachable; when
+// the buffer is full the oldest event is dropped. The service therefore starts
+// and runs without Kafka, in a degraded mode reported by Health.
+//
+// A Producer built without brokers (or a nil *Producer) discards events, so
+// callers never need to check for one.
 type Producer struct {
-	brokers []string
 	config  config.KafkaConfig
+	writer  *kafka.Writer
+	dialer  *kafka.Dialer
+	timeout time.Duration
+
+	mu        sync.Mutex
+	buffer    []pendingMessage
+	nextSeq   uint64
+	connected bool
+	closed    bool
+	lastError string
+
+	dropped atomic.Int64
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
 }
 
-// NewProducer creates a new Kafka producer that can publish to any topic
-func NewProducer(cfg config.KafkaConfig) (*Producer, error) {
+// NewProducer creates a producer for cfg.Brokers and starts its background
+// delivery loop. It never connects eagerly, so an unreachable broker does not
+// prevent startup. Without brokers the producer discards every event.
+func NewProducer(cfg config.KafkaConfig) *Producer {
+	p := &Producer{config: cfg}
 	if len(cfg.Brokers) == 0 {
-		return nil, fmt.Errorf("no Kafka brokers provided")
+		log.Println("Warning: no Kafka brokers configured. Events will not be published.")
+		return p
+	}
+
+	if p.config.BufferSize <= 0 {
+		p.config.BufferSize = 1000
+	}
+	if p.config.RetryInterval <= 0 {
+		p.config.RetryInterval = 5 * time.Second
+	}
+	p.timeout = time.Duration(cfg.ProducerTimeout) * time.Millisecond
+	if p.timeout <= 0 {
+		p.timeout = defaultProducerTimeout
+	}
+
+	p.writer = &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		RequiredAcks: kafka.RequireAll,
+		Balancer:     &kafka.LeastBytes{},
+		BatchTimeout: 10 * time.Millisecond,
+		MaxAttempts:  1, // retries are driven by the delivery loop
+		WriteTimeout: p.timeout,
 	}
+	p.dialer = &kafka.Dialer{Timeout: p.timeout, ClientID: cfg.ClientID}
+	p.wake = make(chan struct{}, 1)
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	go p.run()
+	return p
+}
 
-	return &Producer{
-		brokers: cfg.Brokers,
-		config:  cfg,
-	}, nil
+// Enabled reports whether the producer publishes anywhere
+func (p *Producer) Enabled() bool {
+	return p != nil && p.writer != nil
 }
 
-// PublishJSON marshals data and publishes it to the specified topic
+// PublishJSON marshals data and queues it for the specified topic
 // This is the main method to use for publishing events
 func (p *Producer) PublishJSON(ctx context.Context, topic string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
@@ -163,25 +268,232 @@ func (p *Producer) PublishJSON(ctx context.Context, topic string, data interface
 	return p.Produce(ctx, topic, nil, jsonData)
 }
 
-// Produce sends a raw message to the specified topic
+// Produce queues a raw message for the specified topic and returns
+// immediately; delivery happens in the background. ctx is accepted for API
+// compatibility and is not used to bound delivery.
 func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte) error {
-	writer := &kafka.Writer{
-		Addr:         kafka.TCP(p.brokers...),
-		Topic:        topic,
-		RequiredAcks: kafka.RequireAll,
-		Balancer:     &kafka.LeastBytes{},
+	if !p.Enabled() {
+		return nil
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrProducerClosed
+	}
+	if len(p.buffer) >= p.config.BufferSize {
+		p.buffer[0] = pendingMessage{}
+		p.buffer = p.buffer[1:]
+		if dropped := p.dropped.Add(1); dropped == 1 || dropped%100 == 0 {
+			log.Printf("Warning: Kafka event buffer full (%d events), dropped oldest event (%d dropped in total)", p.config.BufferSize, dropped)
+		}
+	}
+	p.nextSeq++
+	p.buffer = append(p.buffer, pendingMessage{
+		seq: p.nextSeq,
+		msg: kafka.Message{Topic: topic, Key: key, Value: value, Time: time.Now()},
+	})
+	p.mu.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// ProduceSync writes one message straight to the broker, bypassing the
+// buffer, and returns once it is acknowledged. It is meant for callers that
+// keep their own durable queue, such as the event outbox relay.
+func (p *Producer) ProduceSync(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	if !p.Enabled() {
+		return ErrProducerDisabled
+	}
+	msg := kafka.Message{Topic: topic, Key: key, Value: value, Time: time.Now()}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: k, Value: []byte(v)})
 	}
-	defer writer.Close()
 
-	return writer.WriteMessages(ctx,
-		kafka.Message{
-			Key:   key,
-			Value: value,
-		},
-	)
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	err := p.writer.WriteMessages(ctx, msg)
+	p.setConnected(err)
+	return err
 }
 
-// Close is a no-op for compatibility but kept for API consistency
+// Health reports whether the broker is reachable and how many events are
+// waiting to be delivered
+func (p *Producer) Health() ProducerHealth {
+	if !p.Enabled() {
+		return ProducerHealth{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ProducerHealth{
+		Enabled:   true,
+		Connected: p.connected,
+		Buffered:  len(p.buffer),
+		Dropped:   p.dropped.Load(),
+		LastError: p.lastError,
+	}
+}
+
+// Close stops the delivery loop and flushes buffered events, giving up after
+// closeFlushTimeout. Events still buffered then are lost and logged.
 func (p *Producer) Close() error {
-	return nil
+	if !p.Enabled() {
+		return nil
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), closeFlushTimeout)
+	defer cancel()
+	for {
+		sent, err := p.writeBatch(ctx)
+		if err != nil || sent == 0 {
+			break
+		}
+	}
+	if remaining := p.Health().Buffered; remaining > 0 {
+		log.Printf("Warning: Kafka producer closed with %d undelivered event(s)", remaining)
+	}
+	return p.writer.Close()
+}
+
+// run delivers buffered events as they arrive, and retries every
+// RetryInterval while the broker is unreachable
+func (p *Producer) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.config.RetryInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		p.flush(ctx)
+
+		select {
+		case <-p.stop:
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// flush writes buffered events until the buffer is empty or a write fails.
+// With nothing buffered and no connection it probes the brokers, so Health
+// reflects a recovered broker before the next event.
+func (p *Producer) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		sent, err := p.writeBatch(ctx)
+		if err != nil {
+			return
+		}
+		if sent == 0 {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	connected := p.connected
+	p.mu.Unlock()
+	if !connected && ctx.Err() == nil {
+		p.setConnected(p.probe(ctx))
+	}
+}
+
+// writeBatch writes the oldest buffered events and removes them from the
+// buffer once acknowledged. It returns how many were written.
+func (p *Producer) writeBatch(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	n := min(len(p.buffer), writeBatchSize)
+	if n == 0 {
+		p.mu.Unlock()
+		return 0, nil
+	}
+	batch := make([]kafka.Message, n)
+	for i := range batch {
+		batch[i] = p.buffer[i].msg
+	}
+	lastSeq := p.buffer[n-1].seq
+	p.mu.Unlock()
+
+	writeCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	if err := p.writer.WriteMessages(writeCtx, batch...); err != nil {
+		if ctx.Err() == nil {
+			p.setConnected(err)
+		}
+		return 0, err
+	}
+
+	// Events dropped while writing were removed from the front already
+	p.mu.Lock()
+	removed := 0
+	for removed < len(p.buffer) && p.buffer[removed].seq <= lastSeq {
+		p.buffer[removed] = pendingMessage{}
+		removed++
+	}
+	p.buffer = p.buffer[removed:]
+	p.mu.Unlock()
+
+	p.setConnected(nil)
+	return n, nil
+}
+
+// probe checks that at least one broker accepts connections
+func (p *Producer) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var lastErr error
+	for _, broker := range p.config.Brokers {
+		conn, err := p.dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// setConnected records the outcome of talking to the broker, logging
+// transitions only
+func (p *Producer) setConnected(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		if !p.connected {
+			log.Printf("Connected to Kafka (%d buffered event(s) pending)", len(p.buffer))
+		}
+		p.connected = true
+		p.lastError = ""
+		return
+	}
+
+	if p.connected || p.lastError == "" {
+		log.Printf("Warning: Kafka unavailable, buffering events and retrying every %s: %v", p.config.RetryInterval, err)
+	}
+	p.connected = false
+	p.lastError = err.Error()
 }
@@ -0,0 +1,133 @@
+// Package lifecycle closes long-lived components in a controlled order on
+// shutdown.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// CloseFunc releases a component, returning early if ctx expires
+type CloseFunc func(ctx context.Context) error
+
+// closer is one registered component
+type closer struct {
+	name    string
+	timeout time.Duration
+	close   CloseFunc
+}
+
+// Registry closes registered components in the reverse of their registration
+// order. Register a component after everything it depends on, so it is
+// closed before them: background workers before the Kafka producer they
+// publish through, the producer before the database.
+type Registry struct {
+	mu      sync.Mutex
+	closers []closer
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a component. Its close is bounded by timeout as well as by
+// the deadline passed to Close.
+func (r *Registry) Register(name string, timeout time.Duration, fn CloseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closers = append(r.closers, closer{name: name, timeout: timeout, close: fn})
+}
+
+// Close closes every component, last registered first, logging each result.
+// A component that fails or times out does not stop the rest from closing;
+// all failures are returned together.
+func (r *Registry) Close(ctx context.Context) error {
+	r.mu.Lock()
+	closers := r.closers
+	r.closers = nil
+	r.mu.Unlock()
+
+	var errs []error
+	for i := len(closers) - 1; i >= 0; i-- {
+		c := closers[i]
+		start := time.Now()
+		if err := closeOne(ctx, c); err != nil {
+			log.Printf("Warning: closing %s failed after %s: %v", c.name, time.Since(start).Round(time.Millisecond), err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		log.Printf("Closed %s in %s", c.name, time.Since(start).Round(time.Millisecond))
+	}
+	return errors.Join(errs...)
+}
+
+// closeOne runs one close under its timeout. A close that ignores its
+// context is abandoned when the timeout passes, so one stuck component can't
+// hold up the others.
+func closeOne(ctx context.Context, c closer) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.close(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wrap adapts a Close method that takes no context
+func Wrap(fn func() error) CloseFunc {
+	return func(context.Context) error {
+		return fn()
+	}
+}
+
+// Workers runs background loops that stop when the group is closed
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWorkers creates an empty worker group
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a goroutine with the group's context, which is cancelled
+// when the group is closed. fn should finish its current item and return.
+func (w *Workers) Go(fn func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		fn(w.ctx)
+	}()
+}
+
+// Close cancels every worker and waits for them to return or for ctx to expire
+func (w *Workers) Close(ctx context.Context) error {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background workers still running: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,155 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder notes the order components are closed in
+type recorder struct {
+	mu     sync.Mutex
+	closed []string
+}
+
+func (r *recorder) closeFunc(name string, delay time.Duration, err error) CloseFunc {
+	return func(ctx context.Context) error {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.closed = append(r.closed, name)
+		return err
+	}
+}
+
+func (r *recorder) order() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.closed)
+}
+
+func TestRegistryClosesInReverseOrder(t *testing.T) {
+	var rec recorder
+	registry := NewRegistry()
+	registry.Register("mongodb", time.Second, rec.closeFunc("mongodb", 0, nil))
+	registry.Register("kafka", time.Second, rec.closeFunc("kafka", 10*time.Millisecond, nil))
+	registry.Register("workers", time.Second, rec.closeFunc("workers", 0, nil))
+
+	if err := registry.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.order(), []string{"workers", "kafka", "mongodb"}; !slices.Equal(got, want) {
+		t.Errorf("closed %v, want %v", got, want)
+	}
+
+	// Components are closed once
+	if err := registry.Close(context.Background()); err != nil || len(rec.order()) != 3 {
+		t.Errorf("second Close = %v after closing %v, want nothing closed again", err, rec.order())
+	}
+}
+
+// TestSlowComponentsAreAbandoned checks a component stuck past its timeout,
+// even one ignoring its context, does not keep the others from closing
+func TestSlowComponentsAreAbandoned(t *testing.T) {
+	var rec recorder
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	registry := NewRegistry()
+	registry.Register("mongodb", time.Second, rec.closeFunc("mongodb", 0, nil))
+	registry.Register("kafka", 20*time.Millisecond, func(ctx context.Context) error {
+		<-stuck // Ignores ctx
+		return nil
+	})
+	registry.Register("redis", time.Second, rec.closeFunc("redis", 0, errors.New("connection reset")))
+
+	start := time.Now()
+	err := registry.Close(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Close took %s, want the stuck component abandoned after its timeout", elapsed)
+	}
+	if got, want := rec.order(), []string{"redis", "mongodb"}; !slices.Equal(got, want) {
+		t.Errorf("closed %v, want %v", got, want)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "kafka") || !strings.Contains(err.Error(), "redis: connection reset") {
+		t.Errorf("Close = %v, want the kafka timeout and the redis failure", err)
+	}
+}
+
+// TestCloseRespectsTheOverallDeadline gives every component the remaining
+// time of the shutdown, not its full timeout each
+func TestCloseRespectsTheOverallDeadline(t *testing.T) {
+	var rec recorder
+	registry := NewRegistry()
+	for _, name := range []string{"first", "second", "third"} {
+		registry.Register(name, time.Second, rec.closeFunc(name, 200*time.Millisecond, nil))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := registry.Close(ctx)
+	if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+		t.Errorf("Close took %s, want it bounded by the 300ms deadline", elapsed)
+	}
+	if got := rec.order(); !slices.Equal(got, []string{"third"}) {
+		t.Errorf("closed %v, want only the component that fit in the deadline", got)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want the deadline exceeded", err)
+	}
+}
+
+func TestWorkersFinishTheirItemOnClose(t *testing.T) {
+	workers := NewWorkers()
+	var mu sync.Mutex
+	var processed, checkpointed int
+	workers.Go(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				mu.Lock()
+				checkpointed = processed
+				mu.Unlock()
+				return
+			case <-time.After(time.Millisecond):
+				mu.Lock()
+				processed++
+				mu.Unlock()
+			}
+		}
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	if err := workers.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if processed == 0 || checkpointed != processed {
+		t.Errorf("processed %d, checkpointed %d; want the worker to stop after checkpointing", processed, checkpointed)
+	}
+}
+
+func TestWorkersCloseGivesUpAtTheDeadline(t *testing.T) {
+	workers := NewWorkers()
+	release := make(chan struct{})
+	defer close(release)
+	workers.Go(func(ctx context.Context) {
+		<-release // Ignores ctx
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := workers.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want the deadline exceeded", err)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"crypto/x509"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -20,12 +22,19 @@ type Config struct {
 	MinPoolSize uint64
 	MaxRetries  int
 	TLSCAFile   string // Path to CA certificate file for TLS
+
+	// SecondaryReads lets ReportingCollection read from secondaries.
+	// Turning it off sends every read to the primary.
+	SecondaryReads bool
 }
 
 type Client struct {
 	Client *mongo.Client
 	DB     *mongo.Database
 	config Config
+
+	txMu        sync.Mutex
+	txSupported *bool // Whether the deployment supports transactions, once known
 }
 
 type HealthStatus struct {
@@ -122,15 +131,20 @@ func NewClient(config Config) (*Client, error) {
 		}
 	}
 
-	//get database handle
-	database := client.Database(config.Database)
 	fmt.Printf("Successfully connected to MongoDB database: %s\n", config.Database)
 
+	return Wrap(client, config), nil
+}
+
+// Wrap returns a Client over an already connected mongo client, using the
+// database and read settings of config. NewClient connects and then wraps;
+// tests wrap a client of their own.
+func Wrap(client *mongo.Client, config Config) *Client {
 	return &Client{
 		Client: client,
-		DB:     database,
+		DB:     client.Database(config.Database),
 		config: config,
-	}, nil
+	}
 }
 
 // Close gracefully disconnects the MongoDB client
@@ -174,6 +188,22 @@ func (c *Client) Collection(name string) *mongo.Collection {
 	return c.DB.Collection(name)
 }
 
+// ReportingCollection returns a handle on the named collection for list and
+// report queries. With SecondaryReads its reads prefer a secondary, taking
+// that load off the primary at the price of replication lag: a document
+// written a moment ago may be missing or stale. Reads that must see the
+// caller's own writes, such as a session or OTP read back after it is
+// stored, use Collection instead. Writes through either handle go to the
+// primary, and a deployment without secondaries serves both from it.
+func (c *Client) ReportingCollection(name string) *mongo.Collection {
+	if !c.config.SecondaryReads {
+		return c.DB.Collection(name)
+	}
+	// Set on the database handle, whose ReadPreference reports it
+	reports := c.Client.Database(c.DB.Name(), options.Database().SetReadPreference(readpref.SecondaryPreferred()))
+	return reports.Collection(name)
+}
+
 // Startsession strarts a new client session
 func (c *Client) Startsession() (mongo.Session, error) {
 	if c.Client == nil {
@@ -183,6 +213,60 @@ func (c *Client) Startsession() (mongo.Session, error) {
 	return c.Client.StartSession()
 }
 
+// WithTransaction runs fn in a multi-document transaction. fn must use the
+// context it is given for its operations to be part of the transaction, and
+// may be run again when the transaction hits a transient error.
+// Standalone servers do not support transactions, so there fn runs once
+// directly, with a warning logged the first time.
+func (c *Client) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.Client == nil {
+		return fmt.Errorf("MongoDB client is nil")
+	}
+
+	supported, err := c.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fn(ctx)
+	}
+
+	session, err := c.Client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+// supportsTransactions reports whether the deployment is a replica set or a
+// sharded cluster, asking the server on first use
+func (c *Client) supportsTransactions(ctx context.Context) (bool, error) {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	if c.txSupported != nil {
+		return *c.txSupported, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := c.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, fmt.Errorf("failed to detect MongoDB topology: %w", err)
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	c.txSupported = &supported
+	if !supported {
+		fmt.Println("Warning: MongoDB is a standalone server without transactions; multi-document writes run one by one")
+	}
+	return supported, nil
+}
+
 // CreateCollection creates a new collection with optional options
 func (c *Client) CreateCollection(name string) error {
 	if c.DB == nil {
@@ -0,0 +1,48 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// unconnected returns a Client with config over a mongo client that has not
+// reached any server; collection handles and their options need none
+func unconnected(t *testing.T, config Config) *Client {
+	t.Helper()
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	return Wrap(client, config)
+}
+
+func TestReportingCollectionReadPreference(t *testing.T) {
+	for _, tt := range []struct {
+		secondaryReads bool
+		want           readpref.Mode
+	}{
+		{true, readpref.SecondaryPreferredMode},
+		{false, readpref.PrimaryMode},
+	} {
+		c := unconnected(t, Config{Database: "reports", SecondaryReads: tt.secondaryReads})
+		if got := c.ReportingCollection("audit_logs").Database().ReadPreference().Mode(); got != tt.want {
+			t.Errorf("SecondaryReads %v: reporting read preference = %v, want %v", tt.secondaryReads, got, tt.want)
+		}
+		// Reads that must see their own writes stay on the primary
+		if got := c.Collection("audit_logs").Database().ReadPreference().Mode(); got != readpref.PrimaryMode {
+			t.Errorf("SecondaryReads %v: collection read preference = %v, want primary", tt.secondaryReads, got)
+		}
+	}
+}
+
+func TestWrapUsesTheConfiguredDatabase(t *testing.T) {
+	c := unconnected(t, Config{Database: "reports"})
+	if c.DB.Name() != "reports" || c.ReportingCollection("users").Database().Name() != "reports" {
+		t.Errorf("database = %q, want reports", c.DB.Name())
+	}
+}
@@ -0,0 +1,59 @@
+// Package requestid tags every request with an ID that is echoed in the
+// X-Request-ID response header and carried into logs and audit records.
+//
+// An X-Request-ID sent by the client or a proxy in front of the API is kept
+// when it looks like an ID, so a request can be followed across services;
+// anything else is replaced by a new random ID.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/white/user-management/pkg/uuid"
+)
+
+// Header carries the request ID in requests and responses
+const Header = "X-Request-ID"
+
+// maxLength bounds an incoming request ID
+const maxLength = 128
+
+type contextKey struct{}
+
+// Middleware stores the request ID in the request context and sets the
+// response header
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = uuid.MustNewUUID()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// FromContext returns the request ID stored by Middleware, or "" outside a
+// request
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// valid accepts IDs of letters, digits and - _ . : up to maxLength, which
+// keeps them safe to put in log lines and headers
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
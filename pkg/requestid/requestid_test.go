@@ -0,0 +1,44 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	for _, tt := range []struct {
+		name, incoming string
+		kept           bool
+	}{
+		{"no ID", "", false},
+		{"ID from a proxy", "edge-7f3a:2026.03.01_42", true},
+		{"longest ID", strings.Repeat("a", maxLength), true},
+		{"too long", strings.Repeat("a", maxLength+1), false},
+		{"log injection", "abc\nAUDIT: forged", false},
+		{"spaces", "abc def", false},
+	} {
+		var got string
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.incoming != "" {
+			r.Header.Set(Header, tt.incoming)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		if got == "" || rec.Header().Get(Header) != got {
+			t.Errorf("%s: request ID %q, response header %q", tt.name, got, rec.Header().Get(Header))
+		}
+		if kept := got == tt.incoming; kept != tt.kept {
+			t.Errorf("%s: request ID = %q, kept the incoming one %t, want %t", tt.name, got, kept, tt.kept)
+		}
+	}
+
+	if id := FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); id != "" {
+		t.Errorf("FromContext outside the middleware = %q", id)
+	}
+}
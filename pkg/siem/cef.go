@@ -0,0 +1,64 @@
+package siem
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	cefVendor  = "White"
+	cefProduct = "user-management"
+
+	// CEF severities (0-10) of successful and failed actions
+	cefSeveritySuccess = 3
+	cefSeverityFailure = 6
+)
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// cef renders a record as an ArcSight Common Event Format line. Custom
+// strings carry the request ID and the resource.
+func cef(record Record, productVersion string) string {
+	severity := cefSeveritySuccess
+	if record.Result != ResultSuccess {
+		severity = cefSeverityFailure
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeaderEscaper.Replace(cefVendor),
+		cefHeaderEscaper.Replace(cefProduct),
+		cefHeaderEscaper.Replace(productVersion),
+		cefHeaderEscaper.Replace(record.Action),
+		cefHeaderEscaper.Replace(record.Resource+" "+record.Action),
+		severity,
+	)
+
+	extensions := []struct{ key, label, value string }{
+		{"rt", "", fmt.Sprint(record.Time.UnixMilli())},
+		{"externalId", "", record.ID},
+		{"suid", "", record.Actor},
+		{"suser", "", record.ActorName},
+		{"act", "", record.Action},
+		{"outcome", "", record.Result},
+		{"src", "", record.SourceIP},
+		{"requestClientApplication", "", record.UserAgent},
+		{"cs1", "requestId", record.RequestID},
+		{"cs2", "resource", record.Resource},
+		{"cs3", "resourceId", record.ResourceID},
+		{"msg", "", strings.TrimSpace(record.Details + " " + record.Error)},
+	}
+	for _, ext := range extensions {
+		if ext.value == "" {
+			continue
+		}
+		if ext.label != "" {
+			fmt.Fprintf(&b, "%sLabel=%s ", ext.key, ext.label)
+		}
+		fmt.Fprintf(&b, "%s=%s ", ext.key, cefExtensionEscaper.Replace(ext.value))
+	}
+	return strings.TrimSuffix(b.String(), " ")
+}
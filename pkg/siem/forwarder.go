@@ -0,0 +1,188 @@
+package siem
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBufferSize   = 1000
+	defaultRetryBackoff = time.Second
+)
+
+// ForwarderConfig holds the settings of a Forwarder
+type ForwarderConfig struct {
+	Format         string        // FormatJSON or FormatCEF
+	BufferSize     int           // Records waiting to be sent; more are dropped
+	MaxRetries     int           // Retries of a failed send before the record is given up
+	RetryBackoff   time.Duration // Wait before the first retry, doubled for each further one
+	DryRun         bool          // Log the records that would be sent instead of sending them
+	ProductVersion string        // Version named in CEF headers
+}
+
+// ForwarderHealth reports the state of a Forwarder
+type ForwarderHealth struct {
+	Transport string `json:"transport"`
+	Format    string `json:"format"`
+	DryRun    bool   `json:"dry_run"`
+	Backlog   int    `json:"backlog"`   // Records waiting to be sent
+	Capacity  int    `json:"capacity"`  // Records that can wait before new ones are dropped
+	Forwarded int64  `json:"forwarded"` // Records sent (or logged in a dry run)
+	Dropped   int64  `json:"dropped"`   // Records dropped because the backlog was full
+	Failed    int64  `json:"failed"`    // Records given up after their retries
+	Failing   bool   `json:"failing"`   // Whether the last send failed
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Forwarder sends records to a SIEM in the background. Forward never
+// blocks: records wait in a bounded backlog and are dropped, and counted,
+// when it is full.
+type Forwarder struct {
+	transport Transport
+	config    ForwarderConfig
+	queue     chan Record
+
+	forwarded atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+
+	mu        sync.Mutex
+	failing   bool
+	lastError string
+}
+
+// NewForwarder creates a Forwarder sending through transport. Records are
+// only sent while Run is running.
+func NewForwarder(transport Transport, config ForwarderConfig) *Forwarder {
+	if config.Format == "" {
+		config.Format = FormatJSON
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultBufferSize
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	return &Forwarder{
+		transport: transport,
+		config:    config,
+		queue:     make(chan Record, config.BufferSize),
+	}
+}
+
+// Forward queues a record. A nil Forwarder forwards nothing.
+func (f *Forwarder) Forward(record Record) {
+	if f == nil {
+		return
+	}
+	select {
+	case f.queue <- record:
+	default:
+		if f.dropped.Add(1) == 1 {
+			log.Printf("Warning: audit forwarding backlog is full, dropping records")
+		}
+	}
+}
+
+// Run sends queued records until ctx is cancelled, then tries once to send
+// the ones still queued and closes the transport
+func (f *Forwarder) Run(ctx context.Context) {
+	defer f.transport.Close()
+	for {
+		select {
+		case record := <-f.queue:
+			f.send(ctx, record, f.config.MaxRetries)
+		case <-ctx.Done():
+			f.drain()
+			return
+		}
+	}
+}
+
+// drain sends the queued records without retries, giving up on all of them
+// at the first failure so an unreachable SIEM does not hold up shutdown
+func (f *Forwarder) drain() {
+	for {
+		select {
+		case record := <-f.queue:
+			if !f.send(context.Background(), record, 0) {
+				remaining := int64(len(f.queue))
+				f.failed.Add(remaining)
+				log.Printf("Warning: %d audit records were not forwarded before shutdown", remaining+1)
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// send encodes and sends one record, retrying with backoff up to retries
+// times or until ctx is cancelled. It reports whether the record was sent.
+func (f *Forwarder) send(ctx context.Context, record Record, retries int) bool {
+	payload, err := Encode(f.config.Format, record, f.config.ProductVersion)
+	if err != nil {
+		f.failed.Add(1)
+		f.setError(err)
+		return false
+	}
+
+	if f.config.DryRun {
+		log.Printf("AUDIT FORWARD (dry run, %s): %s", f.transport.Name(), payload)
+		f.forwarded.Add(1)
+		return true
+	}
+
+	backoff := f.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = f.transport.Send(ctx, payload)
+		if err == nil {
+			f.forwarded.Add(1)
+			f.setError(nil)
+			return true
+		}
+		f.setError(err)
+		if attempt >= retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+		}
+	}
+
+	f.failed.Add(1)
+	log.Printf("Warning: failed to forward audit record %s via %s: %v", record.ID, f.transport.Name(), err)
+	return false
+}
+
+func (f *Forwarder) setError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = err != nil
+	if err != nil {
+		f.lastError = err.Error()
+	}
+}
+
+// Health reports the backlog and counters of the forwarder
+func (f *Forwarder) Health() ForwarderHealth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return ForwarderHealth{
+		Transport: f.transport.Name(),
+		Format:    f.config.Format,
+		DryRun:    f.config.DryRun,
+		Backlog:   len(f.queue),
+		Capacity:  cap(f.queue),
+		Forwarded: f.forwarded.Load(),
+		Dropped:   f.dropped.Load(),
+		Failed:    f.failed.Load(),
+		Failing:   f.failing,
+		LastError: f.lastError,
+	}
+}
@@ -0,0 +1,86 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// TransportHTTPS names the HTTPS collector transport
+	TransportHTTPS = "https"
+
+	// defaultHTTPSTimeout bounds one request when HTTPSConfig sets no
+	// Timeout
+	defaultHTTPSTimeout = 5 * time.Second
+)
+
+// HTTPSConfig holds the settings of an HTTPS collector, such as a Splunk
+// HTTP Event Collector
+type HTTPSConfig struct {
+	URL         string
+	AuthHeader  string // Header carrying AuthValue, e.g. Authorization
+	AuthValue   string // e.g. "Splunk <token>"
+	ContentType string // Defaults to application/json
+	Timeout     time.Duration
+}
+
+// HTTPSTransport posts each record to an HTTPS collector
+type HTTPSTransport struct {
+	config     HTTPSConfig
+	httpClient *http.Client
+}
+
+// NewHTTPSTransport creates an HTTPS collector transport
+func NewHTTPSTransport(config HTTPSConfig) *HTTPSTransport {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHTTPSTimeout
+	}
+	if config.ContentType == "" {
+		config.ContentType = "application/json"
+	}
+	return &HTTPSTransport{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// Send posts one record; any status other than 2xx is an error
+func (t *HTTPSTransport) Send(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create collector request: %w", err)
+	}
+	req.Header.Set("Content-Type", t.config.ContentType)
+	if t.config.AuthHeader != "" {
+		req.Header.Set(t.config.AuthHeader, t.config.AuthValue)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("collector request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("collector rejected record (status %d): %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Name returns TransportHTTPS
+func (t *HTTPSTransport) Name() string {
+	return TransportHTTPS
+}
+
+// Close releases idle connections to the collector
+func (t *HTTPSTransport) Close() error {
+	t.httpClient.CloseIdleConnections()
+	return nil
+}
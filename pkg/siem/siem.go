@@ -0,0 +1,63 @@
+// Package siem forwards audit records to a SIEM, such as Splunk, as JSON or
+// CEF over syslog (RFC 5424 over TCP or TLS) or to an HTTPS collector.
+// Records are queued and sent in the background, so a SIEM outage never
+// blocks the caller.
+package siem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Record formats
+const (
+	FormatJSON = "json"
+	FormatCEF  = "cef"
+)
+
+// Results of an audited action
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Record is one audited action as sent to the SIEM
+type Record struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Actor      string    `json:"actor"`
+	ActorName  string    `json:"actor_name,omitempty"`
+	ActorEmail string    `json:"actor_email,omitempty"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	ResourceID string    `json:"resource_id,omitempty"`
+	Result     string    `json:"result"` // ResultSuccess or ResultFailure
+	SourceIP   string    `json:"source_ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Details    string    `json:"details,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Transport delivers encoded records to a SIEM
+type Transport interface {
+	Send(ctx context.Context, payload []byte) error
+	// Name identifies the transport (syslog, https) in logs and health
+	Name() string
+	Close() error
+}
+
+// Encode serializes a record in format, FormatJSON or FormatCEF. The CEF
+// header names productVersion as the version of the product.
+func Encode(format string, record Record, productVersion string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.Marshal(record)
+	case FormatCEF:
+		return []byte(cef(record, productVersion)), nil
+	default:
+		return nil, fmt.Errorf("unknown audit record format %q", format)
+	}
+}
@@ -0,0 +1,414 @@
+package siem
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testRecord() Record {
+	return Record{
+		ID:         "evt-1",
+		Time:       time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		RequestID:  "req-42",
+		Actor:      "user-1",
+		ActorName:  "Dana",
+		ActorEmail: "dana@example.com",
+		Action:     "LOGIN",
+		Resource:   "auth",
+		ResourceID: "session-9",
+		Result:     ResultSuccess,
+		SourceIP:   "203.0.113.7",
+		UserAgent:  "curl/8.0",
+		Details:    "signed in",
+	}
+}
+
+// collector is a local syslog collector capturing the messages it receives
+type collector struct {
+	listener net.Listener
+	messages chan string
+}
+
+// newCollector listens on a local port, over TLS when config is not nil
+func newCollector(t *testing.T, config *tls.Config) *collector {
+	t.Helper()
+	var listener net.Listener
+	var err error
+	if config != nil {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", config)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{listener: listener, messages: make(chan string, 100)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go c.read(conn)
+		}
+	}()
+	return c
+}
+
+// read splits the octet-counted frames of a connection into messages
+func (c *collector) read(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			c.messages <- "bad frame length " + length
+			return
+		}
+		message := make([]byte, n)
+		if _, err := io.ReadFull(r, message); err != nil {
+			return
+		}
+		c.messages <- string(message)
+	}
+}
+
+func (c *collector) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case message := <-c.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message reached the collector")
+		return ""
+	}
+}
+
+// runForwarder runs f until the test ends
+func runForwarder(t *testing.T, f *Forwarder) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// syslogPayload checks the RFC 5424 header of a message and returns its
+// payload
+func syslogPayload(t *testing.T, message string) string {
+	t.Helper()
+	parts := strings.SplitN(message, " ", 8)
+	if len(parts) != 8 {
+		t.Fatalf("message %q is not RFC 5424", message)
+	}
+	if parts[0] != "<110>1" || parts[3] != "user-management" || parts[5] != "audit" || parts[6] != "-" {
+		t.Errorf("header = %q, want priority 110, version 1, app user-management, msgid audit and no structured data", parts[:7])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, parts[1]); err != nil {
+		t.Errorf("timestamp %q: %v", parts[1], err)
+	}
+	return parts[7]
+}
+
+func TestSyslogTransportSendsRFC5424Frames(t *testing.T) {
+	c := newCollector(t, nil)
+	f := NewForwarder(NewSyslogTransport(SyslogConfig{Address: c.listener.Addr().String()}), ForwarderConfig{Format: FormatJSON})
+	runForwarder(t, f)
+
+	second := testRecord()
+	second.ID, second.Result, second.Error = "evt-2", ResultFailure, "bad password"
+	f.Forward(testRecord())
+	f.Forward(second)
+
+	for _, want := range []Record{testRecord(), second} {
+		var got Record
+		if err := json.Unmarshal([]byte(syslogPayload(t, c.next(t))), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("forwarded record = %+v, want %+v", got, want)
+		}
+	}
+	if health := f.Health(); health.Forwarded != 2 || health.Failing || health.Transport != TransportSyslog {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestSyslogTransportOverTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	c := newCollector(t, server.TLS)
+	transport := NewSyslogTransport(SyslogConfig{
+		Address:   c.listener.Addr().String(),
+		TLS:       true,
+		TLSConfig: &tls.Config{RootCAs: roots},
+	})
+	defer transport.Close()
+
+	payload, err := Encode(FormatCEF, testRecord(), "1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.Send(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if got := syslogPayload(t, c.next(t)); got != string(payload) {
+		t.Errorf("payload = %q, want %q", got, payload)
+	}
+
+	// A collector whose certificate is not trusted gets nothing
+	untrusted := NewSyslogTransport(SyslogConfig{Address: c.listener.Addr().String(), TLS: true})
+	defer untrusted.Close()
+	if err := untrusted.Send(context.Background(), payload); err == nil {
+		t.Error("sent to a collector with an untrusted certificate")
+	}
+}
+
+func TestSyslogTransportReportsAnUnreachableCollector(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	transport := NewSyslogTransport(SyslogConfig{Address: address, Timeout: time.Second})
+	if err := transport.Send(context.Background(), []byte("{}")); err == nil || !strings.Contains(err.Error(), address) {
+		t.Errorf("Send = %v, want a connection error naming the collector", err)
+	}
+}
+
+func TestHTTPSTransportPostsRecords(t *testing.T) {
+	var mu sync.Mutex
+	var got []*http.Request
+	var bodies []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+		io.WriteString(w, "invalid token\n")
+	}))
+	defer server.Close()
+
+	transport := NewHTTPSTransport(HTTPSConfig{URL: server.URL, AuthHeader: "Authorization", AuthValue: "Splunk secret"})
+	defer transport.Close()
+	payload, _ := Encode(FormatJSON, testRecord(), "")
+	if err := transport.Send(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Method != http.MethodPost || got[0].Header.Get("Authorization") != "Splunk secret" || got[0].Header.Get("Content-Type") != "application/json" {
+		t.Errorf("request = %s with headers %v", got[0].Method, got[0].Header)
+	}
+	if bodies[0] != string(payload) {
+		t.Errorf("body = %q, want %q", bodies[0], payload)
+	}
+
+	mu.Lock()
+	status = http.StatusForbidden
+	mu.Unlock()
+	if err := transport.Send(context.Background(), payload); err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("Send to a rejecting collector = %v, want the status and reason", err)
+	}
+}
+
+// fakeTransport fails its first failures sends, then records the rest; a
+// non-nil block holds every send until it is closed
+type fakeTransport struct {
+	mu       sync.Mutex
+	failures int
+	block    chan struct{}
+	sent     []string
+	closed   bool
+}
+
+func (t *fakeTransport) Send(ctx context.Context, payload []byte) error {
+	if t.block != nil {
+		<-t.block
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failures > 0 {
+		t.failures--
+		return errors.New("collector unavailable")
+	}
+	t.sent = append(t.sent, string(payload))
+	return nil
+}
+
+func (t *fakeTransport) Name() string { return "fake" }
+
+func (t *fakeTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+func (t *fakeTransport) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.sent)
+}
+
+func TestForwardNeverBlocksOnAStalledSIEM(t *testing.T) {
+	transport := &fakeTransport{block: make(chan struct{})}
+	defer close(transport.block)
+	f := NewForwarder(transport, ForwarderConfig{BufferSize: 3})
+	runForwarder(t, f)
+
+	// The first record is taken by the stalled send, three wait and the
+	// rest are dropped
+	f.Forward(testRecord())
+	waitFor(t, "the first send", func() bool { return f.Health().Backlog == 0 })
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			f.Forward(testRecord())
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Forward blocked on a stalled SIEM")
+	}
+	if health := f.Health(); health.Backlog != 3 || health.Capacity != 3 || health.Dropped != 7 {
+		t.Errorf("health = %+v, want a backlog of 3 and 7 dropped", health)
+	}
+}
+
+func TestForwarderRetriesFailedSends(t *testing.T) {
+	transport := &fakeTransport{failures: 2}
+	f := NewForwarder(transport, ForwarderConfig{MaxRetries: 2, RetryBackoff: time.Millisecond})
+	runForwarder(t, f)
+
+	f.Forward(testRecord())
+	waitFor(t, "the record", func() bool { return f.Health().Forwarded == 1 })
+	if health := f.Health(); health.Failed != 0 || health.Failing {
+		t.Errorf("health after a send succeeded on its last retry = %+v", health)
+	}
+
+	transport.mu.Lock()
+	transport.failures = 3
+	transport.mu.Unlock()
+	f.Forward(testRecord())
+	waitFor(t, "the record to be given up", func() bool { return f.Health().Failed == 1 })
+	if health := f.Health(); !health.Failing || health.LastError != "collector unavailable" || health.Forwarded != 1 {
+		t.Errorf("health after the retries ran out = %+v", health)
+	}
+}
+
+func TestForwarderDryRunSendsNothing(t *testing.T) {
+	transport := &fakeTransport{}
+	f := NewForwarder(transport, ForwarderConfig{DryRun: true})
+	runForwarder(t, f)
+
+	f.Forward(testRecord())
+	waitFor(t, "the record to be logged", func() bool { return f.Health().Forwarded == 1 })
+	if n := transport.count(); n != 0 {
+		t.Errorf("a dry run sent %d records", n)
+	}
+	if !f.Health().DryRun {
+		t.Error("health does not report the dry run")
+	}
+}
+
+func TestForwarderDrainsOnShutdown(t *testing.T) {
+	transport := &fakeTransport{}
+	f := NewForwarder(transport, ForwarderConfig{})
+	for i := 0; i < 5; i++ {
+		f.Forward(testRecord())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f.Run(ctx)
+	if n := transport.count(); n != 5 || !transport.closed {
+		t.Errorf("sent %d records (closed %t) on shutdown, want 5 and the transport closed", n, transport.closed)
+	}
+
+	// Without retries: the first failure gives up on the rest
+	transport = &fakeTransport{failures: 100}
+	f = NewForwarder(transport, ForwarderConfig{MaxRetries: 5})
+	for i := 0; i < 5; i++ {
+		f.Forward(testRecord())
+	}
+	f.Run(ctx)
+	if health := f.Health(); health.Failed != 5 || transport.failures < 95 {
+		t.Errorf("health = %+v after %d sends on a failing shutdown, want all 5 failed after 5 sends at most", health, 100-transport.failures)
+	}
+}
+
+func TestForwardOnNilForwarder(t *testing.T) {
+	var f *Forwarder
+	f.Forward(testRecord())
+}
+
+func TestEncodeCEF(t *testing.T) {
+	record := testRecord()
+	record.Action = "LOGIN|SSO"
+	record.Result = ResultFailure
+	record.Details = "a=b\nc"
+	record.Error = `bad\password`
+
+	got, err := Encode(FormatCEF, record, "2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `CEF:0|White|user-management|2.0|LOGIN\|SSO|auth LOGIN\|SSO|6|` +
+		`rt=1772366400000 externalId=evt-1 suid=user-1 suser=Dana act=LOGIN|SSO outcome=failure ` +
+		`src=203.0.113.7 requestClientApplication=curl/8.0 ` +
+		`cs1Label=requestId cs1=req-42 cs2Label=resource cs2=auth cs3Label=resourceId cs3=session-9 ` +
+		`msg=a\=b\nc bad\\password`
+	if string(got) != want {
+		t.Errorf("CEF =\n%s\nwant\n%s", got, want)
+	}
+
+	// Empty values are left out and a success is low severity
+	got, _ = Encode(FormatCEF, Record{Action: "LOGOUT", Resource: "auth", Result: ResultSuccess, Time: record.Time}, "2.0")
+	if want := "CEF:0|White|user-management|2.0|LOGOUT|auth LOGOUT|3|rt=1772366400000 act=LOGOUT outcome=success cs2Label=resource cs2=auth"; string(got) != want {
+		t.Errorf("CEF =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := Encode("xml", record, ""); err == nil {
+		t.Error("Encode accepted an unknown format")
+	}
+}
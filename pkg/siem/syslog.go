@@ -0,0 +1,123 @@
+package siem
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// TransportSyslog names the syslog transport
+	TransportSyslog = "syslog"
+
+	// defaultSyslogTimeout bounds dialing and one write when SyslogConfig
+	// sets no Timeout
+	defaultSyslogTimeout = 5 * time.Second
+
+	// syslogPriority is facility 13 (log audit) at severity 6 (informational)
+	syslogPriority = 13*8 + 6
+	syslogAppName  = "user-management"
+	syslogMsgID    = "audit"
+)
+
+// SyslogConfig holds the settings of a syslog collector
+type SyslogConfig struct {
+	Address   string      // host:port
+	TLS       bool        // RFC 5425 syslog over TLS instead of plain TCP
+	TLSConfig *tls.Config // Optional, e.g. for a private CA; nil uses the system roots
+	Timeout   time.Duration
+}
+
+// SyslogTransport sends records as RFC 5424 messages over one TCP or TLS
+// connection, framed by octet counting (RFC 6587). The connection is opened
+// on first use and again after a failed write.
+type SyslogTransport struct {
+	config   SyslogConfig
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogTransport creates a syslog transport; nothing is dialed until
+// the first record is sent
+func NewSyslogTransport(config SyslogConfig) *SyslogTransport {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultSyslogTimeout
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogTransport{config: config, hostname: hostname}
+}
+
+// Send writes one record as a syslog message
+func (t *SyslogTransport) Send(ctx context.Context, payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		conn, err := t.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog collector %s: %w", t.config.Address, err)
+		}
+		t.conn = conn
+	}
+
+	message := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogPriority,
+		time.Now().UTC().Format(time.RFC3339Nano),
+		t.hostname,
+		syslogAppName,
+		os.Getpid(),
+		syslogMsgID,
+		payload,
+	)
+	frame := strconv.Itoa(len(message)) + " " + message
+
+	deadline := time.Now().Add(t.config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	t.conn.SetWriteDeadline(deadline)
+	if _, err := t.conn.Write([]byte(frame)); err != nil {
+		t.conn.Close()
+		t.conn = nil
+		return fmt.Errorf("failed to write to syslog collector %s: %w", t.config.Address, err)
+	}
+	return nil
+}
+
+func (t *SyslogTransport) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.config.Timeout)
+	defer cancel()
+	if t.config.TLS {
+		dialer := &tls.Dialer{Config: t.config.TLSConfig}
+		return dialer.DialContext(ctx, "tcp", t.config.Address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", t.config.Address)
+}
+
+// Name returns TransportSyslog
+func (t *SyslogTransport) Name() string {
+	return TransportSyslog
+}
+
+// Close closes the connection to the collector
+func (t *SyslogTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
@@ -0,0 +1,27 @@
+package sms
+
+import (
+	"context"
+	"log"
+)
+
+// LogSender logs messages instead of sending them. It is used when no
+// provider is configured so development setups work without one.
+type LogSender struct{}
+
+// NewLogSender creates a logging sender
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+// SendSMS logs the masked recipient of a message; the body is not logged as
+// it usually holds a code
+func (s *LogSender) SendSMS(ctx context.Context, to, body string) error {
+	log.Printf("SMS provider not configured. A %d character text would be sent to %s", len(body), MaskNumber(to))
+	return nil
+}
+
+// Name returns ProviderLog
+func (s *LogSender) Name() string {
+	return ProviderLog
+}
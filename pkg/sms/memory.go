@@ -0,0 +1,59 @@
+package sms
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Message is a text message kept by a MemorySender
+type Message struct {
+	To     string
+	Body   string
+	SentAt time.Time
+}
+
+// MemorySender keeps messages in memory instead of sending them, for tests
+// and local runs that need to read the codes sent. It is safe for
+// concurrent use.
+type MemorySender struct {
+	mu   sync.Mutex
+	sent []Message
+	err  error
+}
+
+// NewMemorySender creates an empty MemorySender
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+// SendSMS keeps the message, or returns the error set by FailWith
+func (s *MemorySender) SendSMS(ctx context.Context, to, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, Message{To: to, Body: body, SentAt: time.Now()})
+	return nil
+}
+
+// FailWith makes every following send return err; nil makes them succeed
+// again
+func (s *MemorySender) FailWith(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Sent returns the messages kept so far, oldest first
+func (s *MemorySender) Sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.sent...)
+}
+
+// Name returns ProviderMemory
+func (s *MemorySender) Name() string {
+	return ProviderMemory
+}
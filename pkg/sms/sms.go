@@ -0,0 +1,32 @@
+// Package sms defines the provider-neutral interface used to send text
+// messages, with Twilio, logging and in-memory implementations.
+package sms
+
+import (
+	"context"
+	"strings"
+)
+
+// Provider names
+const (
+	ProviderTwilio = "twilio"
+	ProviderLog    = "log"
+	ProviderMemory = "memory"
+)
+
+// Sender delivers a plain text message to a phone number in E.164 form,
+// such as +14155550123
+type Sender interface {
+	SendSMS(ctx context.Context, to, body string) error
+	// Name identifies the provider (ProviderTwilio, ProviderLog, ...)
+	Name() string
+}
+
+// MaskNumber hides all but the last four digits of a phone number, for
+// messages and logs
+func MaskNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
@@ -0,0 +1,77 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTwilioTimeout bounds a call to the messages API when TwilioConfig
+// sets no Timeout
+const defaultTwilioTimeout = 5 * time.Second
+
+// TwilioConfig holds Twilio API settings
+type TwilioConfig struct {
+	AccountSID string
+	AuthToken  string
+	APIURL     string // e.g. https://api.twilio.com
+	From       string // Sending number in E.164 form
+	Timeout    time.Duration
+}
+
+// TwilioSender sends text messages through the Twilio messages API
+type TwilioSender struct {
+	config     TwilioConfig
+	httpClient *http.Client
+}
+
+// NewTwilioSender creates a Twilio sender
+func NewTwilioSender(config TwilioConfig) *TwilioSender {
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTwilioTimeout
+	}
+	return &TwilioSender{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// SendSMS posts a message to the Twilio API. Twilio accepts the message
+// for delivery; whether it reaches the phone is not reported back.
+func (s *TwilioSender) SendSMS(ctx context.Context, to, body string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", s.config.From)
+	form.Set("Body", body)
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", s.config.APIURL, url.PathEscape(s.config.AccountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create Twilio request: %w", err)
+	}
+	req.SetBasicAuth(s.config.AccountSID, s.config.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Twilio request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Twilio rejected message (status %d): %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Name returns ProviderTwilio
+func (s *TwilioSender) Name() string {
+	return ProviderTwilio
+}
@@ -0,0 +1,156 @@
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// DefaultMaxAttachmentBytes caps the combined size of a message's attachments
+const DefaultMaxAttachmentBytes int64 = 10 << 20
+
+// base64LineLength is the maximum encoded line length allowed by RFC 2045
+const base64LineLength = 76
+
+// ErrAttachmentsTooLarge is returned when a message's attachments exceed the size cap
+var ErrAttachmentsTooLarge = errors.New("attachments exceed the maximum total size")
+
+// EmailAttachment is an attachment ready to be encoded into a message.
+// A non-empty ContentID makes it an inline part referenced from the HTML
+// body as cid:<ContentID>.
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+// AttachmentLoader fetches the bytes of an attachment stored elsewhere, given
+// the storage reference recorded on the message (CommunicationAttachment.FileURL)
+type AttachmentLoader func(ref string) ([]byte, error)
+
+// SetAttachmentLoader sets how attachments without inline bytes are fetched
+func (c *SMTPClient) SetAttachmentLoader(loader AttachmentLoader) {
+	c.attachmentLoader = loader
+}
+
+// resolveAttachments loads the bytes of every attachment and checks the
+// combined size against the client's cap
+func (c *SMTPClient) resolveAttachments(atts []models.CommunicationAttachment) ([]EmailAttachment, error) {
+	if len(atts) == 0 {
+		return nil, nil
+	}
+
+	maxBytes := c.maxAttachmentBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxAttachmentBytes
+	}
+
+	// Reject on recorded sizes first so oversized files are never fetched
+	var declared int64
+	for _, att := range atts {
+		declared += att.FileSize
+	}
+	if declared > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrAttachmentsTooLarge, declared, maxBytes)
+	}
+
+	result := make([]EmailAttachment, 0, len(atts))
+	var total int64
+	for i, att := range atts {
+		name := strings.TrimSpace(att.FileName)
+		if name == "" {
+			return nil, fmt.Errorf("attachment %d has no file name", i)
+		}
+
+		data := att.Data
+		if data == nil {
+			if att.FileURL == "" {
+				return nil, fmt.Errorf("attachment %q has no data or storage reference", name)
+			}
+			if c.attachmentLoader == nil {
+				return nil, fmt.Errorf("attachment %q is stored at %s but no attachment loader is configured", name, att.FileURL)
+			}
+			loaded, err := c.attachmentLoader(att.FileURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load attachment %q: %w", name, err)
+			}
+			data = loaded
+		}
+
+		total += int64(len(data))
+		if total > maxBytes {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrAttachmentsTooLarge, maxBytes)
+		}
+
+		contentType := att.FileType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(name))
+		}
+		// Parameters are dropped; the part header carries its own name parameter
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			contentType = mediaType
+		} else {
+			contentType = "application/octet-stream"
+		}
+
+		result = append(result, EmailAttachment{
+			Filename:    name,
+			ContentType: contentType,
+			ContentID:   strings.Trim(att.ContentID, "<>"),
+			Data:        data,
+		})
+	}
+	return result, nil
+}
+
+// wrapMultipart nests an entity as the first part of a new multipart/<subtype>
+// body followed by the given attachments
+func wrapMultipart(subtype string, header textproto.MIMEHeader, content []byte, atts []EmailAttachment) (textproto.MIMEHeader, []byte) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	part, _ := writer.CreatePart(header)
+	part.Write(content)
+	for _, att := range atts {
+		writeAttachmentPart(writer, att)
+	}
+	writer.Close()
+
+	wrapped := textproto.MIMEHeader{}
+	wrapped.Set("Content-Type", fmt.Sprintf("multipart/%s; boundary=\"%s\"", subtype, writer.Boundary()))
+	return wrapped, buf.Bytes()
+}
+
+// writeAttachmentPart adds a base64-encoded attachment part. Inline parts get a
+// Content-ID so the HTML body can reference them.
+func writeAttachmentPart(writer *multipart.Writer, att EmailAttachment) {
+	disposition := "attachment"
+	if att.ContentID != "" {
+		disposition = "inline"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(att.ContentType, map[string]string{"name": att.Filename}))
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": att.Filename}))
+	if att.ContentID != "" {
+		header.Set("Content-ID", "<"+att.ContentID+">")
+	}
+
+	part, _ := writer.CreatePart(header)
+	encoded := base64.StdEncoding.EncodeToString(att.Data)
+	for len(encoded) > base64LineLength {
+		part.Write([]byte(encoded[:base64LineLength] + "\r\n"))
+		encoded = encoded[base64LineLength:]
+	}
+	part.Write([]byte(encoded + "\r\n"))
+}
@@ -0,0 +1,226 @@
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// entity is a parsed MIME entity: its header and either its decoded body or
+// its parts
+type entity struct {
+	header    textproto.MIMEHeader
+	mediaType string
+	body      []byte
+	parts     []*entity
+}
+
+// parseEntity parses a MIME entity, descending into multipart bodies and
+// decoding base64 and quoted-printable ones
+func parseEntity(t *testing.T, header textproto.MIMEHeader, body io.Reader) *entity {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type %q: %v", header.Get("Content-Type"), err)
+	}
+	e := &entity{header: header, mediaType: mediaType}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", mediaType, err)
+			}
+			e.parts = append(e.parts, parseEntity(t, part.Header, part))
+		}
+		return e
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch header.Get("Content-Transfer-Encoding") {
+	case "base64":
+		for _, line := range strings.Split(strings.TrimRight(string(raw), "\r\n"), "\r\n") {
+			if len(line) > base64LineLength {
+				t.Errorf("%s: base64 line of %d characters, want at most %d", mediaType, len(line), base64LineLength)
+			}
+		}
+		if e.body, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", "")); err != nil {
+			t.Fatalf("%s: %v", mediaType, err)
+		}
+	case "quoted-printable":
+		if e.body, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(raw))); err != nil {
+			t.Fatalf("%s: %v", mediaType, err)
+		}
+	default:
+		e.body = raw
+	}
+	return e
+}
+
+// parseMessage parses a whole message as net/mail reads it
+func parseMessage(t *testing.T, content []byte) (mail.Header, *entity) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.Header, parseEntity(t, textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+// shape returns the media types of e and its parts, nested in brackets
+func (e *entity) shape() string {
+	if len(e.parts) == 0 {
+		return e.mediaType
+	}
+	shapes := make([]string, len(e.parts))
+	for i, part := range e.parts {
+		shapes[i] = part.shape()
+	}
+	return e.mediaType + "[" + strings.Join(shapes, " ") + "]"
+}
+
+func testMessage(attachments ...models.CommunicationAttachment) *models.CommMessage {
+	return &models.CommMessage{
+		MessageID:   "msg-1",
+		ToAddresses: []string{"lee@acme.test"},
+		Subject:     "Your renewal quote",
+		BodyText:    "The quote is attached.",
+		BodyHTML:    `<p>The quote is attached.</p><img src="cid:logo@acme">`,
+		Attachments: attachments,
+	}
+}
+
+func testClient() *SMTPClient {
+	return NewSMTPClient(&SMTPConfig{Host: "localhost", Port: 25, FromEmail: "sales@white.test"})
+}
+
+func TestMessagesWithAttachmentsAreMultipartMixed(t *testing.T) {
+	logo := bytes.Repeat([]byte{0x89, 'P', 'N', 'G', 0x00, 0xff}, 40)
+	quote := bytes.Repeat([]byte("%PDF-1.7 quote "), 100)
+	_, content, err := testClient().prepareMessage(testMessage(
+		models.CommunicationAttachment{FileName: "quote.pdf", Data: quote},
+		models.CommunicationAttachment{FileName: "logo.png", FileType: "image/png; charset=binary", ContentID: "<logo@acme>", Data: logo},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, root := parseMessage(t, content)
+	if got := header.Get("Subject"); got != "Your renewal quote" {
+		t.Errorf("Subject = %q", got)
+	}
+	want := "multipart/mixed[multipart/related[multipart/alternative[text/plain text/html] image/png] application/pdf]"
+	if got := root.shape(); got != want {
+		t.Fatalf("structure = %s, want %s", got, want)
+	}
+
+	alternative := root.parts[0].parts[0]
+	if text := string(alternative.parts[0].body); text != "The quote is attached." {
+		t.Errorf("text body = %q", text)
+	}
+
+	image := root.parts[0].parts[1]
+	if got := image.header.Get("Content-ID"); got != "<logo@acme>" {
+		t.Errorf("Content-ID = %q, want <logo@acme>", got)
+	}
+	if disposition, params, _ := mime.ParseMediaType(image.header.Get("Content-Disposition")); disposition != "inline" || params["filename"] != "logo.png" {
+		t.Errorf("image Content-Disposition = %q", image.header.Get("Content-Disposition"))
+	}
+	if !bytes.Equal(image.body, logo) {
+		t.Error("the decoded image differs from the attached bytes")
+	}
+
+	pdf := root.parts[1]
+	if disposition, params, _ := mime.ParseMediaType(pdf.header.Get("Content-Disposition")); disposition != "attachment" || params["filename"] != "quote.pdf" {
+		t.Errorf("pdf Content-Disposition = %q", pdf.header.Get("Content-Disposition"))
+	}
+	if pdf.header.Get("Content-ID") != "" {
+		t.Errorf("a regular attachment has Content-ID %q", pdf.header.Get("Content-ID"))
+	}
+	if !bytes.Equal(pdf.body, quote) {
+		t.Error("the decoded PDF differs from the attached bytes")
+	}
+}
+
+func TestMessagesWithoutAttachmentsKeepTheirBody(t *testing.T) {
+	_, content, err := testClient().prepareMessage(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, root := parseMessage(t, content); root.shape() != "multipart/alternative[text/plain text/html]" {
+		t.Errorf("structure = %s, want the alternative body alone", root.shape())
+	}
+
+	// Only inline images: related without mixed
+	_, content, err = testClient().prepareMessage(testMessage(models.CommunicationAttachment{FileName: "logo.png", ContentID: "logo@acme", Data: []byte("png")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, root := parseMessage(t, content); root.shape() != "multipart/related[multipart/alternative[text/plain text/html] image/png]" {
+		t.Errorf("structure = %s, want related only", root.shape())
+	}
+}
+
+func TestAttachmentsAreLoadedFromStorage(t *testing.T) {
+	client := testClient()
+	stored := models.CommunicationAttachment{FileName: "terms.txt", FileURL: "files/terms.txt"}
+	if _, _, err := client.prepareMessage(testMessage(stored)); err == nil || !strings.Contains(err.Error(), "no attachment loader") {
+		t.Errorf("stored attachment without a loader = %v, want an error", err)
+	}
+
+	var loaded []string
+	client.SetAttachmentLoader(func(ref string) ([]byte, error) {
+		loaded = append(loaded, ref)
+		return []byte("Terms and conditions"), nil
+	})
+	_, content, err := client.prepareMessage(testMessage(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0] != "files/terms.txt" {
+		t.Errorf("loaded %v, want the storage reference", loaded)
+	}
+	_, root := parseMessage(t, content)
+	if got := root.parts[1]; got.mediaType != "text/plain" || string(got.body) != "Terms and conditions" {
+		t.Errorf("attachment = %s %q, want the loaded text", got.mediaType, got.body)
+	}
+}
+
+func TestAttachmentSizeCap(t *testing.T) {
+	client := NewSMTPClient(&SMTPConfig{Host: "localhost", Port: 25, FromEmail: "sales@white.test", MaxAttachmentBytes: 100})
+	client.SetAttachmentLoader(func(ref string) ([]byte, error) {
+		t.Errorf("%s was fetched though its recorded size is over the cap", ref)
+		return nil, nil
+	})
+
+	for name, atts := range map[string][]models.CommunicationAttachment{
+		"recorded sizes": {{FileName: "a.bin", FileURL: "a", FileSize: 60}, {FileName: "b.bin", FileURL: "b", FileSize: 60}},
+		"actual bytes":   {{FileName: "a.bin", Data: make([]byte, 60)}, {FileName: "b.bin", Data: make([]byte, 41)}},
+	} {
+		if _, _, err := client.prepareMessage(testMessage(atts...)); !errors.Is(err, ErrAttachmentsTooLarge) {
+			t.Errorf("%s over the cap = %v, want ErrAttachmentsTooLarge", name, err)
+		}
+	}
+	if _, _, err := client.prepareMessage(testMessage(models.CommunicationAttachment{FileName: "a.bin", Data: make([]byte, 100)})); err != nil {
+		t.Errorf("attachments at the cap = %v", err)
+	}
+	if got := testClient().maxAttachmentBytes; got != DefaultMaxAttachmentBytes {
+		t.Errorf("default cap = %d, want %d", got, DefaultMaxAttachmentBytes)
+	}
+}
@@ -0,0 +1,205 @@
+package smtp
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"net/textproto"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// bulkMaxRetries is how many times a message is retried after a temporary
+// (4xx) SMTP reply or a dropped connection
+const bulkMaxRetries = 2
+
+// BulkRecipientResult is the outcome of one recipient of one bulk message
+type BulkRecipientResult struct {
+	MessageIndex int    `json:"message_index"`
+	MessageID    string `json:"message_id,omitempty"`
+	Recipient    string `json:"recipient"`
+	Sent         bool   `json:"sent"`
+	Attempts     int    `json:"attempts"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SendBulkEmailResult reports per-recipient outcomes of a bulk send
+type SendBulkEmailResult struct {
+	Sent        int                   `json:"sent"`
+	Failed      int                   `json:"failed"`
+	Connections int                   `json:"connections"` // SMTP sessions opened for the batch
+	Recipients  []BulkRecipientResult `json:"recipients"`
+}
+
+// Err summarises the failures of a bulk send, or returns nil when every
+// recipient was sent
+func (r *SendBulkEmailResult) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("bulk send completed with %d failed recipients of %d", r.Failed, r.Failed+r.Sent)
+}
+
+func (r *SendBulkEmailResult) record(index int, msgID, recipient string, attempts int, err error) {
+	result := BulkRecipientResult{
+		MessageIndex: index,
+		MessageID:    msgID,
+		Recipient:    recipient,
+		Sent:         err == nil,
+		Attempts:     attempts,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		r.Failed++
+	} else {
+		r.Sent++
+	}
+	r.Recipients = append(r.Recipients, result)
+}
+
+// bulkSession holds the connection shared by the messages of a batch
+type bulkSession struct {
+	c      *SMTPClient
+	client *smtp.Client
+	used   bool  // a transaction ran since the last RSET
+	err    error // permanent connect failure; the rest of the batch fails fast
+	result *SendBulkEmailResult
+}
+
+// ready returns a session positioned for a new transaction, resetting the
+// current connection or reconnecting when it can no longer be used
+func (s *bulkSession) ready() (*smtp.Client, error) {
+	if s.client != nil && s.used {
+		if err := s.client.Reset(); err != nil {
+			s.drop()
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.client == nil {
+		client, err := s.c.connect()
+		if err != nil {
+			if !isTemporarySMTPError(err) {
+				s.err = err
+			}
+			return nil, err
+		}
+		s.client = client
+		s.result.Connections++
+	}
+	s.used = true
+	return s.client, nil
+}
+
+// drop closes a connection that failed mid-transaction
+func (s *bulkSession) drop() {
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+func (s *bulkSession) close() {
+	if s.client != nil {
+		s.client.Quit()
+		s.drop()
+	}
+}
+
+// SendBulkEmail sends multiple emails over a single reused SMTP connection.
+// Messages are separated by RSET, a dropped connection is re-established, and
+// a message is retried up to bulkMaxRetries times on temporary failures.
+// Recipients rejected permanently are reported without blocking the others.
+func (c *SMTPClient) SendBulkEmail(msgs []*models.CommMessage) *SendBulkEmailResult {
+	result := &SendBulkEmailResult{}
+	if len(msgs) == 0 {
+		return result
+	}
+
+	session := &bulkSession{c: c, result: result}
+	defer session.close()
+
+	for i, msg := range msgs {
+		recipients, content, err := c.prepareMessage(msg)
+		if err != nil {
+			msgID := ""
+			if msg != nil {
+				msgID = msg.MessageID
+				recipients = c.getAllRecipients(msg)
+			}
+			if len(recipients) == 0 {
+				recipients = []string{""}
+			}
+			for _, recipient := range recipients {
+				result.record(i, msgID, recipient, 0, err)
+			}
+			continue
+		}
+		session.send(i, msg.MessageID, recipients, content)
+	}
+
+	return result
+}
+
+// send delivers one message, retrying recipients that got a temporary failure
+func (s *bulkSession) send(index int, msgID string, recipients []string, content []byte) {
+	pending := recipients
+	for attempt := 1; len(pending) > 0; attempt++ {
+		retry := attempt <= bulkMaxRetries
+
+		client, err := s.ready()
+		if err != nil {
+			if retry && isTemporarySMTPError(err) {
+				continue
+			}
+			for _, recipient := range pending {
+				s.result.record(index, msgID, recipient, attempt, err)
+			}
+			return
+		}
+
+		// A failed MAIL or DATA fails every accepted recipient; a reply
+		// means the session is still usable, anything else means it is gone
+		rejected, err := s.c.deliver(client, pending, content, false)
+		txFailed := err != nil && len(rejected) < len(pending)
+		if txFailed && !isSMTPReply(err) {
+			s.drop()
+		}
+
+		var next []string
+		for _, recipient := range pending {
+			rcptErr, wasRejected := rejected[recipient]
+			if !wasRejected {
+				if !txFailed {
+					s.result.record(index, msgID, recipient, attempt, nil)
+					continue
+				}
+				rcptErr = err
+			}
+			if retry && isTemporarySMTPError(rcptErr) {
+				next = append(next, recipient)
+				continue
+			}
+			s.result.record(index, msgID, recipient, attempt, rcptErr)
+		}
+		pending = next
+	}
+}
+
+// isSMTPReply reports whether err carries a reply from the server, meaning
+// the connection is still usable
+func isSMTPReply(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply)
+}
+
+// isTemporarySMTPError reports whether err is a 4xx reply or a broken
+// connection, both worth another attempt
+func isTemporarySMTPError(err error) bool {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code >= 400 && reply.Code < 500
+	}
+	return err != nil
+}
@@ -0,0 +1,153 @@
+package smtp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// bulkMessages returns n messages, the ith to recipient<i>@acme.test
+func bulkMessages(n int) []*models.CommMessage {
+	msgs := make([]*models.CommMessage, n)
+	for i := range msgs {
+		msgs[i] = &models.CommMessage{
+			MessageID:   fmt.Sprintf("msg-%d", i),
+			ToAddresses: []string{fmt.Sprintf("recipient%d@acme.test", i)},
+			Subject:     "Spring campaign",
+			BodyText:    "Hello from the spring campaign",
+		}
+	}
+	return msgs
+}
+
+// TestBulkSendReusesOneConnection sends a batch on a single session,
+// separating the messages with RSET, where SendEmail dials once per message
+func TestBulkSendReusesOneConnection(t *testing.T) {
+	const n = 50
+	server := startFakeServer(t)
+	client := server.client()
+
+	result := client.SendBulkEmail(bulkMessages(n))
+	if result.Err() != nil || result.Sent != n || len(result.Recipients) != n {
+		t.Fatalf("result = %+v, want %d sent", result, n)
+	}
+	connections, resets := server.stats()
+	if connections != 1 || result.Connections != 1 {
+		t.Errorf("bulk send opened %d connections (reported %d), want 1", connections, result.Connections)
+	}
+	if resets != n-1 {
+		t.Errorf("RSET sent %d times, want %d", resets, n-1)
+	}
+	for i := 0; i < n; i++ {
+		if got := server.deliveries(fmt.Sprintf("recipient%d@acme.test", i)); got != 1 {
+			t.Fatalf("recipient%d got %d messages, want 1", i, got)
+		}
+	}
+
+	// The single-message path is unchanged: a session per message
+	for _, msg := range bulkMessages(3) {
+		if err := client.SendEmail(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if connections, _ := server.stats(); connections != 1+3 {
+		t.Errorf("SendEmail opened %d connections for 3 messages, want 3", connections-1)
+	}
+}
+
+func TestBulkSendRetriesTemporaryFailures(t *testing.T) {
+	server := startFakeServer(t)
+	server.rcptReply = func(address string, attempt int) string {
+		switch address {
+		case "recipient1@acme.test": // Greylisted once
+			if attempt == 1 {
+				return "451 4.7.1 Greylisted, try again"
+			}
+		case "recipient2@acme.test":
+			return "550 5.1.1 No such user"
+		case "recipient3@acme.test":
+			return "452 4.2.2 Mailbox full"
+		}
+		return ""
+	}
+
+	result := server.client().SendBulkEmail(bulkMessages(5))
+	want := map[string]struct {
+		sent     bool
+		attempts int
+	}{
+		"recipient0@acme.test": {true, 1},
+		"recipient1@acme.test": {true, 2},
+		"recipient2@acme.test": {false, 1},
+		"recipient3@acme.test": {false, 1 + bulkMaxRetries},
+		"recipient4@acme.test": {true, 1},
+	}
+	if len(result.Recipients) != len(want) {
+		t.Fatalf("recipients = %+v, want %d", result.Recipients, len(want))
+	}
+	for _, got := range result.Recipients {
+		w := want[got.Recipient]
+		if got.Sent != w.sent || got.Attempts != w.attempts {
+			t.Errorf("%s: sent %v after %d attempts (%s), want sent %v after %d", got.Recipient, got.Sent, got.Attempts, got.Error, w.sent, w.attempts)
+		}
+		if !got.Sent && got.Error == "" {
+			t.Errorf("%s failed without an error", got.Recipient)
+		}
+	}
+	if result.Sent != 3 || result.Failed != 2 || result.Err() == nil {
+		t.Errorf("sent %d, failed %d, err %v; want 3 sent and 2 failed", result.Sent, result.Failed, result.Err())
+	}
+	if result.Connections != 1 {
+		t.Errorf("connections = %d, want rejections to keep the session", result.Connections)
+	}
+}
+
+func TestBulkSendReconnectsAfterADroppedConnection(t *testing.T) {
+	server := startFakeServer(t)
+	server.hangUpOnData = 2
+
+	result := server.client().SendBulkEmail(bulkMessages(4))
+	if result.Err() != nil {
+		t.Fatalf("result = %+v", result)
+	}
+	if connections, _ := server.stats(); connections != 2 || result.Connections != 2 {
+		t.Errorf("connections = %d (reported %d), want one reconnect", connections, result.Connections)
+	}
+	for i := 0; i < 4; i++ {
+		if got := server.deliveries(fmt.Sprintf("recipient%d@acme.test", i)); got != 1 {
+			t.Errorf("recipient%d got %d messages, want 1", i, got)
+		}
+	}
+	if attempts := result.Recipients[1].Attempts; attempts != 2 {
+		t.Errorf("the message cut off attempts = %d, want 2", attempts)
+	}
+}
+
+func TestBulkSendReportsInvalidMessages(t *testing.T) {
+	server := startFakeServer(t)
+	msgs := bulkMessages(2)
+	msgs[0].Subject = ""
+
+	result := server.client().SendBulkEmail(msgs)
+	if result.Sent != 1 || result.Failed != 1 {
+		t.Fatalf("result = %+v, want the valid message sent", result)
+	}
+	if got := result.Recipients[0]; got.Recipient != "recipient0@acme.test" || got.Attempts != 0 || got.Error == "" {
+		t.Errorf("invalid message = %+v, want it failed before any attempt", got)
+	}
+}
+
+func BenchmarkSendBulkEmail(b *testing.B) {
+	server := startFakeServer(b)
+	client := server.client()
+	msgs := bulkMessages(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.SendBulkEmail(msgs).Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	connections, _ := server.stats()
+	b.ReportMetric(float64(connections)/float64(b.N), "connections/batch")
+}
@@ -1,11 +1,12 @@
 package smtp
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
+	"mime/multipart"
+	"net/textproto"
 	"strings"
-	"os"
-	"strconv"
 	"net/smtp"
 	"mime/quotedprintable"
 	"time"
@@ -14,12 +15,6 @@ import (
 	"github.com/white/user-management/internal/models"
 )
 
-type EmailAttachment struct {
-	Filename    string
-	ContentType string
-	Data        []byte
-}
-
 // loginAuth implements the LOGIN authentication mechanism for SMTP
 // Office 365 may require this instead of PLAIN auth
 type loginAuth struct {
@@ -90,6 +85,11 @@ type SMTPClient struct {
 	fromEmail  string
 	replyTo    string
 	tlsEnabled bool
+	tracker    *Tracker    // nil disables open/click tracking
+	dkim       *DKIMSigner // nil sends messages unsigned
+
+	maxAttachmentBytes int64
+	attachmentLoader   AttachmentLoader // nil when attachments must carry their own bytes
 }
 
 // SMTPConfig holds SMTP configuration
@@ -101,64 +101,16 @@ type SMTPConfig struct {
 	FromEmail  string
 	ReplyTo    string
 	TLSEnabled bool
-}
-
-// NewSMTPClientFromEnv creates a new SMTP client from environment variables
-func NewSMTPClientFromEnv() (*SMTPClient, error) {
-	host := os.Getenv("SMTP_HOST")
-	if host == "" {
-		return nil, fmt.Errorf("SMTP_HOST is not configured")
-	}
-
-	portStr := os.Getenv("SMTP_PORT")
-	port := 587 // default
-	if portStr != "" {
-		var err error
-		port, err = strconv.Atoi(portStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
-		}
-	}
-
-	username := os.Getenv("SMTP_USER")
-	if username == "" {
-		return nil, fmt.Errorf("SMTP_USER is not configured")
-	}
-
-	password := os.Getenv("SMTP_PASSWORD")
-	if password == "" {
-		return nil, fmt.Errorf("SMTP_PASSWORD is not configured")
-	}
-
-	fromEmail := os.Getenv("SMTP_FROM_EMAIL")
-	if fromEmail == "" {
-		fromEmail = username // default to username
-	}
-
-	replyTo := os.Getenv("SMTP_REPLY_TO")
-	if replyTo == "" {
-		replyTo = fromEmail // default to fromEmail
-	}
 
-	tlsEnabled := true
-	tlsStr := os.Getenv("SMTP_TLS_ENABLED")
-	if tlsStr != "" {
-		tlsEnabled = strings.ToLower(tlsStr) == "true" || tlsStr == "1"
-	}
-
-	return &SMTPClient{
-		host:       host,
-		port:       port,
-		username:   username,
-		password:   password,
-		fromEmail:  fromEmail,
-		replyTo:    replyTo,
-		tlsEnabled: tlsEnabled,
-	}, nil
+	MaxAttachmentBytes int64 // total attachment size cap; 0 uses DefaultMaxAttachmentBytes
 }
 
 // NewSMTPClient creates a new SMTP client with explicit configuration
 func NewSMTPClient(config *SMTPConfig) *SMTPClient {
+	maxAttachmentBytes := config.MaxAttachmentBytes
+	if maxAttachmentBytes <= 0 {
+		maxAttachmentBytes = DefaultMaxAttachmentBytes
+	}
 	return &SMTPClient{
 		host:       config.Host,
 		port:       config.Port,
@@ -167,57 +119,71 @@ func NewSMTPClient(config *SMTPConfig) *SMTPClient {
 		fromEmail:  config.FromEmail,
 		replyTo:    config.ReplyTo,
 		tlsEnabled: config.TLSEnabled,
+
+		maxAttachmentBytes: maxAttachmentBytes,
 	}
 }
 
-// SendEmail sends a single email via SMTP
+// SetTracker enables open/click tracking for messages that request it
+func (c *SMTPClient) SetTracker(tracker *Tracker) {
+	c.tracker = tracker
+}
+
+// TrackingEnabled reports whether a tracker is set
+func (c *SMTPClient) TrackingEnabled() bool {
+	return c.tracker != nil
+}
+
+// SendEmail sends a single email via SMTP on its own connection
 func (c *SMTPClient) SendEmail(msg *models.CommMessage) error {
+	recipients, content, err := c.prepareMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	// Connect and send
+	return c.sendViaSMTP(recipients, content)
+}
+
+// prepareMessage validates a message and renders it, returning the envelope
+// recipients and the MIME content
+func (c *SMTPClient) prepareMessage(msg *models.CommMessage) ([]string, []byte, error) {
 	if msg == nil {
-		return fmt.Errorf("message cannot be nil")
+		return nil, nil, fmt.Errorf("message cannot be nil")
 	}
 
 	// Validate message
 	if err := c.validateMessage(msg); err != nil {
-		return fmt.Errorf("invalid message: %w", err)
+		return nil, nil, fmt.Errorf("invalid message: %w", err)
 	}
 
-	// Build email message
-	emailContent := c.buildEmailContent(msg)
-
-	// Get all recipients
-	allRecipients := c.getAllRecipients(msg)
-
-	// Connect and send
-	return c.sendViaSMTP(allRecipients, emailContent)
-}
-
-// SendBulkEmail sends multiple emails
-func (c *SMTPClient) SendBulkEmail(msgs []*models.CommMessage) error {
-	if len(msgs) == 0 {
-		return nil
+	// Instrument a copy so the stored message keeps the original body
+	if msg.TrackEngagement && c.tracker != nil && msg.BodyHTML != "" && msg.MessageID != "" {
+		tracked := *msg
+		tracked.BodyHTML = c.tracker.InstrumentHTML(msg.MessageID, msg.BodyHTML)
+		msg = &tracked
 	}
 
-	var errors []error
-	for i, msg := range msgs {
-		if err := c.SendEmail(msg); err != nil {
-			errors = append(errors, fmt.Errorf("email %d failed: %w", i, err))
-		}
-		// Small delay between emails to avoid rate limiting
-		if i < len(msgs)-1 {
-			time.Sleep(100 * time.Millisecond)
-		}
+	// Resolve attachment bytes and enforce the size cap before connecting
+	attachments, err := c.resolveAttachments(msg.Attachments)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("bulk send completed with %d errors: %v", len(errors), errors)
+	// Build email message, signed last so nothing changes it afterwards
+	content := c.buildEmailContent(msg, attachments)
+	if c.dkim != nil {
+		if content, err = c.dkim.Sign(content); err != nil {
+			return nil, nil, fmt.Errorf("failed to DKIM-sign message: %w", err)
+		}
 	}
-
-	return nil
+	return c.getAllRecipients(msg), content, nil
 }
 
-
-// buildEmailContent builds the MIME email content
-func (c *SMTPClient) buildEmailContent(msg *models.CommMessage) []byte {
+// buildEmailContent builds the MIME email content. Inline attachments wrap the
+// body in multipart/related and regular attachments wrap that in
+// multipart/mixed; without attachments the body is the top-level entity.
+func (c *SMTPClient) buildEmailContent(msg *models.CommMessage, attachments []EmailAttachment) []byte {
 	var builder strings.Builder
 
 	// From header - ALWAYS use configured SMTP sender to avoid SendAsDenied errors
@@ -268,46 +234,69 @@ func (c *SMTPClient) buildEmailContent(msg *models.CommMessage) []byte {
 	// MIME headers
 	builder.WriteString("MIME-Version: 1.0\r\n")
 
-	// Determine content type
+	// Body entity, wrapped by any attachments
+	header, content := c.buildBodyEntity(msg)
+
+	var inline, attached []EmailAttachment
+	for _, att := range attachments {
+		if att.ContentID != "" {
+			inline = append(inline, att)
+		} else {
+			attached = append(attached, att)
+		}
+	}
+	if len(inline) > 0 {
+		header, content = wrapMultipart("related", header, content, inline)
+	}
+	if len(attached) > 0 {
+		header, content = wrapMultipart("mixed", header, content, attached)
+	}
+
+	builder.WriteString(fmt.Sprintf("Content-Type: %s\r\n", header.Get("Content-Type")))
+	if cte := header.Get("Content-Transfer-Encoding"); cte != "" {
+		builder.WriteString(fmt.Sprintf("Content-Transfer-Encoding: %s\r\n", cte))
+	}
+	builder.WriteString("\r\n")
+	builder.Write(content)
+
+	return []byte(builder.String())
+}
+
+// buildBodyEntity builds the text/HTML body: multipart/alternative when both
+// are present, otherwise a single quoted-printable part
+func (c *SMTPClient) buildBodyEntity(msg *models.CommMessage) (textproto.MIMEHeader, []byte) {
+	header := textproto.MIMEHeader{}
+
 	if msg.BodyHTML != "" && msg.BodyText != "" {
 		// Multipart alternative
-		boundary := fmt.Sprintf("----=_Part_%d", time.Now().UnixNano())
-		builder.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-		builder.WriteString("\r\n")
-
-		// Plain text part - use quoted-printable encoding
-		builder.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		builder.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		builder.WriteString("\r\n")
-		builder.WriteString(encodeQuotedPrintable(msg.BodyText))
-		builder.WriteString("\r\n")
-
-		// HTML part - use quoted-printable encoding
-		builder.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		builder.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		builder.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		builder.WriteString("\r\n")
-		builder.WriteString(encodeQuotedPrintable(msg.BodyHTML))
-		builder.WriteString("\r\n")
-
-		// End boundary
-		builder.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	} else if msg.BodyHTML != "" {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		writeQuotedPrintablePart(writer, "text/plain; charset=UTF-8", msg.BodyText)
+		writeQuotedPrintablePart(writer, "text/html; charset=UTF-8", msg.BodyHTML)
+		writer.Close()
+
+		header.Set("Content-Type", fmt.Sprintf("multipart/alternative; boundary=\"%s\"", writer.Boundary()))
+		return header, buf.Bytes()
+	}
+
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	if msg.BodyHTML != "" {
 		// HTML only - use quoted-printable encoding
-		builder.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		builder.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		builder.WriteString("\r\n")
-		builder.WriteString(encodeQuotedPrintable(msg.BodyHTML))
-	} else {
-		// Plain text only - use quoted-printable encoding
-		builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		builder.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		builder.WriteString("\r\n")
-		builder.WriteString(encodeQuotedPrintable(msg.BodyText))
+		header.Set("Content-Type", "text/html; charset=UTF-8")
+		return header, []byte(encodeQuotedPrintable(msg.BodyHTML))
 	}
+	// Plain text only - use quoted-printable encoding
+	header.Set("Content-Type", "text/plain; charset=UTF-8")
+	return header, []byte(encodeQuotedPrintable(msg.BodyText))
+}
 
-	return []byte(builder.String())
+// writeQuotedPrintablePart adds a quoted-printable text part to a multipart body
+func writeQuotedPrintablePart(writer *multipart.Writer, contentType, text string) {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, _ := writer.CreatePart(header)
+	part.Write([]byte(encodeQuotedPrintable(text)))
 }
 
 // getAllRecipients returns all recipients (To, CC, BCC)
@@ -335,147 +324,141 @@ func (c *SMTPClient) validateMessage(msg *models.CommMessage) error {
 
 // sendViaSMTP connects to SMTP server and sends the email
 func (c *SMTPClient) sendViaSMTP(recipients []string, content []byte) error {
-	addr := fmt.Sprintf("%s:%d", c.host, c.port)
-
-	// Create authentication
-	auth := smtp.PlainAuth("", c.username, c.password, c.host)
-
-	if c.tlsEnabled && c.port == 587 {
-		// Use STARTTLS for port 587
-		return c.sendWithSTARTTLS(addr, auth, recipients, content)
-	} else if c.port == 465 {
-		// Use implicit TLS for port 465
-		return c.sendWithImplicitTLS(addr, auth, recipients, content)
-	}
-
-	// Plain SMTP (not recommended)
-	return smtp.SendMail(addr, auth, c.fromEmail, recipients, content)
-}
-
-// sendWithSTARTTLS sends email using STARTTLS (port 587)
-// Tries LOGIN auth first (for Office 365), then falls back to PLAIN auth
-func (c *SMTPClient) sendWithSTARTTLS(addr string, auth smtp.Auth, recipients []string, content []byte) error {
-	// Connect to server
-	client, err := smtp.Dial(addr)
+	client, err := c.connect()
 	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+		return err
 	}
 	defer client.Close()
 
-	// Say hello
-	if err := client.Hello("localhost"); err != nil {
-		return fmt.Errorf("failed to send HELO: %w", err)
+	if _, err := c.deliver(client, recipients, content, true); err != nil {
+		return err
 	}
 
-	// Start TLS
+	// Quit
+	return client.Quit()
+}
+
+// connect opens an authenticated session ready for MAIL FROM.
+// Port 587 with TLS enabled uses STARTTLS and port 465 implicit TLS; both try
+// LOGIN auth first (for Office 365) and fall back to PLAIN. Any other port
+// behaves like net/smtp.SendMail: opportunistic STARTTLS and PLAIN auth when
+// the server offers it.
+func (c *SMTPClient) connect() (*smtp.Client, error) {
+	addr := fmt.Sprintf("%s:%d", c.host, c.port)
 	tlsConfig := &tls.Config{
 		ServerName: c.host,
 	}
-	if err := client.StartTLS(tlsConfig); err != nil {
-		return fmt.Errorf("failed to start TLS: %w", err)
-	}
 
-	// Try LOGIN auth first (Office 365 requires this)
-	loginAuth := LoginAuth(c.username, c.password, c.host)
-	if err := client.Auth(loginAuth); err != nil {
-		// If LOGIN fails, try PLAIN auth as fallback
-		plainAuth := smtp.PlainAuth("", c.username, c.password, c.host)
-		if err := client.Auth(plainAuth); err != nil {
-			return fmt.Errorf("failed to authenticate (tried LOGIN and PLAIN): %w", err)
+	if c.port == 465 {
+		// Implicit TLS
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect with TLS: %w", err)
 		}
-	}
-
-	// Set sender
-	if err := client.Mail(c.fromEmail); err != nil {
-		return fmt.Errorf("failed to set sender: %w", err)
-	}
-
-	// Set recipients
-	for _, recipient := range recipients {
-		if err := client.Rcpt(recipient); err != nil {
-			return fmt.Errorf("failed to set recipient %s: %w", recipient, err)
+		client, err := smtp.NewClient(conn, c.host)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create SMTP client: %w", err)
 		}
+		if err := c.authenticate(client); err != nil {
+			client.Close()
+			return nil, err
+		}
+		return client, nil
 	}
 
-	// Send message body
-	writer, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("failed to open data connection: %w", err)
-	}
-
-	_, err = writer.Write(content)
+	client, err := smtp.Dial(addr)
 	if err != nil {
-		return fmt.Errorf("failed to write message: %w", err)
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
 	}
 
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close data connection: %w", err)
+	// Say hello
+	if err := client.Hello("localhost"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to send HELO: %w", err)
 	}
 
-	// Quit
-	return client.Quit()
-}
-
-// sendWithImplicitTLS sends email using implicit TLS (port 465)
-// Tries LOGIN auth first (for Office 365), then falls back to PLAIN auth
-func (c *SMTPClient) sendWithImplicitTLS(addr string, auth smtp.Auth, recipients []string, content []byte) error {
-	// Create TLS connection
-	tlsConfig := &tls.Config{
-		ServerName: c.host,
+	if c.tlsEnabled && c.port == 587 {
+		// STARTTLS
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+		if err := c.authenticate(client); err != nil {
+			client.Close()
+			return nil, err
+		}
+		return client, nil
 	}
 
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
-	if err != nil {
-		return fmt.Errorf("failed to connect with TLS: %w", err)
+	// Plain SMTP (not recommended)
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
 	}
-	defer conn.Close()
-
-	// Create SMTP client on TLS connection
-	client, err := smtp.NewClient(conn, c.host)
-	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %w", err)
+	if ok, _ := client.Extension("AUTH"); ok {
+		if err := client.Auth(smtp.PlainAuth("", c.username, c.password, c.host)); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to authenticate: %w", err)
+		}
 	}
-	defer client.Close()
+	return client, nil
+}
 
-	// Try LOGIN auth first (Office 365 requires this)
+// authenticate tries LOGIN auth first (Office 365 requires this), then falls
+// back to PLAIN auth
+func (c *SMTPClient) authenticate(client *smtp.Client) error {
 	loginAuth := LoginAuth(c.username, c.password, c.host)
 	if err := client.Auth(loginAuth); err != nil {
-		// If LOGIN fails, try PLAIN auth as fallback
 		plainAuth := smtp.PlainAuth("", c.username, c.password, c.host)
 		if err := client.Auth(plainAuth); err != nil {
 			return fmt.Errorf("failed to authenticate (tried LOGIN and PLAIN): %w", err)
 		}
 	}
+	return nil
+}
 
+// deliver runs one MAIL/RCPT/DATA transaction on an open session. With
+// requireAll any rejected recipient aborts the send; otherwise the message
+// goes to the accepted recipients and the rejected ones are returned.
+func (c *SMTPClient) deliver(client *smtp.Client, recipients []string, content []byte, requireAll bool) (map[string]error, error) {
 	// Set sender
 	if err := client.Mail(c.fromEmail); err != nil {
-		return fmt.Errorf("failed to set sender: %w", err)
+		return nil, fmt.Errorf("failed to set sender: %w", err)
 	}
 
 	// Set recipients
+	rejected := make(map[string]error)
 	for _, recipient := range recipients {
 		if err := client.Rcpt(recipient); err != nil {
-			return fmt.Errorf("failed to set recipient %s: %w", recipient, err)
+			if requireAll {
+				return nil, fmt.Errorf("failed to set recipient %s: %w", recipient, err)
+			}
+			rejected[recipient] = err
 		}
 	}
+	if len(rejected) == len(recipients) {
+		client.Reset()
+		return rejected, fmt.Errorf("no recipient accepted")
+	}
 
 	// Send message body
 	writer, err := client.Data()
 	if err != nil {
-		return fmt.Errorf("failed to open data connection: %w", err)
+		return rejected, fmt.Errorf("failed to open data connection: %w", err)
 	}
 
 	_, err = writer.Write(content)
 	if err != nil {
-		return fmt.Errorf("failed to write message: %w", err)
+		return rejected, fmt.Errorf("failed to write message: %w", err)
 	}
 
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close data connection: %w", err)
+		return rejected, fmt.Errorf("failed to close data connection: %w", err)
 	}
-
-	// Quit
-	return client.Quit()
+	return rejected, nil
 }
 
 // TestConnection tests the SMTP connection
@@ -502,14 +485,8 @@ func (c *SMTPClient) TestConnection() error {
 		}
 	}
 
-	// Try LOGIN auth first (Office 365 requires this)
-	loginAuth := LoginAuth(c.username, c.password, c.host)
-	if err := client.Auth(loginAuth); err != nil {
-		// If LOGIN fails, try PLAIN auth as fallback
-		plainAuth := smtp.PlainAuth("", c.username, c.password, c.host)
-		if err := client.Auth(plainAuth); err != nil {
-			return fmt.Errorf("authentication failed (tried LOGIN and PLAIN): %w", err)
-		}
+	if err := c.authenticate(client); err != nil {
+		return err
 	}
 
 	return client.Quit()
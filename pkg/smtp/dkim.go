@@ -0,0 +1,335 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/white/user-management/internal/models"
+)
+
+// ErrDKIMNotConfigured is returned by VerifySigning when no DKIM signer is set
+var ErrDKIMNotConfigured = errors.New("DKIM signing is not configured")
+
+// dkimSignedHeaders are the headers signed when present, those written by
+// buildEmailContent. Headers a relay adds later are left out.
+var dkimSignedHeaders = []string{
+	"From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// DKIMSigner adds a DKIM-Signature header (RFC 6376) to outbound messages,
+// signed with rsa-sha256 over their relaxed/relaxed canonical form
+type DKIMSigner struct {
+	domain   string
+	selector string
+	key      *rsa.PrivateKey
+}
+
+// NewDKIMSigner creates a DKIMSigner for domain and selector from a PEM RSA
+// private key, in PKCS #1 or PKCS #8 form
+func NewDKIMSigner(domain, selector string, keyPEM []byte) (*DKIMSigner, error) {
+	domain, selector = strings.TrimSpace(domain), strings.TrimSpace(selector)
+	if domain == "" || selector == "" {
+		return nil, fmt.Errorf("DKIM signing needs a domain and a selector")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("DKIM private key is not PEM encoded")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DKIM private key: %w", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("DKIM private key must be an RSA key")
+		}
+		key = rsaKey
+	}
+	if key.N.BitLen() < 1024 {
+		return nil, fmt.Errorf("DKIM private key must have at least 1024 bits, has %d", key.N.BitLen())
+	}
+	return &DKIMSigner{domain: domain, selector: selector, key: key}, nil
+}
+
+// Domain returns the signing domain, the d= tag of signatures
+func (s *DKIMSigner) Domain() string {
+	return s.domain
+}
+
+// RecordName returns the DNS name the public key is published at
+func (s *DKIMSigner) RecordName() string {
+	return s.selector + "._domainkey." + s.domain
+}
+
+// DNSRecord returns the TXT record to publish at RecordName for receivers
+// to verify signatures
+func (s *DKIMSigner) DNSRecord() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode DKIM public key: %w", err)
+	}
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+}
+
+// Sign returns message with a DKIM-Signature header prepended. message is
+// a complete RFC 5322 message with CRLF line endings, as built by
+// buildEmailContent.
+func (s *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	fields, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var signed []string
+	var names []string
+	for _, name := range dkimSignedHeaders {
+		// Repeated headers are signed bottom up, as verifiers select them
+		for i := len(fields) - 1; i >= 0; i-- {
+			if strings.EqualFold(headerName(fields[i]), name) {
+				signed = append(signed, fields[i])
+				names = append(names, strings.ToLower(name))
+			}
+		}
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	value := fmt.Sprintf("v=1; a=rsa-sha256; c=relaxed/relaxed; d=%s; s=%s; t=%d;\r\n\th=%s;\r\n\tbh=%s;\r\n\tb=",
+		s.domain, s.selector, time.Now().Unix(), strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	digest := dkimHeaderHash(signed, "DKIM-Signature: "+value)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(message) + len(value) + 400)
+	out.WriteString("DKIM-Signature: " + value + base64.StdEncoding.EncodeToString(signature) + "\r\n")
+	out.Write(message)
+	return out.Bytes(), nil
+}
+
+// dkimSignatureValue matches the b= tag of a DKIM-Signature field, whose
+// value is left out of the signed form
+var dkimSignatureValue = regexp.MustCompile(`([;:][ \t\r\n]*b[ \t\r\n]*=)[^;]*`)
+
+// VerifyDKIM checks the first DKIM-Signature of message against key, the
+// public half of the signing key. Only the rsa-sha256 relaxed/relaxed
+// signatures DKIMSigner makes are supported.
+func VerifyDKIM(message []byte, key *rsa.PublicKey) error {
+	fields, body, err := splitMessage(message)
+	if err != nil {
+		return err
+	}
+
+	sigIndex := -1
+	for i, field := range fields {
+		if strings.EqualFold(headerName(field), "DKIM-Signature") {
+			sigIndex = i
+			break
+		}
+	}
+	if sigIndex < 0 {
+		return fmt.Errorf("message has no DKIM-Signature header")
+	}
+	sigField := fields[sigIndex]
+	tags := dkimTags(sigField[strings.IndexByte(sigField, ':')+1:])
+
+	switch {
+	case tags["v"] != "1":
+		return fmt.Errorf("unsupported DKIM version %q", tags["v"])
+	case tags["a"] != "rsa-sha256":
+		return fmt.Errorf("unsupported DKIM algorithm %q", tags["a"])
+	case tags["c"] != "relaxed/relaxed":
+		return fmt.Errorf("unsupported DKIM canonicalization %q", tags["c"])
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+		return fmt.Errorf("DKIM body hash does not match the body")
+	}
+
+	// Each name picks the next of its headers not yet used, bottom up
+	used := make(map[int]bool)
+	var signed []string
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if i != sigIndex && !used[i] && strings.EqualFold(headerName(fields[i]), strings.TrimSpace(name)) {
+				used[i] = true
+				signed = append(signed, fields[i])
+				break
+			}
+		}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fmt.Errorf("DKIM signature is not valid base64: %w", err)
+	}
+	digest := dkimHeaderHash(signed, dkimSignatureValue.ReplaceAllString(sigField, "$1"))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature); err != nil {
+		return fmt.Errorf("DKIM signature does not verify: %w", err)
+	}
+	return nil
+}
+
+// SetDKIMSigner makes the client DKIM-sign every message it sends; nil
+// sends them unsigned
+func (c *SMTPClient) SetDKIMSigner(signer *DKIMSigner) {
+	c.dkim = signer
+}
+
+// DKIMEnabled reports whether a DKIM signer is set
+func (c *SMTPClient) DKIMEnabled() bool {
+	return c.dkim != nil
+}
+
+// VerifySigning signs a sample multipart message as SendEmail would and
+// verifies the signature locally, so the key can be checked before
+// messages go out. It does not look up the published DNS record.
+func (c *SMTPClient) VerifySigning() error {
+	if c.dkim == nil {
+		return ErrDKIMNotConfigured
+	}
+	sample := &models.CommMessage{
+		MessageID:   "dkim-check",
+		ToAddresses: []string{"dkim-check@" + c.dkim.domain},
+		Subject:     "DKIM signing check",
+		BodyText:    "DKIM signing check",
+		BodyHTML:    "<p>DKIM signing check</p>",
+	}
+	attachments := []EmailAttachment{{Filename: "check.txt", ContentType: "text/plain", Data: []byte("DKIM signing check\r\n")}}
+
+	signed, err := c.dkim.Sign(c.buildEmailContent(sample, attachments))
+	if err != nil {
+		return err
+	}
+	return VerifyDKIM(signed, &c.dkim.key.PublicKey)
+}
+
+// splitMessage returns the header fields of message, each with its folded
+// lines and final CRLF, and its body
+func splitMessage(message []byte) ([]string, []byte, error) {
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, nil, fmt.Errorf("message has no blank line ending its header")
+	}
+
+	var fields []string
+	for _, line := range strings.SplitAfter(string(message[:end+2]), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		if !strings.Contains(line, ":") {
+			return nil, nil, fmt.Errorf("malformed header line %q", strings.TrimSpace(line))
+		}
+		fields = append(fields, line)
+	}
+	return fields, message[end+4:], nil
+}
+
+// headerName returns the name of a header field
+func headerName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimRight(name, " \t")
+}
+
+// dkimHeaderHash hashes the relaxed form of the signed header fields
+// followed by the DKIM-Signature field, whose b= value is empty and which
+// has no final CRLF
+func dkimHeaderHash(signed []string, sigField string) []byte {
+	h := sha256.New()
+	for _, field := range signed {
+		h.Write([]byte(relaxedHeader(field)))
+	}
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader(sigField), "\r\n")))
+	return h.Sum(nil)
+}
+
+// relaxedHeader canonicalizes a header field with the relaxed algorithm:
+// lower-case name, unfolded value with runs of whitespace reduced to one
+// space, and no whitespace around the colon or at the end
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+	value = strings.Trim(collapseWhitespace(value), " ")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + value + "\r\n"
+}
+
+// relaxedBody canonicalizes a body with the relaxed algorithm: runs of
+// whitespace within lines reduced to one space, none at the end of lines,
+// and no empty lines at the end of the body
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWhitespace(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWhitespace reduces every run of spaces and tabs to one space
+func collapseWhitespace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// dkimTags parses the tag=value list of a DKIM-Signature field; whitespace
+// is not significant in values
+func dkimTags(value string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(value, ";") {
+		name, val, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(name)] = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, val)
+	}
+	return tags
+}
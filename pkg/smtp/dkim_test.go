@@ -0,0 +1,336 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/white/user-management/internal/models"
+)
+
+var (
+	dkimKeyOnce sync.Once
+	dkimKey     *rsa.PrivateKey
+)
+
+// testDKIMKey returns the RSA key pair the tests sign with, generated once
+func testDKIMKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	dkimKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dkimKey = key
+	})
+	return dkimKey
+}
+
+// testSigner returns a DKIMSigner for white.test of the test key, given in
+// PKCS #1 form
+func testSigner(t *testing.T) *DKIMSigner {
+	t.Helper()
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testDKIMKey(t))})
+	signer, err := NewDKIMSigner("white.test", "mail2026", keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// signatureTags returns the tags of the DKIM-Signature field of message
+func signatureTags(t *testing.T, message []byte) map[string]string {
+	t.Helper()
+	fields, _, err := splitMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range fields {
+		if headerName(field) == "DKIM-Signature" {
+			return dkimTags(field[strings.IndexByte(field, ':')+1:])
+		}
+	}
+	t.Fatalf("no DKIM-Signature in %q", message)
+	return nil
+}
+
+// TestDKIMSignaturesVerify signs the single-part, alternative, related and
+// mixed messages buildEmailContent makes and verifies each with the public
+// key
+func TestDKIMSignaturesVerify(t *testing.T) {
+	client := testClient()
+	signer := testSigner(t)
+	logo := EmailAttachment{Filename: "logo.png", ContentType: "image/png", ContentID: "logo@acme", Data: bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 50)}
+	quote := EmailAttachment{Filename: "quote.pdf", ContentType: "application/pdf", Data: bytes.Repeat([]byte("%PDF-1.7 quote "), 100)}
+
+	for _, tt := range []struct {
+		name        string
+		msg         *models.CommMessage
+		attachments []EmailAttachment
+	}{
+		{"text", &models.CommMessage{MessageID: "msg-1", ToAddresses: []string{"lee@acme.test"}, Subject: "Plain", BodyText: "Hello  Lee,\n\nThe quote is attached. \n"}, nil},
+		{"alternative", testMessage(), nil},
+		{"related", testMessage(), []EmailAttachment{logo}},
+		{"mixed", testMessage(), []EmailAttachment{logo, quote}},
+	} {
+		signed, err := signer.Sign(client.buildEmailContent(tt.msg, tt.attachments))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := VerifyDKIM(signed, &testDKIMKey(t).PublicKey); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		tags := signatureTags(t, signed)
+		if tags["d"] != "white.test" || tags["s"] != "mail2026" || tags["a"] != "rsa-sha256" || tags["c"] != "relaxed/relaxed" {
+			t.Errorf("%s: signature tags = %v", tt.name, tags)
+		}
+		for _, name := range []string{"from", "to", "subject", "date", "message-id", "mime-version", "content-type"} {
+			if !slices.Contains(strings.Split(tags["h"], ":"), name) {
+				t.Errorf("%s: h=%s does not sign %s", tt.name, tags["h"], name)
+			}
+		}
+	}
+}
+
+// TestDKIMSignedMessagesAreDelivered sends a signed message to the fake
+// server and verifies the message as it arrived, after the SMTP transfer
+// added its final line break
+func TestDKIMSignedMessagesAreDelivered(t *testing.T) {
+	server := startFakeServer(t)
+	client := server.client()
+	client.SetDKIMSigner(testSigner(t))
+
+	if err := client.SendEmail(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	server.mu.Lock()
+	delivered := server.delivered["lee@acme.test"]
+	server.mu.Unlock()
+	if len(delivered) != 1 {
+		t.Fatalf("%d messages delivered, want 1", len(delivered))
+	}
+	if !bytes.HasPrefix(delivered[0], []byte("DKIM-Signature: ")) {
+		t.Fatalf("delivered message does not start with its signature: %.80q", delivered[0])
+	}
+	if err := VerifyDKIM(delivered[0], &testDKIMKey(t).PublicKey); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDKIMRelaxedCanonicalization changes a signed message the ways relays
+// do, which relaxed canonicalization tolerates, and the ways it must not
+func TestDKIMRelaxedCanonicalization(t *testing.T) {
+	client := testClient()
+	msg := &models.CommMessage{MessageID: "msg-1", ToAddresses: []string{"lee@acme.test"}, Subject: "Your renewal quote", BodyText: "The quote is attached.\nSee you soon."}
+	signed, err := testSigner(t).Sign(client.buildEmailContent(msg, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &testDKIMKey(t).PublicKey
+
+	for _, tt := range []struct {
+		name     string
+		old, new string
+		err      string
+	}{
+		{"header name case", "Subject: ", "SUBJECT: ", ""},
+		{"space around the colon", "Subject: Your", "Subject :   Your", ""},
+		{"header refolded", "Subject: Your renewal quote", "Subject: Your\r\n\t renewal  quote", ""},
+		{"trailing header space", "Subject: Your renewal quote", "Subject: Your renewal quote \t", ""},
+		{"body whitespace runs", "See you soon.", "See \t you  soon.", ""},
+		{"trailing body space", "The quote is attached.", "The quote is attached.  ", ""},
+		{"blank lines at the end", "See you soon.", "See you soon.\r\n\r\n\r\n", ""},
+		{"subject changed", "Your renewal quote", "Your renewal invoice", "does not verify"},
+		{"space inserted in a word", "renewal", "re newal", "does not verify"},
+		{"body changed", "See you soon.", "See you never.", "body hash does not match"},
+		{"blank line inside the body", "attached.\r\nSee", "attached.\r\n\r\nSee", "body hash does not match"},
+	} {
+		if !bytes.Contains(signed, []byte(tt.old)) {
+			t.Fatalf("%s: %q not in the message", tt.name, tt.old)
+		}
+		changed := bytes.Replace(signed, []byte(tt.old), []byte(tt.new), 1)
+		err := VerifyDKIM(changed, key)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v, want the signature to still verify", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// A header the signature does not cover may be added by relays
+	received := append([]byte("Received: from relay.acme.test\r\n"), signed...)
+	if err := VerifyDKIM(received, key); err != nil {
+		t.Errorf("with a Received header added: %v", err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDKIM(signed, &other.PublicKey); err == nil {
+		t.Error("the signature verified with another key")
+	}
+}
+
+// TestRelaxedCanonicalizationExample canonicalizes the example of RFC 6376
+// section 3.4.5
+func TestRelaxedCanonicalizationExample(t *testing.T) {
+	fields, body, err := splitMessage([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers string
+	for _, field := range fields {
+		headers += relaxedHeader(field)
+	}
+	if headers != "a:X\r\nb:Y Z\r\n" {
+		t.Errorf("headers = %q, want %q", headers, "a:X\r\nb:Y Z\r\n")
+	}
+	if got := string(relaxedBody(body)); got != " C\r\nD E\r\n" {
+		t.Errorf("body = %q, want %q", got, " C\r\nD E\r\n")
+	}
+	if got := relaxedBody([]byte("\r\n\r\n")); got != nil {
+		t.Errorf("empty body = %q, want none", got)
+	}
+}
+
+// dateHeader matches the Date header, the only part of a single-part
+// message that differs between two builds
+var dateHeader = regexp.MustCompile(`(?m)^Date: [^\r]*\r\n`)
+
+// TestUnsignedMessagesAreUnchanged checks a client without a signer sends
+// exactly what buildEmailContent builds, as before signing was added, and
+// that signing only prepends its header to those bytes
+func TestUnsignedMessagesAreUnchanged(t *testing.T) {
+	client := testClient()
+	if client.DKIMEnabled() {
+		t.Fatal("a new client signs messages")
+	}
+	msg := &models.CommMessage{MessageID: "msg-1", ToAddresses: []string{"lee@acme.test"}, Subject: "Your renewal quote", BodyText: "The quote is attached.\nSee you   soon."}
+
+	_, sent, err := client.prepareMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "From: White Platform <sales@white.test>\r\n" +
+		"To: lee@acme.test\r\n" +
+		"Subject: Your renewal quote\r\n" +
+		"Message-ID: <msg-1@csa.skillzen.ai>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"The quote is attached.\r\nSee you   soon."
+	if got := dateHeader.ReplaceAllString(string(sent), ""); got != want {
+		t.Errorf("unsigned message = %q, want %q", got, want)
+	}
+	if bytes.Contains(sent, []byte("DKIM-Signature")) {
+		t.Error("unsigned message has a DKIM-Signature")
+	}
+
+	// Signing adds one header field and leaves every byte after it alone
+	content := client.buildEmailContent(msg, nil)
+	signed, err := testSigner(t).Sign(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(signed, content) {
+		t.Fatalf("signing changed the message:\n%q\nwas\n%q", signed, content)
+	}
+	added := signed[:len(signed)-len(content)]
+	fields, _, err := splitMessage(append(added, "\r\n"...))
+	if err != nil || len(fields) != 1 || headerName(fields[0]) != "DKIM-Signature" {
+		t.Errorf("signing added %q, want one DKIM-Signature field", added)
+	}
+
+	client.SetDKIMSigner(nil)
+	if client.DKIMEnabled() {
+		t.Error("DKIMEnabled after the signer was removed")
+	}
+}
+
+func TestVerifySigning(t *testing.T) {
+	client := testClient()
+	if err := client.VerifySigning(); !errors.Is(err, ErrDKIMNotConfigured) {
+		t.Errorf("VerifySigning without a signer = %v, want ErrDKIMNotConfigured", err)
+	}
+	client.SetDKIMSigner(testSigner(t))
+	if err := client.VerifySigning(); err != nil {
+		t.Errorf("VerifySigning = %v", err)
+	}
+}
+
+func TestNewDKIMSigner(t *testing.T) {
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(testDKIMKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewDKIMSigner(" white.test ", "mail2026", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	if err != nil {
+		t.Fatalf("PKCS #8 key: %v", err)
+	}
+	if signer.Domain() != "white.test" || signer.RecordName() != "mail2026._domainkey.white.test" {
+		t.Errorf("domain %q, record %q", signer.Domain(), signer.RecordName())
+	}
+
+	// The published record holds the public half of the signing key
+	record, err := signer.DNSRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p, _ := strings.Cut(record, "; p=")
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		t.Fatalf("record %q: %v", record, err)
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil || !testDKIMKey(t).PublicKey.Equal(public) {
+		t.Errorf("record %q does not hold the public key: %v", record, err)
+	}
+
+	// Go refuses keys under 1024 bits unless told otherwise; the signer
+	// must refuse them either way
+	t.Setenv("GODEBUG", "rsa1024min=0")
+	small, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	for _, tt := range []struct {
+		name, domain, selector string
+		key                    []byte
+		err                    string
+	}{
+		{"no domain", "", "mail2026", valid, "needs a domain and a selector"},
+		{"no selector", "white.test", " ", valid, "needs a domain and a selector"},
+		{"not PEM", "white.test", "mail2026", []byte("-----not a key-----"), "not PEM encoded"},
+		{"not a key", "white.test", "mail2026", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("junk")}), "failed to parse"},
+		{"EC key", "white.test", "mail2026", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecDER}), "must be an RSA key"},
+		{"short key", "white.test", "mail2026", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(small)}), "at least 1024 bits"},
+	} {
+		if _, err := NewDKIMSigner(tt.domain, tt.selector, tt.key); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package smtp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer is a loopback SMTP server counting the sessions and commands
+// it sees. It offers no STARTTLS or AUTH, so clients send in plain text.
+type fakeServer struct {
+	listener net.Listener
+
+	// rcptReply, when set, answers RCPT TO for an address on its nth
+	// attempt (from 1); an empty reply accepts it
+	rcptReply func(address string, attempt int) string
+	// hangUpOnData, when set, closes the session instead of answering the
+	// DATA of the nth message (from 1) the server is sent
+	hangUpOnData int
+
+	mu          sync.Mutex
+	connections int
+	resets      int
+	dataCount   int
+	rcptCount   map[string]int
+	delivered   map[string][][]byte // Message contents by recipient
+}
+
+// startFakeServer starts a fakeServer on a free loopback port, stopped when
+// the test ends
+func startFakeServer(t testing.TB) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: listener, rcptCount: map[string]int{}, delivered: map[string][][]byte{}}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// client returns an SMTPClient sending to the server
+func (s *fakeServer) client() *SMTPClient {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return NewSMTPClient(&SMTPConfig{Host: addr.IP.String(), Port: addr.Port, FromEmail: "sales@white.test"})
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // Closed
+		}
+		s.mu.Lock()
+		s.connections++
+		s.mu.Unlock()
+		go s.session(conn)
+	}
+}
+
+func (s *fakeServer) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP fake")
+	var to []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			to = nil
+			reply("250 OK")
+		case "RCPT":
+			_, address, _ := strings.Cut(arg, ":")
+			address = strings.Trim(strings.TrimSpace(address), "<>")
+			s.mu.Lock()
+			s.rcptCount[address]++
+			attempt := s.rcptCount[address]
+			s.mu.Unlock()
+			if s.rcptReply != nil {
+				if answer := s.rcptReply(address, attempt); answer != "" {
+					reply(answer)
+					continue
+				}
+			}
+			to = append(to, address)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.mu.Lock()
+			s.dataCount++
+			hangUp := s.dataCount == s.hangUpOnData
+			if !hangUp {
+				for _, address := range to {
+					s.delivered[address] = append(s.delivered[address], data.Bytes())
+				}
+			}
+			s.mu.Unlock()
+			if hangUp {
+				return
+			}
+			reply("250 OK")
+		case "RSET":
+			s.mu.Lock()
+			s.resets++
+			s.mu.Unlock()
+			to = nil
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// stats returns the sessions opened and RSETs received so far
+func (s *fakeServer) stats() (connections, resets int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections, s.resets
+}
+
+// deliveries returns how many messages address was delivered
+func (s *fakeServer) deliveries(address string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.delivered[address])
+}
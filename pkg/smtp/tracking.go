@@ -0,0 +1,84 @@
+package smtp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Tracker instruments outbound HTML with an open-tracking pixel and click
+// redirects. Redirect targets are HMAC-signed per message so the click
+// endpoint can't be used as an open redirect.
+type Tracker struct {
+	baseURL string
+	secret  []byte
+}
+
+// NewTracker creates a tracker whose links point at the API served from baseURL
+func NewTracker(baseURL string, secret []byte) *Tracker {
+	return &Tracker{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  secret,
+	}
+}
+
+// trackedLinkPattern matches absolute http(s) href attributes on anchor tags
+var trackedLinkPattern = regexp.MustCompile(`(?i)(<a\s[^>]*?href\s*=\s*)("https?://[^"]*"|'https?://[^']*')`)
+
+// closingBodyPattern matches the closing body tag the pixel is inserted before
+var closingBodyPattern = regexp.MustCompile(`(?i)</body\s*>`)
+
+// OpenPixelURL returns the tracking pixel URL for a message
+func (t *Tracker) OpenPixelURL(messageID string) string {
+	return fmt.Sprintf("%s/api/v1/track/open/%s.gif", t.baseURL, url.PathEscape(messageID))
+}
+
+// ClickURL returns the signed redirect URL for a link in a message
+func (t *Tracker) ClickURL(messageID, target string) string {
+	query := url.Values{}
+	query.Set("url", target)
+	query.Set("sig", t.Sign(messageID, target))
+	return fmt.Sprintf("%s/api/v1/track/click/%s?%s", t.baseURL, url.PathEscape(messageID), query.Encode())
+}
+
+// Sign returns the signature binding a redirect target to a message
+func (t *Tracker) Sign(messageID, target string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(messageID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(target))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether sig is the signature of target for messageID
+func (t *Tracker) Verify(messageID, target, sig string) bool {
+	expected := t.Sign(messageID, target)
+	return hmac.Equal([]byte(expected), []byte(sig))
+}
+
+// InstrumentHTML rewrites absolute links through the click redirect and adds
+// the open pixel before </body> (or at the end when there is none)
+func (t *Tracker) InstrumentHTML(messageID, body string) string {
+	body = trackedLinkPattern.ReplaceAllStringFunc(body, func(match string) string {
+		parts := trackedLinkPattern.FindStringSubmatch(match)
+		quoted := parts[2]
+		quote := quoted[:1]
+		target := html.UnescapeString(quoted[1 : len(quoted)-1])
+		if strings.HasPrefix(target, t.baseURL+"/api/v1/track/") {
+			return match
+		}
+		return parts[1] + quote + html.EscapeString(t.ClickURL(messageID, target)) + quote
+	})
+
+	pixel := fmt.Sprintf(`<img src="%s" width="1" height="1" alt="" style="display:none;border:0;" />`, html.EscapeString(t.OpenPixelURL(messageID)))
+	if loc := closingBodyPattern.FindAllStringIndex(body, -1); len(loc) > 0 {
+		last := loc[len(loc)-1][0]
+		return body[:last] + pixel + body[last:]
+	}
+	return body + pixel
+}
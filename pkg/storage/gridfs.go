@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gridFSScheme prefixes the locations of GridFS objects
+const gridFSScheme = "gridfs:"
+
+// GridFSStorage stores files in a MongoDB GridFS bucket, keyed by Object.Key
+type GridFSStorage struct {
+	db         *mongo.Database
+	bucketName string
+}
+
+// NewGridFSStorage creates a storage backed by the named GridFS bucket
+func NewGridFSStorage(db *mongo.Database, bucketName string) *GridFSStorage {
+	return &GridFSStorage{db: db, bucketName: bucketName}
+}
+
+// bucket opens the bucket with ctx's deadline applied. Deadlines are set per
+// bucket, so every operation uses its own.
+func (s *GridFSStorage) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(s.db, options.GridFSBucket().SetName(s.bucketName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GridFS bucket: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetReadDeadline(deadline)
+		bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+// Put uploads content under obj.Key and returns its gridfs: location
+func (s *GridFSStorage) Put(ctx context.Context, obj Object, content io.Reader) (string, error) {
+	if obj.Key == "" {
+		return "", fmt.Errorf("storage key is required")
+	}
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	opts := options.GridFSUpload().SetMetadata(bson.M{"contentType": obj.ContentType})
+	if err := bucket.UploadFromStreamWithID(obj.Key, obj.Filename, content, opts); err != nil {
+		return "", fmt.Errorf("failed to upload %s to GridFS: %w", obj.Filename, err)
+	}
+	return gridFSScheme + obj.Key, nil
+}
+
+// Open streams a stored file. The caller must close it.
+func (s *GridFSStorage) Open(ctx context.Context, location string) (io.ReadCloser, error) {
+	key, err := parseGridFSLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := bucket.OpenDownloadStream(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", location, err)
+	}
+	return stream, nil
+}
+
+// Delete removes a stored file; a missing file is not an error
+func (s *GridFSStorage) Delete(ctx context.Context, location string) error {
+	key, err := parseGridFSLocation(location)
+	if err != nil {
+		return err
+	}
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.DeleteContext(ctx, key); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return fmt.Errorf("failed to delete %s: %w", location, err)
+	}
+	return nil
+}
+
+func parseGridFSLocation(location string) (string, error) {
+	key := strings.TrimPrefix(location, gridFSScheme)
+	if key == location || key == "" {
+		return "", fmt.Errorf("not a GridFS location: %q", location)
+	}
+	return key, nil
+}
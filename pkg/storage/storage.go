@@ -0,0 +1,60 @@
+// Package storage stores file contents (such as message attachments) behind
+// a small interface, so the GridFS backend can be swapped for object storage.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when no object exists at a location
+var ErrNotFound = errors.New("stored object not found")
+
+// ErrInfected is returned by a Scanner that found malware
+var ErrInfected = errors.New("file failed the malware scan")
+
+// Object describes a file being stored
+type Object struct {
+	Key         string // Unique key chosen by the caller, e.g. the attachment ID
+	Filename    string
+	ContentType string
+}
+
+// Storage persists file contents. Put returns an opaque location that is
+// recorded by the caller and later passed to Open and Delete.
+type Storage interface {
+	Put(ctx context.Context, obj Object, content io.Reader) (location string, err error)
+	Open(ctx context.Context, location string) (io.ReadCloser, error)
+	Delete(ctx context.Context, location string) error
+}
+
+// Scanner inspects uploaded content before it is stored. Scan returns
+// ErrInfected (possibly wrapped) to reject a file.
+type Scanner interface {
+	Scan(ctx context.Context, filename string, content []byte) error
+}
+
+// NoopScanner accepts every file. It is the default until a real scanner
+// (e.g. ClamAV) is configured.
+type NoopScanner struct{}
+
+// Scan accepts the file
+func (NoopScanner) Scan(ctx context.Context, filename string, content []byte) error {
+	return nil
+}
+
+// ReadAll loads a whole stored file, for callers that need the bytes (such as
+// attaching the file to an outgoing email)
+func ReadAll(ctx context.Context, s Storage, location string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	reader, err := s.Open(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
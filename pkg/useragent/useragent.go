@@ -0,0 +1,103 @@
+// Package useragent reads the browser, operating system and device type
+// from a User-Agent header. It knows the common browsers and platforms only,
+// which is enough to label sign-ins for the people reviewing them; anything
+// else is reported as "Other".
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// Other names a browser or operating system that is not recognised
+const Other = "Other"
+
+// Info is what a User-Agent header says about the client
+type Info struct {
+	Browser string `json:"browser"` // e.g. "Chrome 126"
+	OS      string `json:"os"`      // e.g. "macOS", "Android 14"
+	Device  string `json:"device"`  // One of the Device constants
+}
+
+// product matches a browser token and its major version, checked in order:
+// Edge, Opera and Samsung Internet also claim to be Chrome, and Chrome
+// claims to be Safari
+type product struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var browsers = []product{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/(\d+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/(\d+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/(\d+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)},
+	{"Safari", regexp.MustCompile(`Version/(\d+)[.\d]* (?:Mobile/\S+ )?Safari/`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)(\d+)`)},
+}
+
+var (
+	androidVersion = regexp.MustCompile(`Android (\d+)`)
+	iosVersion     = regexp.MustCompile(`OS (\d+)[_\d]* like Mac OS X`)
+	botPattern     = regexp.MustCompile(`(?i)bot|crawler|spider|curl/|wget/|python-requests|go-http-client|postman`)
+)
+
+// Parse reads ua, returning Other and DeviceOther for the parts it does not
+// recognise
+func Parse(ua string) Info {
+	info := Info{Browser: Other, OS: Other, Device: DeviceOther}
+	if strings.TrimSpace(ua) == "" {
+		return info
+	}
+
+	for _, b := range browsers {
+		if m := b.pattern.FindStringSubmatch(ua); m != nil {
+			info.Browser = b.name + " " + m[1]
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "Windows"):
+		info.OS, info.Device = "Windows", DeviceDesktop
+	case strings.Contains(ua, "Android"):
+		info.OS = "Android"
+		if m := androidVersion.FindStringSubmatch(ua); m != nil {
+			info.OS += " " + m[1]
+		}
+		info.Device = DeviceTablet
+		if strings.Contains(ua, "Mobile") {
+			info.Device = DeviceMobile
+		}
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		info.OS = "iOS"
+		if m := iosVersion.FindStringSubmatch(ua); m != nil {
+			info.OS += " " + m[1]
+		}
+		info.Device = DeviceMobile
+		if strings.Contains(ua, "iPad") {
+			info.Device = DeviceTablet
+		}
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		info.OS, info.Device = "macOS", DeviceDesktop
+	case strings.Contains(ua, "CrOS"):
+		info.OS, info.Device = "ChromeOS", DeviceDesktop
+	case strings.Contains(ua, "Linux"):
+		info.OS, info.Device = "Linux", DeviceDesktop
+	}
+
+	if botPattern.MatchString(ua) {
+		info.Device = DeviceBot
+	}
+	return info
+}
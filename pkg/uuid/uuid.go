@@ -24,16 +24,31 @@ func MustNewUUID() string {
 	return id
 }
 
-// ValidateUUID checks if a string is a valid UUID format
-func ValidateUUID(id string) (string, error) {
+// canonicalLength is the length of a UUID in its hyphenated 8-4-4-4-12 form
+const canonicalLength = 36
+
+// ValidateUUID checks that id is a UUID in canonical hyphenated form, in
+// either case. Braced, URN and unhyphenated forms are rejected.
+func ValidateUUID(id string) error {
+	_, err := ParseUUID(id)
+	return err
+}
+
+// ParseUUID validates id like ValidateUUID and returns it lowercased, the
+// form IDs are generated and stored in. Handlers query with the returned
+// value so that an ID sent in another case still finds its document.
+func ParseUUID(id string) (string, error) {
 	if id == "" {
 		return "", fmt.Errorf("UUID cannot be empty")
 	}
-	_, err := uuid.FromString(id)
+	if len(id) != canonicalLength {
+		return "", fmt.Errorf("invalid UUID format: expected %d characters, got %d", canonicalLength, len(id))
+	}
+	parsed, err := uuid.FromString(id)
 	if err != nil {
 		return "", fmt.Errorf("invalid UUID format: %w", err)
 	}
-	return id, nil
+	return parsed.String(), nil
 }
 
 // IsEmptyUUID checks if a UUID string is empty
@@ -46,12 +61,13 @@ func UUIDsToStrings(ids []string) []string {
 	return ids
 }
 
-// StringsToUUIDs validates and filters a slice of strings to only valid UUIDs
+// StringsToUUIDs validates and filters a slice of strings to only valid
+// UUIDs, normalized like ParseUUID
 func StringsToUUIDs(strs []string) []string {
 	result := make([]string, 0, len(strs))
 	for _, str := range strs {
-		if _, err := ValidateUUID(str); err == nil {
-			result = append(result, str)
+		if id, err := ParseUUID(str); err == nil {
+			result = append(result, id)
 		}
 	}
 	return result
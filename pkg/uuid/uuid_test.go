@@ -0,0 +1,100 @@
+package uuid
+
+import (
+	"strings"
+	"testing"
+)
+
+const canonical = "0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b"
+
+func TestParseUUIDRejectsNearMisses(t *testing.T) {
+	for _, id := range []string{
+		"",
+		canonical[:31],
+		canonical[:35],
+		canonical + "0",
+		" " + canonical[1:],
+		canonical[:35] + "\n",
+		"0192a3b4c-5d6-7e8f-9a0b-1c2d3e4f5a6b",
+		"0192a3b4-c5d67-e8f-9a0b-1c2d3e4f5a6b",
+		"0192a3b4-c5d6-7e8f-9a0b1-c2d3e4f5a6b",
+		"0192a3b4-c5d6-7e8f-9a0b_1c2d3e4f5a6b",
+		"0192a3b4c5d67e8f9a0b1c2d3e4f5a6b",
+		"{0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b}",
+		"urn:uuid:0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b",
+		"0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6g",
+		"0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6\xff",
+		"not-a-uuid-at-all-but-36-characters",
+	} {
+		if got, err := ParseUUID(id); err == nil {
+			t.Errorf("ParseUUID(%q) = %q, want an error", id, got)
+		}
+		if err := ValidateUUID(id); err == nil {
+			t.Errorf("ValidateUUID(%q) = nil, want an error", id)
+		}
+	}
+}
+
+func TestParseUUIDLowercases(t *testing.T) {
+	for _, id := range []string{
+		canonical,
+		strings.ToUpper(canonical),
+		"0192A3B4-c5d6-7E8F-9a0b-1C2D3e4f5a6b",
+	} {
+		got, err := ParseUUID(id)
+		if err != nil || got != canonical {
+			t.Errorf("ParseUUID(%q) = %q, %v; want %q", id, got, err, canonical)
+		}
+		if err := ValidateUUID(id); err != nil {
+			t.Errorf("ValidateUUID(%q) = %v", id, err)
+		}
+	}
+}
+
+func TestNewUUIDParses(t *testing.T) {
+	id := MustNewUUID()
+	if got, err := ParseUUID(id); err != nil || got != id {
+		t.Errorf("ParseUUID(%q) = %q, %v; a new UUID should already be canonical", id, got, err)
+	}
+}
+
+func TestStringsToUUIDs(t *testing.T) {
+	got := StringsToUUIDs([]string{strings.ToUpper(canonical), "", canonical[:31], "{" + canonical + "}", canonical})
+	if len(got) != 2 || got[0] != canonical || got[1] != canonical {
+		t.Errorf("StringsToUUIDs = %q, want the two valid IDs lowercased", got)
+	}
+}
+
+// FuzzParseUUID checks that whatever ParseUUID accepts is the canonical
+// lowercase form of its input, and parses back to itself
+func FuzzParseUUID(f *testing.F) {
+	for _, seed := range []string{
+		canonical,
+		strings.ToUpper(canonical),
+		canonical[:31],
+		canonical + "0",
+		"{" + canonical + "}",
+		"urn:uuid:" + canonical,
+		strings.ReplaceAll(canonical, "-", ""),
+		"0192a3b4c-5d6-7e8f-9a0b-1c2d3e4f5a6b",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, id string) {
+		got, err := ParseUUID(id)
+		if err != nil {
+			return
+		}
+		if len(got) != canonicalLength || got != strings.ToLower(got) || !strings.EqualFold(got, id) {
+			t.Fatalf("ParseUUID(%q) = %q, want %q lowercased", id, got, id)
+		}
+		for _, i := range []int{8, 13, 18, 23} {
+			if got[i] != '-' {
+				t.Fatalf("ParseUUID(%q) = %q, want hyphens at 8, 13, 18 and 23", id, got)
+			}
+		}
+		if again, err := ParseUUID(got); err != nil || again != got {
+			t.Fatalf("ParseUUID(%q) = %q, %v; want it unchanged", got, again, err)
+		}
+	})
+}
@@ -0,0 +1,327 @@
+// Package xlsx writes Office Open XML spreadsheets one row at a time. Each
+// row goes straight into the zip stream, so memory stays flat however many
+// rows a sheet has; the price is that sheets are written one after the other
+// and a finished sheet cannot be changed. Cells hold text or numbers only,
+// and text is stored inline so a value is never evaluated as a formula.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the MIME type of the written files
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// MaxRows is the most rows a sheet can hold
+const MaxRows = 1048576
+
+// ErrTooManyRows is returned when a sheet would exceed MaxRows
+var ErrTooManyRows = errors.New("xlsx: sheet row limit reached")
+
+// Sheet describes a sheet when it is started
+type Sheet struct {
+	Name         string    // Shown on the tab; at most 31 characters, without []:*?/\
+	Widths       []float64 // Column widths in characters, from column A; 0 keeps the default
+	FreezeHeader bool      // Keep the first row in view while scrolling
+}
+
+// Writer streams a workbook to an io.Writer. Start a sheet, write its rows,
+// then start the next one; Close writes the workbook parts that list the
+// sheets and must be called for the file to be readable.
+type Writer struct {
+	buf    *bufio.Writer
+	zip    *zip.Writer
+	sheet  io.Writer
+	names  []string
+	rows   int
+	closed bool
+}
+
+// NewWriter starts a workbook written to w
+func NewWriter(w io.Writer) *Writer {
+	buf := bufio.NewWriter(w)
+	return &Writer{buf: buf, zip: zip.NewWriter(buf)}
+}
+
+// StartSheet ends the current sheet, if any, and starts a new one
+func (w *Writer) StartSheet(sheet Sheet) error {
+	if w.closed {
+		return errors.New("xlsx: writer closed")
+	}
+	name := sheetName(sheet.Name, len(w.names)+1)
+	for _, existing := range w.names {
+		if strings.EqualFold(existing, name) {
+			return fmt.Errorf("xlsx: duplicate sheet name %q", name)
+		}
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	part, err := w.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.names)+1))
+	if err != nil {
+		return err
+	}
+	w.names = append(w.names, name)
+	w.sheet = part
+	w.rows = 0
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"`)
+	if len(w.names) == 1 {
+		b.WriteString(` tabSelected="1"`)
+	}
+	b.WriteString(`>`)
+	if sheet.FreezeHeader {
+		b.WriteString(`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft" activeCell="A2" sqref="A2"/>`)
+	}
+	b.WriteString(`</sheetView></sheetViews>`)
+	if hasWidths(sheet.Widths) {
+		b.WriteString(`<cols>`)
+		for i, width := range sheet.Widths {
+			if width > 0 {
+				fmt.Fprintf(&b, `<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, strconv.FormatFloat(width, 'f', -1, 64))
+			}
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	_, err = io.WriteString(w.sheet, b.String())
+	return err
+}
+
+// WriteHeader writes a row of bold text cells
+func (w *Writer) WriteHeader(titles ...string) error {
+	values := make([]interface{}, len(titles))
+	for i, title := range titles {
+		values[i] = title
+	}
+	return w.writeRow(values, styleBold)
+}
+
+// WriteRow writes a row to the current sheet. Strings are written as text;
+// integers and floats as numbers; a time.Time as text in RFC 3339, UTC, or
+// empty when zero; a nil or anything else as an empty cell.
+func (w *Writer) WriteRow(values ...interface{}) error {
+	return w.writeRow(values, styleNone)
+}
+
+// Rows returns how many rows the current sheet has
+func (w *Writer) Rows() int {
+	return w.rows
+}
+
+// Close ends the last sheet, writes the workbook and flushes it. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if len(w.names) == 0 {
+		if err := w.StartSheet(Sheet{}); err != nil {
+			return err
+		}
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	w.closed = true
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", w.contentTypes()},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", w.workbook()},
+		{"xl/_rels/workbook.xml.rels", w.workbookRels()},
+		{"xl/styles.xml", styles},
+	}
+	for _, part := range parts {
+		file, err := w.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+	if err := w.zip.Close(); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+// Cell styles, as indexes into cellXfs of styles
+const (
+	styleNone = 0
+	styleBold = 1
+)
+
+func (w *Writer) writeRow(values []interface{}, style int) error {
+	if w.sheet == nil {
+		return errors.New("xlsx: no sheet started")
+	}
+	if w.rows >= MaxRows {
+		return ErrTooManyRows
+	}
+	w.rows++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(w.rows)
+		styleAttr := ""
+		if style != styleNone {
+			styleAttr = fmt.Sprintf(` s="%d"`, style)
+		}
+		switch v := value.(type) {
+		case string:
+			writeText(&b, ref, styleAttr, v)
+		case time.Time:
+			if !v.IsZero() {
+				writeText(&b, ref, styleAttr, v.UTC().Format(time.RFC3339))
+			}
+		case int:
+			fmt.Fprintf(&b, `<c r="%s"%s><v>%d</v></c>`, ref, styleAttr, v)
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s"%s><v>%d</v></c>`, ref, styleAttr, v)
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"%s><v>%s</v></c>`, ref, styleAttr, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			fmt.Fprintf(&b, `<c r="%s"%s t="b"><v>%s</v></c>`, ref, styleAttr, boolValue(v))
+		}
+	}
+	b.WriteString(`</row>`)
+	_, err := io.WriteString(w.sheet, b.String())
+	return err
+}
+
+// writeText writes an inline string cell, leaving out empty ones
+func writeText(b *strings.Builder, ref, styleAttr, text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">`, ref, styleAttr)
+	// EscapeText replaces the characters XML cannot hold, such as most
+	// control characters, so user-supplied text cannot break the file
+	xml.EscapeText(b, []byte(text))
+	b.WriteString(`</t></is></c>`)
+}
+
+func (w *Writer) endSheet() error {
+	if w.sheet == nil {
+		return nil
+	}
+	_, err := io.WriteString(w.sheet, `</sheetData></worksheet>`)
+	w.sheet = nil
+	return err
+}
+
+func (w *Writer) contentTypes() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range w.names {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func (w *Writer) workbook() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, name := range w.names {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func (w *Writer) workbookRels() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range w.names {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.names)+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// styles holds the default cell format and a bold one for headers
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// columnName returns the letters of the zero-based column index: A, B, ...
+// Z, AA, AB and so on
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// sheetName drops the characters a sheet name cannot hold and shortens it
+// to 31 characters, falling back to "Sheet<n>"
+func sheetName(name string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		name = "Sheet" + strconv.Itoa(n)
+	}
+	return name
+}
+
+func hasWidths(widths []float64) bool {
+	for _, width := range widths {
+		if width > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func boolValue(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,166 @@
+package xlsx_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/white/user-management/pkg/xlsx"
+	"github.com/white/user-management/pkg/xlsx/xlsxtest"
+)
+
+// TestWriterRoundTrip writes a workbook of two sheets and reads it back
+func TestWriterRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	w := xlsx.NewWriter(&out)
+	if err := w.StartSheet(xlsx.Sheet{Name: "Team: Q1/Q2", Widths: []float64{20, 0, 12}, FreezeHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	joined := time.Date(2026, 3, 4, 9, 30, 0, 0, time.FixedZone("IST", 19800))
+	rows := [][]interface{}{
+		{"Dana <dana@example.com>", 42, int64(7), 2.5, true, joined},
+		{"=HYPERLINK(\"https://evil.example\")", "", nil, time.Time{}, false, struct{}{}},
+		{"Tom & Jerry\x01", "  spaced  "},
+	}
+	if err := w.WriteHeader("Name", "Count", "Total", "Ratio", "Active", "Joined"); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Rows() != 4 {
+		t.Errorf("Rows = %d, want 4", w.Rows())
+	}
+	if err := w.StartSheet(xlsx.Sheet{Name: "Summary"}); err != nil {
+		t.Fatal(err)
+	}
+	wide := make([]interface{}, 28)
+	for i := range wide {
+		wide[i] = i
+	}
+	if err := w.WriteRow(wide...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	workbook, err := xlsxtest.Read(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workbook.Sheets) != 2 || workbook.Sheets[0].Name != "Team Q1Q2" || workbook.Sheets[1].Name != "Summary" {
+		t.Fatalf("sheets = %+v, want Team Q1Q2 and Summary", workbook.Sheets)
+	}
+	team := workbook.Sheets[0]
+	want := [][]string{
+		{"Name", "Count", "Total", "Ratio", "Active", "Joined"},
+		{"Dana <dana@example.com>", "42", "7", "2.5", "1", "2026-03-04T04:00:00Z"},
+		// Text that looks like a formula stays text; unsupported values are left out
+		{"=HYPERLINK(\"https://evil.example\")", "", "", "", "0"},
+		{"Tom & Jerry�", "  spaced  "},
+	}
+	if !slices.EqualFunc(team.Rows, want, slices.Equal[[]string]) {
+		t.Errorf("rows = %q, want %q", team.Rows, want)
+	}
+	if !team.FrozenHeader {
+		t.Error("header row not frozen")
+	}
+	summary := workbook.Sheets[1]
+	if summary.FrozenHeader || len(summary.Rows) != 1 || len(summary.Rows[0]) != 28 || summary.Rows[0][27] != "27" {
+		t.Errorf("summary = %+v, want one row of 28 cells out to column AB", summary)
+	}
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct{ n int }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// TestWriterStreams writes 50,000 rows and checks the file went out as the
+// rows were written rather than when the workbook was closed
+func TestWriterStreams(t *testing.T) {
+	const rows = 50000
+	var out bytes.Buffer
+	counted := &countingWriter{}
+	w := xlsx.NewWriter(io.MultiWriter(&out, counted))
+	if err := w.StartSheet(xlsx.Sheet{Name: "Rows", FreezeHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteHeader("Row", "Email"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= rows; i++ {
+		if err := w.WriteRow(i, fmt.Sprintf("user%d@example.com", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	beforeClose := counted.n
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if beforeClose < counted.n/2 {
+		t.Errorf("%d of %d bytes written before Close, want most of them", beforeClose, counted.n)
+	}
+
+	workbook, err := xlsxtest.Read(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := workbook.Sheet("Rows")
+	if sheet == nil || len(sheet.Rows) != rows+1 {
+		t.Fatalf("sheet = %v rows, want %d", sheet, rows+1)
+	}
+	if last := sheet.Rows[rows]; last[0] != strconv.Itoa(rows) || last[1] != fmt.Sprintf("user%d@example.com", rows) {
+		t.Errorf("last row = %q", last)
+	}
+}
+
+// TestSheets checks sheet names are cleaned up and kept unique, and that a
+// workbook closed without sheets still opens
+func TestSheets(t *testing.T) {
+	var out bytes.Buffer
+	w := xlsx.NewWriter(&out)
+	for _, sheet := range []xlsx.Sheet{{Name: "  "}, {Name: "A very long sheet name that goes on and on"}} {
+		if err := w.StartSheet(sheet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.StartSheet(xlsx.Sheet{Name: "sheet1"}); err == nil {
+		t.Error("a second sheet named sheet1, want an error")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow("late"); err == nil {
+		t.Error("wrote a row after Close")
+	}
+	workbook, err := xlsxtest.Read(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sheet := range workbook.Sheets {
+		names = append(names, sheet.Name)
+	}
+	if want := []string{"Sheet1", "A very long sheet name that goe"}; !slices.Equal(names, want) {
+		t.Errorf("sheet names = %q, want %q", names, want)
+	}
+
+	out.Reset()
+	if err := xlsx.NewWriter(&out).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if workbook, err := xlsxtest.Read(out.Bytes()); err != nil || len(workbook.Sheets) != 1 || len(workbook.Sheets[0].Rows) != 0 {
+		t.Errorf("empty workbook = %+v, %v, want one empty sheet", workbook, err)
+	}
+}
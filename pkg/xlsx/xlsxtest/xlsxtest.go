@@ -0,0 +1,175 @@
+// Package xlsxtest reads back the workbooks written by package xlsx, for
+// tests that check what an export holds. It understands only what the
+// writer produces: inline text, numbers and booleans, and frozen panes.
+package xlsxtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Workbook is a read workbook, its sheets in tab order
+type Workbook struct {
+	Sheets []*Sheet
+}
+
+// Sheet is a read sheet. Rows holds the text of every cell, empty for
+// cells left out, each row as long as its last cell.
+type Sheet struct {
+	Name         string
+	Rows         [][]string
+	FrozenHeader bool // The first row stays in view
+}
+
+// Sheet returns the sheet called name, or nil
+func (w *Workbook) Sheet(name string) *Sheet {
+	for _, sheet := range w.Sheets {
+		if sheet.Name == name {
+			return sheet
+		}
+	}
+	return nil
+}
+
+// Read reads a workbook from its bytes
+func Read(data []byte) (*Workbook, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		targets[rel.ID] = path.Join("xl", rel.Target)
+	}
+
+	read := &Workbook{}
+	for _, entry := range workbook.Sheets {
+		target, ok := targets[entry.ID]
+		if !ok {
+			return nil, fmt.Errorf("xlsxtest: sheet %q has no part", entry.Name)
+		}
+		sheet, err := readSheet(files, target)
+		if err != nil {
+			return nil, fmt.Errorf("xlsxtest: sheet %q: %w", entry.Name, err)
+		}
+		sheet.Name = entry.Name
+		read.Sheets = append(read.Sheets, sheet)
+	}
+	return read, nil
+}
+
+func readSheet(files map[string]*zip.File, name string) (*Sheet, error) {
+	var worksheet struct {
+		Panes []struct {
+			YSplit int    `xml:"ySplit,attr"`
+			State  string `xml:"state,attr"`
+		} `xml:"sheetViews>sheetView>pane"`
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodePart(files, name, &worksheet); err != nil {
+		return nil, err
+	}
+
+	sheet := &Sheet{}
+	for _, pane := range worksheet.Panes {
+		if pane.State == "frozen" && pane.YSplit == 1 {
+			sheet.FrozenHeader = true
+		}
+	}
+	for i, row := range worksheet.Rows {
+		if row.Number != i+1 {
+			return nil, fmt.Errorf("row %d is numbered %d", i+1, row.Number)
+		}
+		var values []string
+		for _, cell := range row.Cells {
+			column, err := columnIndex(cell.Ref, row.Number)
+			if err != nil {
+				return nil, err
+			}
+			for len(values) <= column {
+				values = append(values, "")
+			}
+			if cell.Type == "inlineStr" {
+				values[column] = cell.Inline
+			} else {
+				values[column] = cell.Value
+			}
+		}
+		sheet.Rows = append(sheet.Rows, values)
+	}
+	return sheet, nil
+}
+
+// columnIndex returns the zero-based column of a cell reference in row,
+// such as 0 for A1 and 27 for AB1
+func columnIndex(ref string, row int) (int, error) {
+	letters := strings.TrimSuffix(ref, strconv.Itoa(row))
+	if letters == "" || letters == ref {
+		return 0, fmt.Errorf("cell %q is not in row %d", ref, row)
+	}
+	index := 0
+	for _, r := range letters {
+		if r < 'A' || r > 'Z' {
+			return 0, fmt.Errorf("invalid cell reference %q", ref)
+		}
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1, nil
+}
+
+func decodePart(files map[string]*zip.File, name string, v interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("xlsxtest: no part %s", name)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("xlsxtest: %s: %w", name, err)
+	}
+	return nil
+}